@@ -0,0 +1,253 @@
+// Copyright 2022 The codesjoy Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package governor
+
+import (
+	"crypto/subtle"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/netip"
+	"os"
+	"slices"
+	"strings"
+)
+
+var (
+	errRemoteNotAllowed    = errors.New("remote address is not allowed")
+	errClientCertRequired  = errors.New("verified client certificate is required")
+	errClientCertForbidden = errors.New("client certificate is not allowed")
+	errUnauthorized        = errors.New("unauthorized")
+)
+
+// authMiddleware guards every governor route. Requests are checked against
+// the IP allowlist first, then the client certificate and finally the token
+// or basic credentials; each configured check must pass.
+func (s *Server) authMiddleware(next http.Handler) http.Handler {
+	if !s.cfg.Auth.Enabled() {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := s.checkRemote(r); err != nil {
+			s.audit(r, "access", err)
+			respErr(w, http.StatusForbidden, err)
+			return
+		}
+		if err := s.checkClientCert(r); err != nil {
+			s.audit(r, "access", err)
+			respErr(w, http.StatusForbidden, err)
+			return
+		}
+		if s.authorize(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		s.audit(r, "access", errUnauthorized)
+		if strings.TrimSpace(s.cfg.Auth.Token) != "" {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+		} else {
+			w.Header().Set("WWW-Authenticate", `Basic realm="governor"`)
+		}
+		respErr(w, http.StatusUnauthorized, errUnauthorized)
+	})
+}
+
+func (s *Server) authorize(r *http.Request) bool {
+	if token := strings.TrimSpace(s.cfg.Auth.Token); token != "" {
+		header := strings.TrimSpace(r.Header.Get("Authorization"))
+		if !strings.HasPrefix(strings.ToLower(header), "bearer ") {
+			return false
+		}
+		received := strings.TrimSpace(header[len("Bearer "):])
+		return secureEqual(received, token)
+	}
+	username := strings.TrimSpace(s.cfg.Auth.Basic.Username)
+	password := strings.TrimSpace(s.cfg.Auth.Basic.Password)
+	if username == "" && password == "" {
+		return true
+	}
+	u, p, ok := r.BasicAuth()
+	if !ok {
+		return false
+	}
+	return secureEqual(strings.TrimSpace(u), username) &&
+		secureEqual(strings.TrimSpace(p), password)
+}
+
+func (s *Server) checkRemote(r *http.Request) error {
+	if len(s.allowedIPs) == 0 {
+		return nil
+	}
+	addr, ok := remoteAddr(r)
+	if !ok {
+		return errRemoteNotAllowed
+	}
+	for _, prefix := range s.allowedIPs {
+		if prefix.Contains(addr) {
+			return nil
+		}
+	}
+	return errRemoteNotAllowed
+}
+
+func (s *Server) checkClientCert(r *http.Request) error {
+	if !s.cfg.Auth.ClientCert.Required {
+		return nil
+	}
+	cert := verifiedClientCert(r)
+	if cert == nil {
+		return errClientCertRequired
+	}
+	allowed := s.cfg.Auth.ClientCert.AllowedNames
+	if len(allowed) == 0 {
+		return nil
+	}
+	for _, name := range certNames(cert) {
+		if slices.Contains(allowed, name) {
+			return nil
+		}
+	}
+	return errClientCertForbidden
+}
+
+// audit records an admin action or a rejected request together with the
+// caller it came from, so operators can trace who changed a running
+// process.
+func (s *Server) audit(r *http.Request, action string, err error, attrs ...any) {
+	args := []any{
+		slog.String("action", action),
+		slog.String("method", r.Method),
+		slog.String("path", r.URL.Path),
+		slog.String("remote", r.RemoteAddr),
+	}
+	if principal := requestPrincipal(r); principal != "" {
+		args = append(args, slog.String("principal", principal))
+	}
+	args = append(args, attrs...)
+	if err != nil {
+		slog.Warn("governor audit", append(args, slog.Any("error", err))...)
+		return
+	}
+	slog.Info("governor audit", args...)
+}
+
+// requestPrincipal names the caller of r from its client certificate or
+// basic auth user. Bearer tokens are shared secrets and carry no identity.
+func requestPrincipal(r *http.Request) string {
+	if cert := verifiedClientCert(r); cert != nil {
+		if names := certNames(cert); len(names) > 0 {
+			return "cert:" + names[0]
+		}
+	}
+	if username, _, ok := r.BasicAuth(); ok {
+		return "basic:" + strings.TrimSpace(username)
+	}
+	return ""
+}
+
+func verifiedClientCert(r *http.Request) *x509.Certificate {
+	if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 || len(r.TLS.VerifiedChains[0]) == 0 {
+		return nil
+	}
+	return r.TLS.VerifiedChains[0][0]
+}
+
+func certNames(cert *x509.Certificate) []string {
+	names := make([]string, 0, 1+len(cert.DNSNames)+len(cert.URIs))
+	if cert.Subject.CommonName != "" {
+		names = append(names, cert.Subject.CommonName)
+	}
+	names = append(names, cert.DNSNames...)
+	for _, uri := range cert.URIs {
+		names = append(names, uri.String())
+	}
+	return names
+}
+
+func remoteAddr(r *http.Request) (netip.Addr, bool) {
+	host, _, err := net.SplitHostPort(strings.TrimSpace(r.RemoteAddr))
+	if err != nil {
+		host = strings.TrimSpace(r.RemoteAddr)
+	}
+	addr, err := netip.ParseAddr(host)
+	if err != nil {
+		return netip.Addr{}, false
+	}
+	return addr.Unmap(), true
+}
+
+func parseAllowedIPs(items []string) ([]netip.Prefix, error) {
+	prefixes := make([]netip.Prefix, 0, len(items))
+	for i, item := range items {
+		item = strings.TrimSpace(item)
+		if strings.Contains(item, "/") {
+			prefix, err := netip.ParsePrefix(item)
+			if err != nil {
+				return nil, fmt.Errorf("allowed_ips[%d]: %q is not a CIDR prefix", i, item)
+			}
+			prefixes = append(prefixes, prefix.Masked())
+			continue
+		}
+		addr, err := netip.ParseAddr(item)
+		if err != nil {
+			return nil, fmt.Errorf("allowed_ips[%d]: %q is not an IP address", i, item)
+		}
+		addr = addr.Unmap()
+		prefixes = append(prefixes, netip.PrefixFrom(addr, addr.BitLen()))
+	}
+	return prefixes, nil
+}
+
+func buildTLSConfig(cfg TLSConfig, requireClientCert bool) (*tls.Config, error) {
+	if !cfg.Enabled() {
+		return nil, nil
+	}
+	cert, err := tls.LoadX509KeyPair(cfg.CertFile, cfg.KeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("load governor tls certificate: %w", err)
+	}
+	tlsCfg := &tls.Config{
+		MinVersion:   tls.VersionTLS12,
+		Certificates: []tls.Certificate{cert},
+	}
+	if cfg.ClientCAFile == "" {
+		return tlsCfg, nil
+	}
+	data, err := os.ReadFile(cfg.ClientCAFile)
+	if err != nil {
+		return nil, fmt.Errorf("read governor tls client ca: %w", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(data) {
+		return nil, fmt.Errorf("governor tls client ca %q holds no certificates", cfg.ClientCAFile)
+	}
+	tlsCfg.ClientCAs = pool
+	tlsCfg.ClientAuth = tls.VerifyClientCertIfGiven
+	if requireClientCert {
+		tlsCfg.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	return tlsCfg, nil
+}
+
+func secureEqual(a, b string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(a), []byte(b)) == 1
+}
@@ -0,0 +1,256 @@
+// Copyright 2022 The codesjoy Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package governor
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"log/slog"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/codesjoy/yggdrasil/v3/config"
+)
+
+func TestConfig_ValidateAuthExtensions(t *testing.T) {
+	cfg := Config{
+		Auth: AuthConfig{
+			AllowedIPs: []string{"10.0.0.0/8", "::1", "not-an-ip"},
+			ClientCert: ClientCertAuthConfig{Required: true},
+		},
+		TLS: TLSConfig{KeyFile: "key.pem"},
+	}
+	err := cfg.Validate()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), `allowed_ips[2]: "not-an-ip" is not an IP address`)
+	assert.Contains(t, err.Error(), "tls: cert_file and key_file must be provided together")
+	assert.Contains(t, err.Error(), "auth: client_cert requires tls.client_ca_file")
+
+	mounted := Config{Mount: "/-/yggdrasil", Auth: AuthConfig{
+		ClientCert: ClientCertAuthConfig{Required: true},
+	}}
+	require.NoError(t, mounted.Validate())
+	assert.True(t, mounted.Auth.Enabled())
+}
+
+func TestAuthAllowedIPs(t *testing.T) {
+	s, err := NewServerWithConfig(Config{
+		Auth: AuthConfig{AllowedIPs: []string{"10.0.0.0/8", "127.0.0.1"}},
+	}, config.NewManager())
+	require.NoError(t, err)
+
+	for remote, expected := range map[string]int{
+		"10.1.2.3:4000":         http.StatusOK,
+		"127.0.0.1:4000":        http.StatusOK,
+		"[::ffff:10.0.0.1]:400": http.StatusOK,
+		"192.168.1.1:4000":      http.StatusForbidden,
+		"garbage":               http.StatusForbidden,
+	} {
+		req := httptest.NewRequest(http.MethodGet, "/routes", nil)
+		req.RemoteAddr = remote
+		rec := httptest.NewRecorder()
+		s.Handler.ServeHTTP(rec, req)
+		assert.Equal(t, expected, rec.Code, remote)
+	}
+}
+
+func TestAuthClientCert(t *testing.T) {
+	s, err := NewServerWithConfig(Config{
+		Mount: "/-/yggdrasil",
+		Auth: AuthConfig{
+			Token: "secret",
+			ClientCert: ClientCertAuthConfig{
+				Required:     true,
+				AllowedNames: []string{"ops"},
+			},
+		},
+	}, config.NewManager())
+	require.NoError(t, err)
+
+	serve := func(cert *x509.Certificate) int {
+		req := httptest.NewRequest(http.MethodGet, "/routes", nil)
+		req.Header.Set("Authorization", "Bearer secret")
+		if cert != nil {
+			req.TLS = &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{cert}}}
+		}
+		rec := httptest.NewRecorder()
+		s.Handler.ServeHTTP(rec, req)
+		return rec.Code
+	}
+	assert.Equal(t, http.StatusForbidden, serve(nil))
+	assert.Equal(t, http.StatusForbidden, serve(&x509.Certificate{
+		Subject: pkix.Name{CommonName: "dev"},
+	}))
+	assert.Equal(t, http.StatusOK, serve(&x509.Certificate{
+		Subject: pkix.Name{CommonName: "ops"},
+	}))
+	assert.Equal(t, http.StatusOK, serve(&x509.Certificate{DNSNames: []string{"ops"}}))
+}
+
+func TestAuditLogsAdminActions(t *testing.T) {
+	var logBuf bytes.Buffer
+	oldLogger := slog.Default()
+	slog.SetDefault(slog.New(slog.NewTextHandler(&logBuf, nil)))
+	t.Cleanup(func() {
+		slog.SetDefault(oldLogger)
+	})
+
+	s, err := NewServerWithConfig(Config{
+		AllowConfigPatch: true,
+		Auth:             AuthConfig{Basic: BasicAuthConfig{Username: "admin", Password: "pw"}},
+	}, config.NewManager())
+	require.NoError(t, err)
+
+	req := httptest.NewRequest(
+		http.MethodPost,
+		"/configs",
+		strings.NewReader(`{"paths":[["app","mode"]],"data":["debug"]}`),
+	)
+	req.SetBasicAuth("admin", "pw")
+	rec := httptest.NewRecorder()
+	s.Handler.ServeHTTP(rec, req)
+	require.Equal(t, http.StatusNoContent, rec.Code)
+
+	req = httptest.NewRequest(http.MethodPost, "/tuning", strings.NewReader(`{}`))
+	req.SetBasicAuth("admin", "pw")
+	rec = httptest.NewRecorder()
+	s.Handler.ServeHTTP(rec, req)
+	require.Equal(t, http.StatusForbidden, rec.Code)
+
+	forbidden := func(w http.ResponseWriter, _ *http.Request) { w.WriteHeader(http.StatusForbidden) }
+	s.HandleAuditedFunc("/degradation", "degradation_override", forbidden)
+	req = httptest.NewRequest(http.MethodDelete, "/degradation", nil)
+	req.SetBasicAuth("admin", "pw")
+	rec = httptest.NewRecorder()
+	s.Handler.ServeHTTP(rec, req)
+	require.Equal(t, http.StatusForbidden, rec.Code)
+
+	req = httptest.NewRequest(http.MethodGet, "/routes", nil)
+	req.SetBasicAuth("admin", "wrong")
+	rec = httptest.NewRecorder()
+	s.Handler.ServeHTTP(rec, req)
+	require.Equal(t, http.StatusUnauthorized, rec.Code)
+
+	logOutput := logBuf.String()
+	assert.Contains(t, logOutput, "level=INFO msg=\"governor audit\" action=config_patch")
+	assert.Contains(t, logOutput, "principal=basic:admin paths=[app.mode]")
+	assert.Contains(t, logOutput, "action=tuning_set")
+	assert.Contains(t, logOutput, "error=\"governor tuning is disabled\"")
+	assert.Contains(t, logOutput, "action=degradation_override method=DELETE")
+	assert.Contains(t, logOutput, "error=forbidden")
+	assert.Contains(t, logOutput, "action=access")
+	assert.Contains(t, logOutput, "error=unauthorized")
+}
+
+func TestServeTLSRequiresClientCert(t *testing.T) {
+	dir := t.TempDir()
+	ca, caKey := newTestCert(t, nil, nil, x509.Certificate{
+		Subject:               pkix.Name{CommonName: "governor-ca"},
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	})
+	writePEM(t, filepath.Join(dir, "ca.pem"), "CERTIFICATE", ca.Raw)
+	server, serverKey := newTestCert(t, ca, caKey, x509.Certificate{
+		Subject:     pkix.Name{CommonName: "governor"},
+		IPAddresses: []net.IP{net.ParseIP("127.0.0.1")},
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	})
+	writePEM(t, filepath.Join(dir, "server.pem"), "CERTIFICATE", server.Raw)
+	writePEM(t, filepath.Join(dir, "server.key"), "PRIVATE KEY", marshalKey(t, serverKey))
+	client, clientKey := newTestCert(t, ca, caKey, x509.Certificate{
+		Subject:     pkix.Name{CommonName: "ops"},
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	})
+
+	s := startGovernor(t, Config{
+		Port: uint64(mustAllocPort(t)),
+		TLS: TLSConfig{
+			CertFile:     filepath.Join(dir, "server.pem"),
+			KeyFile:      filepath.Join(dir, "server.key"),
+			ClientCAFile: filepath.Join(dir, "ca.pem"),
+		},
+		Auth: AuthConfig{ClientCert: ClientCertAuthConfig{Required: true}},
+	}, config.NewManager())
+	require.Equal(t, "https", s.Info().Scheme)
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ca)
+	get := func(certs []tls.Certificate) (*http.Response, error) {
+		httpClient := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{
+			RootCAs:      roots,
+			Certificates: certs,
+		}}}
+		return httpClient.Get("https://" + s.Info().Address + "/routes")
+	}
+	_, err := get(nil)
+	require.Error(t, err)
+
+	resp, err := get([]tls.Certificate{{Certificate: [][]byte{client.Raw}, PrivateKey: clientKey}})
+	require.NoError(t, err)
+	defer func() { _ = resp.Body.Close() }()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+}
+
+func newTestCert(
+	t *testing.T,
+	parent *x509.Certificate,
+	parentKey *ecdsa.PrivateKey,
+	template x509.Certificate,
+) (*x509.Certificate, *ecdsa.PrivateKey) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template.SerialNumber = big.NewInt(time.Now().UnixNano())
+	template.NotBefore = time.Now().Add(-time.Minute)
+	template.NotAfter = time.Now().Add(time.Hour)
+	if parent == nil {
+		parent, parentKey = &template, key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, &template, parent, &key.PublicKey, parentKey)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	return cert, key
+}
+
+func marshalKey(t *testing.T, key *ecdsa.PrivateKey) []byte {
+	t.Helper()
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	require.NoError(t, err)
+	return der
+}
+
+func writePEM(t *testing.T, path, kind string, der []byte) {
+	t.Helper()
+	data := pem.EncodeToMemory(&pem.Block{Type: kind, Bytes: der})
+	require.NoError(t, os.WriteFile(path, data, 0o600))
+}
@@ -35,17 +35,32 @@ type BasicAuthConfig struct {
 	Password string `mapstructure:"password"`
 }
 
+// ClientCertAuthConfig requires governor callers to present a client
+// certificate verified by the TLS listener serving governor.
+type ClientCertAuthConfig struct {
+	Required bool `mapstructure:"required"`
+	// AllowedNames restricts the accepted certificates to those whose common
+	// name, DNS or URI SAN is listed. Empty accepts any verified certificate.
+	AllowedNames []string `mapstructure:"allowed_names"`
+}
+
 // AuthConfig controls governor authentication.
 type AuthConfig struct {
-	Token string          `mapstructure:"token"`
-	Basic BasicAuthConfig `mapstructure:"basic"`
+	Token      string               `mapstructure:"token"`
+	Basic      BasicAuthConfig      `mapstructure:"basic"`
+	ClientCert ClientCertAuthConfig `mapstructure:"client_cert"`
+	// AllowedIPs lists the addresses and CIDR prefixes governor accepts
+	// requests from, matched against the remote address of the connection.
+	AllowedIPs []string `mapstructure:"allowed_ips"`
 }
 
 // Enabled reports whether auth is configured.
 func (a AuthConfig) Enabled() bool {
 	return strings.TrimSpace(a.Token) != "" ||
 		strings.TrimSpace(a.Basic.Username) != "" ||
-		strings.TrimSpace(a.Basic.Password) != ""
+		strings.TrimSpace(a.Basic.Password) != "" ||
+		a.ClientCert.Required ||
+		len(a.AllowedIPs) > 0
 }
 
 // Validate validates auth config consistency.
@@ -61,6 +76,36 @@ func (a AuthConfig) Validate() error {
 	if basicConfigured && (username == "" || password == "") {
 		return errors.New("governor basic auth requires both username and password")
 	}
+	if _, err := parseAllowedIPs(a.AllowedIPs); err != nil {
+		return err
+	}
+	return nil
+}
+
+// TLSConfig serves the standalone governor listener over TLS. A mounted
+// governor uses the TLS settings of the REST server instead.
+type TLSConfig struct {
+	CertFile string `mapstructure:"cert_file"`
+	KeyFile  string `mapstructure:"key_file"`
+	// ClientCAFile verifies client certificates against the CAs it holds.
+	ClientCAFile string `mapstructure:"client_ca_file"`
+}
+
+// Enabled reports whether the governor listener serves TLS.
+func (c TLSConfig) Enabled() bool {
+	return strings.TrimSpace(c.CertFile) != ""
+}
+
+// Validate validates TLS config consistency.
+func (c TLSConfig) Validate() error {
+	certFile := strings.TrimSpace(c.CertFile)
+	keyFile := strings.TrimSpace(c.KeyFile)
+	if (certFile == "") != (keyFile == "") {
+		return errors.New("cert_file and key_file must be provided together")
+	}
+	if certFile == "" && strings.TrimSpace(c.ClientCAFile) != "" {
+		return errors.New("client_ca_file requires cert_file and key_file")
+	}
 	return nil
 }
 
@@ -84,6 +129,17 @@ type Config struct {
 	AllowConfigPatch bool       `mapstructure:"allow_config_patch"`
 	Advertise        bool       `mapstructure:"advertise"`
 	Auth             AuthConfig `mapstructure:"auth"`
+	TLS              TLSConfig  `mapstructure:"tls"`
+
+	// AllowTuning enables writes to the "/tuning" route, which switches
+	// interceptors off and overrides their parameters at runtime.
+	AllowTuning bool `mapstructure:"allow_tuning"`
+
+	// Mount serves the governor routes on the main REST server under this
+	// path prefix, such as "/-/yggdrasil/", instead of on their own port.
+	// Bind, port and the timeouts are ignored while it is set. The routes
+	// then share the public port, so auth must be configured.
+	Mount string `mapstructure:"mount"`
 }
 
 // Address returns address.
@@ -91,6 +147,12 @@ func (c *Config) Address() string {
 	return fmt.Sprintf("%s:%d", c.Bind, c.Port)
 }
 
+// Mounted reports whether the governor routes are served by the main REST
+// server instead of their own listener.
+func (c Config) Mounted() bool {
+	return c.Mount != ""
+}
+
 // IsEnabled reports whether governor should serve.
 func (c Config) IsEnabled() bool {
 	if c.Enabled == nil {
@@ -99,8 +161,50 @@ func (c Config) IsEnabled() bool {
 	return *c.Enabled
 }
 
+// Validate reports the fields holding invalid values, naming their keys.
+// Zero timeouts are valid and replaced by SetDefault.
+func (c *Config) Validate() error {
+	var errs []error
+	if c.Port > 65535 {
+		errs = append(errs, fmt.Errorf("port: %d is out of range", c.Port))
+	}
+	nonNegative := func(key string, value time.Duration) {
+		if value < 0 {
+			errs = append(errs, fmt.Errorf("%s: must not be negative", key))
+		}
+	}
+	nonNegative("read_header_timeout", c.ReadHeaderTimeout)
+	nonNegative("read_timeout", c.ReadTimeout)
+	nonNegative("write_timeout", c.WriteTimeout)
+	nonNegative("idle_timeout", c.IdleTimeout)
+	if err := c.Auth.Validate(); err != nil {
+		errs = append(errs, fmt.Errorf("auth: %w", err))
+	}
+	if err := c.TLS.Validate(); err != nil {
+		errs = append(errs, fmt.Errorf("tls: %w", err))
+	}
+	if c.Auth.ClientCert.Required && strings.TrimSpace(c.Mount) == "" &&
+		strings.TrimSpace(c.TLS.ClientCAFile) == "" {
+		errs = append(errs, errors.New("auth: client_cert requires tls.client_ca_file"))
+	}
+	if mount := strings.TrimSpace(c.Mount); mount != "" {
+		if !strings.HasPrefix(mount, "/") {
+			errs = append(errs, fmt.Errorf("mount: %q must start with /", mount))
+		} else if strings.Trim(mount, "/") == "" {
+			errs = append(errs, errors.New("mount: must not be the root path"))
+		}
+		if !c.Auth.Enabled() {
+			errs = append(errs, errors.New("mount: requires auth to be configured"))
+		}
+	}
+	return errors.Join(errs...)
+}
+
 // SetDefault sets default values and validates settings.
 func (c *Config) SetDefault() error {
+	if err := c.Validate(); err != nil {
+		return err
+	}
 	if c.Enabled == nil {
 		enabled := true
 		c.Enabled = &enabled
@@ -122,7 +226,11 @@ func (c *Config) SetDefault() error {
 	c.Auth.Token = strings.TrimSpace(c.Auth.Token)
 	c.Auth.Basic.Username = strings.TrimSpace(c.Auth.Basic.Username)
 	c.Auth.Basic.Password = strings.TrimSpace(c.Auth.Basic.Password)
-	return c.Auth.Validate()
+	c.TLS.CertFile = strings.TrimSpace(c.TLS.CertFile)
+	c.TLS.KeyFile = strings.TrimSpace(c.TLS.KeyFile)
+	c.TLS.ClientCAFile = strings.TrimSpace(c.TLS.ClientCAFile)
+	c.Mount = strings.TrimSuffix(strings.TrimSpace(c.Mount), "/")
+	return nil
 }
 
 func normalizeGovernorBind(bind, host string) string {
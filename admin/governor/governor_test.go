@@ -21,6 +21,7 @@ import (
 	"log/slog"
 	"net"
 	"net/http"
+	"net/http/httptest"
 	"strconv"
 	"strings"
 	"testing"
@@ -56,6 +57,61 @@ func TestConfig_SetDefault_ValidateAuth(t *testing.T) {
 	assert.Contains(t, err.Error(), "cannot be configured together")
 }
 
+func TestConfig_Validate(t *testing.T) {
+	require.NoError(t, (&Config{}).Validate())
+
+	cfg := Config{Port: 70000, IdleTimeout: -time.Second}
+	err := cfg.Validate()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "port: 70000 is out of range")
+	assert.Contains(t, err.Error(), "idle_timeout: must not be negative")
+	assert.Error(t, cfg.SetDefault())
+}
+
+func TestConfig_Mount(t *testing.T) {
+	for _, mount := range []string{"-/yggdrasil", "/", "//"} {
+		cfg := Config{Mount: mount}
+		err := cfg.Validate()
+		require.Error(t, err, mount)
+		assert.Contains(t, err.Error(), "mount:")
+	}
+
+	cfg := Config{Mount: "/-/yggdrasil"}
+	err := cfg.Validate()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "mount: requires auth to be configured")
+
+	cfg = Config{Mount: " /-/yggdrasil/ ", Auth: AuthConfig{Token: "secret"}}
+	require.NoError(t, cfg.SetDefault())
+	assert.Equal(t, "/-/yggdrasil", cfg.Mount)
+	assert.True(t, cfg.Mounted())
+}
+
+func TestMountedServerDoesNotListen(t *testing.T) {
+	s, err := NewServerWithConfig(Config{
+		Mount:     "/-/yggdrasil/",
+		Advertise: true,
+		Auth:      AuthConfig{Token: "secret"},
+	}, config.NewManager())
+	require.NoError(t, err)
+	require.NoError(t, s.Serve())
+	require.NoError(t, s.WaitStarted(context.Background()))
+	assert.False(t, s.ShouldAdvertise())
+	assert.Equal(t, "/-/yggdrasil", s.MountPrefix())
+
+	handler := s.MountedHandler()
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/-/yggdrasil/routes", nil))
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+
+	req := httptest.NewRequest(http.MethodGet, "/-/yggdrasil/routes", nil)
+	req.Header.Set("Authorization", "Bearer secret")
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), "/configs")
+}
+
 func TestNewServerDoesNotListenUntilServe(t *testing.T) {
 	port := mustAllocPort(t)
 	cfg := Config{Bind: "127.0.0.1", Port: uint64(port)}
@@ -182,6 +238,52 @@ func TestConfigPatchSuccess(t *testing.T) {
 	assert.Equal(t, map[string]any{"flag": true}, payload["app"])
 }
 
+func TestTuning(t *testing.T) {
+	manager := config.NewManager()
+	s := startGovernor(t, Config{AllowTuning: true}, manager)
+	url := "http://" + s.Info().Address + "/tuning"
+	headers := map[string]string{"Content-Type": "application/json"}
+
+	assertStatus(t, "POST", url, `{"disabled":["logging"]}`, headers, http.StatusBadRequest)
+	assertStatus(t, "POST", url, `{}`, headers, http.StatusBadRequest)
+	assertStatus(
+		t,
+		"POST",
+		url,
+		`{"disabled":{"logging":["pkg.Greeter"]},"logging":{"slow_threshold":"200ms"}}`,
+		headers,
+		http.StatusNoContent,
+	)
+	assertStatus(t, "PUT", url, `{"rate_limit":{"rate":50}}`, headers, http.StatusNoContent)
+
+	getTuning := func() map[string]any {
+		resp, err := http.Get(url)
+		require.NoError(t, err)
+		defer func() { _ = resp.Body.Close() }()
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		var payload map[string]any
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&payload))
+		return payload
+	}
+	assert.Equal(t, map[string]any{
+		"disabled":   map[string]any{"logging": []any{"pkg.Greeter"}},
+		"logging":    map[string]any{"slow_threshold": "200ms"},
+		"rate_limit": map[string]any{"rate": float64(50)},
+	}, getTuning())
+
+	assertStatus(t, "DELETE", url, "", nil, http.StatusNoContent)
+	assert.Empty(t, getTuning())
+	assertStatus(t, "PATCH", url, "", nil, http.StatusMethodNotAllowed)
+}
+
+func TestTuningDisabled(t *testing.T) {
+	s := startGovernor(t, Config{}, config.NewManager())
+	url := "http://" + s.Info().Address + "/tuning"
+	assertStatus(t, "GET", url, "", nil, http.StatusOK)
+	assertStatus(t, "POST", url, `{"logging":{"slow_threshold":"1s"}}`, nil, http.StatusForbidden)
+	assertStatus(t, "DELETE", url, "", nil, http.StatusForbidden)
+}
+
 func TestAuthToken(t *testing.T) {
 	s := startGovernor(t, Config{Auth: AuthConfig{Token: "secret"}}, config.NewManager())
 
@@ -15,10 +15,10 @@
 package governor
 
 import (
-	"crypto/subtle"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"log/slog"
 	"net/http"
 	"os"
 	"runtime/debug"
@@ -41,6 +41,35 @@ func (s *Server) HandleFunc(pattern string, handler http.HandlerFunc) {
 	s.routes = append(s.routes, pattern)
 }
 
+// HandleAuditedFunc registers a route like HandleFunc and records every
+// request to it other than GET and HEAD in the audit log under action.
+func (s *Server) HandleAuditedFunc(pattern, action string, handler http.HandlerFunc) {
+	s.HandleFunc(pattern, func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet || r.Method == http.MethodHead {
+			handler(w, r)
+			return
+		}
+		rec := &statusRecorder{ResponseWriter: w, code: http.StatusOK}
+		handler(rec, r)
+		var err error
+		if rec.code >= http.StatusBadRequest {
+			err = errors.New(strings.ToLower(http.StatusText(rec.code)))
+		}
+		s.audit(r, action, err)
+	})
+}
+
+// statusRecorder remembers the status code written by a handler.
+type statusRecorder struct {
+	http.ResponseWriter
+	code int
+}
+
+func (w *statusRecorder) WriteHeader(code int) {
+	w.code = code
+	w.ResponseWriter.WriteHeader(code)
+}
+
 // ErrResponse represents an error response.
 type ErrResponse struct {
 	Code int    `json:"code"`
@@ -62,6 +91,7 @@ func (s *Server) installDefaultRoutes() {
 		s.HandleFunc("/env", s.envHandle)
 	}
 	s.HandleFunc("/configs", s.configHandle)
+	s.HandleFunc("/tuning", s.tuningHandle)
 	if info, ok := debug.ReadBuildInfo(); ok {
 		s.HandleFunc("/build_info", s.newBuildInfoHandle(info))
 	}
@@ -104,7 +134,9 @@ func respNoContent(w http.ResponseWriter) {
 
 func (s *Server) setConfig(w http.ResponseWriter, r *http.Request) {
 	if !s.cfg.AllowConfigPatch {
-		respErr(w, http.StatusForbidden, errors.New("governor config patch is disabled"))
+		err := errors.New("governor config patch is disabled")
+		s.audit(r, "config_patch", err)
+		respErr(w, http.StatusForbidden, err)
 		return
 	}
 	cfg := &setConfigReq{}
@@ -118,7 +150,9 @@ func (s *Server) setConfig(w http.ResponseWriter, r *http.Request) {
 		respErr(w, http.StatusBadRequest, err)
 		return
 	}
-	if err := s.applyConfigPatch(cfg.Paths, cfg.Data); err != nil {
+	err := s.applyConfigPatch(cfg.Paths, cfg.Data)
+	s.audit(r, "config_patch", err, auditPaths(cfg.Paths))
+	if err != nil {
 		respErr(w, http.StatusBadRequest, err)
 		return
 	}
@@ -171,6 +205,21 @@ func (s *Server) applyConfigPatch(paths [][]string, values []any) error {
 	)
 }
 
+// removeConfigPatch drops the patched values under path.
+func (s *Server) removeConfigPatch(path []string) error {
+	s.configPatchMu.Lock()
+	defer s.configPatchMu.Unlock()
+	deleteNestedValue(s.configPatchData, path)
+	if s.manager == nil {
+		return errors.New("config manager is not configured")
+	}
+	return s.manager.LoadLayer(
+		"governor.config_patch",
+		config.PriorityOverride,
+		memory.NewSource("governor.config_patch", s.configPatchData),
+	)
+}
+
 func validateConfigPatchRequest(paths [][]string, values []any) error {
 	if len(paths) != len(values) {
 		return errors.New("the quantity of path and value does not match")
@@ -192,6 +241,14 @@ func validateConfigPatchRequest(paths [][]string, values []any) error {
 	return nil
 }
 
+func auditPaths(paths [][]string) slog.Attr {
+	keys := make([]string, 0, len(paths))
+	for _, path := range paths {
+		keys = append(keys, strings.Join(path, "."))
+	}
+	return slog.Any("paths", keys)
+}
+
 func setNestedValue(dst map[string]any, path []string, val any) {
 	if len(path) == 0 {
 		return
@@ -199,49 +256,16 @@ func setNestedValue(dst map[string]any, path []string, val any) {
 	config.SetPath(dst, val, path...)
 }
 
-func (s *Server) authMiddleware(next http.Handler) http.Handler {
-	if !s.cfg.Auth.Enabled() {
-		return next
-	}
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		if s.authorize(r) {
-			next.ServeHTTP(w, r)
+func deleteNestedValue(dst map[string]any, path []string) {
+	for i, key := range path {
+		if i == len(path)-1 {
+			delete(dst, key)
 			return
 		}
-		if strings.TrimSpace(s.cfg.Auth.Token) != "" {
-			w.Header().Set("WWW-Authenticate", "Bearer")
-		} else {
-			w.Header().Set("WWW-Authenticate", `Basic realm="governor"`)
-		}
-		respErr(w, http.StatusUnauthorized, errors.New("unauthorized"))
-	})
-}
-
-func (s *Server) authorize(r *http.Request) bool {
-	if token := strings.TrimSpace(s.cfg.Auth.Token); token != "" {
-		header := strings.TrimSpace(r.Header.Get("Authorization"))
-		if !strings.HasPrefix(strings.ToLower(header), "bearer ") {
-			return false
+		next, ok := dst[key].(map[string]any)
+		if !ok {
+			return
 		}
-		received := strings.TrimSpace(header[len("Bearer "):])
-		return secureEqual(received, token)
-	}
-	username := strings.TrimSpace(s.cfg.Auth.Basic.Username)
-	password := strings.TrimSpace(s.cfg.Auth.Basic.Password)
-	if username == "" && password == "" {
-		return true
-	}
-	u, p, ok := r.BasicAuth()
-	if !ok {
-		return false
-	}
-	return secureEqual(strings.TrimSpace(u), username) &&
-		secureEqual(strings.TrimSpace(p), password)
-}
-
-func secureEqual(a, b string) bool {
-	if len(a) != len(b) {
-		return false
+		dst = next
 	}
-	return subtle.ConstantTimeCompare([]byte(a), []byte(b)) == 1
 }
@@ -16,17 +16,21 @@ package governor
 
 import (
 	"context"
+	"crypto/tls"
 	"errors"
 	"fmt"
 	"log/slog"
 	"maps"
 	"net"
 	"net/http"
+	"net/netip"
 	"strconv"
 	"strings"
 	"sync"
 
 	"github.com/codesjoy/yggdrasil/v3/config"
+	"github.com/codesjoy/yggdrasil/v3/config/configdoc"
+	"github.com/codesjoy/yggdrasil/v3/transport/support/handoff"
 )
 
 // ServerInfo contains server info.
@@ -45,8 +49,9 @@ type Server struct {
 	cfg      Config
 	manager  *config.Manager
 
-	mux    *http.ServeMux
-	routes []string
+	mux        *http.ServeMux
+	routes     []string
+	allowedIPs []netip.Prefix
 
 	configPatchMu   sync.Mutex
 	configPatchData map[string]any
@@ -70,18 +75,32 @@ func NewServerWithConfig(cfg Config, manager *config.Manager) (*Server, error) {
 	if err := cfg.SetDefault(); err != nil {
 		return nil, err
 	}
+	slog.Debug("governor config", slog.Any("config", configdoc.Effective(cfg)))
+	allowedIPs, err := parseAllowedIPs(cfg.Auth.AllowedIPs)
+	if err != nil {
+		return nil, err
+	}
+	var tlsCfg *tls.Config
+	if !cfg.Mounted() {
+		tlsCfg, err = buildTLSConfig(cfg.TLS, cfg.Auth.ClientCert.Required)
+		if err != nil {
+			return nil, err
+		}
+	}
 
 	s := &Server{
 		cfg:             cfg,
 		manager:         manager,
 		mux:             http.NewServeMux(),
 		routes:          make([]string, 0, 16),
+		allowedIPs:      allowedIPs,
 		configPatchData: map[string]any{},
 		startedCh:       make(chan struct{}),
 	}
 	s.Server = &http.Server{
 		Addr:              cfg.Address(),
 		Handler:           s.authMiddleware(s.mux),
+		TLSConfig:         tlsCfg,
 		ReadHeaderTimeout: cfg.ReadHeaderTimeout,
 		ReadTimeout:       cfg.ReadTimeout,
 		WriteTimeout:      cfg.WriteTimeout,
@@ -89,7 +108,7 @@ func NewServerWithConfig(cfg Config, manager *config.Manager) (*Server, error) {
 	}
 	s.setInfo(ServerInfo{
 		Address: cfg.Address(),
-		Scheme:  "http",
+		Scheme:  s.scheme(),
 		Attr:    map[string]string{},
 	})
 	s.installDefaultRoutes()
@@ -103,6 +122,11 @@ func (s *Server) Serve() error {
 		return nil
 	}
 	s.warnIfUnauthenticatedExposure()
+	if s.cfg.Mounted() {
+		slog.Info("governor mounted on the rest server", "prefix", s.cfg.Mount)
+		s.markStarted(nil)
+		return nil
+	}
 	listener, err := s.listen()
 	if err != nil {
 		s.markStarted(err)
@@ -131,7 +155,7 @@ func (s *Server) Serve() error {
 	s.mu.Unlock()
 	s.setInfo(ServerInfo{
 		Address: fmt.Sprintf("%s:%d", host, port),
-		Scheme:  "http",
+		Scheme:  s.scheme(),
 		Attr:    map[string]string{},
 	})
 
@@ -139,7 +163,11 @@ func (s *Server) Serve() error {
 	slog.Info("governor start", "endpoint", fmt.Sprintf("%s://%s", info.Scheme, info.Address))
 	s.markStarted(nil)
 
-	err = s.Server.Serve(listener)
+	if s.TLSConfig != nil {
+		err = s.ServeTLS(listener, "", "")
+	} else {
+		err = s.Server.Serve(listener)
+	}
 	if errors.Is(err, http.ErrServerClosed) {
 		return nil
 	}
@@ -200,10 +228,29 @@ func (s *Server) IsEnabled() bool {
 }
 
 // ShouldAdvertise reports whether governor endpoint should be registered.
+// A mounted governor shares the REST endpoint and is never advertised.
 func (s *Server) ShouldAdvertise() bool {
 	s.mu.Lock()
 	defer s.mu.Unlock()
-	return s.cfg.IsEnabled() && s.cfg.Advertise
+	return s.cfg.IsEnabled() && s.cfg.Advertise && !s.cfg.Mounted()
+}
+
+// MountPrefix returns the path prefix the governor routes are served under
+// on the main REST server, or "" when governor listens on its own port or
+// is disabled.
+func (s *Server) MountPrefix() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.cfg.IsEnabled() {
+		return ""
+	}
+	return s.cfg.Mount
+}
+
+// MountedHandler returns the authenticated governor handler with the mount
+// prefix stripped from request paths, for serving on another mux.
+func (s *Server) MountedHandler() http.Handler {
+	return http.StripPrefix(s.MountPrefix(), s.Server.Handler)
 }
 
 func (s *Server) listen() (net.Listener, error) {
@@ -212,8 +259,14 @@ func (s *Server) listen() (net.Listener, error) {
 	if s.listener != nil {
 		return nil, errors.New("governor already serve")
 	}
-	lc := net.ListenConfig{}
-	return lc.Listen(context.Background(), "tcp4", s.cfg.Address())
+	return handoff.Listen(context.Background(), "tcp4", s.cfg.Address())
+}
+
+func (s *Server) scheme() string {
+	if s.TLSConfig != nil {
+		return "https"
+	}
+	return "http"
 }
 
 func (s *Server) markStarted(err error) {
@@ -238,7 +291,7 @@ func (s *Server) warnIfUnauthenticatedExposure() {
 	if s.cfg.Auth.Enabled() {
 		return
 	}
-	exposed := make([]string, 0, 3)
+	exposed := make([]string, 0, 4)
 	if s.cfg.ExposePprof {
 		exposed = append(exposed, "pprof")
 	}
@@ -248,6 +301,9 @@ func (s *Server) warnIfUnauthenticatedExposure() {
 	if s.cfg.AllowConfigPatch {
 		exposed = append(exposed, "config_patch")
 	}
+	if s.cfg.AllowTuning {
+		exposed = append(exposed, "tuning")
+	}
 	if len(exposed) == 0 {
 		return
 	}
@@ -256,6 +312,6 @@ func (s *Server) warnIfUnauthenticatedExposure() {
 		"routes",
 		strings.Join(exposed, ","),
 		"suggestion",
-		"configure governor.auth.token or governor.auth.basic credentials",
+		"configure governor.auth credentials, client certificates or allowed_ips",
 	)
 }
@@ -0,0 +1,122 @@
+// Copyright 2022 The codesjoy Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package governor
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/codesjoy/yggdrasil/v3/rpc/interceptor/tuning"
+)
+
+var (
+	tuningPath        = strings.Split(tuning.ConfigPath, ".")
+	errTuningDisabled = errors.New("governor tuning is disabled")
+)
+
+// tuningHandle serves the runtime tuning. GET returns the effective tuning,
+// POST and PUT merge a partial tuning into the governor config patch and
+// DELETE drops every tuning written through the governor. Writes apply once
+// the application reloads its configuration.
+func (s *Server) tuningHandle(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		s.getTuning(w, r)
+	case http.MethodPut, http.MethodPost:
+		s.setTuning(w, r)
+	case http.MethodDelete:
+		s.resetTuning(w, r)
+	default:
+		w.Header().Set("Allow", "GET, POST, PUT, DELETE")
+		respErr(w, http.StatusMethodNotAllowed, errors.New("method not allowed"))
+	}
+}
+
+func (s *Server) getTuning(w http.ResponseWriter, r *http.Request) {
+	value := map[string]any{}
+	if s.manager != nil {
+		if current := s.manager.Section(tuningPath...).Map(); current != nil {
+			value = current
+		}
+	}
+	respSuccess(w, r, value)
+}
+
+func (s *Server) setTuning(w http.ResponseWriter, r *http.Request) {
+	if !s.cfg.AllowTuning {
+		s.audit(r, "tuning_set", errTuningDisabled)
+		respErr(w, http.StatusForbidden, errTuningDisabled)
+		return
+	}
+	req := map[string]any{}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respErr(w, http.StatusBadRequest, err)
+		return
+	}
+	if err := tuning.Validate(req); err != nil {
+		respErr(w, http.StatusBadRequest, err)
+		return
+	}
+	var (
+		paths  [][]string
+		values []any
+	)
+	collectLeaves(req, tuningPath, func(path []string, value any) {
+		paths = append(paths, path)
+		values = append(values, value)
+	})
+	if len(paths) == 0 {
+		respErr(w, http.StatusBadRequest, errors.New("tuning is empty"))
+		return
+	}
+	err := s.applyConfigPatch(paths, values)
+	s.audit(r, "tuning_set", err, auditPaths(paths))
+	if err != nil {
+		respErr(w, http.StatusBadRequest, err)
+		return
+	}
+	respNoContent(w)
+}
+
+func (s *Server) resetTuning(w http.ResponseWriter, r *http.Request) {
+	if !s.cfg.AllowTuning {
+		s.audit(r, "tuning_reset", errTuningDisabled)
+		respErr(w, http.StatusForbidden, errTuningDisabled)
+		return
+	}
+	err := s.removeConfigPatch(tuningPath)
+	s.audit(r, "tuning_reset", err)
+	if err != nil {
+		respErr(w, http.StatusBadRequest, err)
+		return
+	}
+	respNoContent(w)
+}
+
+// collectLeaves calls fn with the path of every non-map value of tree, so a
+// partial tuning only replaces the values it names. Lists, such as the
+// targets of a disabled interceptor, are replaced as a whole.
+func collectLeaves(tree map[string]any, prefix []string, fn func([]string, any)) {
+	for key, value := range tree {
+		path := append(append([]string(nil), prefix...), key)
+		if child, ok := value.(map[string]any); ok {
+			collectLeaves(child, path, fn)
+			continue
+		}
+		fn(path, value)
+	}
+}
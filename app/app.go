@@ -25,18 +25,29 @@ import (
 	"time"
 
 	"github.com/codesjoy/yggdrasil/v3/admin/governor"
+	internalbootstrap "github.com/codesjoy/yggdrasil/v3/app/internal/bootstrap"
 	internallifecycle "github.com/codesjoy/yggdrasil/v3/app/internal/lifecycle"
 	yassembly "github.com/codesjoy/yggdrasil/v3/assembly"
 	"github.com/codesjoy/yggdrasil/v3/config"
+	"github.com/codesjoy/yggdrasil/v3/config/source"
 	"github.com/codesjoy/yggdrasil/v3/discovery/registry"
 	internalidentity "github.com/codesjoy/yggdrasil/v3/internal/identity"
+	"github.com/codesjoy/yggdrasil/v3/internal/xsync"
 	"github.com/codesjoy/yggdrasil/v3/module"
+	"github.com/codesjoy/yggdrasil/v3/rpc/interceptor/mirror"
 	"github.com/codesjoy/yggdrasil/v3/transport/runtime/client"
 	"github.com/codesjoy/yggdrasil/v3/transport/runtime/server"
 )
 
 type lifecycleState uint32
 
+// Config changes are reloaded once no other change arrived for
+// configReloadDebounce, and at most configReloadMaxDelay after the first one.
+const (
+	configReloadDebounce = 100 * time.Millisecond
+	configReloadMaxDelay = time.Second
+)
+
 // InternalServer is managed by the App lifecycle alongside the main server.
 type InternalServer = internallifecycle.InternalServer
 
@@ -60,6 +71,10 @@ func withLifecycleBeforeStartHooks(hooks ...func(context.Context) error) lifecyc
 	return internallifecycle.WithBeforeStartHooks(hooks...)
 }
 
+func withLifecycleAfterStartHooks(hooks ...func(context.Context) error) lifecycleOption {
+	return internallifecycle.WithAfterStartHooks(hooks...)
+}
+
 func withLifecycleBeforeStopHooks(hooks ...func(context.Context) error) lifecycleOption {
 	return internallifecycle.WithBeforeStopHooks(hooks...)
 }
@@ -90,6 +105,18 @@ func withLifecycleIdentity(identity internalidentity.Identity) lifecycleOption {
 	return internallifecycle.WithIdentity(identity)
 }
 
+func withLifecycleEndpointMetadata(protocol string, metadata map[string]string) lifecycleOption {
+	return internallifecycle.WithEndpointMetadata(protocol, metadata)
+}
+
+func withLifecycleReadinessChecks(checks ...func(context.Context) error) lifecycleOption {
+	return internallifecycle.WithReadinessChecks(checks...)
+}
+
+func withLifecycleWorkers(workers ...internallifecycle.Worker) lifecycleOption {
+	return internallifecycle.WithWorkers(workers...)
+}
+
 func withLifecycleShutdownTimeout(timeout time.Duration) lifecycleOption {
 	return internallifecycle.WithShutdownTimeout(timeout)
 }
@@ -139,8 +166,10 @@ type App struct {
 	tracerShutdown             func(context.Context) error
 	meterShutdown              func(context.Context) error
 	processDefaultsLease       *processDefaultsLease
+	mirrorTargets              *mirror.Targets
 
 	runtime            Runtime
+	clients            clientRegistry
 	lastPlanResult     *yassembly.Result
 	lastSpecDiff       *yassembly.SpecDiff
 	lastPlanHash       string
@@ -265,14 +294,6 @@ func (a *App) stopResources(ctx context.Context) error {
 	return err
 }
 
-func (a *App) reloadAsync() {
-	go func() {
-		if err := a.Reload(context.Background()); err != nil {
-			slog.Error("auto reload failed", slog.Any("error", err))
-		}
-	}()
-}
-
 // Start initializes and runs the application.
 func (a *App) Start(ctx context.Context) (err error) {
 	a.mu.Lock()
@@ -283,6 +304,7 @@ func (a *App) Start(ctx context.Context) (err error) {
 	done := a.waitDone
 	a.state = lifecycleStateRunning
 	a.mu.Unlock()
+	a.logBanner()
 
 	go func(waitDone chan struct{}) {
 		_ = waitDone
@@ -319,8 +341,15 @@ func (a *App) Stop(ctx context.Context) error {
 	return a.stopResources(ctx)
 }
 
-// NewClient creates a client for target service.
-func (a *App) NewClient(ctx context.Context, name string) (client.Client, error) {
+// NewClient creates a client for target, a bare service name or a
+// scheme://authority/endpoint URI such as "dns:///orders:443",
+// "etcd://east/orders" or "unix:/tmp/app.sock". Options override the
+// configured client settings.
+func (a *App) NewClient(
+	ctx context.Context,
+	name string,
+	opts ...client.Option,
+) (client.Client, error) {
 	if ctx == nil {
 		return nil, errors.New("client context is nil")
 	}
@@ -331,11 +360,13 @@ func (a *App) NewClient(ctx context.Context, name string) (client.Client, error)
 	}
 	a.mu.Unlock()
 
-	cli, err := client.New(ctx, name, a.currentRuntimeSnapshot())
+	cli, err := client.New(ctx, name, a.currentRuntimeSnapshot(), opts...)
 	if err != nil {
 		return nil, err
 	}
-	return cli, nil
+	tracked := &trackedClient{Client: cli, registry: &a.clients}
+	a.clients.add(tracked)
+	return tracked, nil
 }
 
 func (a *App) initializeLocked(ctx context.Context) (err error) {
@@ -379,6 +410,7 @@ func (a *App) initializeLocked(ctx context.Context) (err error) {
 			err = errors.Join(err, wrapped)
 		}
 	}()
+	source.SetVariables(internalbootstrap.ConfigVariables(a.name))
 	if err = initConfigChain(a.opts); err != nil {
 		err = wrapAssemblyStageError("prepare", err)
 		return err
@@ -441,13 +473,24 @@ func (a *App) installConfigWatchLocked() {
 		return
 	}
 	first := true
-	a.stopWatch = a.opts.configManager.Watch(nil, func(config.Snapshot) {
+	// Layers often change in bursts, e.g. an editor writing a file twice;
+	// they are coalesced into one reload.
+	reload := xsync.NewDebouncer(configReloadDebounce, configReloadMaxDelay, func() {
+		if err := a.Reload(context.Background()); err != nil {
+			slog.Error("auto reload failed", slog.Any("error", err))
+		}
+	})
+	stop := a.opts.configManager.Watch(nil, func(config.Snapshot) {
 		if first {
 			first = false
 			return
 		}
-		a.reloadAsync()
+		reload.Trigger()
 	})
+	a.stopWatch = func() {
+		stop()
+		reload.Stop()
+	}
 	a.watchStarted = true
 }
 
@@ -465,6 +508,9 @@ func (a *App) initHub(ctx context.Context) error {
 	a.hub.SetCapabilityBindings(
 		selectedCapabilityBindings(a.lastPlanResult, a.opts.resolvedSettings),
 	)
+	if err := validateConfig(a.opts, modules); err != nil {
+		return err
+	}
 	if err := a.hub.Init(ctx, a.opts.configManager.Snapshot()); err != nil {
 		return err
 	}
@@ -476,6 +522,7 @@ func (a *App) initHub(ctx context.Context) error {
 		withLifecycleCleanup("module_hub", func(ctx context.Context) error {
 			return a.hub.Stop(ctx)
 		}),
+		withLifecycleReadinessChecks(a.hub.CheckHealth),
 	)
 	return nil
 }
@@ -30,6 +30,7 @@ import (
 	"github.com/codesjoy/yggdrasil/v3/config"
 	"github.com/codesjoy/yggdrasil/v3/config/source/memory"
 	"github.com/codesjoy/yggdrasil/v3/module"
+	"github.com/codesjoy/yggdrasil/v3/rpc/status"
 )
 
 func TestNewOptionError(t *testing.T) {
@@ -146,6 +147,41 @@ func TestModuleHubEndpointIncludesBindings(t *testing.T) {
 	requireAsyncNoError(t, errCh, "governor serve goroutine did not exit")
 }
 
+func TestReasonsEndpointListsCatalog(t *testing.T) {
+	app, _ := newInitializedAppWithConfig(t, "reasons-endpoint", minimalV3Config("grpc"))
+	t.Cleanup(func() {
+		_ = app.opts.governor.Stop()
+		_ = app.Stop(context.Background())
+	})
+	status.RegisterReasonEntries(status.ReasonEntry{
+		Domain: "test.reasons",
+		Reason: "WIDGET_MISSING",
+		Code:   "NOT_FOUND",
+	})
+
+	errCh := serveGovernorAsync(t, app.opts.governor)
+	waitGovernorStarted(t, app.opts.governor)
+
+	resp, err := http.Get("http://" + app.opts.governor.Info().Address + "/reasons")
+	require.NoError(t, err)
+	defer func() { _ = resp.Body.Close() }()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	var body struct {
+		Reasons []status.ReasonEntry `json:"reasons"`
+	}
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&body))
+	require.Contains(t, body.Reasons, status.ReasonEntry{
+		Domain:   "test.reasons",
+		Reason:   "WIDGET_MISSING",
+		Code:     "NOT_FOUND",
+		HTTPCode: http.StatusNotFound,
+	})
+
+	require.NoError(t, app.opts.governor.Stop())
+	requireAsyncNoError(t, errCh, "governor serve goroutine did not exit")
+}
+
 func TestReloadUpdatesCapabilityBindingsAndMarksRestartRequired(t *testing.T) {
 	app, manager := newInitializedAppWithConfig(t, "binding-reload", minimalV3Config("grpc"))
 	t.Cleanup(func() {
@@ -324,17 +360,6 @@ func TestApp_StopConfigWatchLocked(t *testing.T) {
 	})
 }
 
-// --- reloadAsync ---
-
-func TestApp_ReloadAsync(t *testing.T) {
-	t.Run("does not panic on stopped app", func(t *testing.T) {
-		app := newTestApp(t, "test")
-		// reloadAsync launches a goroutine that calls Reload
-		// Just ensure it doesn't panic
-		app.reloadAsync()
-	})
-}
-
 // --- Phase 6 Governor ---
 
 func TestPhase6GovernorServeStopsCleanly(t *testing.T) {
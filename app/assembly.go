@@ -19,11 +19,24 @@ import (
 	"encoding/json"
 	"errors"
 	"net/http"
+	"slices"
+	"time"
 
 	internalassembly "github.com/codesjoy/yggdrasil/v3/app/internal/assembly"
 	yassembly "github.com/codesjoy/yggdrasil/v3/assembly"
+	"github.com/codesjoy/yggdrasil/v3/degrade"
 	"github.com/codesjoy/yggdrasil/v3/internal/settings"
 	"github.com/codesjoy/yggdrasil/v3/module"
+	"github.com/codesjoy/yggdrasil/v3/observability/channelz"
+	"github.com/codesjoy/yggdrasil/v3/observability/process"
+	statsotel "github.com/codesjoy/yggdrasil/v3/observability/stats/otel"
+	"github.com/codesjoy/yggdrasil/v3/observability/stats/slowrpc"
+	"github.com/codesjoy/yggdrasil/v3/operations"
+	"github.com/codesjoy/yggdrasil/v3/outbox"
+	"github.com/codesjoy/yggdrasil/v3/rpc/interceptor/tuning"
+	"github.com/codesjoy/yggdrasil/v3/rpc/status"
+	"github.com/codesjoy/yggdrasil/v3/tenant"
+	"github.com/codesjoy/yggdrasil/v3/transport/runtime/client"
 	"github.com/codesjoy/yggdrasil/v3/transport/runtime/server"
 )
 
@@ -50,6 +63,11 @@ func (a *App) plannedModules() []module.Module {
 		statsOtelCapabilityModule{},
 		foundationRuntimeModule{app: a},
 		connectivityRuntimeModule{app: a},
+		tenant.Module(),
+		tuning.Module(),
+		process.Module(),
+		statsotel.TracingModule(),
+		operations.Module(),
 	)
 	for _, reg := range a.opts.capabilityRegistrations {
 		mods = append(mods, capabilityRegistrationModule{reg: reg})
@@ -260,6 +278,22 @@ func (a *App) installDiagnosticsRoutes() {
 	a.opts.governor.HandleFunc("/module-hub", func(w http.ResponseWriter, r *http.Request) {
 		writeDiagnosticsJSON(w, r, a.hub.Diagnostics())
 	})
+	a.opts.governor.HandleFunc("/stats/slow", slowrpc.Default().ServeHTTP)
+	a.opts.governor.HandleAuditedFunc(
+		"/degradation",
+		"degradation_override",
+		degrade.Default().ServeHTTP,
+	)
+	a.opts.governor.HandleFunc("/info", a.infoHandle)
+	a.opts.governor.HandleFunc("/healthz", livenessHandle)
+	a.opts.governor.HandleFunc("/readyz", a.readinessHandle)
+	a.opts.governor.HandleFunc("/clients", clientStatusHandle)
+	a.opts.governor.HandleFunc("/outbox", outboxStatusHandle)
+	channelz.Default().SetListeners(a.channelzListeners)
+	a.opts.governor.HandleFunc("/channelz", channelz.Default().ServeHTTP)
+	a.opts.governor.HandleFunc("/reasons", func(w http.ResponseWriter, r *http.Request) {
+		writeDiagnosticsJSON(w, r, map[string]any{"reasons": status.ReasonCatalog()})
+	})
 	a.opts.governor.HandleFunc("/diagnostics", func(w http.ResponseWriter, r *http.Request) {
 		writeDiagnosticsJSON(w, r, map[string]any{
 			"module_hub": a.hub.Diagnostics(),
@@ -268,8 +302,46 @@ func (a *App) installDiagnosticsRoutes() {
 	})
 }
 
+// channelzListeners reports the listen addresses of the App server.
+func (a *App) channelzListeners() []channelz.Listener {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.opts == nil || a.opts.server == nil {
+		return nil
+	}
+	endpoints := a.opts.server.Endpoints()
+	out := make([]channelz.Listener, 0, len(endpoints))
+	for _, item := range endpoints {
+		out = append(out, channelz.Listener{Protocol: item.Protocol(), Address: item.Address()})
+	}
+	return out
+}
+
+// clientStatusHandle serves the connection state of the open clients,
+// optionally narrowed to one target by the target query parameter.
+func clientStatusHandle(w http.ResponseWriter, r *http.Request) {
+	targets := client.Targets()
+	if target := r.URL.Query().Get("target"); target != "" {
+		targets = slices.DeleteFunc(targets, func(item client.TargetStatus) bool {
+			return item.Target != target
+		})
+	}
+	writeDiagnosticsJSON(w, r, map[string]any{"clients": targets})
+}
+
+// outboxStatusHandle serves the status of the running outbox relays.
+func outboxStatusHandle(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 2*time.Second)
+	defer cancel()
+	writeDiagnosticsJSON(w, r, map[string]any{"relays": outbox.Relays(ctx)})
+}
+
 func writeDiagnosticsJSON(w http.ResponseWriter, r *http.Request, resp any) {
-	w.WriteHeader(http.StatusOK)
+	writeStatusJSON(w, r, http.StatusOK, resp)
+}
+
+func writeStatusJSON(w http.ResponseWriter, r *http.Request, code int, resp any) {
+	w.WriteHeader(code)
 	encoder := json.NewEncoder(w)
 	if r.URL.Query().Get("pretty") == "true" {
 		encoder.SetIndent("", "    ")
@@ -19,6 +19,7 @@ import (
 	"encoding/json"
 	"errors"
 	"net/http"
+	"net/http/httptest"
 	"reflect"
 	"sync/atomic"
 	"testing"
@@ -33,6 +34,7 @@ import (
 	"github.com/codesjoy/yggdrasil/v3/config/source/memory"
 	"github.com/codesjoy/yggdrasil/v3/internal/settings"
 	"github.com/codesjoy/yggdrasil/v3/module"
+	"github.com/codesjoy/yggdrasil/v3/rpc/interceptor/tuning"
 	"github.com/codesjoy/yggdrasil/v3/transport/runtime/server"
 )
 
@@ -652,6 +654,52 @@ func TestReloadRuntimeOnlyChangeHotReloadsWithoutBusinessBundle(t *testing.T) {
 	require.Equal(t, module.ReloadPhaseIdle, app.hub.ReloadState().Phase)
 }
 
+func TestReloadAppliesTuningWithInstalledBusiness(t *testing.T) {
+	recorder := newTransportRecorder()
+	manager := newTestManager(t, assemblyTestConfig(false))
+
+	app, err := New("reload-tuning",
+		WithConfigManager(manager), WithModules(testTransportModule{recorder: recorder}),
+	)
+	require.NoError(t, err)
+	require.NoError(
+		t,
+		app.ComposeAndInstall(context.Background(), func(Runtime) (*BusinessBundle, error) {
+			return &BusinessBundle{
+				RPCBindings: []RPCBinding{
+					{
+						ServiceName: testAssemblyServiceName,
+						Desc:        &testAssemblyRPCServiceDesc,
+						Impl:        &testAssemblyServiceImpl{},
+					},
+				},
+			}, nil
+		}),
+	)
+	require.NoError(t, app.Start(context.Background()))
+	waitForChannel(t, recorder.started, 2*time.Second, "tuning reload server did not start")
+	t.Cleanup(func() { _ = app.Stop(context.Background()) })
+	require.False(t, tuning.Disabled("logging", "/pkg.Greeter/SayHello"))
+
+	require.NoError(
+		t,
+		manager.LoadLayer(
+			"override",
+			config.PriorityOverride,
+			memory.NewSource("override", map[string]any{
+				"yggdrasil": map[string]any{
+					"tuning": map[string]any{
+						"disabled": map[string]any{"logging": []any{"pkg.Greeter"}},
+					},
+				},
+			}),
+		),
+	)
+	require.NoError(t, app.Reload(context.Background()))
+	require.Nil(t, app.assemblyErrors.Reload.Err)
+	require.True(t, tuning.Disabled("logging", "/pkg.Greeter/SayHello"))
+}
+
 func TestReloadUpdatesPlanHashesAndDiffDiagnostics(t *testing.T) {
 	recorder := newTransportRecorder()
 	manager := newTestManager(t, map[string]any{
@@ -692,3 +740,58 @@ func TestReloadUpdatesPlanHashesAndDiffDiagnostics(t *testing.T) {
 	require.NotEqual(t, initialHash, app.lastPlanHash)
 	require.Equal(t, initialHash, app.lastStablePlanHash)
 }
+
+func TestClientStatusHandleFiltersByTarget(t *testing.T) {
+	app, _ := newTestAppWithConfig(t, "client-status", map[string]any{
+		"yggdrasil": map[string]any{
+			"clients": map[string]any{
+				"services": map[string]any{
+					"status-svc": map[string]any{
+						"remote": map[string]any{
+							"endpoints": []any{
+								map[string]any{
+									"address":  "127.0.0.1:18080",
+									"protocol": "http",
+								},
+							},
+						},
+					},
+				},
+			},
+			"transports": map[string]any{
+				"http": map[string]any{
+					"client": map[string]any{},
+					"server": map[string]any{},
+				},
+			},
+		},
+	})
+	t.Cleanup(func() { _ = app.Stop(context.Background()) })
+
+	cli, err := app.NewClient(context.Background(), "status-svc")
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = cli.Close() })
+
+	decode := func(query string) []map[string]any {
+		rec := httptest.NewRecorder()
+		clientStatusHandle(rec, httptest.NewRequest(http.MethodGet, "/clients"+query, nil))
+		require.Equal(t, http.StatusOK, rec.Code)
+		var resp struct {
+			Clients []map[string]any `json:"clients"`
+		}
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+		return resp.Clients
+	}
+
+	clients := decode("?target=status-svc")
+	require.Len(t, clients, 1)
+	assert.Equal(t, "status-svc", clients[0]["target"])
+	assert.Empty(t, decode("?target=unknown"))
+}
+
+func TestOutboxStatusHandle(t *testing.T) {
+	rec := httptest.NewRecorder()
+	outboxStatusHandle(rec, httptest.NewRequest(http.MethodGet, "/outbox", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.JSONEq(t, `{"relays":[]}`, rec.Body.String())
+}
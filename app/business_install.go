@@ -186,6 +186,55 @@ func (a *App) InstallBusiness(bundle *BusinessBundle) error {
 	return nil
 }
 
+// RegisterService installs one RPC service binding. Unlike InstallBusiness it
+// may also be called while the App is serving, so optional modules can add
+// their services at runtime; the registry registration is then refreshed to
+// advertise the new service.
+func (a *App) RegisterService(ctx context.Context, binding RPCBinding) error {
+	a.mu.Lock()
+	if a.state < lifecycleStateInitialized || a.state == lifecycleStateStopped {
+		a.mu.Unlock()
+		return yassembly.NewError(
+			yassembly.ErrRuntimeNotReady,
+			"install",
+			"runtime is not ready",
+			nil,
+			nil,
+		)
+	}
+	err := a.installRPCBinding(binding)
+	serving := a.state >= lifecycleStateServing
+	a.mu.Unlock()
+	if err != nil {
+		return internalinstall.WrapError(err)
+	}
+	if serving {
+		return a.lifecycle.RefreshRegistration(ctx)
+	}
+	return nil
+}
+
+// UnregisterService removes an RPC service installed earlier. In-flight calls
+// complete; new calls fail with UNIMPLEMENTED.
+func (a *App) UnregisterService(ctx context.Context, serviceName string) error {
+	a.mu.Lock()
+	if _, ok := a.installedRPCServices[serviceName]; !ok || a.opts == nil || a.opts.server == nil {
+		a.mu.Unlock()
+		return internalinstall.ValidationError(
+			fmt.Sprintf("rpc service %q is not installed", serviceName),
+			nil,
+		)
+	}
+	a.opts.server.UnregisterService(serviceName)
+	delete(a.installedRPCServices, serviceName)
+	serving := a.state >= lifecycleStateServing && a.state != lifecycleStateStopped
+	a.mu.Unlock()
+	if serving {
+		return a.lifecycle.RefreshRegistration(ctx)
+	}
+	return nil
+}
+
 func (a *App) installBundleLocked(bundle *BusinessBundle) error {
 	if bundle == nil {
 		return nil
@@ -20,11 +20,13 @@ import (
 	"net/http"
 	"reflect"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 
 	yassembly "github.com/codesjoy/yggdrasil/v3/assembly"
+	"github.com/codesjoy/yggdrasil/v3/operations"
 )
 
 // --- mock bundleInstaller ---
@@ -276,9 +278,7 @@ func TestApp_InstallBundleLocked(t *testing.T) {
 
 	t.Run("install bundle with RPC binding", func(t *testing.T) {
 		data := minimalV3Config("grpc")
-		data["yggdrasil"].(map[string]any)["transports"].(map[string]any)["http"].(map[string]any)["rest"] = map[string]any{
-			"enabled": true,
-		}
+		data["yggdrasil"].(map[string]any)["transports"].(map[string]any)["http"].(map[string]any)["rest"] = map[string]any{}
 		app, _ := newInitializedAppWithConfig(t, "test-app", data)
 		bundle := &BusinessBundle{
 			RPCBindings: []RPCBinding{
@@ -407,3 +407,57 @@ func TestApp_InstallBusiness_Errors(t *testing.T) {
 		assert.Equal(t, yassembly.ErrRuntimeNotReady, assemblyErr.Code)
 	})
 }
+
+func TestApp_RegistersOperationsService(t *testing.T) {
+	t.Cleanup(func() {
+		require.NoError(t, operations.Default().Configure(operations.Config{
+			Prefix:       "operations",
+			Store:        operations.MemoryStoreName,
+			TTL:          24 * time.Hour,
+			PollInterval: 100 * time.Millisecond,
+		}))
+	})
+	data := minimalV3Config("grpc")
+	data["yggdrasil"].(map[string]any)["operations"] = map[string]any{"enabled": true}
+	app, _ := newInitializedAppWithConfig(t, "test-app", data)
+	assert.Equal(t, []string{operations.ServiceName}, app.opts.server.ServiceNames())
+
+	err := app.RegisterService(context.Background(), RPCBinding{
+		ServiceName: "operations",
+		Desc:        &operations.ServiceDesc,
+		Impl:        operations.NewService(operations.Default()),
+	})
+	var assemblyErr *yassembly.Error
+	require.ErrorAs(t, err, &assemblyErr)
+	assert.Equal(t, yassembly.ErrInstallRegistrationConflict, assemblyErr.Code)
+}
+
+func TestApp_RegisterServiceWhileServing(t *testing.T) {
+	app, _ := newInitializedAppWithConfig(t, "test-app", minimalV3Config("grpc"))
+	app.state = lifecycleStateServing
+	binding := RPCBinding{
+		ServiceName: "test",
+		Desc:        &testAssemblyRPCServiceDesc,
+		Impl:        &testAssemblyServiceImpl{},
+	}
+
+	require.NoError(t, app.RegisterService(context.Background(), binding))
+	assert.Equal(t, []string{testAssemblyServiceName}, app.opts.server.ServiceNames())
+
+	err := app.RegisterService(context.Background(), binding)
+	var assemblyErr *yassembly.Error
+	require.ErrorAs(t, err, &assemblyErr)
+	assert.Equal(t, yassembly.ErrInstallRegistrationConflict, assemblyErr.Code)
+
+	require.NoError(t, app.UnregisterService(context.Background(), testAssemblyServiceName))
+	assert.Empty(t, app.opts.server.ServiceNames())
+	require.ErrorAs(t, app.UnregisterService(context.Background(), testAssemblyServiceName), &assemblyErr)
+	assert.Equal(t, yassembly.ErrInstallValidationFailed, assemblyErr.Code)
+
+	// The service can be installed again after removal.
+	require.NoError(t, app.RegisterService(context.Background(), binding))
+
+	app.state = lifecycleStateStopped
+	require.ErrorAs(t, app.RegisterService(context.Background(), binding), &assemblyErr)
+	assert.Equal(t, yassembly.ErrRuntimeNotReady, assemblyErr.Code)
+}
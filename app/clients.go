@@ -0,0 +1,70 @@
+// Copyright 2022 The codesjoy Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package app
+
+import (
+	"sync"
+
+	"github.com/codesjoy/yggdrasil/v3/transport/runtime/client"
+)
+
+// clientRegistry tracks the clients created by App.NewClient so that reloads
+// can rebuild their interceptor chains.
+type clientRegistry struct {
+	mu      sync.Mutex
+	clients map[*trackedClient]struct{}
+}
+
+func (r *clientRegistry) add(cli *trackedClient) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.clients == nil {
+		r.clients = map[*trackedClient]struct{}{}
+	}
+	r.clients[cli] = struct{}{}
+}
+
+func (r *clientRegistry) remove(cli *trackedClient) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.clients, cli)
+}
+
+// configureInterceptors rebuilds the interceptor chains of the live clients
+// from runtime.
+func (r *clientRegistry) configureInterceptors(runtime client.Runtime) {
+	r.mu.Lock()
+	items := make([]client.Client, 0, len(r.clients))
+	for cli := range r.clients {
+		items = append(items, cli.Client)
+	}
+	r.mu.Unlock()
+	for _, item := range items {
+		if cli, ok := item.(interface{ ConfigureInterceptors(client.Runtime) }); ok {
+			cli.ConfigureInterceptors(runtime)
+		}
+	}
+}
+
+// trackedClient unregisters the client from its registry on Close.
+type trackedClient struct {
+	client.Client
+	registry *clientRegistry
+}
+
+func (c *trackedClient) Close() error {
+	c.registry.remove(c)
+	return c.Client.Close()
+}
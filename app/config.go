@@ -21,10 +21,12 @@ import (
 	"log/slog"
 	"os"
 	"strings"
+	"sync"
 
 	internalbootstrap "github.com/codesjoy/yggdrasil/v3/app/internal/bootstrap"
 	"github.com/codesjoy/yggdrasil/v3/config"
 	configchain "github.com/codesjoy/yggdrasil/v3/config/chain"
+	"github.com/codesjoy/yggdrasil/v3/config/schema"
 	"github.com/codesjoy/yggdrasil/v3/config/source"
 	envsource "github.com/codesjoy/yggdrasil/v3/config/source/env"
 	flagsource "github.com/codesjoy/yggdrasil/v3/config/source/flag"
@@ -37,6 +39,7 @@ const (
 	configFlagName        = internalbootstrap.ConfigFlagName
 	configSourcesEnvName  = internalbootstrap.ConfigSourcesEnvName
 	configSourcesFlagName = internalbootstrap.ConfigSourcesFlagName
+	profilesFlagName      = internalbootstrap.ProfilesFlagName
 	defaultConfigPath     = internalbootstrap.DefaultConfigPath
 )
 
@@ -91,6 +94,7 @@ func loadConfigFile(opts *options, path string, explicit bool) (bool, error) {
 		path,
 		explicit,
 		registry,
+		internalbootstrap.ResolveProfiles(opts.configProfiles)...,
 	)
 	if err != nil {
 		return false, err
@@ -202,7 +206,11 @@ func loadDefaultConfigSources(opts *options) error {
 	}
 	flagSrc := flagsource.NewSourceWithOptions(
 		nil,
-		flagsource.WithIgnoredNames(configFlagName, configSourcesFlagName),
+		flagsource.WithIgnoredNames(
+			configFlagName,
+			configSourcesFlagName,
+			profilesFlagName,
+		),
 	)
 	return loadConfigLayer(
 		opts,
@@ -310,6 +318,32 @@ func validateStartup(opts *options) error {
 	return internalbootstrap.ValidateStartupResolved(resolved)
 }
 
+// frameworkSchema is the schema of the "yggdrasil" config section.
+var frameworkSchema = sync.OnceValue(func() *schema.Schema {
+	return schema.FromStruct(settings.Framework{})
+})
+
+// validateConfig validates the merged config against the framework schema
+// and the registered schemas. Keys under the config paths of the modules
+// are left to their modules unless they registered a schema.
+func validateConfig(opts *options, modules []module.Module) error {
+	if opts == nil || opts.skipConfigValidation || opts.configManager == nil {
+		return nil
+	}
+	tree, _ := opts.configManager.Snapshot().Value().(map[string]any)
+	schemas := schema.Registered()
+	if _, ok := schemas["yggdrasil"]; !ok {
+		schemas["yggdrasil"] = frameworkSchema()
+	}
+	known := make([]string, 0, len(modules))
+	for _, item := range modules {
+		if configurable, ok := item.(module.Configurable); ok {
+			known = append(known, configurable.ConfigPath())
+		}
+	}
+	return schema.ValidateTree(tree, schemas, known...)
+}
+
 func (a *App) resolveIdentityLocked() error {
 	if a == nil || a.opts == nil {
 		return errors.New("app options are not initialized")
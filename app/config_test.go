@@ -27,6 +27,7 @@ import (
 	internalbootstrap "github.com/codesjoy/yggdrasil/v3/app/internal/bootstrap"
 	"github.com/codesjoy/yggdrasil/v3/config"
 	configchain "github.com/codesjoy/yggdrasil/v3/config/chain"
+	"github.com/codesjoy/yggdrasil/v3/config/schema"
 	"github.com/codesjoy/yggdrasil/v3/config/source"
 	"github.com/codesjoy/yggdrasil/v3/config/source/memory"
 	configtest "github.com/codesjoy/yggdrasil/v3/config/testutil"
@@ -513,3 +514,25 @@ func TestResolveIdentityLocked(t *testing.T) {
 		assert.Contains(t, err.Error(), "app name is required")
 	})
 }
+
+func TestInitValidatesConfigAgainstSchemas(t *testing.T) {
+	data := minimalV3Config("grpc")
+	root := data["yggdrasil"].(map[string]any)
+	root["remte"] = map[string]any{"protocol": "grpc"}
+	root["server"].(map[string]any)["default_timeout"] = "1s"
+
+	app, _ := newTestAppWithConfig(t, "config-schema", data)
+	err := app.initializeLocked(context.Background())
+	var schemaErr *schema.Error
+	require.ErrorAs(t, err, &schemaErr)
+	assert.Equal(t, []schema.Violation{
+		{Path: "yggdrasil.remte", Message: "unknown key"},
+		{Path: "yggdrasil.server.default_timeout", Message: "unknown key"},
+	}, schemaErr.Violations)
+
+	data = minimalV3Config("grpc")
+	data["yggdrasil"].(map[string]any)["remte"] = map[string]any{"protocol": "grpc"}
+	app, _ = newTestAppWithConfig(t, "config-schema-off", data, WithConfigValidation(false))
+	require.NoError(t, app.initializeLocked(context.Background()))
+	t.Cleanup(func() { _ = app.Stop(context.Background()) })
+}
@@ -0,0 +1,61 @@
+// Copyright 2022 The codesjoy Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package app
+
+import (
+	"log/slog"
+	"net/http"
+
+	internalinstall "github.com/codesjoy/yggdrasil/v3/app/internal/install"
+	"github.com/codesjoy/yggdrasil/v3/transport/runtime/server"
+)
+
+var governorMountMethods = []string{
+	http.MethodGet,
+	http.MethodHead,
+	http.MethodPost,
+	http.MethodPut,
+	http.MethodPatch,
+	http.MethodDelete,
+}
+
+// mountGovernor serves the governor routes on the REST server when the
+// governor is configured with a mount prefix instead of its own port.
+func (a *App) mountGovernor(svr server.Server) {
+	if a.opts.governor == nil {
+		return
+	}
+	prefix := a.opts.governor.MountPrefix()
+	if prefix == "" {
+		return
+	}
+	if !a.opts.resolvedSettings.Server.RestEnabled {
+		slog.Warn(
+			"governor mount is configured but the rest server is disabled",
+			"prefix", prefix,
+		)
+		return
+	}
+	pattern := prefix + "/*"
+	handler := a.opts.governor.MountedHandler().ServeHTTP
+	for _, method := range governorMountMethods {
+		svr.RegisterRestRawHandlers(&server.RestRawHandlerDesc{
+			Method:  method,
+			Path:    pattern,
+			Handler: handler,
+		})
+		a.installedHTTPRoutes[internalinstall.RouteKey(method, pattern)] = struct{}{}
+	}
+}
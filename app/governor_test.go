@@ -0,0 +1,50 @@
+// Copyright 2022 The codesjoy Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package app
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	internalinstall "github.com/codesjoy/yggdrasil/v3/app/internal/install"
+)
+
+func TestMountGovernorRegistersRoutes(t *testing.T) {
+	cfg := assemblyTestConfig(true)
+	governorCfg := cfg["yggdrasil"].(map[string]any)["admin"].(map[string]any)["governor"]
+	governorCfg.(map[string]any)["mount"] = "/-/yggdrasil/"
+	governorCfg.(map[string]any)["auth"] = map[string]any{"token": "secret"}
+	app, err := New(
+		"governor-mount",
+		WithConfigManager(newTestManager(t, cfg)),
+		WithModules(testTransportModule{recorder: newTransportRecorder()}),
+	)
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = app.Stop(context.Background()) })
+
+	require.NoError(t, app.Prepare(context.Background()))
+	_, err = app.installServer("governor")
+	require.NoError(t, err)
+	for _, method := range []string{http.MethodGet, http.MethodPost, http.MethodDelete} {
+		require.Contains(
+			t,
+			app.installedHTTPRoutes,
+			internalinstall.RouteKey(method, "/-/yggdrasil/*"),
+		)
+	}
+}
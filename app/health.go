@@ -0,0 +1,43 @@
+// Copyright 2022 The codesjoy Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package app
+
+import "net/http"
+
+type healthResponse struct {
+	Status  string   `json:"status"`
+	Reasons []string `json:"reasons,omitempty"`
+}
+
+// livenessHandle reports the process alive for as long as the governor
+// answers, including while the App drains.
+func livenessHandle(w http.ResponseWriter, r *http.Request) {
+	writeDiagnosticsJSON(w, r, healthResponse{Status: "ok"})
+}
+
+// readinessHandle reports whether the App should receive traffic. It answers
+// 503 with the reasons until the servers serve and registration completes,
+// while any readiness check fails, and once the App starts draining.
+func (a *App) readinessHandle(w http.ResponseWriter, r *http.Request) {
+	reasons := a.lifecycle.Readiness(r.Context())
+	if len(reasons) > 0 {
+		writeStatusJSON(w, r, http.StatusServiceUnavailable, healthResponse{
+			Status:  "not_ready",
+			Reasons: reasons,
+		})
+		return
+	}
+	writeDiagnosticsJSON(w, r, healthResponse{Status: "ready"})
+}
@@ -0,0 +1,142 @@
+// Copyright 2022 The codesjoy Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package app
+
+import (
+	"log/slog"
+	"net/http"
+	"runtime"
+	"runtime/debug"
+	"slices"
+	"time"
+
+	"github.com/codesjoy/yggdrasil/v3/config"
+)
+
+// BuildInfo describes the running binary.
+type BuildInfo struct {
+	GoVersion     string    `json:"go_version"`
+	Module        string    `json:"module,omitempty"`
+	ModuleVersion string    `json:"module_version,omitempty"`
+	VCS           string    `json:"vcs,omitempty"`
+	Revision      string    `json:"revision,omitempty"`
+	RevisionTime  time.Time `json:"revision_time,omitzero"`
+	Modified      bool      `json:"modified,omitempty"`
+}
+
+// InterceptorInfo lists the configured interceptor names.
+type InterceptorInfo struct {
+	UnaryServer  []string `json:"unary_server"`
+	StreamServer []string `json:"stream_server"`
+	UnaryClient  []string `json:"unary_client"`
+	StreamClient []string `json:"stream_client"`
+}
+
+// InstanceInfo is what the governor /info endpoint and the startup banner
+// report about the running instance.
+type InstanceInfo struct {
+	Identity      Identity           `json:"identity"`
+	Build         BuildInfo          `json:"build"`
+	ConfigSources []config.LayerInfo `json:"config_sources"`
+	Interceptors  InterceptorInfo    `json:"interceptors"`
+	Services      []string           `json:"services"`
+}
+
+func currentBuildInfo() BuildInfo {
+	out := BuildInfo{GoVersion: runtime.Version()}
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return out
+	}
+	out.Module = info.Main.Path
+	out.ModuleVersion = info.Main.Version
+	for _, item := range info.Settings {
+		switch item.Key {
+		case "vcs":
+			out.VCS = item.Value
+		case "vcs.revision":
+			out.Revision = item.Value
+		case "vcs.time":
+			out.RevisionTime, _ = time.Parse(time.RFC3339, item.Value)
+		case "vcs.modified":
+			out.Modified = item.Value == "true"
+		}
+	}
+	return out
+}
+
+// Info returns the identity, build, configuration and service information
+// of the App.
+func (a *App) Info() InstanceInfo {
+	out := InstanceInfo{
+		Build:         currentBuildInfo(),
+		ConfigSources: []config.LayerInfo{},
+		Services:      []string{},
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.identityResolved {
+		out.Identity = publicIdentity(a.identity)
+	} else {
+		out.Identity = Identity{AppName: a.name, Metadata: map[string]string{}}
+	}
+	if a.opts == nil {
+		return out
+	}
+	if a.opts.configManager != nil {
+		out.ConfigSources = a.opts.configManager.Layers()
+	}
+	resolved := a.opts.resolvedSettings
+	clientDefaults := resolved.Root.Yggdrasil.Clients.Defaults.Interceptors
+	out.Interceptors = InterceptorInfo{
+		UnaryServer:  slices.Clone(resolved.Server.Interceptors.Unary),
+		StreamServer: slices.Clone(resolved.Server.Interceptors.Stream),
+		UnaryClient:  slices.Clone(clientDefaults.Unary),
+		StreamClient: slices.Clone(clientDefaults.Stream),
+	}
+	if a.opts.server != nil {
+		out.Services = a.opts.server.ServiceNames()
+	}
+	return out
+}
+
+func (a *App) infoHandle(w http.ResponseWriter, r *http.Request) {
+	writeDiagnosticsJSON(w, r, a.Info())
+}
+
+// logBanner logs the instance info when admin.info.banner is enabled.
+func (a *App) logBanner() {
+	a.mu.Lock()
+	enabled := a.opts != nil && a.opts.resolvedSettings.Admin.Info.Banner
+	a.mu.Unlock()
+	if !enabled {
+		return
+	}
+	info := a.Info()
+	sources := make([]string, 0, len(info.ConfigSources))
+	for _, item := range info.ConfigSources {
+		sources = append(sources, item.Name)
+	}
+	slog.Info(
+		"instance started",
+		slog.String("app", info.Identity.AppName),
+		slog.String("version", info.Identity.Version),
+		slog.String("go", info.Build.GoVersion),
+		slog.String("revision", info.Build.Revision),
+		slog.Bool("modified", info.Build.Modified),
+		slog.Any("config_sources", sources),
+		slog.Any("services", info.Services),
+	)
+}
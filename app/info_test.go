@@ -0,0 +1,60 @@
+// Copyright 2022 The codesjoy Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAppInfoReportsServicesAndConfigSources(t *testing.T) {
+	data := assemblyTestConfig(false)
+	serverCfg := data["yggdrasil"].(map[string]any)["server"].(map[string]any)
+	serverCfg["interceptors"] = map[string]any{"unary": []any{"logging"}}
+	manager := newTestManager(t, data)
+	app, err := New("info-app",
+		WithConfigManager(manager), WithModules(testTransportModule{recorder: newTransportRecorder()}),
+	)
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = app.Stop(context.Background()) })
+	require.NoError(t, app.Prepare(context.Background()))
+	require.NoError(t, app.RegisterService(context.Background(), RPCBinding{
+		ServiceName: testAssemblyServiceName,
+		Desc:        &testAssemblyRPCServiceDesc,
+		Impl:        &testAssemblyServiceImpl{},
+	}))
+
+	rec := httptest.NewRecorder()
+	app.infoHandle(rec, httptest.NewRequest(http.MethodGet, "/info", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+	var info InstanceInfo
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &info))
+
+	assert.Equal(t, "info-app", info.Identity.AppName)
+	assert.Equal(t, runtime.Version(), info.Build.GoVersion)
+	assert.Equal(t, []string{testAssemblyServiceName}, info.Services)
+	assert.Equal(t, []string{"logging"}, info.Interceptors.UnaryServer)
+	require.NotEmpty(t, info.ConfigSources)
+	last := info.ConfigSources[len(info.ConfigSources)-1]
+	assert.Equal(t, "test", last.Name, "the override layer has the highest precedence")
+	assert.Equal(t, "override", last.Priority)
+}
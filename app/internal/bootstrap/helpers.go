@@ -33,7 +33,13 @@ const (
 	ConfigFlagName        = "yggdrasil-config"
 	ConfigSourcesEnvName  = "YGGDRASIL_CONFIG_SOURCES"
 	ConfigSourcesFlagName = "yggdrasil-config-sources"
+	ProfilesEnvName       = "YGGDRASIL_PROFILES"
+	ProfilesFlagName      = "yggdrasil-profiles"
 	DefaultConfigPath     = "./config.yaml"
+
+	// ApplicationEnvPrefix prefixes the environment variables that set the
+	// identity fields under yggdrasil.admin.application.
+	ApplicationEnvPrefix = "YGGDRASIL_ADMIN_APPLICATION_"
 )
 
 // ResolveConfigPath returns the config path and whether it was set explicitly.
@@ -50,6 +56,35 @@ func ResolveConfigPath(configuredPath string) (string, bool) {
 	return DefaultConfigPath, false
 }
 
+// ResolveProfiles returns the active config profiles. The command line flag
+// wins over the configured profiles, which win over the environment.
+func ResolveProfiles(configured []string) []string {
+	if value, ok := ParseNamedFlagArg(os.Args[1:], ProfilesFlagName); ok {
+		return configchain.ParseProfiles(value)
+	}
+	if len(configured) > 0 {
+		return configchain.ParseProfiles(strings.Join(configured, ","))
+	}
+	if value, ok := LookupRegisteredFlagValue(ProfilesFlagName); ok {
+		return configchain.ParseProfiles(value)
+	}
+	return configchain.ParseProfiles(os.Getenv(ProfilesEnvName))
+}
+
+// ConfigVariables returns the app.* placeholder variables available while
+// config files are loaded: app.name from the App, and app.namespace,
+// app.version, app.region, app.zone and app.campus from the identity
+// environment variables when they are set.
+func ConfigVariables(appName string) map[string]string {
+	vars := map[string]string{"app.name": appName}
+	for _, field := range []string{"namespace", "version", "region", "zone", "campus"} {
+		if value, ok := os.LookupEnv(ApplicationEnvPrefix + strings.ToUpper(field)); ok {
+			vars["app."+field] = value
+		}
+	}
+	return vars
+}
+
 // LookupRegisteredFlagValue returns the value of an already registered flag.
 func LookupRegisteredFlagValue(name string) (string, bool) {
 	f := flag.CommandLine.Lookup(name)
@@ -89,6 +124,7 @@ func LoadConfigFile(
 	path string,
 	explicit bool,
 	registry *configchain.Registry,
+	profiles ...string,
 ) ([]source.Source, bool, error) {
 	path = strings.TrimSpace(path)
 	if path == "" {
@@ -122,7 +158,7 @@ func LoadConfigFile(
 		return nil, false, fmt.Errorf("stat config file %q: %w", path, err)
 	}
 	loader := configchain.NewLoader(registry)
-	sources, loaded, err := loader.LoadFile(manager, path, explicit)
+	sources, loaded, err := loader.LoadFile(manager, path, explicit, profiles...)
 	if err != nil {
 		return nil, false, err
 	}
@@ -71,6 +71,23 @@ func TestParseNamedFlagArg(t *testing.T) {
 	})
 }
 
+func TestResolveProfiles(t *testing.T) {
+	t.Setenv(ProfilesEnvName, "staging, local")
+	assert.Equal(t, []string{"dev"}, ResolveProfiles([]string{"dev"}))
+	assert.Equal(t, []string{"staging", "local"}, ResolveProfiles(nil))
+
+	t.Setenv(ProfilesEnvName, "")
+	assert.Empty(t, ResolveProfiles(nil))
+}
+
+func TestConfigVariables(t *testing.T) {
+	t.Setenv(ApplicationEnvPrefix+"ZONE", "az1")
+	vars := ConfigVariables("demo")
+	assert.Equal(t, "demo", vars["app.name"])
+	assert.Equal(t, "az1", vars["app.zone"])
+	assert.NotContains(t, vars, "app.region")
+}
+
 func TestCloseConfigSourcesReverse(t *testing.T) {
 	t.Run("closes in reverse order", func(t *testing.T) {
 		var order []string
@@ -0,0 +1,47 @@
+// Copyright 2022 The codesjoy Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package lifecycle
+
+import (
+	"context"
+
+	"github.com/codesjoy/yggdrasil/v3/discovery/registry"
+	"github.com/codesjoy/yggdrasil/v3/eventbus"
+)
+
+func (runner *Runner) publishServerStarted() {
+	advertised := runner.Endpoints()
+	endpoints := make([]eventbus.Endpoint, 0, len(advertised))
+	for _, item := range advertised {
+		endpoints = append(endpoints, eventbus.Endpoint{
+			Name:     item.Metadata()[registry.MDServerKind],
+			Protocol: item.Scheme(),
+			Address:  item.Address(),
+		})
+	}
+	eventbus.Publish(context.Background(), eventbus.Default(), eventbus.ServerStarted{
+		AppName:   runner.identity.AppName,
+		Endpoints: endpoints,
+	})
+}
+
+func (runner *Runner) publishRegistryState(state eventbus.RegistryState, err error) {
+	eventbus.Publish(context.Background(), eventbus.Default(), eventbus.RegistryStateChanged{
+		AppName:  runner.identity.AppName,
+		Registry: runner.registry.Type(),
+		State:    state,
+		Err:      err,
+	})
+}
@@ -0,0 +1,91 @@
+// Copyright 2022 The codesjoy Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package lifecycle
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"github.com/codesjoy/yggdrasil/v3/admin/governor"
+	"github.com/codesjoy/yggdrasil/v3/eventbus"
+	internalidentity "github.com/codesjoy/yggdrasil/v3/internal/identity"
+)
+
+func TestLifecyclePublishesFrameworkEvents(t *testing.T) {
+	const appName = "lifecycle-events-app"
+	var mu sync.Mutex
+	var events []string
+	record := func(event string) {
+		mu.Lock()
+		defer mu.Unlock()
+		events = append(events, event)
+	}
+	unsubscribeStarted := eventbus.Subscribe(
+		eventbus.Default(),
+		func(_ context.Context, event eventbus.ServerStarted) {
+			if event.AppName == appName {
+				record("started")
+			}
+		},
+	)
+	defer unsubscribeStarted()
+	unsubscribeRegistry := eventbus.Subscribe(
+		eventbus.Default(),
+		func(_ context.Context, event eventbus.RegistryStateChanged) {
+			if event.AppName == appName {
+				assert.Equal(t, "test-registry", event.Registry)
+				record(string(event.State))
+			}
+		},
+	)
+	defer unsubscribeRegistry()
+
+	mockReg := createMockRegistry()
+	mockReg.On("Register", mock.Anything, mock.Anything).Return(nil)
+	mockReg.On("Deregister", mock.Anything, mock.Anything).Return(nil)
+	mockReg.On("Type").Return("test-registry")
+	gov, err := governor.NewServerWithConfig(governor.Config{Advertise: true}, nil)
+	require.NoError(t, err)
+	runner, err := New(
+		WithGovernor(gov),
+		WithRegistry(mockReg),
+		WithIdentity(internalidentity.Identity{AppName: appName}),
+	)
+	require.NoError(t, err)
+
+	done := make(chan error, 1)
+	go func() { done <- runner.Run(context.Background()) }()
+	require.Eventually(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(events) == 2
+	}, 5*time.Second, 10*time.Millisecond)
+	require.NoError(t, runner.Stop(context.Background()))
+	require.NoError(t, <-done)
+
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Equal(t, []string{
+		"started",
+		string(eventbus.RegistryRegistered),
+		string(eventbus.RegistryDeregistered),
+	}, events)
+}
@@ -17,6 +17,8 @@ package lifecycle
 import (
 	"context"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/stretchr/testify/mock"
 
@@ -80,13 +82,17 @@ func (b *blockingInternalServer) Stop(ctx context.Context) error {
 }
 
 type blockingAppServer struct {
-	stopCtx context.Context
-	endpts  []yserver.Endpoint
+	stopCtx  context.Context
+	endpts   []yserver.Endpoint
+	services []string
 }
 
 func (b *blockingAppServer) RegisterService(*yserver.ServiceDesc, interface{})                    {}
 func (b *blockingAppServer) RegisterRestService(*yserver.RestServiceDesc, interface{}, ...string) {}
 func (b *blockingAppServer) RegisterRestRawHandlers(...*yserver.RestRawHandlerDesc)               {}
+func (b *blockingAppServer) UnregisterService(string) bool                                        { return false }
+func (b *blockingAppServer) ServiceNames() []string                                               { return b.services }
+func (b *blockingAppServer) Routes() yserver.RouteTable                                           { return yserver.RouteTable{} }
 
 func (b *blockingAppServer) Serve(chan<- struct{}) error {
 	return nil
@@ -111,6 +117,9 @@ type runningAppServer struct {
 func (r *runningAppServer) RegisterService(*yserver.ServiceDesc, interface{})                    {}
 func (r *runningAppServer) RegisterRestService(*yserver.RestServiceDesc, interface{}, ...string) {}
 func (r *runningAppServer) RegisterRestRawHandlers(...*yserver.RestRawHandlerDesc)               {}
+func (r *runningAppServer) UnregisterService(string) bool                                        { return false }
+func (r *runningAppServer) ServiceNames() []string                                               { return nil }
+func (r *runningAppServer) Routes() yserver.RouteTable                                           { return yserver.RouteTable{} }
 
 func (r *runningAppServer) Serve(startFlag chan<- struct{}) error {
 	if startFlag != nil {
@@ -182,3 +191,17 @@ func createMockRegistry() *mockRegistry {
 func createMockInternalServer() *mockInternalServer {
 	return &mockInternalServer{}
 }
+
+// claimingAppServer claims its listener asynchronously before it reports
+// that it started, like transports that take over inherited sockets.
+type claimingAppServer struct {
+	runningAppServer
+	delay   time.Duration
+	claimed atomic.Bool
+}
+
+func (c *claimingAppServer) Serve(startFlag chan<- struct{}) error {
+	time.Sleep(c.delay)
+	c.claimed.Store(true)
+	return c.runningAppServer.Serve(startFlag)
+}
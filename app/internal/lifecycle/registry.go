@@ -18,9 +18,11 @@ import (
 	"context"
 	"log/slog"
 	"maps"
+	"strings"
 	"time"
 
 	"github.com/codesjoy/yggdrasil/v3/discovery/registry"
+	"github.com/codesjoy/yggdrasil/v3/eventbus"
 	yserver "github.com/codesjoy/yggdrasil/v3/transport/runtime/server"
 )
 
@@ -38,6 +40,7 @@ func (runner *Runner) register() error {
 	if err := runner.registry.Register(ctx, runner); err != nil {
 		runner.resetRegistering()
 		slog.Error("fault to register application", slog.Any("error", err))
+		runner.publishRegistryState(eventbus.RegistryFailed, err)
 		return err
 	}
 
@@ -49,12 +52,15 @@ func (runner *Runner) register() error {
 				"fault to deregister application after concurrent stop",
 				slog.Any("error", err),
 			)
+			runner.publishRegistryState(eventbus.RegistryFailed, err)
 			return err
 		}
+		runner.publishRegistryState(eventbus.RegistryDeregistered, nil)
 		return nil
 	}
 
 	slog.Info("application has been registered")
+	runner.publishRegistryState(eventbus.RegistryRegistered, nil)
 	return nil
 }
 
@@ -69,6 +75,29 @@ func (runner *Runner) deregister(ctx context.Context) error {
 
 	if err := runner.registry.Deregister(ctx, runner); err != nil {
 		slog.Error("fault to deregister application", slog.Any("error", err))
+		runner.publishRegistryState(eventbus.RegistryFailed, err)
+		return err
+	}
+	runner.publishRegistryState(eventbus.RegistryDeregistered, nil)
+	return nil
+}
+
+// RefreshRegistration registers the instance again so the registry picks up
+// endpoint metadata that changed after startup, such as services registered
+// or unregistered while running. It does nothing unless the instance is
+// currently registered.
+func (runner *Runner) RefreshRegistration(ctx context.Context) error {
+	if runner.registry == nil {
+		return nil
+	}
+	runner.mu.Lock()
+	registered := runner.registryState == registryStateDone
+	runner.mu.Unlock()
+	if !registered {
+		return nil
+	}
+	if err := runner.registry.Register(ctx, runner); err != nil {
+		slog.Error("fault to refresh application registration", slog.Any("error", err))
 		return err
 	}
 	return nil
@@ -162,9 +191,13 @@ func (runner *Runner) Metadata() map[string]string {
 func (runner *Runner) Endpoints() []registry.Endpoint {
 	endpoints := make([]registry.Endpoint, 0)
 	if runner.server != nil {
+		services := strings.Join(runner.server.ServiceNames(), ",")
 		for _, item := range runner.server.Endpoints() {
-			metadata := cloneEndpointMetadata(item.Metadata())
+			metadata := runner.overlayEndpointMetadata(item.Protocol(), item.Metadata())
 			metadata[registry.MDServerKind] = string(item.Kind())
+			if item.Kind() == yserver.EndpointKindRPC && services != "" {
+				metadata[registry.MDServices] = services
+			}
 			endpoints = append(endpoints, endpoint{
 				address:  item.Address(),
 				scheme:   item.Protocol(),
@@ -174,7 +207,7 @@ func (runner *Runner) Endpoints() []registry.Endpoint {
 	}
 	if runner.governor != nil && runner.governor.ShouldAdvertise() {
 		info := runner.governor.Info()
-		metadata := cloneEndpointMetadata(info.Attr)
+		metadata := runner.overlayEndpointMetadata(info.Scheme, info.Attr)
 		metadata[registry.MDServerKind] = string(yserver.EndpointKindGovernor)
 		endpoints = append(endpoints, endpoint{
 			address:  info.Address,
@@ -185,6 +218,16 @@ func (runner *Runner) Endpoints() []registry.Endpoint {
 	return endpoints
 }
 
+func (runner *Runner) overlayEndpointMetadata(
+	protocol string,
+	source map[string]string,
+) map[string]string {
+	metadata := cloneEndpointMetadata(source)
+	maps.Copy(metadata, runner.endpointMetadata[yserver.AnyProtocol])
+	maps.Copy(metadata, runner.endpointMetadata[protocol])
+	return metadata
+}
+
 func cloneEndpointMetadata(source map[string]string) map[string]string {
 	if cloned := maps.Clone(source); cloned != nil {
 		return cloned
@@ -19,7 +19,9 @@ import (
 	"errors"
 	"fmt"
 	"log/slog"
+	"maps"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"golang.org/x/sync/errgroup"
@@ -44,6 +46,7 @@ type Stage uint32
 const (
 	_ Stage = iota
 	StageBeforeStart
+	StageAfterStart
 	StageBeforeStop
 	StageCleanup
 	StageAfterStop
@@ -99,6 +102,12 @@ func WithBeforeStartHooks(hooks ...func(context.Context) error) Option {
 	return WithHook(StageBeforeStart, hooks...)
 }
 
+// WithAfterStartHooks registers hooks that run once the main server, the
+// governor and every transport have started and claimed their listeners.
+func WithAfterStartHooks(hooks ...func(context.Context) error) Option {
+	return WithHook(StageAfterStart, hooks...)
+}
+
 // WithBeforeStopHooks registers before-stop hooks.
 func WithBeforeStopHooks(hooks ...func(context.Context) error) Option {
 	return WithHook(StageBeforeStop, hooks...)
@@ -127,6 +136,33 @@ func WithIdentity(identity internalidentity.Identity) Option {
 	}
 }
 
+// WithEndpointMetadata publishes metadata with the registered endpoints of
+// one protocol, or of every endpoint when protocol is server.AnyProtocol.
+// It overrides metadata configured on the server.
+func WithEndpointMetadata(protocol string, metadata map[string]string) Option {
+	return func(runner *Runner) error {
+		if runner.endpointMetadata == nil {
+			runner.endpointMetadata = map[string]map[string]string{}
+		}
+		target := runner.endpointMetadata[protocol]
+		if target == nil {
+			target = map[string]string{}
+			runner.endpointMetadata[protocol] = target
+		}
+		maps.Copy(target, metadata)
+		return nil
+	}
+}
+
+// WithReadinessChecks registers checks that must pass for Readiness to
+// report the instance ready.
+func WithReadinessChecks(checks ...func(context.Context) error) Option {
+	return func(runner *Runner) error {
+		runner.readinessChecks = append(runner.readinessChecks, checks...)
+		return nil
+	}
+}
+
 // WithShutdownTimeout configures the shutdown timeout.
 func WithShutdownTimeout(timeout time.Duration) Option {
 	return func(runner *Runner) error {
@@ -186,15 +222,53 @@ type Runner struct {
 
 	internalServers []InternalServer
 
-	registryState int
-	registry      registry.Registry
-	identity      internalidentity.Identity
+	registryState    int
+	registry         registry.Registry
+	identity         internalidentity.Identity
+	endpointMetadata map[string]map[string]string
 
 	shutdownTimeout time.Duration
 
+	serving         atomic.Bool
+	draining        atomic.Bool
+	readinessChecks []func(context.Context) error
+
+	workers     []Worker
+	workerGroup workerGroup
+
 	hooks map[Stage]*defers.Defer
 }
 
+// Readiness returns the reasons the instance should not receive traffic, or
+// nil when every server is serving, registration has completed and every
+// readiness check passes. The instance stays not ready once it drains.
+func (runner *Runner) Readiness(ctx context.Context) []string {
+	if runner.draining.Load() {
+		return []string{"draining"}
+	}
+	var reasons []string
+	if !runner.serving.Load() {
+		reasons = append(reasons, "servers are not serving")
+	}
+	if runner.registry != nil {
+		runner.mu.Lock()
+		registered := runner.registryState == registryStateDone
+		runner.mu.Unlock()
+		if !registered {
+			reasons = append(reasons, "registration is not complete")
+		}
+	}
+	runner.optionsMu.RLock()
+	checks := append([]func(context.Context) error(nil), runner.readinessChecks...)
+	runner.optionsMu.RUnlock()
+	for _, check := range checks {
+		if err := check(ctx); err != nil {
+			reasons = append(reasons, err.Error())
+		}
+	}
+	return reasons
+}
+
 func (runner *Runner) setRunning(running bool) {
 	runner.optionsMu.Lock()
 	defer runner.optionsMu.Unlock()
@@ -237,6 +311,7 @@ func (runner *Runner) Init(opts ...Option) error {
 func (runner *Runner) Stop(ctx context.Context) error {
 	var err error
 	runner.stopOnce.Do(func() {
+		runner.draining.Store(true)
 		runner.setRunning(false)
 
 		ctx, cancel := runner.withStopTimeout(ctx)
@@ -261,6 +336,7 @@ func (runner *Runner) runStopSequence(ctx context.Context) error {
 	var err error
 	err = errors.Join(err, runner.runHooks(ctx, StageBeforeStop))
 	err = errors.Join(err, runner.deregister(ctx))
+	err = errors.Join(err, runner.stopWorkers(ctx))
 	err = errors.Join(err, runner.stopServers(ctx))
 	err = errors.Join(err, runner.runHooks(ctx, StageCleanup))
 	err = errors.Join(err, runner.runHooks(ctx, StageAfterStop))
@@ -341,6 +417,13 @@ func (runner *Runner) registerAfterStartup(
 		stopAsync()
 		return fmt.Errorf("wait governor startup: %w", err)
 	}
+	runner.serving.Store(true)
+	runner.publishServerStarted()
+	if err := runner.runHooks(ctx, StageAfterStart); err != nil {
+		stopAsync()
+		return fmt.Errorf("after start hooks: %w", err)
+	}
+	runner.startWorkers()
 	if err := runner.register(); err != nil {
 		stopAsync()
 		return fmt.Errorf("register application: %w", err)
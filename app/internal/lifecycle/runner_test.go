@@ -18,6 +18,7 @@ import (
 	"context"
 	"errors"
 	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -36,7 +37,7 @@ func TestNewRunner(t *testing.T) {
 	require.NoError(t, err)
 	require.NotNil(t, runner)
 	require.NotNil(t, runner.hooks)
-	assert.Len(t, runner.hooks, 4)
+	assert.Len(t, runner.hooks, 5)
 	assert.False(t, runner.running)
 	assert.Equal(t, registryStateInit, runner.registryState)
 	assert.Nil(t, runner.server)
@@ -257,6 +258,24 @@ func TestLifecycleRegisterError(t *testing.T) {
 	assert.Equal(t, registryStateInit, runner.registryState)
 }
 
+func TestLifecycleRefreshRegistration(t *testing.T) {
+	mockReg := createMockRegistry()
+	mockReg.On("Register", mock.Anything, mock.Anything).Return(nil)
+	mockReg.On("Type").Return("test-registry")
+
+	runner, err := New(WithRegistry(mockReg))
+	require.NoError(t, err)
+
+	// Not registered yet: nothing to refresh.
+	require.NoError(t, runner.RefreshRegistration(context.Background()))
+	assert.False(t, mockReg.registered)
+
+	runner.registryState = registryStateDone
+	require.NoError(t, runner.RefreshRegistration(context.Background()))
+	assert.True(t, mockReg.registered)
+	mockReg.AssertNumberOfCalls(t, "Register", 1)
+}
+
 func TestLifecycleDeregisterSuccess(t *testing.T) {
 	mockReg := createMockRegistry()
 	mockReg.On("Register", mock.Anything, mock.Anything).Return(nil)
@@ -363,6 +382,59 @@ func TestLifecycleEndpointsWithServer(t *testing.T) {
 	assert.Equal(t, string(yserver.EndpointKindRPC), endpoints[0].Metadata()[registry.MDServerKind])
 }
 
+func TestLifecycleEndpointsAdvertiseServices(t *testing.T) {
+	mainServer := &blockingAppServer{
+		endpts: []yserver.Endpoint{
+			stubEndpoint{protocol: "grpc", address: "127.0.0.1:9000", kind: yserver.EndpointKindRPC},
+			stubEndpoint{protocol: "http", address: "127.0.0.1:8080", kind: yserver.EndpointKindRest},
+		},
+		services: []string{"a.Service", "b.Service"},
+	}
+
+	runner, err := New(WithServer(mainServer))
+	require.NoError(t, err)
+
+	endpoints := runner.Endpoints()
+	require.Len(t, endpoints, 2)
+	assert.Equal(t, "a.Service,b.Service", endpoints[0].Metadata()[registry.MDServices])
+	assert.NotContains(t, endpoints[1].Metadata(), registry.MDServices)
+}
+
+func TestRunnerEndpointsOverlayEndpointMetadata(t *testing.T) {
+	mainServer := &blockingAppServer{
+		endpts: []yserver.Endpoint{
+			stubEndpoint{
+				protocol: "grpc",
+				address:  "127.0.0.1:9000",
+				kind:     yserver.EndpointKindRPC,
+				metadata: map[string]string{registry.MDWeight: "5"},
+			},
+			stubEndpoint{protocol: "http", address: "127.0.0.1:8080", kind: yserver.EndpointKindRest},
+		},
+	}
+
+	runner, err := New(
+		WithServer(mainServer),
+		WithEndpointMetadata(yserver.AnyProtocol, map[string]string{registry.MDZone: "z1"}),
+		WithEndpointMetadata("grpc", map[string]string{registry.MDWeight: "10"}),
+		WithEndpointMetadata("grpc", map[string]string{registry.MDCanary: "true"}),
+	)
+	require.NoError(t, err)
+
+	endpoints := runner.Endpoints()
+	require.Len(t, endpoints, 2)
+	assert.Equal(t, map[string]string{
+		registry.MDZone:       "z1",
+		registry.MDWeight:     "10",
+		registry.MDCanary:     "true",
+		registry.MDServerKind: string(yserver.EndpointKindRPC),
+	}, endpoints[0].Metadata())
+	assert.Equal(t, "z1", endpoints[1].Metadata()[registry.MDZone])
+	assert.NotContains(t, endpoints[1].Metadata(), registry.MDWeight)
+	assert.Equal(t, "5", mainServer.endpts[0].Metadata()[registry.MDWeight],
+		"server metadata must not be mutated")
+}
+
 func TestLifecycleEndpointsIntegration(t *testing.T) {
 	gov, err := governor.NewServerWithConfig(governor.Config{Advertise: true}, nil)
 	require.NoError(t, err)
@@ -531,3 +603,88 @@ func TestLifecycleStopRunsHooks(t *testing.T) {
 	assert.True(t, cleanupCalled)
 	assert.True(t, afterStopCalled)
 }
+
+func TestLifecycleReadinessFollowsServingChecksAndDrain(t *testing.T) {
+	gov, err := governor.NewServerWithConfig(governor.Config{Advertise: true}, nil)
+	require.NoError(t, err)
+
+	var warm atomic.Bool
+	runner, err := New(WithGovernor(gov), WithReadinessChecks(func(context.Context) error {
+		if !warm.Load() {
+			return errors.New("cache warming")
+		}
+		return nil
+	}))
+	require.NoError(t, err)
+	assert.Equal(
+		t,
+		[]string{"servers are not serving", "cache warming"},
+		runner.Readiness(context.Background()),
+	)
+
+	done := make(chan error, 1)
+	go func() { done <- runner.Run(context.Background()) }()
+	require.Eventually(t, func() bool {
+		return len(runner.Readiness(context.Background())) == 1
+	}, 5*time.Second, 10*time.Millisecond)
+	assert.Equal(t, []string{"cache warming"}, runner.Readiness(context.Background()))
+
+	warm.Store(true)
+	assert.Empty(t, runner.Readiness(context.Background()))
+
+	require.NoError(t, runner.Stop(context.Background()))
+	assert.Equal(t, []string{"draining"}, runner.Readiness(context.Background()))
+	require.NoError(t, <-done)
+}
+
+func TestLifecycleAfterStartHooksWaitForServers(t *testing.T) {
+	gov, err := governor.NewServerWithConfig(governor.Config{Advertise: true}, nil)
+	require.NoError(t, err)
+
+	mainServer := &claimingAppServer{
+		runningAppServer: runningAppServer{stopCh: make(chan struct{})},
+		delay:            50 * time.Millisecond,
+	}
+	claimedAtHook := make(chan bool, 1)
+	runner, err := New(
+		WithGovernor(gov),
+		WithServer(mainServer),
+		WithAfterStartHooks(func(context.Context) error {
+			claimedAtHook <- mainServer.claimed.Load()
+			return nil
+		}),
+	)
+	require.NoError(t, err)
+
+	done := make(chan error, 1)
+	go func() { done <- runner.Run(context.Background()) }()
+	select {
+	case claimed := <-claimedAtHook:
+		assert.True(t, claimed)
+	case <-time.After(5 * time.Second):
+		t.Fatal("after start hook did not run")
+	}
+
+	require.NoError(t, runner.Stop(context.Background()))
+	require.NoError(t, <-done)
+}
+
+func TestLifecycleAfterStartHookErrorStopsRunner(t *testing.T) {
+	gov, err := governor.NewServerWithConfig(governor.Config{Advertise: true}, nil)
+	require.NoError(t, err)
+
+	mainServer := &runningAppServer{stopCh: make(chan struct{})}
+	runner, err := New(
+		WithGovernor(gov),
+		WithServer(mainServer),
+		WithAfterStartHooks(func(context.Context) error {
+			return errors.New("notify failed")
+		}),
+	)
+	require.NoError(t, err)
+
+	err = runner.Run(context.Background())
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "after start hooks")
+	assert.NotNil(t, mainServer.stopCtx)
+}
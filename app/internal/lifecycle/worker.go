@@ -0,0 +1,194 @@
+// Copyright 2022 The codesjoy Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package lifecycle
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"runtime/debug"
+	"sync"
+	"time"
+
+	"github.com/codesjoy/yggdrasil/v3/internal/backoff"
+	"github.com/codesjoy/yggdrasil/v3/observability/crashreport"
+)
+
+// Runnable is a background worker. Run blocks until the worker finishes or
+// ctx is canceled; Stop asks a running worker to finish.
+type Runnable interface {
+	Run(ctx context.Context) error
+	Stop(ctx context.Context) error
+}
+
+// Worker is one supervised Runnable.
+type Worker struct {
+	Name     string
+	Runnable Runnable
+	// Restart restarts the worker when Run fails or panics. A worker whose
+	// Run returns nil is considered done and is not restarted.
+	Restart bool
+	// MaxRestarts bounds consecutive restarts; zero means unlimited.
+	MaxRestarts int
+	// Backoff spaces the restarts. DefaultExponential is used when nil.
+	Backoff backoff.Strategy
+}
+
+// WithWorkers registers workers started once the servers serve and stopped
+// before them on shutdown.
+func WithWorkers(workers ...Worker) Option {
+	return func(runner *Runner) error {
+		for _, item := range workers {
+			if item.Runnable == nil {
+				return errors.New("worker runnable is nil")
+			}
+			runner.workers = append(runner.workers, item)
+		}
+		return nil
+	}
+}
+
+type workerGroup struct {
+	mu       sync.Mutex
+	stopping bool
+	cancel   context.CancelFunc
+	wg       sync.WaitGroup
+}
+
+func (runner *Runner) startWorkers() {
+	group := &runner.workerGroup
+	group.mu.Lock()
+	defer group.mu.Unlock()
+	if group.stopping || group.cancel != nil || len(runner.workers) == 0 {
+		return
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	group.cancel = cancel
+	for index, item := range runner.workers {
+		if item.Name == "" {
+			item.Name = fmt.Sprintf("worker-%d", index)
+		}
+		group.wg.Add(1)
+		go func() {
+			defer group.wg.Done()
+			runner.superviseWorker(ctx, item)
+		}()
+	}
+}
+
+func (runner *Runner) workersStopping() bool {
+	runner.workerGroup.mu.Lock()
+	defer runner.workerGroup.mu.Unlock()
+	return runner.workerGroup.stopping
+}
+
+func (runner *Runner) superviseWorker(ctx context.Context, worker Worker) {
+	strategy := worker.Backoff
+	if strategy == nil {
+		strategy = backoff.DefaultExponential
+	}
+	for restarts := 0; ; restarts++ {
+		err := runWorker(ctx, worker.Name, worker.Runnable)
+		if runner.workersStopping() || ctx.Err() != nil {
+			return
+		}
+		if err == nil {
+			slog.Info("worker finished", slog.String("worker", worker.Name))
+			return
+		}
+		if !worker.Restart || (worker.MaxRestarts > 0 && restarts >= worker.MaxRestarts) {
+			slog.Error(
+				"worker failed",
+				slog.String("worker", worker.Name),
+				slog.Int("restarts", restarts),
+				slog.Any("error", err),
+			)
+			return
+		}
+		delay := strategy.Backoff(restarts)
+		slog.Warn(
+			"worker failed, restarting",
+			slog.String("worker", worker.Name),
+			slog.Duration("delay", delay),
+			slog.Any("error", err),
+		)
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+	}
+}
+
+func runWorker(ctx context.Context, name string, r Runnable) (err error) {
+	defer func() {
+		if p := recover(); p != nil {
+			stack := debug.Stack()
+			crashreport.Recovered(ctx, crashreport.SourceWorker, name, p, stack)
+			err = fmt.Errorf("worker panic: %v\n%s", p, stack)
+		}
+	}()
+	return r.Run(ctx)
+}
+
+// stopWorkers stops the running workers and waits for them within ctx.
+func (runner *Runner) stopWorkers(ctx context.Context) error {
+	group := &runner.workerGroup
+	group.mu.Lock()
+	group.stopping = true
+	cancel := group.cancel
+	group.mu.Unlock()
+	if cancel == nil {
+		return nil
+	}
+
+	var err error
+	var mu sync.Mutex
+	var stops sync.WaitGroup
+	for index, item := range runner.workers {
+		name := item.Name
+		if name == "" {
+			name = fmt.Sprintf("worker-%d", index)
+		}
+		stops.Add(1)
+		go func() {
+			defer stops.Done()
+			if stopErr := stopManagedComponent(
+				ctx, "worker", item.Runnable.Stop, slog.String("worker", name),
+			); stopErr != nil {
+				mu.Lock()
+				err = errors.Join(err, stopErr)
+				mu.Unlock()
+			}
+		}()
+	}
+	stops.Wait()
+	cancel()
+
+	done := make(chan struct{})
+	go func() {
+		group.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-ctx.Done():
+		err = errors.Join(err, fmt.Errorf("wait workers: %w", ctx.Err()))
+	}
+	return err
+}
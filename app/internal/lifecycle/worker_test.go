@@ -0,0 +1,154 @@
+// Copyright 2022 The codesjoy Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package lifecycle
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/codesjoy/yggdrasil/v3/admin/governor"
+	"github.com/codesjoy/yggdrasil/v3/internal/backoff"
+)
+
+type constantBackoff time.Duration
+
+func (b constantBackoff) Backoff(int) time.Duration { return time.Duration(b) }
+
+var _ backoff.Strategy = constantBackoff(0)
+
+type testWorker struct {
+	runs    atomic.Int32
+	failFor int32
+	panics  bool
+	stopped chan struct{}
+	once    sync.Once
+}
+
+func newTestWorker(failFor int32) *testWorker {
+	return &testWorker{failFor: failFor, stopped: make(chan struct{})}
+}
+
+func (w *testWorker) Run(ctx context.Context) error {
+	if w.runs.Add(1) <= w.failFor {
+		if w.panics {
+			panic("boom")
+		}
+		return errors.New("crashed")
+	}
+	select {
+	case <-ctx.Done():
+	case <-w.stopped:
+	}
+	return nil
+}
+
+func (w *testWorker) Stop(context.Context) error {
+	w.once.Do(func() { close(w.stopped) })
+	return nil
+}
+
+func runWithWorkers(t *testing.T, workers ...Worker) (*Runner, chan error) {
+	t.Helper()
+	gov, err := governor.NewServerWithConfig(governor.Config{Advertise: true}, nil)
+	require.NoError(t, err)
+	runner, err := New(WithGovernor(gov), WithWorkers(workers...))
+	require.NoError(t, err)
+	done := make(chan error, 1)
+	go func() { done <- runner.Run(context.Background()) }()
+	return runner, done
+}
+
+func TestWorkerRestartsAfterFailureAndPanic(t *testing.T) {
+	failing := newTestWorker(2)
+	panicking := newTestWorker(1)
+	panicking.panics = true
+	runner, done := runWithWorkers(
+		t,
+		Worker{Name: "failing", Runnable: failing, Restart: true, Backoff: constantBackoff(0)},
+		Worker{Name: "panicking", Runnable: panicking, Restart: true, Backoff: constantBackoff(0)},
+	)
+
+	require.Eventually(t, func() bool {
+		return failing.runs.Load() == 3 && panicking.runs.Load() == 2
+	}, 5*time.Second, 10*time.Millisecond)
+
+	require.NoError(t, runner.Stop(context.Background()))
+	require.NoError(t, <-done)
+	select {
+	case <-failing.stopped:
+	default:
+		t.Fatal("worker was not stopped")
+	}
+}
+
+func TestWorkerGivesUpAfterMaxRestarts(t *testing.T) {
+	worker := newTestWorker(100)
+	runner, done := runWithWorkers(t, Worker{
+		Runnable:    worker,
+		Restart:     true,
+		MaxRestarts: 2,
+		Backoff:     constantBackoff(0),
+	})
+
+	require.Eventually(t, func() bool {
+		return worker.runs.Load() == 3
+	}, 5*time.Second, 10*time.Millisecond)
+	time.Sleep(50 * time.Millisecond)
+	assert.Equal(t, int32(3), worker.runs.Load())
+
+	require.NoError(t, runner.Stop(context.Background()))
+	require.NoError(t, <-done)
+}
+
+func TestWorkerStopIsBoundedByShutdownContext(t *testing.T) {
+	worker := &stuckWorker{started: make(chan struct{})}
+	runner, done := runWithWorkers(t, Worker{Runnable: worker})
+	<-worker.started
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	err := runner.stopWorkers(ctx)
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+
+	close(worker.release)
+	require.NoError(t, runner.Stop(context.Background()))
+	require.NoError(t, <-done)
+}
+
+type stuckWorker struct {
+	started chan struct{}
+	release chan struct{}
+}
+
+func (w *stuckWorker) Run(context.Context) error {
+	w.release = make(chan struct{})
+	close(w.started)
+	<-w.release
+	return nil
+}
+
+func (w *stuckWorker) Stop(context.Context) error { return nil }
+
+func TestWithWorkersRejectsNilRunnable(t *testing.T) {
+	_, err := New(WithWorkers(Worker{Name: "empty"}))
+	require.Error(t, err)
+}
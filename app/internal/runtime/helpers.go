@@ -31,11 +31,15 @@ import (
 	"github.com/codesjoy/yggdrasil/v3/config"
 	"github.com/codesjoy/yggdrasil/v3/internal/settings"
 	"github.com/codesjoy/yggdrasil/v3/module"
+	"github.com/codesjoy/yggdrasil/v3/observability/channelz"
 	"github.com/codesjoy/yggdrasil/v3/observability/logger"
 	"github.com/codesjoy/yggdrasil/v3/observability/stats"
 	statsotel "github.com/codesjoy/yggdrasil/v3/observability/stats/otel"
+	"github.com/codesjoy/yggdrasil/v3/observability/stats/slowrpc"
 	"github.com/codesjoy/yggdrasil/v3/rpc/interceptor"
 	"github.com/codesjoy/yggdrasil/v3/transport/gateway/rest"
+	"github.com/codesjoy/yggdrasil/v3/transport/runtime/client"
+	"github.com/codesjoy/yggdrasil/v3/transport/runtime/server"
 	"github.com/codesjoy/yggdrasil/v3/transport/support/marshaler"
 	"github.com/codesjoy/yggdrasil/v3/transport/support/security"
 )
@@ -203,6 +207,8 @@ func BindStatsHandlerBuilders(
 		_ = settings.DecodePayload(&cfg, resolved.Telemetry.Stats.Providers.OTel)
 		out["otel"] = statsotel.BuiltinHandlerBuilderWithConfig(cfg)
 	}
+	bindSlowRPCHandlerBuilder(resolved, out)
+	bindChannelzHandlerBuilder(resolved, out)
 	return out
 }
 
@@ -228,9 +234,32 @@ func BindStatsHandlerBuildersWithRuntime(
 			},
 		)
 	}
+	bindSlowRPCHandlerBuilder(resolved, out)
+	bindChannelzHandlerBuilder(resolved, out)
 	return out
 }
 
+func bindSlowRPCHandlerBuilder(resolved settings.Resolved, builders map[string]stats.HandlerBuilder) {
+	if _, ok := builders[slowrpc.Name]; !ok {
+		return
+	}
+	cfg := slowrpc.Config{}
+	_ = settings.DecodePayload(&cfg, resolved.Telemetry.Stats.Providers.SlowRPC)
+	builders[slowrpc.Name] = slowrpc.BuiltinHandlerBuilderWithConfig(cfg)
+}
+
+func bindChannelzHandlerBuilder(
+	resolved settings.Resolved,
+	builders map[string]stats.HandlerBuilder,
+) {
+	if _, ok := builders[channelz.Name]; !ok {
+		return
+	}
+	cfg := channelz.Config{}
+	_ = settings.DecodePayload(&cfg, resolved.Telemetry.Stats.Providers.Channelz)
+	builders[channelz.Name] = channelz.BuiltinHandlerBuilderWithConfig(cfg)
+}
+
 // CompileSecurityProfiles compiles configured security profiles.
 func CompileSecurityProfiles(
 	resolved settings.Resolved,
@@ -262,6 +291,14 @@ func LoggingInterceptorSource(resolved settings.Resolved) any {
 	return nil
 }
 
+// InterceptorConfigSource returns the configured source for one interceptor provider.
+func InterceptorConfigSource(resolved settings.Resolved, name string) any {
+	if cfg := resolved.Extensions.Interceptors.Config[name]; cfg != nil {
+		return cfg
+	}
+	return nil
+}
+
 // NewMarshalerProvider builds the runtime marshaler REST provider.
 func NewMarshalerProvider(
 	resolved settings.Resolved,
@@ -333,7 +370,9 @@ func MapStreamClientProviders(
 }
 
 // ResolvedRequiresRestart reports whether changes in resolved settings require a restart.
+// Interceptor chains are rebuilt in place and therefore ignored.
 func ResolvedRequiresRestart(current, next settings.Resolved) bool {
+	current, next = withoutInterceptorChains(current), withoutInterceptorChains(next)
 	return !reflect.DeepEqual(current.Server, next.Server) ||
 		!reflect.DeepEqual(current.Clients, next.Clients) ||
 		!reflect.DeepEqual(current.Discovery, next.Discovery) ||
@@ -343,6 +382,24 @@ func ResolvedRequiresRestart(current, next settings.Resolved) bool {
 		!reflect.DeepEqual(current.Telemetry.Stats, next.Telemetry.Stats)
 }
 
+// withoutInterceptorChains clears the interceptor name lists and rules of the
+// server, client and extension settings.
+func withoutInterceptorChains(resolved settings.Resolved) settings.Resolved {
+	resolved.Server.Interceptors = server.InterceptorSettings{}
+	if len(resolved.Clients.Services) > 0 {
+		services := make(map[string]client.ServiceSettings, len(resolved.Clients.Services))
+		for name, item := range resolved.Clients.Services {
+			item.Interceptors = client.InterceptorSettings{}
+			services[name] = item
+		}
+		resolved.Clients.Services = services
+	}
+	resolved.Extensions.Interceptors = settings.ExtensionInterceptors{
+		Config: resolved.Extensions.Interceptors.Config,
+	}
+	return resolved
+}
+
 func cloneMap[K comparable, V any](in map[K]V) map[K]V {
 	if len(in) == 0 {
 		return map[K]V{}
@@ -38,13 +38,31 @@ func ReloadRequiresRestart(
 	}
 	for _, domain := range diff.AffectedDomains {
 		switch domain {
-		case "mode", "modules", "defaults", "chains", "overrides":
+		case "mode", "modules", "defaults", "overrides":
 			return true
+		case "chains":
+			if !interceptorChainsOnly(diff.Chains) {
+				return true
+			}
 		}
 	}
 	return false
 }
 
+// interceptorChainsOnly reports whether every changed chain is an rpc
+// interceptor chain, which the server and clients rebuild in place.
+func interceptorChainsOnly(chains []yassembly.ChainDiffEntry) bool {
+	if len(chains) == 0 {
+		return false
+	}
+	for _, item := range chains {
+		if !strings.HasPrefix(item.Target, "rpc.interceptor.") {
+			return false
+		}
+	}
+	return true
+}
+
 // ChangedConfigPaths returns deduplicated config paths that differ between two assembly results.
 func ChangedConfigPaths(prevPlan, nextPlan *yassembly.Result) []string {
 	if prevPlan == nil || nextPlan == nil {
@@ -333,6 +333,30 @@ func TestReloadRequiresRestart(t *testing.T) {
 		assert.True(t, ReloadRequiresRestart(diff, nil, nil, false))
 	})
 
+	t.Run("middleware chain changed returns true", func(t *testing.T) {
+		diff := &yassembly.SpecDiff{
+			HasChanges:      true,
+			AffectedDomains: []string{"chains"},
+			Chains: []yassembly.ChainDiffEntry{
+				{Target: "rpc.interceptor.unary_server"},
+				{Target: "middleware.rest_all"},
+			},
+		}
+		assert.True(t, ReloadRequiresRestart(diff, nil, nil, false))
+	})
+
+	t.Run("interceptor chains changed returns false", func(t *testing.T) {
+		diff := &yassembly.SpecDiff{
+			HasChanges:      true,
+			AffectedDomains: []string{"chains"},
+			Chains: []yassembly.ChainDiffEntry{
+				{Target: "rpc.interceptor.unary_server"},
+				{Target: "rpc.interceptor.unary_client"},
+			},
+		}
+		assert.False(t, ReloadRequiresRestart(diff, nil, nil, false))
+	})
+
 	t.Run("overrides domain changed returns true", func(t *testing.T) {
 		diff := &yassembly.SpecDiff{
 			HasChanges:      true,
@@ -46,11 +46,13 @@ type options struct {
 	registry         registry.Registry
 	shutdownTimeout  time.Duration
 	beforeStartHooks []func(context.Context) error
+	afterStartHooks  []func(context.Context) error
 	beforeStopHooks  []func(context.Context) error
 	afterStopHooks   []func(context.Context) error
 	lifecycleOptions []lifecycleOption
 	configManager    *config.Manager
 	configPath       string
+	configProfiles   []string
 	configSources    []configLayerSource
 	configBuilders   map[string]configchain.ContextBuilder
 
@@ -59,9 +61,11 @@ type options struct {
 	configFileLoaded              bool
 	managedConfigSourcesClosed    bool
 	processDefaults               bool
+	skipConfigValidation          bool
 	resolvedSettings              settings.Resolved
 	modules                       []module.Module
 	capabilityRegistrations       []CapabilityRegistration
+	staticDirs                    []staticDir
 }
 
 func (opts *options) buildLifecycleOptions() []lifecycleOption {
@@ -71,6 +75,7 @@ func (opts *options) buildLifecycleOptions() []lifecycleOption {
 		withLifecycleRegistry(opts.registry),
 		withLifecycleShutdownTimeout(opts.shutdownTimeout),
 		withLifecycleBeforeStartHooks(opts.beforeStartHooks...),
+		withLifecycleAfterStartHooks(opts.afterStartHooks...),
 		withLifecycleBeforeStopHooks(opts.beforeStopHooks...),
 		withLifecycleAfterStopHooks(opts.afterStopHooks...),
 		withLifecycleInternalServers(opts.internalServers...),
@@ -98,6 +103,15 @@ func WithBeforeStartHook(fns ...func(context.Context) error) Option {
 	}
 }
 
+// WithAfterStartHook register the after start hook. It runs once every
+// server has started and claimed its listeners.
+func WithAfterStartHook(fns ...func(context.Context) error) Option {
+	return func(opts *options) error {
+		opts.afterStartHooks = append(opts.afterStartHooks, fns...)
+		return nil
+	}
+}
+
 // WithBeforeStopHook register the before stop hook.
 func WithBeforeStopHook(fns ...func(context.Context) error) Option {
 	return func(opts *options) error {
@@ -122,6 +136,31 @@ func WithCleanup(name string, fn func(context.Context) error) Option {
 	}
 }
 
+// WithEndpointMetadata publishes metadata such as zone, canary or weight with
+// the registered endpoints of one protocol, or of every endpoint when
+// protocol is server.AnyProtocol.
+func WithEndpointMetadata(protocol string, metadata map[string]string) Option {
+	return func(opts *options) error {
+		opts.lifecycleOptions = append(
+			opts.lifecycleOptions,
+			withLifecycleEndpointMetadata(protocol, metadata),
+		)
+		return nil
+	}
+}
+
+// WithReadinessCheck adds checks consulted by the governor /readyz endpoint.
+// The instance reports ready only while every check returns nil.
+func WithReadinessCheck(checks ...func(context.Context) error) Option {
+	return func(opts *options) error {
+		opts.lifecycleOptions = append(
+			opts.lifecycleOptions,
+			withLifecycleReadinessChecks(checks...),
+		)
+		return nil
+	}
+}
+
 // WithConfigManager replaces the default framework config manager.
 func WithConfigManager(manager *config.Manager) Option {
 	return func(opts *options) error {
@@ -140,6 +179,16 @@ func WithProcessDefaults(enabled bool) Option {
 	}
 }
 
+// WithConfigValidation controls whether Init validates the merged config
+// against the framework schema and the schemas registered with the
+// config/schema package. Validation is enabled by default.
+func WithConfigValidation(enabled bool) Option {
+	return func(opts *options) error {
+		opts.skipConfigValidation = !enabled
+		return nil
+	}
+}
+
 // WithMode overrides the mode resolved by New.
 func WithMode(mode string) Option {
 	return func(opts *options) error {
@@ -169,6 +218,17 @@ func WithConfigPath(path string) Option {
 	}
 }
 
+// WithConfigProfiles selects the config profiles whose overlays, e.g.
+// config.dev.yaml, are merged over the config file in the given order.
+// The --yggdrasil-profiles flag takes precedence over this option, which
+// takes precedence over the YGGDRASIL_PROFILES environment variable.
+func WithConfigProfiles(profiles ...string) Option {
+	return func(opts *options) error {
+		opts.configProfiles = append(opts.configProfiles, profiles...)
+		return nil
+	}
+}
+
 // WithConfigSource registers an explicit configuration source loaded after the config file.
 func WithConfigSource(name string, priority config.Priority, src source.Source) Option {
 	return func(opts *options) error {
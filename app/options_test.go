@@ -54,6 +54,18 @@ func TestWithBeforeStartHook(t *testing.T) {
 	})
 }
 
+// --- WithAfterStartHook ---
+
+func TestWithAfterStartHook(t *testing.T) {
+	t.Run("adds hook functions", func(t *testing.T) {
+		opts := &options{}
+		fn := func(context.Context) error { return nil }
+		err := WithAfterStartHook(fn)(opts)
+		require.NoError(t, err)
+		assert.Len(t, opts.afterStartHooks, 1)
+	})
+}
+
 // --- WithBeforeStopHook ---
 
 func TestWithBeforeStopHook(t *testing.T) {
@@ -90,6 +102,15 @@ func TestWithCleanup(t *testing.T) {
 	})
 }
 
+// --- WithEndpointMetadata ---
+
+func TestWithEndpointMetadata(t *testing.T) {
+	opts := &options{}
+	err := WithEndpointMetadata("grpc", map[string]string{"weight": "10"})(opts)
+	require.NoError(t, err)
+	assert.Len(t, opts.lifecycleOptions, 1)
+}
+
 // --- WithConfigManager ---
 
 func TestWithConfigManager(t *testing.T) {
@@ -298,7 +319,7 @@ func TestBuildLifecycleOptions(t *testing.T) {
 		}
 		result := opts.buildLifecycleOptions()
 		assert.NotEmpty(t, result)
-		assert.Len(t, result, 8)
+		assert.Len(t, result, 9)
 	})
 
 	t.Run("includes extra lifecycle options", func(t *testing.T) {
@@ -306,7 +327,7 @@ func TestBuildLifecycleOptions(t *testing.T) {
 			lifecycleOptions: []lifecycleOption{func(r *lifecycleRunner) error { return nil }},
 		}
 		result := opts.buildLifecycleOptions()
-		assert.Len(t, result, 9)
+		assert.Len(t, result, 10)
 	})
 }
 
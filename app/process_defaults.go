@@ -26,6 +26,7 @@ import (
 
 	"github.com/codesjoy/yggdrasil/v3/internal/instance"
 	"github.com/codesjoy/yggdrasil/v3/internal/remotelog"
+	"github.com/codesjoy/yggdrasil/v3/observability/crashreport"
 )
 
 var (
@@ -44,6 +45,8 @@ type processDefaultsLease struct {
 	oldPropagator propagation.TextMapPropagator
 	oldRemote     *slog.Logger
 	oldInstance   instance.Snapshot
+	oldCrash      crashreport.Reporter
+	oldRedacted   []string
 
 	installed bool
 	released  bool
@@ -67,6 +70,7 @@ func acquireProcessDefaultsLease(app *App) (*processDefaultsLease, error) {
 		oldPropagator: otel.GetTextMapPropagator(),
 		oldRemote:     remotelog.Logger(),
 		oldInstance:   instance.ProcessDefaultSnapshot(),
+		oldCrash:      crashreport.Default(),
 	}
 	processDefaultsOwner = app
 	if app != nil {
@@ -99,6 +103,15 @@ func (lease *processDefaultsLease) install(snapshot *Snapshot) {
 	if snapshot.RemoteLogger != nil {
 		remotelog.SetLogger(snapshot.RemoteLogger)
 	}
+	if snapshot.CrashReporter != nil {
+		crashreport.SetReporter(snapshot.CrashReporter)
+	}
+	if redacted := snapshot.Resolved.Telemetry.CrashReport.Redacted; redacted != nil {
+		prev := crashreport.SetRedactedMetadata(redacted)
+		if lease.oldRedacted == nil {
+			lease.oldRedacted = prev
+		}
+	}
 	if !snapshot.Identity.isZero() {
 		identity := snapshot.Identity.internal()
 		instance.InstallProcessDefault(identity.AppName, identity.InstanceConfig())
@@ -123,6 +136,8 @@ func (lease *processDefaultsLease) release(context.Context) error {
 	oldPropagator := lease.oldPropagator
 	oldRemote := lease.oldRemote
 	oldInstance := lease.oldInstance
+	oldCrash := lease.oldCrash
+	oldRedacted := lease.oldRedacted
 	app := lease.app
 	lease.mu.Unlock()
 
@@ -143,6 +158,10 @@ func (lease *processDefaultsLease) release(context.Context) error {
 			remotelog.SetLogger(oldRemote)
 		}
 		instance.RestoreProcessDefault(oldInstance)
+		crashreport.SetReporter(oldCrash)
+		if oldRedacted != nil {
+			crashreport.SetRedactedMetadata(oldRedacted)
+		}
 	}
 
 	processDefaultsMu.Lock()
@@ -19,6 +19,7 @@ import (
 
 	internalruntime "github.com/codesjoy/yggdrasil/v3/app/internal/runtime"
 	yassembly "github.com/codesjoy/yggdrasil/v3/assembly"
+	"github.com/codesjoy/yggdrasil/v3/eventbus"
 	"github.com/codesjoy/yggdrasil/v3/module"
 )
 
@@ -76,6 +77,7 @@ func (a *App) Reload(ctx context.Context) error {
 			map[string]string{"target": target},
 		)
 		a.storeReloadPlan(nextPlan, diff, false, restartErr)
+		a.publishConfigReloaded(ctx, changedPaths, true)
 		return restartErr
 	}
 
@@ -94,9 +96,18 @@ func (a *App) Reload(ctx context.Context) error {
 	}
 
 	a.storeReloadPlan(nextPlan, diff, true, nil)
+	a.publishConfigReloaded(ctx, changedPaths, false)
 	return nil
 }
 
+func (a *App) publishConfigReloaded(ctx context.Context, changedPaths []string, restart bool) {
+	eventbus.Publish(ctx, eventbus.Default(), eventbus.ConfigReloaded{
+		AppName:         a.identity.AppName,
+		ChangedPaths:    changedPaths,
+		RestartRequired: restart,
+	})
+}
+
 func (a *App) recordReloadError(err error) error {
 	a.mu.Lock()
 	a.recordAssemblyErrorLocked(assemblyStageReload, err)
@@ -22,19 +22,40 @@ import (
 	"log/slog"
 
 	internalruntime "github.com/codesjoy/yggdrasil/v3/app/internal/runtime"
+	"github.com/codesjoy/yggdrasil/v3/config"
 	"github.com/codesjoy/yggdrasil/v3/discovery/registry"
 	"github.com/codesjoy/yggdrasil/v3/discovery/resolver"
+	"github.com/codesjoy/yggdrasil/v3/discovery/resolver/manual"
 	"github.com/codesjoy/yggdrasil/v3/internal/remotelog"
 	"github.com/codesjoy/yggdrasil/v3/internal/settings"
+	"github.com/codesjoy/yggdrasil/v3/observability/crashreport"
 	"github.com/codesjoy/yggdrasil/v3/observability/logger"
 	xotel "github.com/codesjoy/yggdrasil/v3/observability/otel"
 	"github.com/codesjoy/yggdrasil/v3/observability/stats"
+	"github.com/codesjoy/yggdrasil/v3/operations"
 	"github.com/codesjoy/yggdrasil/v3/rpc/interceptor"
+	"github.com/codesjoy/yggdrasil/v3/rpc/interceptor/accesslog"
+	"github.com/codesjoy/yggdrasil/v3/rpc/interceptor/audit"
+	"github.com/codesjoy/yggdrasil/v3/rpc/interceptor/baggage"
+	"github.com/codesjoy/yggdrasil/v3/rpc/interceptor/dedupe"
+	"github.com/codesjoy/yggdrasil/v3/rpc/interceptor/hedging"
+	"github.com/codesjoy/yggdrasil/v3/rpc/interceptor/i18n"
+	"github.com/codesjoy/yggdrasil/v3/rpc/interceptor/idempotency"
 	intlogging "github.com/codesjoy/yggdrasil/v3/rpc/interceptor/logging"
+	"github.com/codesjoy/yggdrasil/v3/rpc/interceptor/mdvalidate"
+	"github.com/codesjoy/yggdrasil/v3/rpc/interceptor/mirror"
+	"github.com/codesjoy/yggdrasil/v3/rpc/interceptor/propagation"
+	"github.com/codesjoy/yggdrasil/v3/rpc/interceptor/ratelimit"
+	"github.com/codesjoy/yggdrasil/v3/rpc/interceptor/recorder"
+	"github.com/codesjoy/yggdrasil/v3/rpc/interceptor/recovery"
+	"github.com/codesjoy/yggdrasil/v3/rpc/interceptor/resume"
+	"github.com/codesjoy/yggdrasil/v3/rpc/interceptor/timeout"
+	"github.com/codesjoy/yggdrasil/v3/tenant"
 	remote "github.com/codesjoy/yggdrasil/v3/transport"
 	"github.com/codesjoy/yggdrasil/v3/transport/gateway/rest"
 	grpcprotocol "github.com/codesjoy/yggdrasil/v3/transport/protocol/grpc"
 	rpchttp "github.com/codesjoy/yggdrasil/v3/transport/protocol/rpchttp"
+	"github.com/codesjoy/yggdrasil/v3/transport/runtime/client"
 	"github.com/codesjoy/yggdrasil/v3/transport/runtime/client/balancer"
 	"github.com/codesjoy/yggdrasil/v3/transport/runtime/server"
 	"github.com/codesjoy/yggdrasil/v3/transport/support/marshaler"
@@ -127,6 +148,7 @@ func (a *App) applyRuntimeAdapters(snapshot *Snapshot) error {
 	}
 	snapshot.RemoteLogger = remotelog.New(remoteLoggerLv, handler)
 	snapshot.TextMapPropagator = xotel.DefaultPropagator()
+	snapshot.CrashReporter = crashreport.New(snapshot.Resolved.Telemetry.CrashReport)
 
 	oldTracer := a.swapTracerShutdown(nil)
 	if tp, ok := snapshot.BuildTracerProvider(a.identity.AppName); ok {
@@ -202,12 +224,17 @@ func (a *App) shutdownRuntimeAdapters(ctx context.Context) error {
 	tracerShutdown := a.tracerShutdown
 	meterShutdown := a.meterShutdown
 	lease := a.processDefaultsLease
+	targets := a.mirrorTargets
 	a.tracerShutdown = nil
 	a.meterShutdown = nil
 	a.processDefaultsLease = nil
+	a.mirrorTargets = nil
 	a.runtimeMu.Unlock()
 
 	var err error
+	if targets != nil {
+		err = errors.Join(err, targets.Close())
+	}
 	if lease != nil {
 		err = errors.Join(err, lease.release(ctx))
 	}
@@ -270,6 +297,12 @@ func (a *App) initServer() error {
 		return err
 	}
 	server.RegisterGovernorRoutes(a.opts.governor, svr, a.identity)
+	a.registerStaticDirs(svr)
+	a.mountGovernor(svr)
+	if len(resolved.Server.Transports) > 0 && operations.Default().Enabled() {
+		svr.RegisterService(&operations.ServiceDesc, operations.NewService(operations.Default()))
+		a.installedRPCServices[operations.ServiceName] = struct{}{}
+	}
 	a.opts.server = svr
 	return nil
 }
@@ -466,17 +499,82 @@ func (a *App) buildRuntimeSnapshot() (*Snapshot, bool, error) {
 	}
 
 	loggingCfg := internalruntime.LoggingInterceptorSource(resolved)
+	recoveryCfg := internalruntime.InterceptorConfigSource(resolved, "recovery")
+	accessLogCfg := internalruntime.InterceptorConfigSource(resolved, "access_log")
+	auditCfg := internalruntime.InterceptorConfigSource(resolved, "audit")
+	rateLimitCfg := internalruntime.InterceptorConfigSource(resolved, "rate_limit")
+	i18nCfg := internalruntime.InterceptorConfigSource(resolved, "i18n")
+	baggageCfg := internalruntime.InterceptorConfigSource(resolved, "baggage")
+	tenantCfg := internalruntime.InterceptorConfigSource(resolved, "tenant")
+	mdValidateCfg := internalruntime.InterceptorConfigSource(resolved, "metadata_validation")
+	propagationCfg := internalruntime.InterceptorConfigSource(resolved, "metadata_propagation")
+	timeoutCfg := internalruntime.InterceptorConfigSource(resolved, "timeout")
+	dedupeCfg := internalruntime.InterceptorConfigSource(resolved, "dedupe")
 	unaryServerBuiltins := internalruntime.MapUnaryServerProviders(
-		intlogging.BuiltinUnaryServerProvidersWithConfig(loggingCfg),
+		append(
+			intlogging.BuiltinUnaryServerProvidersWithConfig(loggingCfg),
+			recovery.BuiltinUnaryServerProviderWithConfig(recoveryCfg, next.MeterProvider),
+			accesslog.BuiltinUnaryServerProviderWithConfig(accessLogCfg),
+			audit.BuiltinUnaryServerProviderWithConfig(auditCfg),
+			idempotency.BuiltinUnaryServerProviderWithConfig(
+				internalruntime.InterceptorConfigSource(resolved, "idempotency"),
+			),
+			ratelimit.BuiltinUnaryServerProviderWithConfig(rateLimitCfg),
+			i18n.BuiltinUnaryServerProviderWithConfig(i18nCfg),
+			baggage.BuiltinUnaryServerProviderWithConfig(baggageCfg),
+			tenant.BuiltinUnaryServerProviderWithConfig(tenantCfg),
+			mdvalidate.BuiltinUnaryServerProviderWithConfig(mdValidateCfg),
+			timeout.BuiltinUnaryServerProviderWithConfig(timeoutCfg),
+		),
 	)
 	streamServerBuiltins := internalruntime.MapStreamServerProviders(
-		intlogging.BuiltinStreamServerProvidersWithConfig(loggingCfg),
+		append(
+			intlogging.BuiltinStreamServerProvidersWithConfig(loggingCfg),
+			recovery.BuiltinStreamServerProviderWithConfig(recoveryCfg, next.MeterProvider),
+			accesslog.BuiltinStreamServerProviderWithConfig(accessLogCfg),
+			audit.BuiltinStreamServerProviderWithConfig(auditCfg),
+			ratelimit.BuiltinStreamServerProviderWithConfig(rateLimitCfg),
+			i18n.BuiltinStreamServerProviderWithConfig(i18nCfg),
+			baggage.BuiltinStreamServerProviderWithConfig(baggageCfg),
+			tenant.BuiltinStreamServerProviderWithConfig(tenantCfg),
+			mdvalidate.BuiltinStreamServerProviderWithConfig(mdValidateCfg),
+			timeout.BuiltinStreamServerProviderWithConfig(timeoutCfg),
+			dedupe.BuiltinStreamServerProviderWithConfig(dedupeCfg),
+		),
 	)
 	unaryClientBuiltins := internalruntime.MapUnaryClientProviders(
-		intlogging.BuiltinUnaryClientProvidersWithConfig(loggingCfg),
+		append(
+			intlogging.BuiltinUnaryClientProvidersWithConfig(loggingCfg),
+			hedging.BuiltinUnaryClientProviderWithConfig(
+				internalruntime.InterceptorConfigSource(resolved, "hedging"),
+			),
+			mirror.BuiltinUnaryClientProviderWithConfig(
+				internalruntime.InterceptorConfigSource(resolved, "mirror"),
+				a.shadowTargets(),
+			),
+			baggage.BuiltinUnaryClientProviderWithConfig(baggageCfg),
+			tenant.BuiltinUnaryClientProviderWithConfig(tenantCfg),
+			mdvalidate.BuiltinUnaryClientProviderWithConfig(mdValidateCfg),
+			propagation.BuiltinUnaryClientProviderWithConfig(propagationCfg),
+			timeout.BuiltinUnaryClientProviderWithConfig(timeoutCfg),
+			recorder.BuiltinUnaryClientProviderWithConfig(
+				internalruntime.InterceptorConfigSource(resolved, "recorder"),
+			),
+		),
 	)
 	streamClientBuiltins := internalruntime.MapStreamClientProviders(
-		intlogging.BuiltinStreamClientProvidersWithConfig(loggingCfg),
+		append(
+			intlogging.BuiltinStreamClientProvidersWithConfig(loggingCfg),
+			baggage.BuiltinStreamClientProviderWithConfig(baggageCfg),
+			tenant.BuiltinStreamClientProviderWithConfig(tenantCfg),
+			mdvalidate.BuiltinStreamClientProviderWithConfig(mdValidateCfg),
+			propagation.BuiltinStreamClientProviderWithConfig(propagationCfg),
+			timeout.BuiltinStreamClientProviderWithConfig(timeoutCfg),
+			dedupe.BuiltinStreamClientProviderWithConfig(dedupeCfg),
+			resume.BuiltinStreamClientProviderWithConfig(
+				internalruntime.InterceptorConfigSource(resolved, "resume"),
+			),
+		),
 	)
 
 	unaryServerProviders, err := internalruntime.ResolveOrderedRuntimeCapabilities[interceptor.UnaryServerInterceptorProvider](
@@ -586,7 +684,17 @@ func (a *App) buildRuntimeSnapshot() (*Snapshot, bool, error) {
 	if err != nil {
 		return nil, false, err
 	}
-	internalruntime.CopyIntoMap(next.ResolverProviders, resolverProviders)
+	var configManager *config.Manager
+	if a.opts != nil {
+		configManager = a.opts.configManager
+	}
+	internalruntime.CopyPreferredIntoMap(
+		next.ResolverProviders,
+		resolverProviders,
+		map[string]resolver.Provider{
+			manual.Type: manual.ConfigProvider(configManager),
+		},
+	)
 
 	balancerProviders, err := internalruntime.ResolveNamedRuntimeCapabilities[balancer.Provider](
 		a.hub,
@@ -601,7 +709,12 @@ func (a *App) buildRuntimeSnapshot() (*Snapshot, bool, error) {
 		next.BalancerProviders,
 		balancerProviders,
 		map[string]balancer.Provider{
-			"round_robin": balancer.BuiltinProvider(),
+			"round_robin":  balancer.BuiltinProvider(),
+			"least_loaded": balancer.LeastLoadedProvider(),
+			"locality": balancer.LocalityProvider(balancer.Locality{
+				Region: a.identity.Region,
+				Zone:   a.identity.Zone,
+			}),
 		},
 	)
 
@@ -622,3 +735,36 @@ func runtimeRequiresRestart(current, next *Snapshot) bool {
 	}
 	return internalruntime.ResolvedRequiresRestart(current.Resolved, next.Resolved)
 }
+
+// shadowTargets returns the app-scoped cache of mirror shadow clients. The
+// clients are built from the runtime snapshot current at dial time and
+// closed when the app stops.
+func (a *App) shadowTargets() *mirror.Targets {
+	a.runtimeMu.Lock()
+	defer a.runtimeMu.Unlock()
+	if a.mirrorTargets == nil {
+		a.mirrorTargets = mirror.NewTargets(
+			func(ctx context.Context, service string) (mirror.Invoker, error) {
+				snapshot := a.currentRuntimeSnapshot()
+				if snapshot == nil {
+					return nil, errors.New("runtime snapshot is not ready")
+				}
+				cli, err := client.New(ctx, service, snapshot)
+				if err != nil {
+					return nil, err
+				}
+				return mirrorInvoker{Client: cli}, nil
+			},
+		)
+	}
+	return a.mirrorTargets
+}
+
+// mirrorInvoker adapts a client to the mirror interceptor invoker.
+type mirrorInvoker struct {
+	client.Client
+}
+
+func (m mirrorInvoker) Invoke(ctx context.Context, method string, args, reply any) error {
+	return m.Client.Invoke(ctx, method, args, reply)
+}
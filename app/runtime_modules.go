@@ -21,16 +21,39 @@ import (
 
 	"github.com/codesjoy/yggdrasil/v3/capabilities"
 	"github.com/codesjoy/yggdrasil/v3/config"
+	"github.com/codesjoy/yggdrasil/v3/degrade"
 	"github.com/codesjoy/yggdrasil/v3/discovery/registry"
+	"github.com/codesjoy/yggdrasil/v3/discovery/resolver/dns"
+	"github.com/codesjoy/yggdrasil/v3/discovery/resolver/manual"
 	"github.com/codesjoy/yggdrasil/v3/module"
+	"github.com/codesjoy/yggdrasil/v3/observability/channelz"
 	"github.com/codesjoy/yggdrasil/v3/observability/logger"
 	statsotel "github.com/codesjoy/yggdrasil/v3/observability/stats/otel"
+	"github.com/codesjoy/yggdrasil/v3/observability/stats/slowrpc"
+	"github.com/codesjoy/yggdrasil/v3/rpc/interceptor/accesslog"
+	"github.com/codesjoy/yggdrasil/v3/rpc/interceptor/audit"
+	"github.com/codesjoy/yggdrasil/v3/rpc/interceptor/baggage"
+	"github.com/codesjoy/yggdrasil/v3/rpc/interceptor/dedupe"
+	"github.com/codesjoy/yggdrasil/v3/rpc/interceptor/hedging"
+	"github.com/codesjoy/yggdrasil/v3/rpc/interceptor/i18n"
+	"github.com/codesjoy/yggdrasil/v3/rpc/interceptor/idempotency"
 	intlogging "github.com/codesjoy/yggdrasil/v3/rpc/interceptor/logging"
+	"github.com/codesjoy/yggdrasil/v3/rpc/interceptor/mdvalidate"
+	"github.com/codesjoy/yggdrasil/v3/rpc/interceptor/mirror"
+	"github.com/codesjoy/yggdrasil/v3/rpc/interceptor/propagation"
+	"github.com/codesjoy/yggdrasil/v3/rpc/interceptor/ratelimit"
+	"github.com/codesjoy/yggdrasil/v3/rpc/interceptor/recorder"
+	"github.com/codesjoy/yggdrasil/v3/rpc/interceptor/recovery"
+	"github.com/codesjoy/yggdrasil/v3/rpc/interceptor/resume"
+	"github.com/codesjoy/yggdrasil/v3/rpc/interceptor/timeout"
+	"github.com/codesjoy/yggdrasil/v3/tenant"
 	"github.com/codesjoy/yggdrasil/v3/transport/gateway/rest"
 	grpcprotocol "github.com/codesjoy/yggdrasil/v3/transport/protocol/grpc"
 	rpchttp "github.com/codesjoy/yggdrasil/v3/transport/protocol/rpchttp"
 	"github.com/codesjoy/yggdrasil/v3/transport/runtime/client/balancer"
+	"github.com/codesjoy/yggdrasil/v3/transport/runtime/server"
 	"github.com/codesjoy/yggdrasil/v3/transport/support/marshaler"
+	"github.com/codesjoy/yggdrasil/v3/transport/support/orca"
 	"github.com/codesjoy/yggdrasil/v3/transport/support/security/insecure"
 	"github.com/codesjoy/yggdrasil/v3/transport/support/security/local"
 	ytls "github.com/codesjoy/yggdrasil/v3/transport/support/security/tls"
@@ -109,8 +132,9 @@ func (foundationBuiltinCapabilityModule) Capabilities() []module.Capability {
 		"tls":      ytls.BuiltinProvider(),
 	})
 	out = appendSortedCapabilities(out, marshalerCapabilitySpec, map[string]any{
-		"jsonpb": marshaler.JSONPbBuilder(),
-		"proto":  marshaler.ProtoBuilder(),
+		"jsonpb":  marshaler.JSONPbBuilder(),
+		"msgpack": marshaler.MsgpackBuilder(),
+		"proto":   marshaler.ProtoBuilder(),
 	})
 
 	return out
@@ -128,7 +152,9 @@ func (statsOtelCapabilityModule) Init(context.Context, config.View) error { retu
 
 func (statsOtelCapabilityModule) Capabilities() []module.Capability {
 	return appendSortedCapabilities(nil, statsHandlerCapabilitySpec, map[string]any{
-		"otel": statsotel.BuiltinHandlerBuilder(),
+		"otel":        statsotel.BuiltinHandlerBuilder(),
+		slowrpc.Name:  slowrpc.BuiltinHandlerBuilder(),
+		channelz.Name: channelz.BuiltinHandlerBuilder(),
 	})
 }
 
@@ -211,24 +237,59 @@ func (connectivityBuiltinCapabilityModule) Capabilities() []module.Capability {
 	for _, item := range intlogging.BuiltinUnaryServerProviders() {
 		unaryServer[item.Name()] = item
 	}
+	unaryServer["recovery"] = recovery.BuiltinUnaryServerProvider()
+	unaryServer["access_log"] = accesslog.BuiltinUnaryServerProvider()
+	unaryServer["audit"] = audit.BuiltinUnaryServerProvider()
+	unaryServer["idempotency"] = idempotency.BuiltinUnaryServerProvider()
+	unaryServer["rate_limit"] = ratelimit.BuiltinUnaryServerProvider()
+	unaryServer["i18n"] = i18n.BuiltinUnaryServerProvider()
+	unaryServer["baggage"] = baggage.BuiltinUnaryServerProvider()
+	unaryServer["tenant"] = tenant.BuiltinUnaryServerProvider()
+	unaryServer["metadata_validation"] = mdvalidate.BuiltinUnaryServerProvider()
+	unaryServer["timeout"] = timeout.BuiltinUnaryServerProvider()
 	out = appendSortedCapabilities(out, unaryServerInterceptorCapabilitySpec, unaryServer)
 
 	streamServer := map[string]any{}
 	for _, item := range intlogging.BuiltinStreamServerProviders() {
 		streamServer[item.Name()] = item
 	}
+	streamServer["recovery"] = recovery.BuiltinStreamServerProvider()
+	streamServer["access_log"] = accesslog.BuiltinStreamServerProvider()
+	streamServer["audit"] = audit.BuiltinStreamServerProvider()
+	streamServer["rate_limit"] = ratelimit.BuiltinStreamServerProvider()
+	streamServer["i18n"] = i18n.BuiltinStreamServerProvider()
+	streamServer["baggage"] = baggage.BuiltinStreamServerProvider()
+	streamServer["tenant"] = tenant.BuiltinStreamServerProvider()
+	streamServer["metadata_validation"] = mdvalidate.BuiltinStreamServerProvider()
+	streamServer["timeout"] = timeout.BuiltinStreamServerProvider()
+	streamServer["dedupe"] = dedupe.BuiltinStreamServerProvider()
 	out = appendSortedCapabilities(out, streamServerInterceptorCapabilitySpec, streamServer)
 
 	unaryClient := map[string]any{}
 	for _, item := range intlogging.BuiltinUnaryClientProviders() {
 		unaryClient[item.Name()] = item
 	}
+	unaryClient["hedging"] = hedging.BuiltinUnaryClientProvider()
+	unaryClient["mirror"] = mirror.BuiltinUnaryClientProvider()
+	unaryClient["baggage"] = baggage.BuiltinUnaryClientProvider()
+	unaryClient["tenant"] = tenant.BuiltinUnaryClientProvider()
+	unaryClient["metadata_validation"] = mdvalidate.BuiltinUnaryClientProvider()
+	unaryClient["metadata_propagation"] = propagation.BuiltinUnaryClientProvider()
+	unaryClient["timeout"] = timeout.BuiltinUnaryClientProvider()
+	unaryClient["recorder"] = recorder.BuiltinUnaryClientProvider()
 	out = appendSortedCapabilities(out, unaryClientInterceptorCapabilitySpec, unaryClient)
 
 	streamClient := map[string]any{}
 	for _, item := range intlogging.BuiltinStreamClientProviders() {
 		streamClient[item.Name()] = item
 	}
+	streamClient["baggage"] = baggage.BuiltinStreamClientProvider()
+	streamClient["tenant"] = tenant.BuiltinStreamClientProvider()
+	streamClient["metadata_validation"] = mdvalidate.BuiltinStreamClientProvider()
+	streamClient["metadata_propagation"] = propagation.BuiltinStreamClientProvider()
+	streamClient["timeout"] = timeout.BuiltinStreamClientProvider()
+	streamClient["dedupe"] = dedupe.BuiltinStreamClientProvider()
+	streamClient["resume"] = resume.BuiltinStreamClientProvider()
 	out = appendSortedCapabilities(out, streamClientInterceptorCapabilitySpec, streamClient)
 
 	out = appendSortedCapabilities(out, restMiddlewareCapabilitySpec, map[string]any{
@@ -238,8 +299,14 @@ func (connectivityBuiltinCapabilityModule) Capabilities() []module.Capability {
 	out = appendSortedCapabilities(out, registryProviderCapabilitySpec, map[string]any{
 		"multi_registry": registry.BuiltinProvider(),
 	})
+	out = appendSortedCapabilities(out, resolverProviderCapabilitySpec, map[string]any{
+		dns.Scheme:  dns.Provider(),
+		manual.Type: manual.ConfigProvider(nil),
+	})
 	out = appendSortedCapabilities(out, balancerProviderCapabilitySpec, map[string]any{
-		"round_robin": balancer.BuiltinProvider(),
+		"round_robin":  balancer.BuiltinProvider(),
+		"least_loaded": balancer.LeastLoadedProvider(),
+		"locality":     balancer.LocalityProvider(balancer.Locality{}),
 	})
 
 	return out
@@ -343,7 +410,32 @@ func (c connectivityRuntimeCommitter) Commit(context.Context) error {
 	if c.restartRequired && c.app.hub != nil {
 		c.app.hub.MarkRestartRequired("connectivity.runtime")
 	}
+	c.app.applyServerSettings(c.next)
 	return c.app.applyRuntimeAdapters(c.next)
 }
 
+// applyServerSettings applies the reloaded settings that take effect without
+// a restart: the handler pool, load reporting, degradation and the
+// interceptor chains of the server and the live clients.
+func (a *App) applyServerSettings(snapshot *Snapshot) {
+	if snapshot == nil || a.opts == nil {
+		return
+	}
+	a.clients.configureInterceptors(snapshot)
+	if srv, ok := a.opts.server.(interface{ ConfigureInterceptors(server.Runtime) }); ok {
+		srv.ConfigureInterceptors(snapshot)
+	}
+	if srv, ok := a.opts.server.(interface {
+		ResizeHandlerPool(server.HandlerPoolSettings)
+	}); ok {
+		srv.ResizeHandlerPool(snapshot.Resolved.Server.HandlerPool)
+	}
+	if srv, ok := a.opts.server.(interface{ ConfigureLoadReport(orca.Config) }); ok {
+		srv.ConfigureLoadReport(snapshot.Resolved.Server.LoadReport)
+	}
+	if srv, ok := a.opts.server.(interface{ ConfigureDegradation(degrade.Config) }); ok {
+		srv.ConfigureDegradation(snapshot.Resolved.Server.Degradation)
+	}
+}
+
 func (connectivityRuntimeCommitter) Rollback(context.Context) error { return nil }
@@ -34,6 +34,7 @@ import (
 	"github.com/codesjoy/yggdrasil/v3/internal/remotelog"
 	"github.com/codesjoy/yggdrasil/v3/internal/settings"
 	"github.com/codesjoy/yggdrasil/v3/module"
+	"github.com/codesjoy/yggdrasil/v3/observability/crashreport"
 	"github.com/codesjoy/yggdrasil/v3/observability/logger"
 	xotel "github.com/codesjoy/yggdrasil/v3/observability/otel"
 	"github.com/codesjoy/yggdrasil/v3/observability/stats"
@@ -165,18 +166,20 @@ func TestRuntimeAppliesLoggingFromResolvedSettings(t *testing.T) {
 	oldRemote := remotelog.Logger()
 	app, _ := newInitializedAppWithConfig(t, "logger-runtime", map[string]any{
 		"yggdrasil": map[string]any{
-			"logging": map[string]any{
-				"writers": map[string]any{
-					"default": map[string]any{"type": "console"},
-				},
-				"handlers": map[string]any{
-					"default": map[string]any{
-						"type":   "text",
-						"writer": "default",
-						"config": map[string]any{"level": "info"},
+			"observability": map[string]any{
+				"logging": map[string]any{
+					"writers": map[string]any{
+						"default": map[string]any{"type": "console"},
+					},
+					"handlers": map[string]any{
+						"default": map[string]any{
+							"type":   "text",
+							"writer": "default",
+							"config": map[string]any{"level": "info"},
+						},
 					},
+					"remote_level": "error",
 				},
-				"remote_level": "error",
 			},
 		},
 	})
@@ -273,6 +276,16 @@ func TestApplyRuntimeAdapters_ShutsDownPreviousTracerAndMeterProviders(t *testin
 	require.Equal(t, int32(2), atomic.LoadInt32(&meterShutdowns))
 }
 
+func TestShadowTargetsAreSharedAndClosedOnShutdown(t *testing.T) {
+	a := &App{}
+	targets := a.shadowTargets()
+	require.Same(t, targets, a.shadowTargets())
+
+	require.NoError(t, a.shutdownRuntimeAdapters(context.Background()))
+	assert.Nil(t, a.mirrorTargets)
+	assert.NotSame(t, targets, a.shadowTargets())
+}
+
 func TestSnapshotReturnsDetachedCopy(t *testing.T) {
 	app, _ := newInitializedAppWithConfig(t, "snapshot-copy", minimalV3Config("grpc"))
 	t.Cleanup(func() { _ = app.Stop(context.Background()) })
@@ -560,3 +573,31 @@ func TestRuntimeSnapshotTransportProvidersBuildClientsAndServersFromExplicitBuil
 		require.NoError(t, client.Close())
 	}
 }
+
+func TestRuntimeBuildsCrashReporter(t *testing.T) {
+	oldReporter := crashreport.Default()
+	app, _ := newInitializedAppWithConfig(t, "crash-runtime", map[string]any{
+		"yggdrasil": map[string]any{
+			"observability": map[string]any{
+				"telemetry": map[string]any{
+					"crash_report": map[string]any{
+						"webhook": map[string]any{"url": "http://127.0.0.1/crash"},
+					},
+				},
+			},
+		},
+	})
+	t.Cleanup(func() { _ = app.Stop(context.Background()) })
+
+	snapshot := app.currentRuntimeSnapshot()
+	require.NotNil(t, snapshot)
+	require.NotNil(t, snapshot.CrashReporter)
+	require.Equal(t, oldReporter, crashreport.Default())
+
+	lease, err := acquireProcessDefaultsLease(app)
+	require.NoError(t, err)
+	lease.install(snapshot)
+	require.Equal(t, snapshot.CrashReporter, crashreport.Default())
+	require.NoError(t, lease.release(context.Background()))
+	require.Equal(t, oldReporter, crashreport.Default())
+}
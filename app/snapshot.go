@@ -26,6 +26,7 @@ import (
 	"github.com/codesjoy/yggdrasil/v3/discovery/registry"
 	"github.com/codesjoy/yggdrasil/v3/discovery/resolver"
 	"github.com/codesjoy/yggdrasil/v3/internal/settings"
+	"github.com/codesjoy/yggdrasil/v3/observability/crashreport"
 	"github.com/codesjoy/yggdrasil/v3/observability/logger"
 	xotel "github.com/codesjoy/yggdrasil/v3/observability/otel"
 	"github.com/codesjoy/yggdrasil/v3/observability/stats"
@@ -49,6 +50,7 @@ type Snapshot struct {
 	TracerProvider    trace.TracerProvider
 	MeterProvider     metric.MeterProvider
 	TextMapPropagator propagation.TextMapPropagator
+	CrashReporter     crashreport.Reporter
 
 	LoggerHandlerBuilders map[string]logger.HandlerBuilder
 	LoggerWriterBuilders  map[string]logger.WriterBuilder
@@ -105,6 +107,7 @@ func (s *Snapshot) Copy() *Snapshot {
 		TracerProvider:                  s.TracerProvider,
 		MeterProvider:                   s.MeterProvider,
 		TextMapPropagator:               s.TextMapPropagator,
+		CrashReporter:                   s.CrashReporter,
 		LoggerHandlerBuilders:           cloneMap(s.LoggerHandlerBuilders),
 		LoggerWriterBuilders:            cloneMap(s.LoggerWriterBuilders),
 		TracerProviderBuilders:          cloneMap(s.TracerProviderBuilders),
@@ -180,6 +183,14 @@ func (s *Snapshot) RESTMiddlewareProviders() map[string]rest.Provider {
 	return cloneMap(s.RESTMiddlewareProviderMap)
 }
 
+// TracePropagator returns the App-scoped trace propagator.
+func (s *Snapshot) TracePropagator() propagation.TextMapPropagator {
+	if s == nil {
+		return nil
+	}
+	return s.TextMapPropagator
+}
+
 // MarshalerBuilders returns the App-scoped marshaler builders.
 func (s *Snapshot) MarshalerBuilders() map[string]marshaler.MarshalerBuilder {
 	if s == nil {
@@ -246,6 +257,33 @@ func (s *Snapshot) BuildStreamClientInterceptor(
 	)
 }
 
+// ResolveServerInterceptors returns the unary and stream server interceptor
+// names applied to fullMethod after interceptor rules are evaluated.
+func (s *Snapshot) ResolveServerInterceptors(fullMethod string) (unary, stream []string) {
+	if s == nil {
+		return nil, nil
+	}
+	cfg := s.Resolved.Server.Interceptors
+	unary = interceptor.NewChainResolver(cfg.Unary, cfg.Rules).Resolve(fullMethod)
+	stream = interceptor.NewChainResolver(cfg.Stream, cfg.Rules).Resolve(fullMethod)
+	return unary, stream
+}
+
+// ResolveClientInterceptors returns the unary and stream client interceptor
+// names applied to fullMethod of one client service.
+func (s *Snapshot) ResolveClientInterceptors(
+	serviceName string,
+	fullMethod string,
+) (unary, stream []string) {
+	if s == nil {
+		return nil, nil
+	}
+	cfg := s.ClientSettings(serviceName).Interceptors
+	unary = interceptor.NewChainResolver(cfg.Unary, cfg.Rules).Resolve(fullMethod)
+	stream = interceptor.NewChainResolver(cfg.Stream, cfg.Rules).Resolve(fullMethod)
+	return unary, stream
+}
+
 // BuildRESTMiddlewares builds one REST middleware chain from the explicit provider map.
 func (s *Snapshot) BuildRESTMiddlewares(names ...string) chi.Middlewares {
 	return rest.BuildWithProviders(s.RESTMiddlewareProviderMap, names...)
@@ -289,13 +327,21 @@ func (s *Snapshot) NewResolver(name string) (resolver.Resolver, error) {
 		if name == resolver.DefaultResolverName {
 			return nil, nil
 		}
-		return nil, fmt.Errorf("not found resolver type, name: %s", name)
+		// Resolvers named after a provider type work without configuration.
+		if s.ResolverProviders[name] == nil {
+			return nil, fmt.Errorf("not found resolver type, name: %s", name)
+		}
+		typeName = name
 	}
 	provider := s.ResolverProviders[typeName]
 	if provider == nil {
 		return nil, fmt.Errorf("not found resolver provider, type: %s", typeName)
 	}
-	return provider.New(name)
+	r, err := resolver.Build(provider, name, spec)
+	if err != nil {
+		return nil, err
+	}
+	return resolver.WithCache(r, name, spec.Cache), nil
 }
 
 // NewBalancer builds one balancer using explicit providers and resolved settings.
@@ -350,7 +396,11 @@ func (s *Snapshot) BuildDefaultLoggerHandler() (slog.Handler, error) {
 	if handlerBuilder == nil {
 		return nil, fmt.Errorf("handler builder for type %s not found", typeName)
 	}
-	return handlerBuilder(writerName, spec.Config)
+	handler, err := handlerBuilder(writerName, spec.Config)
+	if err != nil {
+		return nil, err
+	}
+	return logger.ContextHandler(handler), nil
 }
 
 // BuildTracerProvider builds the configured tracer provider.
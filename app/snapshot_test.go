@@ -22,8 +22,10 @@ import (
 
 	"github.com/codesjoy/yggdrasil/v3/discovery/registry"
 	"github.com/codesjoy/yggdrasil/v3/discovery/resolver"
+	"github.com/codesjoy/yggdrasil/v3/discovery/resolver/dns"
 	"github.com/codesjoy/yggdrasil/v3/internal/settings"
 	"github.com/codesjoy/yggdrasil/v3/observability/stats"
+	"github.com/codesjoy/yggdrasil/v3/rpc/interceptor"
 	"github.com/codesjoy/yggdrasil/v3/transport/gateway/rest"
 	"github.com/codesjoy/yggdrasil/v3/transport/runtime/client"
 	"github.com/codesjoy/yggdrasil/v3/transport/runtime/client/balancer"
@@ -160,6 +162,40 @@ func TestSnapshot_NewResolver(t *testing.T) {
 		require.NoError(t, err)
 		assert.Nil(t, r)
 	})
+
+	t.Run("provider named resolver works without config", func(t *testing.T) {
+		s := &Snapshot{
+			Resolved: settings.Resolved{},
+			ResolverProviders: map[string]resolver.Provider{
+				dns.Scheme: dns.Provider(),
+			},
+		}
+		r, err := s.NewResolver(dns.Scheme)
+		require.NoError(t, err)
+		assert.Equal(t, dns.Scheme, r.Type())
+	})
+
+	t.Run("config provider receives spec config", func(t *testing.T) {
+		var got map[string]any
+		s := &Snapshot{
+			Resolved: settings.Resolved{},
+			ResolverProviders: map[string]resolver.Provider{
+				"cfg": resolver.NewConfigProvider(
+					"cfg",
+					func(_ string, cfg map[string]any) (resolver.Resolver, error) {
+						got = cfg
+						return dns.New(dns.Config{}, nil), nil
+					},
+				),
+			},
+		}
+		s.Resolved.Discovery.Resolvers = map[string]resolver.Spec{
+			"custom": {Type: "cfg", Config: map[string]any{"k": "v"}},
+		}
+		_, err := s.NewResolver("custom")
+		require.NoError(t, err)
+		assert.Equal(t, map[string]any{"k": "v"}, got)
+	})
 }
 
 // --- Snapshot.NewBalancer ---
@@ -256,3 +292,41 @@ func TestCloneMap(t *testing.T) {
 		assert.False(t, exists)
 	})
 }
+
+// --- Snapshot interceptor dry-run ---
+
+func TestSnapshot_ResolveInterceptors(t *testing.T) {
+	s := &Snapshot{Resolved: settings.Resolved{}}
+	s.Resolved.Server.Interceptors = server.InterceptorSettings{
+		Unary:  []string{"logging", "recovery"},
+		Stream: []string{"logging"},
+		Rules: []interceptor.ChainRule{{
+			Methods: []string{"/grpc.health.v1.Health/*"},
+			Remove:  []string{"logging"},
+		}},
+	}
+	s.Resolved.Clients.Services = map[string]client.ServiceSettings{
+		"svc": {Interceptors: client.InterceptorSettings{
+			Unary: []string{"logging"},
+			Rules: []interceptor.ChainRule{{
+				Methods: []string{"/svc.v1.Svc/Get"},
+				Append:  []string{"retry"},
+			}},
+		}},
+	}
+
+	unary, stream := s.ResolveServerInterceptors("/grpc.health.v1.Health/Check")
+	assert.Equal(t, []string{"recovery"}, unary)
+	assert.Empty(t, stream)
+	unary, stream = s.ResolveServerInterceptors("/svc.v1.Svc/Get")
+	assert.Equal(t, []string{"logging", "recovery"}, unary)
+	assert.Equal(t, []string{"logging"}, stream)
+
+	unary, _ = s.ResolveClientInterceptors("svc", "/svc.v1.Svc/Get")
+	assert.Equal(t, []string{"logging", "retry"}, unary)
+
+	var nilSnapshot *Snapshot
+	unary, stream = nilSnapshot.ResolveServerInterceptors("/svc.v1.Svc/Get")
+	assert.Nil(t, unary)
+	assert.Nil(t, stream)
+}
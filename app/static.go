@@ -0,0 +1,65 @@
+// Copyright 2022 The codesjoy Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package app
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"strings"
+
+	internalinstall "github.com/codesjoy/yggdrasil/v3/app/internal/install"
+	"github.com/codesjoy/yggdrasil/v3/transport/gateway/rest"
+	"github.com/codesjoy/yggdrasil/v3/transport/runtime/server"
+)
+
+type staticDir struct {
+	pattern string
+	handler http.HandlerFunc
+}
+
+// WithRestStaticDir serves the files of fsys under the URL prefix of the
+// REST server, next to the raw HTTP handlers. Pass os.DirFS for on-disk
+// assets or an embed.FS for assets shipped inside the binary.
+func WithRestStaticDir(prefix string, fsys fs.FS, opts ...rest.StaticOption) Option {
+	return func(o *options) error {
+		if fsys == nil {
+			return errors.New("static dir file system is nil")
+		}
+		if !strings.HasPrefix(prefix, "/") {
+			return fmt.Errorf("static dir prefix %q must start with /", prefix)
+		}
+		prefix = strings.TrimSuffix(prefix, "/")
+		o.staticDirs = append(o.staticDirs, staticDir{
+			pattern: prefix + "/*",
+			handler: rest.StaticHandler(prefix, fsys, opts...),
+		})
+		return nil
+	}
+}
+
+func (a *App) registerStaticDirs(svr server.Server) {
+	for _, dir := range a.opts.staticDirs {
+		for _, method := range []string{http.MethodGet, http.MethodHead} {
+			svr.RegisterRestRawHandlers(&server.RestRawHandlerDesc{
+				Method:  method,
+				Path:    dir.pattern,
+				Handler: dir.handler,
+			})
+			a.installedHTTPRoutes[internalinstall.RouteKey(method, dir.pattern)] = struct{}{}
+		}
+	}
+}
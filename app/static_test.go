@@ -0,0 +1,60 @@
+// Copyright 2022 The codesjoy Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package app
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/require"
+
+	internalinstall "github.com/codesjoy/yggdrasil/v3/app/internal/install"
+)
+
+func TestWithRestStaticDirValidates(t *testing.T) {
+	opts := &options{}
+	require.Error(t, WithRestStaticDir("/ui", nil)(opts))
+	require.Error(t, WithRestStaticDir("ui", fstest.MapFS{})(opts))
+	require.NoError(t, WithRestStaticDir("/ui/", fstest.MapFS{})(opts))
+	require.Len(t, opts.staticDirs, 1)
+	require.Equal(t, "/ui/*", opts.staticDirs[0].pattern)
+}
+
+func TestWithRestStaticDirRegistersRoutes(t *testing.T) {
+	app, err := New(
+		"static-dir",
+		WithConfigManager(newTestManager(t, assemblyTestConfig(true))),
+		WithModules(testTransportModule{recorder: newTransportRecorder()}),
+		WithRestStaticDir("/ui", fstest.MapFS{"index.html": {Data: []byte("ui")}}),
+	)
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = app.Stop(context.Background()) })
+
+	require.NoError(t, app.Prepare(context.Background()))
+	_, err = app.installServer("static")
+	require.NoError(t, err)
+	require.Contains(
+		t,
+		app.installedHTTPRoutes,
+		internalinstall.RouteKey(http.MethodGet, "/ui/*"),
+	)
+	require.Contains(
+		t,
+		app.installedHTTPRoutes,
+		internalinstall.RouteKey(http.MethodHead, "/ui/*"),
+	)
+}
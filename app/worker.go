@@ -0,0 +1,80 @@
+// Copyright 2022 The codesjoy Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package app
+
+import (
+	"errors"
+	"time"
+
+	internallifecycle "github.com/codesjoy/yggdrasil/v3/app/internal/lifecycle"
+	"github.com/codesjoy/yggdrasil/v3/internal/backoff"
+)
+
+// Runnable is a background worker managed by the application lifecycle.
+// Run blocks until the worker finishes or its context is canceled; Stop asks
+// the worker to finish during graceful shutdown.
+type Runnable = internallifecycle.Runnable
+
+// WorkerOption configures one worker registered with WithWorker.
+type WorkerOption func(*internallifecycle.Worker)
+
+// WithWorkerName sets the name used in worker logs.
+func WithWorkerName(name string) WorkerOption {
+	return func(worker *internallifecycle.Worker) {
+		worker.Name = name
+	}
+}
+
+// WithWorkerRestart controls whether a worker whose Run fails or panics is
+// restarted. Restart is enabled by default.
+func WithWorkerRestart(enabled bool) WorkerOption {
+	return func(worker *internallifecycle.Worker) {
+		worker.Restart = enabled
+	}
+}
+
+// WithWorkerMaxRestarts bounds the restarts of a failing worker. Zero means
+// unlimited.
+func WithWorkerMaxRestarts(n int) WorkerOption {
+	return func(worker *internallifecycle.Worker) {
+		worker.MaxRestarts = n
+	}
+}
+
+// WithWorkerBackoff sets the exponential delay between restarts.
+func WithWorkerBackoff(base, maxDelay time.Duration) WorkerOption {
+	return func(worker *internallifecycle.Worker) {
+		cfg := backoff.DefaultConfig
+		cfg.BaseDelay = base
+		cfg.MaxDelay = maxDelay
+		worker.Backoff = backoff.Exponential{Config: cfg}
+	}
+}
+
+// WithWorker registers a background worker. Workers start after the servers
+// are serving and are stopped before the servers within the shutdown timeout.
+func WithWorker(runnable Runnable, opts ...WorkerOption) Option {
+	return func(o *options) error {
+		if runnable == nil {
+			return errors.New("worker runnable is nil")
+		}
+		worker := internallifecycle.Worker{Runnable: runnable, Restart: true}
+		for _, opt := range opts {
+			opt(&worker)
+		}
+		o.lifecycleOptions = append(o.lifecycleOptions, withLifecycleWorkers(worker))
+		return nil
+	}
+}
@@ -0,0 +1,63 @@
+// Copyright 2022 The codesjoy Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package app
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	internallifecycle "github.com/codesjoy/yggdrasil/v3/app/internal/lifecycle"
+	"github.com/codesjoy/yggdrasil/v3/internal/backoff"
+)
+
+type nopWorker struct{}
+
+func (nopWorker) Run(ctx context.Context) error {
+	<-ctx.Done()
+	return nil
+}
+
+func (nopWorker) Stop(context.Context) error { return nil }
+
+func TestWorkerOptions(t *testing.T) {
+	worker := internallifecycle.Worker{Restart: true}
+	for _, opt := range []WorkerOption{
+		WithWorkerName("indexer"),
+		WithWorkerRestart(false),
+		WithWorkerMaxRestarts(3),
+		WithWorkerBackoff(10*time.Millisecond, time.Second),
+	} {
+		opt(&worker)
+	}
+	assert.Equal(t, "indexer", worker.Name)
+	assert.False(t, worker.Restart)
+	assert.Equal(t, 3, worker.MaxRestarts)
+	exp, ok := worker.Backoff.(backoff.Exponential)
+	require.True(t, ok)
+	assert.Equal(t, 10*time.Millisecond, exp.Config.BaseDelay)
+	assert.Equal(t, time.Second, exp.Config.MaxDelay)
+}
+
+func TestWithWorker(t *testing.T) {
+	_, err := New("worker-app", WithWorker(nil))
+	require.Error(t, err)
+
+	_, err = New("worker-app", WithWorker(nopWorker{}, WithWorkerName("indexer")))
+	require.NoError(t, err)
+}
@@ -23,6 +23,12 @@ import (
 	"google.golang.org/protobuf/types/pluginpb"
 )
 
+var genClient = flag.Bool(
+	"client",
+	false,
+	"also generate an HTTP client per service calling its REST gateway routes",
+)
+
 func main() {
 	protogen.Options{
 		ParamFunc: flag.CommandLine.Set,
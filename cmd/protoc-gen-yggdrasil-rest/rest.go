@@ -44,7 +44,13 @@ const (
 	svrPkg = protogen.GoImportPath(
 		"github.com/codesjoy/yggdrasil/v3/transport/runtime/server",
 	)
-	codePkg = protogen.GoImportPath("google.golang.org/genproto/googleapis/rpc/code")
+	codePkg   = protogen.GoImportPath("google.golang.org/genproto/googleapis/rpc/code")
+	clientPkg = protogen.GoImportPath(
+		"github.com/codesjoy/yggdrasil/v3/transport/runtime/client",
+	)
+	restClientPkg = protogen.GoImportPath(
+		"github.com/codesjoy/yggdrasil/v3/transport/gateway/rest/restclient",
+	)
 )
 
 // methodSets tracks the per-method-name counter used to disambiguate overloaded
@@ -132,6 +138,7 @@ func genService(
 
 		ServiceType: service.GoName,
 		ServiceName: string(service.Desc.FullName()),
+		Client:      *genClient,
 	}
 
 	for _, method := range service.Methods {
@@ -155,6 +162,10 @@ func genService(
 			break
 		}
 	}
+	if sd.Client {
+		sd.ClientPkg = g.QualifiedGoIdent(clientPkg.Ident(""))
+		sd.RestClientPkg = g.QualifiedGoIdent(restClientPkg.Ident(""))
+	}
 	g.P(sd.execute())
 	return nil
 }
@@ -187,6 +198,7 @@ func buildMethod(sd *serviceDesc, g *protogen.GeneratedFile, method *protogen.Me
 	if item == nil {
 		return nil
 	}
+	item.Primary = true
 	sd.Methods = append(sd.Methods, item)
 	return nil
 }
@@ -236,6 +248,7 @@ func buildHTTPRule(
 	}
 
 	body = rule.Body
+	md.BodyField = body
 	if method == http.MethodGet || method == http.MethodDelete {
 		if body != "" {
 			return nil, fmt.Errorf("%s %s body should not be declared", method, path)
@@ -293,10 +306,17 @@ func buildMethodDesc(
 	// the next call with the same GoName gets a higher Num value.
 	defer func() { methodSets[m.GoName]++ }()
 	desc := &methodDesc{
-		Name:    m.GoName,
-		Num:     methodSets[m.GoName],
-		Request: g.QualifiedGoIdent(m.Input.GoIdent),
-		Method:  method,
+		Name:     m.GoName,
+		Num:      methodSets[m.GoName],
+		Request:  g.QualifiedGoIdent(m.Input.GoIdent),
+		RPCName:  string(m.Desc.Name()),
+		Method:   method,
+		Template: path,
+	}
+	// Only the REST client refers to the response type; qualifying it
+	// otherwise would import its package without using it.
+	if *genClient && m.Output != nil {
+		desc.Response = g.QualifiedGoIdent(m.Output.GoIdent)
 	}
 	var err error
 	desc.Path, desc.PathBindings, err = buildPathVars(path)
@@ -19,10 +19,13 @@ import (
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"google.golang.org/genproto/googleapis/api/annotations"
 	"google.golang.org/protobuf/compiler/protogen"
 	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
 	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/known/emptypb"
 	"google.golang.org/protobuf/types/pluginpb"
 )
 
@@ -57,6 +60,7 @@ func TestServiceDesc_Execute(t *testing.T) {
 	assert.Contains(t, output, "func local_handler_Greeter_SayHello_0")
 	assert.Contains(t, output, "protoReq := &HelloRequest{}")
 	assert.Contains(t, output, "var GreeterRestServiceDesc = svrRestServiceDesc")
+	assert.Contains(t, output, `ServiceName: "helloworld.Greeter",`)
 	assert.Contains(t, output, `Method: "POST"`)
 	assert.Contains(t, output, `Path: "/v1/greeter/say_hello"`)
 }
@@ -433,16 +437,25 @@ func TestBuildHTTPRule_Errors(t *testing.T) {
 				MessageType: []*descriptorpb.DescriptorProto{
 					{Name: proto.String("HelloRequest")},
 				},
+				Service: []*descriptorpb.ServiceDescriptorProto{
+					{
+						Name: proto.String("Greeter"),
+						Method: []*descriptorpb.MethodDescriptorProto{
+							{
+								Name:       proto.String("SayHello"),
+								InputType:  proto.String(".test.HelloRequest"),
+								OutputType: proto.String(".test.HelloRequest"),
+							},
+						},
+					},
+				},
 			},
 		},
 	})
 	assert.NoError(t, err)
 
 	g := gen.NewGeneratedFile("test.go", gen.Files[0].GoImportPath)
-	m := &protogen.Method{
-		GoName: "SayHello",
-		Input:  gen.Files[0].Messages[0],
-	}
+	m := gen.Files[0].Services[0].Methods[0]
 
 	// Test GET with body
 	rule := &annotations.HttpRule{
@@ -537,7 +550,9 @@ func TestGenerateFiles_ExpandsSingletonRoute(t *testing.T) {
 	assert.NoError(t, err)
 
 	output := generatedFileContent(t, gen, "test_rest.pb.go")
-	assert.Contains(t, output, `Path:    "/v1/organizations/{params1}/settings"`)
+	assert.Contains(t, output, `Path:     "/v1/organizations/{params1}/settings"`)
+	assert.Contains(t, output, `RPC:      "/test.SettingsService/GetSettings"`)
+	assert.Contains(t, output, `Template: "/v1/{name=organizations/*/settings}"`)
 	assert.Contains(t, output, `PopulateFieldFromPath(protoReq, "name", val)`)
 	assert.Contains(t, output, `"organizations/" + v5.URLParam(r, "params1") + "/settings"`)
 }
@@ -620,7 +635,7 @@ func TestGenerateFiles_NamedBodyPatchIncludesQueryBeforePathPopulation(t *testin
 	assert.NotEqual(t, -1, pathIdx)
 	assert.True(t, decodeIdx < queryIdx)
 	assert.True(t, queryIdx < pathIdx)
-	assert.Contains(t, output, `Path:    "/v1/organizations/{params1}/settings"`)
+	assert.Contains(t, output, `Path:     "/v1/organizations/{params1}/settings"`)
 }
 
 func TestGenerateFiles_BodyStarSkipsQueryParsing(t *testing.T) {
@@ -735,6 +750,220 @@ func TestGenerateFiles_OmitsRestImportWhenHelpersAreUnused(t *testing.T) {
 	assert.NotContains(t, output, `PopulateFieldFromPath(`)
 }
 
+func TestGenerateFiles_Client(t *testing.T) {
+	methodSets = make(map[string]int)
+	prev := *genClient
+	*genClient = true
+	t.Cleanup(func() { *genClient = prev })
+
+	gen := newTestPlugin(t, &descriptorpb.FileDescriptorProto{
+		Name:    proto.String("test.proto"),
+		Package: proto.String("test"),
+		Options: &descriptorpb.FileOptions{
+			GoPackage: proto.String(
+				"github.com/codesjoy/yggdrasil/v3/cmd/protoc-gen-yggdrasil-rest;main",
+			),
+		},
+		Service: []*descriptorpb.ServiceDescriptorProto{
+			{
+				Name: proto.String("ResourcesService"),
+				Method: []*descriptorpb.MethodDescriptorProto{
+					{
+						Name:       proto.String("GetResource"),
+						InputType:  proto.String(".test.GetResourceRequest"),
+						OutputType: proto.String(".test.Resource"),
+						Options:    &descriptorpb.MethodOptions{},
+					},
+				},
+			},
+		},
+		MessageType: []*descriptorpb.DescriptorProto{
+			{
+				Name: proto.String("GetResourceRequest"),
+				Field: []*descriptorpb.FieldDescriptorProto{
+					{
+						Name:   proto.String("name"),
+						Number: proto.Int32(1),
+						Type:   descriptorpb.FieldDescriptorProto_TYPE_STRING.Enum(),
+					},
+				},
+			},
+			{Name: proto.String("Resource")},
+		},
+	})
+	proto.SetExtension(
+		gen.Files[0].Services[0].Methods[0].Desc.Options(),
+		annotations.E_Http,
+		&annotations.HttpRule{
+			Pattern: &annotations.HttpRule_Get{Get: "/v1/{name=resources/*}"},
+			AdditionalBindings: []*annotations.HttpRule{
+				{
+					Pattern: &annotations.HttpRule_Post{Post: "/v1/{name=resources/*}:get"},
+					Body:    "*",
+				},
+			},
+		},
+	)
+
+	err := generateFiles(gen, gen.Files[0])
+	require.NoError(t, err)
+
+	output := generatedFileContent(t, gen, "test_rest.pb.go")
+	assert.Contains(t, output,
+		`"github.com/codesjoy/yggdrasil/v3/transport/gateway/rest/restclient"`)
+	assert.Contains(t, output, "type ResourcesServiceRestClient interface")
+	assert.Contains(t, output,
+		"GetResource(context.Context, *GetResourceRequest, ...client.CallOption) "+
+			"(*Resource, error)")
+	assert.Contains(t, output,
+		"func NewResourcesServiceRestClient(cc *restclient.Client) ResourcesServiceRestClient")
+	assert.Contains(t, output,
+		`c.cc.Invoke(ctx, "GET", "/v1/{name=resources/*}", "", in, out, opts...)`)
+	assert.Equal(t, 1, strings.Count(output, "c.cc.Invoke("))
+}
+
+func TestGenerateFiles_NoClientByDefault(t *testing.T) {
+	methodSets = make(map[string]int)
+
+	gen := newTestPlugin(t, &descriptorpb.FileDescriptorProto{
+		Name:    proto.String("test.proto"),
+		Package: proto.String("test"),
+		Options: &descriptorpb.FileOptions{
+			GoPackage: proto.String(
+				"github.com/codesjoy/yggdrasil/v3/cmd/protoc-gen-yggdrasil-rest;main",
+			),
+		},
+		Service: []*descriptorpb.ServiceDescriptorProto{
+			{
+				Name: proto.String("ActionsService"),
+				Method: []*descriptorpb.MethodDescriptorProto{
+					{
+						Name:       proto.String("RunAction"),
+						InputType:  proto.String(".test.RunActionRequest"),
+						OutputType: proto.String(".test.RunActionResponse"),
+						Options:    &descriptorpb.MethodOptions{},
+					},
+				},
+			},
+		},
+		MessageType: []*descriptorpb.DescriptorProto{
+			{Name: proto.String("RunActionRequest")},
+			{Name: proto.String("RunActionResponse")},
+		},
+	})
+	proto.SetExtension(
+		gen.Files[0].Services[0].Methods[0].Desc.Options(),
+		annotations.E_Http,
+		&annotations.HttpRule{
+			Pattern: &annotations.HttpRule_Post{Post: "/v1/actions:run"},
+			Body:    "*",
+		},
+	)
+
+	require.NoError(t, generateFiles(gen, gen.Files[0]))
+
+	output := generatedFileContent(t, gen, "test_rest.pb.go")
+	assert.NotContains(t, output, "RestClient")
+	assert.NotContains(t, output, "restclient")
+}
+
+func TestGenerateFiles_RouteListsProtoMethodName(t *testing.T) {
+	methodSets = make(map[string]int)
+
+	gen := newTestPlugin(t, &descriptorpb.FileDescriptorProto{
+		Name:    proto.String("test.proto"),
+		Package: proto.String("test"),
+		Options: &descriptorpb.FileOptions{
+			GoPackage: proto.String(
+				"github.com/codesjoy/yggdrasil/v3/cmd/protoc-gen-yggdrasil-rest;main",
+			),
+		},
+		Service: []*descriptorpb.ServiceDescriptorProto{
+			{
+				Name: proto.String("ActionsService"),
+				Method: []*descriptorpb.MethodDescriptorProto{
+					{
+						Name:       proto.String("run_action"),
+						InputType:  proto.String(".test.RunActionRequest"),
+						OutputType: proto.String(".test.RunActionResponse"),
+						Options:    &descriptorpb.MethodOptions{},
+					},
+				},
+			},
+		},
+		MessageType: []*descriptorpb.DescriptorProto{
+			{Name: proto.String("RunActionRequest")},
+			{Name: proto.String("RunActionResponse")},
+		},
+	})
+	proto.SetExtension(
+		gen.Files[0].Services[0].Methods[0].Desc.Options(),
+		annotations.E_Http,
+		&annotations.HttpRule{
+			Pattern: &annotations.HttpRule_Post{Post: "/v1/actions:run"},
+			Body:    "*",
+		},
+	)
+
+	require.NoError(t, generateFiles(gen, gen.Files[0]))
+
+	output := generatedFileContent(t, gen, "test_rest.pb.go")
+	assert.Contains(t, output, `RPC:      "/test.ActionsService/run_action"`)
+	assert.Contains(t, output, "local_handler_ActionsService_RunAction_0")
+}
+
+func TestGenerateFiles_NoClientOmitsResponseImport(t *testing.T) {
+	methodSets = make(map[string]int)
+
+	file := &descriptorpb.FileDescriptorProto{
+		Name:       proto.String("test.proto"),
+		Package:    proto.String("test"),
+		Dependency: []string{"google/protobuf/empty.proto"},
+		Options: &descriptorpb.FileOptions{
+			GoPackage: proto.String(
+				"github.com/codesjoy/yggdrasil/v3/cmd/protoc-gen-yggdrasil-rest;main",
+			),
+		},
+		Service: []*descriptorpb.ServiceDescriptorProto{
+			{
+				Name: proto.String("BooksService"),
+				Method: []*descriptorpb.MethodDescriptorProto{
+					{
+						Name:       proto.String("DeleteBook"),
+						InputType:  proto.String(".test.DeleteBookRequest"),
+						OutputType: proto.String(".google.protobuf.Empty"),
+						Options:    &descriptorpb.MethodOptions{},
+					},
+				},
+			},
+		},
+		MessageType: []*descriptorpb.DescriptorProto{
+			{Name: proto.String("DeleteBookRequest")},
+		},
+	}
+	gen, err := protogen.Options{}.New(&pluginpb.CodeGeneratorRequest{
+		FileToGenerate: []string{file.GetName()},
+		ProtoFile: []*descriptorpb.FileDescriptorProto{
+			protodesc.ToFileDescriptorProto(emptypb.File_google_protobuf_empty_proto),
+			file,
+		},
+	})
+	require.NoError(t, err)
+	target := gen.FilesByPath["test.proto"]
+	proto.SetExtension(
+		target.Services[0].Methods[0].Desc.Options(),
+		annotations.E_Http,
+		&annotations.HttpRule{
+			Pattern: &annotations.HttpRule_Delete{Delete: "/v1/books"},
+		},
+	)
+
+	require.NoError(t, generateFiles(gen, target))
+
+	output := generatedFileContent(t, gen, "test_rest.pb.go")
+	assert.NotContains(t, output, "emptypb")
+}
+
 // literalSegment creates a pathBindingSegment representing a static path component.
 func literalSegment(value string) pathBindingSegment {
 	return pathBindingSegment{Literal: value}
@@ -77,6 +77,7 @@ func local_handler_{{$.ServiceType}}_{{ .Name }}_{{.Num}}(w {{$.HTTPPkg}}Respons
 {{end -}}
 
 var {{$.ServiceType}}RestServiceDesc = {{$.SvrPkg}}RestServiceDesc{
+	ServiceName: "{{$.ServiceName}}",
 	HandlerType: (*{{$.ServiceType}}Server)(nil),
 	Methods: []{{$.SvrPkg}}RestMethodDesc{
 		{{range $method := .Methods -}}
@@ -84,10 +85,42 @@ var {{$.ServiceType}}RestServiceDesc = {{$.SvrPkg}}RestServiceDesc{
 			Method: "{{$method.Method}}",
 			Path: "{{$method.Path}}",
 			Handler:    local_handler_{{$.ServiceType}}_{{ .Name }}_{{.Num}},
+			RPC: "/{{$.ServiceName}}/{{ .RPCName }}",
+			Template: {{$method.Template | printf "%q"}},
 		},
 		{{end -}}
 	},
 }
+{{- if .Client}}
+
+// {{$.ServiceType}}RestClient is the client API of {{$.ServiceType}} over the
+// routes of its REST gateway.
+type {{$.ServiceType}}RestClient interface {
+	{{- range $method := .ClientMethods}}
+	{{$method.Name}}({{$.CtxPkg}}Context, *{{$method.Request}}, ...{{$.ClientPkg}}CallOption) (*{{$method.Response}}, error)
+	{{- end}}
+}
+
+type {{$.LowerServiceType}}RestClient struct {
+	cc *{{$.RestClientPkg}}Client
+}
+
+// New{{$.ServiceType}}RestClient returns a {{$.ServiceType}}RestClient sending
+// requests through cc.
+func New{{$.ServiceType}}RestClient(cc *{{$.RestClientPkg}}Client) {{$.ServiceType}}RestClient {
+	return &{{$.LowerServiceType}}RestClient{cc}
+}
+{{range $method := .ClientMethods}}
+func (c *{{$.LowerServiceType}}RestClient) {{$method.Name}}(ctx {{$.CtxPkg}}Context, in *{{$method.Request}}, opts ...{{$.ClientPkg}}CallOption) (*{{$method.Response}}, error) {
+	out := new({{$method.Response}})
+	err := c.cc.Invoke(ctx, {{$method.Method | printf "%q"}}, {{$method.Template | printf "%q"}}, {{$method.BodyField | printf "%q"}}, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+{{end -}}
+{{- end}}
 `
 
 type serviceDesc struct {
@@ -101,10 +134,34 @@ type serviceDesc struct {
 	InterceptorPkg string
 	CtxPkg         string
 	IoPkg          string
+	ClientPkg      string
+	RestClientPkg  string
 
 	ServiceType string
 	ServiceName string
 	Methods     []*methodDesc
+	Client      bool // also generate the REST client of the service
+}
+
+// LowerServiceType returns ServiceType with a lowercase first letter, naming
+// the unexported client implementation.
+func (s *serviceDesc) LowerServiceType() string {
+	if s.ServiceType == "" {
+		return ""
+	}
+	return strings.ToLower(s.ServiceType[:1]) + s.ServiceType[1:]
+}
+
+// ClientMethods returns the methods of the REST client: one per RPC, bound
+// to its primary HTTP rule.
+func (s *serviceDesc) ClientMethods() []*methodDesc {
+	var methods []*methodDesc
+	for _, m := range s.Methods {
+		if m.Primary {
+			methods = append(methods, m)
+		}
+	}
+	return methods
 }
 
 // methodDesc holds all information needed to generate a single REST handler
@@ -114,14 +171,24 @@ type methodDesc struct {
 	Num     int    // overload counter for methods with multiple HTTP bindings
 	Method  string // HTTP verb (GET, POST, PUT, PATCH, DELETE, CUSTOM)
 	Request string // qualified Go type name of the request message
+	// RPCName is the method name as declared in the proto, which the RPC
+	// server dispatches on; Name is its Go form.
+	RPCName string
+	// Response is the qualified Go type name of the response message.
+	Response string
+	// Primary marks the main HTTP rule of the RPC, as opposed to its
+	// additional_bindings. The REST client calls the primary route.
+	Primary bool
 
 	// PathBindings contains the parsed path variable bindings. Each binding
 	// maps a protobuf field path to a sequence of literal and param segments.
 	PathBindings []pathVarBinding
 	Path         string // rewritten route path with {paramsN} placeholders
+	Template     string // path template as declared in the HTTP rule
 
 	Body           string // dot-prefixed CamelCase field accessor (e.g. ".Resource") or empty
 	BodyType       string // qualified Go type name of the body field message, for nil-initialization
+	BodyField      string // body of the HTTP rule: "*", a field name, or empty
 	HasBody        bool   // true when the HTTP rule declares a body
 	HasQueryParams bool   // true when query parameters should be populated (body="" or body="field")
 }
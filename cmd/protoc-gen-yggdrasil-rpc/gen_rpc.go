@@ -17,14 +17,18 @@ package main
 import (
 	"strings"
 
+	"cloud.google.com/go/longrunning/autogen/longrunningpb"
 	"golang.org/x/text/cases"
 	"golang.org/x/text/language"
 	"google.golang.org/protobuf/compiler/protogen"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
 	"google.golang.org/protobuf/types/descriptorpb"
 )
 
 const (
 	contextPackage = protogen.GoImportPath("context")
+	iterPackage    = protogen.GoImportPath("iter")
 	xerrorPackage  = protogen.GoImportPath("github.com/codesjoy/pkg/basic/xerror")
 	streamPackage  = protogen.GoImportPath("github.com/codesjoy/yggdrasil/v3/rpc/stream")
 	clientPackage  = protogen.GoImportPath(
@@ -34,15 +38,22 @@ const (
 	serverPackage      = protogen.GoImportPath(
 		"github.com/codesjoy/yggdrasil/v3/transport/runtime/server",
 	)
-	metadataPackage = protogen.GoImportPath("github.com/codesjoy/yggdrasil/v3/rpc/metadata")
-	codePackage     = protogen.GoImportPath("google.golang.org/genproto/googleapis/rpc/code")
+	metadataPackage   = protogen.GoImportPath("github.com/codesjoy/yggdrasil/v3/rpc/metadata")
+	codePackage       = protogen.GoImportPath("google.golang.org/genproto/googleapis/rpc/code")
+	operationsPackage = protogen.GoImportPath("github.com/codesjoy/yggdrasil/v3/operations")
 )
 
+// operationFullName is the message returned by long-running methods.
+const operationFullName protoreflect.FullName = "google.longrunning.Operation"
+
 func generateFiles(gen *protogen.Plugin, file *protogen.File) {
 	if len(file.Services) == 0 {
 		return
 	}
 	generateRPCFile(gen, file)
+	if *skeleton {
+		generateSkeletonFiles(gen, file, *skeletonOut)
+	}
 }
 
 func generateRPCFile(gen *protogen.Plugin, file *protogen.File) {
@@ -59,7 +70,7 @@ func generateHeader(g *protogen.GeneratedFile, file *protogen.File) {
 	g.P()
 }
 
-func generateFileContent(_ *protogen.Plugin, file *protogen.File, g *protogen.GeneratedFile) {
+func generateFileContent(gen *protogen.Plugin, file *protogen.File, g *protogen.GeneratedFile) {
 	g.P("// This is a compile-time assertion to ensure that this generated file")
 	g.P("// is compatible with the yggdrasil package it is being compiled against.")
 	g.P("var _ = new(", metadataPackage.Ident("MD"), ")")
@@ -67,12 +78,17 @@ func generateFileContent(_ *protogen.Plugin, file *protogen.File, g *protogen.Ge
 
 	for _, service := range file.Services {
 		if len(service.Methods) > 0 {
-			genService(g, service, file)
+			genService(gen, g, service, file)
 		}
 	}
 }
 
-func genService(g *protogen.GeneratedFile, service *protogen.Service, file *protogen.File) {
+func genService(
+	gen *protogen.Plugin,
+	g *protogen.GeneratedFile,
+	service *protogen.Service,
+	file *protogen.File,
+) {
 	if service.Desc.Options().(*descriptorpb.ServiceOptions).GetDeprecated() {
 		g.P("//")
 		g.P(deprecationComment)
@@ -93,6 +109,43 @@ func genService(g *protogen.GeneratedFile, service *protogen.Service, file *prot
 		NeedStream:            false,
 		HasUnaryMethods:       false,
 	}
+	for _, tmp := range newMethodDescs(gen, g, service) {
+		if tmp.ClientStream || tmp.ServerStream {
+			sd.NeedStream = true
+		}
+		if tmp.ServerStream {
+			sd.NeedServerStream = true
+		}
+		if tmp.IsUnary {
+			sd.HasUnaryMethods = true
+		}
+		if tmp.WaitOutput != "" {
+			sd.Operations = g.QualifiedGoIdent(operationsPackage.Ident(""))
+		}
+		sd.Methods = append(sd.Methods, tmp)
+	}
+	if sd.NeedStream {
+		sd.Stream = g.QualifiedGoIdent(streamPackage.Ident(""))
+	}
+	if sd.NeedServerStream {
+		sd.Iter = g.QualifiedGoIdent(iterPackage.Ident(""))
+	}
+	if sd.HasUnaryMethods {
+		sd.Interceptor = g.QualifiedGoIdent(interceptorPackage.Ident(""))
+	}
+	if len(sd.Methods) != 0 {
+		g.P(sd.execute(tpl))
+	}
+}
+
+// newMethodDescs describes the methods of service in declaration order,
+// numbering the streaming ones as the service desc lists them.
+func newMethodDescs(
+	gen *protogen.Plugin,
+	g *protogen.GeneratedFile,
+	service *protogen.Service,
+) []*methodDesc {
+	var out []*methodDesc
 	streamIndex := 0
 	for _, method := range service.Methods {
 		tmp := &methodDesc{
@@ -102,29 +155,76 @@ func genService(g *protogen.GeneratedFile, service *protogen.Service, file *prot
 			ClientStream: method.Desc.IsStreamingClient(),
 			ServerStream: method.Desc.IsStreamingServer(),
 		}
+		tmp.Idempotent = method.Desc.Options().(*descriptorpb.MethodOptions).
+			GetIdempotencyLevel() != descriptorpb.MethodOptions_IDEMPOTENCY_UNKNOWN
 		tmp.IsUnary = !tmp.ClientStream && !tmp.ServerStream
 		tmp.IsBidi = tmp.ClientStream && tmp.ServerStream
 		tmp.IsClientStreamOnly = tmp.ClientStream && !tmp.ServerStream
 		tmp.IsServerStreamOnly = !tmp.ClientStream && tmp.ServerStream
+		if tmp.IsUnary {
+			if response := operationResponse(gen, method); response != nil {
+				tmp.WaitOutput = g.QualifiedGoIdent(response.GoIdent)
+			}
+		}
 		if tmp.ClientStream || tmp.ServerStream {
-			sd.NeedStream = true
 			tmp.StreamIndex = streamIndex
 			streamIndex++
 		}
-		if tmp.IsUnary {
-			sd.HasUnaryMethods = true
-		}
-		sd.Methods = append(sd.Methods, tmp)
+		out = append(out, tmp)
 	}
-	if sd.NeedStream {
-		sd.Stream = g.QualifiedGoIdent(streamPackage.Ident(""))
+	return out
+}
+
+// operationResponse returns the message a long-running method resolves to,
+// as named by its google.longrunning.operation_info option. It returns nil
+// for other methods and when the response type is not part of the request.
+func operationResponse(gen *protogen.Plugin, method *protogen.Method) *protogen.Message {
+	if method.Output.Desc.FullName() != operationFullName {
+		return nil
 	}
-	if sd.HasUnaryMethods {
-		sd.Interceptor = g.QualifiedGoIdent(interceptorPackage.Ident(""))
+	info, ok := proto.GetExtension(
+		method.Desc.Options(),
+		longrunningpb.E_OperationInfo,
+	).(*longrunningpb.OperationInfo)
+	if !ok || info.GetResponseType() == "" {
+		return nil
 	}
-	if len(sd.Methods) != 0 {
-		g.P(sd.execute(tpl))
+	name := protoreflect.FullName(strings.TrimPrefix(info.GetResponseType(), "."))
+	// Response types of the method's own package may be left unqualified.
+	candidates := []protoreflect.FullName{
+		method.Desc.ParentFile().Package().Append(name.Name()),
+		name,
+	}
+	if strings.Contains(string(name), ".") {
+		candidates = candidates[1:]
+	}
+	for _, candidate := range candidates {
+		if msg := findMessage(gen, candidate); msg != nil {
+			return msg
+		}
+	}
+	return nil
+}
+
+func findMessage(gen *protogen.Plugin, name protoreflect.FullName) *protogen.Message {
+	for _, file := range gen.Files {
+		if msg := findNestedMessage(file.Messages, name); msg != nil {
+			return msg
+		}
+	}
+	return nil
+}
+
+func findNestedMessage(messages []*protogen.Message, name protoreflect.FullName) *protogen.Message {
+	for _, msg := range messages {
+		if msg.Desc.FullName() == name {
+			return msg
+		}
+		if found := findNestedMessage(msg.Messages, name); found != nil {
+			return found
+		}
 	}
+	return nil
 }
 
 // toLowerFirstCamelCase returns the given string in camelcase formatted string
@@ -15,24 +15,31 @@
 package main
 
 import (
+	"flag"
+	"os"
+	"path/filepath"
 	"sort"
 	"strings"
 	"testing"
 
+	"cloud.google.com/go/longrunning/autogen/longrunningpb"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"google.golang.org/protobuf/compiler/protogen"
 	"google.golang.org/protobuf/proto"
 	"google.golang.org/protobuf/types/descriptorpb"
 	"google.golang.org/protobuf/types/pluginpb"
 )
 
+var updateGolden = flag.Bool("update", false, "update the golden files in testdata")
+
 func TestServiceDesc_Execute(t *testing.T) {
 	sd := &serviceDesc{
 		ServiceType:           "Greeter",
 		ServiceName:           "helloworld.Greeter",
 		LowerFirstServiceType: "greeter",
 		Context:               "context.Context",
-		Client:                "grpc.ClientConnInterface",
+		Client:                "client.",
 		Md:                    "metadata",
 		Server:                "grpc.Server",
 		Interceptor:           "grpc",
@@ -70,7 +77,17 @@ func TestServiceDesc_Execute(t *testing.T) {
 
 	assert.Contains(t, output, "type GreeterClient interface")
 	assert.Contains(t, output, "SayHello(context.Context, *HelloRequest) (*HelloResponse, error)")
-	assert.Contains(t, output, "StreamHello(context.Context) (GreeterStreamHelloClient, error)")
+	assert.Contains(
+		t,
+		output,
+		"SayHello(context.Context, *HelloRequest, ...client.CallOption) (*HelloResponse, error)",
+	)
+	assert.Contains(
+		t,
+		output,
+		"StreamHello(context.Context, ...client.CallOption) (GreeterStreamHelloClient, error)",
+	)
+	assert.Contains(t, output, `c.cc.Invoke(ctx, "/helloworld.Greeter/SayHello", in, out, opts...)`)
 	assert.Contains(t, output, "type GreeterServer interface")
 	assert.Contains(t, output, "var GreeterServiceDesc = grpc.ServerServiceDesc")
 }
@@ -106,6 +123,19 @@ func TestGenerateFiles_UnaryOnly_HasInterceptorImport(t *testing.T) {
 	assert.Contains(t, content, "SayHello(context.Context, *HelloRequest) (*HelloResponse, error)")
 }
 
+func TestGenerateFiles_IdempotentMethodMarksContext(t *testing.T) {
+	get := newMethod("GetHello", "HelloRequest", "HelloResponse", false, false)
+	get.Options = &descriptorpb.MethodOptions{
+		IdempotencyLevel: descriptorpb.MethodOptions_NO_SIDE_EFFECTS.Enum(),
+	}
+	content := generateRPCContent(t, newService("Greeter",
+		get,
+		newMethod("SayHello", "HelloRequest", "HelloResponse", false, false),
+	))
+
+	assert.Equal(t, 1, strings.Count(content, "ctx = interceptor.WithIdempotent(ctx)"))
+}
+
 func TestGenerateFiles_StreamingOnly_NoInterceptorImport(t *testing.T) {
 	content := generateRPCContent(t, newService("Greeter",
 		newMethod("Bidi", "BidiRequest", "BidiResponse", true, true),
@@ -126,7 +156,7 @@ func TestGenerateFiles_ClientStreamOnly_HasCloseAndRecv(t *testing.T) {
 		newMethod("Upload", "UploadRequest", "UploadResponse", true, false),
 	))
 
-	assert.Contains(t, content, "Upload(context.Context) (GreeterUploadClient, error)")
+	assert.Contains(t, content, "Upload(context.Context, ...client.CallOption) (GreeterUploadClient, error)")
 	assert.Contains(t, content, "type GreeterUploadClient interface {")
 	assert.Contains(t, content, "Send(*UploadRequest) error")
 	assert.Contains(t, content, "CloseAndRecv() (*UploadResponse, error)")
@@ -143,13 +173,47 @@ func TestGenerateFiles_ServerStreamOnly_NoCloseAndRecv(t *testing.T) {
 		newMethod("Watch", "WatchRequest", "WatchResponse", false, true),
 	))
 
-	assert.Contains(t, content, "Watch(context.Context, *WatchRequest) (GreeterWatchClient, error)")
+	assert.Contains(
+		t,
+		content,
+		"Watch(context.Context, *WatchRequest, ...client.CallOption) (GreeterWatchClient, error)",
+	)
 	assert.Contains(t, content, "type GreeterWatchClient interface {")
 	assert.Contains(t, content, "Recv() (*WatchResponse, error)")
 	assert.NotContains(t, content, "CloseAndRecv() (*WatchResponse, error)")
 	assert.NotContains(t, content, "func (x *greeterWatchClient) Send(m *WatchRequest) error")
 }
 
+func TestGenerateFiles_StreamingHelpers(t *testing.T) {
+	content := generateRPCContent(t, newService("Greeter",
+		newMethod("Bidi", "BidiRequest", "BidiResponse", true, true),
+		newMethod("Watch", "WatchRequest", "WatchResponse", false, true),
+	))
+
+	assert.Contains(t, content, "iter \"iter\"")
+	assert.Contains(t, content, "Responses() iter.Seq2[*WatchResponse, error]")
+	assert.Contains(t, content, "CollectAll(context.Context) ([]*WatchResponse, error)")
+	assert.Contains(t, content, "SendAll(context.Context, []*BidiRequest) error")
+	assert.Contains(
+		t,
+		content,
+		"func (x *greeterBidiClient) Responses() iter.Seq2[*BidiResponse, error] {\n\treturn stream.Responses(x.Recv)",
+	)
+	assert.Contains(t, content, "return stream.CollectAll(ctx, x.Recv)")
+	assert.Contains(t, content, "return stream.SendAll(ctx, x.Send, msgs)")
+	assert.NotContains(t, content, "SendAll(context.Context, []*WatchRequest) error")
+}
+
+func TestGenerateFiles_ClientStreamOnly_NoIterImport(t *testing.T) {
+	content := generateRPCContent(t, newService("Greeter",
+		newMethod("Upload", "UploadRequest", "UploadResponse", true, false),
+	))
+
+	assert.NotContains(t, content, "iter \"iter\"")
+	assert.NotContains(t, content, "Responses()")
+	assert.Contains(t, content, "SendAll(context.Context, []*UploadRequest) error")
+}
+
 func TestGenerateFiles_StreamIndexMatchesDescriptorOrder(t *testing.T) {
 	content := generateRPCContent(t, newService("Greeter",
 		newMethod("ServerFirst", "ServerFirstRequest", "ServerFirstResponse", false, true),
@@ -162,22 +226,22 @@ func TestGenerateFiles_StreamIndexMatchesDescriptorOrder(t *testing.T) {
 	assert.Contains(
 		t,
 		content,
-		"NewStream(ctx, &GreeterServiceDesc.Streams[0], \"/test.Greeter/ServerFirst\")",
+		"NewStream(ctx, &GreeterServiceDesc.Streams[0], \"/test.Greeter/ServerFirst\", opts...)",
 	)
 	assert.Contains(
 		t,
 		content,
-		"NewStream(ctx, &GreeterServiceDesc.Streams[1], \"/test.Greeter/BidiThird\")",
+		"NewStream(ctx, &GreeterServiceDesc.Streams[1], \"/test.Greeter/BidiThird\", opts...)",
 	)
 	assert.Contains(
 		t,
 		content,
-		"NewStream(ctx, &GreeterServiceDesc.Streams[2], \"/test.Greeter/ClientFourth\")",
+		"NewStream(ctx, &GreeterServiceDesc.Streams[2], \"/test.Greeter/ClientFourth\", opts...)",
 	)
 	assert.Contains(
 		t,
 		content,
-		"NewStream(ctx, &GreeterServiceDesc.Streams[3], \"/test.Greeter/ServerFifth\")",
+		"NewStream(ctx, &GreeterServiceDesc.Streams[3], \"/test.Greeter/ServerFifth\", opts...)",
 	)
 }
 
@@ -363,3 +427,78 @@ func TestGenerateFiles_ServiceWithZeroMethods(t *testing.T) {
 	assert.NotContains(t, content, "EmptyServiceClient")
 	assert.NotContains(t, content, "EmptyServiceServer")
 }
+
+func TestGenerateFiles_OperationMethodsMatchGolden(t *testing.T) {
+	create := newMethod("CreateBook", "CreateBookRequest", "", false, false)
+	create.OutputType = proto.String(".google.longrunning.Operation")
+	create.Options = operationInfoOptions("Book")
+	archive := newMethod("ArchiveShelf", "ArchiveShelfRequest", "", false, false)
+	archive.OutputType = proto.String(".google.longrunning.Operation")
+	archive.Options = operationInfoOptions("test.Shelf")
+	untyped := newMethod("Compact", "CompactRequest", "", false, false)
+	untyped.OutputType = proto.String(".google.longrunning.Operation")
+	svc := newService("Library", create, archive, untyped)
+
+	gen, err := protogen.Options{}.New(&pluginpb.CodeGeneratorRequest{
+		FileToGenerate: []string{"test.proto"},
+		ProtoFile: []*descriptorpb.FileDescriptorProto{
+			{
+				Name:    proto.String("google/longrunning/operations.proto"),
+				Package: proto.String("google.longrunning"),
+				MessageType: []*descriptorpb.DescriptorProto{
+					{Name: proto.String("Operation")},
+				},
+				Options: &descriptorpb.FileOptions{
+					GoPackage: proto.String(
+						"cloud.google.com/go/longrunning/autogen/longrunningpb;longrunningpb",
+					),
+				},
+			},
+			{
+				Name:       proto.String("test.proto"),
+				Package:    proto.String("test"),
+				Dependency: []string{"google/longrunning/operations.proto"},
+				MessageType: []*descriptorpb.DescriptorProto{
+					{Name: proto.String("ArchiveShelfRequest")},
+					{Name: proto.String("Book")},
+					{Name: proto.String("CompactRequest")},
+					{Name: proto.String("CreateBookRequest")},
+					{Name: proto.String("Shelf")},
+				},
+				Options: &descriptorpb.FileOptions{
+					GoPackage: proto.String(
+						"github.com/codesjoy/yggdrasil/v3/cmd/protoc-gen-yggdrasil-rpc;main",
+					),
+				},
+				Service: []*descriptorpb.ServiceDescriptorProto{svc},
+			},
+		},
+	})
+	require.NoError(t, err)
+	generateFiles(gen, gen.FilesByPath["test.proto"])
+
+	var content string
+	for _, f := range gen.Response().File {
+		if strings.HasSuffix(f.GetName(), "test_rpc.pb.go") {
+			content = f.GetContent()
+		}
+	}
+	require.NotEmpty(t, content)
+
+	golden := filepath.Join("testdata", "operations_rpc.pb.go.golden")
+	if *updateGolden {
+		require.NoError(t, os.WriteFile(golden, []byte(content), 0o644))
+	}
+	want, err := os.ReadFile(golden)
+	require.NoError(t, err)
+	assert.Equal(t, string(want), content)
+}
+
+func operationInfoOptions(responseType string) *descriptorpb.MethodOptions {
+	opts := &descriptorpb.MethodOptions{}
+	proto.SetExtension(opts, longrunningpb.E_OperationInfo, &longrunningpb.OperationInfo{
+		ResponseType: responseType,
+		MetadataType: "google.protobuf.Empty",
+	})
+	return opts
+}
@@ -23,6 +23,19 @@ import (
 	"google.golang.org/protobuf/types/pluginpb"
 )
 
+var (
+	skeleton = flag.Bool(
+		"skeleton",
+		false,
+		"also generate a handler skeleton per service when its file is absent",
+	)
+	skeletonOut = flag.String(
+		"skeleton_out",
+		".",
+		"output directory of the plugin, searched for existing skeleton files",
+	)
+)
+
 func main() {
 	protogen.Options{
 		ParamFunc: flag.CommandLine.Set,
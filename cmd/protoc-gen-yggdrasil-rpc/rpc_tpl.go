@@ -32,11 +32,14 @@ var clientTpl = `
 type {{$svrType}}Client interface {
 {{range .Methods -}}
 	{{if or .IsBidi .IsClientStreamOnly -}}
-	{{.Name}}({{$.Context}}) ({{$svrType}}{{.Name}}Client, error)
+	{{.Name}}({{$.Context}}, ...{{$client}}CallOption) ({{$svrType}}{{.Name}}Client, error)
 	{{else if .IsServerStreamOnly -}}
-	{{.Name}}({{$.Context}}, *{{.Input}}) ({{$svrType}}{{.Name}}Client, error)
+	{{.Name}}({{$.Context}}, *{{.Input}}, ...{{$client}}CallOption) ({{$svrType}}{{.Name}}Client, error)
 	{{else -}}
-	{{.Name}}({{$.Context}}, *{{.Input}}) (*{{.Output}}, error)
+	{{.Name}}({{$.Context}}, *{{.Input}}, ...{{$client}}CallOption) (*{{.Output}}, error)
+	{{if .WaitOutput -}}
+	{{.Name}}AndWait({{$.Context}}, *{{.Input}}, ...{{$client}}CallOption) (*{{.WaitOutput}}, error)
+	{{end -}}
 	{{end -}}
 {{end -}}
 }
@@ -46,12 +49,18 @@ type {{$svrType}}Client interface {
 type {{$svrType}}{{.Name}}Client interface{
 	{{if .IsBidi -}}
 	Send(*{{.Input}}) error
+	SendAll({{$.Context}}, []*{{.Input}}) error
 	Recv() (*{{.Output}}, error)
+	Responses() {{$.Iter}}Seq2[*{{.Output}}, error]
+	CollectAll({{$.Context}}) ([]*{{.Output}}, error)
 	{{else if .IsClientStreamOnly -}}
 	Send(*{{.Input}}) error
+	SendAll({{$.Context}}, []*{{.Input}}) error
 	CloseAndRecv() (*{{.Output}}, error)
 	{{else if .IsServerStreamOnly -}}
 	Recv() (*{{.Output}}, error)
+	Responses() {{$.Iter}}Seq2[*{{.Output}}, error]
+	CollectAll({{$.Context}}) ([]*{{.Output}}, error)
 	{{end -}}
 	{{$.Stream}}ClientStream
 }
@@ -68,8 +77,8 @@ func New{{$svrType}}Client(cc {{$client}}Client) {{$svrType}}Client {
 
 {{range .Methods -}}
 {{if .IsBidi -}}
-func (c *{{$lrSvrName}}Client) {{.Name}}(ctx {{$ctx}}) ({{$svrType}}{{.Name}}Client, error) {
-	stream, err := c.cc.NewStream(ctx, &{{$svrType}}ServiceDesc.Streams[{{.StreamIndex}}], "/{{$.FullServerName}}/{{.Name}}")
+func (c *{{$lrSvrName}}Client) {{.Name}}(ctx {{$ctx}}, opts ...{{$client}}CallOption) ({{$svrType}}{{.Name}}Client, error) {
+	stream, err := c.cc.NewStream(ctx, &{{$svrType}}ServiceDesc.Streams[{{.StreamIndex}}], "/{{$.FullServerName}}/{{.Name}}", opts...)
 	if err != nil {
 		return nil, err
 	}
@@ -97,6 +106,10 @@ func (x *{{$lrSvrName}}{{.Name}}Client) Send(m *{{.Input}}) error {
 	return x.ClientStream.SendMsg(m)
 }
 
+func (x *{{$lrSvrName}}{{.Name}}Client) SendAll(ctx {{$ctx}}, msgs []*{{.Input}}) error {
+	return {{$.Stream}}SendAll(ctx, x.Send, msgs)
+}
+
 func (x *{{$lrSvrName}}{{.Name}}Client) Recv() (*{{.Output}}, error) {
 	m := new({{.Output}})
 	if err := x.ClientStream.RecvMsg(m); err != nil {
@@ -104,9 +117,17 @@ func (x *{{$lrSvrName}}{{.Name}}Client) Recv() (*{{.Output}}, error) {
 	}
 	return m, nil
 }
+
+func (x *{{$lrSvrName}}{{.Name}}Client) Responses() {{$.Iter}}Seq2[*{{.Output}}, error] {
+	return {{$.Stream}}Responses(x.Recv)
+}
+
+func (x *{{$lrSvrName}}{{.Name}}Client) CollectAll(ctx {{$ctx}}) ([]*{{.Output}}, error) {
+	return {{$.Stream}}CollectAll(ctx, x.Recv)
+}
 {{else if .IsClientStreamOnly -}}
-func (c *{{$lrSvrName}}Client) {{.Name}}(ctx {{$ctx}}) ({{$svrType}}{{.Name}}Client, error) {
-	stream, err := c.cc.NewStream(ctx, &{{$svrType}}ServiceDesc.Streams[{{.StreamIndex}}], "/{{$.FullServerName}}/{{.Name}}")
+func (c *{{$lrSvrName}}Client) {{.Name}}(ctx {{$ctx}}, opts ...{{$client}}CallOption) ({{$svrType}}{{.Name}}Client, error) {
+	stream, err := c.cc.NewStream(ctx, &{{$svrType}}ServiceDesc.Streams[{{.StreamIndex}}], "/{{$.FullServerName}}/{{.Name}}", opts...)
 	if err != nil {
 		return nil, err
 	}
@@ -145,9 +166,13 @@ func (x *{{$lrSvrName}}{{.Name}}Client) Send(m *{{.Input}}) error {
 	return x.ClientStream.SendMsg(m)
 }
 
+func (x *{{$lrSvrName}}{{.Name}}Client) SendAll(ctx {{$ctx}}, msgs []*{{.Input}}) error {
+	return {{$.Stream}}SendAll(ctx, x.Send, msgs)
+}
+
 {{else if .IsServerStreamOnly -}}
-func (c *{{$lrSvrName}}Client) {{.Name}}(ctx {{$ctx}}, in *{{.Input}}) ({{$svrType}}{{.Name}}Client, error) {
-	stream, err := c.cc.NewStream(ctx, &{{$svrType}}ServiceDesc.Streams[{{.StreamIndex}}], "/{{$.FullServerName}}/{{.Name}}")
+func (c *{{$lrSvrName}}Client) {{.Name}}(ctx {{$ctx}}, in *{{.Input}}, opts ...{{$client}}CallOption) ({{$svrType}}{{.Name}}Client, error) {
+	stream, err := c.cc.NewStream(ctx, &{{$svrType}}ServiceDesc.Streams[{{.StreamIndex}}], "/{{$.FullServerName}}/{{.Name}}", opts...)
 	if err != nil {
 		return nil, err
 	}
@@ -185,16 +210,43 @@ func (x *{{$lrSvrName}}{{.Name}}Client) Recv() (*{{.Output}}, error) {
 	return m, nil
 }
 
+func (x *{{$lrSvrName}}{{.Name}}Client) Responses() {{$.Iter}}Seq2[*{{.Output}}, error] {
+	return {{$.Stream}}Responses(x.Recv)
+}
+
+func (x *{{$lrSvrName}}{{.Name}}Client) CollectAll(ctx {{$ctx}}) ([]*{{.Output}}, error) {
+	return {{$.Stream}}CollectAll(ctx, x.Recv)
+}
+
 {{else -}}
-func (c *{{$lrSvrName}}Client) {{.Name}}(ctx {{$ctx}}, in *{{.Input}}) (*{{.Output}}, error) {
+func (c *{{$lrSvrName}}Client) {{.Name}}(ctx {{$ctx}}, in *{{.Input}}, opts ...{{$client}}CallOption) (*{{.Output}}, error) {
+	{{if .Idempotent -}}
+	ctx = {{$interceptor}}WithIdempotent(ctx)
+	{{end -}}
 	out := new({{.Output}})
-	err := c.cc.Invoke(ctx, "/{{$.FullServerName}}/{{.Name}}", in, out)
+	err := c.cc.Invoke(ctx, "/{{$.FullServerName}}/{{.Name}}", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+{{if .WaitOutput -}}
+// {{.Name}}AndWait calls {{.Name}} and polls the returned operation until it
+// is done or ctx expires.
+func (c *{{$lrSvrName}}Client) {{.Name}}AndWait(ctx {{$ctx}}, in *{{.Input}}, opts ...{{$client}}CallOption) (*{{.WaitOutput}}, error) {
+	op, err := c.{{.Name}}(ctx, in, opts...)
 	if err != nil {
 		return nil, err
 	}
+	out := new({{.WaitOutput}})
+	if err := {{$.Operations}}NewClient(c.cc).Wait(ctx, op, out); err != nil {
+		return nil, err
+	}
 	return out, nil
 }
 
+{{end -}}
 {{end -}}
 {{end -}}
 
@@ -0,0 +1,134 @@
+// Copyright 2022 The codesjoy Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode"
+
+	"google.golang.org/protobuf/compiler/protogen"
+)
+
+const appPackage = protogen.GoImportPath("github.com/codesjoy/yggdrasil/v3/app")
+
+// generateSkeletonFiles emits one handler skeleton per service of file. A
+// skeleton is a starting point owned by the user, so it is skipped when its
+// file already exists under outDir.
+func generateSkeletonFiles(gen *protogen.Plugin, file *protogen.File, outDir string) {
+	for _, service := range file.Services {
+		if len(service.Methods) == 0 {
+			continue
+		}
+		filename := skeletonFilename(file, service)
+		_, err := os.Stat(filepath.Join(outDir, filepath.FromSlash(filename)))
+		if !errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		g := gen.NewGeneratedFile(filename, file.GoImportPath)
+		g.P("// Code generated by protoc-gen-yggdrasil-rpc as a starting point for the")
+		g.P("// ", service.GoName, " handlers. It is only generated while absent, so edit")
+		g.P("// it freely.")
+		g.P()
+		g.P("package ", file.GoPackageName)
+		g.P()
+		sd := &serviceDesc{
+			ServiceType: service.GoName,
+			Context:     g.QualifiedGoIdent(contextPackage.Ident("Context")),
+			Code:        g.QualifiedGoIdent(codePackage.Ident("")),
+			Status:      g.QualifiedGoIdent(xerrorPackage.Ident("")),
+			GoPackage:   string(file.GoPackageName),
+			App:         g.QualifiedGoIdent(appPackage.Ident("")),
+			Methods:     newMethodDescs(gen, g, service),
+		}
+		g.P(sd.execute(skeletonTpl))
+	}
+}
+
+// skeletonFilename names the skeleton of service after its proto file, e.g.
+// greeter_greeter_service_handler.go.
+func skeletonFilename(file *protogen.File, service *protogen.Service) string {
+	return file.GeneratedFilenamePrefix + "_" + toSnakeCase(service.GoName) + "_handler.go"
+}
+
+// toSnakeCase converts from camel case form to underscore separated form.
+func toSnakeCase(s string) string {
+	var b strings.Builder
+	runes := []rune(s)
+	for i, r := range runes {
+		if unicode.IsUpper(r) {
+			// Start a word at a lower-to-upper change and at the last
+			// capital of an acronym, as in "HTTPServer".
+			if i > 0 && (unicode.IsLower(runes[i-1]) ||
+				(i+1 < len(runes) && unicode.IsLower(runes[i+1]))) {
+				b.WriteByte('_')
+			}
+			r = unicode.ToLower(r)
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+var skeletonTpl = `
+{{$svrType := .ServiceType}}
+{{$status := .Status}}
+// {{$svrType}}Handler implements {{$svrType}}Server.
+type {{$svrType}}Handler struct {
+	Unimplemented{{$svrType}}Server
+}
+
+// New{{$svrType}}Handler returns the {{$svrType}} handler.
+func New{{$svrType}}Handler() *{{$svrType}}Handler {
+	return &{{$svrType}}Handler{}
+}
+
+// Compose{{$svrType}} installs a {{$svrType}}Handler into the app:
+//
+//	yggdrasil.Run(ctx, appName, {{.GoPackage}}.Compose{{$svrType}})
+func Compose{{$svrType}}({{.App}}Runtime) (*{{.App}}BusinessBundle, error) {
+	return &{{.App}}BusinessBundle{
+		RPCBindings: []{{.App}}RPCBinding{
+			{
+				ServiceName: {{$svrType}}ServiceDesc.ServiceName,
+				Desc:        &{{$svrType}}ServiceDesc,
+				Impl:        New{{$svrType}}Handler(),
+			},
+		},
+	}, nil
+}
+{{range .Methods}}
+// {{.Name}} implements {{$svrType}}Server.
+{{if .ClientStream -}}
+func (h *{{$svrType}}Handler) {{.Name}}(stream {{$svrType}}{{.Name}}Server) error {
+	// TODO: implement {{.Name}}.
+	return {{$status}}New({{$.Code}}Code_UNIMPLEMENTED, "method {{.Name}} not implemented")
+}
+{{else if .ServerStream -}}
+func (h *{{$svrType}}Handler) {{.Name}}(req *{{.Input}}, stream {{$svrType}}{{.Name}}Server) error {
+	// TODO: implement {{.Name}}.
+	return {{$status}}New({{$.Code}}Code_UNIMPLEMENTED, "method {{.Name}} not implemented")
+}
+{{else -}}
+func (h *{{$svrType}}Handler) {{.Name}}(ctx {{$.Context}}, req *{{.Input}}) (*{{.Output}}, error) {
+	// TODO: implement {{.Name}}.
+	return nil, {{$status}}New({{$.Code}}Code_UNIMPLEMENTED, "method {{.Name}} not implemented")
+}
+{{end -}}
+{{end -}}
+`
@@ -0,0 +1,134 @@
+// Copyright 2022 The codesjoy Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+// testOutPrefix is where the test plugin, without paths=source_relative,
+// places the files of test.proto.
+const testOutPrefix = "github.com/codesjoy/yggdrasil/v3/cmd/protoc-gen-yggdrasil-rpc/"
+
+func generateSkeletons(
+	t *testing.T,
+	outDir string,
+	services ...*descriptorpb.ServiceDescriptorProto,
+) map[string]string {
+	t.Helper()
+	prevSkeleton, prevOut := *skeleton, *skeletonOut
+	*skeleton, *skeletonOut = true, outDir
+	t.Cleanup(func() { *skeleton, *skeletonOut = prevSkeleton, prevOut })
+
+	gen := newTestPlugin(t, services...)
+	generateFiles(gen, gen.Files[0])
+	resp := gen.Response()
+	require.Empty(t, resp.GetError())
+	out := map[string]string{}
+	for _, f := range resp.File {
+		if strings.HasSuffix(f.GetName(), "_handler.go") {
+			out[f.GetName()] = f.GetContent()
+		}
+	}
+	return out
+}
+
+func TestGenerateSkeleton(t *testing.T) {
+	files := generateSkeletons(t, t.TempDir(), newService("Greeter",
+		newMethod("SayHello", "HelloRequest", "HelloResponse", false, false),
+		newMethod("Chat", "HelloRequest", "HelloResponse", true, true),
+		newMethod("Upload", "HelloRequest", "HelloResponse", true, false),
+		newMethod("Watch", "HelloRequest", "HelloResponse", false, true),
+	))
+	require.Len(t, files, 1)
+	content, ok := files[testOutPrefix+"test_greeter_handler.go"]
+	require.True(t, ok)
+
+	assert.NotContains(t, content, "DO NOT EDIT")
+	assert.Contains(t, content, "type GreeterHandler struct {\n\tUnimplementedGreeterServer\n}")
+	assert.Contains(t, content, "func NewGreeterHandler() *GreeterHandler")
+	assert.Contains(t, content, "func ComposeGreeter(app.Runtime) (*app.BusinessBundle, error)")
+	assert.Contains(t, content, "Desc:        &GreeterServiceDesc,")
+	assert.Contains(t, content, "yggdrasil.Run(ctx, appName, main.ComposeGreeter)")
+	assert.Contains(t, content,
+		"func (h *GreeterHandler) SayHello(ctx context.Context, req *HelloRequest) "+
+			"(*HelloResponse, error) {\n\t// TODO: implement SayHello.")
+	assert.Contains(t, content, "func (h *GreeterHandler) Chat(stream GreeterChatServer) error {")
+	assert.Contains(t, content,
+		"func (h *GreeterHandler) Upload(stream GreeterUploadServer) error {")
+	assert.Contains(t, content,
+		"func (h *GreeterHandler) Watch(req *HelloRequest, stream GreeterWatchServer) error {")
+	assert.Equal(t, 4, strings.Count(content, "// TODO: implement"))
+	assert.Contains(t, content, `"github.com/codesjoy/yggdrasil/v3/app"`)
+	assert.NotContains(t, content, "transport/runtime/client")
+}
+
+func TestGenerateSkeleton_SkipsExistingFile(t *testing.T) {
+	dir := t.TempDir()
+	existing := filepath.Join(dir, filepath.FromSlash(testOutPrefix+"test_greeter_handler.go"))
+	require.NoError(t, os.MkdirAll(filepath.Dir(existing), 0o755))
+	require.NoError(t, os.WriteFile(existing, []byte("package main\n"), 0o600))
+	files := generateSkeletons(t, dir,
+		newService("Greeter",
+			newMethod("SayHello", "HelloRequest", "HelloResponse", false, false),
+		),
+		newService("HTTPAdmin",
+			newMethod("Reload", "ReloadRequest", "ReloadResponse", false, false),
+		),
+	)
+	assert.Equal(t, []string{testOutPrefix + "test_http_admin_handler.go"}, sortedKeys(files))
+}
+
+func TestGenerateSkeleton_Disabled(t *testing.T) {
+	content := generateRPCContent(t, newService("Greeter",
+		newMethod("SayHello", "HelloRequest", "HelloResponse", false, false),
+	))
+	assert.NotContains(t, content, "GreeterHandler")
+}
+
+func TestToSnakeCase(t *testing.T) {
+	tests := []struct {
+		input  string
+		expect string
+	}{
+		{"", ""},
+		{"Greeter", "greeter"},
+		{"GreeterService", "greeter_service"},
+		{"HTTPAdmin", "http_admin"},
+		{"ServiceV2", "service_v2"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			assert.Equal(t, tt.expect, toSnakeCase(tt.input))
+		})
+	}
+}
+
+func sortedKeys(m map[string]string) []string {
+	out := make([]string, 0, len(m))
+	for k := range m {
+		out = append(out, k)
+	}
+	sort.Strings(out)
+	return out
+}
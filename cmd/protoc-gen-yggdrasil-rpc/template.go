@@ -36,7 +36,13 @@ type serviceDesc struct {
 	Interceptor           string
 	Md                    string
 	Stream                string
+	Iter                  string
+	Operations            string
 	NeedStream            bool
+	NeedServerStream      bool
+	// GoPackage and App are only set for skeleton files.
+	GoPackage string
+	App       string
 }
 
 type methodDesc struct {
@@ -49,7 +55,11 @@ type methodDesc struct {
 	IsBidi             bool
 	IsClientStreamOnly bool
 	IsServerStreamOnly bool
+	Idempotent         bool
 	StreamIndex        int
+	// WaitOutput is the response type of a long-running method, which
+	// gets an AndWait helper.
+	WaitOutput string
 }
 
 func (sd *serviceDesc) execute(tpl string) string {
@@ -0,0 +1,125 @@
+// Copyright 2022 The codesjoy Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"flag"
+	"net"
+	"strconv"
+
+	"github.com/codesjoy/yggdrasil/v3/app"
+	"github.com/codesjoy/yggdrasil/v3/config"
+	"github.com/codesjoy/yggdrasil/v3/config/source/memory"
+	"github.com/codesjoy/yggdrasil/v3/transport/runtime/client"
+)
+
+// directClient is the client service name host:port targets are dialed as.
+const directClient = "yggctl"
+
+// appFlags are the flags of the commands that build a yggdrasil App.
+type appFlags struct {
+	config   string
+	protocol string
+	verbose  bool
+}
+
+func (f *appFlags) register(fs *flag.FlagSet) {
+	fs.StringVar(&f.config, "config", "", "yggdrasil config file")
+	fs.StringVar(&f.protocol, "protocol", "grpc", "transport protocol of host:port targets")
+	fs.BoolVar(&f.verbose, "v", false, "print framework logs")
+}
+
+// newApp prepares an App from the config file of f, with overlay layered on
+// top of every other source.
+func (f *appFlags) newApp(
+	ctx context.Context,
+	e *env,
+	overlay map[string]any,
+) (*app.App, *config.Manager, error) {
+	quietLogs(e, f.verbose)
+	manager := config.NewManager()
+	opts := []app.Option{app.WithConfigManager(manager), app.WithProcessDefaults(false)}
+	if f.config != "" {
+		opts = append(opts, app.WithConfigPath(f.config))
+	}
+	if overlay != nil {
+		opts = append(opts, app.WithConfigSource(
+			"yggctl",
+			config.PriorityOverride,
+			memory.NewSource("yggctl", overlay),
+		))
+	}
+	a, err := app.New("yggctl", opts...)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := a.Prepare(ctx); err != nil {
+		_ = a.Stop(context.WithoutCancel(ctx))
+		return nil, nil, err
+	}
+	return a, manager, nil
+}
+
+// dial returns a client of target, either a configured client service or a
+// host:port. The returned stop releases the client and its App.
+func (f *appFlags) dial(
+	ctx context.Context,
+	e *env,
+	target string,
+) (cli client.Client, stop func(), err error) {
+	name, overlay := target, map[string]any(nil)
+	if isAddress(target) {
+		name = directClient
+		overlay = map[string]any{
+			"yggdrasil": map[string]any{
+				"clients": map[string]any{
+					"services": map[string]any{
+						directClient: map[string]any{
+							"remote": map[string]any{
+								"endpoints": []any{
+									map[string]any{"address": target, "protocol": f.protocol},
+								},
+							},
+						},
+					},
+				},
+			},
+		}
+	}
+	a, _, err := f.newApp(ctx, e, overlay)
+	if err != nil {
+		return nil, nil, err
+	}
+	cli, err = a.NewClient(ctx, name)
+	if err != nil {
+		_ = a.Stop(context.WithoutCancel(ctx))
+		return nil, nil, err
+	}
+	return cli, func() {
+		_ = cli.Close()
+		_ = a.Stop(context.WithoutCancel(ctx))
+	}, nil
+}
+
+// isAddress reports whether target is a host:port rather than a service name.
+func isAddress(target string) bool {
+	_, port, err := net.SplitHostPort(target)
+	if err != nil {
+		return false
+	}
+	_, err = strconv.ParseUint(port, 10, 16)
+	return err == nil
+}
@@ -0,0 +1,175 @@
+// Copyright 2022 The codesjoy Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/dynamicpb"
+
+	"github.com/codesjoy/yggdrasil/v3/rpc/metadata"
+	"github.com/codesjoy/yggdrasil/v3/rpc/stream"
+)
+
+func runCall(ctx context.Context, e *env, args []string) error {
+	fs := newFlagSet(e, "call [flags] <target> <service>/<method>")
+	var af appFlags
+	af.register(fs)
+	data := fs.String("d", "{}", "request JSON; @file reads a file and @- reads stdin")
+	headers := metadata.MD{}
+	fs.Var(headerFlag(headers), "H", "request metadata as key:value, repeatable")
+	timeout := fs.Duration("timeout", 10*time.Second, "deadline of the call")
+	governorAddr := fs.String("governor", "", "governor address describing error reasons")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 2 {
+		fs.Usage()
+		return flag.ErrHelp
+	}
+	body, err := readData(e, *data)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, *timeout)
+	defer cancel()
+	cli, stop, err := af.dial(ctx, e, fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	defer stop()
+	rc, err := newReflectionClient(ctx, cli)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = rc.Close() }()
+	md, files, err := rc.Method(fs.Arg(1))
+	if err != nil {
+		return err
+	}
+	if md.IsStreamingClient() {
+		return fmt.Errorf("%s is client streaming; only unary and server streaming methods "+
+			"can be called", md.FullName())
+	}
+
+	types := typeResolver{Types: dynamicpb.NewTypes(files)}
+	in := dynamicpb.NewMessage(md.Input())
+	if err := (protojson.UnmarshalOptions{Resolver: types}).Unmarshal(body, in); err != nil {
+		return fmt.Errorf("decode request %s: %w", md.Input().FullName(), err)
+	}
+	out := protojson.MarshalOptions{Multiline: true, Resolver: types}
+	method := fmt.Sprintf("/%s/%s", md.Parent().FullName(), md.Name())
+	ctx = metadata.WithOutContext(ctx, headers)
+
+	if !md.IsStreamingServer() {
+		reply := dynamicpb.NewMessage(md.Output())
+		if err := cli.Invoke(ctx, method, in, reply); err != nil {
+			return newCallError(ctx, err, *governorAddr, types)
+		}
+		return writeMessage(e.stdout, out, reply)
+	}
+	st, err := cli.NewStream(ctx, &stream.Desc{ServerStreams: true}, method)
+	if err != nil {
+		return newCallError(ctx, err, *governorAddr, types)
+	}
+	if err := st.SendMsg(in); err != nil {
+		return newCallError(ctx, err, *governorAddr, types)
+	}
+	if err := st.CloseSend(); err != nil {
+		return newCallError(ctx, err, *governorAddr, types)
+	}
+	for {
+		reply := dynamicpb.NewMessage(md.Output())
+		err := st.RecvMsg(reply)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return newCallError(ctx, err, *governorAddr, types)
+		}
+		if err := writeMessage(e.stdout, out, reply); err != nil {
+			return err
+		}
+	}
+}
+
+// headerFlag collects -H key:value flags into metadata.
+type headerFlag metadata.MD
+
+func (h headerFlag) String() string { return "" }
+
+func (h headerFlag) Set(value string) error {
+	key, val, ok := strings.Cut(value, ":")
+	key = strings.TrimSpace(key)
+	if !ok || key == "" {
+		return fmt.Errorf("header %q is not key:value", value)
+	}
+	metadata.MD(h).Append(key, strings.TrimSpace(val))
+	return nil
+}
+
+// readData returns the request body of the -d flag.
+func readData(e *env, data string) ([]byte, error) {
+	switch {
+	case data == "@-":
+		return io.ReadAll(e.stdin)
+	case strings.HasPrefix(data, "@"):
+		return os.ReadFile(data[1:])
+	default:
+		return []byte(data), nil
+	}
+}
+
+func writeMessage(w io.Writer, opts protojson.MarshalOptions, m proto.Message) error {
+	data, err := opts.Marshal(m)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "%s\n", data)
+	return err
+}
+
+// typeResolver resolves the types of the server first and falls back to
+// the types linked into yggctl, such as the standard error details.
+type typeResolver struct {
+	*dynamicpb.Types
+}
+
+func (r typeResolver) FindMessageByName(
+	name protoreflect.FullName,
+) (protoreflect.MessageType, error) {
+	if mt, err := r.Types.FindMessageByName(name); err == nil {
+		return mt, nil
+	}
+	return protoregistry.GlobalTypes.FindMessageByName(name)
+}
+
+func (r typeResolver) FindMessageByURL(url string) (protoreflect.MessageType, error) {
+	if mt, err := r.Types.FindMessageByURL(url); err == nil {
+		return mt, nil
+	}
+	return protoregistry.GlobalTypes.FindMessageByURL(url)
+}
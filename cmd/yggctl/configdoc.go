@@ -0,0 +1,63 @@
+// Copyright 2022 The codesjoy Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"slices"
+
+	"github.com/codesjoy/yggdrasil/v3/config/configdoc"
+	"github.com/codesjoy/yggdrasil/v3/config/configdoc/builtin"
+)
+
+func runConfigDoc(_ context.Context, e *env, args []string) error {
+	fs := newFlagSet(e, "config-doc [flags] [path...]")
+	format := fs.String("format", "markdown", "output format: markdown or json")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *format != "markdown" && *format != "json" {
+		fs.Usage()
+		return flag.ErrHelp
+	}
+	sections, err := configSections()
+	if err != nil {
+		return err
+	}
+	if fs.NArg() > 0 {
+		var picked []configdoc.Section
+		for _, path := range fs.Args() {
+			i := slices.IndexFunc(sections, func(s configdoc.Section) bool { return s.Path == path })
+			if i < 0 {
+				return fmt.Errorf("no documented config at %q", path)
+			}
+			picked = append(picked, sections[i])
+		}
+		sections = picked
+	}
+	if *format == "json" {
+		return writeJSON(e.stdout, sections)
+	}
+	return configdoc.WriteMarkdown(e.stdout, sections...)
+}
+
+// configSections documents the registered config sections with their
+// defaults.
+func configSections() ([]configdoc.Section, error) {
+	builtin.Register()
+	return configdoc.Sections(nil)
+}
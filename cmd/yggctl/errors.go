@@ -0,0 +1,113 @@
+// Copyright 2022 The codesjoy Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"time"
+
+	"google.golang.org/protobuf/encoding/protojson"
+
+	"github.com/codesjoy/yggdrasil/v3/rpc/status"
+)
+
+// callError is a failed call, printed as its envelope.
+type callError struct {
+	envelope errorEnvelope
+}
+
+func (e *callError) Error() string {
+	return e.envelope.Code + ": " + e.envelope.Message
+}
+
+// errorEnvelope is the JSON form of a failed call.
+type errorEnvelope struct {
+	Code    string            `json:"code"`
+	Message string            `json:"message"`
+	Reason  *errorReason      `json:"reason,omitempty"`
+	Details []json.RawMessage `json:"details,omitempty"`
+}
+
+// errorReason is the ErrorInfo of a failed call, described by the reason
+// catalog of the governor when one was given.
+type errorReason struct {
+	Reason      string            `json:"reason"`
+	Domain      string            `json:"domain"`
+	Metadata    map[string]string `json:"metadata,omitempty"`
+	HTTPCode    int32             `json:"http_code,omitempty"`
+	Description string            `json:"description,omitempty"`
+}
+
+func newCallError(ctx context.Context, err error, governorAddr string, types typeResolver) error {
+	st := status.FromError(err)
+	envelope := errorEnvelope{Code: st.Code().String(), Message: st.Message()}
+	opts := protojson.MarshalOptions{Resolver: types}
+	for _, detail := range st.Status().GetDetails() {
+		raw, err := opts.Marshal(detail)
+		if err != nil {
+			raw, _ = json.Marshal(map[string]string{"@type": detail.GetTypeUrl()})
+		}
+		envelope.Details = append(envelope.Details, raw)
+	}
+	if info := st.ErrorInfo(); info != nil {
+		envelope.Reason = &errorReason{
+			Reason:   info.GetReason(),
+			Domain:   info.GetDomain(),
+			Metadata: info.GetMetadata(),
+		}
+		if governorAddr != "" {
+			// The call deadline may be what failed; give the lookup its own.
+			ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 5*time.Second)
+			defer cancel()
+			entry, ok := lookupReason(ctx, governorAddr, info.GetDomain(), info.GetReason())
+			if ok {
+				envelope.Reason.HTTPCode = entry.HTTPCode
+				envelope.Reason.Description = entry.Description
+			}
+		}
+	}
+	return &callError{envelope: envelope}
+}
+
+// lookupReason finds a reason in the catalog served by the governor.
+func lookupReason(
+	ctx context.Context,
+	governorAddr, domain, reason string,
+) (status.ReasonEntry, bool) {
+	data, err := governorGet(ctx, governorAddr, "/reasons")
+	if err != nil {
+		return status.ReasonEntry{}, false
+	}
+	var catalog struct {
+		Reasons []status.ReasonEntry `json:"reasons"`
+	}
+	if err := json.Unmarshal(data, &catalog); err != nil {
+		return status.ReasonEntry{}, false
+	}
+	for _, entry := range catalog.Reasons {
+		if entry.Domain == domain && entry.Reason == reason {
+			return entry, true
+		}
+	}
+	return status.ReasonEntry{}, false
+}
+
+func writeJSON(w io.Writer, v any) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(v)
+}
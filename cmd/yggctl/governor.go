@@ -0,0 +1,108 @@
+// Copyright 2022 The codesjoy Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+func runTail(ctx context.Context, e *env, args []string) error {
+	fs := newFlagSet(e, "tail [flags] <governor> [path]")
+	interval := fs.Duration("interval", 2*time.Second, "polling interval")
+	count := fs.Int("n", 0, "number of polls; 0 polls until interrupted")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() < 1 || fs.NArg() > 2 {
+		fs.Usage()
+		return flag.ErrHelp
+	}
+	path := "/channelz"
+	if fs.NArg() == 2 {
+		path = fs.Arg(1)
+	}
+	ticker := time.NewTicker(*interval)
+	defer ticker.Stop()
+	for i := 0; *count <= 0 || i < *count; i++ {
+		if i > 0 {
+			select {
+			case <-ctx.Done():
+				return nil
+			case <-ticker.C:
+			}
+		}
+		data, err := governorGet(ctx, fs.Arg(0), path)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+		line := struct {
+			Time time.Time       `json:"time"`
+			Path string          `json:"path"`
+			Data json.RawMessage `json:"data"`
+		}{Time: time.Now(), Path: path, Data: compactJSON(data)}
+		if err := json.NewEncoder(e.stdout).Encode(line); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// governorGet fetches path from the governor at addr, which may omit the
+// http:// scheme.
+func governorGet(ctx context.Context, addr, path string) ([]byte, error) {
+	if !strings.Contains(addr, "://") {
+		addr = "http://" + addr
+	}
+	url := strings.TrimSuffix(addr, "/") + "/" + strings.TrimPrefix(path, "/")
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("GET %s: %s: %s", url, resp.Status, bytes.TrimSpace(data))
+	}
+	return data, nil
+}
+
+// compactJSON returns data without insignificant space, or data as a JSON
+// string when it is not JSON.
+func compactJSON(data []byte) json.RawMessage {
+	var buf bytes.Buffer
+	if err := json.Compact(&buf, data); err != nil {
+		quoted, _ := json.Marshal(string(data))
+		return quoted
+	}
+	return buf.Bytes()
+}
@@ -0,0 +1,182 @@
+// Copyright 2022 The codesjoy Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/codesjoy/yggdrasil/v3/discovery/resolver"
+)
+
+func runServices(ctx context.Context, e *env, args []string) error {
+	fs := newFlagSet(e, "services [flags] <target>")
+	var af appFlags
+	af.register(fs)
+	timeout := fs.Duration("timeout", 10*time.Second, "deadline of the listing")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return flag.ErrHelp
+	}
+	ctx, cancel := context.WithTimeout(ctx, *timeout)
+	defer cancel()
+	cli, stop, err := af.dial(ctx, e, fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	defer stop()
+	rc, err := newReflectionClient(ctx, cli)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = rc.Close() }()
+	names, err := rc.ListServices()
+	if err != nil {
+		return err
+	}
+	for _, name := range names {
+		if _, err := fmt.Fprintln(e.stdout, name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// endpointView is the JSON form of one resolved endpoint.
+type endpointView struct {
+	Name       string         `json:"name,omitempty"`
+	Address    string         `json:"address"`
+	Protocol   string         `json:"protocol"`
+	Attributes map[string]any `json:"attributes,omitempty"`
+}
+
+func runEndpoints(ctx context.Context, e *env, args []string) error {
+	fs := newFlagSet(e, "endpoints [flags] <service>")
+	var af appFlags
+	af.register(fs)
+	wait := fs.Duration("wait", 5*time.Second, "time to wait for the registry")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return flag.ErrHelp
+	}
+	service := fs.Arg(0)
+	a, _, err := af.newApp(ctx, e, nil)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = a.Stop(context.WithoutCancel(ctx)) }()
+	snapshot := a.Snapshot()
+	settings := snapshot.ClientSettings(service)
+	var endpoints []resolver.Endpoint
+	for _, item := range settings.Remote.Endpoints {
+		endpoints = append(endpoints, item)
+	}
+	var r resolver.Resolver
+	if settings.Resolver != "" {
+		if r, err = snapshot.NewResolver(settings.Resolver); err != nil {
+			return err
+		}
+	}
+	if r != nil {
+		ctx, cancel := context.WithTimeout(ctx, *wait)
+		defer cancel()
+		state, err := resolveOnce(ctx, r, service)
+		if err != nil {
+			return fmt.Errorf("resolve %s with %s resolver %q: %w",
+				service, r.Type(), settings.Resolver, err)
+		}
+		endpoints = state.GetEndpoints()
+	}
+	views := make([]endpointView, 0, len(endpoints))
+	for _, item := range endpoints {
+		views = append(views, endpointView{
+			Name:       item.Name(),
+			Address:    item.GetAddress(),
+			Protocol:   item.GetProtocol(),
+			Attributes: item.GetAttributes(),
+		})
+	}
+	return writeJSON(e.stdout, views)
+}
+
+// stateWatcher keeps the first state a resolver reports.
+type stateWatcher struct {
+	once  sync.Once
+	state chan resolver.State
+}
+
+func (w *stateWatcher) UpdateState(state resolver.State) {
+	w.once.Do(func() { w.state <- state })
+}
+
+func resolveOnce(ctx context.Context, r resolver.Resolver, service string) (resolver.State, error) {
+	w := &stateWatcher{state: make(chan resolver.State, 1)}
+	if err := r.AddWatch(service, w); err != nil {
+		return nil, err
+	}
+	defer func() { _ = r.DelWatch(service, w) }()
+	select {
+	case state := <-w.state:
+		return state, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func runConfig(ctx context.Context, e *env, args []string) error {
+	fs := newFlagSet(e, "config [flags]")
+	var af appFlags
+	af.register(fs)
+	governorAddr := fs.String("governor", "", "dump the config of the running app at this governor")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 0 {
+		fs.Usage()
+		return flag.ErrHelp
+	}
+	var data []byte
+	if *governorAddr != "" {
+		var err error
+		if data, err = governorGet(ctx, *governorAddr, "/configs"); err != nil {
+			return err
+		}
+	} else {
+		a, manager, err := af.newApp(ctx, e, nil)
+		if err != nil {
+			return err
+		}
+		defer func() { _ = a.Stop(context.WithoutCancel(ctx)) }()
+		data = manager.Bytes()
+	}
+	var out bytes.Buffer
+	if err := json.Indent(&out, bytes.TrimSpace(data), "", "  "); err != nil {
+		return fmt.Errorf("decode config: %w", err)
+	}
+	out.WriteByte('\n')
+	_, err := e.stdout.Write(out.Bytes())
+	return err
+}
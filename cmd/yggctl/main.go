@@ -0,0 +1,159 @@
+// Copyright 2022 The codesjoy Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Command yggctl is the operational CLI of yggdrasil services.
+//
+// It calls any method of a server through gRPC server reflection with JSON
+// in and out, lists the services of a server and the endpoints a configured
+// registry resolves, tails governor endpoints, dumps resolved config and
+// documents the keys of the protocol configs.
+// Failed calls print the status as a JSON envelope with the error reason
+// and, given a governor address, its entry of the reason catalog.
+//
+//	yggctl call [-config file] [-d json] [-H key:value] <target> <service>/<method>
+//	yggctl services [-config file] <target>
+//	yggctl endpoints [-config file] <service>
+//	yggctl tail [-interval 2s] [-n count] <governor> [path]
+//	yggctl config [-config file] [-governor address]
+//	yggctl config-doc [-format markdown|json] [path...]
+//
+// A target is either a client service configured under
+// yggdrasil.clients.services or a host:port dialed directly.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+)
+
+type env struct {
+	stdin  io.Reader
+	stdout io.Writer
+	stderr io.Writer
+}
+
+type command struct {
+	name    string
+	summary string
+	run     func(ctx context.Context, e *env, args []string) error
+}
+
+var commands = []command{
+	{
+		name:    "call",
+		summary: "invoke a method with a JSON request",
+		run:     runCall,
+	},
+	{
+		name:    "services",
+		summary: "list the services of a server",
+		run:     runServices,
+	},
+	{
+		name:    "endpoints",
+		summary: "list the endpoints resolved for a client service",
+		run:     runEndpoints,
+	},
+	{
+		name:    "tail",
+		summary: "poll a governor endpoint",
+		run:     runTail,
+	},
+	{
+		name:    "config",
+		summary: "dump the resolved configuration",
+		run:     runConfig,
+	},
+	{
+		name:    "config-doc",
+		summary: "document the protocol config keys and defaults",
+		run:     runConfigDoc,
+	},
+}
+
+func main() {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	code := run(ctx, &env{stdin: os.Stdin, stdout: os.Stdout, stderr: os.Stderr}, os.Args[1:])
+	stop()
+	os.Exit(code)
+}
+
+// run executes the command line args and returns the process exit code.
+func run(ctx context.Context, e *env, args []string) int {
+	if len(args) == 0 || args[0] == "-h" || args[0] == "--help" || args[0] == "help" {
+		printUsage(e.stderr)
+		return 2
+	}
+	for _, cmd := range commands {
+		if cmd.name != args[0] {
+			continue
+		}
+		err := cmd.run(ctx, e, args[1:])
+		switch {
+		case err == nil:
+			return 0
+		case errors.Is(err, flag.ErrHelp):
+			return 2
+		}
+		var callErr *callError
+		if errors.As(err, &callErr) {
+			_ = writeJSON(e.stderr, callErr.envelope)
+			return 1
+		}
+		_, _ = fmt.Fprintf(e.stderr, "yggctl %s: %v\n", cmd.name, err)
+		return 1
+	}
+	_, _ = fmt.Fprintf(e.stderr, "yggctl: unknown command %q\n", args[0])
+	printUsage(e.stderr)
+	return 2
+}
+
+func printUsage(w io.Writer) {
+	_, _ = fmt.Fprintln(w, "usage: yggctl <command> [flags] [args]")
+	_, _ = fmt.Fprintln(w)
+	for _, cmd := range commands {
+		_, _ = fmt.Fprintf(w, "  %-10s %s\n", cmd.name, cmd.summary)
+	}
+}
+
+// newFlagSet returns the flag set of a command, printing errors and usage
+// to e. The usage starts with the command name.
+func newFlagSet(e *env, usage string) *flag.FlagSet {
+	name, _, _ := strings.Cut(usage, " ")
+	fs := flag.NewFlagSet("yggctl "+name, flag.ContinueOnError)
+	fs.SetOutput(e.stderr)
+	fs.Usage = func() {
+		_, _ = fmt.Fprintf(e.stderr, "usage: yggctl %s\n", usage)
+		fs.PrintDefaults()
+	}
+	return fs
+}
+
+// quietLogs keeps framework logs below errors off the terminal unless
+// verbose is set, so command output stays machine readable.
+func quietLogs(e *env, verbose bool) {
+	level := slog.LevelError
+	if verbose {
+		level = slog.LevelDebug
+	}
+	slog.SetDefault(slog.New(slog.NewTextHandler(e.stderr, &slog.HandlerOptions{Level: level})))
+}
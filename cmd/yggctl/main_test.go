@@ -0,0 +1,277 @@
+// Copyright 2022 The codesjoy Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/genproto/googleapis/rpc/code"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+
+	"github.com/codesjoy/yggdrasil/v3/app"
+	"github.com/codesjoy/yggdrasil/v3/config"
+	"github.com/codesjoy/yggdrasil/v3/config/source/memory"
+	"github.com/codesjoy/yggdrasil/v3/rpc/interceptor"
+	"github.com/codesjoy/yggdrasil/v3/rpc/status"
+	"github.com/codesjoy/yggdrasil/v3/transport/runtime/server"
+)
+
+type healthService interface {
+	Check(context.Context, *healthpb.HealthCheckRequest) (*healthpb.HealthCheckResponse, error)
+}
+
+type healthServer struct{}
+
+func (healthServer) Check(
+	_ context.Context,
+	in *healthpb.HealthCheckRequest,
+) (*healthpb.HealthCheckResponse, error) {
+	if in.GetService() != "" {
+		return nil, status.New(code.Code_NOT_FOUND, "unknown service "+in.GetService()).
+			WithDetails(&errdetails.ErrorInfo{Reason: "SERVICE_UNKNOWN", Domain: "yggctl.test"}).
+			Err()
+	}
+	return &healthpb.HealthCheckResponse{Status: healthpb.HealthCheckResponse_SERVING}, nil
+}
+
+var healthServiceDesc = server.ServiceDesc{
+	ServiceName: "grpc.health.v1.Health",
+	HandlerType: (*healthService)(nil),
+	Methods: []server.MethodDesc{{
+		MethodName: "Check",
+		Handler: func(
+			srv any,
+			ctx context.Context,
+			dec func(any) error,
+			unary interceptor.UnaryServerInterceptor,
+		) (any, error) {
+			in := new(healthpb.HealthCheckRequest)
+			if err := dec(in); err != nil {
+				return nil, err
+			}
+			info := &interceptor.UnaryServerInfo{
+				Server:     srv,
+				FullMethod: "/grpc.health.v1.Health/Check",
+			}
+			return unary(ctx, in, info, func(ctx context.Context, req any) (any, error) {
+				return srv.(healthService).Check(ctx, req.(*healthpb.HealthCheckRequest))
+			})
+		},
+	}},
+}
+
+func freePort(t *testing.T) int {
+	t.Helper()
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	port := lis.Addr().(*net.TCPAddr).Port
+	require.NoError(t, lis.Close())
+	return port
+}
+
+// startServer serves the health service with reflection over grpc and
+// returns the grpc and governor addresses.
+func startServer(t *testing.T) (addr, governorAddr string) {
+	t.Helper()
+	addr = net.JoinHostPort("127.0.0.1", strconv.Itoa(freePort(t)))
+	govPort := freePort(t)
+	a, err := app.New("yggctl-test",
+		app.WithConfigManager(config.NewManager()),
+		app.WithProcessDefaults(false),
+		app.WithConfigSource("test", config.PriorityOverride, memory.NewSource("test",
+			map[string]any{"yggdrasil": map[string]any{
+				"server": map[string]any{"transports": []any{"grpc"}, "reflection": true},
+				"transports": map[string]any{
+					"grpc": map[string]any{"server": map[string]any{"address": addr}},
+				},
+				"admin": map[string]any{
+					"governor": map[string]any{"host": "127.0.0.1", "port": govPort},
+				},
+			}},
+		)),
+	)
+	require.NoError(t, err)
+	require.NoError(t, a.ComposeAndInstall(context.Background(),
+		func(app.Runtime) (*app.BusinessBundle, error) {
+			return &app.BusinessBundle{RPCBindings: []app.RPCBinding{{
+				ServiceName: healthServiceDesc.ServiceName,
+				Desc:        &healthServiceDesc,
+				Impl:        healthServer{},
+			}}}, nil
+		},
+	))
+	require.NoError(t, a.Start(context.Background()))
+	t.Cleanup(func() { _ = a.Stop(context.Background()) })
+	governorAddr = net.JoinHostPort("127.0.0.1", strconv.Itoa(govPort))
+	require.Eventually(t, func() bool {
+		conn, err := net.Dial("tcp", governorAddr)
+		if err == nil {
+			_ = conn.Close()
+		}
+		return err == nil
+	}, 5*time.Second, 10*time.Millisecond)
+	return addr, governorAddr
+}
+
+func runArgs(t *testing.T, args ...string) (exit int, stdout, stderr string) {
+	t.Helper()
+	var out, errOut bytes.Buffer
+	e := &env{stdin: strings.NewReader(""), stdout: &out, stderr: &errOut}
+	exit = run(context.Background(), e, args)
+	return exit, out.String(), errOut.String()
+}
+
+func TestCall(t *testing.T) {
+	addr, _ := startServer(t)
+	exit, stdout, stderr := runArgs(t, "call", "-d", `{"service":""}`, addr,
+		"grpc.health.v1.Health/Check")
+	require.Equal(t, 0, exit, stderr)
+	assert.JSONEq(t, `{"status":"SERVING"}`, stdout)
+}
+
+func TestCallErrorEnvelope(t *testing.T) {
+	status.RegisterReasonEntries(status.ReasonEntry{
+		Domain:      "yggctl.test",
+		Reason:      "SERVICE_UNKNOWN",
+		Code:        code.Code_NOT_FOUND.String(),
+		Description: "the service is not monitored",
+	})
+	addr, governorAddr := startServer(t)
+	exit, stdout, stderr := runArgs(t, "call", "-governor", governorAddr,
+		"-d", `{"service":"missing"}`, addr, "grpc.health.v1.Health.Check")
+	require.Equal(t, 1, exit)
+	assert.Empty(t, stdout)
+	var envelope errorEnvelope
+	require.NoError(t, json.Unmarshal([]byte(stderr), &envelope), stderr)
+	assert.Equal(t, "NOT_FOUND", envelope.Code)
+	assert.Equal(t, "unknown service missing", envelope.Message)
+	require.NotNil(t, envelope.Reason)
+	assert.Equal(t, "SERVICE_UNKNOWN", envelope.Reason.Reason)
+	assert.Equal(t, "the service is not monitored", envelope.Reason.Description)
+	assert.Equal(t, int32(404), envelope.Reason.HTTPCode)
+	require.Len(t, envelope.Details, 1)
+	assert.Contains(t, string(envelope.Details[0]), "google.rpc.ErrorInfo")
+}
+
+func TestCallUnknownMethod(t *testing.T) {
+	addr, _ := startServer(t)
+	exit, _, stderr := runArgs(t, "call", addr, "grpc.health.v1.Health/Watch2")
+	assert.Equal(t, 1, exit)
+	assert.Contains(t, stderr, "has no method Watch2")
+}
+
+func TestServices(t *testing.T) {
+	addr, _ := startServer(t)
+	exit, stdout, stderr := runArgs(t, "services", addr)
+	require.Equal(t, 0, exit, stderr)
+	assert.Equal(t,
+		"grpc.health.v1.Health\n"+server.ReflectionServiceName+"\n",
+		stdout,
+	)
+}
+
+func TestTail(t *testing.T) {
+	_, governorAddr := startServer(t)
+	exit, stdout, stderr := runArgs(t, "tail", "-n", "2", "-interval", "10ms",
+		governorAddr, "/healthz")
+	require.Equal(t, 0, exit, stderr)
+	lines := strings.Split(strings.TrimSpace(stdout), "\n")
+	require.Len(t, lines, 2)
+	var line struct {
+		Path string          `json:"path"`
+		Data json.RawMessage `json:"data"`
+	}
+	require.NoError(t, json.Unmarshal([]byte(lines[0]), &line))
+	assert.Equal(t, "/healthz", line.Path)
+	assert.NotEmpty(t, line.Data)
+}
+
+func writeConfig(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+	return path
+}
+
+func TestEndpoints(t *testing.T) {
+	path := writeConfig(t, `
+yggdrasil:
+  clients:
+    services:
+      demo:
+        remote:
+          endpoints:
+            - address: "127.0.0.1:9000"
+              protocol: "grpc"
+`)
+	exit, stdout, stderr := runArgs(t, "endpoints", "-config", path, "demo")
+	require.Equal(t, 0, exit, stderr)
+	var views []endpointView
+	require.NoError(t, json.Unmarshal([]byte(stdout), &views))
+	require.Len(t, views, 1)
+	assert.Equal(t, "127.0.0.1:9000", views[0].Address)
+	assert.Equal(t, "grpc", views[0].Protocol)
+}
+
+func TestConfig(t *testing.T) {
+	path := writeConfig(t, `
+app:
+  demo:
+    greeting: hello
+`)
+	exit, stdout, stderr := runArgs(t, "config", "-config", path)
+	require.Equal(t, 0, exit, stderr)
+	var dump map[string]any
+	require.NoError(t, json.Unmarshal([]byte(stdout), &dump))
+	assert.Equal(t, map[string]any{"demo": map[string]any{"greeting": "hello"}}, dump["app"])
+}
+
+func TestConfigDoc(t *testing.T) {
+	exit, stdout, stderr := runArgs(t, "config-doc")
+	require.Equal(t, 0, exit, stderr)
+	assert.Contains(t, stdout, "## yggdrasil.transports.grpc.server\n")
+	assert.Contains(t, stdout, "| `network` | string | `\"tcp\"` |")
+	assert.Contains(t, stdout, "| `read_timeout` | duration | `\"15s\"` |")
+	assert.Contains(t, stdout, "## yggdrasil.admin.governor\n")
+
+	exit, stdout, stderr = runArgs(t, "config-doc", "-format", "json", "yggdrasil.admin.governor")
+	require.Equal(t, 0, exit, stderr)
+	var sections []map[string]any
+	require.NoError(t, json.Unmarshal([]byte(stdout), &sections))
+	require.Len(t, sections, 1)
+	assert.Equal(t, "yggdrasil.admin.governor", sections[0]["path"])
+
+	exit, _, stderr = runArgs(t, "config-doc", "yggdrasil.nope")
+	assert.Equal(t, 1, exit)
+	assert.Contains(t, stderr, `no documented config at "yggdrasil.nope"`)
+}
+
+func TestUnknownCommand(t *testing.T) {
+	exit, _, stderr := runArgs(t, "frobnicate")
+	assert.Equal(t, 2, exit)
+	assert.Contains(t, stderr, `unknown command "frobnicate"`)
+}
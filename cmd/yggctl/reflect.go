@@ -0,0 +1,184 @@
+// Copyright 2022 The codesjoy Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	reflectionpb "google.golang.org/grpc/reflection/grpc_reflection_v1"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+
+	"github.com/codesjoy/yggdrasil/v3/rpc/stream"
+	"github.com/codesjoy/yggdrasil/v3/transport/runtime/client"
+	"github.com/codesjoy/yggdrasil/v3/transport/runtime/server"
+)
+
+// reflectionClient fetches descriptors over one ServerReflectionInfo stream.
+type reflectionClient struct {
+	st    stream.ClientStream
+	files map[string]*descriptorpb.FileDescriptorProto
+}
+
+func newReflectionClient(ctx context.Context, cli client.Client) (*reflectionClient, error) {
+	st, err := cli.NewStream(
+		ctx,
+		&server.ReflectionServiceDesc.Streams[0],
+		"/"+server.ReflectionServiceName+"/ServerReflectionInfo",
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &reflectionClient{st: st, files: map[string]*descriptorpb.FileDescriptorProto{}}, nil
+}
+
+// Close ends the reflection stream.
+func (r *reflectionClient) Close() error {
+	return r.st.CloseSend()
+}
+
+func (r *reflectionClient) exchange(
+	req *reflectionpb.ServerReflectionRequest,
+) (*reflectionpb.ServerReflectionResponse, error) {
+	if err := r.st.SendMsg(req); err != nil {
+		return nil, reflectionError(err)
+	}
+	resp := new(reflectionpb.ServerReflectionResponse)
+	if err := r.st.RecvMsg(resp); err != nil {
+		return nil, reflectionError(err)
+	}
+	if e := resp.GetErrorResponse(); e != nil {
+		return nil, fmt.Errorf("server reflection: %s", e.GetErrorMessage())
+	}
+	return resp, nil
+}
+
+// ListServices returns the sorted names of the services of the server.
+func (r *reflectionClient) ListServices() ([]string, error) {
+	resp, err := r.exchange(&reflectionpb.ServerReflectionRequest{
+		MessageRequest: &reflectionpb.ServerReflectionRequest_ListServices{},
+	})
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, svc := range resp.GetListServicesResponse().GetService() {
+		names = append(names, svc.GetName())
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// Method resolves a "service/method" or "service.method" name.
+func (r *reflectionClient) Method(
+	name string,
+) (protoreflect.MethodDescriptor, *protoregistry.Files, error) {
+	name = strings.TrimPrefix(name, "/")
+	i := strings.LastIndexAny(name, "/.")
+	if i <= 0 || i == len(name)-1 {
+		return nil, nil, fmt.Errorf("method %q is not <service>/<method>", name)
+	}
+	service, method := name[:i], name[i+1:]
+	files, err := r.filesFor(service)
+	if err != nil {
+		return nil, nil, err
+	}
+	desc, err := files.FindDescriptorByName(protoreflect.FullName(service))
+	if err != nil {
+		return nil, nil, fmt.Errorf("service %s: %w", service, err)
+	}
+	sd, ok := desc.(protoreflect.ServiceDescriptor)
+	if !ok {
+		return nil, nil, fmt.Errorf("%s is not a service", service)
+	}
+	md := sd.Methods().ByName(protoreflect.Name(method))
+	if md == nil {
+		return nil, nil, fmt.Errorf("service %s has no method %s", service, method)
+	}
+	return md, files, nil
+}
+
+// filesFor loads the file declaring symbol with its dependencies.
+func (r *reflectionClient) filesFor(symbol string) (*protoregistry.Files, error) {
+	resp, err := r.exchange(&reflectionpb.ServerReflectionRequest{
+		MessageRequest: &reflectionpb.ServerReflectionRequest_FileContainingSymbol{
+			FileContainingSymbol: symbol,
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := r.addFiles(resp); err != nil {
+		return nil, err
+	}
+	// The server sends each file once per stream; fetch what is missing.
+	for {
+		missing := r.missingDependency()
+		if missing == "" {
+			break
+		}
+		resp, err := r.exchange(&reflectionpb.ServerReflectionRequest{
+			MessageRequest: &reflectionpb.ServerReflectionRequest_FileByFilename{
+				FileByFilename: missing,
+			},
+		})
+		if err != nil {
+			return nil, err
+		}
+		if err := r.addFiles(resp); err != nil {
+			return nil, err
+		}
+		if _, ok := r.files[missing]; !ok {
+			return nil, fmt.Errorf("server reflection did not return %s", missing)
+		}
+	}
+	set := &descriptorpb.FileDescriptorSet{}
+	for _, fd := range r.files {
+		set.File = append(set.File, fd)
+	}
+	return protodesc.NewFiles(set)
+}
+
+func (r *reflectionClient) addFiles(resp *reflectionpb.ServerReflectionResponse) error {
+	for _, raw := range resp.GetFileDescriptorResponse().GetFileDescriptorProto() {
+		fd := new(descriptorpb.FileDescriptorProto)
+		if err := proto.Unmarshal(raw, fd); err != nil {
+			return fmt.Errorf("decode file descriptor: %w", err)
+		}
+		r.files[fd.GetName()] = fd
+	}
+	return nil
+}
+
+func (r *reflectionClient) missingDependency() string {
+	for _, fd := range r.files {
+		for _, dep := range fd.GetDependency() {
+			if _, ok := r.files[dep]; !ok {
+				return dep
+			}
+		}
+	}
+	return ""
+}
+
+func reflectionError(err error) error {
+	return fmt.Errorf("server reflection: %w (is yggdrasil.server.reflection enabled?)", err)
+}
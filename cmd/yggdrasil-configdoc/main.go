@@ -0,0 +1,101 @@
+// Copyright 2022 The codesjoy Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Command yggdrasil-configdoc documents the registered config sections of
+// yggdrasil with their keys, types, defaults and descriptions.
+//
+// Usage:
+//
+//	yggdrasil-configdoc [-format markdown|json] [-root dir] [-o file] [path...]
+//
+// The descriptions are the doc comments of the config struct fields, read
+// from the module sources at -root. Paths limit the output to the given
+// sections.
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+
+	"github.com/codesjoy/yggdrasil/v3/config/configdoc"
+	"github.com/codesjoy/yggdrasil/v3/config/configdoc/builtin"
+)
+
+func main() {
+	if err := run(os.Args[1:], os.Stdout); err != nil {
+		fmt.Fprintf(os.Stderr, "yggdrasil-configdoc: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func run(args []string, stdout io.Writer) error {
+	fs := flag.NewFlagSet("yggdrasil-configdoc", flag.ContinueOnError)
+	format := fs.String("format", "markdown", "output format: markdown or json")
+	root := fs.String("root", ".", "module root read for the field descriptions; empty skips them")
+	output := fs.String("o", "", "output file; empty writes to stdout")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *format != "markdown" && *format != "json" {
+		return fmt.Errorf("unknown format %q", *format)
+	}
+
+	var describe configdoc.Describer
+	if *root != "" {
+		var err error
+		if describe, err = configdoc.SourceDescriber(*root); err != nil {
+			return err
+		}
+	}
+	builtin.Register()
+	sections, err := configdoc.Sections(describe)
+	if err != nil {
+		return err
+	}
+	if fs.NArg() > 0 {
+		var picked []configdoc.Section
+		for _, path := range fs.Args() {
+			i := slices.IndexFunc(sections, func(s configdoc.Section) bool { return s.Path == path })
+			if i < 0 {
+				return fmt.Errorf("no documented config at %q", path)
+			}
+			picked = append(picked, sections[i])
+		}
+		sections = picked
+	}
+
+	w := stdout
+	if *output != "" {
+		f, err := os.Create(*output)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		w = f
+	}
+	if *format == "json" {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(sections)
+	}
+	if _, err := io.WriteString(w, "# Configuration reference\n\n"+
+		"Generated by cmd/yggdrasil-configdoc; do not edit.\n\n"); err != nil {
+		return err
+	}
+	return configdoc.WriteMarkdown(w, sections...)
+}
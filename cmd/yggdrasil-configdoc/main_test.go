@@ -0,0 +1,56 @@
+// Copyright 2022 The codesjoy Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/codesjoy/yggdrasil/v3/config/configdoc"
+)
+
+func TestRunJSON(t *testing.T) {
+	var out bytes.Buffer
+	require.NoError(t, run([]string{"-format", "json", "-root", "../..", "yggdrasil.tracing"}, &out))
+	var sections []configdoc.Section
+	require.NoError(t, json.Unmarshal(out.Bytes(), &sections))
+	require.Len(t, sections, 1)
+	assert.Equal(t, "yggdrasil.tracing", sections[0].Path)
+	require.NotEmpty(t, sections[0].Fields)
+	assert.Equal(t, "sampler", sections[0].Fields[0].Key)
+	assert.True(t, strings.HasPrefix(sections[0].Fields[0].Description, "Sampler is one of"))
+}
+
+func TestRunMarkdownFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.md")
+	require.NoError(t, run([]string{"-root", "", "-o", path}, &bytes.Buffer{}))
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Contains(t, string(data), "## yggdrasil.transports.grpc.server\n")
+	assert.Contains(t, string(data), "| `network` | string | `\"tcp\"` |")
+}
+
+func TestRunErrors(t *testing.T) {
+	assert.ErrorContains(t, run([]string{"-format", "yaml"}, &bytes.Buffer{}), `unknown format "yaml"`)
+	assert.ErrorContains(t, run([]string{"-root", "", "yggdrasil.nope"}, &bytes.Buffer{}),
+		`no documented config at "yggdrasil.nope"`)
+}
@@ -23,7 +23,6 @@ import (
 
 	"github.com/codesjoy/yggdrasil/v3/config"
 	"github.com/codesjoy/yggdrasil/v3/config/source"
-	filesource "github.com/codesjoy/yggdrasil/v3/config/source/file"
 )
 
 // Loader loads the main config file and any declared config sources.
@@ -40,10 +39,14 @@ func NewLoader(registry *Registry) *Loader {
 }
 
 // LoadFile loads a config file and all declarative sources it defines.
+//
+// The file is layered with its includes and with the overlays of the given
+// profiles; see NewProfileSource for the merge order.
 func (l *Loader) LoadFile(
 	manager *config.Manager,
 	path string,
 	explicit bool,
+	profiles ...string,
 ) ([]source.Source, bool, error) {
 	path = strings.TrimSpace(path)
 	if path == "" {
@@ -64,7 +67,7 @@ func (l *Loader) LoadFile(
 	}
 
 	loaded := make([]source.Source, 0, 4)
-	configFileSource := filesource.NewSource(path, false)
+	configFileSource := NewProfileSource(path, profiles...)
 	if err := manager.LoadLayer("config:file:"+path, config.PriorityFile, configFileSource); err != nil {
 		return nil, false, err
 	}
@@ -0,0 +1,193 @@
+// Copyright 2022 The codesjoy Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package chain
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/codesjoy/pkg/utils/xmap"
+
+	"github.com/codesjoy/yggdrasil/v3/config/source"
+	filesource "github.com/codesjoy/yggdrasil/v3/config/source/file"
+)
+
+// IncludeKey is the key, under yggdrasil.config, that lists files merged
+// underneath the file declaring it.
+const IncludeKey = "include"
+
+// ProfileFile returns the overlay path of one profile for a base config file,
+// e.g. config.yaml with profile "dev" resolves to config.dev.yaml.
+func ProfileFile(path, profile string) string {
+	ext := filepath.Ext(path)
+	return strings.TrimSuffix(path, ext) + "." + profile + ext
+}
+
+// ParseProfiles splits a comma separated profile list, dropping blanks and duplicates.
+func ParseProfiles(value string) []string {
+	out := make([]string, 0)
+	seen := map[string]struct{}{}
+	for _, item := range strings.Split(value, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		if _, ok := seen[item]; ok {
+			continue
+		}
+		seen[item] = struct{}{}
+		out = append(out, item)
+	}
+	return out
+}
+
+type profileSource struct {
+	path     string
+	profiles []string
+}
+
+// NewProfileSource creates a source for a base config file layered with its
+// includes and profile overlays.
+//
+// Files are merged in a fixed order: the includes of a file (recursively, in
+// declaration order), then the file itself, then the overlay of every profile
+// in the given order, each overlay being expanded the same way. Later files
+// win under xmap.MergeStringMap semantics. Missing profile overlays are
+// skipped; missing includes and include cycles are errors.
+func NewProfileSource(path string, profiles ...string) source.Source {
+	return &profileSource{path: path, profiles: append([]string(nil), profiles...)}
+}
+
+func (s *profileSource) Kind() string { return "file" }
+
+func (s *profileSource) Name() string { return s.path }
+
+func (s *profileSource) Close() error { return nil }
+
+func (s *profileSource) Read() (source.Data, error) {
+	result, err := readLayeredFile(s.path, nil)
+	if err != nil {
+		return nil, err
+	}
+	for _, profile := range s.profiles {
+		overlay := ProfileFile(s.path, profile)
+		if _, err := os.Stat(overlay); err != nil {
+			if errors.Is(err, os.ErrNotExist) {
+				slog.Warn(
+					"config profile file not found, skipped",
+					slog.String("profile", profile),
+					slog.String("path", overlay),
+				)
+				continue
+			}
+			return nil, fmt.Errorf("stat config profile file %q: %w", overlay, err)
+		}
+		data, err := readLayeredFile(overlay, nil)
+		if err != nil {
+			return nil, err
+		}
+		xmap.MergeStringMap(result, data)
+	}
+	return source.NewMapData(result), nil
+}
+
+func readLayeredFile(path string, stack []string) (map[string]any, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+	for _, item := range stack {
+		if item == abs {
+			return nil, fmt.Errorf(
+				"config include cycle: %s",
+				strings.Join(append(stack, abs), " -> "),
+			)
+		}
+	}
+	stack = append(stack, abs)
+
+	data, err := filesource.NewSource(path, false).Read()
+	if err != nil {
+		return nil, err
+	}
+	current := map[string]any{}
+	if err := data.Unmarshal(&current); err != nil {
+		return nil, fmt.Errorf("parse config file %q: %w", path, err)
+	}
+	includes, err := popIncludes(current)
+	if err != nil {
+		return nil, fmt.Errorf("config file %q: %w", path, err)
+	}
+
+	result := map[string]any{}
+	for _, include := range includes {
+		if !filepath.IsAbs(include) {
+			include = filepath.Join(filepath.Dir(path), include)
+		}
+		included, err := readLayeredFile(include, stack)
+		if err != nil {
+			return nil, err
+		}
+		xmap.MergeStringMap(result, included)
+	}
+	xmap.MergeStringMap(result, current)
+	return result, nil
+}
+
+// popIncludes removes yggdrasil.config.include from a parsed file and returns its entries.
+func popIncludes(root map[string]any) ([]string, error) {
+	ygg, ok := root["yggdrasil"].(map[string]any)
+	if !ok {
+		return nil, nil
+	}
+	cfg, ok := ygg["config"].(map[string]any)
+	if !ok {
+		return nil, nil
+	}
+	raw, ok := cfg[IncludeKey]
+	if !ok {
+		return nil, nil
+	}
+	delete(cfg, IncludeKey)
+
+	var items []any
+	switch value := raw.(type) {
+	case nil:
+		return nil, nil
+	case string:
+		items = []any{value}
+	case []any:
+		items = value
+	default:
+		return nil, fmt.Errorf("yggdrasil.config.%s must be a string or a list", IncludeKey)
+	}
+	out := make([]string, 0, len(items))
+	for i, item := range items {
+		path, ok := item.(string)
+		if !ok || strings.TrimSpace(path) == "" {
+			return nil, fmt.Errorf(
+				"yggdrasil.config.%s[%d] must be a non-empty path",
+				IncludeKey,
+				i,
+			)
+		}
+		out = append(out, strings.TrimSpace(path))
+	}
+	return out, nil
+}
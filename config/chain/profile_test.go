@@ -0,0 +1,119 @@
+// Copyright 2022 The codesjoy Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package chain
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/codesjoy/yggdrasil/v3/config"
+)
+
+func writeConfigFile(t *testing.T, path, content string) {
+	t.Helper()
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+}
+
+func TestProfileFileAndParseProfiles(t *testing.T) {
+	require.Equal(t, "conf/config.dev.yaml", ProfileFile("conf/config.yaml", "dev"))
+	require.Equal(t, "config.prod", ProfileFile("config", "prod"))
+	require.Equal(t, []string{"dev", "local"}, ParseProfiles(" dev, ,local,dev "))
+	require.Empty(t, ParseProfiles(""))
+}
+
+func TestProfileSourceMergeOrder(t *testing.T) {
+	dir := t.TempDir()
+	base := filepath.Join(dir, "config.yaml")
+	writeConfigFile(t, filepath.Join(dir, "common.yaml"),
+		"app:\n  name: common\n  region: eu\n  tier: common\n")
+	writeConfigFile(t, base,
+		"yggdrasil:\n  config:\n    include: [common.yaml]\n"+
+			"app:\n  name: base\n  tier: base\n  port: 8080\n")
+	writeConfigFile(t, filepath.Join(dir, "config.dev.yaml"),
+		"app:\n  tier: dev\n  debug: true\n")
+	writeConfigFile(t, filepath.Join(dir, "config.local.yaml"),
+		"app:\n  debug: false\n")
+
+	manager := config.NewManager()
+	require.NoError(t, manager.LoadLayer(
+		"file", config.PriorityFile, NewProfileSource(base, "dev", "missing", "local"),
+	))
+	app := manager.Section("app").Map()
+	require.Equal(t, "base", app["name"])
+	require.Equal(t, "eu", app["region"])
+	require.Equal(t, "dev", app["tier"])
+	require.Equal(t, false, app["debug"])
+	require.EqualValues(t, 8080, app["port"])
+	require.Nil(t, manager.Section("yggdrasil", "config", "include").Value())
+}
+
+func TestProfileSourceOverlayIncludes(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.Mkdir(filepath.Join(dir, "shared"), 0o700))
+	base := filepath.Join(dir, "config.yaml")
+	writeConfigFile(t, filepath.Join(dir, "shared", "prod.yaml"),
+		"app:\n  replicas: 3\n  tier: shared\n")
+	writeConfigFile(t, base, "app:\n  tier: base\n  replicas: 1\n")
+	writeConfigFile(t, filepath.Join(dir, "config.prod.yaml"),
+		"yggdrasil:\n  config:\n    include: shared/prod.yaml\n"+
+			"app:\n  tier: prod\n")
+
+	data, err := NewProfileSource(base, "prod").Read()
+	require.NoError(t, err)
+	out := map[string]any{}
+	require.NoError(t, data.Unmarshal(&out))
+	app := out["app"].(map[string]any)
+	require.Equal(t, "prod", app["tier"])
+	require.EqualValues(t, 3, app["replicas"])
+}
+
+func TestProfileSourceIncludeErrors(t *testing.T) {
+	dir := t.TempDir()
+	a := filepath.Join(dir, "a.yaml")
+	b := filepath.Join(dir, "b.yaml")
+	writeConfigFile(t, a, "yggdrasil:\n  config:\n    include: [b.yaml]\n")
+	writeConfigFile(t, b, "yggdrasil:\n  config:\n    include: [a.yaml]\n")
+	_, err := NewProfileSource(a).Read()
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "include cycle")
+
+	missing := filepath.Join(dir, "missing.yaml")
+	writeConfigFile(t, missing, "yggdrasil:\n  config:\n    include: [nope.yaml]\n")
+	_, err = NewProfileSource(missing).Read()
+	require.Error(t, err)
+
+	invalid := filepath.Join(dir, "invalid.yaml")
+	writeConfigFile(t, invalid, "yggdrasil:\n  config:\n    include: [1]\n")
+	_, err = NewProfileSource(invalid).Read()
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "non-empty path")
+}
+
+func TestLoaderLoadFileWithProfiles(t *testing.T) {
+	dir := t.TempDir()
+	base := filepath.Join(dir, "config.yaml")
+	writeConfigFile(t, base, "app:\n  name: base\n")
+	writeConfigFile(t, filepath.Join(dir, "config.prod.yaml"), "app:\n  name: prod\n")
+
+	manager := config.NewManager()
+	loaded, ok, err := NewLoader(nil).LoadFile(manager, base, true, "prod")
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.Len(t, loaded, 1)
+	require.Equal(t, "prod", manager.Section("app", "name").Value())
+}
@@ -218,7 +218,10 @@ func buildFlagSource(spec SourceSpec) (source.Source, config.Priority, error) {
 	if err != nil {
 		return nil, 0, err
 	}
-	ignored := append([]string{"yggdrasil-config", "yggdrasil-config-sources"}, cfg.IgnoredNames...)
+	ignored := append(
+		[]string{"yggdrasil-config", "yggdrasil-config-sources", "yggdrasil-profiles"},
+		cfg.IgnoredNames...,
+	)
 	return flagsource.NewSourceWithOptions(
 		nil,
 		flagsource.WithIgnoredNames(ignored...),
@@ -0,0 +1,75 @@
+// Copyright 2022 The codesjoy Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package builtin registers the config structs of the framework subsystems
+// with configdoc.
+package builtin
+
+//go:generate go run ../../../cmd/yggdrasil-configdoc -root ../../.. -o ../../../docs/config-reference.md
+
+import (
+	"sync"
+
+	"github.com/codesjoy/yggdrasil/v3/admin/governor"
+	"github.com/codesjoy/yggdrasil/v3/config"
+	"github.com/codesjoy/yggdrasil/v3/config/configdoc"
+	"github.com/codesjoy/yggdrasil/v3/observability/logger"
+	statsotel "github.com/codesjoy/yggdrasil/v3/observability/stats/otel"
+	"github.com/codesjoy/yggdrasil/v3/transport/gateway/rest"
+	grpcprotocol "github.com/codesjoy/yggdrasil/v3/transport/protocol/grpc"
+	"github.com/codesjoy/yggdrasil/v3/transport/runtime/server"
+)
+
+var once sync.Once
+
+// Register registers the builtin config sections once.
+func Register() {
+	once.Do(func() {
+		configdoc.Register("yggdrasil.server", decoded[server.Settings](nil))
+		configdoc.Register("yggdrasil.transports.grpc.server",
+			decoded(func(cfg *grpcprotocol.ServerConfig) error {
+				if err := cfg.SetDefault(); err != nil {
+					return err
+				}
+				// The default address resolves against the local interfaces.
+				cfg.Address = ""
+				return nil
+			}))
+		configdoc.Register("yggdrasil.transports.grpc.client",
+			decoded[grpcprotocol.ClientConfig](nil))
+		configdoc.Register("yggdrasil.transports.http.rest", decoded[rest.Config](nil))
+		configdoc.Register("yggdrasil.observability.logging", decoded[logger.Settings](nil))
+		configdoc.Register("yggdrasil.observability.telemetry.stats.providers.otel",
+			decoded[statsotel.Config](nil))
+		configdoc.Register(statsotel.TracingConfigPath, decoded[statsotel.TracingConfig](nil))
+		configdoc.Register("yggdrasil.admin.governor", decoded((*governor.Config).SetDefault))
+	})
+}
+
+// decoded returns a constructor of T with its default tags applied,
+// followed by setDefault when not nil.
+func decoded[T any](setDefault func(*T) error) func() (any, error) {
+	return func() (any, error) {
+		var cfg T
+		if err := config.NewSnapshot(nil).Decode(&cfg); err != nil {
+			return nil, err
+		}
+		if setDefault != nil {
+			if err := setDefault(&cfg); err != nil {
+				return nil, err
+			}
+		}
+		return cfg, nil
+	}
+}
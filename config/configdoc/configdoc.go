@@ -0,0 +1,291 @@
+// Copyright 2022 The codesjoy Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package configdoc describes typed config structs by reflection.
+//
+// It walks the mapstructure tags of a struct to list its keys with their
+// types and default values, and flattens a populated struct into its
+// effective values for logging, masking secrets such as passwords and
+// tokens. Subsystems register their config structs with Register so that
+// tools such as cmd/yggdrasil-configdoc can document every section.
+package configdoc
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"reflect"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Mask replaces the values of secret keys.
+const Mask = "***"
+
+// Field documents one leaf key of a config struct.
+type Field struct {
+	// Key is the dotted key path relative to the section.
+	Key string `json:"key"`
+	// Type names the value type, e.g. "string", "duration" or "[]string".
+	Type string `json:"type"`
+	// Default is the value of the key in the documented struct, nil when
+	// the key is unset.
+	Default any `json:"default,omitempty"`
+	// Description is the doc comment of the struct field, if known.
+	Description string `json:"description,omitempty"`
+}
+
+// Section documents the config struct read at a config path.
+type Section struct {
+	Path   string  `json:"path"`
+	Fields []Field `json:"fields"`
+}
+
+var (
+	durationType = reflect.TypeOf(time.Duration(0))
+	timeType     = reflect.TypeOf(time.Time{})
+)
+
+// Describer returns the description of the field named field of the struct
+// type owner, or "" when it has none.
+type Describer func(owner reflect.Type, field string) string
+
+// Fields lists the leaf keys of the struct v, taking each default from the
+// value v holds. Pass v with its defaults applied.
+func Fields(v any) []Field {
+	return DescribedFields(v, nil)
+}
+
+// DescribedFields is Fields with the descriptions returned by describe,
+// which may be nil.
+func DescribedFields(v any, describe Describer) []Field {
+	var fields []Field
+	rv := reflect.ValueOf(v)
+	walk(rv.Type(), rv, "", func(key string, owner reflect.Type, sf reflect.StructField,
+		value reflect.Value) {
+		field := Field{Key: key, Type: typeName(sf.Type)}
+		if !isEmpty(value) {
+			field.Default = plain(key, value)
+		}
+		if describe != nil {
+			field.Description = describe(owner, sf.Name)
+		}
+		fields = append(fields, field)
+	})
+	return fields
+}
+
+// Values flattens the struct v into its leaf keys and values. Secret
+// values are replaced with Mask.
+func Values(v any) map[string]any {
+	values := map[string]any{}
+	rv := reflect.ValueOf(v)
+	walk(rv.Type(), rv, "", func(key string, _ reflect.Type, _ reflect.StructField,
+		value reflect.Value) {
+		if !value.IsValid() {
+			values[key] = nil
+			return
+		}
+		values[key] = plain(key, value)
+	})
+	return values
+}
+
+// Effective wraps the struct v so that slog logs its Values, sorted by key,
+// as a group. The values are only collected when a record is logged.
+func Effective(v any) slog.LogValuer {
+	return effective{v: v}
+}
+
+type effective struct {
+	v any
+}
+
+func (e effective) LogValue() slog.Value {
+	values := Values(e.v)
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	attrs := make([]slog.Attr, 0, len(keys))
+	for _, key := range keys {
+		attrs = append(attrs, slog.Any(key, values[key]))
+	}
+	return slog.GroupValue(attrs...)
+}
+
+// WriteMarkdown writes a table of the fields of each section to w. The
+// table of a section with descriptions gains a Description column.
+func WriteMarkdown(w io.Writer, sections ...Section) error {
+	var b strings.Builder
+	for i, section := range sections {
+		if i > 0 {
+			b.WriteByte('\n')
+		}
+		fmt.Fprintf(&b, "## %s\n\n", section.Path)
+		described := slices.ContainsFunc(section.Fields, func(field Field) bool {
+			return field.Description != ""
+		})
+		if described {
+			b.WriteString("| Key | Type | Default | Description |\n| --- | --- | --- | --- |\n")
+		} else {
+			b.WriteString("| Key | Type | Default |\n| --- | --- | --- |\n")
+		}
+		for _, field := range section.Fields {
+			def := ""
+			if field.Default != nil {
+				data, err := json.Marshal(field.Default)
+				if err != nil {
+					return err
+				}
+				def = "`" + string(data) + "`"
+			}
+			if described {
+				fmt.Fprintf(&b, "| `%s` | %s | %s | %s |\n", field.Key, field.Type, def,
+					strings.ReplaceAll(field.Description, "|", "\\|"))
+				continue
+			}
+			fmt.Fprintf(&b, "| `%s` | %s | %s |\n", field.Key, field.Type, def)
+		}
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// leafFunc receives a leaf key with the struct type declaring it, its
+// struct field and its value.
+type leafFunc func(key string, owner reflect.Type, sf reflect.StructField, v reflect.Value)
+
+// walk calls leaf for each leaf key of the struct type t, with its value in
+// v. The values are invalid when v is invalid or a nil pointer hides them.
+func walk(t reflect.Type, v reflect.Value, prefix string, leaf leafFunc) {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+		if v.IsValid() {
+			v = v.Elem()
+		}
+	}
+	for i := range t.NumField() {
+		sf := t.Field(i)
+		if !sf.IsExported() {
+			continue
+		}
+		name, squash := tagName(sf)
+		if name == "-" {
+			continue
+		}
+		key := prefix
+		if !squash {
+			key = join(prefix, name)
+		}
+		var fv reflect.Value
+		if v.IsValid() {
+			fv = v.Field(i)
+		}
+		if isStruct(sf.Type) {
+			walk(sf.Type, fv, key, leaf)
+			continue
+		}
+		leaf(key, t, sf, fv)
+	}
+}
+
+func isStruct(t reflect.Type) bool {
+	if t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	return t.Kind() == reflect.Struct && t != timeType
+}
+
+// isEmpty reports whether v is unset, zero or an empty map or slice.
+func isEmpty(v reflect.Value) bool {
+	if !v.IsValid() || v.IsZero() {
+		return true
+	}
+	switch v.Kind() {
+	case reflect.Map, reflect.Slice:
+		return v.Len() == 0
+	default:
+		return false
+	}
+}
+
+func tagName(sf reflect.StructField) (name string, squash bool) {
+	tag := sf.Tag.Get("mapstructure")
+	name, opts, _ := strings.Cut(tag, ",")
+	for opt := range strings.SplitSeq(opts, ",") {
+		if opt == "squash" {
+			squash = true
+		}
+	}
+	if sf.Anonymous && name == "" {
+		squash = true
+	}
+	if name == "" {
+		name = strings.ToLower(sf.Name)
+	}
+	return name, squash
+}
+
+func join(prefix, name string) string {
+	if prefix == "" {
+		return name
+	}
+	return prefix + "." + name
+}
+
+func typeName(t reflect.Type) string {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if t == durationType {
+		return "duration"
+	}
+	return t.String()
+}
+
+// plain converts a leaf value to a JSON and log friendly form.
+func plain(key string, v reflect.Value) any {
+	for v.Kind() == reflect.Pointer || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return nil
+		}
+		v = v.Elem()
+	}
+	if isSecret(key) {
+		if v.IsZero() {
+			return ""
+		}
+		return Mask
+	}
+	if v.Type() == durationType {
+		return time.Duration(v.Int()).String()
+	}
+	return v.Interface()
+}
+
+// isSecret reports whether the last segment of key names a credential.
+func isSecret(key string) bool {
+	name := strings.ToLower(key[strings.LastIndexByte(key, '.')+1:])
+	for _, secret := range []string{"password", "token", "secret"} {
+		if name == secret || strings.HasSuffix(name, "_"+secret) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,163 @@
+// Copyright 2022 The codesjoy Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package configdoc
+
+import (
+	"bytes"
+	"errors"
+	"log/slog"
+	"reflect"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Limit is exported so that sample can squash it.
+type Limit struct {
+	Rate  float64 `mapstructure:"rate"`
+	Burst int     `mapstructure:"burst"`
+}
+
+type auth struct {
+	Token    string `mapstructure:"token"`
+	Password string `mapstructure:"password"`
+}
+
+type sample struct {
+	Host    string        `mapstructure:"host"`
+	Timeout time.Duration `mapstructure:"timeout"`
+	Enabled *bool         `mapstructure:"enabled"`
+	Tags    []string      `mapstructure:"tags"`
+	Auth    auth          `mapstructure:"auth"`
+	Quota   *Limit        `mapstructure:"quota"`
+	Limit   `mapstructure:",squash"`
+	Skipped string `mapstructure:"-"`
+	hidden  string
+}
+
+func TestFields(t *testing.T) {
+	fields := Fields(sample{Host: "127.0.0.1", Timeout: time.Second, Auth: auth{Token: "t"}})
+	assert.Equal(t, []Field{
+		{Key: "host", Type: "string", Default: "127.0.0.1"},
+		{Key: "timeout", Type: "duration", Default: "1s"},
+		{Key: "enabled", Type: "bool"},
+		{Key: "tags", Type: "[]string"},
+		{Key: "auth.token", Type: "string", Default: Mask},
+		{Key: "auth.password", Type: "string"},
+		{Key: "quota.rate", Type: "float64"},
+		{Key: "quota.burst", Type: "int"},
+		{Key: "rate", Type: "float64"},
+		{Key: "burst", Type: "int"},
+	}, fields)
+}
+
+func TestValues(t *testing.T) {
+	enabled := true
+	cfg := &sample{
+		Enabled: &enabled,
+		Auth:    auth{Password: "secret"},
+		Quota:   &Limit{Rate: 5},
+	}
+	values := Values(cfg)
+	assert.Equal(t, true, values["enabled"])
+	assert.Equal(t, Mask, values["auth.password"])
+	assert.Equal(t, "", values["auth.token"])
+	assert.Equal(t, 5.0, values["quota.rate"])
+	assert.Equal(t, "0s", values["timeout"])
+	assert.NotContains(t, values, "hidden")
+
+	values = Values(sample{})
+	assert.Nil(t, values["enabled"])
+	assert.Nil(t, values["quota.rate"])
+}
+
+func TestEffective(t *testing.T) {
+	value := Effective(Limit{Rate: 2, Burst: 3}).LogValue()
+	require.Equal(t, slog.KindGroup, value.Kind())
+	attrs := value.Group()
+	require.Len(t, attrs, 2)
+	assert.Equal(t, "burst", attrs[0].Key)
+	assert.Equal(t, "rate", attrs[1].Key)
+}
+
+func TestWriteMarkdown(t *testing.T) {
+	var out bytes.Buffer
+	require.NoError(t, WriteMarkdown(&out, Section{
+		Path:   "yggdrasil.demo",
+		Fields: Fields(Limit{Burst: 4}),
+	}))
+	assert.Equal(t, "## yggdrasil.demo\n\n"+
+		"| Key | Type | Default |\n| --- | --- | --- |\n"+
+		"| `rate` | float64 |  |\n"+
+		"| `burst` | int | `4` |\n", out.String())
+}
+
+func TestWriteMarkdownDescriptions(t *testing.T) {
+	var out bytes.Buffer
+	require.NoError(t, WriteMarkdown(&out, Section{
+		Path: "yggdrasil.demo",
+		Fields: []Field{
+			{Key: "rate", Type: "float64", Description: "Rate is a | b."},
+			{Key: "burst", Type: "int", Default: 4},
+		},
+	}))
+	assert.Equal(t, "## yggdrasil.demo\n\n"+
+		"| Key | Type | Default | Description |\n| --- | --- | --- | --- |\n"+
+		"| `rate` | float64 |  | Rate is a \\| b. |\n"+
+		"| `burst` | int | `4` |  |\n", out.String())
+}
+
+func TestSections(t *testing.T) {
+	Register("test.configdoc.limit", func() (any, error) { return Limit{Rate: 1}, nil })
+	Register("test.configdoc.broken", func() (any, error) { return nil, errors.New("boom") })
+	t.Cleanup(func() {
+		registryMu.Lock()
+		delete(registry, "test.configdoc.limit")
+		delete(registry, "test.configdoc.broken")
+		registryMu.Unlock()
+	})
+	assert.Subset(t, Registered(), []string{"test.configdoc.broken", "test.configdoc.limit"})
+
+	_, err := Sections(nil)
+	require.ErrorContains(t, err, `document config at "test.configdoc.broken": boom`)
+
+	Register("test.configdoc.broken", func() (any, error) { return auth{}, nil })
+	sections, err := Sections(func(owner reflect.Type, field string) string {
+		return owner.Name() + "." + field
+	})
+	require.NoError(t, err)
+	i := slices.IndexFunc(sections, func(s Section) bool { return s.Path == "test.configdoc.limit" })
+	require.GreaterOrEqual(t, i, 0)
+	assert.Equal(t, []Field{
+		{Key: "rate", Type: "float64", Default: 1.0, Description: "Limit.Rate"},
+		{Key: "burst", Type: "int", Description: "Limit.Burst"},
+	}, sections[i].Fields)
+}
+
+func TestSourceDescriber(t *testing.T) {
+	describe, err := SourceDescriber("../..")
+	require.NoError(t, err)
+	assert.Equal(t,
+		"Key is the dotted key path relative to the section.",
+		describe(reflect.TypeOf(Field{}), "Key"))
+	assert.Equal(t, "", describe(reflect.TypeOf(Section{}), "Path"))
+	assert.Equal(t, "", describe(reflect.TypeOf(time.Time{}), "wall"))
+
+	_, err = SourceDescriber(t.TempDir())
+	assert.Error(t, err)
+}
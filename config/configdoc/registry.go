@@ -0,0 +1,73 @@
+// Copyright 2022 The codesjoy Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package configdoc
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+)
+
+var (
+	registryMu sync.RWMutex
+	registry   = map[string]func() (any, error){}
+)
+
+// Register records the config struct read at the config path. newConfig
+// returns the struct with its defaults applied; it is called each time the
+// sections are documented. Registering a path again replaces it.
+func Register(path string, newConfig func() (any, error)) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	registry[path] = newConfig
+}
+
+// Registered returns the registered config paths, sorted.
+func Registered() []string {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	paths := make([]string, 0, len(registry))
+	for path := range registry {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+// Sections documents the registered config structs, sorted by path, with
+// the descriptions returned by describe, which may be nil.
+func Sections(describe Describer) ([]Section, error) {
+	registryMu.RLock()
+	entries := make(map[string]func() (any, error), len(registry))
+	for path, newConfig := range registry {
+		entries[path] = newConfig
+	}
+	registryMu.RUnlock()
+
+	paths := make([]string, 0, len(entries))
+	for path := range entries {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	sections := make([]Section, 0, len(paths))
+	for _, path := range paths {
+		cfg, err := entries[path]()
+		if err != nil {
+			return nil, fmt.Errorf("document config at %q: %w", path, err)
+		}
+		sections = append(sections, Section{Path: path, Fields: DescribedFields(cfg, describe)})
+	}
+	return sections, nil
+}
@@ -0,0 +1,152 @@
+// Copyright 2022 The codesjoy Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package configdoc
+
+import (
+	"errors"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+)
+
+// SourceDescriber returns a Describer reading the doc comments of the
+// struct fields from the Go sources of the module rooted at root. Fields
+// of types declared outside the module have no description.
+func SourceDescriber(root string) (Describer, error) {
+	data, err := os.ReadFile(filepath.Join(root, "go.mod"))
+	if err != nil {
+		return nil, err
+	}
+	module := modulePath(data)
+	if module == "" {
+		return nil, errors.New("go.mod of " + root + " declares no module")
+	}
+	src := &sourceComments{root: root, module: module, packages: map[string]map[string]fieldDocs{}}
+	return src.describe, nil
+}
+
+// modulePath returns the module path declared by the go.mod content data.
+func modulePath(data []byte) string {
+	for line := range strings.Lines(string(data)) {
+		if rest, ok := strings.CutPrefix(strings.TrimSpace(line), "module"); ok {
+			return strings.Trim(strings.TrimSpace(rest), `"`)
+		}
+	}
+	return ""
+}
+
+// fieldDocs maps the field names of a struct type to their doc comments.
+type fieldDocs map[string]string
+
+type sourceComments struct {
+	root   string
+	module string
+
+	mu       sync.Mutex
+	packages map[string]map[string]fieldDocs
+}
+
+func (s *sourceComments) describe(owner reflect.Type, field string) string {
+	for owner.Kind() == reflect.Pointer {
+		owner = owner.Elem()
+	}
+	pkg := owner.PkgPath()
+	dir, ok := strings.CutPrefix(pkg, s.module)
+	if !ok || (dir != "" && !strings.HasPrefix(dir, "/")) {
+		return ""
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	types, ok := s.packages[pkg]
+	if !ok {
+		types = parseFieldDocs(filepath.Join(s.root, filepath.FromSlash(dir)))
+		s.packages[pkg] = types
+	}
+	return types[owner.Name()][field]
+}
+
+// parseFieldDocs collects the field doc comments of the struct types
+// declared in the non-test Go files of dir.
+func parseFieldDocs(dir string) map[string]fieldDocs {
+	types := map[string]fieldDocs{}
+	fset := token.NewFileSet()
+	pkgs, err := parser.ParseDir(fset, dir, func(info fs.FileInfo) bool {
+		return !strings.HasSuffix(info.Name(), "_test.go")
+	}, parser.ParseComments)
+	if err != nil {
+		return types
+	}
+	for _, pkg := range pkgs {
+		for _, file := range pkg.Files {
+			ast.Inspect(file, func(node ast.Node) bool {
+				spec, ok := node.(*ast.TypeSpec)
+				if !ok {
+					return true
+				}
+				st, ok := spec.Type.(*ast.StructType)
+				if !ok {
+					return true
+				}
+				docs := fieldDocs{}
+				for _, field := range st.Fields.List {
+					text := fieldDoc(field)
+					if text == "" {
+						continue
+					}
+					for _, name := range field.Names {
+						docs[name.Name] = text
+					}
+					if len(field.Names) == 0 {
+						docs[embeddedName(field.Type)] = text
+					}
+				}
+				types[spec.Name.Name] = docs
+				return false
+			})
+		}
+	}
+	return types
+}
+
+// fieldDoc joins the lines of the doc or line comment of field.
+func fieldDoc(field *ast.Field) string {
+	group := field.Doc
+	if group == nil {
+		group = field.Comment
+	}
+	if group == nil {
+		return ""
+	}
+	return strings.Join(strings.Fields(group.Text()), " ")
+}
+
+func embeddedName(expr ast.Expr) string {
+	switch t := expr.(type) {
+	case *ast.StarExpr:
+		return embeddedName(t.X)
+	case *ast.SelectorExpr:
+		return t.Sel.Name
+	case *ast.Ident:
+		return t.Name
+	default:
+		return ""
+	}
+}
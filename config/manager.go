@@ -38,6 +38,34 @@ const (
 	PriorityOverride
 )
 
+// String returns the lower-case name of the priority level.
+func (p Priority) String() string {
+	switch p {
+	case PriorityDefaults:
+		return "defaults"
+	case PriorityFile:
+		return "file"
+	case PriorityRemote:
+		return "remote"
+	case PriorityEnv:
+		return "env"
+	case PriorityFlag:
+		return "flag"
+	case PriorityOverride:
+		return "override"
+	default:
+		return "unknown"
+	}
+}
+
+// LayerInfo describes one loaded configuration layer.
+type LayerInfo struct {
+	Name     string `json:"name"`
+	Priority string `json:"priority"`
+	Kind     string `json:"kind"`
+	Source   string `json:"source"`
+}
+
 type layer struct {
 	name     string
 	priority Priority
@@ -278,7 +306,32 @@ func (m *Manager) commitLayer(
 	return prev.src, prev.stop, m.collectNotificationsLocked(oldSnapshot, merged)
 }
 
+// Layers returns the loaded layers from lowest to highest precedence.
+func (m *Manager) Layers() []LayerInfo {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	layers := m.sortedLayersLocked()
+	out := make([]LayerInfo, 0, len(layers))
+	for _, item := range layers {
+		info := LayerInfo{Name: item.name, Priority: item.priority.String()}
+		if item.src != nil {
+			info.Kind = item.src.Kind()
+			info.Source = item.src.Name()
+		}
+		out = append(out, info)
+	}
+	return out
+}
+
 func (m *Manager) mergeLocked() map[string]any {
+	merged := map[string]any{}
+	for _, item := range m.sortedLayersLocked() {
+		merged = tree.MergeMaps(merged, item.data)
+	}
+	return merged
+}
+
+func (m *Manager) sortedLayersLocked() []layer {
 	layers := make([]layer, 0, len(m.order))
 	for _, name := range m.order {
 		item, ok := m.layers[name]
@@ -301,12 +354,7 @@ func (m *Manager) mergeLocked() map[string]any {
 			return 0
 		}
 	})
-
-	merged := map[string]any{}
-	for _, item := range layers {
-		merged = tree.MergeMaps(merged, item.data)
-	}
-	return merged
+	return layers
 }
 
 func (m *Manager) collectNotificationsLocked(prev, next map[string]any) []notification {
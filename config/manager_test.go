@@ -110,6 +110,21 @@ func TestManagerLoadLayerRespectsPriorityAndReplacement(t *testing.T) {
 	require.Equal(t, 10001, cfg.Port)
 }
 
+func TestManagerLayersInPrecedenceOrder(t *testing.T) {
+	manager := NewManager()
+	require.NoError(t, manager.LoadLayer("env", PriorityEnv, &testSource{
+		name: "env", kind: "env", data: source.NewMapData(map[string]any{}),
+	}))
+	require.NoError(t, manager.LoadLayer("file", PriorityFile, &testSource{
+		name: "app.yaml", kind: "file", data: source.NewMapData(map[string]any{}),
+	}))
+
+	require.Equal(t, []LayerInfo{
+		{Name: "file", Priority: "file", Kind: "file", Source: "app.yaml"},
+		{Name: "env", Priority: "env", Kind: "env", Source: "env"},
+	}, manager.Layers())
+}
+
 func TestTypedSectionWatchIsScoped(t *testing.T) {
 	manager := NewManager()
 	type appCfg struct {
@@ -0,0 +1,257 @@
+// Copyright 2022 The codesjoy Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package schema validates config trees against JSON Schemas.
+//
+// It supports the subset of JSON Schema describing config files: type,
+// properties, additionalProperties, required, items, enum, minimum,
+// maximum and pattern. Schemas are parsed from JSON documents or derived
+// from config structs by their mapstructure tags, and registered per
+// config path so that the application validates the merged config at
+// Init.
+package schema
+
+import (
+	"bytes"
+	"encoding"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// JSON types of config values.
+const (
+	TypeObject  = "object"
+	TypeArray   = "array"
+	TypeString  = "string"
+	TypeNumber  = "number"
+	TypeInteger = "integer"
+	TypeBoolean = "boolean"
+	TypeNull    = "null"
+)
+
+// Types is the type keyword, a single type or a list of types.
+type Types []string
+
+// UnmarshalJSON accepts a type name or a list of type names.
+func (t *Types) UnmarshalJSON(data []byte) error {
+	var name string
+	if err := json.Unmarshal(data, &name); err == nil {
+		*t = Types{name}
+		return nil
+	}
+	var names []string
+	if err := json.Unmarshal(data, &names); err != nil {
+		return err
+	}
+	*t = names
+	return nil
+}
+
+// MarshalJSON writes a single type as a name.
+func (t Types) MarshalJSON() ([]byte, error) {
+	if len(t) == 1 {
+		return json.Marshal(t[0])
+	}
+	return json.Marshal([]string(t))
+}
+
+// Schema is a JSON Schema. A nil schema accepts every value.
+type Schema struct {
+	Type                 Types              `json:"type,omitempty"`
+	Description          string             `json:"description,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	AdditionalProperties *Schema            `json:"additionalProperties,omitempty"`
+	Required             []string           `json:"required,omitempty"`
+	Items                *Schema            `json:"items,omitempty"`
+	Enum                 []any              `json:"enum,omitempty"`
+	Minimum              *float64           `json:"minimum,omitempty"`
+	Maximum              *float64           `json:"maximum,omitempty"`
+	Pattern              string             `json:"pattern,omitempty"`
+	// Reject marks the schema rejecting every value, written false in JSON.
+	Reject bool `json:"-"`
+}
+
+// Never returns the schema rejecting every value, e.g. to forbid unknown
+// properties.
+func Never() *Schema {
+	return &Schema{Reject: true}
+}
+
+type plainSchema Schema
+
+// UnmarshalJSON accepts a schema object or the boolean schemas true and
+// false.
+func (s *Schema) UnmarshalJSON(data []byte) error {
+	switch string(bytes.TrimSpace(data)) {
+	case "true":
+		*s = Schema{}
+		return nil
+	case "false":
+		*s = Schema{Reject: true}
+		return nil
+	}
+	return json.Unmarshal(data, (*plainSchema)(s))
+}
+
+// MarshalJSON writes the rejecting schema as false.
+func (s *Schema) MarshalJSON() ([]byte, error) {
+	if s.Reject {
+		return []byte("false"), nil
+	}
+	return json.Marshal((*plainSchema)(s))
+}
+
+// Parse parses a JSON Schema document.
+func Parse(data []byte) (*Schema, error) {
+	s := &Schema{}
+	if err := json.Unmarshal(data, s); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// property returns the schema of the property key. Like the config
+// decoder, it matches names case-insensitively.
+func (s *Schema) property(key string) (*Schema, bool) {
+	if prop, ok := s.Properties[key]; ok {
+		return prop, true
+	}
+	for name, prop := range s.Properties {
+		if strings.EqualFold(name, key) {
+			return prop, true
+		}
+	}
+	return nil, false
+}
+
+var (
+	durationType        = reflect.TypeOf(time.Duration(0))
+	timeType            = reflect.TypeOf(time.Time{})
+	textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+)
+
+// FromStruct derives the schema of the config struct v from its
+// mapstructure tags. Objects reject unknown keys; fields of interface type
+// accept every value and durations accept strings such as "5s".
+func FromStruct(v any) *Schema {
+	t := reflect.TypeOf(v)
+	if t == nil {
+		return nil
+	}
+	return fromType(t, map[reflect.Type]bool{})
+}
+
+func fromType(t reflect.Type, visiting map[reflect.Type]bool) *Schema {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	switch {
+	case t == durationType:
+		return &Schema{Type: Types{TypeString, TypeInteger}}
+	case t == timeType:
+		return &Schema{Type: Types{TypeString}}
+	case reflect.PointerTo(t).Implements(textUnmarshalerType):
+		// Text unmarshalers decode from strings as well as from their kind.
+		s := kindSchema(t, visiting)
+		if s == nil || s.Reject {
+			return nil
+		}
+		if len(s.Type) > 0 && s.Type[0] != TypeString {
+			s.Type = append(Types{TypeString}, s.Type...)
+		}
+		s.Properties, s.AdditionalProperties = nil, nil
+		return s
+	}
+	return kindSchema(t, visiting)
+}
+
+func kindSchema(t reflect.Type, visiting map[reflect.Type]bool) *Schema {
+	switch t.Kind() {
+	case reflect.Bool:
+		return &Schema{Type: Types{TypeBoolean}}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return &Schema{Type: Types{TypeInteger}}
+	case reflect.Float32, reflect.Float64:
+		return &Schema{Type: Types{TypeNumber}}
+	case reflect.String:
+		return &Schema{Type: Types{TypeString}}
+	case reflect.Slice, reflect.Array:
+		return &Schema{Type: Types{TypeArray}, Items: fromType(t.Elem(), visiting)}
+	case reflect.Map:
+		return &Schema{Type: Types{TypeObject}, AdditionalProperties: fromType(t.Elem(), visiting)}
+	case reflect.Struct:
+		if visiting[t] {
+			return nil
+		}
+		visiting[t] = true
+		defer delete(visiting, t)
+		s := &Schema{
+			Type:                 Types{TypeObject},
+			Properties:           map[string]*Schema{},
+			AdditionalProperties: Never(),
+		}
+		addFields(s, t, visiting)
+		return s
+	default:
+		return nil
+	}
+}
+
+// addFields adds the properties of the fields of the struct type t to s,
+// squashing embedded structs.
+func addFields(s *Schema, t reflect.Type, visiting map[reflect.Type]bool) {
+	for i := range t.NumField() {
+		sf := t.Field(i)
+		if !sf.IsExported() {
+			continue
+		}
+		name, squash, remain := tagName(sf)
+		switch {
+		case name == "-":
+			continue
+		case remain:
+			s.AdditionalProperties = nil
+			continue
+		case squash:
+			ft := sf.Type
+			for ft.Kind() == reflect.Pointer {
+				ft = ft.Elem()
+			}
+			if ft.Kind() == reflect.Struct {
+				addFields(s, ft, visiting)
+				continue
+			}
+		}
+		s.Properties[name] = fromType(sf.Type, visiting)
+	}
+}
+
+func tagName(sf reflect.StructField) (name string, squash, remain bool) {
+	name, opts, _ := strings.Cut(sf.Tag.Get("mapstructure"), ",")
+	for opt := range strings.SplitSeq(opts, ",") {
+		switch opt {
+		case "squash":
+			squash = true
+		case "remain":
+			remain = true
+		}
+	}
+	if name == "" {
+		name = sf.Name
+	}
+	return name, squash, remain
+}
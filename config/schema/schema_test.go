@@ -0,0 +1,97 @@
+// Copyright 2022 The codesjoy Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package schema
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type level int
+
+func (l *level) UnmarshalText([]byte) error { return nil }
+
+type Common struct {
+	Name string `mapstructure:"name"`
+}
+
+type node struct {
+	Children []node `mapstructure:"children"`
+}
+
+type sample struct {
+	Common  `mapstructure:",squash"`
+	Port    int               `mapstructure:"port"`
+	Timeout time.Duration     `mapstructure:"timeout"`
+	Level   level             `mapstructure:"level"`
+	Tags    []string          `mapstructure:"tags"`
+	Labels  map[string]string `mapstructure:"labels"`
+	Extra   any               `mapstructure:"extra"`
+	Tree    *node             `mapstructure:"tree"`
+	Skipped string            `mapstructure:"-"`
+	hidden  string
+}
+
+func TestFromStruct(t *testing.T) {
+	s := FromStruct(sample{})
+	require.NotNil(t, s)
+	assert.Equal(t, Types{TypeObject}, s.Type)
+	assert.True(t, s.AdditionalProperties.Reject)
+	assert.ElementsMatch(t,
+		[]string{"name", "port", "timeout", "level", "tags", "labels", "extra", "tree"},
+		keys(s.Properties))
+	assert.Equal(t, Types{TypeInteger}, s.Properties["port"].Type)
+	assert.Equal(t, Types{TypeString, TypeInteger}, s.Properties["timeout"].Type)
+	assert.Equal(t, Types{TypeString, TypeInteger}, s.Properties["level"].Type)
+	assert.Equal(t, Types{TypeString}, s.Properties["tags"].Items.Type)
+	assert.Equal(t, Types{TypeString}, s.Properties["labels"].AdditionalProperties.Type)
+	assert.Nil(t, s.Properties["extra"])
+	assert.Nil(t, s.Properties["tree"].Properties["children"].Items, "recursion stops")
+}
+
+func TestParse(t *testing.T) {
+	s, err := Parse([]byte(`{
+		"type": "object",
+		"properties": {
+			"mode": {"type": "string", "enum": ["a", "b"]},
+			"size": {"type": ["integer", "string"], "minimum": 1}
+		},
+		"required": ["mode"],
+		"additionalProperties": false
+	}`))
+	require.NoError(t, err)
+	assert.Equal(t, Types{TypeInteger, TypeString}, s.Properties["size"].Type)
+	assert.True(t, s.AdditionalProperties.Reject)
+
+	data, err := json.Marshal(s)
+	require.NoError(t, err)
+	assert.Contains(t, string(data), `"additionalProperties":false`)
+	assert.Contains(t, string(data), `"type":"object"`)
+
+	_, err = Parse([]byte(`{"type": 1}`))
+	assert.Error(t, err)
+}
+
+func keys(m map[string]*Schema) []string {
+	out := make([]string, 0, len(m))
+	for key := range m {
+		out = append(out, key)
+	}
+	return out
+}
@@ -0,0 +1,308 @@
+// Copyright 2022 The codesjoy Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package schema
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Violation is one config value failing its schema.
+type Violation struct {
+	// Path is the dotted key path of the value, e.g. "yggdrasil.remte".
+	Path    string
+	Message string
+}
+
+func (v Violation) String() string {
+	return v.Path + ": " + v.Message
+}
+
+// Error aggregates the violations of a config tree.
+type Error struct {
+	Violations []Violation
+}
+
+func (e *Error) Error() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "config validation failed with %d violation(s)", len(e.Violations))
+	for _, v := range e.Violations {
+		b.WriteString("\n  ")
+		b.WriteString(v.String())
+	}
+	return b.String()
+}
+
+// Validate validates value found at path against s and returns the
+// violations, sorted by path.
+func (s *Schema) Validate(path string, value any) []Violation {
+	v := &validator{}
+	v.validate(s, path, value)
+	v.sort()
+	return v.violations
+}
+
+type validator struct {
+	// known lists the paths accepted as unknown properties, such as the
+	// config paths of installed modules.
+	known      []string
+	violations []Violation
+}
+
+func (v *validator) add(path, format string, args ...any) {
+	v.violations = append(v.violations, Violation{Path: path, Message: fmt.Sprintf(format, args...)})
+}
+
+func (v *validator) sort() {
+	sort.SliceStable(v.violations, func(i, j int) bool {
+		return v.violations[i].Path < v.violations[j].Path
+	})
+}
+
+func (v *validator) validate(s *Schema, path string, value any) {
+	if s == nil {
+		return
+	}
+	if s.Reject {
+		v.add(path, "unknown key")
+		return
+	}
+	if value == nil {
+		// The config decoder leaves the targets of null values untouched.
+		return
+	}
+	if len(s.Type) > 0 && !slices.ContainsFunc(s.Type, func(t string) bool {
+		return hasType(value, t)
+	}) {
+		v.add(path, "expected %s, got %s", strings.Join(s.Type, " or "), typeOf(value))
+		return
+	}
+	if len(s.Enum) > 0 && !slices.ContainsFunc(s.Enum, func(item any) bool {
+		return equal(item, value)
+	}) {
+		v.add(path, "value %v is not one of %v", value, s.Enum)
+	}
+	if n, ok := number(value); ok {
+		if s.Minimum != nil && n < *s.Minimum {
+			v.add(path, "value %v is less than the minimum %v", value, *s.Minimum)
+		}
+		if s.Maximum != nil && n > *s.Maximum {
+			v.add(path, "value %v is greater than the maximum %v", value, *s.Maximum)
+		}
+	}
+	if str, ok := value.(string); ok && s.Pattern != "" {
+		re, err := regexp.Compile(s.Pattern)
+		switch {
+		case err != nil:
+			v.add(path, "invalid pattern %q: %v", s.Pattern, err)
+		case !re.MatchString(str):
+			v.add(path, "value %q does not match the pattern %q", str, s.Pattern)
+		}
+	}
+	switch value := value.(type) {
+	case map[string]any:
+		v.validateObject(s, path, value)
+	case []any:
+		if s.Items != nil {
+			for i, item := range value {
+				v.validate(s.Items, fmt.Sprintf("%s[%d]", path, i), item)
+			}
+		}
+	}
+}
+
+func (v *validator) validateObject(s *Schema, path string, value map[string]any) {
+	for _, name := range s.Required {
+		if _, ok := lookup(value, name); !ok {
+			v.add(join(path, name), "required key is missing")
+		}
+	}
+	for key, item := range value {
+		child := join(path, key)
+		if prop, ok := s.property(key); ok {
+			v.validate(prop, child, item)
+			continue
+		}
+		if s.AdditionalProperties != nil && s.AdditionalProperties.Reject && v.isKnown(child) {
+			continue
+		}
+		v.validate(s.AdditionalProperties, child, item)
+	}
+}
+
+// isKnown reports whether path is a known path or leads to one.
+func (v *validator) isKnown(path string) bool {
+	for _, known := range v.known {
+		if strings.EqualFold(known, path) ||
+			len(known) > len(path) && strings.EqualFold(known[:len(path)+1], path+".") {
+			return true
+		}
+	}
+	return false
+}
+
+func hasType(value any, t string) bool {
+	switch t {
+	case TypeObject:
+		_, ok := value.(map[string]any)
+		return ok
+	case TypeArray:
+		_, ok := value.([]any)
+		return ok
+	case TypeString:
+		_, ok := value.(string)
+		return ok
+	case TypeBoolean:
+		_, ok := value.(bool)
+		return ok
+	case TypeNull:
+		return value == nil
+	case TypeNumber:
+		_, ok := number(value)
+		return ok
+	case TypeInteger:
+		n, ok := number(value)
+		return ok && n == math.Trunc(n)
+	default:
+		return false
+	}
+}
+
+func number(value any) (float64, bool) {
+	rv := reflect.ValueOf(value)
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(rv.Int()), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(rv.Uint()), true
+	case reflect.Float32, reflect.Float64:
+		return rv.Float(), true
+	default:
+		return 0, false
+	}
+}
+
+func typeOf(value any) string {
+	for _, t := range []string{TypeNull, TypeObject, TypeArray, TypeString, TypeBoolean, TypeInteger,
+		TypeNumber} {
+		if hasType(value, t) {
+			return t
+		}
+	}
+	return fmt.Sprintf("%T", value)
+}
+
+func equal(left, right any) bool {
+	ln, lok := number(left)
+	rn, rok := number(right)
+	if lok && rok {
+		return ln == rn
+	}
+	return reflect.DeepEqual(left, right)
+}
+
+func join(prefix, key string) string {
+	if prefix == "" {
+		return key
+	}
+	return prefix + "." + key
+}
+
+var (
+	registryMu sync.RWMutex
+	registry   = map[string]*Schema{}
+)
+
+// Register registers the schema of the config read at the dotted path.
+// Registering a path again replaces its schema.
+func Register(path string, s *Schema) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	registry[path] = s
+}
+
+// RegisterStruct registers the schema derived from the config struct v.
+func RegisterStruct(path string, v any) {
+	Register(path, FromStruct(v))
+}
+
+// Registered returns a copy of the registered schemas by path.
+func Registered() map[string]*Schema {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	out := make(map[string]*Schema, len(registry))
+	for path, s := range registry {
+		out[path] = s
+	}
+	return out
+}
+
+// ValidateTree validates the config tree against the schemas by path and
+// returns an *Error listing every violation, or nil. Keys rejected as
+// unknown are accepted when their path is one of known or of the schema
+// paths, or leads to one: they belong to another config reader.
+func ValidateTree(tree map[string]any, schemas map[string]*Schema, known ...string) error {
+	v := &validator{known: slices.Clone(known)}
+	paths := make([]string, 0, len(schemas))
+	for path := range schemas {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	v.known = append(v.known, paths...)
+	for _, path := range paths {
+		value, ok := lookup(tree, path)
+		if !ok {
+			continue
+		}
+		v.validate(schemas[path], path, value)
+	}
+	if len(v.violations) == 0 {
+		return nil
+	}
+	v.sort()
+	return &Error{Violations: v.violations}
+}
+
+// lookup returns the value at the dotted path of tree, matching keys
+// case-insensitively.
+func lookup(tree map[string]any, path string) (any, bool) {
+	var value any = tree
+	for key := range strings.SplitSeq(path, ".") {
+		m, ok := value.(map[string]any)
+		if !ok {
+			return nil, false
+		}
+		if value, ok = m[key]; ok {
+			continue
+		}
+		found := false
+		for name, item := range m {
+			if strings.EqualFold(name, key) {
+				value, found = item, true
+				break
+			}
+		}
+		if !found {
+			return nil, false
+		}
+	}
+	return value, true
+}
@@ -0,0 +1,93 @@
+// Copyright 2022 The codesjoy Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package schema
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSchemaValidate(t *testing.T) {
+	minimum, maximum := 1.0, 10.0
+	s := &Schema{
+		Type: Types{TypeObject},
+		Properties: map[string]*Schema{
+			"mode":  {Type: Types{TypeString}, Enum: []any{"a", "b"}},
+			"size":  {Type: Types{TypeInteger}, Minimum: &minimum, Maximum: &maximum},
+			"name":  {Type: Types{TypeString}, Pattern: "^[a-z]+$"},
+			"tags":  {Type: Types{TypeArray}, Items: &Schema{Type: Types{TypeString}}},
+			"extra": nil,
+		},
+		Required:             []string{"mode", "name"},
+		AdditionalProperties: Never(),
+	}
+
+	assert.Empty(t, s.Validate("cfg", map[string]any{
+		"MODE": "a", "size": 3.0, "name": "ok", "tags": nil, "extra": 1,
+	}))
+	assert.Equal(t, []Violation{
+		{Path: "cfg.mode", Message: "value c is not one of [a b]"},
+		{Path: "cfg.name", Message: "required key is missing"},
+		{Path: "cfg.size", Message: "expected integer, got number"},
+		{Path: "cfg.tags[1]", Message: "expected string, got boolean"},
+		{Path: "cfg.typo", Message: "unknown key"},
+	}, s.Validate("cfg", map[string]any{
+		"mode": "c", "size": 2.5, "tags": []any{"x", true}, "typo": 1,
+	}))
+	assert.Equal(t, []Violation{
+		{Path: "cfg.name", Message: `value "Bad" does not match the pattern "^[a-z]+$"`},
+		{Path: "cfg.size", Message: "value 11 is greater than the maximum 10"},
+	}, s.Validate("cfg", map[string]any{"mode": "b", "size": 11, "name": "Bad"}))
+}
+
+func TestValidateTree(t *testing.T) {
+	Register("test.schema.section", FromStruct(struct {
+		Protocol string `mapstructure:"protocol"`
+	}{}))
+	t.Cleanup(func() {
+		registryMu.Lock()
+		delete(registry, "test.schema.section")
+		registryMu.Unlock()
+	})
+	schemas := Registered()
+	schemas["test"] = &Schema{
+		Type:                 Types{TypeObject},
+		Properties:           map[string]*Schema{"mode": {Type: Types{TypeString}}},
+		AdditionalProperties: Never(),
+	}
+
+	tree := map[string]any{
+		"test": map[string]any{
+			"mode":   "x",
+			"schema": map[string]any{"section": map[string]any{"protocol": 1}},
+			"module": map[string]any{"anything": true},
+			"remte":  map[string]any{"protocol": "grpc"},
+		},
+	}
+	err := ValidateTree(tree, schemas, "test.module")
+	var schemaErr *Error
+	require.ErrorAs(t, err, &schemaErr)
+	assert.Equal(t, []Violation{
+		{Path: "test.remte", Message: "unknown key"},
+		{Path: "test.schema.section.protocol", Message: "expected string, got integer"},
+	}, schemaErr.Violations)
+	assert.Equal(t, "config validation failed with 2 violation(s)\n"+
+		"  test.remte: unknown key\n"+
+		"  test.schema.section.protocol: expected string, got integer", err.Error())
+
+	assert.NoError(t, ValidateTree(map[string]any{"other": 1}, schemas))
+}
@@ -141,6 +141,7 @@ func NewSource(pre, sp []string, opts ...Option) source.Source {
 		strippedPrefixes: sp,
 		ignoredKeys: map[string]struct{}{
 			"yggdrasil_config_sources": {},
+			"yggdrasil_profiles":       {},
 		},
 		delimiter: "_",
 		name:      strings.Join(pre, "_"),
@@ -133,7 +133,10 @@ func (f *file) Watch() (<-chan source.Data, error) {
 	f.fw = fw
 	change := make(chan source.Data, 1)
 	xgo.Go(func() {
-		defer close(change)
+		defer func() {
+			_ = fw.Close()
+			close(change)
+		}()
 		for {
 			chg, err := f.watch()
 			if err != nil {
@@ -20,11 +20,58 @@ import (
 	"fmt"
 	"os"
 	"regexp"
+	"strings"
+	"sync"
 )
 
-var envPlaceholderRegexp = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+// placeholderRegexp matches ${NAME}, ${NAME:default} and the escaped form $${NAME}.
+var placeholderRegexp = regexp.MustCompile(
+	`\$?\$\{([A-Za-z_][A-Za-z0-9_.-]*)(?::([^}]*))?\}`,
+)
+
+var (
+	variablesMu sync.RWMutex
+	variables   = map[string]string{}
+)
+
+// SetVariables replaces the process-wide variables resolvable by placeholders,
+// such as app.name or app.zone. Variables take precedence over environment
+// variables of the same name.
+func SetVariables(vars map[string]string) {
+	next := make(map[string]string, len(vars))
+	for key, value := range vars {
+		next[key] = value
+	}
+	variablesMu.Lock()
+	variables = next
+	variablesMu.Unlock()
+}
+
+// Variables returns a copy of the variables installed by SetVariables.
+func Variables() map[string]string {
+	variablesMu.RLock()
+	defer variablesMu.RUnlock()
+	out := make(map[string]string, len(variables))
+	for key, value := range variables {
+		out[key] = value
+	}
+	return out
+}
 
-// ExpandEnvPlaceholders replaces ${VAR} placeholders with environment values.
+func lookupVariable(name string) (string, bool) {
+	variablesMu.RLock()
+	value, ok := variables[name]
+	variablesMu.RUnlock()
+	if ok {
+		return value, true
+	}
+	return os.LookupEnv(name)
+}
+
+// ExpandEnvPlaceholders replaces placeholders with variable or environment values.
+//
+// ${NAME} fails when NAME is not set, ${NAME:default} falls back to default,
+// and $${NAME} is kept as the literal text ${NAME}.
 func ExpandEnvPlaceholders(scope string, data []byte) ([]byte, error) {
 	if len(data) == 0 || !bytes.Contains(data, []byte("${")) {
 		return data, nil
@@ -34,23 +81,33 @@ func ExpandEnvPlaceholders(scope string, data []byte) ([]byte, error) {
 	}
 
 	var missing string
-	result := envPlaceholderRegexp.ReplaceAllStringFunc(string(data), func(match string) string {
+	result := placeholderRegexp.ReplaceAllStringFunc(string(data), func(match string) string {
+		if strings.HasPrefix(match, "$$") {
+			return match[1:]
+		}
 		if missing != "" {
 			return match
 		}
 
-		name := envPlaceholderRegexp.FindStringSubmatch(match)[1]
-		value, ok := os.LookupEnv(name)
-		if !ok {
-			missing = name
-			return match
+		groups := placeholderRegexp.FindStringSubmatch(match)
+		if value, ok := lookupVariable(groups[1]); ok {
+			return value
 		}
-		return value
+		if strings.Contains(match, ":") {
+			return groups[2]
+		}
+		missing = groups[1]
+		return match
 	})
 	if missing != "" {
+		kind := "environment variable"
+		if strings.Contains(missing, ".") {
+			kind = "variable"
+		}
 		return nil, fmt.Errorf(
-			"expand env placeholders for %s: missing environment variable %q",
+			"expand env placeholders for %s: missing %s %q",
 			scope,
+			kind,
 			missing,
 		)
 	}
@@ -58,7 +115,7 @@ func ExpandEnvPlaceholders(scope string, data []byte) ([]byte, error) {
 	return []byte(result), nil
 }
 
-// ExpandEnvPlaceholdersInValue replaces ${VAR} placeholders inside string values.
+// ExpandEnvPlaceholdersInValue replaces placeholders inside string values.
 func ExpandEnvPlaceholdersInValue(scope string, value any) (any, error) {
 	switch item := value.(type) {
 	case string:
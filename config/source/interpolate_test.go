@@ -37,6 +37,40 @@ func TestExpandEnvPlaceholders(t *testing.T) {
 	require.Contains(t, err.Error(), `missing environment variable "MISSING"`)
 }
 
+func TestExpandEnvPlaceholdersDefaultsAndEscaping(t *testing.T) {
+	t.Setenv("APP_NAME", "demo")
+	t.Setenv("EMPTY", "")
+
+	out, err := ExpandEnvPlaceholders("cfg", []byte(
+		`a=${APP_NAME:fallback},b=${MISSING:fallback},c=${MISSING:},d=${EMPTY:x},`+
+			`e=${ADDR:http://127.0.0.1:80},f=$${APP_NAME},g=$${MISSING}`,
+	))
+	require.NoError(t, err)
+	require.Equal(
+		t,
+		"a=demo,b=fallback,c=,d=,e=http://127.0.0.1:80,f=${APP_NAME},g=${MISSING}",
+		string(out),
+	)
+}
+
+func TestExpandEnvPlaceholdersVariables(t *testing.T) {
+	previous := Variables()
+	t.Cleanup(func() { SetVariables(previous) })
+	t.Setenv("app.zone", "from-env")
+
+	SetVariables(map[string]string{"app.name": "demo", "app.zone": "az1"})
+	out, err := ExpandEnvPlaceholders(
+		"cfg",
+		[]byte(`/var/log/${app.name}/${app.zone}/${app.region:default}.log`),
+	)
+	require.NoError(t, err)
+	require.Equal(t, "/var/log/demo/az1/default.log", string(out))
+
+	_, err = ExpandEnvPlaceholders("cfg", []byte(`${app.campus}`))
+	require.Error(t, err)
+	require.Contains(t, err.Error(), `missing variable "app.campus"`)
+}
+
 func TestExpandEnvPlaceholdersInValue(t *testing.T) {
 	t.Setenv("APP_NAME", "demo")
 	t.Setenv("APP_ENV", "prod")
@@ -0,0 +1,85 @@
+// Copyright 2022 The codesjoy Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package etcd adapts the etcd client to the framework's distributed locks.
+package etcd
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"go.etcd.io/etcd/api/v3/v3rpc/rpctypes"
+	clientv3 "go.etcd.io/etcd/client/v3"
+
+	"github.com/codesjoy/yggdrasil/v3/lock"
+)
+
+// LockStore returns a distributed lock store keeping its locks in client
+// under prefix.
+func LockStore(client *clientv3.Client, prefix string) lock.Store {
+	return lock.NewEtcdStore(LockClient(client), prefix)
+}
+
+// LockClient adapts client to the operations used by the etcd lock store.
+func LockClient(client *clientv3.Client) lock.EtcdClient {
+	return lockClient{client: client}
+}
+
+type lockClient struct {
+	client *clientv3.Client
+}
+
+func (c lockClient) Grant(ctx context.Context, ttl time.Duration) (int64, error) {
+	seconds := int64((ttl + time.Second - 1) / time.Second)
+	resp, err := c.client.Grant(ctx, max(seconds, 1))
+	if err != nil {
+		return 0, err
+	}
+	return int64(resp.ID), nil
+}
+
+func (c lockClient) KeepAliveOnce(ctx context.Context, lease int64) (bool, error) {
+	resp, err := c.client.KeepAliveOnce(ctx, clientv3.LeaseID(lease))
+	if errors.Is(err, rpctypes.ErrLeaseNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return resp.TTL > 0, nil
+}
+
+func (c lockClient) Revoke(ctx context.Context, lease int64) error {
+	_, err := c.client.Revoke(ctx, clientv3.LeaseID(lease))
+	if errors.Is(err, rpctypes.ErrLeaseNotFound) {
+		return nil
+	}
+	return err
+}
+
+func (c lockClient) CreateIfAbsent(
+	ctx context.Context,
+	key, value string,
+	lease int64,
+) (bool, error) {
+	resp, err := c.client.Txn(ctx).
+		If(clientv3.Compare(clientv3.CreateRevision(key), "=", 0)).
+		Then(clientv3.OpPut(key, value, clientv3.WithLease(clientv3.LeaseID(lease)))).
+		Commit()
+	if err != nil {
+		return false, err
+	}
+	return resp.Succeeded, nil
+}
@@ -0,0 +1,87 @@
+// Copyright 2022 The codesjoy Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package etcd
+
+import (
+	"context"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	clientv3 "go.etcd.io/etcd/client/v3"
+	"go.etcd.io/etcd/server/v3/embed"
+
+	"github.com/codesjoy/yggdrasil/v3/lock"
+)
+
+func startEtcd(t *testing.T) *clientv3.Client {
+	t.Helper()
+	cfg := embed.NewConfig()
+	cfg.Dir = t.TempDir()
+	cfg.LogLevel = "error"
+	local := []url.URL{{Scheme: "http", Host: "127.0.0.1:0"}}
+	cfg.ListenClientUrls, cfg.AdvertiseClientUrls = local, local
+	peer := []url.URL{{Scheme: "http", Host: "127.0.0.1:0"}}
+	cfg.ListenPeerUrls, cfg.AdvertisePeerUrls = peer, peer
+	cfg.InitialCluster = cfg.Name + "=" + peer[0].String()
+	server, err := embed.StartEtcd(cfg)
+	require.NoError(t, err)
+	t.Cleanup(server.Close)
+	select {
+	case <-server.Server.ReadyNotify():
+	case <-time.After(10 * time.Second):
+		t.Fatal("etcd did not start")
+	}
+	client, err := clientv3.New(clientv3.Config{
+		Endpoints:   []string{server.Clients[0].Addr().String()},
+		DialTimeout: 5 * time.Second,
+	})
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = client.Close() })
+	return client
+}
+
+func TestLockStore(t *testing.T) {
+	client := startEtcd(t)
+	ctx := context.Background()
+	locker := lock.New(LockStore(client, "/locks/"))
+
+	lease, ok, err := locker.TryLock(ctx, "job", 3*time.Second)
+	require.NoError(t, err)
+	require.True(t, ok)
+	_, ok, err = locker.TryLock(ctx, "job", 3*time.Second)
+	require.NoError(t, err)
+	assert.False(t, ok)
+
+	resp, err := client.Get(ctx, "/locks/job")
+	require.NoError(t, err)
+	require.Len(t, resp.Kvs, 1)
+	assert.NotZero(t, resp.Kvs[0].Lease)
+
+	require.NoError(t, lease.Release(ctx))
+	resp, err = client.Get(ctx, "/locks/job")
+	require.NoError(t, err)
+	assert.Empty(t, resp.Kvs)
+}
+
+func TestLockClientReportsMissingLease(t *testing.T) {
+	client := LockClient(startEtcd(t))
+	ok, err := client.KeepAliveOnce(context.Background(), 12345)
+	require.NoError(t, err)
+	assert.False(t, ok)
+	assert.NoError(t, client.Revoke(context.Background(), 12345))
+}
@@ -0,0 +1,153 @@
+// Copyright 2022 The codesjoy Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package redis
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	goredis "github.com/redis/go-redis/v9"
+
+	"github.com/codesjoy/yggdrasil/v3/lock"
+	"github.com/codesjoy/yggdrasil/v3/operations"
+	"github.com/codesjoy/yggdrasil/v3/rpc/interceptor/dedupe"
+	"github.com/codesjoy/yggdrasil/v3/rpc/interceptor/idempotency"
+	"github.com/codesjoy/yggdrasil/v3/rpc/interceptor/ratelimit"
+)
+
+// IdempotencyClient adapts client to the command set used by the
+// idempotency interceptor's Redis store.
+func IdempotencyClient(client goredis.UniversalClient) idempotency.RedisClient {
+	return keyClient{client: client}
+}
+
+// DedupeClient adapts client to the command set used by the dedupe
+// interceptor's Redis store.
+func DedupeClient(client goredis.UniversalClient) dedupe.RedisClient {
+	return keyClient{client: client}
+}
+
+// keyClient implements the string key commands shared by the Redis stores.
+type keyClient struct {
+	client goredis.UniversalClient
+}
+
+func (c keyClient) SetNX(
+	ctx context.Context,
+	key, value string,
+	ttl time.Duration,
+) (bool, error) {
+	return c.client.SetNX(ctx, key, value, ttl).Result()
+}
+
+func (c keyClient) Get(ctx context.Context, key string) (string, bool, error) {
+	value, err := c.client.Get(ctx, key).Result()
+	if errors.Is(err, goredis.Nil) {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, err
+	}
+	return value, true, nil
+}
+
+func (c keyClient) Set(ctx context.Context, key, value string, ttl time.Duration) error {
+	return c.client.Set(ctx, key, value, ttl).Err()
+}
+
+func (c keyClient) Del(ctx context.Context, key string) error {
+	return c.client.Del(ctx, key).Err()
+}
+
+// OperationsClient adapts client to the command set used by the Redis store
+// of long-running operations.
+func OperationsClient(client goredis.UniversalClient) operations.RedisClient {
+	return operationsClient{keyClient: keyClient{client: client}}
+}
+
+type operationsClient struct {
+	keyClient
+}
+
+// compareAndSetScript sets KEYS[1] to ARGV[2] if it still holds ARGV[1],
+// expiring it after ARGV[3] milliseconds unless that is zero.
+var compareAndSetScript = goredis.NewScript(`
+if redis.call("GET", KEYS[1]) ~= ARGV[1] then
+	return 0
+end
+if tonumber(ARGV[3]) > 0 then
+	redis.call("SET", KEYS[1], ARGV[2], "PX", ARGV[3])
+else
+	redis.call("SET", KEYS[1], ARGV[2])
+end
+return 1
+`)
+
+func (c operationsClient) CompareAndSet(
+	ctx context.Context,
+	key, old, value string,
+	ttl time.Duration,
+) (bool, error) {
+	return compareAndSetScript.Run(
+		ctx, c.client, []string{key}, old, value, ttl.Milliseconds(),
+	).Bool()
+}
+
+func (c operationsClient) ZAdd(
+	ctx context.Context,
+	key string,
+	score float64,
+	member string,
+) error {
+	return c.client.ZAddNX(ctx, key, goredis.Z{Score: score, Member: member}).Err()
+}
+
+func (c operationsClient) ZRem(ctx context.Context, key, member string) error {
+	return c.client.ZRem(ctx, key, member).Err()
+}
+
+func (c operationsClient) ZRange(
+	ctx context.Context,
+	key string,
+	start, stop int64,
+) ([]string, error) {
+	return c.client.ZRange(ctx, key, start, stop).Result()
+}
+
+// RateLimitScripter adapts client to the script runner used by the rate
+// limit interceptor's Redis limiter.
+func RateLimitScripter(client goredis.UniversalClient) ratelimit.RedisScripter {
+	return scripter{client: client}
+}
+
+type scripter struct {
+	client goredis.UniversalClient
+}
+
+func (s scripter) Eval(
+	ctx context.Context,
+	script string,
+	keys []string,
+	args ...any,
+) (any, error) {
+	return goredis.NewScript(script).Run(ctx, s.client, keys, args...).Result()
+}
+
+// LockStore returns a distributed lock store keeping its locks in client
+// under prefix.
+func LockStore(client goredis.UniversalClient, prefix string) lock.Store {
+	return lock.NewRedisStore(scripter{client: client}, prefix)
+}
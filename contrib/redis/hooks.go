@@ -0,0 +1,233 @@
+// Copyright 2022 The codesjoy Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package redis
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	goredis "github.com/redis/go-redis/v9"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/metric/noop"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const instrumentationName = "github.com/codesjoy/yggdrasil/v3"
+
+// hook traces commands, records their duration and logs slow ones.
+type hook struct {
+	name      string
+	addrs     string
+	threshold time.Duration
+	tracer    trace.Tracer
+	duration  metric.Float64Histogram
+}
+
+func newHook(name string, addrs []string, threshold time.Duration) *hook {
+	meter := otel.GetMeterProvider().Meter(instrumentationName,
+		metric.WithInstrumentationVersion("yggdrasil"),
+	)
+	duration, err := meter.Float64Histogram("db.client.operation.duration",
+		metric.WithDescription("Duration of Redis commands."),
+		metric.WithUnit("s"))
+	if err != nil {
+		otel.Handle(err)
+		duration = noop.Float64Histogram{}
+	}
+	return &hook{
+		name:      name,
+		addrs:     strings.Join(addrs, ","),
+		threshold: threshold,
+		tracer: otel.GetTracerProvider().Tracer(instrumentationName,
+			trace.WithInstrumentationVersion("yggdrasil"),
+		),
+		duration: duration,
+	}
+}
+
+func (h *hook) DialHook(next goredis.DialHook) goredis.DialHook {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		ctx, span := h.tracer.Start(ctx, "redis.dial",
+			trace.WithSpanKind(trace.SpanKindClient),
+			trace.WithAttributes(
+				attribute.String("db.system", "redis"),
+				attribute.String("server.address", addr),
+			))
+		defer span.End()
+		conn, err := next(ctx, network, addr)
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		}
+		return conn, err
+	}
+}
+
+func (h *hook) ProcessHook(next goredis.ProcessHook) goredis.ProcessHook {
+	return func(ctx context.Context, cmd goredis.Cmder) error {
+		start := time.Now()
+		ctx, span := h.startSpan(ctx, cmd.FullName())
+		err := next(ctx, cmd)
+		h.finish(ctx, span, cmd.FullName(), start, err, func() string {
+			return cmd.String()
+		})
+		return err
+	}
+}
+
+func (h *hook) ProcessPipelineHook(next goredis.ProcessPipelineHook) goredis.ProcessPipelineHook {
+	return func(ctx context.Context, cmds []goredis.Cmder) error {
+		start := time.Now()
+		ctx, span := h.startSpan(ctx, "pipeline")
+		span.SetAttributes(attribute.Int("db.operation.batch.size", len(cmds)))
+		err := next(ctx, cmds)
+		h.finish(ctx, span, "pipeline", start, err, func() string {
+			names := make([]string, 0, len(cmds))
+			for _, cmd := range cmds {
+				names = append(names, cmd.FullName())
+			}
+			return strings.Join(names, " ")
+		})
+		return err
+	}
+}
+
+func (h *hook) startSpan(ctx context.Context, operation string) (context.Context, trace.Span) {
+	return h.tracer.Start(ctx, "redis."+operation,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			attribute.String("db.system", "redis"),
+			attribute.String("db.operation.name", operation),
+			attribute.String("db.client.name", h.name),
+			attribute.String("server.address", h.addrs),
+		))
+}
+
+func (h *hook) finish(
+	ctx context.Context,
+	span trace.Span,
+	operation string,
+	start time.Time,
+	err error,
+	statement func() string,
+) {
+	elapsed := time.Since(start)
+	// A missing key is a normal reply, not a failure.
+	failed := err != nil && !errors.Is(err, goredis.Nil)
+	if failed {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+
+	attrs := []attribute.KeyValue{
+		attribute.String("db.system", "redis"),
+		attribute.String("db.operation.name", operation),
+		attribute.String("db.client.name", h.name),
+	}
+	if failed {
+		attrs = append(attrs, attribute.String("error.type", errorType(err)))
+	}
+	h.duration.Record(context.WithoutCancel(ctx), elapsed.Seconds(),
+		metric.WithAttributes(attrs...))
+
+	if h.threshold > 0 && elapsed >= h.threshold {
+		slog.WarnContext(ctx, "slow redis command",
+			slog.String("redis", h.name),
+			slog.Duration("elapsed", elapsed),
+			slog.String("command", truncate(statement(), 256)))
+	}
+}
+
+func errorType(err error) string {
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		return "timeout"
+	case errors.Is(err, context.Canceled):
+		return "canceled"
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return "network"
+	}
+	return "redis"
+}
+
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	return s[:n] + "..."
+}
+
+var poolMetricsOnce sync.Once
+
+// registerPoolMetrics reports the pool statistics of every open client
+// through the global meter provider, once per process.
+func registerPoolMetrics() {
+	poolMetricsOnce.Do(func() {
+		if err := observePools(otel.GetMeterProvider()); err != nil {
+			otel.Handle(err)
+		}
+	})
+}
+
+func observePools(provider metric.MeterProvider) error {
+	meter := provider.Meter(instrumentationName,
+		metric.WithInstrumentationVersion("yggdrasil"),
+	)
+	connections, err := meter.Int64ObservableUpDownCounter("db.client.connection.count",
+		metric.WithDescription("Number of connections by state."),
+		metric.WithUnit("{connection}"))
+	if err != nil {
+		return err
+	}
+	timeouts, err := meter.Int64ObservableCounter("db.client.connection.timeouts",
+		metric.WithDescription("Number of connection wait timeouts."),
+		metric.WithUnit("{timeout}"))
+	if err != nil {
+		return err
+	}
+	misses, err := meter.Int64ObservableCounter("db.client.connection.misses",
+		metric.WithDescription("Number of times no idle connection was available."),
+		metric.WithUnit("{miss}"))
+	if err != nil {
+		return err
+	}
+	_, err = meter.RegisterCallback(func(_ context.Context, o metric.Observer) error {
+		clients.RLock()
+		defer clients.RUnlock()
+		for name, client := range clients.byName {
+			stats := client.PoolStats()
+			pool := attribute.String("db.client.connection.pool.name", name)
+			o.ObserveInt64(connections, int64(stats.IdleConns), metric.WithAttributes(
+				pool, attribute.String("db.client.connection.state", "idle")))
+			o.ObserveInt64(connections, int64(stats.TotalConns)-int64(stats.IdleConns),
+				metric.WithAttributes(pool, attribute.String("db.client.connection.state", "used")))
+			o.ObserveInt64(timeouts, int64(stats.Timeouts), metric.WithAttributes(pool))
+			o.ObserveInt64(misses, int64(stats.Misses), metric.WithAttributes(pool))
+		}
+		return nil
+	}, connections, timeouts, misses)
+	return err
+}
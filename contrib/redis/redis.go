@@ -0,0 +1,275 @@
+// Copyright 2022 The codesjoy Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package redis integrates go-redis clients with the yggdrasil application:
+// clients are built from configuration, instrumented with tracing, metrics
+// and slow-command logging hooks, checked by the readiness endpoint and
+// closed on shutdown.
+//
+// Other components share the configured clients through Get and the
+// adapters in this package, e.g. IdempotencyClient and RateLimitScripter.
+package redis
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"log/slog"
+	"maps"
+	"slices"
+	"sync"
+	"time"
+
+	goredis "github.com/redis/go-redis/v9"
+
+	"github.com/codesjoy/yggdrasil/v3/config"
+	"github.com/codesjoy/yggdrasil/v3/module"
+)
+
+// ModuleName is the name of the redis module.
+const ModuleName = "redis"
+
+// ConfigPath is the config path consumed by the redis module. Each key below
+// it names one client.
+const ConfigPath = "yggdrasil.redis"
+
+// Client modes.
+const (
+	ModeSingle   = "single"
+	ModeCluster  = "cluster"
+	ModeSentinel = "sentinel"
+)
+
+// Config configures one client.
+type Config struct {
+	// Mode is single, cluster or sentinel; it defaults to single.
+	Mode string `mapstructure:"mode"`
+	// Addrs lists the server addresses; sentinel mode lists the sentinels.
+	Addrs []string `mapstructure:"addrs"`
+	// MasterName is the sentinel master name.
+	MasterName       string `mapstructure:"master_name"`
+	Username         string `mapstructure:"username"`
+	Password         string `mapstructure:"password"`
+	SentinelUsername string `mapstructure:"sentinel_username"`
+	SentinelPassword string `mapstructure:"sentinel_password"`
+	// DB selects the database in single and sentinel modes.
+	DB           int           `mapstructure:"db"`
+	PoolSize     int           `mapstructure:"pool_size"`
+	MinIdleConns int           `mapstructure:"min_idle_conns"`
+	DialTimeout  time.Duration `mapstructure:"dial_timeout"`
+	ReadTimeout  time.Duration `mapstructure:"read_timeout"`
+	WriteTimeout time.Duration `mapstructure:"write_timeout"`
+	// TLS enables TLS with the system roots.
+	TLS bool `mapstructure:"tls"`
+	// SlowThreshold logs commands running longer than it. Zero disables
+	// slow-command logging.
+	SlowThreshold time.Duration `mapstructure:"slow_threshold"`
+	// PingTimeout bounds the startup and health check pings; it defaults to
+	// three seconds.
+	PingTimeout time.Duration `mapstructure:"ping_timeout"`
+}
+
+// NewClient builds a client for cfg with the instrumentation hooks installed.
+// name labels the client in telemetry.
+func NewClient(name string, cfg Config) (goredis.UniversalClient, error) {
+	if len(cfg.Addrs) == 0 {
+		return nil, fmt.Errorf("redis %q: addrs is empty", name)
+	}
+	opts := &goredis.UniversalOptions{
+		Addrs:            cfg.Addrs,
+		MasterName:       cfg.MasterName,
+		Username:         cfg.Username,
+		Password:         cfg.Password,
+		SentinelUsername: cfg.SentinelUsername,
+		SentinelPassword: cfg.SentinelPassword,
+		DB:               cfg.DB,
+		PoolSize:         cfg.PoolSize,
+		MinIdleConns:     cfg.MinIdleConns,
+		DialTimeout:      cfg.DialTimeout,
+		ReadTimeout:      cfg.ReadTimeout,
+		WriteTimeout:     cfg.WriteTimeout,
+	}
+	if cfg.TLS {
+		opts.TLSConfig = &tls.Config{MinVersion: tls.VersionTLS12}
+	}
+
+	var client goredis.UniversalClient
+	switch cfg.Mode {
+	case "", ModeSingle:
+		if len(cfg.Addrs) != 1 {
+			return nil, fmt.Errorf("redis %q: single mode takes one address", name)
+		}
+		client = goredis.NewClient(opts.Simple())
+	case ModeCluster:
+		client = goredis.NewClusterClient(opts.Cluster())
+	case ModeSentinel:
+		if cfg.MasterName == "" {
+			return nil, fmt.Errorf("redis %q: sentinel mode requires master_name", name)
+		}
+		client = goredis.NewFailoverClient(opts.Failover())
+	default:
+		return nil, fmt.Errorf("redis %q: unknown mode %q", name, cfg.Mode)
+	}
+	client.AddHook(newHook(name, cfg.Addrs, cfg.SlowThreshold))
+	return client, nil
+}
+
+var clients = struct {
+	sync.RWMutex
+	byName map[string]goredis.UniversalClient
+	cfgs   map[string]Config
+}{byName: map[string]goredis.UniversalClient{}, cfgs: map[string]Config{}}
+
+// Get returns the client configured under name.
+func Get(name string) (goredis.UniversalClient, error) {
+	clients.RLock()
+	defer clients.RUnlock()
+	client, ok := clients.byName[name]
+	if !ok {
+		return nil, fmt.Errorf("redis %q is not configured", name)
+	}
+	return client, nil
+}
+
+// Names returns the names of the open clients in order.
+func Names() []string {
+	clients.RLock()
+	defer clients.RUnlock()
+	return slices.Sorted(maps.Keys(clients.byName))
+}
+
+type redisModule struct {
+	mu    sync.Mutex
+	names []string
+}
+
+// Module returns the module building the clients configured under
+// ConfigPath. Clients are pinged during initialization, checked by the
+// readiness endpoint and closed when the application stops.
+func Module() module.Module {
+	return &redisModule{}
+}
+
+func (m *redisModule) Name() string { return ModuleName }
+
+func (m *redisModule) ConfigPath() string { return ConfigPath }
+
+func (m *redisModule) IsolationMode() module.IsolationMode {
+	return module.IsolationModeRequiresProcessDefaults
+}
+
+func (m *redisModule) Init(ctx context.Context, view config.View) error {
+	cfgs := map[string]Config{}
+	if err := view.Decode(&cfgs); err != nil {
+		return fmt.Errorf("load redis config: %w", err)
+	}
+	names := slices.Sorted(maps.Keys(cfgs))
+	opened := make(map[string]goredis.UniversalClient, len(cfgs))
+	closeOpened := func() {
+		for _, client := range opened {
+			_ = client.Close()
+		}
+	}
+	for _, name := range names {
+		cfg := cfgs[name]
+		if cfg.PingTimeout <= 0 {
+			cfg.PingTimeout = 3 * time.Second
+		}
+		cfgs[name] = cfg
+		client, err := NewClient(name, cfg)
+		if err != nil {
+			closeOpened()
+			return err
+		}
+		opened[name] = client
+		pingCtx, cancel := context.WithTimeout(ctx, cfg.PingTimeout)
+		err = client.Ping(pingCtx).Err()
+		cancel()
+		if err != nil {
+			closeOpened()
+			return fmt.Errorf("redis %q: ping: %w", name, err)
+		}
+		slog.Info("redis client opened",
+			slog.String("redis", name), slog.String("mode", cfg.Mode))
+	}
+
+	clients.Lock()
+	for _, name := range names {
+		if _, ok := clients.byName[name]; ok {
+			clients.Unlock()
+			closeOpened()
+			return fmt.Errorf("redis %q is already open", name)
+		}
+	}
+	for name, client := range opened {
+		clients.byName[name] = client
+		clients.cfgs[name] = cfgs[name]
+	}
+	clients.Unlock()
+	if len(names) > 0 {
+		registerPoolMetrics()
+	}
+
+	m.mu.Lock()
+	m.names = names
+	m.mu.Unlock()
+	return nil
+}
+
+// CheckHealth pings every client opened by the module.
+func (m *redisModule) CheckHealth(ctx context.Context) error {
+	m.mu.Lock()
+	names := m.names
+	m.mu.Unlock()
+	var multiErr error
+	for _, name := range names {
+		clients.RLock()
+		client, cfg := clients.byName[name], clients.cfgs[name]
+		clients.RUnlock()
+		if client == nil {
+			continue
+		}
+		pingCtx, cancel := context.WithTimeout(ctx, cfg.PingTimeout)
+		err := client.Ping(pingCtx).Err()
+		cancel()
+		if err != nil {
+			multiErr = errors.Join(multiErr, fmt.Errorf("redis %q: %w", name, err))
+		}
+	}
+	return multiErr
+}
+
+func (m *redisModule) Stop(context.Context) error {
+	m.mu.Lock()
+	names := m.names
+	m.names = nil
+	m.mu.Unlock()
+
+	var multiErr error
+	for _, name := range names {
+		clients.Lock()
+		client := clients.byName[name]
+		delete(clients.byName, name)
+		delete(clients.cfgs, name)
+		clients.Unlock()
+		if client == nil {
+			continue
+		}
+		if err := client.Close(); err != nil {
+			multiErr = errors.Join(multiErr, fmt.Errorf("close redis %q: %w", name, err))
+		}
+	}
+	return multiErr
+}
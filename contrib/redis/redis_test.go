@@ -0,0 +1,234 @@
+// Copyright 2022 The codesjoy Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package redis
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/longrunning/autogen/longrunningpb"
+	"github.com/alicebob/miniredis/v2"
+	goredis "github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/codesjoy/yggdrasil/v3/config"
+	"github.com/codesjoy/yggdrasil/v3/lock"
+	"github.com/codesjoy/yggdrasil/v3/module"
+	"github.com/codesjoy/yggdrasil/v3/operations"
+	"github.com/codesjoy/yggdrasil/v3/rpc/interceptor/dedupe"
+	"github.com/codesjoy/yggdrasil/v3/rpc/interceptor/idempotency"
+	"github.com/codesjoy/yggdrasil/v3/rpc/interceptor/ratelimit"
+)
+
+func initModule(t *testing.T, cfg map[string]any) (module.Module, error) {
+	t.Helper()
+	m := Module()
+	err := m.(module.Initializable).Init(context.Background(),
+		config.NewView(ConfigPath, config.NewSnapshot(cfg)))
+	if err == nil {
+		t.Cleanup(func() { _ = m.(module.Stoppable).Stop(context.Background()) })
+	}
+	return m, err
+}
+
+func TestModuleOpensConfiguredClients(t *testing.T) {
+	server := miniredis.RunT(t)
+	m, err := initModule(t, map[string]any{
+		"cache": map[string]any{
+			"addrs":     []string{server.Addr()},
+			"pool_size": 4,
+		},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, ModuleName, m.Name())
+	assert.Equal(t, ConfigPath, m.(module.Configurable).ConfigPath())
+	assert.Contains(t, Names(), "cache")
+
+	client, err := Get("cache")
+	require.NoError(t, err)
+	require.NoError(t, client.Set(context.Background(), "k", "v", 0).Err())
+	got, err := server.Get("k")
+	require.NoError(t, err)
+	assert.Equal(t, "v", got)
+
+	checker := m.(module.HealthChecker)
+	require.NoError(t, checker.CheckHealth(context.Background()))
+	server.Close()
+	assert.ErrorContains(t, checker.CheckHealth(context.Background()), `redis "cache"`)
+
+	require.NoError(t, m.(module.Stoppable).Stop(context.Background()))
+	_, err = Get("cache")
+	assert.Error(t, err)
+}
+
+func TestModuleFailsWhenServerIsUnreachable(t *testing.T) {
+	server := miniredis.RunT(t)
+	addr := server.Addr()
+	server.Close()
+	_, err := initModule(t, map[string]any{
+		"cache": map[string]any{"addrs": []string{addr}, "ping_timeout": "200ms"},
+	})
+	assert.ErrorContains(t, err, "ping")
+	assert.NotContains(t, Names(), "cache")
+}
+
+func TestNewClientValidatesConfig(t *testing.T) {
+	_, err := NewClient("x", Config{})
+	assert.ErrorContains(t, err, "addrs")
+	_, err = NewClient("x", Config{Mode: "ring", Addrs: []string{"127.0.0.1:6379"}})
+	assert.ErrorContains(t, err, "mode")
+	_, err = NewClient("x", Config{Mode: ModeSentinel, Addrs: []string{"127.0.0.1:26379"}})
+	assert.ErrorContains(t, err, "master_name")
+
+	client, err := NewClient("x", Config{Mode: ModeCluster, Addrs: []string{"127.0.0.1:7000"}})
+	require.NoError(t, err)
+	_, ok := client.(*goredis.ClusterClient)
+	assert.True(t, ok)
+	require.NoError(t, client.Close())
+}
+
+func TestSlowCommandsAreLogged(t *testing.T) {
+	var buf bytes.Buffer
+	prev := slog.Default()
+	slog.SetDefault(slog.New(slog.NewTextHandler(&buf, nil)))
+	t.Cleanup(func() { slog.SetDefault(prev) })
+
+	server := miniredis.RunT(t)
+	client, err := NewClient("cache", Config{
+		Addrs:         []string{server.Addr()},
+		SlowThreshold: time.Nanosecond,
+	})
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = client.Close() })
+
+	require.ErrorIs(t, client.Get(context.Background(), "missing").Err(), goredis.Nil)
+	assert.Contains(t, buf.String(), "slow redis command")
+	assert.Contains(t, buf.String(), "redis=cache")
+}
+
+func TestAdapters(t *testing.T) {
+	server := miniredis.RunT(t)
+	client, err := NewClient("cache", Config{Addrs: []string{server.Addr()}})
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = client.Close() })
+	ctx := context.Background()
+
+	store := idempotency.NewRedisStore(IdempotencyClient(client), "idem:")
+	rec, err := store.Reserve(ctx, "req-1", time.Minute)
+	require.NoError(t, err)
+	assert.Nil(t, rec)
+	_, err = store.Reserve(ctx, "req-1", time.Minute)
+	assert.ErrorIs(t, err, idempotency.ErrInProgress)
+	require.NoError(t, store.Release(ctx, "req-1"))
+	assert.False(t, server.Exists("idem:req-1"))
+
+	ids := dedupe.NewRedisStore(DedupeClient(client), "dedupe:")
+	dup, err := ids.Add(ctx, "msg-1", time.Minute)
+	require.NoError(t, err)
+	assert.False(t, dup)
+	dup, err = ids.Add(ctx, "msg-1", time.Minute)
+	require.NoError(t, err)
+	assert.True(t, dup)
+	assert.Equal(t, time.Minute, server.TTL("dedupe:msg-1"))
+	require.NoError(t, ids.Remove(ctx, "msg-1"))
+	assert.False(t, server.Exists("dedupe:msg-1"))
+
+	limiter := ratelimit.NewRedisLimiter(RateLimitScripter(client), "rl:")
+	limit := ratelimit.Limit{Rate: 1, Burst: 2}
+	for range 2 {
+		allowed, _, err := limiter.Allow(ctx, "user", limit)
+		require.NoError(t, err)
+		assert.True(t, allowed)
+	}
+	allowed, _, err := limiter.Allow(ctx, "user", limit)
+	require.NoError(t, err)
+	assert.False(t, allowed)
+}
+
+func TestOperationsClient(t *testing.T) {
+	server := miniredis.RunT(t)
+	client, err := NewClient("cache", Config{Addrs: []string{server.Addr()}})
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = client.Close() })
+	ctx := context.Background()
+
+	store := operations.NewRedisStore(OperationsClient(client), "ops:")
+	for _, name := range []string{"operations/a", "operations/b", "operations/c"} {
+		require.NoError(t, store.Put(ctx, &longrunningpb.Operation{Name: name}, time.Minute))
+	}
+	require.NoError(t, store.Put(ctx, &longrunningpb.Operation{
+		Name: "operations/a",
+		Done: true,
+	}, time.Minute))
+	assert.Equal(t, time.Minute, server.TTL("ops:operations/a"))
+
+	op, err := store.Update(ctx, "operations/b", 2*time.Minute,
+		func(op *longrunningpb.Operation) error {
+			op.Done = true
+			return nil
+		})
+	require.NoError(t, err)
+	assert.True(t, op.GetDone())
+	assert.Equal(t, 2*time.Minute, server.TTL("ops:operations/b"))
+	swapped, err := OperationsClient(client).CompareAndSet(ctx, "ops:operations/b", "stale", "x", 0)
+	require.NoError(t, err)
+	assert.False(t, swapped)
+
+	op, err = store.Get(ctx, "operations/a")
+	require.NoError(t, err)
+	assert.True(t, op.GetDone())
+
+	page, token, err := store.List(ctx, "operations/", 2, "")
+	require.NoError(t, err)
+	require.Len(t, page, 2)
+	assert.Equal(t, "operations/a", page[0].GetName())
+	assert.Equal(t, "operations/b", page[1].GetName())
+	page, token, err = store.List(ctx, "operations/", 2, token)
+	require.NoError(t, err)
+	require.Len(t, page, 1)
+	assert.Equal(t, "operations/c", page[0].GetName())
+	assert.Empty(t, token)
+
+	require.NoError(t, store.Delete(ctx, "operations/b"))
+	_, err = store.Get(ctx, "operations/b")
+	assert.ErrorIs(t, err, operations.ErrNotFound)
+	members, err := server.ZMembers("ops:index")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"operations/a", "operations/c"}, members)
+}
+
+func TestLockStore(t *testing.T) {
+	server := miniredis.RunT(t)
+	client, err := NewClient("cache", Config{Addrs: []string{server.Addr()}})
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = client.Close() })
+	ctx := context.Background()
+
+	locker := lock.New(LockStore(client, "lock:"))
+	lease, ok, err := locker.TryLock(ctx, "job", time.Minute)
+	require.NoError(t, err)
+	require.True(t, ok)
+	assert.Equal(t, time.Minute, server.TTL("lock:job"))
+	_, ok, err = locker.TryLock(ctx, "job", time.Minute)
+	require.NoError(t, err)
+	assert.False(t, ok)
+
+	require.NoError(t, lease.Release(ctx))
+	assert.False(t, server.Exists("lock:job"))
+}
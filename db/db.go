@@ -0,0 +1,234 @@
+// Copyright 2022 The codesjoy Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package db opens database/sql pools from configuration and manages them
+// with the application lifecycle.
+//
+// Drivers are not linked by this package; import the driver of each
+// configured pool, for example _ "github.com/go-sql-driver/mysql".
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"maps"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/codesjoy/yggdrasil/v3/config"
+	"github.com/codesjoy/yggdrasil/v3/module"
+)
+
+// ModuleName is the name of the db module.
+const ModuleName = "db"
+
+// ConfigPath is the config path consumed by the db module. Each key below it
+// names one pool.
+const ConfigPath = "yggdrasil.db"
+
+// Config configures one pool.
+type Config struct {
+	// Driver is the database/sql driver name.
+	Driver string `mapstructure:"driver"`
+	DSN    string `mapstructure:"dsn"`
+	// MaxOpenConns, MaxIdleConns, ConnMaxLifetime and ConnMaxIdleTime map
+	// to the sql.DB setters; zero keeps the database/sql defaults and a
+	// negative MaxIdleConns retains no idle connections.
+	MaxOpenConns    int           `mapstructure:"max_open_conns"`
+	MaxIdleConns    int           `mapstructure:"max_idle_conns"`
+	ConnMaxLifetime time.Duration `mapstructure:"conn_max_lifetime"`
+	ConnMaxIdleTime time.Duration `mapstructure:"conn_max_idle_time"`
+	// SlowQueryThreshold logs statements running longer than it. Zero
+	// disables slow-query logging.
+	SlowQueryThreshold time.Duration `mapstructure:"slow_query_threshold"`
+	// PingTimeout bounds the startup and health check pings; it defaults
+	// to three seconds.
+	PingTimeout time.Duration `mapstructure:"ping_timeout"`
+}
+
+var pools = struct {
+	sync.RWMutex
+	dbs  map[string]*sql.DB
+	cfgs map[string]Config
+}{dbs: map[string]*sql.DB{}, cfgs: map[string]Config{}}
+
+// Get returns the pool configured under name.
+func Get(name string) (*sql.DB, error) {
+	pools.RLock()
+	defer pools.RUnlock()
+	db, ok := pools.dbs[name]
+	if !ok {
+		return nil, fmt.Errorf("db %q is not configured", name)
+	}
+	return db, nil
+}
+
+// Names returns the names of the open pools in order.
+func Names() []string {
+	pools.RLock()
+	defer pools.RUnlock()
+	return slices.Sorted(maps.Keys(pools.dbs))
+}
+
+type dbModule struct {
+	mu    sync.Mutex
+	names []string
+}
+
+// Module returns the module opening the pools configured under ConfigPath.
+// Pools are pinged during initialization, checked by the readiness endpoint
+// and closed when the application stops.
+func Module() module.Module {
+	return &dbModule{}
+}
+
+func (m *dbModule) Name() string { return ModuleName }
+
+func (m *dbModule) ConfigPath() string { return ConfigPath }
+
+func (m *dbModule) IsolationMode() module.IsolationMode {
+	return module.IsolationModeRequiresProcessDefaults
+}
+
+func (m *dbModule) Init(ctx context.Context, view config.View) error {
+	cfgs := map[string]Config{}
+	if err := view.Decode(&cfgs); err != nil {
+		return fmt.Errorf("load db config: %w", err)
+	}
+	names := slices.Sorted(maps.Keys(cfgs))
+	opened := make(map[string]*sql.DB, len(cfgs))
+	for _, name := range names {
+		cfg := cfgs[name]
+		if cfg.PingTimeout <= 0 {
+			cfg.PingTimeout = 3 * time.Second
+		}
+		cfgs[name] = cfg
+		db, err := open(ctx, name, cfg)
+		if err != nil {
+			for _, item := range opened {
+				_ = item.Close()
+			}
+			return err
+		}
+		opened[name] = db
+	}
+
+	pools.Lock()
+	for _, name := range names {
+		if _, ok := pools.dbs[name]; ok {
+			pools.Unlock()
+			for _, item := range opened {
+				_ = item.Close()
+			}
+			return fmt.Errorf("db %q is already open", name)
+		}
+	}
+	for name, db := range opened {
+		pools.dbs[name] = db
+		pools.cfgs[name] = cfgs[name]
+	}
+	pools.Unlock()
+	if len(names) > 0 {
+		registerMetrics()
+	}
+
+	m.mu.Lock()
+	m.names = names
+	m.mu.Unlock()
+	return nil
+}
+
+func open(ctx context.Context, name string, cfg Config) (*sql.DB, error) {
+	if cfg.Driver == "" {
+		return nil, fmt.Errorf("db %q: driver is empty", name)
+	}
+	var db *sql.DB
+	if cfg.SlowQueryThreshold > 0 {
+		connector, err := newSlowQueryConnector(name, cfg)
+		if err != nil {
+			return nil, err
+		}
+		db = sql.OpenDB(connector)
+	} else {
+		var err error
+		if db, err = sql.Open(cfg.Driver, cfg.DSN); err != nil {
+			return nil, fmt.Errorf("db %q: %w", name, err)
+		}
+	}
+	db.SetMaxOpenConns(cfg.MaxOpenConns)
+	if cfg.MaxIdleConns != 0 {
+		db.SetMaxIdleConns(cfg.MaxIdleConns)
+	}
+	db.SetConnMaxLifetime(cfg.ConnMaxLifetime)
+	db.SetConnMaxIdleTime(cfg.ConnMaxIdleTime)
+
+	pingCtx, cancel := context.WithTimeout(ctx, cfg.PingTimeout)
+	defer cancel()
+	if err := db.PingContext(pingCtx); err != nil {
+		_ = db.Close()
+		return nil, fmt.Errorf("db %q: ping: %w", name, err)
+	}
+	slog.Info("db pool opened", slog.String("db", name), slog.String("driver", cfg.Driver))
+	return db, nil
+}
+
+// CheckHealth pings every pool opened by the module.
+func (m *dbModule) CheckHealth(ctx context.Context) error {
+	m.mu.Lock()
+	names := m.names
+	m.mu.Unlock()
+	var multiErr error
+	for _, name := range names {
+		pools.RLock()
+		db, cfg := pools.dbs[name], pools.cfgs[name]
+		pools.RUnlock()
+		if db == nil {
+			continue
+		}
+		pingCtx, cancel := context.WithTimeout(ctx, cfg.PingTimeout)
+		err := db.PingContext(pingCtx)
+		cancel()
+		if err != nil {
+			multiErr = errors.Join(multiErr, fmt.Errorf("db %q: %w", name, err))
+		}
+	}
+	return multiErr
+}
+
+func (m *dbModule) Stop(context.Context) error {
+	m.mu.Lock()
+	names := m.names
+	m.names = nil
+	m.mu.Unlock()
+
+	var multiErr error
+	for _, name := range names {
+		pools.Lock()
+		db := pools.dbs[name]
+		delete(pools.dbs, name)
+		delete(pools.cfgs, name)
+		pools.Unlock()
+		if db == nil {
+			continue
+		}
+		if err := db.Close(); err != nil {
+			multiErr = errors.Join(multiErr, fmt.Errorf("close db %q: %w", name, err))
+		}
+	}
+	return multiErr
+}
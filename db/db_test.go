@@ -0,0 +1,263 @@
+// Copyright 2022 The codesjoy Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package db
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"log/slog"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+
+	"github.com/codesjoy/yggdrasil/v3/config"
+	"github.com/codesjoy/yggdrasil/v3/module"
+)
+
+type fakeBackend struct {
+	mu        sync.Mutex
+	pingErr   error
+	execDelay time.Duration
+	closed    int
+}
+
+var fakeBackends sync.Map
+
+func init() {
+	sql.Register("dbfake", fakeDriver{})
+}
+
+type fakeDriver struct{}
+
+func (fakeDriver) Open(dsn string) (driver.Conn, error) {
+	backend, ok := fakeBackends.Load(dsn)
+	if !ok {
+		return nil, errors.New("unknown backend")
+	}
+	return &fakeConn{backend: backend.(*fakeBackend)}, nil
+}
+
+type fakeConn struct{ backend *fakeBackend }
+
+func (c *fakeConn) Prepare(string) (driver.Stmt, error) { return nil, errors.New("unsupported") }
+
+func (c *fakeConn) Close() error {
+	c.backend.mu.Lock()
+	c.backend.closed++
+	c.backend.mu.Unlock()
+	return nil
+}
+
+func (c *fakeConn) Begin() (driver.Tx, error) { return nil, errors.New("unsupported") }
+
+func (c *fakeConn) Ping(context.Context) error {
+	c.backend.mu.Lock()
+	defer c.backend.mu.Unlock()
+	return c.backend.pingErr
+}
+
+func (c *fakeConn) ExecContext(
+	context.Context,
+	string,
+	[]driver.NamedValue,
+) (driver.Result, error) {
+	c.backend.mu.Lock()
+	delay := c.backend.execDelay
+	c.backend.mu.Unlock()
+	time.Sleep(delay)
+	return driver.RowsAffected(1), nil
+}
+
+func (c *fakeConn) QueryContext(context.Context, string, []driver.NamedValue) (driver.Rows, error) {
+	return emptyRows{}, nil
+}
+
+type emptyRows struct{}
+
+func (emptyRows) Columns() []string         { return []string{"n"} }
+func (emptyRows) Close() error              { return nil }
+func (emptyRows) Next([]driver.Value) error { return io.EOF }
+
+func newBackend(t *testing.T) (string, *fakeBackend) {
+	t.Helper()
+	backend := &fakeBackend{}
+	fakeBackends.Store(t.Name(), backend)
+	t.Cleanup(func() { fakeBackends.Delete(t.Name()) })
+	return t.Name(), backend
+}
+
+func initModule(t *testing.T, cfg map[string]any) (module.Module, error) {
+	t.Helper()
+	m := Module()
+	err := m.(module.Initializable).Init(context.Background(),
+		config.NewView(ConfigPath, config.NewSnapshot(cfg)))
+	if err == nil {
+		t.Cleanup(func() { _ = m.(module.Stoppable).Stop(context.Background()) })
+	}
+	return m, err
+}
+
+func TestModuleOpensConfiguredPools(t *testing.T) {
+	dsn, backend := newBackend(t)
+	m, err := initModule(t, map[string]any{
+		"orders": map[string]any{
+			"driver":             "dbfake",
+			"dsn":                dsn,
+			"max_open_conns":     4,
+			"max_idle_conns":     2,
+			"conn_max_lifetime":  "1m",
+			"conn_max_idle_time": "30s",
+		},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, ModuleName, m.Name())
+	assert.Equal(t, ConfigPath, m.(module.Configurable).ConfigPath())
+
+	db, err := Get("orders")
+	require.NoError(t, err)
+	assert.Equal(t, 4, db.Stats().MaxOpenConnections)
+	assert.Contains(t, Names(), "orders")
+	_, err = Get("missing")
+	require.Error(t, err)
+
+	checker := m.(module.HealthChecker)
+	require.NoError(t, checker.CheckHealth(context.Background()))
+	backend.mu.Lock()
+	backend.pingErr = errors.New("connection refused")
+	backend.mu.Unlock()
+	err = checker.CheckHealth(context.Background())
+	require.ErrorContains(t, err, `db "orders": connection refused`)
+
+	require.NoError(t, m.(module.Stoppable).Stop(context.Background()))
+	require.NoError(t, m.(module.Stoppable).Stop(context.Background()))
+	_, err = Get("orders")
+	require.Error(t, err)
+	backend.mu.Lock()
+	assert.Positive(t, backend.closed)
+	backend.mu.Unlock()
+}
+
+func TestModuleInitFailures(t *testing.T) {
+	dsn, backend := newBackend(t)
+	_, err := initModule(t, map[string]any{"a": map[string]any{"dsn": dsn}})
+	require.ErrorContains(t, err, "driver is empty")
+
+	_, err = initModule(t, map[string]any{"a": map[string]any{"driver": "nope"}})
+	require.Error(t, err)
+
+	backend.pingErr = errors.New("down")
+	_, err = initModule(t, map[string]any{
+		"a": map[string]any{"driver": "dbfake", "dsn": dsn, "ping_timeout": "50ms"},
+	})
+	require.ErrorContains(t, err, "ping: down")
+	assert.Empty(t, Names())
+}
+
+func TestSlowQueryLogging(t *testing.T) {
+	var buf bytes.Buffer
+	var mu sync.Mutex
+	prev := slog.Default()
+	slog.SetDefault(slog.New(slog.NewTextHandler(&lockedWriter{w: &buf, mu: &mu}, nil)))
+	t.Cleanup(func() { slog.SetDefault(prev) })
+
+	dsn, backend := newBackend(t)
+	_, err := initModule(t, map[string]any{
+		"reports": map[string]any{
+			"driver":               "dbfake",
+			"dsn":                  dsn,
+			"slow_query_threshold": "20ms",
+		},
+	})
+	require.NoError(t, err)
+	db, err := Get("reports")
+	require.NoError(t, err)
+
+	_, err = db.ExecContext(context.Background(), "UPDATE fast SET n = 1")
+	require.NoError(t, err)
+	backend.mu.Lock()
+	backend.execDelay = 30 * time.Millisecond
+	backend.mu.Unlock()
+	_, err = db.ExecContext(context.Background(), "UPDATE slow SET n = 1")
+	require.NoError(t, err)
+	rows, err := db.QueryContext(context.Background(), "SELECT n FROM fast")
+	require.NoError(t, err)
+	require.NoError(t, rows.Close())
+
+	mu.Lock()
+	defer mu.Unlock()
+	out := buf.String()
+	assert.Contains(t, out, `msg="slow query" db=reports`)
+	assert.Contains(t, out, "UPDATE slow SET n = 1")
+	assert.NotContains(t, out, "UPDATE fast")
+	assert.NotContains(t, out, "SELECT n FROM fast")
+}
+
+type lockedWriter struct {
+	w  io.Writer
+	mu *sync.Mutex
+}
+
+func (l *lockedWriter) Write(p []byte) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.w.Write(p)
+}
+
+func TestPoolMetrics(t *testing.T) {
+	dsn, _ := newBackend(t)
+	_, err := initModule(t, map[string]any{
+		"metrics": map[string]any{"driver": "dbfake", "dsn": dsn, "max_open_conns": 3},
+	})
+	require.NoError(t, err)
+
+	reader := sdkmetric.NewManualReader()
+	provider := sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader))
+	require.NoError(t, registerPoolMetrics(provider))
+	var rm metricdata.ResourceMetrics
+	require.NoError(t, reader.Collect(context.Background(), &rm))
+
+	values := map[string]int64{}
+	for _, sm := range rm.ScopeMetrics {
+		for _, m := range sm.Metrics {
+			sum, ok := m.Data.(metricdata.Sum[int64])
+			if !ok {
+				continue
+			}
+			for _, dp := range sum.DataPoints {
+				pool, _ := dp.Attributes.Value("db.client.connection.pool.name")
+				if pool.AsString() != "metrics" {
+					continue
+				}
+				key := m.Name
+				if state, ok := dp.Attributes.Value("db.client.connection.state"); ok {
+					key += "/" + state.AsString()
+				}
+				values[key] += dp.Value
+			}
+		}
+	}
+	assert.Equal(t, int64(3), values["db.client.connection.max"])
+	assert.Equal(t, int64(1), values["db.client.connection.count/idle"])
+	assert.Equal(t, int64(0), values["db.client.connection.count/used"])
+}
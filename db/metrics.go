@@ -0,0 +1,98 @@
+// Copyright 2022 The codesjoy Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package db
+
+import (
+	"context"
+	"sync"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+var metricsOnce sync.Once
+
+// registerMetrics reports the sql.DBStats of every open pool through the
+// global meter provider. It registers the instruments once per process.
+func registerMetrics() {
+	metricsOnce.Do(func() {
+		if err := registerPoolMetrics(otel.GetMeterProvider()); err != nil {
+			otel.Handle(err)
+		}
+	})
+}
+
+func registerPoolMetrics(provider metric.MeterProvider) error {
+	meter := provider.Meter("github.com/codesjoy/yggdrasil/v3",
+		metric.WithInstrumentationVersion("yggdrasil"),
+	)
+	connections, err := meter.Int64ObservableUpDownCounter("db.client.connection.count",
+		metric.WithDescription("Number of connections by state."),
+		metric.WithUnit("{connection}"))
+	if err != nil {
+		return err
+	}
+	maxConns, err := meter.Int64ObservableUpDownCounter("db.client.connection.max",
+		metric.WithDescription("Maximum number of open connections allowed."),
+		metric.WithUnit("{connection}"))
+	if err != nil {
+		return err
+	}
+	waits, err := meter.Int64ObservableCounter("db.client.connection.wait_count",
+		metric.WithDescription("Number of times a connection was waited for."),
+		metric.WithUnit("{wait}"))
+	if err != nil {
+		return err
+	}
+	waitTime, err := meter.Float64ObservableCounter("db.client.connection.wait_time",
+		metric.WithDescription("Total time blocked waiting for a connection."),
+		metric.WithUnit("s"))
+	if err != nil {
+		return err
+	}
+	closed, err := meter.Int64ObservableCounter("db.client.connection.closed",
+		metric.WithDescription("Number of connections closed by the pool limits, by reason."),
+		metric.WithUnit("{connection}"))
+	if err != nil {
+		return err
+	}
+
+	_, err = meter.RegisterCallback(func(_ context.Context, o metric.Observer) error {
+		pools.RLock()
+		defer pools.RUnlock()
+		for name, db := range pools.dbs {
+			stats := db.Stats()
+			pool := attribute.String("db.client.connection.pool.name", name)
+			o.ObserveInt64(connections, int64(stats.Idle), metric.WithAttributes(
+				pool, attribute.String("db.client.connection.state", "idle")))
+			o.ObserveInt64(connections, int64(stats.InUse), metric.WithAttributes(
+				pool, attribute.String("db.client.connection.state", "used")))
+			o.ObserveInt64(maxConns, int64(stats.MaxOpenConnections), metric.WithAttributes(pool))
+			o.ObserveInt64(waits, stats.WaitCount, metric.WithAttributes(pool))
+			o.ObserveFloat64(waitTime, stats.WaitDuration.Seconds(), metric.WithAttributes(pool))
+			for reason, n := range map[string]int64{
+				"max_idle":      stats.MaxIdleClosed,
+				"max_idle_time": stats.MaxIdleTimeClosed,
+				"max_lifetime":  stats.MaxLifetimeClosed,
+			} {
+				o.ObserveInt64(closed, n, metric.WithAttributes(
+					pool, attribute.String("reason", reason)))
+			}
+		}
+		return nil
+	}, connections, maxConns, waits, waitTime, closed)
+	return err
+}
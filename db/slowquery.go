@@ -0,0 +1,243 @@
+// Copyright 2022 The codesjoy Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package db
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+)
+
+// maxLoggedQuery bounds the statement text written to slow-query logs.
+const maxLoggedQuery = 1024
+
+// slowQueryConnector wraps the connections of a driver to time statements.
+type slowQueryConnector struct {
+	name      string
+	dsn       string
+	driver    driver.Driver
+	connector driver.Connector
+	threshold time.Duration
+}
+
+func newSlowQueryConnector(name string, cfg Config) (*slowQueryConnector, error) {
+	probe, err := sql.Open(cfg.Driver, cfg.DSN)
+	if err != nil {
+		return nil, fmt.Errorf("db %q: %w", name, err)
+	}
+	drv := probe.Driver()
+	_ = probe.Close()
+
+	c := &slowQueryConnector{
+		name:      name,
+		dsn:       cfg.DSN,
+		driver:    drv,
+		threshold: cfg.SlowQueryThreshold,
+	}
+	if dc, ok := drv.(driver.DriverContext); ok {
+		if c.connector, err = dc.OpenConnector(cfg.DSN); err != nil {
+			return nil, fmt.Errorf("db %q: %w", name, err)
+		}
+	}
+	return c, nil
+}
+
+func (c *slowQueryConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	var conn driver.Conn
+	var err error
+	if c.connector != nil {
+		conn, err = c.connector.Connect(ctx)
+	} else {
+		conn, err = c.driver.Open(c.dsn)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &slowQueryConn{Conn: conn, c: c}, nil
+}
+
+func (c *slowQueryConnector) Driver() driver.Driver { return c.driver }
+
+func (c *slowQueryConnector) observe(ctx context.Context, query string, start time.Time) {
+	elapsed := time.Since(start)
+	if elapsed < c.threshold {
+		return
+	}
+	if len(query) > maxLoggedQuery {
+		query = query[:maxLoggedQuery] + "..."
+	}
+	slog.WarnContext(ctx, "slow query",
+		slog.String("db", c.name),
+		slog.Duration("elapsed", elapsed),
+		slog.String("query", query))
+}
+
+// slowQueryConn forwards the optional driver interfaces of the wrapped
+// connection; driver.ErrSkip makes database/sql fall back to the prepared
+// statement path when the driver lacks a fast path.
+type slowQueryConn struct {
+	driver.Conn
+	c *slowQueryConnector
+}
+
+func (conn *slowQueryConn) Prepare(query string) (driver.Stmt, error) {
+	return conn.PrepareContext(context.Background(), query)
+}
+
+func (conn *slowQueryConn) PrepareContext(ctx context.Context, query string) (driver.Stmt, error) {
+	var stmt driver.Stmt
+	var err error
+	if pc, ok := conn.Conn.(driver.ConnPrepareContext); ok {
+		stmt, err = pc.PrepareContext(ctx, query)
+	} else {
+		stmt, err = conn.Conn.Prepare(query)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &slowQueryStmt{Stmt: stmt, c: conn.c, query: query}, nil
+}
+
+func (conn *slowQueryConn) ExecContext(
+	ctx context.Context,
+	query string,
+	args []driver.NamedValue,
+) (driver.Result, error) {
+	ec, ok := conn.Conn.(driver.ExecerContext)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+	start := time.Now()
+	res, err := ec.ExecContext(ctx, query, args)
+	if !errors.Is(err, driver.ErrSkip) {
+		conn.c.observe(ctx, query, start)
+	}
+	return res, err
+}
+
+func (conn *slowQueryConn) QueryContext(
+	ctx context.Context,
+	query string,
+	args []driver.NamedValue,
+) (driver.Rows, error) {
+	qc, ok := conn.Conn.(driver.QueryerContext)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+	start := time.Now()
+	rows, err := qc.QueryContext(ctx, query, args)
+	if !errors.Is(err, driver.ErrSkip) {
+		conn.c.observe(ctx, query, start)
+	}
+	return rows, err
+}
+
+func (conn *slowQueryConn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	if bc, ok := conn.Conn.(driver.ConnBeginTx); ok {
+		return bc.BeginTx(ctx, opts)
+	}
+	if opts.Isolation != driver.IsolationLevel(sql.LevelDefault) || opts.ReadOnly {
+		return nil, errors.New("db: driver does not support transaction options")
+	}
+	return conn.Conn.Begin() //nolint:staticcheck // fallback for drivers without BeginTx
+}
+
+func (conn *slowQueryConn) Ping(ctx context.Context) error {
+	if p, ok := conn.Conn.(driver.Pinger); ok {
+		return p.Ping(ctx)
+	}
+	return nil
+}
+
+func (conn *slowQueryConn) ResetSession(ctx context.Context) error {
+	if r, ok := conn.Conn.(driver.SessionResetter); ok {
+		return r.ResetSession(ctx)
+	}
+	return nil
+}
+
+func (conn *slowQueryConn) IsValid() bool {
+	if v, ok := conn.Conn.(driver.Validator); ok {
+		return v.IsValid()
+	}
+	return true
+}
+
+func (conn *slowQueryConn) CheckNamedValue(nv *driver.NamedValue) error {
+	if c, ok := conn.Conn.(driver.NamedValueChecker); ok {
+		return c.CheckNamedValue(nv)
+	}
+	return driver.ErrSkip
+}
+
+type slowQueryStmt struct {
+	driver.Stmt
+	c     *slowQueryConnector
+	query string
+}
+
+func (stmt *slowQueryStmt) ExecContext(
+	ctx context.Context,
+	args []driver.NamedValue,
+) (driver.Result, error) {
+	start := time.Now()
+	defer stmt.c.observe(ctx, stmt.query, start)
+	if ec, ok := stmt.Stmt.(driver.StmtExecContext); ok {
+		return ec.ExecContext(ctx, args)
+	}
+	values, err := namedValues(args)
+	if err != nil {
+		return nil, err
+	}
+	return stmt.Stmt.Exec(values) //nolint:staticcheck // fallback for drivers without context
+}
+
+func (stmt *slowQueryStmt) QueryContext(
+	ctx context.Context,
+	args []driver.NamedValue,
+) (driver.Rows, error) {
+	start := time.Now()
+	defer stmt.c.observe(ctx, stmt.query, start)
+	if qc, ok := stmt.Stmt.(driver.StmtQueryContext); ok {
+		return qc.QueryContext(ctx, args)
+	}
+	values, err := namedValues(args)
+	if err != nil {
+		return nil, err
+	}
+	return stmt.Stmt.Query(values) //nolint:staticcheck // fallback for drivers without context
+}
+
+func (stmt *slowQueryStmt) CheckNamedValue(nv *driver.NamedValue) error {
+	if c, ok := stmt.Stmt.(driver.NamedValueChecker); ok {
+		return c.CheckNamedValue(nv)
+	}
+	return driver.ErrSkip
+}
+
+func namedValues(args []driver.NamedValue) ([]driver.Value, error) {
+	values := make([]driver.Value, len(args))
+	for i, arg := range args {
+		if arg.Name != "" {
+			return nil, errors.New("db: driver does not support named parameters")
+		}
+		values[i] = arg.Value
+	}
+	return values, nil
+}
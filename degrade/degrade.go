@@ -0,0 +1,345 @@
+// Copyright 2022 The codesjoy Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package degrade sheds optional work in an ordered way when the process is
+// overloaded.
+//
+// Components register degradable features, each with a level: payload
+// logging might go at level 1, long cache lifetimes at level 2 and low
+// priority callers at level 3. A Manager derives the current level from CPU,
+// memory and queue depth thresholds, or takes it from a manual override set
+// through the governor, and degrades every feature whose level has been
+// reached. Level 0 is normal operation.
+//
+// The Manager samples lazily, when a feature is checked, so no goroutine runs
+// in the background.
+package degrade
+
+import (
+	"log/slog"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/codesjoy/yggdrasil/v3/internal/xclock"
+	"github.com/codesjoy/yggdrasil/v3/transport/support/orca"
+)
+
+// Config defines the degradation settings under
+// yggdrasil.server.degradation.
+type Config struct {
+	// Interval is how often the signals are sampled.
+	Interval time.Duration `mapstructure:"interval" default:"1s"`
+	// Cooldown is how long the signals must stay below the thresholds of the
+	// current level before the manager steps down one level.
+	Cooldown time.Duration `mapstructure:"cooldown" default:"30s"`
+	// Levels lists the thresholds of level 1, 2 and so on. A level is
+	// reached when any of its thresholds is.
+	Levels []Thresholds `mapstructure:"levels"`
+	// Features overrides the level of registered features by name. Level 0
+	// never degrades the feature.
+	Features map[string]int `mapstructure:"features"`
+	// AllowOverride enables writes to the governor "/degradation" route,
+	// which overrides the level by hand. Reads are always served.
+	AllowOverride bool `mapstructure:"allow_override"`
+}
+
+// Thresholds are the signal values reaching a level. Zero values are
+// ignored.
+type Thresholds struct {
+	// CPU is the process CPU utilization, between 0 and 1.
+	CPU float64 `mapstructure:"cpu"`
+	// Memory is the utilization of the Go soft memory limit, between 0 and
+	// 1. It is never reached without a limit.
+	Memory float64 `mapstructure:"memory"`
+	// QueueDepth is the number of requests waiting to be handled.
+	QueueDepth int `mapstructure:"queue_depth"`
+}
+
+func (t Thresholds) reached(s Signals) bool {
+	return (t.CPU > 0 && s.CPU >= t.CPU) ||
+		(t.Memory > 0 && s.Memory >= t.Memory) ||
+		(t.QueueDepth > 0 && s.QueueDepth >= t.QueueDepth)
+}
+
+// Signals are the load signals the levels are derived from.
+type Signals struct {
+	CPU        float64 `json:"cpu"`
+	Memory     float64 `json:"memory"`
+	QueueDepth int     `json:"queue_depth"`
+}
+
+// Status is a point-in-time view of a Manager.
+type Status struct {
+	// Level is the effective level.
+	Level int `json:"level"`
+	// Auto is the level derived from the signals.
+	Auto int `json:"auto"`
+	// Override is the manual level replacing Auto, if any.
+	Override *int           `json:"override,omitempty"`
+	Signals  Signals        `json:"signals"`
+	Features []FeatureState `json:"features"`
+}
+
+// FeatureState describes one registered feature.
+type FeatureState struct {
+	Name     string `json:"name"`
+	Level    int    `json:"level"`
+	Degraded bool   `json:"degraded"`
+}
+
+// Feature is a degradable feature registered with a Manager.
+type Feature struct {
+	m     *Manager
+	name  string
+	def   int
+	level atomic.Int32
+}
+
+// Degraded reports whether the feature is degraded. A nil feature never is.
+func (f *Feature) Degraded() bool {
+	if f == nil {
+		return false
+	}
+	level := int(f.level.Load())
+	return level > 0 && f.m.Level() >= level
+}
+
+// Name returns the name of the feature.
+func (f *Feature) Name() string {
+	return f.name
+}
+
+// Manager tracks the degradation level of the process.
+type Manager struct {
+	clock    xclock.Clock
+	level    atomic.Int32
+	next     atomic.Int64
+	interval atomic.Int64
+	sampling atomic.Bool
+
+	mu         sync.Mutex
+	cfg        Config
+	recorder   *orca.Recorder
+	queueDepth func() int
+	features   map[string]*Feature
+	signals    Signals
+	auto       int
+	override   *int
+	calmSince  time.Time
+}
+
+// NewManager returns a Manager configured by cfg.
+func NewManager(cfg Config) *Manager {
+	m := &Manager{clock: xclock.Real(), features: map[string]*Feature{}}
+	m.Configure(cfg)
+	return m
+}
+
+var (
+	defaultOnce    sync.Once
+	defaultManager *Manager
+)
+
+// Default returns the process-wide manager. The builtin features register
+// with it and the server configures it from yggdrasil.server.degradation.
+func Default() *Manager {
+	defaultOnce.Do(func() {
+		defaultManager = NewManager(Config{})
+	})
+	return defaultManager
+}
+
+// Configure applies new settings. The current level is kept until the next
+// sample.
+func (m *Manager) Configure(cfg Config) {
+	if cfg.Interval <= 0 {
+		cfg.Interval = time.Second
+	}
+	if cfg.Cooldown < 0 {
+		cfg.Cooldown = 0
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.cfg = cfg
+	if m.recorder == nil {
+		m.recorder = orca.NewRecorder(orca.Config{Interval: cfg.Interval})
+	} else {
+		m.recorder.Configure(orca.Config{Interval: cfg.Interval})
+	}
+	for _, f := range m.features {
+		f.level.Store(int32(m.featureLevelLocked(f)))
+	}
+	m.interval.Store(int64(cfg.Interval))
+	m.sampling.Store(len(cfg.Levels) > 0)
+	m.next.Store(0)
+}
+
+// SetQueueDepth sets the source of the queue depth signal.
+func (m *Manager) SetQueueDepth(fn func() int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.queueDepth = fn
+}
+
+// Register registers a degradable feature that degrades from level on,
+// unless the configuration overrides it. Registering a name again returns
+// the feature registered first.
+func (m *Manager) Register(name string, level int) *Feature {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if f, ok := m.features[name]; ok {
+		return f
+	}
+	f := &Feature{m: m, name: name, def: max(level, 0)}
+	f.level.Store(int32(m.featureLevelLocked(f)))
+	m.features[name] = f
+	return f
+}
+
+func (m *Manager) featureLevelLocked(f *Feature) int {
+	if level, ok := m.cfg.Features[f.name]; ok {
+		return max(level, 0)
+	}
+	return f.def
+}
+
+// Level returns the effective level, sampling the signals when the previous
+// sample is older than the interval.
+func (m *Manager) Level() int {
+	m.refresh()
+	return int(m.level.Load())
+}
+
+// refresh samples the signals at most once per interval. Concurrent callers
+// skip the sample another caller is taking.
+func (m *Manager) refresh() {
+	if !m.sampling.Load() {
+		return
+	}
+	now := m.clock.Now().UnixNano()
+	next := m.next.Load()
+	if now < next || !m.next.CompareAndSwap(next, now+m.interval.Load()) {
+		return
+	}
+	m.Observe(m.sample())
+}
+
+func (m *Manager) sample() Signals {
+	m.mu.Lock()
+	recorder, queueDepth := m.recorder, m.queueDepth
+	m.mu.Unlock()
+	report := recorder.Report()
+	s := Signals{CPU: report.CPUUtilization, Memory: report.MemUtilization}
+	if queueDepth != nil {
+		s.QueueDepth = queueDepth()
+	}
+	return s
+}
+
+// Observe derives the level from s. The level rises as soon as a threshold
+// is reached and falls one level per cooldown once the signals stay below
+// it. Applications with their own signal sources may call Observe directly.
+func (m *Manager) Observe(s Signals) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.signals = s
+	target := 0
+	for i, t := range m.cfg.Levels {
+		if t.reached(s) {
+			target = i + 1
+		}
+	}
+	now := m.clock.Now()
+	if target >= m.auto {
+		m.auto = target
+		m.calmSince = time.Time{}
+	} else {
+		if m.calmSince.IsZero() {
+			m.calmSince = now
+		}
+		if now.Sub(m.calmSince) >= m.cfg.Cooldown {
+			m.auto--
+			m.calmSince = now
+		}
+	}
+	m.publishLocked("signals")
+}
+
+// Override replaces the level derived from the signals with level until
+// ClearOverride is called.
+func (m *Manager) Override(level int) {
+	level = max(level, 0)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.override = &level
+	m.publishLocked("override")
+}
+
+// ClearOverride returns to the level derived from the signals.
+func (m *Manager) ClearOverride() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.override = nil
+	m.publishLocked("override cleared")
+}
+
+func (m *Manager) publishLocked(reason string) {
+	level := m.auto
+	if m.override != nil {
+		level = *m.override
+	}
+	prev := int(m.level.Swap(int32(level)))
+	if prev == level {
+		return
+	}
+	slog.Warn(
+		"degradation level changed",
+		slog.Int("from", prev),
+		slog.Int("to", level),
+		slog.String("reason", reason),
+		slog.Float64("cpu", m.signals.CPU),
+		slog.Float64("memory", m.signals.Memory),
+		slog.Int("queue_depth", m.signals.QueueDepth),
+	)
+}
+
+// Status returns the current state of the manager.
+func (m *Manager) Status() Status {
+	level := m.Level()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	st := Status{Level: level, Auto: m.auto, Signals: m.signals}
+	if m.override != nil {
+		override := *m.override
+		st.Override = &override
+	}
+	st.Features = make([]FeatureState, 0, len(m.features))
+	for _, f := range m.features {
+		featureLevel := int(f.level.Load())
+		st.Features = append(st.Features, FeatureState{
+			Name:     f.name,
+			Level:    featureLevel,
+			Degraded: featureLevel > 0 && level >= featureLevel,
+		})
+	}
+	sort.Slice(st.Features, func(i, j int) bool {
+		if st.Features[i].Level != st.Features[j].Level {
+			return st.Features[i].Level < st.Features[j].Level
+		}
+		return st.Features[i].Name < st.Features[j].Name
+	})
+	return st
+}
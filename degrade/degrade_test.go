@@ -0,0 +1,191 @@
+// Copyright 2022 The codesjoy Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package degrade
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/codesjoy/yggdrasil/v3/internal/xclock"
+)
+
+func newTestManager(cfg Config) (*Manager, *xclock.Fake) {
+	clock := xclock.NewFake(time.Unix(0, 0))
+	m := NewManager(cfg)
+	m.clock = clock
+	return m, clock
+}
+
+func TestManagerLevels(t *testing.T) {
+	m, clock := newTestManager(Config{
+		Cooldown: 10 * time.Second,
+		Levels: []Thresholds{
+			{CPU: 0.7, QueueDepth: 100},
+			{CPU: 0.9, Memory: 0.9},
+		},
+	})
+	logs := m.Register("logs", 1)
+	cache := m.Register("cache", 2)
+	assert.Same(t, logs, m.Register("logs", 3))
+
+	m.Observe(Signals{CPU: 0.5, QueueDepth: 10})
+	assert.Equal(t, 0, m.Level())
+	assert.False(t, logs.Degraded())
+
+	m.Observe(Signals{CPU: 0.2, QueueDepth: 150})
+	assert.Equal(t, 1, m.Level())
+	assert.True(t, logs.Degraded())
+	assert.False(t, cache.Degraded())
+
+	m.Observe(Signals{Memory: 0.95})
+	assert.Equal(t, 2, m.Level())
+	assert.True(t, cache.Degraded())
+
+	// Calm signals step down one level per cooldown.
+	m.Observe(Signals{})
+	assert.Equal(t, 2, m.Level())
+	clock.Advance(9 * time.Second)
+	m.Observe(Signals{})
+	assert.Equal(t, 2, m.Level())
+	clock.Advance(time.Second)
+	m.Observe(Signals{})
+	assert.Equal(t, 1, m.Level())
+	assert.True(t, logs.Degraded())
+	assert.False(t, cache.Degraded())
+
+	// Load in between restarts the cooldown.
+	clock.Advance(5 * time.Second)
+	m.Observe(Signals{CPU: 0.8})
+	clock.Advance(5 * time.Second)
+	m.Observe(Signals{})
+	assert.Equal(t, 1, m.Level())
+	clock.Advance(10 * time.Second)
+	m.Observe(Signals{})
+	assert.Equal(t, 0, m.Level())
+	assert.False(t, logs.Degraded())
+}
+
+func TestManagerSamplesLazily(t *testing.T) {
+	m, clock := newTestManager(Config{
+		Interval: time.Second,
+		Levels:   []Thresholds{{QueueDepth: 10}},
+	})
+	depth := 20
+	m.SetQueueDepth(func() int { return depth })
+	assert.Equal(t, 1, m.Level())
+
+	depth = 0
+	assert.Equal(t, 1, m.Level(), "sampled at most once per interval")
+	clock.Advance(time.Second)
+	assert.Equal(t, 0, m.Level())
+	assert.Equal(t, Signals{}, m.Status().Signals)
+}
+
+func TestManagerWithoutLevelsNeverSamples(t *testing.T) {
+	m, _ := newTestManager(Config{})
+	m.SetQueueDepth(func() int {
+		t.Fatal("queue depth sampled without levels")
+		return 0
+	})
+	assert.Equal(t, 0, m.Level())
+}
+
+func TestManagerOverride(t *testing.T) {
+	m, _ := newTestManager(Config{Levels: []Thresholds{{CPU: 0.5}}})
+	f := m.Register("feature", 3)
+	m.Override(3)
+	assert.Equal(t, 3, m.Level())
+	assert.True(t, f.Degraded())
+
+	m.Observe(Signals{CPU: 0.6})
+	assert.Equal(t, 3, m.Level(), "the override wins over the signals")
+	m.ClearOverride()
+	assert.Equal(t, 1, m.Level())
+	assert.False(t, f.Degraded())
+}
+
+func TestManagerFeatureOverrides(t *testing.T) {
+	m, _ := newTestManager(Config{Features: map[string]int{"logs": 0}})
+	logs := m.Register("logs", 1)
+	cache := m.Register("cache", 2)
+	m.Override(5)
+	assert.False(t, logs.Degraded(), "level 0 never degrades")
+	assert.True(t, cache.Degraded())
+
+	m.Configure(Config{Features: map[string]int{"cache": 6}})
+	assert.True(t, logs.Degraded())
+	assert.False(t, cache.Degraded())
+
+	var nilFeature *Feature
+	assert.False(t, nilFeature.Degraded())
+}
+
+func TestServeHTTP(t *testing.T) {
+	m, _ := newTestManager(Config{AllowOverride: true})
+	m.Register("logs", 1)
+	m.Register("cache", 2)
+
+	serve := func(method, body string) (*httptest.ResponseRecorder, Status) {
+		rec := httptest.NewRecorder()
+		m.ServeHTTP(rec, httptest.NewRequest(method, "/degradation", strings.NewReader(body)))
+		var st Status
+		if rec.Code == http.StatusOK {
+			require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &st))
+		}
+		return rec, st
+	}
+
+	rec, st := serve(http.MethodPost, `{"level": 1}`)
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, 1, st.Level)
+	require.NotNil(t, st.Override)
+	assert.Equal(t, []FeatureState{
+		{Name: "logs", Level: 1, Degraded: true},
+		{Name: "cache", Level: 2},
+	}, st.Features)
+
+	_, st = serve(http.MethodDelete, "")
+	assert.Equal(t, 0, st.Level)
+	assert.Nil(t, st.Override)
+
+	rec, _ = serve(http.MethodPut, `{"level": -1}`)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	rec, _ = serve(http.MethodPut, `{}`)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	rec, _ = serve(http.MethodPatch, "")
+	assert.Equal(t, http.StatusMethodNotAllowed, rec.Code)
+}
+
+func TestServeHTTPRejectsWritesByDefault(t *testing.T) {
+	m, _ := newTestManager(Config{})
+
+	for _, method := range []string{http.MethodPost, http.MethodPut, http.MethodDelete} {
+		rec := httptest.NewRecorder()
+		m.ServeHTTP(rec, httptest.NewRequest(method, "/degradation", strings.NewReader(`{"level": 1}`)))
+		assert.Equal(t, http.StatusForbidden, rec.Code, method)
+	}
+	assert.Equal(t, 0, m.Level())
+
+	rec := httptest.NewRecorder()
+	m.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/degradation", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+}
@@ -0,0 +1,73 @@
+// Copyright 2022 The codesjoy Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package degrade
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+)
+
+var errOverrideDisabled = errors.New("degradation override is disabled")
+
+// ServeHTTP serves the manager on the governor. GET returns the Status, POST
+// and PUT take {"level": n} to override the level, and DELETE clears the
+// override. Writes are rejected unless Config.AllowOverride is set.
+func (m *Manager) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && !m.allowOverride() {
+		writeError(w, http.StatusForbidden, errOverrideDisabled)
+		return
+	}
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPost, http.MethodPut:
+		var req struct {
+			Level *int `json:"level"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		if req.Level == nil || *req.Level < 0 {
+			writeError(w, http.StatusBadRequest, errors.New("level must be a non-negative integer"))
+			return
+		}
+		m.Override(*req.Level)
+	case http.MethodDelete:
+		m.ClearOverride()
+	default:
+		w.Header().Set("Allow", "GET, POST, PUT, DELETE")
+		writeError(w, http.StatusMethodNotAllowed, errors.New("method not allowed"))
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	encoder := json.NewEncoder(w)
+	if r.URL.Query().Get("pretty") == "true" {
+		encoder.SetIndent("", "    ")
+	}
+	_ = encoder.Encode(m.Status())
+}
+
+func (m *Manager) allowOverride() bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.cfg.AllowOverride
+}
+
+// writeError writes err in the shape of the governor error responses.
+func writeError(w http.ResponseWriter, code int, err error) {
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(map[string]any{"code": code, "msg": err.Error()})
+}
@@ -27,6 +27,23 @@ import (
 const (
 	// MDServerKind is the key for server kind metadata
 	MDServerKind = "serverKind"
+	// MDServices is the key for the comma-separated RPC services served by an
+	// endpoint
+	MDServices = "services"
+	// MDRegion is the key for the region an endpoint is deployed in
+	MDRegion = "region"
+	// MDZone is the key for the zone an endpoint is deployed in
+	MDZone = "zone"
+	// MDVersion is the key for the version an endpoint runs
+	MDVersion = "version"
+	// MDCanary is the key flagging canary endpoints, "true" when set
+	MDCanary = "canary"
+	// MDWeight is the key for the non-negative integer load-balancing weight
+	// of an endpoint
+	MDWeight = "weight"
+	// MDCapabilities is the key for the comma-separated protocol capabilities
+	// of an endpoint, e.g. "compression,streaming"
+	MDCapabilities = "capabilities"
 )
 
 // Spec describes a registry extension envelope.
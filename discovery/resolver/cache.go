@@ -0,0 +1,323 @@
+// Copyright 2022 The codesjoy Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package resolver
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/codesjoy/yggdrasil/v3/internal/xclock"
+)
+
+const defaultNegativeTTL = 5 * time.Second
+
+// CacheConfig configures the on-disk cache of resolved endpoints.
+type CacheConfig struct {
+	// Dir enables the cache; the last-known good state of every watched
+	// application is persisted below it.
+	Dir string `mapstructure:"dir"`
+	// TTL bounds the age of a persisted state that may still be served.
+	// Zero serves persisted states of any age.
+	TTL time.Duration `mapstructure:"ttl"`
+	// NegativeTTL is how long a failed watch is remembered: watches of the
+	// same application fail over to the cache without contacting the
+	// registry, and the failed watch is retried after it elapses.
+	// Defaults to 5s.
+	NegativeTTL time.Duration `mapstructure:"negative_ttl"`
+}
+
+// WithCache wraps r with the on-disk cache described by cfg. It returns r
+// unchanged when the cache is disabled.
+func WithCache(r Resolver, name string, cfg CacheConfig) Resolver {
+	if r == nil || cfg.Dir == "" {
+		return r
+	}
+	if cfg.NegativeTTL <= 0 {
+		cfg.NegativeTTL = defaultNegativeTTL
+	}
+	return &cachingResolver{
+		inner:    r,
+		name:     name,
+		cfg:      cfg,
+		watchers: map[watchKey]*cacheWatcher{},
+		failures: map[string]watchFailure{},
+		clock:    xclock.Real(),
+	}
+}
+
+type watchKey struct {
+	appName string
+	client  Client
+}
+
+type watchFailure struct {
+	err   error
+	until time.Time
+}
+
+// cachingResolver persists the states pushed by the wrapped resolver and
+// serves them when the wrapped resolver cannot establish a watch.
+type cachingResolver struct {
+	inner Resolver
+	name  string
+	cfg   CacheConfig
+
+	mu       sync.Mutex
+	watchers map[watchKey]*cacheWatcher
+	failures map[string]watchFailure
+	clock    xclock.Clock
+}
+
+// AddWatch watches appName through the wrapped resolver, falling back to the
+// persisted state when the watch fails.
+func (r *cachingResolver) AddWatch(appName string, cli Client) error {
+	w := &cacheWatcher{owner: r, appName: appName, client: cli}
+	key := watchKey{appName: appName, client: cli}
+	r.mu.Lock()
+	if _, ok := r.watchers[key]; ok {
+		r.mu.Unlock()
+		return nil
+	}
+	r.watchers[key] = w
+	failure, failed := r.failures[appName]
+	r.mu.Unlock()
+
+	if failed && r.clock.Now().Before(failure.until) {
+		return r.fallback(w, failure.err)
+	}
+	if err := r.inner.AddWatch(appName, w); err != nil {
+		r.mu.Lock()
+		r.failures[appName] = watchFailure{err: err, until: r.clock.Now().Add(r.cfg.NegativeTTL)}
+		r.mu.Unlock()
+		return r.fallback(w, err)
+	}
+	w.setWatching()
+	if failed {
+		r.mu.Lock()
+		delete(r.failures, appName)
+		r.mu.Unlock()
+	}
+	return nil
+}
+
+// DelWatch stops watching appName for cli.
+func (r *cachingResolver) DelWatch(appName string, cli Client) error {
+	key := watchKey{appName: appName, client: cli}
+	r.mu.Lock()
+	w, ok := r.watchers[key]
+	delete(r.watchers, key)
+	r.mu.Unlock()
+	if !ok {
+		return nil
+	}
+	if w.close() {
+		return r.inner.DelWatch(appName, w)
+	}
+	return nil
+}
+
+// Type returns the type of the wrapped resolver.
+func (r *cachingResolver) Type() string {
+	return r.inner.Type()
+}
+
+// ResolveNow forwards to the wrapped resolver when it supports it.
+func (r *cachingResolver) ResolveNow() {
+	if rn, ok := r.inner.(ResolveNower); ok {
+		rn.ResolveNow()
+	}
+}
+
+func (r *cachingResolver) fallback(w *cacheWatcher, watchErr error) error {
+	state, ok := r.load(w.appName)
+	if !ok {
+		r.mu.Lock()
+		delete(r.watchers, watchKey{appName: w.appName, client: w.client})
+		r.mu.Unlock()
+		return watchErr
+	}
+	slog.Warn("resolver watch failed, serving cached endpoints",
+		slog.String("resolver", r.name),
+		slog.String("app", w.appName),
+		slog.Int("endpoints", len(state.Endpoints)),
+		slog.Any("error", watchErr))
+	w.client.UpdateState(state)
+	w.scheduleRetry(r.cfg.NegativeTTL)
+	return nil
+}
+
+type cachedState struct {
+	UpdatedAt  time.Time      `json:"updated_at"`
+	Attributes map[string]any `json:"attributes,omitempty"`
+	Endpoints  []BaseEndpoint `json:"endpoints"`
+}
+
+func (r *cachingResolver) path(appName string) string {
+	return filepath.Join(r.cfg.Dir, url.PathEscape(r.name), url.PathEscape(appName)+".json")
+}
+
+func (r *cachingResolver) load(appName string) (BaseState, bool) {
+	data, err := os.ReadFile(r.path(appName))
+	if err != nil {
+		return BaseState{}, false
+	}
+	var cached cachedState
+	if err := json.Unmarshal(data, &cached); err != nil {
+		slog.Warn("ignore malformed resolver cache",
+			slog.String("path", r.path(appName)),
+			slog.Any("error", err))
+		return BaseState{}, false
+	}
+	if r.cfg.TTL > 0 && r.clock.Since(cached.UpdatedAt) > r.cfg.TTL {
+		return BaseState{}, false
+	}
+	if len(cached.Endpoints) == 0 {
+		return BaseState{}, false
+	}
+	state := BaseState{Attributes: cached.Attributes}
+	for _, item := range cached.Endpoints {
+		state.Endpoints = append(state.Endpoints, item)
+	}
+	return state, true
+}
+
+func (r *cachingResolver) store(appName string, state State) error {
+	cached := cachedState{UpdatedAt: r.clock.Now(), Attributes: state.GetAttributes()}
+	for _, item := range state.GetEndpoints() {
+		if item == nil {
+			continue
+		}
+		cached.Endpoints = append(cached.Endpoints, BaseEndpoint{
+			Address:    item.GetAddress(),
+			Protocol:   item.GetProtocol(),
+			Attributes: item.GetAttributes(),
+		})
+	}
+	if len(cached.Endpoints) == 0 {
+		return nil
+	}
+	data, err := json.Marshal(cached)
+	if err != nil {
+		return err
+	}
+	path := r.path(appName)
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".resolver-cache-*")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		_ = tmp.Close()
+		_ = os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		_ = os.Remove(tmp.Name())
+		return err
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		_ = os.Remove(tmp.Name())
+		return fmt.Errorf("persist resolver cache: %w", err)
+	}
+	return nil
+}
+
+// cacheWatcher is the Client registered with the wrapped resolver. It
+// persists every pushed state before forwarding it.
+type cacheWatcher struct {
+	owner   *cachingResolver
+	appName string
+	client  Client
+
+	mu       sync.Mutex
+	watching bool
+	closed   bool
+	retry    xclock.Timer
+}
+
+// UpdateState persists and forwards the state.
+func (w *cacheWatcher) UpdateState(state State) {
+	if err := w.owner.store(w.appName, state); err != nil {
+		slog.Warn("fault to persist resolver cache",
+			slog.String("resolver", w.owner.name),
+			slog.String("app", w.appName),
+			slog.Any("error", err))
+	}
+	w.client.UpdateState(state)
+}
+
+func (w *cacheWatcher) setWatching() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.watching = true
+}
+
+// close stops pending retries and reports whether the wrapped resolver
+// holds a watch to delete.
+func (w *cacheWatcher) close() bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.closed = true
+	if w.retry != nil {
+		w.retry.Stop()
+	}
+	return w.watching
+}
+
+func (w *cacheWatcher) scheduleRetry(delay time.Duration) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.closed {
+		return
+	}
+	w.retry = w.owner.clock.AfterFunc(delay, w.retryWatch)
+}
+
+func (w *cacheWatcher) retryWatch() {
+	w.mu.Lock()
+	if w.closed || w.watching {
+		w.mu.Unlock()
+		return
+	}
+	w.mu.Unlock()
+
+	if err := w.owner.inner.AddWatch(w.appName, w); err != nil {
+		slog.Debug("retry resolver watch failed",
+			slog.String("resolver", w.owner.name),
+			slog.String("app", w.appName),
+			slog.Any("error", err))
+		w.scheduleRetry(w.owner.cfg.NegativeTTL)
+		return
+	}
+	w.mu.Lock()
+	closed := w.closed
+	w.watching = !closed
+	w.mu.Unlock()
+	if closed {
+		_ = w.owner.inner.DelWatch(w.appName, w)
+		return
+	}
+	w.owner.mu.Lock()
+	delete(w.owner.failures, w.appName)
+	w.owner.mu.Unlock()
+}
@@ -0,0 +1,202 @@
+// Copyright 2022 The codesjoy Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package resolver
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/codesjoy/yggdrasil/v3/internal/xclock"
+)
+
+type flakyResolver struct {
+	mu       sync.Mutex
+	err      error
+	adds     int
+	dels     int
+	watchers map[string]Client
+}
+
+func (f *flakyResolver) AddWatch(appName string, cli Client) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.adds++
+	if f.err != nil {
+		return f.err
+	}
+	if f.watchers == nil {
+		f.watchers = map[string]Client{}
+	}
+	f.watchers[appName] = cli
+	return nil
+}
+
+func (f *flakyResolver) DelWatch(appName string, _ Client) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.dels++
+	delete(f.watchers, appName)
+	return nil
+}
+
+func (f *flakyResolver) Type() string { return "flaky" }
+
+func (f *flakyResolver) setErr(err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.err = err
+}
+
+func (f *flakyResolver) counts() (int, int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.adds, f.dels
+}
+
+func (f *flakyResolver) push(appName string, state State) {
+	f.mu.Lock()
+	cli := f.watchers[appName]
+	f.mu.Unlock()
+	cli.UpdateState(state)
+}
+
+type recordingClient struct {
+	mu     sync.Mutex
+	states []State
+}
+
+func (c *recordingClient) UpdateState(state State) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.states = append(c.states, state)
+}
+
+func (c *recordingClient) last() State {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.states) == 0 {
+		return nil
+	}
+	return c.states[len(c.states)-1]
+}
+
+var errRegistryDown = errors.New("registry unreachable")
+
+func TestCacheServesPersistedStateWhenRegistryIsDown(t *testing.T) {
+	dir := t.TempDir()
+	cfg := CacheConfig{Dir: dir, NegativeTTL: time.Hour}
+
+	healthy := &flakyResolver{}
+	r := WithCache(healthy, "demo", cfg)
+	cli := &recordingClient{}
+	require.NoError(t, r.AddWatch("users", cli))
+	healthy.push("users", BaseState{Endpoints: []Endpoint{BaseEndpoint{
+		Address:    "10.0.0.1:9000",
+		Protocol:   "grpc",
+		Attributes: map[string]any{"weight": 3},
+	}}})
+	require.NotNil(t, cli.last())
+	assert.FileExists(t, filepath.Join(dir, "demo", "users.json"))
+	require.NoError(t, r.DelWatch("users", cli))
+	_, dels := healthy.counts()
+	assert.Equal(t, 1, dels)
+
+	down := &flakyResolver{err: errRegistryDown}
+	r = WithCache(down, "demo", cfg)
+	cli = &recordingClient{}
+	require.NoError(t, r.AddWatch("users", cli))
+	state := cli.last()
+	require.NotNil(t, state)
+	require.Len(t, state.GetEndpoints(), 1)
+	assert.Equal(t, "grpc/10.0.0.1:9000", state.GetEndpoints()[0].Name())
+	assert.Equal(t, 3, Weight(state.GetEndpoints()[0]))
+	require.NoError(t, r.DelWatch("users", cli))
+	_, dels = down.counts()
+	assert.Zero(t, dels, "no watch was established")
+}
+
+func TestCacheNegativeCachingWithoutPersistedState(t *testing.T) {
+	down := &flakyResolver{err: errRegistryDown}
+	r := WithCache(down, "demo", CacheConfig{Dir: t.TempDir(), NegativeTTL: time.Hour})
+	clock := xclock.NewFake(time.Unix(100, 0))
+	r.(*cachingResolver).clock = clock
+
+	require.ErrorIs(t, r.AddWatch("users", &recordingClient{}), errRegistryDown)
+	require.ErrorIs(t, r.AddWatch("users", &recordingClient{}), errRegistryDown)
+	adds, _ := down.counts()
+	assert.Equal(t, 1, adds, "failure must be cached")
+
+	clock.Advance(time.Hour)
+	require.ErrorIs(t, r.AddWatch("users", &recordingClient{}), errRegistryDown)
+	adds, _ = down.counts()
+	assert.Equal(t, 2, adds, "cached failure must expire")
+}
+
+func TestCacheIgnoresExpiredState(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "demo", "users.json")
+	require.NoError(t, os.MkdirAll(filepath.Dir(path), 0o755))
+	require.NoError(t, os.WriteFile(path, []byte(
+		`{"updated_at":"2020-01-01T00:00:00Z","endpoints":[{"Address":"a:1","Protocol":"grpc"}]}`,
+	), 0o600))
+
+	down := &flakyResolver{err: errRegistryDown}
+	r := WithCache(down, "demo", CacheConfig{Dir: dir, TTL: time.Minute})
+	require.ErrorIs(t, r.AddWatch("users", &recordingClient{}), errRegistryDown)
+
+	r = WithCache(down, "other", CacheConfig{Dir: dir})
+	require.ErrorIs(t, r.AddWatch("users", &recordingClient{}), errRegistryDown)
+}
+
+func TestCacheRetriesFailedWatch(t *testing.T) {
+	dir := t.TempDir()
+	cfg := CacheConfig{Dir: dir, NegativeTTL: time.Minute}
+	inner := &flakyResolver{}
+	r := WithCache(inner, "demo", cfg)
+	clock := xclock.NewFake(time.Unix(100, 0))
+	r.(*cachingResolver).clock = clock
+	cli := &recordingClient{}
+	require.NoError(t, r.AddWatch("users", cli))
+	inner.push("users", BaseState{Endpoints: []Endpoint{BaseEndpoint{Address: "a:1"}}})
+	require.NoError(t, r.DelWatch("users", cli))
+
+	inner.setErr(errRegistryDown)
+	cli = &recordingClient{}
+	require.NoError(t, r.AddWatch("users", cli))
+	inner.setErr(nil)
+	clock.Advance(time.Minute)
+	inner.mu.Lock()
+	require.NotNil(t, inner.watchers["users"], "watch is retried after the negative TTL")
+	inner.mu.Unlock()
+
+	inner.push("users", BaseState{Endpoints: []Endpoint{BaseEndpoint{Address: "b:1"}}})
+	assert.Equal(t, "b:1", cli.last().GetEndpoints()[0].GetAddress())
+	require.NoError(t, r.DelWatch("users", cli))
+	_, dels := inner.counts()
+	assert.Equal(t, 2, dels)
+}
+
+func TestWithCacheDisabled(t *testing.T) {
+	inner := &flakyResolver{}
+	assert.Same(t, inner, WithCache(inner, "demo", CacheConfig{}))
+	assert.Nil(t, WithCache(nil, "demo", CacheConfig{Dir: t.TempDir()}))
+}
@@ -0,0 +1,455 @@
+// Copyright 2022 The codesjoy Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package dns implements a resolver for dns:///host:port targets.
+//
+// Host names are resolved to their A and AAAA records. Names starting with
+// an underscore, such as _grpc._tcp.my-svc.ns.svc.cluster.local, are looked
+// up as SRV records instead, taking the port of every endpoint from its
+// record. Targets are re-resolved periodically with jitter, and failed
+// lookups are retried with exponential backoff while the last resolved
+// endpoints stay in place. Concurrent lookups of the same name by different
+// targets, e.g. the same host on several ports, share one DNS query.
+package dns
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/rand/v2"
+	"net"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/codesjoy/yggdrasil/v3/config"
+	"github.com/codesjoy/yggdrasil/v3/discovery/registry"
+	"github.com/codesjoy/yggdrasil/v3/discovery/resolver"
+	"github.com/codesjoy/yggdrasil/v3/internal/backoff"
+	"github.com/codesjoy/yggdrasil/v3/internal/xsync"
+)
+
+const (
+	// Scheme is the target scheme and the provider type of the resolver.
+	Scheme = "dns"
+	// DefaultPort is used for host names without a port.
+	DefaultPort = "443"
+	// AttrHost is the endpoint attribute carrying the resolved host name.
+	AttrHost = "dns.host"
+)
+
+// Config is the config envelope of a dns resolver spec.
+type Config struct {
+	// RefreshInterval is the period of re-resolution.
+	RefreshInterval time.Duration `mapstructure:"refresh_interval" default:"30s"`
+	// Jitter randomizes every refresh interval by up to this fraction.
+	Jitter float64 `mapstructure:"jitter" default:"0.2"`
+	// Timeout bounds one resolution.
+	Timeout time.Duration `mapstructure:"timeout" default:"10s"`
+	// Protocol is the transport protocol of resolved endpoints.
+	Protocol string `mapstructure:"protocol" default:"grpc"`
+	// Backoff paces retries of failed resolutions.
+	Backoff backoff.Config `mapstructure:"backoff"`
+}
+
+// Lookuper is the subset of net.Resolver used by the resolver.
+type Lookuper interface {
+	LookupHost(ctx context.Context, host string) ([]string, error)
+	LookupSRV(ctx context.Context, service, proto, name string) (string, []*net.SRV, error)
+}
+
+// Provider returns the dns resolver provider.
+func Provider() resolver.Provider {
+	return resolver.NewConfigProvider(
+		Scheme,
+		func(_ string, cfg map[string]any) (resolver.Resolver, error) {
+			var c Config
+			if err := config.NewSnapshot(cfg).Decode(&c); err != nil {
+				return nil, fmt.Errorf("load dns resolver config: %w", err)
+			}
+			return New(c, nil), nil
+		},
+	)
+}
+
+// New returns a dns resolver. A nil lookuper uses net.DefaultResolver, or a
+// resolver querying the authority of dns://authority/host targets.
+func New(cfg Config, lookuper Lookuper) resolver.Resolver {
+	if cfg.Backoff.BaseDelay <= 0 {
+		cfg.Backoff = backoff.DefaultConfig
+	}
+	if cfg.Protocol == "" {
+		cfg.Protocol = "grpc"
+	}
+	return &dnsResolver{
+		cfg:      cfg,
+		lookuper: lookuper,
+		lookups:  &lookupGroup{},
+		watches:  map[string]*watch{},
+	}
+}
+
+// Target is a parsed dns target.
+type Target struct {
+	// Authority is the address of the DNS server to query; empty for the
+	// system resolver.
+	Authority string
+	Host      string
+	Port      string
+}
+
+// SRV reports whether the target names SRV records.
+func (t Target) SRV() bool {
+	return strings.HasPrefix(t.Host, "_")
+}
+
+// ParseTarget parses dns:///host[:port], dns://authority/host[:port] and
+// bare host[:port] targets.
+func ParseTarget(target string) (Target, error) {
+	var out Target
+	hostport := target
+	if strings.HasPrefix(target, Scheme+":") {
+		u, err := url.Parse(target)
+		if err != nil {
+			return Target{}, fmt.Errorf("parse dns target %q: %w", target, err)
+		}
+		out.Authority = u.Host
+		hostport = strings.TrimPrefix(u.Path, "/")
+		if hostport == "" {
+			hostport = u.Opaque
+		}
+	}
+	if hostport == "" {
+		return Target{}, fmt.Errorf("dns target %q has no host", target)
+	}
+	host, port, err := net.SplitHostPort(hostport)
+	if err != nil {
+		host, port = strings.Trim(hostport, "[]"), ""
+	}
+	if host == "" {
+		return Target{}, fmt.Errorf("dns target %q has no host", target)
+	}
+	if port == "" {
+		port = DefaultPort
+	}
+	out.Host, out.Port = host, port
+	return out, nil
+}
+
+type dnsResolver struct {
+	cfg      Config
+	lookuper Lookuper
+	lookups  *lookupGroup
+
+	mu      sync.Mutex
+	watches map[string]*watch
+}
+
+// lookupGroup deduplicates concurrent lookups keyed by authority and name.
+type lookupGroup struct {
+	hosts xsync.Group[string, []string]
+	srvs  xsync.Group[string, []*net.SRV]
+}
+
+// AddWatch resolves appName as a dns target and keeps it resolved until
+// the last client is removed.
+func (r *dnsResolver) AddWatch(appName string, cli resolver.Client) error {
+	target, err := ParseTarget(appName)
+	if err != nil {
+		return err
+	}
+	r.mu.Lock()
+	w, ok := r.watches[appName]
+	if !ok {
+		w = r.newWatch(target)
+		r.watches[appName] = w
+		go w.run()
+	}
+	r.mu.Unlock()
+	w.addClient(cli)
+	return nil
+}
+
+// DelWatch removes cli from the watch of appName.
+func (r *dnsResolver) DelWatch(appName string, cli resolver.Client) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	w, ok := r.watches[appName]
+	if !ok {
+		return nil
+	}
+	if w.delClient(cli) == 0 {
+		delete(r.watches, appName)
+		w.cancel()
+	}
+	return nil
+}
+
+// Type returns the type of the resolver.
+func (r *dnsResolver) Type() string {
+	return Scheme
+}
+
+// ResolveNow re-resolves every watched target.
+func (r *dnsResolver) ResolveNow() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, w := range r.watches {
+		select {
+		case w.resolveNow <- struct{}{}:
+		default:
+		}
+	}
+}
+
+func (r *dnsResolver) newWatch(target Target) *watch {
+	ctx, cancel := context.WithCancel(context.Background())
+	lookuper := r.lookuper
+	if lookuper == nil {
+		lookuper = newLookuper(target.Authority)
+	}
+	return &watch{
+		cfg:        r.cfg,
+		target:     target,
+		lookuper:   lookuper,
+		lookups:    r.lookups,
+		ctx:        ctx,
+		cancel:     cancel,
+		resolveNow: make(chan struct{}, 1),
+	}
+}
+
+func newLookuper(authority string) Lookuper {
+	if authority == "" {
+		return net.DefaultResolver
+	}
+	if _, _, err := net.SplitHostPort(authority); err != nil {
+		authority = net.JoinHostPort(authority, "53")
+	}
+	return &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, network, _ string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, network, authority)
+		},
+	}
+}
+
+type watch struct {
+	cfg        Config
+	target     Target
+	lookuper   Lookuper
+	lookups    *lookupGroup
+	ctx        context.Context
+	cancel     context.CancelFunc
+	resolveNow chan struct{}
+
+	mu      sync.Mutex
+	clients []resolver.Client
+	state   resolver.State
+}
+
+func (w *watch) addClient(cli resolver.Client) {
+	w.mu.Lock()
+	w.clients = append(w.clients, cli)
+	state := w.state
+	w.mu.Unlock()
+	if state != nil {
+		cli.UpdateState(state)
+	}
+}
+
+func (w *watch) delClient(cli resolver.Client) int {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.clients = slices.DeleteFunc(w.clients, func(c resolver.Client) bool {
+		return c == cli
+	})
+	return len(w.clients)
+}
+
+func (w *watch) run() {
+	strategy := backoff.Exponential{Config: w.cfg.Backoff}
+	retries := 0
+	var last []string
+	for {
+		endpoints, err := w.resolve()
+		var wait time.Duration
+		if err != nil {
+			slog.Warn("fault to resolve dns target",
+				slog.String("host", w.target.Host),
+				slog.Any("error", err))
+			wait = strategy.Backoff(retries)
+			retries++
+		} else {
+			retries = 0
+			wait = w.refreshInterval()
+			if names := endpointNames(endpoints); last == nil || !slices.Equal(names, last) {
+				last = names
+				w.publish(endpoints)
+			}
+		}
+		// A literal IP never changes.
+		if err == nil && net.ParseIP(w.target.Host) != nil {
+			<-w.ctx.Done()
+			return
+		}
+		timer := time.NewTimer(wait)
+		select {
+		case <-w.ctx.Done():
+			timer.Stop()
+			return
+		case <-w.resolveNow:
+			timer.Stop()
+		case <-timer.C:
+		}
+	}
+}
+
+func (w *watch) refreshInterval() time.Duration {
+	interval := w.cfg.RefreshInterval
+	if interval <= 0 {
+		interval = 30 * time.Second
+	}
+	if w.cfg.Jitter > 0 {
+		// #nosec G404 - jitter does not require cryptographic randomness
+		interval = time.Duration(float64(interval) * (1 + w.cfg.Jitter*(rand.Float64()*2-1)))
+	}
+	return interval
+}
+
+func (w *watch) resolve() ([]resolver.Endpoint, error) {
+	if net.ParseIP(w.target.Host) != nil {
+		return []resolver.Endpoint{w.endpoint(w.target.Host, w.target.Port, nil)}, nil
+	}
+	if w.target.SRV() {
+		return w.resolveSRV()
+	}
+	addrs, err := w.lookupHost(w.target.Host)
+	if err != nil {
+		return nil, err
+	}
+	endpoints := make([]resolver.Endpoint, 0, len(addrs))
+	for _, addr := range addrs {
+		endpoints = append(endpoints, w.endpoint(addr, w.target.Port, nil))
+	}
+	return endpoints, nil
+}
+
+// resolveSRV resolves the records of the most preferred SRV priority.
+func (w *watch) resolveSRV() ([]resolver.Endpoint, error) {
+	records, err := w.lookupSRV(w.target.Host)
+	if err != nil {
+		return nil, err
+	}
+	if len(records) == 0 {
+		return nil, errors.New("no srv records")
+	}
+	priority := records[0].Priority
+	for _, record := range records {
+		priority = min(priority, record.Priority)
+	}
+	var (
+		endpoints []resolver.Endpoint
+		lookupErr error
+	)
+	for _, record := range records {
+		if record.Priority != priority {
+			continue
+		}
+		host := strings.TrimSuffix(record.Target, ".")
+		addrs, err := w.lookupHost(host)
+		if err != nil {
+			lookupErr = errors.Join(lookupErr, err)
+			continue
+		}
+		port := strconv.Itoa(int(record.Port))
+		attrs := map[string]any{AttrHost: host}
+		if record.Weight > 0 {
+			attrs[registry.MDWeight] = int(record.Weight)
+		}
+		for _, addr := range addrs {
+			endpoints = append(endpoints, w.endpoint(addr, port, attrs))
+		}
+	}
+	if len(endpoints) == 0 && lookupErr != nil {
+		return nil, lookupErr
+	}
+	return endpoints, nil
+}
+
+// lookupContext bounds one lookup. Lookups are shared between watches, so
+// they are not canceled with the watch that started them.
+func (w *watch) lookupContext() (context.Context, context.CancelFunc) {
+	if w.cfg.Timeout > 0 {
+		return context.WithTimeout(context.Background(), w.cfg.Timeout)
+	}
+	return context.WithCancel(context.Background())
+}
+
+func (w *watch) lookupHost(host string) ([]string, error) {
+	addrs, err, _ := w.lookups.hosts.Do(w.target.Authority+"/"+host, func() ([]string, error) {
+		ctx, cancel := w.lookupContext()
+		defer cancel()
+		return w.lookuper.LookupHost(ctx, host)
+	})
+	return addrs, err
+}
+
+func (w *watch) lookupSRV(name string) ([]*net.SRV, error) {
+	records, err, _ := w.lookups.srvs.Do(w.target.Authority+"/"+name, func() ([]*net.SRV, error) {
+		ctx, cancel := w.lookupContext()
+		defer cancel()
+		_, records, err := w.lookuper.LookupSRV(ctx, "", "", name)
+		return records, err
+	})
+	return records, err
+}
+
+func (w *watch) endpoint(addr, port string, attrs map[string]any) resolver.Endpoint {
+	out := map[string]any{AttrHost: w.target.Host}
+	for k, v := range attrs {
+		out[k] = v
+	}
+	return resolver.BaseEndpoint{
+		Address:    net.JoinHostPort(addr, port),
+		Protocol:   w.cfg.Protocol,
+		Attributes: out,
+	}
+}
+
+func endpointNames(endpoints []resolver.Endpoint) []string {
+	names := make([]string, 0, len(endpoints))
+	for _, ep := range endpoints {
+		weight := ep.GetAttributes()[registry.MDWeight]
+		names = append(names, fmt.Sprintf("%s#%v", ep.Name(), weight))
+	}
+	slices.Sort(names)
+	return names
+}
+
+func (w *watch) publish(endpoints []resolver.Endpoint) {
+	state := resolver.BaseState{Attributes: map[string]any{}, Endpoints: endpoints}
+	w.mu.Lock()
+	w.state = state
+	clients := slices.Clone(w.clients)
+	w.mu.Unlock()
+	for _, cli := range clients {
+		cli.UpdateState(state)
+	}
+}
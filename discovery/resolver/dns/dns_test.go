@@ -0,0 +1,283 @@
+// Copyright 2022 The codesjoy Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dns
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/codesjoy/yggdrasil/v3/discovery/registry"
+	"github.com/codesjoy/yggdrasil/v3/discovery/resolver"
+	"github.com/codesjoy/yggdrasil/v3/internal/backoff"
+)
+
+type fakeLookuper struct {
+	mu      sync.Mutex
+	hosts   map[string][]string
+	srv     map[string][]*net.SRV
+	err     error
+	lookups int
+}
+
+func (f *fakeLookuper) LookupHost(_ context.Context, host string) ([]string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.lookups++
+	if f.err != nil {
+		return nil, f.err
+	}
+	addrs, ok := f.hosts[host]
+	if !ok {
+		return nil, &net.DNSError{Err: "no such host", Name: host, IsNotFound: true}
+	}
+	return addrs, nil
+}
+
+func (f *fakeLookuper) LookupSRV(
+	_ context.Context,
+	_, _, name string,
+) (string, []*net.SRV, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.err != nil {
+		return "", nil, f.err
+	}
+	return name, f.srv[name], nil
+}
+
+func (f *fakeLookuper) set(fn func(f *fakeLookuper)) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	fn(f)
+}
+
+type stateRecorder struct {
+	states chan resolver.State
+}
+
+func newStateRecorder() *stateRecorder {
+	return &stateRecorder{states: make(chan resolver.State, 16)}
+}
+
+func (r *stateRecorder) UpdateState(state resolver.State) {
+	r.states <- state
+}
+
+func (r *stateRecorder) next(t *testing.T) resolver.State {
+	t.Helper()
+	select {
+	case state := <-r.states:
+		return state
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for state")
+		return nil
+	}
+}
+
+func addresses(state resolver.State) []string {
+	out := make([]string, 0, len(state.GetEndpoints()))
+	for _, ep := range state.GetEndpoints() {
+		out = append(out, ep.GetAddress())
+	}
+	return out
+}
+
+func testConfig() Config {
+	return Config{
+		RefreshInterval: time.Hour,
+		Protocol:        "grpc",
+		Backoff: backoff.Config{
+			BaseDelay:  5 * time.Millisecond,
+			Multiplier: 1.6,
+			MaxDelay:   20 * time.Millisecond,
+		},
+	}
+}
+
+func TestParseTarget(t *testing.T) {
+	cases := map[string]Target{
+		"dns:///my-svc.ns.svc.cluster.local:50051": {
+			Host: "my-svc.ns.svc.cluster.local", Port: "50051",
+		},
+		"dns://8.8.8.8:53/svc:80": {Authority: "8.8.8.8:53", Host: "svc", Port: "80"},
+		"dns:///svc":              {Host: "svc", Port: DefaultPort},
+		"svc:8080":                {Host: "svc", Port: "8080"},
+		"[::1]:8080":              {Host: "::1", Port: "8080"},
+		"dns:///[::1]":            {Host: "::1", Port: DefaultPort},
+	}
+	for target, want := range cases {
+		got, err := ParseTarget(target)
+		require.NoError(t, err, target)
+		assert.Equal(t, want, got, target)
+	}
+	for _, target := range []string{"", "dns:///", "dns:///:80"} {
+		_, err := ParseTarget(target)
+		assert.Error(t, err, target)
+	}
+	assert.True(t, Target{Host: "_grpc._tcp.svc"}.SRV())
+	assert.False(t, Target{Host: "svc"}.SRV())
+}
+
+func TestResolverResolvesHost(t *testing.T) {
+	lookuper := &fakeLookuper{hosts: map[string][]string{"svc": {"10.0.0.1", "fd00::1"}}}
+	r := New(testConfig(), lookuper)
+	assert.Equal(t, Scheme, r.Type())
+
+	rec := newStateRecorder()
+	require.NoError(t, r.AddWatch("dns:///svc:50051", rec))
+	state := rec.next(t)
+	assert.Equal(t, []string{"10.0.0.1:50051", "[fd00::1]:50051"}, addresses(state))
+	ep := state.GetEndpoints()[0]
+	assert.Equal(t, "grpc", ep.GetProtocol())
+	assert.Equal(t, "svc", ep.GetAttributes()[AttrHost])
+
+	// ResolveNow picks up changed records; unchanged records are not
+	// republished.
+	r.(resolver.ResolveNower).ResolveNow()
+	lookuper.set(func(f *fakeLookuper) { f.hosts["svc"] = []string{"10.0.0.2"} })
+	r.(resolver.ResolveNower).ResolveNow()
+	assert.Equal(t, []string{"10.0.0.2:50051"}, addresses(rec.next(t)))
+
+	// A late client receives the current state.
+	late := newStateRecorder()
+	require.NoError(t, r.AddWatch("dns:///svc:50051", late))
+	assert.Equal(t, []string{"10.0.0.2:50051"}, addresses(late.next(t)))
+
+	require.NoError(t, r.DelWatch("dns:///svc:50051", rec))
+	require.NoError(t, r.DelWatch("dns:///svc:50051", late))
+	require.NoError(t, r.DelWatch("dns:///svc:50051", late))
+}
+
+// gatedLookuper holds every host lookup until release is closed.
+type gatedLookuper struct {
+	fakeLookuper
+	entered chan struct{}
+	release chan struct{}
+}
+
+func (g *gatedLookuper) LookupHost(ctx context.Context, host string) ([]string, error) {
+	g.entered <- struct{}{}
+	<-g.release
+	return g.fakeLookuper.LookupHost(ctx, host)
+}
+
+func TestResolverSharesConcurrentLookups(t *testing.T) {
+	lookuper := &gatedLookuper{
+		fakeLookuper: fakeLookuper{hosts: map[string][]string{"svc": {"10.0.0.1"}}},
+		entered:      make(chan struct{}, 2),
+		release:      make(chan struct{}),
+	}
+	r := New(testConfig(), lookuper)
+	grpcRec, httpRec := newStateRecorder(), newStateRecorder()
+	require.NoError(t, r.AddWatch("dns:///svc:50051", grpcRec))
+	<-lookuper.entered
+	require.NoError(t, r.AddWatch("dns:///svc:8080", httpRec))
+	// The second watch joins the lookup in flight instead of starting one.
+	select {
+	case <-lookuper.entered:
+		t.Fatal("concurrent lookup of the same host was not shared")
+	case <-time.After(100 * time.Millisecond):
+	}
+	close(lookuper.release)
+
+	assert.Equal(t, []string{"10.0.0.1:50051"}, addresses(grpcRec.next(t)))
+	assert.Equal(t, []string{"10.0.0.1:8080"}, addresses(httpRec.next(t)))
+	lookuper.mu.Lock()
+	assert.Equal(t, 1, lookuper.lookups)
+	lookuper.mu.Unlock()
+	require.NoError(t, r.DelWatch("dns:///svc:50051", grpcRec))
+	require.NoError(t, r.DelWatch("dns:///svc:8080", httpRec))
+}
+
+func TestResolverResolvesSRV(t *testing.T) {
+	lookuper := &fakeLookuper{
+		hosts: map[string][]string{
+			"a.svc": {"10.0.0.1"},
+			"b.svc": {"10.0.0.2"},
+			"c.svc": {"10.0.0.3"},
+		},
+		srv: map[string][]*net.SRV{"_grpc._tcp.svc": {
+			{Target: "a.svc.", Port: 7001, Priority: 10, Weight: 3},
+			{Target: "b.svc.", Port: 7002, Priority: 10},
+			{Target: "c.svc.", Port: 7003, Priority: 20, Weight: 1},
+		}},
+	}
+	r := New(testConfig(), lookuper)
+	rec := newStateRecorder()
+	require.NoError(t, r.AddWatch("dns:///_grpc._tcp.svc", rec))
+	state := rec.next(t)
+	assert.Equal(t, []string{"10.0.0.1:7001", "10.0.0.2:7002"}, addresses(state))
+	assert.Equal(t, 3, state.GetEndpoints()[0].GetAttributes()[registry.MDWeight])
+	assert.Equal(t, "a.svc", state.GetEndpoints()[0].GetAttributes()[AttrHost])
+	assert.Equal(t, resolver.DefaultWeight, resolver.Weight(state.GetEndpoints()[1]))
+	require.NoError(t, r.DelWatch("dns:///_grpc._tcp.svc", rec))
+}
+
+func TestResolverRetriesFailedLookups(t *testing.T) {
+	lookuper := &fakeLookuper{err: errors.New("temporary failure")}
+	r := New(testConfig(), lookuper)
+	rec := newStateRecorder()
+	require.NoError(t, r.AddWatch("svc:80", rec))
+
+	assert.Eventually(t, func() bool {
+		lookuper.mu.Lock()
+		defer lookuper.mu.Unlock()
+		return lookuper.lookups >= 3
+	}, 5*time.Second, 5*time.Millisecond)
+	assert.Empty(t, rec.states)
+
+	lookuper.set(func(f *fakeLookuper) {
+		f.err = nil
+		f.hosts = map[string][]string{"svc": {"10.0.0.1"}}
+	})
+	assert.Equal(t, []string{"10.0.0.1:80"}, addresses(rec.next(t)))
+	require.NoError(t, r.DelWatch("svc:80", rec))
+}
+
+func TestResolverLiteralIP(t *testing.T) {
+	lookuper := &fakeLookuper{}
+	r := New(testConfig(), lookuper)
+	rec := newStateRecorder()
+	require.NoError(t, r.AddWatch("dns:///127.0.0.1:9000", rec))
+	assert.Equal(t, []string{"127.0.0.1:9000"}, addresses(rec.next(t)))
+	assert.Zero(t, lookuper.lookups)
+	require.NoError(t, r.DelWatch("dns:///127.0.0.1:9000", rec))
+}
+
+func TestProvider(t *testing.T) {
+	p := Provider()
+	assert.Equal(t, Scheme, p.Type())
+	r, err := resolver.Build(p, "dns", resolver.Spec{
+		Config: map[string]any{"refresh_interval": "1m", "protocol": "http"},
+	})
+	require.NoError(t, err)
+	dr := r.(*dnsResolver)
+	assert.Equal(t, time.Minute, dr.cfg.RefreshInterval)
+	assert.Equal(t, "http", dr.cfg.Protocol)
+	assert.Equal(t, 0.2, dr.cfg.Jitter)
+	assert.Equal(t, backoff.DefaultConfig, dr.cfg.Backoff)
+
+	_, err = resolver.Build(p, "dns", resolver.Spec{
+		Config: map[string]any{"refresh_interval": "soon"},
+	})
+	assert.Error(t, err)
+}
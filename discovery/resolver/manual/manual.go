@@ -0,0 +1,244 @@
+// Copyright 2022 The codesjoy Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package manual implements a resolver whose endpoints are set by the
+// application or by configuration instead of a discovery system.
+package manual
+
+import (
+	"fmt"
+	"log/slog"
+	"slices"
+	"sync"
+
+	"github.com/codesjoy/yggdrasil/v3/config"
+	"github.com/codesjoy/yggdrasil/v3/discovery/resolver"
+)
+
+// Type is the provider type of the config-driven manual resolver.
+const Type = "manual"
+
+// Config is the config envelope of a manual resolver spec.
+type Config struct {
+	// Endpoints lists the endpoints of every application by name.
+	Endpoints map[string][]resolver.BaseEndpoint `mapstructure:"endpoints"`
+}
+
+// Resolver serves endpoint lists updated through UpdateState. Watchers of an
+// application without endpoints receive its first update.
+type Resolver struct {
+	mu        sync.Mutex
+	states    map[string]resolver.State
+	clients   map[string][]resolver.Client
+	fromCfg   map[string]struct{}
+	section   *config.Section[resolver.Spec]
+	stopWatch func()
+}
+
+// New returns an empty manual resolver.
+func New() *Resolver {
+	return &Resolver{
+		states:  map[string]resolver.State{},
+		clients: map[string][]resolver.Client{},
+		fromCfg: map[string]struct{}{},
+	}
+}
+
+// UpdateState replaces the endpoints of appName and pushes them to its
+// watchers.
+func (r *Resolver) UpdateState(appName string, endpoints ...resolver.Endpoint) {
+	state := resolver.BaseState{
+		Attributes: map[string]any{},
+		Endpoints:  slices.Clone(endpoints),
+	}
+	r.mu.Lock()
+	r.states[appName] = state
+	clients := slices.Clone(r.clients[appName])
+	r.mu.Unlock()
+	for _, cli := range clients {
+		cli.UpdateState(state)
+	}
+}
+
+// Endpoints returns the current endpoints of appName.
+func (r *Resolver) Endpoints(appName string) []resolver.Endpoint {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	state, ok := r.states[appName]
+	if !ok {
+		return nil
+	}
+	return slices.Clone(state.GetEndpoints())
+}
+
+// Apply replaces the endpoints of the applications listed in cfg. The
+// applications of a previously applied config that cfg no longer lists lose
+// their endpoints.
+func (r *Resolver) Apply(cfg Config) {
+	r.mu.Lock()
+	var removed []string
+	for appName := range r.fromCfg {
+		if _, ok := cfg.Endpoints[appName]; !ok {
+			removed = append(removed, appName)
+		}
+	}
+	r.fromCfg = make(map[string]struct{}, len(cfg.Endpoints))
+	for appName := range cfg.Endpoints {
+		r.fromCfg[appName] = struct{}{}
+	}
+	r.mu.Unlock()
+
+	for _, appName := range removed {
+		r.UpdateState(appName)
+	}
+	for appName, items := range cfg.Endpoints {
+		endpoints := make([]resolver.Endpoint, 0, len(items))
+		for _, item := range items {
+			endpoints = append(endpoints, item)
+		}
+		r.UpdateState(appName, endpoints...)
+	}
+}
+
+// AddWatch registers cli for appName and sends it the current endpoints.
+func (r *Resolver) AddWatch(appName string, cli resolver.Client) error {
+	r.mu.Lock()
+	section := r.section
+	if r.stopWatch != nil || r.watchCountLocked() > 0 {
+		section = nil
+	}
+	r.mu.Unlock()
+	if section != nil {
+		r.watchConfig(*section)
+	}
+
+	r.mu.Lock()
+	r.clients[appName] = append(r.clients[appName], cli)
+	state, ok := r.states[appName]
+	r.mu.Unlock()
+	if ok {
+		cli.UpdateState(state)
+	}
+	return nil
+}
+
+// DelWatch removes cli from the watchers of appName.
+func (r *Resolver) DelWatch(appName string, cli resolver.Client) error {
+	r.mu.Lock()
+	r.clients[appName] = slices.DeleteFunc(r.clients[appName], func(c resolver.Client) bool {
+		return c == cli
+	})
+	if len(r.clients[appName]) == 0 {
+		delete(r.clients, appName)
+	}
+	var stop func()
+	if r.watchCountLocked() == 0 {
+		stop, r.stopWatch = r.stopWatch, nil
+	}
+	r.mu.Unlock()
+	if stop != nil {
+		stop()
+	}
+	return nil
+}
+
+// Type returns the type of the resolver.
+func (r *Resolver) Type() string {
+	return Type
+}
+
+// ResolveNow pushes the current endpoints to every watcher again.
+func (r *Resolver) ResolveNow() {
+	r.mu.Lock()
+	type update struct {
+		cli   resolver.Client
+		state resolver.State
+	}
+	var updates []update
+	for appName, clients := range r.clients {
+		state, ok := r.states[appName]
+		if !ok {
+			continue
+		}
+		for _, cli := range clients {
+			updates = append(updates, update{cli: cli, state: state})
+		}
+	}
+	r.mu.Unlock()
+	for _, item := range updates {
+		item.cli.UpdateState(item.state)
+	}
+}
+
+// Provider returns a provider of typeName that always yields r, so one
+// resolver instance serves every client configured with it.
+func (r *Resolver) Provider(typeName string) resolver.Provider {
+	return resolver.NewProvider(typeName, func(string) (resolver.Resolver, error) {
+		return r, nil
+	})
+}
+
+func (r *Resolver) watchCountLocked() int {
+	n := 0
+	for _, clients := range r.clients {
+		n += len(clients)
+	}
+	return n
+}
+
+// watchConfig follows the config of a resolver spec while r is watched.
+func (r *Resolver) watchConfig(section config.Section[resolver.Spec]) {
+	stop := section.Watch(func(spec resolver.Spec, err error) {
+		var cfg Config
+		if err == nil {
+			err = config.NewSnapshot(spec.Config).Decode(&cfg)
+		}
+		if err != nil {
+			slog.Warn("fault to load manual resolver config", slog.Any("error", err))
+			return
+		}
+		r.Apply(cfg)
+	})
+	r.mu.Lock()
+	prev := r.stopWatch
+	r.stopWatch = stop
+	r.mu.Unlock()
+	if prev != nil {
+		prev()
+	}
+}
+
+// ConfigProvider returns the provider of config-driven manual resolvers.
+// Each resolver serves the endpoints listed in the config of its spec and,
+// when manager is not nil, follows changes of that config while watched.
+func ConfigProvider(manager *config.Manager) resolver.Provider {
+	return resolver.NewConfigProvider(
+		Type,
+		func(name string, raw map[string]any) (resolver.Resolver, error) {
+			var cfg Config
+			if err := config.NewSnapshot(raw).Decode(&cfg); err != nil {
+				return nil, fmt.Errorf("load manual resolver config: %w", err)
+			}
+			r := New()
+			r.Apply(cfg)
+			if manager != nil {
+				section := config.Bind[resolver.Spec](
+					manager, "yggdrasil", "discovery", "resolvers", name,
+				)
+				r.section = &section
+			}
+			return r, nil
+		},
+	)
+}
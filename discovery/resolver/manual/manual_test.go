@@ -0,0 +1,161 @@
+// Copyright 2022 The codesjoy Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package manual
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/codesjoy/yggdrasil/v3/config"
+	"github.com/codesjoy/yggdrasil/v3/config/source/memory"
+	"github.com/codesjoy/yggdrasil/v3/discovery/resolver"
+)
+
+type stateRecorder struct {
+	mu     sync.Mutex
+	states []resolver.State
+}
+
+func (r *stateRecorder) UpdateState(state resolver.State) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.states = append(r.states, state)
+}
+
+func (r *stateRecorder) addresses() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if len(r.states) == 0 {
+		return nil
+	}
+	out := []string{}
+	for _, ep := range r.states[len(r.states)-1].GetEndpoints() {
+		out = append(out, ep.GetAddress())
+	}
+	return out
+}
+
+func (r *stateRecorder) count() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.states)
+}
+
+func endpoint(address string) resolver.Endpoint {
+	return resolver.BaseEndpoint{Address: address, Protocol: "grpc"}
+}
+
+func TestResolverUpdateState(t *testing.T) {
+	r := New()
+	assert.Equal(t, Type, r.Type())
+
+	rec := &stateRecorder{}
+	require.NoError(t, r.AddWatch("svc", rec))
+	assert.Zero(t, rec.count(), "no state before the first update")
+
+	r.UpdateState("svc", endpoint("10.0.0.1:80"), endpoint("10.0.0.2:80"))
+	assert.Equal(t, []string{"10.0.0.1:80", "10.0.0.2:80"}, rec.addresses())
+	assert.Len(t, r.Endpoints("svc"), 2)
+	assert.Nil(t, r.Endpoints("other"))
+
+	late := &stateRecorder{}
+	require.NoError(t, r.AddWatch("svc", late))
+	assert.Equal(t, []string{"10.0.0.1:80", "10.0.0.2:80"}, late.addresses())
+
+	r.ResolveNow()
+	assert.Equal(t, 2, rec.count())
+
+	require.NoError(t, r.DelWatch("svc", rec))
+	r.UpdateState("svc", endpoint("10.0.0.3:80"))
+	assert.Equal(t, []string{"10.0.0.1:80", "10.0.0.2:80"}, rec.addresses())
+	assert.Equal(t, []string{"10.0.0.3:80"}, late.addresses())
+
+	r.UpdateState("svc")
+	assert.Empty(t, late.addresses())
+}
+
+func TestResolverProviderSharesInstance(t *testing.T) {
+	r := New()
+	p := r.Provider("fixed")
+	assert.Equal(t, "fixed", p.Type())
+	got, err := p.New("any")
+	require.NoError(t, err)
+	assert.Same(t, r, got)
+}
+
+func TestResolverApply(t *testing.T) {
+	r := New()
+	r.UpdateState("manual", endpoint("10.0.0.9:80"))
+	r.Apply(Config{Endpoints: map[string][]resolver.BaseEndpoint{
+		"a": {{Address: "10.0.0.1:80", Protocol: "grpc"}},
+		"b": {{Address: "10.0.0.2:80", Protocol: "grpc"}},
+	}})
+	assert.Len(t, r.Endpoints("a"), 1)
+	assert.Len(t, r.Endpoints("b"), 1)
+
+	r.Apply(Config{Endpoints: map[string][]resolver.BaseEndpoint{
+		"a": {{Address: "10.0.0.3:80", Protocol: "grpc"}},
+	}})
+	assert.Equal(t, "10.0.0.3:80", r.Endpoints("a")[0].GetAddress())
+	assert.Empty(t, r.Endpoints("b"))
+	assert.Len(t, r.Endpoints("manual"), 1, "programmatic endpoints are kept")
+}
+
+func resolverLayer(addresses ...string) map[string]any {
+	endpoints := make([]any, 0, len(addresses))
+	for _, address := range addresses {
+		endpoints = append(endpoints, map[string]any{"address": address, "protocol": "grpc"})
+	}
+	return map[string]any{"yggdrasil": map[string]any{"discovery": map[string]any{
+		"resolvers": map[string]any{"fixed": map[string]any{
+			"type":   Type,
+			"config": map[string]any{"endpoints": map[string]any{"svc": endpoints}},
+		}},
+	}}}
+}
+
+func TestConfigProviderFollowsConfig(t *testing.T) {
+	manager := config.NewManager()
+	require.NoError(t, manager.LoadLayer("file", config.PriorityFile,
+		memory.NewSource("file", resolverLayer("10.0.0.1:80"))))
+
+	p := ConfigProvider(manager)
+	assert.Equal(t, Type, p.Type())
+	spec := manager.Section("yggdrasil", "discovery", "resolvers", "fixed")
+	var s resolver.Spec
+	require.NoError(t, spec.Decode(&s))
+	res, err := resolver.Build(p, "fixed", s)
+	require.NoError(t, err)
+
+	rec := &stateRecorder{}
+	require.NoError(t, res.AddWatch("svc", rec))
+	assert.Equal(t, []string{"10.0.0.1:80"}, rec.addresses())
+
+	require.NoError(t, manager.LoadLayer("file", config.PriorityFile,
+		memory.NewSource("file", resolverLayer("10.0.0.2:80", "10.0.0.3:80"))))
+	assert.Equal(t, []string{"10.0.0.2:80", "10.0.0.3:80"}, rec.addresses())
+
+	// Config changes are not followed once the resolver is unwatched.
+	require.NoError(t, res.DelWatch("svc", rec))
+	require.NoError(t, manager.LoadLayer("file", config.PriorityFile,
+		memory.NewSource("file", resolverLayer("10.0.0.4:80"))))
+	assert.Equal(t, "10.0.0.2:80", res.(*Resolver).Endpoints("svc")[0].GetAddress())
+
+	_, err = resolver.Build(p, "bad", resolver.Spec{Config: map[string]any{"endpoints": "x"}})
+	assert.Error(t, err)
+}
@@ -0,0 +1,130 @@
+// Copyright 2022 The codesjoy Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package resolver
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/codesjoy/yggdrasil/v3/discovery/registry"
+)
+
+// DefaultWeight is the weight of endpoints that publish none.
+const DefaultWeight = 1
+
+// FromRegistryEndpoint converts a registered endpoint into a resolver endpoint.
+// The endpoint metadata is surfaced as attributes so balancer and routing
+// policies can select on zone, version, canary or weight.
+func FromRegistryEndpoint(ep registry.Endpoint) BaseEndpoint {
+	md := ep.Metadata()
+	attrs := make(map[string]any, len(md))
+	for key, value := range md {
+		attrs[key] = value
+	}
+	return BaseEndpoint{
+		Address:    ep.Address(),
+		Protocol:   ep.Scheme(),
+		Attributes: attrs,
+	}
+}
+
+// FromRegistryInstances builds a resolver state from registered instances.
+// Instance region, zone, version and metadata are inherited by endpoints that do not
+// publish their own.
+func FromRegistryInstances(instances ...registry.Instance) BaseState {
+	var state BaseState
+	for _, inst := range instances {
+		if inst == nil {
+			continue
+		}
+		inherited := maps.Clone(inst.Metadata())
+		if inherited == nil {
+			inherited = map[string]string{}
+		}
+		if inst.Region() != "" {
+			inherited[registry.MDRegion] = inst.Region()
+		}
+		if inst.Zone() != "" {
+			inherited[registry.MDZone] = inst.Zone()
+		}
+		if inst.Version() != "" {
+			inherited[registry.MDVersion] = inst.Version()
+		}
+		for _, ep := range inst.Endpoints() {
+			if ep == nil {
+				continue
+			}
+			item := FromRegistryEndpoint(ep)
+			for key, value := range inherited {
+				if _, ok := item.Attributes[key]; !ok {
+					item.Attributes[key] = value
+				}
+			}
+			state.Endpoints = append(state.Endpoints, item)
+		}
+	}
+	return state
+}
+
+// Weight returns the load-balancing weight published by the endpoint, or
+// DefaultWeight when it is missing or malformed.
+func Weight(ep Endpoint) int {
+	value, ok := ep.GetAttributes()[registry.MDWeight]
+	if !ok {
+		return DefaultWeight
+	}
+	var weight int
+	switch v := value.(type) {
+	case int:
+		weight = v
+	case int64:
+		weight = int(v)
+	case float64:
+		weight = int(v)
+	default:
+		parsed, err := strconv.Atoi(strings.TrimSpace(fmt.Sprint(v)))
+		if err != nil {
+			return DefaultWeight
+		}
+		weight = parsed
+	}
+	if weight < 0 {
+		return DefaultWeight
+	}
+	return weight
+}
+
+// Capabilities returns the protocol capabilities published by the endpoint.
+func Capabilities(ep Endpoint) []string {
+	value, ok := ep.GetAttributes()[registry.MDCapabilities]
+	if !ok {
+		return nil
+	}
+	var out []string
+	for _, item := range strings.Split(fmt.Sprint(value), ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			out = append(out, item)
+		}
+	}
+	return out
+}
+
+// HasCapability reports whether the endpoint publishes the capability.
+func HasCapability(ep Endpoint, capability string) bool {
+	return slices.Contains(Capabilities(ep), capability)
+}
@@ -0,0 +1,120 @@
+// Copyright 2022 The codesjoy Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package resolver
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/codesjoy/yggdrasil/v3/discovery/registry"
+)
+
+type testRegistryEndpoint struct {
+	scheme   string
+	address  string
+	metadata map[string]string
+}
+
+func (e testRegistryEndpoint) Scheme() string              { return e.scheme }
+func (e testRegistryEndpoint) Address() string             { return e.address }
+func (e testRegistryEndpoint) Metadata() map[string]string { return e.metadata }
+
+type testRegistryInstance struct {
+	zone      string
+	version   string
+	metadata  map[string]string
+	endpoints []registry.Endpoint
+}
+
+func (i testRegistryInstance) Region() string                 { return "" }
+func (i testRegistryInstance) Zone() string                   { return i.zone }
+func (i testRegistryInstance) Campus() string                 { return "" }
+func (i testRegistryInstance) Namespace() string              { return "" }
+func (i testRegistryInstance) Name() string                   { return "app" }
+func (i testRegistryInstance) Version() string                { return i.version }
+func (i testRegistryInstance) Metadata() map[string]string    { return i.metadata }
+func (i testRegistryInstance) Endpoints() []registry.Endpoint { return i.endpoints }
+
+func TestFromRegistryEndpoint(t *testing.T) {
+	ep := FromRegistryEndpoint(testRegistryEndpoint{
+		scheme:   "grpc",
+		address:  "10.0.0.1:9000",
+		metadata: map[string]string{registry.MDWeight: "3", registry.MDCanary: "true"},
+	})
+	assert.Equal(t, "grpc/10.0.0.1:9000", ep.Name())
+	assert.Equal(t, "true", ep.GetAttributes()[registry.MDCanary])
+	assert.Equal(t, 3, Weight(ep))
+}
+
+func TestFromRegistryInstancesInheritsInstanceMetadata(t *testing.T) {
+	state := FromRegistryInstances(
+		testRegistryInstance{
+			zone:     "z1",
+			version:  "v1",
+			metadata: map[string]string{"team": "core"},
+			endpoints: []registry.Endpoint{
+				testRegistryEndpoint{scheme: "grpc", address: "a:1"},
+				testRegistryEndpoint{
+					scheme:   "grpc",
+					address:  "a:2",
+					metadata: map[string]string{registry.MDZone: "z2"},
+				},
+				nil,
+			},
+		},
+		nil,
+	)
+	require.Len(t, state.Endpoints, 2)
+	assert.Equal(t, map[string]any{
+		registry.MDZone:    "z1",
+		registry.MDVersion: "v1",
+		"team":             "core",
+	}, state.Endpoints[0].GetAttributes())
+	assert.Equal(t, "z2", state.Endpoints[1].GetAttributes()[registry.MDZone])
+}
+
+func TestWeight(t *testing.T) {
+	cases := []struct {
+		name  string
+		value any
+		want  int
+	}{
+		{name: "string", value: "7", want: 7},
+		{name: "int", value: 4, want: 4},
+		{name: "float", value: float64(2), want: 2},
+		{name: "zero", value: "0", want: 0},
+		{name: "negative", value: -1, want: DefaultWeight},
+		{name: "malformed", value: "heavy", want: DefaultWeight},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			ep := BaseEndpoint{Attributes: map[string]any{registry.MDWeight: tc.value}}
+			assert.Equal(t, tc.want, Weight(ep))
+		})
+	}
+	assert.Equal(t, DefaultWeight, Weight(BaseEndpoint{}))
+}
+
+func TestCapabilities(t *testing.T) {
+	ep := BaseEndpoint{Attributes: map[string]any{
+		registry.MDCapabilities: "compression, streaming,,",
+	}}
+	assert.Equal(t, []string{"compression", "streaming"}, Capabilities(ep))
+	assert.True(t, HasCapability(ep, "streaming"))
+	assert.False(t, HasCapability(ep, "xds"))
+	assert.Nil(t, Capabilities(BaseEndpoint{}))
+}
@@ -138,10 +138,56 @@ func NewProvider(typeName string, builder Builder) Provider {
 	}
 }
 
+// ConfigBuilder is a function that creates a resolver from the config
+// envelope of its spec.
+type ConfigBuilder func(name string, cfg map[string]any) (Resolver, error)
+
+// ConfigProvider is implemented by providers whose resolvers consume the
+// config envelope of their spec.
+type ConfigProvider interface {
+	Provider
+	NewWithConfig(name string, cfg map[string]any) (Resolver, error)
+}
+
+type configProvider struct {
+	typeName string
+	builder  ConfigBuilder
+}
+
+func (p configProvider) Type() string { return p.typeName }
+
+func (p configProvider) New(name string) (Resolver, error) {
+	return p.builder(name, CurrentSpec(name).Config)
+}
+
+func (p configProvider) NewWithConfig(name string, cfg map[string]any) (Resolver, error) {
+	return p.builder(name, cfg)
+}
+
+// NewConfigProvider wraps a config-aware resolver builder as a capability
+// provider.
+func NewConfigProvider(typeName string, builder ConfigBuilder) ConfigProvider {
+	return configProvider{
+		typeName: typeName,
+		builder:  builder,
+	}
+}
+
+// Build creates the resolver named name from p and the config of its spec.
+func Build(p Provider, name string, spec Spec) (Resolver, error) {
+	if cp, ok := p.(ConfigProvider); ok {
+		return cp.NewWithConfig(name, spec.Config)
+	}
+	return p.New(name)
+}
+
 // Spec describes a resolver extension envelope.
 type Spec struct {
 	Type   string         `mapstructure:"type"`
 	Config map[string]any `mapstructure:"config"`
+	// Cache persists resolved endpoints to disk as a fallback for registry
+	// outages.
+	Cache CacheConfig `mapstructure:"cache"`
 }
 
 var (
@@ -221,17 +267,22 @@ func Get(name string) (Resolver, error) {
 			// Return nil to indicate no dynamic resolver (use static endpoints)
 			return nil, nil
 		}
-		return nil, fmt.Errorf("not found resolver type, name: %s", name)
+		// Resolvers named after a provider type work without configuration.
+		if _, ok := providers[name]; !ok {
+			return nil, fmt.Errorf("not found resolver type, name: %s", name)
+		}
+		typeName = name
 	}
 
 	p, ok := providers[typeName]
 	if !ok {
 		return nil, fmt.Errorf("not found resolver provider, type: %s", typeName)
 	}
-	r, err := p.New(name)
+	r, err := Build(p, name, spec)
 	if err != nil {
 		return nil, err
 	}
+	r = WithCache(r, name, spec.Cache)
 	// Cache the resolver for future use
 	resolver[name] = r
 	return r, nil
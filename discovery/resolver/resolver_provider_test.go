@@ -31,6 +31,34 @@ func TestNewProvider(t *testing.T) {
 	assert.Equal(t, "svc", r.Type())
 }
 
+func TestNewConfigProvider(t *testing.T) {
+	p := NewConfigProvider("cfg-type", func(name string, cfg map[string]any) (Resolver, error) {
+		return &testResolver{kind: name + ":" + cfg["mode"].(string)}, nil
+	})
+	assert.Equal(t, "cfg-type", p.Type())
+
+	r, err := Build(p, "svc", Spec{Config: map[string]any{"mode": "explicit"}})
+	require.NoError(t, err)
+	assert.Equal(t, "svc:explicit", r.Type())
+
+	Configure(map[string]Spec{"svc": {Type: "cfg-type", Config: map[string]any{"mode": "spec"}}})
+	defer Configure(nil)
+	r, err = p.New("svc")
+	require.NoError(t, err)
+	assert.Equal(t, "svc:spec", r.Type())
+}
+
+func TestGet_ProviderNamedResolverWithoutConfig(t *testing.T) {
+	p := NewProvider("named-res", func(name string) (Resolver, error) {
+		return &testResolver{kind: name}, nil
+	})
+	require.NoError(t, ConfigureProviders([]Provider{p}))
+	Configure(nil)
+	r, err := Get("named-res")
+	require.NoError(t, err)
+	assert.Equal(t, "named-res", r.Type())
+}
+
 func TestConfigureProvidersErrors(t *testing.T) {
 	t.Run("nil items skipped", func(t *testing.T) {
 		err := ConfigureProviders([]Provider{nil})
@@ -0,0 +1,218 @@
+// Copyright 2022 The codesjoy Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package resolver
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"sync"
+)
+
+const (
+	// PassthroughScheme dials the endpoint of the target as is.
+	PassthroughScheme = "passthrough"
+	// UnixScheme dials the unix socket named by the target.
+	UnixScheme = "unix"
+	// AttrNetwork is the endpoint attribute naming the network to dial, e.g.
+	// "unix". Endpoints without it are dialed over the network configured
+	// for their transport.
+	AttrNetwork = "network"
+
+	defaultTargetProtocol = "grpc"
+)
+
+// Target is a parsed client target of the form scheme://authority/endpoint.
+type Target struct {
+	// Raw is the target as given.
+	Raw string
+	// Scheme selects how the target is resolved. It is empty for a bare
+	// service name.
+	Scheme string
+	// Authority is the authority of the target, if any.
+	Authority string
+	// Endpoint is the path of the target without its leading slash.
+	Endpoint string
+}
+
+// ParseTarget parses a client target. Besides scheme://authority/endpoint
+// it accepts a bare host:port, which is a passthrough target, unix:path and
+// a bare service name, which has no scheme.
+func ParseTarget(raw string) (Target, error) {
+	if raw == "" {
+		return Target{}, errors.New("target is empty")
+	}
+	if path, ok := strings.CutPrefix(raw, UnixScheme+":"); ok && !strings.HasPrefix(path, "//") {
+		return unixTarget(raw, path)
+	}
+	if !strings.Contains(raw, "://") {
+		if isHostPort(raw) {
+			return Target{Raw: raw, Scheme: PassthroughScheme, Endpoint: raw}, nil
+		}
+		return Target{Raw: raw, Endpoint: raw}, nil
+	}
+	u, err := url.Parse(raw)
+	if err != nil {
+		return Target{}, fmt.Errorf("parse target %q: %w", raw, err)
+	}
+	if u.Scheme == UnixScheme {
+		return unixTarget(raw, u.Host+u.Path)
+	}
+	return Target{
+		Raw:       raw,
+		Scheme:    u.Scheme,
+		Authority: u.Host,
+		Endpoint:  strings.TrimPrefix(u.Path, "/"),
+	}, nil
+}
+
+func unixTarget(raw, path string) (Target, error) {
+	if path == "" {
+		return Target{}, fmt.Errorf("unix target %q has no path", raw)
+	}
+	return Target{Raw: raw, Scheme: UnixScheme, Endpoint: path}, nil
+}
+
+func isHostPort(value string) bool {
+	host, port, err := net.SplitHostPort(value)
+	if err != nil || host == "" || port == "" {
+		return false
+	}
+	for _, c := range port {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// TargetResolution tells a client how to reach a target.
+type TargetResolution struct {
+	// Service is the name keying the client settings and identifying the
+	// client to interceptors and transports.
+	Service string
+	// Resolver names the resolver, either a configured one or a resolver
+	// type. Empty keeps the resolver of the client settings, unless
+	// Endpoints are set.
+	Resolver string
+	// Watch is the name watched on the resolver.
+	Watch string
+	// Endpoints are the static endpoints of targets dialed without a
+	// resolver.
+	Endpoints []BaseEndpoint
+}
+
+// TargetBuilder resolves the targets of one scheme.
+type TargetBuilder func(Target) (TargetResolution, error)
+
+var (
+	schemesMu sync.RWMutex
+	schemes   = map[string]TargetBuilder{
+		PassthroughScheme: staticTarget(defaultTargetProtocol),
+		UnixScheme:        buildUnixTarget,
+		"grpc":            staticTarget("grpc"),
+		"http":            staticTarget("http"),
+		"dns":             RawTarget("dns"),
+		"xds":             RawTarget("xds"),
+	}
+)
+
+// RegisterScheme registers the builder resolving targets of scheme,
+// replacing any previous one. Schemes without a builder are resolved by
+// ResolverTarget.
+func RegisterScheme(scheme string, builder TargetBuilder) {
+	schemesMu.Lock()
+	defer schemesMu.Unlock()
+	if builder == nil {
+		delete(schemes, scheme)
+		return
+	}
+	schemes[scheme] = builder
+}
+
+// ResolveTarget parses raw and resolves it with the builder of its scheme.
+// A bare service name resolves to itself with the configured resolver.
+func ResolveTarget(raw string) (TargetResolution, error) {
+	target, err := ParseTarget(raw)
+	if err != nil {
+		return TargetResolution{}, err
+	}
+	if target.Scheme == "" {
+		return TargetResolution{Service: raw, Watch: raw}, nil
+	}
+	schemesMu.RLock()
+	builder, ok := schemes[target.Scheme]
+	schemesMu.RUnlock()
+	if !ok {
+		builder = ResolverTarget
+	}
+	return builder(target)
+}
+
+// ResolverTarget resolves scheme://authority/service targets through a
+// registry: the authority names the configured resolver to watch the
+// service with, so one client can reach services of several registries.
+// Without an authority the resolver named after the scheme is used, which
+// may be a resolver type such as "etcd" or "k8s".
+func ResolverTarget(target Target) (TargetResolution, error) {
+	if target.Endpoint == "" {
+		return TargetResolution{}, fmt.Errorf("target %q has no service name", target.Raw)
+	}
+	name := target.Authority
+	if name == "" {
+		name = target.Scheme
+	}
+	return TargetResolution{Service: target.Endpoint, Resolver: name, Watch: target.Endpoint}, nil
+}
+
+// RawTarget returns a builder watching the whole target with the resolver
+// named resolverName, for resolvers parsing the target themselves, such as
+// dns://authority/host:port.
+func RawTarget(resolverName string) TargetBuilder {
+	return func(target Target) (TargetResolution, error) {
+		return TargetResolution{Service: target.Raw, Resolver: resolverName, Watch: target.Raw}, nil
+	}
+}
+
+// staticTarget dials the authority, or the endpoint of targets without
+// one, over protocol.
+func staticTarget(protocol string) TargetBuilder {
+	return func(target Target) (TargetResolution, error) {
+		address := target.Authority
+		if address == "" {
+			address = target.Endpoint
+		}
+		if address == "" {
+			return TargetResolution{}, fmt.Errorf("target %q has no address", target.Raw)
+		}
+		return TargetResolution{
+			Service:   target.Raw,
+			Endpoints: []BaseEndpoint{{Address: address, Protocol: protocol}},
+		}, nil
+	}
+}
+
+func buildUnixTarget(target Target) (TargetResolution, error) {
+	return TargetResolution{
+		Service: target.Raw,
+		Endpoints: []BaseEndpoint{{
+			Address:    target.Endpoint,
+			Protocol:   defaultTargetProtocol,
+			Attributes: map[string]any{AttrNetwork: UnixScheme},
+		}},
+	}, nil
+}
@@ -0,0 +1,129 @@
+// Copyright 2022 The codesjoy Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package resolver
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseTarget(t *testing.T) {
+	tests := []struct {
+		raw  string
+		want Target
+	}{
+		{"orders", Target{Endpoint: "orders"}},
+		{"orders.v1.OrderService", Target{Endpoint: "orders.v1.OrderService"}},
+		{"10.0.0.1:9000", Target{Scheme: PassthroughScheme, Endpoint: "10.0.0.1:9000"}},
+		{"[::1]:9000", Target{Scheme: PassthroughScheme, Endpoint: "[::1]:9000"}},
+		{"localhost:http", Target{Endpoint: "localhost:http"}},
+		{"unix:/tmp/app.sock", Target{Scheme: UnixScheme, Endpoint: "/tmp/app.sock"}},
+		{"unix:app.sock", Target{Scheme: UnixScheme, Endpoint: "app.sock"}},
+		{"unix:///tmp/app.sock", Target{Scheme: UnixScheme, Endpoint: "/tmp/app.sock"}},
+		{"dns:///orders:443", Target{Scheme: "dns", Endpoint: "orders:443"}},
+		{
+			"dns://8.8.8.8/orders:443",
+			Target{Scheme: "dns", Authority: "8.8.8.8", Endpoint: "orders:443"},
+		},
+		{"grpc://10.0.0.1:9000", Target{Scheme: "grpc", Authority: "10.0.0.1:9000"}},
+		{"etcd://east/orders", Target{Scheme: "etcd", Authority: "east", Endpoint: "orders"}},
+		{"k8s:///orders.prod", Target{Scheme: "k8s", Endpoint: "orders.prod"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.raw, func(t *testing.T) {
+			got, err := ParseTarget(tt.raw)
+			require.NoError(t, err)
+			tt.want.Raw = tt.raw
+			assert.Equal(t, tt.want, got)
+		})
+	}
+
+	for _, raw := range []string{"", "unix:", "unix://", "etcd://%zz/orders"} {
+		_, err := ParseTarget(raw)
+		assert.Error(t, err, raw)
+	}
+}
+
+func TestResolveTarget(t *testing.T) {
+	tests := []struct {
+		raw  string
+		want TargetResolution
+	}{
+		{"orders", TargetResolution{Service: "orders", Watch: "orders"}},
+		{"10.0.0.1:9000", TargetResolution{
+			Service:   "10.0.0.1:9000",
+			Endpoints: []BaseEndpoint{{Address: "10.0.0.1:9000", Protocol: "grpc"}},
+		}},
+		{"passthrough:///10.0.0.1:9000", TargetResolution{
+			Service:   "passthrough:///10.0.0.1:9000",
+			Endpoints: []BaseEndpoint{{Address: "10.0.0.1:9000", Protocol: "grpc"}},
+		}},
+		{"http://10.0.0.1:8080", TargetResolution{
+			Service:   "http://10.0.0.1:8080",
+			Endpoints: []BaseEndpoint{{Address: "10.0.0.1:8080", Protocol: "http"}},
+		}},
+		{"unix:/tmp/app.sock", TargetResolution{
+			Service: "unix:/tmp/app.sock",
+			Endpoints: []BaseEndpoint{{
+				Address:    "/tmp/app.sock",
+				Protocol:   "grpc",
+				Attributes: map[string]any{AttrNetwork: "unix"},
+			}},
+		}},
+		{"dns://8.8.8.8/orders:443", TargetResolution{
+			Service:  "dns://8.8.8.8/orders:443",
+			Resolver: "dns",
+			Watch:    "dns://8.8.8.8/orders:443",
+		}},
+		{"etcd://east/orders", TargetResolution{
+			Service: "orders", Resolver: "east", Watch: "orders",
+		}},
+		{"k8s:///orders", TargetResolution{
+			Service: "orders", Resolver: "k8s", Watch: "orders",
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.raw, func(t *testing.T) {
+			got, err := ResolveTarget(tt.raw)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+
+	for _, raw := range []string{"grpc://", "etcd://east"} {
+		_, err := ResolveTarget(raw)
+		assert.Error(t, err, raw)
+	}
+}
+
+func TestRegisterScheme(t *testing.T) {
+	RegisterScheme("consul", RawTarget("consul-east"))
+	t.Cleanup(func() { RegisterScheme("consul", nil) })
+
+	got, err := ResolveTarget("consul:///orders")
+	require.NoError(t, err)
+	assert.Equal(t, TargetResolution{
+		Service:  "consul:///orders",
+		Resolver: "consul-east",
+		Watch:    "consul:///orders",
+	}, got)
+
+	RegisterScheme("consul", nil)
+	got, err = ResolveTarget("consul:///orders")
+	require.NoError(t, err)
+	assert.Equal(t, "consul", got.Resolver)
+}
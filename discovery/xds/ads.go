@@ -0,0 +1,539 @@
+// Copyright 2022 The codesjoy Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package xds
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"slices"
+	"sync"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/mem"
+	"google.golang.org/protobuf/encoding/protowire"
+
+	"github.com/codesjoy/yggdrasil/v3/internal/backoff"
+	"github.com/codesjoy/yggdrasil/v3/internal/xclock"
+)
+
+const (
+	adsMethod = "/envoy.service.discovery.v3.AggregatedDiscoveryService/" +
+		"StreamAggregatedResources"
+	resourceWrapperType = "type.googleapis.com/envoy.service.discovery.v3.Resource"
+	userAgentName       = "yggdrasil"
+	// codeInvalidArgument is google.rpc.Code INVALID_ARGUMENT, sent with NACKs.
+	codeInvalidArgument = 3
+)
+
+var adsStreamDesc = &grpc.StreamDesc{
+	StreamName:    "StreamAggregatedResources",
+	ServerStreams: true,
+	ClientStreams: true,
+}
+
+// rawCodec sends pre-encoded protobuf messages; it keeps the envoy API
+// protos out of the dependency graph.
+type rawCodec struct{}
+
+func (rawCodec) Marshal(v any) (mem.BufferSlice, error) {
+	b, ok := v.(*[]byte)
+	if !ok {
+		return nil, fmt.Errorf("xds: unexpected message type %T", v)
+	}
+	return mem.BufferSlice{mem.SliceBuffer(*b)}, nil
+}
+
+func (rawCodec) Unmarshal(data mem.BufferSlice, v any) error {
+	b, ok := v.(*[]byte)
+	if !ok {
+		return fmt.Errorf("xds: unexpected message type %T", v)
+	}
+	*b = data.Materialize()
+	return nil
+}
+
+func (rawCodec) Name() string { return "proto" }
+
+type discoveryRequest struct {
+	versionInfo   string
+	node          NodeConfig
+	resourceNames []string
+	typeURL       string
+	nonce         string
+	errorDetail   string
+}
+
+func appendString(b []byte, num protowire.Number, v string) []byte {
+	if v == "" {
+		return b
+	}
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	return protowire.AppendString(b, v)
+}
+
+func appendMessage(b []byte, num protowire.Number, v []byte) []byte {
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	return protowire.AppendBytes(b, v)
+}
+
+func (n NodeConfig) marshal() []byte {
+	var b []byte
+	b = appendString(b, 1, n.ID)
+	b = appendString(b, 2, n.Cluster)
+	if n.Region != "" || n.Zone != "" || n.SubZone != "" {
+		var locality []byte
+		locality = appendString(locality, 1, n.Region)
+		locality = appendString(locality, 2, n.Zone)
+		locality = appendString(locality, 3, n.SubZone)
+		b = appendMessage(b, 4, locality)
+	}
+	return appendString(b, 6, userAgentName)
+}
+
+func (r discoveryRequest) marshal() []byte {
+	var b []byte
+	b = appendString(b, 1, r.versionInfo)
+	b = appendMessage(b, 2, r.node.marshal())
+	for _, name := range r.resourceNames {
+		b = protowire.AppendTag(b, 3, protowire.BytesType)
+		b = protowire.AppendString(b, name)
+	}
+	b = appendString(b, 4, r.typeURL)
+	b = appendString(b, 5, r.nonce)
+	if r.errorDetail != "" {
+		var status []byte
+		status = protowire.AppendTag(status, 1, protowire.VarintType)
+		status = protowire.AppendVarint(status, codeInvalidArgument)
+		status = appendString(status, 2, r.errorDetail)
+		b = appendMessage(b, 6, status)
+	}
+	return b
+}
+
+type discoveryResponse struct {
+	versionInfo string
+	resources   [][]byte
+	typeURL     string
+	nonce       string
+}
+
+func decodeDiscoveryResponse(b []byte) (*discoveryResponse, error) {
+	out := &discoveryResponse{}
+	err := forEachField(b, func(f field) error {
+		if f.typ != protowire.BytesType {
+			return nil
+		}
+		switch f.num {
+		case 1:
+			out.versionInfo = string(f.bytes)
+		case 2:
+			typeURL, value, err := decodeAny(f.bytes)
+			if err != nil {
+				return err
+			}
+			if typeURL == resourceWrapperType {
+				if value, err = unwrapResource(value); err != nil {
+					return err
+				}
+			}
+			out.resources = append(out.resources, value)
+		case 4:
+			out.typeURL = string(f.bytes)
+		case 5:
+			out.nonce = string(f.bytes)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// unwrapResource returns the resource carried by an
+// envoy.service.discovery.v3.Resource envelope.
+func unwrapResource(b []byte) ([]byte, error) {
+	var out []byte
+	err := forEachField(b, func(f field) error {
+		if f.num != 2 || f.typ != protowire.BytesType {
+			return nil
+		}
+		_, value, err := decodeAny(f.bytes)
+		out = value
+		return err
+	})
+	return out, err
+}
+
+// decodeResource decodes one resource and returns its name.
+func decodeResource(typeURL string, b []byte) (string, any, error) {
+	switch typeURL {
+	case ListenerType:
+		res, err := DecodeListener(b)
+		if err != nil {
+			return "", nil, err
+		}
+		return res.Name, res, nil
+	case RouteType:
+		res, err := DecodeRouteConfiguration(b)
+		if err != nil {
+			return "", nil, err
+		}
+		return res.Name, res, nil
+	case ClusterType:
+		res, err := DecodeCluster(b)
+		if err != nil {
+			return "", nil, err
+		}
+		return res.Name, res, nil
+	case EndpointType:
+		res, err := DecodeClusterLoadAssignment(b)
+		if err != nil {
+			return "", nil, err
+		}
+		return res.ClusterName, res, nil
+	default:
+		return "", nil, fmt.Errorf("unsupported resource type %q", typeURL)
+	}
+}
+
+// stateOfTheWorld reports whether responses of the type list every
+// subscribed resource, so missing ones were deleted.
+func stateOfTheWorld(typeURL string) bool {
+	return typeURL == ListenerType || typeURL == ClusterType
+}
+
+type resourceWatcher struct {
+	fn func(any)
+}
+
+type subscription struct {
+	watchers  map[string]map[*resourceWatcher]struct{}
+	resources map[string]any
+	version   string
+	nonce     string
+}
+
+// adsClient multiplexes resource subscriptions over one ADS stream. Watchers
+// receive the decoded resource, or nil once it is deleted.
+type adsClient struct {
+	cfg    Config
+	conn   *grpc.ClientConn
+	clock  xclock.Clock
+	ctx    context.Context
+	cancel context.CancelFunc
+	done   chan struct{}
+
+	mu     sync.Mutex
+	subs   map[string]*subscription
+	stream grpc.ClientStream
+
+	sendMu sync.Mutex
+}
+
+func newADSClient(cfg Config, opts ...grpc.DialOption) (*adsClient, error) {
+	if cfg.Server == "" {
+		return nil, errors.New("xds server is required")
+	}
+	creds, err := transportCredentials(cfg.TLS)
+	if err != nil {
+		return nil, err
+	}
+	opts = append([]grpc.DialOption{grpc.WithTransportCredentials(creds)}, opts...)
+	conn, err := grpc.NewClient(cfg.Server, opts...)
+	if err != nil {
+		return nil, err
+	}
+	c := &adsClient{
+		cfg:   cfg,
+		conn:  conn,
+		clock: xclock.Real(),
+		done:  make(chan struct{}),
+		subs:  map[string]*subscription{},
+	}
+	c.ctx, c.cancel = context.WithCancel(context.Background())
+	go c.run()
+	return c, nil
+}
+
+// transportCredentials returns the credentials of the ADS connection.
+func transportCredentials(cfg TLSConfig) (credentials.TransportCredentials, error) {
+	if cfg.Insecure {
+		return insecure.NewCredentials(), nil
+	}
+	tlsCfg := &tls.Config{MinVersion: tls.VersionTLS12, ServerName: cfg.ServerName}
+	if cfg.CAFile != "" {
+		data, err := os.ReadFile(cfg.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("read xds ca_file: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(data) {
+			return nil, fmt.Errorf("xds ca_file %q holds no certificates", cfg.CAFile)
+		}
+		tlsCfg.RootCAs = pool
+	}
+	if cfg.CertFile != "" || cfg.KeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(cfg.CertFile, cfg.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("load xds client certificate: %w", err)
+		}
+		tlsCfg.Certificates = []tls.Certificate{cert}
+	}
+	return credentials.NewTLS(tlsCfg), nil
+}
+
+// watch subscribes to one resource. The returned function cancels the watch.
+func (c *adsClient) watch(typeURL, name string, fn func(any)) func() {
+	w := &resourceWatcher{fn: fn}
+	c.mu.Lock()
+	sub, ok := c.subs[typeURL]
+	if !ok {
+		sub = &subscription{
+			watchers:  map[string]map[*resourceWatcher]struct{}{},
+			resources: map[string]any{},
+		}
+		c.subs[typeURL] = sub
+	}
+	watchers, subscribed := sub.watchers[name]
+	if !subscribed {
+		watchers = map[*resourceWatcher]struct{}{}
+		sub.watchers[name] = watchers
+	}
+	watchers[w] = struct{}{}
+	cached, hasCached := sub.resources[name]
+	c.mu.Unlock()
+
+	if !subscribed {
+		c.sendRequest(typeURL)
+	}
+	if hasCached {
+		fn(cached)
+	}
+
+	var once sync.Once
+	return func() {
+		once.Do(func() { c.unwatch(typeURL, name, w) })
+	}
+}
+
+func (c *adsClient) unwatch(typeURL, name string, w *resourceWatcher) {
+	c.mu.Lock()
+	sub := c.subs[typeURL]
+	watchers := sub.watchers[name]
+	delete(watchers, w)
+	removed := len(watchers) == 0
+	if removed {
+		delete(sub.watchers, name)
+		delete(sub.resources, name)
+	}
+	c.mu.Unlock()
+	if removed {
+		c.sendRequest(typeURL)
+	}
+}
+
+func (c *adsClient) requestLocked(typeURL, errorDetail string) discoveryRequest {
+	sub := c.subs[typeURL]
+	names := make([]string, 0, len(sub.watchers))
+	for name := range sub.watchers {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return discoveryRequest{
+		versionInfo:   sub.version,
+		node:          c.cfg.Node,
+		resourceNames: names,
+		typeURL:       typeURL,
+		nonce:         sub.nonce,
+		errorDetail:   errorDetail,
+	}
+}
+
+func (c *adsClient) sendRequest(typeURL string) {
+	c.mu.Lock()
+	stream := c.stream
+	if stream == nil {
+		c.mu.Unlock()
+		return
+	}
+	req := c.requestLocked(typeURL, "")
+	c.mu.Unlock()
+	c.send(stream, req)
+}
+
+func (c *adsClient) send(stream grpc.ClientStream, req discoveryRequest) {
+	msg := req.marshal()
+	c.sendMu.Lock()
+	defer c.sendMu.Unlock()
+	if err := stream.SendMsg(&msg); err != nil {
+		slog.Debug("fault to send xds request",
+			slog.String("type", req.typeURL),
+			slog.Any("error", err))
+	}
+}
+
+func (c *adsClient) run() {
+	defer close(c.done)
+	strategy := backoff.Exponential{Config: c.cfg.Backoff}
+	retries := 0
+	for {
+		received, err := c.runStream()
+		if c.ctx.Err() != nil {
+			return
+		}
+		if received {
+			retries = 0
+		}
+		slog.Warn("xds stream broken",
+			slog.String("server", c.cfg.Server),
+			slog.Any("error", err))
+		timer := c.clock.NewTimer(strategy.Backoff(retries))
+		retries++
+		select {
+		case <-c.ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C():
+		}
+	}
+}
+
+// runStream serves one ADS stream until it breaks and reports whether any
+// response was received.
+func (c *adsClient) runStream() (bool, error) {
+	ctx, cancel := context.WithCancel(c.ctx)
+	defer cancel()
+	stream, err := c.conn.NewStream(ctx, adsStreamDesc, adsMethod,
+		grpc.ForceCodecV2(rawCodec{}))
+	if err != nil {
+		return false, err
+	}
+
+	c.mu.Lock()
+	c.stream = stream
+	requests := make([]discoveryRequest, 0, len(c.subs))
+	for typeURL := range c.subs {
+		requests = append(requests, c.requestLocked(typeURL, ""))
+	}
+	c.mu.Unlock()
+	defer func() {
+		c.mu.Lock()
+		if c.stream == stream {
+			c.stream = nil
+		}
+		c.mu.Unlock()
+	}()
+	for _, req := range requests {
+		c.send(stream, req)
+	}
+
+	received := false
+	for {
+		var msg []byte
+		if err := stream.RecvMsg(&msg); err != nil {
+			return received, err
+		}
+		received = true
+		resp, err := decodeDiscoveryResponse(msg)
+		if err != nil {
+			slog.Warn("drop malformed xds response", slog.Any("error", err))
+			continue
+		}
+		c.handleResponse(stream, resp)
+	}
+}
+
+type notification struct {
+	fn       func(any)
+	resource any
+}
+
+func (c *adsClient) handleResponse(stream grpc.ClientStream, resp *discoveryResponse) {
+	decoded := make(map[string]any, len(resp.resources))
+	var decodeErr error
+	for _, raw := range resp.resources {
+		name, res, err := decodeResource(resp.typeURL, raw)
+		if err != nil {
+			decodeErr = errors.Join(decodeErr, err)
+			continue
+		}
+		decoded[name] = res
+	}
+
+	c.mu.Lock()
+	sub, ok := c.subs[resp.typeURL]
+	if !ok {
+		c.mu.Unlock()
+		return
+	}
+	sub.nonce = resp.nonce
+	if decodeErr != nil {
+		req := c.requestLocked(resp.typeURL, decodeErr.Error())
+		c.mu.Unlock()
+		slog.Warn("reject xds response",
+			slog.String("type", resp.typeURL),
+			slog.String("version", resp.versionInfo),
+			slog.Any("error", decodeErr))
+		c.send(stream, req)
+		return
+	}
+	sub.version = resp.versionInfo
+	var notifications []notification
+	notify := func(name string, res any) {
+		for w := range sub.watchers[name] {
+			notifications = append(notifications, notification{fn: w.fn, resource: res})
+		}
+	}
+	for name, res := range decoded {
+		if _, subscribed := sub.watchers[name]; !subscribed {
+			continue
+		}
+		sub.resources[name] = res
+		notify(name, res)
+	}
+	if stateOfTheWorld(resp.typeURL) {
+		for name := range sub.watchers {
+			if _, ok := decoded[name]; ok {
+				continue
+			}
+			if _, had := sub.resources[name]; had {
+				delete(sub.resources, name)
+				notify(name, nil)
+			}
+		}
+	}
+	req := c.requestLocked(resp.typeURL, "")
+	c.mu.Unlock()
+
+	c.send(stream, req)
+	for _, item := range notifications {
+		item.fn(item.resource)
+	}
+}
+
+func (c *adsClient) close() error {
+	c.cancel()
+	err := c.conn.Close()
+	<-c.done
+	return err
+}
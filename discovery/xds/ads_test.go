@@ -0,0 +1,352 @@
+// Copyright 2022 The codesjoy Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package xds
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+
+	"github.com/codesjoy/yggdrasil/v3/internal/backoff"
+)
+
+// fakeADS is a minimal state-of-the-world ADS management server.
+type fakeADS struct {
+	addr     string
+	server   *grpc.Server
+	requests chan discoveryRequest
+
+	mu        sync.Mutex
+	version   int
+	resources map[string]map[string][]byte
+	streams   map[*fakeStream]struct{}
+}
+
+type fakeStream struct {
+	names map[string][]string
+	wake  chan string
+}
+
+func newFakeADS(t *testing.T) *fakeADS {
+	t.Helper()
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	return serveFakeADS(t, lis)
+}
+
+func serveFakeADS(t *testing.T, lis net.Listener) *fakeADS {
+	t.Helper()
+	f := &fakeADS{
+		addr:      lis.Addr().String(),
+		server:    grpc.NewServer(grpc.ForceServerCodecV2(rawCodec{})),
+		requests:  make(chan discoveryRequest, 128),
+		resources: map[string]map[string][]byte{},
+		streams:   map[*fakeStream]struct{}{},
+	}
+	f.server.RegisterService(&grpc.ServiceDesc{
+		ServiceName: "envoy.service.discovery.v3.AggregatedDiscoveryService",
+		HandlerType: (*any)(nil),
+		Streams: []grpc.StreamDesc{{
+			StreamName:    "StreamAggregatedResources",
+			Handler:       f.handle,
+			ServerStreams: true,
+			ClientStreams: true,
+		}},
+	}, struct{}{})
+	go f.server.Serve(lis) //nolint:errcheck
+	t.Cleanup(f.server.Stop)
+	return f
+}
+
+func (f *fakeADS) set(typeURL, name string, value []byte) {
+	f.mu.Lock()
+	if f.resources[typeURL] == nil {
+		f.resources[typeURL] = map[string][]byte{}
+	}
+	if value == nil {
+		delete(f.resources[typeURL], name)
+	} else {
+		f.resources[typeURL][name] = value
+	}
+	f.version++
+	streams := make([]*fakeStream, 0, len(f.streams))
+	for s := range f.streams {
+		streams = append(streams, s)
+	}
+	f.mu.Unlock()
+	for _, s := range streams {
+		s.wake <- typeURL
+	}
+}
+
+func (f *fakeADS) handle(_ any, stream grpc.ServerStream) error {
+	s := &fakeStream{names: map[string][]string{}, wake: make(chan string, 64)}
+	f.mu.Lock()
+	f.streams[s] = struct{}{}
+	f.mu.Unlock()
+	defer func() {
+		f.mu.Lock()
+		delete(f.streams, s)
+		f.mu.Unlock()
+	}()
+
+	errCh := make(chan error, 1)
+	go func() {
+		for {
+			var msg []byte
+			if err := stream.RecvMsg(&msg); err != nil {
+				errCh <- err
+				return
+			}
+			req := decodeTestRequest(msg)
+			f.requests <- req
+			f.mu.Lock()
+			changed := !slices.Equal(s.names[req.typeURL], req.resourceNames)
+			s.names[req.typeURL] = req.resourceNames
+			f.mu.Unlock()
+			if changed {
+				s.wake <- req.typeURL
+			}
+		}
+	}()
+	for {
+		select {
+		case err := <-errCh:
+			return err
+		case typeURL := <-s.wake:
+			if msg, ok := f.response(s, typeURL); ok {
+				if err := stream.SendMsg(&msg); err != nil {
+					return err
+				}
+			}
+		}
+	}
+}
+
+func (f *fakeADS) response(s *fakeStream, typeURL string) ([]byte, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	names, ok := s.names[typeURL]
+	if !ok {
+		return nil, false
+	}
+	version := strconv.Itoa(f.version)
+	b := appendString(nil, 1, version)
+	for _, name := range names {
+		if value, ok := f.resources[typeURL][name]; ok {
+			b = appendMessage(b, 2, encAny(typeURL, value))
+		}
+	}
+	b = appendString(b, 4, typeURL)
+	return appendString(b, 5, "nonce-"+version), true
+}
+
+func decodeTestRequest(b []byte) discoveryRequest {
+	var req discoveryRequest
+	_ = forEachField(b, func(f field) error {
+		switch f.num {
+		case 1:
+			req.versionInfo = string(f.bytes)
+		case 2:
+			return forEachField(f.bytes, func(f field) error {
+				switch f.num {
+				case 1:
+					req.node.ID = string(f.bytes)
+				case 4:
+					return forEachField(f.bytes, func(f field) error {
+						if f.num == 1 {
+							req.node.Region = string(f.bytes)
+						}
+						return nil
+					})
+				}
+				return nil
+			})
+		case 3:
+			req.resourceNames = append(req.resourceNames, string(f.bytes))
+		case 4:
+			req.typeURL = string(f.bytes)
+		case 5:
+			req.nonce = string(f.bytes)
+		case 6:
+			return forEachField(f.bytes, func(f field) error {
+				if f.num == 2 {
+					req.errorDetail = string(f.bytes)
+				}
+				return nil
+			})
+		}
+		return nil
+	})
+	return req
+}
+
+func newTestADSClient(t *testing.T, server string) *adsClient {
+	t.Helper()
+	c, err := newADSClient(Config{
+		Server: server,
+		Node:   NodeConfig{ID: "node-1"},
+		TLS:    TLSConfig{Insecure: true},
+		Backoff: backoff.Config{
+			BaseDelay:  10 * time.Millisecond,
+			Multiplier: 1.6,
+			MaxDelay:   100 * time.Millisecond,
+		},
+	})
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = c.close() })
+	return c
+}
+
+func waitRequest(
+	t *testing.T,
+	f *fakeADS,
+	match func(discoveryRequest) bool,
+) discoveryRequest {
+	t.Helper()
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case req := <-f.requests:
+			if match(req) {
+				return req
+			}
+		case <-timeout:
+			t.Fatal("timed out waiting for xds request")
+		}
+	}
+}
+
+func TestDiscoveryRequestMarshal(t *testing.T) {
+	req := discoveryRequest{
+		versionInfo:   "3",
+		node:          NodeConfig{ID: "n", Region: "r"},
+		resourceNames: []string{"a", "b"},
+		typeURL:       ClusterType,
+		nonce:         "x",
+		errorDetail:   "bad",
+	}
+	assert.Equal(t, req, decodeTestRequest(req.marshal()))
+}
+
+func TestDecodeDiscoveryResponseUnwrapsResource(t *testing.T) {
+	wrapped := appendMessage(nil, 2, encAny(ClusterType, encCluster("c1", "")))
+	b := appendMessage(nil, 2, encAny(resourceWrapperType, wrapped))
+	b = appendString(b, 4, ClusterType)
+	resp, err := decodeDiscoveryResponse(b)
+	require.NoError(t, err)
+	require.Len(t, resp.resources, 1)
+	name, res, err := decodeResource(resp.typeURL, resp.resources[0])
+	require.NoError(t, err)
+	assert.Equal(t, "c1", name)
+	assert.Equal(t, &Cluster{Name: "c1", EDSServiceName: "c1"}, res)
+}
+
+func TestADSClientWatchAndACK(t *testing.T) {
+	f := newFakeADS(t)
+	f.set(ClusterType, "c1", encCluster("c1", ""))
+	c := newTestADSClient(t, f.addr)
+
+	updates := make(chan any, 8)
+	cancel := c.watch(ClusterType, "c1", func(res any) { updates <- res })
+	req := waitRequest(t, f, func(r discoveryRequest) bool { return r.typeURL == ClusterType })
+	assert.Equal(t, []string{"c1"}, req.resourceNames)
+	assert.Equal(t, "node-1", req.node.ID)
+
+	select {
+	case res := <-updates:
+		assert.Equal(t, &Cluster{Name: "c1", EDSServiceName: "c1"}, res)
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for cluster")
+	}
+	ack := waitRequest(t, f, func(r discoveryRequest) bool { return r.nonce != "" })
+	assert.NotEmpty(t, ack.versionInfo)
+	assert.Empty(t, ack.errorDetail)
+
+	// Removing a state-of-the-world resource notifies its deletion.
+	f.set(ClusterType, "c1", nil)
+	select {
+	case res := <-updates:
+		assert.Nil(t, res)
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for deletion")
+	}
+
+	cancel()
+	req = waitRequest(t, f, func(r discoveryRequest) bool {
+		return r.typeURL == ClusterType && len(r.resourceNames) == 0
+	})
+	assert.Empty(t, req.resourceNames)
+}
+
+func TestADSClientNACKsMalformedResource(t *testing.T) {
+	f := newFakeADS(t)
+	f.set(EndpointType, "c1", []byte{0xff})
+	c := newTestADSClient(t, f.addr)
+
+	updates := make(chan any, 1)
+	c.watch(EndpointType, "c1", func(res any) { updates <- res })
+	nack := waitRequest(t, f, func(r discoveryRequest) bool { return r.errorDetail != "" })
+	assert.Empty(t, nack.versionInfo)
+	assert.NotEmpty(t, nack.nonce)
+	assert.Empty(t, updates)
+}
+
+func TestADSClientResubscribesAfterReconnect(t *testing.T) {
+	f := newFakeADS(t)
+	f.set(ClusterType, "c1", encCluster("c1", ""))
+	c := newTestADSClient(t, f.addr)
+
+	updates := make(chan any, 8)
+	c.watch(ClusterType, "c1", func(res any) { updates <- res })
+	<-updates
+
+	// A second server on the same address takes over after a restart.
+	f.server.Stop()
+	lis, err := net.Listen("tcp", f.addr)
+	require.NoError(t, err)
+	g := serveFakeADS(t, lis)
+
+	req := waitRequest(t, g, func(r discoveryRequest) bool { return r.typeURL == ClusterType })
+	assert.Equal(t, []string{"c1"}, req.resourceNames)
+}
+
+func TestTransportCredentials(t *testing.T) {
+	creds, err := transportCredentials(TLSConfig{})
+	require.NoError(t, err)
+	assert.Equal(t, "tls", creds.Info().SecurityProtocol, "tls is the default")
+
+	creds, err = transportCredentials(TLSConfig{Insecure: true})
+	require.NoError(t, err)
+	assert.Equal(t, "insecure", creds.Info().SecurityProtocol)
+
+	_, err = transportCredentials(TLSConfig{CAFile: filepath.Join(t.TempDir(), "missing.pem")})
+	assert.Error(t, err)
+	empty := filepath.Join(t.TempDir(), "empty.pem")
+	require.NoError(t, os.WriteFile(empty, nil, 0o600))
+	_, err = transportCredentials(TLSConfig{CAFile: empty})
+	assert.Error(t, err)
+	_, err = transportCredentials(TLSConfig{CertFile: "missing.pem"})
+	assert.Error(t, err)
+}
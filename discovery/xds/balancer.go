@@ -0,0 +1,287 @@
+// Copyright 2022 The codesjoy Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package xds
+
+import (
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"slices"
+	"sync"
+
+	"github.com/codesjoy/yggdrasil/v3/discovery/resolver"
+	remote "github.com/codesjoy/yggdrasil/v3/transport"
+	"github.com/codesjoy/yggdrasil/v3/transport/runtime/client/balancer"
+)
+
+// BalancerName is the type of the balancer that splits traffic between the
+// clusters published by the xds resolver.
+const BalancerName = "xds_weighted"
+
+// BalancerProvider returns the provider of the xds_weighted balancer. It
+// groups endpoints by cluster, balances each cluster round robin and picks
+// a ready cluster by its route weight.
+func BalancerProvider() balancer.Provider {
+	return balancer.NewProvider(
+		BalancerName,
+		func(_, _ string, cli balancer.Client) (balancer.Balancer, error) {
+			return &weightedBalancer{cli: cli, clusters: map[string]*clusterBalancer{}}, nil
+		},
+	)
+}
+
+type weightedBalancer struct {
+	cli balancer.Client
+
+	mu       sync.Mutex
+	closed   bool
+	clusters map[string]*clusterBalancer
+}
+
+type clusterBalancer struct {
+	name     string
+	weight   int
+	balancer balancer.Balancer
+	state    balancer.State
+}
+
+// UpdateState splits the endpoints by cluster and forwards them to the
+// cluster balancers.
+func (b *weightedBalancer) UpdateState(state resolver.State) {
+	states := map[string]*resolver.BaseState{}
+	weights := map[string]int{}
+	for _, endpoint := range state.GetEndpoints() {
+		if endpoint == nil {
+			continue
+		}
+		attrs := endpoint.GetAttributes()
+		name := fmt.Sprint(attrs[AttrCluster])
+		if attrs[AttrCluster] == nil {
+			name = ""
+		}
+		st, ok := states[name]
+		if !ok {
+			st = &resolver.BaseState{Attributes: state.GetAttributes()}
+			states[name] = st
+			weights[name] = clusterWeight(attrs[AttrClusterWeight])
+		}
+		st.Endpoints = append(st.Endpoints, endpoint)
+	}
+
+	b.mu.Lock()
+	if b.closed {
+		b.mu.Unlock()
+		return
+	}
+	var removed []*clusterBalancer
+	for name, cb := range b.clusters {
+		if _, ok := states[name]; !ok {
+			removed = append(removed, cb)
+			delete(b.clusters, name)
+		}
+	}
+	updates := make(map[*clusterBalancer]resolver.State, len(states))
+	var buildErr error
+	for name, st := range states {
+		cb, ok := b.clusters[name]
+		if !ok {
+			cb = &clusterBalancer{
+				name:  name,
+				state: balancer.State{ConnectivityState: remote.Idle},
+			}
+			child, err := balancer.BuiltinProvider().New("", "",
+				&clusterClient{owner: b, cluster: cb})
+			if err != nil {
+				buildErr = errors.Join(buildErr, err)
+				continue
+			}
+			cb.balancer = child
+			b.clusters[name] = cb
+		}
+		cb.weight = weights[name]
+		updates[cb] = *st
+	}
+	var next *balancer.State
+	if len(removed) > 0 {
+		st := b.buildStateLocked()
+		next = &st
+	}
+	b.mu.Unlock()
+
+	for _, cb := range removed {
+		_ = cb.balancer.Close()
+	}
+	if next != nil {
+		b.cli.UpdateState(*next)
+	}
+	for cb, st := range updates {
+		cb.balancer.UpdateState(st)
+	}
+	if buildErr != nil {
+		b.cli.UpdateState(balancer.State{
+			ConnectivityState: remote.TransientFailure,
+			Picker:            errPicker{err: buildErr},
+		})
+	}
+}
+
+func clusterWeight(v any) int {
+	switch weight := v.(type) {
+	case int:
+		return max(weight, 0)
+	case uint32:
+		return int(weight)
+	default:
+		return 0
+	}
+}
+
+// Close closes all cluster balancers.
+func (b *weightedBalancer) Close() error {
+	b.mu.Lock()
+	if b.closed {
+		b.mu.Unlock()
+		return nil
+	}
+	b.closed = true
+	clusters := b.clusters
+	b.clusters = nil
+	b.mu.Unlock()
+
+	var multiErr error
+	for _, cb := range clusters {
+		if err := cb.balancer.Close(); err != nil {
+			multiErr = errors.Join(multiErr, err)
+		}
+	}
+	b.cli.UpdateState(balancer.State{
+		ConnectivityState: remote.Shutdown,
+		Picker:            errPicker{err: balancer.ErrNoAvailableInstance},
+	})
+	return multiErr
+}
+
+// Type returns the type of the balancer.
+func (b *weightedBalancer) Type() string {
+	return BalancerName
+}
+
+func (b *weightedBalancer) updateClusterState(cb *clusterBalancer, state balancer.State) {
+	b.mu.Lock()
+	if b.closed || b.clusters[cb.name] != cb {
+		b.mu.Unlock()
+		return
+	}
+	cb.state = state
+	next := b.buildStateLocked()
+	b.mu.Unlock()
+	b.cli.UpdateState(next)
+}
+
+func (b *weightedBalancer) buildStateLocked() balancer.State {
+	names := make([]string, 0, len(b.clusters))
+	for name := range b.clusters {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+
+	picker := &weightedPicker{}
+	var numConnecting, numIdle int
+	for _, name := range names {
+		cb := b.clusters[name]
+		if cb.state.Picker == nil {
+			continue
+		}
+		if picker.fallback == nil {
+			picker.fallback = cb.state.Picker
+		}
+		switch cb.state.ConnectivityState {
+		case remote.Ready:
+			picker.ready = append(picker.ready, cb.state.Picker)
+			picker.weights = append(picker.weights, cb.weight)
+			picker.total += cb.weight
+		case remote.Connecting:
+			numConnecting++
+		case remote.Idle:
+			numIdle++
+		}
+	}
+	switch {
+	case len(picker.ready) > 0:
+		return balancer.State{ConnectivityState: remote.Ready, Picker: picker}
+	case numConnecting > 0:
+		return balancer.State{ConnectivityState: remote.Connecting, Picker: picker}
+	case numIdle > 0:
+		return balancer.State{ConnectivityState: remote.Idle, Picker: picker}
+	default:
+		return balancer.State{ConnectivityState: remote.TransientFailure, Picker: picker}
+	}
+}
+
+// weightedPicker picks a ready cluster by weight; ready clusters share the
+// traffic evenly when none has a weight.
+type weightedPicker struct {
+	ready    []balancer.Picker
+	weights  []int
+	total    int
+	fallback balancer.Picker
+}
+
+// Next returns the next remote client.
+func (p *weightedPicker) Next(info balancer.RPCInfo) (balancer.PickResult, error) {
+	if len(p.ready) == 0 {
+		if p.fallback == nil {
+			return nil, balancer.ErrNoAvailableInstance
+		}
+		return p.fallback.Next(info)
+	}
+	if p.total == 0 {
+		return p.ready[rand.IntN(len(p.ready))].Next(info)
+	}
+	n := rand.IntN(p.total)
+	for i, weight := range p.weights {
+		if n < weight {
+			return p.ready[i].Next(info)
+		}
+		n -= weight
+	}
+	return p.ready[0].Next(info)
+}
+
+type errPicker struct {
+	err error
+}
+
+// Next returns the picker error.
+func (p errPicker) Next(balancer.RPCInfo) (balancer.PickResult, error) {
+	return nil, p.err
+}
+
+// clusterClient is the Client given to one cluster balancer.
+type clusterClient struct {
+	owner   *weightedBalancer
+	cluster *clusterBalancer
+}
+
+func (c *clusterClient) UpdateState(state balancer.State) {
+	c.owner.updateClusterState(c.cluster, state)
+}
+
+func (c *clusterClient) NewRemoteClient(
+	endpoint resolver.Endpoint,
+	opts balancer.NewRemoteClientOptions,
+) (remote.Client, error) {
+	return c.owner.cli.NewRemoteClient(endpoint, opts)
+}
@@ -0,0 +1,166 @@
+// Copyright 2022 The codesjoy Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package xds
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/codesjoy/yggdrasil/v3/discovery/resolver"
+	"github.com/codesjoy/yggdrasil/v3/rpc/stream"
+	remote "github.com/codesjoy/yggdrasil/v3/transport"
+	"github.com/codesjoy/yggdrasil/v3/transport/runtime/client/balancer"
+)
+
+type fakeRemoteClient struct {
+	address string
+}
+
+func (c *fakeRemoteClient) NewStream(
+	context.Context,
+	*stream.Desc,
+	string,
+) (stream.ClientStream, error) {
+	return nil, nil
+}
+
+func (c *fakeRemoteClient) Close() error { return nil }
+
+func (c *fakeRemoteClient) Protocol() string { return "fake" }
+
+func (c *fakeRemoteClient) State() remote.State { return remote.Ready }
+
+func (c *fakeRemoteClient) Connect() {}
+
+type fakeBalancerClient struct {
+	mu        sync.Mutex
+	state     balancer.State
+	listeners map[string]func(remote.ClientState)
+}
+
+func (c *fakeBalancerClient) UpdateState(state balancer.State) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.state = state
+}
+
+func (c *fakeBalancerClient) NewRemoteClient(
+	endpoint resolver.Endpoint,
+	opts balancer.NewRemoteClientOptions,
+) (remote.Client, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.listeners[endpoint.GetAddress()] = opts.StateListener
+	return &fakeRemoteClient{address: endpoint.GetAddress()}, nil
+}
+
+func (c *fakeBalancerClient) current() balancer.State {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.state
+}
+
+func (c *fakeBalancerClient) fail(endpoint resolver.Endpoint) {
+	c.mu.Lock()
+	listener := c.listeners[endpoint.GetAddress()]
+	c.mu.Unlock()
+	listener(remote.ClientState{Endpoint: endpoint, State: remote.TransientFailure})
+}
+
+func clusterEndpoint(address, cluster string, weight int) resolver.Endpoint {
+	return resolver.BaseEndpoint{
+		Address:  address,
+		Protocol: "grpc",
+		Attributes: map[string]any{
+			AttrCluster:       cluster,
+			AttrClusterWeight: weight,
+		},
+	}
+}
+
+func pickAddresses(t *testing.T, picker balancer.Picker, n int) map[string]int {
+	t.Helper()
+	out := map[string]int{}
+	for range n {
+		res, err := picker.Next(balancer.RPCInfo{Ctx: context.Background()})
+		require.NoError(t, err)
+		out[res.RemoteClient().(*fakeRemoteClient).address]++
+	}
+	return out
+}
+
+func newTestBalancer(t *testing.T) (balancer.Balancer, *fakeBalancerClient) {
+	t.Helper()
+	cli := &fakeBalancerClient{listeners: map[string]func(remote.ClientState){}}
+	b, err := BalancerProvider().New("svc", "default", cli)
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = b.Close() })
+	return b, cli
+}
+
+func TestWeightedBalancerSplitsByClusterWeight(t *testing.T) {
+	b, cli := newTestBalancer(t)
+	assert.Equal(t, BalancerName, b.Type())
+
+	b.UpdateState(resolver.BaseState{Endpoints: []resolver.Endpoint{
+		clusterEndpoint("a1", "a", 100),
+		clusterEndpoint("b1", "b", 0),
+	}})
+	state := cli.current()
+	require.Equal(t, remote.Ready, state.ConnectivityState)
+	assert.Equal(t, map[string]int{"a1": 50}, pickAddresses(t, state.Picker, 50))
+
+	b.UpdateState(resolver.BaseState{Endpoints: []resolver.Endpoint{
+		clusterEndpoint("a1", "a", 1),
+		clusterEndpoint("b1", "b", 1),
+	}})
+	got := pickAddresses(t, cli.current().Picker, 400)
+	assert.Greater(t, got["a1"], 100)
+	assert.Greater(t, got["b1"], 100)
+}
+
+func TestWeightedBalancerSkipsUnavailableCluster(t *testing.T) {
+	b, cli := newTestBalancer(t)
+	a1 := clusterEndpoint("a1", "a", 90)
+	b.UpdateState(resolver.BaseState{Endpoints: []resolver.Endpoint{
+		a1,
+		clusterEndpoint("b1", "b", 10),
+	}})
+	cli.fail(a1)
+	assert.Equal(t, map[string]int{"b1": 20}, pickAddresses(t, cli.current().Picker, 20))
+
+	// Removing a cluster drops it from the picker.
+	b.UpdateState(resolver.BaseState{Endpoints: []resolver.Endpoint{
+		clusterEndpoint("c1", "c", 1),
+	}})
+	assert.Equal(t, map[string]int{"c1": 20}, pickAddresses(t, cli.current().Picker, 20))
+}
+
+func TestWeightedBalancerClose(t *testing.T) {
+	b, cli := newTestBalancer(t)
+	b.UpdateState(resolver.BaseState{Endpoints: []resolver.Endpoint{
+		clusterEndpoint("a1", "a", 1),
+	}})
+	require.NoError(t, b.Close())
+	require.NoError(t, b.Close())
+	state := cli.current()
+	assert.Equal(t, remote.Shutdown, state.ConnectivityState)
+	_, err := state.Picker.Next(balancer.RPCInfo{Ctx: context.Background()})
+	assert.ErrorIs(t, err, balancer.ErrNoAvailableInstance)
+}
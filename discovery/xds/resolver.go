@@ -0,0 +1,483 @@
+// Copyright 2022 The codesjoy Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package xds
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/codesjoy/yggdrasil/v3/discovery/registry"
+	"github.com/codesjoy/yggdrasil/v3/discovery/resolver"
+)
+
+const (
+	// Scheme is the target scheme served by the xds resolver: xds:///service.
+	Scheme = "xds"
+
+	// AttrCluster is the endpoint attribute naming the cluster it belongs to.
+	AttrCluster = "xds.cluster"
+	// AttrClusterWeight is the endpoint attribute carrying the route weight
+	// of its cluster.
+	AttrClusterWeight = "xds.cluster_weight"
+	// AttrPriority is the endpoint attribute carrying its locality priority.
+	AttrPriority = "xds.priority"
+	// AttrSubZone is the endpoint attribute carrying its locality sub zone.
+	AttrSubZone = "xds.sub_zone"
+)
+
+// ParseTarget returns the listener name addressed by target. It accepts
+// xds:///service, xds://authority/service and a bare service name.
+func ParseTarget(target string) (string, error) {
+	if !strings.HasPrefix(target, Scheme+":") {
+		if target == "" {
+			return "", errors.New("xds target is empty")
+		}
+		return target, nil
+	}
+	u, err := url.Parse(target)
+	if err != nil {
+		return "", fmt.Errorf("parse xds target %q: %w", target, err)
+	}
+	name := strings.TrimPrefix(u.Path, "/")
+	if name == "" {
+		name = u.Opaque
+	}
+	if name == "" {
+		return "", fmt.Errorf("xds target %q has no service name", target)
+	}
+	return name, nil
+}
+
+type xdsResolver struct {
+	ads      func() (*adsClient, error)
+	protocol string
+
+	mu      sync.Mutex
+	targets map[string]*targetWatch
+}
+
+func newResolver(ads func() (*adsClient, error), protocol string) *xdsResolver {
+	return &xdsResolver{ads: ads, protocol: protocol, targets: map[string]*targetWatch{}}
+}
+
+// AddWatch watches the listener named by appName and the resources it
+// references.
+func (r *xdsResolver) AddWatch(appName string, cli resolver.Client) error {
+	name, err := ParseTarget(appName)
+	if err != nil {
+		return err
+	}
+	ads, err := r.ads()
+	if err != nil {
+		return err
+	}
+	r.mu.Lock()
+	tw, ok := r.targets[appName]
+	if !ok {
+		tw = newTargetWatch(ads, name, r.protocol)
+		r.targets[appName] = tw
+	}
+	r.mu.Unlock()
+	tw.addClient(cli)
+	return nil
+}
+
+// DelWatch removes cli; the resources of appName are unsubscribed with its
+// last client.
+func (r *xdsResolver) DelWatch(appName string, cli resolver.Client) error {
+	r.mu.Lock()
+	tw, ok := r.targets[appName]
+	if !ok {
+		r.mu.Unlock()
+		return nil
+	}
+	if tw.delClient(cli) == 0 {
+		delete(r.targets, appName)
+		r.mu.Unlock()
+		tw.close()
+		return nil
+	}
+	r.mu.Unlock()
+	return nil
+}
+
+// Type returns the type of the resolver.
+func (r *xdsResolver) Type() string {
+	return Scheme
+}
+
+type resourceEvent struct {
+	typeURL  string
+	name     string
+	resource any
+}
+
+type clusterWatch struct {
+	weight    uint32
+	cluster   *Cluster
+	cancelCDS func()
+	edsName   string
+	cancelEDS func()
+	cla       *ClusterLoadAssignment
+}
+
+// targetWatch follows the resource chain of one listener: the listener, its
+// route configuration, the clusters of the selected route and their
+// endpoints. Resource updates are queued and applied by one goroutine so
+// watches may be added from within update handling.
+type targetWatch struct {
+	ads      *adsClient
+	name     string
+	protocol string
+
+	queueMu sync.Mutex
+	queue   []resourceEvent
+	wake    chan struct{}
+	done    chan struct{}
+
+	// Owned by the loop goroutine.
+	listener  *Listener
+	cancelLDS func()
+	routeName string
+	cancelRDS func()
+	route     *RouteConfiguration
+	clusters  map[string]*clusterWatch
+
+	mu      sync.Mutex
+	clients []resolver.Client
+	state   resolver.State
+}
+
+func newTargetWatch(ads *adsClient, name, protocol string) *targetWatch {
+	tw := &targetWatch{
+		ads:      ads,
+		name:     name,
+		protocol: protocol,
+		wake:     make(chan struct{}, 1),
+		done:     make(chan struct{}),
+		clusters: map[string]*clusterWatch{},
+	}
+	go tw.loop()
+	tw.cancelLDS = ads.watch(ListenerType, name, tw.handler(ListenerType, name))
+	return tw
+}
+
+func (tw *targetWatch) handler(typeURL, name string) func(any) {
+	return func(res any) {
+		tw.queueMu.Lock()
+		tw.queue = append(tw.queue, resourceEvent{typeURL: typeURL, name: name, resource: res})
+		tw.queueMu.Unlock()
+		select {
+		case tw.wake <- struct{}{}:
+		default:
+		}
+	}
+}
+
+func (tw *targetWatch) addClient(cli resolver.Client) {
+	tw.mu.Lock()
+	tw.clients = append(tw.clients, cli)
+	state := tw.state
+	tw.mu.Unlock()
+	if state != nil {
+		cli.UpdateState(state)
+	}
+}
+
+func (tw *targetWatch) delClient(cli resolver.Client) int {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	tw.clients = slices.DeleteFunc(tw.clients, func(c resolver.Client) bool {
+		return c == cli
+	})
+	return len(tw.clients)
+}
+
+func (tw *targetWatch) close() {
+	close(tw.done)
+}
+
+func (tw *targetWatch) loop() {
+	for {
+		select {
+		case <-tw.done:
+			tw.cancelAll()
+			return
+		case <-tw.wake:
+		}
+		tw.queueMu.Lock()
+		events := tw.queue
+		tw.queue = nil
+		tw.queueMu.Unlock()
+		for _, ev := range events {
+			tw.apply(ev)
+		}
+		if len(events) > 0 {
+			tw.publish()
+		}
+	}
+}
+
+func (tw *targetWatch) cancelAll() {
+	if tw.cancelLDS != nil {
+		tw.cancelLDS()
+	}
+	tw.watchRoute("")
+	tw.updateClusters(nil)
+}
+
+func (tw *targetWatch) apply(ev resourceEvent) {
+	switch ev.typeURL {
+	case ListenerType:
+		tw.listener, _ = ev.resource.(*Listener)
+		switch {
+		case tw.listener == nil:
+			tw.watchRoute("")
+			tw.updateClusters(nil)
+		case tw.listener.Route != nil:
+			tw.watchRoute("")
+			tw.route = tw.listener.Route
+			tw.applyRoute(tw.route)
+		default:
+			tw.watchRoute(tw.listener.RouteConfigName)
+		}
+	case RouteType:
+		if ev.name != tw.routeName {
+			return
+		}
+		tw.route, _ = ev.resource.(*RouteConfiguration)
+		tw.applyRoute(tw.route)
+	case ClusterType:
+		cw, ok := tw.clusters[ev.name]
+		if !ok {
+			return
+		}
+		cw.cluster, _ = ev.resource.(*Cluster)
+		edsName := ""
+		if cw.cluster != nil {
+			edsName = cw.cluster.EDSServiceName
+		}
+		if edsName == cw.edsName {
+			return
+		}
+		if cw.cancelEDS != nil {
+			cw.cancelEDS()
+			cw.cancelEDS = nil
+		}
+		cw.edsName, cw.cla = edsName, nil
+		if edsName != "" {
+			cw.cancelEDS = tw.ads.watch(EndpointType, edsName,
+				tw.handler(EndpointType, edsName))
+		}
+	case EndpointType:
+		cla, _ := ev.resource.(*ClusterLoadAssignment)
+		for _, cw := range tw.clusters {
+			if cw.edsName == ev.name {
+				cw.cla = cla
+			}
+		}
+	}
+}
+
+// watchRoute switches the RDS watch to name; an empty name stops it.
+func (tw *targetWatch) watchRoute(name string) {
+	if name == tw.routeName {
+		return
+	}
+	if tw.cancelRDS != nil {
+		tw.cancelRDS()
+		tw.cancelRDS = nil
+	}
+	tw.routeName, tw.route = name, nil
+	if name != "" {
+		tw.cancelRDS = tw.ads.watch(RouteType, name, tw.handler(RouteType, name))
+	}
+}
+
+func (tw *targetWatch) applyRoute(rc *RouteConfiguration) {
+	if rc == nil {
+		tw.updateClusters(nil)
+		return
+	}
+	route, ok := selectRoute(rc, tw.name)
+	if !ok {
+		tw.updateClusters(nil)
+		return
+	}
+	tw.updateClusters(route.Clusters)
+}
+
+// updateClusters watches exactly the given clusters.
+func (tw *targetWatch) updateClusters(targets []WeightedCluster) {
+	wanted := make(map[string]uint32, len(targets))
+	for _, target := range targets {
+		wanted[target.Name] += target.Weight
+	}
+	for name, cw := range tw.clusters {
+		if _, ok := wanted[name]; ok {
+			continue
+		}
+		cw.cancelCDS()
+		if cw.cancelEDS != nil {
+			cw.cancelEDS()
+		}
+		delete(tw.clusters, name)
+	}
+	for name, weight := range wanted {
+		if cw, ok := tw.clusters[name]; ok {
+			cw.weight = weight
+			continue
+		}
+		cw := &clusterWatch{weight: weight}
+		tw.clusters[name] = cw
+		cw.cancelCDS = tw.ads.watch(ClusterType, name, tw.handler(ClusterType, name))
+	}
+}
+
+// selectRoute picks the virtual host serving name and its default route.
+func selectRoute(rc *RouteConfiguration, name string) (Route, bool) {
+	vh, ok := matchVirtualHost(rc.VirtualHosts, name)
+	if !ok || len(vh.Routes) == 0 {
+		return Route{}, false
+	}
+	for _, route := range vh.Routes {
+		if route.Path == "" && (route.Prefix == "" || route.Prefix == "/") {
+			return route, true
+		}
+	}
+	return vh.Routes[0], true
+}
+
+// matchVirtualHost prefers an exact domain, then the longest suffix or
+// prefix wildcard, then the catch-all "*".
+func matchVirtualHost(hosts []VirtualHost, name string) (VirtualHost, bool) {
+	var (
+		best    VirtualHost
+		bestLen = -1
+		found   bool
+	)
+	for _, vh := range hosts {
+		for _, domain := range vh.Domains {
+			matched := -1
+			switch {
+			case domain == name:
+				return vh, true
+			case domain == "*":
+				matched = 0
+			case strings.HasPrefix(domain, "*") &&
+				strings.HasSuffix(name, domain[1:]):
+				matched = len(domain)
+			case strings.HasSuffix(domain, "*") &&
+				strings.HasPrefix(name, domain[:len(domain)-1]):
+				matched = len(domain)
+			}
+			if matched > bestLen {
+				best, bestLen, found = vh, matched, true
+			}
+		}
+	}
+	return best, found
+}
+
+// publish pushes the endpoints once the route and the endpoints of every
+// selected cluster are known. A deleted listener publishes an empty state.
+func (tw *targetWatch) publish() {
+	var endpoints []resolver.Endpoint
+	switch {
+	case tw.listener == nil:
+		if !tw.hasState() {
+			return
+		}
+	case tw.route == nil:
+		return
+	default:
+		names := make([]string, 0, len(tw.clusters))
+		for name, cw := range tw.clusters {
+			if cw.cla == nil {
+				return
+			}
+			names = append(names, name)
+		}
+		slices.Sort(names)
+		for _, name := range names {
+			endpoints = append(endpoints, tw.clusterEndpoints(name, tw.clusters[name])...)
+		}
+	}
+	state := resolver.BaseState{
+		Attributes: map[string]any{},
+		Endpoints:  endpoints,
+	}
+	tw.mu.Lock()
+	tw.state = state
+	clients := slices.Clone(tw.clients)
+	tw.mu.Unlock()
+	for _, cli := range clients {
+		cli.UpdateState(state)
+	}
+}
+
+func (tw *targetWatch) hasState() bool {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	return tw.state != nil
+}
+
+// clusterEndpoints returns the serving endpoints of the highest priority
+// (lowest number) that has any.
+func (tw *targetWatch) clusterEndpoints(name string, cw *clusterWatch) []resolver.Endpoint {
+	priority, found := uint32(0), false
+	for _, le := range cw.cla.Localities {
+		if !slices.ContainsFunc(le.Endpoints, func(ep LbEndpoint) bool {
+			return ep.Health.Serving()
+		}) {
+			continue
+		}
+		if !found || le.Priority < priority {
+			priority, found = le.Priority, true
+		}
+	}
+	if !found {
+		return nil
+	}
+	var out []resolver.Endpoint
+	for _, le := range cw.cla.Localities {
+		if le.Priority != priority {
+			continue
+		}
+		for _, ep := range le.Endpoints {
+			if !ep.Health.Serving() {
+				continue
+			}
+			out = append(out, resolver.BaseEndpoint{
+				Address:  ep.Address,
+				Protocol: tw.protocol,
+				Attributes: map[string]any{
+					AttrCluster:       name,
+					AttrClusterWeight: int(cw.weight),
+					AttrPriority:      int(le.Priority),
+					AttrSubZone:       le.Locality.SubZone,
+					registry.MDRegion: le.Locality.Region,
+					registry.MDZone:   le.Locality.Zone,
+					registry.MDWeight: int(ep.Weight) * int(le.Weight),
+				},
+			})
+		}
+	}
+	return out
+}
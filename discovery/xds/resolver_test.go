@@ -0,0 +1,213 @@
+// Copyright 2022 The codesjoy Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package xds
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/codesjoy/yggdrasil/v3/discovery/registry"
+	"github.com/codesjoy/yggdrasil/v3/discovery/resolver"
+)
+
+type stateRecorder struct {
+	states chan resolver.State
+}
+
+func newStateRecorder() *stateRecorder {
+	return &stateRecorder{states: make(chan resolver.State, 32)}
+}
+
+func (r *stateRecorder) UpdateState(state resolver.State) {
+	r.states <- state
+}
+
+// next waits for the next state whose endpoint addresses match want.
+func (r *stateRecorder) next(t *testing.T, want ...string) resolver.State {
+	t.Helper()
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case state := <-r.states:
+			got := make([]string, 0, len(state.GetEndpoints()))
+			for _, ep := range state.GetEndpoints() {
+				got = append(got, ep.GetAddress())
+			}
+			if assert.ObjectsAreEqual(want, got) ||
+				(len(want) == 0 && len(got) == 0) {
+				return state
+			}
+		case <-timeout:
+			t.Fatalf("timed out waiting for endpoints %v", want)
+		}
+	}
+}
+
+func TestParseTarget(t *testing.T) {
+	cases := map[string]string{
+		"xds:///svc":           "svc",
+		"xds://authority/svc":  "svc",
+		"xds:svc":              "svc",
+		"svc":                  "svc",
+		"xds:///svc.ns:8080":   "svc.ns:8080",
+		"xds:///a/b":           "a/b",
+		"xds://authority/svc/": "svc/",
+	}
+	for target, want := range cases {
+		got, err := ParseTarget(target)
+		require.NoError(t, err, target)
+		assert.Equal(t, want, got, target)
+	}
+	for _, target := range []string{"", "xds:///", "xds://authority"} {
+		_, err := ParseTarget(target)
+		assert.Error(t, err, target)
+	}
+}
+
+func TestSelectRoute(t *testing.T) {
+	rc := &RouteConfiguration{VirtualHosts: []VirtualHost{
+		{Name: "any", Domains: []string{"*"}, Routes: []Route{
+			{Prefix: "/", Clusters: []WeightedCluster{{Name: "any"}}},
+		}},
+		{Name: "suffix", Domains: []string{"*.example.com"}, Routes: []Route{
+			{Path: "/pkg.Svc/Method", Clusters: []WeightedCluster{{Name: "method"}}},
+			{Prefix: "", Clusters: []WeightedCluster{{Name: "suffix"}}},
+		}},
+		{Name: "exact", Domains: []string{"svc"}, Routes: []Route{
+			{Prefix: "/pkg", Clusters: []WeightedCluster{{Name: "exact"}}},
+		}},
+	}}
+	cases := map[string]string{
+		"svc":             "exact",
+		"api.example.com": "suffix",
+		"other":           "any",
+	}
+	for name, want := range cases {
+		route, ok := selectRoute(rc, name)
+		require.True(t, ok, name)
+		assert.Equal(t, want, route.Clusters[0].Name, name)
+	}
+
+	_, ok := selectRoute(&RouteConfiguration{VirtualHosts: []VirtualHost{
+		{Domains: []string{"other"}},
+	}}, "svc")
+	assert.False(t, ok)
+}
+
+func TestResolverFollowsResourceChain(t *testing.T) {
+	f := newFakeADS(t)
+	f.set(ListenerType, "svc", encListener("svc", "route-a", nil))
+	f.set(RouteType, "route-a", encRouteConfig("route-a", []string{"svc"},
+		WeightedCluster{Name: "a", Weight: 80}, WeightedCluster{Name: "b", Weight: 20}))
+	f.set(ClusterType, "a", encCluster("a", ""))
+	f.set(ClusterType, "b", encCluster("b", "b-eds"))
+	f.set(EndpointType, "a", encCLA("a",
+		LocalityEndpoints{
+			Locality: Locality{Region: "r1", Zone: "z1"},
+			Endpoints: []LbEndpoint{
+				{Address: "10.0.0.1:80", Health: HealthHealthy},
+				{Address: "10.0.0.2:80", Health: HealthUnhealthy},
+			},
+		},
+		LocalityEndpoints{
+			Locality:  Locality{Region: "r2"},
+			Priority:  1,
+			Endpoints: []LbEndpoint{{Address: "10.0.1.1:80"}},
+		},
+	))
+	f.set(EndpointType, "b-eds", encCLA("b-eds", LocalityEndpoints{
+		Locality:  Locality{Region: "r1", Zone: "z2", SubZone: "s"},
+		Weight:    3,
+		Endpoints: []LbEndpoint{{Address: "10.0.2.1:80", Weight: 2}},
+	}))
+
+	ads := newTestADSClient(t, f.addr)
+	r := newResolver(func() (*adsClient, error) { return ads, nil }, "grpc")
+	assert.Equal(t, Scheme, r.Type())
+	rec := newStateRecorder()
+	require.NoError(t, r.AddWatch("xds:///svc", rec))
+
+	state := rec.next(t, "10.0.0.1:80", "10.0.2.1:80")
+	a, b := state.GetEndpoints()[0], state.GetEndpoints()[1]
+	assert.Equal(t, "grpc", a.GetProtocol())
+	assert.Equal(t, map[string]any{
+		AttrCluster:       "a",
+		AttrClusterWeight: 80,
+		AttrPriority:      0,
+		AttrSubZone:       "",
+		registry.MDRegion: "r1",
+		registry.MDZone:   "z1",
+		registry.MDWeight: 1,
+	}, a.GetAttributes())
+	assert.Equal(t, "b", b.GetAttributes()[AttrCluster])
+	assert.Equal(t, 20, b.GetAttributes()[AttrClusterWeight])
+	assert.Equal(t, "s", b.GetAttributes()[AttrSubZone])
+	assert.Equal(t, 6, resolver.Weight(b))
+
+	// The priority 0 locality loses its last healthy endpoint.
+	f.set(EndpointType, "a", encCLA("a",
+		LocalityEndpoints{
+			Locality:  Locality{Region: "r1", Zone: "z1"},
+			Endpoints: []LbEndpoint{{Address: "10.0.0.1:80", Health: HealthDraining}},
+		},
+		LocalityEndpoints{
+			Locality:  Locality{Region: "r2"},
+			Priority:  1,
+			Endpoints: []LbEndpoint{{Address: "10.0.1.1:80"}},
+		},
+	))
+	state = rec.next(t, "10.0.1.1:80", "10.0.2.1:80")
+	assert.Equal(t, 1, state.GetEndpoints()[0].GetAttributes()[AttrPriority])
+
+	// The route moves all traffic to cluster b.
+	f.set(RouteType, "route-a", encRouteConfig("route-a", []string{"svc"},
+		WeightedCluster{Name: "b"}))
+	rec.next(t, "10.0.2.1:80")
+
+	// A late watcher receives the current state immediately.
+	late := newStateRecorder()
+	require.NoError(t, r.AddWatch("xds:///svc", late))
+	late.next(t, "10.0.2.1:80")
+	require.NoError(t, r.DelWatch("xds:///svc", late))
+
+	f.set(ListenerType, "svc", nil)
+	rec.next(t)
+
+	require.NoError(t, r.DelWatch("xds:///svc", rec))
+	waitRequest(t, f, func(req discoveryRequest) bool {
+		return req.typeURL == ListenerType && len(req.resourceNames) == 0
+	})
+}
+
+func TestResolverInlineRouteConfiguration(t *testing.T) {
+	f := newFakeADS(t)
+	f.set(ListenerType, "svc", encListener("svc", "",
+		encRouteConfig("inline", []string{"*"}, WeightedCluster{Name: "a"})))
+	f.set(ClusterType, "a", encCluster("a", ""))
+	f.set(EndpointType, "a", encCLA("a", LocalityEndpoints{
+		Endpoints: []LbEndpoint{{Address: "10.0.0.1:80"}},
+	}))
+
+	ads := newTestADSClient(t, f.addr)
+	r := newResolver(func() (*adsClient, error) { return ads, nil }, "rest")
+	rec := newStateRecorder()
+	require.NoError(t, r.AddWatch("svc", rec))
+	state := rec.next(t, "10.0.0.1:80")
+	assert.Equal(t, "rest", state.GetEndpoints()[0].GetProtocol())
+	require.NoError(t, r.DelWatch("svc", rec))
+}
@@ -0,0 +1,528 @@
+// Copyright 2022 The codesjoy Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package xds
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// Type URLs of the ADS resources the resolver subscribes to.
+const (
+	ListenerType = "type.googleapis.com/envoy.config.listener.v3.Listener"
+	RouteType    = "type.googleapis.com/envoy.config.route.v3.RouteConfiguration"
+	ClusterType  = "type.googleapis.com/envoy.config.cluster.v3.Cluster"
+	EndpointType = "type.googleapis.com/envoy.config.endpoint.v3.ClusterLoadAssignment"
+
+	httpConnectionManagerType = "type.googleapis.com/envoy.extensions.filters.network." +
+		"http_connection_manager.v3.HttpConnectionManager"
+)
+
+// The resources below keep only the fields needed for client routing; the
+// decoders skip everything else.
+
+// Listener is the subset of envoy.config.listener.v3.Listener used by the
+// resolver: the route configuration of its HTTP connection manager.
+type Listener struct {
+	Name string
+	// RouteConfigName names the RDS resource; empty when Route is inline.
+	RouteConfigName string
+	Route           *RouteConfiguration
+}
+
+// RouteConfiguration is the subset of envoy.config.route.v3.RouteConfiguration.
+type RouteConfiguration struct {
+	Name         string
+	VirtualHosts []VirtualHost
+}
+
+// VirtualHost is the subset of envoy.config.route.v3.VirtualHost.
+type VirtualHost struct {
+	Name    string
+	Domains []string
+	Routes  []Route
+}
+
+// Route is the subset of envoy.config.route.v3.Route: a prefix or path match
+// routed to one cluster or to weighted clusters.
+type Route struct {
+	Prefix   string
+	Path     string
+	Clusters []WeightedCluster
+}
+
+// WeightedCluster is one cluster target of a route.
+type WeightedCluster struct {
+	Name   string
+	Weight uint32
+}
+
+// Cluster is the subset of envoy.config.cluster.v3.Cluster.
+type Cluster struct {
+	Name string
+	// EDSServiceName names the EDS resource; it defaults to Name.
+	EDSServiceName string
+}
+
+// ClusterLoadAssignment is the subset of
+// envoy.config.endpoint.v3.ClusterLoadAssignment.
+type ClusterLoadAssignment struct {
+	ClusterName string
+	Localities  []LocalityEndpoints
+}
+
+// Locality identifies where endpoints run.
+type Locality struct {
+	Region  string
+	Zone    string
+	SubZone string
+}
+
+// LocalityEndpoints groups the endpoints of one locality and priority.
+type LocalityEndpoints struct {
+	Locality  Locality
+	Weight    uint32
+	Priority  uint32
+	Endpoints []LbEndpoint
+}
+
+// HealthStatus mirrors envoy.config.core.v3.HealthStatus.
+type HealthStatus int32
+
+// Health statuses.
+const (
+	HealthUnknown HealthStatus = iota
+	HealthHealthy
+	HealthUnhealthy
+	HealthDraining
+	HealthTimeout
+	HealthDegraded
+)
+
+// Serving reports whether endpoints with the status may receive traffic.
+func (s HealthStatus) Serving() bool {
+	switch s {
+	case HealthUnhealthy, HealthDraining, HealthTimeout:
+		return false
+	default:
+		return true
+	}
+}
+
+// LbEndpoint is one endpoint of a locality.
+type LbEndpoint struct {
+	Address string
+	Health  HealthStatus
+	Weight  uint32
+}
+
+var errMalformed = errors.New("malformed xds resource")
+
+// field is one decoded field of a protobuf message.
+type field struct {
+	num    protowire.Number
+	typ    protowire.Type
+	bytes  []byte
+	varint uint64
+}
+
+// forEachField iterates over the fields of a protobuf message.
+func forEachField(b []byte, fn func(f field) error) error {
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			return errMalformed
+		}
+		b = b[n:]
+		f := field{num: num, typ: typ}
+		switch typ {
+		case protowire.VarintType:
+			f.varint, n = protowire.ConsumeVarint(b)
+		case protowire.BytesType:
+			f.bytes, n = protowire.ConsumeBytes(b)
+		default:
+			n = protowire.ConsumeFieldValue(num, typ, b)
+		}
+		if n < 0 {
+			return errMalformed
+		}
+		b = b[n:]
+		if err := fn(f); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func decodeAny(b []byte) (typeURL string, value []byte, err error) {
+	err = forEachField(b, func(f field) error {
+		if f.typ != protowire.BytesType {
+			return nil
+		}
+		switch f.num {
+		case 1:
+			typeURL = string(f.bytes)
+		case 2:
+			value = f.bytes
+		}
+		return nil
+	})
+	return typeURL, value, err
+}
+
+func decodeUInt32Value(b []byte) (uint32, error) {
+	var out uint32
+	err := forEachField(b, func(f field) error {
+		if f.num == 1 && f.typ == protowire.VarintType {
+			out = uint32(f.varint)
+		}
+		return nil
+	})
+	return out, err
+}
+
+// DecodeListener decodes an envoy.config.listener.v3.Listener.
+func DecodeListener(b []byte) (*Listener, error) {
+	out := &Listener{}
+	err := forEachField(b, func(f field) error {
+		if f.typ != protowire.BytesType {
+			return nil
+		}
+		switch f.num {
+		case 1: // name
+			out.Name = string(f.bytes)
+		case 19: // api_listener
+			return forEachField(f.bytes, func(f field) error {
+				if f.num != 1 || f.typ != protowire.BytesType {
+					return nil
+				}
+				typeURL, value, err := decodeAny(f.bytes)
+				if err != nil {
+					return err
+				}
+				if typeURL != httpConnectionManagerType {
+					return fmt.Errorf("unsupported api listener %q", typeURL)
+				}
+				return decodeHTTPConnectionManager(value, out)
+			})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func decodeHTTPConnectionManager(b []byte, out *Listener) error {
+	return forEachField(b, func(f field) error {
+		if f.typ != protowire.BytesType {
+			return nil
+		}
+		switch f.num {
+		case 3: // rds
+			return forEachField(f.bytes, func(f field) error {
+				if f.num == 2 && f.typ == protowire.BytesType { // route_config_name
+					out.RouteConfigName = string(f.bytes)
+				}
+				return nil
+			})
+		case 4: // route_config
+			rc, err := DecodeRouteConfiguration(f.bytes)
+			if err != nil {
+				return err
+			}
+			out.Route = rc
+		}
+		return nil
+	})
+}
+
+// DecodeRouteConfiguration decodes an envoy.config.route.v3.RouteConfiguration.
+func DecodeRouteConfiguration(b []byte) (*RouteConfiguration, error) {
+	out := &RouteConfiguration{}
+	err := forEachField(b, func(f field) error {
+		if f.typ != protowire.BytesType {
+			return nil
+		}
+		switch f.num {
+		case 1:
+			out.Name = string(f.bytes)
+		case 2:
+			vh, err := decodeVirtualHost(f.bytes)
+			if err != nil {
+				return err
+			}
+			out.VirtualHosts = append(out.VirtualHosts, vh)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func decodeVirtualHost(b []byte) (VirtualHost, error) {
+	var out VirtualHost
+	err := forEachField(b, func(f field) error {
+		if f.typ != protowire.BytesType {
+			return nil
+		}
+		switch f.num {
+		case 1:
+			out.Name = string(f.bytes)
+		case 2:
+			out.Domains = append(out.Domains, string(f.bytes))
+		case 3:
+			route, ok, err := decodeRoute(f.bytes)
+			if err != nil {
+				return err
+			}
+			if ok {
+				out.Routes = append(out.Routes, route)
+			}
+		}
+		return nil
+	})
+	return out, err
+}
+
+// decodeRoute reports false for routes without a cluster action, e.g.
+// redirects.
+func decodeRoute(b []byte) (Route, bool, error) {
+	var (
+		out       Route
+		hasAction bool
+	)
+	err := forEachField(b, func(f field) error {
+		if f.typ != protowire.BytesType {
+			return nil
+		}
+		switch f.num {
+		case 1: // match
+			return forEachField(f.bytes, func(f field) error {
+				if f.typ != protowire.BytesType {
+					return nil
+				}
+				switch f.num {
+				case 1:
+					out.Prefix = string(f.bytes)
+				case 2:
+					out.Path = string(f.bytes)
+				}
+				return nil
+			})
+		case 2: // route
+			hasAction = true
+			return decodeRouteAction(f.bytes, &out)
+		}
+		return nil
+	})
+	return out, hasAction && len(out.Clusters) > 0, err
+}
+
+func decodeRouteAction(b []byte, out *Route) error {
+	return forEachField(b, func(f field) error {
+		if f.typ != protowire.BytesType {
+			return nil
+		}
+		switch f.num {
+		case 1: // cluster
+			out.Clusters = []WeightedCluster{{Name: string(f.bytes), Weight: 1}}
+		case 3: // weighted_clusters
+			return forEachField(f.bytes, func(f field) error {
+				if f.num != 1 || f.typ != protowire.BytesType {
+					return nil
+				}
+				var wc WeightedCluster
+				err := forEachField(f.bytes, func(f field) error {
+					if f.typ != protowire.BytesType {
+						return nil
+					}
+					switch f.num {
+					case 1:
+						wc.Name = string(f.bytes)
+					case 2:
+						weight, err := decodeUInt32Value(f.bytes)
+						if err != nil {
+							return err
+						}
+						wc.Weight = weight
+					}
+					return nil
+				})
+				if err != nil {
+					return err
+				}
+				out.Clusters = append(out.Clusters, wc)
+				return nil
+			})
+		}
+		return nil
+	})
+}
+
+// DecodeCluster decodes an envoy.config.cluster.v3.Cluster.
+func DecodeCluster(b []byte) (*Cluster, error) {
+	out := &Cluster{}
+	err := forEachField(b, func(f field) error {
+		if f.typ != protowire.BytesType {
+			return nil
+		}
+		switch f.num {
+		case 1:
+			out.Name = string(f.bytes)
+		case 3: // eds_cluster_config
+			return forEachField(f.bytes, func(f field) error {
+				if f.num == 2 && f.typ == protowire.BytesType {
+					out.EDSServiceName = string(f.bytes)
+				}
+				return nil
+			})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if out.EDSServiceName == "" {
+		out.EDSServiceName = out.Name
+	}
+	return out, nil
+}
+
+// DecodeClusterLoadAssignment decodes an
+// envoy.config.endpoint.v3.ClusterLoadAssignment.
+func DecodeClusterLoadAssignment(b []byte) (*ClusterLoadAssignment, error) {
+	out := &ClusterLoadAssignment{}
+	err := forEachField(b, func(f field) error {
+		if f.typ != protowire.BytesType {
+			return nil
+		}
+		switch f.num {
+		case 1:
+			out.ClusterName = string(f.bytes)
+		case 2:
+			item, err := decodeLocalityEndpoints(f.bytes)
+			if err != nil {
+				return err
+			}
+			out.Localities = append(out.Localities, item)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func decodeLocalityEndpoints(b []byte) (LocalityEndpoints, error) {
+	out := LocalityEndpoints{Weight: 1}
+	err := forEachField(b, func(f field) error {
+		switch {
+		case f.num == 1 && f.typ == protowire.BytesType:
+			return forEachField(f.bytes, func(f field) error {
+				if f.typ != protowire.BytesType {
+					return nil
+				}
+				switch f.num {
+				case 1:
+					out.Locality.Region = string(f.bytes)
+				case 2:
+					out.Locality.Zone = string(f.bytes)
+				case 3:
+					out.Locality.SubZone = string(f.bytes)
+				}
+				return nil
+			})
+		case f.num == 2 && f.typ == protowire.BytesType:
+			ep, err := decodeLbEndpoint(f.bytes)
+			if err != nil {
+				return err
+			}
+			if ep.Address != "" {
+				out.Endpoints = append(out.Endpoints, ep)
+			}
+		case f.num == 3 && f.typ == protowire.BytesType:
+			weight, err := decodeUInt32Value(f.bytes)
+			if err != nil {
+				return err
+			}
+			out.Weight = weight
+		case f.num == 5 && f.typ == protowire.VarintType:
+			out.Priority = uint32(f.varint)
+		}
+		return nil
+	})
+	return out, err
+}
+
+func decodeLbEndpoint(b []byte) (LbEndpoint, error) {
+	out := LbEndpoint{Weight: 1}
+	err := forEachField(b, func(f field) error {
+		switch {
+		case f.num == 1 && f.typ == protowire.BytesType: // endpoint
+			return forEachField(f.bytes, func(f field) error {
+				if f.num != 1 || f.typ != protowire.BytesType { // address
+					return nil
+				}
+				return forEachField(f.bytes, func(f field) error {
+					if f.num != 1 || f.typ != protowire.BytesType { // socket_address
+						return nil
+					}
+					address, err := decodeSocketAddress(f.bytes)
+					out.Address = address
+					return err
+				})
+			})
+		case f.num == 2 && f.typ == protowire.VarintType:
+			out.Health = HealthStatus(f.varint)
+		case f.num == 4 && f.typ == protowire.BytesType:
+			weight, err := decodeUInt32Value(f.bytes)
+			if err != nil {
+				return err
+			}
+			out.Weight = weight
+		}
+		return nil
+	})
+	return out, err
+}
+
+func decodeSocketAddress(b []byte) (string, error) {
+	var (
+		host string
+		port uint64
+	)
+	err := forEachField(b, func(f field) error {
+		switch {
+		case f.num == 2 && f.typ == protowire.BytesType:
+			host = string(f.bytes)
+		case f.num == 3 && f.typ == protowire.VarintType:
+			port = f.varint
+		}
+		return nil
+	})
+	if err != nil || host == "" {
+		return "", err
+	}
+	return net.JoinHostPort(host, strconv.FormatUint(port, 10)), nil
+}
@@ -0,0 +1,214 @@
+// Copyright 2022 The codesjoy Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package xds
+
+import (
+	"net"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// Fixture encoders for the resource subsets understood by the decoders.
+
+func encAny(typeURL string, value []byte) []byte {
+	var b []byte
+	b = appendString(b, 1, typeURL)
+	return appendMessage(b, 2, value)
+}
+
+func encUInt32Value(v uint32) []byte {
+	b := protowire.AppendTag(nil, 1, protowire.VarintType)
+	return protowire.AppendVarint(b, uint64(v))
+}
+
+func encListener(name, routeConfigName string, inline []byte) []byte {
+	var hcm []byte
+	if inline != nil {
+		hcm = appendMessage(hcm, 4, inline)
+	} else {
+		hcm = appendMessage(hcm, 3, appendString(nil, 2, routeConfigName))
+	}
+	b := appendString(nil, 1, name)
+	apiListener := appendMessage(nil, 1, encAny(httpConnectionManagerType, hcm))
+	return appendMessage(b, 19, apiListener)
+}
+
+func encRouteConfig(name string, domains []string, clusters ...WeightedCluster) []byte {
+	var action []byte
+	if len(clusters) == 1 {
+		action = appendString(action, 1, clusters[0].Name)
+	} else {
+		var weighted []byte
+		for _, c := range clusters {
+			wc := appendString(nil, 1, c.Name)
+			wc = appendMessage(wc, 2, encUInt32Value(c.Weight))
+			weighted = appendMessage(weighted, 1, wc)
+		}
+		action = appendMessage(action, 3, weighted)
+	}
+	route := appendMessage(nil, 1, appendString(nil, 1, "/"))
+	route = appendMessage(route, 2, action)
+
+	vh := appendString(nil, 1, "vh")
+	for _, domain := range domains {
+		vh = appendString(vh, 2, domain)
+	}
+	vh = appendMessage(vh, 3, route)
+	b := appendString(nil, 1, name)
+	return appendMessage(b, 2, vh)
+}
+
+func encCluster(name, edsServiceName string) []byte {
+	b := appendString(nil, 1, name)
+	if edsServiceName != "" {
+		b = appendMessage(b, 3, appendString(nil, 2, edsServiceName))
+	}
+	return b
+}
+
+func encCLA(name string, localities ...LocalityEndpoints) []byte {
+	b := appendString(nil, 1, name)
+	for _, le := range localities {
+		locality := appendString(nil, 1, le.Locality.Region)
+		locality = appendString(locality, 2, le.Locality.Zone)
+		locality = appendString(locality, 3, le.Locality.SubZone)
+		item := appendMessage(nil, 1, locality)
+		for _, ep := range le.Endpoints {
+			host, port, _ := net.SplitHostPort(ep.Address)
+			portValue, _ := strconv.ParseUint(port, 10, 32)
+			socket := appendString(nil, 2, host)
+			socket = protowire.AppendTag(socket, 3, protowire.VarintType)
+			socket = protowire.AppendVarint(socket, portValue)
+			address := appendMessage(nil, 1, socket)
+			lb := appendMessage(nil, 1, appendMessage(nil, 1, address))
+			lb = protowire.AppendTag(lb, 2, protowire.VarintType)
+			lb = protowire.AppendVarint(lb, uint64(ep.Health))
+			if ep.Weight > 0 {
+				lb = appendMessage(lb, 4, encUInt32Value(ep.Weight))
+			}
+			item = appendMessage(item, 2, lb)
+		}
+		if le.Weight > 0 {
+			item = appendMessage(item, 3, encUInt32Value(le.Weight))
+		}
+		item = protowire.AppendTag(item, 5, protowire.VarintType)
+		item = protowire.AppendVarint(item, uint64(le.Priority))
+		b = appendMessage(b, 2, item)
+	}
+	return b
+}
+
+func TestDecodeListener(t *testing.T) {
+	l, err := DecodeListener(encListener("svc", "route-a", nil))
+	require.NoError(t, err)
+	assert.Equal(t, &Listener{Name: "svc", RouteConfigName: "route-a"}, l)
+
+	inline := encRouteConfig("inline", []string{"*"}, WeightedCluster{Name: "c1"})
+	l, err = DecodeListener(encListener("svc", "", inline))
+	require.NoError(t, err)
+	require.NotNil(t, l.Route)
+	assert.Empty(t, l.RouteConfigName)
+	assert.Equal(t, "inline", l.Route.Name)
+
+	_, err = DecodeListener([]byte{0xff})
+	assert.Error(t, err)
+}
+
+func TestDecodeRouteConfiguration(t *testing.T) {
+	rc, err := DecodeRouteConfiguration(encRouteConfig("r", []string{"svc", "*"},
+		WeightedCluster{Name: "a", Weight: 80}, WeightedCluster{Name: "b", Weight: 20}))
+	require.NoError(t, err)
+	assert.Equal(t, &RouteConfiguration{
+		Name: "r",
+		VirtualHosts: []VirtualHost{{
+			Name:    "vh",
+			Domains: []string{"svc", "*"},
+			Routes: []Route{{
+				Prefix: "/",
+				Clusters: []WeightedCluster{
+					{Name: "a", Weight: 80},
+					{Name: "b", Weight: 20},
+				},
+			}},
+		}},
+	}, rc)
+
+	rc, err = DecodeRouteConfiguration(encRouteConfig("r", []string{"*"},
+		WeightedCluster{Name: "only"}))
+	require.NoError(t, err)
+	assert.Equal(t, []WeightedCluster{{Name: "only", Weight: 1}},
+		rc.VirtualHosts[0].Routes[0].Clusters)
+}
+
+func TestDecodeCluster(t *testing.T) {
+	c, err := DecodeCluster(encCluster("c1", ""))
+	require.NoError(t, err)
+	assert.Equal(t, &Cluster{Name: "c1", EDSServiceName: "c1"}, c)
+
+	c, err = DecodeCluster(encCluster("c1", "eds-c1"))
+	require.NoError(t, err)
+	assert.Equal(t, "eds-c1", c.EDSServiceName)
+}
+
+func TestDecodeClusterLoadAssignment(t *testing.T) {
+	cla, err := DecodeClusterLoadAssignment(encCLA("c1",
+		LocalityEndpoints{
+			Locality: Locality{Region: "r1", Zone: "z1", SubZone: "s1"},
+			Weight:   3,
+			Endpoints: []LbEndpoint{
+				{Address: "10.0.0.1:80", Health: HealthHealthy, Weight: 2},
+				{Address: "10.0.0.2:80", Health: HealthUnhealthy},
+			},
+		},
+		LocalityEndpoints{
+			Locality:  Locality{Region: "r2"},
+			Priority:  1,
+			Endpoints: []LbEndpoint{{Address: "10.0.1.1:80"}},
+		},
+	))
+	require.NoError(t, err)
+	assert.Equal(t, &ClusterLoadAssignment{
+		ClusterName: "c1",
+		Localities: []LocalityEndpoints{
+			{
+				Locality: Locality{Region: "r1", Zone: "z1", SubZone: "s1"},
+				Weight:   3,
+				Endpoints: []LbEndpoint{
+					{Address: "10.0.0.1:80", Health: HealthHealthy, Weight: 2},
+					{Address: "10.0.0.2:80", Health: HealthUnhealthy, Weight: 1},
+				},
+			},
+			{
+				Locality:  Locality{Region: "r2"},
+				Weight:    1,
+				Priority:  1,
+				Endpoints: []LbEndpoint{{Address: "10.0.1.1:80", Weight: 1}},
+			},
+		},
+	}, cla)
+}
+
+func TestHealthStatusServing(t *testing.T) {
+	assert.True(t, HealthUnknown.Serving())
+	assert.True(t, HealthHealthy.Serving())
+	assert.True(t, HealthDegraded.Serving())
+	assert.False(t, HealthUnhealthy.Serving())
+	assert.False(t, HealthDraining.Serving())
+	assert.False(t, HealthTimeout.Serving())
+}
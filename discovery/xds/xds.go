@@ -0,0 +1,157 @@
+// Copyright 2022 The codesjoy Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package xds resolves xds:///service targets from an xDS management server
+// over the aggregated discovery service (ADS).
+//
+// The resolver follows the listener named by the target to its route
+// configuration, the clusters of its default route and their endpoints.
+// Each cluster contributes the healthy endpoints of its highest-priority
+// locality set, tagged with the cluster name and route weight; the
+// xds_weighted balancer splits traffic between clusters by that weight.
+package xds
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/codesjoy/yggdrasil/v3/capabilities"
+	"github.com/codesjoy/yggdrasil/v3/config"
+	"github.com/codesjoy/yggdrasil/v3/discovery/resolver"
+	"github.com/codesjoy/yggdrasil/v3/internal/backoff"
+	"github.com/codesjoy/yggdrasil/v3/module"
+)
+
+// ModuleName is the name of the xds module.
+const ModuleName = "discovery.xds"
+
+// ConfigPath is the config path consumed by the xds module.
+const ConfigPath = "yggdrasil.discovery.xds"
+
+// NodeConfig identifies this client to the management server.
+type NodeConfig struct {
+	ID      string `mapstructure:"id"`
+	Cluster string `mapstructure:"cluster"`
+	Region  string `mapstructure:"region"`
+	Zone    string `mapstructure:"zone"`
+	SubZone string `mapstructure:"sub_zone"`
+}
+
+// Config is the xds module configuration.
+type Config struct {
+	// Server is the gRPC target of the ADS management server.
+	Server string     `mapstructure:"server"`
+	Node   NodeConfig `mapstructure:"node"`
+	// Protocol is the transport protocol of resolved endpoints.
+	Protocol string `mapstructure:"protocol" default:"grpc"`
+	// Backoff paces reconnects of the ADS stream.
+	Backoff backoff.Config `mapstructure:"backoff"`
+	// TLS secures the connection to the management server.
+	TLS TLSConfig `mapstructure:"tls"`
+}
+
+// TLSConfig configures the connection to the management server. TLS with
+// the system roots is used unless Insecure is set.
+type TLSConfig struct {
+	// Insecure connects in plaintext, e.g. to a management server on the
+	// loopback interface or behind a mesh sidecar.
+	Insecure bool `mapstructure:"insecure"`
+	// CAFile verifies the server certificate against the CAs it holds
+	// instead of the system roots.
+	CAFile string `mapstructure:"ca_file"`
+	// CertFile and KeyFile hold the client certificate presented to
+	// servers requiring mutual TLS.
+	CertFile string `mapstructure:"cert_file"`
+	KeyFile  string `mapstructure:"key_file"`
+	// ServerName overrides the name verified in the server certificate.
+	ServerName string `mapstructure:"server_name"`
+}
+
+type xdsModule struct {
+	mu  sync.Mutex
+	cfg Config
+	ads *adsClient
+}
+
+// Module returns the module providing the xds resolver and the
+// xds_weighted balancer. The ADS stream is opened by the first watch.
+func Module() module.Module {
+	return &xdsModule{}
+}
+
+func (m *xdsModule) Name() string { return ModuleName }
+
+func (m *xdsModule) Scope() module.Scope { return module.ScopeProvider }
+
+func (m *xdsModule) ConfigPath() string { return ConfigPath }
+
+func (m *xdsModule) Init(_ context.Context, view config.View) error {
+	var cfg Config
+	if err := view.Decode(&cfg); err != nil {
+		return fmt.Errorf("load xds config: %w", err)
+	}
+	if cfg.Backoff.BaseDelay <= 0 {
+		cfg.Backoff = backoff.DefaultConfig
+	}
+	m.mu.Lock()
+	m.cfg = cfg
+	m.mu.Unlock()
+	return nil
+}
+
+func (m *xdsModule) Capabilities() []module.Capability {
+	return []module.Capability{
+		capabilities.ProvideNamed(
+			capabilities.ResolverProviderSpec,
+			Scheme,
+			resolver.NewProvider(Scheme, func(string) (resolver.Resolver, error) {
+				m.mu.Lock()
+				protocol := m.cfg.Protocol
+				m.mu.Unlock()
+				return newResolver(m.client, protocol), nil
+			}),
+		),
+		capabilities.ProvideNamed(
+			capabilities.BalancerProviderSpec,
+			BalancerName,
+			BalancerProvider(),
+		),
+	}
+}
+
+func (m *xdsModule) client() (*adsClient, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.ads != nil {
+		return m.ads, nil
+	}
+	ads, err := newADSClient(m.cfg)
+	if err != nil {
+		return nil, err
+	}
+	m.ads = ads
+	return ads, nil
+}
+
+func (m *xdsModule) Stop(context.Context) error {
+	m.mu.Lock()
+	ads := m.ads
+	m.ads = nil
+	m.mu.Unlock()
+	if ads == nil {
+		return nil
+	}
+	return ads.close()
+}
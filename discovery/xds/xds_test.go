@@ -0,0 +1,68 @@
+// Copyright 2022 The codesjoy Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package xds
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/codesjoy/yggdrasil/v3/capabilities"
+	"github.com/codesjoy/yggdrasil/v3/config"
+	"github.com/codesjoy/yggdrasil/v3/discovery/resolver"
+	"github.com/codesjoy/yggdrasil/v3/internal/backoff"
+	"github.com/codesjoy/yggdrasil/v3/module"
+)
+
+func TestModule(t *testing.T) {
+	m := Module()
+	assert.Equal(t, ModuleName, m.Name())
+	assert.Equal(t, module.ScopeProvider, m.(module.Scoped).Scope())
+	assert.Equal(t, ConfigPath, m.(module.Configurable).ConfigPath())
+
+	view := config.NewView(ConfigPath, config.NewSnapshot(map[string]any{
+		"server": "127.0.0.1:1",
+		"node":   map[string]any{"id": "n1", "zone": "z1"},
+	}))
+	require.NoError(t, m.(module.Initializable).Init(context.Background(), view))
+	xm := m.(*xdsModule)
+	assert.Equal(t, "grpc", xm.cfg.Protocol)
+	assert.Equal(t, NodeConfig{ID: "n1", Zone: "z1"}, xm.cfg.Node)
+	assert.Equal(t, backoff.DefaultConfig, xm.cfg.Backoff)
+
+	caps := m.(module.CapabilityProvider).Capabilities()
+	require.Len(t, caps, 2)
+	assert.Equal(t, capabilities.ResolverProviderSpec.Name, caps[0].Spec.Name)
+	assert.Equal(t, Scheme, caps[0].Name)
+	assert.Equal(t, capabilities.BalancerProviderSpec.Name, caps[1].Spec.Name)
+	assert.Equal(t, BalancerName, caps[1].Name)
+
+	r, err := caps[0].Value.(resolver.Provider).New("xds")
+	require.NoError(t, err)
+	require.NoError(t, r.AddWatch("xds:///svc", newStateRecorder()))
+	require.NoError(t, m.(module.Stoppable).Stop(context.Background()))
+	require.NoError(t, m.(module.Stoppable).Stop(context.Background()))
+}
+
+func TestModuleRequiresServer(t *testing.T) {
+	m := Module()
+	require.NoError(t, m.(module.Initializable).Init(context.Background(),
+		config.NewView(ConfigPath, config.NewSnapshot(nil))))
+	r, err := m.(module.CapabilityProvider).Capabilities()[0].Value.(resolver.Provider).New("xds")
+	require.NoError(t, err)
+	assert.Error(t, r.AddWatch("svc", newStateRecorder()))
+}
@@ -0,0 +1,311 @@
+// Copyright 2022 The codesjoy Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package eventbus provides a typed in-process publish/subscribe bus.
+package eventbus
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"reflect"
+	"runtime/debug"
+	"sync"
+	"sync/atomic"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/metric/noop"
+)
+
+// DefaultQueueSize is the queue length of asynchronous subscribers that do
+// not set one.
+const DefaultQueueSize = 64
+
+// Handler handles one event of type T.
+type Handler[T any] func(ctx context.Context, event T)
+
+// Option configures a Bus.
+type Option func(*Bus)
+
+// WithMeterProvider sets the meter provider used for bus metrics. The global
+// provider is used by default.
+func WithMeterProvider(provider metric.MeterProvider) Option {
+	return func(b *Bus) {
+		b.meterProvider = provider
+	}
+}
+
+// SubscribeOption configures one subscription.
+type SubscribeOption func(*subscribeConfig)
+
+type subscribeConfig struct {
+	name      string
+	async     bool
+	queueSize int
+}
+
+// WithName names the subscriber in logs and metrics.
+func WithName(name string) SubscribeOption {
+	return func(cfg *subscribeConfig) {
+		cfg.name = name
+	}
+}
+
+// WithAsync delivers events on a dedicated goroutine through a queue holding
+// at most queueSize events. Events published while the queue is full are
+// dropped. A non-positive queueSize uses DefaultQueueSize.
+func WithAsync(queueSize int) SubscribeOption {
+	return func(cfg *subscribeConfig) {
+		cfg.async = true
+		cfg.queueSize = queueSize
+	}
+}
+
+// Bus dispatches events to the subscribers of their type.
+type Bus struct {
+	meterProvider metric.MeterProvider
+	published     metric.Int64Counter
+	dropped       metric.Int64Counter
+	panics        metric.Int64Counter
+
+	mu     sync.RWMutex
+	subs   map[reflect.Type][]*subscription
+	nextID atomic.Uint64
+	closed bool
+	wg     sync.WaitGroup
+}
+
+type subscription struct {
+	name    string
+	deliver func(ctx context.Context, event any)
+
+	// mu guards closed and the sends to queue of asynchronous subscribers.
+	mu     sync.RWMutex
+	closed bool
+	queue  chan queuedEvent
+}
+
+type queuedEvent struct {
+	ctx   context.Context
+	event any
+}
+
+var defaultBus atomic.Pointer[Bus]
+
+// Default returns the process-wide bus carrying framework events.
+func Default() *Bus {
+	if b := defaultBus.Load(); b != nil {
+		return b
+	}
+	defaultBus.CompareAndSwap(nil, New())
+	return defaultBus.Load()
+}
+
+// New creates a bus.
+func New(opts ...Option) *Bus {
+	b := &Bus{subs: map[reflect.Type][]*subscription{}}
+	for _, opt := range opts {
+		opt(b)
+	}
+	if b.meterProvider == nil {
+		b.meterProvider = otel.GetMeterProvider()
+	}
+	meter := b.meterProvider.Meter("github.com/codesjoy/yggdrasil/v3",
+		metric.WithInstrumentationVersion("yggdrasil"),
+	)
+	b.published = newCounter(meter, "eventbus.published",
+		"Counts events published on the event bus.", "{event}")
+	b.dropped = newCounter(meter, "eventbus.dropped",
+		"Counts events dropped because a subscriber queue was full.", "{event}")
+	b.panics = newCounter(meter, "eventbus.handler.panics",
+		"Counts panics recovered from event handlers.", "{panic}")
+	return b
+}
+
+func newCounter(meter metric.Meter, name, description, unit string) metric.Int64Counter {
+	counter, err := meter.Int64Counter(name,
+		metric.WithDescription(description),
+		metric.WithUnit(unit))
+	if err != nil {
+		otel.Handle(err)
+		return noop.Int64Counter{}
+	}
+	return counter
+}
+
+// Subscribe registers handler for events of type T and returns a function
+// removing the subscription. Synchronous handlers run on the publishing
+// goroutine; see WithAsync for queued delivery.
+func Subscribe[T any](b *Bus, handler Handler[T], opts ...SubscribeOption) (unsubscribe func()) {
+	cfg := subscribeConfig{}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	eventType := reflect.TypeFor[T]()
+	if cfg.name == "" {
+		cfg.name = fmt.Sprintf("%s#%d", eventType, b.nextID.Add(1))
+	}
+	sub := &subscription{name: cfg.name}
+	sub.deliver = func(ctx context.Context, event any) {
+		defer func() {
+			if p := recover(); p != nil {
+				b.panics.Add(context.WithoutCancel(ctx), 1, metric.WithAttributes(
+					attribute.String("event", eventType.String()),
+					attribute.String("subscriber", sub.name),
+				))
+				slog.ErrorContext(ctx, "event handler panic recovered",
+					slog.String("event", eventType.String()),
+					slog.String("subscriber", sub.name),
+					slog.Any("panic", p),
+					slog.String("stack", string(debug.Stack())))
+			}
+		}()
+		handler(ctx, event.(T))
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		return func() {}
+	}
+	if cfg.async {
+		size := cfg.queueSize
+		if size <= 0 {
+			size = DefaultQueueSize
+		}
+		sub.queue = make(chan queuedEvent, size)
+		b.wg.Add(1)
+		go func() {
+			defer b.wg.Done()
+			for item := range sub.queue {
+				sub.deliver(item.ctx, item.event)
+			}
+		}()
+	}
+	b.subs[eventType] = append(b.subs[eventType], sub)
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			b.mu.Lock()
+			subs := b.subs[eventType]
+			for i, item := range subs {
+				if item == sub {
+					b.subs[eventType] = append(subs[:i:i], subs[i+1:]...)
+					break
+				}
+			}
+			b.mu.Unlock()
+			sub.close()
+		})
+	}
+}
+
+// Publish delivers event to the subscribers of type T. It returns after the
+// synchronous handlers ran; asynchronous subscribers receive the event with
+// a context detached from ctx cancellation.
+func Publish[T any](ctx context.Context, b *Bus, event T) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	eventType := reflect.TypeFor[T]()
+	b.mu.RLock()
+	if b.closed {
+		b.mu.RUnlock()
+		return
+	}
+	subs := b.subs[eventType]
+	b.mu.RUnlock()
+
+	b.published.Add(context.WithoutCancel(ctx), 1, metric.WithAttributes(
+		attribute.String("event", eventType.String()),
+	))
+	for _, sub := range subs {
+		if sub.queue == nil {
+			sub.deliver(ctx, event)
+			continue
+		}
+		if !sub.enqueue(queuedEvent{ctx: context.WithoutCancel(ctx), event: event}) {
+			b.dropped.Add(context.WithoutCancel(ctx), 1, metric.WithAttributes(
+				attribute.String("event", eventType.String()),
+				attribute.String("subscriber", sub.name),
+			))
+			slog.WarnContext(ctx, "event dropped, subscriber queue is full",
+				slog.String("event", eventType.String()),
+				slog.String("subscriber", sub.name))
+		}
+	}
+}
+
+// Close removes all subscriptions and waits, within ctx, for asynchronous
+// subscribers to drain their queues. Events published after Close are
+// discarded.
+func (b *Bus) Close(ctx context.Context) error {
+	b.mu.Lock()
+	if b.closed {
+		b.mu.Unlock()
+		return nil
+	}
+	b.closed = true
+	subs := b.subs
+	b.subs = map[reflect.Type][]*subscription{}
+	b.mu.Unlock()
+
+	for _, list := range subs {
+		for _, sub := range list {
+			sub.close()
+		}
+	}
+	done := make(chan struct{})
+	go func() {
+		b.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("wait event subscribers: %w", ctx.Err())
+	}
+}
+
+// enqueue reports whether the event was queued; events sent to a closed
+// subscription are discarded without being reported as dropped.
+func (s *subscription) enqueue(item queuedEvent) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.closed {
+		return true
+	}
+	select {
+	case s.queue <- item:
+		return true
+	default:
+		return false
+	}
+}
+
+func (s *subscription) close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return
+	}
+	s.closed = true
+	if s.queue != nil {
+		close(s.queue)
+	}
+}
@@ -0,0 +1,155 @@
+// Copyright 2022 The codesjoy Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package eventbus
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+)
+
+type orderPlaced struct {
+	ID string
+}
+
+type orderCanceled struct {
+	ID string
+}
+
+func counterTotals(t *testing.T, reader *sdkmetric.ManualReader) map[string]int64 {
+	t.Helper()
+	var rm metricdata.ResourceMetrics
+	require.NoError(t, reader.Collect(context.Background(), &rm))
+	out := map[string]int64{}
+	for _, sm := range rm.ScopeMetrics {
+		for _, m := range sm.Metrics {
+			sum, ok := m.Data.(metricdata.Sum[int64])
+			if !ok {
+				continue
+			}
+			for _, dp := range sum.DataPoints {
+				out[m.Name] += dp.Value
+			}
+		}
+	}
+	return out
+}
+
+func TestPublishDispatchesByType(t *testing.T) {
+	bus := New()
+	var placed []string
+	var canceled atomic.Int32
+	unsubscribe := Subscribe(bus, func(_ context.Context, event orderPlaced) {
+		placed = append(placed, event.ID)
+	})
+	Subscribe(bus, func(context.Context, orderCanceled) { canceled.Add(1) })
+
+	Publish(context.Background(), bus, orderPlaced{ID: "a"})
+	Publish(context.Background(), bus, orderPlaced{ID: "b"})
+	Publish(context.Background(), bus, orderCanceled{ID: "a"})
+	assert.Equal(t, []string{"a", "b"}, placed)
+	assert.Equal(t, int32(1), canceled.Load())
+
+	unsubscribe()
+	unsubscribe()
+	Publish(context.Background(), bus, orderPlaced{ID: "c"})
+	assert.Equal(t, []string{"a", "b"}, placed)
+}
+
+func TestAsyncSubscriberDropsWhenQueueFull(t *testing.T) {
+	reader := sdkmetric.NewManualReader()
+	bus := New(WithMeterProvider(sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader))))
+
+	release := make(chan struct{})
+	started := make(chan struct{})
+	var once sync.Once
+	var mu sync.Mutex
+	var received []string
+	Subscribe(bus, func(_ context.Context, event orderPlaced) {
+		once.Do(func() { close(started) })
+		<-release
+		mu.Lock()
+		received = append(received, event.ID)
+		mu.Unlock()
+	}, WithAsync(1), WithName("slow"))
+
+	Publish(context.Background(), bus, orderPlaced{ID: "1"})
+	<-started
+	Publish(context.Background(), bus, orderPlaced{ID: "2"})
+	Publish(context.Background(), bus, orderPlaced{ID: "3"})
+	close(release)
+	require.NoError(t, bus.Close(context.Background()))
+
+	assert.Equal(t, []string{"1", "2"}, received)
+	totals := counterTotals(t, reader)
+	assert.Equal(t, int64(3), totals["eventbus.published"])
+	assert.Equal(t, int64(1), totals["eventbus.dropped"])
+}
+
+func TestHandlerPanicIsRecovered(t *testing.T) {
+	reader := sdkmetric.NewManualReader()
+	bus := New(WithMeterProvider(sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader))))
+	var after atomic.Int32
+	Subscribe(bus, func(context.Context, orderPlaced) { panic("boom") })
+	Subscribe(bus, func(context.Context, orderPlaced) { after.Add(1) })
+
+	assert.NotPanics(t, func() {
+		Publish(context.Background(), bus, orderPlaced{ID: "a"})
+	})
+	assert.Equal(t, int32(1), after.Load())
+	assert.Equal(t, int64(1), counterTotals(t, reader)["eventbus.handler.panics"])
+}
+
+func TestCloseBoundedByContext(t *testing.T) {
+	bus := New()
+	release := make(chan struct{})
+	Subscribe(bus, func(context.Context, orderPlaced) { <-release }, WithAsync(0))
+	Publish(context.Background(), bus, orderPlaced{ID: "a"})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	require.ErrorIs(t, bus.Close(ctx), context.DeadlineExceeded)
+	close(release)
+
+	var calls atomic.Int32
+	Subscribe(bus, func(context.Context, orderPlaced) { calls.Add(1) })
+	Publish(context.Background(), bus, orderPlaced{ID: "b"})
+	assert.Zero(t, calls.Load())
+}
+
+func TestAsyncDeliveryIsDetachedFromPublisherCancellation(t *testing.T) {
+	bus := New()
+	errs := make(chan error, 1)
+	Subscribe(bus, func(ctx context.Context, _ orderPlaced) {
+		errs <- ctx.Err()
+	}, WithAsync(1))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	Publish(ctx, bus, orderPlaced{ID: "a"})
+	cancel()
+	require.NoError(t, <-errs)
+	require.NoError(t, bus.Close(context.Background()))
+}
+
+func TestDefaultIsShared(t *testing.T) {
+	assert.Same(t, Default(), Default())
+}
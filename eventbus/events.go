@@ -0,0 +1,66 @@
+// Copyright 2022 The codesjoy Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package eventbus
+
+// Framework events published on Default.
+
+// Endpoint describes one network endpoint carried by framework events.
+type Endpoint struct {
+	Name     string
+	Protocol string
+	Address  string
+}
+
+// ServerStarted is published once the application servers are serving.
+type ServerStarted struct {
+	AppName   string
+	Endpoints []Endpoint
+}
+
+// ConfigReloaded is published after a configuration reload cycle completed.
+// RestartRequired reports that the change was not applied and needs a
+// process restart.
+type ConfigReloaded struct {
+	AppName         string
+	ChangedPaths    []string
+	RestartRequired bool
+}
+
+// RegistryState is the registration state reported by RegistryStateChanged.
+type RegistryState string
+
+// Registration states.
+const (
+	RegistryRegistered   RegistryState = "registered"
+	RegistryDeregistered RegistryState = "deregistered"
+	RegistryFailed       RegistryState = "failed"
+)
+
+// RegistryStateChanged is published when the application instance is
+// registered to or deregistered from the service registry. Err is set for
+// RegistryFailed.
+type RegistryStateChanged struct {
+	AppName  string
+	Registry string
+	State    RegistryState
+	Err      error
+}
+
+// ClientEndpointsChanged is published when a client receives a new set of
+// resolved endpoints for its target.
+type ClientEndpointsChanged struct {
+	Target    string
+	Endpoints []Endpoint
+}
@@ -28,6 +28,7 @@ import (
 
 	"github.com/codesjoy/yggdrasil/v3"
 	errorhandlingpb "github.com/codesjoy/yggdrasil/v3/examples/protogen/error-handling"
+	"github.com/codesjoy/yggdrasil/v3/rpc/status"
 )
 
 // LibraryServer implements the LibraryService
@@ -56,9 +57,20 @@ func NewLibraryServer() *LibraryServer {
 	}
 }
 
-func reasonErr(err error, reason xerror.Reason, metadata map[string]string) error {
-	return xerror.WrapWithReason(err, reason, "", metadata)
-}
+// One constructor per reason value keeps each call site tied to its reason.
+var (
+	newInvalidInput        = status.ReasonConstructor(errorhandlingpb.Reason_INVALID_INPUT)
+	newEmailAlreadyExists  = status.ReasonConstructor(errorhandlingpb.Reason_EMAIL_ALREADY_EXISTS)
+	newUserNotFound        = status.ReasonConstructor(errorhandlingpb.Reason_USER_NOT_FOUND)
+	newInvalidCredentials  = status.ReasonConstructor(errorhandlingpb.Reason_INVALID_CREDENTIALS)
+	newBookNotFound        = status.ReasonConstructor(errorhandlingpb.Reason_BOOK_NOT_FOUND)
+	newBookAlreadyBorrowed = status.ReasonConstructor(errorhandlingpb.Reason_BOOK_ALREADY_BORROWED)
+	newShelfNotFound       = status.ReasonConstructor(errorhandlingpb.Reason_SHELF_NOT_FOUND)
+	newShelfFull           = status.ReasonConstructor(errorhandlingpb.Reason_SHELF_FULL)
+	newDatabaseError       = status.ReasonConstructor(errorhandlingpb.Reason_DATABASE_ERROR)
+	newNetworkError        = status.ReasonConstructor(errorhandlingpb.Reason_NETWORK_ERROR)
+	newInternalError       = status.ReasonConstructor(errorhandlingpb.Reason_INTERNAL_ERROR)
+)
 
 func (s *LibraryServer) CreateUser(
 	ctx context.Context,
@@ -68,18 +80,16 @@ func (s *LibraryServer) CreateUser(
 
 	// Validate email format
 	if req.Email == "" || !strings.Contains(req.Email, "@") {
-		return nil, reasonErr(
+		return nil, newInvalidInput(
 			errors.New("invalid email format"),
-			errorhandlingpb.Reason_INVALID_INPUT,
 			map[string]string{"field": "email", "value": req.Email},
 		)
 	}
 
 	// Validate password
 	if req.Password == "" || len(req.Password) < 6 {
-		return nil, reasonErr(
+		return nil, newInvalidInput(
 			errors.New("password too short"),
-			errorhandlingpb.Reason_INVALID_INPUT,
 			map[string]string{"field": "password", "min_length": "6"},
 		)
 	}
@@ -89,9 +99,8 @@ func (s *LibraryServer) CreateUser(
 
 	// Check if email already exists
 	if _, exists := s.emailToID[req.Email]; exists {
-		return nil, reasonErr(
+		return nil, newEmailAlreadyExists(
 			fmt.Errorf("email %s already registered", req.Email),
-			errorhandlingpb.Reason_EMAIL_ALREADY_EXISTS,
 			map[string]string{"email": req.Email},
 		)
 	}
@@ -119,9 +128,8 @@ func (s *LibraryServer) GetUser(
 	slog.Info("GetUser called", "user_id", req.UserId)
 
 	if req.UserId == "" {
-		return nil, reasonErr(
+		return nil, newInvalidInput(
 			errors.New("user_id is required"),
-			errorhandlingpb.Reason_INVALID_INPUT,
 			map[string]string{"field": "user_id"},
 		)
 	}
@@ -131,9 +139,8 @@ func (s *LibraryServer) GetUser(
 
 	user, exists := s.users[req.UserId]
 	if !exists {
-		return nil, reasonErr(
+		return nil, newUserNotFound(
 			fmt.Errorf("user %s not found", req.UserId),
-			errorhandlingpb.Reason_USER_NOT_FOUND,
 			map[string]string{"user_id": req.UserId},
 		)
 	}
@@ -152,9 +159,8 @@ func (s *LibraryServer) AuthenticateUser(
 
 	userID, exists := s.emailToID[req.Email]
 	if !exists {
-		return nil, reasonErr(
+		return nil, newInvalidCredentials(
 			errors.New("invalid credentials"),
-			errorhandlingpb.Reason_INVALID_CREDENTIALS,
 			map[string]string{"email": req.Email},
 		)
 	}
@@ -163,9 +169,8 @@ func (s *LibraryServer) AuthenticateUser(
 
 	// Simple password check (in production, use bcrypt)
 	if req.Password != "password123" {
-		return nil, reasonErr(
+		return nil, newInvalidCredentials(
 			errors.New("invalid credentials"),
-			errorhandlingpb.Reason_INVALID_CREDENTIALS,
 			map[string]string{"email": req.Email},
 		)
 	}
@@ -184,9 +189,8 @@ func (s *LibraryServer) CreateBook(
 	slog.Info("CreateBook called", "title", req.Title, "author", req.Author)
 
 	if req.Title == "" || req.Author == "" {
-		return nil, reasonErr(
+		return nil, newInvalidInput(
 			errors.New("title and author are required"),
-			errorhandlingpb.Reason_INVALID_INPUT,
 			map[string]string{"missing_fields": "title, author"},
 		)
 	}
@@ -216,9 +220,8 @@ func (s *LibraryServer) GetBook(
 	slog.Info("GetBook called", "book_id", req.BookId)
 
 	if req.BookId == "" {
-		return nil, reasonErr(
+		return nil, newInvalidInput(
 			errors.New("book_id is required"),
-			errorhandlingpb.Reason_INVALID_INPUT,
 			map[string]string{"field": "book_id"},
 		)
 	}
@@ -228,9 +231,8 @@ func (s *LibraryServer) GetBook(
 
 	book, exists := s.books[req.BookId]
 	if !exists {
-		return nil, reasonErr(
+		return nil, newBookNotFound(
 			fmt.Errorf("book %s not found", req.BookId),
-			errorhandlingpb.Reason_BOOK_NOT_FOUND,
 			map[string]string{"book_id": req.BookId},
 		)
 	}
@@ -249,9 +251,8 @@ func (s *LibraryServer) BorrowBook(
 
 	// Check if user exists
 	if _, exists := s.users[req.UserId]; !exists {
-		return nil, reasonErr(
+		return nil, newUserNotFound(
 			fmt.Errorf("user %s not found", req.UserId),
-			errorhandlingpb.Reason_USER_NOT_FOUND,
 			map[string]string{"user_id": req.UserId},
 		)
 	}
@@ -259,18 +260,16 @@ func (s *LibraryServer) BorrowBook(
 	// Check if book exists
 	book, exists := s.books[req.BookId]
 	if !exists {
-		return nil, reasonErr(
+		return nil, newBookNotFound(
 			fmt.Errorf("book %s not found", req.BookId),
-			errorhandlingpb.Reason_BOOK_NOT_FOUND,
 			map[string]string{"book_id": req.BookId},
 		)
 	}
 
 	// Check if book is already borrowed
 	if book.BorrowerId != "" {
-		return nil, reasonErr(
+		return nil, newBookAlreadyBorrowed(
 			errors.New("book is already borrowed"),
-			errorhandlingpb.Reason_BOOK_ALREADY_BORROWED,
 			map[string]string{
 				"book_id":     req.BookId,
 				"borrower_id": book.BorrowerId,
@@ -296,9 +295,8 @@ func (s *LibraryServer) ReturnBook(
 
 	book, exists := s.books[req.BookId]
 	if !exists {
-		return nil, reasonErr(
+		return nil, newBookNotFound(
 			fmt.Errorf("book %s not found", req.BookId),
-			errorhandlingpb.Reason_BOOK_NOT_FOUND,
 			map[string]string{"book_id": req.BookId},
 		)
 	}
@@ -316,17 +314,15 @@ func (s *LibraryServer) CreateShelf(
 	slog.Info("CreateShelf called", "name", req.Name, "capacity", req.Capacity)
 
 	if req.Name == "" {
-		return nil, reasonErr(
+		return nil, newInvalidInput(
 			errors.New("name is required"),
-			errorhandlingpb.Reason_INVALID_INPUT,
 			map[string]string{"field": "name"},
 		)
 	}
 
 	if req.Capacity <= 0 {
-		return nil, reasonErr(
+		return nil, newInvalidInput(
 			errors.New("capacity must be positive"),
-			errorhandlingpb.Reason_INVALID_INPUT,
 			map[string]string{"field": "capacity", "min": "1"},
 		)
 	}
@@ -361,27 +357,24 @@ func (s *LibraryServer) AddBookToShelf(
 	// Check if shelf exists
 	shelf, exists := s.shelves[req.ShelfId]
 	if !exists {
-		return nil, reasonErr(
+		return nil, newShelfNotFound(
 			fmt.Errorf("shelf %s not found", req.ShelfId),
-			errorhandlingpb.Reason_SHELF_NOT_FOUND,
 			map[string]string{"shelf_id": req.ShelfId},
 		)
 	}
 
 	// Check if book exists
 	if _, exists := s.books[req.BookId]; !exists {
-		return nil, reasonErr(
+		return nil, newBookNotFound(
 			fmt.Errorf("book %s not found", req.BookId),
-			errorhandlingpb.Reason_BOOK_NOT_FOUND,
 			map[string]string{"book_id": req.BookId},
 		)
 	}
 
 	// Check if shelf is full
 	if shelf.CurrentCount >= shelf.Capacity {
-		return nil, reasonErr(
+		return nil, newShelfFull(
 			fmt.Errorf("shelf %s is full", req.ShelfId),
-			errorhandlingpb.Reason_SHELF_FULL,
 			map[string]string{
 				"shelf_id":      req.ShelfId,
 				"capacity":      fmt.Sprintf("%d", shelf.Capacity),
@@ -405,27 +398,24 @@ func (s *LibraryServer) TriggerError(
 
 	switch req.ErrorType {
 	case "database_error":
-		return nil, reasonErr(
+		return nil, newDatabaseError(
 			errors.New("database connection failed"),
-			errorhandlingpb.Reason_DATABASE_ERROR,
 			map[string]string{
 				"host":     "localhost:5432",
 				"database": "library_db",
 			},
 		)
 	case "network_error":
-		return nil, reasonErr(
+		return nil, newNetworkError(
 			errors.New("network timeout"),
-			errorhandlingpb.Reason_NETWORK_ERROR,
 			map[string]string{
 				"target":  "external-api.example.com",
 				"timeout": "30s",
 			},
 		)
 	case "internal_error":
-		return nil, reasonErr(
+		return nil, newInternalError(
 			errors.New("unexpected internal error"),
-			errorhandlingpb.Reason_INTERNAL_ERROR,
 			map[string]string{
 				"component": "library-service",
 				"version":   "1.0.0",
@@ -459,6 +449,10 @@ func composeBundle(
 }
 
 func main() {
+	// Publish the reasons on the governor /reasons endpoint.
+	for value := range errorhandlingpb.Reason_name {
+		status.RegisterReasons(errorhandlingpb.Reason(value))
+	}
 	if err := yggdrasil.Run(
 		context.Background(),
 		"github.com.codesjoy.yggdrasil.example.13-error-reason",
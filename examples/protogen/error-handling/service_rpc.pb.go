@@ -19,16 +19,16 @@ import (
 var _ = new(metadata.MD)
 
 type LibraryServiceClient interface {
-	CreateUser(context.Context, *CreateUserRequest) (*CreateUserResponse, error)
-	GetUser(context.Context, *GetUserRequest) (*GetUserResponse, error)
-	AuthenticateUser(context.Context, *AuthenticateUserRequest) (*AuthenticateUserResponse, error)
-	CreateBook(context.Context, *CreateBookRequest) (*CreateBookResponse, error)
-	GetBook(context.Context, *GetBookRequest) (*GetBookResponse, error)
-	BorrowBook(context.Context, *BorrowBookRequest) (*BorrowBookResponse, error)
-	ReturnBook(context.Context, *ReturnBookRequest) (*ReturnBookResponse, error)
-	CreateShelf(context.Context, *CreateShelfRequest) (*CreateShelfResponse, error)
-	AddBookToShelf(context.Context, *AddBookToShelfRequest) (*AddBookToShelfResponse, error)
-	TriggerError(context.Context, *TriggerErrorRequest) (*TriggerErrorResponse, error)
+	CreateUser(context.Context, *CreateUserRequest, ...client.CallOption) (*CreateUserResponse, error)
+	GetUser(context.Context, *GetUserRequest, ...client.CallOption) (*GetUserResponse, error)
+	AuthenticateUser(context.Context, *AuthenticateUserRequest, ...client.CallOption) (*AuthenticateUserResponse, error)
+	CreateBook(context.Context, *CreateBookRequest, ...client.CallOption) (*CreateBookResponse, error)
+	GetBook(context.Context, *GetBookRequest, ...client.CallOption) (*GetBookResponse, error)
+	BorrowBook(context.Context, *BorrowBookRequest, ...client.CallOption) (*BorrowBookResponse, error)
+	ReturnBook(context.Context, *ReturnBookRequest, ...client.CallOption) (*ReturnBookResponse, error)
+	CreateShelf(context.Context, *CreateShelfRequest, ...client.CallOption) (*CreateShelfResponse, error)
+	AddBookToShelf(context.Context, *AddBookToShelfRequest, ...client.CallOption) (*AddBookToShelfResponse, error)
+	TriggerError(context.Context, *TriggerErrorRequest, ...client.CallOption) (*TriggerErrorResponse, error)
 }
 
 type libraryserviceClient struct {
@@ -39,90 +39,90 @@ func NewLibraryServiceClient(cc client.Client) LibraryServiceClient {
 	return &libraryserviceClient{cc}
 }
 
-func (c *libraryserviceClient) CreateUser(ctx context.Context, in *CreateUserRequest) (*CreateUserResponse, error) {
+func (c *libraryserviceClient) CreateUser(ctx context.Context, in *CreateUserRequest, opts ...client.CallOption) (*CreateUserResponse, error) {
 	out := new(CreateUserResponse)
-	err := c.cc.Invoke(ctx, "/codesjoy.yggdrasil.example.proto.errorhandling.LibraryService/CreateUser", in, out)
+	err := c.cc.Invoke(ctx, "/codesjoy.yggdrasil.example.proto.errorhandling.LibraryService/CreateUser", in, out, opts...)
 	if err != nil {
 		return nil, err
 	}
 	return out, nil
 }
 
-func (c *libraryserviceClient) GetUser(ctx context.Context, in *GetUserRequest) (*GetUserResponse, error) {
+func (c *libraryserviceClient) GetUser(ctx context.Context, in *GetUserRequest, opts ...client.CallOption) (*GetUserResponse, error) {
 	out := new(GetUserResponse)
-	err := c.cc.Invoke(ctx, "/codesjoy.yggdrasil.example.proto.errorhandling.LibraryService/GetUser", in, out)
+	err := c.cc.Invoke(ctx, "/codesjoy.yggdrasil.example.proto.errorhandling.LibraryService/GetUser", in, out, opts...)
 	if err != nil {
 		return nil, err
 	}
 	return out, nil
 }
 
-func (c *libraryserviceClient) AuthenticateUser(ctx context.Context, in *AuthenticateUserRequest) (*AuthenticateUserResponse, error) {
+func (c *libraryserviceClient) AuthenticateUser(ctx context.Context, in *AuthenticateUserRequest, opts ...client.CallOption) (*AuthenticateUserResponse, error) {
 	out := new(AuthenticateUserResponse)
-	err := c.cc.Invoke(ctx, "/codesjoy.yggdrasil.example.proto.errorhandling.LibraryService/AuthenticateUser", in, out)
+	err := c.cc.Invoke(ctx, "/codesjoy.yggdrasil.example.proto.errorhandling.LibraryService/AuthenticateUser", in, out, opts...)
 	if err != nil {
 		return nil, err
 	}
 	return out, nil
 }
 
-func (c *libraryserviceClient) CreateBook(ctx context.Context, in *CreateBookRequest) (*CreateBookResponse, error) {
+func (c *libraryserviceClient) CreateBook(ctx context.Context, in *CreateBookRequest, opts ...client.CallOption) (*CreateBookResponse, error) {
 	out := new(CreateBookResponse)
-	err := c.cc.Invoke(ctx, "/codesjoy.yggdrasil.example.proto.errorhandling.LibraryService/CreateBook", in, out)
+	err := c.cc.Invoke(ctx, "/codesjoy.yggdrasil.example.proto.errorhandling.LibraryService/CreateBook", in, out, opts...)
 	if err != nil {
 		return nil, err
 	}
 	return out, nil
 }
 
-func (c *libraryserviceClient) GetBook(ctx context.Context, in *GetBookRequest) (*GetBookResponse, error) {
+func (c *libraryserviceClient) GetBook(ctx context.Context, in *GetBookRequest, opts ...client.CallOption) (*GetBookResponse, error) {
 	out := new(GetBookResponse)
-	err := c.cc.Invoke(ctx, "/codesjoy.yggdrasil.example.proto.errorhandling.LibraryService/GetBook", in, out)
+	err := c.cc.Invoke(ctx, "/codesjoy.yggdrasil.example.proto.errorhandling.LibraryService/GetBook", in, out, opts...)
 	if err != nil {
 		return nil, err
 	}
 	return out, nil
 }
 
-func (c *libraryserviceClient) BorrowBook(ctx context.Context, in *BorrowBookRequest) (*BorrowBookResponse, error) {
+func (c *libraryserviceClient) BorrowBook(ctx context.Context, in *BorrowBookRequest, opts ...client.CallOption) (*BorrowBookResponse, error) {
 	out := new(BorrowBookResponse)
-	err := c.cc.Invoke(ctx, "/codesjoy.yggdrasil.example.proto.errorhandling.LibraryService/BorrowBook", in, out)
+	err := c.cc.Invoke(ctx, "/codesjoy.yggdrasil.example.proto.errorhandling.LibraryService/BorrowBook", in, out, opts...)
 	if err != nil {
 		return nil, err
 	}
 	return out, nil
 }
 
-func (c *libraryserviceClient) ReturnBook(ctx context.Context, in *ReturnBookRequest) (*ReturnBookResponse, error) {
+func (c *libraryserviceClient) ReturnBook(ctx context.Context, in *ReturnBookRequest, opts ...client.CallOption) (*ReturnBookResponse, error) {
 	out := new(ReturnBookResponse)
-	err := c.cc.Invoke(ctx, "/codesjoy.yggdrasil.example.proto.errorhandling.LibraryService/ReturnBook", in, out)
+	err := c.cc.Invoke(ctx, "/codesjoy.yggdrasil.example.proto.errorhandling.LibraryService/ReturnBook", in, out, opts...)
 	if err != nil {
 		return nil, err
 	}
 	return out, nil
 }
 
-func (c *libraryserviceClient) CreateShelf(ctx context.Context, in *CreateShelfRequest) (*CreateShelfResponse, error) {
+func (c *libraryserviceClient) CreateShelf(ctx context.Context, in *CreateShelfRequest, opts ...client.CallOption) (*CreateShelfResponse, error) {
 	out := new(CreateShelfResponse)
-	err := c.cc.Invoke(ctx, "/codesjoy.yggdrasil.example.proto.errorhandling.LibraryService/CreateShelf", in, out)
+	err := c.cc.Invoke(ctx, "/codesjoy.yggdrasil.example.proto.errorhandling.LibraryService/CreateShelf", in, out, opts...)
 	if err != nil {
 		return nil, err
 	}
 	return out, nil
 }
 
-func (c *libraryserviceClient) AddBookToShelf(ctx context.Context, in *AddBookToShelfRequest) (*AddBookToShelfResponse, error) {
+func (c *libraryserviceClient) AddBookToShelf(ctx context.Context, in *AddBookToShelfRequest, opts ...client.CallOption) (*AddBookToShelfResponse, error) {
 	out := new(AddBookToShelfResponse)
-	err := c.cc.Invoke(ctx, "/codesjoy.yggdrasil.example.proto.errorhandling.LibraryService/AddBookToShelf", in, out)
+	err := c.cc.Invoke(ctx, "/codesjoy.yggdrasil.example.proto.errorhandling.LibraryService/AddBookToShelf", in, out, opts...)
 	if err != nil {
 		return nil, err
 	}
 	return out, nil
 }
 
-func (c *libraryserviceClient) TriggerError(ctx context.Context, in *TriggerErrorRequest) (*TriggerErrorResponse, error) {
+func (c *libraryserviceClient) TriggerError(ctx context.Context, in *TriggerErrorRequest, opts ...client.CallOption) (*TriggerErrorResponse, error) {
 	out := new(TriggerErrorResponse)
-	err := c.cc.Invoke(ctx, "/codesjoy.yggdrasil.example.proto.errorhandling.LibraryService/TriggerError", in, out)
+	err := c.cc.Invoke(ctx, "/codesjoy.yggdrasil.example.proto.errorhandling.LibraryService/TriggerError", in, out, opts...)
 	if err != nil {
 		return nil, err
 	}
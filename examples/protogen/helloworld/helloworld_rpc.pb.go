@@ -4,6 +4,7 @@ package helloworld
 
 import (
 	context "context"
+	iter "iter"
 
 	xerror "github.com/codesjoy/pkg/basic/xerror"
 	code "google.golang.org/genproto/googleapis/rpc/code"
@@ -20,27 +21,33 @@ import (
 var _ = new(metadata.MD)
 
 type GreeterServiceClient interface {
-	SayHello(context.Context, *SayHelloRequest) (*SayHelloResponse, error)
-	SayError(context.Context, *SayErrorRequest) (*SayErrorResponse, error)
-	SayHelloStream(context.Context) (GreeterServiceSayHelloStreamClient, error)
-	SayHelloClientStream(context.Context) (GreeterServiceSayHelloClientStreamClient, error)
-	SayHelloServerStream(context.Context, *SayHelloServerStreamRequest) (GreeterServiceSayHelloServerStreamClient, error)
+	SayHello(context.Context, *SayHelloRequest, ...client.CallOption) (*SayHelloResponse, error)
+	SayError(context.Context, *SayErrorRequest, ...client.CallOption) (*SayErrorResponse, error)
+	SayHelloStream(context.Context, ...client.CallOption) (GreeterServiceSayHelloStreamClient, error)
+	SayHelloClientStream(context.Context, ...client.CallOption) (GreeterServiceSayHelloClientStreamClient, error)
+	SayHelloServerStream(context.Context, *SayHelloServerStreamRequest, ...client.CallOption) (GreeterServiceSayHelloServerStreamClient, error)
 }
 
 type GreeterServiceSayHelloStreamClient interface {
 	Send(*SayHelloStreamRequest) error
+	SendAll(context.Context, []*SayHelloStreamRequest) error
 	Recv() (*SayHelloStreamResponse, error)
+	Responses() iter.Seq2[*SayHelloStreamResponse, error]
+	CollectAll(context.Context) ([]*SayHelloStreamResponse, error)
 	stream.ClientStream
 }
 
 type GreeterServiceSayHelloClientStreamClient interface {
 	Send(*SayHelloClientStreamRequest) error
+	SendAll(context.Context, []*SayHelloClientStreamRequest) error
 	CloseAndRecv() (*SayHelloClientStreamResponse, error)
 	stream.ClientStream
 }
 
 type GreeterServiceSayHelloServerStreamClient interface {
 	Recv() (*SayHelloServerStreamResponse, error)
+	Responses() iter.Seq2[*SayHelloServerStreamResponse, error]
+	CollectAll(context.Context) ([]*SayHelloServerStreamResponse, error)
 	stream.ClientStream
 }
 
@@ -52,26 +59,26 @@ func NewGreeterServiceClient(cc client.Client) GreeterServiceClient {
 	return &greeterserviceClient{cc}
 }
 
-func (c *greeterserviceClient) SayHello(ctx context.Context, in *SayHelloRequest) (*SayHelloResponse, error) {
+func (c *greeterserviceClient) SayHello(ctx context.Context, in *SayHelloRequest, opts ...client.CallOption) (*SayHelloResponse, error) {
 	out := new(SayHelloResponse)
-	err := c.cc.Invoke(ctx, "/codesjoy.yggdrasil.example.proto.helloword.GreeterService/SayHello", in, out)
+	err := c.cc.Invoke(ctx, "/codesjoy.yggdrasil.example.proto.helloword.GreeterService/SayHello", in, out, opts...)
 	if err != nil {
 		return nil, err
 	}
 	return out, nil
 }
 
-func (c *greeterserviceClient) SayError(ctx context.Context, in *SayErrorRequest) (*SayErrorResponse, error) {
+func (c *greeterserviceClient) SayError(ctx context.Context, in *SayErrorRequest, opts ...client.CallOption) (*SayErrorResponse, error) {
 	out := new(SayErrorResponse)
-	err := c.cc.Invoke(ctx, "/codesjoy.yggdrasil.example.proto.helloword.GreeterService/SayError", in, out)
+	err := c.cc.Invoke(ctx, "/codesjoy.yggdrasil.example.proto.helloword.GreeterService/SayError", in, out, opts...)
 	if err != nil {
 		return nil, err
 	}
 	return out, nil
 }
 
-func (c *greeterserviceClient) SayHelloStream(ctx context.Context) (GreeterServiceSayHelloStreamClient, error) {
-	stream, err := c.cc.NewStream(ctx, &GreeterServiceServiceDesc.Streams[0], "/codesjoy.yggdrasil.example.proto.helloword.GreeterService/SayHelloStream")
+func (c *greeterserviceClient) SayHelloStream(ctx context.Context, opts ...client.CallOption) (GreeterServiceSayHelloStreamClient, error) {
+	stream, err := c.cc.NewStream(ctx, &GreeterServiceServiceDesc.Streams[0], "/codesjoy.yggdrasil.example.proto.helloword.GreeterService/SayHelloStream", opts...)
 	if err != nil {
 		return nil, err
 	}
@@ -99,6 +106,10 @@ func (x *greeterserviceSayHelloStreamClient) Send(m *SayHelloStreamRequest) erro
 	return x.ClientStream.SendMsg(m)
 }
 
+func (x *greeterserviceSayHelloStreamClient) SendAll(ctx context.Context, msgs []*SayHelloStreamRequest) error {
+	return stream.SendAll(ctx, x.Send, msgs)
+}
+
 func (x *greeterserviceSayHelloStreamClient) Recv() (*SayHelloStreamResponse, error) {
 	m := new(SayHelloStreamResponse)
 	if err := x.ClientStream.RecvMsg(m); err != nil {
@@ -107,8 +118,15 @@ func (x *greeterserviceSayHelloStreamClient) Recv() (*SayHelloStreamResponse, er
 	return m, nil
 }
 
-func (c *greeterserviceClient) SayHelloClientStream(ctx context.Context) (GreeterServiceSayHelloClientStreamClient, error) {
-	stream, err := c.cc.NewStream(ctx, &GreeterServiceServiceDesc.Streams[1], "/codesjoy.yggdrasil.example.proto.helloword.GreeterService/SayHelloClientStream")
+func (x *greeterserviceSayHelloStreamClient) Responses() iter.Seq2[*SayHelloStreamResponse, error] {
+	return stream.Responses(x.Recv)
+}
+
+func (x *greeterserviceSayHelloStreamClient) CollectAll(ctx context.Context) ([]*SayHelloStreamResponse, error) {
+	return stream.CollectAll(ctx, x.Recv)
+}
+func (c *greeterserviceClient) SayHelloClientStream(ctx context.Context, opts ...client.CallOption) (GreeterServiceSayHelloClientStreamClient, error) {
+	stream, err := c.cc.NewStream(ctx, &GreeterServiceServiceDesc.Streams[1], "/codesjoy.yggdrasil.example.proto.helloword.GreeterService/SayHelloClientStream", opts...)
 	if err != nil {
 		return nil, err
 	}
@@ -147,8 +165,12 @@ func (x *greeterserviceSayHelloClientStreamClient) Send(m *SayHelloClientStreamR
 	return x.ClientStream.SendMsg(m)
 }
 
-func (c *greeterserviceClient) SayHelloServerStream(ctx context.Context, in *SayHelloServerStreamRequest) (GreeterServiceSayHelloServerStreamClient, error) {
-	stream, err := c.cc.NewStream(ctx, &GreeterServiceServiceDesc.Streams[2], "/codesjoy.yggdrasil.example.proto.helloword.GreeterService/SayHelloServerStream")
+func (x *greeterserviceSayHelloClientStreamClient) SendAll(ctx context.Context, msgs []*SayHelloClientStreamRequest) error {
+	return stream.SendAll(ctx, x.Send, msgs)
+}
+
+func (c *greeterserviceClient) SayHelloServerStream(ctx context.Context, in *SayHelloServerStreamRequest, opts ...client.CallOption) (GreeterServiceSayHelloServerStreamClient, error) {
+	stream, err := c.cc.NewStream(ctx, &GreeterServiceServiceDesc.Streams[2], "/codesjoy.yggdrasil.example.proto.helloword.GreeterService/SayHelloServerStream", opts...)
 	if err != nil {
 		return nil, err
 	}
@@ -186,6 +208,14 @@ func (x *greeterserviceSayHelloServerStreamClient) Recv() (*SayHelloServerStream
 	return m, nil
 }
 
+func (x *greeterserviceSayHelloServerStreamClient) Responses() iter.Seq2[*SayHelloServerStreamResponse, error] {
+	return stream.Responses(x.Recv)
+}
+
+func (x *greeterserviceSayHelloServerStreamClient) CollectAll(ctx context.Context) ([]*SayHelloServerStreamResponse, error) {
+	return stream.CollectAll(ctx, x.Recv)
+}
+
 func _GreeterService_SayHello_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, unaryInt interceptor.UnaryServerInterceptor) (interface{}, error) {
 	in := new(SayHelloRequest)
 	if err := dec(in); err != nil {
@@ -37,6 +37,10 @@ func local_handler_LibraryService_CreateShelf_0(w http.ResponseWriter, r *http.R
 		return nil, xerror.Wrap(err, code.Code_INVALID_ARGUMENT, "")
 	}
 
+	if err := rest.PopulateQueryParameters(protoReq, r.URL.Query()); err != nil {
+		return nil, xerror.Wrap(err, code.Code_INVALID_ARGUMENT, "")
+	}
+
 	if unaryInt == nil {
 		return server.(LibraryServiceServer).CreateShelf(r.Context(), protoReq)
 	}
@@ -53,6 +57,7 @@ func local_handler_LibraryService_CreateShelf_0(w http.ResponseWriter, r *http.R
 
 func local_handler_LibraryService_GetShelf_0(w http.ResponseWriter, r *http.Request, server interface{}, unaryInt interceptor.UnaryServerInterceptor) (interface{}, error) {
 	protoReq := &GetShelfRequest{}
+
 	if err := rest.PopulateQueryParameters(protoReq, r.URL.Query()); err != nil {
 		return nil, xerror.Wrap(err, code.Code_INVALID_ARGUMENT, "")
 	}
@@ -79,6 +84,7 @@ func local_handler_LibraryService_GetShelf_0(w http.ResponseWriter, r *http.Requ
 
 func local_handler_LibraryService_ListShelves_0(w http.ResponseWriter, r *http.Request, server interface{}, unaryInt interceptor.UnaryServerInterceptor) (interface{}, error) {
 	protoReq := &ListShelvesRequest{}
+
 	if err := rest.PopulateQueryParameters(protoReq, r.URL.Query()); err != nil {
 		return nil, xerror.Wrap(err, code.Code_INVALID_ARGUMENT, "")
 	}
@@ -99,6 +105,7 @@ func local_handler_LibraryService_ListShelves_0(w http.ResponseWriter, r *http.R
 
 func local_handler_LibraryService_DeleteShelf_0(w http.ResponseWriter, r *http.Request, server interface{}, unaryInt interceptor.UnaryServerInterceptor) (interface{}, error) {
 	protoReq := &DeleteShelfRequest{}
+
 	if err := rest.PopulateQueryParameters(protoReq, r.URL.Query()); err != nil {
 		return nil, xerror.Wrap(err, code.Code_INVALID_ARGUMENT, "")
 	}
@@ -164,6 +171,10 @@ func local_handler_LibraryService_CreateBook_0(w http.ResponseWriter, r *http.Re
 		return nil, xerror.Wrap(err, code.Code_INVALID_ARGUMENT, "")
 	}
 
+	if err := rest.PopulateQueryParameters(protoReq, r.URL.Query()); err != nil {
+		return nil, xerror.Wrap(err, code.Code_INVALID_ARGUMENT, "")
+	}
+
 	if val := "shelves/" + v5.URLParam(r, "params1"); len(val) == 0 {
 		return nil, xerror.New(code.Code_INVALID_ARGUMENT, "not found parent")
 	} else if err := rest.PopulateFieldFromPath(protoReq, "parent", val); err != nil {
@@ -186,6 +197,7 @@ func local_handler_LibraryService_CreateBook_0(w http.ResponseWriter, r *http.Re
 
 func local_handler_LibraryService_GetBook_0(w http.ResponseWriter, r *http.Request, server interface{}, unaryInt interceptor.UnaryServerInterceptor) (interface{}, error) {
 	protoReq := &GetBookRequest{}
+
 	if err := rest.PopulateQueryParameters(protoReq, r.URL.Query()); err != nil {
 		return nil, xerror.Wrap(err, code.Code_INVALID_ARGUMENT, "")
 	}
@@ -212,6 +224,7 @@ func local_handler_LibraryService_GetBook_0(w http.ResponseWriter, r *http.Reque
 
 func local_handler_LibraryService_ListBooks_0(w http.ResponseWriter, r *http.Request, server interface{}, unaryInt interceptor.UnaryServerInterceptor) (interface{}, error) {
 	protoReq := &ListBooksRequest{}
+
 	if err := rest.PopulateQueryParameters(protoReq, r.URL.Query()); err != nil {
 		return nil, xerror.Wrap(err, code.Code_INVALID_ARGUMENT, "")
 	}
@@ -238,6 +251,7 @@ func local_handler_LibraryService_ListBooks_0(w http.ResponseWriter, r *http.Req
 
 func local_handler_LibraryService_DeleteBook_0(w http.ResponseWriter, r *http.Request, server interface{}, unaryInt interceptor.UnaryServerInterceptor) (interface{}, error) {
 	protoReq := &DeleteBookRequest{}
+
 	if err := rest.PopulateQueryParameters(protoReq, r.URL.Query()); err != nil {
 		return nil, xerror.Wrap(err, code.Code_INVALID_ARGUMENT, "")
 	}
@@ -275,6 +289,10 @@ func local_handler_LibraryService_UpdateBook_0(w http.ResponseWriter, r *http.Re
 		return nil, xerror.Wrap(err, code.Code_INVALID_ARGUMENT, "")
 	}
 
+	if err := rest.PopulateQueryParameters(protoReq, r.URL.Query()); err != nil {
+		return nil, xerror.Wrap(err, code.Code_INVALID_ARGUMENT, "")
+	}
+
 	if val := "shelves/" + v5.URLParam(r, "params1") + "/books/" + v5.URLParam(r, "params2"); len(val) == 0 {
 		return nil, xerror.New(code.Code_INVALID_ARGUMENT, "not found book.name")
 	} else if err := rest.PopulateFieldFromPath(protoReq, "book.name", val); err != nil {
@@ -324,62 +342,85 @@ func local_handler_LibraryService_MoveBook_0(w http.ResponseWriter, r *http.Requ
 }
 
 var LibraryServiceRestServiceDesc = server.RestServiceDesc{
+	ServiceName: "codesjoy.yggdrasil.example.proto.library.v1.LibraryService",
 	HandlerType: (*LibraryServiceServer)(nil),
 	Methods: []server.RestMethodDesc{
 		{
-			Method:  "POST",
-			Path:    "/v1/shelves",
-			Handler: local_handler_LibraryService_CreateShelf_0,
+			Method:   "POST",
+			Path:     "/v1/shelves",
+			Handler:  local_handler_LibraryService_CreateShelf_0,
+			RPC:      "/codesjoy.yggdrasil.example.proto.library.v1.LibraryService/CreateShelf",
+			Template: "/v1/shelves",
 		},
 		{
-			Method:  "GET",
-			Path:    "/v1/shelves/{params1}",
-			Handler: local_handler_LibraryService_GetShelf_0,
+			Method:   "GET",
+			Path:     "/v1/shelves/{params1}",
+			Handler:  local_handler_LibraryService_GetShelf_0,
+			RPC:      "/codesjoy.yggdrasil.example.proto.library.v1.LibraryService/GetShelf",
+			Template: "/v1/{name=shelves/*}",
 		},
 		{
-			Method:  "GET",
-			Path:    "/v1/shelves",
-			Handler: local_handler_LibraryService_ListShelves_0,
+			Method:   "GET",
+			Path:     "/v1/shelves",
+			Handler:  local_handler_LibraryService_ListShelves_0,
+			RPC:      "/codesjoy.yggdrasil.example.proto.library.v1.LibraryService/ListShelves",
+			Template: "/v1/shelves",
 		},
 		{
-			Method:  "DELETE",
-			Path:    "/v1/shelves/{params1}",
-			Handler: local_handler_LibraryService_DeleteShelf_0,
+			Method:   "DELETE",
+			Path:     "/v1/shelves/{params1}",
+			Handler:  local_handler_LibraryService_DeleteShelf_0,
+			RPC:      "/codesjoy.yggdrasil.example.proto.library.v1.LibraryService/DeleteShelf",
+			Template: "/v1/{name=shelves/*}",
 		},
 		{
-			Method:  "POST",
-			Path:    "/v1/shelves/{params1}:merge",
-			Handler: local_handler_LibraryService_MergeShelves_0,
+			Method:   "POST",
+			Path:     "/v1/shelves/{params1}:merge",
+			Handler:  local_handler_LibraryService_MergeShelves_0,
+			RPC:      "/codesjoy.yggdrasil.example.proto.library.v1.LibraryService/MergeShelves",
+			Template: "/v1/{name=shelves/*}:merge",
 		},
 		{
-			Method:  "POST",
-			Path:    "/v1/shelves/{params1}/books",
-			Handler: local_handler_LibraryService_CreateBook_0,
+			Method:   "POST",
+			Path:     "/v1/shelves/{params1}/books",
+			Handler:  local_handler_LibraryService_CreateBook_0,
+			RPC:      "/codesjoy.yggdrasil.example.proto.library.v1.LibraryService/CreateBook",
+			Template: "/v1/{parent=shelves/*}/books",
 		},
 		{
-			Method:  "GET",
-			Path:    "/v1/shelves/{params1}/books/{params2}",
-			Handler: local_handler_LibraryService_GetBook_0,
+			Method:   "GET",
+			Path:     "/v1/shelves/{params1}/books/{params2}",
+			Handler:  local_handler_LibraryService_GetBook_0,
+			RPC:      "/codesjoy.yggdrasil.example.proto.library.v1.LibraryService/GetBook",
+			Template: "/v1/{name=shelves/*/books/*}",
 		},
 		{
-			Method:  "GET",
-			Path:    "/v1/shelves/{params1}/books",
-			Handler: local_handler_LibraryService_ListBooks_0,
+			Method:   "GET",
+			Path:     "/v1/shelves/{params1}/books",
+			Handler:  local_handler_LibraryService_ListBooks_0,
+			RPC:      "/codesjoy.yggdrasil.example.proto.library.v1.LibraryService/ListBooks",
+			Template: "/v1/{parent=shelves/*}/books",
 		},
 		{
-			Method:  "DELETE",
-			Path:    "/v1/shelves/{params1}/books/{params2}",
-			Handler: local_handler_LibraryService_DeleteBook_0,
+			Method:   "DELETE",
+			Path:     "/v1/shelves/{params1}/books/{params2}",
+			Handler:  local_handler_LibraryService_DeleteBook_0,
+			RPC:      "/codesjoy.yggdrasil.example.proto.library.v1.LibraryService/DeleteBook",
+			Template: "/v1/{name=shelves/*/books/*}",
 		},
 		{
-			Method:  "PATCH",
-			Path:    "/v1/shelves/{params1}/books/{params2}",
-			Handler: local_handler_LibraryService_UpdateBook_0,
+			Method:   "PATCH",
+			Path:     "/v1/shelves/{params1}/books/{params2}",
+			Handler:  local_handler_LibraryService_UpdateBook_0,
+			RPC:      "/codesjoy.yggdrasil.example.proto.library.v1.LibraryService/UpdateBook",
+			Template: "/v1/{book.name=shelves/*/books/*}",
 		},
 		{
-			Method:  "POST",
-			Path:    "/v1/shelves/{params1}/books/{params2}:move",
-			Handler: local_handler_LibraryService_MoveBook_0,
+			Method:   "POST",
+			Path:     "/v1/shelves/{params1}/books/{params2}:move",
+			Handler:  local_handler_LibraryService_MoveBook_0,
+			RPC:      "/codesjoy.yggdrasil.example.proto.library.v1.LibraryService/MoveBook",
+			Template: "/v1/{name=shelves/*/books/*}:move",
 		},
 	},
 }
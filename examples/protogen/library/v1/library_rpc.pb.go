@@ -20,17 +20,17 @@ import (
 var _ = new(metadata.MD)
 
 type LibraryServiceClient interface {
-	CreateShelf(context.Context, *CreateShelfRequest) (*Shelf, error)
-	GetShelf(context.Context, *GetShelfRequest) (*Shelf, error)
-	ListShelves(context.Context, *ListShelvesRequest) (*ListShelvesResponse, error)
-	DeleteShelf(context.Context, *DeleteShelfRequest) (*emptypb.Empty, error)
-	MergeShelves(context.Context, *MergeShelvesRequest) (*Shelf, error)
-	CreateBook(context.Context, *CreateBookRequest) (*Book, error)
-	GetBook(context.Context, *GetBookRequest) (*Book, error)
-	ListBooks(context.Context, *ListBooksRequest) (*ListBooksResponse, error)
-	DeleteBook(context.Context, *DeleteBookRequest) (*emptypb.Empty, error)
-	UpdateBook(context.Context, *UpdateBookRequest) (*Book, error)
-	MoveBook(context.Context, *MoveBookRequest) (*Book, error)
+	CreateShelf(context.Context, *CreateShelfRequest, ...client.CallOption) (*Shelf, error)
+	GetShelf(context.Context, *GetShelfRequest, ...client.CallOption) (*Shelf, error)
+	ListShelves(context.Context, *ListShelvesRequest, ...client.CallOption) (*ListShelvesResponse, error)
+	DeleteShelf(context.Context, *DeleteShelfRequest, ...client.CallOption) (*emptypb.Empty, error)
+	MergeShelves(context.Context, *MergeShelvesRequest, ...client.CallOption) (*Shelf, error)
+	CreateBook(context.Context, *CreateBookRequest, ...client.CallOption) (*Book, error)
+	GetBook(context.Context, *GetBookRequest, ...client.CallOption) (*Book, error)
+	ListBooks(context.Context, *ListBooksRequest, ...client.CallOption) (*ListBooksResponse, error)
+	DeleteBook(context.Context, *DeleteBookRequest, ...client.CallOption) (*emptypb.Empty, error)
+	UpdateBook(context.Context, *UpdateBookRequest, ...client.CallOption) (*Book, error)
+	MoveBook(context.Context, *MoveBookRequest, ...client.CallOption) (*Book, error)
 }
 
 type libraryserviceClient struct {
@@ -41,99 +41,99 @@ func NewLibraryServiceClient(cc client.Client) LibraryServiceClient {
 	return &libraryserviceClient{cc}
 }
 
-func (c *libraryserviceClient) CreateShelf(ctx context.Context, in *CreateShelfRequest) (*Shelf, error) {
+func (c *libraryserviceClient) CreateShelf(ctx context.Context, in *CreateShelfRequest, opts ...client.CallOption) (*Shelf, error) {
 	out := new(Shelf)
-	err := c.cc.Invoke(ctx, "/codesjoy.yggdrasil.example.proto.library.v1.LibraryService/CreateShelf", in, out)
+	err := c.cc.Invoke(ctx, "/codesjoy.yggdrasil.example.proto.library.v1.LibraryService/CreateShelf", in, out, opts...)
 	if err != nil {
 		return nil, err
 	}
 	return out, nil
 }
 
-func (c *libraryserviceClient) GetShelf(ctx context.Context, in *GetShelfRequest) (*Shelf, error) {
+func (c *libraryserviceClient) GetShelf(ctx context.Context, in *GetShelfRequest, opts ...client.CallOption) (*Shelf, error) {
 	out := new(Shelf)
-	err := c.cc.Invoke(ctx, "/codesjoy.yggdrasil.example.proto.library.v1.LibraryService/GetShelf", in, out)
+	err := c.cc.Invoke(ctx, "/codesjoy.yggdrasil.example.proto.library.v1.LibraryService/GetShelf", in, out, opts...)
 	if err != nil {
 		return nil, err
 	}
 	return out, nil
 }
 
-func (c *libraryserviceClient) ListShelves(ctx context.Context, in *ListShelvesRequest) (*ListShelvesResponse, error) {
+func (c *libraryserviceClient) ListShelves(ctx context.Context, in *ListShelvesRequest, opts ...client.CallOption) (*ListShelvesResponse, error) {
 	out := new(ListShelvesResponse)
-	err := c.cc.Invoke(ctx, "/codesjoy.yggdrasil.example.proto.library.v1.LibraryService/ListShelves", in, out)
+	err := c.cc.Invoke(ctx, "/codesjoy.yggdrasil.example.proto.library.v1.LibraryService/ListShelves", in, out, opts...)
 	if err != nil {
 		return nil, err
 	}
 	return out, nil
 }
 
-func (c *libraryserviceClient) DeleteShelf(ctx context.Context, in *DeleteShelfRequest) (*emptypb.Empty, error) {
+func (c *libraryserviceClient) DeleteShelf(ctx context.Context, in *DeleteShelfRequest, opts ...client.CallOption) (*emptypb.Empty, error) {
 	out := new(emptypb.Empty)
-	err := c.cc.Invoke(ctx, "/codesjoy.yggdrasil.example.proto.library.v1.LibraryService/DeleteShelf", in, out)
+	err := c.cc.Invoke(ctx, "/codesjoy.yggdrasil.example.proto.library.v1.LibraryService/DeleteShelf", in, out, opts...)
 	if err != nil {
 		return nil, err
 	}
 	return out, nil
 }
 
-func (c *libraryserviceClient) MergeShelves(ctx context.Context, in *MergeShelvesRequest) (*Shelf, error) {
+func (c *libraryserviceClient) MergeShelves(ctx context.Context, in *MergeShelvesRequest, opts ...client.CallOption) (*Shelf, error) {
 	out := new(Shelf)
-	err := c.cc.Invoke(ctx, "/codesjoy.yggdrasil.example.proto.library.v1.LibraryService/MergeShelves", in, out)
+	err := c.cc.Invoke(ctx, "/codesjoy.yggdrasil.example.proto.library.v1.LibraryService/MergeShelves", in, out, opts...)
 	if err != nil {
 		return nil, err
 	}
 	return out, nil
 }
 
-func (c *libraryserviceClient) CreateBook(ctx context.Context, in *CreateBookRequest) (*Book, error) {
+func (c *libraryserviceClient) CreateBook(ctx context.Context, in *CreateBookRequest, opts ...client.CallOption) (*Book, error) {
 	out := new(Book)
-	err := c.cc.Invoke(ctx, "/codesjoy.yggdrasil.example.proto.library.v1.LibraryService/CreateBook", in, out)
+	err := c.cc.Invoke(ctx, "/codesjoy.yggdrasil.example.proto.library.v1.LibraryService/CreateBook", in, out, opts...)
 	if err != nil {
 		return nil, err
 	}
 	return out, nil
 }
 
-func (c *libraryserviceClient) GetBook(ctx context.Context, in *GetBookRequest) (*Book, error) {
+func (c *libraryserviceClient) GetBook(ctx context.Context, in *GetBookRequest, opts ...client.CallOption) (*Book, error) {
 	out := new(Book)
-	err := c.cc.Invoke(ctx, "/codesjoy.yggdrasil.example.proto.library.v1.LibraryService/GetBook", in, out)
+	err := c.cc.Invoke(ctx, "/codesjoy.yggdrasil.example.proto.library.v1.LibraryService/GetBook", in, out, opts...)
 	if err != nil {
 		return nil, err
 	}
 	return out, nil
 }
 
-func (c *libraryserviceClient) ListBooks(ctx context.Context, in *ListBooksRequest) (*ListBooksResponse, error) {
+func (c *libraryserviceClient) ListBooks(ctx context.Context, in *ListBooksRequest, opts ...client.CallOption) (*ListBooksResponse, error) {
 	out := new(ListBooksResponse)
-	err := c.cc.Invoke(ctx, "/codesjoy.yggdrasil.example.proto.library.v1.LibraryService/ListBooks", in, out)
+	err := c.cc.Invoke(ctx, "/codesjoy.yggdrasil.example.proto.library.v1.LibraryService/ListBooks", in, out, opts...)
 	if err != nil {
 		return nil, err
 	}
 	return out, nil
 }
 
-func (c *libraryserviceClient) DeleteBook(ctx context.Context, in *DeleteBookRequest) (*emptypb.Empty, error) {
+func (c *libraryserviceClient) DeleteBook(ctx context.Context, in *DeleteBookRequest, opts ...client.CallOption) (*emptypb.Empty, error) {
 	out := new(emptypb.Empty)
-	err := c.cc.Invoke(ctx, "/codesjoy.yggdrasil.example.proto.library.v1.LibraryService/DeleteBook", in, out)
+	err := c.cc.Invoke(ctx, "/codesjoy.yggdrasil.example.proto.library.v1.LibraryService/DeleteBook", in, out, opts...)
 	if err != nil {
 		return nil, err
 	}
 	return out, nil
 }
 
-func (c *libraryserviceClient) UpdateBook(ctx context.Context, in *UpdateBookRequest) (*Book, error) {
+func (c *libraryserviceClient) UpdateBook(ctx context.Context, in *UpdateBookRequest, opts ...client.CallOption) (*Book, error) {
 	out := new(Book)
-	err := c.cc.Invoke(ctx, "/codesjoy.yggdrasil.example.proto.library.v1.LibraryService/UpdateBook", in, out)
+	err := c.cc.Invoke(ctx, "/codesjoy.yggdrasil.example.proto.library.v1.LibraryService/UpdateBook", in, out, opts...)
 	if err != nil {
 		return nil, err
 	}
 	return out, nil
 }
 
-func (c *libraryserviceClient) MoveBook(ctx context.Context, in *MoveBookRequest) (*Book, error) {
+func (c *libraryserviceClient) MoveBook(ctx context.Context, in *MoveBookRequest, opts ...client.CallOption) (*Book, error) {
 	out := new(Book)
-	err := c.cc.Invoke(ctx, "/codesjoy.yggdrasil.example.proto.library.v1.LibraryService/MoveBook", in, out)
+	err := c.cc.Invoke(ctx, "/codesjoy.yggdrasil.example.proto.library.v1.LibraryService/MoveBook", in, out, opts...)
 	if err != nil {
 		return nil, err
 	}
@@ -15,6 +15,7 @@
 package settings
 
 import (
+	"errors"
 	"fmt"
 	"slices"
 	"sort"
@@ -134,6 +135,9 @@ func Compile(root Root) (Resolved, error) {
 	if err := validateSecurityProfileReferences(resolved); err != nil {
 		return Resolved{}, err
 	}
+	if err := validateProtocolConfigs(resolved); err != nil {
+		return Resolved{}, err
+	}
 
 	resolved.CapabilityBindings = compileCapabilityBindings(resolved)
 
@@ -359,6 +363,23 @@ func compileCapabilityBindings(resolved Resolved) map[string][]string {
 	return out
 }
 
+// validateProtocolConfigs validates the typed server configs of each
+// protocol, reporting every invalid key under its config path.
+func validateProtocolConfigs(resolved Resolved) error {
+	var errs []error
+	check := func(path string, err error) {
+		if err != nil {
+			errs = append(errs, fmt.Errorf("invalid %s: %w", path, err))
+		}
+	}
+	check("yggdrasil.transports.grpc.server", resolved.Transports.GRPC.Server.Validate())
+	if resolved.Transports.Rest != nil {
+		check("yggdrasil.transports.http.rest", resolved.Transports.Rest.Validate())
+	}
+	check("yggdrasil.admin.governor", resolved.Admin.Governor.Validate())
+	return errors.Join(errs...)
+}
+
 func validateSecurityProfileReferences(resolved Resolved) error {
 	defined := resolved.Transports.SecurityProfiles
 	check := func(name, key string) error {
@@ -19,6 +19,7 @@ import (
 	"slices"
 
 	"github.com/codesjoy/yggdrasil/v3/internal/backoff"
+	"github.com/codesjoy/yggdrasil/v3/rpc/interceptor"
 	grpcprotocol "github.com/codesjoy/yggdrasil/v3/transport/protocol/grpc"
 	rpchttp "github.com/codesjoy/yggdrasil/v3/transport/protocol/rpchttp"
 	"github.com/codesjoy/yggdrasil/v3/transport/runtime/client"
@@ -52,6 +53,18 @@ func mergeClientServiceSettings(
 			)
 		}
 	}
+	if overlay.Methods != nil {
+		out.Methods = mergeMethodSettings(base.Methods, *overlay.Methods)
+	}
+	if overlay.Routing != nil {
+		out.Routing = *overlay.Routing
+	}
+	if overlay.IdleTimeout != nil {
+		out.IdleTimeout = *overlay.IdleTimeout
+	}
+	if overlay.Warmup != nil {
+		out.Warmup = *overlay.Warmup
+	}
 	if overlay.Interceptors != nil {
 		if overlay.Interceptors.Unary != nil {
 			out.Interceptors.Unary = mergeInterceptorNames(
@@ -65,6 +78,12 @@ func mergeClientServiceSettings(
 				*overlay.Interceptors.Stream,
 			)
 		}
+		if overlay.Interceptors.Rules != nil {
+			out.Interceptors.Rules = append(
+				append([]interceptor.ChainRule(nil), base.Interceptors.Rules...),
+				*overlay.Interceptors.Rules...,
+			)
+		}
 	}
 	return out
 }
@@ -115,6 +134,17 @@ func mergeGRPCClientConfig(
 	if overlay.Network != nil {
 		out.Network = *overlay.Network
 	}
+	if overlay.ConnsPerEndpoint != nil {
+		out.ConnsPerEndpoint = *overlay.ConnsPerEndpoint
+	}
+	if overlay.Backoff != nil {
+		merged := backoff.DefaultConfig
+		if base.Backoff != nil {
+			merged = *base.Backoff
+		}
+		merged = mergeBackoffConfig(merged, *overlay.Backoff)
+		out.Backoff = &merged
+	}
 	out.Transport = mergeGRPCTransportConfig(base.Transport, overlay.Transport)
 	return out
 }
@@ -151,6 +181,9 @@ func mergeGRPCTransportConfig(
 	if overlay.MaxHeaderListSize != nil {
 		out.MaxHeaderListSize = overlay.MaxHeaderListSize
 	}
+	if overlay.DynamicWindow != nil {
+		out.DynamicWindow = overlay.DynamicWindow
+	}
 	return out
 }
 
@@ -171,6 +204,15 @@ func mergeBackoffConfig(base backoff.Config, overlay backoffConfigOverlay) backo
 	return out
 }
 
+func mergeMethodSettings(
+	base, overlay map[string]client.MethodSettings,
+) map[string]client.MethodSettings {
+	out := make(map[string]client.MethodSettings, len(base)+len(overlay))
+	maps.Copy(out, base)
+	maps.Copy(out, overlay)
+	return out
+}
+
 func mergeRemoteAttributes(base, overlay map[string]any) map[string]any {
 	if len(overlay) == 0 {
 		return map[string]any{}
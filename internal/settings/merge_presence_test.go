@@ -19,6 +19,8 @@ import (
 	"time"
 
 	"github.com/stretchr/testify/require"
+
+	"github.com/codesjoy/yggdrasil/v3/transport/runtime/client"
 )
 
 func TestCompile_ServiceOverridesHonorExplicitZeroAndEmptyValues(t *testing.T) {
@@ -114,3 +116,147 @@ func TestCompile_ServiceOverridesHonorExplicitZeroAndEmptyValues(t *testing.T) {
 	require.Equal(t, "", resolved.Transports.GRPC.ClientServices["svc"].Transport.UserAgent)
 	require.Equal(t, time.Duration(0), resolved.Transports.HTTP.ClientServices["svc"].Timeout)
 }
+
+func TestCompile_ServiceMethodTimeoutsMergeWithDefaults(t *testing.T) {
+	root := decodeRoot(t, map[string]any{
+		"yggdrasil": map[string]any{
+			"clients": map[string]any{
+				"defaults": map[string]any{
+					"idle_timeout": "5m",
+					"methods": map[string]any{
+						"Get":  map[string]any{"timeout": "1s"},
+						"List": map[string]any{"timeout": "2s"},
+					},
+				},
+				"services": map[string]any{
+					"svc": map[string]any{
+						"methods": map[string]any{
+							"List": map[string]any{"timeout": "5s"},
+						},
+					},
+				},
+			},
+		},
+	})
+
+	resolved, err := Compile(root)
+	require.NoError(t, err)
+
+	methods := resolved.Clients.Services["svc"].Methods
+	require.Equal(t, time.Second, methods["Get"].Timeout)
+	require.Equal(t, 5*time.Second, methods["List"].Timeout)
+	require.Equal(t, 5*time.Minute, resolved.Clients.Services["svc"].IdleTimeout)
+}
+
+func TestCompile_ServiceRoutingReplacesDefaults(t *testing.T) {
+	root := decodeRoot(t, map[string]any{
+		"yggdrasil": map[string]any{
+			"clients": map[string]any{
+				"defaults": map[string]any{
+					"routing": map[string]any{
+						"default_subset": map[string]any{"version": "v1"},
+					},
+				},
+				"services": map[string]any{
+					"svc": map[string]any{
+						"routing": map[string]any{
+							"rules": []any{map[string]any{
+								"match": map[string]any{
+									"metadata":   map[string]any{"x-canary": "true"},
+									"hash_range": map[string]any{"header": "user-id", "to": 10},
+								},
+								"subset": map[string]any{"version": "v2"},
+							}},
+						},
+					},
+				},
+			},
+		},
+	})
+
+	resolved, err := Compile(root)
+	require.NoError(t, err)
+
+	routing := resolved.Clients.Services["svc"].Routing
+	require.Len(t, routing.Rules, 1)
+	require.Equal(t, map[string]string{"version": "v2"}, routing.Rules[0].Subset)
+	require.Equal(t, "true", routing.Rules[0].Match.Metadata["x-canary"])
+	require.Equal(t, uint32(10), routing.Rules[0].Match.HashRange.To)
+	require.Empty(t, routing.DefaultSubset)
+}
+
+func TestCompile_InterceptorRules(t *testing.T) {
+	root := decodeRoot(t, map[string]any{
+		"yggdrasil": map[string]any{
+			"server": map[string]any{
+				"interceptors": map[string]any{
+					"rules": []any{map[string]any{
+						"methods": []any{"/grpc.health.v1.Health/*"},
+						"remove":  []any{"logging"},
+					}},
+				},
+			},
+			"clients": map[string]any{
+				"defaults": map[string]any{
+					"interceptors": map[string]any{
+						"rules": []any{map[string]any{"append": []any{"metrics"}}},
+					},
+				},
+				"services": map[string]any{
+					"svc": map[string]any{
+						"interceptors": map[string]any{
+							"rules": []any{map[string]any{
+								"methods":         []any{"/svc.v1.Svc/*"},
+								"exclude_methods": []any{"/svc.v1.Svc/Ping"},
+								"chain":           []any{"retry"},
+							}},
+						},
+					},
+				},
+			},
+		},
+	})
+
+	resolved, err := Compile(root)
+	require.NoError(t, err)
+
+	serverRules := resolved.Server.Interceptors.Rules
+	require.Len(t, serverRules, 1)
+	require.Equal(t, []string{"logging"}, serverRules[0].Remove)
+
+	clientRules := resolved.Clients.Services["svc"].Interceptors.Rules
+	require.Len(t, clientRules, 2)
+	require.Equal(t, []string{"metrics"}, clientRules[0].Append)
+	require.Equal(t, []string{"/svc.v1.Svc/Ping"}, clientRules[1].ExcludeMethods)
+	require.Equal(t, []string{"retry"}, clientRules[1].Chain)
+}
+
+func TestCompile_ServiceWarmupReplacesDefaults(t *testing.T) {
+	root := decodeRoot(t, map[string]any{
+		"yggdrasil": map[string]any{
+			"clients": map[string]any{
+				"defaults": map[string]any{
+					"warmup": map[string]any{"endpoints": 1, "timeout": "1s", "required": true},
+				},
+				"services": map[string]any{
+					"svc":   map[string]any{"warmup": map[string]any{"endpoints": 3}},
+					"other": map[string]any{},
+				},
+			},
+		},
+	})
+
+	resolved, err := Compile(root)
+	require.NoError(t, err)
+
+	require.Equal(
+		t,
+		client.WarmupSettings{Endpoints: 3},
+		resolved.Clients.Services["svc"].Warmup,
+	)
+	require.Equal(
+		t,
+		client.WarmupSettings{Endpoints: 1, Timeout: time.Second, Required: true},
+		resolved.Clients.Services["other"].Warmup,
+	)
+}
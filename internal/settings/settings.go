@@ -24,8 +24,10 @@ import (
 	"github.com/codesjoy/yggdrasil/v3/discovery/registry"
 	"github.com/codesjoy/yggdrasil/v3/discovery/resolver"
 	"github.com/codesjoy/yggdrasil/v3/internal/instance"
+	"github.com/codesjoy/yggdrasil/v3/observability/crashreport"
 	"github.com/codesjoy/yggdrasil/v3/observability/logger"
 	"github.com/codesjoy/yggdrasil/v3/observability/stats"
+	"github.com/codesjoy/yggdrasil/v3/rpc/interceptor"
 	"github.com/codesjoy/yggdrasil/v3/transport/gateway/rest"
 	grpcprotocol "github.com/codesjoy/yggdrasil/v3/transport/protocol/grpc"
 	rpchttp "github.com/codesjoy/yggdrasil/v3/transport/protocol/rpchttp"
@@ -120,12 +122,16 @@ type ClientDefaults struct {
 
 // clientServiceConfigOverlay keeps service-level override presence information.
 type clientServiceConfigOverlay struct {
-	FastFail     *bool                     `mapstructure:"fast_fail"`
-	Resolver     *string                   `mapstructure:"resolver"`
-	Balancer     *string                   `mapstructure:"balancer"`
-	Backoff      *backoffConfigOverlay     `mapstructure:"backoff"`
-	Remote       *remoteConfigOverlay      `mapstructure:"remote"`
-	Interceptors *interceptorConfigOverlay `mapstructure:"interceptors"`
+	FastFail     *bool                             `mapstructure:"fast_fail"`
+	Resolver     *string                           `mapstructure:"resolver"`
+	Balancer     *string                           `mapstructure:"balancer"`
+	Backoff      *backoffConfigOverlay             `mapstructure:"backoff"`
+	Remote       *remoteConfigOverlay              `mapstructure:"remote"`
+	Interceptors *interceptorConfigOverlay         `mapstructure:"interceptors"`
+	Methods      *map[string]client.MethodSettings `mapstructure:"methods"`
+	Routing      *client.RoutingSettings           `mapstructure:"routing"`
+	IdleTimeout  *time.Duration                    `mapstructure:"idle_timeout"`
+	Warmup       *client.WarmupSettings            `mapstructure:"warmup"`
 }
 
 // ClientServiceSpec contains one configured client service subtree.
@@ -154,8 +160,9 @@ type remoteConfigOverlay struct {
 }
 
 type interceptorConfigOverlay struct {
-	Unary  *[]string `mapstructure:"unary"`
-	Stream *[]string `mapstructure:"stream"`
+	Unary  *[]string                `mapstructure:"unary"`
+	Stream *[]string                `mapstructure:"stream"`
+	Rules  *[]interceptor.ChainRule `mapstructure:"rules"`
 }
 
 type grpcClientConfigOverlay struct {
@@ -167,6 +174,8 @@ type grpcClientConfigOverlay struct {
 	BackOffMaxDelay   *time.Duration                    `mapstructure:"back_off_max_delay"`
 	MinConnectTimeout *time.Duration                    `mapstructure:"min_connect_timeout"`
 	Network           *string                           `mapstructure:"network"`
+	ConnsPerEndpoint  *int                              `mapstructure:"conns_per_endpoint"`
+	Backoff           *backoffConfigOverlay             `mapstructure:"backoff"`
 	Transport         grpcClientTransportOptionsOverlay `mapstructure:"transport"`
 }
 
@@ -180,6 +189,7 @@ type grpcClientTransportOptionsOverlay struct {
 	WriteBufferSize       *int                         `mapstructure:"write_buffer_size"`
 	ReadBufferSize        *int                         `mapstructure:"read_buffer_size"`
 	MaxHeaderListSize     *uint32                      `mapstructure:"max_header_list_size"`
+	DynamicWindow         *bool                        `mapstructure:"dynamic_window"`
 }
 
 // Clients contains all client settings.
@@ -205,6 +215,8 @@ type Telemetry struct {
 	Tracer string         `mapstructure:"tracer"`
 	Meter  string         `mapstructure:"meter"`
 	Stats  stats.Settings `mapstructure:"stats"`
+	// CrashReport configures where recovered panics are reported.
+	CrashReport crashreport.Config `mapstructure:"crash_report"`
 }
 
 // Extensions contains chain-oriented extension references.
@@ -219,6 +231,8 @@ type ExtensionInterceptors struct {
 	StreamServer any `mapstructure:"stream_server"`
 	UnaryClient  any `mapstructure:"unary_client"`
 	StreamClient any `mapstructure:"stream_client"`
+	// Config holds per-interceptor configuration keyed by provider name.
+	Config map[string]map[string]any `mapstructure:"config"`
 }
 
 // ExtensionMiddleware contains explicit ordered lists or template references.
@@ -245,11 +259,18 @@ type Validation struct {
 	Enable bool `mapstructure:"enable"`
 }
 
+// Info contains instance info settings.
+type Info struct {
+	// Banner logs the instance info once the App starts.
+	Banner bool `mapstructure:"banner"`
+}
+
 // Admin contains framework admin settings.
 type Admin struct {
 	Application instance.Config `mapstructure:"application"`
 	Governor    governor.Config `mapstructure:"governor"`
 	Validation  Validation      `mapstructure:"validation"`
+	Info        Info            `mapstructure:"info"`
 }
 
 // Resolved contains normalized settings ready for module configuration.
@@ -357,6 +357,21 @@ func TestCompile_InitializesNilMaps(t *testing.T) {
 	require.NotNil(t, resolved.Transports.SecurityProfiles)
 }
 
+func TestCompile_ValidatesProtocolConfigs(t *testing.T) {
+	var root Root
+	root.Yggdrasil.Transports.GRPC.Server.MaxSendMessageSize = -1
+	root.Yggdrasil.Transports.HTTP.Rest = &rest.Config{Port: 70000}
+	root.Yggdrasil.Admin.Governor.ReadTimeout = -time.Second
+
+	_, err := Compile(root)
+	require.ErrorContains(t, err,
+		"invalid yggdrasil.transports.grpc.server: max_send_message_size: must not be negative")
+	require.ErrorContains(t, err,
+		"invalid yggdrasil.transports.http.rest: port: 70000 is out of range")
+	require.ErrorContains(t, err,
+		"invalid yggdrasil.admin.governor: read_timeout: must not be negative")
+}
+
 func TestCompile_ProducesOrderedExtensionsAndCapabilityBindings(t *testing.T) {
 	root := decodeRoot(t, map[string]any{
 		"yggdrasil": map[string]any{
@@ -570,7 +585,8 @@ func TestValidate_EnableNonStrictWarnsButDoesNotFail(t *testing.T) {
 				Marshaler: struct {
 					Support []string `mapstructure:"support"`
 					Config  struct {
-						JSONPB *marshaler.JSONPbConfig `mapstructure:"jsonpb"`
+						JSONPB   *marshaler.JSONPbConfig       `mapstructure:"jsonpb"`
+						Services []rest.ServiceMarshalerConfig `mapstructure:"services"`
 					} `mapstructure:"config"`
 				}{
 					Support: []string{"missing-marshaler"},
@@ -803,7 +819,8 @@ func TestValidate_StrictReturnsJoinedErrorsAndHandlesInvalidCredentialConfig(t *
 				Marshaler: struct {
 					Support []string `mapstructure:"support"`
 					Config  struct {
-						JSONPB *marshaler.JSONPbConfig `mapstructure:"jsonpb"`
+						JSONPB   *marshaler.JSONPbConfig       `mapstructure:"jsonpb"`
+						Services []rest.ServiceMarshalerConfig `mapstructure:"services"`
 					} `mapstructure:"config"`
 				}{
 					Support: []string{restMarshal},
@@ -930,6 +947,7 @@ func TestMergeGRPCClientConfigAndTransport(t *testing.T) {
 		BackOffMaxDelay:   ptr(6 * time.Second),
 		MinConnectTimeout: ptr(7 * time.Second),
 		Network:           ptr("unix"),
+		ConnsPerEndpoint:  ptr(4),
 		Transport: grpcClientTransportOptionsOverlay{
 			UserAgent:             ptr("overlay-ua"),
 			SecurityProfile:       ptr("overlay-creds"),
@@ -940,6 +958,7 @@ func TestMergeGRPCClientConfigAndTransport(t *testing.T) {
 			WriteBufferSize:       ptr(13),
 			ReadBufferSize:        ptr(14),
 			MaxHeaderListSize:     &overlayHeader,
+			DynamicWindow:         ptr(true),
 		},
 	}
 
@@ -952,6 +971,7 @@ func TestMergeGRPCClientConfigAndTransport(t *testing.T) {
 	require.Equal(t, 6*time.Second, merged.BackOffMaxDelay)
 	require.Equal(t, 7*time.Second, merged.MinConnectTimeout)
 	require.Equal(t, "unix", merged.Network)
+	require.Equal(t, 4, merged.ConnsPerEndpoint)
 	require.Equal(t, "overlay-ua", merged.Transport.UserAgent)
 	require.Equal(t, "overlay-creds", merged.Transport.SecurityProfile)
 	require.Equal(t, "overlay-auth", merged.Transport.Authority)
@@ -965,6 +985,26 @@ func TestMergeGRPCClientConfigAndTransport(t *testing.T) {
 	require.Equal(t, 13, merged.Transport.WriteBufferSize)
 	require.Equal(t, 14, merged.Transport.ReadBufferSize)
 	require.EqualValues(t, overlayHeader, *merged.Transport.MaxHeaderListSize)
+	require.True(t, *merged.Transport.DynamicWindow)
+}
+
+func TestMergeGRPCClientConfigBackoff(t *testing.T) {
+	merged := mergeGRPCClientConfig(grpcprotocol.ClientConfig{}, grpcClientConfigOverlay{
+		Backoff: &backoffConfigOverlay{MaxDelay: ptr(10 * time.Second)},
+	})
+	require.Equal(t, &backoff.Config{
+		BaseDelay:  time.Second,
+		Multiplier: 1.6,
+		Jitter:     0.2,
+		MaxDelay:   10 * time.Second,
+	}, merged.Backoff)
+
+	merged = mergeGRPCClientConfig(merged, grpcClientConfigOverlay{
+		Backoff: &backoffConfigOverlay{BaseDelay: ptr(100 * time.Millisecond)},
+	})
+	require.Equal(t, 100*time.Millisecond, merged.Backoff.BaseDelay)
+	require.Equal(t, 10*time.Second, merged.Backoff.MaxDelay)
+	require.Equal(t, merged, mergeGRPCClientConfig(merged, grpcClientConfigOverlay{}))
 }
 
 func TestCloneNestedMapAndDedupStrings(t *testing.T) {
@@ -0,0 +1,215 @@
+// Copyright 2022 The codesjoy Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package xclock
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// Fake is a Clock whose time only moves through Advance and Set. Timers,
+// tickers and sleepers fire synchronously, in deadline order, from the
+// goroutine advancing the clock; AfterFunc callbacks run there too.
+type Fake struct {
+	mu      sync.Mutex
+	now     time.Time
+	waiters []*fakeWaiter
+}
+
+type fakeWaiter struct {
+	clock    *Fake
+	deadline time.Time
+	period   time.Duration
+	ch       chan time.Time
+	fn       func()
+	active   bool
+}
+
+// NewFake returns a Fake set to now.
+func NewFake(now time.Time) *Fake {
+	return &Fake{now: now}
+}
+
+// Now returns the fake time.
+func (f *Fake) Now() time.Time {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.now
+}
+
+// Since returns the fake time elapsed since t.
+func (f *Fake) Since(t time.Time) time.Duration {
+	return f.Now().Sub(t)
+}
+
+// Sleep blocks until the clock is advanced by at least d.
+func (f *Fake) Sleep(d time.Duration) {
+	if d <= 0 {
+		return
+	}
+	<-f.NewTimer(d).C()
+}
+
+// NewTimer returns a timer firing once the clock reached now+d.
+func (f *Fake) NewTimer(d time.Duration) Timer {
+	return f.add(d, 0, make(chan time.Time, 1), nil)
+}
+
+// NewTicker returns a ticker firing every d of fake time.
+func (f *Fake) NewTicker(d time.Duration) Ticker {
+	if d <= 0 {
+		panic("xclock: non-positive interval for NewTicker")
+	}
+	return fakeTicker{f.add(d, d, make(chan time.Time, 1), nil)}
+}
+
+// AfterFunc calls fn once the clock reached now+d.
+func (f *Fake) AfterFunc(d time.Duration, fn func()) Timer {
+	return f.add(d, 0, nil, fn)
+}
+
+func (f *Fake) add(d, period time.Duration, ch chan time.Time, fn func()) *fakeWaiter {
+	f.mu.Lock()
+	w := &fakeWaiter{clock: f, period: period, ch: ch, fn: fn}
+	f.scheduleLocked(w, d)
+	f.mu.Unlock()
+	f.Advance(0)
+	return w
+}
+
+func (f *Fake) scheduleLocked(w *fakeWaiter, d time.Duration) {
+	w.deadline = f.now.Add(d)
+	if !w.active {
+		w.active = true
+		f.waiters = append(f.waiters, w)
+	}
+}
+
+func (f *Fake) removeLocked(w *fakeWaiter) bool {
+	if !w.active {
+		return false
+	}
+	w.active = false
+	for i, item := range f.waiters {
+		if item == w {
+			f.waiters = append(f.waiters[:i], f.waiters[i+1:]...)
+			break
+		}
+	}
+	return true
+}
+
+// Waiters returns the number of pending timers, tickers and sleepers. Tests
+// use it to wait until a component armed its timer before advancing.
+func (f *Fake) Waiters() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return len(f.waiters)
+}
+
+// Set moves the clock to t, firing what became due. Moving backwards fires
+// nothing.
+func (f *Fake) Set(t time.Time) {
+	f.mu.Lock()
+	d := t.Sub(f.now)
+	if d < 0 {
+		f.now = t
+		f.mu.Unlock()
+		return
+	}
+	f.mu.Unlock()
+	f.Advance(d)
+}
+
+// Advance moves the clock forward by d, firing what became due.
+func (f *Fake) Advance(d time.Duration) {
+	f.mu.Lock()
+	target := f.now.Add(d)
+	for {
+		next := f.nextDueLocked(target)
+		if next == nil {
+			break
+		}
+		f.now = next.deadline
+		if next.period > 0 {
+			next.deadline = next.deadline.Add(next.period)
+		} else {
+			f.removeLocked(next)
+		}
+		now := f.now
+		f.mu.Unlock()
+		next.fire(now)
+		f.mu.Lock()
+	}
+	f.now = target
+	f.mu.Unlock()
+}
+
+func (f *Fake) nextDueLocked(target time.Time) *fakeWaiter {
+	sort.SliceStable(f.waiters, func(i, j int) bool {
+		return f.waiters[i].deadline.Before(f.waiters[j].deadline)
+	})
+	if len(f.waiters) == 0 || f.waiters[0].deadline.After(target) {
+		return nil
+	}
+	return f.waiters[0]
+}
+
+func (w *fakeWaiter) fire(now time.Time) {
+	if w.fn != nil {
+		w.fn()
+		return
+	}
+	// Like time.Ticker, a slow receiver drops ticks.
+	select {
+	case w.ch <- now:
+	default:
+	}
+}
+
+func (w *fakeWaiter) C() <-chan time.Time {
+	return w.ch
+}
+
+func (w *fakeWaiter) Stop() bool {
+	w.clock.mu.Lock()
+	defer w.clock.mu.Unlock()
+	return w.clock.removeLocked(w)
+}
+
+func (w *fakeWaiter) Reset(d time.Duration) bool {
+	w.clock.mu.Lock()
+	active := w.active
+	w.clock.scheduleLocked(w, d)
+	w.clock.mu.Unlock()
+	w.clock.Advance(0)
+	return active
+}
+
+type fakeTicker struct{ w *fakeWaiter }
+
+func (t fakeTicker) C() <-chan time.Time { return t.w.ch }
+func (t fakeTicker) Stop()               { t.w.Stop() }
+
+func (t fakeTicker) Reset(d time.Duration) {
+	if d <= 0 {
+		panic("xclock: non-positive interval for Ticker.Reset")
+	}
+	t.w.clock.mu.Lock()
+	t.w.period = d
+	t.w.clock.mu.Unlock()
+	t.w.Reset(d)
+}
@@ -0,0 +1,131 @@
+// Copyright 2022 The codesjoy Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package xclock
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var epoch = time.Unix(1000, 0)
+
+func received(ch <-chan time.Time) (time.Time, bool) {
+	select {
+	case t := <-ch:
+		return t, true
+	default:
+		return time.Time{}, false
+	}
+}
+
+func TestFakeTimer(t *testing.T) {
+	c := NewFake(epoch)
+	timer := c.NewTimer(time.Second)
+	assert.Equal(t, 1, c.Waiters())
+
+	c.Advance(999 * time.Millisecond)
+	_, ok := received(timer.C())
+	assert.False(t, ok)
+
+	c.Advance(time.Millisecond)
+	at, ok := received(timer.C())
+	require.True(t, ok)
+	assert.Equal(t, epoch.Add(time.Second), at)
+	assert.Zero(t, c.Waiters())
+	assert.False(t, timer.Stop())
+
+	assert.False(t, timer.Reset(time.Second))
+	assert.True(t, timer.Stop())
+	c.Advance(time.Hour)
+	_, ok = received(timer.C())
+	assert.False(t, ok)
+}
+
+func TestFakeTicker(t *testing.T) {
+	c := NewFake(epoch)
+	ticker := c.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	c.Advance(time.Second)
+	at, ok := received(ticker.C())
+	require.True(t, ok)
+	assert.Equal(t, epoch.Add(time.Second), at)
+
+	c.Advance(3 * time.Second)
+	_, ok = received(ticker.C())
+	assert.True(t, ok)
+	_, ok = received(ticker.C())
+	assert.False(t, ok, "ticks to a slow receiver are dropped")
+
+	ticker.Reset(time.Minute)
+	c.Advance(time.Second)
+	_, ok = received(ticker.C())
+	assert.False(t, ok)
+	c.Advance(time.Minute)
+	_, ok = received(ticker.C())
+	assert.True(t, ok)
+}
+
+func TestFakeAfterFuncOrder(t *testing.T) {
+	c := NewFake(epoch)
+	var fired []time.Duration
+	for _, d := range []time.Duration{3 * time.Second, time.Second, 2 * time.Second} {
+		c.AfterFunc(d, func() {
+			fired = append(fired, c.Since(epoch))
+		})
+	}
+	c.Set(epoch.Add(time.Minute))
+	assert.Equal(t, []time.Duration{time.Second, 2 * time.Second, 3 * time.Second}, fired)
+	assert.Equal(t, epoch.Add(time.Minute), c.Now())
+}
+
+func TestFakeAfterFuncReschedules(t *testing.T) {
+	c := NewFake(epoch)
+	calls := 0
+	var retry func()
+	retry = func() {
+		calls++
+		c.AfterFunc(time.Second, retry)
+	}
+	c.AfterFunc(time.Second, retry)
+	c.Advance(3 * time.Second)
+	assert.Equal(t, 3, calls)
+}
+
+func TestFakeSleep(t *testing.T) {
+	c := NewFake(epoch)
+	done := make(chan struct{})
+	go func() {
+		c.Sleep(time.Second)
+		close(done)
+	}()
+	require.Eventually(t, func() bool { return c.Waiters() == 1 }, time.Second, time.Millisecond)
+	select {
+	case <-done:
+		t.Fatal("sleep returned before the clock advanced")
+	default:
+	}
+	c.Advance(time.Second)
+	<-done
+}
+
+func TestOrReal(t *testing.T) {
+	fake := NewFake(epoch)
+	assert.Same(t, fake, OrReal(fake))
+	assert.Equal(t, Real(), OrReal(nil))
+}
@@ -0,0 +1,98 @@
+// Copyright 2022 The codesjoy Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package xpool
+
+import (
+	"context"
+	"sync"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+var (
+	metricsOnce sync.Once
+	pools       = struct {
+		sync.RWMutex
+		items map[*Pool]struct{}
+	}{items: map[*Pool]struct{}{}}
+)
+
+func register(p *Pool) {
+	pools.Lock()
+	pools.items[p] = struct{}{}
+	pools.Unlock()
+	metricsOnce.Do(func() {
+		if err := registerPoolMetrics(otel.GetMeterProvider()); err != nil {
+			otel.Handle(err)
+		}
+	})
+}
+
+func unregister(p *Pool) {
+	pools.Lock()
+	delete(pools.items, p)
+	pools.Unlock()
+}
+
+// registerPoolMetrics reports the Stats of every open pool through provider.
+func registerPoolMetrics(provider metric.MeterProvider) error {
+	meter := provider.Meter("github.com/codesjoy/yggdrasil/v3",
+		metric.WithInstrumentationVersion("yggdrasil"),
+	)
+	workers, err := meter.Int64ObservableUpDownCounter("yggdrasil.pool.workers",
+		metric.WithDescription("Number of pool workers by state."),
+		metric.WithUnit("{worker}"))
+	if err != nil {
+		return err
+	}
+	queued, err := meter.Int64ObservableUpDownCounter("yggdrasil.pool.queued",
+		metric.WithDescription("Number of tasks waiting for a worker."),
+		metric.WithUnit("{task}"))
+	if err != nil {
+		return err
+	}
+	tasks, err := meter.Int64ObservableCounter("yggdrasil.pool.tasks",
+		metric.WithDescription("Number of tasks by outcome."),
+		metric.WithUnit("{task}"))
+	if err != nil {
+		return err
+	}
+
+	_, err = meter.RegisterCallback(func(_ context.Context, o metric.Observer) error {
+		pools.RLock()
+		defer pools.RUnlock()
+		for p := range pools.items {
+			stats := p.Stats()
+			pool := attribute.String("yggdrasil.pool.name", p.Name())
+			o.ObserveInt64(workers, int64(stats.Running), metric.WithAttributes(
+				pool, attribute.String("yggdrasil.pool.worker.state", "running")))
+			o.ObserveInt64(workers, int64(stats.Workers-stats.Running), metric.WithAttributes(
+				pool, attribute.String("yggdrasil.pool.worker.state", "available")))
+			o.ObserveInt64(queued, int64(stats.Queued), metric.WithAttributes(pool))
+			for outcome, n := range map[string]uint64{
+				"completed": stats.Completed,
+				"rejected":  stats.Rejected,
+				"panicked":  stats.Panics,
+			} {
+				o.ObserveInt64(tasks, int64(n), metric.WithAttributes(
+					pool, attribute.String("outcome", outcome)))
+			}
+		}
+		return nil
+	}, workers, queued, tasks)
+	return err
+}
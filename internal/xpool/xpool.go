@@ -0,0 +1,310 @@
+// Copyright 2022 The codesjoy Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package xpool provides a goroutine pool with a bounded queue.
+//
+// A Pool runs at most Workers tasks at once, on its own workers or, with
+// Run, on the goroutines of the callers. Further tasks wait in a FIFO
+// queue of at most QueueSize entries and are rejected with ErrFull beyond
+// that, which puts a ceiling on the goroutines spawned under load. Workers
+// are started on demand and exit once the queue is drained. Panics of tasks
+// are recovered, logged and sent to the crash reporter.
+package xpool
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"runtime/debug"
+	"sync"
+	"sync/atomic"
+
+	"github.com/codesjoy/yggdrasil/v3/observability/crashreport"
+)
+
+var (
+	// ErrFull is returned when every worker is busy and the queue is full.
+	ErrFull = errors.New("xpool: queue is full")
+	// ErrClosed is returned for tasks submitted after Close.
+	ErrClosed = errors.New("xpool: pool is closed")
+	// ErrPanicked is returned by Do when the task panicked.
+	ErrPanicked = errors.New("xpool: task panicked")
+)
+
+// Config defines the pool size.
+type Config struct {
+	// Workers bounds the tasks running at once. Zero or less disables the
+	// pool for its users, see Enabled.
+	Workers int `mapstructure:"workers"`
+	// QueueSize bounds the tasks waiting for a worker.
+	QueueSize int `mapstructure:"queue_size" default:"1024"`
+}
+
+// Enabled reports whether the config bounds concurrency.
+func (c Config) Enabled() bool {
+	return c.Workers > 0
+}
+
+// Stats is a point-in-time view of a pool.
+type Stats struct {
+	Workers   int    `json:"workers"`
+	Running   int    `json:"running"`
+	Queued    int    `json:"queued"`
+	QueueSize int    `json:"queue_size"`
+	Completed uint64 `json:"completed"`
+	Rejected  uint64 `json:"rejected"`
+	Panics    uint64 `json:"panics"`
+}
+
+const (
+	taskQueued int32 = iota
+	taskStarted
+	taskCanceled
+)
+
+type task struct {
+	ctx context.Context
+	// fn is nil for a Run caller waiting for a worker slot.
+	fn    func()
+	state atomic.Int32
+	done  chan struct{}
+	// panicked is set before done is closed.
+	panicked bool
+}
+
+// Pool is a bounded goroutine pool. It is safe for concurrent use.
+type Pool struct {
+	name string
+
+	mu        sync.Mutex
+	workers   int
+	queueSize int
+	running   int
+	queue     []*task
+	closed    bool
+
+	completed atomic.Uint64
+	rejected  atomic.Uint64
+	panics    atomic.Uint64
+}
+
+// New creates a pool. name identifies the pool in logs, crash reports and
+// metrics. A Workers value below one is treated as one.
+func New(name string, cfg Config) *Pool {
+	p := &Pool{name: name}
+	p.setSize(cfg)
+	register(p)
+	return p
+}
+
+// Name returns the pool name.
+func (p *Pool) Name() string {
+	return p.name
+}
+
+// Submit runs fn on a pool worker without waiting for it.
+func (p *Pool) Submit(fn func()) error {
+	return p.submit(&task{ctx: context.Background(), fn: fn})
+}
+
+// Do runs fn on a pool worker and waits until it returns. When ctx is done
+// before a worker picked fn up, fn is dropped and the context error returned;
+// once started, fn always runs to completion. A recovered panic of fn is
+// reported as ErrPanicked.
+func (p *Pool) Do(ctx context.Context, fn func()) error {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	t := &task{ctx: ctx, fn: fn, done: make(chan struct{})}
+	if err := p.submit(t); err != nil {
+		return err
+	}
+	select {
+	case <-t.done:
+	case <-ctx.Done():
+		if t.state.CompareAndSwap(taskQueued, taskCanceled) {
+			return ctx.Err()
+		}
+		<-t.done
+	}
+	if t.panicked {
+		return ErrPanicked
+	}
+	return nil
+}
+
+// Run runs fn on the calling goroutine once a worker slot is free, so it
+// limits concurrency like Do without handing fn to another goroutine. Queueing,
+// cancellation and panics are handled as by Do.
+func (p *Pool) Run(ctx context.Context, fn func()) error {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	t := &task{ctx: ctx, done: make(chan struct{})}
+	if err := p.submit(t); err != nil {
+		return err
+	}
+	select {
+	case <-t.done:
+	case <-ctx.Done():
+		if t.state.CompareAndSwap(taskQueued, taskCanceled) {
+			return ctx.Err()
+		}
+		// The slot was granted concurrently.
+		<-t.done
+	}
+	t.fn, t.done = fn, nil
+	p.run(t)
+	if next := p.next(); next != nil {
+		go p.worker(next)
+	}
+	if t.panicked {
+		return ErrPanicked
+	}
+	return nil
+}
+
+func (p *Pool) submit(t *task) error {
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return ErrClosed
+	}
+	if p.running < p.workers {
+		p.running++
+		p.mu.Unlock()
+		t.state.Store(taskStarted)
+		p.start(t)
+		return nil
+	}
+	if len(p.queue) >= p.queueSize {
+		p.mu.Unlock()
+		p.rejected.Add(1)
+		return ErrFull
+	}
+	p.queue = append(p.queue, t)
+	p.mu.Unlock()
+	return nil
+}
+
+// start hands the worker slot taken for t to it: a Run caller is woken up,
+// any other task gets a worker goroutine.
+func (p *Pool) start(t *task) {
+	if t.fn == nil {
+		close(t.done)
+		return
+	}
+	go p.worker(t)
+}
+
+func (p *Pool) worker(t *task) {
+	for t != nil {
+		p.run(t)
+		t = p.next()
+	}
+}
+
+// next passes the worker slot of a finished task on. It returns the next
+// queued task for the current worker, or nil once the slot was handed to a
+// Run caller or released.
+func (p *Pool) next() *task {
+	for {
+		p.mu.Lock()
+		if len(p.queue) == 0 || p.running > p.workers {
+			p.running--
+			p.mu.Unlock()
+			return nil
+		}
+		t := p.queue[0]
+		p.queue[0] = nil
+		p.queue = p.queue[1:]
+		p.mu.Unlock()
+		if !t.state.CompareAndSwap(taskQueued, taskStarted) {
+			continue
+		}
+		if t.fn == nil {
+			close(t.done)
+			return nil
+		}
+		return t
+	}
+}
+
+func (p *Pool) run(t *task) {
+	defer func() {
+		if r := recover(); r != nil {
+			p.panics.Add(1)
+			stack := debug.Stack()
+			slog.Error(
+				"pool task panicked",
+				slog.String("pool", p.name),
+				slog.Any("panic", r),
+				slog.String("stack", string(stack)),
+			)
+			crashreport.Recovered(t.ctx, crashreport.SourcePool, p.name, r, stack)
+			t.panicked = true
+		}
+		p.completed.Add(1)
+		if t.done != nil {
+			close(t.done)
+		}
+	}()
+	t.fn()
+}
+
+// Resize applies a new size. Growing starts workers for the queued tasks
+// right away; shrinking lets the surplus workers exit after their current
+// task. Queued tasks beyond a smaller QueueSize are kept.
+func (p *Pool) Resize(cfg Config) {
+	p.mu.Lock()
+	p.setSize(cfg)
+	grow := min(p.workers-p.running, len(p.queue))
+	p.running += max(grow, 0)
+	p.mu.Unlock()
+	// Each new slot picks up a queued task like a finishing worker would.
+	for range grow {
+		if t := p.next(); t != nil {
+			go p.worker(t)
+		}
+	}
+}
+
+func (p *Pool) setSize(cfg Config) {
+	p.workers = max(cfg.Workers, 1)
+	p.queueSize = max(cfg.QueueSize, 0)
+}
+
+// Stats returns the current pool statistics.
+func (p *Pool) Stats() Stats {
+	p.mu.Lock()
+	stats := Stats{
+		Workers:   p.workers,
+		Running:   p.running,
+		Queued:    len(p.queue),
+		QueueSize: p.queueSize,
+	}
+	p.mu.Unlock()
+	stats.Completed = p.completed.Load()
+	stats.Rejected = p.rejected.Load()
+	stats.Panics = p.panics.Load()
+	return stats
+}
+
+// Close rejects new tasks. Running and queued tasks still complete.
+func (p *Pool) Close() {
+	p.mu.Lock()
+	p.closed = true
+	p.mu.Unlock()
+	unregister(p)
+}
@@ -0,0 +1,170 @@
+// Copyright 2022 The codesjoy Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package xpool
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/codesjoy/yggdrasil/v3/observability/crashreport"
+)
+
+// blockWorkers occupies every worker of p until the returned func is called.
+func blockWorkers(t *testing.T, p *Pool, n int) func() {
+	t.Helper()
+	release := make(chan struct{})
+	var started sync.WaitGroup
+	started.Add(n)
+	for i := 0; i < n; i++ {
+		require.NoError(t, p.Submit(func() {
+			started.Done()
+			<-release
+		}))
+	}
+	started.Wait()
+	return func() { close(release) }
+}
+
+func TestPoolBoundsConcurrencyAndQueue(t *testing.T) {
+	p := New("test", Config{Workers: 2, QueueSize: 1})
+	defer p.Close()
+
+	release := blockWorkers(t, p, 2)
+	var ran atomic.Int32
+	require.NoError(t, p.Submit(func() { ran.Add(1) }))
+	require.ErrorIs(t, p.Submit(func() { ran.Add(1) }), ErrFull)
+
+	stats := p.Stats()
+	require.Equal(t, 2, stats.Running)
+	require.Equal(t, 1, stats.Queued)
+	require.EqualValues(t, 1, stats.Rejected)
+
+	release()
+	require.Eventually(t, func() bool {
+		return p.Stats().Running == 0
+	}, time.Second, time.Millisecond)
+	require.EqualValues(t, 1, ran.Load())
+	require.EqualValues(t, 3, p.Stats().Completed)
+}
+
+func TestPoolDoWaitsAndHonorsContext(t *testing.T) {
+	p := New("test", Config{Workers: 1, QueueSize: 1})
+	defer p.Close()
+
+	var ran bool
+	require.NoError(t, p.Do(context.Background(), func() { ran = true }))
+	require.True(t, ran)
+
+	release := blockWorkers(t, p, 1)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	var dropped atomic.Bool
+	err := p.Do(ctx, func() { dropped.Store(true) })
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+
+	release()
+	require.Eventually(t, func() bool {
+		return p.Stats().Running == 0
+	}, time.Second, time.Millisecond)
+	require.False(t, dropped.Load())
+}
+
+func TestPoolRunSharesSlotsWithWorkers(t *testing.T) {
+	p := New("test", Config{Workers: 1, QueueSize: 2})
+	defer p.Close()
+
+	release := blockWorkers(t, p, 1)
+	ran := make(chan error, 1)
+	var running atomic.Int32
+	go func() {
+		ran <- p.Run(context.Background(), func() {
+			running.Store(int32(p.Stats().Running))
+		})
+	}()
+	require.Eventually(t, func() bool {
+		return p.Stats().Queued == 1
+	}, time.Second, time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	require.ErrorIs(t, p.Run(ctx, func() { t.Error("dropped call ran") }), context.DeadlineExceeded)
+
+	release()
+	require.NoError(t, <-ran)
+	require.EqualValues(t, 1, running.Load())
+	require.Eventually(t, func() bool {
+		return p.Stats().Running == 0
+	}, time.Second, time.Millisecond)
+	require.EqualValues(t, 2, p.Stats().Completed)
+
+	require.ErrorIs(t, p.Run(context.Background(), func() { panic("boom") }), ErrPanicked)
+	require.Zero(t, p.Stats().Running)
+}
+
+func TestPoolResize(t *testing.T) {
+	p := New("test", Config{Workers: 1, QueueSize: 4})
+	defer p.Close()
+
+	release := blockWorkers(t, p, 1)
+	defer release()
+	var started sync.WaitGroup
+	started.Add(2)
+	for i := 0; i < 2; i++ {
+		require.NoError(t, p.Submit(func() {
+			started.Done()
+		}))
+	}
+	require.Equal(t, 2, p.Stats().Queued)
+
+	p.Resize(Config{Workers: 3, QueueSize: 4})
+	started.Wait()
+	require.Equal(t, 3, p.Stats().Workers)
+	require.Zero(t, p.Stats().Queued)
+}
+
+func TestPoolRecoversPanics(t *testing.T) {
+	reports := make(chan *crashreport.Report, 1)
+	prev := crashreport.SetReporter(crashreport.ReporterFunc(
+		func(_ context.Context, report *crashreport.Report) { reports <- report },
+	))
+	defer crashreport.SetReporter(prev)
+
+	p := New("panicky", Config{Workers: 1})
+	defer p.Close()
+	require.ErrorIs(t, p.Do(context.Background(), func() { panic("boom") }), ErrPanicked)
+
+	report := <-reports
+	require.Equal(t, crashreport.SourcePool, report.Source)
+	require.Equal(t, "panicky", report.Name)
+	require.Equal(t, "boom", report.Panic)
+	require.EqualValues(t, 1, p.Stats().Panics)
+
+	var ran bool
+	require.NoError(t, p.Do(context.Background(), func() { ran = true }))
+	require.True(t, ran)
+}
+
+func TestPoolClose(t *testing.T) {
+	p := New("test", Config{Workers: 1})
+	p.Close()
+	require.ErrorIs(t, p.Submit(func() {}), ErrClosed)
+	require.ErrorIs(t, p.Do(context.Background(), func() {}), ErrClosed)
+	require.ErrorIs(t, p.Run(context.Background(), func() {}), ErrClosed)
+}
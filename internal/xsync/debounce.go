@@ -0,0 +1,95 @@
+// Copyright 2022 The codesjoy Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package xsync
+
+import (
+	"sync"
+	"time"
+)
+
+// Debouncer coalesces bursts of Trigger calls into one call of fn, made once
+// no Trigger arrived for wait. A positive maxWait bounds the delay from the
+// first Trigger of a burst, so a steady stream of triggers still runs fn at
+// least that often.
+//
+// fn runs on its own goroutine; a Trigger arriving while fn runs schedules
+// another call, which may overlap with the running one.
+type Debouncer struct {
+	wait    time.Duration
+	maxWait time.Duration
+	fn      func()
+
+	mu      sync.Mutex
+	timer   *time.Timer
+	gen     uint64
+	first   time.Time
+	stopped bool
+}
+
+// NewDebouncer returns a Debouncer calling fn.
+func NewDebouncer(wait, maxWait time.Duration, fn func()) *Debouncer {
+	return &Debouncer{wait: wait, maxWait: maxWait, fn: fn}
+}
+
+// NewThrottle returns a Debouncer that calls fn at most once per interval,
+// interval after the first Trigger of a burst.
+func NewThrottle(interval time.Duration, fn func()) *Debouncer {
+	return NewDebouncer(interval, interval, fn)
+}
+
+// Trigger schedules a call of fn.
+func (d *Debouncer) Trigger() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.stopped {
+		return
+	}
+	now := time.Now()
+	if d.timer == nil {
+		d.first = now
+	} else {
+		d.timer.Stop()
+	}
+	delay := d.wait
+	if d.maxWait > 0 {
+		delay = min(delay, d.first.Add(d.maxWait).Sub(now))
+	}
+	d.gen++
+	gen := d.gen
+	d.timer = time.AfterFunc(max(delay, 0), func() { d.fire(gen) })
+}
+
+func (d *Debouncer) fire(gen uint64) {
+	d.mu.Lock()
+	if d.stopped || gen != d.gen {
+		d.mu.Unlock()
+		return
+	}
+	d.timer = nil
+	d.mu.Unlock()
+	d.fn()
+}
+
+// Stop drops the pending call and ignores later triggers. It does not wait
+// for a running call of fn.
+func (d *Debouncer) Stop() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.stopped = true
+	if d.timer != nil {
+		d.timer.Stop()
+		d.timer = nil
+	}
+}
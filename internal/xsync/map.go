@@ -0,0 +1,82 @@
+// Copyright 2022 The codesjoy Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package xsync provides type-safe concurrency helpers: a generic
+// concurrent Map, a singleflight Group and a Debouncer.
+package xsync
+
+import "sync"
+
+// Map is a type-safe sync.Map. The zero value is empty and ready for use.
+type Map[K comparable, V any] struct {
+	m sync.Map
+}
+
+// Load returns the value stored for key.
+func (m *Map[K, V]) Load(key K) (value V, ok bool) {
+	v, ok := m.m.Load(key)
+	if !ok {
+		return value, false
+	}
+	return v.(V), true
+}
+
+// Store sets the value for key.
+func (m *Map[K, V]) Store(key K, value V) {
+	m.m.Store(key, value)
+}
+
+// LoadOrStore returns the existing value for key if present. Otherwise it
+// stores and returns value. loaded reports whether the value was present.
+func (m *Map[K, V]) LoadOrStore(key K, value V) (actual V, loaded bool) {
+	v, loaded := m.m.LoadOrStore(key, value)
+	return v.(V), loaded
+}
+
+// LoadAndDelete deletes the value for key, returning the previous value.
+func (m *Map[K, V]) LoadAndDelete(key K) (value V, loaded bool) {
+	v, loaded := m.m.LoadAndDelete(key)
+	if !loaded {
+		return value, false
+	}
+	return v.(V), true
+}
+
+// Delete deletes the value for key.
+func (m *Map[K, V]) Delete(key K) {
+	m.m.Delete(key)
+}
+
+// Range calls fn for every entry until fn returns false. See sync.Map.Range.
+func (m *Map[K, V]) Range(fn func(key K, value V) bool) {
+	m.m.Range(func(k, v any) bool {
+		return fn(k.(K), v.(V))
+	})
+}
+
+// Len returns the number of entries. It walks the map and is meant for
+// diagnostics, not hot paths.
+func (m *Map[K, V]) Len() int {
+	n := 0
+	m.m.Range(func(any, any) bool {
+		n++
+		return true
+	})
+	return n
+}
+
+// Clear deletes every entry.
+func (m *Map[K, V]) Clear() {
+	m.m.Clear()
+}
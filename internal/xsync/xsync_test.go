@@ -0,0 +1,198 @@
+// Copyright 2022 The codesjoy Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package xsync
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMap(t *testing.T) {
+	var m Map[string, int]
+	_, ok := m.Load("a")
+	require.False(t, ok)
+
+	m.Store("a", 1)
+	v, loaded := m.LoadOrStore("a", 2)
+	require.True(t, loaded)
+	require.Equal(t, 1, v)
+	v, loaded = m.LoadOrStore("b", 2)
+	require.False(t, loaded)
+	require.Equal(t, 2, v)
+	require.Equal(t, 2, m.Len())
+
+	sum := 0
+	m.Range(func(_ string, value int) bool {
+		sum += value
+		return true
+	})
+	require.Equal(t, 3, sum)
+
+	v, loaded = m.LoadAndDelete("a")
+	require.True(t, loaded)
+	require.Equal(t, 1, v)
+	_, loaded = m.LoadAndDelete("a")
+	require.False(t, loaded)
+
+	m.Delete("b")
+	m.Store("c", 3)
+	m.Clear()
+	require.Zero(t, m.Len())
+}
+
+func TestGroupDeduplicatesConcurrentCalls(t *testing.T) {
+	var g Group[string, int]
+	var calls atomic.Int32
+	release := make(chan struct{})
+	entered := make(chan struct{})
+
+	const n = 8
+	results := make(chan int, n)
+	var wg sync.WaitGroup
+	wg.Add(n)
+	go func() {
+		defer wg.Done()
+		v, _, _ := g.Do("k", func() (int, error) {
+			calls.Add(1)
+			close(entered)
+			<-release
+			return 42, nil
+		})
+		results <- v
+	}()
+	<-entered
+	for i := 1; i < n; i++ {
+		go func() {
+			defer wg.Done()
+			v, err, shared := g.Do("k", func() (int, error) {
+				calls.Add(1)
+				return 0, nil
+			})
+			require.NoError(t, err)
+			require.True(t, shared)
+			results <- v
+		}()
+	}
+	require.Eventually(t, func() bool {
+		g.mu.Lock()
+		defer g.mu.Unlock()
+		return g.calls["k"].dups == n-1
+	}, time.Second, time.Millisecond)
+	close(release)
+	wg.Wait()
+	close(results)
+
+	require.EqualValues(t, 1, calls.Load())
+	for v := range results {
+		require.Equal(t, 42, v)
+	}
+
+	v, err, shared := g.Do("k", func() (int, error) { return 7, errors.New("boom") })
+	require.EqualError(t, err, "boom")
+	require.False(t, shared)
+	require.Equal(t, 7, v)
+}
+
+func TestGroupPanicReleasesWaiters(t *testing.T) {
+	var g Group[string, int]
+	entered := make(chan struct{})
+	release := make(chan struct{})
+	done := make(chan error, 1)
+
+	go func() {
+		defer func() { _ = recover() }()
+		_, _, _ = g.Do("k", func() (int, error) {
+			close(entered)
+			<-release
+			panic("boom")
+		})
+	}()
+	<-entered
+	go func() {
+		_, err, _ := g.Do("k", func() (int, error) { return 1, nil })
+		done <- err
+	}()
+	require.Eventually(t, func() bool {
+		g.mu.Lock()
+		defer g.mu.Unlock()
+		c, ok := g.calls["k"]
+		return ok && c.dups == 1
+	}, time.Second, time.Millisecond)
+	close(release)
+	require.ErrorIs(t, <-done, ErrCallPanicked)
+}
+
+func TestGroupForget(t *testing.T) {
+	var g Group[string, int]
+	entered := make(chan struct{})
+	release := make(chan struct{})
+	go func() {
+		_, _, _ = g.Do("k", func() (int, error) {
+			close(entered)
+			<-release
+			return 1, nil
+		})
+	}()
+	<-entered
+	g.Forget("k")
+	v, _, shared := g.Do("k", func() (int, error) { return 2, nil })
+	require.Equal(t, 2, v)
+	require.False(t, shared)
+	close(release)
+}
+
+func TestDebouncerCoalescesBursts(t *testing.T) {
+	var calls atomic.Int32
+	d := NewDebouncer(20*time.Millisecond, 0, func() { calls.Add(1) })
+	defer d.Stop()
+
+	for i := 0; i < 5; i++ {
+		d.Trigger()
+	}
+	require.Eventually(t, func() bool { return calls.Load() == 1 }, time.Second, time.Millisecond)
+	time.Sleep(40 * time.Millisecond)
+	require.EqualValues(t, 1, calls.Load())
+
+	d.Trigger()
+	require.Eventually(t, func() bool { return calls.Load() == 2 }, time.Second, time.Millisecond)
+}
+
+func TestDebouncerMaxWait(t *testing.T) {
+	var calls atomic.Int32
+	d := NewDebouncer(50*time.Millisecond, 60*time.Millisecond, func() { calls.Add(1) })
+	defer d.Stop()
+
+	deadline := time.Now().Add(200 * time.Millisecond)
+	for time.Now().Before(deadline) {
+		d.Trigger()
+		time.Sleep(5 * time.Millisecond)
+	}
+	require.GreaterOrEqual(t, calls.Load(), int32(2))
+}
+
+func TestDebouncerStop(t *testing.T) {
+	var calls atomic.Int32
+	d := NewThrottle(10*time.Millisecond, func() { calls.Add(1) })
+	d.Trigger()
+	d.Stop()
+	d.Trigger()
+	time.Sleep(30 * time.Millisecond)
+	require.Zero(t, calls.Load())
+}
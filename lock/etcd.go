@@ -0,0 +1,92 @@
+// Copyright 2022 The codesjoy Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package lock
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// EtcdClient is the subset of etcd operations used by the etcd store.
+// LockClient in contrib/etcd implements it over the etcd v3 client.
+type EtcdClient interface {
+	// Grant creates a lease expiring after ttl and returns its id.
+	Grant(ctx context.Context, ttl time.Duration) (int64, error)
+	// KeepAliveOnce renews lease. It reports false when the lease no longer
+	// exists.
+	KeepAliveOnce(ctx context.Context, lease int64) (bool, error)
+	// Revoke revokes lease, deleting the keys attached to it.
+	Revoke(ctx context.Context, lease int64) error
+	// CreateIfAbsent puts key attached to lease if key does not exist and
+	// reports whether it did.
+	CreateIfAbsent(ctx context.Context, key, value string, lease int64) (bool, error)
+}
+
+type etcdStore struct {
+	client EtcdClient
+	prefix string
+
+	mu     sync.Mutex
+	leases map[string]int64
+}
+
+// NewEtcdStore returns a store that keeps locks in etcd under prefix. Each
+// lock is attached to its own lease, so it disappears when its holder stops
+// renewing it. etcd rounds lease ttls up to whole seconds.
+func NewEtcdStore(client EtcdClient, prefix string) Store {
+	return &etcdStore{client: client, prefix: prefix, leases: map[string]int64{}}
+}
+
+func (s *etcdStore) Acquire(
+	ctx context.Context,
+	key, token string,
+	ttl time.Duration,
+) (bool, error) {
+	lease, err := s.client.Grant(ctx, ttl)
+	if err != nil {
+		return false, err
+	}
+	ok, err := s.client.CreateIfAbsent(ctx, s.prefix+key, token, lease)
+	if err != nil || !ok {
+		_ = s.client.Revoke(context.WithoutCancel(ctx), lease)
+		return false, err
+	}
+	s.mu.Lock()
+	s.leases[token] = lease
+	s.mu.Unlock()
+	return true, nil
+}
+
+func (s *etcdStore) Refresh(ctx context.Context, _, token string, _ time.Duration) (bool, error) {
+	s.mu.Lock()
+	lease, ok := s.leases[token]
+	s.mu.Unlock()
+	if !ok {
+		return false, nil
+	}
+	return s.client.KeepAliveOnce(ctx, lease)
+}
+
+func (s *etcdStore) Release(ctx context.Context, _, token string) error {
+	s.mu.Lock()
+	lease, ok := s.leases[token]
+	delete(s.leases, token)
+	s.mu.Unlock()
+	if !ok {
+		return nil
+	}
+	return s.client.Revoke(ctx, lease)
+}
@@ -0,0 +1,195 @@
+// Copyright 2022 The codesjoy Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package lock
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ElectorOption configures a LeaderElector.
+type ElectorOption func(*LeaderElector)
+
+// WithLeaseTTL sets how long leadership survives a leader that stopped
+// renewing it. The default is 15s.
+func WithLeaseTTL(ttl time.Duration) ElectorOption {
+	return func(e *LeaderElector) {
+		if ttl > 0 {
+			e.ttl = ttl
+		}
+	}
+}
+
+// WithCampaignInterval sets the pause before campaigning again after losing
+// or giving up leadership. The default is 1s.
+func WithCampaignInterval(interval time.Duration) ElectorOption {
+	return func(e *LeaderElector) {
+		if interval > 0 {
+			e.interval = interval
+		}
+	}
+}
+
+// LeaderElector runs a callback on the single replica holding a lock. It
+// implements the application worker contract, so it can be registered with
+// app.WithWorker and stops with the application.
+type LeaderElector struct {
+	locker   Locker
+	key      string
+	fn       func(ctx context.Context) error
+	ttl      time.Duration
+	interval time.Duration
+
+	leader atomic.Bool
+
+	mu      sync.Mutex
+	cancel  context.CancelFunc
+	stopped bool
+	done    chan struct{}
+}
+
+// LeaderElector satisfies app.Runnable, spelled out to avoid importing app.
+var _ interface {
+	Run(ctx context.Context) error
+	Stop(ctx context.Context) error
+} = (*LeaderElector)(nil)
+
+// NewLeaderElector returns an elector campaigning for key. fn runs while this
+// replica leads; its context is canceled when leadership is lost or the
+// elector stops. fn is expected to block for as long as it leads: when it
+// returns, leadership is given up and the elector campaigns again.
+func NewLeaderElector(
+	locker Locker,
+	key string,
+	fn func(ctx context.Context) error,
+	opts ...ElectorOption,
+) *LeaderElector {
+	e := &LeaderElector{
+		locker:   locker,
+		key:      key,
+		fn:       fn,
+		ttl:      15 * time.Second,
+		interval: time.Second,
+	}
+	for _, opt := range opts {
+		opt(e)
+	}
+	return e
+}
+
+// IsLeader reports whether this replica currently leads.
+func (e *LeaderElector) IsLeader() bool {
+	return e.leader.Load()
+}
+
+// Run campaigns for leadership until ctx is done or Stop is called.
+func (e *LeaderElector) Run(ctx context.Context) error {
+	e.mu.Lock()
+	if e.stopped {
+		e.mu.Unlock()
+		return nil
+	}
+	if e.done != nil {
+		e.mu.Unlock()
+		return errors.New("leader elector is already running")
+	}
+	ctx, e.cancel = context.WithCancel(ctx)
+	e.done = make(chan struct{})
+	done := e.done
+	e.mu.Unlock()
+	defer close(done)
+
+	for {
+		lease, err := e.locker.Lock(ctx, e.key, e.ttl)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			slog.Warn("campaign for leadership",
+				slog.String("key", e.key), slog.Any("error", err))
+		} else {
+			e.lead(ctx, lease)
+		}
+		timer := time.NewTimer(e.interval)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return nil
+		}
+	}
+}
+
+func (e *LeaderElector) lead(ctx context.Context, lease *Lease) {
+	leadCtx, cancel := context.WithCancel(ctx)
+	go func() {
+		select {
+		case <-lease.Done():
+			cancel()
+		case <-leadCtx.Done():
+		}
+	}()
+
+	e.leader.Store(true)
+	slog.Info("leadership acquired", slog.String("key", e.key))
+	err := e.call(leadCtx)
+	e.leader.Store(false)
+	cancel()
+
+	releaseCtx, cancelRelease := context.WithTimeout(context.WithoutCancel(ctx), e.ttl)
+	defer cancelRelease()
+	if releaseErr := lease.Release(releaseCtx); releaseErr != nil {
+		slog.Warn("release leadership",
+			slog.String("key", e.key), slog.Any("error", releaseErr))
+	}
+	if err != nil && ctx.Err() == nil {
+		slog.Error("leader callback failed", slog.String("key", e.key), slog.Any("error", err))
+	} else {
+		slog.Info("leadership released", slog.String("key", e.key))
+	}
+}
+
+func (e *LeaderElector) call(ctx context.Context) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+	return e.fn(ctx)
+}
+
+// Stop cancels the callback, releases leadership and waits for Run to return
+// within ctx.
+func (e *LeaderElector) Stop(ctx context.Context) error {
+	e.mu.Lock()
+	e.stopped = true
+	cancel, done := e.cancel, e.done
+	e.mu.Unlock()
+	if cancel == nil {
+		return nil
+	}
+	cancel()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("wait leader elector: %w", ctx.Err())
+	}
+}
@@ -0,0 +1,90 @@
+// Copyright 2022 The codesjoy Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package lock
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLeaderElectorRunsOnSingleReplica(t *testing.T) {
+	locker := New(NewMemoryStore(), WithRetryInterval(5*time.Millisecond))
+	var running, maxRunning atomic.Int32
+	fn := func(ctx context.Context) error {
+		n := running.Add(1)
+		if n > maxRunning.Load() {
+			maxRunning.Store(n)
+		}
+		<-ctx.Done()
+		running.Add(-1)
+		return nil
+	}
+	first := NewLeaderElector(locker, "leader", fn, WithLeaseTTL(time.Second))
+	second := NewLeaderElector(locker, "leader", fn, WithLeaseTTL(time.Second),
+		WithCampaignInterval(5*time.Millisecond))
+
+	firstDone := runElector(t, first)
+	require.Eventually(t, first.IsLeader, time.Second, 5*time.Millisecond)
+	secondDone := runElector(t, second)
+	time.Sleep(50 * time.Millisecond)
+	assert.False(t, second.IsLeader())
+
+	require.NoError(t, first.Stop(context.Background()))
+	require.NoError(t, <-firstDone)
+	assert.False(t, first.IsLeader())
+	require.Eventually(t, second.IsLeader, time.Second, 5*time.Millisecond)
+
+	require.NoError(t, second.Stop(context.Background()))
+	require.NoError(t, <-secondDone)
+	assert.Equal(t, int32(1), maxRunning.Load())
+	assert.Equal(t, int32(0), running.Load())
+}
+
+func TestLeaderElectorCampaignsAgainAfterCallbackFails(t *testing.T) {
+	locker := New(NewMemoryStore())
+	var calls atomic.Int32
+	elector := NewLeaderElector(locker, "leader", func(context.Context) error {
+		if calls.Add(1) == 1 {
+			panic("boom")
+		}
+		return errors.New("failed")
+	}, WithCampaignInterval(5*time.Millisecond))
+
+	done := runElector(t, elector)
+	require.Eventually(t, func() bool { return calls.Load() >= 3 }, time.Second, 5*time.Millisecond)
+	require.NoError(t, elector.Stop(context.Background()))
+	require.NoError(t, <-done)
+}
+
+func TestLeaderElectorStopBeforeRun(t *testing.T) {
+	elector := NewLeaderElector(New(NewMemoryStore()), "leader",
+		func(context.Context) error { return nil })
+	require.NoError(t, elector.Stop(context.Background()))
+	assert.NoError(t, elector.Run(context.Background()))
+}
+
+func runElector(t *testing.T, e *LeaderElector) <-chan error {
+	t.Helper()
+	done := make(chan error, 1)
+	go func() { done <- e.Run(context.Background()) }()
+	t.Cleanup(func() { _ = e.Stop(context.Background()) })
+	return done
+}
@@ -0,0 +1,238 @@
+// Copyright 2022 The codesjoy Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package lock provides distributed locks with automatic renewal and a leader
+// elector built on them.
+package lock
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/codesjoy/yggdrasil/v3/schedule"
+)
+
+// Store keeps lock ownership. Each acquisition is identified by a random
+// token so a holder can only refresh or release its own lock.
+type Store interface {
+	// Acquire sets the owner of key to token for ttl if key is free and
+	// reports whether it did.
+	Acquire(ctx context.Context, key, token string, ttl time.Duration) (bool, error)
+	// Refresh extends the lock for another ttl. It reports false when token
+	// no longer owns key.
+	Refresh(ctx context.Context, key, token string, ttl time.Duration) (bool, error)
+	// Release frees key if token owns it.
+	Release(ctx context.Context, key, token string) error
+}
+
+// Locker acquires distributed locks.
+type Locker interface {
+	// TryLock attempts to acquire key without waiting. It returns
+	// acquired=false when another holder owns the lock.
+	TryLock(
+		ctx context.Context,
+		key string,
+		ttl time.Duration,
+	) (lease *Lease, acquired bool, err error)
+	// Lock waits until key is acquired or ctx is done.
+	Lock(ctx context.Context, key string, ttl time.Duration) (*Lease, error)
+}
+
+// Option configures a Locker.
+type Option func(*locker)
+
+// WithRetryInterval sets how often Lock retries a held lock. The default is
+// 200ms.
+func WithRetryInterval(interval time.Duration) Option {
+	return func(l *locker) {
+		if interval > 0 {
+			l.retryInterval = interval
+		}
+	}
+}
+
+type locker struct {
+	store         Store
+	retryInterval time.Duration
+}
+
+// New returns a Locker keeping its locks in store. Acquired locks are renewed
+// every third of their ttl until released.
+func New(store Store, opts ...Option) Locker {
+	l := &locker{store: store, retryInterval: 200 * time.Millisecond}
+	for _, opt := range opts {
+		opt(l)
+	}
+	return l
+}
+
+func (l *locker) TryLock(ctx context.Context, key string, ttl time.Duration) (*Lease, bool, error) {
+	if ttl <= 0 {
+		return nil, false, errors.New("lock ttl must be positive")
+	}
+	token, err := newToken()
+	if err != nil {
+		return nil, false, err
+	}
+	// The store may start the ttl as soon as it receives the request.
+	start := time.Now()
+	ok, err := l.store.Acquire(ctx, key, token, ttl)
+	if err != nil || !ok {
+		return nil, false, err
+	}
+	return newLease(l.store, key, token, ttl, start.Add(ttl)), true, nil
+}
+
+func (l *locker) Lock(ctx context.Context, key string, ttl time.Duration) (*Lease, error) {
+	for {
+		lease, ok, err := l.TryLock(ctx, key, ttl)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			return lease, nil
+		}
+		timer := time.NewTimer(l.retryInterval)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		}
+	}
+}
+
+func newToken() (string, error) {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b[:]), nil
+}
+
+// Lease is a held lock. It is renewed in the background until it is released
+// or renewals keep failing until the lock would expire before the next one.
+type Lease struct {
+	store Store
+	key   string
+	token string
+	ttl   time.Duration
+
+	cancel   context.CancelFunc
+	renewed  chan struct{}
+	done     chan struct{}
+	doneOnce sync.Once
+}
+
+func newLease(store Store, key, token string, ttl time.Duration, expiry time.Time) *Lease {
+	ctx, cancel := context.WithCancel(context.Background())
+	l := &Lease{
+		store:   store,
+		key:     key,
+		token:   token,
+		ttl:     ttl,
+		cancel:  cancel,
+		renewed: make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+	go l.renew(ctx, expiry)
+	return l
+}
+
+// Key returns the locked key.
+func (l *Lease) Key() string { return l.key }
+
+// Done is closed when the lease ends, either because it was released or
+// because ownership was lost.
+func (l *Lease) Done() <-chan struct{} { return l.done }
+
+// Release stops renewing the lease and frees the lock.
+func (l *Lease) Release(ctx context.Context) error {
+	l.cancel()
+	<-l.renewed
+	l.end()
+	return l.store.Release(ctx, l.key, l.token)
+}
+
+func (l *Lease) end() {
+	l.doneOnce.Do(func() { close(l.done) })
+}
+
+// renew refreshes the lock every third of its ttl. expiry is the earliest
+// time the store may let the lock expire.
+func (l *Lease) renew(ctx context.Context, expiry time.Time) {
+	defer close(l.renewed)
+	interval := l.ttl / 3
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		start := time.Now()
+		deadline := start.Add(interval)
+		if expiry.Before(deadline) {
+			deadline = expiry
+		}
+		refreshCtx, cancel := context.WithDeadline(ctx, deadline)
+		ok, err := l.store.Refresh(refreshCtx, l.key, l.token, l.ttl)
+		cancel()
+		switch {
+		case err == nil && ok:
+			expiry = start.Add(l.ttl)
+			continue
+		case err == nil:
+			slog.Warn("lock lost", slog.String("key", l.key))
+		case ctx.Err() != nil:
+			return
+		case time.Now().Add(interval).Before(expiry):
+			slog.Warn("renew lock", slog.String("key", l.key), slog.Any("error", err))
+			continue
+		default:
+			// Another holder may take the lock before the next renewal.
+			slog.Warn("lock expires before renewal succeeds",
+				slog.String("key", l.key), slog.Any("error", err))
+		}
+		l.end()
+		return
+	}
+}
+
+// JobLocker adapts locker to the scheduler's job locks.
+func JobLocker(locker Locker) schedule.Locker {
+	return jobLocker{locker: locker}
+}
+
+type jobLocker struct {
+	locker Locker
+}
+
+func (j jobLocker) TryLock(
+	ctx context.Context,
+	key string,
+	ttl time.Duration,
+) (func(context.Context) error, bool, error) {
+	lease, ok, err := j.locker.TryLock(ctx, key, ttl)
+	if err != nil || !ok {
+		return nil, false, err
+	}
+	return lease.Release, true, nil
+}
@@ -0,0 +1,144 @@
+// Copyright 2022 The codesjoy Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package lock
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTryLockIsExclusive(t *testing.T) {
+	ctx := context.Background()
+	locker := New(NewMemoryStore())
+
+	lease, ok, err := locker.TryLock(ctx, "job", time.Minute)
+	require.NoError(t, err)
+	require.True(t, ok)
+	assert.Equal(t, "job", lease.Key())
+
+	_, ok, err = locker.TryLock(ctx, "job", time.Minute)
+	require.NoError(t, err)
+	assert.False(t, ok)
+
+	require.NoError(t, lease.Release(ctx))
+	select {
+	case <-lease.Done():
+	default:
+		t.Fatal("released lease is not done")
+	}
+	other, ok, err := locker.TryLock(ctx, "job", time.Minute)
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.NoError(t, other.Release(ctx))
+
+	_, _, err = locker.TryLock(ctx, "job", 0)
+	assert.Error(t, err)
+}
+
+func TestLeaseIsRenewed(t *testing.T) {
+	ctx := context.Background()
+	locker := New(NewMemoryStore())
+	lease, ok, err := locker.TryLock(ctx, "job", 60*time.Millisecond)
+	require.NoError(t, err)
+	require.True(t, ok)
+	t.Cleanup(func() { _ = lease.Release(ctx) })
+
+	time.Sleep(200 * time.Millisecond)
+	_, ok, err = locker.TryLock(ctx, "job", time.Minute)
+	require.NoError(t, err)
+	assert.False(t, ok)
+}
+
+func TestLeaseReportsLostOwnership(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStore()
+	lease, ok, err := New(store).TryLock(ctx, "job", 30*time.Millisecond)
+	require.NoError(t, err)
+	require.True(t, ok)
+
+	store.(*memoryStore).mu.Lock()
+	delete(store.(*memoryStore).locks, "job")
+	store.(*memoryStore).mu.Unlock()
+
+	select {
+	case <-lease.Done():
+	case <-time.After(time.Second):
+		t.Fatal("lost lease is not done")
+	}
+	require.NoError(t, lease.Release(ctx))
+}
+
+type failingRefreshStore struct {
+	Store
+}
+
+func (failingRefreshStore) Refresh(context.Context, string, string, time.Duration) (bool, error) {
+	return false, errors.New("unavailable")
+}
+
+func TestLeaseEndsBeforeExpiryWhenRenewalFails(t *testing.T) {
+	ctx := context.Background()
+	ttl := 300 * time.Millisecond
+	start := time.Now()
+	lease, ok, err := New(failingRefreshStore{Store: NewMemoryStore()}).TryLock(ctx, "job", ttl)
+	require.NoError(t, err)
+	require.True(t, ok)
+
+	select {
+	case <-lease.Done():
+		assert.Less(t, time.Since(start), ttl)
+	case <-time.After(time.Second):
+		t.Fatal("lease outlived a failing renewal")
+	}
+	require.NoError(t, lease.Release(ctx))
+}
+
+func TestLockWaitsForRelease(t *testing.T) {
+	ctx := context.Background()
+	locker := New(NewMemoryStore(), WithRetryInterval(5*time.Millisecond))
+	held, err := locker.Lock(ctx, "job", time.Minute)
+	require.NoError(t, err)
+
+	time.AfterFunc(20*time.Millisecond, func() { _ = held.Release(ctx) })
+	lease, err := locker.Lock(ctx, "job", time.Minute)
+	require.NoError(t, err)
+
+	timeout, cancel := context.WithTimeout(ctx, 20*time.Millisecond)
+	defer cancel()
+	_, err = locker.Lock(timeout, "job", time.Minute)
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+	require.NoError(t, lease.Release(ctx))
+}
+
+func TestJobLocker(t *testing.T) {
+	ctx := context.Background()
+	locker := JobLocker(New(NewMemoryStore()))
+	release, ok, err := locker.TryLock(ctx, "job", time.Minute)
+	require.NoError(t, err)
+	require.True(t, ok)
+	_, ok, err = locker.TryLock(ctx, "job", time.Minute)
+	require.NoError(t, err)
+	assert.False(t, ok)
+	require.NoError(t, release(ctx))
+	release, ok, err = locker.TryLock(ctx, "job", time.Minute)
+	require.NoError(t, err)
+	assert.True(t, ok)
+	require.NoError(t, release(ctx))
+}
@@ -0,0 +1,78 @@
+// Copyright 2022 The codesjoy Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package lock
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+type memoryLock struct {
+	token   string
+	expires time.Time
+}
+
+type memoryStore struct {
+	mu    sync.Mutex
+	locks map[string]memoryLock
+	now   func() time.Time
+}
+
+// NewMemoryStore returns a store local to the process. It is meant for tests
+// and single-instance deployments.
+func NewMemoryStore() Store {
+	return &memoryStore{locks: map[string]memoryLock{}, now: time.Now}
+}
+
+func (s *memoryStore) Acquire(
+	_ context.Context,
+	key, token string,
+	ttl time.Duration,
+) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := s.now()
+	if held, ok := s.locks[key]; ok && now.Before(held.expires) {
+		return false, nil
+	}
+	s.locks[key] = memoryLock{token: token, expires: now.Add(ttl)}
+	return true, nil
+}
+
+func (s *memoryStore) Refresh(
+	_ context.Context,
+	key, token string,
+	ttl time.Duration,
+) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := s.now()
+	held, ok := s.locks[key]
+	if !ok || held.token != token || !now.Before(held.expires) {
+		return false, nil
+	}
+	s.locks[key] = memoryLock{token: token, expires: now.Add(ttl)}
+	return true, nil
+}
+
+func (s *memoryStore) Release(_ context.Context, key, token string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if held, ok := s.locks[key]; ok && held.token == token {
+		delete(s.locks, key)
+	}
+	return nil
+}
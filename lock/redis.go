@@ -0,0 +1,95 @@
+// Copyright 2022 The codesjoy Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package lock
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// RedisScripter is the subset of Redis commands used by the Redis store.
+// contrib/redis builds the store over a go-redis client with LockStore.
+type RedisScripter interface {
+	// Eval runs script with keys and args and returns its result.
+	Eval(ctx context.Context, script string, keys []string, args ...any) (any, error)
+}
+
+const (
+	acquireScript = `
+if redis.call("SET", KEYS[1], ARGV[1], "NX", "PX", ARGV[2]) then
+  return 1
+end
+return 0
+`
+	refreshScript = `
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+  redis.call("PEXPIRE", KEYS[1], ARGV[2])
+  return 1
+end
+return 0
+`
+	releaseScript = `
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+  return redis.call("DEL", KEYS[1])
+end
+return 0
+`
+)
+
+var errUnexpectedReply = errors.New("unexpected redis reply")
+
+type redisStore struct {
+	client RedisScripter
+	prefix string
+}
+
+// NewRedisStore returns a store that keeps locks in Redis under prefix.
+func NewRedisStore(client RedisScripter, prefix string) Store {
+	return &redisStore{client: client, prefix: prefix}
+}
+
+func (s *redisStore) Acquire(
+	ctx context.Context,
+	key, token string,
+	ttl time.Duration,
+) (bool, error) {
+	return s.eval(ctx, acquireScript, key, token, ttl.Milliseconds())
+}
+
+func (s *redisStore) Refresh(
+	ctx context.Context,
+	key, token string,
+	ttl time.Duration,
+) (bool, error) {
+	return s.eval(ctx, refreshScript, key, token, ttl.Milliseconds())
+}
+
+func (s *redisStore) Release(ctx context.Context, key, token string) error {
+	_, err := s.eval(ctx, releaseScript, key, token)
+	return err
+}
+
+func (s *redisStore) eval(ctx context.Context, script, key string, args ...any) (bool, error) {
+	reply, err := s.client.Eval(ctx, script, []string{s.prefix + key}, args...)
+	if err != nil {
+		return false, err
+	}
+	n, ok := reply.(int64)
+	if !ok {
+		return false, errUnexpectedReply
+	}
+	return n == 1, nil
+}
@@ -0,0 +1,169 @@
+// Copyright 2022 The codesjoy Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package lock
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeRedis interprets the store's scripts against a map.
+type fakeRedis struct {
+	values map[string]string
+	ttls   map[string]int64
+	err    error
+}
+
+func (f *fakeRedis) Eval(
+	_ context.Context,
+	script string,
+	keys []string,
+	args ...any,
+) (any, error) {
+	if f.err != nil {
+		return nil, f.err
+	}
+	key, token := keys[0], args[0].(string)
+	switch script {
+	case acquireScript:
+		if _, ok := f.values[key]; ok {
+			return int64(0), nil
+		}
+		f.values[key], f.ttls[key] = token, args[1].(int64)
+	case refreshScript:
+		if f.values[key] != token {
+			return int64(0), nil
+		}
+		f.ttls[key] = args[1].(int64)
+	case releaseScript:
+		if f.values[key] != token {
+			return int64(0), nil
+		}
+		delete(f.values, key)
+	}
+	return int64(1), nil
+}
+
+func TestRedisStore(t *testing.T) {
+	ctx := context.Background()
+	client := &fakeRedis{values: map[string]string{}, ttls: map[string]int64{}}
+	store := NewRedisStore(client, "lock:")
+
+	ok, err := store.Acquire(ctx, "job", "a", time.Second)
+	require.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, int64(1000), client.ttls["lock:job"])
+	ok, err = store.Acquire(ctx, "job", "b", time.Second)
+	require.NoError(t, err)
+	assert.False(t, ok)
+
+	ok, err = store.Refresh(ctx, "job", "b", time.Second)
+	require.NoError(t, err)
+	assert.False(t, ok)
+	ok, err = store.Refresh(ctx, "job", "a", 2*time.Second)
+	require.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, int64(2000), client.ttls["lock:job"])
+
+	require.NoError(t, store.Release(ctx, "job", "b"))
+	assert.Contains(t, client.values, "lock:job")
+	require.NoError(t, store.Release(ctx, "job", "a"))
+	assert.NotContains(t, client.values, "lock:job")
+
+	client.err = errors.New("down")
+	_, err = store.Acquire(ctx, "job", "a", time.Second)
+	assert.EqualError(t, err, "down")
+}
+
+func TestRedisStoreRejectsUnexpectedReply(t *testing.T) {
+	store := NewRedisStore(scripterFunc(func() (any, error) { return "OK", nil }), "")
+	_, err := store.Acquire(context.Background(), "job", "a", time.Second)
+	assert.ErrorIs(t, err, errUnexpectedReply)
+}
+
+type scripterFunc func() (any, error)
+
+func (f scripterFunc) Eval(context.Context, string, []string, ...any) (any, error) {
+	return f()
+}
+
+// fakeEtcd keeps keys attached to leases.
+type fakeEtcd struct {
+	nextLease int64
+	leases    map[int64]bool
+	keys      map[string]int64
+}
+
+func (f *fakeEtcd) Grant(context.Context, time.Duration) (int64, error) {
+	f.nextLease++
+	f.leases[f.nextLease] = true
+	return f.nextLease, nil
+}
+
+func (f *fakeEtcd) KeepAliveOnce(_ context.Context, lease int64) (bool, error) {
+	return f.leases[lease], nil
+}
+
+func (f *fakeEtcd) Revoke(_ context.Context, lease int64) error {
+	delete(f.leases, lease)
+	for key, l := range f.keys {
+		if l == lease {
+			delete(f.keys, key)
+		}
+	}
+	return nil
+}
+
+func (f *fakeEtcd) CreateIfAbsent(_ context.Context, key, _ string, lease int64) (bool, error) {
+	if _, ok := f.keys[key]; ok {
+		return false, nil
+	}
+	f.keys[key] = lease
+	return true, nil
+}
+
+func TestEtcdStore(t *testing.T) {
+	ctx := context.Background()
+	client := &fakeEtcd{leases: map[int64]bool{}, keys: map[string]int64{}}
+	store := NewEtcdStore(client, "/locks/")
+
+	ok, err := store.Acquire(ctx, "job", "a", time.Second)
+	require.NoError(t, err)
+	assert.True(t, ok)
+	assert.Contains(t, client.keys, "/locks/job")
+
+	ok, err = store.Acquire(ctx, "job", "b", time.Second)
+	require.NoError(t, err)
+	assert.False(t, ok)
+	assert.Len(t, client.leases, 1, "the losing lease is revoked")
+
+	ok, err = store.Refresh(ctx, "job", "a", time.Second)
+	require.NoError(t, err)
+	assert.True(t, ok)
+	ok, err = store.Refresh(ctx, "job", "b", time.Second)
+	require.NoError(t, err)
+	assert.False(t, ok)
+
+	require.NoError(t, store.Release(ctx, "job", "a"))
+	assert.Empty(t, client.keys)
+	ok, err = store.Refresh(ctx, "job", "a", time.Second)
+	require.NoError(t, err)
+	assert.False(t, ok)
+}
@@ -93,6 +93,25 @@ func (h *Hub) Stop(ctx context.Context) error {
 	return h.stopSequence(ctx, topo)
 }
 
+// CheckHealth runs the health checks of the modules implementing
+// HealthChecker and joins their failures.
+func (h *Hub) CheckHealth(ctx context.Context) error {
+	h.mu.RLock()
+	topo := append([]Module(nil), h.topoOrder...)
+	h.mu.RUnlock()
+	var multiErr error
+	for _, mod := range topo {
+		item, ok := mod.(HealthChecker)
+		if !ok {
+			continue
+		}
+		if err := item.CheckHealth(ctx); err != nil {
+			multiErr = errors.Join(multiErr, fmt.Errorf("module %q: %w", mod.Name(), err))
+		}
+	}
+	return multiErr
+}
+
 func (h *Hub) stopSequence(ctx context.Context, startedSeq []Module) error {
 	var multiErr error
 	for i := len(startedSeq) - 1; i >= 0; i-- {
@@ -165,6 +165,28 @@ func TestStop_MultipleStopErrors(t *testing.T) {
 	require.Contains(t, err.Error(), "stop-b")
 }
 
+type healthModule struct {
+	name string
+	err  error
+}
+
+func (m *healthModule) Name() string                      { return m.name }
+func (m *healthModule) CheckHealth(context.Context) error { return m.err }
+
+func TestCheckHealth_JoinsModuleFailures(t *testing.T) {
+	h := NewHub()
+	require.NoError(t, h.Use(
+		&healthModule{name: "ok"},
+		&healthModule{name: "db", err: errors.New("ping failed")},
+		&testModule{name: "plain"},
+	))
+	require.NoError(t, h.Seal())
+
+	err := h.CheckHealth(context.Background())
+	require.Error(t, err)
+	require.Equal(t, `module "db": ping failed`, err.Error())
+}
+
 // ---------------------------------------------------------------------------
 // Reload no-op (no affected modules)
 // ---------------------------------------------------------------------------
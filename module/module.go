@@ -82,6 +82,12 @@ type Stoppable interface {
 	Stop(ctx context.Context) error
 }
 
+// HealthChecker reports whether the resources of an initialized module are
+// usable. Failing checks mark the application not ready.
+type HealthChecker interface {
+	CheckHealth(ctx context.Context) error
+}
+
 // Reloadable supports staged reload.
 type Reloadable interface {
 	PrepareReload(ctx context.Context, view config.View) (ReloadCommitter, error)
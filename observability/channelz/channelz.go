@@ -0,0 +1,512 @@
+// Copyright 2022 The codesjoy Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package channelz tracks the servers, listen sockets, client channels,
+// subchannels and connections of the process together with their call and
+// stream counters, in the spirit of gRPC channelz. The registry is fed by the
+// channelz stats handler and by the client runtime; it is exposed as JSON on
+// the governor and as the grpc.channelz.v1.Channelz service, which can be
+// installed with ServiceDesc and NewService.
+package channelz
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/codesjoy/yggdrasil/v3/observability/stats"
+	"github.com/codesjoy/yggdrasil/v3/transport/runtime/client"
+)
+
+// Name is the stats handler name.
+const Name = "channelz"
+
+// Config bounds the memory used by the registry.
+type Config struct {
+	// MaxSockets is the number of open connections tracked. Connections
+	// opened beyond it are counted as dropped and not tracked.
+	MaxSockets int `mapstructure:"max_sockets" default:"1024"`
+	// MaxClosedSockets is the number of closed connections kept for
+	// inspection, most recent first. A negative value keeps none.
+	MaxClosedSockets int `mapstructure:"max_closed_sockets" default:"64"`
+	// MaxEndpoints is the number of distinct server ports and client
+	// addresses that keep call counters.
+	MaxEndpoints int `mapstructure:"max_endpoints" default:"1024"`
+}
+
+// Listener describes one address a server listens on.
+type Listener struct {
+	Protocol string
+	Address  string
+}
+
+// CallMetrics counts the calls handled by a server or sent to a channel.
+type CallMetrics struct {
+	Started     int64      `json:"calls_started"`
+	Succeeded   int64      `json:"calls_succeeded"`
+	Failed      int64      `json:"calls_failed"`
+	LastStarted *time.Time `json:"last_call_started,omitempty"`
+}
+
+// Server is one server listen address and the connections accepted on it.
+type Server struct {
+	ID           int64  `json:"id"`
+	Protocol     string `json:"protocol"`
+	Address      string `json:"address"`
+	ListenSocket int64  `json:"listen_socket"`
+	CallMetrics
+	Sockets []int64 `json:"sockets"`
+}
+
+// Channel is one client target.
+type Channel struct {
+	ID     int64  `json:"id"`
+	Target string `json:"target"`
+	State  string `json:"state"`
+	CallMetrics
+	Subchannels []Subchannel `json:"subchannels"`
+}
+
+// Subchannel is one endpoint of a channel.
+type Subchannel struct {
+	ID       int64  `json:"id"`
+	Name     string `json:"name"`
+	Address  string `json:"address"`
+	Protocol string `json:"protocol"`
+	State    string `json:"state"`
+	CallMetrics
+	Sockets []int64 `json:"sockets"`
+}
+
+// Socket is one transport connection.
+type Socket struct {
+	ID                  int64      `json:"id"`
+	Protocol            string     `json:"protocol"`
+	Client              bool       `json:"client"`
+	Local               string     `json:"local"`
+	Remote              string     `json:"remote"`
+	Opened              time.Time  `json:"opened"`
+	Closed              *time.Time `json:"closed,omitempty"`
+	StreamsStarted      int64      `json:"streams_started"`
+	StreamsSucceeded    int64      `json:"streams_succeeded"`
+	StreamsFailed       int64      `json:"streams_failed"`
+	MessagesSent        int64      `json:"messages_sent"`
+	MessagesReceived    int64      `json:"messages_received"`
+	KeepalivesSent      int64      `json:"keepalives_sent"`
+	LastStreamCreated   *time.Time `json:"last_stream_created,omitempty"`
+	LastMessageSent     *time.Time `json:"last_message_sent,omitempty"`
+	LastMessageReceived *time.Time `json:"last_message_received,omitempty"`
+}
+
+// Snapshot is the state of the registry at one point in time.
+type Snapshot struct {
+	Servers        []Server  `json:"servers"`
+	Channels       []Channel `json:"channels"`
+	Sockets        []Socket  `json:"sockets"`
+	ClosedSockets  []Socket  `json:"closed_sockets"`
+	DroppedSockets int64     `json:"dropped_sockets"`
+}
+
+type callCounters struct {
+	started     atomic.Int64
+	succeeded   atomic.Int64
+	failed      atomic.Int64
+	lastStarted atomic.Int64
+}
+
+func (c *callCounters) start(now time.Time) {
+	c.started.Add(1)
+	c.lastStarted.Store(now.UnixNano())
+}
+
+func (c *callCounters) finish(failed bool) {
+	if failed {
+		c.failed.Add(1)
+		return
+	}
+	c.succeeded.Add(1)
+}
+
+func (c *callCounters) metrics() CallMetrics {
+	return CallMetrics{
+		Started:     c.started.Load(),
+		Succeeded:   c.succeeded.Load(),
+		Failed:      c.failed.Load(),
+		LastStarted: unixTime(c.lastStarted.Load()),
+	}
+}
+
+func (m *CallMetrics) add(o CallMetrics) {
+	m.Started += o.Started
+	m.Succeeded += o.Succeeded
+	m.Failed += o.Failed
+	if o.LastStarted != nil && (m.LastStarted == nil || o.LastStarted.After(*m.LastStarted)) {
+		m.LastStarted = o.LastStarted
+	}
+}
+
+type socket struct {
+	id       int64
+	protocol string
+	client   bool
+	local    string
+	remote   string
+	opened   time.Time
+	closed   time.Time
+
+	streamsStarted   atomic.Int64
+	streamsSucceeded atomic.Int64
+	streamsFailed    atomic.Int64
+	messagesSent     atomic.Int64
+	messagesReceived atomic.Int64
+	lastStream       atomic.Int64
+	lastSent         atomic.Int64
+	lastReceived     atomic.Int64
+}
+
+func (s *socket) view() Socket {
+	out := Socket{
+		ID:                  s.id,
+		Protocol:            s.protocol,
+		Client:              s.client,
+		Local:               s.local,
+		Remote:              s.remote,
+		Opened:              s.opened,
+		StreamsStarted:      s.streamsStarted.Load(),
+		StreamsSucceeded:    s.streamsSucceeded.Load(),
+		StreamsFailed:       s.streamsFailed.Load(),
+		MessagesSent:        s.messagesSent.Load(),
+		MessagesReceived:    s.messagesReceived.Load(),
+		LastStreamCreated:   unixTime(s.lastStream.Load()),
+		LastMessageSent:     unixTime(s.lastSent.Load()),
+		LastMessageReceived: unixTime(s.lastReceived.Load()),
+	}
+	if !s.closed.IsZero() {
+		closed := s.closed
+		out.Closed = &closed
+	}
+	return out
+}
+
+type addrPair struct {
+	local  string
+	remote string
+}
+
+// Registry holds the tracked entities.
+type Registry struct {
+	mu          sync.Mutex
+	cfg         Config
+	now         func() time.Time
+	nextID      int64
+	ids         map[string]int64
+	sockets     map[int64]*socket
+	byAddr      map[addrPair]*socket
+	closed      []*socket
+	dropped     int64
+	serverCalls map[string]*callCounters
+	clientCalls map[string]*callCounters
+	listeners   func() []Listener
+	targets     func() []client.TargetStatus
+	keepalives  func(context.Context) map[addrPair]int64
+}
+
+// NewRegistry returns an empty registry with cfg.
+func NewRegistry(cfg Config) *Registry {
+	r := &Registry{
+		now:        time.Now,
+		ids:        map[string]int64{},
+		targets:    client.Targets,
+		keepalives: grpcKeepalives,
+	}
+	r.Configure(cfg)
+	return r
+}
+
+var (
+	defaultOnce     sync.Once
+	defaultRegistry *Registry
+)
+
+// Default returns the process-wide registry fed by the builtin handler.
+func Default() *Registry {
+	defaultOnce.Do(func() {
+		defaultRegistry = NewRegistry(Config{})
+	})
+	return defaultRegistry
+}
+
+// BuiltinHandlerBuilder returns the builder of handlers feeding Default.
+func BuiltinHandlerBuilder() stats.HandlerBuilder {
+	return Default().Handler
+}
+
+// BuiltinHandlerBuilderWithConfig configures Default and returns the builder
+// of handlers feeding it.
+func BuiltinHandlerBuilderWithConfig(cfg Config) stats.HandlerBuilder {
+	Default().Configure(cfg)
+	return Default().Handler
+}
+
+// Configure replaces the configuration and resets the collected data.
+func (r *Registry) Configure(cfg Config) {
+	if cfg.MaxSockets <= 0 {
+		cfg.MaxSockets = 1024
+	}
+	if cfg.MaxClosedSockets == 0 {
+		cfg.MaxClosedSockets = 64
+	}
+	if cfg.MaxEndpoints <= 0 {
+		cfg.MaxEndpoints = 1024
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.cfg = cfg
+	r.sockets = map[int64]*socket{}
+	r.byAddr = map[addrPair]*socket{}
+	r.closed = nil
+	r.dropped = 0
+	r.serverCalls = map[string]*callCounters{}
+	r.clientCalls = map[string]*callCounters{}
+}
+
+// SetListeners installs the source of the server listen addresses. Servers
+// seen only through their connections are reported without it.
+func (r *Registry) SetListeners(fn func() []Listener) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.listeners = fn
+}
+
+// id returns the stable identifier of key. Callers hold r.mu.
+func (r *Registry) id(key string) int64 {
+	if id, ok := r.ids[key]; ok {
+		return id
+	}
+	r.nextID++
+	r.ids[key] = r.nextID
+	return r.nextID
+}
+
+func (r *Registry) openSocket(info stats.ChanTagInfo, isClient bool) *socket {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if len(r.sockets) >= r.cfg.MaxSockets {
+		r.dropped++
+		return nil
+	}
+	r.nextID++
+	s := &socket{
+		id:       r.nextID,
+		protocol: info.GetProtocol(),
+		client:   isClient,
+		local:    info.GetLocalEndpoint(),
+		remote:   info.GetRemoteEndpoint(),
+		opened:   r.now(),
+	}
+	r.sockets[s.id] = s
+	r.byAddr[addrPair{local: s.local, remote: s.remote}] = s
+	return s
+}
+
+func (r *Registry) closeSocket(s *socket) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.sockets[s.id]; !ok {
+		return
+	}
+	delete(r.sockets, s.id)
+	key := addrPair{local: s.local, remote: s.remote}
+	if r.byAddr[key] == s {
+		delete(r.byAddr, key)
+	}
+	s.closed = r.now()
+	if r.cfg.MaxClosedSockets < 0 {
+		return
+	}
+	r.closed = append([]*socket{s}, r.closed...)
+	if len(r.closed) > r.cfg.MaxClosedSockets {
+		r.closed = r.closed[:r.cfg.MaxClosedSockets]
+	}
+}
+
+func (r *Registry) socketByAddr(local, remote string) *socket {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.byAddr[addrPair{local: local, remote: remote}]
+}
+
+// calls returns the counters of key, or nil once MaxEndpoints keys exist.
+func (r *Registry) calls(isClient bool, key string) *callCounters {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	table := r.serverCalls
+	if isClient {
+		table = r.clientCalls
+	}
+	c := table[key]
+	if c == nil && len(r.serverCalls)+len(r.clientCalls) < r.cfg.MaxEndpoints {
+		c = &callCounters{}
+		table[key] = c
+	}
+	return c
+}
+
+// serverKey groups server connections by listen port, since listeners bound
+// to a wildcard address accept connections on every local address.
+func serverKey(protocol, address string) string {
+	if _, port, err := net.SplitHostPort(address); err == nil {
+		address = port
+	}
+	return protocol + "|" + address
+}
+
+func clientKey(protocol, address string) string {
+	return protocol + "|" + address
+}
+
+// Snapshot returns the current state of the registry.
+func (r *Registry) Snapshot(ctx context.Context) Snapshot {
+	keepalives := map[addrPair]int64{}
+	if r.keepalives != nil {
+		keepalives = r.keepalives(ctx)
+	}
+	targets := r.targets()
+	r.mu.Lock()
+	listenersFn := r.listeners
+	r.mu.Unlock()
+	var listeners []Listener
+	if listenersFn != nil {
+		listeners = listenersFn()
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	out := Snapshot{
+		Servers:        []Server{},
+		Channels:       []Channel{},
+		Sockets:        make([]Socket, 0, len(r.sockets)),
+		ClosedSockets:  make([]Socket, 0, len(r.closed)),
+		DroppedSockets: r.dropped,
+	}
+	for _, s := range r.sockets {
+		view := s.view()
+		view.KeepalivesSent = keepalives[addrPair{local: s.local, remote: s.remote}]
+		out.Sockets = append(out.Sockets, view)
+	}
+	sort.Slice(out.Sockets, func(i, j int) bool { return out.Sockets[i].ID < out.Sockets[j].ID })
+	for _, s := range r.closed {
+		out.ClosedSockets = append(out.ClosedSockets, s.view())
+	}
+	out.Servers = r.serversLocked(listeners, out.Sockets)
+	for _, target := range targets {
+		out.Channels = append(out.Channels, r.channelLocked(target, out.Sockets))
+	}
+	return out
+}
+
+// ServeHTTP writes the snapshot as JSON.
+func (r *Registry) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	w.WriteHeader(http.StatusOK)
+	encoder := json.NewEncoder(w)
+	if req.URL.Query().Get("pretty") == "true" {
+		encoder.SetIndent("", "    ")
+	}
+	_ = encoder.Encode(r.Snapshot(req.Context()))
+}
+
+func (r *Registry) serversLocked(listeners []Listener, sockets []Socket) []Server {
+	seen := map[string]bool{}
+	unique := make([]Listener, 0, len(listeners)+len(r.serverCalls))
+	for _, item := range listeners {
+		if key := serverKey(item.Protocol, item.Address); !seen[key] {
+			unique = append(unique, item)
+			seen[key] = true
+		}
+	}
+	for key := range r.serverCalls {
+		if !seen[key] {
+			protocol, port, _ := strings.Cut(key, "|")
+			unique = append(unique, Listener{Protocol: protocol, Address: ":" + port})
+			seen[key] = true
+		}
+	}
+
+	out := make([]Server, 0, len(unique))
+	for _, item := range unique {
+		key := serverKey(item.Protocol, item.Address)
+		server := Server{
+			ID:           r.id("server/" + key),
+			Protocol:     item.Protocol,
+			Address:      item.Address,
+			ListenSocket: r.id("listen/" + key),
+			Sockets:      []int64{},
+		}
+		if c := r.serverCalls[key]; c != nil {
+			server.CallMetrics = c.metrics()
+		}
+		for _, s := range sockets {
+			if !s.Client && serverKey(s.Protocol, s.Local) == key {
+				server.Sockets = append(server.Sockets, s.ID)
+			}
+		}
+		out = append(out, server)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].ID < out[j].ID })
+	return out
+}
+
+func (r *Registry) channelLocked(target client.TargetStatus, sockets []Socket) Channel {
+	channel := Channel{
+		ID:          r.id("channel/" + target.Target),
+		Target:      target.Target,
+		State:       target.State,
+		Subchannels: make([]Subchannel, 0, len(target.Endpoints)),
+	}
+	for _, ep := range target.Endpoints {
+		sub := Subchannel{
+			ID:       r.id("subchannel/" + target.Target + "/" + ep.Name),
+			Name:     ep.Name,
+			Address:  ep.Address,
+			Protocol: ep.Protocol,
+			State:    ep.State,
+			Sockets:  []int64{},
+		}
+		if c := r.clientCalls[clientKey(ep.Protocol, ep.Address)]; c != nil {
+			sub.CallMetrics = c.metrics()
+		}
+		for _, s := range sockets {
+			if s.Client && s.Protocol == ep.Protocol && s.Remote == ep.Address {
+				sub.Sockets = append(sub.Sockets, s.ID)
+			}
+		}
+		channel.CallMetrics.add(sub.CallMetrics)
+		channel.Subchannels = append(channel.Subchannels, sub)
+	}
+	return channel
+}
+
+func unixTime(nanos int64) *time.Time {
+	if nanos == 0 {
+		return nil
+	}
+	t := time.Unix(0, nanos)
+	return &t
+}
@@ -0,0 +1,170 @@
+// Copyright 2022 The codesjoy Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package channelz
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/codesjoy/yggdrasil/v3/observability/stats"
+	"github.com/codesjoy/yggdrasil/v3/transport/runtime/client"
+)
+
+func newTestRegistry(cfg Config, targets ...client.TargetStatus) *Registry {
+	r := NewRegistry(cfg)
+	r.targets = func() []client.TargetStatus { return targets }
+	r.keepalives = nil
+	return r
+}
+
+func openConn(h stats.Handler, local, remote string) context.Context {
+	ctx := h.TagChannel(context.Background(), &stats.ChanTagInfoBase{
+		LocalEndpoint:  local,
+		RemoteEndpoint: remote,
+		Protocol:       "grpc",
+	})
+	h.HandleChannel(ctx, &stats.ChanBeginBase{})
+	return ctx
+}
+
+func serverCall(h stats.Handler, conn context.Context, local string, err error) {
+	ctx := h.TagRPC(conn, &stats.RPCTagInfoBase{FullMethod: "/svc/Call"})
+	h.HandleRPC(ctx, &stats.RPCServerInHeaderBase{
+		RPCInHeaderBase: stats.RPCInHeaderBase{Protocol: "grpc"},
+		LocalEndpoint:   local,
+	})
+	h.HandleRPC(ctx, &stats.RPCInPayloadBase{})
+	h.HandleRPC(ctx, &stats.RPCOutPayloadBase{})
+	h.HandleRPC(ctx, &stats.RPCEndBase{Err: err})
+}
+
+func TestRegistry_ServerSockets(t *testing.T) {
+	r := newTestRegistry(Config{})
+	r.SetListeners(func() []Listener {
+		return []Listener{{Protocol: "grpc", Address: "[::]:9000"}}
+	})
+	h := r.Handler(true)
+	conn := openConn(h, "127.0.0.1:9000", "127.0.0.1:50000")
+	serverCall(h, conn, "127.0.0.1:9000", nil)
+	serverCall(h, conn, "127.0.0.1:9000", errors.New("boom"))
+
+	snap := r.Snapshot(context.Background())
+	require.Len(t, snap.Servers, 1)
+	server := snap.Servers[0]
+	assert.Equal(t, "[::]:9000", server.Address)
+	assert.Equal(t, int64(2), server.Started)
+	assert.Equal(t, int64(1), server.Succeeded)
+	assert.Equal(t, int64(1), server.Failed)
+	assert.NotNil(t, server.LastStarted)
+
+	require.Len(t, snap.Sockets, 1)
+	sock := snap.Sockets[0]
+	assert.Equal(t, []int64{sock.ID}, server.Sockets)
+	assert.False(t, sock.Client)
+	assert.Equal(t, int64(2), sock.StreamsStarted)
+	assert.Equal(t, int64(1), sock.StreamsSucceeded)
+	assert.Equal(t, int64(1), sock.StreamsFailed)
+	assert.Equal(t, int64(2), sock.MessagesSent)
+	assert.Equal(t, int64(2), sock.MessagesReceived)
+
+	h.HandleChannel(conn, &stats.ChanEndBase{})
+	snap = r.Snapshot(context.Background())
+	assert.Empty(t, snap.Sockets)
+	require.Len(t, snap.ClosedSockets, 1)
+	assert.NotNil(t, snap.ClosedSockets[0].Closed)
+	assert.Equal(t, int64(2), snap.Servers[0].Started, "server counters outlive sockets")
+}
+
+func TestRegistry_ClientChannels(t *testing.T) {
+	r := newTestRegistry(Config{}, client.TargetStatus{
+		Target: "svc",
+		State:  "READY",
+		Endpoints: []client.EndpointStatus{
+			{Name: "a", Address: "10.0.0.1:80", Protocol: "grpc", State: "READY"},
+			{Name: "b", Address: "10.0.0.2:80", Protocol: "grpc", State: "IDLE"},
+		},
+	})
+	h := r.Handler(false)
+	openConn(h, "10.0.0.9:40000", "10.0.0.1:80")
+	ctx := h.TagRPC(context.Background(), &stats.RPCTagInfoBase{FullMethod: "/svc/Call"})
+	h.HandleRPC(ctx, &stats.RPCBeginBase{Client: true})
+	h.HandleRPC(ctx, &stats.OutHeaderBase{
+		Client:         true,
+		LocalEndpoint:  "10.0.0.9:40000",
+		RemoteEndpoint: "10.0.0.1:80",
+		Protocol:       "grpc",
+	})
+	h.HandleRPC(ctx, &stats.RPCOutPayloadBase{Client: true})
+	h.HandleRPC(ctx, &stats.RPCEndBase{Client: true})
+
+	snap := r.Snapshot(context.Background())
+	require.Len(t, snap.Channels, 1)
+	channel := snap.Channels[0]
+	assert.Equal(t, "svc", channel.Target)
+	assert.Equal(t, int64(1), channel.Succeeded)
+	require.Len(t, channel.Subchannels, 2)
+	require.Len(t, snap.Sockets, 1)
+	assert.Equal(t, []int64{snap.Sockets[0].ID}, channel.Subchannels[0].Sockets)
+	assert.Equal(t, int64(1), channel.Subchannels[0].Started)
+	assert.Empty(t, channel.Subchannels[1].Sockets)
+	assert.Equal(t, int64(1), snap.Sockets[0].StreamsSucceeded)
+	assert.Equal(t, int64(1), snap.Sockets[0].MessagesSent)
+
+	again := r.Snapshot(context.Background())
+	assert.Equal(t, channel.ID, again.Channels[0].ID, "ids are stable")
+}
+
+func TestRegistry_Bounds(t *testing.T) {
+	r := newTestRegistry(Config{MaxSockets: 1, MaxClosedSockets: 1, MaxEndpoints: 1})
+	h := r.Handler(true)
+	first := openConn(h, "127.0.0.1:9000", "127.0.0.1:1")
+	openConn(h, "127.0.0.1:9000", "127.0.0.1:2")
+	serverCall(h, first, "127.0.0.1:9000", nil)
+	serverCall(h, context.Background(), "127.0.0.1:9001", nil)
+
+	snap := r.Snapshot(context.Background())
+	assert.Len(t, snap.Sockets, 1)
+	assert.Equal(t, int64(1), snap.DroppedSockets)
+	require.Len(t, snap.Servers, 1, "the second port exceeds MaxEndpoints")
+	assert.Equal(t, ":9000", snap.Servers[0].Address)
+
+	h.HandleChannel(first, &stats.ChanEndBase{})
+	third := openConn(h, "127.0.0.1:9000", "127.0.0.1:3")
+	h.HandleChannel(third, &stats.ChanEndBase{})
+	snap = r.Snapshot(context.Background())
+	require.Len(t, snap.ClosedSockets, 1)
+	assert.Equal(t, "127.0.0.1:3", snap.ClosedSockets[0].Remote)
+}
+
+func TestRegistry_ServeHTTP(t *testing.T) {
+	r := newTestRegistry(Config{})
+	r.keepalives = func(context.Context) map[addrPair]int64 {
+		return map[addrPair]int64{{local: "127.0.0.1:9000", remote: "127.0.0.1:1"}: 3}
+	}
+	openConn(r.Handler(true), "127.0.0.1:9000", "127.0.0.1:1")
+
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest("GET", "/channelz", nil))
+	var snap Snapshot
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &snap))
+	require.Len(t, snap.Sockets, 1)
+	assert.Equal(t, int64(3), snap.Sockets[0].KeepalivesSent)
+}
@@ -0,0 +1,154 @@
+// Copyright 2022 The codesjoy Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package channelz
+
+import (
+	"context"
+	"net"
+	"strconv"
+	"sync"
+
+	ggrpc "google.golang.org/grpc"
+	channelzgrpc "google.golang.org/grpc/channelz/grpc_channelz_v1"
+	"google.golang.org/grpc/channelz/service"
+)
+
+// The grpc transport is built on grpc-go, whose own channelz counts the
+// keepalive pings of every connection. Stats handlers never see those pings,
+// so the counters are read from grpc-go and matched to the sockets of the
+// registry by address.
+
+type captureRegistrar struct {
+	impl channelzgrpc.ChannelzServer
+}
+
+func (c *captureRegistrar) RegisterService(_ *ggrpc.ServiceDesc, impl any) {
+	c.impl, _ = impl.(channelzgrpc.ChannelzServer)
+}
+
+var (
+	grpcChannelzOnce sync.Once
+	grpcChannelz     channelzgrpc.ChannelzServer
+)
+
+func grpcChannelzServer() channelzgrpc.ChannelzServer {
+	grpcChannelzOnce.Do(func() {
+		registrar := &captureRegistrar{}
+		service.RegisterChannelzServiceToServer(registrar)
+		grpcChannelz = registrar.impl
+	})
+	return grpcChannelz
+}
+
+// grpcKeepalives returns the keepalive pings sent on each grpc-go connection.
+func grpcKeepalives(ctx context.Context) map[addrPair]int64 {
+	out := map[addrPair]int64{}
+	cz := grpcChannelzServer()
+	if cz == nil {
+		return out
+	}
+	var socketIDs []int64
+	for start := int64(0); ; {
+		resp, err := cz.GetServers(ctx, &channelzgrpc.GetServersRequest{StartServerId: start})
+		if err != nil {
+			break
+		}
+		for _, srv := range resp.GetServer() {
+			start = srv.GetRef().GetServerId() + 1
+			socketIDs = append(socketIDs, grpcServerSockets(ctx, cz, srv.GetRef().GetServerId())...)
+		}
+		if resp.GetEnd() || len(resp.GetServer()) == 0 {
+			break
+		}
+	}
+	for start := int64(0); ; {
+		resp, err := cz.GetTopChannels(
+			ctx,
+			&channelzgrpc.GetTopChannelsRequest{StartChannelId: start},
+		)
+		if err != nil {
+			break
+		}
+		for _, ch := range resp.GetChannel() {
+			start = ch.GetRef().GetChannelId() + 1
+			socketIDs = append(socketIDs, grpcChannelSockets(ctx, cz, ch)...)
+		}
+		if resp.GetEnd() || len(resp.GetChannel()) == 0 {
+			break
+		}
+	}
+	for _, id := range socketIDs {
+		resp, err := cz.GetSocket(ctx, &channelzgrpc.GetSocketRequest{SocketId: id})
+		if err != nil {
+			continue
+		}
+		sock := resp.GetSocket()
+		key := addrPair{local: grpcAddress(sock.GetLocal()), remote: grpcAddress(sock.GetRemote())}
+		out[key] = sock.GetData().GetKeepAlivesSent()
+	}
+	return out
+}
+
+func grpcServerSockets(ctx context.Context, cz channelzgrpc.ChannelzServer, id int64) []int64 {
+	var out []int64
+	for start := int64(0); ; {
+		resp, err := cz.GetServerSockets(ctx, &channelzgrpc.GetServerSocketsRequest{
+			ServerId:      id,
+			StartSocketId: start,
+		})
+		if err != nil {
+			return out
+		}
+		for _, ref := range resp.GetSocketRef() {
+			start = ref.GetSocketId() + 1
+			out = append(out, ref.GetSocketId())
+		}
+		if resp.GetEnd() || len(resp.GetSocketRef()) == 0 {
+			return out
+		}
+	}
+}
+
+func grpcChannelSockets(
+	ctx context.Context,
+	cz channelzgrpc.ChannelzServer,
+	ch *channelzgrpc.Channel,
+) []int64 {
+	var out []int64
+	for _, ref := range ch.GetSocketRef() {
+		out = append(out, ref.GetSocketId())
+	}
+	for _, ref := range ch.GetSubchannelRef() {
+		resp, err := cz.GetSubchannel(
+			ctx,
+			&channelzgrpc.GetSubchannelRequest{SubchannelId: ref.GetSubchannelId()},
+		)
+		if err != nil {
+			continue
+		}
+		for _, sock := range resp.GetSubchannel().GetSocketRef() {
+			out = append(out, sock.GetSocketId())
+		}
+	}
+	return out
+}
+
+func grpcAddress(addr *channelzgrpc.Address) string {
+	tcp := addr.GetTcpipAddress()
+	if tcp == nil {
+		return ""
+	}
+	return net.JoinHostPort(net.IP(tcp.GetIpAddress()).String(), strconv.Itoa(int(tcp.GetPort())))
+}
@@ -0,0 +1,135 @@
+// Copyright 2022 The codesjoy Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package channelz
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/codesjoy/yggdrasil/v3/observability/stats"
+)
+
+// Handler returns a stats handler feeding r.
+func (r *Registry) Handler(isServer bool) stats.Handler {
+	return &handler{registry: r, client: !isServer}
+}
+
+type (
+	socketCtxKey struct{}
+	rpcCtxKey    struct{}
+)
+
+// rpcState follows one call from the first event carrying its addresses to
+// its end.
+type rpcState struct {
+	mu     sync.Mutex
+	socket *socket
+	calls  *callCounters
+	begun  bool
+}
+
+type handler struct {
+	registry *Registry
+	client   bool
+}
+
+func (h *handler) TagChannel(ctx context.Context, info stats.ChanTagInfo) context.Context {
+	s := h.registry.openSocket(info, h.client)
+	if s == nil {
+		return ctx
+	}
+	return context.WithValue(ctx, socketCtxKey{}, s)
+}
+
+func (h *handler) HandleChannel(ctx context.Context, cs stats.ChanStats) {
+	if _, ok := cs.(stats.ChanEnd); !ok {
+		return
+	}
+	if s, ok := ctx.Value(socketCtxKey{}).(*socket); ok {
+		h.registry.closeSocket(s)
+	}
+}
+
+func (h *handler) TagRPC(ctx context.Context, _ stats.RPCTagInfo) context.Context {
+	st := &rpcState{}
+	if s, ok := ctx.Value(socketCtxKey{}).(*socket); ok {
+		st.socket = s
+	}
+	return context.WithValue(ctx, rpcCtxKey{}, st)
+}
+
+func (h *handler) HandleRPC(ctx context.Context, rs stats.RPCStats) {
+	st, ok := ctx.Value(rpcCtxKey{}).(*rpcState)
+	if !ok {
+		return
+	}
+	now := h.registry.now()
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	switch s := rs.(type) {
+	case stats.RPCServerInHeader:
+		if st.begun {
+			return
+		}
+		st.calls = h.registry.calls(false, serverKey(s.GetProtocol(), s.GetLocalEndpoint()))
+		h.begin(st, now)
+	case stats.RPCOutHeader:
+		if !s.IsClient() || st.begun {
+			return
+		}
+		if st.socket == nil && s.GetLocalEndpoint() != "" {
+			st.socket = h.registry.socketByAddr(s.GetLocalEndpoint(), s.GetRemoteEndpoint())
+		}
+		st.calls = h.registry.calls(true, clientKey(s.GetProtocol(), s.GetRemoteEndpoint()))
+		h.begin(st, now)
+	case stats.RPCOutPayload:
+		if st.socket != nil {
+			st.socket.messagesSent.Add(1)
+			st.socket.lastSent.Store(now.UnixNano())
+		}
+	case stats.RPCInPayload:
+		if st.socket != nil {
+			st.socket.messagesReceived.Add(1)
+			st.socket.lastReceived.Store(now.UnixNano())
+		}
+	case stats.RPCEnd:
+		if !st.begun {
+			return
+		}
+		failed := s.Error() != nil
+		if st.calls != nil {
+			st.calls.finish(failed)
+		}
+		if st.socket != nil {
+			if failed {
+				st.socket.streamsFailed.Add(1)
+			} else {
+				st.socket.streamsSucceeded.Add(1)
+			}
+		}
+	}
+}
+
+func (h *handler) begin(st *rpcState, now time.Time) {
+	st.begun = true
+	if st.calls != nil {
+		st.calls.start(now)
+	}
+	if st.socket != nil {
+		st.socket.streamsStarted.Add(1)
+		st.socket.lastStream.Store(now.UnixNano())
+	}
+}
@@ -0,0 +1,399 @@
+// Copyright 2022 The codesjoy Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package channelz
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+	"time"
+
+	"github.com/codesjoy/pkg/basic/xerror"
+	"google.golang.org/genproto/googleapis/rpc/code"
+	channelzgrpc "google.golang.org/grpc/channelz/grpc_channelz_v1"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"github.com/codesjoy/yggdrasil/v3/rpc/interceptor"
+	"github.com/codesjoy/yggdrasil/v3/transport/runtime/server"
+)
+
+// ServiceName is the name of the channelz gRPC service.
+const ServiceName = "grpc.channelz.v1.Channelz"
+
+// defaultMaxResults is the page size used when a request does not set one.
+const defaultMaxResults = 100
+
+// NewService returns the grpc.channelz.v1.Channelz implementation serving r.
+// Install it with ServiceDesc.
+func NewService(r *Registry) channelzgrpc.ChannelzServer {
+	return &channelzService{registry: r}
+}
+
+type channelzService struct {
+	channelzgrpc.UnimplementedChannelzServer
+	registry *Registry
+}
+
+func (s *channelzService) GetTopChannels(
+	ctx context.Context,
+	req *channelzgrpc.GetTopChannelsRequest,
+) (*channelzgrpc.GetTopChannelsResponse, error) {
+	snap := s.registry.Snapshot(ctx)
+	page, end := paginate(snap.Channels, func(c Channel) int64 { return c.ID },
+		req.GetStartChannelId(), req.GetMaxResults())
+	resp := &channelzgrpc.GetTopChannelsResponse{End: end}
+	for _, item := range page {
+		resp.Channel = append(resp.Channel, channelProto(item))
+	}
+	return resp, nil
+}
+
+func (s *channelzService) GetServers(
+	ctx context.Context,
+	req *channelzgrpc.GetServersRequest,
+) (*channelzgrpc.GetServersResponse, error) {
+	snap := s.registry.Snapshot(ctx)
+	page, end := paginate(snap.Servers, func(srv Server) int64 { return srv.ID },
+		req.GetStartServerId(), req.GetMaxResults())
+	resp := &channelzgrpc.GetServersResponse{End: end}
+	for _, item := range page {
+		resp.Server = append(resp.Server, serverProto(item))
+	}
+	return resp, nil
+}
+
+func (s *channelzService) GetServer(
+	ctx context.Context,
+	req *channelzgrpc.GetServerRequest,
+) (*channelzgrpc.GetServerResponse, error) {
+	srv, ok := findServer(s.registry.Snapshot(ctx), req.GetServerId())
+	if !ok {
+		return nil, notFound("server", req.GetServerId())
+	}
+	return &channelzgrpc.GetServerResponse{Server: serverProto(srv)}, nil
+}
+
+func (s *channelzService) GetServerSockets(
+	ctx context.Context,
+	req *channelzgrpc.GetServerSocketsRequest,
+) (*channelzgrpc.GetServerSocketsResponse, error) {
+	srv, ok := findServer(s.registry.Snapshot(ctx), req.GetServerId())
+	if !ok {
+		return nil, notFound("server", req.GetServerId())
+	}
+	page, end := paginate(srv.Sockets, func(id int64) int64 { return id },
+		req.GetStartSocketId(), req.GetMaxResults())
+	resp := &channelzgrpc.GetServerSocketsResponse{End: end}
+	for _, id := range page {
+		resp.SocketRef = append(resp.SocketRef, &channelzgrpc.SocketRef{SocketId: id})
+	}
+	return resp, nil
+}
+
+func (s *channelzService) GetChannel(
+	ctx context.Context,
+	req *channelzgrpc.GetChannelRequest,
+) (*channelzgrpc.GetChannelResponse, error) {
+	for _, item := range s.registry.Snapshot(ctx).Channels {
+		if item.ID == req.GetChannelId() {
+			return &channelzgrpc.GetChannelResponse{Channel: channelProto(item)}, nil
+		}
+	}
+	return nil, notFound("channel", req.GetChannelId())
+}
+
+func (s *channelzService) GetSubchannel(
+	ctx context.Context,
+	req *channelzgrpc.GetSubchannelRequest,
+) (*channelzgrpc.GetSubchannelResponse, error) {
+	for _, channel := range s.registry.Snapshot(ctx).Channels {
+		for _, item := range channel.Subchannels {
+			if item.ID == req.GetSubchannelId() {
+				return &channelzgrpc.GetSubchannelResponse{
+					Subchannel: subchannelProto(item),
+				}, nil
+			}
+		}
+	}
+	return nil, notFound("subchannel", req.GetSubchannelId())
+}
+
+func (s *channelzService) GetSocket(
+	ctx context.Context,
+	req *channelzgrpc.GetSocketRequest,
+) (*channelzgrpc.GetSocketResponse, error) {
+	snap := s.registry.Snapshot(ctx)
+	for _, sockets := range [][]Socket{snap.Sockets, snap.ClosedSockets} {
+		for _, item := range sockets {
+			if item.ID == req.GetSocketId() {
+				return &channelzgrpc.GetSocketResponse{Socket: socketProto(item)}, nil
+			}
+		}
+	}
+	for _, srv := range snap.Servers {
+		if srv.ListenSocket == req.GetSocketId() {
+			return &channelzgrpc.GetSocketResponse{Socket: &channelzgrpc.Socket{
+				Ref:   &channelzgrpc.SocketRef{SocketId: srv.ListenSocket, Name: srv.Address},
+				Data:  &channelzgrpc.SocketData{},
+				Local: addressProto(srv.Address),
+			}}, nil
+		}
+	}
+	return nil, notFound("socket", req.GetSocketId())
+}
+
+func findServer(snap Snapshot, id int64) (Server, bool) {
+	for _, item := range snap.Servers {
+		if item.ID == id {
+			return item, true
+		}
+	}
+	return Server{}, false
+}
+
+func notFound(kind string, id int64) error {
+	return xerror.New(code.Code_NOT_FOUND, fmt.Sprintf("channelz: %s %d not found", kind, id))
+}
+
+// paginate returns the items whose id is at least start, at most maxResults
+// of them, and whether the last item was reached.
+func paginate[T any](items []T, id func(T) int64, start, maxResults int64) ([]T, bool) {
+	if maxResults <= 0 {
+		maxResults = defaultMaxResults
+	}
+	var out []T
+	for _, item := range items {
+		if id(item) < start {
+			continue
+		}
+		if int64(len(out)) == maxResults {
+			return out, false
+		}
+		out = append(out, item)
+	}
+	return out, true
+}
+
+func channelProto(item Channel) *channelzgrpc.Channel {
+	out := &channelzgrpc.Channel{
+		Ref: &channelzgrpc.ChannelRef{ChannelId: item.ID, Name: item.Target},
+		Data: &channelzgrpc.ChannelData{
+			State:                    stateProto(item.State),
+			Target:                   item.Target,
+			CallsStarted:             item.Started,
+			CallsSucceeded:           item.Succeeded,
+			CallsFailed:              item.Failed,
+			LastCallStartedTimestamp: timestampProto(item.LastStarted),
+		},
+	}
+	for _, sub := range item.Subchannels {
+		out.SubchannelRef = append(out.SubchannelRef, &channelzgrpc.SubchannelRef{
+			SubchannelId: sub.ID,
+			Name:         sub.Name,
+		})
+	}
+	return out
+}
+
+func subchannelProto(item Subchannel) *channelzgrpc.Subchannel {
+	out := &channelzgrpc.Subchannel{
+		Ref: &channelzgrpc.SubchannelRef{SubchannelId: item.ID, Name: item.Name},
+		Data: &channelzgrpc.ChannelData{
+			State:                    stateProto(item.State),
+			Target:                   item.Address,
+			CallsStarted:             item.Started,
+			CallsSucceeded:           item.Succeeded,
+			CallsFailed:              item.Failed,
+			LastCallStartedTimestamp: timestampProto(item.LastStarted),
+		},
+	}
+	for _, id := range item.Sockets {
+		out.SocketRef = append(out.SocketRef, &channelzgrpc.SocketRef{SocketId: id})
+	}
+	return out
+}
+
+func serverProto(item Server) *channelzgrpc.Server {
+	return &channelzgrpc.Server{
+		Ref: &channelzgrpc.ServerRef{
+			ServerId: item.ID,
+			Name:     item.Protocol + "://" + item.Address,
+		},
+		Data: &channelzgrpc.ServerData{
+			CallsStarted:             item.Started,
+			CallsSucceeded:           item.Succeeded,
+			CallsFailed:              item.Failed,
+			LastCallStartedTimestamp: timestampProto(item.LastStarted),
+		},
+		ListenSocket: []*channelzgrpc.SocketRef{
+			{SocketId: item.ListenSocket, Name: item.Address},
+		},
+	}
+}
+
+func socketProto(item Socket) *channelzgrpc.Socket {
+	data := &channelzgrpc.SocketData{
+		StreamsStarted:               item.StreamsStarted,
+		StreamsSucceeded:             item.StreamsSucceeded,
+		StreamsFailed:                item.StreamsFailed,
+		MessagesSent:                 item.MessagesSent,
+		MessagesReceived:             item.MessagesReceived,
+		KeepAlivesSent:               item.KeepalivesSent,
+		LastMessageSentTimestamp:     timestampProto(item.LastMessageSent),
+		LastMessageReceivedTimestamp: timestampProto(item.LastMessageReceived),
+	}
+	if item.Client {
+		data.LastLocalStreamCreatedTimestamp = timestampProto(item.LastStreamCreated)
+	} else {
+		data.LastRemoteStreamCreatedTimestamp = timestampProto(item.LastStreamCreated)
+	}
+	return &channelzgrpc.Socket{
+		Ref: &channelzgrpc.SocketRef{
+			SocketId: item.ID,
+			Name:     item.Local + " -> " + item.Remote,
+		},
+		Data:   data,
+		Local:  addressProto(item.Local),
+		Remote: addressProto(item.Remote),
+	}
+}
+
+func addressProto(address string) *channelzgrpc.Address {
+	if address == "" {
+		return nil
+	}
+	host, port, err := net.SplitHostPort(address)
+	if err == nil {
+		ip := net.ParseIP(host)
+		portNum, perr := strconv.Atoi(port)
+		if ip != nil && perr == nil {
+			if v4 := ip.To4(); v4 != nil {
+				ip = v4
+			}
+			return &channelzgrpc.Address{
+				Address: &channelzgrpc.Address_TcpipAddress{
+					TcpipAddress: &channelzgrpc.Address_TcpIpAddress{
+						IpAddress: ip,
+						Port:      int32(portNum), //nolint:gosec // ports fit in int32
+					},
+				},
+			}
+		}
+	}
+	return &channelzgrpc.Address{
+		Address: &channelzgrpc.Address_OtherAddress_{
+			OtherAddress: &channelzgrpc.Address_OtherAddress{Name: address},
+		},
+	}
+}
+
+func stateProto(state string) *channelzgrpc.ChannelConnectivityState {
+	value := channelzgrpc.ChannelConnectivityState_State_value[state]
+	return &channelzgrpc.ChannelConnectivityState{
+		State: channelzgrpc.ChannelConnectivityState_State(value),
+	}
+}
+
+func timestampProto(t *time.Time) *timestamppb.Timestamp {
+	if t == nil {
+		return nil
+	}
+	return timestamppb.New(*t)
+}
+
+func unaryHandler[Req any, Resp any](
+	fullMethod string,
+	call func(channelzgrpc.ChannelzServer, context.Context, *Req) (*Resp, error),
+) func(any, context.Context, func(any) error, interceptor.UnaryServerInterceptor) (any, error) {
+	return func(
+		srv any,
+		ctx context.Context,
+		dec func(any) error,
+		unaryInt interceptor.UnaryServerInterceptor,
+	) (any, error) {
+		in := new(Req)
+		if err := dec(in); err != nil {
+			return nil, err
+		}
+		impl := srv.(channelzgrpc.ChannelzServer)
+		if unaryInt == nil {
+			return call(impl, ctx, in)
+		}
+		info := &interceptor.UnaryServerInfo{Server: srv, FullMethod: fullMethod}
+		handler := func(ctx context.Context, req any) (any, error) {
+			return call(impl, ctx, req.(*Req))
+		}
+		return unaryInt(ctx, in, info, handler)
+	}
+}
+
+// ServiceDesc describes the grpc.channelz.v1.Channelz service for the server
+// runtime. Register it with an implementation returned by NewService.
+var ServiceDesc = server.ServiceDesc{
+	ServiceName: ServiceName,
+	HandlerType: (*channelzgrpc.ChannelzServer)(nil),
+	Methods: []server.MethodDesc{
+		{
+			MethodName: "GetTopChannels",
+			Handler: unaryHandler(
+				"/"+ServiceName+"/GetTopChannels",
+				channelzgrpc.ChannelzServer.GetTopChannels,
+			),
+		},
+		{
+			MethodName: "GetServers",
+			Handler: unaryHandler(
+				"/"+ServiceName+"/GetServers",
+				channelzgrpc.ChannelzServer.GetServers,
+			),
+		},
+		{
+			MethodName: "GetServer",
+			Handler: unaryHandler(
+				"/"+ServiceName+"/GetServer",
+				channelzgrpc.ChannelzServer.GetServer,
+			),
+		},
+		{
+			MethodName: "GetServerSockets",
+			Handler: unaryHandler(
+				"/"+ServiceName+"/GetServerSockets",
+				channelzgrpc.ChannelzServer.GetServerSockets,
+			),
+		},
+		{
+			MethodName: "GetChannel",
+			Handler: unaryHandler(
+				"/"+ServiceName+"/GetChannel",
+				channelzgrpc.ChannelzServer.GetChannel,
+			),
+		},
+		{
+			MethodName: "GetSubchannel",
+			Handler: unaryHandler(
+				"/"+ServiceName+"/GetSubchannel",
+				channelzgrpc.ChannelzServer.GetSubchannel,
+			),
+		},
+		{
+			MethodName: "GetSocket",
+			Handler: unaryHandler(
+				"/"+ServiceName+"/GetSocket",
+				channelzgrpc.ChannelzServer.GetSocket,
+			),
+		},
+	},
+}
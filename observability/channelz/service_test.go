@@ -0,0 +1,146 @@
+// Copyright 2022 The codesjoy Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package channelz
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/genproto/googleapis/rpc/code"
+	channelzgrpc "google.golang.org/grpc/channelz/grpc_channelz_v1"
+
+	"github.com/codesjoy/yggdrasil/v3/rpc/status"
+	"github.com/codesjoy/yggdrasil/v3/transport/runtime/client"
+)
+
+func TestService_ServersAndSockets(t *testing.T) {
+	r := newTestRegistry(Config{})
+	r.SetListeners(func() []Listener {
+		return []Listener{
+			{Protocol: "grpc", Address: "0.0.0.0:9000"},
+			{Protocol: "http", Address: "0.0.0.0:8080"},
+		}
+	})
+	h := r.Handler(true)
+	conn := openConn(h, "127.0.0.1:9000", "127.0.0.1:50000")
+	serverCall(h, conn, "127.0.0.1:9000", nil)
+	svc := NewService(r)
+	ctx := context.Background()
+
+	servers, err := svc.GetServers(ctx, &channelzgrpc.GetServersRequest{MaxResults: 1})
+	require.NoError(t, err)
+	require.Len(t, servers.GetServer(), 1)
+	assert.False(t, servers.GetEnd())
+	grpcServer := servers.GetServer()[0]
+	assert.Equal(t, int64(1), grpcServer.GetData().GetCallsSucceeded())
+
+	rest, err := svc.GetServers(ctx, &channelzgrpc.GetServersRequest{
+		StartServerId: grpcServer.GetRef().GetServerId() + 1,
+	})
+	require.NoError(t, err)
+	require.Len(t, rest.GetServer(), 1)
+	assert.True(t, rest.GetEnd())
+
+	sockets, err := svc.GetServerSockets(ctx, &channelzgrpc.GetServerSocketsRequest{
+		ServerId: grpcServer.GetRef().GetServerId(),
+	})
+	require.NoError(t, err)
+	require.Len(t, sockets.GetSocketRef(), 1)
+
+	sock, err := svc.GetSocket(ctx, &channelzgrpc.GetSocketRequest{
+		SocketId: sockets.GetSocketRef()[0].GetSocketId(),
+	})
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), sock.GetSocket().GetData().GetStreamsSucceeded())
+	assert.Equal(t, "127.0.0.1:50000", grpcAddress(sock.GetSocket().GetRemote()))
+	assert.NotNil(t, sock.GetSocket().GetData().GetLastRemoteStreamCreatedTimestamp())
+
+	listen, err := svc.GetSocket(ctx, &channelzgrpc.GetSocketRequest{
+		SocketId: grpcServer.GetListenSocket()[0].GetSocketId(),
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "0.0.0.0:9000", grpcAddress(listen.GetSocket().GetLocal()))
+
+	_, err = svc.GetServer(ctx, &channelzgrpc.GetServerRequest{ServerId: 999})
+	assert.Equal(t, code.Code_NOT_FOUND, status.FromError(err).Code())
+}
+
+func TestService_Channels(t *testing.T) {
+	r := newTestRegistry(Config{}, client.TargetStatus{
+		Target: "svc",
+		State:  "TRANSIENT_FAILURE",
+		Endpoints: []client.EndpointStatus{
+			{Name: "a", Address: "unix:///tmp/a.sock", Protocol: "grpc", State: "CONNECTING"},
+		},
+	})
+	svc := NewService(r)
+	ctx := context.Background()
+
+	top, err := svc.GetTopChannels(ctx, &channelzgrpc.GetTopChannelsRequest{})
+	require.NoError(t, err)
+	require.Len(t, top.GetChannel(), 1)
+	channel := top.GetChannel()[0]
+	assert.Equal(t, "svc", channel.GetData().GetTarget())
+	assert.Equal(t,
+		channelzgrpc.ChannelConnectivityState_TRANSIENT_FAILURE,
+		channel.GetData().GetState().GetState(),
+	)
+
+	sub, err := svc.GetSubchannel(ctx, &channelzgrpc.GetSubchannelRequest{
+		SubchannelId: channel.GetSubchannelRef()[0].GetSubchannelId(),
+	})
+	require.NoError(t, err)
+	assert.Equal(t,
+		channelzgrpc.ChannelConnectivityState_CONNECTING,
+		sub.GetSubchannel().GetData().GetState().GetState(),
+	)
+	assert.Equal(t, "unix:///tmp/a.sock", sub.GetSubchannel().GetData().GetTarget())
+
+	got, err := svc.GetChannel(ctx, &channelzgrpc.GetChannelRequest{
+		ChannelId: channel.GetRef().GetChannelId(),
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "svc", got.GetChannel().GetRef().GetName())
+}
+
+func TestServiceDesc_DecodesRequests(t *testing.T) {
+	r := newTestRegistry(Config{})
+	svc := NewService(r)
+	var handler func(any, context.Context, func(any) error) (any, error)
+	for _, method := range ServiceDesc.Methods {
+		if method.MethodName == "GetServers" {
+			handler = func(srv any, ctx context.Context, dec func(any) error) (any, error) {
+				return method.Handler(srv, ctx, dec, nil)
+			}
+		}
+	}
+	require.NotNil(t, handler)
+	out, err := handler(svc, context.Background(), func(in any) error {
+		in.(*channelzgrpc.GetServersRequest).MaxResults = 5
+		return nil
+	})
+	require.NoError(t, err)
+	assert.True(t, out.(*channelzgrpc.GetServersResponse).GetEnd())
+	assert.Len(t, ServiceDesc.Methods, 7)
+}
+
+func TestAddressProto(t *testing.T) {
+	assert.Equal(t, "[::1]:80", grpcAddress(addressProto("[::1]:80")))
+	assert.Equal(t, "10.0.0.1:80", grpcAddress(addressProto("10.0.0.1:80")))
+	assert.Equal(t, "pipe", addressProto("pipe").GetOtherAddress().GetName())
+	assert.Nil(t, addressProto(""))
+}
@@ -0,0 +1,227 @@
+// Copyright 2022 The codesjoy Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package crashreport reports recovered panics to a central Reporter, the
+// integration point for services such as Sentry or Rollbar.
+//
+// The recovery and logging interceptors, the worker runner, the goroutine
+// pools and the application run loop call Recovered for every panic they
+// recover. The installed Reporter receives the panic value and stack together
+// with the incoming request metadata and the identity of the running App.
+package crashreport
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"runtime/debug"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/codesjoy/yggdrasil/v3/internal/instance"
+	"github.com/codesjoy/yggdrasil/v3/rpc/metadata"
+)
+
+// Sources of the recovered panics.
+const (
+	SourceUnaryServer  = "rpc.unary_server"
+	SourceStreamServer = "rpc.stream_server"
+	SourceUnaryClient  = "rpc.unary_client"
+	SourceStreamClient = "rpc.stream_client"
+	SourceWorker       = "worker"
+	SourcePool         = "pool"
+	SourceApp          = "app"
+)
+
+// redactedValue replaces the values of redacted metadata keys.
+const redactedValue = "***"
+
+// Config defines the crash report settings under
+// yggdrasil.observability.telemetry.crash_report.
+type Config struct {
+	// Webhook posts every report as JSON to an HTTP endpoint.
+	Webhook WebhookConfig `mapstructure:"webhook"`
+	// Redacted lists the case-insensitive request metadata keys whose
+	// values are masked in reports.
+	Redacted []string `mapstructure:"redact_metadata" default:"[\"authorization\",\"cookie\"]"`
+}
+
+// Identity is the identity of the App that recovered the panic.
+type Identity struct {
+	AppName   string `json:"app_name"`
+	Namespace string `json:"namespace"`
+	Version   string `json:"version"`
+	Region    string `json:"region"`
+	Zone      string `json:"zone"`
+	Campus    string `json:"campus"`
+}
+
+// Report describes one recovered panic.
+type Report struct {
+	Time time.Time `json:"time"`
+	// Source is the recovery path, e.g. SourceUnaryServer.
+	Source string `json:"source"`
+	// Name is the RPC full method or worker name, when known.
+	Name  string `json:"name,omitempty"`
+	Panic string `json:"panic"`
+	Stack string `json:"stack"`
+	// Metadata is the incoming request metadata, redacted.
+	Metadata map[string][]string `json:"metadata,omitempty"`
+	App      Identity            `json:"app"`
+}
+
+// Reporter receives recovered panics. Report is called synchronously on the
+// recovering goroutine and must be safe for concurrent use.
+type Reporter interface {
+	Report(ctx context.Context, report *Report)
+}
+
+// ReporterFunc adapts a function to a Reporter.
+type ReporterFunc func(ctx context.Context, report *Report)
+
+// Report calls f.
+func (f ReporterFunc) Report(ctx context.Context, report *Report) {
+	f(ctx, report)
+}
+
+type nopReporter struct{}
+
+func (nopReporter) Report(context.Context, *Report) {}
+
+// Nop returns a Reporter dropping every report.
+func Nop() Reporter {
+	return nopReporter{}
+}
+
+var (
+	mu       sync.RWMutex
+	reporter = Nop()
+	redact   = []string{"authorization", "cookie"}
+)
+
+// SetReporter installs the process-wide reporter and returns the previous
+// one. A nil reporter installs Nop.
+func SetReporter(next Reporter) Reporter {
+	if next == nil {
+		next = Nop()
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	prev := reporter
+	reporter = next
+	return prev
+}
+
+// Default returns the process-wide reporter.
+func Default() Reporter {
+	mu.RLock()
+	defer mu.RUnlock()
+	return reporter
+}
+
+// SetRedactedMetadata replaces the metadata keys masked in reports and
+// returns the previous keys.
+func SetRedactedMetadata(keys []string) []string {
+	next := make([]string, 0, len(keys))
+	for _, key := range keys {
+		next = append(next, strings.ToLower(key))
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	prev := redact
+	redact = next
+	return prev
+}
+
+// New returns the reporter configured by cfg, or nil when nothing is
+// configured.
+func New(cfg Config) Reporter {
+	if cfg.Webhook.URL == "" {
+		return nil
+	}
+	return NewWebhookReporter(cfg.Webhook)
+}
+
+// Recovered reports the panic p recovered by source with its stack, which
+// defaults to the current stack. name identifies the failed RPC or worker.
+func Recovered(ctx context.Context, source, name string, p any, stack []byte) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if stack == nil {
+		stack = debug.Stack()
+	}
+	mu.RLock()
+	r, keys := reporter, redact
+	mu.RUnlock()
+	if _, ok := r.(nopReporter); ok {
+		return
+	}
+	report := &Report{
+		Time:     time.Now(),
+		Source:   source,
+		Name:     name,
+		Panic:    fmt.Sprint(p),
+		Stack:    string(stack),
+		Metadata: requestMetadata(ctx, keys),
+		App:      processIdentity(),
+	}
+	defer func() {
+		if p := recover(); p != nil {
+			slog.Error("crash reporter panicked", slog.Any("panic", p))
+		}
+	}()
+	r.Report(ctx, report)
+}
+
+// Guard reports and re-raises a panic of the calling goroutine. It must be
+// deferred directly:
+//
+//	defer crashreport.Guard(ctx, crashreport.SourceApp, "")
+func Guard(ctx context.Context, source, name string) {
+	if p := recover(); p != nil {
+		Recovered(ctx, source, name, p, debug.Stack())
+		panic(p)
+	}
+}
+
+func requestMetadata(ctx context.Context, redacted []string) map[string][]string {
+	md, ok := metadata.FromInContext(ctx)
+	if !ok || md.Len() == 0 {
+		return nil
+	}
+	out := make(map[string][]string, md.Len())
+	for key, values := range md {
+		if slices.Contains(redacted, strings.ToLower(key)) {
+			out[key] = []string{redactedValue}
+			continue
+		}
+		out[key] = slices.Clone(values)
+	}
+	return out
+}
+
+func processIdentity() Identity {
+	snapshot := instance.ProcessDefaultSnapshot()
+	return Identity{
+		AppName:   snapshot.AppName,
+		Namespace: snapshot.Config.Namespace,
+		Version:   snapshot.Config.Version,
+		Region:    snapshot.Config.Region,
+		Zone:      snapshot.Config.Zone,
+		Campus:    snapshot.Config.Campus,
+	}
+}
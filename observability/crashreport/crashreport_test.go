@@ -0,0 +1,114 @@
+// Copyright 2022 The codesjoy Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package crashreport
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/codesjoy/yggdrasil/v3/internal/instance"
+	"github.com/codesjoy/yggdrasil/v3/rpc/metadata"
+)
+
+func captureReports(t *testing.T) *[]*Report {
+	t.Helper()
+	var reports []*Report
+	prev := SetReporter(ReporterFunc(func(_ context.Context, report *Report) {
+		reports = append(reports, report)
+	}))
+	t.Cleanup(func() { SetReporter(prev) })
+	return &reports
+}
+
+func TestRecovered(t *testing.T) {
+	reports := captureReports(t)
+	prevInstance := instance.ProcessDefaultSnapshot()
+	instance.InstallProcessDefault("orders", instance.Config{Version: "1.2.3", Zone: "z1"})
+	defer instance.RestoreProcessDefault(prevInstance)
+
+	ctx := metadata.WithInContext(context.Background(), metadata.Pairs(
+		"authorization", "Bearer secret",
+		"x-request-id", "r1",
+	))
+	Recovered(ctx, SourceUnaryServer, "/pkg.Svc/Get", "boom", []byte("stack"))
+
+	require.Len(t, *reports, 1)
+	report := (*reports)[0]
+	assert.Equal(t, SourceUnaryServer, report.Source)
+	assert.Equal(t, "/pkg.Svc/Get", report.Name)
+	assert.Equal(t, "boom", report.Panic)
+	assert.Equal(t, "stack", report.Stack)
+	assert.False(t, report.Time.IsZero())
+	assert.Equal(t, []string{redactedValue}, report.Metadata["authorization"])
+	assert.Equal(t, []string{"r1"}, report.Metadata["x-request-id"])
+	assert.Equal(t, "orders", report.App.AppName)
+	assert.Equal(t, "1.2.3", report.App.Version)
+	assert.Equal(t, "z1", report.App.Zone)
+}
+
+func TestRecoveredRedactedKeys(t *testing.T) {
+	reports := captureReports(t)
+	prev := SetRedactedMetadata([]string{"X-Api-Key"})
+	defer SetRedactedMetadata(prev)
+
+	ctx := metadata.WithInContext(context.Background(), metadata.Pairs(
+		"authorization", "Bearer secret",
+		"x-api-key", "k",
+	))
+	Recovered(ctx, SourceWorker, "sync", "boom", nil)
+
+	require.Len(t, *reports, 1)
+	assert.Equal(t, []string{"Bearer secret"}, (*reports)[0].Metadata["authorization"])
+	assert.Equal(t, []string{redactedValue}, (*reports)[0].Metadata["x-api-key"])
+	assert.NotEmpty(t, (*reports)[0].Stack, "the stack defaults to the current one")
+}
+
+func TestRecoveredIsolatesReporterPanics(t *testing.T) {
+	prev := SetReporter(ReporterFunc(func(context.Context, *Report) { panic("reporter") }))
+	defer SetReporter(prev)
+
+	assert.NotPanics(t, func() {
+		Recovered(context.Background(), SourceApp, "", "boom", nil)
+	})
+}
+
+func TestGuard(t *testing.T) {
+	reports := captureReports(t)
+
+	assert.PanicsWithValue(t, "boom", func() {
+		defer Guard(context.Background(), SourceApp, "orders")
+		panic("boom")
+	})
+	require.Len(t, *reports, 1)
+	assert.Equal(t, SourceApp, (*reports)[0].Source)
+	assert.Equal(t, "orders", (*reports)[0].Name)
+
+	assert.NotPanics(t, func() {
+		defer Guard(context.Background(), SourceApp, "orders")
+	})
+	assert.Len(t, *reports, 1)
+}
+
+func TestSetReporter(t *testing.T) {
+	prev := SetReporter(nil)
+	defer SetReporter(prev)
+	assert.Equal(t, Nop(), Default())
+
+	assert.Nil(t, New(Config{}))
+	assert.NotNil(t, New(Config{Webhook: WebhookConfig{URL: "http://127.0.0.1/crash"}}))
+}
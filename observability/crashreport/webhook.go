@@ -0,0 +1,84 @@
+// Copyright 2022 The codesjoy Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package crashreport
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+// WebhookConfig configures the HTTP webhook reporter.
+type WebhookConfig struct {
+	// URL receives a POST with the JSON encoded Report. Empty disables the
+	// webhook.
+	URL string `mapstructure:"url"`
+	// Headers are added to every request, e.g. an authorization token.
+	Headers map[string]string `mapstructure:"headers"`
+	// Timeout bounds one delivery.
+	Timeout time.Duration `mapstructure:"timeout" default:"3s"`
+}
+
+type webhookReporter struct {
+	cfg    WebhookConfig
+	client *http.Client
+}
+
+// NewWebhookReporter returns a Reporter posting reports to cfg.URL. Failed
+// deliveries are logged and dropped.
+func NewWebhookReporter(cfg WebhookConfig) Reporter {
+	return &webhookReporter{cfg: cfg, client: &http.Client{Timeout: cfg.Timeout}}
+}
+
+func (w *webhookReporter) Report(ctx context.Context, report *Report) {
+	if err := w.post(ctx, report); err != nil {
+		slog.Warn("failed to deliver crash report",
+			slog.String("url", w.cfg.URL),
+			slog.Any("error", err),
+		)
+	}
+}
+
+func (w *webhookReporter) post(ctx context.Context, report *Report) error {
+	body, err := json.Marshal(report)
+	if err != nil {
+		return err
+	}
+	// The report outlives a request context canceled by the panic.
+	ctx = context.WithoutCancel(ctx)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.cfg.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for key, value := range w.cfg.Headers {
+		req.Header.Set(key, value)
+	}
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	_, _ = io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode >= http.StatusBadRequest {
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,67 @@
+// Copyright 2022 The codesjoy Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package crashreport
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWebhookReporter(t *testing.T) {
+	received := make(chan *Report, 1)
+	var token string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token = r.Header.Get("X-Token")
+		assert.Equal(t, "application/json", r.Header.Get("Content-Type"))
+		report := &Report{}
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(report))
+		received <- report
+	}))
+	defer srv.Close()
+
+	reporter := NewWebhookReporter(WebhookConfig{
+		URL:     srv.URL,
+		Headers: map[string]string{"X-Token": "t1"},
+		Timeout: time.Second,
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	reporter.Report(ctx, &Report{Source: SourceWorker, Name: "sync", Panic: "boom"})
+
+	report := <-received
+	assert.Equal(t, "t1", token)
+	assert.Equal(t, SourceWorker, report.Source)
+	assert.Equal(t, "sync", report.Name)
+	assert.Equal(t, "boom", report.Panic)
+}
+
+func TestWebhookReporterStatusError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer srv.Close()
+
+	reporter := NewWebhookReporter(WebhookConfig{URL: srv.URL, Timeout: time.Second})
+	err := reporter.(*webhookReporter).post(context.Background(), &Report{})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "502")
+}
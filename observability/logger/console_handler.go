@@ -26,6 +26,8 @@ type ConsoleHandlerConfig struct {
 	Level     slog.Level `mapstructure:"level"      yaml:"level"      json:"level"`
 	AddTrace  bool       `mapstructure:"add_trace"  yaml:"add_trace"  json:"add_trace"`
 	AddSource bool       `mapstructure:"add_source" yaml:"add_source" json:"add_source"`
+	// Redaction masks sensitive attribute values.
+	Redaction RedactionConfig `mapstructure:"redaction" yaml:"redaction" json:"redaction"`
 
 	Writer io.Writer
 }
@@ -39,10 +41,15 @@ func NewConsoleHandler(cfg *ConsoleHandlerConfig) (slog.Handler, error) {
 	if w == nil {
 		w = emptyWriter{}
 	}
+	replaceAttr, err := cfg.Redaction.replaceAttr()
+	if err != nil {
+		return nil, err
+	}
 	opts := &slog.HandlerOptions{
-		AddSource: cfg.AddSource,
-		Level:     cfg.Level,
+		AddSource:   cfg.AddSource,
+		Level:       cfg.Level,
+		ReplaceAttr: replaceAttr,
 	}
 	h := slog.NewTextHandler(w, opts)
-	return wrapTraceHandler(h, cfg.AddTrace), nil
+	return ContextHandler(wrapTraceHandler(h, cfg.AddTrace)), nil
 }
@@ -0,0 +1,136 @@
+// Copyright 2022 The codesjoy Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package logger
+
+import (
+	"context"
+	"log/slog"
+	"slices"
+)
+
+type ctxAttrsKey struct{}
+
+// AppendCtx returns a copy of ctx carrying attrs in addition to the
+// attributes already attached to it. The framework handlers add them to
+// every record logged with the returned context, e.g. through
+// slog.InfoContext, so request-scoped values such as the request id or
+// tenant need not be threaded through slog.With.
+func AppendCtx(ctx context.Context, attrs ...slog.Attr) context.Context {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if len(attrs) == 0 {
+		return ctx
+	}
+	prev := ContextAttrs(ctx)
+	next := make([]slog.Attr, 0, len(prev)+len(attrs))
+	next = append(append(next, prev...), attrs...)
+	return context.WithValue(ctx, ctxAttrsKey{}, next)
+}
+
+// ContextAttrs returns the attributes attached to ctx with AppendCtx, in the
+// order they were appended.
+func ContextAttrs(ctx context.Context) []slog.Attr {
+	if ctx == nil {
+		return nil
+	}
+	attrs, _ := ctx.Value(ctxAttrsKey{}).([]slog.Attr)
+	return slices.Clip(attrs)
+}
+
+// ContextHandler adds the attributes attached to the record context with
+// AppendCtx to every record before passing it to the wrapped handler. They
+// stay at the top level of the record even when the logger has groups, as
+// they describe the request rather than the grouped values. The json and
+// text handlers and the process default handler are wrapped already; wrap
+// handlers built elsewhere to get the same behavior.
+func ContextHandler(base slog.Handler) slog.Handler {
+	if _, ok := base.(*contextHandler); ok {
+		return base
+	}
+	return &contextHandler{base: base, full: base}
+}
+
+// contextHandler keeps the wrapped handler as it was before the first group,
+// plus the groups and attributes added since, so the context attributes can
+// be added outside the groups.
+type contextHandler struct {
+	// base is the wrapped handler up to the first group.
+	base slog.Handler
+	// full is base with ops applied.
+	full slog.Handler
+	ops  []handlerOp
+}
+
+// handlerOp is a WithGroup call when group is set, else a WithAttrs call.
+type handlerOp struct {
+	group string
+	attrs []slog.Attr
+}
+
+func (h *contextHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return h.full.Enabled(ctx, level)
+}
+
+func (h *contextHandler) Handle(ctx context.Context, r slog.Record) error {
+	attrs := ContextAttrs(ctx)
+	if len(attrs) == 0 {
+		return h.full.Handle(ctx, r)
+	}
+	if len(h.ops) > 0 {
+		next := h.base.WithAttrs(attrs)
+		for _, op := range h.ops {
+			if op.group != "" {
+				next = next.WithGroup(op.group)
+			} else {
+				next = next.WithAttrs(op.attrs)
+			}
+		}
+		return next.Handle(ctx, r)
+	}
+	clone := slog.NewRecord(r.Time, r.Level, r.Message, r.PC)
+	clone.AddAttrs(attrs...)
+	r.Attrs(func(attr slog.Attr) bool {
+		clone.AddAttrs(attr)
+		return true
+	})
+	return h.full.Handle(ctx, clone)
+}
+
+func (h *contextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	if len(attrs) == 0 {
+		return h
+	}
+	if len(h.ops) == 0 {
+		base := h.base.WithAttrs(attrs)
+		return &contextHandler{base: base, full: base}
+	}
+	return &contextHandler{
+		base: h.base,
+		full: h.full.WithAttrs(attrs),
+		ops:  append(slices.Clip(h.ops), handlerOp{attrs: attrs}),
+	}
+}
+
+func (h *contextHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+	return &contextHandler{
+		base: h.base,
+		full: h.full.WithGroup(name),
+		ops:  append(slices.Clip(h.ops), handlerOp{group: name}),
+	}
+}
@@ -0,0 +1,87 @@
+// Copyright 2022 The codesjoy Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package logger
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAppendCtx(t *testing.T) {
+	assert.Nil(t, ContextAttrs(context.Background()))
+
+	parent := AppendCtx(context.Background(), slog.String("request_id", "req-1"))
+	child := AppendCtx(parent, slog.String("tenant", "acme"))
+	sibling := AppendCtx(parent, slog.String("user", "alice"))
+
+	assert.Equal(t, []slog.Attr{slog.String("request_id", "req-1")}, ContextAttrs(parent))
+	assert.Equal(
+		t,
+		[]slog.Attr{slog.String("request_id", "req-1"), slog.String("tenant", "acme")},
+		ContextAttrs(child),
+	)
+	assert.Equal(
+		t,
+		[]slog.Attr{slog.String("request_id", "req-1"), slog.String("user", "alice")},
+		ContextAttrs(sibling),
+	)
+	assert.Equal(t, parent, AppendCtx(parent))
+}
+
+func TestJSONHandlerAddsContextAttrs(t *testing.T) {
+	var buf bytes.Buffer
+	h, err := NewJSONHandler(&JSONHandlerConfig{Writer: &buf})
+	require.NoError(t, err)
+	assert.Same(t, h, ContextHandler(h))
+
+	ctx := AppendCtx(context.Background(), slog.String("request_id", "req-1"))
+	slog.New(h).With("component", "test").InfoContext(ctx, "hello", "k", "v")
+
+	got := map[string]any{}
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &got))
+	assert.Equal(t, "req-1", got["request_id"])
+	assert.Equal(t, "test", got["component"])
+	assert.Equal(t, "v", got["k"])
+
+	buf.Reset()
+	slog.New(h).InfoContext(context.Background(), "hello")
+	assert.NotContains(t, buf.String(), "request_id")
+}
+
+func TestContextAttrsStayOutsideGroups(t *testing.T) {
+	var buf bytes.Buffer
+	h := ContextHandler(slog.NewJSONHandler(&buf, nil))
+	ctx := AppendCtx(context.Background(), slog.String("request_id", "req-1"))
+	slog.New(h).With("component", "test").WithGroup("http").With("method", "GET").
+		InfoContext(ctx, "hello", "status", 200)
+
+	got := map[string]any{}
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &got))
+	assert.Equal(t, "req-1", got["request_id"])
+	assert.Equal(t, "test", got["component"])
+	assert.Equal(t, map[string]any{"method": "GET", "status": float64(200)}, got["http"])
+
+	buf.Reset()
+	slog.New(h).WithGroup("http").InfoContext(context.Background(), "hello", "status", 200)
+	got = map[string]any{}
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &got))
+	assert.Equal(t, map[string]any{"status": float64(200)}, got["http"])
+}
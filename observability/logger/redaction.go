@@ -0,0 +1,187 @@
+// Copyright 2022 The codesjoy Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package logger
+
+import (
+	"fmt"
+	"log/slog"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// Builtin value matchers of RedactionConfig.Values.
+const (
+	// RedactCreditCard masks digit sequences passing the Luhn check.
+	RedactCreditCard = "credit_card"
+	// RedactEmail masks email addresses.
+	RedactEmail = "email"
+)
+
+// RedactionConfig masks sensitive values before a handler encodes them, so
+// redaction applies whichever component logged the attribute.
+type RedactionConfig struct {
+	// Keys lists case-insensitive attribute key patterns whose values are
+	// replaced, e.g. "authorization", "set-cookie" or "*_token". A pattern
+	// matches the key itself or its dotted path inside groups.
+	Keys []string `mapstructure:"keys"   yaml:"keys"   json:"keys"`
+	// Values lists matchers masking the matching parts of string values,
+	// including the message: "credit_card", "email" or a regular expression.
+	Values []string `mapstructure:"values" yaml:"values" json:"values"`
+	// Mask replaces redacted values. It defaults to "***".
+	Mask string `mapstructure:"mask"   yaml:"mask"   json:"mask"`
+}
+
+var (
+	creditCardPattern = regexp.MustCompile(`\b\d(?:[ -]?\d){12,18}\b`)
+	emailPattern      = regexp.MustCompile(`[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}`)
+)
+
+type valueMatcher struct {
+	pattern *regexp.Regexp
+	// accept filters the matches of pattern; nil accepts all.
+	accept func(string) bool
+}
+
+type redactor struct {
+	keys   []string
+	values []valueMatcher
+	mask   string
+}
+
+// replaceAttr returns a slog.HandlerOptions.ReplaceAttr function applying
+// the config, or nil when nothing is redacted.
+func (c RedactionConfig) replaceAttr() (func([]string, slog.Attr) slog.Attr, error) {
+	if len(c.Keys) == 0 && len(c.Values) == 0 {
+		return nil, nil
+	}
+	r := &redactor{mask: c.Mask}
+	if r.mask == "" {
+		r.mask = "***"
+	}
+	for _, key := range c.Keys {
+		key = strings.ToLower(key)
+		if _, err := path.Match(key, ""); err != nil {
+			return nil, fmt.Errorf("invalid redaction key pattern %q: %w", key, err)
+		}
+		r.keys = append(r.keys, key)
+	}
+	for _, value := range c.Values {
+		switch value {
+		case RedactCreditCard:
+			r.values = append(r.values, valueMatcher{pattern: creditCardPattern, accept: luhn})
+		case RedactEmail:
+			r.values = append(r.values, valueMatcher{pattern: emailPattern})
+		default:
+			pattern, err := regexp.Compile(value)
+			if err != nil {
+				return nil, fmt.Errorf("invalid redaction value pattern %q: %w", value, err)
+			}
+			r.values = append(r.values, valueMatcher{pattern: pattern})
+		}
+	}
+	return r.replace, nil
+}
+
+func (r *redactor) replace(groups []string, attr slog.Attr) slog.Attr {
+	if len(groups) > 0 || !builtinKey(attr.Key) {
+		if r.sensitiveKey(groups, attr.Key) {
+			return slog.String(attr.Key, r.mask)
+		}
+	}
+	if len(r.values) == 0 {
+		return attr
+	}
+	var s string
+	switch attr.Value.Kind() {
+	case slog.KindString:
+		s = attr.Value.String()
+	case slog.KindAny:
+		switch v := attr.Value.Any().(type) {
+		case error:
+			s = v.Error()
+		case fmt.Stringer:
+			s = v.String()
+		default:
+			return attr
+		}
+	default:
+		return attr
+	}
+	if masked := r.maskValue(s); masked != s {
+		return slog.String(attr.Key, masked)
+	}
+	return attr
+}
+
+func builtinKey(key string) bool {
+	switch key {
+	case slog.TimeKey, slog.LevelKey, slog.SourceKey, slog.MessageKey:
+		return true
+	}
+	return false
+}
+
+func (r *redactor) sensitiveKey(groups []string, key string) bool {
+	key = strings.ToLower(key)
+	full := key
+	if len(groups) > 0 {
+		full = strings.ToLower(strings.Join(groups, ".")) + "." + key
+	}
+	for _, pattern := range r.keys {
+		if ok, _ := path.Match(pattern, key); ok {
+			return true
+		}
+		if full != key {
+			if ok, _ := path.Match(pattern, full); ok {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (r *redactor) maskValue(s string) string {
+	for _, m := range r.values {
+		s = m.pattern.ReplaceAllStringFunc(s, func(match string) string {
+			if m.accept != nil && !m.accept(match) {
+				return match
+			}
+			return r.mask
+		})
+	}
+	return s
+}
+
+// luhn reports whether the digits of s pass the Luhn checksum.
+func luhn(s string) bool {
+	sum, double := 0, false
+	for i := len(s) - 1; i >= 0; i-- {
+		c := s[i]
+		if c < '0' || c > '9' {
+			continue
+		}
+		d := int(c - '0')
+		if double {
+			d *= 2
+			if d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+		double = !double
+	}
+	return sum%10 == 0
+}
@@ -0,0 +1,119 @@
+// Copyright 2022 The codesjoy Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package logger
+
+import (
+	"errors"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+func TestJSONHandlerRedactsKeysAndValues(t *testing.T) {
+	w := &jsonTestWriter{}
+	h, err := NewJSONHandler(&JSONHandlerConfig{
+		Level:  slog.LevelInfo,
+		Writer: w,
+		Redaction: RedactionConfig{
+			Keys:   []string{"Authorization", "set-cookie", "*_token", "user.password"},
+			Values: []string{RedactCreditCard, RedactEmail},
+		},
+	})
+	if err != nil {
+		t.Fatalf("NewJSONHandler() error = %v", err)
+	}
+
+	slog.New(h).Info("contact alice@example.com",
+		slog.String("authorization", "Bearer secret"),
+		slog.String("refresh_token", "abc"),
+		slog.Group("user",
+			slog.String("password", "hunter2"),
+			slog.String("name", "alice"),
+		),
+		slog.String("note", "card 4111 1111 1111 1111 order 1234567890123"),
+		slog.String("from", "bob@example.org"),
+		slog.Any("error", errors.New("rejected carol@example.net")),
+		slog.Int("count", 3),
+	)
+
+	lines := w.Lines()
+	if len(lines) != 1 {
+		t.Fatalf("expected one line, got %d", len(lines))
+	}
+	got := decodeJSONLine(t, lines[0])
+	if got["msg"] != "contact ***" {
+		t.Fatalf("unexpected message: %v", got["msg"])
+	}
+	if got["authorization"] != "***" || got["refresh_token"] != "***" {
+		t.Fatalf("sensitive keys not redacted: %v", got)
+	}
+	user, _ := got["user"].(map[string]any)
+	if user["password"] != "***" || user["name"] != "alice" {
+		t.Fatalf("unexpected user group: %v", user)
+	}
+	if got["note"] != "card *** order 1234567890123" {
+		t.Fatalf("unexpected note: %v", got["note"])
+	}
+	if got["from"] != "***" || got["error"] != "rejected ***" {
+		t.Fatalf("emails not redacted: %v", got)
+	}
+	if got["count"] != float64(3) {
+		t.Fatalf("unexpected count: %v", got["count"])
+	}
+}
+
+func TestConsoleHandlerRedactsWithCustomMask(t *testing.T) {
+	w := &jsonTestWriter{}
+	h, err := NewConsoleHandler(&ConsoleHandlerConfig{
+		Level:  slog.LevelInfo,
+		Writer: w,
+		Redaction: RedactionConfig{
+			Keys:   []string{"set-cookie"},
+			Values: []string{`sk-[a-z0-9]+`},
+			Mask:   "[redacted]",
+		},
+	})
+	if err != nil {
+		t.Fatalf("NewConsoleHandler() error = %v", err)
+	}
+
+	slog.New(h).With(slog.String("Set-Cookie", "session=1")).
+		Info("call", slog.String("key", "use sk-abc123"))
+
+	lines := w.Lines()
+	if len(lines) != 1 {
+		t.Fatalf("expected one line, got %d", len(lines))
+	}
+	if !strings.Contains(lines[0], "Set-Cookie=[redacted]") ||
+		!strings.Contains(lines[0], `key="use [redacted]"`) {
+		t.Fatalf("unexpected output: %q", lines[0])
+	}
+	if strings.Contains(lines[0], "session=1") || strings.Contains(lines[0], "sk-abc123") {
+		t.Fatalf("secret leaked: %q", lines[0])
+	}
+}
+
+func TestRedactionConfigInvalidPattern(t *testing.T) {
+	if _, err := NewJSONHandler(&JSONHandlerConfig{
+		Redaction: RedactionConfig{Values: []string{"("}},
+	}); err == nil {
+		t.Fatal("expected error for invalid value pattern")
+	}
+	if _, err := NewConsoleHandler(&ConsoleHandlerConfig{
+		Redaction: RedactionConfig{Keys: []string{"["}},
+	}); err == nil {
+		t.Fatal("expected error for invalid key pattern")
+	}
+}
@@ -0,0 +1,131 @@
+// Copyright 2022 The codesjoy Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package process
+
+import (
+	"bufio"
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// unlimitedV1 bounds the limits cgroup v1 reports for unlimited memory,
+// which are the largest page-aligned int64.
+const unlimitedV1 = 1 << 62
+
+// cgroups reads the limits of the cgroup of the process. Only the cgroup
+// v2 hierarchy of the process is followed; cgroup v1 controllers are read at
+// the mount points, which is where containers see their own cgroup.
+type cgroups struct {
+	// root is the cgroup mount point.
+	root string
+	// self is the cgroup membership file of the process.
+	self string
+}
+
+var hostCgroups = cgroups{root: "/sys/fs/cgroup", self: "/proc/self/cgroup"}
+
+// cpuQuota returns the CPU quota in CPUs.
+func (c cgroups) cpuQuota() (float64, bool) {
+	if line, ok := c.readV2("cpu.max"); ok {
+		fields := strings.Fields(line)
+		if len(fields) != 2 || fields[0] == "max" {
+			return 0, false
+		}
+		return quota(fields[0], fields[1])
+	}
+	for _, dir := range []string{"cpu", "cpu,cpuacct"} {
+		q, err := os.ReadFile(filepath.Join(c.root, dir, "cpu.cfs_quota_us"))
+		if err != nil {
+			continue
+		}
+		p, err := os.ReadFile(filepath.Join(c.root, dir, "cpu.cfs_period_us"))
+		if err != nil {
+			continue
+		}
+		return quota(strings.TrimSpace(string(q)), strings.TrimSpace(string(p)))
+	}
+	return 0, false
+}
+
+func quota(quota, period string) (float64, bool) {
+	q, err := strconv.ParseFloat(quota, 64)
+	if err != nil || q <= 0 {
+		return 0, false
+	}
+	p, err := strconv.ParseFloat(period, 64)
+	if err != nil || p <= 0 {
+		return 0, false
+	}
+	return q / p, true
+}
+
+// memoryLimit returns the memory limit in bytes.
+func (c cgroups) memoryLimit() (int64, bool) {
+	line, ok := c.readV2("memory.max")
+	if !ok {
+		data, err := os.ReadFile(filepath.Join(c.root, "memory", "memory.limit_in_bytes"))
+		if err != nil {
+			return 0, false
+		}
+		line = strings.TrimSpace(string(data))
+	}
+	if line == "max" {
+		return 0, false
+	}
+	limit, err := strconv.ParseInt(line, 10, 64)
+	if err != nil || limit <= 0 || limit >= unlimitedV1 {
+		return 0, false
+	}
+	return limit, true
+}
+
+// readV2 reads the first line of a cgroup v2 interface file, looking in the
+// cgroup of the process first and at the root second.
+func (c cgroups) readV2(name string) (string, bool) {
+	dirs := []string{c.root}
+	if path, err := c.v2Path(); err == nil && path != "/" {
+		dirs = append([]string{filepath.Join(c.root, path)}, dirs...)
+	}
+	for _, dir := range dirs {
+		data, err := os.ReadFile(filepath.Join(dir, name))
+		if err == nil {
+			line, _, _ := strings.Cut(string(data), "\n")
+			return strings.TrimSpace(line), true
+		}
+	}
+	return "", false
+}
+
+// v2Path returns the cgroup v2 path of the process, listed as "0::<path>".
+func (c cgroups) v2Path() (string, error) {
+	f, err := os.Open(c.self)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if path, ok := strings.CutPrefix(scanner.Text(), "0::"); ok {
+			return path, nil
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return "", err
+	}
+	return "", errors.New("no cgroup v2 membership")
+}
@@ -0,0 +1,64 @@
+// Copyright 2022 The codesjoy Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package process
+
+import (
+	"log/slog"
+	"math"
+	"os"
+	"runtime"
+	"runtime/debug"
+)
+
+// applyLimits adapts the soft memory limit and, when enabled, GOMAXPROCS to
+// the limits of cg and returns the function undoing it.
+func applyLimits(cfg Config, cg cgroups) (restore func()) {
+	var undo []func()
+	if cfg.MaxProcs && os.Getenv("GOMAXPROCS") == "" {
+		if cpus, ok := cg.cpuQuota(); ok {
+			procs := max(int(math.Floor(cpus)), 1)
+			if prev := runtime.GOMAXPROCS(0); procs != prev {
+				runtime.GOMAXPROCS(procs)
+				// Hand GOMAXPROCS back to the runtime, which then follows
+				// changes of the quota again.
+				undo = append(undo, runtime.SetDefaultGOMAXPROCS)
+				slog.Info("set GOMAXPROCS from the cgroup CPU quota",
+					slog.Float64("quota", cpus),
+					slog.Int("from", prev),
+					slog.Int("to", procs))
+			}
+		}
+	}
+	if !cfg.DisableMemoryLimit && os.Getenv("GOMEMLIMIT") == "" &&
+		debug.SetMemoryLimit(-1) == math.MaxInt64 {
+		if limit, ok := cg.memoryLimit(); ok {
+			ratio := cfg.MemoryLimitRatio
+			if ratio <= 0 || ratio > 1 {
+				ratio = 0.9
+			}
+			soft := int64(float64(limit) * ratio)
+			prev := debug.SetMemoryLimit(soft)
+			undo = append(undo, func() { debug.SetMemoryLimit(prev) })
+			slog.Info("set the soft memory limit from the cgroup memory limit",
+				slog.Int64("limit", limit),
+				slog.Int64("soft_limit", soft))
+		}
+	}
+	return func() {
+		for _, fn := range undo {
+			fn()
+		}
+	}
+}
@@ -0,0 +1,237 @@
+// Copyright 2022 The codesjoy Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package process
+
+import (
+	"context"
+	"math"
+	"runtime/metrics"
+	"sync"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+// The runtime/metrics samples read on every collection.
+const (
+	sampleGoroutines = "/sched/goroutines:goroutines"
+	sampleProcs      = "/sched/gomaxprocs:threads"
+	sampleTotal      = "/memory/classes/total:bytes"
+	sampleReleased   = "/memory/classes/heap/released:bytes"
+	sampleHeap       = "/memory/classes/heap/objects:bytes"
+	sampleGoal       = "/gc/heap/goal:bytes"
+	sampleLimit      = "/gc/gomemlimit:bytes"
+	sampleAllocs     = "/gc/heap/allocs:bytes"
+	sampleCycles     = "/gc/cycles/total:gc-cycles"
+	sampleGCPauses   = "/sched/pauses/total/gc:seconds"
+	sampleLatencies  = "/sched/latencies:seconds"
+)
+
+// quantiles are reported for the GC pauses and scheduling latencies since
+// the previous collection.
+var quantiles = []float64{0.5, 0.9, 0.99}
+
+// runtimeCollector reads the runtime metrics and turns their cumulative
+// histograms into the distribution since the previous collection.
+type runtimeCollector struct {
+	mu      sync.Mutex
+	samples []metrics.Sample
+	index   map[string]int
+	prev    map[string][]uint64
+}
+
+func newRuntimeCollector() *runtimeCollector {
+	names := []string{
+		sampleGoroutines, sampleProcs, sampleTotal, sampleReleased, sampleHeap,
+		sampleGoal, sampleLimit, sampleAllocs, sampleCycles, sampleGCPauses,
+		sampleLatencies,
+	}
+	c := &runtimeCollector{
+		samples: make([]metrics.Sample, len(names)),
+		index:   make(map[string]int, len(names)),
+		prev:    map[string][]uint64{},
+	}
+	for i, name := range names {
+		c.samples[i].Name = name
+		c.index[name] = i
+	}
+	return c
+}
+
+func (c *runtimeCollector) uint64(name string) (int64, bool) {
+	value := c.samples[c.index[name]].Value
+	if value.Kind() != metrics.KindUint64 {
+		return 0, false
+	}
+	return int64(min(value.Uint64(), math.MaxInt64)), true
+}
+
+// quantiles returns the quantiles of the histogram name observed since the
+// previous call. It reports false when nothing was observed.
+func (c *runtimeCollector) quantiles(name string) ([]float64, bool) {
+	value := c.samples[c.index[name]].Value
+	if value.Kind() != metrics.KindFloat64Histogram {
+		return nil, false
+	}
+	h := value.Float64Histogram()
+	prev := c.prev[name]
+	delta := make([]uint64, len(h.Counts))
+	var total uint64
+	for i, n := range h.Counts {
+		if i < len(prev) {
+			n -= prev[i]
+		}
+		delta[i] = n
+		total += n
+	}
+	c.prev[name] = append(prev[:0], h.Counts...)
+	if total == 0 {
+		return nil, false
+	}
+	return histogramQuantiles(h.Buckets, delta, total, quantiles), true
+}
+
+// histogramQuantiles returns the upper bounds of the buckets holding qs,
+// or the lower bound of an unbounded bucket.
+func histogramQuantiles(buckets []float64, counts []uint64, total uint64, qs []float64) []float64 {
+	out := make([]float64, 0, len(qs))
+	var seen uint64
+	i := 0
+	for _, q := range qs {
+		rank := uint64(math.Ceil(q * float64(total)))
+		for i < len(counts)-1 && seen+counts[i] < rank {
+			seen += counts[i]
+			i++
+		}
+		bound := buckets[i+1]
+		if math.IsInf(bound, 1) {
+			bound = buckets[i]
+		}
+		out = append(out, bound)
+	}
+	return out
+}
+
+// registerRuntimeMetrics reports the Go runtime metrics through provider,
+// following the OpenTelemetry semantic conventions for Go where they exist.
+func registerRuntimeMetrics(provider metric.MeterProvider) (metric.Registration, error) {
+	meter := provider.Meter("github.com/codesjoy/yggdrasil/v3",
+		metric.WithInstrumentationVersion("yggdrasil"),
+	)
+	goroutines, err := meter.Int64ObservableUpDownCounter("go.goroutine.count",
+		metric.WithDescription("Count of live goroutines."),
+		metric.WithUnit("{goroutine}"))
+	if err != nil {
+		return nil, err
+	}
+	procs, err := meter.Int64ObservableUpDownCounter("go.processor.limit",
+		metric.WithDescription(
+			"The number of OS threads that can execute user-level Go code simultaneously."),
+		metric.WithUnit("{thread}"))
+	if err != nil {
+		return nil, err
+	}
+	used, err := meter.Int64ObservableUpDownCounter("go.memory.used",
+		metric.WithDescription("Memory used by the Go runtime."),
+		metric.WithUnit("By"))
+	if err != nil {
+		return nil, err
+	}
+	heap, err := meter.Int64ObservableUpDownCounter("go.memory.heap",
+		metric.WithDescription("Memory occupied by live and not yet swept heap objects."),
+		metric.WithUnit("By"))
+	if err != nil {
+		return nil, err
+	}
+	goal, err := meter.Int64ObservableUpDownCounter("go.memory.gc.goal",
+		metric.WithDescription("Heap size target for the end of the GC cycle."),
+		metric.WithUnit("By"))
+	if err != nil {
+		return nil, err
+	}
+	limit, err := meter.Int64ObservableUpDownCounter("go.memory.limit",
+		metric.WithDescription("Go runtime soft memory limit, if set."),
+		metric.WithUnit("By"))
+	if err != nil {
+		return nil, err
+	}
+	allocated, err := meter.Int64ObservableCounter("go.memory.allocated",
+		metric.WithDescription("Memory allocated to the heap by the application."),
+		metric.WithUnit("By"))
+	if err != nil {
+		return nil, err
+	}
+	cycles, err := meter.Int64ObservableCounter("go.gc.cycles",
+		metric.WithDescription("Count of completed GC cycles."),
+		metric.WithUnit("{cycle}"))
+	if err != nil {
+		return nil, err
+	}
+	pauses, err := meter.Float64ObservableGauge("go.gc.pause.duration",
+		metric.WithDescription(
+			"Quantiles of the GC stop-the-world pauses since the previous collection."),
+		metric.WithUnit("s"))
+	if err != nil {
+		return nil, err
+	}
+	latencies, err := meter.Float64ObservableGauge("go.schedule.duration",
+		metric.WithDescription("Quantiles of the time goroutines spent runnable before running, "+
+			"since the previous collection."),
+		metric.WithUnit("s"))
+	if err != nil {
+		return nil, err
+	}
+
+	c := newRuntimeCollector()
+	gauges := map[string]metric.Int64Observable{
+		sampleGoroutines: goroutines,
+		sampleProcs:      procs,
+		sampleHeap:       heap,
+		sampleGoal:       goal,
+		sampleAllocs:     allocated,
+		sampleCycles:     cycles,
+	}
+	return meter.RegisterCallback(func(_ context.Context, o metric.Observer) error {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		metrics.Read(c.samples)
+		for name, instrument := range gauges {
+			if v, ok := c.uint64(name); ok {
+				o.ObserveInt64(instrument, v)
+			}
+		}
+		if total, ok := c.uint64(sampleTotal); ok {
+			released, _ := c.uint64(sampleReleased)
+			o.ObserveInt64(used, total-released)
+		}
+		if v, ok := c.uint64(sampleLimit); ok && v < math.MaxInt64 {
+			o.ObserveInt64(limit, v)
+		}
+		for name, instrument := range map[string]metric.Float64Observable{
+			sampleGCPauses:  pauses,
+			sampleLatencies: latencies,
+		} {
+			values, ok := c.quantiles(name)
+			if !ok {
+				continue
+			}
+			for i, v := range values {
+				o.ObserveFloat64(instrument, v, metric.WithAttributes(
+					attribute.Float64("quantile", quantiles[i])))
+			}
+		}
+		return nil
+	}, goroutines, procs, used, heap, goal, limit, allocated, cycles, pauses, latencies)
+}
@@ -0,0 +1,112 @@
+// Copyright 2022 The codesjoy Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package process makes services behave well in constrained containers.
+//
+// Its module exports the Go runtime metrics: garbage collection, heap,
+// goroutines and scheduling latency. It also adapts the runtime to the limits
+// of the cgroup the process runs in: the soft memory limit (GOMEMLIMIT)
+// follows the memory limit and, when enabled, GOMAXPROCS follows the CPU
+// quota rounded down. Limits set through the GOMAXPROCS and GOMEMLIMIT
+// environment variables are left alone, and every part is configured under
+// yggdrasil.process.
+package process
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/metric"
+
+	"github.com/codesjoy/yggdrasil/v3/config"
+	"github.com/codesjoy/yggdrasil/v3/module"
+)
+
+const (
+	// ModuleName is the name of the process module.
+	ModuleName = "process"
+	// ConfigPath is the config path holding the process settings.
+	ConfigPath = "yggdrasil.process"
+)
+
+// Config defines the process settings under ConfigPath.
+type Config struct {
+	// DisableMetrics stops exporting the Go runtime metrics.
+	DisableMetrics bool `mapstructure:"disable_metrics"`
+	// MaxProcs sets GOMAXPROCS to the cgroup CPU quota rounded down. Since
+	// Go 1.25 the runtime already follows the quota, rounded up, so this is
+	// only needed to trade throughput for less CPU throttling.
+	MaxProcs bool `mapstructure:"maxprocs"`
+	// DisableMemoryLimit leaves the soft memory limit unset when the cgroup
+	// limits the memory of the process.
+	DisableMemoryLimit bool `mapstructure:"disable_memory_limit"`
+	// MemoryLimitRatio is the share of the cgroup memory limit used as the
+	// soft memory limit, leaving headroom for memory the Go runtime does not
+	// manage.
+	MemoryLimitRatio float64 `mapstructure:"memory_limit_ratio" default:"0.9"`
+}
+
+type processModule struct {
+	mu      sync.Mutex
+	restore func()
+	metrics metric.Registration
+}
+
+// Module returns the module applying the settings under ConfigPath. It
+// adapts the soft memory limit, and GOMAXPROCS when enabled, when it
+// initializes, restores them when it stops, and exports the runtime metrics
+// in between.
+func Module() module.Module {
+	return &processModule{}
+}
+
+func (m *processModule) Name() string { return ModuleName }
+
+func (m *processModule) ConfigPath() string { return ConfigPath }
+
+func (m *processModule) Init(_ context.Context, view config.View) error {
+	cfg := Config{}
+	if err := view.Decode(&cfg); err != nil {
+		return fmt.Errorf("load process config: %w", err)
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.restore = applyLimits(cfg, hostCgroups)
+	if !cfg.DisableMetrics {
+		registration, err := registerRuntimeMetrics(otel.GetMeterProvider())
+		if err != nil {
+			otel.Handle(err)
+		}
+		m.metrics = registration
+	}
+	return nil
+}
+
+func (m *processModule) Stop(context.Context) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.restore != nil {
+		m.restore()
+		m.restore = nil
+	}
+	if m.metrics != nil {
+		if err := m.metrics.Unregister(); err != nil {
+			otel.Handle(err)
+		}
+		m.metrics = nil
+	}
+	return nil
+}
@@ -0,0 +1,184 @@
+// Copyright 2022 The codesjoy Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package process
+
+import (
+	"context"
+	"math"
+	"os"
+	"path/filepath"
+	"runtime"
+	"runtime/debug"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+
+	"github.com/codesjoy/yggdrasil/v3/config"
+	"github.com/codesjoy/yggdrasil/v3/module"
+)
+
+// fakeCgroups lays out files below a temporary cgroup root.
+func fakeCgroups(t *testing.T, self string, files map[string]string) cgroups {
+	t.Helper()
+	dir := t.TempDir()
+	cg := cgroups{root: filepath.Join(dir, "cgroup"), self: filepath.Join(dir, "self")}
+	require.NoError(t, os.WriteFile(cg.self, []byte(self), 0o600))
+	for name, content := range files {
+		path := filepath.Join(cg.root, name)
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0o700))
+		require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+	}
+	return cg
+}
+
+func TestCgroupsV2(t *testing.T) {
+	cg := fakeCgroups(t, "0::/kubepods/pod1\n", map[string]string{
+		"kubepods/pod1/cpu.max":    "250000 100000\n",
+		"kubepods/pod1/memory.max": "536870912\n",
+		"cpu.max":                  "max 100000\n",
+	})
+	cpus, ok := cg.cpuQuota()
+	require.True(t, ok)
+	assert.Equal(t, 2.5, cpus)
+	limit, ok := cg.memoryLimit()
+	require.True(t, ok)
+	assert.Equal(t, int64(512<<20), limit)
+
+	// The root files apply when the cgroup of the process has none.
+	cg = fakeCgroups(t, "0::/\n", map[string]string{
+		"cpu.max":    "max 100000\n",
+		"memory.max": "max\n",
+	})
+	_, ok = cg.cpuQuota()
+	assert.False(t, ok)
+	_, ok = cg.memoryLimit()
+	assert.False(t, ok)
+}
+
+func TestCgroupsV1(t *testing.T) {
+	cg := fakeCgroups(t, "4:cpu,cpuacct:/\n", map[string]string{
+		"cpu,cpuacct/cpu.cfs_quota_us":    "50000\n",
+		"cpu,cpuacct/cpu.cfs_period_us":   "100000\n",
+		"memory/memory.limit_in_bytes":    "1073741824\n",
+		"unrelated/memory.limit_in_bytes": "1\n",
+	})
+	cpus, ok := cg.cpuQuota()
+	require.True(t, ok)
+	assert.Equal(t, 0.5, cpus)
+	limit, ok := cg.memoryLimit()
+	require.True(t, ok)
+	assert.Equal(t, int64(1<<30), limit)
+
+	cg = fakeCgroups(t, "", map[string]string{
+		"cpu/cpu.cfs_quota_us":         "-1\n",
+		"cpu/cpu.cfs_period_us":        "100000\n",
+		"memory/memory.limit_in_bytes": "9223372036854771712\n",
+	})
+	_, ok = cg.cpuQuota()
+	assert.False(t, ok)
+	_, ok = cg.memoryLimit()
+	assert.False(t, ok)
+}
+
+func TestApplyLimits(t *testing.T) {
+	if os.Getenv("GOMAXPROCS") != "" || os.Getenv("GOMEMLIMIT") != "" {
+		t.Skip("the runtime limits are set by the environment")
+	}
+	t.Setenv("GOMAXPROCS", "")
+	t.Setenv("GOMEMLIMIT", "")
+	procs := runtime.GOMAXPROCS(0)
+	memLimit := debug.SetMemoryLimit(-1)
+	require.Equal(t, int64(math.MaxInt64), memLimit, "the test needs an unset memory limit")
+	cg := fakeCgroups(t, "0::/\n", map[string]string{
+		"cpu.max":    "150000 100000\n",
+		"memory.max": "1000000000\n",
+	})
+
+	restore := applyLimits(Config{MaxProcs: true, MemoryLimitRatio: 0.5}, cg)
+	assert.Equal(t, 1, runtime.GOMAXPROCS(0), "the quota is rounded down")
+	assert.Equal(t, int64(500000000), debug.SetMemoryLimit(-1))
+	restore()
+	assert.Equal(t, procs, runtime.GOMAXPROCS(0))
+	assert.Equal(t, memLimit, debug.SetMemoryLimit(-1))
+
+	restore = applyLimits(Config{DisableMemoryLimit: true}, cg)
+	assert.Equal(t, procs, runtime.GOMAXPROCS(0))
+	assert.Equal(t, memLimit, debug.SetMemoryLimit(-1))
+	restore()
+
+	t.Setenv("GOMEMLIMIT", "1GiB")
+	restore = applyLimits(Config{}, cg)
+	assert.Equal(t, memLimit, debug.SetMemoryLimit(-1), "GOMEMLIMIT wins")
+	restore()
+}
+
+func TestHistogramQuantiles(t *testing.T) {
+	buckets := []float64{0, 1, 2, 4, math.Inf(1)}
+	assert.Equal(t,
+		[]float64{1, 4, 4},
+		histogramQuantiles(buckets, []uint64{6, 0, 4, 0}, 10, []float64{0.5, 0.9, 0.99}))
+	assert.Equal(t,
+		[]float64{2, 4},
+		histogramQuantiles(buckets, []uint64{0, 1, 0, 1}, 2, []float64{0.5, 1}))
+}
+
+func TestRuntimeMetrics(t *testing.T) {
+	reader := sdkmetric.NewManualReader()
+	provider := sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader))
+	registration, err := registerRuntimeMetrics(provider)
+	require.NoError(t, err)
+
+	runtime.GC()
+	var rm metricdata.ResourceMetrics
+	require.NoError(t, reader.Collect(context.Background(), &rm))
+	names := map[string]bool{}
+	sums := map[string]int64{}
+	for _, sm := range rm.ScopeMetrics {
+		for _, m := range sm.Metrics {
+			names[m.Name] = true
+			if sum, ok := m.Data.(metricdata.Sum[int64]); ok && len(sum.DataPoints) == 1 {
+				sums[m.Name] = sum.DataPoints[0].Value
+			}
+		}
+	}
+	assert.Positive(t, sums["go.goroutine.count"])
+	assert.Equal(t, int64(runtime.GOMAXPROCS(0)), sums["go.processor.limit"])
+	assert.Positive(t, sums["go.memory.used"])
+	assert.Positive(t, sums["go.gc.cycles"])
+	assert.True(t, names["go.gc.pause.duration"])
+	assert.True(t, names["go.schedule.duration"])
+
+	require.NoError(t, registration.Unregister())
+}
+
+func TestModule(t *testing.T) {
+	m := Module()
+	assert.Equal(t, ModuleName, m.Name())
+	assert.Equal(t, ConfigPath, m.(module.Configurable).ConfigPath())
+
+	procs := runtime.GOMAXPROCS(0)
+	require.NoError(t, m.(module.Initializable).Init(context.Background(),
+		config.NewView(ConfigPath, config.NewSnapshot(map[string]any{
+			"disable_memory_limit": true,
+		}))))
+	assert.NotNil(t, m.(*processModule).metrics)
+	require.NoError(t, m.(module.Stoppable).Stop(context.Background()))
+	require.NoError(t, m.(module.Stoppable).Stop(context.Background()))
+	assert.Nil(t, m.(*processModule).metrics)
+	assert.Equal(t, procs, runtime.GOMAXPROCS(0))
+}
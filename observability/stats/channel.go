@@ -15,6 +15,8 @@
 // Package stats defines the stats of a transport connection.
 package stats
 
+import "time"
+
 // ChanTagInfo defines the relevant information needed by connection context tagger.
 type ChanTagInfo interface {
 	GetProtocol() string
@@ -53,6 +55,8 @@ type ChanStats interface {
 // ChanBegin defines the stats of a transport connection when it begins.
 type ChanBegin interface {
 	ChanStats
+	// GetBeginTime returns the time when the connection was established.
+	GetBeginTime() time.Time
 	isBegin()
 }
 
@@ -60,16 +64,32 @@ type ChanBegin interface {
 type ChanBeginBase struct {
 	// Client is true if this ConnBegin is from client side.
 	Client bool
+	// BeginTime is the time when the connection was established.
+	BeginTime time.Time
 }
 
 // IsClient indicates if this is from client side.
 func (s *ChanBeginBase) IsClient() bool { return s.Client }
-func (s *ChanBeginBase) isChanStats()   {}
-func (s *ChanBeginBase) isBegin()       {}
 
-// ChanEnd defines the stats of a transport connection when it ends.
+// GetBeginTime returns the time when the connection was established.
+func (s *ChanBeginBase) GetBeginTime() time.Time { return s.BeginTime }
+func (s *ChanBeginBase) isChanStats()            {}
+func (s *ChanBeginBase) isBegin()                {}
+
+// ChanEnd defines the stats of a transport connection when it ends. The
+// counters are the totals over the life of the connection.
 type ChanEnd interface {
 	ChanStats
+	// GetBeginTime returns the time when the connection was established.
+	GetBeginTime() time.Time
+	// GetEndTime returns the time when the connection was closed.
+	GetEndTime() time.Time
+	// GetBytesIn returns the bytes received on the connection.
+	GetBytesIn() int64
+	// GetBytesOut returns the bytes sent on the connection.
+	GetBytesOut() int64
+	// GetStreams returns the number of streams started on the connection.
+	GetStreams() int64
 	isEnd()
 }
 
@@ -77,9 +97,119 @@ type ChanEnd interface {
 type ChanEndBase struct {
 	// Client is true if this ConnEnd is from client side.
 	Client bool
+	// BeginTime is the time when the connection was established.
+	BeginTime time.Time
+	// EndTime is the time when the connection was closed.
+	EndTime time.Time
+	// BytesIn is the number of bytes received on the connection.
+	BytesIn int64
+	// BytesOut is the number of bytes sent on the connection.
+	BytesOut int64
+	// Streams is the number of streams started on the connection.
+	Streams int64
 }
 
 // IsClient indicates if this is from client side.
 func (s *ChanEndBase) IsClient() bool { return s.Client }
-func (s *ChanEndBase) isChanStats()   {}
-func (s *ChanEndBase) isEnd()         {}
+
+// GetBeginTime returns the time when the connection was established.
+func (s *ChanEndBase) GetBeginTime() time.Time { return s.BeginTime }
+
+// GetEndTime returns the time when the connection was closed.
+func (s *ChanEndBase) GetEndTime() time.Time { return s.EndTime }
+
+// GetBytesIn returns the bytes received on the connection.
+func (s *ChanEndBase) GetBytesIn() int64 { return s.BytesIn }
+
+// GetBytesOut returns the bytes sent on the connection.
+func (s *ChanEndBase) GetBytesOut() int64 { return s.BytesOut }
+
+// GetStreams returns the number of streams started on the connection.
+func (s *ChanEndBase) GetStreams() int64 { return s.Streams }
+func (s *ChanEndBase) isChanStats()      {}
+func (s *ChanEndBase) isEnd()            {}
+
+// ChanInPayload defines the stats of bytes received on a transport
+// connection, e.g. the headers, messages and trailers of one of its streams.
+type ChanInPayload interface {
+	ChanStats
+	// GetTransportSize returns the number of bytes received.
+	GetTransportSize() int
+	isInPayload()
+}
+
+// ChanInPayloadBase defines the stats of bytes received on a transport
+// connection.
+type ChanInPayloadBase struct {
+	// Client is true if this InPayload is from client side.
+	Client bool
+	// TransportSize is the number of bytes received.
+	TransportSize int
+}
+
+// IsClient indicates if this is from client side.
+func (s *ChanInPayloadBase) IsClient() bool { return s.Client }
+
+// GetTransportSize returns the number of bytes received.
+func (s *ChanInPayloadBase) GetTransportSize() int { return s.TransportSize }
+func (s *ChanInPayloadBase) isChanStats()          {}
+func (s *ChanInPayloadBase) isInPayload()          {}
+
+// ChanOutPayload defines the stats of bytes sent on a transport connection.
+type ChanOutPayload interface {
+	ChanStats
+	// GetTransportSize returns the number of bytes sent.
+	GetTransportSize() int
+	isOutPayload()
+}
+
+// ChanOutPayloadBase defines the stats of bytes sent on a transport
+// connection.
+type ChanOutPayloadBase struct {
+	// Client is true if this OutPayload is from client side.
+	Client bool
+	// TransportSize is the number of bytes sent.
+	TransportSize int
+}
+
+// IsClient indicates if this is from client side.
+func (s *ChanOutPayloadBase) IsClient() bool { return s.Client }
+
+// GetTransportSize returns the number of bytes sent.
+func (s *ChanOutPayloadBase) GetTransportSize() int { return s.TransportSize }
+func (s *ChanOutPayloadBase) isChanStats()          {}
+func (s *ChanOutPayloadBase) isOutPayload()         {}
+
+// ChanStreams defines the stats of a stream starting or ending on a
+// transport connection.
+type ChanStreams interface {
+	ChanStats
+	// IsBegin returns true when a stream started and false when one ended.
+	IsBegin() bool
+	// GetActiveStreams returns the streams open on the connection after
+	// this event.
+	GetActiveStreams() int64
+	isStreams()
+}
+
+// ChanStreamsBase defines the stats of a stream starting or ending on a
+// transport connection.
+type ChanStreamsBase struct {
+	// Client is true if this event is from client side.
+	Client bool
+	// Begin is true when a stream started and false when one ended.
+	Begin bool
+	// ActiveStreams is the number of streams open after this event.
+	ActiveStreams int64
+}
+
+// IsClient indicates if this is from client side.
+func (s *ChanStreamsBase) IsClient() bool { return s.Client }
+
+// IsBegin returns true when a stream started and false when one ended.
+func (s *ChanStreamsBase) IsBegin() bool { return s.Begin }
+
+// GetActiveStreams returns the streams open on the connection.
+func (s *ChanStreamsBase) GetActiveStreams() int64 { return s.ActiveStreams }
+func (s *ChanStreamsBase) isChanStats()            {}
+func (s *ChanStreamsBase) isStreams()              {}
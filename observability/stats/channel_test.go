@@ -16,6 +16,7 @@ package stats
 
 import (
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -116,3 +117,38 @@ func TestChanTagInfoInterface(t *testing.T) {
 		assert.Equal(t, "https", info.GetProtocol())
 	})
 }
+
+func TestChanTrafficStats(t *testing.T) {
+	begin := time.Unix(100, 0)
+	end := &ChanEndBase{
+		BeginTime: begin,
+		EndTime:   begin.Add(time.Minute),
+		BytesIn:   10,
+		BytesOut:  20,
+		Streams:   3,
+	}
+	assert.Equal(t, begin, end.GetBeginTime())
+	assert.Equal(t, time.Minute, end.GetEndTime().Sub(end.GetBeginTime()))
+	assert.Equal(t, int64(10), end.GetBytesIn())
+	assert.Equal(t, int64(20), end.GetBytesOut())
+	assert.Equal(t, int64(3), end.GetStreams())
+
+	var cs ChanStats = &ChanInPayloadBase{Client: true, TransportSize: 5}
+	in, ok := cs.(ChanInPayload)
+	assert.True(t, ok)
+	assert.True(t, in.IsClient())
+	assert.Equal(t, 5, in.GetTransportSize())
+	_, ok = cs.(ChanOutPayload)
+	assert.False(t, ok)
+
+	cs = &ChanOutPayloadBase{TransportSize: 7}
+	out, ok := cs.(ChanOutPayload)
+	assert.True(t, ok)
+	assert.Equal(t, 7, out.GetTransportSize())
+
+	cs = &ChanStreamsBase{Begin: true, ActiveStreams: 2}
+	streams, ok := cs.(ChanStreams)
+	assert.True(t, ok)
+	assert.True(t, streams.IsBegin())
+	assert.Equal(t, int64(2), streams.GetActiveStreams())
+}
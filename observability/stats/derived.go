@@ -0,0 +1,205 @@
+// Copyright 2022 The codesjoy Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package stats
+
+import (
+	"context"
+	"time"
+)
+
+// DerivedSettings enables events derived from the raw RPC stats.
+type DerivedSettings struct {
+	// PayloadSizeThreshold reports RPCPayloadTooLarge for payloads of at
+	// least this many bytes. Zero disables the event.
+	PayloadSizeThreshold int `mapstructure:"payload_size_threshold"`
+	// DeadlineBudgetThreshold reports RPCDeadlineAlmostExceeded when an RPC
+	// ends with less than this fraction of its deadline budget left, e.g.
+	// 0.1 for 10%. Zero disables the event.
+	DeadlineBudgetThreshold float64 `mapstructure:"deadline_budget_threshold"`
+}
+
+func (s DerivedSettings) enabled() bool {
+	return s.PayloadSizeThreshold > 0 || s.DeadlineBudgetThreshold > 0
+}
+
+// RPCPayloadTooLarge is reported after a payload reaching the configured
+// size threshold.
+type RPCPayloadTooLarge interface {
+	RPCStats
+	// IsClient returns true if this event is from client side.
+	IsClient() bool
+	// IsInbound returns true for received payloads.
+	IsInbound() bool
+	// GetFullMethod returns the full RPC method string.
+	GetFullMethod() string
+	// GetSize returns the payload size on the wire.
+	GetSize() int
+	// GetThreshold returns the configured size threshold.
+	GetThreshold() int
+}
+
+// RPCPayloadTooLargeBase contains the stats of a payload over the size threshold.
+type RPCPayloadTooLargeBase struct {
+	// Client is true if this event is from client side.
+	Client bool
+	// Inbound is true for received payloads.
+	Inbound bool
+	// FullMethod is the full RPC method string, i.e., /package.service/method.
+	FullMethod string
+	// Size is the payload size on the wire.
+	Size int
+	// Threshold is the configured size threshold.
+	Threshold int
+}
+
+func (s *RPCPayloadTooLargeBase) isRPCStats() {}
+
+// IsClient returns true if this event is from client side.
+func (s *RPCPayloadTooLargeBase) IsClient() bool { return s.Client }
+
+// IsInbound returns true for received payloads.
+func (s *RPCPayloadTooLargeBase) IsInbound() bool { return s.Inbound }
+
+// GetFullMethod returns the full RPC method string.
+func (s *RPCPayloadTooLargeBase) GetFullMethod() string { return s.FullMethod }
+
+// GetSize returns the payload size on the wire.
+func (s *RPCPayloadTooLargeBase) GetSize() int { return s.Size }
+
+// GetThreshold returns the configured size threshold.
+func (s *RPCPayloadTooLargeBase) GetThreshold() int { return s.Threshold }
+
+// RPCDeadlineAlmostExceeded is reported after an RPC that ended with less
+// than the configured fraction of its deadline budget left.
+type RPCDeadlineAlmostExceeded interface {
+	RPCStats
+	// IsClient returns true if this event is from client side.
+	IsClient() bool
+	// GetFullMethod returns the full RPC method string.
+	GetFullMethod() string
+	// GetBudget returns the time between the RPC begin and its deadline.
+	GetBudget() time.Duration
+	// GetRemaining returns the time left until the deadline when the RPC
+	// ended. It is negative when the deadline was missed.
+	GetRemaining() time.Duration
+}
+
+// RPCDeadlineAlmostExceededBase contains the stats of an RPC that used up
+// most of its deadline budget.
+type RPCDeadlineAlmostExceededBase struct {
+	// Client is true if this event is from client side.
+	Client bool
+	// FullMethod is the full RPC method string, i.e., /package.service/method.
+	FullMethod string
+	// Budget is the time between the RPC begin and its deadline.
+	Budget time.Duration
+	// Remaining is the time left until the deadline when the RPC ended.
+	Remaining time.Duration
+}
+
+func (s *RPCDeadlineAlmostExceededBase) isRPCStats() {}
+
+// IsClient returns true if this event is from client side.
+func (s *RPCDeadlineAlmostExceededBase) IsClient() bool { return s.Client }
+
+// GetFullMethod returns the full RPC method string.
+func (s *RPCDeadlineAlmostExceededBase) GetFullMethod() string { return s.FullMethod }
+
+// GetBudget returns the time between the RPC begin and its deadline.
+func (s *RPCDeadlineAlmostExceededBase) GetBudget() time.Duration { return s.Budget }
+
+// GetRemaining returns the time left until the deadline when the RPC ended.
+func (s *RPCDeadlineAlmostExceededBase) GetRemaining() time.Duration { return s.Remaining }
+
+type derivedMethodKey struct{}
+
+// derivedHandler forwards all stats to next and reports the derived events
+// right after the stats they are derived from.
+type derivedHandler struct {
+	Handler
+	settings DerivedSettings
+}
+
+func withDerived(h Handler, settings DerivedSettings) Handler {
+	if !settings.enabled() {
+		return h
+	}
+	return &derivedHandler{Handler: h, settings: settings}
+}
+
+func (h *derivedHandler) TagRPC(ctx context.Context, info RPCTagInfo) context.Context {
+	ctx = h.Handler.TagRPC(ctx, info)
+	return context.WithValue(ctx, derivedMethodKey{}, info.GetFullMethod())
+}
+
+func (h *derivedHandler) HandleRPC(ctx context.Context, rs RPCStats) {
+	h.Handler.HandleRPC(ctx, rs)
+	if derived := h.derive(ctx, rs); derived != nil {
+		h.Handler.HandleRPC(ctx, derived)
+	}
+}
+
+func (h *derivedHandler) derive(ctx context.Context, rs RPCStats) RPCStats {
+	method, _ := ctx.Value(derivedMethodKey{}).(string)
+	threshold := h.settings.PayloadSizeThreshold
+	switch rs := rs.(type) {
+	case RPCInPayload:
+		if size := payloadSize(rs.GetTransportSize(), rs.GetData()); threshold > 0 && size >= threshold {
+			return &RPCPayloadTooLargeBase{
+				Client:     rs.IsClient(),
+				Inbound:    true,
+				FullMethod: method,
+				Size:       size,
+				Threshold:  threshold,
+			}
+		}
+	case RPCOutPayload:
+		if size := payloadSize(rs.GetTransportSize(), rs.GetData()); threshold > 0 && size >= threshold {
+			return &RPCPayloadTooLargeBase{
+				Client:     rs.IsClient(),
+				FullMethod: method,
+				Size:       size,
+				Threshold:  threshold,
+			}
+		}
+	case RPCEnd:
+		if h.settings.DeadlineBudgetThreshold <= 0 {
+			return nil
+		}
+		deadline, ok := ctx.Deadline()
+		if !ok {
+			return nil
+		}
+		budget := deadline.Sub(rs.GetBeginTime())
+		remaining := deadline.Sub(rs.GetEndTime())
+		if budget <= 0 || float64(remaining) >= h.settings.DeadlineBudgetThreshold*float64(budget) {
+			return nil
+		}
+		return &RPCDeadlineAlmostExceededBase{
+			Client:     rs.IsClient(),
+			FullMethod: method,
+			Budget:     budget,
+			Remaining:  remaining,
+		}
+	}
+	return nil
+}
+
+func payloadSize(transportSize int, data []byte) int {
+	if transportSize > 0 {
+		return transportSize
+	}
+	return len(data)
+}
@@ -0,0 +1,92 @@
+// Copyright 2022 The codesjoy Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package stats
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type recordingHandler struct {
+	mockHandler
+	events []RPCStats
+}
+
+func (r *recordingHandler) HandleRPC(_ context.Context, rs RPCStats) {
+	r.events = append(r.events, rs)
+}
+
+func TestWithDerived_Disabled(t *testing.T) {
+	h := &recordingHandler{}
+	assert.Same(t, Handler(h), withDerived(h, DerivedSettings{}))
+}
+
+func TestDerivedHandler_PayloadTooLarge(t *testing.T) {
+	rec := &recordingHandler{}
+	h := withDerived(rec, DerivedSettings{PayloadSizeThreshold: 100})
+	ctx := h.TagRPC(context.Background(), &RPCTagInfoBase{FullMethod: "/pkg.Svc/Get"})
+
+	h.HandleRPC(ctx, &RPCInPayloadBase{TransportSize: 99})
+	h.HandleRPC(ctx, &RPCOutPayloadBase{Client: true, Data: make([]byte, 100)})
+	require.Len(t, rec.events, 3)
+
+	event, ok := rec.events[2].(RPCPayloadTooLarge)
+	require.True(t, ok)
+	assert.True(t, event.IsClient())
+	assert.False(t, event.IsInbound())
+	assert.Equal(t, "/pkg.Svc/Get", event.GetFullMethod())
+	assert.Equal(t, 100, event.GetSize())
+	assert.Equal(t, 100, event.GetThreshold())
+}
+
+func TestDerivedHandler_DeadlineAlmostExceeded(t *testing.T) {
+	rec := &recordingHandler{}
+	h := withDerived(rec, DerivedSettings{DeadlineBudgetThreshold: 0.1})
+	begin := time.Now()
+	ctx, cancel := context.WithDeadline(context.Background(), begin.Add(time.Second))
+	defer cancel()
+	ctx = h.TagRPC(ctx, &RPCTagInfoBase{FullMethod: "/pkg.Svc/Get"})
+
+	h.HandleRPC(ctx, &RPCEndBase{BeginTime: begin, EndTime: begin.Add(500 * time.Millisecond)})
+	require.Len(t, rec.events, 1)
+
+	h.HandleRPC(ctx, &RPCEndBase{BeginTime: begin, EndTime: begin.Add(950 * time.Millisecond)})
+	require.Len(t, rec.events, 3)
+	event, ok := rec.events[2].(RPCDeadlineAlmostExceeded)
+	require.True(t, ok)
+	assert.Equal(t, time.Second, event.GetBudget())
+	assert.Equal(t, 50*time.Millisecond, event.GetRemaining())
+	assert.Equal(t, "/pkg.Svc/Get", event.GetFullMethod())
+
+	// Derived events are not mistaken for the stats they derive from.
+	_, isEnd := rec.events[2].(RPCEnd)
+	assert.False(t, isEnd)
+}
+
+func TestBuildHandlerChainWithBuilders_Derived(t *testing.T) {
+	rec := &recordingHandler{}
+	h := BuildHandlerChainWithBuilders(
+		Settings{Server: "rec", Derived: DerivedSettings{PayloadSizeThreshold: 1}},
+		map[string]HandlerBuilder{"rec": func(bool) Handler { return rec }},
+		true,
+	)
+	ctx := h.TagRPC(context.Background(), &RPCTagInfoBase{FullMethod: "/pkg.Svc/Get"})
+	h.HandleRPC(ctx, &RPCInPayloadBase{TransportSize: 1})
+	assert.Len(t, rec.events, 2)
+}
@@ -16,6 +16,7 @@ package stats
 
 import (
 	"context"
+	"fmt"
 	"log/slog"
 	"sync"
 )
@@ -23,6 +24,8 @@ import (
 var (
 	mu             sync.RWMutex
 	handlerBuilder = map[string]HandlerBuilder{}
+	serverHandlers []Handler
+	clientHandlers []Handler
 	svrOnce        sync.Once
 	svrHandler     Handler
 	cliOnce        sync.Once
@@ -32,6 +35,43 @@ var (
 	NoOpHandler Handler = &handlerChain{}
 )
 
+// RegisterServerHandler adds h to every server side handler chain, after the
+// handlers configured by name. Handlers registered this way coexist with the
+// configured ones, e.g. a custom audit handler next to otel. Register
+// handlers before the App starts; chains built earlier are not updated.
+func RegisterServerHandler(h Handler) {
+	if h == nil {
+		return
+	}
+	mu.Lock()
+	serverHandlers = append(serverHandlers, h)
+	svrOnce = sync.Once{}
+	svrHandler = nil
+	mu.Unlock()
+}
+
+// RegisterClientHandler adds h to every client side handler chain, after the
+// handlers configured by name.
+func RegisterClientHandler(h Handler) {
+	if h == nil {
+		return
+	}
+	mu.Lock()
+	clientHandlers = append(clientHandlers, h)
+	cliOnce = sync.Once{}
+	cliHandler = nil
+	mu.Unlock()
+}
+
+func registeredHandlers(isServer bool) []Handler {
+	mu.RLock()
+	defer mu.RUnlock()
+	if isServer {
+		return append([]Handler(nil), serverHandlers...)
+	}
+	return append([]Handler(nil), clientHandlers...)
+}
+
 // RegisterHandlerBuilder registers a HandlerBuilder.
 func RegisterHandlerBuilder(name string, builder HandlerBuilder) {
 	mu.Lock()
@@ -94,33 +134,75 @@ type handlerChain struct {
 	handlers []Handler
 }
 
+// NewMultiHandler returns a handler that fans every call out to handlers in
+// order. A panic in one handler is logged and does not affect the others.
+func NewMultiHandler(handlers ...Handler) Handler {
+	out := make([]Handler, 0, len(handlers))
+	for _, h := range handlers {
+		if h != nil {
+			out = append(out, h)
+		}
+	}
+	return &handlerChain{handlers: out}
+}
+
+// isolate recovers a panic raised by one handler of the chain.
+func isolate(handler Handler, op string) {
+	if p := recover(); p != nil {
+		slog.Error(
+			"stats handler panicked",
+			slog.String("handler", fmt.Sprintf("%T", handler)),
+			slog.String("op", op),
+			slog.Any("panic", p),
+		)
+	}
+}
+
 // TagRPC attaches some information to the given context.
 func (h *handlerChain) TagRPC(ctx context.Context, info RPCTagInfo) context.Context {
 	for _, handler := range h.handlers {
-		ctx = handler.TagRPC(ctx, info)
+		ctx = tagRPC(handler, ctx, info)
 	}
 	return ctx
 }
 
+func tagRPC(handler Handler, ctx context.Context, info RPCTagInfo) (out context.Context) {
+	out = ctx
+	defer isolate(handler, "TagRPC")
+	return handler.TagRPC(ctx, info)
+}
+
 // HandleRPC processes the RPC stats.
 func (h *handlerChain) HandleRPC(ctx context.Context, rs RPCStats) {
 	for _, handler := range h.handlers {
-		handler.HandleRPC(ctx, rs)
+		func() {
+			defer isolate(handler, "HandleRPC")
+			handler.HandleRPC(ctx, rs)
+		}()
 	}
 }
 
 // TagChannel attaches some information to the given context.
 func (h *handlerChain) TagChannel(ctx context.Context, info ChanTagInfo) context.Context {
 	for _, handler := range h.handlers {
-		ctx = handler.TagChannel(ctx, info)
+		ctx = tagChannel(handler, ctx, info)
 	}
 	return ctx
 }
 
+func tagChannel(handler Handler, ctx context.Context, info ChanTagInfo) (out context.Context) {
+	out = ctx
+	defer isolate(handler, "TagChannel")
+	return handler.TagChannel(ctx, info)
+}
+
 // HandleChannel processes the Channel stats.
 func (h *handlerChain) HandleChannel(ctx context.Context, cs ChanStats) {
 	for _, handler := range h.handlers {
-		handler.HandleChannel(ctx, cs)
+		func() {
+			defer isolate(handler, "HandleChannel")
+			handler.HandleChannel(ctx, cs)
+		}()
 	}
 }
 
@@ -177,5 +259,6 @@ func BuildHandlerChainWithBuilders(
 		}
 		h.handlers = append(h.handlers, builder(isServer))
 	}
-	return h
+	h.handlers = append(h.handlers, registeredHandlers(isServer)...)
+	return withDerived(h, settings.Derived)
 }
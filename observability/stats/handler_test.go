@@ -403,3 +403,69 @@ func TestRegisterHandlerBuilder_Concurrency(t *testing.T) {
 		assert.NotNil(t, retrieved)
 	})
 }
+
+type panicHandler struct {
+	mockHandler
+}
+
+func (p *panicHandler) TagRPC(context.Context, RPCTagInfo) context.Context {
+	panic("tag")
+}
+
+func (p *panicHandler) HandleRPC(context.Context, RPCStats) {
+	panic("handle")
+}
+
+type tagKey struct{}
+
+type taggingHandler struct {
+	mockHandler
+}
+
+func (t *taggingHandler) TagRPC(ctx context.Context, _ RPCTagInfo) context.Context {
+	t.tagRPCCalled = true
+	return context.WithValue(ctx, tagKey{}, "tagged")
+}
+
+func TestNewMultiHandler_IsolatesPanics(t *testing.T) {
+	first := &taggingHandler{}
+	last := &mockHandler{}
+	h := NewMultiHandler(first, &panicHandler{}, nil, last)
+
+	ctx := h.TagRPC(context.Background(), &RPCTagInfoBase{FullMethod: "/test/method"})
+	assert.Equal(t, "tagged", ctx.Value(tagKey{}))
+	assert.True(t, last.tagRPCCalled)
+
+	h.HandleRPC(ctx, &RPCBeginBase{})
+	assert.True(t, last.handleRPCCalled)
+}
+
+func TestRegisterServerAndClientHandler(t *testing.T) {
+	mu.Lock()
+	savedServer, savedClient := serverHandlers, clientHandlers
+	mu.Unlock()
+	defer func() {
+		mu.Lock()
+		serverHandlers, clientHandlers = savedServer, savedClient
+		mu.Unlock()
+	}()
+
+	audit := &mockHandler{}
+	RegisterServerHandler(audit)
+	RegisterServerHandler(nil)
+	cliAudit := &mockHandler{}
+	RegisterClientHandler(cliAudit)
+
+	configured := &mockHandler{}
+	builders := map[string]HandlerBuilder{"configured": func(bool) Handler { return configured }}
+
+	server := BuildHandlerChainWithBuilders(Settings{Server: "configured"}, builders, true)
+	server.HandleRPC(context.Background(), &RPCBeginBase{})
+	assert.True(t, configured.handleRPCCalled)
+	assert.True(t, audit.handleRPCCalled)
+	assert.False(t, cliAudit.handleRPCCalled)
+
+	client := BuildHandlerChainWithBuilders(Settings{}, builders, false)
+	client.HandleRPC(context.Background(), &RPCBeginBase{})
+	assert.True(t, cliAudit.handleRPCCalled)
+}
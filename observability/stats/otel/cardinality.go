@@ -0,0 +1,201 @@
+// Copyright 2022 The codesjoy Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package otel
+
+import (
+	"hash/fnv"
+	"log/slog"
+	"net"
+	"path"
+	"strconv"
+	"sync"
+
+	"go.opentelemetry.io/otel/attribute"
+	semconv "go.opentelemetry.io/otel/semconv/v1.24.0"
+)
+
+const (
+	// PeerLabelKeep labels connection metrics with the peer endpoint.
+	PeerLabelKeep = "keep"
+	// PeerLabelHost labels connection metrics with the peer host only.
+	PeerLabelHost = "host"
+	// PeerLabelHash labels connection metrics with a hash of the peer host.
+	PeerLabelHash = "hash"
+	// PeerLabelDrop leaves the peer label out of connection metrics.
+	PeerLabelDrop = "drop"
+)
+
+// otherLabel replaces the label values collapsed by the cardinality limits.
+const otherLabel = "other"
+
+// CardinalityConfig limits the label values of the RPC and connection
+// metrics, protecting the metrics backend from clients probing random
+// methods or paths.
+type CardinalityConfig struct {
+	// Methods allow-lists the full method names or path.Match patterns such
+	// as "/pkg.Service/*" labelled by name; other methods are labelled
+	// "other". Empty labels every method by name.
+	Methods []string `mapstructure:"methods"`
+	// CollapseUnimplemented labels the calls failing with UNIMPLEMENTED,
+	// i.e. calls of unregistered methods, "other".
+	CollapseUnimplemented bool `mapstructure:"collapse_unimplemented" default:"true"`
+	// Peer is one of "keep", "host", "hash" and "drop". Empty means "keep".
+	Peer string `mapstructure:"peer"`
+	// MaxSeries caps the distinct method and peer label sets of a handler.
+	// Label sets beyond the cap are labelled "other" and a warning is
+	// logged once. A method counts once one of its calls exchanged a
+	// message or finished with a code other than UNIMPLEMENTED. Zero
+	// disables the cap.
+	MaxSeries int `mapstructure:"max_series"`
+}
+
+// cardinalityLimiter applies a CardinalityConfig to metric attributes.
+type cardinalityLimiter struct {
+	cfg CardinalityConfig
+
+	mu     sync.Mutex
+	series map[attribute.Distinct]struct{}
+	warned bool
+}
+
+func newCardinalityLimiter(cfg CardinalityConfig) *cardinalityLimiter {
+	return &cardinalityLimiter{cfg: cfg, series: map[attribute.Distinct]struct{}{}}
+}
+
+// methodAttrs returns the metric attributes of fullMethod, collapsing
+// methods outside the allowlist, and whether they are subject to the series
+// cap. The cap is charged by callAttrs once the call turns out to be served.
+func (l *cardinalityLimiter) methodAttrs(
+	fullMethod string,
+	attrs []attribute.KeyValue,
+) ([]attribute.KeyValue, bool) {
+	if !l.allowed(fullMethod) {
+		return collapseMethod(attrs), false
+	}
+	return attrs, true
+}
+
+// callAttrs returns the metric attributes of the call of rctx, charging them to
+// the series cap on first use.
+func (l *cardinalityLimiter) callAttrs(rctx *rpcContext) []attribute.KeyValue {
+	rctx.seriesOnce.Do(func() {
+		rctx.series = rctx.metricAttrs
+		if rctx.capped {
+			rctx.series = l.limit(rctx.metricAttrs, collapseMethod)
+		}
+	})
+	return rctx.series
+}
+
+// finished returns the metric attributes of a finished call. Calls of
+// unregistered methods are collapsed before they are charged to the series
+// cap, so probing random methods cannot use it up.
+func (l *cardinalityLimiter) finished(
+	rctx *rpcContext,
+	unimplemented bool,
+) []attribute.KeyValue {
+	if unimplemented && l.cfg.CollapseUnimplemented {
+		return collapseMethod(rctx.metricAttrs)
+	}
+	return l.callAttrs(rctx)
+}
+
+// peerAttrs returns the connection metric attributes of peer.
+func (l *cardinalityLimiter) peerAttrs(
+	protocol string,
+	peer string,
+) []attribute.KeyValue {
+	attrs := []attribute.KeyValue{protocolKey.String(protocol)}
+	switch l.cfg.Peer {
+	case PeerLabelDrop:
+		return attrs
+	case PeerLabelHost:
+		peer = peerHost(peer)
+	case PeerLabelHash:
+		h := fnv.New64a()
+		_, _ = h.Write([]byte(peerHost(peer)))
+		peer = strconv.FormatUint(h.Sum64(), 16)
+	}
+	attrs = append(attrs, peerEndpointKey.String(peer))
+	return l.limit(attrs, func(attrs []attribute.KeyValue) []attribute.KeyValue {
+		return []attribute.KeyValue{attrs[0], peerEndpointKey.String(otherLabel)}
+	})
+}
+
+func (l *cardinalityLimiter) allowed(fullMethod string) bool {
+	if len(l.cfg.Methods) == 0 {
+		return true
+	}
+	for _, pattern := range l.cfg.Methods {
+		if pattern == fullMethod {
+			return true
+		}
+		if ok, _ := path.Match(pattern, fullMethod); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// limit returns attrs while the series cap has room for them and the
+// collapsed attributes otherwise.
+func (l *cardinalityLimiter) limit(
+	attrs []attribute.KeyValue,
+	collapse func([]attribute.KeyValue) []attribute.KeyValue,
+) []attribute.KeyValue {
+	if l.cfg.MaxSeries <= 0 {
+		return attrs
+	}
+	set := attribute.NewSet(attrs...)
+	key := set.Equivalent()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if _, ok := l.series[key]; ok {
+		return attrs
+	}
+	if len(l.series) < l.cfg.MaxSeries {
+		l.series[key] = struct{}{}
+		return attrs
+	}
+	if !l.warned {
+		l.warned = true
+		slog.Warn("metric series cap reached, labelling new series \"other\"",
+			slog.Int("max_series", l.cfg.MaxSeries))
+	}
+	return collapse(attrs)
+}
+
+// collapseMethod replaces the service and method attributes with "other".
+func collapseMethod(attrs []attribute.KeyValue) []attribute.KeyValue {
+	out := make([]attribute.KeyValue, 0, len(attrs))
+	for _, attr := range attrs {
+		switch attr.Key {
+		case semconv.RPCServiceKey:
+			out = append(out, semconv.RPCService(otherLabel))
+		case semconv.RPCMethodKey:
+			out = append(out, semconv.RPCMethod(otherLabel))
+		default:
+			out = append(out, attr)
+		}
+	}
+	return out
+}
+
+func peerHost(peer string) string {
+	if host, _, err := net.SplitHostPort(peer); err == nil {
+		return host
+	}
+	return peer
+}
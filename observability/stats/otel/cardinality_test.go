@@ -0,0 +1,151 @@
+// Copyright 2022 The codesjoy Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package otel
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/attribute"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	semconv "go.opentelemetry.io/otel/semconv/v1.24.0"
+	"google.golang.org/genproto/googleapis/rpc/code"
+
+	"github.com/codesjoy/yggdrasil/v3/observability/stats"
+	"github.com/codesjoy/yggdrasil/v3/rpc/status"
+)
+
+func durationMethods(t *testing.T, reader *sdkmetric.ManualReader) map[string]uint64 {
+	t.Helper()
+	var rm metricdata.ResourceMetrics
+	require.NoError(t, reader.Collect(context.Background(), &rm))
+	out := map[string]uint64{}
+	for _, sm := range rm.ScopeMetrics {
+		for _, m := range sm.Metrics {
+			if m.Name != "rpc.server.duration" {
+				continue
+			}
+			for _, dp := range m.Data.(metricdata.Histogram[float64]).DataPoints {
+				method, _ := dp.Attributes.Value(semconv.RPCMethodKey)
+				out[method.AsString()] += dp.Count
+			}
+		}
+	}
+	return out
+}
+
+func TestServerHandler_CardinalityCollapsesMethods(t *testing.T) {
+	reader := sdkmetric.NewManualReader()
+	provider := sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader))
+	h := newSvrHandlerWithRuntime(&Config{
+		EnableMetrics: true,
+		Cardinality: CardinalityConfig{
+			Methods:               []string{"/pkg.Svc/*"},
+			CollapseUnimplemented: true,
+		},
+	}, HandlerRuntime{MeterProvider: provider})
+
+	call := func(method string, err error) {
+		ctx := h.TagRPC(context.Background(), &stats.RPCTagInfoBase{FullMethod: method})
+		now := time.Now()
+		h.HandleRPC(ctx, &stats.RPCEndBase{BeginTime: now, EndTime: now, Err: err})
+	}
+	call("/pkg.Svc/Get", nil)
+	call("/pkg.Svc/Missing", status.New(code.Code_UNIMPLEMENTED, "unknown method").Err())
+	call("/probe/random", nil)
+
+	assert.Equal(t, map[string]uint64{"Get": 1, "other": 2}, durationMethods(t, reader))
+}
+
+func TestServerHandler_CardinalityCapsSeries(t *testing.T) {
+	reader := sdkmetric.NewManualReader()
+	provider := sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader))
+	h := newSvrHandlerWithRuntime(&Config{
+		EnableMetrics: true,
+		Cardinality:   CardinalityConfig{MaxSeries: 2},
+	}, HandlerRuntime{MeterProvider: provider})
+
+	for _, method := range []string{"/a.S/A", "/a.S/B", "/a.S/A", "/a.S/C", "/a.S/D"} {
+		ctx := h.TagRPC(context.Background(), &stats.RPCTagInfoBase{FullMethod: method})
+		now := time.Now()
+		h.HandleRPC(ctx, &stats.RPCEndBase{BeginTime: now, EndTime: now})
+	}
+
+	assert.Equal(t, map[string]uint64{"A": 2, "B": 1, "other": 2}, durationMethods(t, reader))
+}
+
+func TestServerHandler_CardinalityProbesDoNotUseSeriesCap(t *testing.T) {
+	reader := sdkmetric.NewManualReader()
+	provider := sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader))
+	h := newSvrHandlerWithRuntime(&Config{
+		EnableMetrics: true,
+		Cardinality: CardinalityConfig{
+			MaxSeries:             2,
+			CollapseUnimplemented: true,
+		},
+	}, HandlerRuntime{MeterProvider: provider})
+	call := func(method string, err error) {
+		ctx := h.TagRPC(context.Background(), &stats.RPCTagInfoBase{FullMethod: method})
+		now := time.Now()
+		h.HandleRPC(ctx, &stats.RPCEndBase{BeginTime: now, EndTime: now, Err: err})
+	}
+
+	unimplemented := status.New(code.Code_UNIMPLEMENTED, "unknown method").Err()
+	for i := 0; i < 5; i++ {
+		call(fmt.Sprintf("/probe.S/M%d", i), unimplemented)
+	}
+	call("/a.S/A", nil)
+	call("/a.S/B", status.New(code.Code_NOT_FOUND, "missing").Err())
+	call("/a.S/C", nil)
+
+	assert.Equal(t, map[string]uint64{"A": 1, "B": 1, "other": 6}, durationMethods(t, reader))
+}
+
+func TestCardinalityLimiter_PeerAttrs(t *testing.T) {
+	peerOf := func(attrs []attribute.KeyValue) (string, bool) {
+		set := attribute.NewSet(attrs...)
+		value, ok := set.Value(peerEndpointKey)
+		return value.AsString(), ok
+	}
+
+	peer, ok := peerOf(newCardinalityLimiter(CardinalityConfig{}).peerAttrs("grpc", "10.0.0.1:80"))
+	require.True(t, ok)
+	assert.Equal(t, "10.0.0.1:80", peer)
+
+	limiter := newCardinalityLimiter(CardinalityConfig{Peer: PeerLabelHost})
+	peer, _ = peerOf(limiter.peerAttrs("grpc", "10.0.0.1:80"))
+	assert.Equal(t, "10.0.0.1", peer)
+
+	limiter = newCardinalityLimiter(CardinalityConfig{Peer: PeerLabelHash})
+	first, _ := peerOf(limiter.peerAttrs("grpc", "10.0.0.1:80"))
+	second, _ := peerOf(limiter.peerAttrs("grpc", "10.0.0.1:81"))
+	assert.Equal(t, first, second)
+	assert.NotEqual(t, "10.0.0.1", first)
+
+	limiter = newCardinalityLimiter(CardinalityConfig{Peer: PeerLabelDrop})
+	_, ok = peerOf(limiter.peerAttrs("grpc", "10.0.0.1:80"))
+	assert.False(t, ok)
+
+	limiter = newCardinalityLimiter(CardinalityConfig{MaxSeries: 1})
+	peer, _ = peerOf(limiter.peerAttrs("grpc", "10.0.0.1:80"))
+	assert.Equal(t, "10.0.0.1:80", peer)
+	peer, _ = peerOf(limiter.peerAttrs("grpc", "10.0.0.2:80"))
+	assert.Equal(t, otherLabel, peer)
+}
@@ -0,0 +1,137 @@
+// Copyright 2022 The codesjoy Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package otel
+
+import (
+	"context"
+	"net"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/metric/noop"
+
+	"github.com/codesjoy/yggdrasil/v3/observability/stats"
+)
+
+var directionKey = attribute.Key("direction")
+
+type chanContextKey struct{}
+
+type chanContext struct {
+	metricAttrs []attribute.KeyValue
+}
+
+// connMetrics records connection churn, bandwidth and stream concurrency
+// per peer.
+type connMetrics struct {
+	opened  metric.Int64Counter
+	active  metric.Int64UpDownCounter
+	bytes   metric.Int64Counter
+	streams metric.Int64UpDownCounter
+}
+
+func newConnMetrics(meter metric.Meter, role string) *connMetrics {
+	m := &connMetrics{}
+	var err error
+	m.opened, err = meter.Int64Counter("rpc."+role+".connection.opened",
+		metric.WithDescription("Counts the transport connections established."),
+		metric.WithUnit("{connection}"))
+	if err != nil {
+		otel.Handle(err)
+		if m.opened == nil {
+			m.opened = noop.Int64Counter{}
+		}
+	}
+	m.active, err = meter.Int64UpDownCounter("rpc."+role+".connection.active",
+		metric.WithDescription("Measures the transport connections currently open."),
+		metric.WithUnit("{connection}"))
+	if err != nil {
+		otel.Handle(err)
+		if m.active == nil {
+			m.active = noop.Int64UpDownCounter{}
+		}
+	}
+	m.bytes, err = meter.Int64Counter("rpc."+role+".connection.bytes",
+		metric.WithDescription("Counts the bytes transferred on transport connections."),
+		metric.WithUnit("By"))
+	if err != nil {
+		otel.Handle(err)
+		if m.bytes == nil {
+			m.bytes = noop.Int64Counter{}
+		}
+	}
+	m.streams, err = meter.Int64UpDownCounter("rpc."+role+".connection.active_streams",
+		metric.WithDescription("Measures the streams currently open on transport connections."),
+		metric.WithUnit("{stream}"))
+	if err != nil {
+		otel.Handle(err)
+		if m.streams == nil {
+			m.streams = noop.Int64UpDownCounter{}
+		}
+	}
+	return m
+}
+
+// tagChannel attaches the peer attributes of the connection. Server side
+// peers are reduced to their host since client ports are ephemeral; the
+// cardinality config may further reduce or drop them.
+func (h *handler) tagChannel(
+	ctx context.Context,
+	info stats.ChanTagInfo,
+	isServer bool,
+) context.Context {
+	if h.conn == nil {
+		return ctx
+	}
+	peer := info.GetRemoteEndpoint()
+	if isServer {
+		if host, _, err := net.SplitHostPort(peer); err == nil {
+			peer = host
+		}
+	}
+	return context.WithValue(ctx, chanContextKey{}, &chanContext{
+		metricAttrs: h.cardinality.peerAttrs(info.GetProtocol(), peer),
+	})
+}
+
+func (h *handler) handleChannel(ctx context.Context, cs stats.ChanStats) {
+	if h.conn == nil {
+		return
+	}
+	var attrs []attribute.KeyValue
+	if cctx, ok := ctx.Value(chanContextKey{}).(*chanContext); ok {
+		attrs = cctx.metricAttrs
+	}
+	switch s := cs.(type) {
+	case stats.ChanBegin:
+		h.conn.opened.Add(ctx, 1, metric.WithAttributes(attrs...))
+		h.conn.active.Add(ctx, 1, metric.WithAttributes(attrs...))
+	case stats.ChanEnd:
+		h.conn.active.Add(ctx, -1, metric.WithAttributes(attrs...))
+	case stats.ChanInPayload:
+		h.conn.bytes.Add(ctx, int64(s.GetTransportSize()), metric.WithAttributes(
+			append(attrs[:len(attrs):len(attrs)], directionKey.String("in"))...))
+	case stats.ChanOutPayload:
+		h.conn.bytes.Add(ctx, int64(s.GetTransportSize()), metric.WithAttributes(
+			append(attrs[:len(attrs):len(attrs)], directionKey.String("out"))...))
+	case stats.ChanStreams:
+		if s.IsBegin() {
+			h.conn.streams.Add(ctx, 1, metric.WithAttributes(attrs...))
+		} else {
+			h.conn.streams.Add(ctx, -1, metric.WithAttributes(attrs...))
+		}
+	}
+}
@@ -0,0 +1,85 @@
+// Copyright 2022 The codesjoy Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package otel
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+
+	"github.com/codesjoy/yggdrasil/v3/observability/stats"
+)
+
+func TestServerHandler_ConnectionMetrics(t *testing.T) {
+	reader := sdkmetric.NewManualReader()
+	provider := sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader))
+	h := newSvrHandlerWithRuntime(&Config{EnableMetrics: true}, HandlerRuntime{
+		MeterProvider: provider,
+	})
+
+	ctx := h.TagChannel(context.Background(), &stats.ChanTagInfoBase{
+		RemoteEndpoint: "10.0.0.1:40000",
+		LocalEndpoint:  "10.0.0.2:9000",
+		Protocol:       "grpc",
+	})
+	h.HandleChannel(ctx, &stats.ChanBeginBase{})
+	h.HandleChannel(ctx, &stats.ChanStreamsBase{Begin: true, ActiveStreams: 1})
+	h.HandleChannel(ctx, &stats.ChanInPayloadBase{TransportSize: 100})
+	h.HandleChannel(ctx, &stats.ChanOutPayloadBase{TransportSize: 40})
+	h.HandleChannel(ctx, &stats.ChanInPayloadBase{TransportSize: 20})
+
+	var rm metricdata.ResourceMetrics
+	require.NoError(t, reader.Collect(context.Background(), &rm))
+	sums := map[string]metricdata.Sum[int64]{}
+	for _, sm := range rm.ScopeMetrics {
+		for _, m := range sm.Metrics {
+			if sum, ok := m.Data.(metricdata.Sum[int64]); ok {
+				sums[m.Name] = sum
+			}
+		}
+	}
+
+	require.Len(t, sums["rpc.server.connection.opened"].DataPoints, 1)
+	assert.Equal(t, int64(1), sums["rpc.server.connection.opened"].DataPoints[0].Value)
+	assert.Equal(t, int64(1), sums["rpc.server.connection.active"].DataPoints[0].Value)
+	assert.Equal(t, int64(1), sums["rpc.server.connection.active_streams"].DataPoints[0].Value)
+	peer, ok := sums["rpc.server.connection.active"].DataPoints[0].Attributes.Value(peerEndpointKey)
+	require.True(t, ok)
+	assert.Equal(t, "10.0.0.1", peer.AsString(), "server peers drop the ephemeral port")
+
+	bytes := map[string]int64{}
+	for _, dp := range sums["rpc.server.connection.bytes"].DataPoints {
+		dir, _ := dp.Attributes.Value(directionKey)
+		bytes[dir.AsString()] = dp.Value
+	}
+	assert.Equal(t, map[string]int64{"in": 120, "out": 40}, bytes)
+
+	h.HandleChannel(ctx, &stats.ChanStreamsBase{})
+	h.HandleChannel(ctx, &stats.ChanEndBase{})
+	require.NoError(t, reader.Collect(context.Background(), &rm))
+	for _, sm := range rm.ScopeMetrics {
+		for _, m := range sm.Metrics {
+			switch m.Name {
+			case "rpc.server.connection.active", "rpc.server.connection.active_streams":
+				sum := m.Data.(metricdata.Sum[int64])
+				assert.Equal(t, int64(0), sum.DataPoints[0].Value, m.Name)
+			}
+		}
+	}
+}
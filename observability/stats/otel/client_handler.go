@@ -39,15 +39,19 @@ func newCliHandler() stats.Handler {
 func (h *clientHandler) TagRPC(ctx context.Context, info stats.RPCTagInfo) context.Context {
 	spanName, attrs := parseFullMethod(info.GetFullMethod())
 	attrs = append(attrs, semconv.RPCSystemKey.String("yggdrasil"))
-	ctx, _ = h.tracer.Start(
+	ctx, deferred := h.startSpan(
 		ctx,
+		info.GetFullMethod(),
 		spanName,
-		trace.WithSpanKind(trace.SpanKindClient),
-		trace.WithAttributes(attrs...),
+		trace.SpanKindClient,
+		attrs,
 	)
 
+	metricAttrs, capped := h.cardinality.methodAttrs(info.GetFullMethod(), attrs)
 	gctx := rpcContext{
-		metricAttrs: attrs,
+		metricAttrs: metricAttrs,
+		capped:      capped,
+		deferred:    deferred,
 	}
 
 	return inject(context.WithValue(ctx, rpcContextKey{}, &gctx), h.propagator)
@@ -59,11 +63,11 @@ func (h *clientHandler) HandleRPC(ctx context.Context, rs stats.RPCStats) {
 }
 
 // TagChannel can attach some information to the given context.
-func (h *clientHandler) TagChannel(ctx context.Context, _ stats.ChanTagInfo) context.Context {
-	return ctx
+func (h *clientHandler) TagChannel(ctx context.Context, info stats.ChanTagInfo) context.Context {
+	return h.tagChannel(ctx, info, false)
 }
 
 // HandleChannel handles the given channel stats.
-func (h *clientHandler) HandleChannel(context.Context, stats.ChanStats) {
-	// no-op
+func (h *clientHandler) HandleChannel(ctx context.Context, cs stats.ChanStats) {
+	h.handleChannel(ctx, cs)
 }
@@ -201,14 +201,14 @@ func TestClientHandler_TagChannel(t *testing.T) {
 
 // TestClientHandler_HandleChannel tests clientHandler.HandleChannel method
 func TestClientHandler_HandleChannel(t *testing.T) {
-	t.Run("handle channel is no-op", func(*testing.T) {
+	t.Run("handle channel without metrics", func(*testing.T) {
 		h := newCliHandler()
 		ctx := context.Background()
 		cs := &stats.ChanBeginBase{
 			Client: true,
 		}
 
-		// Should not panic (no-op)
+		// Should not panic
 		h.HandleChannel(ctx, cs)
 	})
 }
@@ -25,6 +25,8 @@ type Config struct {
 	ReceivedEvent bool `default:"true"`
 	SentEvent     bool `default:"true"`
 	EnableMetrics bool `default:"true"`
+	// Cardinality limits the label values of the metrics.
+	Cardinality CardinalityConfig `mapstructure:"cardinality"`
 }
 
 func getCfg() *Config {
@@ -16,6 +16,7 @@ package otel
 
 import (
 	"context"
+	"sync"
 	"sync/atomic"
 	"time"
 
@@ -41,6 +42,12 @@ type rpcContext struct {
 	requests         int64
 	responses        int64
 	metricAttrs      []attribute.KeyValue
+	// capped reports whether metricAttrs are subject to the series cap.
+	capped     bool
+	seriesOnce sync.Once
+	series     []attribute.KeyValue
+	// deferred is the span of a call dropped by the sampling.
+	deferred *deferredSpan
 }
 
 var (
@@ -60,6 +67,8 @@ type handler struct {
 	rpcRequestsPerRPC  metric.Int64Histogram
 	rpcResponsesPerRPC metric.Int64Histogram
 	propagator         propagation.TextMapPropagator
+	conn               *connMetrics
+	cardinality        *cardinalityLimiter
 
 	handleRPC func(context.Context, stats.RPCStats, bool)
 }
@@ -94,9 +103,10 @@ func newHandlerWithRuntime(cfg *Config, isSvr bool, runtime HandlerRuntime) hand
 		trace.WithInstrumentationVersion("yggdrasil"),
 	)
 	h := handler{
-		cfg:        cfg,
-		tracer:     tracer,
-		propagator: propagator,
+		cfg:         cfg,
+		tracer:      tracer,
+		propagator:  propagator,
+		cardinality: newCardinalityLimiter(cfg.Cardinality),
 	}
 	meter := meterProvider.Meter("github.com/codesjoy/yggdrasil/v3",
 		metric.WithInstrumentationVersion("yggdrasil"),
@@ -168,6 +178,7 @@ func newHandlerWithRuntime(cfg *Config, isSvr bool, runtime HandlerRuntime) hand
 				h.rpcResponsesPerRPC = noop.Int64Histogram{}
 			}
 		}
+		h.conn = newConnMetrics(meter, role)
 		h.handleRPC = h.handleWithMetrics
 	} else {
 		h.handleRPC = h.handleWithOutMetrics
@@ -199,16 +210,12 @@ func newCliHandlerWithRuntime(cfg *Config, runtime HandlerRuntime) stats.Handler
 func (h *handler) handleWithMetrics(ctx context.Context, rs stats.RPCStats, isServer bool) {
 	span := trace.SpanFromContext(ctx)
 	rctx, _ := ctx.Value(rpcContextKey{}).(*rpcContext)
-	var metricAttrs []attribute.KeyValue
-	if rctx != nil {
-		metricAttrs = make([]attribute.KeyValue, 0, len(rctx.metricAttrs)+1)
-		metricAttrs = append(metricAttrs, rctx.metricAttrs...)
-	}
 	var messageID int64
 	switch rs := rs.(type) {
 	case stats.RPCBegin:
 	case stats.RPCInPayload:
 		if rctx != nil {
+			metricAttrs := h.cardinality.callAttrs(rctx)
 			messageID = atomic.AddInt64(&rctx.messagesReceived, 1)
 			if rs.IsClient() {
 				atomic.AddInt64(&rctx.responses, 1)
@@ -231,6 +238,7 @@ func (h *handler) handleWithMetrics(ctx context.Context, rs stats.RPCStats, isSe
 		}
 	case stats.RPCOutPayload:
 		if rctx != nil {
+			metricAttrs := h.cardinality.callAttrs(rctx)
 			messageID = atomic.AddInt64(&rctx.messagesSent, 1)
 			if rs.IsClient() {
 				atomic.AddInt64(&rctx.requests, 1)
@@ -254,11 +262,15 @@ func (h *handler) handleWithMetrics(ctx context.Context, rs stats.RPCStats, isSe
 		}
 	case stats.RPCOutTrailer:
 	case stats.RPCOutHeader:
-		span.SetAttributes(protocolKey.String(rs.GetProtocol()))
-		span.SetAttributes(peerEndpointKey.String(rs.GetRemoteEndpoint()))
+		setSpanAttributes(span, rctx,
+			protocolKey.String(rs.GetProtocol()),
+			peerEndpointKey.String(rs.GetRemoteEndpoint()))
 	case stats.RPCEnd:
+		if late := h.lateSpan(ctx, rctx, rs); late != nil {
+			span = late
+		}
 		var rpcStatusAttr attribute.KeyValue
-
+		unimplemented := false
 		if rs.Error() != nil {
 			s := status.FromError(rs.Error())
 			if isServer {
@@ -268,12 +280,19 @@ func (h *handler) handleWithMetrics(ctx context.Context, rs stats.RPCStats, isSe
 				span.SetStatus(codes.Error, s.Message())
 			}
 			rpcStatusAttr = codeKey.Int(int(s.Code()))
+			unimplemented = s.Code() == code.Code_UNIMPLEMENTED
 		} else {
 			rpcStatusAttr = codeKey.Int(int(code.Code_OK))
 		}
 		span.SetAttributes(rpcStatusAttr)
 		span.End()
 
+		var metricAttrs []attribute.KeyValue
+		if rctx != nil {
+			attrs := h.cardinality.finished(rctx, unimplemented)
+			metricAttrs = make([]attribute.KeyValue, 0, len(attrs)+1)
+			metricAttrs = append(metricAttrs, attrs...)
+		}
 		metricAttrs = append(metricAttrs, rpcStatusAttr)
 
 		// Use floating point division here for higher precision (instead of Millisecond method).
@@ -328,9 +347,13 @@ func (h *handler) handleWithOutMetrics(ctx context.Context, rs stats.RPCStats, i
 		}
 	case stats.RPCOutTrailer:
 	case stats.RPCOutHeader:
-		span.SetAttributes(protocolKey.String(rs.GetProtocol()))
-		span.SetAttributes(peerEndpointKey.String(rs.GetRemoteEndpoint()))
+		setSpanAttributes(span, rctx,
+			protocolKey.String(rs.GetProtocol()),
+			peerEndpointKey.String(rs.GetRemoteEndpoint()))
 	case stats.RPCEnd:
+		if late := h.lateSpan(ctx, rctx, rs); late != nil {
+			span = late
+		}
 		var rpcStatusAttr attribute.KeyValue
 
 		if rs.Error() != nil {
@@ -0,0 +1,374 @@
+// Copyright 2022 The codesjoy Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package otel
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"math/rand/v2"
+	"path"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/codesjoy/yggdrasil/v3/config"
+	"github.com/codesjoy/yggdrasil/v3/module"
+	"github.com/codesjoy/yggdrasil/v3/observability/stats"
+	"github.com/codesjoy/yggdrasil/v3/rpc/interceptor/ratelimit"
+)
+
+const (
+	// TracingModuleName is the name of the module serving the sampling
+	// configuration.
+	TracingModuleName = "tracing"
+	// TracingConfigPath is the config path holding the sampling
+	// configuration.
+	TracingConfigPath = "yggdrasil.tracing"
+)
+
+// Sampler types of a SamplingRule.
+const (
+	// SamplerAlways traces every call.
+	SamplerAlways = "always"
+	// SamplerNever traces no call.
+	SamplerNever = "never"
+	// SamplerRatio traces the share Ratio of the traces.
+	SamplerRatio = "ratio"
+	// SamplerRateLimited traces at most Rate calls per second.
+	SamplerRateLimited = "rate_limited"
+)
+
+var samplingReasonKey = attribute.Key("sampling.reason")
+
+// SamplingRule decides which calls the stats handler traces.
+//
+// Calls with a sampled or unsampled parent follow the parent unless
+// IgnoreParent is set; the sampler decides for the others. Unsampled calls
+// that fail or run slow can still be traced: their span is recorded when the
+// call ends, without message events, and starts a new trace linked to the
+// parent when the parent was not sampled.
+type SamplingRule struct {
+	// Sampler is one of "always", "never", "ratio" and "rate_limited".
+	// Empty means "always".
+	Sampler string `mapstructure:"sampler"`
+	// Ratio is the share of the traces sampled by the ratio sampler.
+	Ratio float64 `mapstructure:"ratio"`
+	// Rate is the number of calls per second sampled by the rate_limited
+	// sampler.
+	Rate float64 `mapstructure:"rate"`
+	// IgnoreParent lets the sampler decide for calls with a parent too.
+	IgnoreParent bool `mapstructure:"ignore_parent"`
+	// SampleErrors traces unsampled calls that fail.
+	SampleErrors bool `mapstructure:"sample_errors"`
+	// SlowThreshold traces unsampled calls lasting longer. Zero disables it.
+	SlowThreshold time.Duration `mapstructure:"slow_threshold"`
+}
+
+// TracingConfig defines the sampling under TracingConfigPath.
+type TracingConfig struct {
+	SamplingRule `mapstructure:",squash"`
+	// Methods replaces the rule per full method name or path.Match pattern
+	// such as "/pkg.Service/*". An exact name wins over the longest
+	// matching pattern.
+	Methods map[string]SamplingRule `mapstructure:"methods"`
+}
+
+// ruleSampler applies one SamplingRule.
+type ruleSampler struct {
+	rule    SamplingRule
+	limiter ratelimit.Limiter
+}
+
+func newRuleSampler(rule SamplingRule) (*ruleSampler, error) {
+	s := &ruleSampler{rule: rule}
+	switch rule.Sampler {
+	case "", SamplerAlways, SamplerNever:
+	case SamplerRatio:
+		if rule.Ratio < 0 || rule.Ratio > 1 {
+			return nil, fmt.Errorf("sampling ratio %v is not between 0 and 1", rule.Ratio)
+		}
+	case SamplerRateLimited:
+		if rule.Rate <= 0 {
+			return nil, fmt.Errorf("sampling rate %v is not positive", rule.Rate)
+		}
+		s.limiter = ratelimit.NewLocalLimiter()
+	default:
+		return nil, fmt.Errorf("unknown sampler %q", rule.Sampler)
+	}
+	return s, nil
+}
+
+// shouldSample decides whether a call with parent is traced from its start.
+func (s *ruleSampler) shouldSample(ctx context.Context, parent trace.SpanContext) bool {
+	if parent.IsValid() && !s.rule.IgnoreParent {
+		return parent.IsSampled()
+	}
+	switch s.rule.Sampler {
+	case SamplerNever:
+		return false
+	case SamplerRatio:
+		return sampleRatio(parent, s.rule.Ratio)
+	case SamplerRateLimited:
+		ok, _, err := s.limiter.Allow(ctx, "", ratelimit.Limit{
+			Rate:  s.rule.Rate,
+			Burst: max(int(s.rule.Rate), 1),
+		})
+		return err == nil && ok
+	default:
+		return true
+	}
+}
+
+// sampleRatio decides by the trace ID when there is one, so every service
+// keeps or drops the same traces, and at random otherwise.
+func sampleRatio(parent trace.SpanContext, ratio float64) bool {
+	if !parent.IsValid() {
+		return rand.Float64() < ratio
+	}
+	id := parent.TraceID()
+	return binary.BigEndian.Uint64(id[8:16])>>1 < uint64(ratio*(1<<63))
+}
+
+// lateReason returns why an unsampled call is traced after all.
+func (s *ruleSampler) lateReason(err error, elapsed time.Duration) (string, bool) {
+	switch {
+	case s.rule.SampleErrors && err != nil:
+		return "error", true
+	case s.rule.SlowThreshold > 0 && elapsed > s.rule.SlowThreshold:
+		return "slow", true
+	default:
+		return "", false
+	}
+}
+
+// sampling is a compiled TracingConfig.
+type sampling struct {
+	rule    *ruleSampler
+	methods map[string]*ruleSampler
+}
+
+func newSampling(cfg TracingConfig) (*sampling, error) {
+	rule, err := newRuleSampler(cfg.SamplingRule)
+	if err != nil {
+		return nil, err
+	}
+	s := &sampling{rule: rule, methods: make(map[string]*ruleSampler, len(cfg.Methods))}
+	for method, item := range cfg.Methods {
+		if _, err := path.Match(method, ""); err != nil {
+			return nil, fmt.Errorf("sampling method %q: %w", method, err)
+		}
+		if s.methods[method], err = newRuleSampler(item); err != nil {
+			return nil, fmt.Errorf("sampling method %q: %w", method, err)
+		}
+	}
+	return s, nil
+}
+
+// forMethod returns the sampler of fullMethod: the exact entry, else the
+// longest matching pattern, else the default rule.
+func (s *sampling) forMethod(fullMethod string) *ruleSampler {
+	if rule, ok := s.methods[fullMethod]; ok {
+		return rule
+	}
+	var best string
+	rule := s.rule
+	for pattern, item := range s.methods {
+		if !strings.ContainsAny(pattern, "*?[") {
+			continue
+		}
+		if ok, err := path.Match(pattern, fullMethod); err != nil || !ok {
+			continue
+		}
+		if len(pattern) > len(best) || (len(pattern) == len(best) && pattern < best) {
+			best, rule = pattern, item
+		}
+	}
+	return rule
+}
+
+// currentSampling holds the sampling served by the tracing module. Without
+// it every call is traced.
+var currentSampling atomic.Pointer[sampling]
+
+// deferredSpan keeps what the span of an unsampled call needs in case the
+// call turns out to fail or run slow.
+type deferredSpan struct {
+	name    string
+	kind    trace.SpanKind
+	parent  trace.SpanContext
+	sampler *ruleSampler
+
+	mu    sync.Mutex
+	attrs []attribute.KeyValue
+}
+
+func (d *deferredSpan) setAttributes(attrs ...attribute.KeyValue) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.attrs = append(d.attrs, attrs...)
+}
+
+// startSpan starts the span of a call unless the sampling drops it. Dropped
+// calls carry an unsampled span context, so the calls they make are dropped
+// as well, and return the span to record should they fail or run slow.
+func (h *handler) startSpan(
+	ctx context.Context,
+	fullMethod, name string,
+	kind trace.SpanKind,
+	attrs []attribute.KeyValue,
+) (context.Context, *deferredSpan) {
+	if s := currentSampling.Load(); s != nil {
+		parent := trace.SpanContextFromContext(ctx)
+		sampler := s.forMethod(fullMethod)
+		if !sampler.shouldSample(ctx, parent) {
+			return trace.ContextWithSpanContext(ctx, unsampled(parent)), &deferredSpan{
+				name:    name,
+				kind:    kind,
+				parent:  parent,
+				sampler: sampler,
+				attrs:   append([]attribute.KeyValue(nil), attrs...),
+			}
+		}
+	}
+	ctx, _ = h.tracer.Start(ctx, name, trace.WithSpanKind(kind), trace.WithAttributes(attrs...))
+	return ctx, nil
+}
+
+// unsampled returns the span context propagated by a dropped call.
+func unsampled(parent trace.SpanContext) trace.SpanContext {
+	if parent.IsValid() {
+		return parent.WithTraceFlags(parent.TraceFlags().WithSampled(false))
+	}
+	var traceID trace.TraceID
+	var spanID trace.SpanID
+	binary.BigEndian.PutUint64(traceID[:8], rand.Uint64())
+	binary.BigEndian.PutUint64(traceID[8:], rand.Uint64())
+	binary.BigEndian.PutUint64(spanID[:], rand.Uint64()|1)
+	return trace.NewSpanContext(trace.SpanContextConfig{TraceID: traceID, SpanID: spanID})
+}
+
+// lateSpan starts the span of a dropped call that failed or ran slow, or
+// returns nil.
+func (h *handler) lateSpan(ctx context.Context, rctx *rpcContext, rs stats.RPCEnd) trace.Span {
+	if rctx == nil || rctx.deferred == nil {
+		return nil
+	}
+	d := rctx.deferred
+	reason, ok := d.sampler.lateReason(rs.Error(), rs.GetEndTime().Sub(rs.GetBeginTime()))
+	if !ok {
+		return nil
+	}
+	d.mu.Lock()
+	attrs := append(append([]attribute.KeyValue(nil), d.attrs...), samplingReasonKey.String(reason))
+	d.mu.Unlock()
+	opts := []trace.SpanStartOption{
+		trace.WithSpanKind(d.kind),
+		trace.WithAttributes(attrs...),
+		trace.WithTimestamp(rs.GetBeginTime()),
+	}
+	if d.parent.IsSampled() {
+		ctx = trace.ContextWithSpanContext(ctx, d.parent)
+	} else {
+		opts = append(opts, trace.WithNewRoot())
+		if d.parent.IsValid() {
+			opts = append(opts, trace.WithLinks(trace.Link{SpanContext: d.parent}))
+		}
+	}
+	_, span := h.tracer.Start(ctx, d.name, opts...)
+	return span
+}
+
+// setSpanAttributes sets attrs on span and on the deferred span of rctx.
+func setSpanAttributes(span trace.Span, rctx *rpcContext, attrs ...attribute.KeyValue) {
+	span.SetAttributes(attrs...)
+	if rctx != nil && rctx.deferred != nil {
+		rctx.deferred.setAttributes(attrs...)
+	}
+}
+
+type tracingModule struct{}
+
+// TracingModule returns the module serving the sampling configured under
+// TracingConfigPath. The sampling is replaced when the configuration is
+// reloaded; without it every call is traced.
+func TracingModule() module.Module {
+	return tracingModule{}
+}
+
+func (tracingModule) Name() string { return TracingModuleName }
+
+func (tracingModule) ConfigPath() string { return TracingConfigPath }
+
+func (tracingModule) Init(_ context.Context, view config.View) error {
+	next, err := decodeSampling(view)
+	if err != nil {
+		return err
+	}
+	currentSampling.Store(next)
+	return nil
+}
+
+func (tracingModule) PrepareReload(
+	_ context.Context,
+	view config.View,
+) (module.ReloadCommitter, error) {
+	next, err := decodeSampling(view)
+	if err != nil {
+		return nil, err
+	}
+	return samplingCommitter{next: next, prev: currentSampling.Load()}, nil
+}
+
+func (tracingModule) Stop(context.Context) error {
+	currentSampling.Store(nil)
+	return nil
+}
+
+// decodeSampling returns the sampling configured in view, or nil when
+// nothing is configured.
+func decodeSampling(view config.View) (*sampling, error) {
+	if view == nil || !view.Exists() {
+		return nil, nil
+	}
+	cfg := TracingConfig{}
+	if err := view.Decode(&cfg); err != nil {
+		return nil, fmt.Errorf("load tracing config: %w", err)
+	}
+	next, err := newSampling(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("load tracing config: %w", err)
+	}
+	return next, nil
+}
+
+type samplingCommitter struct {
+	next *sampling
+	prev *sampling
+}
+
+func (c samplingCommitter) Commit(context.Context) error {
+	currentSampling.Store(c.next)
+	return nil
+}
+
+func (c samplingCommitter) Rollback(context.Context) error {
+	currentSampling.Store(c.prev)
+	return nil
+}
@@ -0,0 +1,288 @@
+// Copyright 2022 The codesjoy Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package otel
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/noop"
+
+	"github.com/codesjoy/yggdrasil/v3/config"
+	"github.com/codesjoy/yggdrasil/v3/module"
+	"github.com/codesjoy/yggdrasil/v3/observability/stats"
+)
+
+// recordingTracer records the spans it starts.
+type recordingTracer struct {
+	noop.Tracer
+
+	mu    sync.Mutex
+	spans []*recordedSpan
+	next  byte
+}
+
+type recordedSpan struct {
+	noop.Span
+
+	name   string
+	sc     trace.SpanContext
+	parent trace.SpanContext
+	cfg    trace.SpanConfig
+	attrs  []attribute.KeyValue
+	ended  bool
+}
+
+func (s *recordedSpan) SpanContext() trace.SpanContext { return s.sc }
+func (s *recordedSpan) IsRecording() bool              { return !s.ended }
+func (s *recordedSpan) End(...trace.SpanEndOption)     { s.ended = true }
+func (s *recordedSpan) SetAttributes(kv ...attribute.KeyValue) {
+	s.attrs = append(s.attrs, kv...)
+}
+
+func (s *recordedSpan) attr(key attribute.Key) string {
+	for _, kv := range append(s.cfg.Attributes(), s.attrs...) {
+		if kv.Key == key {
+			return kv.Value.Emit()
+		}
+	}
+	return ""
+}
+
+func (t *recordingTracer) Start(
+	ctx context.Context,
+	name string,
+	opts ...trace.SpanStartOption,
+) (context.Context, trace.Span) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	cfg := trace.NewSpanStartConfig(opts...)
+	parent := trace.SpanContextFromContext(ctx)
+	if cfg.NewRoot() {
+		parent = trace.SpanContext{}
+	}
+	t.next++
+	traceID := parent.TraceID()
+	if !parent.IsValid() {
+		traceID = trace.TraceID{t.next}
+	}
+	span := &recordedSpan{
+		name:   name,
+		parent: parent,
+		cfg:    cfg,
+		sc: trace.NewSpanContext(trace.SpanContextConfig{
+			TraceID:    traceID,
+			SpanID:     trace.SpanID{t.next},
+			TraceFlags: trace.FlagsSampled,
+		}),
+	}
+	t.spans = append(t.spans, span)
+	return trace.ContextWithSpan(ctx, span), span
+}
+
+func (t *recordingTracer) recorded() []*recordedSpan {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return append([]*recordedSpan(nil), t.spans...)
+}
+
+type recordingProvider struct {
+	noop.TracerProvider
+	tracer *recordingTracer
+}
+
+func (p recordingProvider) Tracer(string, ...trace.TracerOption) trace.Tracer {
+	return p.tracer
+}
+
+func useSampling(t *testing.T, cfg TracingConfig) {
+	t.Helper()
+	s, err := newSampling(cfg)
+	require.NoError(t, err)
+	currentSampling.Store(s)
+	t.Cleanup(func() { currentSampling.Store(nil) })
+}
+
+func newRecordingHandler(isServer bool) (stats.Handler, *recordingTracer) {
+	tracer := &recordingTracer{}
+	runtime := HandlerRuntime{TracerProvider: recordingProvider{tracer: tracer}}
+	if isServer {
+		return newSvrHandlerWithRuntime(&Config{}, runtime), tracer
+	}
+	return newCliHandlerWithRuntime(&Config{}, runtime), tracer
+}
+
+func runRPC(
+	ctx context.Context,
+	h stats.Handler,
+	method string,
+	elapsed time.Duration,
+	err error,
+) context.Context {
+	ctx = h.TagRPC(ctx, &stats.RPCTagInfoBase{FullMethod: method})
+	begin := time.Now()
+	h.HandleRPC(ctx, &stats.RPCEndBase{BeginTime: begin, EndTime: begin.Add(elapsed), Err: err})
+	return ctx
+}
+
+func TestSamplingDropsAndTracesLate(t *testing.T) {
+	useSampling(t, TracingConfig{SamplingRule: SamplingRule{
+		Sampler:       SamplerNever,
+		SampleErrors:  true,
+		SlowThreshold: time.Second,
+	}})
+	h, tracer := newRecordingHandler(true)
+
+	ctx := runRPC(context.Background(), h, "/pkg.Svc/Get", time.Millisecond, nil)
+	assert.Empty(t, tracer.recorded())
+	sc := trace.SpanContextFromContext(ctx)
+	assert.True(t, sc.IsValid(), "dropped calls propagate their decision")
+	assert.False(t, sc.IsSampled())
+
+	runRPC(context.Background(), h, "/pkg.Svc/Get", time.Millisecond, errors.New("boom"))
+	runRPC(context.Background(), h, "/pkg.Svc/Get", 2*time.Second, nil)
+	spans := tracer.recorded()
+	require.Len(t, spans, 2)
+	assert.Equal(t, "error", spans[0].attr(samplingReasonKey))
+	assert.Equal(t, "slow", spans[1].attr(samplingReasonKey))
+	for _, span := range spans {
+		assert.True(t, span.ended)
+		assert.Equal(t, "pkg.Svc/Get", span.name)
+		assert.Equal(t, trace.SpanKindServer, span.cfg.SpanKind())
+		assert.False(t, span.cfg.Timestamp().IsZero(), "late spans start with the call")
+		assert.NotEmpty(t, span.attr(codeKey))
+	}
+}
+
+func TestSamplingFollowsParent(t *testing.T) {
+	useSampling(t, TracingConfig{SamplingRule: SamplingRule{
+		Sampler:      SamplerNever,
+		SampleErrors: true,
+	}})
+	h, tracer := newRecordingHandler(false)
+	sampled := trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID:    trace.TraceID{0xaa},
+		SpanID:     trace.SpanID{0xbb},
+		TraceFlags: trace.FlagsSampled,
+	})
+	runRPC(trace.ContextWithSpanContext(context.Background(), sampled), h, "/pkg.Svc/Get", 0, nil)
+	spans := tracer.recorded()
+	require.Len(t, spans, 1)
+	assert.Equal(t, sampled, spans[0].parent)
+
+	// A failing call below an unsampled parent starts a trace linked to it.
+	unsampledParent := sampled.WithTraceFlags(0)
+	ctx := trace.ContextWithSpanContext(context.Background(), unsampledParent)
+	runRPC(ctx, h, "/pkg.Svc/Get", 0, errors.New("boom"))
+	spans = tracer.recorded()
+	require.Len(t, spans, 2)
+	assert.True(t, spans[1].cfg.NewRoot())
+	require.Len(t, spans[1].cfg.Links(), 1)
+	assert.Equal(t, unsampledParent, spans[1].cfg.Links()[0].SpanContext)
+}
+
+func TestSamplingMethodOverrides(t *testing.T) {
+	useSampling(t, TracingConfig{
+		SamplingRule: SamplingRule{Sampler: SamplerNever},
+		Methods: map[string]SamplingRule{
+			"/pkg.Svc/*":   {Sampler: SamplerAlways},
+			"/pkg.Svc/Hot": {Sampler: SamplerRateLimited, Rate: 1},
+		},
+	})
+	h, tracer := newRecordingHandler(true)
+	runRPC(context.Background(), h, "/other.Svc/Get", 0, nil)
+	runRPC(context.Background(), h, "/pkg.Svc/Get", 0, nil)
+	runRPC(context.Background(), h, "/pkg.Svc/Hot", 0, nil)
+	runRPC(context.Background(), h, "/pkg.Svc/Hot", 0, nil)
+	var names []string
+	for _, span := range tracer.recorded() {
+		names = append(names, span.name)
+	}
+	assert.Equal(t, []string{"pkg.Svc/Get", "pkg.Svc/Hot"}, names)
+}
+
+func TestSampleRatio(t *testing.T) {
+	low := trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID: trace.TraceID{15: 1},
+		SpanID:  trace.SpanID{1},
+	})
+	high := trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID: trace.TraceID{8: 0xff, 15: 1},
+		SpanID:  trace.SpanID{1},
+	})
+	assert.True(t, sampleRatio(low, 0.5))
+	assert.False(t, sampleRatio(high, 0.5))
+	assert.False(t, sampleRatio(low, 0))
+	assert.True(t, sampleRatio(high, 1))
+}
+
+func TestNewSamplingErrors(t *testing.T) {
+	for name, cfg := range map[string]TracingConfig{
+		"unknown sampler": {SamplingRule: SamplingRule{Sampler: "sometimes"}},
+		"ratio":           {SamplingRule: SamplingRule{Sampler: SamplerRatio, Ratio: 2}},
+		"rate":            {SamplingRule: SamplingRule{Sampler: SamplerRateLimited}},
+		"pattern":         {Methods: map[string]SamplingRule{"/pkg.Svc/[": {}}},
+	} {
+		_, err := newSampling(cfg)
+		assert.Error(t, err, name)
+	}
+}
+
+func TestTracingModule(t *testing.T) {
+	m := TracingModule()
+	assert.Equal(t, TracingModuleName, m.Name())
+	view := func(value map[string]any) config.View {
+		return config.NewView(TracingConfigPath, config.NewSnapshot(value))
+	}
+	require.NoError(t, m.(module.Initializable).Init(context.Background(),
+		config.NewView(TracingConfigPath, config.NewSnapshot(nil))))
+	assert.Nil(t, currentSampling.Load())
+
+	committer, err := m.(module.Reloadable).PrepareReload(context.Background(), view(map[string]any{
+		"sampler":        "ratio",
+		"ratio":          0.1,
+		"sample_errors":  true,
+		"slow_threshold": "500ms",
+		"methods": map[string]any{
+			"/pkg.Svc/Get": map[string]any{"sampler": "never"},
+		},
+	}))
+	require.NoError(t, err)
+	require.NoError(t, committer.Commit(context.Background()))
+	s := currentSampling.Load()
+	require.NotNil(t, s)
+	assert.Equal(t, SamplingRule{
+		Sampler:       SamplerRatio,
+		Ratio:         0.1,
+		SampleErrors:  true,
+		SlowThreshold: 500 * time.Millisecond,
+	}, s.rule.rule)
+	assert.Equal(t, SamplerNever, s.forMethod("/pkg.Svc/Get").rule.Sampler)
+
+	_, err = m.(module.Reloadable).PrepareReload(context.Background(), view(map[string]any{
+		"sampler": "sometimes",
+	}))
+	require.Error(t, err)
+
+	require.NoError(t, m.(module.Stoppable).Stop(context.Background()))
+	assert.Nil(t, currentSampling.Load())
+}
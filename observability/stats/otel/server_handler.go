@@ -34,12 +34,13 @@ func newSvrHandler() *serverHandler {
 }
 
 // TagChannel can attach some information to the given context.
-func (h *serverHandler) TagChannel(ctx context.Context, _ stats.ChanTagInfo) context.Context {
-	return ctx
+func (h *serverHandler) TagChannel(ctx context.Context, info stats.ChanTagInfo) context.Context {
+	return h.tagChannel(ctx, info, true)
 }
 
 // HandleChannel processes the channel stats.
-func (h *serverHandler) HandleChannel(context.Context, stats.ChanStats) {
+func (h *serverHandler) HandleChannel(ctx context.Context, cs stats.ChanStats) {
+	h.handleChannel(ctx, cs)
 }
 
 // TagRPC can attach some information to the given context.
@@ -48,15 +49,19 @@ func (h *serverHandler) TagRPC(ctx context.Context, info stats.RPCTagInfo) conte
 
 	spanName, attrs := parseFullMethod(info.GetFullMethod())
 	attrs = append(attrs, semconv.RPCSystemKey.String("yggdrasil"))
-	ctx, _ = h.tracer.Start(
+	ctx, deferred := h.startSpan(
 		trace.ContextWithRemoteSpanContext(ctx, trace.SpanContextFromContext(ctx)),
+		info.GetFullMethod(),
 		spanName,
-		trace.WithSpanKind(trace.SpanKindServer),
-		trace.WithAttributes(attrs...),
+		trace.SpanKindServer,
+		attrs,
 	)
 
+	metricAttrs, capped := h.cardinality.methodAttrs(info.GetFullMethod(), attrs)
 	return context.WithValue(ctx, rpcContextKey{}, &rpcContext{
-		metricAttrs: attrs,
+		metricAttrs: metricAttrs,
+		capped:      capped,
+		deferred:    deferred,
 	})
 }
 
@@ -21,7 +21,9 @@ import (
 
 // ProviderSettings contains provider-specific stats payloads.
 type ProviderSettings struct {
-	OTel map[string]any `mapstructure:"otel"`
+	OTel     map[string]any `mapstructure:"otel"`
+	SlowRPC  map[string]any `mapstructure:"slow_rpc"`
+	Channelz map[string]any `mapstructure:"channelz"`
 }
 
 // Settings contains resolved observability stats settings.
@@ -29,6 +31,7 @@ type Settings struct {
 	Server    string           `mapstructure:"server"`
 	Client    string           `mapstructure:"client"`
 	Providers ProviderSettings `mapstructure:"providers"`
+	Derived   DerivedSettings  `mapstructure:"derived"`
 }
 
 var (
@@ -0,0 +1,260 @@
+// Copyright 2022 The codesjoy Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package slowrpc provides a stats handler that aggregates the slowest
+// methods over a sliding window. It complements the per-call slow logging of
+// the logging interceptor with a ranked view exposed through the governor.
+package slowrpc
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/codesjoy/yggdrasil/v3/observability/stats"
+)
+
+// Name is the stats handler name.
+const Name = "slow_rpc"
+
+// Config defines the slow RPC reporter configuration.
+type Config struct {
+	// Window is the aggregation window. The report covers the current and
+	// the previous window.
+	Window time.Duration `mapstructure:"window" default:"1m"`
+	// TopN is the number of methods reported.
+	TopN int `mapstructure:"top_n" default:"10"`
+}
+
+// MethodStats is the aggregate of one method on one side.
+type MethodStats struct {
+	Method       string  `json:"method"`
+	Side         string  `json:"side"`
+	Count        int64   `json:"count"`
+	Errors       int64   `json:"errors"`
+	MaxLatencyMs float64 `json:"max_latency_ms"`
+	AvgLatencyMs float64 `json:"avg_latency_ms"`
+}
+
+type methodKey struct {
+	method string
+	client bool
+}
+
+type aggregate struct {
+	count  int64
+	errors int64
+	total  time.Duration
+	max    time.Duration
+}
+
+func (a *aggregate) merge(o *aggregate) {
+	a.count += o.count
+	a.errors += o.errors
+	a.total += o.total
+	if o.max > a.max {
+		a.max = o.max
+	}
+}
+
+// Reporter aggregates RPC latencies per method.
+type Reporter struct {
+	mu          sync.Mutex
+	cfg         Config
+	now         func() time.Time
+	windowStart time.Time
+	cur         map[methodKey]*aggregate
+	prev        map[methodKey]*aggregate
+}
+
+// NewReporter returns a reporter with cfg.
+func NewReporter(cfg Config) *Reporter {
+	r := &Reporter{now: time.Now}
+	r.Configure(cfg)
+	return r
+}
+
+var (
+	defaultOnce     sync.Once
+	defaultReporter *Reporter
+)
+
+// Default returns the process-wide reporter fed by the builtin handler.
+func Default() *Reporter {
+	defaultOnce.Do(func() {
+		defaultReporter = NewReporter(Config{})
+	})
+	return defaultReporter
+}
+
+// BuiltinHandlerBuilder returns the builder of handlers feeding Default.
+func BuiltinHandlerBuilder() stats.HandlerBuilder {
+	return Default().Handler
+}
+
+// BuiltinHandlerBuilderWithConfig configures Default and returns the builder
+// of handlers feeding it.
+func BuiltinHandlerBuilderWithConfig(cfg Config) stats.HandlerBuilder {
+	Default().Configure(cfg)
+	return Default().Handler
+}
+
+// Configure replaces the configuration and resets the collected data.
+func (r *Reporter) Configure(cfg Config) {
+	if cfg.Window <= 0 {
+		cfg.Window = time.Minute
+	}
+	if cfg.TopN <= 0 {
+		cfg.TopN = 10
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.cfg = cfg
+	r.windowStart = r.now()
+	r.cur = map[methodKey]*aggregate{}
+	r.prev = map[methodKey]*aggregate{}
+}
+
+// rotate moves to the window containing now. Callers hold r.mu.
+func (r *Reporter) rotate(now time.Time) {
+	elapsed := now.Sub(r.windowStart)
+	if elapsed < r.cfg.Window {
+		return
+	}
+	if elapsed < 2*r.cfg.Window {
+		r.prev = r.cur
+	} else {
+		r.prev = map[methodKey]*aggregate{}
+	}
+	r.cur = map[methodKey]*aggregate{}
+	r.windowStart = now.Add(-elapsed % r.cfg.Window)
+}
+
+func (r *Reporter) record(key methodKey, latency time.Duration, failed bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.rotate(r.now())
+	agg := r.cur[key]
+	if agg == nil {
+		agg = &aggregate{}
+		r.cur[key] = agg
+	}
+	agg.merge(&aggregate{count: 1, total: latency, max: latency})
+	if failed {
+		agg.errors++
+	}
+}
+
+// Top returns the slowest methods by maximum latency, slowest first.
+func (r *Reporter) Top() []MethodStats {
+	r.mu.Lock()
+	r.rotate(r.now())
+	merged := make(map[methodKey]*aggregate, len(r.cur)+len(r.prev))
+	for _, window := range []map[methodKey]*aggregate{r.prev, r.cur} {
+		for key, agg := range window {
+			if merged[key] == nil {
+				merged[key] = &aggregate{}
+			}
+			merged[key].merge(agg)
+		}
+	}
+	topN := r.cfg.TopN
+	r.mu.Unlock()
+
+	out := make([]MethodStats, 0, len(merged))
+	for key, agg := range merged {
+		side := "server"
+		if key.client {
+			side = "client"
+		}
+		out = append(out, MethodStats{
+			Method:       key.method,
+			Side:         side,
+			Count:        agg.count,
+			Errors:       agg.errors,
+			MaxLatencyMs: milliseconds(agg.max),
+			AvgLatencyMs: milliseconds(agg.total / time.Duration(agg.count)),
+		})
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].MaxLatencyMs != out[j].MaxLatencyMs {
+			return out[i].MaxLatencyMs > out[j].MaxLatencyMs
+		}
+		return out[i].Method < out[j].Method
+	})
+	if len(out) > topN {
+		out = out[:topN]
+	}
+	return out
+}
+
+// ServeHTTP writes the report as JSON.
+func (r *Reporter) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	w.WriteHeader(http.StatusOK)
+	encoder := json.NewEncoder(w)
+	if req.URL.Query().Get("pretty") == "true" {
+		encoder.SetIndent("", "    ")
+	}
+	_ = encoder.Encode(map[string]any{
+		"window": r.window().String(),
+		"top":    r.Top(),
+	})
+}
+
+func (r *Reporter) window() time.Duration {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.cfg.Window
+}
+
+func milliseconds(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
+
+// Handler returns a stats handler feeding r.
+func (r *Reporter) Handler(bool) stats.Handler {
+	return &handler{reporter: r}
+}
+
+type methodCtxKey struct{}
+
+type handler struct {
+	reporter *Reporter
+}
+
+func (h *handler) TagRPC(ctx context.Context, info stats.RPCTagInfo) context.Context {
+	return context.WithValue(ctx, methodCtxKey{}, info.GetFullMethod())
+}
+
+func (h *handler) HandleRPC(ctx context.Context, rs stats.RPCStats) {
+	end, ok := rs.(stats.RPCEnd)
+	if !ok {
+		return
+	}
+	method, _ := ctx.Value(methodCtxKey{}).(string)
+	h.reporter.record(
+		methodKey{method: method, client: end.IsClient()},
+		end.GetEndTime().Sub(end.GetBeginTime()),
+		end.Error() != nil,
+	)
+}
+
+func (h *handler) TagChannel(ctx context.Context, _ stats.ChanTagInfo) context.Context {
+	return ctx
+}
+
+func (h *handler) HandleChannel(context.Context, stats.ChanStats) {}
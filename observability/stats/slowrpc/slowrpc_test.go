@@ -0,0 +1,98 @@
+// Copyright 2022 The codesjoy Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package slowrpc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/codesjoy/yggdrasil/v3/observability/stats"
+)
+
+func call(h stats.Handler, method string, client bool, latency time.Duration, err error) {
+	ctx := h.TagRPC(context.Background(), &stats.RPCTagInfoBase{FullMethod: method})
+	begin := time.Unix(0, 0)
+	h.HandleRPC(ctx, &stats.RPCEndBase{
+		Client:    client,
+		BeginTime: begin,
+		EndTime:   begin.Add(latency),
+		Err:       err,
+	})
+}
+
+func TestReporter_Top(t *testing.T) {
+	r := NewReporter(Config{TopN: 2})
+	h := r.Handler(true)
+	call(h, "/svc/Fast", false, 10*time.Millisecond, nil)
+	call(h, "/svc/Slow", false, 300*time.Millisecond, nil)
+	call(h, "/svc/Slow", false, 100*time.Millisecond, errors.New("boom"))
+	call(h, "/svc/Mid", true, 200*time.Millisecond, nil)
+
+	top := r.Top()
+	require.Len(t, top, 2)
+	assert.Equal(t, MethodStats{
+		Method:       "/svc/Slow",
+		Side:         "server",
+		Count:        2,
+		Errors:       1,
+		MaxLatencyMs: 300,
+		AvgLatencyMs: 200,
+	}, top[0])
+	assert.Equal(t, "/svc/Mid", top[1].Method)
+	assert.Equal(t, "client", top[1].Side)
+}
+
+func TestReporter_Window(t *testing.T) {
+	now := time.Unix(1000, 0)
+	r := &Reporter{now: func() time.Time { return now }}
+	r.Configure(Config{Window: time.Minute})
+	h := r.Handler(true)
+
+	call(h, "/svc/A", false, time.Second, nil)
+	now = now.Add(90 * time.Second)
+	call(h, "/svc/B", false, time.Second, nil)
+	assert.Len(t, r.Top(), 2, "previous window is still reported")
+
+	now = now.Add(60 * time.Second)
+	top := r.Top()
+	require.Len(t, top, 1)
+	assert.Equal(t, "/svc/B", top[0].Method)
+
+	now = now.Add(5 * time.Minute)
+	assert.Empty(t, r.Top())
+}
+
+func TestReporter_ServeHTTP(t *testing.T) {
+	r := NewReporter(Config{})
+	call(r.Handler(false), "/svc/A", true, time.Millisecond, nil)
+
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest("GET", "/stats/slow", nil))
+	var body struct {
+		Window string        `json:"window"`
+		Top    []MethodStats `json:"top"`
+	}
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &body))
+	assert.Equal(t, "1m0s", body.Window)
+	require.Len(t, body.Top, 1)
+	assert.Equal(t, "/svc/A", body.Top[0].Method)
+}
@@ -0,0 +1,107 @@
+// Copyright 2022 The codesjoy Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package stats
+
+import "time"
+
+// RPCSendBufferFull is reported by a server transport when a streaming
+// handler waited longer than the configured timeout for room in the send
+// buffer of a stream, which means the client reads slower than the handler
+// produces.
+type RPCSendBufferFull interface {
+	RPCStats
+	// GetFullMethod returns the full RPC method string.
+	GetFullMethod() string
+	// GetBufferedMessages returns the number of messages queued.
+	GetBufferedMessages() int
+	// GetBufferedBytes returns the encoded size of the queued messages.
+	GetBufferedBytes() int
+	// GetWaited returns how long the handler waited.
+	GetWaited() time.Duration
+	// IsAborted returns true if the stream was aborted with UNAVAILABLE.
+	IsAborted() bool
+}
+
+// RPCSendBufferFullBase contains the stats of a stream whose send buffer
+// stayed full.
+type RPCSendBufferFullBase struct {
+	// FullMethod is the full RPC method string, i.e., /package.service/method.
+	FullMethod string
+	// BufferedMessages is the number of messages queued.
+	BufferedMessages int
+	// BufferedBytes is the encoded size of the queued messages.
+	BufferedBytes int
+	// Waited is how long the handler waited.
+	Waited time.Duration
+	// Aborted is true if the stream was aborted with UNAVAILABLE.
+	Aborted bool
+}
+
+func (s *RPCSendBufferFullBase) isRPCStats() {}
+
+// GetFullMethod returns the full RPC method string.
+func (s *RPCSendBufferFullBase) GetFullMethod() string { return s.FullMethod }
+
+// GetBufferedMessages returns the number of messages queued.
+func (s *RPCSendBufferFullBase) GetBufferedMessages() int { return s.BufferedMessages }
+
+// GetBufferedBytes returns the encoded size of the queued messages.
+func (s *RPCSendBufferFullBase) GetBufferedBytes() int { return s.BufferedBytes }
+
+// GetWaited returns how long the handler waited.
+func (s *RPCSendBufferFullBase) GetWaited() time.Duration { return s.Waited }
+
+// IsAborted returns true if the stream was aborted with UNAVAILABLE.
+func (s *RPCSendBufferFullBase) IsAborted() bool { return s.Aborted }
+
+// RPCStreamIdle is reported by a server transport when a streaming RPC has
+// exchanged no messages in either direction for the configured idle timeout.
+type RPCStreamIdle interface {
+	RPCStats
+	// GetFullMethod returns the full RPC method string.
+	GetFullMethod() string
+	// GetIdle returns how long the stream has been idle.
+	GetIdle() time.Duration
+	// GetAction returns the configured idle action: warn, ping or cancel.
+	GetAction() string
+	// IsCancelled returns true if the stream was cancelled.
+	IsCancelled() bool
+}
+
+// RPCStreamIdleBase contains the stats of an idle stream.
+type RPCStreamIdleBase struct {
+	// FullMethod is the full RPC method string, i.e., /package.service/method.
+	FullMethod string
+	// Idle is how long the stream has been idle.
+	Idle time.Duration
+	// Action is the configured idle action.
+	Action string
+	// Cancelled is true if the stream was cancelled.
+	Cancelled bool
+}
+
+func (s *RPCStreamIdleBase) isRPCStats() {}
+
+// GetFullMethod returns the full RPC method string.
+func (s *RPCStreamIdleBase) GetFullMethod() string { return s.FullMethod }
+
+// GetIdle returns how long the stream has been idle.
+func (s *RPCStreamIdleBase) GetIdle() time.Duration { return s.Idle }
+
+// GetAction returns the configured idle action.
+func (s *RPCStreamIdleBase) GetAction() string { return s.Action }
+
+// IsCancelled returns true if the stream was cancelled.
+func (s *RPCStreamIdleBase) IsCancelled() bool { return s.Cancelled }
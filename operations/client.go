@@ -0,0 +1,166 @@
+// Copyright 2022 The codesjoy Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package operations
+
+import (
+	"context"
+	"time"
+
+	"cloud.google.com/go/longrunning/autogen/longrunningpb"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/emptypb"
+
+	"github.com/codesjoy/yggdrasil/v3/rpc/status"
+	"github.com/codesjoy/yggdrasil/v3/transport/runtime/client"
+)
+
+const (
+	defaultMinPollInterval = 100 * time.Millisecond
+	defaultMaxPollInterval = 5 * time.Second
+)
+
+// Client calls the google.longrunning.Operations service, typically of the
+// server that returned an operation from one of its methods.
+type Client struct {
+	cc          client.Client
+	minInterval time.Duration
+	maxInterval time.Duration
+}
+
+// ClientOption configures a Client.
+type ClientOption func(*Client)
+
+// WithPollInterval sets the interval between the polls of Wait. It starts at
+// minInterval and doubles up to maxInterval; the default is 100ms to 5s.
+func WithPollInterval(minInterval, maxInterval time.Duration) ClientOption {
+	return func(c *Client) {
+		if minInterval > 0 {
+			c.minInterval = minInterval
+		}
+		if maxInterval >= c.minInterval {
+			c.maxInterval = maxInterval
+		}
+	}
+}
+
+// NewClient returns a client calling the Operations service over cc.
+func NewClient(cc client.Client, opts ...ClientOption) *Client {
+	c := &Client{
+		cc:          cc,
+		minInterval: defaultMinPollInterval,
+		maxInterval: defaultMaxPollInterval,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+func (c *Client) invoke(
+	ctx context.Context,
+	method string,
+	in, out proto.Message,
+	opts []client.CallOption,
+) error {
+	return c.cc.Invoke(ctx, "/"+ServiceName+"/"+method, in, out, opts...)
+}
+
+// GetOperation returns the latest state of the operation called name.
+func (c *Client) GetOperation(
+	ctx context.Context,
+	name string,
+	opts ...client.CallOption,
+) (*longrunningpb.Operation, error) {
+	out := &longrunningpb.Operation{}
+	req := &longrunningpb.GetOperationRequest{Name: name}
+	if err := c.invoke(ctx, "GetOperation", req, out, opts); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// ListOperations returns one page of operations.
+func (c *Client) ListOperations(
+	ctx context.Context,
+	req *longrunningpb.ListOperationsRequest,
+	opts ...client.CallOption,
+) (*longrunningpb.ListOperationsResponse, error) {
+	out := &longrunningpb.ListOperationsResponse{}
+	if err := c.invoke(ctx, "ListOperations", req, out, opts); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// CancelOperation asks the server to cancel the operation called name.
+func (c *Client) CancelOperation(
+	ctx context.Context,
+	name string,
+	opts ...client.CallOption,
+) error {
+	req := &longrunningpb.CancelOperationRequest{Name: name}
+	return c.invoke(ctx, "CancelOperation", req, &emptypb.Empty{}, opts)
+}
+
+// DeleteOperation tells the server the operation called name is no longer
+// of interest.
+func (c *Client) DeleteOperation(
+	ctx context.Context,
+	name string,
+	opts ...client.CallOption,
+) error {
+	req := &longrunningpb.DeleteOperationRequest{Name: name}
+	return c.invoke(ctx, "DeleteOperation", req, &emptypb.Empty{}, opts)
+}
+
+// Wait polls op until it is done and unmarshals its response into out,
+// which may be nil. It returns the error the operation failed with, or the
+// status of ctx once its deadline passes or it is cancelled.
+func (c *Client) Wait(
+	ctx context.Context,
+	op *longrunningpb.Operation,
+	out proto.Message,
+	opts ...client.CallOption,
+) error {
+	interval := c.minInterval
+	for !op.GetDone() {
+		timer := time.NewTimer(interval)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return status.FromContextError(ctx.Err()).Err()
+		}
+		interval = min(interval*2, c.maxInterval)
+		next, err := c.GetOperation(ctx, op.GetName(), opts...)
+		if err != nil {
+			return err
+		}
+		op = next
+	}
+	return Result(op, out)
+}
+
+// Result returns the error of a done operation, or unmarshals its response
+// into out, which may be nil.
+func Result(op *longrunningpb.Operation, out proto.Message) error {
+	if stu := op.GetError(); stu != nil {
+		return status.FromProto(stu).Err()
+	}
+	if out == nil || op.GetResponse() == nil {
+		return nil
+	}
+	return op.GetResponse().UnmarshalTo(out)
+}
@@ -0,0 +1,113 @@
+// Copyright 2022 The codesjoy Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package operations
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/codesjoy/yggdrasil/v3/config"
+	"github.com/codesjoy/yggdrasil/v3/module"
+)
+
+const (
+	// ModuleName is the name of the operations module.
+	ModuleName = "operations"
+	// ConfigPath is the config path holding the operations settings.
+	ConfigPath = "yggdrasil.operations"
+)
+
+// Config defines the operations settings under ConfigPath.
+type Config struct {
+	// Enabled registers the google.longrunning.Operations service serving
+	// Default on the RPC server. It is read when the server is created.
+	Enabled bool `mapstructure:"enabled"`
+	// Prefix is the collection new operations are named under, as in
+	// "operations/<id>".
+	Prefix string `mapstructure:"prefix" default:"operations"`
+	// Store names the operation store: "memory" or a store registered with
+	// RegisterStore.
+	Store string `mapstructure:"store" default:"memory"`
+	// TTL is how long an operation is kept after its last update.
+	TTL time.Duration `mapstructure:"ttl" default:"24h"`
+	// PollInterval is how often WaitOperation checks the store.
+	PollInterval time.Duration `mapstructure:"poll_interval" default:"100ms"`
+}
+
+func defaultConfig() Config {
+	return Config{
+		Prefix:       "operations",
+		Store:        MemoryStoreName,
+		TTL:          24 * time.Hour,
+		PollInterval: 100 * time.Millisecond,
+	}
+}
+
+type operationsModule struct{}
+
+// Module returns the module applying the settings under ConfigPath to
+// Default.
+func Module() module.Module {
+	return operationsModule{}
+}
+
+func (operationsModule) Name() string { return ModuleName }
+
+func (operationsModule) ConfigPath() string { return ConfigPath }
+
+func (operationsModule) Init(_ context.Context, view config.View) error {
+	cfg, err := decodeConfig(view)
+	if err != nil {
+		return err
+	}
+	return Default().Configure(cfg)
+}
+
+func (operationsModule) PrepareReload(
+	_ context.Context,
+	view config.View,
+) (module.ReloadCommitter, error) {
+	next, err := decodeConfig(view)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := resolveStore(next); err != nil {
+		return nil, err
+	}
+	prev, _ := Default().settings()
+	return configCommitter{next: next, prev: prev}, nil
+}
+
+func decodeConfig(view config.View) (Config, error) {
+	cfg := Config{}
+	if err := view.Decode(&cfg); err != nil {
+		return Config{}, fmt.Errorf("load operations config: %w", err)
+	}
+	return cfg, nil
+}
+
+type configCommitter struct {
+	next Config
+	prev Config
+}
+
+func (c configCommitter) Commit(context.Context) error {
+	return Default().Configure(c.next)
+}
+
+func (c configCommitter) Rollback(context.Context) error {
+	return Default().Configure(c.prev)
+}
@@ -0,0 +1,434 @@
+// Copyright 2022 The codesjoy Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package operations serves long-running operations as described by AIP-151.
+//
+// A handler whose work outlives the RPC starts it with Manager.Start and
+// returns the google.longrunning.Operation it gets back. The work runs in the
+// background; it reports progress through the Handle it is given, and its
+// result or error completes the operation. Clients follow the operation
+// through the google.longrunning.Operations service, which the operations
+// module registers on the server, and wait for it with Client.Wait. For
+// methods whose google.longrunning.operation_info option names a response
+// type, protoc-gen-yggdrasil-rpc also generates a typed <Method>AndWait
+// client helper built on Client.Wait.
+//
+// Operations are kept in a Store: the builtin memory store keeps them in the
+// process, NewRedisStore shares them across instances.
+package operations
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+
+	"cloud.google.com/go/longrunning/autogen/longrunningpb"
+	"google.golang.org/genproto/googleapis/rpc/code"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/anypb"
+
+	"github.com/codesjoy/yggdrasil/v3/rpc/status"
+)
+
+var (
+	// ErrNotFound is returned for an operation that does not exist or has
+	// expired.
+	ErrNotFound = errors.New("operation not found")
+	// ErrDone is returned when updating an operation that already completed,
+	// e.g. because it was cancelled.
+	ErrDone = errors.New("operation already done")
+)
+
+// Store keeps operations by name.
+type Store interface {
+	// Put creates or replaces op, keeping it for ttl.
+	Put(ctx context.Context, op *longrunningpb.Operation, ttl time.Duration) error
+	// Get returns the operation called name, or ErrNotFound.
+	Get(ctx context.Context, name string) (*longrunningpb.Operation, error)
+	// Update applies fn to the operation called name and stores the result
+	// for ttl, with no other update landing between the read and the write.
+	// When fn fails nothing is stored, and Update returns the operation as
+	// read along with the error of fn.
+	Update(
+		ctx context.Context,
+		name string,
+		ttl time.Duration,
+		fn func(*longrunningpb.Operation) error,
+	) (*longrunningpb.Operation, error)
+	// Delete removes the operation called name.
+	Delete(ctx context.Context, name string) error
+	// List returns up to pageSize operations whose names start with prefix,
+	// oldest first, and the token of the next page, empty on the last one.
+	List(
+		ctx context.Context,
+		prefix string,
+		pageSize int,
+		pageToken string,
+	) ([]*longrunningpb.Operation, string, error)
+}
+
+// RunFunc performs the work of an operation started with Manager.Start. Its
+// response completes the operation; its error fails it.
+type RunFunc func(ctx context.Context, h *Handle) (proto.Message, error)
+
+// Manager starts operations and tracks the ones running in the process.
+type Manager struct {
+	mu      sync.RWMutex
+	cfg     Config
+	store   Store
+	memory  Store
+	running map[string]context.CancelFunc
+}
+
+var (
+	defaultOnce    sync.Once
+	defaultManager *Manager
+)
+
+// Default returns the process-wide manager configured by the operations
+// module and served by the Operations service it registers.
+func Default() *Manager {
+	defaultOnce.Do(func() {
+		defaultManager = NewManager(nil)
+	})
+	return defaultManager
+}
+
+// NewManager returns a manager keeping its operations in store, or in a
+// memory store when store is nil.
+func NewManager(store Store) *Manager {
+	memory := NewMemoryStore(defaultMaxEntries)
+	if store == nil {
+		store = memory
+	}
+	return &Manager{
+		cfg:     defaultConfig(),
+		store:   store,
+		memory:  memory,
+		running: map[string]context.CancelFunc{},
+	}
+}
+
+// Configure applies cfg. Operations already stored stay in the previous
+// store when cfg selects another one.
+func (m *Manager) Configure(cfg Config) error {
+	store, err := resolveStore(cfg)
+	if err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if store == nil {
+		store = m.memory
+	}
+	m.cfg, m.store = cfg, store
+	return nil
+}
+
+// Enabled reports whether the Operations service should be registered.
+func (m *Manager) Enabled() bool {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.cfg.Enabled
+}
+
+func (m *Manager) settings() (Config, Store) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.cfg, m.store
+}
+
+// Create stores a new pending operation carrying metadata, which may be nil,
+// and returns the handle updating it. The caller completes it with
+// Handle.Complete or Handle.Fail.
+func (m *Manager) Create(ctx context.Context, metadata proto.Message) (*Handle, error) {
+	cfg, store := m.settings()
+	op := &longrunningpb.Operation{Name: cfg.Prefix + "/" + newOperationID()}
+	if metadata != nil {
+		value, err := anypb.New(metadata)
+		if err != nil {
+			return nil, err
+		}
+		op.Metadata = value
+	}
+	if err := store.Put(ctx, op, cfg.TTL); err != nil {
+		return nil, err
+	}
+	return &Handle{m: m, name: op.GetName(), op: op}, nil
+}
+
+// Start creates an operation carrying metadata and runs it in the
+// background. The run context keeps the values of ctx but not its deadline,
+// and is cancelled by CancelOperation. Start returns the pending operation
+// for the handler to respond with.
+func (m *Manager) Start(
+	ctx context.Context,
+	metadata proto.Message,
+	run RunFunc,
+) (*longrunningpb.Operation, error) {
+	h, err := m.Create(ctx, metadata)
+	if err != nil {
+		return nil, err
+	}
+	runCtx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+	m.mu.Lock()
+	m.running[h.Name()] = cancel
+	m.mu.Unlock()
+	go m.run(runCtx, cancel, h, run)
+	return h.Operation(), nil
+}
+
+func (m *Manager) run(ctx context.Context, cancel context.CancelFunc, h *Handle, run RunFunc) {
+	defer func() {
+		m.mu.Lock()
+		delete(m.running, h.Name())
+		m.mu.Unlock()
+		cancel()
+	}()
+	resp, err := runRecovered(ctx, h, run)
+	if err != nil {
+		err = h.Fail(ctx, err)
+	} else {
+		err = h.Complete(ctx, resp)
+	}
+	if err != nil && !errors.Is(err, ErrDone) {
+		slog.Error("failed to complete operation",
+			slog.String("operation", h.Name()), slog.Any("error", err))
+	}
+}
+
+func runRecovered(ctx context.Context, h *Handle, run RunFunc) (resp proto.Message, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			slog.Error("operation panicked",
+				slog.String("operation", h.Name()), slog.Any("panic", r))
+			err = status.New(code.Code_INTERNAL, "operation panicked").Err()
+		}
+	}()
+	return run(ctx, h)
+}
+
+// Get returns the operation called name.
+func (m *Manager) Get(ctx context.Context, name string) (*longrunningpb.Operation, error) {
+	_, store := m.settings()
+	return store.Get(ctx, name)
+}
+
+// List returns a page of the operations under the collection name, "" or
+// the configured prefix listing them all. The filter "done=true" or
+// "done=false" selects by completion; a filtered page may come back short.
+func (m *Manager) List(
+	ctx context.Context,
+	req *longrunningpb.ListOperationsRequest,
+) (*longrunningpb.ListOperationsResponse, error) {
+	keep, err := parseFilter(req.GetFilter())
+	if err != nil {
+		return nil, err
+	}
+	_, store := m.settings()
+	prefix := ""
+	if req.GetName() != "" {
+		prefix = strings.TrimSuffix(req.GetName(), "/") + "/"
+	}
+	pageSize := int(req.GetPageSize())
+	if pageSize <= 0 || pageSize > maxPageSize {
+		pageSize = maxPageSize
+	}
+	ops, next, err := store.List(ctx, prefix, pageSize, req.GetPageToken())
+	if err != nil {
+		return nil, err
+	}
+	resp := &longrunningpb.ListOperationsResponse{NextPageToken: next}
+	for _, op := range ops {
+		if keep(op) {
+			resp.Operations = append(resp.Operations, op)
+		}
+	}
+	return resp, nil
+}
+
+const maxPageSize = 100
+
+func parseFilter(filter string) (func(*longrunningpb.Operation) bool, error) {
+	switch strings.ReplaceAll(filter, " ", "") {
+	case "":
+		return func(*longrunningpb.Operation) bool { return true }, nil
+	case "done=true":
+		return (*longrunningpb.Operation).GetDone, nil
+	case "done=false":
+		return func(op *longrunningpb.Operation) bool { return !op.GetDone() }, nil
+	default:
+		return nil, status.New(
+			code.Code_INVALID_ARGUMENT,
+			fmt.Sprintf("unsupported filter %q", filter),
+		).Err()
+	}
+}
+
+// Delete removes the operation called name without cancelling it.
+func (m *Manager) Delete(ctx context.Context, name string) error {
+	_, store := m.settings()
+	return store.Delete(ctx, name)
+}
+
+// Cancel completes the operation called name with CANCELLED and cancels its
+// run context when it runs in this process. Runs elsewhere notice it when
+// their next update fails with ErrDone. Cancelling a completed operation is
+// a no-op.
+func (m *Manager) Cancel(ctx context.Context, name string) error {
+	h, err := m.handle(ctx, name)
+	if err != nil {
+		return err
+	}
+	err = h.Fail(ctx, status.New(code.Code_CANCELLED, "operation cancelled").Err())
+	if err != nil && !errors.Is(err, ErrDone) {
+		return err
+	}
+	m.mu.RLock()
+	cancel := m.running[name]
+	m.mu.RUnlock()
+	if cancel != nil {
+		cancel()
+	}
+	return nil
+}
+
+// Wait returns the operation called name once it is done, or its latest
+// state once timeout elapses or ctx is done. A zero timeout waits for ctx
+// alone.
+func (m *Manager) Wait(
+	ctx context.Context,
+	name string,
+	timeout time.Duration,
+) (*longrunningpb.Operation, error) {
+	cfg, _ := m.settings()
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	for {
+		op, err := m.Get(ctx, name)
+		if err != nil || op.GetDone() {
+			return op, err
+		}
+		timer := time.NewTimer(cfg.PollInterval)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			// The caller may have given up already; the latest state is
+			// still the best answer.
+			return m.Get(context.WithoutCancel(ctx), name)
+		}
+	}
+}
+
+func (m *Manager) handle(ctx context.Context, name string) (*Handle, error) {
+	op, err := m.Get(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	return &Handle{m: m, name: name, op: op}, nil
+}
+
+// Handle updates one operation.
+type Handle struct {
+	m    *Manager
+	name string
+
+	mu sync.Mutex
+	op *longrunningpb.Operation
+}
+
+// Name returns the operation name.
+func (h *Handle) Name() string {
+	return h.name
+}
+
+// Operation returns a copy of the operation as last written by h.
+func (h *Handle) Operation() *longrunningpb.Operation {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return cloneOperation(h.op)
+}
+
+// Update replaces the metadata of the operation, e.g. to report progress. It
+// returns ErrDone once the operation completed, which a run treats as the
+// signal to stop.
+func (h *Handle) Update(ctx context.Context, metadata proto.Message) error {
+	value, err := anypb.New(metadata)
+	if err != nil {
+		return err
+	}
+	return h.write(ctx, func(op *longrunningpb.Operation) {
+		op.Metadata = value
+	})
+}
+
+// Complete marks the operation done with response, which may be nil.
+func (h *Handle) Complete(ctx context.Context, response proto.Message) error {
+	var value *anypb.Any
+	if response != nil {
+		var err error
+		if value, err = anypb.New(response); err != nil {
+			return err
+		}
+	}
+	return h.write(ctx, func(op *longrunningpb.Operation) {
+		op.Done = true
+		op.Result = &longrunningpb.Operation_Response{Response: value}
+	})
+}
+
+// Fail marks the operation done with the status of err.
+func (h *Handle) Fail(ctx context.Context, err error) error {
+	stu := status.FromError(err).Status()
+	return h.write(ctx, func(op *longrunningpb.Operation) {
+		op.Done = true
+		op.Result = &longrunningpb.Operation_Error{Error: stu}
+	})
+}
+
+// write applies fn to the stored operation unless it is done. The store
+// updates it atomically, so a cancellation made through another handle or
+// instance is never overwritten.
+func (h *Handle) write(ctx context.Context, fn func(*longrunningpb.Operation)) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	cfg, store := h.m.settings()
+	op, err := store.Update(ctx, h.name, cfg.TTL, func(op *longrunningpb.Operation) error {
+		if op.GetDone() {
+			return ErrDone
+		}
+		fn(op)
+		return nil
+	})
+	if op != nil {
+		h.op = op
+	}
+	return err
+}
+
+func newOperationID() string {
+	var b [16]byte
+	_, _ = rand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}
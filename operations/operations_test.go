@@ -0,0 +1,491 @@
+// Copyright 2022 The codesjoy Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package operations
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/longrunning/autogen/longrunningpb"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/genproto/googleapis/rpc/code"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/durationpb"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+
+	"github.com/codesjoy/yggdrasil/v3/config"
+	"github.com/codesjoy/yggdrasil/v3/rpc/status"
+	"github.com/codesjoy/yggdrasil/v3/transport/runtime/client"
+)
+
+func newTestManager(t *testing.T) *Manager {
+	t.Helper()
+	m := NewManager(nil)
+	cfg := defaultConfig()
+	cfg.PollInterval = time.Millisecond
+	require.NoError(t, m.Configure(cfg))
+	return m
+}
+
+func waitDone(t *testing.T, m *Manager, name string) *longrunningpb.Operation {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	op, err := m.Wait(ctx, name, 0)
+	require.NoError(t, err)
+	require.True(t, op.GetDone())
+	return op
+}
+
+func TestStartCompletesWithResponse(t *testing.T) {
+	m := newTestManager(t)
+	release := make(chan struct{})
+	op, err := m.Start(context.Background(), wrapperspb.String("queued"),
+		func(ctx context.Context, h *Handle) (proto.Message, error) {
+			<-release
+			require.NoError(t, h.Update(ctx, wrapperspb.String("half way")))
+			return wrapperspb.Int64(42), nil
+		})
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(op.GetName(), "operations/"))
+	assert.False(t, op.GetDone())
+
+	meta := &wrapperspb.StringValue{}
+	require.NoError(t, op.GetMetadata().UnmarshalTo(meta))
+	assert.Equal(t, "queued", meta.GetValue())
+
+	close(release)
+	op = waitDone(t, m, op.GetName())
+	require.NoError(t, op.GetMetadata().UnmarshalTo(meta))
+	assert.Equal(t, "half way", meta.GetValue())
+	out := &wrapperspb.Int64Value{}
+	require.NoError(t, Result(op, out))
+	assert.Equal(t, int64(42), out.GetValue())
+}
+
+func TestStartFailsWithError(t *testing.T) {
+	m := newTestManager(t)
+	op, err := m.Start(context.Background(), nil,
+		func(context.Context, *Handle) (proto.Message, error) {
+			return nil, status.New(code.Code_FAILED_PRECONDITION, "no quota").Err()
+		})
+	require.NoError(t, err)
+	op = waitDone(t, m, op.GetName())
+	err = Result(op, nil)
+	assert.Equal(t, code.Code_FAILED_PRECONDITION, status.FromError(err).Code())
+	assert.Equal(t, "no quota", status.FromError(err).Message())
+}
+
+func TestStartRecoversPanic(t *testing.T) {
+	m := newTestManager(t)
+	op, err := m.Start(context.Background(), nil,
+		func(context.Context, *Handle) (proto.Message, error) {
+			panic("boom")
+		})
+	require.NoError(t, err)
+	op = waitDone(t, m, op.GetName())
+	assert.Equal(t, code.Code_INTERNAL, status.FromError(Result(op, nil)).Code())
+}
+
+func TestCancelStopsRun(t *testing.T) {
+	m := newTestManager(t)
+	stopped := make(chan error, 1)
+	op, err := m.Start(context.Background(), nil,
+		func(ctx context.Context, h *Handle) (proto.Message, error) {
+			<-ctx.Done()
+			stopped <- h.Update(context.Background(), wrapperspb.String("late"))
+			return nil, ctx.Err()
+		})
+	require.NoError(t, err)
+
+	require.NoError(t, m.Cancel(context.Background(), op.GetName()))
+	assert.ErrorIs(t, <-stopped, ErrDone)
+	op = waitDone(t, m, op.GetName())
+	assert.Equal(t, code.Code_CANCELLED, status.FromError(Result(op, nil)).Code())
+	assert.Nil(t, op.GetMetadata())
+
+	// Cancelling again is a no-op.
+	require.NoError(t, m.Cancel(context.Background(), op.GetName()))
+}
+
+func TestCompleteAndCancelRaceKeepsOneResult(t *testing.T) {
+	m := newTestManager(t)
+	for i := 0; i < 50; i++ {
+		h, err := m.Create(context.Background(), nil)
+		require.NoError(t, err)
+		var (
+			wg                     sync.WaitGroup
+			completeErr, cancelErr error
+		)
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			completeErr = h.Complete(context.Background(), wrapperspb.String("done"))
+		}()
+		go func() {
+			defer wg.Done()
+			cancelErr = m.Cancel(context.Background(), h.Name())
+		}()
+		wg.Wait()
+		require.NoError(t, cancelErr)
+
+		op, err := m.Get(context.Background(), h.Name())
+		require.NoError(t, err)
+		if completeErr == nil {
+			assert.NotNil(t, op.GetResponse(), "a completed run must not be overwritten")
+		} else {
+			require.ErrorIs(t, completeErr, ErrDone)
+			assert.Equal(t, code.Code_CANCELLED, status.FromError(Result(op, nil)).Code())
+		}
+	}
+}
+
+func TestWaitReturnsLatestStateOnTimeout(t *testing.T) {
+	m := newTestManager(t)
+	h, err := m.Create(context.Background(), nil)
+	require.NoError(t, err)
+	op, err := m.Wait(context.Background(), h.Name(), 5*time.Millisecond)
+	require.NoError(t, err)
+	assert.False(t, op.GetDone())
+
+	_, err = m.Wait(context.Background(), "operations/missing", time.Millisecond)
+	assert.ErrorIs(t, err, ErrNotFound)
+}
+
+func TestListFiltersAndPages(t *testing.T) {
+	m := newTestManager(t)
+	ctx := context.Background()
+	var names []string
+	for i := 0; i < 5; i++ {
+		h, err := m.Create(ctx, nil)
+		require.NoError(t, err)
+		if i%2 == 0 {
+			require.NoError(t, h.Complete(ctx, nil))
+		}
+		names = append(names, h.Name())
+	}
+
+	var listed []string
+	req := &longrunningpb.ListOperationsRequest{Name: "operations", PageSize: 2}
+	for {
+		resp, err := m.List(ctx, req)
+		require.NoError(t, err)
+		for _, op := range resp.GetOperations() {
+			listed = append(listed, op.GetName())
+		}
+		if resp.GetNextPageToken() == "" {
+			break
+		}
+		req.PageToken = resp.GetNextPageToken()
+	}
+	assert.Equal(t, names, listed)
+
+	resp, err := m.List(ctx, &longrunningpb.ListOperationsRequest{Filter: "done = true"})
+	require.NoError(t, err)
+	assert.Len(t, resp.GetOperations(), 3)
+
+	_, err = m.List(ctx, &longrunningpb.ListOperationsRequest{Filter: "name=x"})
+	assert.Equal(t, code.Code_INVALID_ARGUMENT, status.FromError(err).Code())
+	_, err = m.List(ctx, &longrunningpb.ListOperationsRequest{PageToken: "x"})
+	assert.Equal(t, code.Code_INVALID_ARGUMENT, status.FromError(err).Code())
+}
+
+func TestMemoryStoreExpiresAndEvicts(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStore(2).(*memoryStore)
+	now := time.Unix(0, 0)
+	store.now = func() time.Time { return now }
+
+	for _, name := range []string{"operations/a", "operations/b", "operations/c"} {
+		require.NoError(t, store.Put(ctx, &longrunningpb.Operation{Name: name}, time.Minute))
+	}
+	_, err := store.Get(ctx, "operations/a")
+	assert.ErrorIs(t, err, ErrNotFound)
+	_, err = store.Get(ctx, "operations/c")
+	require.NoError(t, err)
+
+	now = now.Add(time.Minute)
+	_, err = store.Get(ctx, "operations/c")
+	assert.ErrorIs(t, err, ErrNotFound)
+	ops, _, err := store.List(ctx, "", 10, "")
+	require.NoError(t, err)
+	assert.Empty(t, ops)
+}
+
+// fakeRedis keeps values and one sorted set in maps, ignoring TTLs.
+type fakeRedis struct {
+	values map[string]string
+	ttls   map[string]time.Duration
+	scores map[string]float64
+	// beforeSwap runs at the start of CompareAndSet, to interleave writers.
+	beforeSwap func()
+}
+
+func newFakeRedis() *fakeRedis {
+	return &fakeRedis{
+		values: map[string]string{},
+		ttls:   map[string]time.Duration{},
+		scores: map[string]float64{},
+	}
+}
+
+func (f *fakeRedis) Get(_ context.Context, key string) (string, bool, error) {
+	v, ok := f.values[key]
+	return v, ok, nil
+}
+
+func (f *fakeRedis) Set(_ context.Context, key, value string, ttl time.Duration) error {
+	f.values[key], f.ttls[key] = value, ttl
+	return nil
+}
+
+func (f *fakeRedis) CompareAndSet(
+	_ context.Context,
+	key, old, value string,
+	ttl time.Duration,
+) (bool, error) {
+	if f.beforeSwap != nil {
+		f.beforeSwap()
+	}
+	if f.values[key] != old {
+		return false, nil
+	}
+	f.values[key], f.ttls[key] = value, ttl
+	return true, nil
+}
+
+func (f *fakeRedis) Del(_ context.Context, key string) error {
+	delete(f.values, key)
+	return nil
+}
+
+func (f *fakeRedis) ZAdd(_ context.Context, _ string, score float64, member string) error {
+	if _, ok := f.scores[member]; !ok {
+		f.scores[member] = score
+	}
+	return nil
+}
+
+func (f *fakeRedis) ZRem(_ context.Context, _, member string) error {
+	delete(f.scores, member)
+	return nil
+}
+
+func (f *fakeRedis) ZRange(_ context.Context, _ string, start, stop int64) ([]string, error) {
+	members := make([]string, 0, len(f.scores))
+	for member := range f.scores {
+		members = append(members, member)
+	}
+	sort.Slice(members, func(i, j int) bool { return f.scores[members[i]] < f.scores[members[j]] })
+	if start >= int64(len(members)) {
+		return nil, nil
+	}
+	return members[start:min(stop+1, int64(len(members)))], nil
+}
+
+func TestRedisStore(t *testing.T) {
+	ctx := context.Background()
+	redis := newFakeRedis()
+	store := NewRedisStore(redis, "lro:").(*redisStore)
+	seq := int64(0)
+	store.now = func() time.Time { seq++; return time.Unix(0, seq) }
+
+	for _, name := range []string{"operations/a", "operations/b", "other/c", "operations/d"} {
+		require.NoError(t, store.Put(ctx, &longrunningpb.Operation{Name: name}, time.Hour))
+	}
+	assert.Equal(t, time.Hour, redis.ttls["lro:operations/a"])
+	done := &longrunningpb.Operation{Name: "operations/a", Done: true}
+	require.NoError(t, store.Put(ctx, done, time.Hour))
+	op, err := store.Get(ctx, "operations/a")
+	require.NoError(t, err)
+	assert.True(t, op.GetDone())
+
+	// b expired: listing drops it from the index.
+	delete(redis.values, "lro:operations/b")
+	ops, next, err := store.List(ctx, "operations/", 1, "")
+	require.NoError(t, err)
+	require.Len(t, ops, 1)
+	assert.Equal(t, "operations/a", ops[0].GetName())
+	ops, next, err = store.List(ctx, "operations/", 1, next)
+	require.NoError(t, err)
+	require.Len(t, ops, 1)
+	assert.Equal(t, "operations/d", ops[0].GetName())
+	ops, next, err = store.List(ctx, "operations/", 1, next)
+	require.NoError(t, err)
+	assert.Empty(t, ops)
+	assert.Empty(t, next)
+	assert.NotContains(t, redis.scores, "operations/b")
+
+	require.NoError(t, store.Delete(ctx, "operations/a"))
+	_, err = store.Get(ctx, "operations/a")
+	assert.ErrorIs(t, err, ErrNotFound)
+	assert.NotContains(t, redis.scores, "operations/a")
+	_, err = store.Update(ctx, "operations/a", time.Hour, func(*longrunningpb.Operation) error {
+		return nil
+	})
+	assert.ErrorIs(t, err, ErrNotFound)
+}
+
+func TestRedisStoreUpdateRetriesOnConcurrentWrite(t *testing.T) {
+	ctx := context.Background()
+	redis := newFakeRedis()
+	store := NewRedisStore(redis, "lro:")
+	m := NewManager(store)
+	h, err := m.Create(ctx, nil)
+	require.NoError(t, err)
+
+	// Another instance cancels the operation between the read and the
+	// write of Complete.
+	redis.beforeSwap = func() {
+		redis.beforeSwap = nil
+		require.NoError(t, m.Cancel(ctx, h.Name()))
+	}
+	require.ErrorIs(t, h.Complete(ctx, wrapperspb.String("done")), ErrDone)
+	op, err := store.Get(ctx, h.Name())
+	require.NoError(t, err)
+	assert.Equal(t, code.Code_CANCELLED, status.FromError(Result(op, nil)).Code())
+	assert.True(t, h.Operation().GetDone())
+}
+
+func TestConfigureSelectsStore(t *testing.T) {
+	m := newTestManager(t)
+	cfg := defaultConfig()
+	cfg.Store = "operations-test-missing"
+	assert.Error(t, m.Configure(cfg))
+
+	store := NewMemoryStore(1)
+	RegisterStore("operations-test", store)
+	cfg.Store = "operations-test"
+	require.NoError(t, m.Configure(cfg))
+	h, err := m.Create(context.Background(), nil)
+	require.NoError(t, err)
+	_, err = store.Get(context.Background(), h.Name())
+	require.NoError(t, err)
+
+	cfg.Store = MemoryStoreName
+	require.NoError(t, m.Configure(cfg))
+	_, err = m.Get(context.Background(), h.Name())
+	assert.ErrorIs(t, err, ErrNotFound)
+}
+
+func TestModuleConfiguresDefault(t *testing.T) {
+	prev, _ := Default().settings()
+	t.Cleanup(func() { _ = Default().Configure(prev) })
+
+	mod := Module().(operationsModule)
+	view := func(value map[string]any) config.View {
+		return config.NewView(ConfigPath, config.NewSnapshot(value))
+	}
+	require.NoError(t, mod.Init(context.Background(), view(map[string]any{
+		"enabled": true,
+		"prefix":  "jobs",
+	})))
+	assert.True(t, Default().Enabled())
+	h, err := Default().Create(context.Background(), nil)
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(h.Name(), "jobs/"))
+
+	_, err = mod.PrepareReload(context.Background(),
+		view(map[string]any{"store": "operations-test-missing"}))
+	assert.Error(t, err)
+	committer, err := mod.PrepareReload(context.Background(), view(nil))
+	require.NoError(t, err)
+	require.NoError(t, committer.Commit(context.Background()))
+	assert.False(t, Default().Enabled())
+	require.NoError(t, committer.Rollback(context.Background()))
+	assert.True(t, Default().Enabled())
+}
+
+// loopbackClient serves Invoke with ServiceDesc in process.
+type loopbackClient struct {
+	client.Client
+	srv longrunningpb.OperationsServer
+}
+
+func (c loopbackClient) Invoke(
+	ctx context.Context,
+	method string,
+	args, reply any,
+	_ ...client.CallOption,
+) error {
+	for _, desc := range ServiceDesc.Methods {
+		if method != "/"+ServiceName+"/"+desc.MethodName {
+			continue
+		}
+		dec := func(in any) error {
+			proto.Merge(in.(proto.Message), args.(proto.Message))
+			return nil
+		}
+		out, err := desc.Handler(c.srv, ctx, dec, nil)
+		if err != nil {
+			return err
+		}
+		proto.Merge(reply.(proto.Message), out.(proto.Message))
+		return nil
+	}
+	return errors.New("unknown method " + method)
+}
+
+func TestClientWait(t *testing.T) {
+	m := newTestManager(t)
+	c := NewClient(loopbackClient{srv: NewService(m)},
+		WithPollInterval(time.Millisecond, 2*time.Millisecond))
+	ctx := context.Background()
+
+	release := make(chan struct{})
+	op, err := m.Start(ctx, nil, func(context.Context, *Handle) (proto.Message, error) {
+		<-release
+		return wrapperspb.String("done"), nil
+	})
+	require.NoError(t, err)
+
+	short, cancel := context.WithTimeout(ctx, 5*time.Millisecond)
+	defer cancel()
+	err = c.Wait(short, op, nil)
+	assert.Equal(t, code.Code_DEADLINE_EXCEEDED, status.FromError(err).Code())
+
+	close(release)
+	out := &wrapperspb.StringValue{}
+	require.NoError(t, c.Wait(ctx, op, out))
+	assert.Equal(t, "done", out.GetValue())
+
+	resp, err := c.ListOperations(ctx, &longrunningpb.ListOperationsRequest{})
+	require.NoError(t, err)
+	assert.Len(t, resp.GetOperations(), 1)
+	require.NoError(t, c.CancelOperation(ctx, op.GetName()))
+	require.NoError(t, c.DeleteOperation(ctx, op.GetName()))
+	_, err = c.GetOperation(ctx, op.GetName())
+	assert.Equal(t, code.Code_NOT_FOUND, status.FromError(err).Code())
+}
+
+func TestServiceWaitOperation(t *testing.T) {
+	m := newTestManager(t)
+	h, err := m.Create(context.Background(), nil)
+	require.NoError(t, err)
+	go func() {
+		time.Sleep(5 * time.Millisecond)
+		_ = h.Complete(context.Background(), nil)
+	}()
+	req := &longrunningpb.WaitOperationRequest{Name: h.Name(), Timeout: durationpb.New(time.Second)}
+	op, err := NewService(m).WaitOperation(context.Background(), req)
+	require.NoError(t, err)
+	assert.True(t, op.GetDone())
+}
@@ -0,0 +1,198 @@
+// Copyright 2022 The codesjoy Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package operations
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/longrunning/autogen/longrunningpb"
+	"google.golang.org/protobuf/proto"
+)
+
+// RedisClient is the subset of Redis commands used by the Redis store.
+// OperationsClient in contrib/redis implements it over a go-redis client.
+type RedisClient interface {
+	// Get returns the value of key and whether it exists.
+	Get(ctx context.Context, key string) (string, bool, error)
+	// Set sets key to value with ttl.
+	Set(ctx context.Context, key, value string, ttl time.Duration) error
+	// CompareAndSet sets key to value with ttl if its value is still old,
+	// atomically, and reports whether it did.
+	CompareAndSet(ctx context.Context, key, old, value string, ttl time.Duration) (bool, error)
+	// Del deletes key.
+	Del(ctx context.Context, key string) error
+	// ZAdd adds member to the sorted set key with score unless it is
+	// already a member.
+	ZAdd(ctx context.Context, key string, score float64, member string) error
+	// ZRem removes member from the sorted set key.
+	ZRem(ctx context.Context, key, member string) error
+	// ZRange returns the members of the sorted set key ranked start to
+	// stop inclusive, lowest score first.
+	ZRange(ctx context.Context, key string, start, stop int64) ([]string, error)
+}
+
+type redisStore struct {
+	client RedisClient
+	prefix string
+	now    func() time.Time
+}
+
+// NewRedisStore returns a store that keeps operations in Redis under prefix,
+// so any instance can serve them. Operation names are indexed in a sorted
+// set by creation time for listing; names of expired operations are dropped
+// from it as listing finds them.
+func NewRedisStore(client RedisClient, prefix string) Store {
+	return &redisStore{client: client, prefix: prefix, now: time.Now}
+}
+
+func (s *redisStore) indexKey() string {
+	return s.prefix + "index"
+}
+
+func (s *redisStore) Put(
+	ctx context.Context,
+	op *longrunningpb.Operation,
+	ttl time.Duration,
+) error {
+	data, err := proto.Marshal(op)
+	if err != nil {
+		return err
+	}
+	if err := s.client.Set(ctx, s.prefix+op.GetName(), string(data), ttl); err != nil {
+		return err
+	}
+	return s.client.ZAdd(ctx, s.indexKey(), float64(s.now().UnixNano()), op.GetName())
+}
+
+func (s *redisStore) Get(ctx context.Context, name string) (*longrunningpb.Operation, error) {
+	value, found, err := s.client.Get(ctx, s.prefix+name)
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		return nil, ErrNotFound
+	}
+	op := &longrunningpb.Operation{}
+	if err := proto.Unmarshal([]byte(value), op); err != nil {
+		return nil, err
+	}
+	return op, nil
+}
+
+// Update retries on the latest value whenever another writer changed the
+// operation since it was read.
+func (s *redisStore) Update(
+	ctx context.Context,
+	name string,
+	ttl time.Duration,
+	fn func(*longrunningpb.Operation) error,
+) (*longrunningpb.Operation, error) {
+	key := s.prefix + name
+	for {
+		value, found, err := s.client.Get(ctx, key)
+		if err != nil {
+			return nil, err
+		}
+		if !found {
+			return nil, ErrNotFound
+		}
+		current := &longrunningpb.Operation{}
+		if err := proto.Unmarshal([]byte(value), current); err != nil {
+			return nil, err
+		}
+		op := cloneOperation(current)
+		if err := fn(op); err != nil {
+			return current, err
+		}
+		data, err := proto.Marshal(op)
+		if err != nil {
+			return nil, err
+		}
+		swapped, err := s.client.CompareAndSet(ctx, key, value, string(data), ttl)
+		if err != nil {
+			return nil, err
+		}
+		if swapped {
+			return op, nil
+		}
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+	}
+}
+
+func (s *redisStore) Delete(ctx context.Context, name string) error {
+	if err := s.client.Del(ctx, s.prefix+name); err != nil {
+		return err
+	}
+	return s.client.ZRem(ctx, s.indexKey(), name)
+}
+
+// List pages by rank in the index. Names dropped by another lister shift
+// the ranks, so a page may skip an operation; listing is best effort.
+func (s *redisStore) List(
+	ctx context.Context,
+	prefix string,
+	pageSize int,
+	pageToken string,
+) ([]*longrunningpb.Operation, string, error) {
+	var start int64
+	if pageToken != "" {
+		var err error
+		if start, err = strconv.ParseInt(pageToken, 10, 64); err != nil || start < 0 {
+			return nil, "", invalidPageToken(pageToken)
+		}
+	}
+	var out []*longrunningpb.Operation
+	for len(out) < pageSize {
+		names, err := s.client.ZRange(ctx, s.indexKey(), start, start+int64(pageSize)-1)
+		if err != nil {
+			return nil, "", err
+		}
+		if len(names) == 0 {
+			return out, "", nil
+		}
+		// next is the rank of the following name once the dropped ones
+		// are gone.
+		next := start
+		for _, name := range names {
+			if len(out) == pageSize {
+				return out, strconv.FormatInt(next, 10), nil
+			}
+			if !strings.HasPrefix(name, prefix) {
+				next++
+				continue
+			}
+			op, err := s.Get(ctx, name)
+			if errors.Is(err, ErrNotFound) {
+				if err := s.client.ZRem(ctx, s.indexKey(), name); err != nil {
+					return nil, "", err
+				}
+				continue
+			}
+			if err != nil {
+				return nil, "", err
+			}
+			out = append(out, op)
+			next++
+		}
+		start = next
+	}
+	return out, strconv.FormatInt(start, 10), nil
+}
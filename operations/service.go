@@ -0,0 +1,181 @@
+// Copyright 2022 The codesjoy Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package operations
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"cloud.google.com/go/longrunning/autogen/longrunningpb"
+	"google.golang.org/genproto/googleapis/rpc/code"
+	"google.golang.org/protobuf/types/known/emptypb"
+
+	"github.com/codesjoy/yggdrasil/v3/rpc/interceptor"
+	"github.com/codesjoy/yggdrasil/v3/rpc/status"
+	"github.com/codesjoy/yggdrasil/v3/transport/runtime/server"
+)
+
+// ServiceName is the name of the long-running operations service.
+const ServiceName = "google.longrunning.Operations"
+
+// NewService returns the google.longrunning.Operations implementation
+// serving the operations of m. Install it with ServiceDesc.
+func NewService(m *Manager) longrunningpb.OperationsServer {
+	return &service{m: m}
+}
+
+type service struct {
+	m *Manager
+}
+
+func (s *service) ListOperations(
+	ctx context.Context,
+	req *longrunningpb.ListOperationsRequest,
+) (*longrunningpb.ListOperationsResponse, error) {
+	return s.m.List(ctx, req)
+}
+
+func (s *service) GetOperation(
+	ctx context.Context,
+	req *longrunningpb.GetOperationRequest,
+) (*longrunningpb.Operation, error) {
+	op, err := s.m.Get(ctx, req.GetName())
+	return op, mapError(req.GetName(), err)
+}
+
+func (s *service) DeleteOperation(
+	ctx context.Context,
+	req *longrunningpb.DeleteOperationRequest,
+) (*emptypb.Empty, error) {
+	if err := s.m.Delete(ctx, req.GetName()); err != nil {
+		return nil, mapError(req.GetName(), err)
+	}
+	return &emptypb.Empty{}, nil
+}
+
+func (s *service) CancelOperation(
+	ctx context.Context,
+	req *longrunningpb.CancelOperationRequest,
+) (*emptypb.Empty, error) {
+	if err := s.m.Cancel(ctx, req.GetName()); err != nil {
+		return nil, mapError(req.GetName(), err)
+	}
+	return &emptypb.Empty{}, nil
+}
+
+func (s *service) WaitOperation(
+	ctx context.Context,
+	req *longrunningpb.WaitOperationRequest,
+) (*longrunningpb.Operation, error) {
+	op, err := s.m.Wait(ctx, req.GetName(), req.GetTimeout().AsDuration())
+	return op, mapError(req.GetName(), err)
+}
+
+func mapError(name string, err error) error {
+	if errors.Is(err, ErrNotFound) {
+		return status.New(code.Code_NOT_FOUND, fmt.Sprintf("operation %q not found", name)).Err()
+	}
+	return err
+}
+
+// unaryHandler adapts one method of the service to the server runtime, as
+// the generated code of a service would.
+func unaryHandler[T any](
+	method string,
+	call func(longrunningpb.OperationsServer, context.Context, *T) (any, error),
+) func(any, context.Context, func(any) error, interceptor.UnaryServerInterceptor) (any, error) {
+	fullMethod := "/" + ServiceName + "/" + method
+	return func(
+		srv any,
+		ctx context.Context,
+		dec func(any) error,
+		unaryInt interceptor.UnaryServerInterceptor,
+	) (any, error) {
+		in := new(T)
+		if err := dec(in); err != nil {
+			return nil, err
+		}
+		if unaryInt == nil {
+			return call(srv.(longrunningpb.OperationsServer), ctx, in)
+		}
+		info := &interceptor.UnaryServerInfo{Server: srv, FullMethod: fullMethod}
+		handler := func(ctx context.Context, req any) (any, error) {
+			return call(srv.(longrunningpb.OperationsServer), ctx, req.(*T))
+		}
+		return unaryInt(ctx, in, info, handler)
+	}
+}
+
+// ServiceDesc describes the google.longrunning.Operations service for the
+// server runtime. Register it with an implementation returned by NewService;
+// the operations module does so for Default when enabled.
+var ServiceDesc = server.ServiceDesc{
+	ServiceName: ServiceName,
+	HandlerType: (*longrunningpb.OperationsServer)(nil),
+	Methods: []server.MethodDesc{
+		{
+			MethodName: "ListOperations",
+			Handler: unaryHandler("ListOperations", func(
+				srv longrunningpb.OperationsServer,
+				ctx context.Context,
+				in *longrunningpb.ListOperationsRequest,
+			) (any, error) {
+				return srv.ListOperations(ctx, in)
+			}),
+		},
+		{
+			MethodName: "GetOperation",
+			Handler: unaryHandler("GetOperation", func(
+				srv longrunningpb.OperationsServer,
+				ctx context.Context,
+				in *longrunningpb.GetOperationRequest,
+			) (any, error) {
+				return srv.GetOperation(ctx, in)
+			}),
+		},
+		{
+			MethodName: "DeleteOperation",
+			Handler: unaryHandler("DeleteOperation", func(
+				srv longrunningpb.OperationsServer,
+				ctx context.Context,
+				in *longrunningpb.DeleteOperationRequest,
+			) (any, error) {
+				return srv.DeleteOperation(ctx, in)
+			}),
+		},
+		{
+			MethodName: "CancelOperation",
+			Handler: unaryHandler("CancelOperation", func(
+				srv longrunningpb.OperationsServer,
+				ctx context.Context,
+				in *longrunningpb.CancelOperationRequest,
+			) (any, error) {
+				return srv.CancelOperation(ctx, in)
+			}),
+		},
+		{
+			MethodName: "WaitOperation",
+			Handler: unaryHandler("WaitOperation", func(
+				srv longrunningpb.OperationsServer,
+				ctx context.Context,
+				in *longrunningpb.WaitOperationRequest,
+			) (any, error) {
+				return srv.WaitOperation(ctx, in)
+			}),
+		},
+	},
+	Metadata: "google/longrunning/operations.proto",
+}
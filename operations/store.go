@@ -0,0 +1,218 @@
+// Copyright 2022 The codesjoy Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package operations
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"cloud.google.com/go/longrunning/autogen/longrunningpb"
+	"google.golang.org/genproto/googleapis/rpc/code"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/codesjoy/yggdrasil/v3/rpc/status"
+)
+
+// MemoryStoreName is the name of the builtin in-memory store.
+const MemoryStoreName = "memory"
+
+const defaultMaxEntries = 10000
+
+var (
+	mu     sync.RWMutex
+	stores = map[string]Store{}
+)
+
+// RegisterStore registers a named store, e.g. a Redis backed one built with
+// NewRedisStore. The name "memory" is reserved for the builtin store.
+func RegisterStore(name string, store Store) {
+	mu.Lock()
+	defer mu.Unlock()
+	stores[name] = store
+}
+
+// GetStore returns a registered store by name.
+func GetStore(name string) Store {
+	mu.RLock()
+	defer mu.RUnlock()
+	return stores[name]
+}
+
+// resolveStore returns the registered store cfg selects, or nil for the
+// builtin memory store.
+func resolveStore(cfg Config) (Store, error) {
+	if cfg.Store == "" || cfg.Store == MemoryStoreName {
+		return nil, nil
+	}
+	store := GetStore(cfg.Store)
+	if store == nil {
+		return nil, fmt.Errorf("operations store %q is not registered", cfg.Store)
+	}
+	return store, nil
+}
+
+type memoryEntry struct {
+	seq      uint64
+	op       *longrunningpb.Operation
+	expireAt time.Time
+}
+
+// memoryStore keeps operations in the process, evicting the oldest beyond
+// maxEntries.
+type memoryStore struct {
+	mu         sync.Mutex
+	maxEntries int
+	seq        uint64
+	entries    map[string]*memoryEntry
+	order      []string
+	now        func() time.Time
+}
+
+// NewMemoryStore returns a store local to the process holding at most
+// maxEntries operations. It is meant for tests and single-instance
+// deployments.
+func NewMemoryStore(maxEntries int) Store {
+	if maxEntries <= 0 {
+		maxEntries = defaultMaxEntries
+	}
+	return &memoryStore{
+		maxEntries: maxEntries,
+		entries:    map[string]*memoryEntry{},
+		now:        time.Now,
+	}
+}
+
+func (s *memoryStore) Put(_ context.Context, op *longrunningpb.Operation, ttl time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	expireAt := s.now().Add(ttl)
+	if e, ok := s.entries[op.GetName()]; ok {
+		e.op, e.expireAt = cloneOperation(op), expireAt
+		return nil
+	}
+	for len(s.order) >= s.maxEntries {
+		s.removeLocked(s.order[0])
+	}
+	s.seq++
+	s.entries[op.GetName()] = &memoryEntry{seq: s.seq, op: cloneOperation(op), expireAt: expireAt}
+	s.order = append(s.order, op.GetName())
+	return nil
+}
+
+func (s *memoryStore) Get(_ context.Context, name string) (*longrunningpb.Operation, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e, ok := s.entries[name]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	if !s.now().Before(e.expireAt) {
+		s.removeLocked(name)
+		return nil, ErrNotFound
+	}
+	return cloneOperation(e.op), nil
+}
+
+func (s *memoryStore) Update(
+	_ context.Context,
+	name string,
+	ttl time.Duration,
+	fn func(*longrunningpb.Operation) error,
+) (*longrunningpb.Operation, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e, ok := s.entries[name]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	if !s.now().Before(e.expireAt) {
+		s.removeLocked(name)
+		return nil, ErrNotFound
+	}
+	op := cloneOperation(e.op)
+	if err := fn(op); err != nil {
+		return cloneOperation(e.op), err
+	}
+	e.op, e.expireAt = cloneOperation(op), s.now().Add(ttl)
+	return op, nil
+}
+
+func (s *memoryStore) Delete(_ context.Context, name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.removeLocked(name)
+	return nil
+}
+
+// List pages by insertion sequence, so the token stays valid when earlier
+// operations are removed.
+func (s *memoryStore) List(
+	_ context.Context,
+	prefix string,
+	pageSize int,
+	pageToken string,
+) ([]*longrunningpb.Operation, string, error) {
+	var after uint64
+	if pageToken != "" {
+		var err error
+		if after, err = strconv.ParseUint(pageToken, 10, 64); err != nil {
+			return nil, "", invalidPageToken(pageToken)
+		}
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := s.now()
+	var (
+		out  []*longrunningpb.Operation
+		last uint64
+	)
+	for _, name := range s.order {
+		e := s.entries[name]
+		if e.seq <= after || !strings.HasPrefix(name, prefix) || !now.Before(e.expireAt) {
+			continue
+		}
+		if len(out) == pageSize {
+			return out, strconv.FormatUint(last, 10), nil
+		}
+		out = append(out, cloneOperation(e.op))
+		last = e.seq
+	}
+	return out, "", nil
+}
+
+func (s *memoryStore) removeLocked(name string) {
+	if _, ok := s.entries[name]; !ok {
+		return
+	}
+	delete(s.entries, name)
+	for i, n := range s.order {
+		if n == name {
+			s.order = append(s.order[:i], s.order[i+1:]...)
+			break
+		}
+	}
+}
+
+func invalidPageToken(token string) error {
+	return status.New(code.Code_INVALID_ARGUMENT, fmt.Sprintf("invalid page token %q", token)).Err()
+}
+
+func cloneOperation(op *longrunningpb.Operation) *longrunningpb.Operation {
+	return proto.Clone(op).(*longrunningpb.Operation)
+}
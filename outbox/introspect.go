@@ -0,0 +1,90 @@
+// Copyright 2022 The codesjoy Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package outbox
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// RelayStatus is the governor view of one running relay.
+type RelayStatus struct {
+	Name       string    `json:"name"`
+	Pending    int64     `json:"pending"`
+	Published  uint64    `json:"published"`
+	Failed     uint64    `json:"failed"`
+	Dead       uint64    `json:"dead"`
+	LastPollAt time.Time `json:"last_poll_at,omitzero"`
+	LastError  string    `json:"last_error,omitempty"`
+}
+
+var liveRelays = struct {
+	sync.Mutex
+	relays map[*Relay]struct{}
+}{relays: map[*Relay]struct{}{}}
+
+func trackRelay(r *Relay) {
+	liveRelays.Lock()
+	defer liveRelays.Unlock()
+	liveRelays.relays[r] = struct{}{}
+}
+
+func untrackRelay(r *Relay) {
+	liveRelays.Lock()
+	defer liveRelays.Unlock()
+	delete(liveRelays.relays, r)
+}
+
+// Relays returns the status of every running relay, ordered by name. Pending
+// counts are queried from the stores within ctx and reported as -1 when the
+// query fails.
+func Relays(ctx context.Context) []RelayStatus {
+	liveRelays.Lock()
+	relays := make([]*Relay, 0, len(liveRelays.relays))
+	for r := range liveRelays.relays {
+		relays = append(relays, r)
+	}
+	liveRelays.Unlock()
+
+	out := make([]RelayStatus, 0, len(relays))
+	for _, r := range relays {
+		out = append(out, r.status(ctx))
+	}
+	slices.SortStableFunc(out, func(a, b RelayStatus) int {
+		return strings.Compare(a.Name, b.Name)
+	})
+	return out
+}
+
+func (r *Relay) status(ctx context.Context) RelayStatus {
+	pending, err := r.store.Pending(ctx)
+	if err != nil {
+		pending = -1
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return RelayStatus{
+		Name:       r.cfg.Name,
+		Pending:    pending,
+		Published:  r.published.Load(),
+		Failed:     r.failed.Load(),
+		Dead:       r.dead.Load(),
+		LastPollAt: r.lastPollAt,
+		LastError:  r.lastError,
+	}
+}
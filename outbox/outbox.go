@@ -0,0 +1,78 @@
+// Copyright 2022 The codesjoy Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package outbox implements the transactional outbox pattern: events are
+// written to a table in the same database transaction as the business change
+// and a relay publishes them afterwards.
+//
+// Delivery is at least once. A message may be published again when the relay
+// stops between publishing and recording it, so consumers should deduplicate
+// by Message.ID.
+package outbox
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"time"
+)
+
+// Message is one event stored in the outbox.
+type Message struct {
+	// ID identifies the message; one is generated when empty.
+	ID      string
+	Topic   string
+	Key     string
+	Payload []byte
+	Headers map[string]string
+	// CreatedAt is set by the store when the message is enqueued.
+	CreatedAt time.Time
+	// Attempts counts the failed publish attempts so far.
+	Attempts int
+}
+
+// Publisher delivers outbox messages to the message broker.
+type Publisher interface {
+	Publish(ctx context.Context, msg Message) error
+}
+
+// PublisherFunc adapts a function to Publisher.
+type PublisherFunc func(ctx context.Context, msg Message) error
+
+// Publish calls f.
+func (f PublisherFunc) Publish(ctx context.Context, msg Message) error {
+	return f(ctx, msg)
+}
+
+// Store persists outbox messages for the relay.
+type Store interface {
+	// Fetch claims up to limit pending messages that are due. A claimed
+	// message is not returned again until lease elapses.
+	Fetch(ctx context.Context, limit int, lease time.Duration) ([]Message, error)
+	// MarkPublished removes a published message.
+	MarkPublished(ctx context.Context, id string) error
+	// MarkFailed records a failed attempt and makes the message due again
+	// at retryAt.
+	MarkFailed(ctx context.Context, id string, cause error, retryAt time.Time) error
+	// MarkDead records a failed attempt and stops retrying the message.
+	MarkDead(ctx context.Context, id string, cause error) error
+	// Pending counts the messages waiting to be published.
+	Pending(ctx context.Context) (int64, error)
+}
+
+func newMessageID() string {
+	var b [16]byte
+	_, _ = rand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}
@@ -0,0 +1,292 @@
+// Copyright 2022 The codesjoy Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package outbox
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/metric/noop"
+
+	"github.com/codesjoy/yggdrasil/v3/internal/backoff"
+)
+
+// Config configures a Relay. Zero fields take their defaults.
+type Config struct {
+	// Name identifies the relay in logs, metrics and the governor.
+	Name string `mapstructure:"name"`
+	// Interval is the delay between polls when the outbox is drained.
+	Interval time.Duration `mapstructure:"interval"`
+	// BatchSize bounds the messages claimed per poll.
+	BatchSize int `mapstructure:"batch_size"`
+	// Lease is how long a claimed message is hidden from other relays.
+	Lease time.Duration `mapstructure:"lease"`
+	// MaxAttempts is the number of failed publishes after which a message
+	// is marked dead.
+	MaxAttempts int `mapstructure:"max_attempts"`
+	// RetryDelay and MaxRetryDelay bound the exponential delay between
+	// publish attempts of one message.
+	RetryDelay    time.Duration `mapstructure:"retry_delay"`
+	MaxRetryDelay time.Duration `mapstructure:"max_retry_delay"`
+}
+
+func (c *Config) setDefaults() {
+	if c.Name == "" {
+		c.Name = "default"
+	}
+	if c.Interval <= 0 {
+		c.Interval = time.Second
+	}
+	if c.BatchSize <= 0 {
+		c.BatchSize = 100
+	}
+	if c.Lease <= 0 {
+		c.Lease = 30 * time.Second
+	}
+	if c.MaxAttempts <= 0 {
+		c.MaxAttempts = 10
+	}
+	if c.RetryDelay <= 0 {
+		c.RetryDelay = time.Second
+	}
+	if c.MaxRetryDelay <= 0 {
+		c.MaxRetryDelay = 5 * time.Minute
+	}
+}
+
+// Option configures a Relay.
+type Option func(*Relay)
+
+// WithMeterProvider sets the meter provider used for relay metrics. The
+// global provider is used by default.
+func WithMeterProvider(provider metric.MeterProvider) Option {
+	return func(r *Relay) {
+		r.meterProvider = provider
+	}
+}
+
+// Relay polls a Store and publishes pending messages. It implements the
+// application worker contract, so it can be registered with app.WithWorker.
+type Relay struct {
+	cfg           Config
+	store         Store
+	publisher     Publisher
+	backoff       backoff.Strategy
+	meterProvider metric.MeterProvider
+	messages      metric.Int64Counter
+
+	published atomic.Uint64
+	failed    atomic.Uint64
+	dead      atomic.Uint64
+
+	mu         sync.Mutex
+	lastPollAt time.Time
+	lastError  string
+	cancel     context.CancelFunc
+	stopped    bool
+	done       chan struct{}
+}
+
+// NewRelay creates a relay publishing the messages of store through
+// publisher.
+func NewRelay(store Store, publisher Publisher, cfg Config, opts ...Option) (*Relay, error) {
+	if store == nil || publisher == nil {
+		return nil, errors.New("outbox: store and publisher are required")
+	}
+	cfg.setDefaults()
+	r := &Relay{
+		cfg:       cfg,
+		store:     store,
+		publisher: publisher,
+		backoff: backoff.Exponential{Config: backoff.Config{
+			BaseDelay:  cfg.RetryDelay,
+			Multiplier: backoff.DefaultConfig.Multiplier,
+			Jitter:     backoff.DefaultConfig.Jitter,
+			MaxDelay:   cfg.MaxRetryDelay,
+		}},
+	}
+	for _, opt := range opts {
+		opt(r)
+	}
+	if r.meterProvider == nil {
+		r.meterProvider = otel.GetMeterProvider()
+	}
+	meter := r.meterProvider.Meter("github.com/codesjoy/yggdrasil/v3",
+		metric.WithInstrumentationVersion("yggdrasil"),
+	)
+	var err error
+	r.messages, err = meter.Int64Counter("outbox.messages",
+		metric.WithDescription("Counts outbox messages handled by the relay, by outcome."),
+		metric.WithUnit("{message}"))
+	if err != nil {
+		otel.Handle(err)
+		r.messages = noop.Int64Counter{}
+	}
+	return r, nil
+}
+
+// Run polls the store until ctx is canceled or Stop is called.
+func (r *Relay) Run(ctx context.Context) error {
+	r.mu.Lock()
+	if r.stopped {
+		r.mu.Unlock()
+		return nil
+	}
+	if r.cancel != nil {
+		r.mu.Unlock()
+		return errors.New("outbox relay is already running")
+	}
+	ctx, r.cancel = context.WithCancel(ctx)
+	r.done = make(chan struct{})
+	done := r.done
+	r.mu.Unlock()
+	defer close(done)
+
+	trackRelay(r)
+	defer untrackRelay(r)
+
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-timer.C:
+		}
+		delay := r.cfg.Interval
+		if r.poll(ctx) == r.cfg.BatchSize {
+			// The batch was full; more messages are likely waiting.
+			delay = 0
+		}
+		timer.Reset(delay)
+	}
+}
+
+// Stop stops polling and waits, within ctx, for the publishes in flight.
+func (r *Relay) Stop(ctx context.Context) error {
+	r.mu.Lock()
+	r.stopped = true
+	cancel, done := r.cancel, r.done
+	r.mu.Unlock()
+	if cancel == nil {
+		return nil
+	}
+	cancel()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("wait outbox relay: %w", ctx.Err())
+	}
+}
+
+// poll publishes one batch and returns the number of messages claimed.
+func (r *Relay) poll(ctx context.Context) int {
+	msgs, err := r.store.Fetch(ctx, r.cfg.BatchSize, r.cfg.Lease)
+	r.mu.Lock()
+	r.lastPollAt = time.Now()
+	if err != nil {
+		r.lastError = err.Error()
+	}
+	r.mu.Unlock()
+	if err != nil {
+		if ctx.Err() == nil {
+			slog.Error("outbox fetch failed",
+				slog.String("relay", r.cfg.Name), slog.Any("error", err))
+		}
+		return 0
+	}
+	for _, msg := range msgs {
+		if ctx.Err() != nil {
+			// Unpublished claims become due again once their lease expires.
+			break
+		}
+		r.publish(ctx, msg)
+	}
+	return len(msgs)
+}
+
+func (r *Relay) publish(ctx context.Context, msg Message) {
+	// Bookkeeping must complete even when Stop cancels ctx after publishing.
+	storeCtx := context.WithoutCancel(ctx)
+	pubErr := r.publisher.Publish(ctx, msg)
+	if pubErr == nil {
+		if err := r.store.MarkPublished(storeCtx, msg.ID); err != nil {
+			r.recordError(err)
+			slog.Error("outbox mark published failed",
+				slog.String("relay", r.cfg.Name),
+				slog.String("id", msg.ID),
+				slog.Any("error", err))
+		}
+		r.published.Add(1)
+		r.record(ctx, "published")
+		return
+	}
+
+	r.recordError(pubErr)
+	attempts := msg.Attempts + 1
+	var err error
+	if attempts >= r.cfg.MaxAttempts {
+		err = r.store.MarkDead(storeCtx, msg.ID, pubErr)
+		r.dead.Add(1)
+		r.record(ctx, "dead")
+		slog.Error("outbox message is dead after max attempts",
+			slog.String("relay", r.cfg.Name),
+			slog.String("id", msg.ID),
+			slog.String("topic", msg.Topic),
+			slog.Int("attempts", attempts),
+			slog.Any("error", pubErr))
+	} else {
+		retryAt := time.Now().Add(r.backoff.Backoff(msg.Attempts))
+		err = r.store.MarkFailed(storeCtx, msg.ID, pubErr, retryAt)
+		r.failed.Add(1)
+		r.record(ctx, "failed")
+		slog.Warn("outbox publish failed",
+			slog.String("relay", r.cfg.Name),
+			slog.String("id", msg.ID),
+			slog.String("topic", msg.Topic),
+			slog.Int("attempts", attempts),
+			slog.Time("retry_at", retryAt),
+			slog.Any("error", pubErr))
+	}
+	if err != nil {
+		r.recordError(err)
+		slog.Error("outbox mark failed failed",
+			slog.String("relay", r.cfg.Name),
+			slog.String("id", msg.ID),
+			slog.Any("error", err))
+	}
+}
+
+func (r *Relay) record(ctx context.Context, outcome string) {
+	r.messages.Add(context.WithoutCancel(ctx), 1, metric.WithAttributes(
+		attribute.String("relay", r.cfg.Name),
+		attribute.String("outcome", outcome),
+	))
+}
+
+func (r *Relay) recordError(err error) {
+	r.mu.Lock()
+	r.lastError = err.Error()
+	r.mu.Unlock()
+}
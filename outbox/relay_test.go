@@ -0,0 +1,116 @@
+// Copyright 2022 The codesjoy Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package outbox
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func startRelay(t *testing.T, r *Relay) {
+	t.Helper()
+	done := make(chan error, 1)
+	go func() { done <- r.Run(context.Background()) }()
+	t.Cleanup(func() {
+		require.NoError(t, r.Stop(context.Background()))
+		require.NoError(t, <-done)
+	})
+}
+
+func TestRelayPublishesRetriesAndDeadLetters(t *testing.T) {
+	db, fake := openFakeDB(t)
+	store, err := NewSQLStore(db, SQLite)
+	require.NoError(t, err)
+	ctx := context.Background()
+	require.NoError(t, store.Enqueue(ctx, db,
+		Message{ID: "ok", Topic: "orders"},
+		Message{ID: "flaky", Topic: "orders"},
+		Message{ID: "poison", Topic: "orders"},
+	))
+
+	var mu sync.Mutex
+	published := map[string]int{}
+	flakyCalls := 0
+	publisher := PublisherFunc(func(_ context.Context, msg Message) error {
+		mu.Lock()
+		defer mu.Unlock()
+		switch msg.ID {
+		case "flaky":
+			flakyCalls++
+			if flakyCalls == 1 {
+				return errors.New("transient")
+			}
+		case "poison":
+			return errors.New("rejected")
+		}
+		published[msg.ID]++
+		return nil
+	})
+	relay, err := NewRelay(store, publisher, Config{
+		Name:        "orders",
+		Interval:    5 * time.Millisecond,
+		MaxAttempts: 2,
+		RetryDelay:  time.Millisecond,
+	})
+	require.NoError(t, err)
+	startRelay(t, relay)
+
+	require.Eventually(t, func() bool {
+		fake.mu.Lock()
+		defer fake.mu.Unlock()
+		return len(fake.rows) == 1 && fake.rows["poison"].status == statusDead
+	}, 5*time.Second, 5*time.Millisecond)
+
+	mu.Lock()
+	assert.Equal(t, map[string]int{"ok": 1, "flaky": 1}, published)
+	mu.Unlock()
+
+	var status RelayStatus
+	for _, item := range Relays(ctx) {
+		if item.Name == "orders" {
+			status = item
+		}
+	}
+	assert.Equal(t, uint64(2), status.Published)
+	assert.Equal(t, uint64(2), status.Failed)
+	assert.Equal(t, uint64(1), status.Dead)
+	assert.Zero(t, status.Pending)
+	assert.Equal(t, "rejected", status.LastError)
+	assert.False(t, status.LastPollAt.IsZero())
+}
+
+func TestRelayStopBeforeRunAndValidation(t *testing.T) {
+	_, err := NewRelay(nil, nil, Config{})
+	require.Error(t, err)
+
+	db, _ := openFakeDB(t)
+	store, err := NewSQLStore(db, SQLite)
+	require.NoError(t, err)
+	relay, err := NewRelay(store, PublisherFunc(func(context.Context, Message) error {
+		return nil
+	}), Config{})
+	require.NoError(t, err)
+	require.NoError(t, relay.Stop(context.Background()))
+	require.NoError(t, relay.Run(context.Background()))
+	for _, item := range Relays(context.Background()) {
+		assert.NotEqual(t, "default", item.Name)
+	}
+}
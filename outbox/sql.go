@@ -0,0 +1,287 @@
+// Copyright 2022 The codesjoy Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package outbox
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"time"
+)
+
+// DefaultTable is the outbox table name used unless WithTable is given.
+const DefaultTable = "yggdrasil_outbox"
+
+// Message states stored in the status column.
+const (
+	statusPending = 0
+	statusDead    = 1
+)
+
+// Dialect describes the SQL differences between databases.
+type Dialect struct {
+	Name     string
+	BlobType string
+	// Placeholder returns the bind parameter for the n-th (1-based) argument.
+	Placeholder func(n int) string
+}
+
+// Supported dialects.
+var (
+	MySQL = Dialect{
+		Name:        "mysql",
+		BlobType:    "LONGBLOB",
+		Placeholder: func(int) string { return "?" },
+	}
+	Postgres = Dialect{
+		Name:        "postgres",
+		BlobType:    "BYTEA",
+		Placeholder: func(n int) string { return "$" + strconv.Itoa(n) },
+	}
+	SQLite = Dialect{
+		Name:        "sqlite",
+		BlobType:    "BLOB",
+		Placeholder: func(int) string { return "?" },
+	}
+)
+
+var tableNamePattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*(\.[A-Za-z_][A-Za-z0-9_]*)?$`)
+
+// Execer is satisfied by *sql.DB, *sql.Tx and *sql.Conn.
+type Execer interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+}
+
+// SQLOption configures a SQLStore.
+type SQLOption func(*SQLStore)
+
+// WithTable sets the outbox table name.
+func WithTable(name string) SQLOption {
+	return func(s *SQLStore) {
+		s.table = name
+	}
+}
+
+// SQLStore is a Store backed by database/sql.
+type SQLStore struct {
+	db      *sql.DB
+	dialect Dialect
+	table   string
+	now     func() time.Time
+}
+
+// NewSQLStore creates a store using db.
+func NewSQLStore(db *sql.DB, dialect Dialect, opts ...SQLOption) (*SQLStore, error) {
+	if db == nil {
+		return nil, errors.New("outbox: db is nil")
+	}
+	if dialect.Placeholder == nil {
+		return nil, errors.New("outbox: dialect placeholder is nil")
+	}
+	s := &SQLStore{db: db, dialect: dialect, table: DefaultTable, now: time.Now}
+	for _, opt := range opts {
+		opt(s)
+	}
+	if !tableNamePattern.MatchString(s.table) {
+		return nil, fmt.Errorf("outbox: invalid table name %q", s.table)
+	}
+	return s, nil
+}
+
+// Schema returns the CREATE TABLE statement of the outbox table. Times are
+// stored as Unix nanoseconds to stay portable across databases.
+func (s *SQLStore) Schema() string {
+	return fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %[1]s (
+	id VARCHAR(64) NOT NULL PRIMARY KEY,
+	topic VARCHAR(255) NOT NULL,
+	msg_key VARCHAR(255) NOT NULL,
+	payload %[2]s NOT NULL,
+	headers TEXT NOT NULL,
+	created_at BIGINT NOT NULL,
+	attempts INTEGER NOT NULL,
+	status SMALLINT NOT NULL,
+	due_at BIGINT NOT NULL,
+	last_error TEXT
+)`, s.table, s.dialect.BlobType)
+}
+
+// Enqueue inserts msgs using exec, normally the *sql.Tx carrying the business
+// change so both commit or roll back together.
+func (s *SQLStore) Enqueue(ctx context.Context, exec Execer, msgs ...Message) error {
+	query := fmt.Sprintf(
+		"INSERT INTO %s (id, topic, msg_key, payload, headers, created_at, attempts, "+
+			"status, due_at, last_error) VALUES (%s, NULL)",
+		s.table, s.placeholders(1, 9),
+	)
+	now := s.now().UnixNano()
+	for _, msg := range msgs {
+		if msg.Topic == "" {
+			return errors.New("outbox: message topic is empty")
+		}
+		if msg.ID == "" {
+			msg.ID = newMessageID()
+		}
+		headers, err := json.Marshal(msg.Headers)
+		if err != nil {
+			return fmt.Errorf("outbox: encode headers: %w", err)
+		}
+		payload := msg.Payload
+		if payload == nil {
+			payload = []byte{}
+		}
+		if _, err := exec.ExecContext(ctx, query,
+			msg.ID, msg.Topic, msg.Key, payload, string(headers),
+			now, 0, statusPending, now,
+		); err != nil {
+			return fmt.Errorf("outbox: enqueue %s: %w", msg.ID, err)
+		}
+	}
+	return nil
+}
+
+// Fetch implements Store. Messages are claimed one by one with a conditional
+// update, so several relays may poll the same table.
+func (s *SQLStore) Fetch(ctx context.Context, limit int, lease time.Duration) ([]Message, error) {
+	now := s.now().UnixNano()
+	rows, err := s.db.QueryContext(ctx, fmt.Sprintf(
+		"SELECT id, topic, msg_key, payload, headers, created_at, attempts FROM %s "+
+			"WHERE status = %s AND due_at <= %s ORDER BY due_at LIMIT %d",
+		s.table, s.arg(1), s.arg(2), limit,
+	), statusPending, now)
+	if err != nil {
+		return nil, fmt.Errorf("outbox: fetch: %w", err)
+	}
+	var candidates []Message
+	for rows.Next() {
+		var msg Message
+		var headers string
+		var createdAt int64
+		if err := rows.Scan(
+			&msg.ID, &msg.Topic, &msg.Key, &msg.Payload, &headers, &createdAt, &msg.Attempts,
+		); err != nil {
+			_ = rows.Close()
+			return nil, fmt.Errorf("outbox: fetch: %w", err)
+		}
+		if headers != "" && headers != "null" {
+			if err := json.Unmarshal([]byte(headers), &msg.Headers); err != nil {
+				_ = rows.Close()
+				return nil, fmt.Errorf("outbox: decode headers of %s: %w", msg.ID, err)
+			}
+		}
+		msg.CreatedAt = time.Unix(0, createdAt)
+		candidates = append(candidates, msg)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, fmt.Errorf("outbox: fetch: %w", err)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("outbox: fetch: %w", err)
+	}
+
+	claim := fmt.Sprintf(
+		"UPDATE %s SET due_at = %s WHERE id = %s AND status = %s AND due_at <= %s",
+		s.table, s.arg(1), s.arg(2), s.arg(3), s.arg(4),
+	)
+	leaseUntil := now + lease.Nanoseconds()
+	claimed := candidates[:0]
+	for _, msg := range candidates {
+		res, err := s.db.ExecContext(ctx, claim, leaseUntil, msg.ID, statusPending, now)
+		if err != nil {
+			return claimed, fmt.Errorf("outbox: claim %s: %w", msg.ID, err)
+		}
+		if n, err := res.RowsAffected(); err == nil && n == 1 {
+			claimed = append(claimed, msg)
+		}
+	}
+	return claimed, nil
+}
+
+// MarkPublished implements Store.
+func (s *SQLStore) MarkPublished(ctx context.Context, id string) error {
+	_, err := s.db.ExecContext(ctx,
+		fmt.Sprintf("DELETE FROM %s WHERE id = %s", s.table, s.arg(1)), id)
+	if err != nil {
+		return fmt.Errorf("outbox: mark %s published: %w", id, err)
+	}
+	return nil
+}
+
+// MarkFailed implements Store.
+func (s *SQLStore) MarkFailed(
+	ctx context.Context,
+	id string,
+	cause error,
+	retryAt time.Time,
+) error {
+	return s.markFailed(ctx, id, cause, statusPending, retryAt.UnixNano())
+}
+
+// MarkDead implements Store.
+func (s *SQLStore) MarkDead(ctx context.Context, id string, cause error) error {
+	return s.markFailed(ctx, id, cause, statusDead, s.now().UnixNano())
+}
+
+func (s *SQLStore) markFailed(
+	ctx context.Context,
+	id string,
+	cause error,
+	status int,
+	dueAt int64,
+) error {
+	msg := ""
+	if cause != nil {
+		msg = cause.Error()
+	}
+	_, err := s.db.ExecContext(ctx, fmt.Sprintf(
+		"UPDATE %s SET attempts = attempts + 1, status = %s, due_at = %s, last_error = %s "+
+			"WHERE id = %s",
+		s.table, s.arg(1), s.arg(2), s.arg(3), s.arg(4),
+	), status, dueAt, msg, id)
+	if err != nil {
+		return fmt.Errorf("outbox: mark %s failed: %w", id, err)
+	}
+	return nil
+}
+
+// Pending implements Store.
+func (s *SQLStore) Pending(ctx context.Context) (int64, error) {
+	var n int64
+	err := s.db.QueryRowContext(ctx, fmt.Sprintf(
+		"SELECT COUNT(*) FROM %s WHERE status = %s", s.table, s.arg(1),
+	), statusPending).Scan(&n)
+	if err != nil {
+		return 0, fmt.Errorf("outbox: count pending: %w", err)
+	}
+	return n, nil
+}
+
+func (s *SQLStore) arg(n int) string {
+	return s.dialect.Placeholder(n)
+}
+
+func (s *SQLStore) placeholders(from, count int) string {
+	out := ""
+	for i := range count {
+		if i > 0 {
+			out += ", "
+		}
+		out += s.arg(from + i)
+	}
+	return out
+}
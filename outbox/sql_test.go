@@ -0,0 +1,279 @@
+// Copyright 2022 The codesjoy Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package outbox
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeDB emulates the outbox table for the statements issued by SQLStore.
+type fakeDB struct {
+	mu      sync.Mutex
+	rows    map[string]*fakeRow
+	queries []string
+}
+
+type fakeRow struct {
+	id, topic, key, headers string
+	payload                 []byte
+	createdAt, dueAt        int64
+	attempts, status        int64
+	lastError               string
+}
+
+var fakeDBs sync.Map
+
+var fakeDriverSeq atomic.Int64
+
+func init() {
+	sql.Register("outboxfake", fakeDriver{})
+}
+
+type fakeDriver struct{}
+
+func (fakeDriver) Open(name string) (driver.Conn, error) {
+	db, ok := fakeDBs.Load(name)
+	if !ok {
+		return nil, fmt.Errorf("unknown fake db %q", name)
+	}
+	return &fakeConn{db: db.(*fakeDB)}, nil
+}
+
+func openFakeDB(t *testing.T) (*sql.DB, *fakeDB) {
+	t.Helper()
+	name := fmt.Sprintf("db-%d", fakeDriverSeq.Add(1))
+	fake := &fakeDB{rows: map[string]*fakeRow{}}
+	fakeDBs.Store(name, fake)
+	db, err := sql.Open("outboxfake", name)
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = db.Close() })
+	return db, fake
+}
+
+type fakeConn struct{ db *fakeDB }
+
+func (c *fakeConn) Prepare(string) (driver.Stmt, error) {
+	return nil, errors.New("prepare is not supported")
+}
+
+func (c *fakeConn) Close() error { return nil }
+
+func (c *fakeConn) Begin() (driver.Tx, error) { return fakeTx{}, nil }
+
+type fakeTx struct{}
+
+func (fakeTx) Commit() error   { return nil }
+func (fakeTx) Rollback() error { return nil }
+
+func (c *fakeConn) ExecContext(
+	_ context.Context,
+	query string,
+	args []driver.NamedValue,
+) (driver.Result, error) {
+	db := c.db
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	db.queries = append(db.queries, query)
+	v := func(i int) any { return args[i].Value }
+	switch {
+	case strings.HasPrefix(query, "INSERT"):
+		id := v(0).(string)
+		if _, ok := db.rows[id]; ok {
+			return nil, errors.New("duplicate id")
+		}
+		db.rows[id] = &fakeRow{
+			id: id, topic: v(1).(string), key: v(2).(string), payload: v(3).([]byte),
+			headers: v(4).(string), createdAt: v(5).(int64), attempts: v(6).(int64),
+			status: v(7).(int64), dueAt: v(8).(int64),
+		}
+		return driver.RowsAffected(1), nil
+	case strings.Contains(query, "SET due_at"):
+		row, ok := db.rows[v(1).(string)]
+		if !ok || row.status != v(2).(int64) || row.dueAt > v(3).(int64) {
+			return driver.RowsAffected(0), nil
+		}
+		row.dueAt = v(0).(int64)
+		return driver.RowsAffected(1), nil
+	case strings.Contains(query, "SET attempts"):
+		row, ok := db.rows[v(3).(string)]
+		if !ok {
+			return driver.RowsAffected(0), nil
+		}
+		row.attempts++
+		row.status = v(0).(int64)
+		row.dueAt = v(1).(int64)
+		row.lastError = v(2).(string)
+		return driver.RowsAffected(1), nil
+	case strings.HasPrefix(query, "DELETE"):
+		delete(db.rows, v(0).(string))
+		return driver.RowsAffected(1), nil
+	}
+	return nil, fmt.Errorf("unexpected exec %q", query)
+}
+
+func (c *fakeConn) QueryContext(
+	_ context.Context,
+	query string,
+	args []driver.NamedValue,
+) (driver.Rows, error) {
+	db := c.db
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	db.queries = append(db.queries, query)
+	status := args[0].Value.(int64)
+	if strings.HasPrefix(query, "SELECT COUNT(*)") {
+		var n int64
+		for _, row := range db.rows {
+			if row.status == status {
+				n++
+			}
+		}
+		return &fakeRows{cols: []string{"count"}, values: [][]driver.Value{{n}}}, nil
+	}
+	var limit int
+	if _, err := fmt.Sscanf(query[strings.Index(query, "LIMIT"):], "LIMIT %d", &limit); err != nil {
+		return nil, err
+	}
+	now := args[1].Value.(int64)
+	var due []*fakeRow
+	for _, row := range db.rows {
+		if row.status == status && row.dueAt <= now {
+			due = append(due, row)
+		}
+	}
+	sort.Slice(due, func(i, j int) bool { return due[i].dueAt < due[j].dueAt })
+	out := &fakeRows{cols: []string{
+		"id", "topic", "msg_key", "payload", "headers", "created_at", "attempts",
+	}}
+	for i, row := range due {
+		if i == limit {
+			break
+		}
+		out.values = append(out.values, []driver.Value{
+			row.id, row.topic, row.key, row.payload, row.headers, row.createdAt, row.attempts,
+		})
+	}
+	return out, nil
+}
+
+type fakeRows struct {
+	cols   []string
+	values [][]driver.Value
+}
+
+func (r *fakeRows) Columns() []string { return r.cols }
+func (r *fakeRows) Close() error      { return nil }
+
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if len(r.values) == 0 {
+		return io.EOF
+	}
+	copy(dest, r.values[0])
+	r.values = r.values[1:]
+	return nil
+}
+
+func TestSQLStoreEnqueueFetchAndMark(t *testing.T) {
+	db, fake := openFakeDB(t)
+	store, err := NewSQLStore(db, Postgres, WithTable("app.outbox"))
+	require.NoError(t, err)
+	now := time.Unix(1000, 0)
+	store.now = func() time.Time { return now }
+	ctx := context.Background()
+
+	tx, err := db.BeginTx(ctx, nil)
+	require.NoError(t, err)
+	require.NoError(t, store.Enqueue(ctx, tx,
+		Message{ID: "m1", Topic: "orders", Key: "o-1", Payload: []byte("a"),
+			Headers: map[string]string{"type": "placed"}},
+		Message{Topic: "orders"},
+	))
+	require.NoError(t, tx.Commit())
+	assert.Contains(t, fake.queries[0], "INSERT INTO app.outbox")
+	assert.Contains(t, fake.queries[0], "$9")
+
+	pending, err := store.Pending(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), pending)
+
+	msgs, err := store.Fetch(ctx, 10, time.Minute)
+	require.NoError(t, err)
+	require.Len(t, msgs, 2)
+	byID := map[string]Message{}
+	for _, msg := range msgs {
+		byID[msg.ID] = msg
+	}
+	assert.Equal(t, map[string]string{"type": "placed"}, byID["m1"].Headers)
+	assert.Equal(t, []byte("a"), byID["m1"].Payload)
+	assert.Equal(t, now, byID["m1"].CreatedAt)
+
+	again, err := store.Fetch(ctx, 10, time.Minute)
+	require.NoError(t, err)
+	assert.Empty(t, again, "claimed messages are leased")
+
+	require.NoError(t, store.MarkPublished(ctx, "m1"))
+	var other string
+	for id := range byID {
+		if id != "m1" {
+			other = id
+		}
+	}
+	require.NoError(t, store.MarkFailed(ctx, other, errors.New("broker down"), now))
+	fake.mu.Lock()
+	assert.NotContains(t, fake.rows, "m1")
+	assert.Equal(t, int64(1), fake.rows[other].attempts)
+	assert.Equal(t, "broker down", fake.rows[other].lastError)
+	fake.mu.Unlock()
+
+	msgs, err = store.Fetch(ctx, 10, time.Minute)
+	require.NoError(t, err)
+	require.Len(t, msgs, 1)
+	assert.Equal(t, 1, msgs[0].Attempts)
+
+	require.NoError(t, store.MarkDead(ctx, other, errors.New("gave up")))
+	pending, err = store.Pending(ctx)
+	require.NoError(t, err)
+	assert.Zero(t, pending)
+}
+
+func TestNewSQLStoreValidation(t *testing.T) {
+	db, _ := openFakeDB(t)
+	_, err := NewSQLStore(nil, MySQL)
+	require.Error(t, err)
+	_, err = NewSQLStore(db, Dialect{})
+	require.Error(t, err)
+	_, err = NewSQLStore(db, MySQL, WithTable("outbox; DROP TABLE users"))
+	require.Error(t, err)
+
+	store, err := NewSQLStore(db, MySQL)
+	require.NoError(t, err)
+	assert.Contains(t, store.Schema(), "CREATE TABLE IF NOT EXISTS yggdrasil_outbox")
+	assert.Contains(t, store.Schema(), "LONGBLOB")
+	require.Error(t, store.Enqueue(context.Background(), db, Message{}))
+}
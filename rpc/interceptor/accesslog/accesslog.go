@@ -0,0 +1,345 @@
+// Copyright 2022 The codesjoy Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package accesslog provides server interceptors that write one access
+// record per RPC to a dedicated writer, separate from application logs.
+package accesslog
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"google.golang.org/protobuf/proto"
+
+	"github.com/codesjoy/yggdrasil/v3/config"
+	"github.com/codesjoy/yggdrasil/v3/observability/logger"
+	"github.com/codesjoy/yggdrasil/v3/rpc/interceptor"
+	"github.com/codesjoy/yggdrasil/v3/rpc/metadata"
+	"github.com/codesjoy/yggdrasil/v3/rpc/status"
+	"github.com/codesjoy/yggdrasil/v3/rpc/stream"
+	"github.com/codesjoy/yggdrasil/v3/transport/support/peer"
+)
+
+const name = "access_log"
+
+// Record fields.
+const (
+	FieldTime      = "time"
+	FieldType      = "type"
+	FieldMethod    = "method"
+	FieldPeer      = "peer"
+	FieldStatus    = "status"
+	FieldLatency   = "latency_ms"
+	FieldBytesIn   = "bytes_in"
+	FieldBytesOut  = "bytes_out"
+	FieldRequestID = "request_id"
+)
+
+// Record formats.
+const (
+	FormatJSON = "json"
+	FormatCLF  = "clf"
+)
+
+var defaultFields = []string{
+	FieldTime,
+	FieldPeer,
+	FieldType,
+	FieldMethod,
+	FieldStatus,
+	FieldBytesIn,
+	FieldBytesOut,
+	FieldLatency,
+	FieldRequestID,
+}
+
+// Config defines the access log interceptor configuration.
+type Config struct {
+	// Writer names a writer from the logging writers; empty writes to stdout.
+	Writer string `mapstructure:"writer"`
+	// Format is "json" or "clf".
+	Format string `mapstructure:"format" default:"json"`
+	// Fields selects and orders the record fields. Empty selects all.
+	Fields []string `mapstructure:"fields"`
+	// RequestIDHeader is the incoming metadata key carrying the request id.
+	RequestIDHeader string `mapstructure:"request_id_header" default:"x-request-id"`
+}
+
+// BuiltinUnaryServerProvider returns the access log unary server interceptor provider.
+func BuiltinUnaryServerProvider() interceptor.UnaryServerInterceptorProvider {
+	return BuiltinUnaryServerProviderWithConfig(nil)
+}
+
+// BuiltinUnaryServerProviderWithConfig returns the access log unary server
+// interceptor provider bound to explicit config.
+func BuiltinUnaryServerProviderWithConfig(source any) interceptor.UnaryServerInterceptorProvider {
+	l := newAccessLog(mustLoadConfig(source), nil)
+	return interceptor.NewUnaryServerInterceptorProvider(
+		name,
+		func() interceptor.UnaryServerInterceptor {
+			return l.UnaryServerInterceptor
+		},
+	)
+}
+
+// BuiltinStreamServerProvider returns the access log stream server interceptor provider.
+func BuiltinStreamServerProvider() interceptor.StreamServerInterceptorProvider {
+	return BuiltinStreamServerProviderWithConfig(nil)
+}
+
+// BuiltinStreamServerProviderWithConfig returns the access log stream server
+// interceptor provider bound to explicit config.
+func BuiltinStreamServerProviderWithConfig(
+	source any,
+) interceptor.StreamServerInterceptorProvider {
+	l := newAccessLog(mustLoadConfig(source), nil)
+	return interceptor.NewStreamServerInterceptorProvider(
+		name,
+		func() interceptor.StreamServerInterceptor {
+			return l.StreamServerInterceptor
+		},
+	)
+}
+
+func mustLoadConfig(source any) *Config {
+	cfg := Config{}
+	if err := config.NewSnapshot(source).Decode(&cfg); err != nil {
+		panic(fmt.Sprintf("load access log interceptor config: %v", err))
+	}
+	if cfg.Format != FormatJSON && cfg.Format != FormatCLF {
+		panic(fmt.Sprintf("load access log interceptor config: unknown format %q", cfg.Format))
+	}
+	for _, field := range cfg.Fields {
+		if !slices.Contains(defaultFields, field) {
+			panic(fmt.Sprintf("load access log interceptor config: unknown field %q", field))
+		}
+	}
+	if len(cfg.Fields) == 0 {
+		cfg.Fields = slices.Clone(defaultFields)
+	}
+	return &cfg
+}
+
+type accessLog struct {
+	cfg *Config
+
+	once sync.Once
+	mu   sync.Mutex
+	w    io.Writer
+}
+
+func newAccessLog(cfg *Config, w io.Writer) *accessLog {
+	return &accessLog{cfg: cfg, w: w}
+}
+
+// writer opens the configured writer on first use, after the logging
+// settings of the App are in place.
+func (l *accessLog) writer() io.Writer {
+	l.once.Do(func() {
+		if l.w != nil {
+			return
+		}
+		l.w = os.Stdout
+		if l.cfg.Writer == "" {
+			return
+		}
+		w, err := logger.GetWriter(l.cfg.Writer)
+		if err != nil {
+			slog.Warn(
+				"fault to open access log writer",
+				slog.String("writer", l.cfg.Writer),
+				slog.Any("error", err),
+			)
+			return
+		}
+		l.w = w
+	})
+	return l.w
+}
+
+type record struct {
+	start    time.Time
+	typ      string
+	method   string
+	ctx      context.Context
+	err      error
+	bytesIn  int64
+	bytesOut int64
+}
+
+// UnaryServerInterceptor is a unary server interceptor.
+func (l *accessLog) UnaryServerInterceptor(
+	ctx context.Context,
+	req interface{},
+	info *interceptor.UnaryServerInfo,
+	handler interceptor.UnaryHandler,
+) (resp interface{}, err error) {
+	rec := record{start: time.Now(), typ: "unary", method: info.FullMethod, ctx: ctx}
+	defer func() {
+		rec.err = err
+		rec.bytesIn = messageSize(req)
+		rec.bytesOut = messageSize(resp)
+		l.write(&rec)
+	}()
+	return handler(ctx, req)
+}
+
+// StreamServerInterceptor is a stream server interceptor.
+func (l *accessLog) StreamServerInterceptor(
+	srv interface{},
+	ss stream.ServerStream,
+	info *interceptor.StreamServerInfo,
+	handler stream.Handler,
+) (err error) {
+	rec := record{start: time.Now(), typ: "stream", method: info.FullMethod, ctx: ss.Context()}
+	cs := &countingServerStream{ServerStream: ss}
+	defer func() {
+		rec.err = err
+		rec.bytesIn = cs.in.Load()
+		rec.bytesOut = cs.out.Load()
+		l.write(&rec)
+	}()
+	return handler(srv, cs)
+}
+
+func (l *accessLog) write(rec *record) {
+	var buf bytes.Buffer
+	if l.cfg.Format == FormatCLF {
+		l.formatCLF(&buf, rec)
+	} else {
+		l.formatJSON(&buf, rec)
+	}
+	buf.WriteByte('\n')
+	w := l.writer()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if _, err := w.Write(buf.Bytes()); err != nil {
+		slog.Warn("fault to write access log", slog.Any("error", err))
+	}
+}
+
+func (l *accessLog) value(rec *record, field string) any {
+	switch field {
+	case FieldTime:
+		return rec.start.Format(time.RFC3339Nano)
+	case FieldType:
+		return rec.typ
+	case FieldMethod:
+		return rec.method
+	case FieldPeer:
+		if p, ok := peer.FromContext(rec.ctx); ok && p.Addr != nil {
+			return p.Addr.String()
+		}
+		return ""
+	case FieldStatus:
+		return status.FromError(rec.err).Code().String()
+	case FieldLatency:
+		return float64(time.Since(rec.start)) / float64(time.Millisecond)
+	case FieldBytesIn:
+		return rec.bytesIn
+	case FieldBytesOut:
+		return rec.bytesOut
+	case FieldRequestID:
+		if md, ok := metadata.FromInContext(rec.ctx); ok {
+			if values := md.Get(l.cfg.RequestIDHeader); len(values) > 0 {
+				return values[0]
+			}
+		}
+		return ""
+	default:
+		return nil
+	}
+}
+
+func (l *accessLog) formatJSON(buf *bytes.Buffer, rec *record) {
+	buf.WriteByte('{')
+	for i, field := range l.cfg.Fields {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		key, _ := json.Marshal(field)
+		val, _ := json.Marshal(l.value(rec, field))
+		buf.Write(key)
+		buf.WriteByte(':')
+		buf.Write(val)
+	}
+	buf.WriteByte('}')
+}
+
+// formatCLF writes the selected fields space separated in the spirit of the
+// Common Log Format: empty values become "-", the time is bracketed and the
+// method is quoted.
+func (l *accessLog) formatCLF(buf *bytes.Buffer, rec *record) {
+	for i, field := range l.cfg.Fields {
+		if i > 0 {
+			buf.WriteByte(' ')
+		}
+		val := l.value(rec, field)
+		switch field {
+		case FieldTime:
+			buf.WriteString("[" + rec.start.Format("02/Jan/2006:15:04:05 -0700") + "]")
+		case FieldMethod:
+			buf.WriteString(strconv.Quote(rec.method))
+		case FieldLatency:
+			buf.WriteString(strconv.FormatFloat(val.(float64), 'f', 3, 64))
+		default:
+			s := fmt.Sprint(val)
+			if s == "" || val == nil {
+				s = "-"
+			}
+			buf.WriteString(strings.ReplaceAll(s, " ", "_"))
+		}
+	}
+}
+
+func messageSize(m any) int64 {
+	if msg, ok := m.(proto.Message); ok {
+		return int64(proto.Size(msg))
+	}
+	return 0
+}
+
+// countingServerStream counts the sizes of the messages sent and received.
+type countingServerStream struct {
+	stream.ServerStream
+	in  atomic.Int64
+	out atomic.Int64
+}
+
+func (s *countingServerStream) SendMsg(m interface{}) error {
+	err := s.ServerStream.SendMsg(m)
+	if err == nil {
+		s.out.Add(messageSize(m))
+	}
+	return err
+}
+
+func (s *countingServerStream) RecvMsg(m interface{}) error {
+	err := s.ServerStream.RecvMsg(m)
+	if err == nil {
+		s.in.Add(messageSize(m))
+	}
+	return err
+}
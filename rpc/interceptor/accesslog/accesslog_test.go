@@ -0,0 +1,113 @@
+// Copyright 2022 The codesjoy Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package accesslog
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/codesjoy/pkg/basic/xerror"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/genproto/googleapis/rpc/code"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+
+	"github.com/codesjoy/yggdrasil/v3/rpc/interceptor"
+	"github.com/codesjoy/yggdrasil/v3/rpc/metadata"
+	"github.com/codesjoy/yggdrasil/v3/rpc/stream"
+	"github.com/codesjoy/yggdrasil/v3/transport/support/peer"
+)
+
+type testServerStream struct {
+	stream.ServerStream
+	ctx context.Context
+}
+
+func (s *testServerStream) Context() context.Context { return s.ctx }
+
+func (s *testServerStream) SendMsg(any) error { return nil }
+
+func (s *testServerStream) RecvMsg(any) error { return nil }
+
+func testContext() context.Context {
+	ctx := metadata.WithInContext(context.Background(), metadata.Pairs("x-request-id", "req-1"))
+	return peer.WithContext(ctx, &peer.Peer{
+		Addr: &net.TCPAddr{IP: net.ParseIP("10.0.0.1"), Port: 1234},
+	})
+}
+
+func TestMustLoadConfigDefaults(t *testing.T) {
+	cfg := mustLoadConfig(nil)
+	assert.Equal(t, FormatJSON, cfg.Format)
+	assert.Equal(t, "x-request-id", cfg.RequestIDHeader)
+	assert.Equal(t, defaultFields, cfg.Fields)
+
+	assert.Panics(t, func() { mustLoadConfig(map[string]any{"format": "xml"}) })
+	assert.PanicsWithValue(t,
+		`load access log interceptor config: unknown field "latency"`,
+		func() { mustLoadConfig(map[string]any{"fields": []string{"method", "latency"}}) })
+}
+
+func TestUnaryServerInterceptorWritesJSON(t *testing.T) {
+	var buf bytes.Buffer
+	l := newAccessLog(mustLoadConfig(nil), &buf)
+	req := wrapperspb.String("hello")
+	_, err := l.UnaryServerInterceptor(testContext(), req,
+		&interceptor.UnaryServerInfo{FullMethod: "/pkg.Svc/Get"},
+		func(context.Context, any) (any, error) {
+			return nil, xerror.New(code.Code_NOT_FOUND, "missing")
+		})
+	require.Error(t, err)
+
+	out := map[string]any{}
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &out))
+	assert.Equal(t, "/pkg.Svc/Get", out[FieldMethod])
+	assert.Equal(t, "unary", out[FieldType])
+	assert.Equal(t, "10.0.0.1:1234", out[FieldPeer])
+	assert.Equal(t, "NOT_FOUND", out[FieldStatus])
+	assert.Equal(t, "req-1", out[FieldRequestID])
+	assert.EqualValues(t, 7, out[FieldBytesIn])
+	assert.EqualValues(t, 0, out[FieldBytesOut])
+	assert.Contains(t, out, FieldLatency)
+	assert.Contains(t, out, FieldTime)
+}
+
+func TestStreamServerInterceptorWritesCLF(t *testing.T) {
+	var buf bytes.Buffer
+	l := newAccessLog(mustLoadConfig(map[string]any{
+		"format": "clf",
+		"fields": []any{"peer", "method", "status", "bytes_out", "request_id"},
+	}), &buf)
+	ss := &testServerStream{ctx: peer.WithContext(context.Background(), &peer.Peer{
+		Addr: &net.TCPAddr{IP: net.ParseIP("10.0.0.1"), Port: 1234},
+	})}
+	err := l.StreamServerInterceptor(nil, ss,
+		&interceptor.StreamServerInfo{FullMethod: "/pkg.Svc/Watch"},
+		func(_ any, s stream.ServerStream) error {
+			_ = s.SendMsg(wrapperspb.String("abc"))
+			return errors.New("boom")
+		})
+	require.Error(t, err)
+	assert.Equal(
+		t,
+		`10.0.0.1:1234 "/pkg.Svc/Watch" UNKNOWN 5 -`,
+		strings.TrimSpace(buf.String()),
+	)
+}
@@ -0,0 +1,278 @@
+// Copyright 2022 The codesjoy Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package audit provides server interceptors that write the request and
+// response messages of selected methods to a dedicated audit writer.
+//
+// Sensitive fields are masked before they are written: fields marked with
+// the debug_redact option, fields named in the config wherever they appear,
+// and fields addressed by a dotted path from the message root.
+package audit
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/codesjoy/yggdrasil/v3/config"
+	"github.com/codesjoy/yggdrasil/v3/observability/logger"
+	"github.com/codesjoy/yggdrasil/v3/rpc/interceptor"
+	"github.com/codesjoy/yggdrasil/v3/rpc/status"
+	"github.com/codesjoy/yggdrasil/v3/rpc/stream"
+	"github.com/codesjoy/yggdrasil/v3/transport/support/peer"
+)
+
+const name = "audit"
+
+// Config defines the audit interceptor configuration.
+type Config struct {
+	// Writer names a writer from the logging writers; empty writes to stdout.
+	Writer string `mapstructure:"writer"`
+	// Methods lists the audited methods by full name ("/pkg.Service/Method")
+	// or bare name ("Method"). "*" audits every method.
+	Methods []string `mapstructure:"methods"`
+	// Redact lists the masked fields, either by name (e.g. "password") or by
+	// dotted path from the message root (e.g. "card.number").
+	Redact []string `mapstructure:"redact"`
+	// Mask replaces the values of masked fields.
+	Mask string `mapstructure:"mask" default:"***"`
+}
+
+// BuiltinUnaryServerProvider returns the audit unary server interceptor provider.
+func BuiltinUnaryServerProvider() interceptor.UnaryServerInterceptorProvider {
+	return BuiltinUnaryServerProviderWithConfig(nil)
+}
+
+// BuiltinUnaryServerProviderWithConfig returns the audit unary server
+// interceptor provider bound to explicit config.
+func BuiltinUnaryServerProviderWithConfig(source any) interceptor.UnaryServerInterceptorProvider {
+	a := newAudit(mustLoadConfig(source), nil)
+	return interceptor.NewUnaryServerInterceptorProvider(
+		name,
+		func() interceptor.UnaryServerInterceptor {
+			return a.UnaryServerInterceptor
+		},
+	)
+}
+
+// BuiltinStreamServerProvider returns the audit stream server interceptor provider.
+func BuiltinStreamServerProvider() interceptor.StreamServerInterceptorProvider {
+	return BuiltinStreamServerProviderWithConfig(nil)
+}
+
+// BuiltinStreamServerProviderWithConfig returns the audit stream server
+// interceptor provider bound to explicit config.
+func BuiltinStreamServerProviderWithConfig(
+	source any,
+) interceptor.StreamServerInterceptorProvider {
+	a := newAudit(mustLoadConfig(source), nil)
+	return interceptor.NewStreamServerInterceptorProvider(
+		name,
+		func() interceptor.StreamServerInterceptor {
+			return a.StreamServerInterceptor
+		},
+	)
+}
+
+func mustLoadConfig(source any) *Config {
+	cfg := Config{}
+	if err := config.NewSnapshot(source).Decode(&cfg); err != nil {
+		panic(fmt.Sprintf("load audit interceptor config: %v", err))
+	}
+	return &cfg
+}
+
+type audit struct {
+	cfg      *Config
+	all      bool
+	methods  map[string]struct{}
+	redactor *redactor
+
+	once sync.Once
+	mu   sync.Mutex
+	w    io.Writer
+}
+
+func newAudit(cfg *Config, w io.Writer) *audit {
+	a := &audit{
+		cfg:      cfg,
+		methods:  make(map[string]struct{}, len(cfg.Methods)),
+		redactor: newRedactor(cfg.Redact, cfg.Mask),
+		w:        w,
+	}
+	for _, method := range cfg.Methods {
+		if method == "*" {
+			a.all = true
+		}
+		a.methods[method] = struct{}{}
+	}
+	return a
+}
+
+func (a *audit) audited(method string) bool {
+	if a.all {
+		return true
+	}
+	if _, ok := a.methods[method]; ok {
+		return true
+	}
+	_, ok := a.methods[method[strings.LastIndex(method, "/")+1:]]
+	return ok
+}
+
+// writer opens the configured writer on first use, after the logging
+// settings of the App are in place.
+func (a *audit) writer() io.Writer {
+	a.once.Do(func() {
+		if a.w != nil {
+			return
+		}
+		a.w = os.Stdout
+		if a.cfg.Writer == "" {
+			return
+		}
+		w, err := logger.GetWriter(a.cfg.Writer)
+		if err != nil {
+			slog.Warn(
+				"fault to open audit writer",
+				slog.String("writer", a.cfg.Writer),
+				slog.Any("error", err),
+			)
+			return
+		}
+		a.w = w
+	})
+	return a.w
+}
+
+// record is one audit entry. Unary calls produce one record holding both
+// messages; streams produce one record per message and a final one holding
+// the status.
+type record struct {
+	Time      string   `json:"time"`
+	Type      string   `json:"type"`
+	Method    string   `json:"method"`
+	Peer      string   `json:"peer,omitempty"`
+	Direction string   `json:"direction,omitempty"`
+	Status    string   `json:"status,omitempty"`
+	LatencyMS *float64 `json:"latency_ms,omitempty"`
+	Request   any      `json:"request,omitempty"`
+	Response  any      `json:"response,omitempty"`
+	Message   any      `json:"message,omitempty"`
+}
+
+func newRecord(ctx context.Context, typ, method string) *record {
+	rec := &record{Time: time.Now().Format(time.RFC3339Nano), Type: typ, Method: method}
+	if p, ok := peer.FromContext(ctx); ok && p.Addr != nil {
+		rec.Peer = p.Addr.String()
+	}
+	return rec
+}
+
+func (rec *record) finish(start time.Time, err error) {
+	latency := float64(time.Since(start)) / float64(time.Millisecond)
+	rec.LatencyMS = &latency
+	rec.Status = status.FromError(err).Code().String()
+}
+
+// UnaryServerInterceptor is a unary server interceptor.
+func (a *audit) UnaryServerInterceptor(
+	ctx context.Context,
+	req any,
+	info *interceptor.UnaryServerInfo,
+	handler interceptor.UnaryHandler,
+) (resp any, err error) {
+	if !a.audited(info.FullMethod) {
+		return handler(ctx, req)
+	}
+	start := time.Now()
+	rec := newRecord(ctx, "unary", info.FullMethod)
+	defer func() {
+		rec.finish(start, err)
+		rec.Request = a.redactor.render(req)
+		rec.Response = a.redactor.render(resp)
+		a.write(rec)
+	}()
+	return handler(ctx, req)
+}
+
+// StreamServerInterceptor is a stream server interceptor.
+func (a *audit) StreamServerInterceptor(
+	srv any,
+	ss stream.ServerStream,
+	info *interceptor.StreamServerInfo,
+	handler stream.Handler,
+) (err error) {
+	if !a.audited(info.FullMethod) {
+		return handler(srv, ss)
+	}
+	start := time.Now()
+	defer func() {
+		rec := newRecord(ss.Context(), "stream", info.FullMethod)
+		rec.finish(start, err)
+		a.write(rec)
+	}()
+	return handler(srv, &auditServerStream{ServerStream: ss, audit: a, method: info.FullMethod})
+}
+
+func (a *audit) write(rec *record) {
+	data, err := json.Marshal(rec)
+	if err != nil {
+		slog.Warn("fault to encode audit record", slog.Any("error", err))
+		return
+	}
+	data = append(data, '\n')
+	w := a.writer()
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if _, err := w.Write(data); err != nil {
+		slog.Warn("fault to write audit record", slog.Any("error", err))
+	}
+}
+
+// auditServerStream records the messages sent and received on a stream.
+type auditServerStream struct {
+	stream.ServerStream
+	audit  *audit
+	method string
+}
+
+func (s *auditServerStream) SendMsg(m any) error {
+	err := s.ServerStream.SendMsg(m)
+	if err == nil {
+		s.record("send", m)
+	}
+	return err
+}
+
+func (s *auditServerStream) RecvMsg(m any) error {
+	err := s.ServerStream.RecvMsg(m)
+	if err == nil {
+		s.record("recv", m)
+	}
+	return err
+}
+
+func (s *auditServerStream) record(direction string, m any) {
+	rec := newRecord(s.Context(), "stream", s.method)
+	rec.Direction = direction
+	rec.Message = s.audit.redactor.render(m)
+	s.audit.write(rec)
+}
@@ -0,0 +1,234 @@
+// Copyright 2022 The codesjoy Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package audit
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/genproto/googleapis/rpc/code"
+	spb "google.golang.org/genproto/googleapis/rpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+	"google.golang.org/protobuf/types/known/anypb"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+
+	"github.com/codesjoy/yggdrasil/v3/rpc/interceptor"
+	"github.com/codesjoy/yggdrasil/v3/rpc/status"
+	"github.com/codesjoy/yggdrasil/v3/rpc/stream"
+)
+
+// payRequest describes:
+//
+//	message Card { string number = 1 [debug_redact = true]; string holder = 2; }
+//	message PayRequest {
+//	  string user = 1; string password = 2; Card card = 3;
+//	  repeated Card cards = 4; map<string, Card> by_name = 5;
+//	}
+var payRequest = func() protoreflect.MessageDescriptor {
+	str := descriptorpb.FieldDescriptorProto_TYPE_STRING.Enum()
+	msg := descriptorpb.FieldDescriptorProto_TYPE_MESSAGE.Enum()
+	opt := descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL.Enum()
+	rep := descriptorpb.FieldDescriptorProto_LABEL_REPEATED.Enum()
+	field := func(name string, number int32, typ *descriptorpb.FieldDescriptorProto_Type,
+		label *descriptorpb.FieldDescriptorProto_Label, typeName string,
+	) *descriptorpb.FieldDescriptorProto {
+		f := &descriptorpb.FieldDescriptorProto{
+			Name: proto.String(name), Number: proto.Int32(number), Type: typ, Label: label,
+		}
+		if typeName != "" {
+			f.TypeName = proto.String(typeName)
+		}
+		return f
+	}
+	number := field("number", 1, str, opt, "")
+	number.Options = &descriptorpb.FieldOptions{DebugRedact: proto.Bool(true)}
+	file := &descriptorpb.FileDescriptorProto{
+		Name:    proto.String("audit_test.proto"),
+		Package: proto.String("audit.test"),
+		Syntax:  proto.String("proto3"),
+		MessageType: []*descriptorpb.DescriptorProto{
+			{
+				Name: proto.String("Card"),
+				Field: []*descriptorpb.FieldDescriptorProto{
+					number,
+					field("holder", 2, str, opt, ""),
+				},
+			},
+			{
+				Name: proto.String("PayRequest"),
+				Field: []*descriptorpb.FieldDescriptorProto{
+					field("user", 1, str, opt, ""),
+					field("password", 2, str, opt, ""),
+					field("card", 3, msg, opt, ".audit.test.Card"),
+					field("cards", 4, msg, rep, ".audit.test.Card"),
+					field("by_name", 5, msg, rep, ".audit.test.PayRequest.ByNameEntry"),
+				},
+				NestedType: []*descriptorpb.DescriptorProto{{
+					Name: proto.String("ByNameEntry"),
+					Field: []*descriptorpb.FieldDescriptorProto{
+						field("key", 1, str, opt, ""),
+						field("value", 2, msg, opt, ".audit.test.Card"),
+					},
+					Options: &descriptorpb.MessageOptions{MapEntry: proto.Bool(true)},
+				}},
+			},
+		},
+	}
+	fd, err := protodesc.NewFile(file, nil)
+	if err != nil {
+		panic(err)
+	}
+	return fd.Messages().ByName("PayRequest")
+}()
+
+func newPayRequest(t *testing.T) proto.Message {
+	t.Helper()
+	m := dynamicpb.NewMessage(payRequest)
+	require.NoError(t, protojson.Unmarshal([]byte(`{
+		"user": "alice",
+		"password": "secret",
+		"card": {"number": "4111", "holder": "Alice"},
+		"cards": [{"number": "4222", "holder": "Bob"}],
+		"by_name": {"main": {"number": "4333", "holder": "Carol"}}
+	}`), m))
+	return m
+}
+
+func TestRedactor(t *testing.T) {
+	r := newRedactor([]string{"password", "card.holder"}, "***")
+	out := r.render(newPayRequest(t))
+	assert.Equal(t, map[string]any{
+		"user":     "alice",
+		"password": "***",
+		"card":     map[string]any{"number": "***", "holder": "***"},
+		"cards":    []any{map[string]any{"number": "***", "holder": "Bob"}},
+		"by_name":  map[string]any{"main": map[string]any{"number": "***", "holder": "Carol"}},
+	}, out)
+
+	assert.Equal(t, "hi", r.render(wrapperspb.String("hi")))
+	assert.Nil(t, r.render("not a message"))
+	assert.Nil(t, r.render(nil))
+}
+
+func TestRedactorAny(t *testing.T) {
+	r := newRedactor([]string{"message"}, "***")
+	packed, err := anypb.New(&spb.Status{
+		Code:    3,
+		Message: "secret",
+		Details: []*anypb.Any{
+			{TypeUrl: "type.googleapis.com/unknown.Type", Value: []byte{0x0a, 0x01, 'x'}},
+		},
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, map[string]any{
+		"@type":   "type.googleapis.com/google.rpc.Status",
+		"code":    float64(3),
+		"message": "***",
+		"details": []any{"***"},
+	}, r.render(packed))
+}
+
+func decodeRecords(t *testing.T, buf *bytes.Buffer) []map[string]any {
+	t.Helper()
+	var out []map[string]any
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		if line == "" {
+			continue
+		}
+		rec := map[string]any{}
+		require.NoError(t, json.Unmarshal([]byte(line), &rec))
+		out = append(out, rec)
+	}
+	return out
+}
+
+func TestUnaryServerInterceptor(t *testing.T) {
+	var buf bytes.Buffer
+	a := newAudit(mustLoadConfig(map[string]any{
+		"methods": []string{"Pay"},
+		"redact":  []string{"password"},
+		"mask":    "[redacted]",
+	}), &buf)
+
+	_, err := a.UnaryServerInterceptor(context.Background(), newPayRequest(t),
+		&interceptor.UnaryServerInfo{FullMethod: "/pkg.Svc/Pay"},
+		func(context.Context, any) (any, error) {
+			return nil, status.New(code.Code_PERMISSION_DENIED, "denied").Err()
+		})
+	require.Error(t, err)
+	_, err = a.UnaryServerInterceptor(context.Background(), newPayRequest(t),
+		&interceptor.UnaryServerInfo{FullMethod: "/pkg.Svc/Get"},
+		func(context.Context, any) (any, error) { return wrapperspb.String("ok"), nil })
+	require.NoError(t, err)
+
+	records := decodeRecords(t, &buf)
+	require.Len(t, records, 1, "only configured methods are audited")
+	rec := records[0]
+	assert.Equal(t, "unary", rec["type"])
+	assert.Equal(t, "/pkg.Svc/Pay", rec["method"])
+	assert.Equal(t, "PERMISSION_DENIED", rec["status"])
+	assert.Contains(t, rec, "latency_ms")
+	req := rec["request"].(map[string]any)
+	assert.Equal(t, "[redacted]", req["password"])
+	assert.Equal(t, "[redacted]", req["card"].(map[string]any)["number"])
+	assert.NotContains(t, rec, "response")
+}
+
+type testServerStream struct {
+	stream.ServerStream
+	ctx context.Context
+}
+
+func (s *testServerStream) Context() context.Context { return s.ctx }
+func (s *testServerStream) SendMsg(any) error        { return nil }
+func (s *testServerStream) RecvMsg(m any) error {
+	proto.Merge(m.(proto.Message), wrapperspb.String("in"))
+	return nil
+}
+
+func TestStreamServerInterceptor(t *testing.T) {
+	var buf bytes.Buffer
+	a := newAudit(mustLoadConfig(map[string]any{"methods": []string{"*"}}), &buf)
+	err := a.StreamServerInterceptor(nil, &testServerStream{ctx: context.Background()},
+		&interceptor.StreamServerInfo{FullMethod: "/pkg.Svc/Chat"},
+		func(_ any, ss stream.ServerStream) error {
+			in := &wrapperspb.StringValue{}
+			if err := ss.RecvMsg(in); err != nil {
+				return err
+			}
+			return ss.SendMsg(wrapperspb.String("out"))
+		})
+	require.NoError(t, err)
+
+	records := decodeRecords(t, &buf)
+	require.Len(t, records, 3)
+	assert.Equal(t, "recv", records[0]["direction"])
+	assert.Equal(t, "in", records[0]["message"])
+	assert.Equal(t, "send", records[1]["direction"])
+	assert.Equal(t, "out", records[1]["message"])
+	assert.Equal(t, "OK", records[2]["status"])
+	assert.NotContains(t, records[2], "direction")
+}
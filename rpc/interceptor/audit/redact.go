@@ -0,0 +1,159 @@
+// Copyright 2022 The codesjoy Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package audit
+
+import (
+	"encoding/json"
+	"strings"
+
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/known/emptypb"
+)
+
+// redactor masks sensitive fields of messages rendered as JSON.
+type redactor struct {
+	// names holds bare field names redacted wherever they appear.
+	names map[string]struct{}
+	// paths holds dotted field paths from the message root.
+	paths map[string]struct{}
+	mask  string
+}
+
+func newRedactor(fields []string, mask string) *redactor {
+	r := &redactor{names: map[string]struct{}{}, paths: map[string]struct{}{}, mask: mask}
+	for _, field := range fields {
+		if strings.Contains(field, ".") {
+			r.paths[field] = struct{}{}
+		} else {
+			r.names[field] = struct{}{}
+		}
+	}
+	return r
+}
+
+var marshalOptions = protojson.MarshalOptions{
+	UseProtoNames: true,
+	Resolver:      anyResolver{protoregistry.GlobalTypes},
+}
+
+// anyResolver resolves the types packed in Any from the global registry.
+// Unknown types render as empty messages, so the message still renders and
+// redact masks the Any as a whole.
+type anyResolver struct {
+	*protoregistry.Types
+}
+
+func (r anyResolver) FindMessageByURL(url string) (protoreflect.MessageType, error) {
+	if mt, err := r.Types.FindMessageByURL(url); err == nil {
+		return mt, nil
+	}
+	return (&emptypb.Empty{}).ProtoReflect().Type(), nil
+}
+
+// render returns the JSON form of m with the sensitive fields masked.
+func (r *redactor) render(m any) any {
+	msg, ok := m.(proto.Message)
+	if !ok || m == nil {
+		return nil
+	}
+	data, err := marshalOptions.Marshal(msg)
+	if err != nil {
+		return nil
+	}
+	var out any
+	if err := json.Unmarshal(data, &out); err != nil {
+		return nil
+	}
+	return r.redactValue(msg.ProtoReflect().Descriptor(), out, "")
+}
+
+const anyName protoreflect.FullName = "google.protobuf.Any"
+
+// redactValue redacts the JSON form of a desc message and returns it. The
+// message packed in an Any is redacted in place, or the whole Any is masked
+// when its type cannot be resolved.
+func (r *redactor) redactValue(desc protoreflect.MessageDescriptor, value any, prefix string) any {
+	obj, ok := value.(map[string]any)
+	if !ok {
+		return value
+	}
+	if desc.FullName() == anyName {
+		url, _ := obj["@type"].(string)
+		mt, err := protoregistry.GlobalTypes.FindMessageByURL(url)
+		if err != nil {
+			return r.mask
+		}
+		desc = mt.Descriptor()
+	}
+	r.redact(desc, obj, prefix)
+	return obj
+}
+
+func (r *redactor) redact(desc protoreflect.MessageDescriptor, obj map[string]any, prefix string) {
+	// Well-known types have special JSON forms without field names.
+	if desc.ParentFile().Package() == "google.protobuf" {
+		return
+	}
+	fields := desc.Fields()
+	for i := 0; i < fields.Len(); i++ {
+		field := fields.Get(i)
+		name := string(field.Name())
+		value, ok := obj[name]
+		if !ok {
+			continue
+		}
+		path := prefix + name
+		if r.sensitive(field, name, path) {
+			obj[name] = r.mask
+			continue
+		}
+		child := field.Message()
+		if field.IsMap() {
+			child = field.MapValue().Message()
+		}
+		if child == nil {
+			continue
+		}
+		switch v := value.(type) {
+		case map[string]any:
+			if !field.IsMap() {
+				obj[name] = r.redactValue(child, v, path+".")
+				continue
+			}
+			for key, item := range v {
+				v[key] = r.redactValue(child, item, path+".")
+			}
+		case []any:
+			for i, item := range v {
+				v[i] = r.redactValue(child, item, path+".")
+			}
+		}
+	}
+}
+
+func (r *redactor) sensitive(field protoreflect.FieldDescriptor, name, path string) bool {
+	if opts, ok := field.Options().(*descriptorpb.FieldOptions); ok && opts.GetDebugRedact() {
+		return true
+	}
+	if _, ok := r.names[name]; ok {
+		return true
+	}
+	_, ok := r.paths[path]
+	return ok
+}
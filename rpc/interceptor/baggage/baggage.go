@@ -0,0 +1,221 @@
+// Copyright 2022 The codesjoy Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package baggage propagates request-scoped values across service hops.
+//
+// Values are declared once as typed keys and stored in the context. The
+// client interceptors serialize every value into the single "baggage"
+// metadata entry, using the W3C baggage format, and the server interceptors
+// restore them, so values such as a tenant id or a debug flag flow through a
+// call chain without per-team headers.
+package baggage
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Metadata is the metadata key carrying the serialized baggage.
+const Metadata = "baggage"
+
+// Codec converts values of a key to and from their string form.
+type Codec[T any] struct {
+	Encode func(T) string
+	Decode func(string) (T, error)
+}
+
+// Key is a typed baggage entry. Declare keys once, usually as package level
+// variables, and use them to set and read values.
+type Key[T any] struct {
+	name  string
+	codec Codec[T]
+}
+
+// NewKey declares a key named name. The name must be a valid metadata token:
+// lowercase letters, digits and "-", "_" or ".". It panics otherwise.
+func NewKey[T any](name string, codec Codec[T]) Key[T] {
+	if !validName(name) {
+		panic(fmt.Sprintf("baggage: invalid key name %q", name))
+	}
+	if codec.Encode == nil || codec.Decode == nil {
+		panic(fmt.Sprintf("baggage: key %q has an incomplete codec", name))
+	}
+	return Key[T]{name: name, codec: codec}
+}
+
+// StringKey declares a key holding a string.
+func StringKey(name string) Key[string] {
+	return NewKey(name, Codec[string]{
+		Encode: func(v string) string { return v },
+		Decode: func(s string) (string, error) { return s, nil },
+	})
+}
+
+// BoolKey declares a key holding a bool.
+func BoolKey(name string) Key[bool] {
+	return NewKey(name, Codec[bool]{Encode: strconv.FormatBool, Decode: strconv.ParseBool})
+}
+
+// IntKey declares a key holding an int64.
+func IntKey(name string) Key[int64] {
+	return NewKey(name, Codec[int64]{
+		Encode: func(v int64) string { return strconv.FormatInt(v, 10) },
+		Decode: func(s string) (int64, error) { return strconv.ParseInt(s, 10, 64) },
+	})
+}
+
+// Name returns the name of the key.
+func (k Key[T]) Name() string { return k.name }
+
+// With returns a copy of ctx carrying value for the key.
+func (k Key[T]) With(ctx context.Context, value T) context.Context {
+	return withEntry(ctx, k.name, k.codec.Encode(value))
+}
+
+// From returns the value of the key carried by ctx. It reports false when
+// the key is absent or its value cannot be decoded.
+func (k Key[T]) From(ctx context.Context) (T, bool) {
+	var zero T
+	raw, ok := FromContext(ctx)[k.name]
+	if !ok {
+		return zero, false
+	}
+	value, err := k.codec.Decode(raw)
+	if err != nil {
+		return zero, false
+	}
+	return value, true
+}
+
+type bagKey struct{}
+
+// FromContext returns a copy of the raw entries carried by ctx.
+func FromContext(ctx context.Context) map[string]string {
+	bag, _ := ctx.Value(bagKey{}).(map[string]string)
+	return maps.Clone(bag)
+}
+
+// WithoutKey returns a copy of ctx without the entry named name.
+func WithoutKey(ctx context.Context, name string) context.Context {
+	bag, _ := ctx.Value(bagKey{}).(map[string]string)
+	if _, ok := bag[name]; !ok {
+		return ctx
+	}
+	next := maps.Clone(bag)
+	delete(next, name)
+	return context.WithValue(ctx, bagKey{}, next)
+}
+
+func withEntry(ctx context.Context, name, value string) context.Context {
+	bag, _ := ctx.Value(bagKey{}).(map[string]string)
+	next := make(map[string]string, len(bag)+1)
+	maps.Copy(next, bag)
+	next[name] = value
+	return context.WithValue(ctx, bagKey{}, next)
+}
+
+func withEntries(ctx context.Context, entries map[string]string) context.Context {
+	if len(entries) == 0 {
+		return ctx
+	}
+	bag, _ := ctx.Value(bagKey{}).(map[string]string)
+	next := make(map[string]string, len(bag)+len(entries))
+	maps.Copy(next, bag)
+	maps.Copy(next, entries)
+	return context.WithValue(ctx, bagKey{}, next)
+}
+
+func validName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for _, r := range name {
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9', r == '-', r == '_', r == '.':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// encode serializes the allowed entries in name order, dropping those that
+// would exceed the limits.
+func encode(bag map[string]string, l limits) string {
+	var b strings.Builder
+	count := 0
+	for _, name := range slices.Sorted(maps.Keys(bag)) {
+		if !l.allowed(name) || count == l.maxEntries {
+			continue
+		}
+		member := name + "=" + escape(bag[name])
+		size := len(member)
+		if b.Len() > 0 {
+			size++
+		}
+		if b.Len()+size > l.maxBytes {
+			continue
+		}
+		if b.Len() > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(member)
+		count++
+	}
+	return b.String()
+}
+
+// decode parses serialized baggage values. Later members override earlier
+// ones; malformed, disallowed and over-limit members are dropped.
+func decode(values []string, l limits) map[string]string {
+	out := map[string]string{}
+	size := 0
+	for _, value := range values {
+		for _, member := range strings.Split(value, ",") {
+			member = strings.TrimSpace(member)
+			if member == "" {
+				continue
+			}
+			size += len(member)
+			if size > l.maxBytes {
+				return out
+			}
+			// Properties are not supported and are ignored.
+			member, _, _ = strings.Cut(member, ";")
+			name, raw, ok := strings.Cut(member, "=")
+			name = strings.TrimSpace(name)
+			if !ok || !validName(name) || !l.allowed(name) {
+				continue
+			}
+			decoded, err := url.PathUnescape(strings.TrimSpace(raw))
+			if err != nil {
+				continue
+			}
+			if _, exists := out[name]; !exists && len(out) == l.maxEntries {
+				continue
+			}
+			out[name] = decoded
+		}
+	}
+	return out
+}
+
+func escape(value string) string {
+	return strings.ReplaceAll(url.QueryEscape(value), "+", "%20")
+}
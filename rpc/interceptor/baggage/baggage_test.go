@@ -0,0 +1,110 @@
+// Copyright 2022 The codesjoy Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package baggage
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var (
+	tenantKey = StringKey("tenant-id")
+	debugKey  = BoolKey("debug")
+	levelKey  = IntKey("level")
+)
+
+func TestKeys(t *testing.T) {
+	ctx := tenantKey.With(context.Background(), "acme")
+	ctx = debugKey.With(ctx, true)
+	ctx = levelKey.With(ctx, 3)
+
+	tenant, ok := tenantKey.From(ctx)
+	assert.True(t, ok)
+	assert.Equal(t, "acme", tenant)
+	debug, ok := debugKey.From(ctx)
+	assert.True(t, ok)
+	assert.True(t, debug)
+	level, ok := levelKey.From(ctx)
+	assert.True(t, ok)
+	assert.Equal(t, int64(3), level)
+	assert.Equal(t,
+		map[string]string{"tenant-id": "acme", "debug": "true", "level": "3"},
+		FromContext(ctx),
+	)
+
+	ctx = WithoutKey(ctx, "debug")
+	_, ok = debugKey.From(ctx)
+	assert.False(t, ok)
+	_, ok = tenantKey.From(context.Background())
+	assert.False(t, ok)
+
+	// Undecodable values are reported as absent.
+	ctx = withEntry(ctx, "level", "high")
+	_, ok = levelKey.From(ctx)
+	assert.False(t, ok)
+}
+
+func TestNewKeyValidatesName(t *testing.T) {
+	assert.Panics(t, func() { StringKey("Tenant") })
+	assert.Panics(t, func() { StringKey("") })
+	assert.Panics(t, func() { StringKey("a=b") })
+	assert.Panics(t, func() {
+		NewKey("custom", Codec[error]{Encode: func(err error) string { return err.Error() }})
+	})
+	assert.NotPanics(t, func() {
+		NewKey("custom", Codec[error]{
+			Encode: func(err error) string { return err.Error() },
+			Decode: func(s string) (error, error) { return errors.New(s), nil },
+		})
+	})
+}
+
+func TestEncodeDecode(t *testing.T) {
+	l := limits{maxEntries: 32, maxBytes: 4096}
+	bag := map[string]string{"tenant-id": "acme corp", "locale": "zh-CN,en", "x": "a=b;c"}
+	encoded := encode(bag, l)
+	assert.Equal(t, "locale=zh-CN%2Cen,tenant-id=acme%20corp,x=a%3Db%3Bc", encoded)
+	assert.Equal(t, bag, decode([]string{encoded}, l))
+
+	// Later members win, properties are ignored and malformed members are
+	// dropped.
+	assert.Equal(t,
+		map[string]string{"a": "2", "b": "x"},
+		decode([]string{"a=1, b=x;prop=1", "a=2,Bad=3,novalue,c=%zz"}, l),
+	)
+}
+
+func TestLimits(t *testing.T) {
+	bag := map[string]string{"a": "1", "b": "2", "c": "3"}
+
+	l := limits{maxEntries: 2, maxBytes: 4096}
+	assert.Equal(t, "a=1,b=2", encode(bag, l))
+	assert.Equal(t, map[string]string{"a": "1", "b": "2"}, decode([]string{"a=1,b=2,c=3"}, l))
+
+	l = limits{maxEntries: 32, maxBytes: 8}
+	assert.Equal(t, "a=1,b=2", encode(bag, l))
+	assert.Equal(t,
+		map[string]string{"a": "1"},
+		decode([]string{"a=1," + strings.Repeat("b", 9)}, l),
+	)
+
+	l = newLimits(Config{Allow: []string{"b"}, MaxEntries: 32, MaxBytes: 4096})
+	assert.Equal(t, "b=2", encode(bag, l))
+	assert.Equal(t, map[string]string{"b": "2"}, decode([]string{"a=1,b=2,c=3"}, l))
+}
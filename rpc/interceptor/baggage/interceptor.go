@@ -0,0 +1,236 @@
+// Copyright 2022 The codesjoy Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package baggage
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/codesjoy/yggdrasil/v3/config"
+	"github.com/codesjoy/yggdrasil/v3/rpc/interceptor"
+	"github.com/codesjoy/yggdrasil/v3/rpc/metadata"
+	"github.com/codesjoy/yggdrasil/v3/rpc/stream"
+)
+
+const name = "baggage"
+
+// Config defines the baggage interceptor configuration.
+type Config struct {
+	// Allow lists the entry names sent to servers and accepted from callers.
+	// Every entry is propagated when it is empty.
+	Allow []string `mapstructure:"allow"`
+	// MaxEntries bounds the number of propagated entries.
+	MaxEntries int `mapstructure:"max_entries" default:"32"`
+	// MaxBytes bounds the size of the serialized baggage.
+	MaxBytes int `mapstructure:"max_bytes" default:"4096"`
+}
+
+type limits struct {
+	allow      map[string]struct{}
+	maxEntries int
+	maxBytes   int
+}
+
+func (l limits) allowed(name string) bool {
+	if len(l.allow) == 0 {
+		return true
+	}
+	_, ok := l.allow[name]
+	return ok
+}
+
+func newLimits(cfg Config) limits {
+	l := limits{maxEntries: cfg.MaxEntries, maxBytes: cfg.MaxBytes}
+	if len(cfg.Allow) > 0 {
+		l.allow = make(map[string]struct{}, len(cfg.Allow))
+		for _, name := range cfg.Allow {
+			l.allow[name] = struct{}{}
+		}
+	}
+	return l
+}
+
+func mustLoadConfig(source any) Config {
+	cfg := Config{}
+	if err := config.NewSnapshot(source).Decode(&cfg); err != nil {
+		panic(fmt.Sprintf("load baggage interceptor config: %v", err))
+	}
+	return cfg
+}
+
+// BuiltinUnaryClientProvider returns the baggage unary client interceptor provider.
+func BuiltinUnaryClientProvider() interceptor.UnaryClientInterceptorProvider {
+	return BuiltinUnaryClientProviderWithConfig(nil)
+}
+
+// BuiltinUnaryClientProviderWithConfig returns the baggage unary client
+// interceptor provider bound to explicit config.
+func BuiltinUnaryClientProviderWithConfig(
+	source any,
+) interceptor.UnaryClientInterceptorProvider {
+	cfg := mustLoadConfig(source)
+	return interceptor.NewUnaryClientInterceptorProvider(
+		name,
+		func(string) interceptor.UnaryClientInterceptor {
+			return UnaryClientInterceptor(cfg)
+		},
+	)
+}
+
+// BuiltinStreamClientProvider returns the baggage stream client interceptor provider.
+func BuiltinStreamClientProvider() interceptor.StreamClientInterceptorProvider {
+	return BuiltinStreamClientProviderWithConfig(nil)
+}
+
+// BuiltinStreamClientProviderWithConfig returns the baggage stream client
+// interceptor provider bound to explicit config.
+func BuiltinStreamClientProviderWithConfig(
+	source any,
+) interceptor.StreamClientInterceptorProvider {
+	cfg := mustLoadConfig(source)
+	return interceptor.NewStreamClientInterceptorProvider(
+		name,
+		func(string) interceptor.StreamClientInterceptor {
+			return StreamClientInterceptor(cfg)
+		},
+	)
+}
+
+// BuiltinUnaryServerProvider returns the baggage unary server interceptor provider.
+func BuiltinUnaryServerProvider() interceptor.UnaryServerInterceptorProvider {
+	return BuiltinUnaryServerProviderWithConfig(nil)
+}
+
+// BuiltinUnaryServerProviderWithConfig returns the baggage unary server
+// interceptor provider bound to explicit config.
+func BuiltinUnaryServerProviderWithConfig(
+	source any,
+) interceptor.UnaryServerInterceptorProvider {
+	cfg := mustLoadConfig(source)
+	return interceptor.NewUnaryServerInterceptorProvider(
+		name,
+		func() interceptor.UnaryServerInterceptor {
+			return UnaryServerInterceptor(cfg)
+		},
+	)
+}
+
+// BuiltinStreamServerProvider returns the baggage stream server interceptor provider.
+func BuiltinStreamServerProvider() interceptor.StreamServerInterceptorProvider {
+	return BuiltinStreamServerProviderWithConfig(nil)
+}
+
+// BuiltinStreamServerProviderWithConfig returns the baggage stream server
+// interceptor provider bound to explicit config.
+func BuiltinStreamServerProviderWithConfig(
+	source any,
+) interceptor.StreamServerInterceptorProvider {
+	cfg := mustLoadConfig(source)
+	return interceptor.NewStreamServerInterceptorProvider(
+		name,
+		func() interceptor.StreamServerInterceptor {
+			return StreamServerInterceptor(cfg)
+		},
+	)
+}
+
+// UnaryClientInterceptor attaches the context baggage to outgoing calls.
+func UnaryClientInterceptor(cfg Config) interceptor.UnaryClientInterceptor {
+	l := newLimits(cfg)
+	return func(
+		ctx context.Context,
+		method string,
+		req, reply any,
+		invoker interceptor.UnaryInvoker,
+	) error {
+		return invoker(outgoing(ctx, l), method, req, reply)
+	}
+}
+
+// StreamClientInterceptor attaches the context baggage to outgoing streams.
+func StreamClientInterceptor(cfg Config) interceptor.StreamClientInterceptor {
+	l := newLimits(cfg)
+	return func(
+		ctx context.Context,
+		desc *stream.Desc,
+		method string,
+		streamer interceptor.Streamer,
+	) (stream.ClientStream, error) {
+		return streamer(outgoing(ctx, l), desc, method)
+	}
+}
+
+// UnaryServerInterceptor restores the baggage sent by callers.
+func UnaryServerInterceptor(cfg Config) interceptor.UnaryServerInterceptor {
+	l := newLimits(cfg)
+	return func(
+		ctx context.Context,
+		req any,
+		_ *interceptor.UnaryServerInfo,
+		handler interceptor.UnaryHandler,
+	) (any, error) {
+		return handler(incoming(ctx, l), req)
+	}
+}
+
+// StreamServerInterceptor restores the baggage sent by callers.
+func StreamServerInterceptor(cfg Config) interceptor.StreamServerInterceptor {
+	l := newLimits(cfg)
+	return func(
+		srv any,
+		ss stream.ServerStream,
+		_ *interceptor.StreamServerInfo,
+		handler stream.Handler,
+	) error {
+		ctx := incoming(ss.Context(), l)
+		if ctx == ss.Context() {
+			return handler(srv, ss)
+		}
+		return handler(srv, &serverStream{ServerStream: ss, ctx: ctx})
+	}
+}
+
+type serverStream struct {
+	stream.ServerStream
+	ctx context.Context
+}
+
+func (ss *serverStream) Context() context.Context {
+	return ss.ctx
+}
+
+func outgoing(ctx context.Context, l limits) context.Context {
+	bag, _ := ctx.Value(bagKey{}).(map[string]string)
+	if len(bag) == 0 {
+		return ctx
+	}
+	value := encode(bag, l)
+	if value == "" {
+		return ctx
+	}
+	return metadata.WithOutContext(ctx, metadata.Pairs(Metadata, value))
+}
+
+func incoming(ctx context.Context, l limits) context.Context {
+	md, ok := metadata.FromInContext(ctx)
+	if !ok {
+		return ctx
+	}
+	values := md.Get(Metadata)
+	if len(values) == 0 {
+		return ctx
+	}
+	return withEntries(ctx, decode(values, l))
+}
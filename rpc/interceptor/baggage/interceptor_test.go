@@ -0,0 +1,111 @@
+// Copyright 2022 The codesjoy Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package baggage
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/codesjoy/yggdrasil/v3/rpc/interceptor"
+	"github.com/codesjoy/yggdrasil/v3/rpc/metadata"
+	"github.com/codesjoy/yggdrasil/v3/rpc/stream"
+)
+
+func TestBuiltinProvidersUseDefaults(t *testing.T) {
+	assert.Equal(t, "baggage", BuiltinUnaryClientProvider().Name())
+	assert.Equal(t, "baggage", BuiltinStreamClientProvider().Name())
+	assert.Equal(t, "baggage", BuiltinUnaryServerProvider().Name())
+	assert.Equal(t, "baggage", BuiltinStreamServerProvider().Name())
+
+	cfg := mustLoadConfig(nil)
+	assert.Equal(t, 32, cfg.MaxEntries)
+	assert.Equal(t, 4096, cfg.MaxBytes)
+	cfg = mustLoadConfig(map[string]any{"allow": []string{"tenant-id"}, "max_bytes": 128})
+	assert.Equal(t, []string{"tenant-id"}, cfg.Allow)
+	assert.Equal(t, 128, cfg.MaxBytes)
+}
+
+func TestPropagatesAcrossHops(t *testing.T) {
+	cfg := mustLoadConfig(nil)
+	ctx := tenantKey.With(context.Background(), "acme")
+	ctx = debugKey.With(ctx, true)
+
+	var sent metadata.MD
+	err := UnaryClientInterceptor(cfg)(ctx, "/svc/Get", nil, nil,
+		func(ctx context.Context, _ string, _, _ any) error {
+			sent, _ = metadata.FromOutContext(ctx)
+			return nil
+		})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"debug=true,tenant-id=acme"}, sent.Get(Metadata))
+
+	serverCtx := metadata.WithInContext(context.Background(), sent)
+	_, err = UnaryServerInterceptor(cfg)(serverCtx, nil,
+		&interceptor.UnaryServerInfo{FullMethod: "/svc/Get"},
+		func(ctx context.Context, _ any) (any, error) {
+			tenant, ok := tenantKey.From(ctx)
+			assert.True(t, ok)
+			assert.Equal(t, "acme", tenant)
+			debug, _ := debugKey.From(ctx)
+			assert.True(t, debug)
+			return nil, nil
+		})
+	require.NoError(t, err)
+}
+
+func TestUnaryClientInterceptorSkipsEmptyBaggage(t *testing.T) {
+	err := UnaryClientInterceptor(mustLoadConfig(nil))(context.Background(), "/svc/Get", nil, nil,
+		func(ctx context.Context, _ string, _, _ any) error {
+			_, ok := metadata.FromOutContext(ctx)
+			assert.False(t, ok)
+			return nil
+		})
+	require.NoError(t, err)
+}
+
+type testServerStream struct {
+	stream.ServerStream
+	ctx context.Context
+}
+
+func (s *testServerStream) Context() context.Context { return s.ctx }
+
+func TestStreamInterceptors(t *testing.T) {
+	cfg := Config{Allow: []string{"tenant-id"}, MaxEntries: 32, MaxBytes: 4096}
+	ctx := tenantKey.With(context.Background(), "acme")
+	ctx = debugKey.With(ctx, true)
+
+	var sent metadata.MD
+	_, err := StreamClientInterceptor(cfg)(ctx, &stream.Desc{}, "/svc/Watch",
+		func(ctx context.Context, _ *stream.Desc, _ string) (stream.ClientStream, error) {
+			sent, _ = metadata.FromOutContext(ctx)
+			return nil, nil
+		})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"tenant-id=acme"}, sent.Get(Metadata))
+
+	inCtx := metadata.WithInContext(context.Background(),
+		metadata.Pairs(Metadata, "tenant-id=acme,debug=true"))
+	err = StreamServerInterceptor(cfg)(nil, &testServerStream{ctx: inCtx},
+		&interceptor.StreamServerInfo{FullMethod: "/svc/Watch"},
+		func(_ any, ss stream.ServerStream) error {
+			assert.Equal(t, map[string]string{"tenant-id": "acme"}, FromContext(ss.Context()))
+			return nil
+		})
+	require.NoError(t, err)
+}
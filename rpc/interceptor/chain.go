@@ -0,0 +1,249 @@
+// Copyright 2022 The codesjoy Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package interceptor
+
+import (
+	"context"
+	"path"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/codesjoy/yggdrasil/v3/rpc/stream"
+)
+
+// ChainRule changes the interceptor chain of the methods it matches.
+//
+// Method patterns use path.Match syntax on full method names. "*" matches
+// every method, "/pkg.Service/*" every method of one service and
+// "/pkg.Service/Method" a single method.
+type ChainRule struct {
+	// Methods are the patterns the rule applies to. Empty matches every method.
+	Methods []string `mapstructure:"methods"`
+	// ExcludeMethods are patterns the rule never applies to.
+	ExcludeMethods []string `mapstructure:"exclude_methods"`
+	// Chain, when set, replaces the chain resolved so far and fixes its order.
+	Chain []string `mapstructure:"chain"`
+	// Append adds interceptors to the end of the chain if not present yet.
+	Append []string `mapstructure:"append"`
+	// Remove drops interceptors from the chain.
+	Remove []string `mapstructure:"remove"`
+}
+
+const (
+	scopeGlobal = iota
+	scopeService
+	scopeMethod
+)
+
+// match reports whether the rule applies to method and how specific the
+// matching pattern is.
+func (r ChainRule) match(method string) (int, bool) {
+	for _, pattern := range r.ExcludeMethods {
+		if matchMethodPattern(pattern, method) {
+			return 0, false
+		}
+	}
+	if len(r.Methods) == 0 {
+		return scopeGlobal, true
+	}
+	scope, found := scopeGlobal, false
+	for _, pattern := range r.Methods {
+		if !matchMethodPattern(pattern, method) {
+			continue
+		}
+		found = true
+		scope = max(scope, patternScope(pattern))
+	}
+	return scope, found
+}
+
+func matchMethodPattern(pattern, method string) bool {
+	if pattern == "*" || pattern == method {
+		return true
+	}
+	ok, err := path.Match(pattern, method)
+	return err == nil && ok
+}
+
+func patternScope(pattern string) int {
+	switch {
+	case !strings.ContainsAny(pattern, "*?["):
+		return scopeMethod
+	case pattern == "*":
+		return scopeGlobal
+	default:
+		return scopeService
+	}
+}
+
+// ChainResolver resolves the interceptor names of one method from a base
+// chain and a list of rules. Matching rules are applied from the least to
+// the most specific scope (global, service, method) and in declaration
+// order within one scope.
+type ChainResolver struct {
+	base  []string
+	rules []ChainRule
+}
+
+// NewChainResolver returns a resolver for base and rules.
+func NewChainResolver(base []string, rules []ChainRule) *ChainResolver {
+	return &ChainResolver{
+		base:  dedupNames(base),
+		rules: slices.Clone(rules),
+	}
+}
+
+// HasRules reports whether any rule may change the base chain.
+func (r *ChainResolver) HasRules() bool {
+	return r != nil && len(r.rules) > 0
+}
+
+// Resolve returns the interceptor names applied to method. It does not build
+// any interceptor and can be used to inspect the effective chain.
+func (r *ChainResolver) Resolve(method string) []string {
+	if r == nil {
+		return nil
+	}
+	type matched struct {
+		scope int
+		index int
+	}
+	var hits []matched
+	for i, rule := range r.rules {
+		if scope, ok := rule.match(method); ok {
+			hits = append(hits, matched{scope: scope, index: i})
+		}
+	}
+	sort.SliceStable(hits, func(i, j int) bool { return hits[i].scope < hits[j].scope })
+
+	names := slices.Clone(r.base)
+	for _, hit := range hits {
+		rule := r.rules[hit.index]
+		if rule.Chain != nil {
+			names = dedupNames(rule.Chain)
+		}
+		for _, name := range rule.Append {
+			if name != "" && !slices.Contains(names, name) {
+				names = append(names, name)
+			}
+		}
+		if len(rule.Remove) > 0 {
+			names = slices.DeleteFunc(names, func(name string) bool {
+				return slices.Contains(rule.Remove, name)
+			})
+		}
+	}
+	return names
+}
+
+func dedupNames(names []string) []string {
+	out := make([]string, 0, len(names))
+	for _, name := range names {
+		if name != "" && !slices.Contains(out, name) {
+			out = append(out, name)
+		}
+	}
+	return out
+}
+
+// methodChains caches one built chain per distinct name list and remembers
+// which list every method resolved to.
+type methodChains[T any] struct {
+	resolver *ChainResolver
+	build    func(names []string) T
+
+	mu      sync.RWMutex
+	methods map[string]T
+	chains  map[string]T
+}
+
+func newMethodChains[T any](resolver *ChainResolver, build func([]string) T) *methodChains[T] {
+	return &methodChains[T]{
+		resolver: resolver,
+		build:    build,
+		methods:  map[string]T{},
+		chains:   map[string]T{},
+	}
+}
+
+func (c *methodChains[T]) get(method string) T {
+	c.mu.RLock()
+	chain, ok := c.methods[method]
+	c.mu.RUnlock()
+	if ok {
+		return chain
+	}
+	names := c.resolver.Resolve(method)
+	key := strings.Join(names, "\x00")
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if chain, ok = c.methods[method]; ok {
+		return chain
+	}
+	if chain, ok = c.chains[key]; !ok {
+		chain = c.build(names)
+		c.chains[key] = chain
+	}
+	c.methods[method] = chain
+	return chain
+}
+
+// ScopedUnaryServerInterceptor returns an interceptor that runs the chain
+// resolved for each method. Chains are built on first use through build.
+func ScopedUnaryServerInterceptor(
+	resolver *ChainResolver,
+	build func(names []string) UnaryServerInterceptor,
+) UnaryServerInterceptor {
+	chains := newMethodChains(resolver, build)
+	return func(ctx context.Context, req any, info *UnaryServerInfo, handler UnaryHandler) (any, error) {
+		return chains.get(info.FullMethod)(ctx, req, info, handler)
+	}
+}
+
+// ScopedStreamServerInterceptor is the stream variant of ScopedUnaryServerInterceptor.
+func ScopedStreamServerInterceptor(
+	resolver *ChainResolver,
+	build func(names []string) StreamServerInterceptor,
+) StreamServerInterceptor {
+	chains := newMethodChains(resolver, build)
+	return func(srv any, ss stream.ServerStream, info *StreamServerInfo, handler stream.Handler) error {
+		return chains.get(info.FullMethod)(srv, ss, info, handler)
+	}
+}
+
+// ScopedUnaryClientInterceptor is the unary client variant of ScopedUnaryServerInterceptor.
+func ScopedUnaryClientInterceptor(
+	resolver *ChainResolver,
+	build func(names []string) UnaryClientInterceptor,
+) UnaryClientInterceptor {
+	chains := newMethodChains(resolver, build)
+	return func(ctx context.Context, method string, req, reply any, invoker UnaryInvoker) error {
+		return chains.get(method)(ctx, method, req, reply, invoker)
+	}
+}
+
+// ScopedStreamClientInterceptor is the stream client variant of ScopedUnaryServerInterceptor.
+func ScopedStreamClientInterceptor(
+	resolver *ChainResolver,
+	build func(names []string) StreamClientInterceptor,
+) StreamClientInterceptor {
+	chains := newMethodChains(resolver, build)
+	return func(ctx context.Context, desc *stream.Desc, method string, streamer Streamer) (stream.ClientStream, error) {
+		return chains.get(method)(ctx, desc, method, streamer)
+	}
+}
@@ -0,0 +1,127 @@
+// Copyright 2022 The codesjoy Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package interceptor
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestChainResolver_Resolve(t *testing.T) {
+	resolver := NewChainResolver(
+		[]string{"logging", "recovery", "logging"},
+		[]ChainRule{
+			{
+				Methods: []string{"/library.v1.LibraryService/GetBook"},
+				Append:  []string{"cache"},
+			},
+			{
+				Methods: []string{"/library.v1.LibraryService/*"},
+				Append:  []string{"auth", "audit"},
+			},
+			{
+				Methods:        []string{"*"},
+				ExcludeMethods: []string{"/grpc.health.v1.Health/*"},
+				Append:         []string{"metrics"},
+			},
+			{
+				Methods: []string{"/grpc.health.v1.Health/*"},
+				Remove:  []string{"logging"},
+			},
+			{
+				Methods: []string{"/library.v1.LibraryService/MoveBook"},
+				Chain:   []string{"recovery", "auth"},
+				Remove:  []string{"auth"},
+			},
+		},
+	)
+	require.True(t, resolver.HasRules())
+
+	assert.Equal(
+		t,
+		[]string{"logging", "recovery", "metrics", "auth", "audit", "cache"},
+		resolver.Resolve("/library.v1.LibraryService/GetBook"),
+	)
+	assert.Equal(
+		t,
+		[]string{"recovery"},
+		resolver.Resolve("/library.v1.LibraryService/MoveBook"),
+	)
+	assert.Equal(t, []string{"recovery"}, resolver.Resolve("/grpc.health.v1.Health/Check"))
+	assert.Equal(t, []string{"logging", "recovery", "metrics"}, resolver.Resolve("/other.Svc/Do"))
+}
+
+func TestChainResolver_NoRules(t *testing.T) {
+	resolver := NewChainResolver([]string{"a", "", "b"}, nil)
+	assert.False(t, resolver.HasRules())
+	assert.Equal(t, []string{"a", "b"}, resolver.Resolve("/svc/M"))
+
+	var nilResolver *ChainResolver
+	assert.False(t, nilResolver.HasRules())
+	assert.Nil(t, nilResolver.Resolve("/svc/M"))
+}
+
+func TestScopedUnaryServerInterceptor_BuildsChainPerDistinctNames(t *testing.T) {
+	var built [][]string
+	var calls []string
+	resolver := NewChainResolver([]string{"a"}, []ChainRule{
+		{Methods: []string{"/svc/Special"}, Append: []string{"b"}},
+	})
+	scoped := ScopedUnaryServerInterceptor(
+		resolver,
+		func(names []string) UnaryServerInterceptor {
+			built = append(built, names)
+			return func(ctx context.Context, req any, _ *UnaryServerInfo, handler UnaryHandler) (any, error) {
+				calls = append(calls, names...)
+				return handler(ctx, req)
+			}
+		},
+	)
+	handler := func(context.Context, any) (any, error) { return "ok", nil }
+
+	for _, method := range []string{"/svc/A", "/svc/B", "/svc/Special", "/svc/A"} {
+		resp, err := scoped(
+			context.Background(),
+			nil,
+			&UnaryServerInfo{FullMethod: method},
+			handler,
+		)
+		require.NoError(t, err)
+		assert.Equal(t, "ok", resp)
+	}
+	assert.Equal(t, [][]string{{"a"}, {"a", "b"}}, built)
+	assert.Equal(t, []string{"a", "a", "a", "b", "a"}, calls)
+}
+
+func TestScopedUnaryClientInterceptor_UsesMethod(t *testing.T) {
+	var chains []string
+	scoped := ScopedUnaryClientInterceptor(
+		NewChainResolver(nil, []ChainRule{{Methods: []string{"/svc/*"}, Chain: []string{"x"}}}),
+		func(names []string) UnaryClientInterceptor {
+			return func(ctx context.Context, method string, req, reply any, invoker UnaryInvoker) error {
+				chains = append(chains, method+":"+strings.Join(names, ","))
+				return invoker(ctx, method, req, reply)
+			}
+		},
+	)
+	invoker := func(context.Context, string, any, any) error { return nil }
+	require.NoError(t, scoped(context.Background(), "/svc/M", nil, nil, invoker))
+	require.NoError(t, scoped(context.Background(), "/other/M", nil, nil, invoker))
+	assert.Equal(t, []string{"/svc/M:x", "/other/M:"}, chains)
+}
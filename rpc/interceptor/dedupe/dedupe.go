@@ -0,0 +1,344 @@
+// Copyright 2022 The codesjoy Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package dedupe drops duplicate messages for at-least-once streaming
+// consumers. When a stream is re-established after a reconnect and the
+// upstream re-sends what it could not confirm, messages whose ID was
+// already handled within a TTL window are skipped by RecvMsg. A message
+// counts as handled once the next one is requested or, on the server, once
+// the handler returns without an error.
+//
+// Window is the underlying helper and can be used on its own; the stream
+// interceptors take the ID from a field of each message.
+package dedupe
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+
+	"google.golang.org/genproto/googleapis/rpc/code"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+
+	"github.com/codesjoy/yggdrasil/v3/config"
+	"github.com/codesjoy/yggdrasil/v3/rpc/interceptor"
+	"github.com/codesjoy/yggdrasil/v3/rpc/metadata"
+	"github.com/codesjoy/yggdrasil/v3/rpc/status"
+	"github.com/codesjoy/yggdrasil/v3/rpc/stream"
+)
+
+const name = "dedupe"
+
+// Config defines the dedupe interceptor configuration.
+type Config struct {
+	// Field is the dotted path of the message field holding the message ID,
+	// e.g. "id" or "header.event_id". Empty disables the interceptor.
+	Field string `mapstructure:"field"`
+	// Header is the metadata key whose value scopes the IDs, e.g. a
+	// producer or subscription ID, so equal IDs of different scopes are
+	// kept apart. The server reads incoming metadata, the client outgoing.
+	Header string `mapstructure:"header"`
+	// TTL is how long a handled ID is remembered.
+	TTL time.Duration `mapstructure:"ttl" default:"10m"`
+	// Store names the ID store: "memory" or a store registered with
+	// RegisterStore.
+	Store string `mapstructure:"store" default:"memory"`
+	// MaxEntries bounds the memory store.
+	MaxEntries int `mapstructure:"max_entries" default:"10000"`
+	// Methods limits the interceptor to methods by full name
+	// ("/pkg.Service/Method") or bare name ("Method"). Empty selects all.
+	Methods []string `mapstructure:"methods"`
+}
+
+// BuiltinStreamServerProvider returns the dedupe stream server interceptor
+// provider.
+func BuiltinStreamServerProvider() interceptor.StreamServerInterceptorProvider {
+	return BuiltinStreamServerProviderWithConfig(nil)
+}
+
+// BuiltinStreamServerProviderWithConfig returns the dedupe stream server
+// interceptor provider bound to explicit config.
+func BuiltinStreamServerProviderWithConfig(
+	source any,
+) interceptor.StreamServerInterceptorProvider {
+	d := newDedupe(mustLoadConfig(source), nil)
+	return interceptor.NewStreamServerInterceptorProvider(
+		name,
+		func() interceptor.StreamServerInterceptor {
+			return d.StreamServerInterceptor
+		},
+	)
+}
+
+// BuiltinStreamClientProvider returns the dedupe stream client interceptor
+// provider.
+func BuiltinStreamClientProvider() interceptor.StreamClientInterceptorProvider {
+	return BuiltinStreamClientProviderWithConfig(nil)
+}
+
+// BuiltinStreamClientProviderWithConfig returns the dedupe stream client
+// interceptor provider bound to explicit config.
+func BuiltinStreamClientProviderWithConfig(
+	source any,
+) interceptor.StreamClientInterceptorProvider {
+	d := newDedupe(mustLoadConfig(source), nil)
+	return interceptor.NewStreamClientInterceptorProvider(
+		name,
+		func(string) interceptor.StreamClientInterceptor {
+			return d.StreamClientInterceptor
+		},
+	)
+}
+
+func mustLoadConfig(source any) *Config {
+	cfg := Config{}
+	if err := config.NewSnapshot(source).Decode(&cfg); err != nil {
+		panic(fmt.Sprintf("load dedupe interceptor config: %v", err))
+	}
+	cfg.Header = strings.ToLower(cfg.Header)
+	return &cfg
+}
+
+type dedupe struct {
+	cfg  *Config
+	path []string
+
+	once   sync.Once
+	store  Store
+	window *Window
+}
+
+func newDedupe(cfg *Config, store Store) *dedupe {
+	d := &dedupe{cfg: cfg, store: store}
+	if cfg.Field != "" {
+		d.path = strings.Split(cfg.Field, ".")
+	}
+	return d
+}
+
+// resolveWindow looks the store up on first use so stores registered after
+// the runtime is assembled are still picked up.
+func (d *dedupe) resolveWindow() *Window {
+	d.once.Do(func() {
+		store := d.store
+		if store == nil {
+			if d.cfg.Store == "" || d.cfg.Store == MemoryStoreName {
+				store = NewMemoryStore(d.cfg.MaxEntries)
+			} else {
+				store = GetStore(d.cfg.Store)
+			}
+		}
+		if store != nil {
+			d.window = NewWindow(store, d.cfg.TTL)
+		}
+	})
+	return d.window
+}
+
+func (d *dedupe) eligible(method string) bool {
+	if d.path == nil {
+		return false
+	}
+	if len(d.cfg.Methods) == 0 {
+		return true
+	}
+	bare := method[strings.LastIndex(method, "/")+1:]
+	for _, item := range d.cfg.Methods {
+		if item == method || item == bare {
+			return true
+		}
+	}
+	return false
+}
+
+func (d *dedupe) scope(md metadata.MD, ok bool) string {
+	if d.cfg.Header == "" || !ok {
+		return ""
+	}
+	if values := md.Get(d.cfg.Header); len(values) > 0 {
+		return strings.TrimSpace(values[0])
+	}
+	return ""
+}
+
+func (d *dedupe) receiver(method, scope string) (*receiver, error) {
+	window := d.resolveWindow()
+	if window == nil {
+		return nil, status.New(
+			code.Code_INTERNAL,
+			fmt.Sprintf("dedupe store %q is not registered", d.cfg.Store),
+		).Err()
+	}
+	return &receiver{
+		window: window,
+		path:   d.path,
+		method: method,
+		prefix: method + "|" + scope + "|",
+	}, nil
+}
+
+// StreamServerInterceptor drops duplicate messages received from clients.
+func (d *dedupe) StreamServerInterceptor(
+	srv any,
+	ss stream.ServerStream,
+	info *interceptor.StreamServerInfo,
+	handler stream.Handler,
+) error {
+	if !info.IsClientStream || !d.eligible(info.FullMethod) {
+		return handler(srv, ss)
+	}
+	md, ok := metadata.FromInContext(ss.Context())
+	r, err := d.receiver(info.FullMethod, d.scope(md, ok))
+	if err != nil {
+		return err
+	}
+	err = handler(srv, &serverStream{ServerStream: ss, r: r})
+	if err != nil {
+		r.release(ss.Context())
+	}
+	return err
+}
+
+// StreamClientInterceptor drops duplicate messages received from servers.
+func (d *dedupe) StreamClientInterceptor(
+	ctx context.Context,
+	desc *stream.Desc,
+	method string,
+	streamer interceptor.Streamer,
+) (stream.ClientStream, error) {
+	if !desc.ServerStreams || !d.eligible(method) {
+		return streamer(ctx, desc, method)
+	}
+	md, ok := metadata.FromOutContext(ctx)
+	r, err := d.receiver(method, d.scope(md, ok))
+	if err != nil {
+		return nil, err
+	}
+	cs, err := streamer(ctx, desc, method)
+	if err != nil {
+		return nil, err
+	}
+	return &clientStream{ClientStream: cs, ctx: ctx, r: r}, nil
+}
+
+// receiver filters the messages of one stream.
+type receiver struct {
+	window *Window
+	path   []string
+	method string
+	prefix string
+	// pending is the ID of the message delivered last. It is reserved when
+	// the message is delivered, so a concurrent duplicate delivery is
+	// dropped, and released when the server handler fails, so the message
+	// is accepted when re-sent.
+	pending string
+}
+
+// recv calls next until it yields a message not delivered before. Store
+// failures let the message through, since dropping it could lose it for good.
+func (r *receiver) recv(ctx context.Context, m any, next func(any) error) error {
+	r.pending = ""
+	for {
+		if err := next(m); err != nil {
+			return err
+		}
+		id := messageID(m, r.path)
+		if id == "" {
+			return nil
+		}
+		dup, err := r.window.Duplicate(ctx, r.prefix+id)
+		if err != nil {
+			slog.Warn("failed to check message id",
+				slog.String("method", r.method), slog.Any("error", err))
+			return nil
+		}
+		if !dup {
+			r.pending = id
+			return nil
+		}
+		slog.Debug("dropped duplicate message",
+			slog.String("method", r.method), slog.String("id", id))
+	}
+}
+
+// release forgets the reservation of the message delivered last.
+func (r *receiver) release(ctx context.Context) {
+	if r.pending == "" {
+		return
+	}
+	id := r.pending
+	r.pending = ""
+	if err := r.window.Release(ctx, r.prefix+id); err != nil {
+		slog.Warn("failed to release message id",
+			slog.String("method", r.method), slog.Any("error", err))
+	}
+}
+
+type serverStream struct {
+	stream.ServerStream
+	r *receiver
+}
+
+func (ss *serverStream) RecvMsg(m any) error {
+	return ss.r.recv(ss.Context(), m, ss.ServerStream.RecvMsg)
+}
+
+type clientStream struct {
+	stream.ClientStream
+	// ctx is the call context; ClientStream.Context must not be called
+	// before the first message arrived.
+	ctx context.Context
+	r   *receiver
+}
+
+func (cs *clientStream) RecvMsg(m any) error {
+	return cs.r.recv(cs.ctx, m, cs.ClientStream.RecvMsg)
+}
+
+// messageID returns the value of the field at path, or "" when m is not a
+// proto message or the field is unset.
+func messageID(m any, path []string) string {
+	msg, ok := m.(proto.Message)
+	if !ok {
+		return ""
+	}
+	pm := msg.ProtoReflect()
+	for i, item := range path {
+		fd := pm.Descriptor().Fields().ByName(protoreflect.Name(item))
+		if fd == nil || fd.IsList() || fd.IsMap() || !pm.Has(fd) {
+			return ""
+		}
+		value := pm.Get(fd)
+		if i < len(path)-1 {
+			if fd.Message() == nil {
+				return ""
+			}
+			pm = value.Message()
+			continue
+		}
+		switch fd.Kind() {
+		case protoreflect.BytesKind:
+			return string(value.Bytes())
+		case protoreflect.MessageKind, protoreflect.GroupKind:
+			return ""
+		default:
+			return value.String()
+		}
+	}
+	return ""
+}
@@ -0,0 +1,251 @@
+// Copyright 2022 The codesjoy Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dedupe
+
+import (
+	"context"
+	"errors"
+	"io"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/genproto/googleapis/rpc/code"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+
+	"github.com/codesjoy/yggdrasil/v3/rpc/interceptor"
+	"github.com/codesjoy/yggdrasil/v3/rpc/metadata"
+	"github.com/codesjoy/yggdrasil/v3/rpc/status"
+	"github.com/codesjoy/yggdrasil/v3/rpc/stream"
+)
+
+type fakeServerStream struct {
+	stream.ServerStream
+	ctx  context.Context
+	msgs []string
+}
+
+func (ss *fakeServerStream) Context() context.Context {
+	return ss.ctx
+}
+
+func (ss *fakeServerStream) RecvMsg(m any) error {
+	if len(ss.msgs) == 0 {
+		return io.EOF
+	}
+	m.(*wrapperspb.StringValue).Value = ss.msgs[0]
+	ss.msgs = ss.msgs[1:]
+	return nil
+}
+
+type fakeClientStream struct {
+	stream.ClientStream
+	msgs []string
+}
+
+func (cs *fakeClientStream) RecvMsg(m any) error {
+	if len(cs.msgs) == 0 {
+		return io.EOF
+	}
+	m.(*wrapperspb.StringValue).Value = cs.msgs[0]
+	cs.msgs = cs.msgs[1:]
+	return nil
+}
+
+func recvAll(t *testing.T, ss interface{ RecvMsg(any) error }) []string {
+	t.Helper()
+	var out []string
+	for {
+		msg := &wrapperspb.StringValue{}
+		err := ss.RecvMsg(msg)
+		if errors.Is(err, io.EOF) {
+			return out
+		}
+		require.NoError(t, err)
+		out = append(out, msg.GetValue())
+	}
+}
+
+func TestMustLoadConfig_Defaults(t *testing.T) {
+	assert.Equal(t, "dedupe", BuiltinStreamServerProvider().Name())
+	assert.Equal(t, "dedupe", BuiltinStreamClientProvider().Name())
+
+	cfg := mustLoadConfig(map[string]any{"header": "X-Producer"})
+	assert.Equal(t, 10*time.Minute, cfg.TTL)
+	assert.Equal(t, MemoryStoreName, cfg.Store)
+	assert.Equal(t, 10000, cfg.MaxEntries)
+	assert.Equal(t, "x-producer", cfg.Header)
+}
+
+func TestStreamServerInterceptor_DropsDuplicates(t *testing.T) {
+	d := newDedupe(mustLoadConfig(map[string]any{"field": "value", "header": "x-producer"}), nil)
+	info := &interceptor.StreamServerInfo{FullMethod: "/svc/Publish", IsClientStream: true}
+	run := func(producer string, msgs ...string) []string {
+		ctx := metadata.WithInContext(context.Background(), metadata.Pairs("x-producer", producer))
+		var got []string
+		err := d.StreamServerInterceptor(nil, &fakeServerStream{ctx: ctx, msgs: msgs}, info,
+			func(_ any, ss stream.ServerStream) error {
+				got = recvAll(t, ss)
+				return nil
+			})
+		require.NoError(t, err)
+		return got
+	}
+
+	assert.Equal(t, []string{"1", "2"}, run("p1", "1", "2", "2"))
+	// The producer reconnects and re-sends what it could not confirm.
+	assert.Equal(t, []string{"3"}, run("p1", "2", "3"))
+	assert.Equal(t, []string{"1"}, run("p2", "1"), "ids are scoped per producer")
+}
+
+func TestStreamServerInterceptor_FailedMessageIsRedelivered(t *testing.T) {
+	d := newDedupe(mustLoadConfig(map[string]any{"field": "value"}), nil)
+	info := &interceptor.StreamServerInfo{FullMethod: "/svc/Publish", IsClientStream: true}
+	run := func(fail string, msgs ...string) []string {
+		ss := &fakeServerStream{ctx: context.Background(), msgs: msgs}
+		var got []string
+		_ = d.StreamServerInterceptor(nil, ss, info, func(_ any, ss stream.ServerStream) error {
+			for {
+				msg := &wrapperspb.StringValue{}
+				if err := ss.RecvMsg(msg); err != nil {
+					return nil
+				}
+				got = append(got, msg.GetValue())
+				if msg.GetValue() == fail {
+					return errors.New("handling failed")
+				}
+			}
+		})
+		return got
+	}
+
+	assert.Equal(t, []string{"1", "2"}, run("2", "1", "2"))
+	// Only the message handled before the failure is skipped on re-send.
+	assert.Equal(t, []string{"2", "3"}, run("", "1", "2", "3"))
+	assert.Equal(t, []string{"4"}, run("", "3", "4"))
+}
+
+func TestStreamServerInterceptor_ConcurrentDuplicateDelivery(t *testing.T) {
+	d := newDedupe(mustLoadConfig(map[string]any{"field": "value"}), nil)
+	info := &interceptor.StreamServerInfo{FullMethod: "/svc/Publish", IsClientStream: true}
+	const streams = 8
+	var (
+		delivered atomic.Int32
+		wg        sync.WaitGroup
+	)
+	start := make(chan struct{})
+	for range streams {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			<-start
+			ss := &fakeServerStream{ctx: context.Background(), msgs: []string{"1"}}
+			err := d.StreamServerInterceptor(nil, ss, info,
+				func(_ any, ss stream.ServerStream) error {
+					delivered.Add(int32(len(recvAll(t, ss))))
+					return nil
+				})
+			assert.NoError(t, err)
+		}()
+	}
+	close(start)
+	wg.Wait()
+	assert.Equal(t, int32(1), delivered.Load())
+}
+
+func TestStreamClientInterceptor_DropsDuplicates(t *testing.T) {
+	d := newDedupe(mustLoadConfig(map[string]any{"field": "value"}), nil)
+	streamer := func(msgs ...string) interceptor.Streamer {
+		return func(context.Context, *stream.Desc, string) (stream.ClientStream, error) {
+			return &fakeClientStream{msgs: msgs}, nil
+		}
+	}
+	desc := &stream.Desc{ServerStreams: true}
+
+	ctx := context.Background()
+	cs, err := d.StreamClientInterceptor(ctx, desc, "/svc/Watch", streamer("a", "b"))
+	require.NoError(t, err)
+	assert.Equal(t, []string{"a", "b"}, recvAll(t, cs))
+	cs, err = d.StreamClientInterceptor(ctx, desc, "/svc/Watch", streamer("b", "c"))
+	require.NoError(t, err)
+	assert.Equal(t, []string{"c"}, recvAll(t, cs))
+}
+
+func TestStreamServerInterceptor_PassThrough(t *testing.T) {
+	info := &interceptor.StreamServerInfo{FullMethod: "/svc/Publish", IsClientStream: true}
+	for _, cfg := range []map[string]any{
+		{},
+		{"field": "value", "methods": []string{"Other"}},
+	} {
+		d := newDedupe(mustLoadConfig(cfg), nil)
+		ss := &fakeServerStream{ctx: context.Background(), msgs: []string{"1", "1"}}
+		err := d.StreamServerInterceptor(nil, ss, info,
+			func(_ any, got stream.ServerStream) error {
+				assert.Same(t, ss, got)
+				return nil
+			})
+		require.NoError(t, err)
+	}
+
+	d := newDedupe(mustLoadConfig(map[string]any{"field": "value", "store": "missing"}), nil)
+	err := d.StreamServerInterceptor(nil, &fakeServerStream{ctx: context.Background()}, info,
+		func(any, stream.ServerStream) error {
+			t.Fatal("handler should not be called")
+			return nil
+		})
+	assert.Equal(t, code.Code_INTERNAL, status.FromError(err).Code())
+}
+
+type failingStore struct{}
+
+func (failingStore) Add(context.Context, string, time.Duration) (bool, error) {
+	return false, errors.New("down")
+}
+
+func (failingStore) Remove(context.Context, string) error {
+	return errors.New("down")
+}
+
+func TestStreamServerInterceptor_StoreFailureDelivers(t *testing.T) {
+	RegisterStore("failing", failingStore{})
+	d := newDedupe(mustLoadConfig(map[string]any{"field": "value", "store": "failing"}), nil)
+	info := &interceptor.StreamServerInfo{FullMethod: "/svc/Publish", IsClientStream: true}
+	ss := &fakeServerStream{ctx: context.Background(), msgs: []string{"1", "1"}}
+	err := d.StreamServerInterceptor(nil, ss, info, func(_ any, ss stream.ServerStream) error {
+		assert.Equal(t, []string{"1", "1"}, recvAll(t, ss))
+		return nil
+	})
+	require.NoError(t, err)
+}
+
+func TestMessageID(t *testing.T) {
+	file := &descriptorpb.FileDescriptorProto{
+		Name:    proto.String("a.proto"),
+		Options: &descriptorpb.FileOptions{JavaPackage: proto.String("pkg")},
+	}
+	assert.Equal(t, "a.proto", messageID(file, []string{"name"}))
+	assert.Equal(t, "pkg", messageID(file, []string{"options", "java_package"}))
+	assert.Equal(t, "", messageID(file, []string{"package"}), "unset field")
+	assert.Equal(t, "", messageID(file, []string{"options"}), "message field")
+	assert.Equal(t, "", messageID(file, []string{"missing"}))
+	assert.Equal(t, "42", messageID(wrapperspb.Int64(42), []string{"value"}))
+	assert.Equal(t, "raw", messageID(wrapperspb.Bytes([]byte("raw")), []string{"value"}))
+	assert.Equal(t, "", messageID("not proto", []string{"value"}))
+}
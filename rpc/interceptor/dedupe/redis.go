@@ -0,0 +1,54 @@
+// Copyright 2022 The codesjoy Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dedupe
+
+import (
+	"context"
+	"time"
+)
+
+// RedisClient is the subset of Redis commands used by the Redis store.
+// DedupeClient in contrib/redis implements it over a go-redis client.
+type RedisClient interface {
+	// SetNX sets key to value with ttl if key does not exist and reports
+	// whether it was set.
+	SetNX(ctx context.Context, key, value string, ttl time.Duration) (bool, error)
+	// Del deletes key.
+	Del(ctx context.Context, key string) error
+}
+
+type redisStore struct {
+	client RedisClient
+	prefix string
+}
+
+// NewRedisStore returns a store that keeps IDs in Redis under prefix, so
+// duplicates are recognized across server instances and reconnects to
+// another instance.
+func NewRedisStore(client RedisClient, prefix string) Store {
+	return &redisStore{client: client, prefix: prefix}
+}
+
+func (s *redisStore) Add(ctx context.Context, id string, ttl time.Duration) (bool, error) {
+	set, err := s.client.SetNX(ctx, s.prefix+id, "1", ttl)
+	if err != nil {
+		return false, err
+	}
+	return !set, nil
+}
+
+func (s *redisStore) Remove(ctx context.Context, id string) error {
+	return s.client.Del(ctx, s.prefix+id)
+}
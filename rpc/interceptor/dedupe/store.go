@@ -0,0 +1,149 @@
+// Copyright 2022 The codesjoy Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dedupe
+
+import (
+	"container/list"
+	"context"
+	"sync"
+	"time"
+)
+
+// MemoryStoreName is the name of the builtin in-memory LRU store.
+const MemoryStoreName = "memory"
+
+const defaultMaxEntries = 10000
+
+// Store keeps the message IDs seen within their TTL.
+type Store interface {
+	// Add records id for ttl and reports whether it was already recorded
+	// and not yet expired. Checking and recording must be atomic, so two
+	// deliveries of the same ID never both see false.
+	Add(ctx context.Context, id string, ttl time.Duration) (bool, error)
+	// Remove forgets id, so its next delivery is not a duplicate.
+	Remove(ctx context.Context, id string) error
+}
+
+var (
+	mu     sync.RWMutex
+	stores = map[string]Store{}
+)
+
+// RegisterStore registers a named store, e.g. a Redis backed one built with
+// NewRedisStore. The name "memory" is reserved for the builtin LRU store.
+func RegisterStore(name string, store Store) {
+	mu.Lock()
+	defer mu.Unlock()
+	stores[name] = store
+}
+
+// GetStore returns a registered store by name.
+func GetStore(name string) Store {
+	mu.RLock()
+	defer mu.RUnlock()
+	return stores[name]
+}
+
+// Window is a windowed set of message IDs: an ID seen again within the TTL
+// of its first delivery is a duplicate. It is safe for concurrent use.
+type Window struct {
+	store Store
+	ttl   time.Duration
+}
+
+// NewWindow returns a window remembering IDs for ttl in store. A nil store
+// means an in-memory store of 10000 entries.
+func NewWindow(store Store, ttl time.Duration) *Window {
+	if store == nil {
+		store = NewMemoryStore(defaultMaxEntries)
+	}
+	return &Window{store: store, ttl: ttl}
+}
+
+// Duplicate records id and reports whether it was seen within the window.
+// An empty id is never a duplicate.
+func (w *Window) Duplicate(ctx context.Context, id string) (bool, error) {
+	if id == "" {
+		return false, nil
+	}
+	return w.store.Add(ctx, id, w.ttl)
+}
+
+// Release forgets id recorded by Duplicate, e.g. when handling the message
+// failed and it must be accepted when delivered again.
+func (w *Window) Release(ctx context.Context, id string) error {
+	if id == "" {
+		return nil
+	}
+	return w.store.Remove(ctx, id)
+}
+
+type memoryEntry struct {
+	id       string
+	expireAt time.Time
+}
+
+// memoryStore is an in-memory LRU store bounded by maxEntries.
+type memoryStore struct {
+	mu         sync.Mutex
+	maxEntries int
+	ll         *list.List
+	items      map[string]*list.Element
+	now        func() time.Time
+}
+
+// NewMemoryStore returns an in-memory store that keeps at most maxEntries
+// IDs and evicts the least recently seen ones first. Evicted IDs are no
+// longer recognized, so size it for the messages arriving within the TTL.
+func NewMemoryStore(maxEntries int) Store {
+	return &memoryStore{
+		maxEntries: maxEntries,
+		ll:         list.New(),
+		items:      map[string]*list.Element{},
+		now:        time.Now,
+	}
+}
+
+func (s *memoryStore) Add(_ context.Context, id string, ttl time.Duration) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := s.now()
+	if elem, ok := s.items[id]; ok {
+		if now.Before(elem.Value.(*memoryEntry).expireAt) {
+			s.ll.MoveToFront(elem)
+			return true, nil
+		}
+		s.remove(elem)
+	}
+	s.items[id] = s.ll.PushFront(&memoryEntry{id: id, expireAt: now.Add(ttl)})
+	for s.maxEntries > 0 && s.ll.Len() > s.maxEntries {
+		s.remove(s.ll.Back())
+	}
+	return false, nil
+}
+
+func (s *memoryStore) Remove(_ context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if elem, ok := s.items[id]; ok {
+		s.remove(elem)
+	}
+	return nil
+}
+
+func (s *memoryStore) remove(elem *list.Element) {
+	s.ll.Remove(elem)
+	delete(s.items, elem.Value.(*memoryEntry).id)
+}
@@ -0,0 +1,131 @@
+// Copyright 2022 The codesjoy Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dedupe
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWindow_Duplicate(t *testing.T) {
+	ctx := context.Background()
+	w := NewWindow(nil, time.Minute)
+
+	dup, err := w.Duplicate(ctx, "a")
+	require.NoError(t, err)
+	assert.False(t, dup)
+	dup, err = w.Duplicate(ctx, "a")
+	require.NoError(t, err)
+	assert.True(t, dup)
+	dup, err = w.Duplicate(ctx, "")
+	require.NoError(t, err)
+	assert.False(t, dup, "empty ids are never duplicates")
+}
+
+func TestWindow_Release(t *testing.T) {
+	ctx := context.Background()
+	w := NewWindow(nil, time.Minute)
+
+	dup, err := w.Duplicate(ctx, "a")
+	require.NoError(t, err)
+	assert.False(t, dup)
+	require.NoError(t, w.Release(ctx, "a"))
+	dup, err = w.Duplicate(ctx, "a")
+	require.NoError(t, err)
+	assert.False(t, dup, "released id is delivered again")
+	require.NoError(t, w.Release(ctx, ""))
+	require.NoError(t, w.Release(ctx, "missing"))
+}
+
+func TestMemoryStore_ExpiryAndEviction(t *testing.T) {
+	ctx := context.Background()
+	now := time.Unix(100, 0)
+	store := NewMemoryStore(2).(*memoryStore)
+	store.now = func() time.Time { return now }
+
+	_, err := store.Add(ctx, "a", time.Second)
+	require.NoError(t, err)
+	now = now.Add(2 * time.Second)
+	seen, err := store.Add(ctx, "a", time.Second)
+	require.NoError(t, err)
+	assert.False(t, seen, "expired id is delivered again")
+	now = now.Add(2 * time.Second)
+	seen, err = store.Add(ctx, "a", time.Second)
+	require.NoError(t, err)
+	assert.False(t, seen, "expired id is delivered again")
+
+	_, err = store.Add(ctx, "b", time.Minute)
+	require.NoError(t, err)
+	_, err = store.Add(ctx, "c", time.Minute)
+	require.NoError(t, err)
+	assert.Equal(t, 2, store.ll.Len())
+	_, ok := store.items["a"]
+	assert.False(t, ok, "least recently seen id is evicted")
+}
+
+type fakeRedis struct {
+	mu   sync.Mutex
+	data map[string]string
+	err  error
+}
+
+func (r *fakeRedis) SetNX(_ context.Context, key, value string, _ time.Duration) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.err != nil {
+		return false, r.err
+	}
+	if _, ok := r.data[key]; ok {
+		return false, nil
+	}
+	r.data[key] = value
+	return true, nil
+}
+
+func (r *fakeRedis) Del(_ context.Context, key string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.err != nil {
+		return r.err
+	}
+	delete(r.data, key)
+	return nil
+}
+
+func TestRedisStore(t *testing.T) {
+	ctx := context.Background()
+	client := &fakeRedis{data: map[string]string{}}
+	store := NewRedisStore(client, "dedupe:")
+
+	seen, err := store.Add(ctx, "a", time.Minute)
+	require.NoError(t, err)
+	assert.False(t, seen)
+	assert.Contains(t, client.data, "dedupe:a")
+	seen, err = store.Add(ctx, "a", time.Minute)
+	require.NoError(t, err)
+	assert.True(t, seen)
+	require.NoError(t, store.Remove(ctx, "a"))
+	assert.NotContains(t, client.data, "dedupe:a")
+
+	client.err = errors.New("down")
+	_, err = store.Add(ctx, "b", time.Minute)
+	assert.Error(t, err)
+}
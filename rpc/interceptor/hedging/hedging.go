@@ -0,0 +1,260 @@
+// Copyright 2022 The codesjoy Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package hedging provides a client interceptor that hedges idempotent unary
+// calls: when the first attempt has not completed after a delay, another
+// attempt is issued and the first successful response wins.
+//
+// Each attempt goes through the client balancer again. The attempts share a
+// balancer.Attempts, so the builtin balancers send them to endpoints not
+// tried yet while one is ready.
+package hedging
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+
+	"google.golang.org/genproto/googleapis/rpc/code"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/codesjoy/yggdrasil/v3/config"
+	"github.com/codesjoy/yggdrasil/v3/rpc/interceptor"
+	"github.com/codesjoy/yggdrasil/v3/rpc/metadata"
+	"github.com/codesjoy/yggdrasil/v3/rpc/status"
+	"github.com/codesjoy/yggdrasil/v3/transport/runtime/client/balancer"
+)
+
+const name = "hedging"
+
+// Policy controls hedging for one client service.
+type Policy struct {
+	// Delay is the time to wait for an attempt before issuing the next one.
+	Delay time.Duration `mapstructure:"delay"`
+	// MaxAttempts is the total number of attempts, including the first one.
+	MaxAttempts int `mapstructure:"max_attempts"`
+	// Methods lists the idempotent methods eligible for hedging by full name
+	// ("/pkg.Service/Method") or bare name ("Method"). Calls marked with
+	// interceptor.WithIdempotent are always eligible.
+	Methods []string `mapstructure:"methods"`
+	// NonFatalCodes lists the status code names (e.g. "UNAVAILABLE") that let
+	// the remaining attempts continue; any other error is returned immediately.
+	NonFatalCodes []string `mapstructure:"non_fatal_codes"`
+}
+
+// Config defines the hedging interceptor configuration.
+type Config struct {
+	Policy `mapstructure:",squash"`
+	// Services overrides the default policy per client service. Zero fields
+	// inherit the default policy.
+	Services map[string]Policy `mapstructure:"services"`
+}
+
+// BuiltinUnaryClientProvider returns the hedging unary client interceptor provider.
+func BuiltinUnaryClientProvider() interceptor.UnaryClientInterceptorProvider {
+	return BuiltinUnaryClientProviderWithConfig(nil)
+}
+
+// BuiltinUnaryClientProviderWithConfig returns the hedging unary client
+// interceptor provider bound to explicit config.
+func BuiltinUnaryClientProviderWithConfig(
+	source any,
+) interceptor.UnaryClientInterceptorProvider {
+	cfg := mustLoadConfig(source)
+	return interceptor.NewUnaryClientInterceptorProvider(
+		name,
+		func(serviceName string) interceptor.UnaryClientInterceptor {
+			return newHedger(cfg.policyFor(serviceName)).UnaryClientInterceptor
+		},
+	)
+}
+
+func mustLoadConfig(source any) *Config {
+	cfg := Config{}
+	if err := config.NewSnapshot(source).Decode(&cfg); err != nil {
+		panic(fmt.Sprintf("load hedging interceptor config: %v", err))
+	}
+	return &cfg
+}
+
+func (c *Config) policyFor(serviceName string) Policy {
+	out := c.Policy
+	if override, ok := c.Services[serviceName]; ok {
+		if override.Delay > 0 {
+			out.Delay = override.Delay
+		}
+		if override.MaxAttempts > 0 {
+			out.MaxAttempts = override.MaxAttempts
+		}
+		if override.Methods != nil {
+			out.Methods = override.Methods
+		}
+		if override.NonFatalCodes != nil {
+			out.NonFatalCodes = override.NonFatalCodes
+		}
+	}
+	if out.Delay <= 0 {
+		out.Delay = 50 * time.Millisecond
+	}
+	if out.MaxAttempts <= 0 {
+		out.MaxAttempts = 2
+	}
+	if out.NonFatalCodes == nil {
+		out.NonFatalCodes = []string{code.Code_UNAVAILABLE.String()}
+	}
+	return out
+}
+
+func (p Policy) eligible(ctx context.Context, method string) bool {
+	if p.MaxAttempts < 2 {
+		return false
+	}
+	if interceptor.IsIdempotent(ctx) {
+		return true
+	}
+	bare := method[strings.LastIndex(method, "/")+1:]
+	for _, item := range p.Methods {
+		if item == method || item == bare {
+			return true
+		}
+	}
+	return false
+}
+
+type hedger struct {
+	policy   Policy
+	nonFatal map[code.Code]struct{}
+}
+
+func newHedger(policy Policy) *hedger {
+	h := &hedger{policy: policy, nonFatal: map[code.Code]struct{}{}}
+	for _, item := range policy.NonFatalCodes {
+		if value, ok := code.Code_value[strings.ToUpper(strings.TrimSpace(item))]; ok {
+			h.nonFatal[code.Code(value)] = struct{}{}
+		}
+	}
+	return h
+}
+
+type attemptResult struct {
+	ctx   context.Context
+	reply any
+	err   error
+}
+
+// UnaryClientInterceptor is a unary client interceptor.
+func (h *hedger) UnaryClientInterceptor(
+	ctx context.Context,
+	method string,
+	req, reply any,
+	invoker interceptor.UnaryInvoker,
+) error {
+	if !h.policy.eligible(ctx, method) || !canCloneReply(reply) {
+		return invoker(ctx, method, req, reply)
+	}
+	// Cancelling the shared context on return stops the losing attempts.
+	ctx, cancel := context.WithCancel(balancer.WithAttempts(ctx))
+	defer cancel()
+
+	results := make(chan attemptResult, h.policy.MaxAttempts)
+	launch := func() {
+		// Each attempt gets its own stream so that only the returned
+		// attempt's header and trailer reach the caller.
+		attemptCtx := metadata.NewStreamContext(ctx)
+		attemptReply := newReply(reply)
+		go func() {
+			err := invoker(attemptCtx, method, req, attemptReply)
+			results <- attemptResult{ctx: attemptCtx, reply: attemptReply, err: err}
+		}()
+	}
+
+	launch()
+	started, finished := 1, 0
+	timer := time.NewTimer(h.policy.Delay)
+	defer timer.Stop()
+	var lastErr error
+	for {
+		select {
+		case res := <-results:
+			finished++
+			if res.err == nil {
+				copyStream(ctx, res.ctx)
+				copyReply(reply, res.reply)
+				return nil
+			}
+			lastErr = res.err
+			if !h.isNonFatal(res.err) {
+				copyStream(ctx, res.ctx)
+				return res.err
+			}
+			if started < h.policy.MaxAttempts && ctx.Err() == nil {
+				launch()
+				started++
+				continue
+			}
+			if finished == started {
+				copyStream(ctx, res.ctx)
+				return lastErr
+			}
+		case <-timer.C:
+			if started < h.policy.MaxAttempts && ctx.Err() == nil {
+				launch()
+				started++
+				timer.Reset(h.policy.Delay)
+			}
+		}
+	}
+}
+
+func (h *hedger) isNonFatal(err error) bool {
+	_, ok := h.nonFatal[status.FromError(err).Code()]
+	return ok
+}
+
+// copyStream copies the header and trailer of an attempt into the caller's
+// stream, if the caller attached one.
+func copyStream(dst, src context.Context) {
+	if header, ok := metadata.FromHeaderCtx(src); ok {
+		_ = metadata.SetHeader(dst, header)
+	}
+	if trailer, ok := metadata.FromTrailerCtx(src); ok {
+		_ = metadata.SetTrailer(dst, trailer)
+	}
+}
+
+func canCloneReply(reply any) bool {
+	if _, ok := reply.(proto.Message); ok {
+		return true
+	}
+	v := reflect.ValueOf(reply)
+	return v.Kind() == reflect.Pointer && !v.IsNil()
+}
+
+func newReply(reply any) any {
+	if msg, ok := reply.(proto.Message); ok {
+		return msg.ProtoReflect().New().Interface()
+	}
+	return reflect.New(reflect.TypeOf(reply).Elem()).Interface()
+}
+
+func copyReply(dst, src any) {
+	if msg, ok := dst.(proto.Message); ok {
+		proto.Reset(msg)
+		proto.Merge(msg, src.(proto.Message))
+		return
+	}
+	reflect.ValueOf(dst).Elem().Set(reflect.ValueOf(src).Elem())
+}
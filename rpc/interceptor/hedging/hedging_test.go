@@ -0,0 +1,195 @@
+// Copyright 2022 The codesjoy Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package hedging
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/codesjoy/pkg/basic/xerror"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/genproto/googleapis/rpc/code"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+
+	"github.com/codesjoy/yggdrasil/v3/rpc/interceptor"
+	"github.com/codesjoy/yggdrasil/v3/rpc/metadata"
+)
+
+func TestConfigPolicyFor(t *testing.T) {
+	cfg := mustLoadConfig(map[string]any{
+		"delay":   "10ms",
+		"methods": []any{"Get"},
+		"services": map[string]any{
+			"svc": map[string]any{"max_attempts": 3},
+		},
+	})
+
+	def := cfg.policyFor("other")
+	assert.Equal(t, 10*time.Millisecond, def.Delay)
+	assert.Equal(t, 2, def.MaxAttempts)
+	assert.Equal(t, []string{"Get"}, def.Methods)
+	assert.Equal(t, []string{"UNAVAILABLE"}, def.NonFatalCodes)
+
+	svc := cfg.policyFor("svc")
+	assert.Equal(t, 10*time.Millisecond, svc.Delay)
+	assert.Equal(t, 3, svc.MaxAttempts)
+}
+
+func TestPolicyEligible(t *testing.T) {
+	p := Policy{MaxAttempts: 2, Methods: []string{"Get", "/pkg.Svc/List"}}
+	assert.True(t, p.eligible(context.Background(), "/pkg.Svc/Get"))
+	assert.True(t, p.eligible(context.Background(), "/pkg.Svc/List"))
+	assert.False(t, p.eligible(context.Background(), "/other.Svc/List"))
+	assert.True(t, p.eligible(interceptor.WithIdempotent(context.Background()), "/pkg.Svc/Put"))
+
+	p.MaxAttempts = 1
+	assert.False(t, p.eligible(context.Background(), "/pkg.Svc/Get"))
+}
+
+func TestHedgerSlowFirstAttemptLoses(t *testing.T) {
+	h := newHedger(Policy{Delay: 10 * time.Millisecond, MaxAttempts: 2, Methods: []string{"Get"}})
+	var calls atomic.Int32
+	loserCancelled := make(chan struct{})
+	invoker := func(ctx context.Context, _ string, _, reply any) error {
+		if calls.Add(1) == 1 {
+			<-ctx.Done()
+			close(loserCancelled)
+			return ctx.Err()
+		}
+		reply.(*wrapperspb.StringValue).Value = "fast"
+		return nil
+	}
+
+	reply := &wrapperspb.StringValue{}
+	require.NoError(t, h.UnaryClientInterceptor(context.Background(), "/pkg.Svc/Get", nil, reply, invoker))
+	assert.Equal(t, "fast", reply.GetValue())
+	assert.Equal(t, int32(2), calls.Load())
+	select {
+	case <-loserCancelled:
+	case <-time.After(time.Second):
+		t.Fatal("losing attempt was not cancelled")
+	}
+}
+
+func TestHedgerCopiesOnlyWinnerHeaderAndTrailer(t *testing.T) {
+	h := newHedger(Policy{Delay: 10 * time.Millisecond, MaxAttempts: 2, Methods: []string{"Get"}})
+	var calls atomic.Int32
+	loserDone := make(chan struct{})
+	invoker := func(ctx context.Context, _ string, _, reply any) error {
+		attempt := calls.Add(1)
+		ctx = metadata.WithStreamContext(ctx)
+		if attempt == 1 {
+			defer close(loserDone)
+			_ = metadata.SetHeader(ctx, metadata.Pairs("attempt", "1"))
+			<-ctx.Done()
+			_ = metadata.SetTrailer(ctx, metadata.Pairs("attempt", "1"))
+			return ctx.Err()
+		}
+		_ = metadata.SetHeader(ctx, metadata.Pairs("attempt", "2"))
+		_ = metadata.SetTrailer(ctx, metadata.Pairs("attempt", "2"))
+		reply.(*wrapperspb.StringValue).Value = "fast"
+		return nil
+	}
+
+	ctx := metadata.WithStreamContext(context.Background())
+	reply := &wrapperspb.StringValue{}
+	require.NoError(t, h.UnaryClientInterceptor(ctx, "/pkg.Svc/Get", nil, reply, invoker))
+	<-loserDone
+
+	header, ok := metadata.FromHeaderCtx(ctx)
+	require.True(t, ok)
+	assert.Equal(t, []string{"2"}, header.Get("attempt"))
+	trailer, ok := metadata.FromTrailerCtx(ctx)
+	require.True(t, ok)
+	assert.Equal(t, []string{"2"}, trailer.Get("attempt"))
+}
+
+func TestHedgerFastFirstAttemptSkipsHedge(t *testing.T) {
+	h := newHedger(Policy{Delay: time.Second, MaxAttempts: 2, Methods: []string{"Get"}})
+	var calls atomic.Int32
+	invoker := func(_ context.Context, _ string, _, reply any) error {
+		calls.Add(1)
+		*reply.(*string) = "ok"
+		return nil
+	}
+
+	var reply string
+	require.NoError(t, h.UnaryClientInterceptor(context.Background(), "/pkg.Svc/Get", nil, &reply, invoker))
+	assert.Equal(t, "ok", reply)
+	assert.Equal(t, int32(1), calls.Load())
+}
+
+func TestHedgerErrors(t *testing.T) {
+	t.Run("fatal error returns immediately", func(t *testing.T) {
+		h := newHedger(Policy{
+			Delay:         time.Second,
+			MaxAttempts:   3,
+			Methods:       []string{"Get"},
+			NonFatalCodes: []string{"UNAVAILABLE"},
+		})
+		var calls atomic.Int32
+		err := h.UnaryClientInterceptor(
+			context.Background(),
+			"/pkg.Svc/Get",
+			nil,
+			&wrapperspb.StringValue{},
+			func(context.Context, string, any, any) error {
+				calls.Add(1)
+				return xerror.New(code.Code_INVALID_ARGUMENT, "bad")
+			},
+		)
+		require.Error(t, err)
+		assert.Equal(t, int32(1), calls.Load())
+	})
+
+	t.Run("non fatal error triggers next attempt", func(t *testing.T) {
+		h := newHedger(Policy{
+			Delay:         time.Second,
+			MaxAttempts:   2,
+			Methods:       []string{"Get"},
+			NonFatalCodes: []string{"UNAVAILABLE"},
+		})
+		var calls atomic.Int32
+		err := h.UnaryClientInterceptor(
+			context.Background(),
+			"/pkg.Svc/Get",
+			nil,
+			&wrapperspb.StringValue{},
+			func(context.Context, string, any, any) error {
+				calls.Add(1)
+				return xerror.New(code.Code_UNAVAILABLE, "down")
+			},
+		)
+		require.Error(t, err)
+		assert.Equal(t, int32(2), calls.Load())
+	})
+
+	t.Run("ineligible method is not hedged", func(t *testing.T) {
+		h := newHedger(Policy{Delay: time.Millisecond, MaxAttempts: 2})
+		want := errors.New("boom")
+		err := h.UnaryClientInterceptor(
+			context.Background(),
+			"/pkg.Svc/Put",
+			nil,
+			nil,
+			func(context.Context, string, any, any) error { return want },
+		)
+		assert.Same(t, want, err)
+	})
+}
@@ -0,0 +1,231 @@
+// Copyright 2022 The codesjoy Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package i18n
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/codesjoy/pkg/utils/xgo"
+
+	"github.com/codesjoy/yggdrasil/v3/config/source"
+)
+
+// Bundle holds translated messages keyed by locale and message key.
+type Bundle struct {
+	defaultLocale string
+
+	mu       sync.RWMutex
+	messages map[string]map[string]string
+	// tags maps normalized locales to the tags they were loaded with.
+	tags map[string]string
+	// sources maps normalized locales to the sources they were loaded from.
+	sources map[string]*loadedSource
+}
+
+// loadedSource wraps a source so replacements are detected by identity even
+// when the source itself is not comparable.
+type loadedSource struct {
+	source.Source
+}
+
+// NewBundle returns an empty bundle falling back to defaultLocale when no
+// requested locale is available.
+func NewBundle(defaultLocale string) *Bundle {
+	return &Bundle{
+		defaultLocale: strings.TrimSpace(defaultLocale),
+		messages:      map[string]map[string]string{},
+		tags:          map[string]string{},
+		sources:       map[string]*loadedSource{},
+	}
+}
+
+// DefaultLocale returns the fallback locale of the bundle.
+func (b *Bundle) DefaultLocale() string {
+	return b.defaultLocale
+}
+
+// SetMessages replaces the messages of locale.
+func (b *Bundle) SetMessages(locale string, messages map[string]string) {
+	copied := make(map[string]string, len(messages))
+	for k, v := range messages {
+		copied[k] = v
+	}
+	key := normalizeLocale(locale)
+	b.mu.Lock()
+	b.messages[key] = copied
+	b.tags[key] = strings.TrimSpace(locale)
+	b.mu.Unlock()
+}
+
+// LoadSource loads the messages of locale from src. Nested maps are flattened
+// into dot-separated keys, so
+//
+//	user:
+//	  not_found: "user {id} does not exist"
+//
+// defines the key "user.not_found". When src is watchable the messages are
+// reloaded on every change until src is closed. Once loaded, the bundle owns
+// src and closes it when another source is loaded for locale or on Close.
+func (b *Bundle) LoadSource(locale string, src source.Source) error {
+	data, err := src.Read()
+	if err != nil {
+		return fmt.Errorf("read %s messages from %s: %w", locale, src.Name(), err)
+	}
+	if err := b.loadData(locale, data); err != nil {
+		return fmt.Errorf("decode %s messages from %s: %w", locale, src.Name(), err)
+	}
+	key := normalizeLocale(locale)
+	loaded := &loadedSource{Source: src}
+	b.mu.Lock()
+	prev := b.sources[key]
+	b.sources[key] = loaded
+	b.mu.Unlock()
+	if prev != nil {
+		if err := prev.Close(); err != nil {
+			slog.Warn("fault to close replaced i18n source",
+				slog.String("locale", locale),
+				slog.String("source", prev.Name()),
+				slog.Any("error", err),
+			)
+		}
+	}
+	watchable, ok := src.(source.Watchable)
+	if !ok {
+		return nil
+	}
+	changes, err := watchable.Watch()
+	if err != nil || changes == nil {
+		return err
+	}
+	xgo.Go(func() {
+		for data := range changes {
+			if !b.current(key, loaded) {
+				continue
+			}
+			if err := b.loadData(locale, data); err != nil {
+				slog.Error("fault to reload i18n messages",
+					slog.String("locale", locale),
+					slog.String("source", src.Name()),
+					slog.Any("error", err),
+				)
+			}
+		}
+	})
+	return nil
+}
+
+// current reports whether loaded is still the source of the locale key.
+func (b *Bundle) current(key string, loaded *loadedSource) bool {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return b.sources[key] == loaded
+}
+
+// Close closes the sources of the bundle, which stops their reloads. The
+// loaded messages stay available.
+func (b *Bundle) Close() error {
+	b.mu.Lock()
+	sources := b.sources
+	b.sources = map[string]*loadedSource{}
+	b.mu.Unlock()
+	var err error
+	for _, src := range sources {
+		err = errors.Join(err, src.Close())
+	}
+	return err
+}
+
+func (b *Bundle) loadData(locale string, data source.Data) error {
+	raw := map[string]any{}
+	if err := data.Unmarshal(&raw); err != nil {
+		return err
+	}
+	messages := map[string]string{}
+	flattenMessages("", raw, messages)
+	b.SetMessages(locale, messages)
+	return nil
+}
+
+// Locales returns the loaded locales in sorted order.
+func (b *Bundle) Locales() []string {
+	b.mu.RLock()
+	out := make([]string, 0, len(b.tags))
+	for _, tag := range b.tags {
+		out = append(out, tag)
+	}
+	b.mu.RUnlock()
+	sort.Strings(out)
+	return out
+}
+
+// Match returns the first loaded locale satisfying preferred, trying each tag
+// and then its base language ("pt-BR" then "pt"). It returns the default
+// locale when nothing matches.
+func (b *Bundle) Match(preferred []string) string {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	for _, tag := range preferred {
+		tag = normalizeLocale(tag)
+		if loaded, ok := b.tags[tag]; ok {
+			return loaded
+		}
+		if base, _, found := strings.Cut(tag, "-"); found {
+			if loaded, ok := b.tags[base]; ok {
+				return loaded
+			}
+		}
+	}
+	return b.defaultLocale
+}
+
+// Message returns the message of key in locale.
+func (b *Bundle) Message(locale, key string) (string, bool) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	msg, ok := b.messages[normalizeLocale(locale)][key]
+	return msg, ok
+}
+
+func flattenMessages(prefix string, raw map[string]any, out map[string]string) {
+	for k, v := range raw {
+		key := k
+		if prefix != "" {
+			key = prefix + "." + k
+		}
+		switch val := v.(type) {
+		case map[string]any:
+			flattenMessages(key, val, out)
+		case map[any]any:
+			nested := make(map[string]any, len(val))
+			for nk, nv := range val {
+				nested[fmt.Sprint(nk)] = nv
+			}
+			flattenMessages(key, nested, out)
+		case nil:
+		default:
+			out[key] = fmt.Sprint(val)
+		}
+	}
+}
+
+// normalizeLocale lower-cases tag and uses "-" as the subtag separator.
+func normalizeLocale(tag string) string {
+	return strings.ToLower(strings.ReplaceAll(strings.TrimSpace(tag), "_", "-"))
+}
@@ -0,0 +1,120 @@
+// Copyright 2022 The codesjoy Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package i18n
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/codesjoy/yggdrasil/v3/config/source"
+	"github.com/codesjoy/yggdrasil/v3/config/source/memory"
+)
+
+type watchSource struct {
+	source.Source
+	changes chan source.Data
+}
+
+func (s *watchSource) Watch() (<-chan source.Data, error) {
+	return s.changes, nil
+}
+
+func TestBundleMatch(t *testing.T) {
+	b := NewBundle("en")
+	b.SetMessages("en", map[string]string{"k": "hello"})
+	b.SetMessages("zh-CN", map[string]string{"k": "你好"})
+	b.SetMessages("pt", map[string]string{"k": "olá"})
+
+	assert.Equal(t, "zh-CN", b.Match([]string{"zh_cn"}))
+	assert.Equal(t, "pt", b.Match([]string{"fr", "pt-BR"}))
+	assert.Equal(t, "en", b.Match([]string{"de"}))
+	assert.Equal(t, "en", b.Match(nil))
+	assert.Equal(t, []string{"en", "pt", "zh-CN"}, b.Locales())
+
+	msg, ok := b.Message("zh-CN", "k")
+	assert.True(t, ok)
+	assert.Equal(t, "你好", msg)
+	_, ok = b.Message("en", "missing")
+	assert.False(t, ok)
+}
+
+func TestBundleLoadSourceFlattensAndReloads(t *testing.T) {
+	src := &watchSource{
+		Source: memory.NewSource("en", map[string]any{
+			"user": map[string]any{"not_found": "user {id} does not exist"},
+			"ping": "pong",
+		}),
+		changes: make(chan source.Data, 1),
+	}
+	b := NewBundle("en")
+	require.NoError(t, b.LoadSource("en", src))
+
+	msg, ok := b.Message("en", "user.not_found")
+	require.True(t, ok)
+	assert.Equal(t, "user {id} does not exist", msg)
+
+	src.changes <- source.NewMapData(map[string]any{"ping": "pong!"})
+	close(src.changes)
+	assert.Eventually(t, func() bool {
+		msg, _ := b.Message("en", "ping")
+		return msg == "pong!"
+	}, time.Second, 5*time.Millisecond)
+	_, ok = b.Message("en", "user.not_found")
+	assert.False(t, ok)
+}
+
+type closeTrackingSource struct {
+	watchSource
+	closed bool
+}
+
+func (s *closeTrackingSource) Close() error {
+	s.closed = true
+	return nil
+}
+
+func newCloseTrackingSource(messages map[string]any) *closeTrackingSource {
+	return &closeTrackingSource{watchSource: watchSource{
+		Source:  memory.NewSource("en", messages),
+		changes: make(chan source.Data, 1),
+	}}
+}
+
+func TestBundleClosesReplacedSources(t *testing.T) {
+	first := newCloseTrackingSource(map[string]any{"ping": "first"})
+	second := newCloseTrackingSource(map[string]any{"ping": "second"})
+	b := NewBundle("en")
+	require.NoError(t, b.LoadSource("en", first))
+	require.NoError(t, b.LoadSource("EN", second))
+	assert.True(t, first.closed)
+	assert.False(t, second.closed)
+
+	first.changes <- source.NewMapData(map[string]any{"ping": "stale"})
+	close(first.changes)
+	second.changes <- source.NewMapData(map[string]any{"ping": "fresh"})
+	assert.Eventually(t, func() bool {
+		msg, _ := b.Message("en", "ping")
+		return msg == "fresh"
+	}, time.Second, 5*time.Millisecond)
+
+	require.NoError(t, b.Close())
+	assert.True(t, second.closed)
+	msg, ok := b.Message("en", "ping")
+	assert.True(t, ok, "messages outlive Close")
+	assert.Equal(t, "fresh", msg)
+}
@@ -0,0 +1,270 @@
+// Copyright 2022 The codesjoy Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package i18n provides server interceptors that localize error statuses.
+//
+// Handlers return a status whose message, or ErrorInfo reason, is a message
+// key. The interceptor negotiates a locale from the "language" or
+// "accept-language" metadata, looks the key up in a Bundle and attaches the
+// translation as a LocalizedMessage detail. Placeholders such as "{id}" in a
+// translation are filled from the ErrorInfo metadata.
+package i18n
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/codesjoy/yggdrasil/v3/config"
+	"github.com/codesjoy/yggdrasil/v3/config/source/file"
+	"github.com/codesjoy/yggdrasil/v3/rpc/interceptor"
+	"github.com/codesjoy/yggdrasil/v3/rpc/metadata"
+	"github.com/codesjoy/yggdrasil/v3/rpc/status"
+	"github.com/codesjoy/yggdrasil/v3/rpc/stream"
+)
+
+const name = "i18n"
+
+const (
+	// LanguageMetadata carries an explicit locale chosen by the caller. It
+	// takes precedence over AcceptLanguageMetadata.
+	LanguageMetadata = "language"
+	// AcceptLanguageMetadata carries an HTTP Accept-Language value.
+	AcceptLanguageMetadata = "accept-language"
+)
+
+// Config defines the i18n interceptor configuration.
+type Config struct {
+	// DefaultLocale is used when no requested locale is available.
+	DefaultLocale string `mapstructure:"default_locale" default:"en"`
+	// Bundles maps a locale to a message file. The format follows the file
+	// extension: yaml, json or toml.
+	Bundles map[string]string `mapstructure:"bundles"`
+	// Watch reloads the message files when they change.
+	Watch bool `mapstructure:"watch"`
+}
+
+type localeKey struct{}
+
+// LocaleFromContext returns the locale negotiated for the current request.
+func LocaleFromContext(ctx context.Context) (string, bool) {
+	locale, ok := ctx.Value(localeKey{}).(string)
+	return locale, ok
+}
+
+// BuiltinUnaryServerProvider returns the i18n unary server interceptor provider.
+func BuiltinUnaryServerProvider() interceptor.UnaryServerInterceptorProvider {
+	return BuiltinUnaryServerProviderWithConfig(nil)
+}
+
+// BuiltinUnaryServerProviderWithConfig returns the i18n unary server
+// interceptor provider bound to explicit config.
+func BuiltinUnaryServerProviderWithConfig(source any) interceptor.UnaryServerInterceptorProvider {
+	bundle := lazyBundle(source)
+	return interceptor.NewUnaryServerInterceptorProvider(
+		name,
+		func() interceptor.UnaryServerInterceptor {
+			return UnaryServerInterceptor(bundle())
+		},
+	)
+}
+
+// BuiltinStreamServerProvider returns the i18n stream server interceptor provider.
+func BuiltinStreamServerProvider() interceptor.StreamServerInterceptorProvider {
+	return BuiltinStreamServerProviderWithConfig(nil)
+}
+
+// BuiltinStreamServerProviderWithConfig returns the i18n stream server
+// interceptor provider bound to explicit config.
+func BuiltinStreamServerProviderWithConfig(
+	source any,
+) interceptor.StreamServerInterceptorProvider {
+	bundle := lazyBundle(source)
+	return interceptor.NewStreamServerInterceptorProvider(
+		name,
+		func() interceptor.StreamServerInterceptor {
+			return StreamServerInterceptor(bundle())
+		},
+	)
+}
+
+// lazyBundle defers reading the message files until the interceptor is used.
+func lazyBundle(source any) func() *Bundle {
+	cfg := mustLoadConfig(source)
+	return sync.OnceValue(func() *Bundle { return sharedBundle(cfg) })
+}
+
+// shared is the bundle of the builtin interceptors. The unary and stream
+// interceptors built from one config share it, and a bundle built for a
+// changed config replaces it and closes its sources.
+var shared struct {
+	mu     sync.Mutex
+	cfg    *Config
+	bundle *Bundle
+}
+
+func sharedBundle(cfg *Config) *Bundle {
+	shared.mu.Lock()
+	defer shared.mu.Unlock()
+	if shared.bundle != nil && reflect.DeepEqual(shared.cfg, cfg) {
+		return shared.bundle
+	}
+	bundle := NewBundle(cfg.DefaultLocale)
+	for locale, path := range cfg.Bundles {
+		src := file.NewSource(path, cfg.Watch)
+		if err := bundle.LoadSource(locale, src); err != nil {
+			_ = src.Close()
+			_ = bundle.Close()
+			panic(fmt.Sprintf("load i18n interceptor bundle: %v", err))
+		}
+	}
+	if shared.bundle != nil {
+		if err := shared.bundle.Close(); err != nil {
+			slog.Warn("fault to close replaced i18n bundle", slog.Any("error", err))
+		}
+	}
+	shared.cfg, shared.bundle = cfg, bundle
+	return bundle
+}
+
+func mustLoadConfig(source any) *Config {
+	cfg := Config{}
+	if err := config.NewSnapshot(source).Decode(&cfg); err != nil {
+		panic(fmt.Sprintf("load i18n interceptor config: %v", err))
+	}
+	return &cfg
+}
+
+// UnaryServerInterceptor localizes the errors of unary handlers with bundle.
+func UnaryServerInterceptor(bundle *Bundle) interceptor.UnaryServerInterceptor {
+	return func(
+		ctx context.Context,
+		req any,
+		info *interceptor.UnaryServerInfo,
+		handler interceptor.UnaryHandler,
+	) (any, error) {
+		locale := bundle.Match(preferredLocales(ctx))
+		resp, err := handler(context.WithValue(ctx, localeKey{}, locale), req)
+		return resp, localize(bundle, locale, err)
+	}
+}
+
+// StreamServerInterceptor localizes the errors of stream handlers with bundle.
+func StreamServerInterceptor(bundle *Bundle) interceptor.StreamServerInterceptor {
+	return func(
+		srv interface{},
+		ss stream.ServerStream,
+		info *interceptor.StreamServerInfo,
+		handler stream.Handler,
+	) error {
+		locale := bundle.Match(preferredLocales(ss.Context()))
+		err := handler(srv, &localeServerStream{
+			ServerStream: ss,
+			ctx:          context.WithValue(ss.Context(), localeKey{}, locale),
+		})
+		return localize(bundle, locale, err)
+	}
+}
+
+// localeServerStream carries the negotiated locale in its context.
+type localeServerStream struct {
+	stream.ServerStream
+	ctx context.Context
+}
+
+func (s *localeServerStream) Context() context.Context {
+	return s.ctx
+}
+
+func localize(bundle *Bundle, locale string, err error) error {
+	if err == nil {
+		return nil
+	}
+	st, ok := status.CoverError(err)
+	if !ok || st.LocalizedMessage() != nil {
+		return err
+	}
+	info := st.ErrorInfo()
+	msg, found := bundle.Message(locale, st.Message())
+	if !found && info != nil {
+		msg, found = bundle.Message(locale, info.GetReason())
+	}
+	if !found {
+		return err
+	}
+	if len(info.GetMetadata()) > 0 {
+		pairs := make([]string, 0, 2*len(info.GetMetadata()))
+		for k, v := range info.GetMetadata() {
+			pairs = append(pairs, "{"+k+"}", v)
+		}
+		msg = strings.NewReplacer(pairs...).Replace(msg)
+	}
+	// Clone so statuses shared between requests are never modified.
+	return status.FromProto(st.Status()).WithLocalizedMessage(locale, msg)
+}
+
+func preferredLocales(ctx context.Context) []string {
+	md, ok := metadata.FromInContext(ctx)
+	if !ok {
+		return nil
+	}
+	var out []string
+	for _, v := range md.Get(LanguageMetadata) {
+		out = append(out, strings.TrimSpace(v))
+	}
+	for _, v := range md.Get(AcceptLanguageMetadata) {
+		out = append(out, parseAcceptLanguage(v)...)
+	}
+	return out
+}
+
+// parseAcceptLanguage returns the tags of an Accept-Language value ordered by
+// quality, dropping the wildcard and tags with q=0.
+func parseAcceptLanguage(value string) []string {
+	type weighted struct {
+		tag string
+		q   float64
+	}
+	var tags []weighted
+	for _, part := range strings.Split(value, ",") {
+		tag, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		tag = strings.TrimSpace(tag)
+		if tag == "" || tag == "*" {
+			continue
+		}
+		q := 1.0
+		if qv, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			parsed, err := strconv.ParseFloat(qv, 64)
+			if err != nil {
+				continue
+			}
+			q = parsed
+		}
+		if q <= 0 {
+			continue
+		}
+		tags = append(tags, weighted{tag: tag, q: q})
+	}
+	sort.SliceStable(tags, func(i, j int) bool { return tags[i].q > tags[j].q })
+	out := make([]string, len(tags))
+	for i, t := range tags {
+		out[i] = t.tag
+	}
+	return out
+}
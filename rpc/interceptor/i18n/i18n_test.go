@@ -0,0 +1,179 @@
+// Copyright 2022 The codesjoy Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package i18n
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/genproto/googleapis/rpc/code"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+
+	"github.com/codesjoy/yggdrasil/v3/config/source"
+	"github.com/codesjoy/yggdrasil/v3/rpc/interceptor"
+	"github.com/codesjoy/yggdrasil/v3/rpc/metadata"
+	"github.com/codesjoy/yggdrasil/v3/rpc/status"
+	"github.com/codesjoy/yggdrasil/v3/rpc/stream"
+)
+
+func testBundle() *Bundle {
+	b := NewBundle("en")
+	b.SetMessages("en", map[string]string{
+		"user.not_found": "user {id} does not exist",
+		"QUOTA":          "quota exceeded",
+	})
+	b.SetMessages("zh-CN", map[string]string{
+		"user.not_found": "用户 {id} 不存在",
+	})
+	return b
+}
+
+func TestParseAcceptLanguage(t *testing.T) {
+	assert.Equal(t,
+		[]string{"zh-CN", "zh", "en"},
+		parseAcceptLanguage("en;q=0.5, zh-CN, *;q=0.1, zh;q=0.9, fr;q=0"),
+	)
+	assert.Empty(t, parseAcceptLanguage(""))
+}
+
+func TestUnaryServerInterceptorLocalizesByKey(t *testing.T) {
+	unary := UnaryServerInterceptor(testBundle())
+	ctx := metadata.WithInContext(
+		context.Background(),
+		metadata.Pairs("accept-language", "zh-CN,en;q=0.8"),
+	)
+	shared := status.New(code.Code_NOT_FOUND, "user.not_found").
+		WithDetails(&errdetails.ErrorInfo{Reason: "USER_NOT_FOUND", Metadata: map[string]string{"id": "42"}})
+
+	var locale string
+	_, err := unary(ctx, nil, &interceptor.UnaryServerInfo{FullMethod: "/svc/Get"},
+		func(ctx context.Context, _ any) (any, error) {
+			locale, _ = LocaleFromContext(ctx)
+			return nil, shared
+		},
+	)
+	assert.Equal(t, "zh-CN", locale)
+	msg := status.FromError(err).LocalizedMessage()
+	require.NotNil(t, msg)
+	assert.Equal(t, "zh-CN", msg.GetLocale())
+	assert.Equal(t, "用户 42 不存在", msg.GetMessage())
+	assert.Equal(t, code.Code_NOT_FOUND, status.FromError(err).Code())
+	assert.Nil(t, shared.LocalizedMessage(), "shared status must not be modified")
+}
+
+func TestUnaryServerInterceptorFallsBack(t *testing.T) {
+	unary := UnaryServerInterceptor(testBundle())
+	ctx := metadata.WithInContext(
+		context.Background(),
+		metadata.Pairs("language", "fr", "accept-language", "de"),
+	)
+	info := &interceptor.UnaryServerInfo{FullMethod: "/svc/Get"}
+
+	// The ErrorInfo reason is the key when the message is not one.
+	_, err := unary(ctx, nil, info, func(context.Context, any) (any, error) {
+		return nil, status.New(code.Code_RESOURCE_EXHAUSTED, "too many").
+			WithDetails(&errdetails.ErrorInfo{Reason: "QUOTA"})
+	})
+	msg := status.FromError(err).LocalizedMessage()
+	require.NotNil(t, msg)
+	assert.Equal(t, "en", msg.GetLocale())
+	assert.Equal(t, "quota exceeded", msg.GetMessage())
+
+	// Unknown keys and plain errors pass through untouched.
+	unknown := status.New(code.Code_INTERNAL, "unknown.key")
+	_, err = unary(ctx, nil, info, func(context.Context, any) (any, error) { return nil, unknown })
+	assert.Same(t, unknown, err)
+	plain := errors.New("boom")
+	_, err = unary(ctx, nil, info, func(context.Context, any) (any, error) { return nil, plain })
+	assert.Same(t, plain, err)
+	_, err = unary(ctx, nil, info, func(context.Context, any) (any, error) { return "ok", nil })
+	assert.NoError(t, err)
+}
+
+type testStream struct {
+	stream.ServerStream
+	ctx context.Context
+}
+
+func (s *testStream) Context() context.Context { return s.ctx }
+
+func TestStreamServerInterceptor(t *testing.T) {
+	ctx := metadata.WithInContext(context.Background(), metadata.Pairs("language", "zh-CN"))
+	err := StreamServerInterceptor(testBundle())(
+		nil,
+		&testStream{ctx: ctx},
+		&interceptor.StreamServerInfo{FullMethod: "/svc/Watch"},
+		func(_ any, ss stream.ServerStream) error {
+			locale, ok := LocaleFromContext(ss.Context())
+			assert.True(t, ok)
+			assert.Equal(t, "zh-CN", locale)
+			return status.New(code.Code_NOT_FOUND, "user.not_found")
+		},
+	)
+	msg := status.FromError(err).LocalizedMessage()
+	require.NotNil(t, msg)
+	assert.Equal(t, "用户 {id} 不存在", msg.GetMessage())
+}
+
+func TestBuiltinProviderLoadsBundles(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "zh.yaml")
+	require.NoError(t, os.WriteFile(path, []byte("greeting:\n  hello: 你好\n"), 0o600))
+
+	provider := BuiltinUnaryServerProviderWithConfig(map[string]any{
+		"default_locale": "en",
+		"bundles":        map[string]any{"zh": path},
+	})
+	assert.Equal(t, "i18n", provider.Name())
+	ctx := metadata.WithInContext(context.Background(), metadata.Pairs("accept-language", "zh-TW"))
+	_, err := provider.New()(ctx, nil, &interceptor.UnaryServerInfo{FullMethod: "/svc/Get"},
+		func(context.Context, any) (any, error) {
+			return nil, status.New(code.Code_UNAVAILABLE, "greeting.hello")
+		},
+	)
+	msg := status.FromError(err).LocalizedMessage()
+	require.NotNil(t, msg)
+	assert.Equal(t, "zh", msg.GetLocale())
+	assert.Equal(t, "你好", msg.GetMessage())
+}
+
+func TestBuiltinProvidersShareBundleUntilConfigChanges(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "en.yaml")
+	require.NoError(t, os.WriteFile(path, []byte("hello: hi\n"), 0o600))
+	cfg := map[string]any{"bundles": map[string]any{"en": path}, "watch": true}
+
+	first := lazyBundle(cfg)()
+	assert.Same(t, first, lazyBundle(cfg)())
+	first.mu.RLock()
+	src := first.sources["en"]
+	first.mu.RUnlock()
+	require.NotNil(t, src)
+
+	cfg["default_locale"] = "zh"
+	second := lazyBundle(cfg)()
+	assert.NotSame(t, first, second)
+	first.mu.RLock()
+	assert.Empty(t, first.sources)
+	first.mu.RUnlock()
+	_, err := src.Source.(source.Watchable).Watch()
+	assert.EqualError(t, err, "the file source is stopped")
+	require.NoError(t, second.Close())
+}
@@ -0,0 +1,337 @@
+// Copyright 2022 The codesjoy Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package idempotency provides a unary server interceptor that makes retried
+// requests safe: the first response for an Idempotency-Key is stored for a
+// TTL and replayed for later requests carrying the same key, while
+// concurrent duplicates are rejected with ABORTED. Keys are scoped per
+// method, tenant and caller, and a replay whose request differs from the
+// first one is rejected with INVALID_ARGUMENT.
+//
+// Over the REST gateway the key is taken from the Idempotency-Key header.
+package idempotency
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"google.golang.org/genproto/googleapis/rpc/code"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/codesjoy/yggdrasil/v3/config"
+	"github.com/codesjoy/yggdrasil/v3/degrade"
+	"github.com/codesjoy/yggdrasil/v3/rpc/interceptor"
+	"github.com/codesjoy/yggdrasil/v3/rpc/metadata"
+	"github.com/codesjoy/yggdrasil/v3/rpc/status"
+	"github.com/codesjoy/yggdrasil/v3/tenant"
+	"github.com/codesjoy/yggdrasil/v3/transport/support/peer"
+	ytls "github.com/codesjoy/yggdrasil/v3/transport/support/security/tls"
+)
+
+const name = "idempotency"
+
+// ttlDegradation shortens the record TTL to DegradedTTL while the process is
+// degraded.
+var ttlDegradation = degrade.Default().Register("idempotency.ttl", 2)
+
+// MemoryStoreName is the name of the builtin in-memory LRU store.
+const MemoryStoreName = "memory"
+
+// Config defines the idempotency interceptor configuration.
+type Config struct {
+	// Header is the incoming metadata key carrying the idempotency key.
+	Header string `mapstructure:"header" default:"idempotency-key"`
+	// TTL is how long the first response is replayed.
+	TTL time.Duration `mapstructure:"ttl" default:"24h"`
+	// DegradedTTL replaces a longer TTL while the process is degraded, so
+	// the memory store sheds its records sooner. Zero keeps TTL.
+	DegradedTTL time.Duration `mapstructure:"degraded_ttl" default:"1h"`
+	// Lease is how long a request holds its key while the handler runs, so
+	// the key frees up soon after a crash. Calls with a later deadline hold
+	// it until the deadline; completion extends it to TTL.
+	Lease time.Duration `mapstructure:"lease" default:"1m"`
+	// Store names the record store: "memory" or a store registered with
+	// RegisterStore.
+	Store string `mapstructure:"store" default:"memory"`
+	// MaxEntries bounds the memory store.
+	MaxEntries int `mapstructure:"max_entries" default:"10000"`
+	// CallerMetadata is the incoming metadata key identifying the caller,
+	// e.g. "x-caller-id". Keys are scoped per caller so one caller cannot
+	// replay the responses of another.
+	CallerMetadata string `mapstructure:"caller_metadata"`
+	// CallerFromPeer identifies callers without caller metadata by the first
+	// URI or DNS SAN of their mTLS client certificate.
+	CallerFromPeer bool `mapstructure:"caller_from_peer"`
+	// Methods limits the interceptor to methods by full name
+	// ("/pkg.Service/Method") or bare name ("Method"). Empty selects all.
+	Methods []string `mapstructure:"methods"`
+}
+
+// BuiltinUnaryServerProvider returns the idempotency unary server interceptor provider.
+func BuiltinUnaryServerProvider() interceptor.UnaryServerInterceptorProvider {
+	return BuiltinUnaryServerProviderWithConfig(nil)
+}
+
+// BuiltinUnaryServerProviderWithConfig returns the idempotency unary server
+// interceptor provider bound to explicit config.
+func BuiltinUnaryServerProviderWithConfig(source any) interceptor.UnaryServerInterceptorProvider {
+	i := newIdempotency(mustLoadConfig(source), nil)
+	return interceptor.NewUnaryServerInterceptorProvider(
+		name,
+		func() interceptor.UnaryServerInterceptor {
+			return i.UnaryServerInterceptor
+		},
+	)
+}
+
+func mustLoadConfig(source any) *Config {
+	cfg := Config{}
+	if err := config.NewSnapshot(source).Decode(&cfg); err != nil {
+		panic(fmt.Sprintf("load idempotency interceptor config: %v", err))
+	}
+	cfg.Header = strings.ToLower(cfg.Header)
+	cfg.CallerMetadata = strings.ToLower(cfg.CallerMetadata)
+	return &cfg
+}
+
+type idempotency struct {
+	cfg *Config
+
+	once  sync.Once
+	store Store
+}
+
+func newIdempotency(cfg *Config, store Store) *idempotency {
+	return &idempotency{cfg: cfg, store: store}
+}
+
+// resolveStore looks the store up on first use so stores registered after
+// the runtime is assembled are still picked up.
+func (i *idempotency) resolveStore() Store {
+	i.once.Do(func() {
+		if i.store != nil {
+			return
+		}
+		if i.cfg.Store == "" || i.cfg.Store == MemoryStoreName {
+			i.store = NewMemoryStore(i.cfg.MaxEntries)
+			return
+		}
+		i.store = GetStore(i.cfg.Store)
+	})
+	return i.store
+}
+
+func (i *idempotency) eligible(method string) bool {
+	if len(i.cfg.Methods) == 0 {
+		return true
+	}
+	bare := method[strings.LastIndex(method, "/")+1:]
+	for _, item := range i.cfg.Methods {
+		if item == method || item == bare {
+			return true
+		}
+	}
+	return false
+}
+
+func (i *idempotency) keyFrom(ctx context.Context) string {
+	md, ok := metadata.FromInContext(ctx)
+	if !ok {
+		return ""
+	}
+	if values := md.Get(i.cfg.Header); len(values) > 0 {
+		return strings.TrimSpace(values[0])
+	}
+	return ""
+}
+
+func (i *idempotency) caller(ctx context.Context) string {
+	if key := i.cfg.CallerMetadata; key != "" {
+		if md, ok := metadata.FromInContext(ctx); ok {
+			if values := md.Get(key); len(values) > 0 && values[0] != "" {
+				return values[0]
+			}
+		}
+	}
+	if i.cfg.CallerFromPeer {
+		return peerIdentity(ctx)
+	}
+	return ""
+}
+
+// storeKey scopes key to the method, tenant and caller. Tenant and caller
+// are escaped so neither can forge the separators of another scope.
+func (i *idempotency) storeKey(ctx context.Context, method, key string) string {
+	scope := method
+	if id, _ := tenant.FromContext(ctx); id != "" {
+		scope += "@" + url.QueryEscape(id)
+	}
+	if caller := i.caller(ctx); caller != "" {
+		scope += "#" + url.QueryEscape(caller)
+	}
+	return scope + "|" + key
+}
+
+// peerIdentity returns the first URI or DNS SAN of the verified mTLS client
+// certificate of the peer.
+func peerIdentity(ctx context.Context) string {
+	p, ok := peer.FromContext(ctx)
+	if !ok || p == nil {
+		return ""
+	}
+	info, ok := p.AuthInfo.(ytls.AuthInfo)
+	if !ok || len(info.State.PeerCertificates) == 0 {
+		return ""
+	}
+	cert := info.State.PeerCertificates[0]
+	if len(cert.URIs) > 0 {
+		return cert.URIs[0].String()
+	}
+	if len(cert.DNSNames) > 0 {
+		return cert.DNSNames[0]
+	}
+	return ""
+}
+
+// requestHash returns the SHA-256 of the deterministic encoding of req, or
+// nil when req is not a proto message.
+func requestHash(req any) []byte {
+	msg, ok := req.(proto.Message)
+	if !ok {
+		return nil
+	}
+	data, err := proto.MarshalOptions{Deterministic: true}.Marshal(msg)
+	if err != nil {
+		return nil
+	}
+	sum := sha256.Sum256(data)
+	return sum[:]
+}
+
+func (i *idempotency) ttl() time.Duration {
+	if ttl := i.cfg.DegradedTTL; ttl > 0 && ttl < i.cfg.TTL && ttlDegradation.Degraded() {
+		return ttl
+	}
+	return i.cfg.TTL
+}
+
+// lease returns how long a new reservation holds the key.
+func (i *idempotency) lease(ctx context.Context) time.Duration {
+	lease := i.cfg.Lease
+	if deadline, ok := ctx.Deadline(); ok {
+		lease = max(lease, time.Until(deadline))
+	}
+	if ttl := i.ttl(); lease <= 0 || lease > ttl {
+		return ttl
+	}
+	return lease
+}
+
+// UnaryServerInterceptor is a unary server interceptor.
+func (i *idempotency) UnaryServerInterceptor(
+	ctx context.Context,
+	req interface{},
+	info *interceptor.UnaryServerInfo,
+	handler interceptor.UnaryHandler,
+) (interface{}, error) {
+	key := i.keyFrom(ctx)
+	if key == "" || !i.eligible(info.FullMethod) {
+		return handler(ctx, req)
+	}
+	store := i.resolveStore()
+	if store == nil {
+		return nil, status.New(
+			code.Code_INTERNAL,
+			fmt.Sprintf("idempotency store %q is not registered", i.cfg.Store),
+		).Err()
+	}
+	storeKey := i.storeKey(ctx, info.FullMethod, key)
+	hash := requestHash(req)
+	rec, err := store.Reserve(ctx, storeKey, i.lease(ctx))
+	switch {
+	case errors.Is(err, ErrInProgress):
+		return nil, status.New(
+			code.Code_ABORTED,
+			"a request with the same idempotency key is in progress",
+		).Err()
+	case err != nil:
+		return nil, status.New(
+			code.Code_UNAVAILABLE,
+			fmt.Sprintf("idempotency store: %v", err),
+		).Err()
+	case rec != nil:
+		if rec.RequestHash != nil && hash != nil && !bytes.Equal(rec.RequestHash, hash) {
+			return nil, status.New(
+				code.Code_INVALID_ARGUMENT,
+				"the idempotency key was already used with a different request",
+			).Err()
+		}
+		return rec.replay()
+	}
+
+	storeCtx := context.WithoutCancel(ctx)
+	defer func() {
+		if rec := recover(); rec != nil {
+			_ = store.Release(storeCtx, storeKey)
+			panic(rec)
+		}
+	}()
+	resp, err := handler(ctx, req)
+	if retryable(err) {
+		if releaseErr := store.Release(storeCtx, storeKey); releaseErr != nil {
+			slog.Warn("fault to release idempotency key", slog.Any("error", releaseErr))
+		}
+		return resp, err
+	}
+	rec, recErr := newRecord(resp, err)
+	if recErr == nil {
+		rec.RequestHash = hash
+		recErr = store.Complete(storeCtx, storeKey, rec, i.ttl())
+	}
+	if recErr != nil {
+		slog.Warn(
+			"fault to store idempotent response",
+			slog.String("method", info.FullMethod),
+			slog.Any("error", recErr),
+		)
+		_ = store.Release(storeCtx, storeKey)
+	}
+	return resp, err
+}
+
+// retryable reports whether err is transient, in which case the response is
+// not stored and a retry with the same key runs again.
+func retryable(err error) bool {
+	if err == nil {
+		return false
+	}
+	switch status.FromError(err).Code() {
+	case code.Code_CANCELLED,
+		code.Code_DEADLINE_EXCEEDED,
+		code.Code_UNAVAILABLE,
+		code.Code_RESOURCE_EXHAUSTED,
+		code.Code_ABORTED:
+		return true
+	default:
+		return false
+	}
+}
@@ -0,0 +1,280 @@
+// Copyright 2022 The codesjoy Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package idempotency
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/genproto/googleapis/rpc/code"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+
+	"github.com/codesjoy/yggdrasil/v3/degrade"
+	"github.com/codesjoy/yggdrasil/v3/rpc/interceptor"
+	"github.com/codesjoy/yggdrasil/v3/rpc/metadata"
+	"github.com/codesjoy/yggdrasil/v3/rpc/status"
+	"github.com/codesjoy/yggdrasil/v3/tenant"
+)
+
+func withKey(key string) context.Context {
+	return metadata.WithInContext(context.Background(), metadata.Pairs("idempotency-key", key))
+}
+
+func TestMustLoadConfig_Defaults(t *testing.T) {
+	cfg := mustLoadConfig(map[string]any{"header": "X-Idem-Key"})
+	assert.Equal(t, "x-idem-key", cfg.Header)
+	assert.Equal(t, 24*time.Hour, cfg.TTL)
+	assert.Equal(t, MemoryStoreName, cfg.Store)
+	assert.Equal(t, 10000, cfg.MaxEntries)
+	assert.Equal(t, time.Hour, cfg.DegradedTTL)
+	assert.Equal(t, time.Minute, cfg.Lease)
+}
+
+func TestLease(t *testing.T) {
+	i := newIdempotency(mustLoadConfig(nil), nil)
+	assert.Equal(t, time.Minute, i.lease(context.Background()))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
+	defer cancel()
+	lease := i.lease(ctx)
+	assert.Greater(t, lease, 9*time.Minute)
+	assert.LessOrEqual(t, lease, 10*time.Minute)
+
+	short := newIdempotency(mustLoadConfig(map[string]any{"ttl": "30s"}), nil)
+	assert.Equal(t, 30*time.Second, short.lease(context.Background()))
+}
+
+func TestUnaryServerInterceptor_ReservesWithLease(t *testing.T) {
+	store := NewMemoryStore(0).(*memoryStore)
+	now := time.Now()
+	store.now = func() time.Time { return now }
+	i := newIdempotency(mustLoadConfig(nil), store)
+	info := &interceptor.UnaryServerInfo{FullMethod: "/pkg.Svc/Pay"}
+
+	var expireAt time.Time
+	_, err := i.UnaryServerInterceptor(withKey("k1"), nil, info,
+		func(context.Context, any) (any, error) {
+			expireAt = store.items["/pkg.Svc/Pay|k1"].Value.(*memoryEntry).expireAt
+			return wrapperspb.Int32(1), nil
+		})
+	require.NoError(t, err)
+	assert.Equal(t, now.Add(time.Minute), expireAt)
+	completed := store.items["/pkg.Svc/Pay|k1"].Value.(*memoryEntry)
+	assert.Equal(t, now.Add(24*time.Hour), completed.expireAt)
+}
+
+func TestUnaryServerInterceptor_ReleasesKeyOnPanic(t *testing.T) {
+	i := newIdempotency(mustLoadConfig(nil), nil)
+	info := &interceptor.UnaryServerInfo{FullMethod: "/pkg.Svc/Pay"}
+
+	assert.PanicsWithValue(t, "boom", func() {
+		_, _ = i.UnaryServerInterceptor(withKey("k1"), nil, info,
+			func(context.Context, any) (any, error) { panic("boom") })
+	})
+	resp, err := i.UnaryServerInterceptor(withKey("k1"), nil, info,
+		func(context.Context, any) (any, error) { return wrapperspb.Int32(2), nil })
+	require.NoError(t, err)
+	assert.Equal(t, int32(2), resp.(*wrapperspb.Int32Value).GetValue())
+}
+
+func TestTTLWhileDegraded(t *testing.T) {
+	t.Cleanup(degrade.Default().ClearOverride)
+	i := newIdempotency(mustLoadConfig(nil), nil)
+	assert.Equal(t, 24*time.Hour, i.ttl())
+
+	degrade.Default().Override(2)
+	assert.Equal(t, time.Hour, i.ttl())
+
+	short := newIdempotency(mustLoadConfig(map[string]any{"ttl": "10m"}), nil)
+	assert.Equal(t, 10*time.Minute, short.ttl(), "a shorter TTL is kept")
+}
+
+func TestUnaryServerInterceptor_ReplaysFirstResponse(t *testing.T) {
+	i := newIdempotency(mustLoadConfig(nil), nil)
+	info := &interceptor.UnaryServerInfo{FullMethod: "/pkg.Svc/Pay"}
+	var calls atomic.Int32
+	handler := func(context.Context, any) (any, error) {
+		n := calls.Add(1)
+		return wrapperspb.Int32(n), nil
+	}
+
+	first, err := i.UnaryServerInterceptor(withKey("k1"), nil, info, handler)
+	require.NoError(t, err)
+	second, err := i.UnaryServerInterceptor(withKey("k1"), nil, info, handler)
+	require.NoError(t, err)
+	assert.True(t, proto.Equal(first.(proto.Message), second.(proto.Message)))
+	assert.Equal(t, int32(1), calls.Load())
+
+	_, err = i.UnaryServerInterceptor(withKey("k2"), nil, info, handler)
+	require.NoError(t, err)
+	_, err = i.UnaryServerInterceptor(context.Background(), nil, info, handler)
+	require.NoError(t, err)
+	assert.Equal(t, int32(3), calls.Load())
+}
+
+func TestUnaryServerInterceptor_ReplaysError(t *testing.T) {
+	i := newIdempotency(mustLoadConfig(nil), nil)
+	info := &interceptor.UnaryServerInfo{FullMethod: "/pkg.Svc/Pay"}
+	var calls int
+	handler := func(context.Context, any) (any, error) {
+		calls++
+		return nil, status.New(code.Code_FAILED_PRECONDITION, "insufficient funds").Err()
+	}
+	for range 2 {
+		_, err := i.UnaryServerInterceptor(withKey("k"), nil, info, handler)
+		assert.Equal(t, code.Code_FAILED_PRECONDITION, status.FromError(err).Code())
+	}
+	assert.Equal(t, 1, calls)
+}
+
+func TestUnaryServerInterceptor_RejectsKeyReusedWithDifferentRequest(t *testing.T) {
+	i := newIdempotency(mustLoadConfig(nil), nil)
+	info := &interceptor.UnaryServerInfo{FullMethod: "/pkg.Svc/Pay"}
+	var calls int
+	handler := func(context.Context, any) (any, error) {
+		calls++
+		return wrapperspb.Int32(int32(calls)), nil
+	}
+
+	_, err := i.UnaryServerInterceptor(withKey("k"), wrapperspb.String("a"), info, handler)
+	require.NoError(t, err)
+	_, err = i.UnaryServerInterceptor(withKey("k"), wrapperspb.String("b"), info, handler)
+	assert.Equal(t, code.Code_INVALID_ARGUMENT, status.FromError(err).Code())
+	resp, err := i.UnaryServerInterceptor(withKey("k"), wrapperspb.String("a"), info, handler)
+	require.NoError(t, err)
+	assert.Equal(t, int32(1), resp.(*wrapperspb.Int32Value).GetValue())
+	assert.Equal(t, 1, calls)
+}
+
+func TestUnaryServerInterceptor_ScopesKeysPerCaller(t *testing.T) {
+	i := newIdempotency(mustLoadConfig(map[string]any{"caller_metadata": "X-Caller-ID"}), nil)
+	info := &interceptor.UnaryServerInfo{FullMethod: "/pkg.Svc/Pay"}
+	var calls int
+	handler := func(context.Context, any) (any, error) {
+		calls++
+		return wrapperspb.Int32(int32(calls)), nil
+	}
+	call := func(ctx context.Context) int32 {
+		resp, err := i.UnaryServerInterceptor(ctx, wrapperspb.String("req"), info, handler)
+		require.NoError(t, err)
+		return resp.(*wrapperspb.Int32Value).GetValue()
+	}
+	as := func(caller string) context.Context {
+		return metadata.WithInContext(context.Background(),
+			metadata.Pairs("idempotency-key", "k", "x-caller-id", caller))
+	}
+
+	assert.Equal(t, int32(1), call(as("alice")))
+	assert.Equal(t, int32(2), call(as("bob")))
+	assert.Equal(t, int32(1), call(as("alice")))
+	assert.Equal(t, int32(3), call(tenant.WithID(as("alice"), "acme")))
+	assert.Equal(t, int32(4), call(withKey("k")))
+
+	other := &interceptor.UnaryServerInfo{FullMethod: "/pkg.Svc/Refund"}
+	_, err := i.UnaryServerInterceptor(as("alice"), wrapperspb.String("req"), other, handler)
+	require.NoError(t, err)
+	assert.Equal(t, 5, calls)
+}
+
+func TestStoreKey_EscapesScope(t *testing.T) {
+	i := newIdempotency(mustLoadConfig(map[string]any{"caller_metadata": "x-caller-id"}), nil)
+	ctx := func(caller, key string) context.Context {
+		return metadata.WithInContext(context.Background(),
+			metadata.Pairs("idempotency-key", key, "x-caller-id", caller))
+	}
+	forged := i.storeKey(ctx("a|b", "c"), "/pkg.Svc/Pay", "c")
+	victim := i.storeKey(ctx("a", "b|c"), "/pkg.Svc/Pay", "b|c")
+	assert.NotEqual(t, victim, forged)
+	assert.Equal(t, "/pkg.Svc/Pay|k", i.storeKey(withKey("k"), "/pkg.Svc/Pay", "k"))
+}
+
+func TestUnaryServerInterceptor_RetryableErrorIsNotStored(t *testing.T) {
+	i := newIdempotency(mustLoadConfig(nil), nil)
+	info := &interceptor.UnaryServerInfo{FullMethod: "/pkg.Svc/Pay"}
+	var calls int
+	handler := func(context.Context, any) (any, error) {
+		calls++
+		if calls == 1 {
+			return nil, status.New(code.Code_UNAVAILABLE, "try later").Err()
+		}
+		return wrapperspb.String("ok"), nil
+	}
+	_, err := i.UnaryServerInterceptor(withKey("k"), nil, info, handler)
+	require.Error(t, err)
+	resp, err := i.UnaryServerInterceptor(withKey("k"), nil, info, handler)
+	require.NoError(t, err)
+	assert.Equal(t, "ok", resp.(*wrapperspb.StringValue).GetValue())
+	assert.Equal(t, 2, calls)
+}
+
+func TestUnaryServerInterceptor_ConcurrentDuplicateAborted(t *testing.T) {
+	i := newIdempotency(mustLoadConfig(nil), nil)
+	info := &interceptor.UnaryServerInfo{FullMethod: "/pkg.Svc/Pay"}
+	started := make(chan struct{})
+	release := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		_, _ = i.UnaryServerInterceptor(withKey("k"), nil, info, func(context.Context, any) (any, error) {
+			close(started)
+			<-release
+			return wrapperspb.String("ok"), nil
+		})
+	}()
+	<-started
+	_, err := i.UnaryServerInterceptor(withKey("k"), nil, info, func(context.Context, any) (any, error) {
+		t.Fatal("duplicate must not run")
+		return nil, nil
+	})
+	assert.Equal(t, code.Code_ABORTED, status.FromError(err).Code())
+	close(release)
+	wg.Wait()
+}
+
+func TestUnaryServerInterceptor_MethodsAndStore(t *testing.T) {
+	i := newIdempotency(mustLoadConfig(map[string]any{"methods": []string{"Pay"}}), nil)
+	var calls int
+	handler := func(context.Context, any) (any, error) {
+		calls++
+		return wrapperspb.String("ok"), nil
+	}
+	other := &interceptor.UnaryServerInfo{FullMethod: "/pkg.Svc/Get"}
+	for range 2 {
+		_, err := i.UnaryServerInterceptor(withKey("k"), nil, other, handler)
+		require.NoError(t, err)
+	}
+	assert.Equal(t, 2, calls)
+
+	missing := newIdempotency(mustLoadConfig(map[string]any{"store": "missing"}), nil)
+	_, err := missing.UnaryServerInterceptor(
+		withKey("k"),
+		nil,
+		&interceptor.UnaryServerInfo{FullMethod: "/pkg.Svc/Pay"},
+		handler,
+	)
+	assert.Equal(t, code.Code_INTERNAL, status.FromError(err).Code())
+
+	RegisterStore("test_redis", NewRedisStore(newFakeRedis(), ""))
+	defer RegisterStore("test_redis", nil)
+	registered := newIdempotency(mustLoadConfig(map[string]any{"store": "test_redis"}), nil)
+	assert.NotNil(t, registered.resolveStore())
+}
@@ -0,0 +1,133 @@
+// Copyright 2022 The codesjoy Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package idempotency
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	statuspb "google.golang.org/genproto/googleapis/rpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/anypb"
+)
+
+// RedisClient is the subset of Redis commands used by the Redis store.
+// IdempotencyClient in contrib/redis implements it over a go-redis client.
+type RedisClient interface {
+	// SetNX sets key to value with ttl if key does not exist and reports
+	// whether it was set.
+	SetNX(ctx context.Context, key, value string, ttl time.Duration) (bool, error)
+	// Get returns the value of key and whether it exists.
+	Get(ctx context.Context, key string) (string, bool, error)
+	// Set sets key to value with ttl.
+	Set(ctx context.Context, key, value string, ttl time.Duration) error
+	// Del deletes key.
+	Del(ctx context.Context, key string) error
+}
+
+// pendingValue marks a reserved key whose request has not completed yet.
+const pendingValue = "pending"
+
+type redisStore struct {
+	client RedisClient
+	prefix string
+}
+
+// NewRedisStore returns a store that keeps records in Redis under prefix,
+// so retries are recognized across server instances.
+func NewRedisStore(client RedisClient, prefix string) Store {
+	return &redisStore{client: client, prefix: prefix}
+}
+
+type redisRecord struct {
+	TypeURL     string `json:"type_url,omitempty"`
+	Value       []byte `json:"value,omitempty"`
+	Status      []byte `json:"status,omitempty"`
+	RequestHash []byte `json:"request_hash,omitempty"`
+}
+
+func (s *redisStore) Reserve(ctx context.Context, key string, ttl time.Duration) (*Record, error) {
+	key = s.prefix + key
+	ok, err := s.client.SetNX(ctx, key, pendingValue, ttl)
+	if err != nil {
+		return nil, err
+	}
+	if ok {
+		return nil, nil
+	}
+	value, found, err := s.client.Get(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		// The key expired in between; treat it as a concurrent holder so the
+		// client retries instead of racing another reservation.
+		return nil, ErrInProgress
+	}
+	if value == pendingValue {
+		return nil, ErrInProgress
+	}
+	return decodeRedisRecord(value)
+}
+
+func (s *redisStore) Complete(ctx context.Context, key string, rec *Record, ttl time.Duration) error {
+	value, err := encodeRedisRecord(rec)
+	if err != nil {
+		return err
+	}
+	return s.client.Set(ctx, s.prefix+key, value, ttl)
+}
+
+func (s *redisStore) Release(ctx context.Context, key string) error {
+	return s.client.Del(ctx, s.prefix+key)
+}
+
+func encodeRedisRecord(rec *Record) (string, error) {
+	out := redisRecord{RequestHash: rec.RequestHash}
+	if rec.Response != nil {
+		out.TypeURL = rec.Response.GetTypeUrl()
+		out.Value = rec.Response.GetValue()
+	}
+	if rec.Status != nil {
+		data, err := proto.Marshal(rec.Status)
+		if err != nil {
+			return "", err
+		}
+		out.Status = data
+	}
+	data, err := json.Marshal(out)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+func decodeRedisRecord(value string) (*Record, error) {
+	var in redisRecord
+	if err := json.Unmarshal([]byte(value), &in); err != nil {
+		return nil, err
+	}
+	rec := &Record{RequestHash: in.RequestHash}
+	if in.Status != nil {
+		rec.Status = &statuspb.Status{}
+		if err := proto.Unmarshal(in.Status, rec.Status); err != nil {
+			return nil, err
+		}
+	} else {
+		rec.Response = &anypb.Any{TypeUrl: in.TypeURL, Value: in.Value}
+	}
+	return rec, nil
+}
@@ -0,0 +1,179 @@
+// Copyright 2022 The codesjoy Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package idempotency
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	statuspb "google.golang.org/genproto/googleapis/rpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/anypb"
+
+	"github.com/codesjoy/yggdrasil/v3/rpc/status"
+)
+
+// ErrInProgress is returned by Store.Reserve when another request holds the key.
+var ErrInProgress = errors.New("idempotency: request in progress")
+
+// Record is the stored outcome of the first request for a key.
+type Record struct {
+	// Response is the response message, nil when the request failed.
+	Response *anypb.Any
+	// Status is the error status, nil when the request succeeded.
+	Status *statuspb.Status
+	// RequestHash is the SHA-256 of the request the record answers, nil
+	// when the request could not be hashed.
+	RequestHash []byte
+}
+
+func newRecord(resp any, err error) (*Record, error) {
+	if err != nil {
+		return &Record{Status: status.FromError(err).Status()}, nil
+	}
+	msg, ok := resp.(proto.Message)
+	if !ok {
+		return nil, fmt.Errorf("response %T is not a proto message", resp)
+	}
+	anyResp, err := anypb.New(msg)
+	if err != nil {
+		return nil, err
+	}
+	return &Record{Response: anyResp}, nil
+}
+
+func (r *Record) replay() (any, error) {
+	if r.Status != nil {
+		return nil, status.FromProto(r.Status).Err()
+	}
+	if r.Response == nil {
+		return nil, errors.New("idempotency: empty record")
+	}
+	return r.Response.UnmarshalNew()
+}
+
+// Store keeps idempotency records.
+type Store interface {
+	// Reserve claims key for ttl. It returns the completed record when one
+	// exists, ErrInProgress when another request holds the key, and a nil
+	// record when the caller now holds the key.
+	Reserve(ctx context.Context, key string, ttl time.Duration) (*Record, error)
+	// Complete stores the record for key, replacing the reservation.
+	Complete(ctx context.Context, key string, rec *Record, ttl time.Duration) error
+	// Release drops the reservation so the next request runs again.
+	Release(ctx context.Context, key string) error
+}
+
+var (
+	mu     sync.RWMutex
+	stores = map[string]Store{}
+)
+
+// RegisterStore registers a named store, e.g. a Redis backed one built with
+// NewRedisStore. The name "memory" is reserved for the builtin LRU store.
+func RegisterStore(name string, store Store) {
+	mu.Lock()
+	defer mu.Unlock()
+	stores[name] = store
+}
+
+// GetStore returns a registered store by name.
+func GetStore(name string) Store {
+	mu.RLock()
+	defer mu.RUnlock()
+	return stores[name]
+}
+
+type memoryEntry struct {
+	key      string
+	rec      *Record
+	expireAt time.Time
+}
+
+// memoryStore is an in-memory LRU store bounded by maxEntries.
+type memoryStore struct {
+	mu         sync.Mutex
+	maxEntries int
+	ll         *list.List
+	items      map[string]*list.Element
+	now        func() time.Time
+}
+
+// NewMemoryStore returns an in-memory store that keeps at most maxEntries
+// records and evicts the least recently used ones first.
+func NewMemoryStore(maxEntries int) Store {
+	return &memoryStore{
+		maxEntries: maxEntries,
+		ll:         list.New(),
+		items:      map[string]*list.Element{},
+		now:        time.Now,
+	}
+}
+
+func (s *memoryStore) Reserve(_ context.Context, key string, ttl time.Duration) (*Record, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := s.now()
+	if elem, ok := s.items[key]; ok {
+		entry := elem.Value.(*memoryEntry)
+		if now.Before(entry.expireAt) {
+			if entry.rec == nil {
+				return nil, ErrInProgress
+			}
+			s.ll.MoveToFront(elem)
+			return entry.rec, nil
+		}
+		s.remove(elem)
+	}
+	s.items[key] = s.ll.PushFront(&memoryEntry{key: key, expireAt: now.Add(ttl)})
+	for s.maxEntries > 0 && s.ll.Len() > s.maxEntries {
+		s.remove(s.ll.Back())
+	}
+	return nil, nil
+}
+
+func (s *memoryStore) Complete(_ context.Context, key string, rec *Record, ttl time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	entry := &memoryEntry{key: key, rec: rec, expireAt: s.now().Add(ttl)}
+	if elem, ok := s.items[key]; ok {
+		elem.Value = entry
+		s.ll.MoveToFront(elem)
+		return nil
+	}
+	s.items[key] = s.ll.PushFront(entry)
+	for s.maxEntries > 0 && s.ll.Len() > s.maxEntries {
+		s.remove(s.ll.Back())
+	}
+	return nil
+}
+
+func (s *memoryStore) Release(_ context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if elem, ok := s.items[key]; ok {
+		s.remove(elem)
+	}
+	return nil
+}
+
+func (s *memoryStore) remove(elem *list.Element) {
+	s.ll.Remove(elem)
+	delete(s.items, elem.Value.(*memoryEntry).key)
+}
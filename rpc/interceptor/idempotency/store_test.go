@@ -0,0 +1,163 @@
+// Copyright 2022 The codesjoy Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package idempotency
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/genproto/googleapis/rpc/code"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+
+	"github.com/codesjoy/yggdrasil/v3/rpc/status"
+)
+
+func TestMemoryStore_ReserveCompleteRelease(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStore(0)
+
+	rec, err := store.Reserve(ctx, "k", time.Minute)
+	require.NoError(t, err)
+	assert.Nil(t, rec)
+
+	_, err = store.Reserve(ctx, "k", time.Minute)
+	assert.ErrorIs(t, err, ErrInProgress)
+
+	want, err := newRecord(wrapperspb.String("v"), nil)
+	require.NoError(t, err)
+	require.NoError(t, store.Complete(ctx, "k", want, time.Minute))
+	rec, err = store.Reserve(ctx, "k", time.Minute)
+	require.NoError(t, err)
+	assert.Same(t, want, rec)
+
+	require.NoError(t, store.Release(ctx, "k"))
+	rec, err = store.Reserve(ctx, "k", time.Minute)
+	require.NoError(t, err)
+	assert.Nil(t, rec)
+}
+
+func TestMemoryStore_ExpiryAndEviction(t *testing.T) {
+	ctx := context.Background()
+	now := time.Unix(100, 0)
+	store := NewMemoryStore(2).(*memoryStore)
+	store.now = func() time.Time { return now }
+
+	_, err := store.Reserve(ctx, "a", time.Second)
+	require.NoError(t, err)
+	now = now.Add(2 * time.Second)
+	rec, err := store.Reserve(ctx, "a", time.Second)
+	require.NoError(t, err, "expired reservation is reclaimed")
+	assert.Nil(t, rec)
+
+	_, err = store.Reserve(ctx, "b", time.Minute)
+	require.NoError(t, err)
+	_, err = store.Reserve(ctx, "c", time.Minute)
+	require.NoError(t, err)
+	assert.Equal(t, 2, store.ll.Len())
+	_, ok := store.items["a"]
+	assert.False(t, ok, "least recently used entry is evicted")
+}
+
+type fakeRedis struct {
+	mu   sync.Mutex
+	data map[string]string
+	err  error
+}
+
+func newFakeRedis() *fakeRedis {
+	return &fakeRedis{data: map[string]string{}}
+}
+
+func (r *fakeRedis) SetNX(_ context.Context, key, value string, _ time.Duration) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.err != nil {
+		return false, r.err
+	}
+	if _, ok := r.data[key]; ok {
+		return false, nil
+	}
+	r.data[key] = value
+	return true, nil
+}
+
+func (r *fakeRedis) Get(_ context.Context, key string) (string, bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	value, ok := r.data[key]
+	return value, ok, r.err
+}
+
+func (r *fakeRedis) Set(_ context.Context, key, value string, _ time.Duration) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.data[key] = value
+	return r.err
+}
+
+func (r *fakeRedis) Del(_ context.Context, key string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.data, key)
+	return r.err
+}
+
+func TestRedisStore(t *testing.T) {
+	ctx := context.Background()
+	client := newFakeRedis()
+	store := NewRedisStore(client, "idem:")
+
+	rec, err := store.Reserve(ctx, "k", time.Minute)
+	require.NoError(t, err)
+	assert.Nil(t, rec)
+	assert.Equal(t, pendingValue, client.data["idem:k"])
+
+	_, err = store.Reserve(ctx, "k", time.Minute)
+	assert.ErrorIs(t, err, ErrInProgress)
+
+	ok, err := newRecord(wrapperspb.String("v"), nil)
+	require.NoError(t, err)
+	ok.RequestHash = requestHash(wrapperspb.String("req"))
+	require.NoError(t, store.Complete(ctx, "k", ok, time.Minute))
+	rec, err = store.Reserve(ctx, "k", time.Minute)
+	require.NoError(t, err)
+	assert.Equal(t, ok.RequestHash, rec.RequestHash)
+	resp, err := rec.replay()
+	require.NoError(t, err)
+	assert.True(t, proto.Equal(wrapperspb.String("v"), resp.(proto.Message)))
+
+	failed, err := newRecord(nil, status.New(code.Code_INVALID_ARGUMENT, "bad").Err())
+	require.NoError(t, err)
+	require.NoError(t, store.Complete(ctx, "f", failed, time.Minute))
+	rec, err = store.Reserve(ctx, "f", time.Minute)
+	require.NoError(t, err)
+	_, err = rec.replay()
+	assert.Equal(t, code.Code_INVALID_ARGUMENT, status.FromError(err).Code())
+	assert.Equal(t, "bad", status.FromError(err).Message())
+
+	require.NoError(t, store.Release(ctx, "k"))
+	_, exists := client.data["idem:k"]
+	assert.False(t, exists)
+
+	client.err = errors.New("down")
+	_, err = store.Reserve(ctx, "x", time.Minute)
+	assert.EqualError(t, err, "down")
+}
@@ -22,6 +22,7 @@ import (
 	"log/slog"
 	"sync"
 
+	"github.com/codesjoy/yggdrasil/v3/rpc/interceptor/tuning"
 	"github.com/codesjoy/yggdrasil/v3/rpc/stream"
 )
 
@@ -479,7 +480,7 @@ func ChainUnaryServerInterceptorsWithProviders(
 			slog.Warn("not found unary server interceptor", slog.String("name", item))
 			continue
 		}
-		interceptors = append(interceptors, provider.New())
+		interceptors = append(interceptors, tunableUnaryServer(item, provider.New()))
 	}
 
 	if len(interceptors) == 0 {
@@ -537,7 +538,7 @@ func ChainStreamServerInterceptorsWithProviders(
 			slog.Warn("not found stream server interceptor", slog.String("name", item))
 			continue
 		}
-		interceptors = append(interceptors, provider.New())
+		interceptors = append(interceptors, tunableStreamServer(item, provider.New()))
 	}
 
 	if len(interceptors) == 0 {
@@ -570,3 +571,24 @@ func getChainStreamHandler(
 		)
 	}
 }
+
+// tunableUnaryServer bypasses the interceptor name for the methods it is
+// disabled for through the tuning.
+func tunableUnaryServer(name string, next UnaryServerInterceptor) UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *UnaryServerInfo, handler UnaryHandler) (any, error) {
+		if tuning.Disabled(name, info.FullMethod) {
+			return handler(ctx, req)
+		}
+		return next(ctx, req, info, handler)
+	}
+}
+
+// tunableStreamServer is the stream variant of tunableUnaryServer.
+func tunableStreamServer(name string, next StreamServerInterceptor) StreamServerInterceptor {
+	return func(srv any, ss stream.ServerStream, info *StreamServerInfo, handler stream.Handler) error {
+		if tuning.Disabled(name, info.FullMethod) {
+			return handler(srv, ss)
+		}
+		return next(srv, ss, info, handler)
+	}
+}
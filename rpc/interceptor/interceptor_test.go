@@ -24,6 +24,9 @@ import (
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 
+	"github.com/codesjoy/yggdrasil/v3/config"
+	"github.com/codesjoy/yggdrasil/v3/module"
+	"github.com/codesjoy/yggdrasil/v3/rpc/interceptor/tuning"
 	"github.com/codesjoy/yggdrasil/v3/rpc/metadata"
 	"github.com/codesjoy/yggdrasil/v3/rpc/stream"
 )
@@ -1003,3 +1006,56 @@ func TestChainWithProviders_MissingProvider(t *testing.T) {
 		assert.NoError(t, err)
 	})
 }
+
+func TestChainWithProviders_TuningDisabled(t *testing.T) {
+	m := tuning.Module()
+	require.NoError(t, m.(module.Initializable).Init(context.Background(),
+		config.NewView(tuning.ConfigPath, config.NewSnapshot(map[string]any{
+			"disabled": map[string]any{"b": []any{"pkg.Greeter"}},
+		}))))
+	t.Cleanup(func() { _ = m.(module.Stoppable).Stop(context.Background()) })
+
+	var calls []string
+	unary := func(name string) UnaryServerInterceptorProvider {
+		return NewUnaryServerInterceptorProvider(name, func() UnaryServerInterceptor {
+			return func(ctx context.Context, req any, _ *UnaryServerInfo, h UnaryHandler) (any, error) {
+				calls = append(calls, name)
+				return h(ctx, req)
+			}
+		})
+	}
+	chain := ChainUnaryServerInterceptorsWithProviders([]string{"a", "b"},
+		map[string]UnaryServerInterceptorProvider{"a": unary("a"), "b": unary("b")})
+	handler := func(context.Context, any) (any, error) { return "resp", nil }
+	_, err := chain(context.Background(), "req",
+		&UnaryServerInfo{FullMethod: "/pkg.Greeter/SayHello"}, handler)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"a"}, calls)
+
+	calls = nil
+	_, err = chain(context.Background(), "req",
+		&UnaryServerInfo{FullMethod: "/pkg.Other/Get"}, handler)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"a", "b"}, calls)
+
+	streamed := false
+	streamChain := ChainStreamServerInterceptorsWithProviders([]string{"b"},
+		map[string]StreamServerInterceptorProvider{
+			"b": NewStreamServerInterceptorProvider("b", func() StreamServerInterceptor {
+				return func(any, stream.ServerStream, *StreamServerInfo, stream.Handler) error {
+					return errors.New("not skipped")
+				}
+			}),
+		})
+	err = streamChain(&struct{}{}, &mockServerStream{},
+		&StreamServerInfo{FullMethod: "/pkg.Greeter/Chat"},
+		func(any, stream.ServerStream) error { streamed = true; return nil })
+	require.NoError(t, err)
+	assert.True(t, streamed)
+}
+
+func TestWithIdempotent(t *testing.T) {
+	ctx := context.Background()
+	assert.False(t, IsIdempotent(ctx))
+	assert.True(t, IsIdempotent(WithIdempotent(ctx)))
+}
@@ -19,12 +19,21 @@ import (
 	"context"
 	"fmt"
 	"log/slog"
+	"maps"
 	"net/http"
 	"runtime"
+	"slices"
 	"time"
 
 	"github.com/codesjoy/yggdrasil/v3/config"
+	"github.com/codesjoy/yggdrasil/v3/degrade"
+	"github.com/codesjoy/yggdrasil/v3/internal/xclock"
+	"github.com/codesjoy/yggdrasil/v3/observability/crashreport"
+	"github.com/codesjoy/yggdrasil/v3/observability/logger"
 	"github.com/codesjoy/yggdrasil/v3/rpc/interceptor"
+	"github.com/codesjoy/yggdrasil/v3/rpc/interceptor/matcher"
+	"github.com/codesjoy/yggdrasil/v3/rpc/interceptor/tuning"
+	"github.com/codesjoy/yggdrasil/v3/rpc/metadata"
 	"github.com/codesjoy/yggdrasil/v3/rpc/status"
 	"github.com/codesjoy/yggdrasil/v3/rpc/stream"
 )
@@ -36,8 +45,21 @@ const (
 
 // Config defines the logger configuration.
 type Config struct {
-	SlowThreshold  time.Duration `default:"1s"`
-	PrintReqAndRes bool
+	SlowThreshold  time.Duration `mapstructure:"slow_threshold" default:"1s"`
+	PrintReqAndRes bool          `mapstructure:"print_req_and_res"`
+	// PrintReqAndResWhen restricts PrintReqAndRes to calls matching a
+	// matcher expression, e.g. "method:/pkg.Service/Method || header:x-debug=1".
+	PrintReqAndResWhen string `mapstructure:"print_req_and_res_when"`
+	// StreamMessageLogEvery logs every Nth message of each streaming RPC
+	// direction, starting with the first. Zero disables per-message logs.
+	StreamMessageLogEvery int `mapstructure:"stream_message_log_every"`
+	// ContextMetadata maps incoming metadata keys to the log attributes the
+	// server interceptors append to the request context with
+	// logger.AppendCtx, so every line logged with that context carries them.
+	// Unset maps "x-request-id" to "request_id"; an empty map disables it.
+	ContextMetadata map[string]string `mapstructure:"context_metadata"`
+
+	printWhen *matcher.Matcher
 }
 
 func providerNames() []string {
@@ -157,11 +179,79 @@ func mustLoadConfig(source any) *Config {
 	if err := config.NewSnapshot(source).Decode(&cfg); err != nil {
 		panic(fmt.Sprintf("load logging interceptor config: %v", err))
 	}
+	printWhen, err := matcher.Parse(cfg.PrintReqAndResWhen)
+	if err != nil {
+		panic(fmt.Sprintf("load logging interceptor config: %v", err))
+	}
+	cfg.printWhen = printWhen
+	if cfg.ContextMetadata == nil {
+		cfg.ContextMetadata = map[string]string{"x-request-id": "request_id"}
+	}
 	return &cfg
 }
 
+// overrides holds the parameters adjusted at runtime under the "logging"
+// section of the tuning.
+type overrides struct {
+	SlowThreshold  time.Duration `mapstructure:"slow_threshold"`
+	PrintReqAndRes *bool         `mapstructure:"print_req_and_res"`
+}
+
+var tuned = tuning.NewValue[overrides](typeLogging)
+
+// printDegradation suspends request and response logging while the process
+// is degraded.
+var printDegradation = degrade.Default().Register("logging.print_req_and_res", 1)
+
 type logging struct {
 	cfg *Config
+	// clock measures call durations; nil means the real clock.
+	clock xclock.Clock
+}
+
+func (l *logging) now() time.Time {
+	return xclock.OrReal(l.clock).Now()
+}
+
+func (l *logging) since(t time.Time) time.Duration {
+	return xclock.OrReal(l.clock).Since(t)
+}
+
+func (l *logging) slowThreshold() time.Duration {
+	if o, ok := tuned.Get(); ok && o.SlowThreshold > 0 {
+		return o.SlowThreshold
+	}
+	return l.cfg.SlowThreshold
+}
+
+func (l *logging) printReqAndRes() bool {
+	if printDegradation.Degraded() {
+		return false
+	}
+	if o, ok := tuned.Get(); ok && o.PrintReqAndRes != nil {
+		return *o.PrintReqAndRes
+	}
+	return l.cfg.PrintReqAndRes
+}
+
+// appendContext attaches the configured incoming metadata to ctx as log
+// attributes.
+func (l *logging) appendContext(ctx context.Context) context.Context {
+	if len(l.cfg.ContextMetadata) == 0 {
+		return ctx
+	}
+	md, ok := metadata.FromInContext(ctx)
+	if !ok {
+		return ctx
+	}
+	keys := slices.Sorted(maps.Keys(l.cfg.ContextMetadata))
+	attrs := make([]slog.Attr, 0, len(keys))
+	for _, key := range keys {
+		if values := md.Get(key); len(values) > 0 && values[0] != "" {
+			attrs = append(attrs, slog.String(l.cfg.ContextMetadata[key], values[0]))
+		}
+	}
+	return logger.AppendCtx(ctx, attrs...)
 }
 
 // UnaryServerInterceptor is a unary server interceptor.
@@ -171,15 +261,17 @@ func (l *logging) UnaryServerInterceptor(
 	info *interceptor.UnaryServerInfo,
 	handler interceptor.UnaryHandler,
 ) (resp interface{}, err error) {
-	startTime := time.Now()
+	startTime := l.now()
+	ctx = l.appendContext(ctx)
+	printBodies := l.printReqAndRes() && l.cfg.printWhen.MatchServer(ctx, info.FullMethod)
 	defer func() {
 		var (
 			st     = status.FromError(err)
 			fields = make([]slog.Attr, 0)
 			event  = "normal"
-			cost   = time.Since(startTime)
+			cost   = l.since(startTime)
 		)
-		if l.cfg.SlowThreshold <= cost {
+		if l.slowThreshold() <= cost {
 			event = "slow"
 		}
 		if rec := recover(); rec != nil {
@@ -192,6 +284,7 @@ func (l *logging) UnaryServerInterceptor(
 			st = status.FromError(err)
 			stack := make([]byte, 4096)
 			stack = stack[:runtime.Stack(stack, true)]
+			crashreport.Recovered(ctx, crashreport.SourceUnaryServer, info.FullMethod, rec, stack)
 			fields = append(fields, slog.String("stack", string(stack)))
 			event = "recover"
 		}
@@ -201,7 +294,7 @@ func (l *logging) UnaryServerInterceptor(
 			slog.Float64("cost", float64(cost)/float64(time.Millisecond)),
 			slog.Int("code", int(st.Code())),
 			slog.String("event", event))
-		if l.cfg.PrintReqAndRes {
+		if printBodies {
 			fields = append(fields, slog.Any("req", req))
 		}
 		var lv slog.Level
@@ -213,7 +306,7 @@ func (l *logging) UnaryServerInterceptor(
 				lv = slog.LevelWarn
 			}
 		} else {
-			if l.cfg.PrintReqAndRes {
+			if printBodies {
 				fields = append(fields, slog.Any("res", resp))
 			}
 			lv = slog.LevelInfo
@@ -230,13 +323,19 @@ func (l *logging) StreamServerInterceptor(
 	info *interceptor.StreamServerInfo,
 	handler stream.Handler,
 ) (err error) {
-	startTime := time.Now()
+	startTime := l.now()
+	ls := &loggingServerStream{
+		ServerStream: ss,
+		ctx:          l.appendContext(ss.Context()),
+		l:            l,
+		method:       info.FullMethod,
+	}
 	defer func() {
 		var (
 			st     = status.FromError(err)
 			fields = make([]slog.Attr, 0)
 			event  = "normal"
-			cost   = time.Since(startTime)
+			cost   = l.since(startTime)
 		)
 		if rec := recover(); rec != nil {
 			switch rec := rec.(type) {
@@ -248,6 +347,9 @@ func (l *logging) StreamServerInterceptor(
 			st = status.FromError(err)
 			stack := make([]byte, 4096)
 			stack = stack[:runtime.Stack(stack, true)]
+			crashreport.Recovered(
+				ss.Context(), crashreport.SourceStreamServer, info.FullMethod, rec, stack,
+			)
 			fields = append(fields, slog.String("stack", string(stack)))
 			event = "recover"
 		}
@@ -257,6 +359,7 @@ func (l *logging) StreamServerInterceptor(
 			slog.Float64("cost", float64(cost)/float64(time.Millisecond)),
 			slog.String("event", event),
 			slog.Int("code", int(st.Code())))
+		fields = append(fields, ls.stats.attrs()...)
 		var lv slog.Level
 		if err != nil {
 			fields = append(fields, slog.Any("error", err))
@@ -268,9 +371,9 @@ func (l *logging) StreamServerInterceptor(
 		} else {
 			lv = slog.LevelInfo
 		}
-		slog.LogAttrs(ss.Context(), lv, "access", fields...)
+		slog.LogAttrs(ls.Context(), lv, "access", fields...)
 	}()
-	return handler(srv, ss)
+	return handler(srv, ls)
 }
 
 // UnaryClientInterceptor is a unary client interceptor.
@@ -280,15 +383,16 @@ func (l *logging) UnaryClientInterceptor(
 	req, reply any,
 	invoker interceptor.UnaryInvoker,
 ) (err error) {
-	startTime := time.Now()
+	startTime := l.now()
+	printBodies := l.printReqAndRes() && l.cfg.printWhen.MatchClient(ctx, method)
 	defer func() {
 		var (
 			st     = status.FromError(err)
 			fields = make([]slog.Attr, 0)
 			event  = "normal"
-			cost   = time.Since(startTime)
+			cost   = l.since(startTime)
 		)
-		if l.cfg.SlowThreshold <= cost {
+		if l.slowThreshold() <= cost {
 			event = "slow"
 		}
 		if rec := recover(); rec != nil {
@@ -301,6 +405,7 @@ func (l *logging) UnaryClientInterceptor(
 			st = status.FromError(err)
 			stack := make([]byte, 4096)
 			stack = stack[:runtime.Stack(stack, true)]
+			crashreport.Recovered(ctx, crashreport.SourceUnaryClient, method, rec, stack)
 			fields = append(fields, slog.String("stack", string(stack)))
 			event = "recover"
 		}
@@ -310,7 +415,7 @@ func (l *logging) UnaryClientInterceptor(
 			slog.Float64("cost", float64(cost)/float64(time.Millisecond)),
 			slog.Int("code", int(st.Code())),
 			slog.String("event", event))
-		if l.cfg.PrintReqAndRes {
+		if printBodies {
 			fields = append(fields, slog.Any("req", req))
 		}
 
@@ -323,10 +428,10 @@ func (l *logging) UnaryClientInterceptor(
 				lv = slog.LevelWarn
 			}
 		} else {
-			if l.cfg.PrintReqAndRes {
+			if printBodies {
 				fields = append(fields, slog.Any("res", reply))
 			}
-			if l.cfg.SlowThreshold <= cost {
+			if l.slowThreshold() <= cost {
 				lv = slog.LevelWarn
 			} else {
 				lv = slog.LevelInfo
@@ -345,13 +450,13 @@ func (l *logging) StreamClientInterceptor(
 	method string,
 	streamer interceptor.Streamer,
 ) (res stream.ClientStream, err error) {
-	startTime := time.Now()
+	startTime := l.now()
 	defer func() {
 		var (
 			st     = status.FromError(err)
 			fields = make([]slog.Attr, 0)
 			event  = "normal"
-			cost   = time.Since(startTime)
+			cost   = l.since(startTime)
 		)
 		if rec := recover(); rec != nil {
 			switch rec := rec.(type) {
@@ -363,6 +468,7 @@ func (l *logging) StreamClientInterceptor(
 			st = status.FromError(err)
 			stack := make([]byte, 4096)
 			stack = stack[:runtime.Stack(stack, true)]
+			crashreport.Recovered(ctx, crashreport.SourceStreamClient, method, rec, stack)
 			fields = append(fields, slog.String("stack", string(stack)))
 			event = "recover"
 		}
@@ -386,5 +492,16 @@ func (l *logging) StreamClientInterceptor(
 		}
 		slog.LogAttrs(ctx, lv, "access", fields...)
 	}()
-	return streamer(ctx, desc, method)
+	cs, err := streamer(ctx, desc, method)
+	if err != nil {
+		return nil, err
+	}
+	return &loggingClientStream{
+		ClientStream:  cs,
+		l:             l,
+		ctx:           ctx,
+		method:        method,
+		serverStreams: desc.ServerStreams,
+		start:         startTime,
+	}, nil
 }
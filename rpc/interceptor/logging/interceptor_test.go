@@ -23,8 +23,15 @@ import (
 
 	"github.com/codesjoy/pkg/basic/xerror"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 
+	"github.com/codesjoy/yggdrasil/v3/config"
+	"github.com/codesjoy/yggdrasil/v3/degrade"
+	"github.com/codesjoy/yggdrasil/v3/internal/xclock"
+	"github.com/codesjoy/yggdrasil/v3/module"
+	"github.com/codesjoy/yggdrasil/v3/observability/logger"
 	"github.com/codesjoy/yggdrasil/v3/rpc/interceptor"
+	"github.com/codesjoy/yggdrasil/v3/rpc/interceptor/tuning"
 	"github.com/codesjoy/yggdrasil/v3/rpc/metadata"
 	"github.com/codesjoy/yggdrasil/v3/rpc/stream"
 
@@ -107,6 +114,136 @@ func TestConfig(t *testing.T) {
 	})
 }
 
+func TestMustLoadConfig_PrintReqAndResWhen(t *testing.T) {
+	cfg := mustLoadConfig(map[string]any{
+		"slow_threshold":         "2s",
+		"print_req_and_res":      true,
+		"print_req_and_res_when": "method:/library.v1.LibraryService/MoveBook || header:x-debug=1",
+	})
+	assert.Equal(t, 2*time.Second, cfg.SlowThreshold)
+	assert.True(t, cfg.PrintReqAndRes)
+	assert.NotNil(t, cfg.printWhen)
+
+	assert.Panics(t, func() {
+		mustLoadConfig(map[string]any{"print_req_and_res_when": "method:/a &&"})
+	})
+}
+
+type recordHandler struct {
+	records *[]slog.Record
+}
+
+func (h recordHandler) Enabled(context.Context, slog.Level) bool { return true }
+func (h recordHandler) Handle(_ context.Context, r slog.Record) error {
+	*h.records = append(*h.records, r)
+	return nil
+}
+func (h recordHandler) WithAttrs([]slog.Attr) slog.Handler { return h }
+func (h recordHandler) WithGroup(string) slog.Handler      { return h }
+
+func recordHasAttr(r slog.Record, key string) bool {
+	found := false
+	r.Attrs(func(a slog.Attr) bool {
+		if a.Key == key {
+			found = true
+			return false
+		}
+		return true
+	})
+	return found
+}
+
+func TestLogging_PrintReqAndResWhen(t *testing.T) {
+	var records []slog.Record
+	prev := slog.Default()
+	slog.SetDefault(slog.New(recordHandler{records: &records}))
+	defer slog.SetDefault(prev)
+
+	l := &logging{cfg: mustLoadConfig(map[string]any{
+		"print_req_and_res":      true,
+		"print_req_and_res_when": "method:/library.v1.LibraryService/MoveBook || header:x-debug=1",
+	})}
+	handler := func(context.Context, interface{}) (interface{}, error) { return "response", nil }
+	call := func(ctx context.Context, method string) {
+		_, err := l.UnaryServerInterceptor(
+			ctx,
+			"request",
+			&interceptor.UnaryServerInfo{FullMethod: method},
+			handler,
+		)
+		assert.NoError(t, err)
+	}
+
+	call(context.Background(), "/library.v1.LibraryService/MoveBook")
+	call(context.Background(), "/library.v1.LibraryService/GetBook")
+	call(
+		metadata.WithInContext(context.Background(), metadata.Pairs("x-debug", "1")),
+		"/library.v1.LibraryService/GetBook",
+	)
+
+	if assert.Len(t, records, 3) {
+		assert.True(t, recordHasAttr(records[0], "req"))
+		assert.True(t, recordHasAttr(records[0], "res"))
+		assert.False(t, recordHasAttr(records[1], "req"))
+		assert.True(t, recordHasAttr(records[2], "req"))
+	}
+
+	records = nil
+	invoker := func(context.Context, string, any, any) error { return nil }
+	assert.NoError(t, l.UnaryClientInterceptor(
+		context.Background(), "/library.v1.LibraryService/GetBook", "req", "reply", invoker,
+	))
+	if assert.Len(t, records, 1) {
+		assert.False(t, recordHasAttr(records[0], "req"))
+	}
+}
+
+func TestLogging_Tuning(t *testing.T) {
+	var records []slog.Record
+	prev := slog.Default()
+	slog.SetDefault(slog.New(recordHandler{records: &records}))
+	defer slog.SetDefault(prev)
+
+	m := tuning.Module()
+	require.NoError(t, m.(module.Initializable).Init(context.Background(),
+		config.NewView(tuning.ConfigPath, config.NewSnapshot(map[string]any{
+			"logging": map[string]any{"slow_threshold": "1ns", "print_req_and_res": true},
+		}))))
+	t.Cleanup(func() { _ = m.(module.Stoppable).Stop(context.Background()) })
+
+	l := &logging{cfg: mustLoadConfig(map[string]any{"slow_threshold": "1h"})}
+	_, err := l.UnaryServerInterceptor(
+		context.Background(),
+		"request",
+		&interceptor.UnaryServerInfo{FullMethod: "/pkg.Greeter/SayHello"},
+		func(context.Context, any) (any, error) { return "response", nil },
+	)
+	require.NoError(t, err)
+	if assert.Len(t, records, 1) {
+		assert.True(t, recordHasAttr(records[0], "req"))
+		records[0].Attrs(func(a slog.Attr) bool {
+			if a.Key == "event" {
+				assert.Equal(t, "slow", a.Value.String())
+			}
+			return true
+		})
+	}
+
+	require.NoError(t, m.(module.Stoppable).Stop(context.Background()))
+	assert.Equal(t, time.Hour, l.slowThreshold())
+	assert.False(t, l.printReqAndRes())
+}
+
+func TestPrintReqAndResSuspendedWhileDegraded(t *testing.T) {
+	t.Cleanup(degrade.Default().ClearOverride)
+	l := &logging{cfg: &Config{PrintReqAndRes: true}}
+	assert.True(t, l.printReqAndRes())
+	degrade.Default().Override(1)
+	assert.False(t, l.printReqAndRes())
+	degrade.Default().ClearOverride()
+	assert.True(t, l.printReqAndRes())
+}
+
 // TestLogging_UnaryServerInterceptor tests UnaryServerInterceptor method
 func TestLogging_UnaryServerInterceptor(t *testing.T) {
 	t.Run("successful call", func(t *testing.T) {
@@ -147,7 +284,8 @@ func TestLogging_UnaryServerInterceptor(t *testing.T) {
 	})
 
 	t.Run("slow call detection", func(t *testing.T) {
-		l := &logging{cfg: &Config{SlowThreshold: 10 * time.Millisecond}}
+		clock := xclock.NewFake(time.Unix(0, 0))
+		l := &logging{cfg: &Config{SlowThreshold: 10 * time.Millisecond}, clock: clock}
 
 		info := &interceptor.UnaryServerInfo{
 			Server:     &struct{}{},
@@ -155,7 +293,7 @@ func TestLogging_UnaryServerInterceptor(t *testing.T) {
 		}
 
 		handler := func(_ context.Context, _ interface{}) (interface{}, error) {
-			time.Sleep(50 * time.Millisecond)
+			clock.Advance(50 * time.Millisecond)
 			return "response", nil
 		}
 
@@ -312,7 +450,8 @@ func TestLogging_StreamServerInterceptor(t *testing.T) {
 	})
 
 	t.Run("slow call detection", func(t *testing.T) {
-		l := &logging{cfg: &Config{SlowThreshold: 10 * time.Millisecond}}
+		clock := xclock.NewFake(time.Unix(0, 0))
+		l := &logging{cfg: &Config{SlowThreshold: 10 * time.Millisecond}, clock: clock}
 
 		info := &interceptor.StreamServerInfo{
 			FullMethod:     "/test.service/StreamMethod",
@@ -324,7 +463,7 @@ func TestLogging_StreamServerInterceptor(t *testing.T) {
 		srv := &struct{}{}
 
 		handler := func(interface{}, stream.ServerStream) error {
-			time.Sleep(50 * time.Millisecond)
+			clock.Advance(50 * time.Millisecond)
 			return nil
 		}
 
@@ -374,10 +513,11 @@ func TestLogging_UnaryClientInterceptor(t *testing.T) {
 	})
 
 	t.Run("slow call detection", func(t *testing.T) {
-		l := &logging{cfg: &Config{SlowThreshold: 10 * time.Millisecond}}
+		clock := xclock.NewFake(time.Unix(0, 0))
+		l := &logging{cfg: &Config{SlowThreshold: 10 * time.Millisecond}, clock: clock}
 
 		invoker := func(_ context.Context, _ string, _ interface{}, _ interface{}) error {
-			time.Sleep(50 * time.Millisecond)
+			clock.Advance(50 * time.Millisecond)
 			return nil
 		}
 
@@ -433,10 +573,16 @@ func TestLogging_UnaryClientInterceptor(t *testing.T) {
 	})
 
 	t.Run("slow successful call logs at warn level", func(t *testing.T) {
-		l := &logging{cfg: &Config{SlowThreshold: 10 * time.Millisecond}}
+		var records []slog.Record
+		prev := slog.Default()
+		slog.SetDefault(slog.New(recordHandler{records: &records}))
+		defer slog.SetDefault(prev)
+
+		clock := xclock.NewFake(time.Unix(0, 0))
+		l := &logging{cfg: &Config{SlowThreshold: 10 * time.Millisecond}, clock: clock}
 
 		invoker := func(_ context.Context, _ string, _ interface{}, _ interface{}) error {
-			time.Sleep(50 * time.Millisecond)
+			clock.Advance(50 * time.Millisecond)
 			return nil
 		}
 
@@ -449,6 +595,15 @@ func TestLogging_UnaryClientInterceptor(t *testing.T) {
 		)
 
 		assert.NoError(t, err)
+		if assert.Len(t, records, 1) {
+			assert.Equal(t, slog.LevelWarn, records[0].Level)
+			records[0].Attrs(func(a slog.Attr) bool {
+				if a.Key == "event" {
+					assert.Equal(t, "slow", a.Value.String())
+				}
+				return true
+			})
+		}
 	})
 
 	t.Run("fast successful call logs at info level", func(t *testing.T) {
@@ -633,6 +788,58 @@ func TestLogging_ContextPropagation(t *testing.T) {
 	})
 }
 
+func TestLogging_ContextMetadata(t *testing.T) {
+	cfg := mustLoadConfig(nil)
+	assert.Equal(t, map[string]string{"x-request-id": "request_id"}, cfg.ContextMetadata)
+	cfg = mustLoadConfig(map[string]any{"context_metadata": map[string]any{}})
+	assert.Empty(t, cfg.ContextMetadata)
+
+	l := &logging{cfg: mustLoadConfig(map[string]any{
+		"context_metadata": map[string]any{
+			"x-request-id": "request_id",
+			"x-tenant":     "tenant",
+		},
+	})}
+	ctx := metadata.WithInContext(
+		context.Background(),
+		metadata.Pairs("x-request-id", "req-1", "x-tenant", "acme"),
+	)
+	want := []slog.Attr{slog.String("request_id", "req-1"), slog.String("tenant", "acme")}
+
+	_, err := l.UnaryServerInterceptor(
+		ctx,
+		"request",
+		&interceptor.UnaryServerInfo{FullMethod: "/test.service/Method"},
+		func(ctx context.Context, _ any) (any, error) {
+			assert.Equal(t, want, logger.ContextAttrs(ctx))
+			return "response", nil
+		},
+	)
+	assert.NoError(t, err)
+
+	err = l.StreamServerInterceptor(
+		nil,
+		&mockServerStream{ctx: ctx},
+		&interceptor.StreamServerInfo{FullMethod: "/test.service/Stream"},
+		func(_ any, ss stream.ServerStream) error {
+			assert.Equal(t, want, logger.ContextAttrs(ss.Context()))
+			return nil
+		},
+	)
+	assert.NoError(t, err)
+
+	_, err = l.UnaryServerInterceptor(
+		context.Background(),
+		"request",
+		&interceptor.UnaryServerInfo{FullMethod: "/test.service/Method"},
+		func(ctx context.Context, _ any) (any, error) {
+			assert.Empty(t, logger.ContextAttrs(ctx))
+			return "response", nil
+		},
+	)
+	assert.NoError(t, err)
+}
+
 // TestLogging_StatusCodeConversion tests status code to HTTP code conversion
 func TestLogging_StatusCodeConversion(t *testing.T) {
 	t.Run("various status codes", func(t *testing.T) {
@@ -0,0 +1,202 @@
+// Copyright 2022 The codesjoy Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package logging
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+
+	"google.golang.org/protobuf/proto"
+
+	"github.com/codesjoy/yggdrasil/v3/rpc/status"
+	"github.com/codesjoy/yggdrasil/v3/rpc/stream"
+)
+
+const (
+	directionSend = "send"
+	directionRecv = "recv"
+)
+
+// streamStats tracks the messages of a streaming RPC. Sends and receives may
+// run on different goroutines.
+type streamStats struct {
+	mu        sync.Mutex
+	sent      int64
+	recv      int64
+	sentBytes int64
+	recvBytes int64
+	first     time.Time
+	last      time.Time
+}
+
+// record accounts one message and returns its sequence number in its
+// direction, starting at 1.
+func (s *streamStats) record(now time.Time, direction string, size int64) int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.first.IsZero() {
+		s.first = now
+	}
+	s.last = now
+	if direction == directionSend {
+		s.sent++
+		s.sentBytes += size
+		return s.sent
+	}
+	s.recv++
+	s.recvBytes += size
+	return s.recv
+}
+
+func (s *streamStats) attrs() []slog.Attr {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	attrs := []slog.Attr{
+		slog.Int64("msgs_sent", s.sent),
+		slog.Int64("msgs_recv", s.recv),
+		slog.Int64("bytes_sent", s.sentBytes),
+		slog.Int64("bytes_recv", s.recvBytes),
+	}
+	if !s.first.IsZero() {
+		attrs = append(attrs, slog.Time("first_msg", s.first), slog.Time("last_msg", s.last))
+	}
+	return attrs
+}
+
+func messageSize(m any) int64 {
+	if msg, ok := m.(proto.Message); ok {
+		return int64(proto.Size(msg))
+	}
+	return 0
+}
+
+// onMessage records a stream message and emits the sampled per-message log.
+func (l *logging) onMessage(
+	ctx context.Context,
+	stats *streamStats,
+	method, direction string,
+	m any,
+) {
+	size := messageSize(m)
+	seq := stats.record(l.now(), direction, size)
+	every := int64(l.cfg.StreamMessageLogEvery)
+	if every <= 0 || (seq-1)%every != 0 {
+		return
+	}
+	slog.LogAttrs(ctx, slog.LevelInfo, "stream message",
+		slog.String("method", method),
+		slog.String("direction", direction),
+		slog.Int64("seq", seq),
+		slog.Int64("bytes", size))
+}
+
+// loggingServerStream records the messages of a server stream.
+type loggingServerStream struct {
+	stream.ServerStream
+	ctx    context.Context
+	l      *logging
+	method string
+	stats  streamStats
+}
+
+func (s *loggingServerStream) Context() context.Context {
+	return s.ctx
+}
+
+func (s *loggingServerStream) SendMsg(m interface{}) error {
+	err := s.ServerStream.SendMsg(m)
+	if err == nil {
+		s.l.onMessage(s.Context(), &s.stats, s.method, directionSend, m)
+	}
+	return err
+}
+
+func (s *loggingServerStream) RecvMsg(m interface{}) error {
+	err := s.ServerStream.RecvMsg(m)
+	if err == nil {
+		s.l.onMessage(s.Context(), &s.stats, s.method, directionRecv, m)
+	}
+	return err
+}
+
+// loggingClientStream records the messages of a client stream and logs a
+// summary once the stream finishes.
+type loggingClientStream struct {
+	stream.ClientStream
+	l             *logging
+	ctx           context.Context
+	method        string
+	serverStreams bool
+	start         time.Time
+	stats         streamStats
+	once          sync.Once
+}
+
+func (s *loggingClientStream) SendMsg(m interface{}) error {
+	err := s.ClientStream.SendMsg(m)
+	if err == nil {
+		s.l.onMessage(s.ctx, &s.stats, s.method, directionSend, m)
+	} else if !errors.Is(err, io.EOF) {
+		// io.EOF defers the stream error to RecvMsg.
+		s.finish(err)
+	}
+	return err
+}
+
+func (s *loggingClientStream) RecvMsg(m interface{}) error {
+	err := s.ClientStream.RecvMsg(m)
+	if err == nil {
+		s.l.onMessage(s.ctx, &s.stats, s.method, directionRecv, m)
+		if !s.serverStreams {
+			s.finish(nil)
+		}
+		return nil
+	}
+	if errors.Is(err, io.EOF) {
+		s.finish(nil)
+	} else {
+		s.finish(err)
+	}
+	return err
+}
+
+func (s *loggingClientStream) finish(err error) {
+	s.once.Do(func() {
+		st := status.FromError(err)
+		fields := []slog.Attr{
+			slog.String("type", "stream"),
+			slog.String("method", s.method),
+			slog.Float64("cost", float64(s.l.since(s.start))/float64(time.Millisecond)),
+			slog.String("event", "finish"),
+			slog.Int("code", int(st.Code())),
+		}
+		fields = append(fields, s.stats.attrs()...)
+		lv := slog.LevelInfo
+		if err != nil {
+			fields = append(fields, slog.Any("error", err))
+			if st.HTTPCode() >= http.StatusInternalServerError {
+				lv = slog.LevelError
+			} else {
+				lv = slog.LevelWarn
+			}
+		}
+		slog.LogAttrs(s.ctx, lv, "access", fields...)
+	})
+}
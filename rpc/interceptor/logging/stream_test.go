@@ -0,0 +1,176 @@
+// Copyright 2022 The codesjoy Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package logging
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/genproto/googleapis/rpc/code"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+
+	"github.com/codesjoy/yggdrasil/v3/rpc/interceptor"
+	"github.com/codesjoy/yggdrasil/v3/rpc/status"
+	"github.com/codesjoy/yggdrasil/v3/rpc/stream"
+)
+
+// scriptedClientStream replays recvErrs from RecvMsg in order.
+type scriptedClientStream struct {
+	mockClientStream
+	recvErrs []error
+}
+
+func (s *scriptedClientStream) RecvMsg(interface{}) error {
+	err := s.recvErrs[0]
+	s.recvErrs = s.recvErrs[1:]
+	return err
+}
+
+func captureRecords(t *testing.T) *[]slog.Record {
+	t.Helper()
+	var records []slog.Record
+	prev := slog.Default()
+	slog.SetDefault(slog.New(recordHandler{records: &records}))
+	t.Cleanup(func() { slog.SetDefault(prev) })
+	return &records
+}
+
+func recordAttr(r slog.Record, key string) slog.Value {
+	var v slog.Value
+	r.Attrs(func(a slog.Attr) bool {
+		if a.Key == key {
+			v = a.Value
+			return false
+		}
+		return true
+	})
+	return v
+}
+
+func recordsWithMessage(records []slog.Record, msg string) []slog.Record {
+	var out []slog.Record
+	for _, r := range records {
+		if r.Message == msg {
+			out = append(out, r)
+		}
+	}
+	return out
+}
+
+func TestLogging_StreamServerMessageStats(t *testing.T) {
+	records := captureRecords(t)
+	l := &logging{cfg: &Config{StreamMessageLogEvery: 2}}
+	msg := wrapperspb.String("payload")
+	size := int64(proto.Size(msg))
+
+	err := l.StreamServerInterceptor(nil, &mockServerStream{},
+		&interceptor.StreamServerInfo{FullMethod: "/test.Service/Chat"},
+		func(_ interface{}, ss stream.ServerStream) error {
+			for i := 0; i < 3; i++ {
+				require.NoError(t, ss.RecvMsg(msg))
+			}
+			return ss.SendMsg(msg)
+		})
+	require.NoError(t, err)
+
+	access := recordsWithMessage(*records, "access")
+	require.Len(t, access, 1)
+	assert.Equal(t, int64(1), recordAttr(access[0], "msgs_sent").Int64())
+	assert.Equal(t, int64(3), recordAttr(access[0], "msgs_recv").Int64())
+	assert.Equal(t, size, recordAttr(access[0], "bytes_sent").Int64())
+	assert.Equal(t, 3*size, recordAttr(access[0], "bytes_recv").Int64())
+	first := recordAttr(access[0], "first_msg").Time()
+	last := recordAttr(access[0], "last_msg").Time()
+	assert.False(t, first.IsZero())
+	assert.False(t, last.Before(first))
+
+	// Every second message per direction, starting with the first.
+	sampled := recordsWithMessage(*records, "stream message")
+	require.Len(t, sampled, 3)
+	assert.Equal(t, "recv", recordAttr(sampled[0], "direction").String())
+	assert.Equal(t, int64(1), recordAttr(sampled[0], "seq").Int64())
+	assert.Equal(t, int64(3), recordAttr(sampled[1], "seq").Int64())
+	assert.Equal(t, "send", recordAttr(sampled[2], "direction").String())
+	assert.Equal(t, size, recordAttr(sampled[2], "bytes").Int64())
+}
+
+func TestLogging_StreamServerNoMessages(t *testing.T) {
+	records := captureRecords(t)
+	l := &logging{cfg: &Config{}}
+
+	err := l.StreamServerInterceptor(nil, &mockServerStream{},
+		&interceptor.StreamServerInfo{FullMethod: "/test.Service/Chat"},
+		func(interface{}, stream.ServerStream) error { return nil })
+	require.NoError(t, err)
+
+	require.Len(t, *records, 1)
+	assert.Equal(t, int64(0), recordAttr((*records)[0], "msgs_recv").Int64())
+	assert.False(t, recordHasAttr((*records)[0], "first_msg"))
+}
+
+func TestLogging_StreamClientFinish(t *testing.T) {
+	open := func(l *logging, desc *stream.Desc, recvErrs ...error) stream.ClientStream {
+		cs, err := l.StreamClientInterceptor(context.Background(), desc, "/test.Service/Chat",
+			func(context.Context, *stream.Desc, string) (stream.ClientStream, error) {
+				return &scriptedClientStream{recvErrs: recvErrs}, nil
+			})
+		require.NoError(t, err)
+		return cs
+	}
+
+	t.Run("server streaming ends on EOF", func(t *testing.T) {
+		records := captureRecords(t)
+		cs := open(&logging{cfg: &Config{}}, &stream.Desc{ServerStreams: true}, nil, nil, io.EOF)
+		require.NoError(t, cs.SendMsg(wrapperspb.String("req")))
+		require.NoError(t, cs.RecvMsg(&wrapperspb.StringValue{}))
+		require.NoError(t, cs.RecvMsg(&wrapperspb.StringValue{}))
+		assert.Len(t, *records, 1, "only the open log before the stream ends")
+		assert.ErrorIs(t, cs.RecvMsg(&wrapperspb.StringValue{}), io.EOF)
+
+		require.Len(t, *records, 2)
+		finish := (*records)[1]
+		assert.Equal(t, "finish", recordAttr(finish, "event").String())
+		assert.Equal(t, int64(0), recordAttr(finish, "code").Int64())
+		assert.Equal(t, int64(1), recordAttr(finish, "msgs_sent").Int64())
+		assert.Equal(t, int64(2), recordAttr(finish, "msgs_recv").Int64())
+	})
+
+	t.Run("client streaming ends on response", func(t *testing.T) {
+		records := captureRecords(t)
+		cs := open(&logging{cfg: &Config{}}, &stream.Desc{ClientStreams: true}, nil)
+		require.NoError(t, cs.RecvMsg(&wrapperspb.StringValue{}))
+		require.Len(t, *records, 2)
+		assert.Equal(t, "finish", recordAttr((*records)[1], "event").String())
+	})
+
+	t.Run("error is logged once", func(t *testing.T) {
+		records := captureRecords(t)
+		failure := status.New(code.Code_UNAVAILABLE, "gone").Err()
+		cs := open(&logging{cfg: &Config{}}, &stream.Desc{ServerStreams: true}, failure, failure)
+		assert.ErrorIs(t, cs.RecvMsg(nil), failure)
+		_ = cs.RecvMsg(nil)
+
+		require.Len(t, *records, 2)
+		finish := (*records)[1]
+		assert.Equal(t, slog.LevelError, finish.Level)
+		assert.Equal(t, int64(code.Code_UNAVAILABLE), recordAttr(finish, "code").Int64())
+		assert.True(t, recordHasAttr(finish, "error"))
+	})
+}
@@ -0,0 +1,334 @@
+// Copyright 2022 The codesjoy Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package matcher implements a small expression language that selects RPCs
+// in interceptor configuration.
+//
+// An expression combines predicates with "&&", "||", "!" and parentheses:
+//
+//	method:/library.v1.LibraryService/MoveBook || header:x-debug=1
+//	method:/library.v1.*/* && !metadata:x-internal
+//
+// Predicates:
+//
+//   - method:<pattern> matches the full method with path.Match syntax;
+//     "*" matches every method.
+//   - metadata:<key>[=<value>] matches the metadata the call carries: the
+//     incoming metadata on the server and the outgoing metadata on the client.
+//   - header:<key>[=<value>] matches the headers of the inbound request, i.e.
+//     the incoming metadata. On the client it refers to the request currently
+//     being served, if any.
+//
+// Without a value a key predicate only checks presence. Words may be quoted
+// with double quotes to include spaces or operator characters.
+package matcher
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/codesjoy/yggdrasil/v3/rpc/metadata"
+)
+
+// Matcher is a compiled expression. A nil Matcher matches every call.
+type Matcher struct {
+	expr string
+	root node
+}
+
+// Parse compiles expr. An empty expression yields a nil Matcher.
+func Parse(expr string) (*Matcher, error) {
+	if strings.TrimSpace(expr) == "" {
+		return nil, nil
+	}
+	tokens, err := lex(expr)
+	if err != nil {
+		return nil, fmt.Errorf("matcher: %w", err)
+	}
+	p := &parser{tokens: tokens}
+	root, err := p.parseOr()
+	if err != nil {
+		return nil, fmt.Errorf("matcher: %w", err)
+	}
+	if p.pos != len(p.tokens) {
+		return nil, fmt.Errorf("matcher: unexpected %q", p.tokens[p.pos].text)
+	}
+	return &Matcher{expr: expr, root: root}, nil
+}
+
+// MustParse is like Parse but panics on error.
+func MustParse(expr string) *Matcher {
+	m, err := Parse(expr)
+	if err != nil {
+		panic(err)
+	}
+	return m
+}
+
+// String returns the source expression.
+func (m *Matcher) String() string {
+	if m == nil {
+		return ""
+	}
+	return m.expr
+}
+
+// MatchServer evaluates the expression for a call handled by the server.
+func (m *Matcher) MatchServer(ctx context.Context, method string) bool {
+	if m == nil {
+		return true
+	}
+	in, _ := metadata.FromInContext(ctx)
+	return m.root.eval(&input{method: method, metadata: in, header: in})
+}
+
+// MatchClient evaluates the expression for an outgoing call.
+func (m *Matcher) MatchClient(ctx context.Context, method string) bool {
+	if m == nil {
+		return true
+	}
+	out, _ := metadata.FromOutContext(ctx)
+	in, _ := metadata.FromInContext(ctx)
+	return m.root.eval(&input{method: method, metadata: out, header: in})
+}
+
+type input struct {
+	method   string
+	metadata metadata.MD
+	header   metadata.MD
+}
+
+type node interface {
+	eval(in *input) bool
+}
+
+type orNode struct{ left, right node }
+
+func (n orNode) eval(in *input) bool { return n.left.eval(in) || n.right.eval(in) }
+
+type andNode struct{ left, right node }
+
+func (n andNode) eval(in *input) bool { return n.left.eval(in) && n.right.eval(in) }
+
+type notNode struct{ inner node }
+
+func (n notNode) eval(in *input) bool { return !n.inner.eval(in) }
+
+type methodNode struct{ pattern string }
+
+func (n methodNode) eval(in *input) bool {
+	if n.pattern == "*" || n.pattern == in.method {
+		return true
+	}
+	ok, err := path.Match(n.pattern, in.method)
+	return err == nil && ok
+}
+
+type keyNode struct {
+	header   bool
+	key      string
+	value    string
+	hasValue bool
+}
+
+func (n keyNode) eval(in *input) bool {
+	md := in.metadata
+	if n.header {
+		md = in.header
+	}
+	values := md.Get(n.key)
+	if !n.hasValue {
+		return len(values) > 0
+	}
+	for _, value := range values {
+		if value == n.value {
+			return true
+		}
+	}
+	return false
+}
+
+func newPredicate(word string) (node, error) {
+	kind, arg, ok := strings.Cut(word, ":")
+	if !ok || arg == "" {
+		return nil, fmt.Errorf("invalid predicate %q", word)
+	}
+	switch kind {
+	case "method":
+		if _, err := path.Match(arg, ""); err != nil {
+			return nil, fmt.Errorf("invalid method pattern %q: %w", arg, err)
+		}
+		return methodNode{pattern: arg}, nil
+	case "metadata", "header":
+		key, value, hasValue := strings.Cut(arg, "=")
+		if key == "" {
+			return nil, fmt.Errorf("empty key in predicate %q", word)
+		}
+		return keyNode{
+			header:   kind == "header",
+			key:      strings.ToLower(key),
+			value:    value,
+			hasValue: hasValue,
+		}, nil
+	default:
+		return nil, fmt.Errorf("unknown predicate kind %q", kind)
+	}
+}
+
+type tokenKind int
+
+const (
+	tokenWord tokenKind = iota
+	tokenAnd
+	tokenOr
+	tokenNot
+	tokenLParen
+	tokenRParen
+)
+
+type token struct {
+	kind tokenKind
+	text string
+}
+
+func lex(expr string) ([]token, error) {
+	var tokens []token
+	for i := 0; i < len(expr); {
+		switch c := expr[i]; {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case c == '(':
+			tokens = append(tokens, token{kind: tokenLParen, text: "("})
+			i++
+		case c == ')':
+			tokens = append(tokens, token{kind: tokenRParen, text: ")"})
+			i++
+		case c == '!':
+			tokens = append(tokens, token{kind: tokenNot, text: "!"})
+			i++
+		case strings.HasPrefix(expr[i:], "&&"):
+			tokens = append(tokens, token{kind: tokenAnd, text: "&&"})
+			i += 2
+		case strings.HasPrefix(expr[i:], "||"):
+			tokens = append(tokens, token{kind: tokenOr, text: "||"})
+			i += 2
+		default:
+			word, next, err := lexWord(expr, i)
+			if err != nil {
+				return nil, err
+			}
+			tokens = append(tokens, token{kind: tokenWord, text: word})
+			i = next
+		}
+	}
+	return tokens, nil
+}
+
+func lexWord(expr string, start int) (string, int, error) {
+	var b strings.Builder
+	i := start
+	for i < len(expr) {
+		c := expr[i]
+		if c == '"' {
+			end := strings.IndexByte(expr[i+1:], '"')
+			if end < 0 {
+				return "", 0, errors.New("unterminated quote")
+			}
+			b.WriteString(expr[i+1 : i+1+end])
+			i += end + 2
+			continue
+		}
+		if strings.IndexByte(" \t\n\r()!", c) >= 0 ||
+			strings.HasPrefix(expr[i:], "&&") || strings.HasPrefix(expr[i:], "||") {
+			break
+		}
+		b.WriteByte(c)
+		i++
+	}
+	return b.String(), i, nil
+}
+
+type parser struct {
+	tokens []token
+	pos    int
+}
+
+func (p *parser) peek(kind tokenKind) bool {
+	return p.pos < len(p.tokens) && p.tokens[p.pos].kind == kind
+}
+
+func (p *parser) parseOr() (node, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek(tokenOr) {
+		p.pos++
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = orNode{left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *parser) parseAnd() (node, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek(tokenAnd) {
+		p.pos++
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = andNode{left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *parser) parseUnary() (node, error) {
+	if p.pos >= len(p.tokens) {
+		return nil, errors.New("unexpected end of expression")
+	}
+	tok := p.tokens[p.pos]
+	p.pos++
+	switch tok.kind {
+	case tokenNot:
+		inner, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return notNode{inner: inner}, nil
+	case tokenLParen:
+		inner, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if !p.peek(tokenRParen) {
+			return nil, errors.New("missing closing parenthesis")
+		}
+		p.pos++
+		return inner, nil
+	case tokenWord:
+		return newPredicate(tok.text)
+	default:
+		return nil, fmt.Errorf("unexpected %q", tok.text)
+	}
+}
@@ -0,0 +1,99 @@
+// Copyright 2022 The codesjoy Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package matcher
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/codesjoy/yggdrasil/v3/rpc/metadata"
+)
+
+func TestParse_Empty(t *testing.T) {
+	m, err := Parse("  ")
+	require.NoError(t, err)
+	assert.Nil(t, m)
+	assert.True(t, m.MatchServer(context.Background(), "/svc/M"))
+	assert.True(t, m.MatchClient(context.Background(), "/svc/M"))
+	assert.Equal(t, "", m.String())
+}
+
+func TestMatcher_MatchServer(t *testing.T) {
+	m := MustParse("method:/library.v1.LibraryService/MoveBook || header:x-debug=1")
+	assert.Equal(t, "method:/library.v1.LibraryService/MoveBook || header:x-debug=1", m.String())
+
+	ctx := context.Background()
+	assert.True(t, m.MatchServer(ctx, "/library.v1.LibraryService/MoveBook"))
+	assert.False(t, m.MatchServer(ctx, "/library.v1.LibraryService/GetBook"))
+
+	debugCtx := metadata.WithInContext(ctx, metadata.Pairs("X-Debug", "1"))
+	assert.True(t, m.MatchServer(debugCtx, "/library.v1.LibraryService/GetBook"))
+	otherCtx := metadata.WithInContext(ctx, metadata.Pairs("x-debug", "0"))
+	assert.False(t, m.MatchServer(otherCtx, "/library.v1.LibraryService/GetBook"))
+}
+
+func TestMatcher_Precedence(t *testing.T) {
+	ctx := metadata.WithInContext(context.Background(), metadata.Pairs("tenant", "a"))
+	cases := []struct {
+		expr   string
+		method string
+		want   bool
+	}{
+		{"method:/a.Svc/* && !metadata:tenant", "/a.Svc/M", false},
+		{"method:/b.Svc/* || method:/a.Svc/* && metadata:tenant=a", "/a.Svc/M", true},
+		{"(method:/b.Svc/* || method:/a.Svc/*) && metadata:tenant=b", "/a.Svc/M", false},
+		{"!!method:*", "/x/y", true},
+		{`metadata:"tenant=a"`, "/x/y", true},
+	}
+	for _, tc := range cases {
+		t.Run(tc.expr, func(t *testing.T) {
+			assert.Equal(t, tc.want, MustParse(tc.expr).MatchServer(ctx, tc.method))
+		})
+	}
+}
+
+func TestMatcher_MatchClient(t *testing.T) {
+	m := MustParse("metadata:x-route && header:x-debug")
+	ctx := metadata.WithOutContext(context.Background(), metadata.Pairs("x-route", "canary"))
+	assert.False(t, m.MatchClient(ctx, "/svc/M"))
+
+	ctx = metadata.WithInContext(ctx, metadata.Pairs("x-debug", "true"))
+	assert.True(t, m.MatchClient(ctx, "/svc/M"))
+	// The server view reads metadata from the incoming side only.
+	assert.False(t, m.MatchServer(ctx, "/svc/M"))
+}
+
+func TestParse_Errors(t *testing.T) {
+	for _, expr := range []string{
+		"method",
+		"path:/a",
+		"metadata:=1",
+		"method:[",
+		"method:/a ||",
+		"(method:/a",
+		"method:/a)",
+		`header:"x`,
+		"&& method:/a",
+	} {
+		t.Run(expr, func(t *testing.T) {
+			_, err := Parse(expr)
+			assert.Error(t, err)
+		})
+	}
+	assert.Panics(t, func() { MustParse("bogus") })
+}
@@ -0,0 +1,232 @@
+// Copyright 2022 The codesjoy Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package mdvalidate rejects calls carrying malformed or oversized metadata
+// with a descriptive status instead of an opaque transport error.
+package mdvalidate
+
+import (
+	"context"
+	"fmt"
+
+	"google.golang.org/genproto/googleapis/rpc/code"
+
+	"github.com/codesjoy/yggdrasil/v3/config"
+	"github.com/codesjoy/yggdrasil/v3/rpc/interceptor"
+	"github.com/codesjoy/yggdrasil/v3/rpc/metadata"
+	"github.com/codesjoy/yggdrasil/v3/rpc/status"
+	"github.com/codesjoy/yggdrasil/v3/rpc/stream"
+)
+
+const name = "metadata_validation"
+
+// Config defines the metadata validation interceptor configuration.
+type Config struct {
+	// MaxKeyBytes bounds the length of a single key.
+	MaxKeyBytes int `mapstructure:"max_key_bytes" default:"256"`
+	// MaxValueBytes bounds the summed length of the values of a single key.
+	MaxValueBytes int `mapstructure:"max_value_bytes" default:"8192"`
+	// MaxTotalBytes bounds the metadata size, counted as HTTP/2 header
+	// list size. Keep it below the transport max_header_list_size.
+	MaxTotalBytes int `mapstructure:"max_total_bytes" default:"16384"`
+	// ReservedPrefixes lists key prefixes reserved for framework internals.
+	ReservedPrefixes []string `mapstructure:"reserved_prefixes" default:"[\"yggdrasil-\"]"`
+}
+
+func (c Config) limits() metadata.Limits {
+	return metadata.Limits{
+		MaxKeyBytes:      c.MaxKeyBytes,
+		MaxValueBytes:    c.MaxValueBytes,
+		MaxTotalBytes:    c.MaxTotalBytes,
+		ReservedPrefixes: c.ReservedPrefixes,
+	}
+}
+
+func mustLoadConfig(source any) Config {
+	cfg := Config{}
+	if err := config.NewSnapshot(source).Decode(&cfg); err != nil {
+		panic(fmt.Sprintf("load metadata validation interceptor config: %v", err))
+	}
+	return cfg
+}
+
+// BuiltinUnaryClientProvider returns the metadata validation unary client
+// interceptor provider.
+func BuiltinUnaryClientProvider() interceptor.UnaryClientInterceptorProvider {
+	return BuiltinUnaryClientProviderWithConfig(nil)
+}
+
+// BuiltinUnaryClientProviderWithConfig returns the metadata validation unary
+// client interceptor provider bound to explicit config.
+func BuiltinUnaryClientProviderWithConfig(
+	source any,
+) interceptor.UnaryClientInterceptorProvider {
+	cfg := mustLoadConfig(source)
+	return interceptor.NewUnaryClientInterceptorProvider(
+		name,
+		func(string) interceptor.UnaryClientInterceptor {
+			return UnaryClientInterceptor(cfg)
+		},
+	)
+}
+
+// BuiltinStreamClientProvider returns the metadata validation stream client
+// interceptor provider.
+func BuiltinStreamClientProvider() interceptor.StreamClientInterceptorProvider {
+	return BuiltinStreamClientProviderWithConfig(nil)
+}
+
+// BuiltinStreamClientProviderWithConfig returns the metadata validation
+// stream client interceptor provider bound to explicit config.
+func BuiltinStreamClientProviderWithConfig(
+	source any,
+) interceptor.StreamClientInterceptorProvider {
+	cfg := mustLoadConfig(source)
+	return interceptor.NewStreamClientInterceptorProvider(
+		name,
+		func(string) interceptor.StreamClientInterceptor {
+			return StreamClientInterceptor(cfg)
+		},
+	)
+}
+
+// BuiltinUnaryServerProvider returns the metadata validation unary server
+// interceptor provider.
+func BuiltinUnaryServerProvider() interceptor.UnaryServerInterceptorProvider {
+	return BuiltinUnaryServerProviderWithConfig(nil)
+}
+
+// BuiltinUnaryServerProviderWithConfig returns the metadata validation unary
+// server interceptor provider bound to explicit config.
+func BuiltinUnaryServerProviderWithConfig(
+	source any,
+) interceptor.UnaryServerInterceptorProvider {
+	cfg := mustLoadConfig(source)
+	return interceptor.NewUnaryServerInterceptorProvider(
+		name,
+		func() interceptor.UnaryServerInterceptor {
+			return UnaryServerInterceptor(cfg)
+		},
+	)
+}
+
+// BuiltinStreamServerProvider returns the metadata validation stream server
+// interceptor provider.
+func BuiltinStreamServerProvider() interceptor.StreamServerInterceptorProvider {
+	return BuiltinStreamServerProviderWithConfig(nil)
+}
+
+// BuiltinStreamServerProviderWithConfig returns the metadata validation
+// stream server interceptor provider bound to explicit config.
+func BuiltinStreamServerProviderWithConfig(
+	source any,
+) interceptor.StreamServerInterceptorProvider {
+	cfg := mustLoadConfig(source)
+	return interceptor.NewStreamServerInterceptorProvider(
+		name,
+		func() interceptor.StreamServerInterceptor {
+			return StreamServerInterceptor(cfg)
+		},
+	)
+}
+
+// UnaryClientInterceptor rejects outgoing calls with invalid metadata with
+// INTERNAL before they reach the transport.
+func UnaryClientInterceptor(cfg Config) interceptor.UnaryClientInterceptor {
+	l := cfg.limits()
+	return func(
+		ctx context.Context,
+		method string,
+		req, reply any,
+		invoker interceptor.UnaryInvoker,
+	) error {
+		if err := checkOutgoing(ctx, l); err != nil {
+			return err
+		}
+		return invoker(ctx, method, req, reply)
+	}
+}
+
+// StreamClientInterceptor rejects outgoing streams with invalid metadata
+// with INTERNAL before they reach the transport.
+func StreamClientInterceptor(cfg Config) interceptor.StreamClientInterceptor {
+	l := cfg.limits()
+	return func(
+		ctx context.Context,
+		desc *stream.Desc,
+		method string,
+		streamer interceptor.Streamer,
+	) (stream.ClientStream, error) {
+		if err := checkOutgoing(ctx, l); err != nil {
+			return nil, err
+		}
+		return streamer(ctx, desc, method)
+	}
+}
+
+// UnaryServerInterceptor rejects calls with invalid metadata with
+// INVALID_ARGUMENT.
+func UnaryServerInterceptor(cfg Config) interceptor.UnaryServerInterceptor {
+	l := cfg.limits()
+	return func(
+		ctx context.Context,
+		req any,
+		_ *interceptor.UnaryServerInfo,
+		handler interceptor.UnaryHandler,
+	) (any, error) {
+		if err := checkIncoming(ctx, l); err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+}
+
+// StreamServerInterceptor rejects streams with invalid metadata with
+// INVALID_ARGUMENT.
+func StreamServerInterceptor(cfg Config) interceptor.StreamServerInterceptor {
+	l := cfg.limits()
+	return func(
+		srv any,
+		ss stream.ServerStream,
+		_ *interceptor.StreamServerInfo,
+		handler stream.Handler,
+	) error {
+		if err := checkIncoming(ss.Context(), l); err != nil {
+			return err
+		}
+		return handler(srv, ss)
+	}
+}
+
+func checkOutgoing(ctx context.Context, l metadata.Limits) error {
+	md, ok := metadata.FromOutContext(ctx)
+	if !ok {
+		return nil
+	}
+	if err := md.Validate(l); err != nil {
+		return status.New(code.Code_INTERNAL, "outgoing "+err.Error()).Err()
+	}
+	return nil
+}
+
+func checkIncoming(ctx context.Context, l metadata.Limits) error {
+	md, ok := metadata.FromInContext(ctx)
+	if !ok {
+		return nil
+	}
+	if err := md.Validate(l); err != nil {
+		return status.New(code.Code_INVALID_ARGUMENT, err.Error()).Err()
+	}
+	return nil
+}
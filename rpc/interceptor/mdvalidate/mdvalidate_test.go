@@ -0,0 +1,104 @@
+// Copyright 2022 The codesjoy Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mdvalidate
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/genproto/googleapis/rpc/code"
+
+	"github.com/codesjoy/yggdrasil/v3/rpc/interceptor"
+	"github.com/codesjoy/yggdrasil/v3/rpc/metadata"
+	"github.com/codesjoy/yggdrasil/v3/rpc/status"
+	"github.com/codesjoy/yggdrasil/v3/rpc/stream"
+)
+
+func TestBuiltinProvidersUseDefaults(t *testing.T) {
+	assert.Equal(t, "metadata_validation", BuiltinUnaryClientProvider().Name())
+	assert.Equal(t, "metadata_validation", BuiltinStreamClientProvider().Name())
+	assert.Equal(t, "metadata_validation", BuiltinUnaryServerProvider().Name())
+	assert.Equal(t, "metadata_validation", BuiltinStreamServerProvider().Name())
+
+	cfg := mustLoadConfig(nil)
+	assert.Equal(t, 256, cfg.MaxKeyBytes)
+	assert.Equal(t, 8192, cfg.MaxValueBytes)
+	assert.Equal(t, 16384, cfg.MaxTotalBytes)
+	assert.Equal(t, []string{"yggdrasil-"}, cfg.ReservedPrefixes)
+}
+
+func TestClientRejectsInvalidMetadata(t *testing.T) {
+	cfg := mustLoadConfig(map[string]any{"max_value_bytes": 8})
+	called := false
+	invoker := func(context.Context, string, any, any) error {
+		called = true
+		return nil
+	}
+
+	ctx := metadata.WithOutContext(context.Background(), metadata.Pairs("x-id", "ok"))
+	require.NoError(t, UnaryClientInterceptor(cfg)(ctx, "/svc/Get", nil, nil, invoker))
+	assert.True(t, called)
+
+	called = false
+	ctx = metadata.WithOutContext(context.Background(), metadata.Pairs("x-id", "too-long-value"))
+	err := UnaryClientInterceptor(cfg)(ctx, "/svc/Get", nil, nil, invoker)
+	assert.Equal(t, code.Code_INTERNAL, status.FromError(err).Code())
+	assert.Contains(t, err.Error(), "values exceed 8 bytes")
+	assert.False(t, called)
+
+	ctx = metadata.WithOutContext(context.Background(), metadata.Pairs("yggdrasil-x", "v"))
+	_, err = StreamClientInterceptor(cfg)(ctx, &stream.Desc{}, "/svc/Watch",
+		func(context.Context, *stream.Desc, string) (stream.ClientStream, error) {
+			t.Fatal("streamer should not be called")
+			return nil, nil
+		})
+	assert.Equal(t, code.Code_INTERNAL, status.FromError(err).Code())
+}
+
+func TestServerRejectsInvalidMetadata(t *testing.T) {
+	cfg := mustLoadConfig(map[string]any{"max_total_bytes": 64})
+	handler := func(context.Context, any) (any, error) { return "ok", nil }
+	info := &interceptor.UnaryServerInfo{FullMethod: "/svc/Get"}
+
+	resp, err := UnaryServerInterceptor(cfg)(context.Background(), nil, info, handler)
+	require.NoError(t, err)
+	assert.Equal(t, "ok", resp)
+
+	ctx := metadata.WithInContext(context.Background(),
+		metadata.Pairs("x-id", strings.Repeat("a", 40)))
+	_, err = UnaryServerInterceptor(cfg)(ctx, nil, info, handler)
+	assert.Equal(t, code.Code_INVALID_ARGUMENT, status.FromError(err).Code())
+
+	ctx = metadata.WithInContext(context.Background(), metadata.MD{"x id": {"v"}})
+	err = StreamServerInterceptor(cfg)(nil, &serverStream{ctx: ctx},
+		&interceptor.StreamServerInfo{FullMethod: "/svc/Watch"},
+		func(any, stream.ServerStream) error {
+			t.Fatal("handler should not be called")
+			return nil
+		})
+	assert.Equal(t, code.Code_INVALID_ARGUMENT, status.FromError(err).Code())
+}
+
+type serverStream struct {
+	stream.ServerStream
+	ctx context.Context
+}
+
+func (ss *serverStream) Context() context.Context {
+	return ss.ctx
+}
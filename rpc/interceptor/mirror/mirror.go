@@ -0,0 +1,318 @@
+// Copyright 2022 The codesjoy Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package mirror provides a client interceptor that copies a percentage of
+// unary calls to a shadow target service. Shadow responses and errors are
+// discarded, so callers only ever observe the primary call.
+package mirror
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"math/rand/v2"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+
+	"google.golang.org/protobuf/proto"
+
+	"github.com/codesjoy/yggdrasil/v3/config"
+	"github.com/codesjoy/yggdrasil/v3/internal/xsync"
+	"github.com/codesjoy/yggdrasil/v3/rpc/interceptor"
+	"github.com/codesjoy/yggdrasil/v3/rpc/metadata"
+)
+
+const name = "mirror"
+
+// Rule controls mirroring for one source client service.
+type Rule struct {
+	// Target is the client service name that receives the shadow traffic.
+	Target string `mapstructure:"target"`
+	// Percent is the share of calls to mirror, from 0 to 100.
+	Percent float64 `mapstructure:"percent"`
+	// Methods limits mirroring to the listed full ("/pkg.Service/Method") or
+	// bare ("Method") names. Empty means all unary methods.
+	Methods []string `mapstructure:"methods"`
+	// Timeout bounds each shadow call.
+	Timeout time.Duration `mapstructure:"timeout"`
+}
+
+// Config defines the mirror interceptor configuration.
+type Config struct {
+	// Services maps source client services to their mirror rule.
+	Services map[string]Rule `mapstructure:"services"`
+	// MaxInflight caps concurrent shadow calls; extra calls are dropped.
+	MaxInflight int `mapstructure:"max_inflight" default:"100"`
+}
+
+// Invoker performs unary calls on the shadow target.
+type Invoker interface {
+	Invoke(ctx context.Context, method string, args, reply any) error
+}
+
+// Dialer creates the invoker for one shadow target service. ctx lives until
+// the owning Targets is closed.
+type Dialer func(ctx context.Context, service string) (Invoker, error)
+
+// BuiltinUnaryClientProvider returns the mirror unary client interceptor
+// provider without any mirror rules.
+func BuiltinUnaryClientProvider() interceptor.UnaryClientInterceptorProvider {
+	return BuiltinUnaryClientProviderWithConfig(nil, nil)
+}
+
+// BuiltinUnaryClientProviderWithConfig returns the mirror unary client
+// interceptor provider bound to explicit config. Shadow invokers are taken
+// from targets, which dials them lazily on the first mirrored call and
+// shares them across services and config reloads.
+func BuiltinUnaryClientProviderWithConfig(
+	source any,
+	targets *Targets,
+) interceptor.UnaryClientInterceptorProvider {
+	cfg := mustLoadConfig(source)
+	inflight := make(chan struct{}, max(cfg.MaxInflight, 1))
+	return interceptor.NewUnaryClientInterceptorProvider(
+		name,
+		func(serviceName string) interceptor.UnaryClientInterceptor {
+			rule, ok := cfg.Services[serviceName]
+			if !ok || rule.Target == "" || rule.Percent <= 0 || targets == nil {
+				return passthrough
+			}
+			if rule.Timeout <= 0 {
+				rule.Timeout = time.Second
+			}
+			m := &mirror{rule: rule, targets: targets, inflight: inflight}
+			return m.UnaryClientInterceptor
+		},
+	)
+}
+
+func mustLoadConfig(source any) *Config {
+	cfg := Config{}
+	if err := config.NewSnapshot(source).Decode(&cfg); err != nil {
+		panic(fmt.Sprintf("load mirror interceptor config: %v", err))
+	}
+	return &cfg
+}
+
+func passthrough(
+	ctx context.Context,
+	method string,
+	req, reply any,
+	invoker interceptor.UnaryInvoker,
+) error {
+	return invoker(ctx, method, req, reply)
+}
+
+type mirroredKey struct{}
+
+// IsMirrored reports whether ctx belongs to a shadow call.
+func IsMirrored(ctx context.Context) bool {
+	v, _ := ctx.Value(mirroredKey{}).(bool)
+	return v
+}
+
+var errTargetsClosed = errors.New("mirror targets are closed")
+
+// Targets caches the shadow target invokers of the mirror interceptors.
+// Invokers are dialed once per target with a context that outlives the
+// mirrored calls, and closed, when they implement io.Closer, by Close.
+type Targets struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+	dial   Dialer
+	group  xsync.Group[string, Invoker]
+
+	mu     sync.Mutex
+	items  map[string]Invoker
+	closed bool
+}
+
+// NewTargets returns a Targets dialing shadow invokers with dial.
+func NewTargets(dial Dialer) *Targets {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Targets{ctx: ctx, cancel: cancel, dial: dial, items: map[string]Invoker{}}
+}
+
+func (t *Targets) get(service string) (Invoker, error) {
+	t.mu.Lock()
+	item, ok := t.items[service]
+	closed := t.closed
+	t.mu.Unlock()
+	if closed {
+		return nil, errTargetsClosed
+	}
+	if ok {
+		return item, nil
+	}
+	item, err, _ := t.group.Do(service, func() (Invoker, error) {
+		t.mu.Lock()
+		item, ok := t.items[service]
+		t.mu.Unlock()
+		if ok {
+			return item, nil
+		}
+		item, err := t.dial(t.ctx, service)
+		if err != nil {
+			return nil, err
+		}
+		t.mu.Lock()
+		defer t.mu.Unlock()
+		if t.closed {
+			closeInvoker(item)
+			return nil, errTargetsClosed
+		}
+		t.items[service] = item
+		return item, nil
+	})
+	return item, err
+}
+
+// Close cancels the dial context and closes the cached invokers. Later
+// mirrored calls are dropped.
+func (t *Targets) Close() error {
+	t.mu.Lock()
+	if t.closed {
+		t.mu.Unlock()
+		return nil
+	}
+	t.closed = true
+	items := t.items
+	t.items = map[string]Invoker{}
+	t.mu.Unlock()
+	t.cancel()
+	var err error
+	for _, item := range items {
+		err = errors.Join(err, closeInvoker(item))
+	}
+	return err
+}
+
+func closeInvoker(item Invoker) error {
+	if closer, ok := item.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
+
+type mirror struct {
+	rule     Rule
+	targets  *Targets
+	inflight chan struct{}
+}
+
+// UnaryClientInterceptor is a unary client interceptor.
+func (m *mirror) UnaryClientInterceptor(
+	ctx context.Context,
+	method string,
+	req, reply any,
+	invoker interceptor.UnaryInvoker,
+) error {
+	if m.sampled(ctx, method) {
+		select {
+		case m.inflight <- struct{}{}:
+			// The caller may reuse req once the primary call returns, so the
+			// shadow sends its own copy.
+			go m.shadow(shadowContext(ctx), method, cloneRequest(req), newReply(reply))
+		default:
+			slog.Debug("mirror call dropped", slog.String("method", method))
+		}
+	}
+	return invoker(ctx, method, req, reply)
+}
+
+func (m *mirror) sampled(ctx context.Context, method string) bool {
+	if IsMirrored(ctx) || !m.matchMethod(method) {
+		return false
+	}
+	return m.rule.Percent >= 100 || rand.Float64()*100 < m.rule.Percent
+}
+
+func (m *mirror) matchMethod(method string) bool {
+	if len(m.rule.Methods) == 0 {
+		return true
+	}
+	bare := method[strings.LastIndex(method, "/")+1:]
+	for _, item := range m.rule.Methods {
+		if item == method || item == bare {
+			return true
+		}
+	}
+	return false
+}
+
+// shadowContext detaches ctx from the primary call. The shadow call outlives
+// it and gets its own outgoing metadata and stream, so shadow headers and
+// trailers never reach the caller.
+func shadowContext(ctx context.Context) context.Context {
+	ctx = context.WithoutCancel(ctx)
+	if _, ok := metadata.FromOutContext(ctx); ok {
+		// Joining with an empty MD stores a copy of the outgoing metadata.
+		ctx = metadata.WithOutContext(ctx, metadata.MD{})
+	}
+	return metadata.NewStreamContext(ctx)
+}
+
+// shadow sends req to the mirror target and discards reply.
+func (m *mirror) shadow(ctx context.Context, method string, req, reply any) {
+	defer func() { <-m.inflight }()
+	ctx, cancel := context.WithTimeout(context.WithValue(ctx, mirroredKey{}, true), m.rule.Timeout)
+	defer cancel()
+	target, err := m.targets.get(m.rule.Target)
+	if err != nil {
+		slog.Warn(
+			"failed to create mirror target client",
+			slog.String("target", m.rule.Target),
+			slog.Any("error", err),
+		)
+		return
+	}
+	if err = target.Invoke(ctx, method, req, reply); err != nil {
+		slog.Debug(
+			"mirror call failed",
+			slog.String("target", m.rule.Target),
+			slog.String("method", method),
+			slog.Any("error", err),
+		)
+	}
+}
+
+// cloneRequest deep copies proto requests and shallow copies the value behind
+// other pointers.
+func cloneRequest(req any) any {
+	if msg, ok := req.(proto.Message); ok {
+		return proto.Clone(msg)
+	}
+	v := reflect.ValueOf(req)
+	if v.Kind() != reflect.Pointer || v.IsNil() {
+		return req
+	}
+	out := reflect.New(v.Type().Elem())
+	out.Elem().Set(v.Elem())
+	return out.Interface()
+}
+
+func newReply(reply any) any {
+	if msg, ok := reply.(proto.Message); ok {
+		return msg.ProtoReflect().New().Interface()
+	}
+	v := reflect.ValueOf(reply)
+	if v.Kind() != reflect.Pointer || v.IsNil() {
+		return nil
+	}
+	return reflect.New(v.Type().Elem()).Interface()
+}
@@ -0,0 +1,284 @@
+// Copyright 2022 The codesjoy Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mirror
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+
+	"github.com/codesjoy/yggdrasil/v3/rpc/metadata"
+)
+
+type shadowCall struct {
+	ctx    context.Context
+	ctxErr error
+	method string
+	req    any
+	reply  any
+}
+
+type fakeInvoker struct {
+	calls chan shadowCall
+	err   error
+}
+
+func (f *fakeInvoker) Invoke(ctx context.Context, method string, args, reply any) error {
+	f.calls <- shadowCall{ctx: ctx, ctxErr: ctx.Err(), method: method, req: args, reply: reply}
+	return f.err
+}
+
+func TestMirrorCopiesCallAndDiscardsShadowResult(t *testing.T) {
+	shadow := &fakeInvoker{calls: make(chan shadowCall, 1), err: errors.New("shadow failed")}
+	provider := BuiltinUnaryClientProviderWithConfig(
+		map[string]any{"services": map[string]any{
+			"svc": map[string]any{"target": "svc-v2", "percent": 100},
+		}},
+		NewTargets(func(_ context.Context, service string) (Invoker, error) {
+			assert.Equal(t, "svc-v2", service)
+			return shadow, nil
+		}),
+	)
+	intercept := provider.New("svc")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	req := wrapperspb.String("req")
+	reply := &wrapperspb.StringValue{}
+	err := intercept(ctx, "/pkg.Svc/Get", req, reply,
+		func(context.Context, string, any, any) error {
+			reply.Value = "primary"
+			return nil
+		})
+	cancel()
+	require.NoError(t, err)
+	assert.Equal(t, "primary", reply.GetValue())
+
+	select {
+	case call := <-shadow.calls:
+		assert.Equal(t, "/pkg.Svc/Get", call.method)
+		assert.NotSame(t, req, call.req)
+		assert.True(t, proto.Equal(req, call.req.(proto.Message)))
+		assert.NotSame(t, reply, call.reply)
+		assert.IsType(t, &wrapperspb.StringValue{}, call.reply)
+		assert.NoError(t, call.ctxErr)
+		assert.True(t, IsMirrored(call.ctx))
+		_, ok := call.ctx.Deadline()
+		assert.True(t, ok)
+	case <-time.After(time.Second):
+		t.Fatal("shadow call was not issued")
+	}
+}
+
+func TestMirrorShadowRunsOnItsOwnStream(t *testing.T) {
+	shadow := &fakeInvoker{calls: make(chan shadowCall, 1)}
+	provider := BuiltinUnaryClientProviderWithConfig(
+		map[string]any{"services": map[string]any{
+			"svc": map[string]any{"target": "svc-v2", "percent": 100},
+		}},
+		NewTargets(func(context.Context, string) (Invoker, error) { return shadow, nil }),
+	)
+	intercept := provider.New("svc")
+
+	ctx := metadata.WithStreamContext(
+		metadata.WithOutContext(context.Background(), metadata.Pairs("tenant", "a")),
+	)
+	require.NoError(t, intercept(ctx, "/pkg.Svc/Get", wrapperspb.String("req"), &wrapperspb.StringValue{},
+		func(context.Context, string, any, any) error { return nil }))
+
+	select {
+	case call := <-shadow.calls:
+		md, ok := metadata.FromOutContext(call.ctx)
+		require.True(t, ok)
+		assert.Equal(t, []string{"a"}, md.Get("tenant"))
+		require.NoError(t, metadata.SetHeader(call.ctx, metadata.Pairs("shadow", "1")))
+		require.NoError(t, metadata.SetTrailer(call.ctx, metadata.Pairs("shadow", "1")))
+	case <-time.After(time.Second):
+		t.Fatal("shadow call was not issued")
+	}
+
+	_, ok := metadata.FromHeaderCtx(ctx)
+	assert.False(t, ok)
+	_, ok = metadata.FromTrailerCtx(ctx)
+	assert.False(t, ok)
+}
+
+func TestMirrorShadowKeepsRequestReusedByCaller(t *testing.T) {
+	shadow := &fakeInvoker{calls: make(chan shadowCall, 2)}
+	provider := BuiltinUnaryClientProviderWithConfig(
+		map[string]any{"services": map[string]any{
+			"svc": map[string]any{"target": "svc-v2", "percent": 100},
+		}},
+		NewTargets(func(context.Context, string) (Invoker, error) { return shadow, nil }),
+	)
+	intercept := provider.New("svc")
+	ok := func(context.Context, string, any, any) error { return nil }
+
+	req := wrapperspb.String("first")
+	require.NoError(t, intercept(context.Background(), "/pkg.Svc/Get", req, nil, ok))
+	req.Value = "second"
+	type plain struct{ Value string }
+	plainReq := &plain{Value: "first"}
+	require.NoError(t, intercept(context.Background(), "/pkg.Svc/Get", plainReq, nil, ok))
+	plainReq.Value = "second"
+
+	got := map[string]bool{}
+	for range 2 {
+		select {
+		case call := <-shadow.calls:
+			switch req := call.req.(type) {
+			case *wrapperspb.StringValue:
+				got["proto"] = req.GetValue() == "first"
+			case *plain:
+				got["plain"] = req.Value == "first"
+			}
+		case <-time.After(time.Second):
+			t.Fatal("shadow call was not issued")
+		}
+	}
+	assert.Equal(t, map[string]bool{"proto": true, "plain": true}, got)
+}
+
+func TestMirrorSkipsUnselectedCalls(t *testing.T) {
+	shadow := &fakeInvoker{calls: make(chan shadowCall, 4)}
+	provider := BuiltinUnaryClientProviderWithConfig(
+		map[string]any{"services": map[string]any{
+			"svc":  map[string]any{"target": "svc-v2", "percent": 100, "methods": []any{"Get"}},
+			"zero": map[string]any{"target": "svc-v2"},
+		}},
+		NewTargets(func(context.Context, string) (Invoker, error) { return shadow, nil }),
+	)
+	ok := func(context.Context, string, any, any) error { return nil }
+
+	require.NoError(t, provider.New("svc")(context.Background(), "/pkg.Svc/List", nil, nil, ok))
+	require.NoError(t, provider.New("zero")(context.Background(), "/pkg.Svc/Get", nil, nil, ok))
+	require.NoError(t, provider.New("other")(context.Background(), "/pkg.Svc/Get", nil, nil, ok))
+	mirrored := context.WithValue(context.Background(), mirroredKey{}, true)
+	require.NoError(t, provider.New("svc")(mirrored, "/pkg.Svc/Get", nil, nil, ok))
+
+	select {
+	case call := <-shadow.calls:
+		t.Fatalf("unexpected shadow call %s", call.method)
+	case <-time.After(20 * time.Millisecond):
+	}
+}
+
+func TestMirrorDropsWhenSaturated(t *testing.T) {
+	m := &mirror{
+		rule:     Rule{Target: "svc-v2", Percent: 100, Timeout: time.Second},
+		targets:  NewTargets(nil),
+		inflight: make(chan struct{}, 1),
+	}
+	m.inflight <- struct{}{}
+	var primary bool
+	err := m.UnaryClientInterceptor(context.Background(), "/pkg.Svc/Get", nil, nil,
+		func(context.Context, string, any, any) error {
+			primary = true
+			return nil
+		})
+	require.NoError(t, err)
+	assert.True(t, primary)
+	assert.Len(t, m.inflight, 1)
+}
+
+type closingInvoker struct {
+	fakeInvoker
+	closed atomic.Bool
+}
+
+func (c *closingInvoker) Close() error {
+	c.closed.Store(true)
+	return nil
+}
+
+func TestTargetsDialOnceWithLongLivedContext(t *testing.T) {
+	var (
+		dials   atomic.Int32
+		dialCtx context.Context
+		release = make(chan struct{})
+		shadow  = &closingInvoker{}
+	)
+	targets := NewTargets(func(ctx context.Context, _ string) (Invoker, error) {
+		dials.Add(1)
+		dialCtx = ctx
+		<-release
+		return shadow, nil
+	})
+
+	var wg sync.WaitGroup
+	got := make([]Invoker, 4)
+	for i := range got {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			item, err := targets.get("svc-v2")
+			assert.NoError(t, err)
+			got[i] = item
+		}()
+	}
+	time.Sleep(10 * time.Millisecond)
+	close(release)
+	wg.Wait()
+	assert.Equal(t, int32(1), dials.Load())
+	for _, item := range got {
+		assert.Same(t, shadow, item)
+	}
+	require.NoError(t, dialCtx.Err())
+
+	require.NoError(t, targets.Close())
+	assert.True(t, shadow.closed.Load())
+	assert.Error(t, dialCtx.Err())
+	_, err := targets.get("svc-v2")
+	assert.ErrorIs(t, err, errTargetsClosed)
+}
+
+func TestShadowClientSurvivesCallTimeout(t *testing.T) {
+	shadow := &fakeInvoker{calls: make(chan shadowCall, 2)}
+	targets := NewTargets(func(ctx context.Context, _ string) (Invoker, error) {
+		return ctxInvoker{ctx: ctx, next: shadow}, nil
+	})
+	m := &mirror{
+		rule:     Rule{Target: "svc-v2", Percent: 100, Timeout: time.Millisecond},
+		targets:  targets,
+		inflight: make(chan struct{}, 2),
+	}
+	for range 2 {
+		m.inflight <- struct{}{}
+		m.shadow(context.Background(), "/pkg.Svc/Get", nil, nil)
+		time.Sleep(2 * time.Millisecond)
+	}
+	require.Len(t, shadow.calls, 2)
+}
+
+// ctxInvoker fails once its dial context is done, like a client bound to
+// a cancelled context.
+type ctxInvoker struct {
+	ctx  context.Context
+	next Invoker
+}
+
+func (c ctxInvoker) Invoke(ctx context.Context, method string, args, reply any) error {
+	if err := c.ctx.Err(); err != nil {
+		return err
+	}
+	return c.next.Invoke(ctx, method, args, reply)
+}
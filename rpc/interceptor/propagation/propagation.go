@@ -0,0 +1,191 @@
+// Copyright 2022 The codesjoy Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package propagation copies selected inbound metadata onto the outgoing
+// calls made while serving a request, so handlers no longer forward it by
+// hand with metadata.WithOutContext.
+package propagation
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/codesjoy/yggdrasil/v3/config"
+	"github.com/codesjoy/yggdrasil/v3/rpc/interceptor"
+	"github.com/codesjoy/yggdrasil/v3/rpc/metadata"
+	"github.com/codesjoy/yggdrasil/v3/rpc/stream"
+)
+
+const name = "metadata_propagation"
+
+// Config defines the metadata propagation interceptor configuration.
+type Config struct {
+	// Allow lists the case-insensitive key patterns copied from the inbound
+	// metadata, e.g. "x-request-id" or "x-b3-*". Sensitive keys such as
+	// "authorization" are only propagated when listed explicitly.
+	Allow []string `mapstructure:"allow" default:"[\"x-request-id\"]"`
+	// Deny lists key patterns never copied, even when allowed.
+	Deny []string `mapstructure:"deny"`
+}
+
+type policy struct {
+	allow []string
+	deny  []string
+}
+
+func newPolicy(cfg Config) (policy, error) {
+	p := policy{}
+	for _, item := range cfg.Allow {
+		item = strings.ToLower(item)
+		if _, err := path.Match(item, ""); err != nil {
+			return policy{}, fmt.Errorf("invalid allow pattern %q: %w", item, err)
+		}
+		p.allow = append(p.allow, item)
+	}
+	for _, item := range cfg.Deny {
+		item = strings.ToLower(item)
+		if _, err := path.Match(item, ""); err != nil {
+			return policy{}, fmt.Errorf("invalid deny pattern %q: %w", item, err)
+		}
+		p.deny = append(p.deny, item)
+	}
+	return p, nil
+}
+
+func (p policy) propagated(key string) bool {
+	if transportKey(key) || matchAny(p.deny, key) {
+		return false
+	}
+	return matchAny(p.allow, key)
+}
+
+// transportKey reports whether key describes the inbound connection rather
+// than the request, so copying it would corrupt the outgoing call.
+func transportKey(key string) bool {
+	switch key {
+	case "content-type", "user-agent", "te", "authority", "host":
+		return true
+	}
+	return strings.HasPrefix(key, ":") || strings.HasPrefix(key, "grpc-")
+}
+
+func matchAny(patterns []string, key string) bool {
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, key); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func mustLoadConfig(source any) Config {
+	cfg := Config{}
+	if err := config.NewSnapshot(source).Decode(&cfg); err != nil {
+		panic(fmt.Sprintf("load metadata propagation interceptor config: %v", err))
+	}
+	return cfg
+}
+
+func mustNewPolicy(cfg Config) policy {
+	p, err := newPolicy(cfg)
+	if err != nil {
+		panic(fmt.Sprintf("load metadata propagation interceptor config: %v", err))
+	}
+	return p
+}
+
+// BuiltinUnaryClientProvider returns the metadata propagation unary client
+// interceptor provider.
+func BuiltinUnaryClientProvider() interceptor.UnaryClientInterceptorProvider {
+	return BuiltinUnaryClientProviderWithConfig(nil)
+}
+
+// BuiltinUnaryClientProviderWithConfig returns the metadata propagation
+// unary client interceptor provider bound to explicit config.
+func BuiltinUnaryClientProviderWithConfig(
+	source any,
+) interceptor.UnaryClientInterceptorProvider {
+	p := mustNewPolicy(mustLoadConfig(source))
+	return interceptor.NewUnaryClientInterceptorProvider(
+		name,
+		func(string) interceptor.UnaryClientInterceptor {
+			return unaryClientInterceptor(p)
+		},
+	)
+}
+
+// BuiltinStreamClientProvider returns the metadata propagation stream client
+// interceptor provider.
+func BuiltinStreamClientProvider() interceptor.StreamClientInterceptorProvider {
+	return BuiltinStreamClientProviderWithConfig(nil)
+}
+
+// BuiltinStreamClientProviderWithConfig returns the metadata propagation
+// stream client interceptor provider bound to explicit config.
+func BuiltinStreamClientProviderWithConfig(
+	source any,
+) interceptor.StreamClientInterceptorProvider {
+	p := mustNewPolicy(mustLoadConfig(source))
+	return interceptor.NewStreamClientInterceptorProvider(
+		name,
+		func(string) interceptor.StreamClientInterceptor {
+			return streamClientInterceptor(p)
+		},
+	)
+}
+
+func unaryClientInterceptor(p policy) interceptor.UnaryClientInterceptor {
+	return func(
+		ctx context.Context,
+		method string,
+		req, reply any,
+		invoker interceptor.UnaryInvoker,
+	) error {
+		return invoker(propagate(ctx, p), method, req, reply)
+	}
+}
+
+func streamClientInterceptor(p policy) interceptor.StreamClientInterceptor {
+	return func(
+		ctx context.Context,
+		desc *stream.Desc,
+		method string,
+		streamer interceptor.Streamer,
+	) (stream.ClientStream, error) {
+		return streamer(propagate(ctx, p), desc, method)
+	}
+}
+
+// propagate attaches the allowed inbound metadata to the outgoing context.
+// Keys already set on the outgoing context win over inbound values.
+func propagate(ctx context.Context, p policy) context.Context {
+	in, ok := metadata.FromInContext(ctx)
+	if !ok || len(p.allow) == 0 {
+		return ctx
+	}
+	out, _ := metadata.FromOutContext(ctx)
+	md := metadata.MD{}
+	for key, vals := range in {
+		if len(vals) == 0 || len(out[key]) > 0 || !p.propagated(key) {
+			continue
+		}
+		md[key] = vals
+	}
+	if len(md) == 0 {
+		return ctx
+	}
+	return metadata.WithOutContext(ctx, md)
+}
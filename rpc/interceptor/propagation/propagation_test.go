@@ -0,0 +1,94 @@
+// Copyright 2022 The codesjoy Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package propagation
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/codesjoy/yggdrasil/v3/rpc/metadata"
+	"github.com/codesjoy/yggdrasil/v3/rpc/stream"
+)
+
+func TestBuiltinProvidersUseDefaults(t *testing.T) {
+	assert.Equal(t, "metadata_propagation", BuiltinUnaryClientProvider().Name())
+	assert.Equal(t, "metadata_propagation", BuiltinStreamClientProvider().Name())
+
+	cfg := mustLoadConfig(nil)
+	assert.Equal(t, []string{"x-request-id"}, cfg.Allow)
+	assert.Empty(t, cfg.Deny)
+
+	assert.Panics(t, func() {
+		BuiltinUnaryClientProviderWithConfig(map[string]any{"allow": []string{"["}})
+	})
+}
+
+func TestUnaryClientPropagatesAllowedKeys(t *testing.T) {
+	p := mustNewPolicy(Config{
+		Allow: []string{"x-request-id", "baggage", "X-B3-*", "authorization", "content-type"},
+		Deny:  []string{"x-b3-sampled"},
+	})
+	in := metadata.Pairs(
+		"x-request-id", "req-1",
+		"baggage", "tenant-id=acme",
+		"x-b3-traceid", "abc",
+		"x-b3-sampled", "1",
+		"authorization", "Bearer t",
+		"cookie", "session=1",
+		"content-type", "application/grpc",
+	)
+	ctx := metadata.WithInContext(context.Background(), in)
+	ctx = metadata.WithOutContext(ctx, metadata.Pairs("baggage", "explicit=1"))
+
+	var sent metadata.MD
+	err := unaryClientInterceptor(p)(ctx, "/svc/Get", nil, nil,
+		func(ctx context.Context, _ string, _, _ any) error {
+			sent, _ = metadata.FromOutContext(ctx)
+			return nil
+		})
+	require.NoError(t, err)
+	assert.Equal(t, metadata.MD{
+		"x-request-id":  {"req-1"},
+		"baggage":       {"explicit=1"},
+		"x-b3-traceid":  {"abc"},
+		"authorization": {"Bearer t"},
+	}, sent)
+}
+
+func TestStreamClientPropagatesDefaults(t *testing.T) {
+	p := mustNewPolicy(mustLoadConfig(nil))
+	in := metadata.Pairs("x-request-id", "req-1", "authorization", "Bearer t")
+	ctx := metadata.WithInContext(context.Background(), in)
+
+	var sent metadata.MD
+	_, err := streamClientInterceptor(p)(ctx, &stream.Desc{}, "/svc/Watch",
+		func(ctx context.Context, _ *stream.Desc, _ string) (stream.ClientStream, error) {
+			sent, _ = metadata.FromOutContext(ctx)
+			return nil, nil
+		})
+	require.NoError(t, err)
+	assert.Equal(t, metadata.MD{"x-request-id": {"req-1"}}, sent)
+
+	ctx = context.Background()
+	_, err = streamClientInterceptor(p)(ctx, &stream.Desc{}, "/svc/Watch",
+		func(got context.Context, _ *stream.Desc, _ string) (stream.ClientStream, error) {
+			assert.Equal(t, ctx, got)
+			return nil, nil
+		})
+	require.NoError(t, err)
+}
@@ -0,0 +1,202 @@
+// Copyright 2022 The codesjoy Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ratelimit
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/codesjoy/yggdrasil/v3/internal/xclock"
+)
+
+// Limit is a GCRA rate: Rate requests per second on average with bursts of
+// up to Burst requests.
+type Limit struct {
+	Rate  float64 `mapstructure:"rate"`
+	Burst int     `mapstructure:"burst"`
+}
+
+// enabled reports whether the limit restricts anything.
+func (l Limit) enabled() bool {
+	return l.Rate > 0
+}
+
+// emission returns the interval between two requests at the steady rate.
+func (l Limit) emission() time.Duration {
+	return time.Duration(float64(time.Second) / l.Rate)
+}
+
+// tolerance returns how far ahead of now the theoretical arrival time may be.
+func (l Limit) tolerance() time.Duration {
+	burst := l.Burst
+	if burst < 1 {
+		burst = 1
+	}
+	return time.Duration(burst) * l.emission()
+}
+
+// Limiter decides whether a request identified by key fits into limit.
+type Limiter interface {
+	// Allow consumes one request for key. When the request is denied it
+	// returns false and how long to wait before retrying.
+	Allow(ctx context.Context, key string, limit Limit) (bool, time.Duration, error)
+}
+
+var (
+	mu       sync.RWMutex
+	limiters = map[string]Limiter{}
+)
+
+// RegisterLimiter registers a named limiter backend, e.g. a Redis backed one
+// built with NewRedisLimiter. The name "local" is reserved for the builtin
+// in-process limiter.
+func RegisterLimiter(name string, limiter Limiter) {
+	mu.Lock()
+	defer mu.Unlock()
+	limiters[name] = limiter
+}
+
+// GetLimiter returns a registered limiter by name.
+func GetLimiter(name string) Limiter {
+	mu.RLock()
+	defer mu.RUnlock()
+	return limiters[name]
+}
+
+// sweepEvery is the number of new keys after which idle keys are dropped.
+const sweepEvery = 1024
+
+// localLimiter is an in-process GCRA limiter; limits apply per replica.
+type localLimiter struct {
+	mu      sync.Mutex
+	tat     map[string]time.Time
+	inserts int
+	clock   xclock.Clock
+}
+
+// NewLocalLimiter returns an in-process limiter.
+func NewLocalLimiter() Limiter {
+	return &localLimiter{tat: map[string]time.Time{}, clock: xclock.Real()}
+}
+
+func (l *localLimiter) Allow(_ context.Context, key string, limit Limit) (bool, time.Duration, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := l.clock.Now()
+	tat, ok := l.tat[key]
+	if !ok {
+		l.inserts++
+		if l.inserts%sweepEvery == 0 {
+			l.sweep(now)
+		}
+	}
+	if tat.Before(now) {
+		tat = now
+	}
+	next := tat.Add(limit.emission())
+	if allowAt := next.Add(-limit.tolerance()); allowAt.After(now) {
+		return false, allowAt.Sub(now), nil
+	}
+	l.tat[key] = next
+	return true, 0, nil
+}
+
+// sweep drops keys whose theoretical arrival time has passed; they behave
+// exactly like unknown keys.
+func (l *localLimiter) sweep(now time.Time) {
+	for key, tat := range l.tat {
+		if !tat.After(now) {
+			delete(l.tat, key)
+		}
+	}
+}
+
+// RedisScripter is the subset of Redis commands used by the Redis limiter.
+// RateLimitScripter in contrib/redis implements it over a go-redis client.
+type RedisScripter interface {
+	// Eval runs script with keys and args and returns its result.
+	Eval(ctx context.Context, script string, keys []string, args ...any) (any, error)
+}
+
+// gcraScript implements GCRA atomically. Times are in microseconds; the
+// reply is {allowed, retry_after_us}.
+const gcraScript = `
+local emission = tonumber(ARGV[1])
+local tolerance = tonumber(ARGV[2])
+local now = tonumber(ARGV[3])
+local tat = tonumber(redis.call("GET", KEYS[1]))
+if not tat or tat < now then
+  tat = now
+end
+local next_tat = tat + emission
+local allow_at = next_tat - tolerance
+if allow_at > now then
+  return {0, allow_at - now}
+end
+redis.call("SET", KEYS[1], next_tat, "PX", math.ceil((next_tat - now) / 1000))
+return {1, 0}
+`
+
+type redisLimiter struct {
+	client RedisScripter
+	prefix string
+	clock  xclock.Clock
+}
+
+// NewRedisLimiter returns a GCRA limiter that keeps its state in Redis under
+// prefix, so limits are shared by all replicas of a service. Replicas should
+// keep their clocks in sync.
+func NewRedisLimiter(client RedisScripter, prefix string) Limiter {
+	return &redisLimiter{client: client, prefix: prefix, clock: xclock.Real()}
+}
+
+func (l *redisLimiter) Allow(ctx context.Context, key string, limit Limit) (bool, time.Duration, error) {
+	reply, err := l.client.Eval(
+		ctx,
+		gcraScript,
+		[]string{l.prefix + key},
+		limit.emission().Microseconds(),
+		limit.tolerance().Microseconds(),
+		l.clock.Now().UnixMicro(),
+	)
+	if err != nil {
+		return false, 0, err
+	}
+	values, ok := reply.([]any)
+	if !ok || len(values) != 2 {
+		return false, 0, errUnexpectedReply
+	}
+	allowed, ok1 := toInt64(values[0])
+	retryAfter, ok2 := toInt64(values[1])
+	if !ok1 || !ok2 {
+		return false, 0, errUnexpectedReply
+	}
+	return allowed == 1, time.Duration(retryAfter) * time.Microsecond, nil
+}
+
+func toInt64(v any) (int64, bool) {
+	switch n := v.(type) {
+	case int64:
+		return n, true
+	case int:
+		return int64(n), true
+	case float64:
+		return int64(math.Ceil(n)), true
+	default:
+		return 0, false
+	}
+}
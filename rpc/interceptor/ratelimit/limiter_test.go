@@ -0,0 +1,107 @@
+// Copyright 2022 The codesjoy Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/codesjoy/yggdrasil/v3/internal/xclock"
+)
+
+func TestLocalLimiter_Burst(t *testing.T) {
+	ctx := context.Background()
+	clock := xclock.NewFake(time.Unix(100, 0))
+	l := NewLocalLimiter().(*localLimiter)
+	l.clock = clock
+	limit := Limit{Rate: 10, Burst: 3}
+
+	for i := 0; i < 3; i++ {
+		ok, _, err := l.Allow(ctx, "k", limit)
+		require.NoError(t, err)
+		assert.True(t, ok, "request %d within burst", i)
+	}
+	ok, retryAfter, err := l.Allow(ctx, "k", limit)
+	require.NoError(t, err)
+	assert.False(t, ok)
+	assert.Equal(t, 100*time.Millisecond, retryAfter)
+
+	ok, _, _ = l.Allow(ctx, "other", limit)
+	assert.True(t, ok, "keys are limited independently")
+
+	clock.Advance(100 * time.Millisecond)
+	ok, _, _ = l.Allow(ctx, "k", limit)
+	assert.True(t, ok)
+	ok, _, _ = l.Allow(ctx, "k", limit)
+	assert.False(t, ok)
+}
+
+func TestLocalLimiter_Sweep(t *testing.T) {
+	clock := xclock.NewFake(time.Unix(100, 0))
+	l := NewLocalLimiter().(*localLimiter)
+	l.clock = clock
+	_, _, _ = l.Allow(context.Background(), "idle", Limit{Rate: 1000})
+	clock.Advance(time.Second)
+	l.sweep(clock.Now())
+	assert.Empty(t, l.tat)
+}
+
+type fakeScripter struct {
+	keys  []string
+	args  []any
+	reply any
+	err   error
+}
+
+func (f *fakeScripter) Eval(_ context.Context, script string, keys []string, args ...any) (any, error) {
+	if script != gcraScript {
+		return nil, errors.New("unexpected script")
+	}
+	f.keys = keys
+	f.args = args
+	return f.reply, f.err
+}
+
+func TestRedisLimiter(t *testing.T) {
+	ctx := context.Background()
+	client := &fakeScripter{reply: []any{int64(1), int64(0)}}
+	l := NewRedisLimiter(client, "rl:").(*redisLimiter)
+	l.clock = xclock.NewFake(time.UnixMicro(5000))
+
+	ok, _, err := l.Allow(ctx, "k", Limit{Rate: 10, Burst: 2})
+	require.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, []string{"rl:k"}, client.keys)
+	assert.Equal(t, []any{int64(100000), int64(200000), int64(5000)}, client.args)
+
+	client.reply = []any{int64(0), int64(2500)}
+	ok, retryAfter, err := l.Allow(ctx, "k", Limit{Rate: 10})
+	require.NoError(t, err)
+	assert.False(t, ok)
+	assert.Equal(t, 2500*time.Microsecond, retryAfter)
+
+	client.reply = "bad"
+	_, _, err = l.Allow(ctx, "k", Limit{Rate: 10})
+	assert.ErrorIs(t, err, errUnexpectedReply)
+
+	client.err = errors.New("down")
+	_, _, err = l.Allow(ctx, "k", Limit{Rate: 10})
+	assert.EqualError(t, err, "down")
+}
@@ -0,0 +1,275 @@
+// Copyright 2022 The codesjoy Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package ratelimit provides server interceptors that reject requests over a
+// configured rate with RESOURCE_EXHAUSTED.
+//
+// Limits are kept per method and, when KeyMetadata is set, per caller key
+// taken from incoming metadata (e.g. a user id). The builtin "local" backend
+// limits each replica on its own; a Redis backend registered with
+// RegisterLimiter enforces the limits across all replicas.
+//
+// Requests of a tenant resolved by the tenant interceptor use the limits
+// overlaid under "yggdrasil.tenants.{id}.rate_limit", with a quota of their
+// own. Limits tuned at runtime under "yggdrasil.tuning.rate_limit" take
+// precedence over the configured ones for all other requests.
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+
+	"google.golang.org/genproto/googleapis/rpc/code"
+
+	"github.com/codesjoy/yggdrasil/v3/config"
+	"github.com/codesjoy/yggdrasil/v3/rpc/interceptor"
+	"github.com/codesjoy/yggdrasil/v3/rpc/interceptor/tuning"
+	"github.com/codesjoy/yggdrasil/v3/rpc/metadata"
+	"github.com/codesjoy/yggdrasil/v3/rpc/status"
+	"github.com/codesjoy/yggdrasil/v3/rpc/stream"
+	"github.com/codesjoy/yggdrasil/v3/tenant"
+)
+
+const name = "rate_limit"
+
+// LocalLimiterName is the name of the builtin in-process limiter.
+const LocalLimiterName = "local"
+
+var errUnexpectedReply = errors.New("ratelimit: unexpected limiter reply")
+
+// Config defines the rate limit interceptor configuration.
+type Config struct {
+	// Limit applies to every method without an override. A zero rate
+	// disables limiting.
+	Limit `mapstructure:",squash"`
+	// Methods overrides the limit per method by full name
+	// ("/pkg.Service/Method") or bare name ("Method").
+	Methods map[string]Limit `mapstructure:"methods"`
+	// KeyMetadata is the incoming metadata key identifying the caller, e.g.
+	// "x-user-id". Empty shares one quota between all callers of a method.
+	KeyMetadata string `mapstructure:"key_metadata"`
+	// Backend names the limiter: "local" or one registered with RegisterLimiter.
+	Backend string `mapstructure:"backend" default:"local"`
+	// FailClosed rejects requests with UNAVAILABLE when the backend fails.
+	// By default such requests are admitted.
+	FailClosed bool `mapstructure:"fail_closed"`
+}
+
+// BuiltinUnaryServerProvider returns the rate limit unary server interceptor provider.
+func BuiltinUnaryServerProvider() interceptor.UnaryServerInterceptorProvider {
+	return BuiltinUnaryServerProviderWithConfig(nil)
+}
+
+// BuiltinUnaryServerProviderWithConfig returns the rate limit unary server
+// interceptor provider bound to explicit config.
+func BuiltinUnaryServerProviderWithConfig(source any) interceptor.UnaryServerInterceptorProvider {
+	r := newRateLimit(mustLoadConfig(source), nil)
+	return interceptor.NewUnaryServerInterceptorProvider(
+		name,
+		func() interceptor.UnaryServerInterceptor {
+			return r.UnaryServerInterceptor
+		},
+	)
+}
+
+// BuiltinStreamServerProvider returns the rate limit stream server interceptor provider.
+func BuiltinStreamServerProvider() interceptor.StreamServerInterceptorProvider {
+	return BuiltinStreamServerProviderWithConfig(nil)
+}
+
+// BuiltinStreamServerProviderWithConfig returns the rate limit stream server
+// interceptor provider bound to explicit config.
+func BuiltinStreamServerProviderWithConfig(
+	source any,
+) interceptor.StreamServerInterceptorProvider {
+	r := newRateLimit(mustLoadConfig(source), nil)
+	return interceptor.NewStreamServerInterceptorProvider(
+		name,
+		func() interceptor.StreamServerInterceptor {
+			return r.StreamServerInterceptor
+		},
+	)
+}
+
+func mustLoadConfig(source any) *Config {
+	cfg := Config{}
+	if err := config.NewSnapshot(source).Decode(&cfg); err != nil {
+		panic(fmt.Sprintf("load rate limit interceptor config: %v", err))
+	}
+	cfg.KeyMetadata = strings.ToLower(cfg.KeyMetadata)
+	return &cfg
+}
+
+// tenantLimits are the limits overlaid for a tenant or through the tuning.
+type tenantLimits struct {
+	Limit   `mapstructure:",squash"`
+	Methods map[string]Limit `mapstructure:"methods"`
+}
+
+var tuned = tuning.NewValue[tenantLimits](name)
+
+type rateLimit struct {
+	cfg     *Config
+	tenants *tenant.Cache[tenantLimits]
+
+	once    sync.Once
+	limiter Limiter
+}
+
+func newRateLimit(cfg *Config, limiter Limiter) *rateLimit {
+	return &rateLimit{
+		cfg:     cfg,
+		limiter: limiter,
+		tenants: tenant.NewCache(func(s config.Snapshot) (tenantLimits, error) {
+			out := tenantLimits{}
+			err := s.Decode(&out)
+			return out, err
+		}, "rate_limit"),
+	}
+}
+
+// resolveLimiter looks the backend up on first use so limiters registered
+// after the runtime is assembled are still picked up.
+func (r *rateLimit) resolveLimiter() Limiter {
+	r.once.Do(func() {
+		if r.limiter != nil {
+			return
+		}
+		if r.cfg.Backend == "" || r.cfg.Backend == LocalLimiterName {
+			r.limiter = NewLocalLimiter()
+			return
+		}
+		r.limiter = GetLimiter(r.cfg.Backend)
+	})
+	return r.limiter
+}
+
+// limitFor returns the limit of method and, when it comes from a tenant
+// overlay, the tenant id. Tenant overlays win over the tuning, which wins
+// over the configuration.
+func (r *rateLimit) limitFor(ctx context.Context, method string) (Limit, string) {
+	if overlay, ok := r.tenants.Get(ctx); ok {
+		id, _ := tenant.FromContext(ctx)
+		if limit, ok := methodLimit(overlay.Methods, method); ok {
+			return limit, id
+		}
+		if overlay.Limit != (Limit{}) {
+			return overlay.Limit, id
+		}
+	}
+	if overrides, ok := tuned.Get(); ok {
+		if limit, ok := methodLimit(overrides.Methods, method); ok {
+			return limit, ""
+		}
+		if overrides.Limit != (Limit{}) {
+			return overrides.Limit, ""
+		}
+	}
+	if limit, ok := methodLimit(r.cfg.Methods, method); ok {
+		return limit, ""
+	}
+	return r.cfg.Limit, ""
+}
+
+func methodLimit(methods map[string]Limit, method string) (Limit, bool) {
+	if limit, ok := methods[method]; ok {
+		return limit, true
+	}
+	limit, ok := methods[method[strings.LastIndex(method, "/")+1:]]
+	return limit, ok
+}
+
+func (r *rateLimit) key(ctx context.Context, method, tenantID string) string {
+	if tenantID != "" {
+		method += "@" + tenantID
+	}
+	if r.cfg.KeyMetadata == "" {
+		return method
+	}
+	var caller string
+	if md, ok := metadata.FromInContext(ctx); ok {
+		if values := md.Get(r.cfg.KeyMetadata); len(values) > 0 {
+			caller = values[0]
+		}
+	}
+	return method + "|" + caller
+}
+
+// check returns a non-nil status error when the request must be rejected.
+func (r *rateLimit) check(ctx context.Context, method string) error {
+	limit, tenantID := r.limitFor(ctx, method)
+	if !limit.enabled() {
+		return nil
+	}
+	limiter := r.resolveLimiter()
+	var (
+		allowed    bool
+		retryAfter time.Duration
+		err        error
+	)
+	if limiter == nil {
+		err = fmt.Errorf("limiter %q is not registered", r.cfg.Backend)
+	} else {
+		allowed, retryAfter, err = limiter.Allow(ctx, r.key(ctx, method, tenantID), limit)
+	}
+	if err != nil {
+		slog.Warn(
+			"fault to check rate limit",
+			slog.String("method", method),
+			slog.Bool("fail_closed", r.cfg.FailClosed),
+			slog.Any("error", err),
+		)
+		if !r.cfg.FailClosed {
+			return nil
+		}
+		return status.New(code.Code_UNAVAILABLE, "rate limiter unavailable").Err()
+	}
+	if allowed {
+		return nil
+	}
+	return status.New(code.Code_RESOURCE_EXHAUSTED, "rate limit exceeded").
+		WithRetryInfo(retryAfter).
+		Err()
+}
+
+// UnaryServerInterceptor is a unary server interceptor.
+func (r *rateLimit) UnaryServerInterceptor(
+	ctx context.Context,
+	req interface{},
+	info *interceptor.UnaryServerInfo,
+	handler interceptor.UnaryHandler,
+) (interface{}, error) {
+	if err := r.check(ctx, info.FullMethod); err != nil {
+		return nil, err
+	}
+	return handler(ctx, req)
+}
+
+// StreamServerInterceptor is a stream server interceptor.
+func (r *rateLimit) StreamServerInterceptor(
+	srv interface{},
+	ss stream.ServerStream,
+	info *interceptor.StreamServerInfo,
+	handler stream.Handler,
+) error {
+	if err := r.check(ss.Context(), info.FullMethod); err != nil {
+		return err
+	}
+	return handler(srv, ss)
+}
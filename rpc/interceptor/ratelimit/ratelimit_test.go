@@ -0,0 +1,174 @@
+// Copyright 2022 The codesjoy Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/genproto/googleapis/rpc/code"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+
+	"github.com/codesjoy/yggdrasil/v3/config"
+	"github.com/codesjoy/yggdrasil/v3/module"
+	"github.com/codesjoy/yggdrasil/v3/rpc/interceptor"
+	"github.com/codesjoy/yggdrasil/v3/rpc/interceptor/tuning"
+	"github.com/codesjoy/yggdrasil/v3/rpc/metadata"
+	"github.com/codesjoy/yggdrasil/v3/rpc/status"
+	"github.com/codesjoy/yggdrasil/v3/tenant"
+)
+
+func okHandler(context.Context, any) (any, error) { return "ok", nil }
+
+func TestMustLoadConfig(t *testing.T) {
+	cfg := mustLoadConfig(map[string]any{
+		"rate":         5,
+		"burst":        2,
+		"key_metadata": "X-User-Id",
+		"methods":      map[string]any{"Pay": map[string]any{"rate": 1}},
+	})
+	assert.Equal(t, Limit{Rate: 5, Burst: 2}, cfg.Limit)
+	assert.Equal(t, "x-user-id", cfg.KeyMetadata)
+	assert.Equal(t, LocalLimiterName, cfg.Backend)
+	assert.False(t, cfg.FailClosed)
+	assert.Equal(t, Limit{Rate: 1}, cfg.Methods["Pay"])
+}
+
+func TestUnaryServerInterceptor_PerCallerQuota(t *testing.T) {
+	r := newRateLimit(mustLoadConfig(map[string]any{
+		"rate":         1,
+		"key_metadata": "x-user-id",
+	}), nil)
+	info := &interceptor.UnaryServerInfo{FullMethod: "/pkg.Svc/Get"}
+	ctxFor := func(user string) context.Context {
+		return metadata.WithInContext(context.Background(), metadata.Pairs("x-user-id", user))
+	}
+
+	_, err := r.UnaryServerInterceptor(ctxFor("alice"), nil, info, okHandler)
+	require.NoError(t, err)
+	_, err = r.UnaryServerInterceptor(ctxFor("bob"), nil, info, okHandler)
+	require.NoError(t, err)
+
+	_, err = r.UnaryServerInterceptor(ctxFor("alice"), nil, info, okHandler)
+	st := status.FromError(err)
+	require.Equal(t, code.Code_RESOURCE_EXHAUSTED, st.Code())
+	require.Len(t, st.Status().GetDetails(), 1)
+	retry := &errdetails.RetryInfo{}
+	require.NoError(t, st.Status().GetDetails()[0].UnmarshalTo(retry))
+	assert.Greater(t, retry.GetRetryDelay().AsDuration(), time.Duration(0))
+}
+
+func TestUnaryServerInterceptor_MethodOverrides(t *testing.T) {
+	r := newRateLimit(mustLoadConfig(map[string]any{
+		"methods": map[string]any{"/pkg.Svc/Pay": map[string]any{"rate": 1}},
+	}), nil)
+	free := &interceptor.UnaryServerInfo{FullMethod: "/pkg.Svc/Get"}
+	for range 5 {
+		_, err := r.UnaryServerInterceptor(context.Background(), nil, free, okHandler)
+		require.NoError(t, err)
+	}
+	limited := &interceptor.UnaryServerInfo{FullMethod: "/pkg.Svc/Pay"}
+	_, err := r.UnaryServerInterceptor(context.Background(), nil, limited, okHandler)
+	require.NoError(t, err)
+	_, err = r.UnaryServerInterceptor(context.Background(), nil, limited, okHandler)
+	assert.Equal(t, code.Code_RESOURCE_EXHAUSTED, status.FromError(err).Code())
+}
+
+func TestUnaryServerInterceptor_TenantOverlay(t *testing.T) {
+	overlays := tenant.Module()
+	require.NoError(t, overlays.(module.Initializable).Init(context.Background(),
+		config.NewView(tenant.ConfigPath, config.NewSnapshot(map[string]any{
+			"acme": map[string]any{"rate_limit": map[string]any{
+				"methods": map[string]any{"Get": map[string]any{"rate": 1}},
+			}},
+		}))))
+	t.Cleanup(func() { _ = overlays.(module.Stoppable).Stop(context.Background()) })
+
+	r := newRateLimit(mustLoadConfig(map[string]any{"rate": 100, "burst": 100}), nil)
+	info := &interceptor.UnaryServerInfo{FullMethod: "/pkg.Svc/Get"}
+	acme := tenant.WithID(context.Background(), "acme")
+	_, err := r.UnaryServerInterceptor(acme, nil, info, okHandler)
+	require.NoError(t, err)
+	_, err = r.UnaryServerInterceptor(acme, nil, info, okHandler)
+	assert.Equal(t, code.Code_RESOURCE_EXHAUSTED, status.FromError(err).Code())
+
+	// Other tenants keep the default limit.
+	other := tenant.WithID(context.Background(), "other")
+	for range 3 {
+		_, err = r.UnaryServerInterceptor(other, nil, info, okHandler)
+		require.NoError(t, err)
+	}
+}
+
+func TestUnaryServerInterceptor_Tuning(t *testing.T) {
+	m := tuning.Module()
+	require.NoError(t, m.(module.Initializable).Init(context.Background(),
+		config.NewView(tuning.ConfigPath, config.NewSnapshot(map[string]any{
+			"rate_limit": map[string]any{"rate": 1},
+		}))))
+	t.Cleanup(func() { _ = m.(module.Stoppable).Stop(context.Background()) })
+
+	r := newRateLimit(mustLoadConfig(map[string]any{"rate": 100, "burst": 100}), nil)
+	info := &interceptor.UnaryServerInfo{FullMethod: "/pkg.Svc/Get"}
+	_, err := r.UnaryServerInterceptor(context.Background(), nil, info, okHandler)
+	require.NoError(t, err)
+	_, err = r.UnaryServerInterceptor(context.Background(), nil, info, okHandler)
+	assert.Equal(t, code.Code_RESOURCE_EXHAUSTED, status.FromError(err).Code())
+
+	// Once the tuning is cleared the configured limit applies again.
+	require.NoError(t, m.(module.Stoppable).Stop(context.Background()))
+	limit, _ := r.limitFor(context.Background(), info.FullMethod)
+	assert.Equal(t, Limit{Rate: 100, Burst: 100}, limit)
+}
+
+type failingLimiter struct{}
+
+func (failingLimiter) Allow(context.Context, string, Limit) (bool, time.Duration, error) {
+	return false, 0, errors.New("down")
+}
+
+func TestUnaryServerInterceptor_FailOpenAndClosed(t *testing.T) {
+	info := &interceptor.UnaryServerInfo{FullMethod: "/pkg.Svc/Get"}
+
+	open := newRateLimit(mustLoadConfig(map[string]any{"rate": 1}), failingLimiter{})
+	_, err := open.UnaryServerInterceptor(context.Background(), nil, info, okHandler)
+	require.NoError(t, err)
+
+	closed := newRateLimit(
+		mustLoadConfig(map[string]any{"rate": 1, "fail_closed": true}),
+		failingLimiter{},
+	)
+	_, err = closed.UnaryServerInterceptor(context.Background(), nil, info, okHandler)
+	assert.Equal(t, code.Code_UNAVAILABLE, status.FromError(err).Code())
+
+	missing := newRateLimit(
+		mustLoadConfig(map[string]any{"rate": 1, "backend": "missing", "fail_closed": true}),
+		nil,
+	)
+	_, err = missing.UnaryServerInterceptor(context.Background(), nil, info, okHandler)
+	assert.Equal(t, code.Code_UNAVAILABLE, status.FromError(err).Code())
+}
+
+func TestResolveLimiter_Registered(t *testing.T) {
+	limiter := NewRedisLimiter(&fakeScripter{}, "")
+	RegisterLimiter("test_redis", limiter)
+	defer RegisterLimiter("test_redis", nil)
+	r := newRateLimit(mustLoadConfig(map[string]any{"backend": "test_redis"}), nil)
+	assert.Same(t, limiter, r.resolveLimiter())
+}
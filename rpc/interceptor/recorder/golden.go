@@ -0,0 +1,78 @@
+// Copyright 2022 The codesjoy Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package recorder
+
+import (
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"github.com/codesjoy/yggdrasil/v3/rpc/metadata"
+)
+
+// Interaction is one recorded unary call. Messages are stored as their
+// deterministic proto wire bytes.
+type Interaction struct {
+	Method   string      `json:"method"`
+	Metadata metadata.MD `json:"metadata,omitempty"`
+	Request  []byte      `json:"request"`
+	Response []byte      `json:"response,omitempty"`
+	Header   metadata.MD `json:"header,omitempty"`
+	Trailer  metadata.MD `json:"trailer,omitempty"`
+	// Status is the wire bytes of the google.rpc.Status the call failed
+	// with; it is empty for successful calls.
+	Status []byte `json:"status,omitempty"`
+}
+
+// Golden is the content of one golden file.
+type Golden struct {
+	Interactions []Interaction `json:"interactions"`
+}
+
+// LoadGolden reads the golden file at path. A missing file yields an empty
+// Golden.
+func LoadGolden(path string) (*Golden, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return &Golden{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	g := &Golden{}
+	if err := json.Unmarshal(data, g); err != nil {
+		return nil, err
+	}
+	return g, nil
+}
+
+// Save writes g to path, creating the parent directories. The file is
+// replaced atomically.
+func (g *Golden) Save(path string) error {
+	data, err := json.MarshalIndent(g, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err = os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err = os.WriteFile(tmp, append(data, '\n'), 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
@@ -0,0 +1,219 @@
+// Copyright 2022 The codesjoy Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package recorder records the unary calls of a client to golden files and
+// replays them from a server, for consumer-driven contract tests of
+// generated clients.
+//
+// While recording, each call is stored with its request and response proto
+// bytes, outgoing metadata, response header and trailer, and status. A
+// Replay registered on any server, e.g. one started with yggdrasiltest,
+// serves the recorded responses back to the same client code without the
+// real backend.
+package recorder
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"path/filepath"
+	"sync"
+
+	"google.golang.org/protobuf/proto"
+
+	"github.com/codesjoy/yggdrasil/v3/config"
+	"github.com/codesjoy/yggdrasil/v3/rpc/interceptor"
+	"github.com/codesjoy/yggdrasil/v3/rpc/metadata"
+	"github.com/codesjoy/yggdrasil/v3/rpc/status"
+)
+
+const (
+	name          = "recorder"
+	redactedValue = "***"
+)
+
+// Config defines the recorder interceptor configuration.
+type Config struct {
+	// Dir holds one golden file per client service, named
+	// "<service>.json".
+	Dir string `mapstructure:"dir" default:"testdata/golden"`
+	// Redacted lists the case-insensitive metadata keys whose values are
+	// masked in golden files, so credentials are never checked in.
+	Redacted []string `mapstructure:"redact_metadata" default:"[\"authorization\",\"cookie\",\"x-api-key\"]"`
+}
+
+// defaultRedacted is the key list of recorders opened directly.
+var defaultRedacted = []string{"authorization", "cookie", "x-api-key"}
+
+func mustLoadConfig(source any) Config {
+	cfg := Config{}
+	if err := config.NewSnapshot(source).Decode(&cfg); err != nil {
+		panic(fmt.Sprintf("load recorder interceptor config: %v", err))
+	}
+	return cfg
+}
+
+// BuiltinUnaryClientProvider returns the recorder unary client interceptor
+// provider.
+func BuiltinUnaryClientProvider() interceptor.UnaryClientInterceptorProvider {
+	return BuiltinUnaryClientProviderWithConfig(nil)
+}
+
+// BuiltinUnaryClientProviderWithConfig returns the recorder unary client
+// interceptor provider bound to explicit config.
+func BuiltinUnaryClientProviderWithConfig(
+	source any,
+) interceptor.UnaryClientInterceptorProvider {
+	cfg := mustLoadConfig(source)
+	return interceptor.NewUnaryClientInterceptorProvider(
+		name,
+		func(serviceName string) interceptor.UnaryClientInterceptor {
+			r := Open(filepath.Join(cfg.Dir, serviceName+".json"))
+			r.SetRedacted(cfg.Redacted)
+			return r.UnaryClientInterceptor()
+		},
+	)
+}
+
+var (
+	recordersMu sync.Mutex
+	recorders   = map[string]*Recorder{}
+)
+
+// Recorder appends the calls it observes to one golden file.
+type Recorder struct {
+	path string
+
+	mu       sync.Mutex
+	golden   *Golden
+	redacted []string
+}
+
+// Open returns the recorder writing to path. Recorders are shared per path
+// within the process, and a recorder starts from an empty file: the first
+// recorded call replaces what a previous run left behind.
+func Open(path string) *Recorder {
+	path = filepath.Clean(path)
+	recordersMu.Lock()
+	defer recordersMu.Unlock()
+	if r, ok := recorders[path]; ok {
+		return r
+	}
+	r := &Recorder{path: path, golden: &Golden{}, redacted: defaultRedacted}
+	recorders[path] = r
+	return r
+}
+
+// Path returns the golden file path.
+func (r *Recorder) Path() string {
+	return r.path
+}
+
+// SetRedacted replaces the case-insensitive metadata keys whose values are
+// masked in the golden file. It defaults to authorization, cookie and
+// x-api-key.
+func (r *Recorder) SetRedacted(keys []string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.redacted = append([]string(nil), keys...)
+}
+
+// Interactions returns the calls recorded so far.
+func (r *Recorder) Interactions() []Interaction {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]Interaction(nil), r.golden.Interactions...)
+}
+
+// UnaryClientInterceptor records each call with proto messages and saves
+// the golden file after it completes. Calls with non-proto messages are
+// passed through unrecorded.
+func (r *Recorder) UnaryClientInterceptor() interceptor.UnaryClientInterceptor {
+	return func(
+		ctx context.Context,
+		method string,
+		req, reply any,
+		invoker interceptor.UnaryInvoker,
+	) error {
+		ctx = metadata.WithStreamContext(ctx)
+		err := invoker(ctx, method, req, reply)
+		in, ok := req.(proto.Message)
+		out, ok2 := reply.(proto.Message)
+		if !ok || !ok2 {
+			return err
+		}
+		if recErr := r.record(ctx, method, in, out, err); recErr != nil {
+			slog.Warn(
+				"failed to record call",
+				slog.String("method", method),
+				slog.String("path", r.path),
+				slog.Any("error", recErr),
+			)
+		}
+		return err
+	}
+}
+
+func (r *Recorder) record(
+	ctx context.Context,
+	method string,
+	req, reply proto.Message,
+	callErr error,
+) error {
+	marshal := proto.MarshalOptions{Deterministic: true}
+	item := Interaction{Method: method}
+	var err error
+	if item.Request, err = marshal.Marshal(req); err != nil {
+		return err
+	}
+	if md, ok := metadata.FromOutContext(ctx); ok && md.Len() > 0 {
+		item.Metadata = md
+	}
+	if md, ok := metadata.FromHeaderCtx(ctx); ok && md.Len() > 0 {
+		item.Header = md
+	}
+	if md, ok := metadata.FromTrailerCtx(ctx); ok && md.Len() > 0 {
+		item.Trailer = md
+	}
+	if callErr != nil {
+		if item.Status, err = marshal.Marshal(status.FromError(callErr).Status()); err != nil {
+			return err
+		}
+	} else if item.Response, err = marshal.Marshal(reply); err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, md := range []metadata.MD{item.Metadata, item.Header, item.Trailer} {
+		r.redactLocked(md)
+	}
+	r.golden.Interactions = append(r.golden.Interactions, item)
+	return r.golden.Save(r.path)
+}
+
+// redactLocked masks the values of the redacted keys in md.
+func (r *Recorder) redactLocked(md metadata.MD) {
+	for _, key := range r.redacted {
+		values := md.Get(key)
+		if len(values) == 0 {
+			continue
+		}
+		masked := make([]string, len(values))
+		for i := range masked {
+			masked[i] = redactedValue
+		}
+		md.Set(key, masked...)
+	}
+}
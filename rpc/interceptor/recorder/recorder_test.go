@@ -0,0 +1,205 @@
+// Copyright 2022 The codesjoy Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package recorder_test
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/genproto/googleapis/rpc/code"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/codesjoy/yggdrasil/v3/rpc/interceptor"
+	"github.com/codesjoy/yggdrasil/v3/rpc/interceptor/recorder"
+	"github.com/codesjoy/yggdrasil/v3/rpc/metadata"
+	"github.com/codesjoy/yggdrasil/v3/rpc/status"
+	"github.com/codesjoy/yggdrasil/v3/transport/runtime/client"
+	"github.com/codesjoy/yggdrasil/v3/transport/runtime/server"
+	"github.com/codesjoy/yggdrasil/v3/yggdrasiltest"
+)
+
+const checkMethod = "/grpc.health.v1.Health/Check"
+
+type healthService interface {
+	Check(context.Context, *healthpb.HealthCheckRequest) (*healthpb.HealthCheckResponse, error)
+}
+
+type healthServer struct{}
+
+func (healthServer) Check(
+	ctx context.Context,
+	in *healthpb.HealthCheckRequest,
+) (*healthpb.HealthCheckResponse, error) {
+	_ = metadata.SetHeader(ctx, metadata.Pairs("x-served-by", "backend"))
+	if in.GetService() != "" {
+		return nil, status.New(code.Code_NOT_FOUND, "unknown service "+in.GetService()).Err()
+	}
+	return &healthpb.HealthCheckResponse{Status: healthpb.HealthCheckResponse_SERVING}, nil
+}
+
+var healthServiceDesc = server.ServiceDesc{
+	ServiceName: "grpc.health.v1.Health",
+	HandlerType: (*healthService)(nil),
+	Methods: []server.MethodDesc{{
+		MethodName: "Check",
+		Handler: func(
+			srv any,
+			ctx context.Context,
+			dec func(any) error,
+			unary interceptor.UnaryServerInterceptor,
+		) (any, error) {
+			in := new(healthpb.HealthCheckRequest)
+			if err := dec(in); err != nil {
+				return nil, err
+			}
+			info := &interceptor.UnaryServerInfo{Server: srv, FullMethod: checkMethod}
+			return unary(ctx, in, info, func(ctx context.Context, req any) (any, error) {
+				return srv.(healthService).Check(ctx, req.(*healthpb.HealthCheckRequest))
+			})
+		},
+	}},
+}
+
+type checkResult struct {
+	reply  *healthpb.HealthCheckResponse
+	header metadata.MD
+	err    error
+}
+
+func check(t *testing.T, cli client.Client, service string) checkResult {
+	t.Helper()
+	res := checkResult{reply: new(healthpb.HealthCheckResponse)}
+	ctx := metadata.WithOutContext(context.Background(), metadata.Pairs(
+		"x-caller", "test",
+		"authorization", "Bearer secret",
+	))
+	res.err = cli.Invoke(
+		ctx,
+		checkMethod,
+		&healthpb.HealthCheckRequest{Service: service},
+		res.reply,
+		client.Header(&res.header),
+	)
+	return res
+}
+
+func TestRecordAndReplay(t *testing.T) {
+	dir := t.TempDir()
+	backend := yggdrasiltest.StartTestServer(t,
+		yggdrasiltest.WithServiceDesc(&healthServiceDesc, healthServer{}),
+		yggdrasiltest.WithConfig(map[string]any{
+			"yggdrasil": map[string]any{
+				"clients": map[string]any{
+					"services": map[string]any{
+						yggdrasiltest.Target: map[string]any{
+							"interceptors": map[string]any{"unary": []any{"recorder"}},
+						},
+					},
+				},
+				"extensions": map[string]any{
+					"interceptors": map[string]any{
+						"config": map[string]any{"recorder": map[string]any{"dir": dir}},
+					},
+				},
+			},
+		}),
+	)
+	recorded := []checkResult{
+		check(t, backend.Client(), ""),
+		check(t, backend.Client(), "missing"),
+	}
+	yggdrasiltest.RequireCode(t, recorded[0].err, code.Code_OK)
+	yggdrasiltest.RequireCode(t, recorded[1].err, code.Code_NOT_FOUND)
+
+	path := filepath.Join(dir, yggdrasiltest.Target+".json")
+	golden, err := recorder.LoadGolden(path)
+	require.NoError(t, err)
+	require.Len(t, golden.Interactions, 2)
+	assert.Equal(t, checkMethod, golden.Interactions[0].Method)
+	assert.Equal(t, []string{"test"}, golden.Interactions[0].Metadata.Get("x-caller"))
+	assert.Equal(t, []string{"***"}, golden.Interactions[0].Metadata.Get("authorization"))
+	assert.Equal(t, []string{"backend"}, golden.Interactions[0].Header.Get("x-served-by"))
+	assert.Empty(t, golden.Interactions[0].Status)
+	assert.NotEmpty(t, golden.Interactions[1].Status)
+
+	replay, err := recorder.LoadReplay(path)
+	require.NoError(t, err)
+	stub := yggdrasiltest.StartTestServer(t)
+	require.NoError(t, replay.Register(stub.Server()))
+
+	for i, service := range []string{"", "missing"} {
+		got := check(t, stub.Client(), service)
+		want := recorded[i]
+		assert.True(t, proto.Equal(want.reply, got.reply), "reply of %q", service)
+		assert.Equal(t, want.header.Get("x-served-by"), got.header.Get("x-served-by"))
+		assert.Equal(t, status.FromError(want.err).Status().String(),
+			status.FromError(got.err).Status().String())
+	}
+	yggdrasiltest.RequireCode(t, check(t, stub.Client(), "other").err, code.Code_UNIMPLEMENTED)
+}
+
+func TestReplayServesInRecordedOrder(t *testing.T) {
+	req, err := proto.Marshal(&healthpb.HealthCheckRequest{})
+	require.NoError(t, err)
+	response := func(s healthpb.HealthCheckResponse_ServingStatus) []byte {
+		data, err := proto.Marshal(&healthpb.HealthCheckResponse{Status: s})
+		require.NoError(t, err)
+		return data
+	}
+	replay := recorder.NewReplay(&recorder.Golden{Interactions: []recorder.Interaction{
+		{
+			Method:   checkMethod,
+			Request:  req,
+			Response: response(healthpb.HealthCheckResponse_NOT_SERVING),
+		},
+		{
+			Method:   checkMethod,
+			Request:  req,
+			Response: response(healthpb.HealthCheckResponse_SERVING),
+		},
+	}})
+	stub := yggdrasiltest.StartTestServer(t)
+	require.NoError(t, replay.Register(stub.Server()))
+
+	var got []healthpb.HealthCheckResponse_ServingStatus
+	for range 3 {
+		res := check(t, stub.Client(), "")
+		require.NoError(t, res.err)
+		got = append(got, res.reply.GetStatus())
+	}
+	assert.Equal(t, []healthpb.HealthCheckResponse_ServingStatus{
+		healthpb.HealthCheckResponse_NOT_SERVING,
+		healthpb.HealthCheckResponse_SERVING,
+		healthpb.HealthCheckResponse_SERVING,
+	}, got)
+}
+
+func TestReplayUnknownService(t *testing.T) {
+	replay := recorder.NewReplay(&recorder.Golden{Interactions: []recorder.Interaction{
+		{Method: "/missing.Service/Call"},
+	}})
+	_, err := replay.ServiceDescs()
+	assert.ErrorContains(t, err, "missing.Service")
+}
+
+func TestLoadGoldenMissingFile(t *testing.T) {
+	g, err := recorder.LoadGolden(filepath.Join(t.TempDir(), "none.json"))
+	require.NoError(t, err)
+	assert.Empty(t, g.Interactions)
+}
@@ -0,0 +1,237 @@
+// Copyright 2022 The codesjoy Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package recorder
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+
+	"google.golang.org/genproto/googleapis/rpc/code"
+	statuspb "google.golang.org/genproto/googleapis/rpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/dynamicpb"
+
+	"github.com/codesjoy/yggdrasil/v3/rpc/interceptor"
+	"github.com/codesjoy/yggdrasil/v3/rpc/metadata"
+	"github.com/codesjoy/yggdrasil/v3/rpc/status"
+	"github.com/codesjoy/yggdrasil/v3/transport/runtime/server"
+)
+
+// Replay serves recorded interactions back from a server.
+//
+// A call matches the interactions of its method with the same request
+// bytes; request metadata is ignored. Matching interactions are served in
+// recorded order, the last one repeating once they are used up. Calls
+// without a match fail with UNIMPLEMENTED.
+type Replay struct {
+	methods map[string][]Interaction
+
+	mu     sync.Mutex
+	cursor map[string]int
+}
+
+// NewReplay returns a replay of the interactions in goldens.
+func NewReplay(goldens ...*Golden) *Replay {
+	r := &Replay{methods: map[string][]Interaction{}, cursor: map[string]int{}}
+	for _, g := range goldens {
+		for _, item := range g.Interactions {
+			r.methods[item.Method] = append(r.methods[item.Method], item)
+		}
+	}
+	return r
+}
+
+// LoadReplay returns a replay of the golden files at paths.
+func LoadReplay(paths ...string) (*Replay, error) {
+	goldens := make([]*Golden, 0, len(paths))
+	for _, path := range paths {
+		g, err := LoadGolden(path)
+		if err != nil {
+			return nil, fmt.Errorf("load golden file %s: %w", path, err)
+		}
+		goldens = append(goldens, g)
+	}
+	return NewReplay(goldens...), nil
+}
+
+// Register registers the recorded services on svr.
+func (r *Replay) Register(svr server.Server) error {
+	descs, err := r.ServiceDescs()
+	if err != nil {
+		return err
+	}
+	for _, desc := range descs {
+		svr.RegisterService(desc, r)
+	}
+	return nil
+}
+
+// ServiceDescs returns the descriptions of the recorded services, with r as
+// their implementation. Message types are resolved from the protobuf
+// registry, so the generated code of the services must be linked in.
+func (r *Replay) ServiceDescs() ([]*server.ServiceDesc, error) {
+	services := map[string]*server.ServiceDesc{}
+	for _, method := range slices.Sorted(maps.Keys(r.methods)) {
+		serviceName, methodName, ok := splitMethod(method)
+		if !ok {
+			return nil, fmt.Errorf("invalid recorded method %q", method)
+		}
+		md, err := findMethod(serviceName, methodName)
+		if err != nil {
+			return nil, err
+		}
+		if md.IsStreamingClient() || md.IsStreamingServer() {
+			return nil, fmt.Errorf("recorded method %s is streaming", method)
+		}
+		sd, ok := services[serviceName]
+		if !ok {
+			sd = &server.ServiceDesc{ServiceName: serviceName, HandlerType: (*any)(nil)}
+			services[serviceName] = sd
+		}
+		sd.Methods = append(sd.Methods, server.MethodDesc{
+			MethodName: methodName,
+			Handler:    r.handler(method, messageType(md.Input()), messageType(md.Output())),
+		})
+	}
+	out := make([]*server.ServiceDesc, 0, len(services))
+	for _, sd := range services {
+		out = append(out, sd)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].ServiceName < out[j].ServiceName })
+	return out, nil
+}
+
+func (r *Replay) handler(
+	method string,
+	input, output protoreflect.MessageType,
+) func(any, context.Context, func(any) error, interceptor.UnaryServerInterceptor) (any, error) {
+	return func(
+		srv any,
+		ctx context.Context,
+		dec func(any) error,
+		unary interceptor.UnaryServerInterceptor,
+	) (any, error) {
+		in := input.New().Interface()
+		if err := dec(in); err != nil {
+			return nil, err
+		}
+		handle := func(ctx context.Context, req any) (any, error) {
+			return r.serve(ctx, method, req.(proto.Message), output)
+		}
+		if unary == nil {
+			return handle(ctx, in)
+		}
+		return unary(ctx, in, &interceptor.UnaryServerInfo{Server: srv, FullMethod: method}, handle)
+	}
+}
+
+func (r *Replay) serve(
+	ctx context.Context,
+	method string,
+	req proto.Message,
+	output protoreflect.MessageType,
+) (any, error) {
+	data, err := proto.MarshalOptions{Deterministic: true}.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+	item, ok := r.next(method, data)
+	if !ok {
+		return nil, status.New(
+			code.Code_UNIMPLEMENTED,
+			fmt.Sprintf("no recorded interaction of %s matches the request", method),
+		).Err()
+	}
+	if item.Header.Len() > 0 {
+		_ = metadata.SetHeader(ctx, item.Header.Copy())
+	}
+	if item.Trailer.Len() > 0 {
+		_ = metadata.SetTrailer(ctx, item.Trailer.Copy())
+	}
+	if len(item.Status) > 0 {
+		pb := &statuspb.Status{}
+		if err = proto.Unmarshal(item.Status, pb); err != nil {
+			return nil, err
+		}
+		return nil, status.FromProto(pb).Err()
+	}
+	out := output.New().Interface()
+	if err = proto.Unmarshal(item.Response, out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// next returns the interaction to serve for a request of method.
+func (r *Replay) next(method string, request []byte) (Interaction, bool) {
+	var matches []Interaction
+	for _, item := range r.methods[method] {
+		if string(item.Request) == string(request) {
+			matches = append(matches, item)
+		}
+	}
+	if len(matches) == 0 {
+		return Interaction{}, false
+	}
+	key := method + "\x00" + string(request)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	i := min(r.cursor[key], len(matches)-1)
+	r.cursor[key] = i + 1
+	return matches[i], true
+}
+
+func splitMethod(method string) (service, name string, ok bool) {
+	method = strings.TrimPrefix(method, "/")
+	pos := strings.LastIndex(method, "/")
+	if pos <= 0 || pos == len(method)-1 {
+		return "", "", false
+	}
+	return method[:pos], method[pos+1:], true
+}
+
+func findMethod(serviceName, methodName string) (protoreflect.MethodDescriptor, error) {
+	desc, err := protoregistry.GlobalFiles.FindDescriptorByName(
+		protoreflect.FullName(serviceName),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("find service %s: %w", serviceName, err)
+	}
+	sd, ok := desc.(protoreflect.ServiceDescriptor)
+	if !ok {
+		return nil, fmt.Errorf("%s is not a service", serviceName)
+	}
+	md := sd.Methods().ByName(protoreflect.Name(methodName))
+	if md == nil {
+		return nil, fmt.Errorf("service %s has no method %s", serviceName, methodName)
+	}
+	return md, nil
+}
+
+// messageType prefers the generated type of desc and falls back to a
+// dynamic message.
+func messageType(desc protoreflect.MessageDescriptor) protoreflect.MessageType {
+	if mt, err := protoregistry.GlobalTypes.FindMessageByName(desc.FullName()); err == nil {
+		return mt
+	}
+	return dynamicpb.NewMessageType(desc)
+}
@@ -0,0 +1,190 @@
+// Copyright 2022 The codesjoy Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package recovery provides server interceptors that convert handler panics
+// into INTERNAL status errors.
+package recovery
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"runtime/debug"
+	"strings"
+	"sync/atomic"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/metric/noop"
+	"google.golang.org/genproto/googleapis/rpc/code"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+
+	"github.com/codesjoy/yggdrasil/v3/config"
+	"github.com/codesjoy/yggdrasil/v3/observability/crashreport"
+	"github.com/codesjoy/yggdrasil/v3/rpc/interceptor"
+	"github.com/codesjoy/yggdrasil/v3/rpc/status"
+	"github.com/codesjoy/yggdrasil/v3/rpc/stream"
+)
+
+const name = "recovery"
+
+// Config defines the recovery interceptor configuration.
+type Config struct {
+	// StripStack omits the panic value and the DebugInfo stack details from
+	// the returned status, which is recommended in production. Both are
+	// still logged.
+	StripStack bool `mapstructure:"strip_stack"`
+}
+
+// RecoveryHandlerFunc is called for every recovered panic, e.g. to report it
+// to custom telemetry. A non-nil returned error replaces the INTERNAL status
+// sent to the caller.
+type RecoveryHandlerFunc func(ctx context.Context, method string, p any, stack []byte) error
+
+var recoveryHandler atomic.Pointer[RecoveryHandlerFunc]
+
+// SetRecoveryHandler registers the handler called by all recovery
+// interceptors. A nil handler removes the registration.
+func SetRecoveryHandler(fn RecoveryHandlerFunc) {
+	if fn == nil {
+		recoveryHandler.Store(nil)
+		return
+	}
+	recoveryHandler.Store(&fn)
+}
+
+// BuiltinUnaryServerProvider returns the recovery unary server interceptor provider.
+func BuiltinUnaryServerProvider() interceptor.UnaryServerInterceptorProvider {
+	return BuiltinUnaryServerProviderWithConfig(nil, nil)
+}
+
+// BuiltinUnaryServerProviderWithConfig returns the recovery unary server
+// interceptor provider bound to explicit config and meter provider.
+func BuiltinUnaryServerProviderWithConfig(
+	source any,
+	meterProvider metric.MeterProvider,
+) interceptor.UnaryServerInterceptorProvider {
+	r := newRecovery(mustLoadConfig(source), meterProvider)
+	return interceptor.NewUnaryServerInterceptorProvider(
+		name,
+		func() interceptor.UnaryServerInterceptor {
+			return r.UnaryServerInterceptor
+		},
+	)
+}
+
+// BuiltinStreamServerProvider returns the recovery stream server interceptor provider.
+func BuiltinStreamServerProvider() interceptor.StreamServerInterceptorProvider {
+	return BuiltinStreamServerProviderWithConfig(nil, nil)
+}
+
+// BuiltinStreamServerProviderWithConfig returns the recovery stream server
+// interceptor provider bound to explicit config and meter provider.
+func BuiltinStreamServerProviderWithConfig(
+	source any,
+	meterProvider metric.MeterProvider,
+) interceptor.StreamServerInterceptorProvider {
+	r := newRecovery(mustLoadConfig(source), meterProvider)
+	return interceptor.NewStreamServerInterceptorProvider(
+		name,
+		func() interceptor.StreamServerInterceptor {
+			return r.StreamServerInterceptor
+		},
+	)
+}
+
+func mustLoadConfig(source any) *Config {
+	cfg := Config{}
+	if err := config.NewSnapshot(source).Decode(&cfg); err != nil {
+		panic(fmt.Sprintf("load recovery interceptor config: %v", err))
+	}
+	return &cfg
+}
+
+type recovery struct {
+	cfg    *Config
+	panics metric.Int64Counter
+}
+
+func newRecovery(cfg *Config, meterProvider metric.MeterProvider) *recovery {
+	if meterProvider == nil {
+		meterProvider = otel.GetMeterProvider()
+	}
+	meter := meterProvider.Meter("github.com/codesjoy/yggdrasil/v3",
+		metric.WithInstrumentationVersion("yggdrasil"),
+	)
+	panics, err := meter.Int64Counter("rpc.server.panics",
+		metric.WithDescription("Counts panics recovered from RPC handlers."),
+		metric.WithUnit("{panic}"))
+	if err != nil {
+		otel.Handle(err)
+		panics = noop.Int64Counter{}
+	}
+	return &recovery{cfg: cfg, panics: panics}
+}
+
+// UnaryServerInterceptor is a unary server interceptor.
+func (r *recovery) UnaryServerInterceptor(
+	ctx context.Context,
+	req interface{},
+	info *interceptor.UnaryServerInfo,
+	handler interceptor.UnaryHandler,
+) (resp interface{}, err error) {
+	defer func() {
+		if p := recover(); p != nil {
+			resp, err = nil, r.recovered(ctx, crashreport.SourceUnaryServer, info.FullMethod, p)
+		}
+	}()
+	return handler(ctx, req)
+}
+
+// StreamServerInterceptor is a stream server interceptor.
+func (r *recovery) StreamServerInterceptor(
+	srv interface{},
+	ss stream.ServerStream,
+	info *interceptor.StreamServerInfo,
+	handler stream.Handler,
+) (err error) {
+	defer func() {
+		if p := recover(); p != nil {
+			err = r.recovered(ss.Context(), crashreport.SourceStreamServer, info.FullMethod, p)
+		}
+	}()
+	return handler(srv, ss)
+}
+
+func (r *recovery) recovered(ctx context.Context, source, method string, p any) error {
+	stack := debug.Stack()
+	r.panics.Add(ctx, 1, metric.WithAttributes(attribute.String("rpc.method", method)))
+	slog.ErrorContext(ctx, "panic recovered",
+		slog.String("method", method),
+		slog.Any("panic", p),
+		slog.String("stack", string(stack)),
+	)
+	crashreport.Recovered(ctx, source, method, p, stack)
+	if fn := recoveryHandler.Load(); fn != nil {
+		if err := (*fn)(ctx, method, p, stack); err != nil {
+			return err
+		}
+	}
+	if r.cfg.StripStack {
+		return status.New(code.Code_INTERNAL, "internal error").Err()
+	}
+	return status.New(code.Code_INTERNAL, fmt.Sprintf("panic: %v", p)).
+		WithDetails(&errdetails.DebugInfo{
+			StackEntries: strings.Split(strings.TrimSpace(string(stack)), "\n"),
+			Detail:       fmt.Sprint(p),
+		}).Err()
+}
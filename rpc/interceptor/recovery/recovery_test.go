@@ -0,0 +1,151 @@
+// Copyright 2022 The codesjoy Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package recovery
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/metric/noop"
+	"google.golang.org/genproto/googleapis/rpc/code"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+
+	"github.com/codesjoy/yggdrasil/v3/observability/crashreport"
+	"github.com/codesjoy/yggdrasil/v3/rpc/interceptor"
+	"github.com/codesjoy/yggdrasil/v3/rpc/metadata"
+	"github.com/codesjoy/yggdrasil/v3/rpc/status"
+	"github.com/codesjoy/yggdrasil/v3/rpc/stream"
+)
+
+type countingMeterProvider struct {
+	noop.MeterProvider
+	count atomic.Int64
+}
+
+func (p *countingMeterProvider) Meter(string, ...metric.MeterOption) metric.Meter {
+	return countingMeter{provider: p}
+}
+
+type countingMeter struct {
+	noop.Meter
+	provider *countingMeterProvider
+}
+
+func (m countingMeter) Int64Counter(string, ...metric.Int64CounterOption) (metric.Int64Counter, error) {
+	return countingCounter{provider: m.provider}, nil
+}
+
+type countingCounter struct {
+	noop.Int64Counter
+	provider *countingMeterProvider
+}
+
+func (c countingCounter) Add(_ context.Context, incr int64, _ ...metric.AddOption) {
+	c.provider.count.Add(incr)
+}
+
+type testServerStream struct {
+	stream.ServerStream
+}
+
+func (testServerStream) Context() context.Context { return context.Background() }
+
+func TestUnaryServerInterceptorRecoversPanic(t *testing.T) {
+	mp := &countingMeterProvider{}
+	r := newRecovery(&Config{}, mp)
+	info := &interceptor.UnaryServerInfo{FullMethod: "/pkg.Svc/Get"}
+
+	resp, err := r.UnaryServerInterceptor(context.Background(), nil, info,
+		func(context.Context, any) (any, error) { panic("boom") })
+	assert.Nil(t, resp)
+	require.Error(t, err)
+	st := status.FromError(err)
+	assert.Equal(t, code.Code_INTERNAL, st.Code())
+	assert.Equal(t, "panic: boom", st.Message())
+	require.Len(t, st.Status().GetDetails(), 1)
+	debugInfo := &errdetails.DebugInfo{}
+	require.NoError(t, st.Status().GetDetails()[0].UnmarshalTo(debugInfo))
+	assert.Equal(t, "boom", debugInfo.GetDetail())
+	assert.NotEmpty(t, debugInfo.GetStackEntries())
+	assert.Equal(t, int64(1), mp.count.Load())
+}
+
+func TestUnaryServerInterceptorPassesThrough(t *testing.T) {
+	r := newRecovery(&Config{}, noop.NewMeterProvider())
+	info := &interceptor.UnaryServerInfo{FullMethod: "/pkg.Svc/Get"}
+	resp, err := r.UnaryServerInterceptor(context.Background(), "req", info,
+		func(_ context.Context, req any) (any, error) { return req, nil })
+	require.NoError(t, err)
+	assert.Equal(t, "req", resp)
+}
+
+func TestStreamServerInterceptorStripsStack(t *testing.T) {
+	r := newRecovery(&Config{StripStack: true}, noop.NewMeterProvider())
+	info := &interceptor.StreamServerInfo{FullMethod: "/pkg.Svc/Watch"}
+
+	err := r.StreamServerInterceptor(nil, testServerStream{}, info,
+		func(any, stream.ServerStream) error { panic(errors.New("boom")) })
+	st := status.FromError(err)
+	assert.Equal(t, code.Code_INTERNAL, st.Code())
+	assert.Equal(t, "internal error", st.Message())
+	assert.NotContains(t, err.Error(), "boom")
+	assert.Empty(t, st.Status().GetDetails())
+}
+
+func TestRecoveryHandlerOverridesError(t *testing.T) {
+	custom := errors.New("custom")
+	var gotMethod string
+	SetRecoveryHandler(func(_ context.Context, method string, p any, stack []byte) error {
+		gotMethod = method
+		assert.Equal(t, "boom", p)
+		assert.NotEmpty(t, stack)
+		return custom
+	})
+	defer SetRecoveryHandler(nil)
+
+	r := newRecovery(mustLoadConfig(map[string]any{"strip_stack": true}), nil)
+	assert.True(t, r.cfg.StripStack)
+	_, err := r.UnaryServerInterceptor(context.Background(), nil,
+		&interceptor.UnaryServerInfo{FullMethod: "/pkg.Svc/Get"},
+		func(context.Context, any) (any, error) { panic("boom") })
+	assert.ErrorIs(t, err, custom)
+	assert.Equal(t, "/pkg.Svc/Get", gotMethod)
+}
+
+func TestRecoveryReportsCrash(t *testing.T) {
+	var got *crashreport.Report
+	prev := crashreport.SetReporter(crashreport.ReporterFunc(
+		func(_ context.Context, report *crashreport.Report) { got = report },
+	))
+	defer crashreport.SetReporter(prev)
+
+	r := newRecovery(mustLoadConfig(nil), nil)
+	ctx := metadata.WithInContext(context.Background(), metadata.Pairs("x-request-id", "r1"))
+	_, err := r.UnaryServerInterceptor(ctx, nil,
+		&interceptor.UnaryServerInfo{FullMethod: "/pkg.Svc/Get"},
+		func(context.Context, any) (any, error) { panic("boom") })
+	require.Error(t, err)
+	require.NotNil(t, got)
+	assert.Equal(t, crashreport.SourceUnaryServer, got.Source)
+	assert.Equal(t, "/pkg.Svc/Get", got.Name)
+	assert.Equal(t, "boom", got.Panic)
+	assert.NotEmpty(t, got.Stack)
+	assert.Equal(t, []string{"r1"}, got.Metadata["x-request-id"])
+}
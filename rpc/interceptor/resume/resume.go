@@ -0,0 +1,336 @@
+// Copyright 2022 The codesjoy Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package resume provides a client interceptor that resumes server-streaming
+// calls after transient disconnects. When the stream fails with a resumable
+// code, the call is re-issued with a resumption token taken from the last
+// message received, and RecvMsg carries on with the new stream as if nothing
+// happened. Watch-style APIs get robust without every caller writing its
+// own reconnect loop.
+//
+// Resumption is opt-in: register a Resumer for a method with Register, or
+// for a single call with WithResumer.
+package resume
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+
+	"google.golang.org/genproto/googleapis/rpc/code"
+
+	"github.com/codesjoy/yggdrasil/v3/config"
+	"github.com/codesjoy/yggdrasil/v3/internal/backoff"
+	"github.com/codesjoy/yggdrasil/v3/internal/xclock"
+	"github.com/codesjoy/yggdrasil/v3/rpc/interceptor"
+	"github.com/codesjoy/yggdrasil/v3/rpc/metadata"
+	"github.com/codesjoy/yggdrasil/v3/rpc/status"
+	"github.com/codesjoy/yggdrasil/v3/rpc/stream"
+)
+
+const name = "resume"
+
+// Resumer tells the interceptor how to resume the calls of a method.
+type Resumer struct {
+	// Token returns the resumption token carried by a received message, or
+	// "" when the message carries none. It must not be nil.
+	Token func(msg any) string
+	// Request returns the request re-issuing the call from token, e.g. the
+	// original request with its start position replaced. When nil the
+	// original request is re-sent and the token travels in the configured
+	// metadata header.
+	Request func(req any, token string) any
+}
+
+var (
+	mu       sync.RWMutex
+	resumers = map[string]Resumer{}
+)
+
+// Register enables resumption for the full method name
+// ("/pkg.Service/Method").
+func Register(method string, r Resumer) {
+	mu.Lock()
+	defer mu.Unlock()
+	resumers[method] = r
+}
+
+func lookup(method string) (Resumer, bool) {
+	mu.RLock()
+	defer mu.RUnlock()
+	r, ok := resumers[method]
+	return r, ok
+}
+
+type resumerKey struct{}
+
+// WithResumer enables resumption for the call made with ctx, taking
+// precedence over a Resumer registered for its method.
+func WithResumer(ctx context.Context, r Resumer) context.Context {
+	return context.WithValue(ctx, resumerKey{}, r)
+}
+
+// Config defines the resume interceptor configuration.
+type Config struct {
+	// Header is the outgoing metadata key carrying the resumption token.
+	Header string `mapstructure:"header" default:"x-resume-token"`
+	// MaxAttempts bounds the consecutive resumptions that deliver no
+	// message before the error is returned to the caller.
+	MaxAttempts int `mapstructure:"max_attempts" default:"5"`
+	// BaseDelay is the wait before the first resumption.
+	BaseDelay time.Duration `mapstructure:"base_delay" default:"100ms"`
+	// MaxDelay bounds the exponentially growing wait between resumptions.
+	MaxDelay time.Duration `mapstructure:"max_delay" default:"5s"`
+	// Codes lists the status code names a stream is resumed on.
+	Codes []string `mapstructure:"codes" default:"[\"UNAVAILABLE\"]"`
+}
+
+// BuiltinStreamClientProvider returns the resume stream client interceptor
+// provider.
+func BuiltinStreamClientProvider() interceptor.StreamClientInterceptorProvider {
+	return BuiltinStreamClientProviderWithConfig(nil)
+}
+
+// BuiltinStreamClientProviderWithConfig returns the resume stream client
+// interceptor provider bound to explicit config.
+func BuiltinStreamClientProviderWithConfig(
+	source any,
+) interceptor.StreamClientInterceptorProvider {
+	r := newResumption(mustLoadConfig(source))
+	return interceptor.NewStreamClientInterceptorProvider(
+		name,
+		func(string) interceptor.StreamClientInterceptor {
+			return r.StreamClientInterceptor
+		},
+	)
+}
+
+func mustLoadConfig(source any) *Config {
+	cfg := Config{}
+	if err := config.NewSnapshot(source).Decode(&cfg); err != nil {
+		panic(fmt.Sprintf("load resume interceptor config: %v", err))
+	}
+	cfg.Header = strings.ToLower(cfg.Header)
+	return &cfg
+}
+
+type resumption struct {
+	cfg       *Config
+	backoff   backoff.Strategy
+	clock     xclock.Clock
+	resumable map[code.Code]struct{}
+}
+
+func newResumption(cfg *Config) *resumption {
+	r := &resumption{
+		cfg: cfg,
+		backoff: backoff.Exponential{Config: backoff.Config{
+			BaseDelay:  cfg.BaseDelay,
+			Multiplier: 1.6,
+			Jitter:     0.2,
+			MaxDelay:   cfg.MaxDelay,
+		}},
+		clock:     xclock.Real(),
+		resumable: map[code.Code]struct{}{},
+	}
+	for _, item := range cfg.Codes {
+		if value, ok := code.Code_value[strings.ToUpper(strings.TrimSpace(item))]; ok {
+			r.resumable[code.Code(value)] = struct{}{}
+		}
+	}
+	return r
+}
+
+// StreamClientInterceptor is a stream client interceptor. Only streams
+// that send a single request are resumed, since the messages of a client
+// stream cannot be replayed.
+func (r *resumption) StreamClientInterceptor(
+	ctx context.Context,
+	desc *stream.Desc,
+	method string,
+	streamer interceptor.Streamer,
+) (stream.ClientStream, error) {
+	if !desc.ServerStreams || desc.ClientStreams || r.cfg.MaxAttempts <= 0 {
+		return streamer(ctx, desc, method)
+	}
+	resumer, ok := ctx.Value(resumerKey{}).(Resumer)
+	if !ok {
+		resumer, ok = lookup(method)
+	}
+	if !ok || resumer.Token == nil {
+		return streamer(ctx, desc, method)
+	}
+	cs, err := streamer(ctx, desc, method)
+	if err != nil {
+		return nil, err
+	}
+	return &clientStream{
+		r:        r,
+		resumer:  resumer,
+		ctx:      ctx,
+		desc:     desc,
+		method:   method,
+		streamer: streamer,
+		cur:      cs,
+	}, nil
+}
+
+func (r *resumption) isResumable(err error) bool {
+	_, ok := r.resumable[status.FromError(err).Code()]
+	return ok
+}
+
+// clientStream replaces its underlying stream whenever it resumes. RecvMsg
+// is the only method that swaps it, guarded by mu against concurrent
+// Header and Trailer calls.
+type clientStream struct {
+	r        *resumption
+	resumer  Resumer
+	ctx      context.Context
+	desc     *stream.Desc
+	method   string
+	streamer interceptor.Streamer
+
+	mu        sync.Mutex
+	cur       stream.ClientStream
+	req       any
+	closeSent bool
+	token     string
+}
+
+func (cs *clientStream) current() stream.ClientStream {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	return cs.cur
+}
+
+func (cs *clientStream) Header() (metadata.MD, error) {
+	return cs.current().Header()
+}
+
+func (cs *clientStream) Trailer() metadata.MD {
+	return cs.current().Trailer()
+}
+
+func (cs *clientStream) Context() context.Context {
+	return cs.current().Context()
+}
+
+func (cs *clientStream) SendMsg(m any) error {
+	cs.mu.Lock()
+	if cs.req == nil {
+		cs.req = m
+	}
+	cur := cs.cur
+	cs.mu.Unlock()
+	return cur.SendMsg(m)
+}
+
+func (cs *clientStream) CloseSend() error {
+	cs.mu.Lock()
+	cs.closeSent = true
+	cur := cs.cur
+	cs.mu.Unlock()
+	return cur.CloseSend()
+}
+
+func (cs *clientStream) RecvMsg(m any) error {
+	attempts := 0
+	for {
+		err := cs.current().RecvMsg(m)
+		if err == nil {
+			if token := cs.resumer.Token(m); token != "" {
+				cs.mu.Lock()
+				cs.token = token
+				cs.mu.Unlock()
+			}
+			return nil
+		}
+		if !cs.canResume(err, attempts) {
+			return err
+		}
+		for {
+			if waitErr := cs.wait(attempts); waitErr != nil {
+				return err
+			}
+			attempts++
+			resumeErr := cs.resume()
+			if resumeErr == nil {
+				break
+			}
+			if !cs.canResume(resumeErr, attempts) {
+				return resumeErr
+			}
+			err = resumeErr
+		}
+	}
+}
+
+func (cs *clientStream) canResume(err error, attempts int) bool {
+	if errors.Is(err, io.EOF) || attempts >= cs.r.cfg.MaxAttempts || cs.ctx.Err() != nil {
+		return false
+	}
+	cs.mu.Lock()
+	sent := cs.req != nil && cs.closeSent
+	cs.mu.Unlock()
+	return sent && cs.r.isResumable(err)
+}
+
+func (cs *clientStream) wait(attempts int) error {
+	timer := cs.r.clock.NewTimer(cs.r.backoff.Backoff(attempts))
+	defer timer.Stop()
+	select {
+	case <-cs.ctx.Done():
+		return cs.ctx.Err()
+	case <-timer.C():
+		return nil
+	}
+}
+
+// resume re-issues the call from the last token and swaps the stream in.
+func (cs *clientStream) resume() error {
+	cs.mu.Lock()
+	req, token := cs.req, cs.token
+	cs.mu.Unlock()
+
+	ctx := cs.ctx
+	if token != "" {
+		if cs.resumer.Request != nil {
+			req = cs.resumer.Request(req, token)
+		} else {
+			md, _ := metadata.FromOutContext(ctx)
+			md = md.Copy()
+			md.Set(cs.r.cfg.Header, token)
+			ctx = metadata.WithOutContext(ctx, md)
+		}
+	}
+	next, err := cs.streamer(ctx, cs.desc, cs.method)
+	if err != nil {
+		return err
+	}
+	if err := next.SendMsg(req); err != nil && !errors.Is(err, io.EOF) {
+		return err
+	}
+	if err := next.CloseSend(); err != nil {
+		return err
+	}
+	cs.mu.Lock()
+	cs.cur = next
+	cs.mu.Unlock()
+	return nil
+}
@@ -0,0 +1,237 @@
+// Copyright 2022 The codesjoy Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package resume
+
+import (
+	"context"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/genproto/googleapis/rpc/code"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+
+	"github.com/codesjoy/yggdrasil/v3/rpc/metadata"
+	"github.com/codesjoy/yggdrasil/v3/rpc/status"
+	"github.com/codesjoy/yggdrasil/v3/rpc/stream"
+)
+
+// fakeStream delivers msgs and then fails with end.
+type fakeStream struct {
+	stream.ClientStream
+	msgs []string
+	end  error
+	req  any
+}
+
+func (s *fakeStream) SendMsg(m any) error { s.req = m; return nil }
+
+func (s *fakeStream) CloseSend() error { return nil }
+
+func (s *fakeStream) RecvMsg(m any) error {
+	if len(s.msgs) == 0 {
+		return s.end
+	}
+	m.(*wrapperspb.StringValue).Value = s.msgs[0]
+	s.msgs = s.msgs[1:]
+	return nil
+}
+
+type call struct {
+	token string
+	req   any
+}
+
+// fakeServer answers each call with the next scripted stream and records
+// the token and request it was issued with.
+type fakeServer struct {
+	streams []*fakeStream
+	calls   []call
+}
+
+func (f *fakeServer) streamer(
+	ctx context.Context,
+	_ *stream.Desc,
+	_ string,
+) (stream.ClientStream, error) {
+	md, _ := metadata.FromOutContext(ctx)
+	token := ""
+	if values := md.Get("x-resume-token"); len(values) > 0 {
+		token = values[0]
+	}
+	if len(f.streams) == 0 {
+		return nil, status.New(code.Code_UNAVAILABLE, "no endpoint").Err()
+	}
+	s := f.streams[0]
+	f.streams = f.streams[1:]
+	f.calls = append(f.calls, call{token: token})
+	return &recordingStream{fakeStream: s, f: f, idx: len(f.calls) - 1}, nil
+}
+
+type recordingStream struct {
+	*fakeStream
+	f   *fakeServer
+	idx int
+}
+
+func (s *recordingStream) SendMsg(m any) error {
+	s.f.calls[s.idx].req = m
+	return s.fakeStream.SendMsg(m)
+}
+
+var (
+	unavailable = status.New(code.Code_UNAVAILABLE, "connection reset").Err()
+	watchDesc   = &stream.Desc{ServerStreams: true}
+	tokenOf     = func(msg any) string { return msg.(*wrapperspb.StringValue).GetValue() }
+)
+
+func newTestResumption(cfg map[string]any) *resumption {
+	if cfg == nil {
+		cfg = map[string]any{}
+	}
+	cfg["base_delay"] = time.Millisecond
+	return newResumption(mustLoadConfig(cfg))
+}
+
+func open(
+	t *testing.T,
+	r *resumption,
+	ctx context.Context,
+	f *fakeServer,
+) stream.ClientStream {
+	t.Helper()
+	cs, err := r.StreamClientInterceptor(ctx, watchDesc, "/svc/Watch", f.streamer)
+	require.NoError(t, err)
+	require.NoError(t, cs.SendMsg(wrapperspb.String("req")))
+	require.NoError(t, cs.CloseSend())
+	return cs
+}
+
+func recvAll(cs stream.ClientStream) ([]string, error) {
+	var out []string
+	for {
+		msg := &wrapperspb.StringValue{}
+		if err := cs.RecvMsg(msg); err != nil {
+			return out, err
+		}
+		out = append(out, msg.GetValue())
+	}
+}
+
+func TestMustLoadConfig_Defaults(t *testing.T) {
+	assert.Equal(t, "resume", BuiltinStreamClientProvider().Name())
+	cfg := mustLoadConfig(nil)
+	assert.Equal(t, "x-resume-token", cfg.Header)
+	assert.Equal(t, 5, cfg.MaxAttempts)
+	assert.Equal(t, 100*time.Millisecond, cfg.BaseDelay)
+	assert.Equal(t, 5*time.Second, cfg.MaxDelay)
+	assert.Equal(t, []string{"UNAVAILABLE"}, cfg.Codes)
+}
+
+func TestResume_HeaderToken(t *testing.T) {
+	f := &fakeServer{streams: []*fakeStream{
+		{msgs: []string{"1", "2"}, end: unavailable},
+		{msgs: []string{"3"}, end: io.EOF},
+	}}
+	ctx := WithResumer(context.Background(), Resumer{Token: tokenOf})
+	got, err := recvAll(open(t, newTestResumption(nil), ctx, f))
+	assert.ErrorIs(t, err, io.EOF)
+	assert.Equal(t, []string{"1", "2", "3"}, got)
+	require.Len(t, f.calls, 2)
+	assert.Equal(t, "", f.calls[0].token)
+	assert.Equal(t, "2", f.calls[1].token)
+	assert.Equal(t, "req", f.calls[1].req.(*wrapperspb.StringValue).GetValue())
+}
+
+func TestResume_RequestToken(t *testing.T) {
+	f := &fakeServer{streams: []*fakeStream{
+		{msgs: []string{"1"}, end: unavailable},
+		{end: io.EOF},
+	}}
+	Register("/svc/Watch", Resumer{
+		Token: tokenOf,
+		Request: func(_ any, token string) any {
+			return wrapperspb.String("from " + token)
+		},
+	})
+	t.Cleanup(func() { Register("/svc/Watch", Resumer{}) })
+
+	_, err := recvAll(open(t, newTestResumption(nil), context.Background(), f))
+	assert.ErrorIs(t, err, io.EOF)
+	require.Len(t, f.calls, 2)
+	assert.Equal(t, "", f.calls[1].token, "the request carries the token")
+	assert.Equal(t, "from 1", f.calls[1].req.(*wrapperspb.StringValue).GetValue())
+}
+
+func TestResume_GivesUp(t *testing.T) {
+	ctx := WithResumer(context.Background(), Resumer{Token: tokenOf})
+
+	// Non resumable codes are returned as is.
+	denied := status.New(code.Code_PERMISSION_DENIED, "denied").Err()
+	f := &fakeServer{streams: []*fakeStream{{msgs: []string{"1"}, end: denied}}}
+	_, err := recvAll(open(t, newTestResumption(nil), ctx, f))
+	assert.Equal(t, code.Code_PERMISSION_DENIED, status.FromError(err).Code())
+	assert.Len(t, f.calls, 1)
+
+	// Resumptions delivering nothing count against max_attempts, including
+	// the ones failing to reconnect.
+	f = &fakeServer{streams: []*fakeStream{
+		{msgs: []string{"1"}, end: unavailable},
+		{end: unavailable},
+	}}
+	r := newTestResumption(map[string]any{"max_attempts": 3})
+	got, err := recvAll(open(t, r, ctx, f))
+	assert.Equal(t, []string{"1"}, got)
+	assert.Equal(t, code.Code_UNAVAILABLE, status.FromError(err).Code())
+	assert.Len(t, f.calls, 2)
+}
+
+func TestResume_PassThrough(t *testing.T) {
+	r := newTestResumption(nil)
+	f := &fakeServer{streams: []*fakeStream{{end: unavailable}, {end: unavailable}}}
+	cs, err := r.StreamClientInterceptor(context.Background(), watchDesc, "/svc/Other", f.streamer)
+	require.NoError(t, err)
+	_, ok := cs.(*clientStream)
+	assert.False(t, ok, "methods without a resumer are not wrapped")
+
+	ctx := WithResumer(context.Background(), Resumer{Token: tokenOf})
+	bidi := &stream.Desc{ServerStreams: true, ClientStreams: true}
+	cs, err = r.StreamClientInterceptor(ctx, bidi, "/svc/Chat", f.streamer)
+	require.NoError(t, err)
+	_, ok = cs.(*clientStream)
+	assert.False(t, ok, "client streams are not wrapped")
+}
+
+func TestResume_StopsWithContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(
+		WithResumer(context.Background(), Resumer{Token: tokenOf}))
+	f := &fakeServer{streams: []*fakeStream{{end: unavailable}}}
+	r := newResumption(mustLoadConfig(map[string]any{"base_delay": time.Hour}))
+	cs := open(t, r, ctx, f)
+	done := make(chan error, 1)
+	go func() {
+		_, err := recvAll(cs)
+		done <- err
+	}()
+	cancel()
+	select {
+	case err := <-done:
+		assert.ErrorIs(t, err, unavailable)
+	case <-time.After(5 * time.Second):
+		t.Fatal("RecvMsg kept waiting after cancel")
+	}
+}
@@ -0,0 +1,379 @@
+// Copyright 2022 The codesjoy Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package timeout applies configured per-method timeouts to RPCs. On the
+// server side it caps the handler time; on the client side it sets a default
+// deadline for calls made without one. Calls cut short by a configured
+// timeout fail with a DEADLINE_EXCEEDED status naming the budget that fired.
+package timeout
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"google.golang.org/genproto/googleapis/rpc/code"
+
+	"github.com/codesjoy/yggdrasil/v3/config"
+	"github.com/codesjoy/yggdrasil/v3/observability/stats"
+	"github.com/codesjoy/yggdrasil/v3/rpc/interceptor"
+	"github.com/codesjoy/yggdrasil/v3/rpc/status"
+	"github.com/codesjoy/yggdrasil/v3/rpc/stream"
+)
+
+const name = "timeout"
+
+// Config defines the timeout interceptor configuration.
+//
+// Server and Client map full-method names or path.Match patterns such as
+// "/pkg.Service/*" to timeouts. An exact name wins over the longest matching
+// pattern, and "*" matches any method as the final fallback.
+type Config struct {
+	// Server caps the handler time of served methods.
+	Server map[string]time.Duration `mapstructure:"server"`
+	// Client sets the deadline of outgoing calls without one.
+	Client map[string]time.Duration `mapstructure:"client"`
+	// BudgetThreshold reports stats.RPCDeadlineAlmostExceeded when a call
+	// used more than this fraction of its configured timeout, e.g. 0.8.
+	// Zero disables the event.
+	BudgetThreshold float64 `mapstructure:"budget_threshold"`
+}
+
+func mustLoadConfig(source any) Config {
+	cfg := Config{}
+	if err := config.NewSnapshot(source).Decode(&cfg); err != nil {
+		panic(fmt.Sprintf("load timeout interceptor config: %v", err))
+	}
+	if cfg.BudgetThreshold < 0 || cfg.BudgetThreshold > 1 {
+		panic(fmt.Sprintf(
+			"load timeout interceptor config: budget_threshold %v out of [0, 1]",
+			cfg.BudgetThreshold,
+		))
+	}
+	return cfg
+}
+
+// BuiltinUnaryClientProvider returns the timeout unary client interceptor
+// provider.
+func BuiltinUnaryClientProvider() interceptor.UnaryClientInterceptorProvider {
+	return BuiltinUnaryClientProviderWithConfig(nil)
+}
+
+// BuiltinUnaryClientProviderWithConfig returns the timeout unary client
+// interceptor provider bound to explicit config.
+func BuiltinUnaryClientProviderWithConfig(
+	source any,
+) interceptor.UnaryClientInterceptorProvider {
+	cfg := mustLoadConfig(source)
+	return interceptor.NewUnaryClientInterceptorProvider(
+		name,
+		func(string) interceptor.UnaryClientInterceptor {
+			return UnaryClientInterceptor(cfg)
+		},
+	)
+}
+
+// BuiltinStreamClientProvider returns the timeout stream client interceptor
+// provider.
+func BuiltinStreamClientProvider() interceptor.StreamClientInterceptorProvider {
+	return BuiltinStreamClientProviderWithConfig(nil)
+}
+
+// BuiltinStreamClientProviderWithConfig returns the timeout stream client
+// interceptor provider bound to explicit config.
+func BuiltinStreamClientProviderWithConfig(
+	source any,
+) interceptor.StreamClientInterceptorProvider {
+	cfg := mustLoadConfig(source)
+	return interceptor.NewStreamClientInterceptorProvider(
+		name,
+		func(string) interceptor.StreamClientInterceptor {
+			return StreamClientInterceptor(cfg)
+		},
+	)
+}
+
+// BuiltinUnaryServerProvider returns the timeout unary server interceptor
+// provider.
+func BuiltinUnaryServerProvider() interceptor.UnaryServerInterceptorProvider {
+	return BuiltinUnaryServerProviderWithConfig(nil)
+}
+
+// BuiltinUnaryServerProviderWithConfig returns the timeout unary server
+// interceptor provider bound to explicit config.
+func BuiltinUnaryServerProviderWithConfig(
+	source any,
+) interceptor.UnaryServerInterceptorProvider {
+	cfg := mustLoadConfig(source)
+	return interceptor.NewUnaryServerInterceptorProvider(
+		name,
+		func() interceptor.UnaryServerInterceptor {
+			return UnaryServerInterceptor(cfg)
+		},
+	)
+}
+
+// BuiltinStreamServerProvider returns the timeout stream server interceptor
+// provider.
+func BuiltinStreamServerProvider() interceptor.StreamServerInterceptorProvider {
+	return BuiltinStreamServerProviderWithConfig(nil)
+}
+
+// BuiltinStreamServerProviderWithConfig returns the timeout stream server
+// interceptor provider bound to explicit config.
+func BuiltinStreamServerProviderWithConfig(
+	source any,
+) interceptor.StreamServerInterceptorProvider {
+	cfg := mustLoadConfig(source)
+	return interceptor.NewStreamServerInterceptorProvider(
+		name,
+		func() interceptor.StreamServerInterceptor {
+			return StreamServerInterceptor(cfg)
+		},
+	)
+}
+
+// UnaryServerInterceptor caps the handler time of unary methods.
+func UnaryServerInterceptor(cfg Config) interceptor.UnaryServerInterceptor {
+	return func(
+		ctx context.Context,
+		req any,
+		info *interceptor.UnaryServerInfo,
+		handler interceptor.UnaryHandler,
+	) (any, error) {
+		b, ok := newBudget(cfg, cfg.Server, false, info.FullMethod)
+		if !ok {
+			return handler(ctx, req)
+		}
+		ctx, cancel := b.apply(ctx)
+		defer cancel()
+		resp, err := handler(ctx, req)
+		return resp, b.done(ctx, err)
+	}
+}
+
+// StreamServerInterceptor caps the handler time of streaming methods.
+func StreamServerInterceptor(cfg Config) interceptor.StreamServerInterceptor {
+	return func(
+		srv any,
+		ss stream.ServerStream,
+		info *interceptor.StreamServerInfo,
+		handler stream.Handler,
+	) error {
+		b, ok := newBudget(cfg, cfg.Server, false, info.FullMethod)
+		if !ok {
+			return handler(srv, ss)
+		}
+		ctx, cancel := b.apply(ss.Context())
+		defer cancel()
+		err := handler(srv, &serverStream{ServerStream: ss, ctx: ctx})
+		return b.done(ctx, err)
+	}
+}
+
+// UnaryClientInterceptor sets the configured deadline on calls without one.
+func UnaryClientInterceptor(cfg Config) interceptor.UnaryClientInterceptor {
+	return func(
+		ctx context.Context,
+		method string,
+		req, reply any,
+		invoker interceptor.UnaryInvoker,
+	) error {
+		b, ok := newBudget(cfg, cfg.Client, true, method)
+		if !ok || hasDeadline(ctx) {
+			return invoker(ctx, method, req, reply)
+		}
+		ctx, cancel := b.apply(ctx)
+		defer cancel()
+		return b.done(ctx, invoker(ctx, method, req, reply))
+	}
+}
+
+// StreamClientInterceptor sets the configured deadline on streams without
+// one. The budget covers the whole stream.
+func StreamClientInterceptor(cfg Config) interceptor.StreamClientInterceptor {
+	return func(
+		ctx context.Context,
+		desc *stream.Desc,
+		method string,
+		streamer interceptor.Streamer,
+	) (stream.ClientStream, error) {
+		b, ok := newBudget(cfg, cfg.Client, true, method)
+		if !ok || hasDeadline(ctx) {
+			return streamer(ctx, desc, method)
+		}
+		ctx, cancel := b.apply(ctx)
+		cs, err := streamer(ctx, desc, method)
+		if err != nil {
+			cancel()
+			return nil, b.done(ctx, err)
+		}
+		return &clientStream{
+			ClientStream:  cs,
+			ctx:           ctx,
+			budget:        b,
+			cancel:        cancel,
+			serverStreams: desc.ServerStreams,
+		}, nil
+	}
+}
+
+func hasDeadline(ctx context.Context) bool {
+	_, ok := ctx.Deadline()
+	return ok
+}
+
+// budget is the configured timeout of one call.
+type budget struct {
+	client    bool
+	method    string
+	timeout   time.Duration
+	threshold float64
+	start     time.Time
+	cause     error
+}
+
+func newBudget(
+	cfg Config,
+	rules map[string]time.Duration,
+	client bool,
+	method string,
+) (*budget, bool) {
+	timeout, ok := match(rules, method)
+	if !ok {
+		return nil, false
+	}
+	side := "server"
+	if client {
+		side = "client"
+	}
+	return &budget{
+		client:    client,
+		method:    method,
+		timeout:   timeout,
+		threshold: cfg.BudgetThreshold,
+		cause: status.New(
+			code.Code_DEADLINE_EXCEEDED,
+			fmt.Sprintf("%s timeout of %s exceeded for %s", side, timeout, method),
+		).Err(),
+	}, true
+}
+
+func (b *budget) apply(ctx context.Context) (context.Context, context.CancelFunc) {
+	b.start = time.Now()
+	return context.WithTimeoutCause(ctx, b.timeout, b.cause)
+}
+
+// done reports the budget usage and replaces the error of a call cut short
+// by this budget with its cause. io.EOF marks a finished stream and is kept.
+func (b *budget) done(ctx context.Context, err error) error {
+	b.report(ctx)
+	if err != nil && err != io.EOF && errors.Is(context.Cause(ctx), b.cause) {
+		return b.cause
+	}
+	return err
+}
+
+func (b *budget) report(ctx context.Context) {
+	if b.threshold <= 0 {
+		return
+	}
+	elapsed := time.Since(b.start)
+	if float64(elapsed) <= b.threshold*float64(b.timeout) {
+		return
+	}
+	handler := stats.GetServerHandler()
+	if b.client {
+		handler = stats.GetClientHandler()
+	}
+	handler.HandleRPC(ctx, &stats.RPCDeadlineAlmostExceededBase{
+		Client:     b.client,
+		FullMethod: b.method,
+		Budget:     b.timeout,
+		Remaining:  b.timeout - elapsed,
+	})
+}
+
+// match returns the timeout configured for method.
+func match(rules map[string]time.Duration, method string) (time.Duration, bool) {
+	if len(rules) == 0 {
+		return 0, false
+	}
+	if timeout, ok := rules[method]; ok {
+		return timeout, timeout > 0
+	}
+	var (
+		best    string
+		timeout time.Duration
+		found   bool
+	)
+	for pattern, value := range rules {
+		if pattern == "*" || !strings.ContainsAny(pattern, "*?[") {
+			continue
+		}
+		if ok, err := path.Match(pattern, method); err != nil || !ok {
+			continue
+		}
+		if !found || len(pattern) > len(best) || (len(pattern) == len(best) && pattern < best) {
+			best, timeout, found = pattern, value, true
+		}
+	}
+	if !found {
+		timeout, found = rules["*"]
+	}
+	return timeout, found && timeout > 0
+}
+
+type serverStream struct {
+	stream.ServerStream
+	ctx context.Context
+}
+
+func (ss *serverStream) Context() context.Context {
+	return ss.ctx
+}
+
+// clientStream releases the budget once the stream finishes.
+type clientStream struct {
+	stream.ClientStream
+	ctx           context.Context
+	budget        *budget
+	cancel        context.CancelFunc
+	serverStreams bool
+	once          sync.Once
+}
+
+func (cs *clientStream) RecvMsg(m any) error {
+	err := cs.ClientStream.RecvMsg(m)
+	if err != nil || !cs.serverStreams {
+		cs.once.Do(func() {
+			err = cs.budget.done(cs.ctx, err)
+			cs.cancel()
+		})
+	}
+	return err
+}
+
+func (cs *clientStream) SendMsg(m any) error {
+	err := cs.ClientStream.SendMsg(m)
+	if err != nil && errors.Is(context.Cause(cs.ctx), cs.budget.cause) {
+		return cs.budget.cause
+	}
+	return err
+}
@@ -0,0 +1,278 @@
+// Copyright 2022 The codesjoy Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package timeout
+
+import (
+	"context"
+	"errors"
+	"io"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/genproto/googleapis/rpc/code"
+
+	"github.com/codesjoy/yggdrasil/v3/observability/stats"
+	"github.com/codesjoy/yggdrasil/v3/rpc/interceptor"
+	"github.com/codesjoy/yggdrasil/v3/rpc/metadata"
+	"github.com/codesjoy/yggdrasil/v3/rpc/status"
+	"github.com/codesjoy/yggdrasil/v3/rpc/stream"
+)
+
+type recordingHandler struct {
+	mu     sync.Mutex
+	events []stats.RPCDeadlineAlmostExceeded
+}
+
+func (h *recordingHandler) TagRPC(ctx context.Context, _ stats.RPCTagInfo) context.Context {
+	return ctx
+}
+
+func (h *recordingHandler) HandleRPC(_ context.Context, rs stats.RPCStats) {
+	if ev, ok := rs.(stats.RPCDeadlineAlmostExceeded); ok {
+		h.mu.Lock()
+		h.events = append(h.events, ev)
+		h.mu.Unlock()
+	}
+}
+
+func (h *recordingHandler) TagChannel(ctx context.Context, _ stats.ChanTagInfo) context.Context {
+	return ctx
+}
+
+func (h *recordingHandler) HandleChannel(context.Context, stats.ChanStats) {}
+
+func (h *recordingHandler) take() []stats.RPCDeadlineAlmostExceeded {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	out := h.events
+	h.events = nil
+	return out
+}
+
+var (
+	serverEvents = &recordingHandler{}
+	clientEvents = &recordingHandler{}
+)
+
+func init() {
+	stats.RegisterServerHandler(serverEvents)
+	stats.RegisterClientHandler(clientEvents)
+}
+
+type mockServerStream struct {
+	ctx context.Context
+}
+
+func (m *mockServerStream) Context() context.Context     { return m.ctx }
+func (m *mockServerStream) RecvMsg(interface{}) error    { return nil }
+func (m *mockServerStream) SendMsg(interface{}) error    { return nil }
+func (m *mockServerStream) SetHeader(metadata.MD) error  { return nil }
+func (m *mockServerStream) SendHeader(metadata.MD) error { return nil }
+func (m *mockServerStream) SetTrailer(metadata.MD)       {}
+
+type mockClientStream struct {
+	ctx  context.Context
+	recv func(context.Context) error
+}
+
+func (m *mockClientStream) Header() (metadata.MD, error) { return nil, nil }
+func (m *mockClientStream) Trailer() metadata.MD         { return nil }
+func (m *mockClientStream) CloseSend() error             { return nil }
+func (m *mockClientStream) Context() context.Context     { return m.ctx }
+func (m *mockClientStream) SendMsg(interface{}) error    { return nil }
+func (m *mockClientStream) RecvMsg(interface{}) error    { return m.recv(m.ctx) }
+
+func TestBuiltinProviders(t *testing.T) {
+	assert.Equal(t, "timeout", BuiltinUnaryClientProvider().Name())
+	assert.Equal(t, "timeout", BuiltinStreamClientProvider().Name())
+	assert.Equal(t, "timeout", BuiltinUnaryServerProvider().Name())
+	assert.Equal(t, "timeout", BuiltinStreamServerProvider().Name())
+
+	cfg := mustLoadConfig(map[string]any{
+		"server":           map[string]any{"/pkg.Svc/*": "2s"},
+		"budget_threshold": 0.8,
+	})
+	assert.Equal(t, 2*time.Second, cfg.Server["/pkg.Svc/*"])
+	assert.Equal(t, 0.8, cfg.BudgetThreshold)
+	assert.Panics(t, func() { mustLoadConfig(map[string]any{"budget_threshold": 2}) })
+}
+
+func TestMatch(t *testing.T) {
+	rules := map[string]time.Duration{
+		"/pkg.Svc/Get": time.Second,
+		"/pkg.Svc/*":   2 * time.Second,
+		"/pkg.*/*":     3 * time.Second,
+		"/pkg.Svc/Off": 0,
+		"*":            4 * time.Second,
+	}
+	for method, want := range map[string]time.Duration{
+		"/pkg.Svc/Get":   time.Second,
+		"/pkg.Svc/List":  2 * time.Second,
+		"/pkg.Other/Get": 3 * time.Second,
+		"/other.Svc/Get": 4 * time.Second,
+	} {
+		got, ok := match(rules, method)
+		assert.True(t, ok, method)
+		assert.Equal(t, want, got, method)
+	}
+	_, ok := match(rules, "/pkg.Svc/Off")
+	assert.False(t, ok)
+	_, ok = match(nil, "/pkg.Svc/Get")
+	assert.False(t, ok)
+}
+
+func waitDone(ctx context.Context, _ any) (any, error) {
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+func TestUnaryServerCapsHandler(t *testing.T) {
+	cfg := Config{Server: map[string]time.Duration{"/svc/Slow": 20 * time.Millisecond}}
+	info := &interceptor.UnaryServerInfo{FullMethod: "/svc/Slow"}
+
+	_, err := UnaryServerInterceptor(cfg)(context.Background(), nil, info, waitDone)
+	st := status.FromError(err)
+	assert.Equal(t, code.Code_DEADLINE_EXCEEDED, st.Code())
+	assert.Equal(t, "server timeout of 20ms exceeded for /svc/Slow", st.Message())
+
+	// A sooner caller deadline keeps its own error.
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond)
+	defer cancel()
+	_, err = UnaryServerInterceptor(cfg)(ctx, nil, info, waitDone)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+
+	// Unconfigured methods run untouched.
+	info = &interceptor.UnaryServerInfo{FullMethod: "/svc/Other"}
+	resp, err := UnaryServerInterceptor(cfg)(context.Background(), "req", info,
+		func(ctx context.Context, req any) (any, error) {
+			assert.False(t, hasDeadline(ctx))
+			return req, nil
+		})
+	require.NoError(t, err)
+	assert.Equal(t, "req", resp)
+}
+
+func TestStreamServerCapsHandler(t *testing.T) {
+	cfg := Config{Server: map[string]time.Duration{"*": 20 * time.Millisecond}}
+	err := StreamServerInterceptor(cfg)(nil, &mockServerStream{ctx: context.Background()},
+		&interceptor.StreamServerInfo{FullMethod: "/svc/Watch"},
+		func(_ any, ss stream.ServerStream) error {
+			<-ss.Context().Done()
+			return ss.Context().Err()
+		})
+	assert.Equal(t, code.Code_DEADLINE_EXCEEDED, status.FromError(err).Code())
+	assert.Contains(t, status.FromError(err).Message(), "server timeout of 20ms")
+}
+
+func TestUnaryClientDefaultDeadline(t *testing.T) {
+	cfg := Config{Client: map[string]time.Duration{"/svc/Get": time.Hour}}
+	invoker := func(ctx context.Context, _ string, _, _ any) error {
+		deadline, ok := ctx.Deadline()
+		require.True(t, ok)
+		assert.WithinDuration(t, time.Now().Add(time.Hour), deadline, time.Minute)
+		return nil
+	}
+	unary := UnaryClientInterceptor(cfg)
+	require.NoError(t, unary(context.Background(), "/svc/Get", nil, nil, invoker))
+
+	// A caller deadline wins.
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	want, _ := ctx.Deadline()
+	require.NoError(t, UnaryClientInterceptor(cfg)(ctx, "/svc/Get", nil, nil,
+		func(ctx context.Context, _ string, _, _ any) error {
+			got, _ := ctx.Deadline()
+			assert.Equal(t, want, got)
+			return nil
+		}))
+
+	cfg = Config{Client: map[string]time.Duration{"*": 10 * time.Millisecond}}
+	err := UnaryClientInterceptor(cfg)(context.Background(), "/svc/Get", nil, nil,
+		func(ctx context.Context, _ string, _, _ any) error {
+			<-ctx.Done()
+			return status.New(code.Code_DEADLINE_EXCEEDED, "context deadline exceeded").Err()
+		})
+	assert.Equal(t, "client timeout of 10ms exceeded for /svc/Get", status.FromError(err).Message())
+}
+
+func TestStreamClientBudget(t *testing.T) {
+	cfg := Config{Client: map[string]time.Duration{"*": 10 * time.Millisecond}}
+	streamer := func(ctx context.Context, _ *stream.Desc, _ string) (stream.ClientStream, error) {
+		return &mockClientStream{ctx: ctx, recv: func(ctx context.Context) error {
+			<-ctx.Done()
+			return errors.New("stream reset")
+		}}, nil
+	}
+	cs, err := StreamClientInterceptor(cfg)(context.Background(),
+		&stream.Desc{ServerStreams: true}, "/svc/Watch", streamer)
+	require.NoError(t, err)
+	err = cs.RecvMsg(nil)
+	assert.Equal(t, "client timeout of 10ms exceeded for /svc/Watch",
+		status.FromError(err).Message())
+
+	// Finished streams release the budget.
+	streamer = func(ctx context.Context, _ *stream.Desc, _ string) (stream.ClientStream, error) {
+		return &mockClientStream{ctx: ctx, recv: func(context.Context) error { return io.EOF }}, nil
+	}
+	cfg = Config{Client: map[string]time.Duration{"*": time.Hour}}
+	cs, err = StreamClientInterceptor(cfg)(context.Background(),
+		&stream.Desc{ServerStreams: true}, "/svc/Watch", streamer)
+	require.NoError(t, err)
+	assert.ErrorIs(t, cs.RecvMsg(nil), io.EOF)
+	assert.ErrorIs(t, cs.Context().Err(), context.Canceled)
+}
+
+func TestBudgetThresholdEvent(t *testing.T) {
+	serverEvents.take()
+	clientEvents.take()
+	cfg := Config{
+		Server:          map[string]time.Duration{"*": 100 * time.Millisecond},
+		Client:          map[string]time.Duration{"*": 100 * time.Millisecond},
+		BudgetThreshold: 0.5,
+	}
+	info := &interceptor.UnaryServerInfo{FullMethod: "/svc/Get"}
+
+	_, err := UnaryServerInterceptor(cfg)(context.Background(), nil, info,
+		func(context.Context, any) (any, error) { return nil, nil })
+	require.NoError(t, err)
+	assert.Empty(t, serverEvents.take())
+
+	_, err = UnaryServerInterceptor(cfg)(context.Background(), nil, info,
+		func(context.Context, any) (any, error) {
+			time.Sleep(60 * time.Millisecond)
+			return nil, nil
+		})
+	require.NoError(t, err)
+	events := serverEvents.take()
+	require.Len(t, events, 1)
+	assert.False(t, events[0].IsClient())
+	assert.Equal(t, "/svc/Get", events[0].GetFullMethod())
+	assert.Equal(t, 100*time.Millisecond, events[0].GetBudget())
+	assert.Less(t, events[0].GetRemaining(), 50*time.Millisecond)
+
+	err = UnaryClientInterceptor(cfg)(context.Background(), "/svc/Get", nil, nil,
+		func(ctx context.Context, _ string, _, _ any) error {
+			<-ctx.Done()
+			return ctx.Err()
+		})
+	assert.Equal(t, code.Code_DEADLINE_EXCEEDED, status.FromError(err).Code())
+	events = clientEvents.take()
+	require.Len(t, events, 1)
+	assert.True(t, events[0].IsClient())
+	assert.LessOrEqual(t, events[0].GetRemaining(), time.Duration(0))
+}
@@ -0,0 +1,250 @@
+// Copyright 2022 The codesjoy Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package tuning serves the runtime adjustments configured under
+// "yggdrasil.tuning".
+//
+// Operators switch named server interceptors off for some services or
+// methods and override interceptor parameters, such as the slow threshold of
+// the logging interceptor or the rate of the rate limit interceptor, without
+// a redeploy. The module returned by Module replaces the tuning whenever the
+// configuration is reloaded; interceptors read their section through a Value.
+//
+// A typical tuning written by the governor "/tuning" route looks like:
+//
+//	yggdrasil:
+//	  tuning:
+//	    disabled:
+//	      logging: ["pkg.Greeter", "/pkg.Other/Get"]
+//	    logging:
+//	      slow_threshold: 200ms
+//	      print_req_and_res: true
+//	    rate_limit:
+//	      rate: 50
+package tuning
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"path"
+	"strings"
+	"sync/atomic"
+
+	"github.com/codesjoy/yggdrasil/v3/config"
+	"github.com/codesjoy/yggdrasil/v3/module"
+)
+
+const (
+	// ModuleName is the name of the tuning module.
+	ModuleName = "tuning"
+	// ConfigPath is the config path holding the tuning.
+	ConfigPath = "yggdrasil.tuning"
+)
+
+// Settings is the part of the tuning interpreted by this package. Other keys
+// are sections owned by the interceptors reading them.
+type Settings struct {
+	// Disabled maps server interceptor names to the targets they are skipped
+	// for. A target is a service name such as "pkg.Greeter", a full method
+	// such as "/pkg.Greeter/SayHello", a glob over full methods or "*".
+	Disabled map[string][]string `mapstructure:"disabled"`
+}
+
+type state struct {
+	generation uint64
+	snapshot   config.Snapshot
+	disabled   map[string][]string
+}
+
+var (
+	current    atomic.Pointer[state]
+	generation atomic.Uint64
+)
+
+func newState(value map[string]any) (*state, error) {
+	snapshot := config.NewSnapshot(value)
+	var settings Settings
+	if err := snapshot.Decode(&settings); err != nil {
+		return nil, fmt.Errorf("load tuning: %w", err)
+	}
+	disabled := map[string][]string{}
+	for name, targets := range settings.Disabled {
+		if len(targets) > 0 {
+			disabled[name] = targets
+		}
+	}
+	return &state{snapshot: snapshot, disabled: disabled}, nil
+}
+
+// store installs a copy of s under a new generation so that cached values
+// are rebuilt even when a previous state is restored. A nil s clears the
+// tuning.
+func store(s *state) {
+	if s == nil {
+		current.Store(nil)
+		return
+	}
+	next := *s
+	next.generation = generation.Add(1)
+	current.Store(&next)
+}
+
+func load() *state {
+	if s := current.Load(); s != nil {
+		return s
+	}
+	return &state{}
+}
+
+// Validate reports whether value, the tree found at ConfigPath, is a valid
+// tuning.
+func Validate(value map[string]any) error {
+	_, err := newState(value)
+	return err
+}
+
+// Section returns the tuning under path. It is empty when nothing is tuned
+// there.
+func Section(path ...string) config.Snapshot {
+	return load().snapshot.Section(path...)
+}
+
+// Disabled reports whether the server interceptor name is switched off for
+// fullMethod.
+func Disabled(name, fullMethod string) bool {
+	targets := load().disabled[name]
+	for _, target := range targets {
+		if matchTarget(target, fullMethod) {
+			return true
+		}
+	}
+	return false
+}
+
+// AnyDisabled reports whether any interceptor is switched off.
+func AnyDisabled() bool {
+	return len(load().disabled) > 0
+}
+
+func matchTarget(target, fullMethod string) bool {
+	if target == "*" || target == fullMethod {
+		return true
+	}
+	if !strings.HasPrefix(target, "/") {
+		service, _, ok := strings.Cut(strings.TrimPrefix(fullMethod, "/"), "/")
+		return ok && service == target
+	}
+	ok, err := path.Match(target, fullMethod)
+	return err == nil && ok
+}
+
+// Value decodes the tuning found at a fixed path and keeps it until the
+// tuning changes.
+type Value[T any] struct {
+	path  []string
+	entry atomic.Pointer[valueEntry[T]]
+}
+
+type valueEntry[T any] struct {
+	generation uint64
+	value      T
+	ok         bool
+}
+
+// NewValue returns a value decoding the tuning under path.
+func NewValue[T any](path ...string) *Value[T] {
+	return &Value[T]{path: path}
+}
+
+// Get returns the decoded tuning. It reports false when nothing is tuned at
+// the path or the tuning there is invalid.
+func (v *Value[T]) Get() (T, bool) {
+	s := load()
+	if entry := v.entry.Load(); entry != nil && entry.generation == s.generation {
+		return entry.value, entry.ok
+	}
+	entry := &valueEntry[T]{generation: s.generation}
+	if section := s.snapshot.Section(v.path...); !section.Empty() {
+		if err := section.Decode(&entry.value); err != nil {
+			slog.Warn("invalid tuning",
+				slog.Any("path", v.path),
+				slog.Any("error", err))
+		} else {
+			entry.ok = true
+		}
+	}
+	v.entry.Store(entry)
+	return entry.value, entry.ok
+}
+
+type tuningModule struct{}
+
+// Module returns the module serving the tuning configured under ConfigPath.
+// The tuning is replaced when the configuration is reloaded.
+func Module() module.Module {
+	return tuningModule{}
+}
+
+func (tuningModule) Name() string { return ModuleName }
+
+func (tuningModule) ConfigPath() string { return ConfigPath }
+
+func (tuningModule) Init(_ context.Context, view config.View) error {
+	next, err := decodeState(view)
+	if err != nil {
+		return err
+	}
+	store(next)
+	return nil
+}
+
+func (tuningModule) PrepareReload(
+	_ context.Context,
+	view config.View,
+) (module.ReloadCommitter, error) {
+	next, err := decodeState(view)
+	if err != nil {
+		return nil, err
+	}
+	return stateCommitter{next: next, prev: current.Load()}, nil
+}
+
+func (tuningModule) Stop(context.Context) error {
+	store(nil)
+	return nil
+}
+
+func decodeState(view config.View) (*state, error) {
+	value := map[string]any{}
+	if err := view.Decode(&value); err != nil {
+		return nil, fmt.Errorf("load tuning: %w", err)
+	}
+	return newState(value)
+}
+
+type stateCommitter struct {
+	next *state
+	prev *state
+}
+
+func (c stateCommitter) Commit(context.Context) error {
+	store(c.next)
+	return nil
+}
+
+func (c stateCommitter) Rollback(context.Context) error {
+	store(c.prev)
+	return nil
+}
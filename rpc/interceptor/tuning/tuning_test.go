@@ -0,0 +1,109 @@
+// Copyright 2022 The codesjoy Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tuning
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/codesjoy/yggdrasil/v3/config"
+	"github.com/codesjoy/yggdrasil/v3/module"
+)
+
+func initModule(t *testing.T, value map[string]any) module.Module {
+	t.Helper()
+	m := Module()
+	require.NoError(t, m.(module.Initializable).Init(context.Background(),
+		config.NewView(ConfigPath, config.NewSnapshot(value))))
+	t.Cleanup(func() { _ = m.(module.Stoppable).Stop(context.Background()) })
+	return m
+}
+
+func TestDisabled(t *testing.T) {
+	m := initModule(t, map[string]any{
+		"disabled": map[string]any{
+			"logging":    []any{"pkg.Greeter", "/pkg.Other/Get"},
+			"rate_limit": []any{"/pkg.Batch/*"},
+			"recovery":   []any{},
+		},
+	})
+	assert.Equal(t, ModuleName, m.Name())
+	assert.Equal(t, ConfigPath, m.(module.Configurable).ConfigPath())
+	assert.True(t, AnyDisabled())
+
+	assert.True(t, Disabled("logging", "/pkg.Greeter/SayHello"))
+	assert.True(t, Disabled("logging", "/pkg.Other/Get"))
+	assert.False(t, Disabled("logging", "/pkg.Other/List"))
+	assert.False(t, Disabled("logging", "/pkg.GreeterV2/SayHello"))
+	assert.True(t, Disabled("rate_limit", "/pkg.Batch/Import"))
+	assert.False(t, Disabled("rate_limit", "/pkg.Greeter/SayHello"))
+	assert.False(t, Disabled("recovery", "/pkg.Greeter/SayHello"))
+
+	committer, err := m.(module.Reloadable).PrepareReload(context.Background(),
+		config.NewView(ConfigPath, config.NewSnapshot(map[string]any{
+			"disabled": map[string]any{"recovery": []any{"*"}},
+		})))
+	require.NoError(t, err)
+	assert.True(t, Disabled("logging", "/pkg.Other/Get"),
+		"prepared tuning is not visible before commit")
+	require.NoError(t, committer.Commit(context.Background()))
+	assert.False(t, Disabled("logging", "/pkg.Other/Get"))
+	assert.True(t, Disabled("recovery", "/pkg.Greeter/SayHello"))
+
+	require.NoError(t, committer.Rollback(context.Background()))
+	assert.True(t, Disabled("logging", "/pkg.Other/Get"))
+}
+
+func TestValue(t *testing.T) {
+	type logging struct {
+		SlowThreshold time.Duration `mapstructure:"slow_threshold"`
+	}
+	m := initModule(t, map[string]any{
+		"logging": map[string]any{"slow_threshold": "200ms"},
+	})
+	value := NewValue[logging]("logging")
+	got, ok := value.Get()
+	assert.True(t, ok)
+	assert.Equal(t, 200*time.Millisecond, got.SlowThreshold)
+	_, ok = NewValue[logging]("rate_limit").Get()
+	assert.False(t, ok)
+
+	committer, err := m.(module.Reloadable).PrepareReload(context.Background(),
+		config.NewView(ConfigPath, config.NewSnapshot(map[string]any{
+			"logging": map[string]any{"slow_threshold": "bad"},
+		})))
+	require.NoError(t, err)
+	require.NoError(t, committer.Commit(context.Background()))
+	_, ok = value.Get()
+	assert.False(t, ok, "invalid tuning is ignored")
+
+	require.NoError(t, m.(module.Stoppable).Stop(context.Background()))
+	_, ok = value.Get()
+	assert.False(t, ok)
+	assert.False(t, AnyDisabled())
+}
+
+func TestValidate(t *testing.T) {
+	assert.NoError(t, Validate(map[string]any{
+		"disabled": map[string]any{"logging": []any{"*"}},
+		"logging":  map[string]any{"slow_threshold": "1s"},
+	}))
+	assert.Error(t, Validate(map[string]any{"disabled": []any{"logging"}}))
+	assert.True(t, Section("logging").Empty())
+}
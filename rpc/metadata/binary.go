@@ -0,0 +1,114 @@
+// Copyright 2022 The codesjoy Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package metadata
+
+import (
+	"encoding/base64"
+	"strings"
+)
+
+// BinarySuffix marks keys whose values carry arbitrary bytes. Text based
+// transports base64 encode such values on the wire, as gRPC does.
+const BinarySuffix = "-bin"
+
+// IsBinaryKey reports whether k carries binary values.
+func IsBinaryKey(k string) bool {
+	return strings.HasSuffix(strings.ToLower(k), BinarySuffix)
+}
+
+func binaryKey(k string) string {
+	k = strings.ToLower(k)
+	if !strings.HasSuffix(k, BinarySuffix) {
+		k += BinarySuffix
+	}
+	return k
+}
+
+// SetBinary sets the binary values of key k. The -bin suffix is appended to
+// k when missing.
+func (md MD) SetBinary(k string, vals ...[]byte) {
+	if len(vals) == 0 {
+		return
+	}
+	md[binaryKey(k)] = binaryStrings(vals)
+}
+
+// AppendBinary adds binary values to key k. The -bin suffix is appended to
+// k when missing.
+func (md MD) AppendBinary(k string, vals ...[]byte) {
+	if len(vals) == 0 {
+		return
+	}
+	k = binaryKey(k)
+	md[k] = append(md[k], binaryStrings(vals)...)
+}
+
+// GetBinary obtains the binary values of key k. The -bin suffix is appended
+// to k when missing.
+func (md MD) GetBinary(k string) [][]byte {
+	vals := md[binaryKey(k)]
+	if len(vals) == 0 {
+		return nil
+	}
+	out := make([][]byte, len(vals))
+	for i, v := range vals {
+		out[i] = []byte(v)
+	}
+	return out
+}
+
+func binaryStrings(vals [][]byte) []string {
+	out := make([]string, len(vals))
+	for i, v := range vals {
+		out[i] = string(v)
+	}
+	return out
+}
+
+// EncodeBinaryHeader encodes a binary value for a text header using
+// unpadded standard base64, matching grpc-go.
+func EncodeBinaryHeader(v []byte) string {
+	return base64.RawStdEncoding.EncodeToString(v)
+}
+
+// DecodeBinaryHeader decodes a binary header value, accepting both padded
+// and unpadded base64.
+func DecodeBinaryHeader(v string) ([]byte, error) {
+	if len(v)%4 == 0 {
+		return base64.StdEncoding.DecodeString(v)
+	}
+	return base64.RawStdEncoding.DecodeString(v)
+}
+
+// EncodeHeaderValue returns the wire form of value v of key k: binary values
+// are base64 encoded and others are returned unchanged.
+func EncodeHeaderValue(k, v string) string {
+	if IsBinaryKey(k) {
+		return EncodeBinaryHeader([]byte(v))
+	}
+	return v
+}
+
+// DecodeHeaderValue reverses EncodeHeaderValue.
+func DecodeHeaderValue(k, v string) (string, error) {
+	if !IsBinaryKey(k) {
+		return v, nil
+	}
+	b, err := DecodeBinaryHeader(v)
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
@@ -0,0 +1,51 @@
+// Copyright 2022 The codesjoy Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package metadata
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBinaryValues(t *testing.T) {
+	md := MD{}
+	md.SetBinary("Trace", []byte{0x00, 0xff})
+	md.AppendBinary("trace-bin", []byte("x"))
+
+	assert.Equal(t, []string{"\x00\xff", "x"}, md["trace-bin"])
+	assert.Equal(t, [][]byte{{0x00, 0xff}, []byte("x")}, md.GetBinary("trace"))
+	assert.Nil(t, md.GetBinary("missing"))
+	assert.True(t, IsBinaryKey("Trace-Bin"))
+	assert.False(t, IsBinaryKey("trace"))
+}
+
+func TestHeaderValueEncoding(t *testing.T) {
+	assert.Equal(t, "AP8", EncodeHeaderValue("trace-bin", "\x00\xff"))
+	assert.Equal(t, "plain", EncodeHeaderValue("x-id", "plain"))
+
+	for _, wire := range []string{"AP8", "AP8="} {
+		v, err := DecodeHeaderValue("trace-bin", wire)
+		require.NoError(t, err)
+		assert.Equal(t, "\x00\xff", v)
+	}
+	v, err := DecodeHeaderValue("x-id", "AP8")
+	require.NoError(t, err)
+	assert.Equal(t, "AP8", v)
+
+	_, err = DecodeHeaderValue("trace-bin", "!!")
+	assert.Error(t, err)
+}
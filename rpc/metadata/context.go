@@ -78,6 +78,12 @@ func WithStreamContext(ctx context.Context) context.Context {
 	return ctx
 }
 
+// NewStreamContext returns a new context with a fresh stream attached,
+// shadowing any stream already attached to ctx.
+func NewStreamContext(ctx context.Context) context.Context {
+	return context.WithValue(ctx, streamKey{}, &stream{})
+}
+
 // SetTrailer sets the trailer metadata attached to the given context.
 func SetTrailer(ctx context.Context, md MD) error {
 	h, ok := ctx.Value(streamKey{}).(*stream)
@@ -244,6 +244,20 @@ func TestWithStreamContext(t *testing.T) {
 	})
 }
 
+// TestNewStreamContext tests shadowing an existing stream context
+func TestNewStreamContext(t *testing.T) {
+	parent := WithStreamContext(context.Background())
+	require.NoError(t, SetHeader(parent, Pairs("k", "parent")))
+
+	child := NewStreamContext(parent)
+	require.NoError(t, SetHeader(child, Pairs("k", "child")))
+
+	md, _ := FromHeaderCtx(parent)
+	assert.Equal(t, []string{"parent"}, md.Get("k"))
+	md, _ = FromHeaderCtx(child)
+	assert.Equal(t, []string{"child"}, md.Get("k"))
+}
+
 // TestSetHeader tests setting header metadata
 func TestSetHeader(t *testing.T) {
 	t.Run("set header on stream context", func(t *testing.T) {
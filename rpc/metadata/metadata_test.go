@@ -529,3 +529,32 @@ func TestMD_RealWorldScenarios(t *testing.T) {
 		assert.Equal(t, []string{"456"}, downstream2["user-id"])
 	})
 }
+
+func TestMDValidate(t *testing.T) {
+	limits := Limits{
+		MaxKeyBytes:      10,
+		MaxValueBytes:    10,
+		MaxTotalBytes:    200,
+		ReservedPrefixes: []string{"yggdrasil-"},
+	}
+
+	assert.NoError(t, Pairs("x-id", "abc", "trace-bin", "\x00\x01").Validate(limits))
+	assert.NoError(t, MD{}.Validate(limits))
+
+	cases := map[string]MD{
+		"invalid key":     {"x id": {"v"}},
+		"upper key":       {"X-Id": {"v"}},
+		"reserved prefix": {"yggdrasil-x": {"v"}},
+		"long key":        {"abcdefghijk": {"v"}},
+		"invalid value":   {"x-id": {"a\nb"}},
+		"long values":     {"x-id": {"123456", "123456"}},
+		"total size":      {"a": {"1"}, "b": {"1"}, "c": {"1"}, "d": {"1"}, "e": {"1"}, "f": {"1"}},
+	}
+	for name, md := range cases {
+		t.Run(name, func(t *testing.T) {
+			err := md.Validate(limits)
+			var verr *ValidationError
+			assert.ErrorAs(t, err, &verr)
+		})
+	}
+}
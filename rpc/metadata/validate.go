@@ -0,0 +1,125 @@
+// Copyright 2022 The codesjoy Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package metadata
+
+import (
+	"fmt"
+	"strings"
+)
+
+// HeaderFieldOverhead is the per-entry overhead HTTP/2 adds when sizing a
+// header list, see RFC 7540 section 6.5.2.
+const HeaderFieldOverhead = 32
+
+// Limits bounds the metadata accepted by Validate. Zero values disable the
+// corresponding check.
+type Limits struct {
+	// MaxKeyBytes bounds the length of a single key.
+	MaxKeyBytes int
+	// MaxValueBytes bounds the summed length of the values of a single key.
+	MaxValueBytes int
+	// MaxTotalBytes bounds the header list size, counted as HTTP/2 does.
+	MaxTotalBytes int
+	// ReservedPrefixes lists key prefixes no caller may set.
+	ReservedPrefixes []string
+}
+
+// ValidationError reports metadata rejected by Validate.
+type ValidationError struct {
+	// Key is the offending key; it is empty when the total size is exceeded.
+	Key    string
+	Reason string
+}
+
+func (e *ValidationError) Error() string {
+	if e.Key == "" {
+		return "metadata: " + e.Reason
+	}
+	return fmt.Sprintf("metadata: key %q: %s", e.Key, e.Reason)
+}
+
+// ValidKey reports whether k only contains the characters allowed in keys:
+// digits, lowercase letters and -_.
+func ValidKey(k string) bool {
+	if k == "" {
+		return false
+	}
+	for i := 0; i < len(k); i++ {
+		c := k[i]
+		switch {
+		case c >= 'a' && c <= 'z', c >= '0' && c <= '9', c == '-', c == '_', c == '.':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// ValidValue reports whether v only contains printable ASCII, as required
+// for values of keys without the -bin suffix.
+func ValidValue(v string) bool {
+	for i := 0; i < len(v); i++ {
+		if v[i] < 0x20 || v[i] > 0x7e {
+			return false
+		}
+	}
+	return true
+}
+
+// Validate checks md against the key charset, the value charset and l. It
+// returns a *ValidationError describing the first violation.
+func (md MD) Validate(l Limits) error {
+	total := 0
+	for k, vals := range md {
+		if !ValidKey(k) {
+			return &ValidationError{Key: k, Reason: "invalid character in key"}
+		}
+		for _, prefix := range l.ReservedPrefixes {
+			if strings.HasPrefix(k, prefix) {
+				return &ValidationError{
+					Key:    k,
+					Reason: fmt.Sprintf("prefix %q is reserved", prefix),
+				}
+			}
+		}
+		if l.MaxKeyBytes > 0 && len(k) > l.MaxKeyBytes {
+			return &ValidationError{
+				Key:    k,
+				Reason: fmt.Sprintf("key exceeds %d bytes", l.MaxKeyBytes),
+			}
+		}
+		size := 0
+		binary := strings.HasSuffix(k, "-bin")
+		for _, v := range vals {
+			if !binary && !ValidValue(v) {
+				return &ValidationError{Key: k, Reason: "invalid character in value"}
+			}
+			size += len(v)
+			total += len(k) + len(v) + HeaderFieldOverhead
+		}
+		if l.MaxValueBytes > 0 && size > l.MaxValueBytes {
+			return &ValidationError{
+				Key:    k,
+				Reason: fmt.Sprintf("values exceed %d bytes", l.MaxValueBytes),
+			}
+		}
+	}
+	if l.MaxTotalBytes > 0 && total > l.MaxTotalBytes {
+		return &ValidationError{
+			Reason: fmt.Sprintf("size %d exceeds %d bytes", total, l.MaxTotalBytes),
+		}
+	}
+	return nil
+}
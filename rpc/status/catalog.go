@@ -0,0 +1,117 @@
+// Copyright 2022 The codesjoy Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package status
+
+import (
+	"encoding/json"
+	"io"
+	"sort"
+	"sync"
+
+	"github.com/codesjoy/pkg/basic/xerror"
+	"google.golang.org/genproto/googleapis/rpc/code"
+)
+
+// ReasonEntry describes one error reason in the reason catalog.
+type ReasonEntry struct {
+	Domain      string `json:"domain"`
+	Reason      string `json:"reason"`
+	Code        string `json:"code"`
+	HTTPCode    int32  `json:"http_code"`
+	Description string `json:"description,omitempty"`
+}
+
+type reasonKey struct {
+	domain string
+	reason string
+}
+
+var (
+	catalogMu sync.RWMutex
+	catalog   = map[reasonKey]ReasonEntry{}
+)
+
+// RegisterReasons adds reasons to the catalog served by the governor, so
+// client teams can browse the error semantics of a service. Generated reason
+// enums can be registered with all their values.
+func RegisterReasons(reasons ...xerror.Reason) {
+	entries := make([]ReasonEntry, 0, len(reasons))
+	for _, r := range reasons {
+		if r == nil {
+			continue
+		}
+		entries = append(entries, ReasonEntry{
+			Domain: r.Domain(),
+			Reason: r.Reason(),
+			Code:   r.Code().String(),
+		})
+	}
+	RegisterReasonEntries(entries...)
+}
+
+// RegisterReasonEntries adds described entries to the reason catalog. An
+// entry replaces an earlier one with the same domain and reason.
+func RegisterReasonEntries(entries ...ReasonEntry) {
+	catalogMu.Lock()
+	defer catalogMu.Unlock()
+	for _, entry := range entries {
+		if entry.HTTPCode == 0 {
+			c, ok := code.Code_value[entry.Code]
+			if !ok {
+				c = int32(code.Code_UNKNOWN)
+			}
+			entry.HTTPCode = statusCodeToHTTPCode(code.Code(c))
+		}
+		catalog[reasonKey{domain: entry.Domain, reason: entry.Reason}] = entry
+	}
+}
+
+// ReasonCatalog returns the registered reasons ordered by domain and reason.
+func ReasonCatalog() []ReasonEntry {
+	catalogMu.RLock()
+	out := make([]ReasonEntry, 0, len(catalog))
+	for _, entry := range catalog {
+		out = append(out, entry)
+	}
+	catalogMu.RUnlock()
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Domain != out[j].Domain {
+			return out[i].Domain < out[j].Domain
+		}
+		return out[i].Reason < out[j].Reason
+	})
+	return out
+}
+
+// WriteReasonCatalog writes the registered reasons as indented JSON in the
+// shape served by the governor, so the catalog can be published alongside a
+// service's API definitions.
+func WriteReasonCatalog(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(map[string]any{"reasons": ReasonCatalog()})
+}
+
+// ReasonConstructor returns a constructor for errors carrying reason, so each
+// reason value can have its own typed helper:
+//
+//	var NewBookNotFound = status.ReasonConstructor(pb.Reason_BOOK_NOT_FOUND)
+//
+// The returned function wraps err with the reason and the given metadata.
+func ReasonConstructor(reason xerror.Reason) func(err error, md map[string]string) error {
+	return func(err error, md map[string]string) error {
+		return xerror.WrapWithReason(err, reason, "", md)
+	}
+}
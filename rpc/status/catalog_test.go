@@ -0,0 +1,101 @@
+// Copyright 2022 The codesjoy Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package status
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/codesjoy/pkg/basic/xerror"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/genproto/googleapis/rpc/code"
+)
+
+func TestReasonCatalog(t *testing.T) {
+	catalogMu.Lock()
+	saved := catalog
+	catalog = map[reasonKey]ReasonEntry{}
+	catalogMu.Unlock()
+	defer func() {
+		catalogMu.Lock()
+		catalog = saved
+		catalogMu.Unlock()
+	}()
+
+	RegisterReasons(
+		testReason{reason: "BOOK_NOT_FOUND", domain: "library", code: code.Code_NOT_FOUND},
+		nil,
+		testReason{reason: "INVALID_INPUT", domain: "account", code: code.Code_INVALID_ARGUMENT},
+	)
+	RegisterReasonEntries(ReasonEntry{
+		Domain:      "library",
+		Reason:      "BOOK_NOT_FOUND",
+		Code:        "NOT_FOUND",
+		Description: "The requested book does not exist.",
+	})
+
+	entries := ReasonCatalog()
+	require.Len(t, entries, 2)
+	assert.Equal(t, ReasonEntry{
+		Domain:   "account",
+		Reason:   "INVALID_INPUT",
+		Code:     "INVALID_ARGUMENT",
+		HTTPCode: http.StatusBadRequest,
+	}, entries[0])
+	assert.Equal(t, "The requested book does not exist.", entries[1].Description)
+	assert.Equal(t, int32(http.StatusNotFound), entries[1].HTTPCode)
+}
+
+func TestWriteReasonCatalog(t *testing.T) {
+	catalogMu.Lock()
+	saved := catalog
+	catalog = map[reasonKey]ReasonEntry{}
+	catalogMu.Unlock()
+	defer func() {
+		catalogMu.Lock()
+		catalog = saved
+		catalogMu.Unlock()
+	}()
+
+	RegisterReasons(
+		testReason{reason: "BOOK_NOT_FOUND", domain: "library", code: code.Code_NOT_FOUND},
+	)
+	var buf bytes.Buffer
+	require.NoError(t, WriteReasonCatalog(&buf))
+
+	var out struct {
+		Reasons []ReasonEntry `json:"reasons"`
+	}
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &out))
+	require.Len(t, out.Reasons, 1)
+	assert.Equal(t, "BOOK_NOT_FOUND", out.Reasons[0].Reason)
+	assert.Equal(t, int32(http.StatusNotFound), out.Reasons[0].HTTPCode)
+}
+
+func TestReasonConstructor(t *testing.T) {
+	reason := testReason{reason: "BOOK_NOT_FOUND", domain: "library", code: code.Code_NOT_FOUND}
+	newBookNotFound := ReasonConstructor(reason)
+
+	err := newBookNotFound(errors.New("missing"), map[string]string{"id": "42"})
+	assert.True(t, xerror.IsReason(err, reason))
+	st := FromError(err)
+	assert.Equal(t, code.Code_NOT_FOUND, st.Code())
+	assert.Equal(t, "BOOK_NOT_FOUND", st.ErrorInfo().GetReason())
+	assert.Equal(t, "42", st.ErrorInfo().GetMetadata()["id"])
+}
@@ -0,0 +1,182 @@
+// Copyright 2022 The codesjoy Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package status
+
+import (
+	"time"
+
+	"google.golang.org/genproto/googleapis/rpc/code"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/durationpb"
+)
+
+// findDetail unmarshals the first detail of the type of target into target.
+func (e *Status) findDetail(target proto.Message) bool {
+	if e == nil || e.stu == nil {
+		return false
+	}
+	for _, detail := range e.stu.Details {
+		if detail.MessageIs(target) {
+			return detail.UnmarshalTo(target) == nil
+		}
+	}
+	return false
+}
+
+// WithRetryInfo adds a RetryInfo detail asking the client to wait delay
+// before retrying. The REST gateway also sends it as a Retry-After header.
+func (e *Status) WithRetryInfo(delay time.Duration) *Status {
+	return e.WithDetails(&errdetails.RetryInfo{RetryDelay: durationpb.New(delay)})
+}
+
+// RetryInfo returns the RetryInfo detail of the status.
+func (e *Status) RetryInfo() *errdetails.RetryInfo {
+	info := &errdetails.RetryInfo{}
+	if e.findDetail(info) {
+		return info
+	}
+	return nil
+}
+
+// RetryDelay returns the delay of the RetryInfo detail and whether it is set.
+func (e *Status) RetryDelay() (time.Duration, bool) {
+	info := e.RetryInfo()
+	if info == nil || info.GetRetryDelay() == nil {
+		return 0, false
+	}
+	return info.GetRetryDelay().AsDuration(), true
+}
+
+// QuotaViolation describes one exceeded quota, e.g. subject "project:123".
+func QuotaViolation(subject, description string) *errdetails.QuotaFailure_Violation {
+	return &errdetails.QuotaFailure_Violation{Subject: subject, Description: description}
+}
+
+// WithQuotaFailure adds a QuotaFailure detail with violations.
+func (e *Status) WithQuotaFailure(violations ...*errdetails.QuotaFailure_Violation) *Status {
+	return e.WithDetails(&errdetails.QuotaFailure{Violations: violations})
+}
+
+// QuotaFailure returns the QuotaFailure detail of the status.
+func (e *Status) QuotaFailure() *errdetails.QuotaFailure {
+	failure := &errdetails.QuotaFailure{}
+	if e.findDetail(failure) {
+		return failure
+	}
+	return nil
+}
+
+// PreconditionViolation describes one failed precondition, e.g. type "TOS",
+// subject "google.com/cloud".
+func PreconditionViolation(typ, subject, description string) *errdetails.PreconditionFailure_Violation {
+	return &errdetails.PreconditionFailure_Violation{
+		Type:        typ,
+		Subject:     subject,
+		Description: description,
+	}
+}
+
+// WithPreconditionFailure adds a PreconditionFailure detail with violations.
+func (e *Status) WithPreconditionFailure(
+	violations ...*errdetails.PreconditionFailure_Violation,
+) *Status {
+	return e.WithDetails(&errdetails.PreconditionFailure{Violations: violations})
+}
+
+// PreconditionFailure returns the PreconditionFailure detail of the status.
+func (e *Status) PreconditionFailure() *errdetails.PreconditionFailure {
+	failure := &errdetails.PreconditionFailure{}
+	if e.findDetail(failure) {
+		return failure
+	}
+	return nil
+}
+
+// BadRequest returns the BadRequest detail of the status.
+func (e *Status) BadRequest() *errdetails.BadRequest {
+	req := &errdetails.BadRequest{}
+	if e.findDetail(req) {
+		return req
+	}
+	return nil
+}
+
+// WithLocalizedMessage adds a LocalizedMessage detail with msg in locale, a
+// BCP 47 tag such as "en-US".
+func (e *Status) WithLocalizedMessage(locale, msg string) *Status {
+	return e.WithDetails(&errdetails.LocalizedMessage{Locale: locale, Message: msg})
+}
+
+// LocalizedMessage returns the LocalizedMessage detail of the status.
+func (e *Status) LocalizedMessage() *errdetails.LocalizedMessage {
+	msg := &errdetails.LocalizedMessage{}
+	if e.findDetail(msg) {
+		return msg
+	}
+	return nil
+}
+
+// BadRequestBuilder collects field violations for an INVALID_ARGUMENT status.
+//
+//	b := status.NewBadRequest()
+//	if req.GetEmail() == "" {
+//		b.Field("email", "must not be empty")
+//	}
+//	if err := b.Err("invalid request"); err != nil {
+//		return nil, err
+//	}
+type BadRequestBuilder struct {
+	violations []*errdetails.BadRequest_FieldViolation
+}
+
+// NewBadRequest returns an empty BadRequestBuilder.
+func NewBadRequest() *BadRequestBuilder {
+	return &BadRequestBuilder{}
+}
+
+// Field adds a violation of field, a dot-separated path into the request.
+func (b *BadRequestBuilder) Field(field, description string) *BadRequestBuilder {
+	return b.FieldReason(field, "", description)
+}
+
+// FieldReason adds a violation of field with a machine-readable reason.
+func (b *BadRequestBuilder) FieldReason(field, reason, description string) *BadRequestBuilder {
+	b.violations = append(b.violations, &errdetails.BadRequest_FieldViolation{
+		Field:       field,
+		Reason:      reason,
+		Description: description,
+	})
+	return b
+}
+
+// Len returns the number of violations.
+func (b *BadRequestBuilder) Len() int {
+	return len(b.violations)
+}
+
+// Status returns an INVALID_ARGUMENT status carrying the violations.
+func (b *BadRequestBuilder) Status(msg string) *Status {
+	return New(code.Code_INVALID_ARGUMENT, msg).
+		WithDetails(&errdetails.BadRequest{FieldViolations: b.violations})
+}
+
+// Err returns the status error, or nil when no violation was added.
+func (b *BadRequestBuilder) Err(msg string) error {
+	if len(b.violations) == 0 {
+		return nil
+	}
+	return b.Status(msg).Err()
+}
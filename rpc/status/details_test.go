@@ -0,0 +1,86 @@
+// Copyright 2022 The codesjoy Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package status
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/genproto/googleapis/rpc/code"
+)
+
+func TestRetryInfo(t *testing.T) {
+	st := New(code.Code_UNAVAILABLE, "busy")
+	_, ok := st.RetryDelay()
+	assert.False(t, ok)
+	assert.Nil(t, st.RetryInfo())
+
+	st.WithRetryInfo(3 * time.Second)
+	delay, ok := st.RetryDelay()
+	require.True(t, ok)
+	assert.Equal(t, 3*time.Second, delay)
+
+	var nilStatus *Status
+	_, ok = nilStatus.RetryDelay()
+	assert.False(t, ok)
+}
+
+func TestQuotaAndPreconditionFailure(t *testing.T) {
+	st := New(code.Code_RESOURCE_EXHAUSTED, "quota").
+		WithQuotaFailure(QuotaViolation("project:1", "daily limit"))
+	require.NotNil(t, st.QuotaFailure())
+	assert.Equal(t, "daily limit", st.QuotaFailure().GetViolations()[0].GetDescription())
+	assert.Nil(t, st.PreconditionFailure())
+
+	st = New(code.Code_FAILED_PRECONDITION, "tos").
+		WithPreconditionFailure(PreconditionViolation("TOS", "user:1", "accept terms"))
+	failure := st.PreconditionFailure()
+	require.NotNil(t, failure)
+	assert.Equal(t, "TOS", failure.GetViolations()[0].GetType())
+	assert.Equal(t, "user:1", failure.GetViolations()[0].GetSubject())
+}
+
+func TestBadRequestBuilder(t *testing.T) {
+	b := NewBadRequest()
+	require.NoError(t, b.Err("invalid"))
+
+	err := b.Field("email", "must not be empty").
+		FieldReason("age", "OUT_OF_RANGE", "must be positive").
+		Err("invalid request")
+	require.Error(t, err)
+	assert.Equal(t, 2, b.Len())
+
+	var st *Status
+	require.True(t, errors.As(err, &st))
+	assert.Equal(t, code.Code_INVALID_ARGUMENT, st.Code())
+	violations := st.BadRequest().GetFieldViolations()
+	require.Len(t, violations, 2)
+	assert.Equal(t, "email", violations[0].GetField())
+	assert.Equal(t, "OUT_OF_RANGE", violations[1].GetReason())
+}
+
+func TestLocalizedMessage(t *testing.T) {
+	st := New(code.Code_NOT_FOUND, "user.not_found")
+	assert.Nil(t, st.LocalizedMessage())
+
+	st = st.WithLocalizedMessage("zh-CN", "用户不存在")
+	msg := st.LocalizedMessage()
+	require.NotNil(t, msg)
+	assert.Equal(t, "zh-CN", msg.GetLocale())
+	assert.Equal(t, "用户不存在", msg.GetMessage())
+}
@@ -0,0 +1,49 @@
+// Copyright 2022 The codesjoy Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package status
+
+import (
+	"errors"
+
+	gstatus "google.golang.org/grpc/status"
+)
+
+// grpcStatus is implemented by the errors of grpc-go and of libraries
+// built on it.
+type grpcStatus interface {
+	GRPCStatus() *gstatus.Status
+}
+
+// GRPCStatus returns the grpc-go form of the status, so grpc-go and the
+// libraries built on it recognize yggdrasil errors with their details.
+func (e *Status) GRPCStatus() *gstatus.Status {
+	if e == nil || e.stu == nil {
+		return nil
+	}
+	return gstatus.FromProto(e.stu)
+}
+
+// fromGRPCStatus converts errors carrying a grpc-go status.
+func fromGRPCStatus(err error) (*Status, bool) {
+	var gs grpcStatus
+	if !errors.As(err, &gs) {
+		return nil, false
+	}
+	st := gs.GRPCStatus()
+	if st == nil {
+		return nil, false
+	}
+	return FromProto(st.Proto()), true
+}
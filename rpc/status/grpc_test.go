@@ -0,0 +1,57 @@
+// Copyright 2022 The codesjoy Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package status
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/genproto/googleapis/rpc/code"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	gcodes "google.golang.org/grpc/codes"
+	gstatus "google.golang.org/grpc/status"
+)
+
+func TestGRPCStatus(t *testing.T) {
+	err := NewBadRequest().Field("name", "required").Err("invalid request")
+
+	gs, ok := gstatus.FromError(fmt.Errorf("create: %w", err))
+	require.True(t, ok)
+	assert.Equal(t, gcodes.InvalidArgument, gs.Code())
+	require.Len(t, gs.Details(), 1)
+	br, ok := gs.Details()[0].(*errdetails.BadRequest)
+	require.True(t, ok)
+	assert.Equal(t, "name", br.GetFieldViolations()[0].GetField())
+
+	var nilStatus *Status
+	assert.Nil(t, nilStatus.GRPCStatus())
+}
+
+func TestCoverError_GRPCStatus(t *testing.T) {
+	gs, err := gstatus.New(gcodes.FailedPrecondition, "not ready").
+		WithDetails(&errdetails.PreconditionFailure{
+			Violations: []*errdetails.PreconditionFailure_Violation{{Type: "TOS"}},
+		})
+	require.NoError(t, err)
+
+	st, ok := CoverError(fmt.Errorf("call: %w", gs.Err()))
+	require.True(t, ok)
+	assert.Equal(t, code.Code_FAILED_PRECONDITION, st.Code())
+	assert.Equal(t, "not ready", st.Message())
+	require.NotNil(t, st.PreconditionFailure())
+	assert.Equal(t, "TOS", st.PreconditionFailure().GetViolations()[0].GetType())
+}
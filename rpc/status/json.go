@@ -0,0 +1,130 @@
+// Copyright 2022 The codesjoy Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package status
+
+import (
+	"encoding/json"
+	"errors"
+
+	statuspb "google.golang.org/genproto/googleapis/rpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/known/anypb"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+// opaqueResolver resolves the types unknown to the DetailResolver as
+// google.protobuf.BytesValue, so their details travel through JSON in the
+// well-known type form {"@type": "...", "value": "<base64 payload>"}.
+type opaqueResolver struct {
+	detailResolver
+}
+
+var bytesValueType = (*wrapperspb.BytesValue)(nil).ProtoReflect().Type()
+
+func (r opaqueResolver) FindMessageByURL(url string) (protoreflect.MessageType, error) {
+	mt, err := r.detailResolver.FindMessageByURL(url)
+	if errors.Is(err, protoregistry.NotFound) {
+		return bytesValueType, nil
+	}
+	return mt, err
+}
+
+func resolvable(detail *anypb.Any) bool {
+	_, err := DetailResolver.FindMessageByURL(detail.GetTypeUrl())
+	return err == nil
+}
+
+// EncodeJSON encodes pb as protojson with opts. Details of types the
+// DetailResolver does not know are encoded as {"@type", "value"} objects
+// carrying their base64 payload instead of failing the encoding.
+func EncodeJSON(opts protojson.MarshalOptions, pb *statuspb.Status) ([]byte, error) {
+	var opaque bool
+	for _, detail := range pb.GetDetails() {
+		if !resolvable(detail) {
+			opaque = true
+			break
+		}
+	}
+	opts.Resolver = DetailResolver
+	if !opaque {
+		return opts.Marshal(pb)
+	}
+	pb = proto.Clone(pb).(*statuspb.Status)
+	for _, detail := range pb.Details {
+		if resolvable(detail) {
+			continue
+		}
+		value, err := proto.Marshal(wrapperspb.Bytes(detail.GetValue()))
+		if err != nil {
+			return nil, err
+		}
+		detail.Value = value
+	}
+	opts.Resolver = opaqueResolver{}
+	return opts.Marshal(pb)
+}
+
+// DecodeJSON decodes the protojson encoding of a status into pb. Details of
+// types the DetailResolver does not know are kept as Any: with their
+// payload when encoded by EncodeJSON, otherwise with their type URL only.
+func DecodeJSON(opts protojson.UnmarshalOptions, data []byte, pb *statuspb.Status) error {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil || fields == nil {
+		// Let protojson report malformed input.
+		return opts.Unmarshal(data, pb)
+	}
+	raw, ok := fields["details"]
+	if !ok {
+		opts.Resolver = DetailResolver
+		return opts.Unmarshal(data, pb)
+	}
+	delete(fields, "details")
+	envelope, err := json.Marshal(fields)
+	if err != nil {
+		return err
+	}
+	if err := opts.Unmarshal(envelope, pb); err != nil {
+		return err
+	}
+	var details []json.RawMessage
+	if err := json.Unmarshal(raw, &details); err != nil {
+		return err
+	}
+	for _, detail := range details {
+		pb.Details = append(pb.Details, decodeDetail(opts, detail))
+	}
+	return nil
+}
+
+func decodeDetail(opts protojson.UnmarshalOptions, data []byte) *anypb.Any {
+	detail := &anypb.Any{}
+	opts.Resolver = opaqueResolver{}
+	if err := opts.Unmarshal(data, detail); err == nil {
+		if !resolvable(detail) {
+			opaque := &wrapperspb.BytesValue{}
+			_ = proto.Unmarshal(detail.GetValue(), opaque)
+			detail.Value = opaque.GetValue()
+		}
+		return detail
+	}
+	var typed struct {
+		Type string `json:"@type"`
+	}
+	_ = json.Unmarshal(data, &typed)
+	return &anypb.Any{TypeUrl: typed.Type}
+}
@@ -0,0 +1,76 @@
+// Copyright 2022 The codesjoy Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package status
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/genproto/googleapis/rpc/code"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	statuspb "google.golang.org/genproto/googleapis/rpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/anypb"
+)
+
+func TestJSONRoundTrip(t *testing.T) {
+	st := New(code.Code_NOT_FOUND, "missing").
+		WithDetails(&errdetails.ResourceInfo{ResourceType: "user", ResourceName: "u1"})
+	st.stu.Details = append(st.stu.Details, unknownDetail())
+	pb := st.Status()
+
+	_, err := protojson.Marshal(pb)
+	require.Error(t, err, "plain protojson cannot encode unknown details")
+
+	data, err := EncodeJSON(protojson.MarshalOptions{}, pb)
+	require.NoError(t, err)
+	assert.Contains(t, string(data), `"@type":"`+unknownDetailURL+`"`)
+
+	got := &statuspb.Status{}
+	require.NoError(t, DecodeJSON(protojson.UnmarshalOptions{}, data, got))
+	assert.True(t, proto.Equal(pb, got))
+
+	info := Details[*errdetails.ResourceInfo](FromProto(got).Err())
+	require.Len(t, info, 1)
+	assert.Equal(t, "u1", info[0].GetResourceName())
+}
+
+func TestDecodeJSON(t *testing.T) {
+	t.Run("foreign unknown detail keeps its type", func(t *testing.T) {
+		data := []byte(`{"code":5,"message":"missing","details":[
+			{"@type":"type.googleapis.com/google.rpc.ErrorInfo","reason":"GONE"},
+			{"@type":"` + unknownDetailURL + `","field":"x"}]}`)
+		got := &statuspb.Status{}
+		require.NoError(t, DecodeJSON(protojson.UnmarshalOptions{}, data, got))
+		assert.Equal(t, int32(code.Code_NOT_FOUND), got.GetCode())
+		require.Len(t, got.GetDetails(), 2)
+		assert.Equal(t, "GONE", FromProto(got).ErrorInfo().GetReason())
+		assert.True(t, proto.Equal(&anypb.Any{TypeUrl: unknownDetailURL}, got.GetDetails()[1]))
+	})
+
+	t.Run("without details", func(t *testing.T) {
+		got := &statuspb.Status{}
+		require.NoError(t, DecodeJSON(protojson.UnmarshalOptions{}, []byte(`{"code":3}`), got))
+		assert.Equal(t, int32(code.Code_INVALID_ARGUMENT), got.GetCode())
+	})
+
+	t.Run("malformed", func(t *testing.T) {
+		got := &statuspb.Status{}
+		assert.Error(t, DecodeJSON(protojson.UnmarshalOptions{}, []byte(`{"code":`), got))
+		assert.Error(t, DecodeJSON(protojson.UnmarshalOptions{}, []byte(`{"code":"x"}`), got))
+	})
+}
@@ -0,0 +1,105 @@
+// Copyright 2022 The codesjoy Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package status
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"sync"
+
+	"github.com/codesjoy/pkg/basic/xerror"
+	"google.golang.org/genproto/googleapis/rpc/code"
+)
+
+// ErrorMapper converts a domain error into a Status. It returns nil when it
+// does not recognize err, so the next mapper in the chain is consulted.
+type ErrorMapper func(ctx context.Context, err error) *Status
+
+var (
+	mapperMu       sync.RWMutex
+	defaultMappers = []ErrorMapper{MapContextError, MapNoRows}
+	serviceMappers = map[string][]ErrorMapper{}
+)
+
+// RegisterErrorMapper appends mappers to the default chain applied to every
+// service.
+func RegisterErrorMapper(mappers ...ErrorMapper) {
+	mapperMu.Lock()
+	defer mapperMu.Unlock()
+	for _, m := range mappers {
+		if m != nil {
+			defaultMappers = append(defaultMappers, m)
+		}
+	}
+}
+
+// RegisterServiceErrorMapper appends mappers for a single service, identified
+// by its full name (e.g. "helloworld.Greeter"). They are consulted before the
+// default chain.
+func RegisterServiceErrorMapper(service string, mappers ...ErrorMapper) {
+	mapperMu.Lock()
+	defer mapperMu.Unlock()
+	for _, m := range mappers {
+		if m != nil {
+			serviceMappers[service] = append(serviceMappers[service], m)
+		}
+	}
+}
+
+// MapError converts err with the mappers registered for service and then the
+// default chain. Errors that already carry a status code are returned as is,
+// as are errors no mapper recognizes.
+func MapError(ctx context.Context, service string, err error) error {
+	if err == nil || hasCode(err) {
+		return err
+	}
+	mapperMu.RLock()
+	chain := make([]ErrorMapper, 0, len(serviceMappers[service])+len(defaultMappers))
+	chain = append(chain, serviceMappers[service]...)
+	chain = append(chain, defaultMappers...)
+	mapperMu.RUnlock()
+	for _, m := range chain {
+		if st := m(ctx, err); st != nil {
+			return st
+		}
+	}
+	return err
+}
+
+// MapContextError maps context cancellation and deadline errors.
+func MapContextError(_ context.Context, err error) *Status {
+	if errors.Is(err, context.DeadlineExceeded) || errors.Is(err, context.Canceled) {
+		return FromContextError(err)
+	}
+	return nil
+}
+
+// MapNoRows maps sql.ErrNoRows to NOT_FOUND.
+func MapNoRows(_ context.Context, err error) *Status {
+	if errors.Is(err, sql.ErrNoRows) {
+		return WithCode(code.Code_NOT_FOUND, err)
+	}
+	return nil
+}
+
+func hasCode(err error) bool {
+	var s *Status
+	if errors.As(err, &s) {
+		return true
+	}
+	_, ok := xerror.CodeOf(err)
+	return ok
+}
@@ -0,0 +1,100 @@
+// Copyright 2022 The codesjoy Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package status
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/codesjoy/pkg/basic/xerror"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/genproto/googleapis/rpc/code"
+)
+
+func resetErrorMappers(t *testing.T) {
+	t.Helper()
+	mapperMu.Lock()
+	savedDefault := append([]ErrorMapper(nil), defaultMappers...)
+	savedService := make(map[string][]ErrorMapper, len(serviceMappers))
+	for k, v := range serviceMappers {
+		savedService[k] = v
+	}
+	mapperMu.Unlock()
+	t.Cleanup(func() {
+		mapperMu.Lock()
+		defaultMappers = savedDefault
+		serviceMappers = savedService
+		mapperMu.Unlock()
+	})
+}
+
+func TestMapErrorDefaultChain(t *testing.T) {
+	ctx := context.Background()
+
+	err := MapError(ctx, "svc", fmt.Errorf("load user: %w", sql.ErrNoRows))
+	assert.Equal(t, code.Code_NOT_FOUND, FromError(err).Code())
+
+	err = MapError(ctx, "svc", fmt.Errorf("wait: %w", context.DeadlineExceeded))
+	assert.Equal(t, code.Code_DEADLINE_EXCEEDED, FromError(err).Code())
+
+	plain := errors.New("boom")
+	assert.Same(t, plain, MapError(ctx, "svc", plain))
+	assert.NoError(t, MapError(ctx, "svc", nil))
+}
+
+func TestMapErrorKeepsCodedErrors(t *testing.T) {
+	resetErrorMappers(t)
+	RegisterErrorMapper(func(context.Context, error) *Status {
+		return New(code.Code_INTERNAL, "mapped")
+	})
+
+	st := New(code.Code_PERMISSION_DENIED, "denied")
+	assert.Same(t, st, MapError(context.Background(), "svc", st))
+
+	xerr := xerror.New(code.Code_ALREADY_EXISTS, "exists")
+	assert.Equal(t, xerr, MapError(context.Background(), "svc", xerr))
+}
+
+func TestMapErrorServiceOverride(t *testing.T) {
+	resetErrorMappers(t)
+	errInvalid := errors.New("invalid input")
+	RegisterErrorMapper(func(_ context.Context, err error) *Status {
+		if errors.Is(err, errInvalid) {
+			return WithCode(code.Code_INVALID_ARGUMENT, err)
+		}
+		return nil
+	})
+	RegisterServiceErrorMapper("legacy.Service", func(_ context.Context, err error) *Status {
+		if errors.Is(err, errInvalid) {
+			return WithCode(code.Code_FAILED_PRECONDITION, err)
+		}
+		return nil
+	})
+
+	err := MapError(context.Background(), "legacy.Service", errInvalid)
+	require.Error(t, err)
+	assert.Equal(t, code.Code_FAILED_PRECONDITION, FromError(err).Code())
+
+	err = MapError(context.Background(), "other.Service", errInvalid)
+	assert.Equal(t, code.Code_INVALID_ARGUMENT, FromError(err).Code())
+
+	// Service mappers fall through to the default chain.
+	err = MapError(context.Background(), "legacy.Service", sql.ErrNoRows)
+	assert.Equal(t, code.Code_NOT_FOUND, FromError(err).Code())
+}
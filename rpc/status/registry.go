@@ -0,0 +1,136 @@
+// Copyright 2022 The codesjoy Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package status
+
+import (
+	"errors"
+	"sync"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/known/anypb"
+)
+
+var (
+	detailTypesMu sync.RWMutex
+	detailTypes   = new(protoregistry.Types)
+)
+
+// RegisterDetailTypes registers the types of msgs as status details, so the
+// details resolve even when their types are not linked into the global
+// registry, e.g. dynamicpb messages built from descriptors fetched at run
+// time. Generated messages resolve without registration.
+func RegisterDetailTypes(msgs ...proto.Message) error {
+	detailTypesMu.Lock()
+	defer detailTypesMu.Unlock()
+	var errs []error
+	for _, msg := range msgs {
+		mt := msg.ProtoReflect().Type()
+		if _, err := detailTypes.FindMessageByName(mt.Descriptor().FullName()); err == nil {
+			continue
+		}
+		errs = append(errs, detailTypes.RegisterMessage(mt))
+	}
+	return errors.Join(errs...)
+}
+
+// DetailResolver resolves the types of status details: the registered
+// detail types first, then the global registry.
+var DetailResolver interface {
+	protoregistry.MessageTypeResolver
+	protoregistry.ExtensionTypeResolver
+} = detailResolver{}
+
+type detailResolver struct{}
+
+func (detailResolver) FindMessageByName(
+	name protoreflect.FullName,
+) (protoreflect.MessageType, error) {
+	detailTypesMu.RLock()
+	mt, err := detailTypes.FindMessageByName(name)
+	detailTypesMu.RUnlock()
+	if err == nil {
+		return mt, nil
+	}
+	return protoregistry.GlobalTypes.FindMessageByName(name)
+}
+
+func (detailResolver) FindMessageByURL(url string) (protoreflect.MessageType, error) {
+	detailTypesMu.RLock()
+	mt, err := detailTypes.FindMessageByURL(url)
+	detailTypesMu.RUnlock()
+	if err == nil {
+		return mt, nil
+	}
+	return protoregistry.GlobalTypes.FindMessageByURL(url)
+}
+
+func (detailResolver) FindExtensionByName(
+	field protoreflect.FullName,
+) (protoreflect.ExtensionType, error) {
+	return protoregistry.GlobalTypes.FindExtensionByName(field)
+}
+
+func (detailResolver) FindExtensionByNumber(
+	message protoreflect.FullName,
+	field protoreflect.FieldNumber,
+) (protoreflect.ExtensionType, error) {
+	return protoregistry.GlobalTypes.FindExtensionByNumber(message, field)
+}
+
+// Details returns the details of the status. Details of types the
+// DetailResolver does not know are returned as *anypb.Any, so they are
+// kept rather than dropped.
+func (e *Status) Details() []proto.Message {
+	if e == nil || e.stu == nil {
+		return nil
+	}
+	details := make([]proto.Message, 0, len(e.stu.Details))
+	for _, detail := range e.stu.Details {
+		msg, err := anypb.UnmarshalNew(detail, proto.UnmarshalOptions{Resolver: DetailResolver})
+		if err != nil {
+			details = append(details, detail)
+			continue
+		}
+		details = append(details, msg)
+	}
+	return details
+}
+
+// Details returns the details of type T carried by err, in order.
+//
+//	for _, q := range status.Details[*quotapb.Quota](err) {
+//		...
+//	}
+func Details[T proto.Message](err error) []T {
+	st, _ := CoverError(err)
+	if st == nil || st.stu == nil {
+		return nil
+	}
+	var zero T
+	mt := zero.ProtoReflect().Type()
+	var out []T
+	for _, detail := range st.stu.Details {
+		if detail.MessageName() != mt.Descriptor().FullName() {
+			continue
+		}
+		msg := mt.New().Interface()
+		if proto.Unmarshal(detail.GetValue(), msg) == nil {
+			out = append(out, msg.(T))
+		}
+	}
+	return out
+}
@@ -0,0 +1,119 @@
+// Copyright 2022 The codesjoy Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package status
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/genproto/googleapis/rpc/code"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+	"google.golang.org/protobuf/types/known/anypb"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+const unknownDetailURL = "type.googleapis.com/example.v1.Unlinked"
+
+func unknownDetail() *anypb.Any {
+	value, _ := proto.Marshal(wrapperspb.String("opaque"))
+	return &anypb.Any{TypeUrl: unknownDetailURL, Value: value}
+}
+
+// dynamicDetail builds a message type that is not in the global registry.
+func dynamicDetail(t *testing.T) protoreflect.MessageType {
+	t.Helper()
+	fd, err := protodesc.NewFile(&descriptorpb.FileDescriptorProto{
+		Name:    proto.String("status_detail_test.proto"),
+		Package: proto.String("statustest"),
+		Syntax:  proto.String("proto3"),
+		MessageType: []*descriptorpb.DescriptorProto{{
+			Name: proto.String("Dynamic"),
+			Field: []*descriptorpb.FieldDescriptorProto{{
+				Name:     proto.String("id"),
+				JsonName: proto.String("id"),
+				Number:   proto.Int32(1),
+				Type:     descriptorpb.FieldDescriptorProto_TYPE_STRING.Enum(),
+				Label:    descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL.Enum(),
+			}},
+		}},
+	}, nil)
+	require.NoError(t, err)
+	return dynamicpb.NewMessageType(fd.Messages().Get(0))
+}
+
+func TestDetailsGeneric(t *testing.T) {
+	st := New(code.Code_FAILED_PRECONDITION, "not ready").
+		WithDetails(
+			wrapperspb.String("first"),
+			&errdetails.ErrorInfo{Reason: "NOT_READY"},
+			wrapperspb.String("second"),
+		)
+	err := fmt.Errorf("call: %w", st.Err())
+
+	values := Details[*wrapperspb.StringValue](err)
+	require.Len(t, values, 2)
+	assert.Equal(t, "first", values[0].GetValue())
+	assert.Equal(t, "second", values[1].GetValue())
+	require.Len(t, Details[*errdetails.ErrorInfo](err), 1)
+	assert.Empty(t, Details[*errdetails.RetryInfo](err))
+	assert.Empty(t, Details[*wrapperspb.StringValue](nil))
+	assert.Empty(t, Details[*wrapperspb.StringValue](fmt.Errorf("plain")))
+}
+
+func TestStatusDetailsKeepsUnknownTypes(t *testing.T) {
+	st := New(code.Code_INTERNAL, "boom").
+		WithDetails(&errdetails.ErrorInfo{Reason: "BOOM"})
+	st.stu.Details = append(st.stu.Details, unknownDetail())
+
+	details := st.Details()
+	require.Len(t, details, 2)
+	assert.Equal(t, "BOOM", details[0].(*errdetails.ErrorInfo).GetReason())
+	assert.True(t, proto.Equal(unknownDetail(), details[1]))
+
+	var nilStatus *Status
+	assert.Nil(t, nilStatus.Details())
+}
+
+func TestRegisterDetailTypes(t *testing.T) {
+	mt := dynamicDetail(t)
+	msg := mt.New()
+	msg.Set(mt.Descriptor().Fields().ByName("id"), protoreflect.ValueOfString("42"))
+	st := New(code.Code_ABORTED, "conflict").WithDetails(msg.Interface())
+
+	_, err := EncodeJSON(protojson.MarshalOptions{}, st.Status())
+	require.NoError(t, err, "unknown types are encoded opaquely")
+	_, ok := st.Details()[0].(*anypb.Any)
+	assert.True(t, ok)
+
+	require.NoError(t, RegisterDetailTypes(msg.Interface()))
+	require.NoError(t, RegisterDetailTypes(msg.Interface()), "registration is idempotent")
+	data, err := EncodeJSON(protojson.MarshalOptions{}, st.Status())
+	require.NoError(t, err)
+	assert.Contains(t, string(data), `"id":"42"`)
+
+	details := st.Details()
+	require.Len(t, details, 1)
+	got := details[0].ProtoReflect()
+	assert.Equal(t, mt.Descriptor().FullName(), got.Descriptor().FullName())
+	assert.Equal(t, "42", got.Get(got.Descriptor().Fields().ByName("id")).String())
+}
@@ -36,7 +36,8 @@ const (
 
 // Status represents a status.
 type Status struct {
-	stu *statuspb.Status
+	stu      *statuspb.Status
+	httpCode int32
 }
 
 // New creates a new status from code and message.
@@ -72,11 +73,24 @@ func (e *Status) WithDetails(details ...proto.Message) *Status {
 	return e
 }
 
+// WithHTTPCode overrides the http status code derived from the status code,
+// for transport conditions such as 413 or 408 that no status code names.
+func (e *Status) WithHTTPCode(httpCode int32) *Status {
+	if e == nil {
+		return e
+	}
+	e.httpCode = httpCode
+	return e
+}
+
 // HTTPCode returns the http status code of the status.
 func (e *Status) HTTPCode() int32 {
 	if e == nil || e.stu == nil {
 		return http.StatusOK
 	}
+	if e.httpCode != 0 {
+		return e.httpCode
+	}
 	return statusCodeToHTTPCode(code.Code(e.stu.Code))
 }
 
@@ -167,7 +181,7 @@ func HTTPCodeToStuCode(httpCode int32) code.Code {
 		return code.Code_CANCELLED
 	case http.StatusBadRequest:
 		return code.Code_INVALID_ARGUMENT
-	case http.StatusGatewayTimeout:
+	case http.StatusGatewayTimeout, http.StatusRequestTimeout:
 		return code.Code_DEADLINE_EXCEEDED
 	case http.StatusNotFound:
 		return code.Code_NOT_FOUND
@@ -175,7 +189,7 @@ func HTTPCodeToStuCode(httpCode int32) code.Code {
 		return code.Code_PERMISSION_DENIED
 	case http.StatusUnauthorized:
 		return code.Code_UNAUTHENTICATED
-	case http.StatusTooManyRequests:
+	case http.StatusTooManyRequests, http.StatusRequestEntityTooLarge:
 		return code.Code_RESOURCE_EXHAUSTED
 	case http.StatusConflict:
 		return code.Code_ABORTED
@@ -206,6 +220,11 @@ func CoverError(err error) (*Status, bool) {
 		return s, true
 	}
 
+	s, ok = fromGRPCStatus(err)
+	if ok {
+		return s, true
+	}
+
 	s, ok = fromXError(err)
 	if ok {
 		return s, true
@@ -162,4 +162,19 @@ func TestNewAndWithCode(t *testing.T) {
 func TestHTTPCodeToStuCode(t *testing.T) {
 	assert.Equal(t, code.Code_CANCELLED, HTTPCodeToStuCode(HTTPStatusClientClosed))
 	assert.Equal(t, code.Code_INTERNAL, HTTPCodeToStuCode(http.StatusInternalServerError))
+	assert.Equal(
+		t,
+		code.Code_RESOURCE_EXHAUSTED,
+		HTTPCodeToStuCode(http.StatusRequestEntityTooLarge),
+	)
+	assert.Equal(t, code.Code_DEADLINE_EXCEEDED, HTTPCodeToStuCode(http.StatusRequestTimeout))
+}
+
+func TestWithHTTPCode(t *testing.T) {
+	st := New(code.Code_RESOURCE_EXHAUSTED, "too large")
+	assert.Equal(t, int32(http.StatusTooManyRequests), st.HTTPCode())
+	st = st.WithHTTPCode(http.StatusRequestEntityTooLarge)
+	assert.Equal(t, int32(http.StatusRequestEntityTooLarge), st.HTTPCode())
+	assert.Equal(t, int32(http.StatusRequestEntityTooLarge), FromError(st.Err()).HTTPCode())
+	assert.Nil(t, (*Status)(nil).WithHTTPCode(http.StatusRequestTimeout))
 }
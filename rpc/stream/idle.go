@@ -0,0 +1,35 @@
+// Copyright 2022 The codesjoy Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package stream
+
+import "context"
+
+type idleKey struct{}
+
+// WithIdle returns a copy of ctx carrying the channel a server transport
+// signals when the stream of ctx has been idle for its idle timeout.
+func WithIdle(ctx context.Context, idle <-chan struct{}) context.Context {
+	return context.WithValue(ctx, idleKey{}, idle)
+}
+
+// Idle returns the channel signalled when the server stream of ctx has been
+// idle for the transport's idle timeout and its idle action is ping. The
+// goroutine sending the responses should answer with a heartbeat message;
+// a stream still idle one more timeout later is cancelled. Idle returns nil,
+// which blocks forever, when the transport does not ping.
+func Idle(ctx context.Context) <-chan struct{} {
+	idle, _ := ctx.Value(idleKey{}).(<-chan struct{})
+	return idle
+}
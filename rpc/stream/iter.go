@@ -0,0 +1,81 @@
+// Copyright 2022 The codesjoy Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package stream
+
+import (
+	"context"
+	"errors"
+	"io"
+	"iter"
+)
+
+// Responses adapts a typed Recv method to an iterator. It yields each
+// message with a nil error, ends silently on io.EOF and yields a final zero
+// message with the error on any other failure:
+//
+//	for resp, err := range stream.Responses() {
+//		if err != nil {
+//			return err
+//		}
+//		...
+//	}
+func Responses[T any](recv func() (T, error)) iter.Seq2[T, error] {
+	return func(yield func(T, error) bool) {
+		for {
+			msg, err := recv()
+			if errors.Is(err, io.EOF) {
+				return
+			}
+			if err != nil {
+				var zero T
+				yield(zero, err)
+				return
+			}
+			if !yield(msg, nil) {
+				return
+			}
+		}
+	}
+}
+
+// CollectAll receives messages until the stream ends and returns them. It
+// stops early with the context error once ctx is done.
+func CollectAll[T any](ctx context.Context, recv func() (T, error)) ([]T, error) {
+	var out []T
+	for msg, err := range Responses(recv) {
+		if err != nil {
+			return out, err
+		}
+		out = append(out, msg)
+		if err := ctx.Err(); err != nil {
+			return out, err
+		}
+	}
+	return out, nil
+}
+
+// SendAll sends msgs in order. It stops at the first send error, or with the
+// context error once ctx is done. It does not close the send direction.
+func SendAll[T any](ctx context.Context, send func(T) error, msgs []T) error {
+	for _, msg := range msgs {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := send(msg); err != nil {
+			return err
+		}
+	}
+	return nil
+}
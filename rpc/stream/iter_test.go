@@ -0,0 +1,98 @@
+// Copyright 2022 The codesjoy Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package stream
+
+import (
+	"context"
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func recvFrom(msgs []int, end error) func() (int, error) {
+	return func() (int, error) {
+		if len(msgs) == 0 {
+			return 0, end
+		}
+		msg := msgs[0]
+		msgs = msgs[1:]
+		return msg, nil
+	}
+}
+
+func TestResponses(t *testing.T) {
+	var got []int
+	for msg, err := range Responses(recvFrom([]int{1, 2, 3}, io.EOF)) {
+		assert.NoError(t, err)
+		got = append(got, msg)
+	}
+	assert.Equal(t, []int{1, 2, 3}, got)
+
+	boom := errors.New("boom")
+	var errs []error
+	for _, err := range Responses(recvFrom([]int{1}, boom)) {
+		errs = append(errs, err)
+	}
+	assert.Equal(t, []error{nil, boom}, errs)
+
+	// Breaking out of the loop stops receiving.
+	calls := 0
+	recv := func() (int, error) { calls++; return calls, nil }
+	for range Responses(recv) {
+		break
+	}
+	assert.Equal(t, 1, calls)
+}
+
+func TestCollectAll(t *testing.T) {
+	got, err := CollectAll(context.Background(), recvFrom([]int{1, 2}, io.EOF))
+	assert.NoError(t, err)
+	assert.Equal(t, []int{1, 2}, got)
+
+	boom := errors.New("boom")
+	got, err = CollectAll(context.Background(), recvFrom([]int{1}, boom))
+	assert.ErrorIs(t, err, boom)
+	assert.Equal(t, []int{1}, got)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	got, err = CollectAll(ctx, recvFrom([]int{1, 2}, io.EOF))
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Equal(t, []int{1}, got)
+}
+
+func TestSendAll(t *testing.T) {
+	var sent []int
+	send := func(m int) error { sent = append(sent, m); return nil }
+	assert.NoError(t, SendAll(context.Background(), send, []int{1, 2, 3}))
+	assert.Equal(t, []int{1, 2, 3}, sent)
+
+	boom := errors.New("boom")
+	err := SendAll(context.Background(), func(m int) error {
+		if m == 2 {
+			return boom
+		}
+		return nil
+	}, []int{1, 2, 3})
+	assert.ErrorIs(t, err, boom)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	sent = nil
+	assert.ErrorIs(t, SendAll(ctx, send, []int{1}), context.Canceled)
+	assert.Empty(t, sent)
+}
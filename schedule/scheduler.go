@@ -0,0 +1,412 @@
+// Copyright 2022 The codesjoy Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package schedule
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"runtime/debug"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/metric/noop"
+)
+
+// Job is the work executed on each activation.
+type Job func(ctx context.Context) error
+
+// OverlapPolicy decides what happens when a job fires while its previous run
+// is still in progress.
+type OverlapPolicy int
+
+const (
+	// OverlapSkip drops the activation.
+	OverlapSkip OverlapPolicy = iota
+	// OverlapQueue runs the activation once the previous run finishes. At
+	// most one activation is kept pending; further ones are dropped.
+	OverlapQueue
+)
+
+// Locker acquires cluster-wide locks so only one replica runs a job.
+type Locker interface {
+	// TryLock attempts to acquire key for at most ttl without waiting. It
+	// returns acquired=false when another holder owns the lock.
+	TryLock(
+		ctx context.Context,
+		key string,
+		ttl time.Duration,
+	) (release func(context.Context) error, acquired bool, err error)
+}
+
+// Run outcomes reported by the schedule.job.runs metric.
+const (
+	OutcomeSuccess = "success"
+	OutcomeFailure = "failure"
+	OutcomePanic   = "panic"
+	OutcomeTimeout = "timeout"
+	OutcomeSkipped = "skipped"
+	OutcomeLocked  = "locked"
+)
+
+// JobOption configures one job.
+type JobOption func(*jobConfig)
+
+type jobConfig struct {
+	timeout time.Duration
+	overlap OverlapPolicy
+	locker  Locker
+	lockKey string
+	lockTTL time.Duration
+}
+
+// WithTimeout bounds each run of the job.
+func WithTimeout(timeout time.Duration) JobOption {
+	return func(cfg *jobConfig) {
+		cfg.timeout = timeout
+	}
+}
+
+// WithOverlap sets the overlap policy. OverlapSkip is the default.
+func WithOverlap(policy OverlapPolicy) JobOption {
+	return func(cfg *jobConfig) {
+		cfg.overlap = policy
+	}
+}
+
+// WithLock runs the job only on the replica acquiring key from locker. The
+// lock is held for at most ttl; when ttl is zero the job timeout is used, or
+// one minute when the job has no timeout.
+func WithLock(locker Locker, key string, ttl time.Duration) JobOption {
+	return func(cfg *jobConfig) {
+		cfg.locker = locker
+		cfg.lockKey = key
+		cfg.lockTTL = ttl
+	}
+}
+
+// Option configures a Scheduler.
+type Option func(*Scheduler)
+
+// WithMeterProvider sets the meter provider used for job metrics. The global
+// provider is used by default.
+func WithMeterProvider(provider metric.MeterProvider) Option {
+	return func(s *Scheduler) {
+		s.meterProvider = provider
+	}
+}
+
+// Scheduler runs registered jobs. It implements the application worker
+// contract, so it can be registered with app.WithWorker.
+type Scheduler struct {
+	meterProvider metric.MeterProvider
+	runs          metric.Int64Counter
+	duration      metric.Float64Histogram
+
+	mu      sync.Mutex
+	jobs    map[string]*entry
+	ctx     context.Context
+	cancel  context.CancelFunc
+	stopped bool
+	wg      sync.WaitGroup
+}
+
+// Scheduler satisfies app.Runnable, spelled out to avoid importing app.
+var _ interface {
+	Run(ctx context.Context) error
+	Stop(ctx context.Context) error
+} = (*Scheduler)(nil)
+
+type entry struct {
+	name     string
+	schedule Schedule
+	job      Job
+	cfg      jobConfig
+	// slots admits one running activation plus, for OverlapQueue, one
+	// pending activation.
+	slots   chan struct{}
+	running sync.Mutex
+}
+
+// New creates a scheduler.
+func New(opts ...Option) *Scheduler {
+	s := &Scheduler{jobs: map[string]*entry{}}
+	for _, opt := range opts {
+		opt(s)
+	}
+	if s.meterProvider == nil {
+		s.meterProvider = otel.GetMeterProvider()
+	}
+	meter := s.meterProvider.Meter("github.com/codesjoy/yggdrasil/v3",
+		metric.WithInstrumentationVersion("yggdrasil"),
+	)
+	var err error
+	s.runs, err = meter.Int64Counter("schedule.job.runs",
+		metric.WithDescription("Counts scheduled job activations by outcome."),
+		metric.WithUnit("{run}"))
+	if err != nil {
+		otel.Handle(err)
+		s.runs = noop.Int64Counter{}
+	}
+	s.duration, err = meter.Float64Histogram("schedule.job.duration",
+		metric.WithDescription("Measures the duration of scheduled job runs."),
+		metric.WithUnit("s"))
+	if err != nil {
+		otel.Handle(err)
+		s.duration = noop.Float64Histogram{}
+	}
+	return s
+}
+
+// Add registers a job. Jobs added while the scheduler runs start immediately.
+func (s *Scheduler) Add(name string, schedule Schedule, job Job, opts ...JobOption) error {
+	if name == "" {
+		return errors.New("job name is empty")
+	}
+	if schedule == nil || job == nil {
+		return fmt.Errorf("job %q: schedule and job are required", name)
+	}
+	e := &entry{name: name, schedule: schedule, job: job}
+	for _, opt := range opts {
+		opt(&e.cfg)
+	}
+	if e.cfg.locker != nil && e.cfg.lockKey == "" {
+		e.cfg.lockKey = name
+	}
+	slots := 1
+	if e.cfg.overlap == OverlapQueue {
+		slots = 2
+	}
+	e.slots = make(chan struct{}, slots)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.jobs[name]; ok {
+		return fmt.Errorf("job %q already registered", name)
+	}
+	s.jobs[name] = e
+	if s.ctx != nil && !s.stopped {
+		s.startLocked(e)
+	}
+	return nil
+}
+
+// AddCron registers a job driven by a cron expression; see ParseCron.
+func (s *Scheduler) AddCron(name, expr string, job Job, opts ...JobOption) error {
+	schedule, err := ParseCron(expr)
+	if err != nil {
+		return err
+	}
+	return s.Add(name, schedule, job, opts...)
+}
+
+// AddInterval registers a job firing every interval.
+func (s *Scheduler) AddInterval(
+	name string,
+	interval time.Duration,
+	job Job,
+	opts ...JobOption,
+) error {
+	if interval <= 0 {
+		return fmt.Errorf("job %q: interval must be positive", name)
+	}
+	return s.Add(name, Every(interval), job, opts...)
+}
+
+// Run starts all jobs and blocks until ctx is canceled or Stop is called.
+func (s *Scheduler) Run(ctx context.Context) error {
+	s.mu.Lock()
+	if s.stopped {
+		s.mu.Unlock()
+		return nil
+	}
+	if s.ctx != nil {
+		s.mu.Unlock()
+		return errors.New("scheduler is already running")
+	}
+	s.ctx, s.cancel = context.WithCancel(ctx)
+	done := s.ctx.Done()
+	for _, e := range s.jobs {
+		s.startLocked(e)
+	}
+	s.mu.Unlock()
+
+	<-done
+	s.wg.Wait()
+	return nil
+}
+
+// Stop stops scheduling new activations and waits for running jobs within ctx.
+// Running jobs observe the cancellation of their context.
+func (s *Scheduler) Stop(ctx context.Context) error {
+	s.mu.Lock()
+	s.stopped = true
+	cancel := s.cancel
+	s.mu.Unlock()
+	if cancel == nil {
+		return nil
+	}
+	cancel()
+
+	done := make(chan struct{})
+	go func() {
+		s.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("wait scheduled jobs: %w", ctx.Err())
+	}
+}
+
+func (s *Scheduler) startLocked(e *entry) {
+	ctx := s.ctx
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		s.loop(ctx, e)
+	}()
+}
+
+func (s *Scheduler) loop(ctx context.Context, e *entry) {
+	now := time.Now()
+	for {
+		next := e.schedule.Next(now)
+		if next.IsZero() {
+			return
+		}
+		timer := time.NewTimer(time.Until(next))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case now = <-timer.C:
+		}
+		s.fire(ctx, e)
+	}
+}
+
+func (s *Scheduler) fire(ctx context.Context, e *entry) {
+	select {
+	case e.slots <- struct{}{}:
+	default:
+		s.record(ctx, e, OutcomeSkipped, 0)
+		slog.WarnContext(ctx, "scheduled job skipped, previous run still in progress",
+			slog.String("job", e.name))
+		return
+	}
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		defer func() { <-e.slots }()
+		e.running.Lock()
+		defer e.running.Unlock()
+		if ctx.Err() != nil {
+			return
+		}
+		s.execute(ctx, e)
+	}()
+}
+
+func (s *Scheduler) execute(ctx context.Context, e *entry) {
+	runCtx := ctx
+	if e.cfg.timeout > 0 {
+		var cancel context.CancelFunc
+		runCtx, cancel = context.WithTimeout(ctx, e.cfg.timeout)
+		defer cancel()
+	}
+	if e.cfg.locker != nil {
+		ttl := e.cfg.lockTTL
+		if ttl <= 0 {
+			ttl = e.cfg.timeout
+		}
+		if ttl <= 0 {
+			ttl = time.Minute
+		}
+		release, acquired, err := e.cfg.locker.TryLock(runCtx, e.cfg.lockKey, ttl)
+		if err != nil {
+			s.record(ctx, e, OutcomeFailure, 0)
+			slog.ErrorContext(ctx, "scheduled job lock failed",
+				slog.String("job", e.name), slog.Any("error", err))
+			return
+		}
+		if !acquired {
+			s.record(ctx, e, OutcomeLocked, 0)
+			return
+		}
+		defer func() {
+			if err := release(context.WithoutCancel(ctx)); err != nil {
+				slog.WarnContext(ctx, "scheduled job unlock failed",
+					slog.String("job", e.name), slog.Any("error", err))
+			}
+		}()
+	}
+
+	start := time.Now()
+	stack, err := runJob(runCtx, e.job)
+	elapsed := time.Since(start)
+	outcome := OutcomeSuccess
+	switch {
+	case stack != nil:
+		outcome = OutcomePanic
+	case err != nil && errors.Is(runCtx.Err(), context.DeadlineExceeded):
+		outcome = OutcomeTimeout
+	case err != nil:
+		outcome = OutcomeFailure
+	}
+	s.record(ctx, e, outcome, elapsed)
+	if stack != nil {
+		slog.ErrorContext(ctx, "scheduled job panic recovered",
+			slog.String("job", e.name),
+			slog.Any("error", err),
+			slog.String("stack", string(stack)))
+	} else if err != nil {
+		slog.ErrorContext(ctx, "scheduled job failed",
+			slog.String("job", e.name),
+			slog.String("outcome", outcome),
+			slog.Duration("elapsed", elapsed),
+			slog.Any("error", err))
+	}
+}
+
+// runJob runs job and converts a panic into an error, returning the stack of
+// the panicking goroutine.
+func runJob(ctx context.Context, job Job) (stack []byte, err error) {
+	defer func() {
+		if p := recover(); p != nil {
+			stack = debug.Stack()
+			err = fmt.Errorf("job panic: %v", p)
+		}
+	}()
+	return nil, job(ctx)
+}
+
+func (s *Scheduler) record(ctx context.Context, e *entry, outcome string, elapsed time.Duration) {
+	ctx = context.WithoutCancel(ctx)
+	attrs := metric.WithAttributes(
+		attribute.String("job", e.name),
+		attribute.String("outcome", outcome),
+	)
+	s.runs.Add(ctx, 1, attrs)
+	if elapsed > 0 {
+		s.duration.Record(ctx, elapsed.Seconds(), attrs)
+	}
+}
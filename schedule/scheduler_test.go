@@ -0,0 +1,229 @@
+// Copyright 2022 The codesjoy Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package schedule
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+)
+
+func startScheduler(t *testing.T, s *Scheduler) {
+	t.Helper()
+	done := make(chan error, 1)
+	go func() { done <- s.Run(context.Background()) }()
+	t.Cleanup(func() {
+		require.NoError(t, s.Stop(context.Background()))
+		require.NoError(t, <-done)
+	})
+}
+
+func collectRuns(t *testing.T, reader *sdkmetric.ManualReader) map[string]int64 {
+	t.Helper()
+	var rm metricdata.ResourceMetrics
+	require.NoError(t, reader.Collect(context.Background(), &rm))
+	out := map[string]int64{}
+	for _, sm := range rm.ScopeMetrics {
+		for _, m := range sm.Metrics {
+			if m.Name != "schedule.job.runs" {
+				continue
+			}
+			for _, dp := range m.Data.(metricdata.Sum[int64]).DataPoints {
+				job, _ := dp.Attributes.Value("job")
+				outcome, _ := dp.Attributes.Value("outcome")
+				out[job.AsString()+"/"+outcome.AsString()] += dp.Value
+			}
+		}
+	}
+	return out
+}
+
+func TestSchedulerRunsIntervalJobsAndRecoversPanics(t *testing.T) {
+	reader := sdkmetric.NewManualReader()
+	s := New(WithMeterProvider(sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader))))
+
+	var ticks, panics atomic.Int32
+	require.NoError(t, s.AddInterval("tick", 5*time.Millisecond, func(context.Context) error {
+		ticks.Add(1)
+		return nil
+	}))
+	require.NoError(t, s.AddInterval("boom", 5*time.Millisecond, func(context.Context) error {
+		panics.Add(1)
+		panic("boom")
+	}))
+	startScheduler(t, s)
+
+	require.Eventually(t, func() bool {
+		return ticks.Load() >= 3 && panics.Load() >= 3
+	}, 5*time.Second, 5*time.Millisecond)
+	runs := collectRuns(t, reader)
+	assert.GreaterOrEqual(t, runs["tick/success"], int64(3))
+	assert.GreaterOrEqual(t, runs["boom/panic"], int64(3))
+}
+
+func TestSchedulerOverlapPolicies(t *testing.T) {
+	reader := sdkmetric.NewManualReader()
+	s := New(WithMeterProvider(sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader))))
+
+	release := make(chan struct{})
+	var skipRuns, queueRuns, concurrent, maxConcurrent atomic.Int32
+	slow := func(counter *atomic.Int32) Job {
+		return func(ctx context.Context) error {
+			n := concurrent.Add(1)
+			defer concurrent.Add(-1)
+			for {
+				cur := maxConcurrent.Load()
+				if n <= cur || maxConcurrent.CompareAndSwap(cur, n) {
+					break
+				}
+			}
+			counter.Add(1)
+			select {
+			case <-release:
+			case <-ctx.Done():
+			}
+			return nil
+		}
+	}
+	require.NoError(t, s.AddInterval("skip", 5*time.Millisecond, slow(&skipRuns)))
+	require.NoError(t, s.AddInterval("queue", 5*time.Millisecond, slow(&queueRuns),
+		WithOverlap(OverlapQueue)))
+	startScheduler(t, s)
+
+	require.Eventually(t, func() bool {
+		runs := collectRuns(t, reader)
+		return runs["skip/skipped"] > 0 && runs["queue/skipped"] > 0
+	}, 5*time.Second, 5*time.Millisecond)
+	assert.Equal(t, int32(1), skipRuns.Load())
+	assert.Equal(t, int32(1), queueRuns.Load())
+
+	close(release)
+	require.Eventually(t, func() bool {
+		return queueRuns.Load() >= 2
+	}, 5*time.Second, 5*time.Millisecond)
+	assert.LessOrEqual(t, maxConcurrent.Load(), int32(2))
+}
+
+func TestSchedulerJobTimeout(t *testing.T) {
+	reader := sdkmetric.NewManualReader()
+	s := New(WithMeterProvider(sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader))))
+	require.NoError(t, s.AddInterval("slow", 5*time.Millisecond, func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	}, WithTimeout(10*time.Millisecond)))
+	startScheduler(t, s)
+
+	require.Eventually(t, func() bool {
+		return collectRuns(t, reader)["slow/timeout"] > 0
+	}, 5*time.Second, 5*time.Millisecond)
+}
+
+type memoryLocker struct {
+	mu   sync.Mutex
+	held map[string]bool
+	err  error
+}
+
+func (l *memoryLocker) TryLock(
+	_ context.Context,
+	key string,
+	_ time.Duration,
+) (func(context.Context) error, bool, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.err != nil {
+		return nil, false, l.err
+	}
+	if l.held[key] {
+		return nil, false, nil
+	}
+	l.held[key] = true
+	return func(context.Context) error {
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		delete(l.held, key)
+		return nil
+	}, true, nil
+}
+
+func TestSchedulerLockRunsJobOnOneReplica(t *testing.T) {
+	locker := &memoryLocker{held: map[string]bool{}}
+	release := make(chan struct{})
+	var runs atomic.Int32
+	job := func(ctx context.Context) error {
+		runs.Add(1)
+		select {
+		case <-release:
+		case <-ctx.Done():
+		}
+		return nil
+	}
+
+	replicas := make([]*Scheduler, 3)
+	for i := range replicas {
+		replicas[i] = New()
+		require.NoError(t, replicas[i].AddInterval("report", 5*time.Millisecond, job,
+			WithLock(locker, "", time.Second)))
+		startScheduler(t, replicas[i])
+	}
+	require.Eventually(t, func() bool {
+		return runs.Load() == 1
+	}, 5*time.Second, 5*time.Millisecond)
+	time.Sleep(30 * time.Millisecond)
+	assert.Equal(t, int32(1), runs.Load())
+	close(release)
+}
+
+func TestSchedulerLockErrorSkipsRun(t *testing.T) {
+	reader := sdkmetric.NewManualReader()
+	s := New(WithMeterProvider(sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader))))
+	locker := &memoryLocker{held: map[string]bool{}, err: errors.New("lock backend down")}
+	var runs atomic.Int32
+	require.NoError(t, s.AddInterval("report", 5*time.Millisecond, func(context.Context) error {
+		runs.Add(1)
+		return nil
+	}, WithLock(locker, "report", 0)))
+	startScheduler(t, s)
+
+	require.Eventually(t, func() bool {
+		return collectRuns(t, reader)["report/failure"] > 0
+	}, 5*time.Second, 5*time.Millisecond)
+	assert.Zero(t, runs.Load())
+}
+
+func TestSchedulerAddValidation(t *testing.T) {
+	s := New()
+	noop := func(context.Context) error { return nil }
+	require.Error(t, s.Add("", Every(time.Second), noop))
+	require.Error(t, s.Add("nil", nil, noop))
+	require.Error(t, s.AddInterval("zero", 0, noop))
+	require.Error(t, s.AddCron("bad", "not a cron", noop))
+	require.NoError(t, s.AddCron("nightly", "@daily", noop))
+	require.Error(t, s.AddCron("nightly", "@daily", noop))
+}
+
+func TestSchedulerStopBeforeRun(t *testing.T) {
+	s := New()
+	require.NoError(t, s.Stop(context.Background()))
+	require.NoError(t, s.Run(context.Background()))
+}
@@ -0,0 +1,272 @@
+// Copyright 2022 The codesjoy Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tenant
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"google.golang.org/genproto/googleapis/rpc/code"
+
+	"github.com/codesjoy/yggdrasil/v3/config"
+	"github.com/codesjoy/yggdrasil/v3/rpc/interceptor"
+	"github.com/codesjoy/yggdrasil/v3/rpc/metadata"
+	"github.com/codesjoy/yggdrasil/v3/rpc/status"
+	"github.com/codesjoy/yggdrasil/v3/rpc/stream"
+)
+
+const name = "tenant"
+
+// Config defines the tenant interceptor configuration.
+type Config struct {
+	// Resolvers lists the resolvers tried in order: "metadata", "jwt" or
+	// names registered with RegisterResolver.
+	Resolvers []string `mapstructure:"resolvers" default:"[\"metadata\"]"`
+	// Metadata is the metadata key read by the "metadata" resolver and
+	// written by the client interceptors.
+	Metadata string `mapstructure:"metadata" default:"x-tenant-id"`
+	// Claim is the token claim read by the "jwt" resolver.
+	Claim string `mapstructure:"claim" default:"tenant_id"`
+	// Required rejects requests without a tenant with INVALID_ARGUMENT.
+	Required bool `mapstructure:"required"`
+}
+
+// serverOverlay holds the overlay fields applied by the server interceptors.
+type serverOverlay struct {
+	// Timeout bounds the requests of the tenant.
+	Timeout time.Duration `mapstructure:"timeout"`
+}
+
+func mustLoadConfig(source any) Config {
+	cfg := Config{}
+	if err := config.NewSnapshot(source).Decode(&cfg); err != nil {
+		panic(fmt.Sprintf("load tenant interceptor config: %v", err))
+	}
+	cfg.Metadata = strings.ToLower(cfg.Metadata)
+	return cfg
+}
+
+// BuiltinUnaryServerProvider returns the tenant unary server interceptor provider.
+func BuiltinUnaryServerProvider() interceptor.UnaryServerInterceptorProvider {
+	return BuiltinUnaryServerProviderWithConfig(nil)
+}
+
+// BuiltinUnaryServerProviderWithConfig returns the tenant unary server
+// interceptor provider bound to explicit config.
+func BuiltinUnaryServerProviderWithConfig(
+	source any,
+) interceptor.UnaryServerInterceptorProvider {
+	cfg := mustLoadConfig(source)
+	return interceptor.NewUnaryServerInterceptorProvider(
+		name,
+		func() interceptor.UnaryServerInterceptor {
+			return UnaryServerInterceptor(cfg)
+		},
+	)
+}
+
+// BuiltinStreamServerProvider returns the tenant stream server interceptor provider.
+func BuiltinStreamServerProvider() interceptor.StreamServerInterceptorProvider {
+	return BuiltinStreamServerProviderWithConfig(nil)
+}
+
+// BuiltinStreamServerProviderWithConfig returns the tenant stream server
+// interceptor provider bound to explicit config.
+func BuiltinStreamServerProviderWithConfig(
+	source any,
+) interceptor.StreamServerInterceptorProvider {
+	cfg := mustLoadConfig(source)
+	return interceptor.NewStreamServerInterceptorProvider(
+		name,
+		func() interceptor.StreamServerInterceptor {
+			return StreamServerInterceptor(cfg)
+		},
+	)
+}
+
+// BuiltinUnaryClientProvider returns the tenant unary client interceptor provider.
+func BuiltinUnaryClientProvider() interceptor.UnaryClientInterceptorProvider {
+	return BuiltinUnaryClientProviderWithConfig(nil)
+}
+
+// BuiltinUnaryClientProviderWithConfig returns the tenant unary client
+// interceptor provider bound to explicit config.
+func BuiltinUnaryClientProviderWithConfig(
+	source any,
+) interceptor.UnaryClientInterceptorProvider {
+	cfg := mustLoadConfig(source)
+	return interceptor.NewUnaryClientInterceptorProvider(
+		name,
+		func(string) interceptor.UnaryClientInterceptor {
+			return UnaryClientInterceptor(cfg)
+		},
+	)
+}
+
+// BuiltinStreamClientProvider returns the tenant stream client interceptor provider.
+func BuiltinStreamClientProvider() interceptor.StreamClientInterceptorProvider {
+	return BuiltinStreamClientProviderWithConfig(nil)
+}
+
+// BuiltinStreamClientProviderWithConfig returns the tenant stream client
+// interceptor provider bound to explicit config.
+func BuiltinStreamClientProviderWithConfig(
+	source any,
+) interceptor.StreamClientInterceptorProvider {
+	cfg := mustLoadConfig(source)
+	return interceptor.NewStreamClientInterceptorProvider(
+		name,
+		func(string) interceptor.StreamClientInterceptor {
+			return StreamClientInterceptor(cfg)
+		},
+	)
+}
+
+type server struct {
+	cfg      Config
+	overlays *Cache[serverOverlay]
+}
+
+func newServer(cfg Config) *server {
+	return &server{
+		cfg: cfg,
+		overlays: NewCache(func(s config.Snapshot) (serverOverlay, error) {
+			out := serverOverlay{}
+			err := s.Decode(&out)
+			return out, err
+		}),
+	}
+}
+
+func (s *server) resolve(ctx context.Context) (string, bool) {
+	for _, name := range s.cfg.Resolvers {
+		var resolver Resolver
+		switch name {
+		case MetadataResolverName:
+			resolver = MetadataResolver(s.cfg.Metadata)
+		case JWTResolverName:
+			resolver = JWTResolver(s.cfg.Claim)
+		default:
+			resolver = GetResolver(name)
+		}
+		if resolver == nil {
+			continue
+		}
+		if id, ok := resolver.Resolve(ctx); ok {
+			return id, true
+		}
+	}
+	return "", false
+}
+
+// enter resolves the tenant and applies its timeout. The returned cancel
+// function must be called when the request completes.
+func (s *server) enter(ctx context.Context) (context.Context, context.CancelFunc, error) {
+	id, ok := s.resolve(ctx)
+	if !ok {
+		if s.cfg.Required {
+			return nil, nil, status.New(code.Code_INVALID_ARGUMENT, "missing tenant").Err()
+		}
+		return ctx, func() {}, nil
+	}
+	ctx = WithID(ctx, id)
+	if overlay, ok := s.overlays.Get(ctx); ok && overlay.Timeout > 0 {
+		ctx, cancel := context.WithTimeout(ctx, overlay.Timeout)
+		return ctx, cancel, nil
+	}
+	return ctx, func() {}, nil
+}
+
+// UnaryServerInterceptor resolves the tenant of unary requests.
+func UnaryServerInterceptor(cfg Config) interceptor.UnaryServerInterceptor {
+	s := newServer(cfg)
+	return func(
+		ctx context.Context,
+		req any,
+		_ *interceptor.UnaryServerInfo,
+		handler interceptor.UnaryHandler,
+	) (any, error) {
+		ctx, cancel, err := s.enter(ctx)
+		if err != nil {
+			return nil, err
+		}
+		defer cancel()
+		return handler(ctx, req)
+	}
+}
+
+// StreamServerInterceptor resolves the tenant of streams.
+func StreamServerInterceptor(cfg Config) interceptor.StreamServerInterceptor {
+	s := newServer(cfg)
+	return func(
+		srv any,
+		ss stream.ServerStream,
+		_ *interceptor.StreamServerInfo,
+		handler stream.Handler,
+	) error {
+		ctx, cancel, err := s.enter(ss.Context())
+		if err != nil {
+			return err
+		}
+		defer cancel()
+		return handler(srv, &serverStream{ServerStream: ss, ctx: ctx})
+	}
+}
+
+type serverStream struct {
+	stream.ServerStream
+	ctx context.Context
+}
+
+func (ss *serverStream) Context() context.Context {
+	return ss.ctx
+}
+
+// UnaryClientInterceptor forwards the context tenant to called services.
+func UnaryClientInterceptor(cfg Config) interceptor.UnaryClientInterceptor {
+	return func(
+		ctx context.Context,
+		method string,
+		req, reply any,
+		invoker interceptor.UnaryInvoker,
+	) error {
+		return invoker(outgoing(ctx, cfg.Metadata), method, req, reply)
+	}
+}
+
+// StreamClientInterceptor forwards the context tenant to called services.
+func StreamClientInterceptor(cfg Config) interceptor.StreamClientInterceptor {
+	return func(
+		ctx context.Context,
+		desc *stream.Desc,
+		method string,
+		streamer interceptor.Streamer,
+	) (stream.ClientStream, error) {
+		return streamer(outgoing(ctx, cfg.Metadata), desc, method)
+	}
+}
+
+func outgoing(ctx context.Context, key string) context.Context {
+	id, ok := FromContext(ctx)
+	if !ok {
+		return ctx
+	}
+	if md, ok := metadata.FromOutContext(ctx); ok && len(md.Get(key)) > 0 {
+		return ctx
+	}
+	return metadata.WithOutContext(ctx, metadata.Pairs(key, id))
+}
@@ -0,0 +1,162 @@
+// Copyright 2022 The codesjoy Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tenant
+
+import (
+	"context"
+	"encoding/base64"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/genproto/googleapis/rpc/code"
+
+	"github.com/codesjoy/yggdrasil/v3/rpc/interceptor"
+	"github.com/codesjoy/yggdrasil/v3/rpc/metadata"
+	"github.com/codesjoy/yggdrasil/v3/rpc/status"
+	"github.com/codesjoy/yggdrasil/v3/rpc/stream"
+)
+
+func bearer(payload string) string {
+	return "Bearer e30." + base64.RawURLEncoding.EncodeToString([]byte(payload)) + ".sig"
+}
+
+func TestMustLoadConfig(t *testing.T) {
+	cfg := mustLoadConfig(nil)
+	assert.Equal(t, []string{MetadataResolverName}, cfg.Resolvers)
+	assert.Equal(t, "x-tenant-id", cfg.Metadata)
+	assert.Equal(t, "tenant_id", cfg.Claim)
+	assert.False(t, cfg.Required)
+
+	cfg = mustLoadConfig(map[string]any{"metadata": "X-Org", "resolvers": []string{"jwt"}})
+	assert.Equal(t, "x-org", cfg.Metadata)
+	assert.Equal(t, []string{JWTResolverName}, cfg.Resolvers)
+}
+
+func TestJWTResolver(t *testing.T) {
+	resolve := func(values ...string) (string, bool) {
+		md := metadata.MD{}
+		md.Append("authorization", values...)
+		return JWTResolver("tenant_id").Resolve(metadata.WithInContext(context.Background(), md))
+	}
+	id, ok := resolve(bearer(`{"tenant_id":"acme"}`))
+	assert.True(t, ok)
+	assert.Equal(t, "acme", id)
+	id, ok = resolve("Basic abc", bearer(`{"tenant_id":42}`))
+	assert.True(t, ok)
+	assert.Equal(t, "42", id)
+
+	_, ok = resolve(bearer(`{"sub":"x"}`))
+	assert.False(t, ok)
+	_, ok = resolve("Bearer not-a-jwt")
+	assert.False(t, ok)
+	_, ok = JWTResolver("tenant_id").Resolve(context.Background())
+	assert.False(t, ok)
+}
+
+func TestUnaryServerInterceptor(t *testing.T) {
+	initModule(t, map[string]any{"acme": map[string]any{"timeout": "1m"}})
+	RegisterResolver("fixed", ResolverFunc(func(context.Context) (string, bool) {
+		return "fixed", true
+	}))
+	t.Cleanup(func() { RegisterResolver("fixed", nil) })
+	info := &interceptor.UnaryServerInfo{FullMethod: "/svc/Get"}
+
+	unary := UnaryServerInterceptor(mustLoadConfig(map[string]any{
+		"resolvers": []string{"metadata", "jwt", "missing", "fixed"},
+	}))
+	call := func(ctx context.Context) (string, bool, error) {
+		var (
+			id          string
+			hasDeadline bool
+		)
+		_, err := unary(ctx, nil, info, func(ctx context.Context, _ any) (any, error) {
+			id, _ = FromContext(ctx)
+			_, hasDeadline = ctx.Deadline()
+			return nil, nil
+		})
+		return id, hasDeadline, err
+	}
+
+	id, hasDeadline, err := call(metadata.WithInContext(context.Background(),
+		metadata.Pairs("x-tenant-id", "acme")))
+	require.NoError(t, err)
+	assert.Equal(t, "acme", id)
+	assert.True(t, hasDeadline, "the tenant timeout applies")
+
+	id, hasDeadline, err = call(metadata.WithInContext(context.Background(),
+		metadata.Pairs("authorization", bearer(`{"tenant_id":"beta"}`))))
+	require.NoError(t, err)
+	assert.Equal(t, "beta", id)
+	assert.False(t, hasDeadline)
+
+	id, _, err = call(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, "fixed", id)
+}
+
+func TestServerInterceptorsRequireTenant(t *testing.T) {
+	cfg := mustLoadConfig(map[string]any{"required": true})
+	_, err := UnaryServerInterceptor(cfg)(context.Background(), nil,
+		&interceptor.UnaryServerInfo{FullMethod: "/svc/Get"},
+		func(context.Context, any) (any, error) { return nil, nil })
+	assert.Equal(t, code.Code_INVALID_ARGUMENT, status.FromError(err).Code())
+
+	err = StreamServerInterceptor(cfg)(nil, &testServerStream{ctx: context.Background()},
+		&interceptor.StreamServerInfo{FullMethod: "/svc/Watch"},
+		func(any, stream.ServerStream) error { return nil })
+	assert.Equal(t, code.Code_INVALID_ARGUMENT, status.FromError(err).Code())
+
+	ctx := metadata.WithInContext(context.Background(), metadata.Pairs("x-tenant-id", "acme"))
+	err = StreamServerInterceptor(cfg)(nil, &testServerStream{ctx: ctx},
+		&interceptor.StreamServerInfo{FullMethod: "/svc/Watch"},
+		func(_ any, ss stream.ServerStream) error {
+			id, _ := FromContext(ss.Context())
+			assert.Equal(t, "acme", id)
+			return nil
+		})
+	require.NoError(t, err)
+}
+
+type testServerStream struct {
+	stream.ServerStream
+	ctx context.Context
+}
+
+func (s *testServerStream) Context() context.Context { return s.ctx }
+
+func TestClientInterceptorsForwardTenant(t *testing.T) {
+	cfg := mustLoadConfig(nil)
+	ctx := WithID(context.Background(), "acme")
+
+	var sent metadata.MD
+	err := UnaryClientInterceptor(cfg)(ctx, "/svc/Get", nil, nil,
+		func(ctx context.Context, _ string, _, _ any) error {
+			sent, _ = metadata.FromOutContext(ctx)
+			return nil
+		})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"acme"}, sent.Get("x-tenant-id"))
+
+	// An explicit tenant set by the caller is kept.
+	explicit := metadata.WithOutContext(ctx, metadata.Pairs("x-tenant-id", "other"))
+	_, err = StreamClientInterceptor(cfg)(explicit, &stream.Desc{}, "/svc/Watch",
+		func(ctx context.Context, _ *stream.Desc, _ string) (stream.ClientStream, error) {
+			sent, _ = metadata.FromOutContext(ctx)
+			return nil, nil
+		})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"other"}, sent.Get("x-tenant-id"))
+}
@@ -0,0 +1,141 @@
+// Copyright 2022 The codesjoy Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tenant
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/codesjoy/yggdrasil/v3/rpc/metadata"
+)
+
+// Resolver extracts the tenant id of an incoming request.
+type Resolver interface {
+	// Resolve returns the tenant id and whether one was found.
+	Resolve(ctx context.Context) (string, bool)
+}
+
+// ResolverFunc adapts a function to a Resolver.
+type ResolverFunc func(ctx context.Context) (string, bool)
+
+// Resolve calls f.
+func (f ResolverFunc) Resolve(ctx context.Context) (string, bool) { return f(ctx) }
+
+// Builtin resolver names.
+const (
+	// MetadataResolverName reads the tenant id from the configured metadata.
+	MetadataResolverName = "metadata"
+	// JWTResolverName reads the tenant id from a claim of the bearer token in
+	// the "authorization" metadata. The token signature is not verified, so
+	// it must only be used behind a component that verifies it.
+	JWTResolverName = "jwt"
+)
+
+var resolvers = struct {
+	sync.RWMutex
+	m map[string]Resolver
+}{m: map[string]Resolver{}}
+
+// RegisterResolver registers a resolver under name so it can be listed in
+// the interceptor config. Registering an existing name replaces it.
+func RegisterResolver(name string, resolver Resolver) {
+	resolvers.Lock()
+	defer resolvers.Unlock()
+	resolvers.m[name] = resolver
+}
+
+// GetResolver returns the resolver registered under name, or nil.
+func GetResolver(name string) Resolver {
+	resolvers.RLock()
+	defer resolvers.RUnlock()
+	return resolvers.m[name]
+}
+
+// MetadataResolver reads the tenant id from the incoming metadata key.
+func MetadataResolver(key string) Resolver {
+	key = strings.ToLower(key)
+	return ResolverFunc(func(ctx context.Context) (string, bool) {
+		md, ok := metadata.FromInContext(ctx)
+		if !ok {
+			return "", false
+		}
+		values := md.Get(key)
+		if len(values) == 0 {
+			return "", false
+		}
+		id := strings.TrimSpace(values[0])
+		return id, id != ""
+	})
+}
+
+// JWTResolver reads the tenant id from claim of the bearer token carried by
+// the "authorization" metadata. It does not verify the token.
+func JWTResolver(claim string) Resolver {
+	return ResolverFunc(func(ctx context.Context) (string, bool) {
+		md, ok := metadata.FromInContext(ctx)
+		if !ok {
+			return "", false
+		}
+		for _, value := range md.Get("authorization") {
+			token, ok := cutBearer(value)
+			if !ok {
+				continue
+			}
+			if id, ok := claimValue(token, claim); ok {
+				return id, true
+			}
+		}
+		return "", false
+	})
+}
+
+func cutBearer(value string) (string, bool) {
+	scheme, token, ok := strings.Cut(strings.TrimSpace(value), " ")
+	if !ok || !strings.EqualFold(scheme, "bearer") {
+		return "", false
+	}
+	return strings.TrimSpace(token), true
+}
+
+func claimValue(token, claim string) (string, bool) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return "", false
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return "", false
+	}
+	claims := map[string]any{}
+	decoder := json.NewDecoder(strings.NewReader(string(payload)))
+	decoder.UseNumber()
+	if err := decoder.Decode(&claims); err != nil {
+		return "", false
+	}
+	switch v := claims[claim].(type) {
+	case string:
+		return v, v != ""
+	case json.Number:
+		return v.String(), true
+	case nil:
+		return "", false
+	default:
+		return fmt.Sprint(v), true
+	}
+}
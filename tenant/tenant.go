@@ -0,0 +1,210 @@
+// Copyright 2022 The codesjoy Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package tenant resolves the tenant of a request and the configuration
+// overlaid for it.
+//
+// The server interceptors resolve the tenant id from metadata or token claims
+// and store it in the context. Overlays configured under
+// "yggdrasil.tenants.{id}" are served by the module returned by Module; other
+// subsystems read them through Section, FeatureEnabled or a Cache, so per
+// tenant limits apply without extra wiring.
+package tenant
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sync"
+	"sync/atomic"
+
+	"github.com/codesjoy/yggdrasil/v3/config"
+	"github.com/codesjoy/yggdrasil/v3/module"
+)
+
+const (
+	// ModuleName is the name of the tenant overlay module.
+	ModuleName = "tenant"
+	// ConfigPath is the config path holding the overlays keyed by tenant id.
+	ConfigPath = "yggdrasil.tenants"
+)
+
+type idKey struct{}
+
+// WithID returns a copy of ctx carrying the tenant id.
+func WithID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, idKey{}, id)
+}
+
+// FromContext returns the tenant id carried by ctx.
+func FromContext(ctx context.Context) (string, bool) {
+	id, ok := ctx.Value(idKey{}).(string)
+	return id, ok && id != ""
+}
+
+type overlaySet struct {
+	generation uint64
+	snapshot   config.Snapshot
+}
+
+var (
+	overlays   atomic.Pointer[overlaySet]
+	generation atomic.Uint64
+)
+
+func setOverlays(value map[string]any) {
+	overlays.Store(&overlaySet{
+		generation: generation.Add(1),
+		snapshot:   config.NewSnapshot(value),
+	})
+}
+
+func currentOverlays() *overlaySet {
+	if set := overlays.Load(); set != nil {
+		return set
+	}
+	return &overlaySet{}
+}
+
+// Section returns the overlay of tenant id under path. It is empty when the
+// tenant has no overlay there.
+func Section(id string, path ...string) config.Snapshot {
+	return currentOverlays().snapshot.Section(append([]string{id}, path...)...)
+}
+
+// FeatureEnabled reports whether the tenant of ctx enables the feature flag
+// configured under "yggdrasil.tenants.{id}.features.{name}".
+func FeatureEnabled(ctx context.Context, name string) bool {
+	id, ok := FromContext(ctx)
+	if !ok {
+		return false
+	}
+	var enabled bool
+	if err := Section(id, "features", name).Decode(&enabled); err != nil {
+		return false
+	}
+	return enabled
+}
+
+// Cache builds a value from the overlay found at a fixed path and keeps it
+// per tenant until the overlays change.
+type Cache[T any] struct {
+	path  []string
+	build func(config.Snapshot) (T, error)
+
+	mu      sync.Mutex
+	entries map[string]cacheEntry[T]
+}
+
+type cacheEntry[T any] struct {
+	generation uint64
+	value      T
+	ok         bool
+}
+
+// NewCache returns a cache building values from the overlays under path.
+func NewCache[T any](build func(config.Snapshot) (T, error), path ...string) *Cache[T] {
+	return &Cache[T]{path: path, build: build, entries: map[string]cacheEntry[T]{}}
+}
+
+// Get returns the value built for the tenant of ctx. It reports false when
+// ctx carries no tenant, the tenant has no overlay at the path or the overlay
+// is invalid.
+func (c *Cache[T]) Get(ctx context.Context) (T, bool) {
+	var zero T
+	id, ok := FromContext(ctx)
+	if !ok {
+		return zero, false
+	}
+	set := currentOverlays()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if entry, ok := c.entries[id]; ok && entry.generation == set.generation {
+		return entry.value, entry.ok
+	}
+	entry := cacheEntry[T]{generation: set.generation}
+	if section := set.snapshot.Section(append([]string{id}, c.path...)...); !section.Empty() {
+		value, err := c.build(section)
+		if err != nil {
+			slog.Warn("invalid tenant overlay",
+				slog.String("tenant", id),
+				slog.Any("path", c.path),
+				slog.Any("error", err))
+		} else {
+			entry.value, entry.ok = value, true
+		}
+	}
+	c.entries[id] = entry
+	return entry.value, entry.ok
+}
+
+type tenantModule struct{}
+
+// Module returns the module serving the tenant overlays configured under
+// ConfigPath. Overlays are replaced when the configuration is reloaded.
+func Module() module.Module {
+	return tenantModule{}
+}
+
+func (tenantModule) Name() string { return ModuleName }
+
+func (tenantModule) ConfigPath() string { return ConfigPath }
+
+func (tenantModule) Init(_ context.Context, view config.View) error {
+	value, err := decodeOverlays(view)
+	if err != nil {
+		return err
+	}
+	setOverlays(value)
+	return nil
+}
+
+func (tenantModule) PrepareReload(
+	_ context.Context,
+	view config.View,
+) (module.ReloadCommitter, error) {
+	value, err := decodeOverlays(view)
+	if err != nil {
+		return nil, err
+	}
+	return overlayCommitter{next: value, prev: currentOverlays()}, nil
+}
+
+func (tenantModule) Stop(context.Context) error {
+	overlays.Store(nil)
+	return nil
+}
+
+func decodeOverlays(view config.View) (map[string]any, error) {
+	value := map[string]any{}
+	if err := view.Decode(&value); err != nil {
+		return nil, fmt.Errorf("load tenant overlays: %w", err)
+	}
+	return value, nil
+}
+
+type overlayCommitter struct {
+	next map[string]any
+	prev *overlaySet
+}
+
+func (c overlayCommitter) Commit(context.Context) error {
+	setOverlays(c.next)
+	return nil
+}
+
+func (c overlayCommitter) Rollback(context.Context) error {
+	overlays.Store(c.prev)
+	return nil
+}
@@ -0,0 +1,109 @@
+// Copyright 2022 The codesjoy Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tenant
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/codesjoy/yggdrasil/v3/config"
+	"github.com/codesjoy/yggdrasil/v3/module"
+)
+
+func initModule(t *testing.T, overlays map[string]any) module.Module {
+	t.Helper()
+	m := Module()
+	require.NoError(t, m.(module.Initializable).Init(context.Background(),
+		config.NewView(ConfigPath, config.NewSnapshot(overlays))))
+	t.Cleanup(func() { _ = m.(module.Stoppable).Stop(context.Background()) })
+	return m
+}
+
+func TestContext(t *testing.T) {
+	_, ok := FromContext(context.Background())
+	assert.False(t, ok)
+	_, ok = FromContext(WithID(context.Background(), ""))
+	assert.False(t, ok)
+	id, ok := FromContext(WithID(context.Background(), "acme"))
+	assert.True(t, ok)
+	assert.Equal(t, "acme", id)
+}
+
+func TestOverlays(t *testing.T) {
+	m := initModule(t, map[string]any{
+		"acme": map[string]any{
+			"features": map[string]any{"beta": true},
+			"limits":   map[string]any{"max": 3},
+		},
+	})
+	assert.Equal(t, ModuleName, m.Name())
+	assert.Equal(t, ConfigPath, m.(module.Configurable).ConfigPath())
+
+	ctx := WithID(context.Background(), "acme")
+	assert.True(t, FeatureEnabled(ctx, "beta"))
+	assert.False(t, FeatureEnabled(ctx, "gamma"))
+	assert.False(t, FeatureEnabled(context.Background(), "beta"))
+	assert.Equal(t, map[string]any{"max": 3}, Section("acme", "limits").Map())
+	assert.True(t, Section("other").Empty())
+
+	builds := 0
+	cache := NewCache(func(s config.Snapshot) (int, error) {
+		builds++
+		var out struct {
+			Max int `mapstructure:"max"`
+		}
+		err := s.Decode(&out)
+		return out.Max, err
+	}, "limits")
+	value, ok := cache.Get(ctx)
+	assert.True(t, ok)
+	assert.Equal(t, 3, value)
+	_, _ = cache.Get(ctx)
+	assert.Equal(t, 1, builds)
+	_, ok = cache.Get(WithID(context.Background(), "other"))
+	assert.False(t, ok)
+	_, ok = cache.Get(context.Background())
+	assert.False(t, ok)
+
+	// A reload replaces the overlays and invalidates cached values.
+	committer, err := m.(module.Reloadable).PrepareReload(context.Background(),
+		config.NewView(ConfigPath, config.NewSnapshot(map[string]any{
+			"acme": map[string]any{"limits": map[string]any{"max": 5}},
+		})))
+	require.NoError(t, err)
+	value, _ = cache.Get(ctx)
+	assert.Equal(t, 3, value, "prepared overlays are not visible before commit")
+	require.NoError(t, committer.Commit(context.Background()))
+	value, _ = cache.Get(ctx)
+	assert.Equal(t, 5, value)
+	assert.False(t, FeatureEnabled(ctx, "beta"))
+
+	require.NoError(t, committer.Rollback(context.Background()))
+	value, _ = cache.Get(ctx)
+	assert.Equal(t, 3, value)
+}
+
+func TestCacheSkipsInvalidOverlay(t *testing.T) {
+	initModule(t, map[string]any{"acme": map[string]any{"limits": 1}})
+	cache := NewCache(func(config.Snapshot) (int, error) {
+		return 0, errors.New("invalid")
+	}, "limits")
+	_, ok := cache.Get(WithID(context.Background(), "acme"))
+	assert.False(t, ok)
+}
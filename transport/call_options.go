@@ -0,0 +1,42 @@
+// Copyright 2022 The codesjoy Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package transport
+
+import "context"
+
+// CallOptions carries per-call overrides for the transport that serves the
+// call. Transports apply the fields they support and ignore the rest.
+type CallOptions struct {
+	// MaxRecvMsgSize overrides the maximum size of a received message.
+	MaxRecvMsgSize int
+	// Compressor overrides the compressor used for the request by name.
+	Compressor string
+}
+
+type callOptionsKey struct{}
+
+// WithCallOptions attaches per-call transport options to ctx.
+func WithCallOptions(ctx context.Context, opts CallOptions) context.Context {
+	return context.WithValue(ctx, callOptionsKey{}, opts)
+}
+
+// CallOptionsFromContext returns the per-call transport options attached to ctx.
+func CallOptionsFromContext(ctx context.Context) (CallOptions, bool) {
+	if ctx == nil {
+		return CallOptions{}, false
+	}
+	opts, ok := ctx.Value(callOptionsKey{}).(CallOptions)
+	return opts, ok
+}
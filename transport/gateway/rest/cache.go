@@ -0,0 +1,86 @@
+// Copyright 2022 The codesjoy Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rest
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"net/http"
+	"path"
+	"strings"
+)
+
+// CacheConfig configures conditional GET support for RPC routes.
+type CacheConfig struct {
+	// Routes lists the GET routes answering with an ETag.
+	Routes []CacheRoute `mapstructure:"routes"`
+}
+
+// CacheRoute is the cache policy of the GET routes matching Path.
+type CacheRoute struct {
+	// Path is a route pattern as registered, e.g. "/v1/books/{id}", or a
+	// path.Match glob over registered patterns such as "/v1/books/*".
+	Path string `mapstructure:"path"`
+	// CacheControl is emitted as the Cache-Control header when set.
+	CacheControl string `mapstructure:"cache_control"`
+}
+
+// cacheRoute returns the cache policy of the route, or nil when responses
+// of the route are not cached.
+func (s *ServeMux) cacheRoute(meth, pattern string) *CacheRoute {
+	if s.cfg == nil || meth != http.MethodGet {
+		return nil
+	}
+	for i := range s.cfg.Cache.Routes {
+		route := &s.cfg.Cache.Routes[i]
+		if route.Path == pattern {
+			return route
+		}
+		if ok, _ := path.Match(route.Path, pattern); ok {
+			return route
+		}
+	}
+	return nil
+}
+
+// writeCacheHeaders sets the ETag and Cache-Control headers of a response
+// with body buf and reports whether the client copy is still fresh.
+func writeCacheHeaders(w http.ResponseWriter, r *http.Request, route *CacheRoute, buf []byte) bool {
+	etag := computeETag(buf)
+	w.Header().Set("ETag", etag)
+	if route.CacheControl != "" {
+		w.Header().Set("Cache-Control", route.CacheControl)
+	}
+	return etagMatches(r.Header.Values("If-None-Match"), etag)
+}
+
+func computeETag(buf []byte) string {
+	sum := sha256.Sum256(buf)
+	return `"` + base64.RawURLEncoding.EncodeToString(sum[:16]) + `"`
+}
+
+// etagMatches applies the weak comparison RFC 9110 requires for
+// If-None-Match.
+func etagMatches(headers []string, etag string) bool {
+	for _, header := range headers {
+		for _, candidate := range strings.Split(header, ",") {
+			candidate = strings.TrimSpace(candidate)
+			if candidate == "*" || strings.TrimPrefix(candidate, "W/") == etag {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,78 @@
+// Copyright 2022 The codesjoy Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rest
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+func TestServeMux_CacheRoutes(t *testing.T) {
+	cfg := &Config{}
+	cfg.Cache.Routes = []CacheRoute{
+		{Path: "/v1/books/{id}", CacheControl: "private, max-age=30"},
+		{Path: "/v1/shelves/*"},
+	}
+	s, err := NewServer(cfg)
+	require.NoError(t, err)
+	mux := s.(*ServeMux)
+
+	assert.Equal(t, &cfg.Cache.Routes[0], mux.cacheRoute(http.MethodGet, "/v1/books/{id}"))
+	assert.Equal(t, &cfg.Cache.Routes[1], mux.cacheRoute(http.MethodGet, "/v1/shelves/{id}"))
+	assert.Nil(t, mux.cacheRoute(http.MethodPost, "/v1/books/{id}"))
+	assert.Nil(t, mux.cacheRoute(http.MethodGet, "/v1/authors/{id}"))
+
+	value := "book"
+	handler := func(http.ResponseWriter, *http.Request) (interface{}, error) {
+		return wrapperspb.String(value), nil
+	}
+	mux.RPCHandle(http.MethodGet, "/v1/books/{id}", handler)
+	mux.RPCHandle(http.MethodGet, "/v1/authors/{id}", handler)
+
+	get := func(path, ifNoneMatch string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodGet, path, nil)
+		if ifNoneMatch != "" {
+			r.Header.Set("If-None-Match", ifNoneMatch)
+		}
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, r)
+		return w
+	}
+
+	w := get("/v1/books/1", "")
+	require.Equal(t, http.StatusOK, w.Code)
+	etag := w.Header().Get("ETag")
+	require.NotEmpty(t, etag)
+	assert.Equal(t, "private, max-age=30", w.Header().Get("Cache-Control"))
+
+	w = get("/v1/books/1", `"other", W/`+etag)
+	assert.Equal(t, http.StatusNotModified, w.Code)
+	assert.Empty(t, w.Body.Bytes())
+	assert.Equal(t, etag, w.Header().Get("ETag"))
+
+	value = "changed"
+	w = get("/v1/books/1", etag)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.NotEqual(t, etag, w.Header().Get("ETag"))
+
+	w = get("/v1/authors/1", "*")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Empty(t, w.Header().Get("ETag"))
+}
@@ -0,0 +1,63 @@
+// Copyright 2022 The codesjoy Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rest
+
+import (
+	"fmt"
+
+	statuspb "google.golang.org/genproto/googleapis/rpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+
+	"github.com/codesjoy/yggdrasil/v3/rpc/status"
+	"github.com/codesjoy/yggdrasil/v3/transport/support/marshaler"
+)
+
+// Error body formats of the REST server.
+const (
+	// ErrorFormatStatus renders errors as google.rpc.Status with the
+	// negotiated marshaler. It is the default.
+	ErrorFormatStatus = "status"
+	// ErrorFormatGRPCGateway renders errors as the JSON body of grpc-gateway,
+	// {"code":5,"message":"...","details":[...]}, regardless of the
+	// negotiated codec and jsonpb options.
+	ErrorFormatGRPCGateway = "grpc_gateway"
+)
+
+// grpcGatewayErrorOptions mirror the default marshaler of grpc-gateway, so
+// details are emitted as protojson Any with every field populated.
+var grpcGatewayErrorOptions = protojson.MarshalOptions{EmitUnpopulated: true}
+
+func validateErrorFormat(format string) error {
+	switch format {
+	case "", ErrorFormatStatus, ErrorFormatGRPCGateway:
+		return nil
+	default:
+		return fmt.Errorf("unknown rest error format %q", format)
+	}
+}
+
+// marshalError encodes the error body in the configured format and returns
+// it with its content type.
+func (s *ServeMux) marshalError(
+	outbound marshaler.Marshaler,
+	pb *statuspb.Status,
+) (string, []byte, error) {
+	if s.cfg != nil && s.cfg.ErrorFormat == ErrorFormatGRPCGateway {
+		buf, err := status.EncodeJSON(grpcGatewayErrorOptions, pb)
+		return marshaler.ContentTypeJSON, buf, err
+	}
+	buf, err := outbound.Marshal(pb)
+	return outbound.ContentType(pb), buf, err
+}
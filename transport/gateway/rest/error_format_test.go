@@ -0,0 +1,82 @@
+// Copyright 2022 The codesjoy Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rest
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/genproto/googleapis/rpc/code"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+
+	"github.com/codesjoy/yggdrasil/v3/rpc/status"
+	"github.com/codesjoy/yggdrasil/v3/transport/support/marshaler"
+)
+
+func newErrorFormatMux(t *testing.T, cfg *Config) *ServeMux {
+	t.Helper()
+	reg := marshaler.BuildMarshalerRegistry("jsonpb", "proto")
+	s, err := NewServer(cfg, WithMarshalerRegistry(reg))
+	require.NoError(t, err)
+	mux := s.(*ServeMux)
+	mux.RPCHandle(http.MethodGet, "/missing",
+		func(http.ResponseWriter, *http.Request) (interface{}, error) {
+			return nil, status.New(code.Code_NOT_FOUND, "shelf not found").
+				WithDetails(&errdetails.ErrorInfo{Reason: "SHELF_MISSING"}).Err()
+		})
+	return mux
+}
+
+func TestServeMux_ErrorFormatGRPCGateway(t *testing.T) {
+	mux := newErrorFormatMux(t, &Config{ErrorFormat: ErrorFormatGRPCGateway})
+
+	r := httptest.NewRequest(http.MethodGet, "/missing", nil)
+	r.Header.Set("Accept", "application/x-protobuf")
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, r)
+
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.Equal(t, marshaler.ContentTypeJSON, w.Header().Get("Content-Type"))
+	assert.JSONEq(t, `{
+		"code": 5,
+		"message": "shelf not found",
+		"details": [{
+			"@type": "type.googleapis.com/google.rpc.ErrorInfo",
+			"reason": "SHELF_MISSING",
+			"domain": "",
+			"metadata": {}
+		}]
+	}`, w.Body.String())
+}
+
+func TestServeMux_ErrorFormatStatus(t *testing.T) {
+	mux := newErrorFormatMux(t, &Config{})
+
+	r := httptest.NewRequest(http.MethodGet, "/missing", nil)
+	r.Header.Set("Accept", "application/x-protobuf")
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, r)
+
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.Equal(t, marshaler.ContentTypeXProtobuf, w.Header().Get("Content-Type"))
+}
+
+func TestNewServer_UnknownErrorFormat(t *testing.T) {
+	_, err := NewServer(&Config{ErrorFormat: "xml"})
+	assert.ErrorContains(t, err, `unknown rest error format "xml"`)
+}
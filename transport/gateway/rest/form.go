@@ -0,0 +1,186 @@
+// Copyright 2022 The codesjoy Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rest
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"strings"
+	"unicode/utf8"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+
+	"github.com/codesjoy/yggdrasil/v3/transport/support/marshaler"
+)
+
+// Form content types decoded into request messages.
+const (
+	ContentTypeMultipart = "multipart/form-data"
+	ContentTypeForm      = "application/x-www-form-urlencoded"
+)
+
+// formMarshaler decodes form bodies into messages: form fields populate
+// the fields named by their (dotted) proto or JSON names, and uploaded
+// files populate bytes or string fields. Responses are left to the
+// negotiated marshaler.
+type formMarshaler struct {
+	marshaler.Marshaler
+	contentType  string
+	maxFileBytes int64
+}
+
+// bindForm replaces the inbound marshaler of form requests.
+func (s *ServeMux) bindForm(ctx context.Context, r *http.Request) context.Context {
+	contentType := r.Header.Get("Content-Type")
+	switch marshaler.NormalizeContentType(contentType) {
+	case ContentTypeMultipart, ContentTypeForm:
+	default:
+		return ctx
+	}
+	var maxFileBytes int64
+	if s.cfg != nil {
+		maxFileBytes = s.cfg.MaxFileBytes
+	}
+	return marshaler.WithInboundContext(ctx, &formMarshaler{
+		Marshaler:    marshaler.OutboundFromContext(ctx),
+		contentType:  contentType,
+		maxFileBytes: maxFileBytes,
+	})
+}
+
+func (m *formMarshaler) Unmarshal(data []byte, v interface{}) error {
+	return m.NewDecoder(bytes.NewReader(data)).Decode(v)
+}
+
+func (m *formMarshaler) NewDecoder(r io.Reader) marshaler.Decoder {
+	return marshaler.DecoderFunc(func(v interface{}) error {
+		msg, ok := v.(proto.Message)
+		if !ok {
+			return errors.New("unable to decode form into non proto value")
+		}
+		mediaType, params, err := mime.ParseMediaType(m.contentType)
+		if err != nil {
+			return err
+		}
+		if mediaType == ContentTypeForm {
+			body, err := io.ReadAll(r)
+			if err != nil {
+				return err
+			}
+			values, err := url.ParseQuery(string(body))
+			if err != nil {
+				return err
+			}
+			return PopulateQueryParameters(msg, values)
+		}
+		return m.decodeMultipart(multipart.NewReader(r, params["boundary"]), msg)
+	})
+}
+
+func (m *formMarshaler) decodeMultipart(mr *multipart.Reader, msg proto.Message) error {
+	values := url.Values{}
+	for {
+		part, err := mr.NextPart()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		name := part.FormName()
+		if name == "" {
+			continue
+		}
+		data, err := m.readPart(part)
+		if err != nil {
+			return err
+		}
+		if part.FileName() == "" {
+			values.Add(name, string(data))
+			continue
+		}
+		if err := setFileField(msg.ProtoReflect(), strings.Split(name, "."), data); err != nil {
+			return err
+		}
+	}
+	return PopulateQueryParameters(msg, values)
+}
+
+// readPart reads a part, failing with *http.MaxBytesError once it exceeds
+// the file size cap.
+func (m *formMarshaler) readPart(part *multipart.Part) ([]byte, error) {
+	if m.maxFileBytes <= 0 {
+		return io.ReadAll(part)
+	}
+	data, err := io.ReadAll(io.LimitReader(part, m.maxFileBytes+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > m.maxFileBytes {
+		return nil, &http.MaxBytesError{Limit: m.maxFileBytes}
+	}
+	return data, nil
+}
+
+// setFileField stores an uploaded file in the bytes or string field at
+// fieldPath. Files for unknown fields are dropped.
+func setFileField(v protoreflect.Message, fieldPath []string, data []byte) error {
+	var fd protoreflect.FieldDescriptor
+	for i, fieldName := range fieldPath {
+		fields := v.Descriptor().Fields()
+		if fd = fields.ByName(protoreflect.Name(fieldName)); fd == nil {
+			if fd = fields.ByJSONName(fieldName); fd == nil {
+				return nil
+			}
+		}
+		if i == len(fieldPath)-1 {
+			break
+		}
+		if fd.Message() == nil || fd.Cardinality() == protoreflect.Repeated {
+			return fmt.Errorf("invalid path: %q is not a message", fieldName)
+		}
+		v = v.Mutable(fd).Message()
+	}
+
+	var value protoreflect.Value
+	switch fd.Kind() {
+	case protoreflect.BytesKind:
+		value = protoreflect.ValueOfBytes(data)
+	case protoreflect.StringKind:
+		if !utf8.Valid(data) {
+			return fmt.Errorf("file for field %q is not valid UTF-8", fd.FullName().Name())
+		}
+		value = protoreflect.ValueOfString(string(data))
+	default:
+		return fmt.Errorf("field %q cannot hold a file", fd.FullName().Name())
+	}
+	switch {
+	case fd.IsList():
+		v.Mutable(fd).List().Append(value)
+	case fd.IsMap():
+		return fmt.Errorf("field %q cannot hold a file", fd.FullName().Name())
+	default:
+		v.Set(fd, value)
+	}
+	return nil
+}
@@ -0,0 +1,116 @@
+// Copyright 2022 The codesjoy Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rest
+
+import (
+	"bytes"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/genproto/googleapis/rpc/code"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/types/descriptorpb"
+
+	"github.com/codesjoy/pkg/basic/xerror"
+
+	"github.com/codesjoy/yggdrasil/v3/transport/support/marshaler"
+)
+
+func newFormTestMux(t *testing.T, cfg *Config) (*ServeMux, *descriptorpb.UninterpretedOption) {
+	t.Helper()
+	s, err := NewServer(cfg)
+	require.NoError(t, err)
+	mux := s.(*ServeMux)
+	got := &descriptorpb.UninterpretedOption{}
+	mux.RPCHandle(http.MethodPost, "/upload",
+		func(_ http.ResponseWriter, r *http.Request) (interface{}, error) {
+			inbound := marshaler.InboundFromContext(r.Context())
+			if err := inbound.NewDecoder(r.Body).Decode(got); err != nil && err != io.EOF {
+				return nil, xerror.Wrap(err, code.Code_INVALID_ARGUMENT, "")
+			}
+			return got, nil
+		})
+	return mux, got
+}
+
+func multipartBody(t *testing.T, fields map[string]string, file string) (string, *bytes.Buffer) {
+	t.Helper()
+	buf := &bytes.Buffer{}
+	mw := multipart.NewWriter(buf)
+	for name, value := range fields {
+		require.NoError(t, mw.WriteField(name, value))
+	}
+	fw, err := mw.CreateFormFile("string_value", "payload.bin")
+	require.NoError(t, err)
+	_, err = io.WriteString(fw, file)
+	require.NoError(t, err)
+	require.NoError(t, mw.Close())
+	return mw.FormDataContentType(), buf
+}
+
+func TestServeMux_MultipartForm(t *testing.T) {
+	mux, got := newFormTestMux(t, &Config{MaxFileBytes: 16})
+
+	contentType, body := multipartBody(t, map[string]string{
+		"identifierValue":    "upload",
+		"positive_int_value": "7",
+	}, "\x00\x01binary")
+	r := httptest.NewRequest(http.MethodPost, "/upload", body)
+	r.Header.Set("Content-Type", contentType)
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, r)
+
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Contains(t, w.Header().Get("Content-Type"), "application/json")
+	assert.Equal(t, "upload", got.GetIdentifierValue())
+	assert.Equal(t, uint64(7), got.GetPositiveIntValue())
+	assert.Equal(t, []byte("\x00\x01binary"), got.GetStringValue())
+
+	resp := &descriptorpb.UninterpretedOption{}
+	require.NoError(t, protojson.Unmarshal(w.Body.Bytes(), resp))
+	assert.Equal(t, "upload", resp.GetIdentifierValue())
+}
+
+func TestServeMux_MultipartFileTooLarge(t *testing.T) {
+	mux, _ := newFormTestMux(t, &Config{MaxFileBytes: 4})
+
+	contentType, body := multipartBody(t, nil, "too large")
+	r := httptest.NewRequest(http.MethodPost, "/upload", body)
+	r.Header.Set("Content-Type", contentType)
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, r)
+	assert.Equal(t, http.StatusRequestEntityTooLarge, w.Code)
+}
+
+func TestServeMux_URLEncodedForm(t *testing.T) {
+	mux, got := newFormTestMux(t, &Config{})
+
+	form := url.Values{"identifier_value": {"form"}, "double_value": {"1.5"}}
+	r := httptest.NewRequest(http.MethodPost, "/upload", strings.NewReader(form.Encode()))
+	r.Header.Set("Content-Type", ContentTypeForm)
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, r)
+
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Equal(t, "form", got.GetIdentifierValue())
+	assert.Equal(t, 1.5, got.GetDoubleValue())
+}
@@ -0,0 +1,184 @@
+// Copyright 2022 The codesjoy Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rest
+
+import (
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+
+	"google.golang.org/genproto/googleapis/rpc/code"
+
+	"github.com/codesjoy/yggdrasil/v3/rpc/status"
+)
+
+// RouteLimit overrides the request limits of the RPC routes matching Method
+// and Path. Zero fields inherit the server wide limits.
+type RouteLimit struct {
+	// Method is the HTTP method; empty matches every method.
+	Method string `mapstructure:"method"`
+	// Path is a route pattern as registered, or a path.Match glob over
+	// registered patterns.
+	Path string `mapstructure:"path"`
+	// MaxBodyBytes bounds the request body; larger bodies fail with 413.
+	MaxBodyBytes int64 `mapstructure:"max_body_bytes"`
+	// BodyTimeout bounds reading the request body; slower clients fail
+	// with 408.
+	BodyTimeout time.Duration `mapstructure:"body_timeout"`
+	// MaxInFlight bounds the concurrent requests of the route; excess
+	// requests fail with 503.
+	MaxInFlight int `mapstructure:"max_in_flight"`
+}
+
+type requestLimits struct {
+	maxBodyBytes int64
+	bodyTimeout  time.Duration
+	inFlight     chan struct{}
+}
+
+// requestLimits returns the limits applied to the RPC route.
+func (s *ServeMux) requestLimits(meth, pattern string) requestLimits {
+	l := requestLimits{}
+	if s.cfg == nil {
+		return l
+	}
+	l.maxBodyBytes = s.cfg.MaxBodyBytes
+	for _, route := range s.cfg.RouteLimits {
+		if route.Method != "" && !strings.EqualFold(route.Method, meth) {
+			continue
+		}
+		if ok, _ := path.Match(route.Path, pattern); !ok && route.Path != pattern {
+			continue
+		}
+		if route.MaxBodyBytes != 0 {
+			l.maxBodyBytes = route.MaxBodyBytes
+		}
+		l.bodyTimeout = route.BodyTimeout
+		if route.MaxInFlight > 0 {
+			l.inFlight = make(chan struct{}, route.MaxInFlight)
+		}
+		break
+	}
+	return l
+}
+
+// acquire reserves an in-flight slot, reporting false when the route is
+// saturated.
+func (l requestLimits) acquire() bool {
+	if l.inFlight == nil {
+		return true
+	}
+	select {
+	case l.inFlight <- struct{}{}:
+		return true
+	default:
+		return false
+	}
+}
+
+func (l requestLimits) release() {
+	if l.inFlight != nil {
+		<-l.inFlight
+	}
+}
+
+// wrapBody applies the body limits to r and returns the body recording
+// limit violations.
+func (l requestLimits) wrapBody(w http.ResponseWriter, r *http.Request) *limitedBody {
+	if l.bodyTimeout > 0 {
+		_ = http.NewResponseController(w).SetReadDeadline(time.Now().Add(l.bodyTimeout))
+	}
+	if r.Body == nil || r.Body == http.NoBody {
+		return nil
+	}
+	body := r.Body
+	if l.maxBodyBytes > 0 {
+		body = http.MaxBytesReader(w, body, l.maxBodyBytes)
+	}
+	lb := &limitedBody{ReadCloser: body}
+	r.Body = lb
+	return lb
+}
+
+// limitedBody remembers why reading the body failed, since handlers wrap
+// decoding errors as INVALID_ARGUMENT.
+type limitedBody struct {
+	io.ReadCloser
+	err *status.Status
+}
+
+func (b *limitedBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if err != nil && b.err == nil {
+		b.err = bodyReadStatus(err)
+	}
+	return n, err
+}
+
+// violation returns the status replacing the handler error, or nil.
+func (b *limitedBody) violation() *status.Status {
+	if b == nil {
+		return nil
+	}
+	return b.err
+}
+
+func bodyReadStatus(err error) *status.Status {
+	if st := bodyTooLargeStatus(err); st != nil {
+		return st
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return status.New(code.Code_DEADLINE_EXCEEDED, "request body read timeout").
+			WithHTTPCode(http.StatusRequestTimeout)
+	}
+	return nil
+}
+
+// bodyTooLargeStatus maps a *http.MaxBytesError anywhere in the chain of
+// err to 413.
+func bodyTooLargeStatus(err error) *status.Status {
+	var tooLarge *http.MaxBytesError
+	if !errors.As(err, &tooLarge) {
+		return nil
+	}
+	return status.New(code.Code_RESOURCE_EXHAUSTED, "request body too large").
+		WithHTTPCode(http.StatusRequestEntityTooLarge)
+}
+
+// inFlightMiddleware rejects requests with 503 once max requests are in
+// flight on the server.
+func (s *ServeMux) inFlightMiddleware(max int) func(http.Handler) http.Handler {
+	slots := make(chan struct{}, max)
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			select {
+			case slots <- struct{}{}:
+				defer func() { <-slots }()
+				next.ServeHTTP(w, r)
+			default:
+				s.errorHandler(w, r, errTooManyRequests())
+			}
+		})
+	}
+}
+
+func errTooManyRequests() error {
+	return status.New(code.Code_UNAVAILABLE, "too many in-flight requests").Err()
+}
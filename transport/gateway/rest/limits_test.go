@@ -0,0 +1,148 @@
+// Copyright 2022 The codesjoy Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rest
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/genproto/googleapis/rpc/code"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+
+	"github.com/codesjoy/yggdrasil/v3/rpc/status"
+)
+
+// decodingHandler reads the body the way generated handlers do, hiding the
+// read error behind INVALID_ARGUMENT.
+func decodingHandler(_ http.ResponseWriter, r *http.Request) (interface{}, error) {
+	if _, err := io.ReadAll(r.Body); err != nil {
+		return nil, status.New(code.Code_INVALID_ARGUMENT, err.Error()).Err()
+	}
+	return wrapperspb.String("ok"), nil
+}
+
+func TestServeMux_MaxBodyBytes(t *testing.T) {
+	cfg := &Config{MaxBodyBytes: 8}
+	cfg.RouteLimits = []RouteLimit{{Method: http.MethodPost, Path: "/upload", MaxBodyBytes: 64}}
+	s, err := NewServer(cfg)
+	require.NoError(t, err)
+	mux := s.(*ServeMux)
+	mux.RPCHandle(http.MethodPost, "/small", decodingHandler)
+	mux.RPCHandle(http.MethodPost, "/upload", decodingHandler)
+
+	post := func(path, body string) int {
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, httptest.NewRequest(http.MethodPost, path, strings.NewReader(body)))
+		return w.Code
+	}
+	assert.Equal(t, http.StatusOK, post("/small", "12345678"))
+	assert.Equal(t, http.StatusRequestEntityTooLarge, post("/small", "123456789"))
+	assert.Equal(t, http.StatusOK, post("/upload", strings.Repeat("x", 64)))
+	assert.Equal(t, http.StatusRequestEntityTooLarge, post("/upload", strings.Repeat("x", 65)))
+}
+
+func TestServeMux_MaxInFlight(t *testing.T) {
+	cfg := &Config{}
+	cfg.RouteLimits = []RouteLimit{{Path: "/slow", MaxInFlight: 1}}
+	s, err := NewServer(cfg)
+	require.NoError(t, err)
+	mux := s.(*ServeMux)
+
+	entered := make(chan struct{})
+	unblock := make(chan struct{})
+	mux.RPCHandle(http.MethodGet, "/slow",
+		func(http.ResponseWriter, *http.Request) (interface{}, error) {
+			close(entered)
+			<-unblock
+			return wrapperspb.String("ok"), nil
+		})
+
+	done := make(chan int)
+	go func() {
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/slow", nil))
+		done <- w.Code
+	}()
+	<-entered
+
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/slow", nil))
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+
+	close(unblock)
+	assert.Equal(t, http.StatusOK, <-done)
+}
+
+func TestServeMux_GlobalMaxInFlight(t *testing.T) {
+	s, err := NewServer(&Config{MaxInFlight: 1})
+	require.NoError(t, err)
+	mux := s.(*ServeMux)
+
+	entered := make(chan struct{})
+	unblock := make(chan struct{})
+	mux.RawHandle(http.MethodGet, "/raw", func(w http.ResponseWriter, _ *http.Request) {
+		close(entered)
+		<-unblock
+	})
+	mux.RPCHandle(http.MethodGet, "/rpc",
+		func(http.ResponseWriter, *http.Request) (interface{}, error) {
+			return wrapperspb.String("ok"), nil
+		})
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		mux.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/raw", nil))
+	}()
+	<-entered
+
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/rpc", nil))
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	close(unblock)
+	<-done
+}
+
+func TestServeMux_BodyTimeout(t *testing.T) {
+	cfg := &Config{}
+	cfg.RouteLimits = []RouteLimit{{Path: "/upload", BodyTimeout: 50 * time.Millisecond}}
+	s, err := NewServer(cfg)
+	require.NoError(t, err)
+	mux := s.(*ServeMux)
+	mux.RPCHandle(http.MethodPost, "/upload", decodingHandler)
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+
+	conn, err := net.Dial("tcp", ts.Listener.Addr().String())
+	require.NoError(t, err)
+	defer func() { _ = conn.Close() }()
+	_, err = io.WriteString(conn, "POST /upload HTTP/1.1\r\nHost: test\r\n"+
+		"Content-Type: application/json\r\nContent-Length: 10\r\n\r\n{")
+	require.NoError(t, err)
+
+	require.NoError(t, conn.SetReadDeadline(time.Now().Add(5*time.Second)))
+	resp, err := http.ReadResponse(bufio.NewReader(conn), nil)
+	require.NoError(t, err)
+	defer func() { _ = resp.Body.Close() }()
+	assert.Equal(t, http.StatusRequestTimeout, resp.StatusCode)
+}
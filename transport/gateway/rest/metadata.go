@@ -21,3 +21,23 @@ const MetadataHeaderPrefix = "Yggdrasil-Metadata-"
 // MetadataTrailerPrefix is prepended to RPC metadata as it is converted to
 // HTTP headers in a response handled by rest
 const MetadataTrailerPrefix = "Yggdrasil-Trailer-"
+
+// IdempotencyKeyHeader is forwarded to the RPC as "idempotency-key" metadata
+// so retried requests can be recognized by the idempotency interceptor.
+const IdempotencyKeyHeader = "Idempotency-Key"
+
+// AcceptLanguageHeader is forwarded to the RPC as "accept-language" metadata
+// so handlers and the i18n interceptor can negotiate a locale.
+const AcceptLanguageHeader = "Accept-Language"
+
+// BaggageHeader is forwarded to the RPC as "baggage" metadata so the W3C
+// baggage of HTTP callers is restored by the baggage interceptor.
+const BaggageHeader = "Baggage"
+
+// TraceparentHeader and TracestateHeader carry the W3C trace context of
+// HTTP callers. They are forwarded to the RPC as metadata of the same name
+// and extracted into the request context by the trace propagator.
+const (
+	TraceparentHeader = "Traceparent"
+	TracestateHeader  = "Tracestate"
+)
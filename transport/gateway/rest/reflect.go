@@ -20,28 +20,46 @@ import (
 	"fmt"
 	"log/slog"
 	"net/url"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
+	"unicode"
 
 	"google.golang.org/genproto/protobuf/field_mask"
 	"google.golang.org/protobuf/proto"
 	"google.golang.org/protobuf/reflect/protoreflect"
-	"google.golang.org/protobuf/reflect/protoregistry"
 	"google.golang.org/protobuf/types/known/durationpb"
 	"google.golang.org/protobuf/types/known/timestamppb"
 	"google.golang.org/protobuf/types/known/wrapperspb"
+
+	"github.com/codesjoy/yggdrasil/v3/rpc/status"
 )
 
-// PopulateQueryParameters parses query parameters
-// into "msg" using current query parser
+// PopulateQueryParameters parses query parameters into "msg".
+//
+// Keys are dot-separated field paths using proto or JSON field names.
+// Repeated fields take every value of their key (?id=1&id=2), and map
+// entries are addressed as labels[key]=value or labels.key=value. Every
+// malformed parameter is reported: the returned INVALID_ARGUMENT status
+// carries one BadRequest field violation per bad key.
 func PopulateQueryParameters(msg proto.Message, values url.Values) error {
-	for key, value := range values {
-		if err := populateFieldValues(msg.ProtoReflect(), strings.Split(key, "."), value); err != nil {
-			return err
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	violations := status.NewBadRequest()
+	for _, key := range keys {
+		fieldPath, err := splitQueryKey(key)
+		if err == nil {
+			err = populateFieldValues(msg.ProtoReflect(), fieldPath, values[key])
+		}
+		if err != nil {
+			violations.Field(key, err.Error())
 		}
 	}
-	return nil
+	return violations.Err("invalid query parameters")
 }
 
 // PopulateFieldFromPath sets a value in a nested Protobuf structure.
@@ -50,6 +68,44 @@ func PopulateFieldFromPath(msg proto.Message, fieldPathString string, value stri
 	return populateFieldValues(msg.ProtoReflect(), fieldPath, []string{value})
 }
 
+// splitQueryKey splits a query key into its path segments. A bracketed
+// segment, as in labels[key], is taken verbatim so map keys may contain
+// dots.
+func splitQueryKey(key string) ([]string, error) {
+	if !strings.Contains(key, "[") {
+		return strings.Split(key, "."), nil
+	}
+	var segments []string
+	for rest := key; rest != ""; {
+		i := strings.IndexAny(rest, ".[")
+		switch {
+		case i < 0:
+			return append(segments, rest), nil
+		case rest[i] == '.':
+			segments = append(segments, rest[:i])
+			rest = rest[i+1:]
+			continue
+		case i > 0:
+			segments = append(segments, rest[:i])
+		case len(segments) == 0:
+			return nil, fmt.Errorf("missing field name before %q", "[")
+		}
+		end := strings.IndexByte(rest[i:], ']')
+		if end < 0 {
+			return nil, fmt.Errorf("missing %q", "]")
+		}
+		segments = append(segments, rest[i+1:i+end])
+		rest = rest[i+end+1:]
+		switch {
+		case strings.HasPrefix(rest, "."):
+			rest = rest[1:]
+		case rest != "" && rest[0] != '[':
+			return nil, fmt.Errorf("unexpected %q after %q", rest[0], "]")
+		}
+	}
+	return segments, nil
+}
+
 func populateFieldValues(v protoreflect.Message, fieldPath []string, values []string) error {
 	if len(fieldPath) < 1 {
 		return errors.New("no field path")
@@ -58,7 +114,8 @@ func populateFieldValues(v protoreflect.Message, fieldPath []string, values []st
 		return errors.New("no value provided")
 	}
 	var fd protoreflect.FieldDescriptor
-	for i, fieldName := range fieldPath {
+	for i := 0; i < len(fieldPath); i++ {
+		fieldName := fieldPath[i]
 		fields := v.Descriptor().Fields()
 
 		if fd = fields.ByName(protoreflect.Name(fieldName)); fd == nil {
@@ -79,6 +136,10 @@ func populateFieldValues(v protoreflect.Message, fieldPath []string, values []st
 			break
 		}
 
+		if fd.IsMap() {
+			return populateMapEntry(fd, v.Mutable(fd).Map(), fieldPath[i+1:], values)
+		}
+
 		if fd.Message() == nil || fd.Cardinality() == protoreflect.Repeated {
 			return fmt.Errorf("invalid path: %q is not a message", fieldName)
 		}
@@ -106,11 +167,54 @@ func populateFieldValues(v protoreflect.Message, fieldPath []string, values []st
 	return populateField(fd, v, values[0])
 }
 
+// populateMapEntry sets the entry of map field fd keyed by the first
+// element of path. Further elements address fields of a message value.
+func populateMapEntry(
+	fd protoreflect.FieldDescriptor,
+	mp protoreflect.Map,
+	path []string,
+	values []string,
+) error {
+	key, err := parseField(fd.MapKey(), path[0])
+	if err != nil {
+		return fmt.Errorf("parsing map key %q: %w", fd.FullName().Name(), err)
+	}
+	if len(path) > 1 {
+		if fd.MapValue().Message() == nil {
+			return fmt.Errorf("invalid path: %q values are not messages", fd.FullName().Name())
+		}
+		return populateFieldValues(mp.Mutable(key.MapKey()).Message(), path[1:], values)
+	}
+	if len(values) != 1 {
+		return fmt.Errorf(
+			"too many values for key %q in map %q: %s",
+			path[0],
+			fd.FullName().Name(),
+			strings.Join(values, ", "),
+		)
+	}
+	value, err := parseField(fd.MapValue(), values[0])
+	if err != nil {
+		return fmt.Errorf("parsing map value %q: %w", fd.FullName().Name(), err)
+	}
+	if !value.IsValid() {
+		mp.Clear(key.MapKey())
+		return nil
+	}
+	mp.Set(key.MapKey(), value)
+	return nil
+}
+
 func populateField(fd protoreflect.FieldDescriptor, v protoreflect.Message, value string) error {
 	val, err := parseField(fd, value)
 	if err != nil {
 		return fmt.Errorf("parsing field %q: %w", fd.FullName().Name(), err)
 	}
+	if !val.IsValid() {
+		// "null" well-known type.
+		v.Clear(fd)
+		return nil
+	}
 	v.Set(fd, val)
 	return nil
 }
@@ -125,6 +229,9 @@ func populateRepeatedField(
 		if err != nil {
 			return fmt.Errorf("parsing list %q: %w", fd.FullName().Name(), err)
 		}
+		if !v.IsValid() {
+			return fmt.Errorf("parsing list %q: null element", fd.FullName().Name())
+		}
 		list.Append(v)
 	}
 	return nil
@@ -159,23 +266,14 @@ func parseField(fd protoreflect.FieldDescriptor, value string) (protoreflect.Val
 		}
 		return protoreflect.ValueOfBool(v), nil
 	case protoreflect.EnumKind:
-		enum, err := protoregistry.GlobalTypes.FindEnumByName(fd.Enum().FullName())
-		switch {
-		case errors.Is(err, protoregistry.NotFound):
-			return protoreflect.Value{}, fmt.Errorf(
-				"enum %q is not registered",
-				fd.Enum().FullName(),
-			)
-		case err != nil:
-			return protoreflect.Value{}, fmt.Errorf("failed to look up enum: %w", err)
-		}
-		v := enum.Descriptor().Values().ByName(protoreflect.Name(value))
+		values := fd.Enum().Values()
+		v := values.ByName(protoreflect.Name(value))
 		if v == nil {
 			i, err := strconv.ParseInt(value, 10, 32)
 			if err != nil {
 				return protoreflect.Value{}, fmt.Errorf("%q is not a valid value", value)
 			}
-			v = enum.Descriptor().Values().ByNumber(protoreflect.EnumNumber(i))
+			v = values.ByNumber(protoreflect.EnumNumber(i))
 			if v == nil {
 				return protoreflect.Value{}, fmt.Errorf("%q is not a valid value", value)
 			}
@@ -237,7 +335,7 @@ func parseMessage(md protoreflect.MessageDescriptor, value string) (protoreflect
 	switch md.FullName() {
 	case "google.protobuf.Timestamp":
 		if value == "null" {
-			break
+			return protoreflect.Value{}, nil
 		}
 		t, err := time.Parse(time.RFC3339Nano, value)
 		if err != nil {
@@ -246,7 +344,7 @@ func parseMessage(md protoreflect.MessageDescriptor, value string) (protoreflect
 		msg = timestamppb.New(t)
 	case "google.protobuf.Duration":
 		if value == "null" {
-			break
+			return protoreflect.Value{}, nil
 		}
 		d, err := time.ParseDuration(value)
 		if err != nil {
@@ -305,7 +403,11 @@ func parseMessage(md protoreflect.MessageDescriptor, value string) (protoreflect
 		msg = wrapperspb.Bytes(v)
 	case "google.protobuf.FieldMask":
 		fm := &field_mask.FieldMask{}
-		fm.Paths = append(fm.Paths, strings.Split(value, ",")...)
+		for _, path := range strings.Split(value, ",") {
+			if path = strings.TrimSpace(path); path != "" {
+				fm.Paths = append(fm.Paths, snakeCase(path))
+			}
+		}
 		msg = fm
 	default:
 		return protoreflect.Value{}, fmt.Errorf(
@@ -315,3 +417,17 @@ func parseMessage(md protoreflect.MessageDescriptor, value string) (protoreflect
 	}
 	return protoreflect.ValueOfMessage(msg.ProtoReflect()), nil
 }
+
+// snakeCase converts the lowerCamelCase segments of a JSON field mask path,
+// as in "displayName.givenName", to proto field names.
+func snakeCase(path string) string {
+	var b strings.Builder
+	for _, r := range path {
+		if unicode.IsUpper(r) {
+			b.WriteByte('_')
+			r = unicode.ToLower(r)
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
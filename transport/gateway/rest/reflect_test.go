@@ -17,15 +17,25 @@ package rest
 import (
 	"net/url"
 	"testing"
+	"time"
 
+	"github.com/codesjoy/pkg/basic/xerror"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"google.golang.org/genproto/googleapis/rpc/code"
 	"google.golang.org/genproto/protobuf/field_mask"
 	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
 	"google.golang.org/protobuf/types/known/durationpb"
 	"google.golang.org/protobuf/types/known/structpb"
 	"google.golang.org/protobuf/types/known/timestamppb"
 	"google.golang.org/protobuf/types/known/wrapperspb"
+
+	"github.com/codesjoy/yggdrasil/v3/rpc/status"
 )
 
 func TestParseField_Uint32(t *testing.T) {
@@ -562,3 +572,205 @@ func TestParseMessage_WellKnownTypes(t *testing.T) {
 		})
 	}
 }
+
+// queryTestMessage returns a dynamic message exercising the query binding
+// of repeated, map, enum and well-known type fields.
+func queryTestMessage(t *testing.T) *dynamicpb.Message {
+	t.Helper()
+	field := func(
+		name string,
+		number int32,
+		label descriptorpb.FieldDescriptorProto_Label,
+		typ descriptorpb.FieldDescriptorProto_Type,
+		typeName string,
+	) *descriptorpb.FieldDescriptorProto {
+		f := &descriptorpb.FieldDescriptorProto{
+			Name:   proto.String(name),
+			Number: proto.Int32(number),
+			Label:  label.Enum(),
+			Type:   typ.Enum(),
+		}
+		if typeName != "" {
+			f.TypeName = proto.String(typeName)
+		}
+		return f
+	}
+	const (
+		optional = descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL
+		repeated = descriptorpb.FieldDescriptorProto_LABEL_REPEATED
+		message  = descriptorpb.FieldDescriptorProto_TYPE_MESSAGE
+		str      = descriptorpb.FieldDescriptorProto_TYPE_STRING
+	)
+	fd := &descriptorpb.FileDescriptorProto{
+		Name:    proto.String("rest/query_test.proto"),
+		Package: proto.String("rest.test"),
+		Syntax:  proto.String("proto3"),
+		Dependency: []string{
+			"google/protobuf/duration.proto",
+			"google/protobuf/field_mask.proto",
+			"google/protobuf/timestamp.proto",
+			"google/protobuf/wrappers.proto",
+		},
+		EnumType: []*descriptorpb.EnumDescriptorProto{{
+			Name: proto.String("State"),
+			Value: []*descriptorpb.EnumValueDescriptorProto{
+				{Name: proto.String("STATE_UNSPECIFIED"), Number: proto.Int32(0)},
+				{Name: proto.String("STATE_ACTIVE"), Number: proto.Int32(1)},
+			},
+		}},
+		MessageType: []*descriptorpb.DescriptorProto{{
+			Name: proto.String("Query"),
+			Field: []*descriptorpb.FieldDescriptorProto{
+				field("ids", 1, repeated, descriptorpb.FieldDescriptorProto_TYPE_INT64, ""),
+				field("labels", 2, repeated, message, ".rest.test.Query.LabelsEntry"),
+				field("state", 3, optional, descriptorpb.FieldDescriptorProto_TYPE_ENUM,
+					".rest.test.State"),
+				field("start_time", 4, optional, message, ".google.protobuf.Timestamp"),
+				field("ttl", 5, optional, message, ".google.protobuf.Duration"),
+				field("update_mask", 6, optional, message, ".google.protobuf.FieldMask"),
+				field("limit", 7, optional, message, ".google.protobuf.Int32Value"),
+				field("children", 8, repeated, message, ".rest.test.Query.ChildrenEntry"),
+				field("name", 9, optional, str, ""),
+			},
+			NestedType: []*descriptorpb.DescriptorProto{
+				{
+					Name: proto.String("LabelsEntry"),
+					Field: []*descriptorpb.FieldDescriptorProto{
+						field("key", 1, optional, str, ""),
+						field("value", 2, optional, str, ""),
+					},
+					Options: &descriptorpb.MessageOptions{MapEntry: proto.Bool(true)},
+				},
+				{
+					Name: proto.String("ChildrenEntry"),
+					Field: []*descriptorpb.FieldDescriptorProto{
+						field("key", 1, optional, str, ""),
+						field("value", 2, optional, message, ".rest.test.Query"),
+					},
+					Options: &descriptorpb.MessageOptions{MapEntry: proto.Bool(true)},
+				},
+			},
+		}},
+	}
+	file, err := protodesc.NewFile(fd, protoregistry.GlobalFiles)
+	require.NoError(t, err)
+	return dynamicpb.NewMessage(file.Messages().ByName("Query"))
+}
+
+func TestPopulateQueryParameters_Typed(t *testing.T) {
+	msg := queryTestMessage(t)
+	values, err := url.ParseQuery(
+		"ids=1&ids=2&labels[env]=prod&labels.team=core&labels[a.b]=dotted" +
+			"&state=STATE_ACTIVE&startTime=2024-01-02T03:04:05Z&ttl=1.5s" +
+			"&update_mask=displayName,labels.teamName&limit=10" +
+			"&children[c1].name=child&children[c1].ids=7",
+	)
+	require.NoError(t, err)
+	require.NoError(t, PopulateQueryParameters(msg, values))
+
+	get := func(m *dynamicpb.Message, name string) protoreflect.Value {
+		return m.Get(m.Descriptor().Fields().ByName(protoreflect.Name(name)))
+	}
+	ids := get(msg, "ids").List()
+	require.Equal(t, 2, ids.Len())
+	assert.Equal(t, int64(1), ids.Get(0).Int())
+	assert.Equal(t, int64(2), ids.Get(1).Int())
+
+	labels := get(msg, "labels").Map()
+	assert.Equal(t, 3, labels.Len())
+	for key, want := range map[string]string{"env": "prod", "team": "core", "a.b": "dotted"} {
+		assert.Equal(t, want, labels.Get(protoreflect.ValueOfString(key).MapKey()).String())
+	}
+
+	assert.Equal(t, protoreflect.EnumNumber(1), get(msg, "state").Enum())
+	assert.True(t, proto.Equal(
+		timestamppb.New(time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)),
+		get(msg, "start_time").Message().Interface(),
+	))
+	assert.True(t, proto.Equal(
+		durationpb.New(1500*time.Millisecond),
+		get(msg, "ttl").Message().Interface(),
+	))
+	assert.True(t, proto.Equal(
+		&field_mask.FieldMask{Paths: []string{"display_name", "labels.team_name"}},
+		get(msg, "update_mask").Message().Interface(),
+	))
+	assert.True(t, proto.Equal(wrapperspb.Int32(10), get(msg, "limit").Message().Interface()))
+
+	child := get(msg, "children").Map().Get(protoreflect.ValueOfString("c1").MapKey()).Message()
+	assert.Equal(t, "child", child.Get(child.Descriptor().Fields().ByName("name")).String())
+	assert.Equal(t, 1, child.Get(child.Descriptor().Fields().ByName("ids")).List().Len())
+}
+
+func TestPopulateQueryParameters_EnumByNumber(t *testing.T) {
+	msg := queryTestMessage(t)
+	require.NoError(t, PopulateQueryParameters(msg, url.Values{"state": {"1"}}))
+	state := msg.Get(msg.Descriptor().Fields().ByName("state"))
+	assert.Equal(t, protoreflect.EnumNumber(1), state.Enum())
+}
+
+func TestPopulateQueryParameters_NullClearsWellKnownType(t *testing.T) {
+	msg := queryTestMessage(t)
+	require.NoError(t, PopulateQueryParameters(msg, url.Values{"ttl": {"1s"}}))
+	require.NoError(t, PopulateQueryParameters(msg, url.Values{"ttl": {"null"}}))
+	assert.False(t, msg.Has(msg.Descriptor().Fields().ByName("ttl")))
+}
+
+func TestPopulateQueryParameters_AggregatesViolations(t *testing.T) {
+	msg := queryTestMessage(t)
+	values := url.Values{
+		"ids":          {"1", "x"},
+		"state":        {"STATE_BOGUS"},
+		"ttl":          {"soon"},
+		"labels[env]":  {"a", "b"},
+		"labels[broke": {"v"},
+		"name":         {"ok"},
+	}
+	err := PopulateQueryParameters(msg, values)
+	require.Error(t, err)
+
+	st, ok := status.CoverError(err)
+	require.True(t, ok)
+	assert.Equal(t, code.Code_INVALID_ARGUMENT, st.Code())
+	br := st.BadRequest()
+	require.NotNil(t, br)
+	var fields []string
+	for _, v := range br.GetFieldViolations() {
+		fields = append(fields, v.GetField())
+		assert.NotEmpty(t, v.GetDescription())
+	}
+	assert.Equal(t, []string{"ids", "labels[broke", "labels[env]", "state", "ttl"}, fields)
+
+	// The BadRequest details survive the wrapping done by generated handlers.
+	st, ok = status.CoverError(xerror.Wrap(err, code.Code_INVALID_ARGUMENT, ""))
+	require.True(t, ok)
+	assert.Len(t, st.BadRequest().GetFieldViolations(), 5)
+}
+
+func TestSplitQueryKey(t *testing.T) {
+	tests := []struct {
+		key     string
+		want    []string
+		wantErr bool
+	}{
+		{key: "a.b.c", want: []string{"a", "b", "c"}},
+		{key: "labels[k]", want: []string{"labels", "k"}},
+		{key: "labels[a.b]", want: []string{"labels", "a.b"}},
+		{key: "m[k].name", want: []string{"m", "k", "name"}},
+		{key: "a.m[k][j]", want: []string{"a", "m", "k", "j"}},
+		{key: "[k]", wantErr: true},
+		{key: "m[k", wantErr: true},
+		{key: "m[k]x", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.key, func(t *testing.T) {
+			got, err := splitQueryKey(tt.key)
+			if tt.wantErr {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
@@ -13,6 +13,21 @@
 // limitations under the License.
 
 // Package rest provides HTTP server for the framework.
+//
+// # Route precedence
+//
+// Requests are matched against route patterns segment by segment from the
+// left. A literal segment wins over a template variable, and a variable
+// wins over a trailing "*" wildcard, so among overlapping routes the one
+// with the longest literal prefix serves the request. RPC routes and raw
+// handlers are matched alike.
+//
+// Two routes with the same method and the same pattern shape, e.g.
+// "/v1/{id}" and "/v1/{name}", are duplicates: the first one registered is
+// kept and the later one is dropped. Routes that match some common path
+// without being duplicates, e.g. "/web" and "/{name}", overlap and are
+// served by precedence. Both are reported as RouteConflicts; with
+// Config.StrictRoutes, Start refuses to serve while any exists.
 package rest
 
 import (
@@ -21,22 +36,30 @@ import (
 	"fmt"
 	"io"
 	"log/slog"
+	"math"
 	"net"
 	"net/http"
+	"path"
 	"strconv"
 	"strings"
 	"sync"
 	"time"
 
 	"github.com/go-chi/chi/v5"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
 	"google.golang.org/genproto/googleapis/rpc/code"
 	"google.golang.org/protobuf/proto"
 
+	"github.com/codesjoy/yggdrasil/v3/config/configdoc"
 	"github.com/codesjoy/yggdrasil/v3/rpc/metadata"
 	"github.com/codesjoy/yggdrasil/v3/rpc/status"
+	"github.com/codesjoy/yggdrasil/v3/transport/support/handoff"
 	"github.com/codesjoy/yggdrasil/v3/transport/support/listenaddr"
 	"github.com/codesjoy/yggdrasil/v3/transport/support/marshaler"
 	"github.com/codesjoy/yggdrasil/v3/transport/support/peer"
+	"github.com/codesjoy/yggdrasil/v3/transport/support/security"
+	"github.com/codesjoy/yggdrasil/v3/transport/support/security/tls"
 )
 
 // Config is the configuration for the server.
@@ -60,8 +83,62 @@ type Config struct {
 		Support []string `mapstructure:"support"`
 		Config  struct {
 			JSONPB *marshaler.JSONPbConfig `mapstructure:"jsonpb"`
+			// Services overrides the jsonpb options per service.
+			Services []ServiceMarshalerConfig `mapstructure:"services"`
 		} `mapstructure:"config"`
 	} `mapstructure:"marshaler"`
+	Cache CacheConfig `mapstructure:"cache"`
+	// MaxBodyBytes bounds RPC request bodies; larger bodies fail with 413.
+	// A negative value removes the limit.
+	MaxBodyBytes int64 `mapstructure:"max_body_bytes" default:"4194304"`
+	// MaxInFlight bounds the requests served concurrently; excess requests
+	// fail with 503. Zero means unlimited.
+	MaxInFlight int `mapstructure:"max_in_flight"`
+	// RouteLimits overrides the request limits of matching RPC routes.
+	RouteLimits []RouteLimit `mapstructure:"route_limits"`
+	// MaxFileBytes bounds each file uploaded in a multipart form; larger
+	// files fail with 413. Zero means unlimited.
+	MaxFileBytes int64 `mapstructure:"max_file_bytes" default:"4194304"`
+	// ErrorFormat selects the error body layout: "status" (default) or
+	// "grpc_gateway".
+	ErrorFormat string `mapstructure:"error_format"`
+	// StrictRoutes refuses to start while registered routes conflict;
+	// otherwise conflicts are logged and resolved by precedence.
+	StrictRoutes bool `mapstructure:"strict_routes"`
+}
+
+// Validate reports the fields holding invalid values, naming their keys.
+func (c *Config) Validate() error {
+	var errs []error
+	if _, err := listenaddr.NormalizeListenHost(c.Host); err != nil {
+		errs = append(errs, fmt.Errorf("host: %w", err))
+	}
+	if c.Port < 0 || c.Port > 65535 {
+		errs = append(errs, fmt.Errorf("port: %d is out of range", c.Port))
+	}
+	nonNegative := func(key string, value int64) {
+		if value < 0 {
+			errs = append(errs, fmt.Errorf("%s: must not be negative", key))
+		}
+	}
+	nonNegative("read_header_timeout", int64(c.ReadHeaderTimeout))
+	nonNegative("read_timeout", int64(c.ReadTimeout))
+	nonNegative("write_timeout", int64(c.WriteTimeout))
+	nonNegative("idle_timeout", int64(c.IdleTimeout))
+	nonNegative("shutdown_timeout", int64(c.ShutdownTimeout))
+	nonNegative("max_in_flight", int64(c.MaxInFlight))
+	nonNegative("max_file_bytes", c.MaxFileBytes)
+	for i, limit := range c.RouteLimits {
+		if _, err := path.Match(limit.Path, ""); err != nil {
+			errs = append(errs, fmt.Errorf("route_limits.%d.path: %w", i, err))
+		}
+		nonNegative(fmt.Sprintf("route_limits.%d.body_timeout", i), int64(limit.BodyTimeout))
+		nonNegative(fmt.Sprintf("route_limits.%d.max_in_flight", i), int64(limit.MaxInFlight))
+	}
+	if err := validateErrorFormat(c.ErrorFormat); err != nil {
+		errs = append(errs, fmt.Errorf("error_format: %w", err))
+	}
+	return errors.Join(errs...)
 }
 
 type serverInfo struct {
@@ -99,6 +176,10 @@ type ServeMux struct {
 
 	marshalerRegistry marshaler.Registry
 	middlewareMap     map[string]Provider
+	propagator        propagation.TextMapPropagator
+
+	routes    []route
+	conflicts []RouteConflict
 }
 
 // Option is the option for the server.
@@ -118,16 +199,28 @@ func WithMiddlewareProviders(providers map[string]Provider) Option {
 	}
 }
 
+// WithPropagator sets the propagator extracting the trace context and
+// baggage of HTTP callers. The global otel propagator is used when unset.
+func WithPropagator(propagator propagation.TextMapPropagator) Option {
+	return func(s *ServeMux) {
+		s.propagator = propagator
+	}
+}
+
 // NewServer creates a new ServeMux from explicit config.
 func NewServer(cfg *Config, opts ...Option) (Server, error) {
 	if cfg == nil {
 		cfg = &Config{}
 	}
 
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
 	host, err := listenaddr.NormalizeListenHost(cfg.Host)
 	if err != nil {
 		return nil, err
 	}
+	slog.Debug("rest server config", slog.Any("config", configdoc.Effective(cfg)))
 	address := fmt.Sprintf("%s:%d", host, cfg.Port)
 
 	s := &ServeMux{
@@ -146,6 +239,9 @@ func NewServer(cfg *Config, opts ...Option) (Server, error) {
 	}
 
 	r := chi.NewMux()
+	if cfg.MaxInFlight > 0 {
+		r.Use(s.inFlightMiddleware(cfg.MaxInFlight))
+	}
 	allMiddlewares := dedupStableStrings(cfg.Middleware.All)
 	if s.middlewareMap != nil {
 		r.Use(BuildWithProviders(s.middlewareMap, allMiddlewares...)...)
@@ -186,23 +282,55 @@ func NewServer(cfg *Config, opts ...Option) (Server, error) {
 
 // RPCHandle registers a new RPC handler.
 func (s *ServeMux) RPCHandle(meth, path string, f HandlerFunc) {
+	s.ServiceRPCHandle("", meth, path, f)
+}
+
+// ServiceRPCHandle registers a new RPC handler of service, applying the
+// service's marshaler options.
+func (s *ServeMux) ServiceRPCHandle(service, meth, path string, f HandlerFunc) {
+	owner := service
+	if owner == "" {
+		owner = "rpc"
+	}
+	if !s.claimRoute(meth, path, owner) {
+		return
+	}
+	jsonpb := s.serviceJSONPb(service)
+	cache := s.cacheRoute(meth, path)
+	limits := s.requestLimits(meth, path)
 	s.rpcRouter.MethodFunc(meth, path, func(w http.ResponseWriter, r *http.Request) {
-		ctx := r.Context()
+		if !limits.acquire() {
+			s.errorHandler(w, r, errTooManyRequests())
+			return
+		}
+		defer limits.release()
+		body := limits.wrapBody(w, r)
+		ctx := withServiceJSONPb(r.Context(), jsonpb)
 		ctx = metadata.WithStreamContext(ctx)
 		ctx = metadata.WithInContext(ctx, s.extractInMetadata(r))
+		ctx = s.extractTraceContext(ctx, r)
 		ctx = peer.WithContext(ctx, s.getPeer(r))
+		ctx = s.bindForm(ctx, r)
 		r = r.WithContext(ctx)
 		res, err := f(w, r)
 		if err != nil {
+			if st := body.violation(); st != nil {
+				err = st
+			} else if st := bodyTooLargeStatus(err); st != nil {
+				err = st
+			}
 			s.errorHandler(w, r, err)
 			return
 		}
-		s.successHandler(w, r, res.(proto.Message))
+		s.writeSuccess(w, r, res.(proto.Message), cache)
 	})
 }
 
 // RawHandle registers a new raw handler.
 func (s *ServeMux) RawHandle(meth, path string, h http.HandlerFunc) {
+	if !s.claimRoute(meth, path, "raw") {
+		return
+	}
 	s.webRouter.MethodFunc(meth, path, h)
 }
 
@@ -216,9 +344,12 @@ func (s *ServeMux) Start() error {
 	if s.started {
 		return errors.New("server had already serve")
 	}
+	if err := s.conflictsErr(); err != nil {
+		return err
+	}
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
-	lis, err := (&net.ListenConfig{}).Listen(ctx, "tcp", s.info.address)
+	lis, err := handoff.Listen(ctx, "tcp", s.info.address)
 	if err != nil {
 		s.started = false
 		s.listener = nil
@@ -263,6 +394,17 @@ func (s *ServeMux) Serve() error {
 	return s.svr.Serve(s.listener)
 }
 
+// ServeListener serves HTTP on an additional listener. It must be called after Start.
+func (s *ServeMux) ServeListener(lis net.Listener) error {
+	s.mu.Lock()
+	svr, started := s.svr, s.started
+	s.mu.Unlock()
+	if !started || svr == nil {
+		return errors.New("server is not initialized")
+	}
+	return svr.Serve(lis)
+}
+
 // Stop stops the server.
 func (s *ServeMux) Stop(ctx context.Context) error {
 	s.mu.Lock()
@@ -302,15 +444,40 @@ func (s *ServeMux) extractInMetadata(r *http.Request) metadata.MD {
 		}
 		md.Append(item, vals...)
 	}
+	for _, item := range []string{
+		IdempotencyKeyHeader, AcceptLanguageHeader, BaggageHeader,
+		TraceparentHeader, TracestateHeader,
+	} {
+		if vals := r.Header.Values(item); vals != nil && md.Get(item) == nil {
+			md.Append(item, vals...)
+		}
+	}
 
 	for key, vals := range r.Header {
-		if strings.HasPrefix(key, MetadataHeaderPrefix) {
-			md.Append(key[len(MetadataHeaderPrefix):], vals...)
+		if !strings.HasPrefix(key, MetadataHeaderPrefix) {
+			continue
+		}
+		key = key[len(MetadataHeaderPrefix):]
+		for _, v := range vals {
+			if decoded, err := metadata.DecodeHeaderValue(key, v); err == nil {
+				md.Append(key, decoded)
+			}
 		}
 	}
 	return md
 }
 
+// extractTraceContext restores the remote span context and baggage of the
+// HTTP caller under the same context keys the gRPC server path uses, so the
+// client stats handlers continue the trace on downstream calls.
+func (s *ServeMux) extractTraceContext(ctx context.Context, r *http.Request) context.Context {
+	propagator := s.propagator
+	if propagator == nil {
+		propagator = otel.GetTextMapPropagator()
+	}
+	return propagator.Extract(ctx, propagation.HeaderCarrier(r.Header))
+}
+
 func (s *ServeMux) getPeer(r *http.Request) *peer.Peer {
 	ip, portStr, _ := net.SplitHostPort(strings.TrimSpace(r.RemoteAddr))
 	port, _ := strconv.Atoi(portStr)
@@ -326,14 +493,22 @@ func (s *ServeMux) getPeer(r *http.Request) *peer.Peer {
 	if s.listener != nil {
 		localAddr = s.listener.Addr()
 	}
-	return &peer.Peer{
+	p := &peer.Peer{
 		Addr: &net.TCPAddr{
 			IP:   net.ParseIP(ip),
 			Port: port,
 		},
 		LocalAddr: localAddr,
 		Protocol:  "http",
+		RemoteIP:  ip,
+	}
+	if r.TLS != nil {
+		p.AuthInfo = tls.AuthInfo{
+			CommonAuthInfo: security.CommonAuthInfo{SecurityLevel: security.PrivacyAndIntegrity},
+			State:          *r.TLS,
+		}
 	}
+	return p
 }
 
 func (s *ServeMux) errorHandler(w http.ResponseWriter, r *http.Request, err error) {
@@ -349,14 +524,16 @@ func (s *ServeMux) errorHandler(w http.ResponseWriter, r *http.Request, err erro
 	w.Header().Del("Trailer")
 	w.Header().Del("Transfer-Encoding")
 
-	contentType := outbound.ContentType(pb)
+	contentType, buf, mErr := s.marshalError(outbound, pb)
 	w.Header().Set("Content-Type", contentType)
 
 	if st.IsCode(code.Code_UNAUTHENTICATED) {
 		w.Header().Set("WWW-Authenticate", st.Message())
 	}
+	if delay, ok := st.RetryDelay(); ok {
+		w.Header().Set("Retry-After", strconv.FormatInt(int64(math.Ceil(delay.Seconds())), 10))
+	}
 
-	buf, mErr := outbound.Marshal(pb)
 	if mErr != nil {
 		slog.Error("failed to marshal error message",
 			slog.String("status", fmt.Sprintf("%q", st)),
@@ -391,6 +568,15 @@ func (s *ServeMux) errorHandler(w http.ResponseWriter, r *http.Request, err erro
 }
 
 func (s *ServeMux) successHandler(w http.ResponseWriter, r *http.Request, resp proto.Message) {
+	s.writeSuccess(w, r, resp, nil)
+}
+
+func (s *ServeMux) writeSuccess(
+	w http.ResponseWriter,
+	r *http.Request,
+	resp proto.Message,
+	cache *CacheRoute,
+) {
 	ctx := r.Context()
 
 	outbound := marshaler.OutboundFromContext(ctx)
@@ -409,6 +595,11 @@ func (s *ServeMux) successHandler(w http.ResponseWriter, r *http.Request, resp p
 
 	s.handleResponseHeader(w, header)
 
+	if cache != nil && writeCacheHeaders(w, r, cache, buf) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
 	doForwardTrailers := s.requestAcceptsTrailers(r)
 
 	if doForwardTrailers && trailerHeader.Len() > 0 {
@@ -429,7 +620,7 @@ func (s *ServeMux) handleResponseHeader(w http.ResponseWriter, md metadata.MD) {
 	for k, vs := range md {
 		if h, ok := s.outgoingHeaderMatcher(k); ok {
 			for _, v := range vs {
-				w.Header().Add(h, v)
+				w.Header().Add(h, metadata.EncodeHeaderValue(k, v))
 			}
 		}
 	}
@@ -461,7 +652,7 @@ func (s *ServeMux) handleForwardResponseTrailer(w http.ResponseWriter, md metada
 	for k, vs := range md {
 		if h, ok := s.outgoingTrailerMatcher(k); ok {
 			for _, v := range vs {
-				w.Header().Add(h, v)
+				w.Header().Add(h, metadata.EncodeHeaderValue(k, v))
 			}
 		}
 	}
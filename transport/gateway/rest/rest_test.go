@@ -16,6 +16,7 @@ package rest
 
 import (
 	"context"
+	stdtls "crypto/tls"
 	"encoding/json"
 	"errors"
 	"io"
@@ -29,13 +30,19 @@ import (
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	otelbaggage "go.opentelemetry.io/otel/baggage"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
 	"google.golang.org/genproto/googleapis/rpc/code"
+	statuspb "google.golang.org/genproto/googleapis/rpc/status"
 
 	"google.golang.org/protobuf/types/known/wrapperspb"
 
 	"github.com/codesjoy/yggdrasil/v3/rpc/metadata"
 	rpcstatus "github.com/codesjoy/yggdrasil/v3/rpc/status"
 	"github.com/codesjoy/yggdrasil/v3/transport/support/marshaler"
+	"github.com/codesjoy/yggdrasil/v3/transport/support/security"
+	"github.com/codesjoy/yggdrasil/v3/transport/support/security/tls"
 )
 
 func TestServeMux_Serve_NotStarted(t *testing.T) {
@@ -412,6 +419,97 @@ func TestServeMux_ExtractInMetadata_MissingAcceptHeader(t *testing.T) {
 	assert.Equal(t, 0, md.Len())
 }
 
+func TestServeMux_ExtractInMetadata_IdempotencyKey(t *testing.T) {
+	mux := &ServeMux{acceptHeaders: []string{"Idempotency-Key"}}
+	r := httptest.NewRequest("POST", "/", nil)
+	r.Header.Set("Idempotency-Key", "key-1")
+	assert.Equal(t, []string{"key-1"}, mux.extractInMetadata(r).Get("idempotency-key"))
+
+	mux = &ServeMux{}
+	assert.Equal(t, []string{"key-1"}, mux.extractInMetadata(r).Get("idempotency-key"))
+}
+
+func TestServeMux_ExtractInMetadata_AcceptLanguage(t *testing.T) {
+	r := httptest.NewRequest("GET", "/", nil)
+	r.Header.Set("Accept-Language", "zh-CN,en;q=0.8")
+	md := (&ServeMux{}).extractInMetadata(r)
+	assert.Equal(t, []string{"zh-CN,en;q=0.8"}, md.Get("accept-language"))
+}
+
+func TestServeMux_ExtractInMetadata_Baggage(t *testing.T) {
+	r := httptest.NewRequest("GET", "/", nil)
+	r.Header.Set("Baggage", "tenant-id=acme")
+	md := (&ServeMux{}).extractInMetadata(r)
+	assert.Equal(t, []string{"tenant-id=acme"}, md.Get("baggage"))
+}
+
+func TestServeMux_ExtractInMetadata_TraceContext(t *testing.T) {
+	r := httptest.NewRequest("GET", "/", nil)
+	r.Header.Set("Traceparent", testTraceparent)
+	r.Header.Set("Tracestate", "vendor=opaque")
+	md := (&ServeMux{}).extractInMetadata(r)
+	assert.Equal(t, []string{testTraceparent}, md.Get("traceparent"))
+	assert.Equal(t, []string{"vendor=opaque"}, md.Get("tracestate"))
+}
+
+const testTraceparent = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+
+func TestServeMux_RPCHandle_ExtractsTraceContext(t *testing.T) {
+	s, err := NewServer(nil, WithPropagator(propagation.NewCompositeTextMapPropagator(
+		propagation.TraceContext{}, propagation.Baggage{},
+	)))
+	require.NoError(t, err)
+	mux := s.(*ServeMux)
+
+	var ctx context.Context
+	mux.RPCHandle(
+		"POST",
+		"/rpc",
+		func(w http.ResponseWriter, r *http.Request) (interface{}, error) {
+			ctx = r.Context()
+			return wrapperspb.String("rpc"), nil
+		},
+	)
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+
+	req, err := http.NewRequest(http.MethodPost, ts.URL+"/rpc", nil)
+	require.NoError(t, err)
+	req.Header.Set("Traceparent", testTraceparent)
+	req.Header.Set("Tracestate", "vendor=opaque")
+	req.Header.Set("Baggage", "tenant-id=acme")
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer func() { _ = resp.Body.Close() }()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	sc := trace.SpanContextFromContext(ctx)
+	assert.True(t, sc.IsRemote())
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", sc.TraceID().String())
+	assert.Equal(t, "00f067aa0ba902b7", sc.SpanID().String())
+	assert.True(t, sc.IsSampled())
+	assert.Equal(t, "vendor=opaque", sc.TraceState().String())
+	assert.Equal(t, "acme", otelbaggage.FromContext(ctx).Member("tenant-id").Value())
+
+	md, ok := metadata.FromInContext(ctx)
+	require.True(t, ok)
+	assert.Equal(t, []string{testTraceparent}, md.Get("traceparent"))
+	assert.Equal(t, []string{"tenant-id=acme"}, md.Get("baggage"))
+}
+
+func TestServeMux_ExtractInMetadata_BinaryValues(t *testing.T) {
+	r := httptest.NewRequest("GET", "/", nil)
+	r.Header.Set(MetadataHeaderPrefix+"Trace-Bin", "AP8")
+	r.Header.Set(MetadataHeaderPrefix+"Bad-Bin", "!!")
+	md := (&ServeMux{}).extractInMetadata(r)
+	assert.Equal(t, [][]byte{{0x00, 0xff}}, md.GetBinary("trace"))
+	assert.Nil(t, md.Get("bad-bin"))
+
+	rec := httptest.NewRecorder()
+	(&ServeMux{}).handleResponseHeader(rec, md)
+	assert.Equal(t, "AP8", rec.Header().Get(MetadataHeaderPrefix+"trace-bin"))
+}
+
 func TestServeMux_GetPeer_XForwardedFor(t *testing.T) {
 	lis, err := net.Listen("tcp", "127.0.0.1:0")
 	require.NoError(t, err)
@@ -442,6 +540,24 @@ func TestServeMux_GetPeer_XRealIP(t *testing.T) {
 	require.NotNil(t, p)
 	assert.Equal(t, "10.0.0.5", p.Addr.(*net.TCPAddr).IP.String())
 	assert.Equal(t, 12345, p.Addr.(*net.TCPAddr).Port)
+	assert.Equal(t, "10.0.0.5", p.RemoteIP)
+	assert.Nil(t, p.AuthInfo)
+}
+
+func TestServeMux_GetPeer_TLS(t *testing.T) {
+	mux := &ServeMux{}
+
+	r := httptest.NewRequest("GET", "https://example.com/", nil)
+	r.RemoteAddr = "192.168.1.1:12345"
+	r.TLS = &stdtls.ConnectionState{ServerName: "example.com"}
+
+	p := mux.getPeer(r)
+	require.NotNil(t, p)
+	info, ok := p.AuthInfo.(tls.AuthInfo)
+	require.True(t, ok)
+	assert.Equal(t, "example.com", info.State.ServerName)
+	assert.Equal(t, security.PrivacyAndIntegrity, info.SecurityLevel)
+	assert.Equal(t, "192.168.1.1", p.RemoteIP)
 }
 
 func TestServeMux_GetPeer_RemoteAddr(t *testing.T) {
@@ -615,6 +731,31 @@ func TestServeMux_ErrorHandler_Unauthenticated(t *testing.T) {
 	assert.NotEmpty(t, w.Header().Get("WWW-Authenticate"))
 }
 
+func TestServeMux_ErrorHandler_DetailsRoundTrip(t *testing.T) {
+	mux := &ServeMux{}
+	m := marshaler.NewJSONPbMarshalerWithConfig(nil)
+	ctx := marshaler.WithOutboundContext(context.Background(), m)
+	r := httptest.NewRequest("POST", "/test", nil).WithContext(ctx)
+	w := httptest.NewRecorder()
+
+	errSt := rpcstatus.New(code.Code_RESOURCE_EXHAUSTED, "slow down").
+		WithRetryInfo(1500 * time.Millisecond).
+		WithQuotaFailure(rpcstatus.QuotaViolation("user:1", "daily quota"))
+	mux.errorHandler(w, r, errSt)
+
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Equal(t, "2", w.Header().Get("Retry-After"))
+
+	pb := &statuspb.Status{}
+	require.NoError(t, m.Unmarshal(w.Body.Bytes(), pb))
+	got := rpcstatus.FromProto(pb)
+	delay, ok := got.RetryDelay()
+	require.True(t, ok)
+	assert.Equal(t, 1500*time.Millisecond, delay)
+	require.NotNil(t, got.QuotaFailure())
+	assert.Equal(t, "user:1", got.QuotaFailure().GetViolations()[0].GetSubject())
+}
+
 func TestServeMux_SuccessHandler(t *testing.T) {
 	mux := &ServeMux{}
 
@@ -697,6 +838,27 @@ func TestNewServer_WithConfig(t *testing.T) {
 	assert.Equal(t, "127.0.0.1:9090", mux.info.address)
 }
 
+func TestConfig_Validate(t *testing.T) {
+	require.NoError(t, (&Config{}).Validate())
+
+	cfg := &Config{
+		Port:        70000,
+		ReadTimeout: -time.Second,
+		MaxInFlight: -1,
+		RouteLimits: []RouteLimit{{Path: "/v1/["}},
+		ErrorFormat: "xml",
+	}
+	err := cfg.Validate()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "port: 70000 is out of range")
+	assert.Contains(t, err.Error(), "read_timeout: must not be negative")
+	assert.Contains(t, err.Error(), "max_in_flight: must not be negative")
+	assert.Contains(t, err.Error(), "route_limits.0.path: ")
+	assert.Contains(t, err.Error(), "error_format: ")
+	_, err = NewServer(cfg)
+	assert.Error(t, err)
+}
+
 func TestNewServer_WithMarshalerRegistry(t *testing.T) {
 	reg := marshaler.BuildMarshalerRegistry("jsonpb")
 	s, err := NewServer(nil, WithMarshalerRegistry(reg))
@@ -0,0 +1,259 @@
+// Copyright 2022 The codesjoy Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package restclient calls services through the routes of their REST
+// gateway. It backs the clients generated by protoc-gen-yggdrasil-rest with
+// the client option, so Go callers outside the RPC network use the same
+// typed API over plain HTTP.
+//
+// Path variables are filled from the request message, the remaining fields
+// not sent as the body are encoded as query parameters, and error bodies
+// are decoded back into *status.Status with their details.
+package restclient
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"google.golang.org/genproto/googleapis/rpc/code"
+	statuspb "google.golang.org/genproto/googleapis/rpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+
+	"github.com/codesjoy/yggdrasil/v3/rpc/metadata"
+	"github.com/codesjoy/yggdrasil/v3/rpc/status"
+	"github.com/codesjoy/yggdrasil/v3/transport/gateway/rest"
+	"github.com/codesjoy/yggdrasil/v3/transport/runtime/client"
+	"github.com/codesjoy/yggdrasil/v3/transport/support/marshaler"
+)
+
+// Client sends requests to one REST gateway.
+type Client struct {
+	base   *url.URL
+	hc     *http.Client
+	header http.Header
+}
+
+// Option configures a Client.
+type Option func(*Client)
+
+// WithHTTPClient sends requests through hc instead of http.DefaultClient.
+func WithHTTPClient(hc *http.Client) Option {
+	return func(c *Client) {
+		c.hc = hc
+	}
+}
+
+// WithHeader adds a header sent with every request, e.g. an API key.
+func WithHeader(key, value string) Option {
+	return func(c *Client) {
+		c.header.Add(key, value)
+	}
+}
+
+// New returns a client of the gateway at baseURL, e.g.
+// "https://api.example.com". Route paths are appended to its path.
+func New(baseURL string, opts ...Option) (*Client, error) {
+	base, err := url.Parse(baseURL)
+	if err != nil {
+		return nil, fmt.Errorf("parse rest base url: %w", err)
+	}
+	if base.Scheme == "" || base.Host == "" {
+		return nil, fmt.Errorf("rest base url %q must be absolute", baseURL)
+	}
+	base.Path = strings.TrimSuffix(base.Path, "/")
+	c := &Client{base: base, hc: http.DefaultClient, header: http.Header{}}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c, nil
+}
+
+// Invoke calls the route method template, as declared in the HTTP rule of
+// the RPC, and decodes the response into out. body names the request field
+// sent as the body, "*" for the whole request and "" for none; the other
+// fields not bound to the path go to the query.
+//
+// Outgoing metadata is sent as headers, and the PerCallTimeout, Header and
+// Trailer call options are honored. Errors are *status.Status.
+func (c *Client) Invoke(
+	ctx context.Context,
+	method, template, body string,
+	in, out proto.Message,
+	opts ...client.CallOption,
+) error {
+	settings := client.ResolveCallOptions(opts...)
+	if settings.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, settings.Timeout)
+		defer cancel()
+	}
+	req, err := c.newRequest(ctx, method, template, body, in)
+	if err != nil {
+		return err
+	}
+	resp, err := c.hc.Do(req)
+	if err != nil {
+		if ctx.Err() != nil {
+			return status.FromContextError(ctx.Err()).Err()
+		}
+		return status.WithCode(code.Code_UNAVAILABLE, err).Err()
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return status.WithCode(code.Code_UNAVAILABLE, err).Err()
+	}
+	if settings.Header != nil {
+		*settings.Header = responseMetadata(resp.Header, rest.MetadataHeaderPrefix)
+	}
+	if settings.Trailer != nil {
+		*settings.Trailer = metadata.Join(
+			responseMetadata(resp.Header, rest.MetadataTrailerPrefix),
+			responseMetadata(resp.Trailer, rest.MetadataTrailerPrefix),
+		)
+	}
+	if resp.StatusCode < http.StatusOK || resp.StatusCode >= http.StatusMultipleChoices {
+		return decodeError(resp, data)
+	}
+	if len(bytes.TrimSpace(data)) == 0 {
+		return nil
+	}
+	if err := (protojson.UnmarshalOptions{DiscardUnknown: true}).Unmarshal(data, out); err != nil {
+		return status.WithCode(code.Code_INTERNAL, fmt.Errorf("decode response: %w", err)).Err()
+	}
+	return nil
+}
+
+func (c *Client) newRequest(
+	ctx context.Context,
+	method, template, body string,
+	in proto.Message,
+) (*http.Request, error) {
+	msg := in.ProtoReflect()
+	path, bound, err := expandTemplate(template, msg)
+	if err != nil {
+		return nil, status.WithCode(code.Code_INVALID_ARGUMENT, err).Err()
+	}
+	target := c.base.String() + path
+	var reader io.Reader
+	if body != "" {
+		payload, err := marshalBody(msg, body)
+		if err != nil {
+			return nil, status.WithCode(code.Code_INVALID_ARGUMENT, err).Err()
+		}
+		reader = bytes.NewReader(payload)
+	}
+	if body != "*" {
+		skip := bound
+		if body != "" {
+			skip = append(skip, body)
+		}
+		query, err := encodeQuery(msg, skip)
+		if err != nil {
+			return nil, status.WithCode(code.Code_INVALID_ARGUMENT, err).Err()
+		}
+		if len(query) > 0 {
+			target += "?" + query.Encode()
+		}
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, target, reader)
+	if err != nil {
+		return nil, status.WithCode(code.Code_INVALID_ARGUMENT, err).Err()
+	}
+	for key, vals := range c.header {
+		req.Header[key] = append([]string(nil), vals...)
+	}
+	if reader != nil {
+		req.Header.Set("Content-Type", marshaler.ContentTypeJSON)
+	}
+	req.Header.Set("Accept", marshaler.ContentTypeJSON)
+	if md, ok := metadata.FromOutContext(ctx); ok {
+		for key, vals := range md {
+			for _, v := range vals {
+				req.Header.Add(rest.MetadataHeaderPrefix+key, metadata.EncodeHeaderValue(key, v))
+			}
+		}
+	}
+	return req, nil
+}
+
+// marshalBody encodes the request, or its top-level field named body, as
+// JSON.
+func marshalBody(msg protoreflect.Message, body string) ([]byte, error) {
+	if body == "*" {
+		return protojson.Marshal(msg.Interface())
+	}
+	fd := msg.Descriptor().Fields().ByName(protoreflect.Name(body))
+	if fd == nil {
+		return nil, fmt.Errorf("body field %q not found in %s", body, msg.Descriptor().FullName())
+	}
+	if fd.Message() == nil || fd.IsList() || fd.IsMap() {
+		return nil, fmt.Errorf("body field %q is not a message", body)
+	}
+	return protojson.Marshal(msg.Get(fd).Message().Interface())
+}
+
+// decodeError rebuilds the status of an error response, whether it carries
+// a google.rpc.Status in JSON or protobuf, the grpc-gateway error body, or
+// no recognizable body at all.
+func decodeError(resp *http.Response, data []byte) error {
+	pb := &statuspb.Status{}
+	var err error
+	switch contentType := resp.Header.Get("Content-Type"); {
+	case len(bytes.TrimSpace(data)) == 0:
+		err = io.ErrUnexpectedEOF
+	case strings.HasPrefix(contentType, marshaler.ContentTypeJSON):
+		err = status.DecodeJSON(protojson.UnmarshalOptions{DiscardUnknown: true}, data, pb)
+	default:
+		err = proto.Unmarshal(data, pb)
+	}
+	if err != nil || pb.GetCode() == int32(code.Code_OK) {
+		msg := strings.TrimSpace(string(data))
+		if err == nil || msg == "" || !isText(resp.Header.Get("Content-Type")) {
+			msg = http.StatusText(resp.StatusCode)
+		}
+		return status.New(status.HTTPCodeToStuCode(int32(resp.StatusCode)), msg).
+			WithHTTPCode(int32(resp.StatusCode)).Err()
+	}
+	return status.FromProto(pb).WithHTTPCode(int32(resp.StatusCode)).Err()
+}
+
+func isText(contentType string) bool {
+	return contentType == "" || strings.HasPrefix(contentType, "text/")
+}
+
+// responseMetadata collects the headers carrying RPC metadata under prefix.
+func responseMetadata(header http.Header, prefix string) metadata.MD {
+	md := metadata.MD{}
+	for key, vals := range header {
+		if !strings.HasPrefix(key, prefix) {
+			continue
+		}
+		key = strings.ToLower(key[len(prefix):])
+		for _, v := range vals {
+			if decoded, err := metadata.DecodeHeaderValue(key, v); err == nil {
+				md.Append(key, decoded)
+			}
+		}
+	}
+	return md
+}
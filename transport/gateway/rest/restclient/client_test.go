@@ -0,0 +1,188 @@
+// Copyright 2022 The codesjoy Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package restclient
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/genproto/googleapis/rpc/code"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/types/known/sourcecontextpb"
+	"google.golang.org/protobuf/types/known/typepb"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+
+	"github.com/codesjoy/yggdrasil/v3/rpc/metadata"
+	"github.com/codesjoy/yggdrasil/v3/rpc/status"
+	"github.com/codesjoy/yggdrasil/v3/transport/runtime/client"
+)
+
+func newTestClient(t *testing.T, handler http.HandlerFunc) *Client {
+	t.Helper()
+	srv := httptest.NewServer(handler)
+	t.Cleanup(srv.Close)
+	c, err := New(srv.URL+"/api/", WithHeader("X-Api-Key", "k"))
+	require.NoError(t, err)
+	return c
+}
+
+func testType() *typepb.Type {
+	return &typepb.Type{
+		Name:          "types/a b",
+		Oneofs:        []string{"x", "y"},
+		Syntax:        typepb.Syntax_SYNTAX_PROTO3,
+		SourceContext: &sourcecontextpb.SourceContext{FileName: "f.proto"},
+	}
+}
+
+func TestInvoke_PathAndQuery(t *testing.T) {
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodGet, r.Method)
+		assert.Equal(t, "/api/v1/types/a%20b:get", r.URL.EscapedPath())
+		query := r.URL.Query()
+		assert.Equal(t, []string{"x", "y"}, query["oneofs"])
+		assert.Equal(t, "SYNTAX_PROTO3", query.Get("syntax"))
+		assert.Equal(t, "f.proto", query.Get("source_context.file_name"))
+		assert.False(t, query.Has("name"))
+		assert.Equal(t, "k", r.Header.Get("X-Api-Key"))
+		assert.Equal(t, "r1", r.Header.Get("Yggdrasil-Metadata-X-Request-Id"))
+		w.Header().Set("Yggdrasil-Metadata-X-Served-By", "node1")
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"fileName":"ok.proto"}`))
+	})
+
+	ctx := metadata.WithOutContext(context.Background(), metadata.Pairs("x-request-id", "r1"))
+	var header metadata.MD
+	out := &sourcecontextpb.SourceContext{}
+	err := c.Invoke(ctx, http.MethodGet, "/v1/{name=types/*}:get", "", testType(), out,
+		client.Header(&header))
+	require.NoError(t, err)
+	assert.Equal(t, "ok.proto", out.GetFileName())
+	assert.Equal(t, []string{"node1"}, header.Get("x-served-by"))
+}
+
+func TestInvoke_Body(t *testing.T) {
+	tests := []struct {
+		name  string
+		body  string
+		check func(t *testing.T, r *http.Request, body map[string]any)
+	}{
+		{
+			name: "whole request",
+			body: "*",
+			check: func(t *testing.T, r *http.Request, body map[string]any) {
+				assert.Empty(t, r.URL.RawQuery)
+				assert.Equal(t, "types/a b", body["name"])
+			},
+		},
+		{
+			name: "field",
+			body: "source_context",
+			check: func(t *testing.T, r *http.Request, body map[string]any) {
+				assert.Equal(t, "types/a b", r.URL.Query().Get("name"))
+				assert.False(t, r.URL.Query().Has("source_context.file_name"))
+				assert.Equal(t, map[string]any{"fileName": "f.proto"}, body)
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+				assert.Equal(t, "application/json", r.Header.Get("Content-Type"))
+				data, err := io.ReadAll(r.Body)
+				require.NoError(t, err)
+				var body map[string]any
+				require.NoError(t, json.Unmarshal(data, &body))
+				tt.check(t, r, body)
+				w.WriteHeader(http.StatusOK)
+			})
+			err := c.Invoke(context.Background(), http.MethodPost, "/v1/types", tt.body,
+				testType(), &wrapperspb.StringValue{})
+			require.NoError(t, err)
+		})
+	}
+}
+
+func TestInvoke_ErrorEnvelope(t *testing.T) {
+	want := status.NewBadRequest().Field("name", "must not be empty").Status("invalid request")
+	c := newTestClient(t, func(w http.ResponseWriter, _ *http.Request) {
+		data, err := status.EncodeJSON(protojson.MarshalOptions{}, want.Status())
+		require.NoError(t, err)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = w.Write(data)
+	})
+
+	err := c.Invoke(context.Background(), http.MethodGet, "/v1/types", "", &typepb.Type{},
+		&wrapperspb.StringValue{})
+	st, ok := status.CoverError(err)
+	require.True(t, ok)
+	assert.Equal(t, code.Code_INVALID_ARGUMENT, st.Code())
+	assert.Equal(t, "invalid request", st.Message())
+	assert.Equal(t, int32(http.StatusBadRequest), st.HTTPCode())
+	require.Len(t, st.BadRequest().GetFieldViolations(), 1)
+	assert.Equal(t, "name", st.BadRequest().GetFieldViolations()[0].GetField())
+}
+
+func TestInvoke_PlainError(t *testing.T) {
+	c := newTestClient(t, func(w http.ResponseWriter, _ *http.Request) {
+		http.Error(w, "upstream down", http.StatusServiceUnavailable)
+	})
+
+	err := c.Invoke(context.Background(), http.MethodGet, "/v1/types", "", &typepb.Type{},
+		&wrapperspb.StringValue{})
+	st, ok := status.CoverError(err)
+	require.True(t, ok)
+	assert.Equal(t, code.Code_UNAVAILABLE, st.Code())
+	assert.Equal(t, "upstream down", st.Message())
+}
+
+func TestInvoke_PathMismatch(t *testing.T) {
+	c := newTestClient(t, func(http.ResponseWriter, *http.Request) {
+		t.Error("unexpected request")
+	})
+
+	for _, name := range []string{"", "shelves/1", "types/1/books"} {
+		err := c.Invoke(context.Background(), http.MethodGet, "/v1/{name=types/*}", "",
+			&typepb.Type{Name: name}, &wrapperspb.StringValue{})
+		st, ok := status.CoverError(err)
+		require.True(t, ok)
+		assert.Equal(t, code.Code_INVALID_ARGUMENT, st.Code(), name)
+	}
+}
+
+func TestInvoke_PerCallTimeout(t *testing.T) {
+	c := newTestClient(t, func(_ http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	})
+
+	err := c.Invoke(context.Background(), http.MethodGet, "/v1/types", "", &typepb.Type{},
+		&wrapperspb.StringValue{}, client.PerCallTimeout(20*time.Millisecond))
+	st, ok := status.CoverError(err)
+	require.True(t, ok)
+	assert.Equal(t, code.Code_DEADLINE_EXCEEDED, st.Code())
+}
+
+func TestNew_RequiresAbsoluteURL(t *testing.T) {
+	_, err := New("/api")
+	require.Error(t, err)
+}
@@ -0,0 +1,270 @@
+// Copyright 2022 The codesjoy Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package restclient
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net/url"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/known/durationpb"
+	"google.golang.org/protobuf/types/known/fieldmaskpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// variablePattern matches the path variables of an HTTP rule template:
+// {field.path} or {field.path=segments/*}.
+var variablePattern = regexp.MustCompile(`{([^{}=]*)(?:=([^{}]*))?}`)
+
+// expandTemplate fills the variables of template with the fields of msg and
+// returns the escaped path and the field paths it bound.
+func expandTemplate(template string, msg protoreflect.Message) (string, []string, error) {
+	var (
+		b     strings.Builder
+		bound []string
+		last  int
+	)
+	for _, match := range variablePattern.FindAllStringSubmatchIndex(template, -1) {
+		b.WriteString(template[last:match[0]])
+		last = match[1]
+		field := template[match[2]:match[3]]
+		pattern := "*"
+		if match[4] >= 0 {
+			pattern = template[match[4]:match[5]]
+		}
+		value, err := pathValue(msg, field)
+		if err != nil {
+			return "", nil, err
+		}
+		if !matchSegments(pattern, value) {
+			return "", nil, fmt.Errorf("field %q value %q does not match %q", field, value, pattern)
+		}
+		b.WriteString(escapePath(value))
+		bound = append(bound, field)
+	}
+	b.WriteString(template[last:])
+	return b.String(), bound, nil
+}
+
+// pathValue returns the string form of the scalar field at path.
+func pathValue(msg protoreflect.Message, path string) (string, error) {
+	names := strings.Split(path, ".")
+	for i, name := range names {
+		fd := msg.Descriptor().Fields().ByName(protoreflect.Name(name))
+		if fd == nil {
+			return "", fmt.Errorf(
+				"path field %q not found in %s",
+				path,
+				msg.Descriptor().FullName(),
+			)
+		}
+		if i < len(names)-1 {
+			if fd.Message() == nil || fd.IsList() || fd.IsMap() {
+				return "", fmt.Errorf("path field %q: %q is not a message", path, name)
+			}
+			msg = msg.Get(fd).Message()
+			continue
+		}
+		if fd.IsList() || fd.IsMap() {
+			return "", fmt.Errorf("path field %q is not a scalar", path)
+		}
+		value, err := formatValue(fd, msg.Get(fd))
+		if err != nil {
+			return "", fmt.Errorf("path field %q: %w", path, err)
+		}
+		if value == "" {
+			return "", fmt.Errorf("path field %q is empty", path)
+		}
+		return value, nil
+	}
+	return "", fmt.Errorf("empty path field")
+}
+
+// matchSegments reports whether value matches the segment pattern of a
+// path variable, where "*" matches one non-empty segment.
+func matchSegments(pattern, value string) bool {
+	want := strings.Split(pattern, "/")
+	got := strings.Split(value, "/")
+	if len(want) != len(got) {
+		return false
+	}
+	for i, segment := range want {
+		if got[i] == "" || (segment != "*" && segment != got[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// escapePath escapes each segment of a "/"-separated path.
+func escapePath(path string) string {
+	segments := strings.Split(path, "/")
+	for i, segment := range segments {
+		segments[i] = url.PathEscape(segment)
+	}
+	return strings.Join(segments, "/")
+}
+
+// encodeQuery encodes the populated fields of msg, except the field paths
+// in skip and their subfields, as query parameters the REST gateway binds
+// back: repeated fields repeat their key and map entries use name[key].
+func encodeQuery(msg protoreflect.Message, skip []string) (url.Values, error) {
+	values := url.Values{}
+	if err := encodeMessage(values, msg, "", skip); err != nil {
+		return nil, err
+	}
+	return values, nil
+}
+
+func encodeMessage(
+	values url.Values,
+	msg protoreflect.Message,
+	prefix string,
+	skip []string,
+) error {
+	var err error
+	msg.Range(func(fd protoreflect.FieldDescriptor, v protoreflect.Value) bool {
+		key := prefix + string(fd.Name())
+		if slices.Contains(skip, key) {
+			return true
+		}
+		err = encodeField(values, fd, v, key, skip)
+		return err == nil
+	})
+	return err
+}
+
+func encodeField(
+	values url.Values,
+	fd protoreflect.FieldDescriptor,
+	v protoreflect.Value,
+	key string,
+	skip []string,
+) error {
+	switch {
+	case fd.IsList():
+		list := v.List()
+		for i := 0; i < list.Len(); i++ {
+			if fd.Message() != nil && !isWellKnown(fd.Message()) {
+				return fmt.Errorf("query field %q: repeated messages are not supported", key)
+			}
+			s, err := formatValue(fd, list.Get(i))
+			if err != nil {
+				return fmt.Errorf("query field %q: %w", key, err)
+			}
+			values.Add(key, s)
+		}
+		return nil
+	case fd.IsMap():
+		var err error
+		v.Map().Range(func(k protoreflect.MapKey, mv protoreflect.Value) bool {
+			err = encodeField(values, fd.MapValue(), mv, key+"["+k.String()+"]", skip)
+			return err == nil
+		})
+		return err
+	case fd.Message() != nil && !isWellKnown(fd.Message()):
+		return encodeMessage(values, v.Message(), key+".", skip)
+	}
+	s, err := formatValue(fd, v)
+	if err != nil {
+		return fmt.Errorf("query field %q: %w", key, err)
+	}
+	values.Add(key, s)
+	return nil
+}
+
+// isWellKnown reports whether md is a well-known type encoded as a single
+// string value.
+func isWellKnown(md protoreflect.MessageDescriptor) bool {
+	switch md.FullName() {
+	case "google.protobuf.Timestamp", "google.protobuf.Duration", "google.protobuf.FieldMask",
+		"google.protobuf.DoubleValue", "google.protobuf.FloatValue",
+		"google.protobuf.Int64Value", "google.protobuf.Int32Value",
+		"google.protobuf.UInt64Value", "google.protobuf.UInt32Value",
+		"google.protobuf.BoolValue", "google.protobuf.StringValue", "google.protobuf.BytesValue":
+		return true
+	}
+	return false
+}
+
+// formatValue returns the string form of a single value of fd, as parsed
+// by the REST gateway.
+func formatValue(fd protoreflect.FieldDescriptor, v protoreflect.Value) (string, error) {
+	switch fd.Kind() {
+	case protoreflect.BoolKind:
+		return strconv.FormatBool(v.Bool()), nil
+	case protoreflect.EnumKind:
+		if ev := fd.Enum().Values().ByNumber(v.Enum()); ev != nil {
+			return string(ev.Name()), nil
+		}
+		return strconv.FormatInt(int64(v.Enum()), 10), nil
+	case protoreflect.Int32Kind, protoreflect.Sint32Kind, protoreflect.Sfixed32Kind,
+		protoreflect.Int64Kind, protoreflect.Sint64Kind, protoreflect.Sfixed64Kind:
+		return strconv.FormatInt(v.Int(), 10), nil
+	case protoreflect.Uint32Kind, protoreflect.Fixed32Kind,
+		protoreflect.Uint64Kind, protoreflect.Fixed64Kind:
+		return strconv.FormatUint(v.Uint(), 10), nil
+	case protoreflect.FloatKind:
+		return strconv.FormatFloat(v.Float(), 'g', -1, 32), nil
+	case protoreflect.DoubleKind:
+		return strconv.FormatFloat(v.Float(), 'g', -1, 64), nil
+	case protoreflect.StringKind:
+		return v.String(), nil
+	case protoreflect.BytesKind:
+		return base64.StdEncoding.EncodeToString(v.Bytes()), nil
+	case protoreflect.MessageKind, protoreflect.GroupKind:
+		return formatMessage(v.Message())
+	default:
+		return "", fmt.Errorf("unknown field kind: %v", fd.Kind())
+	}
+}
+
+func formatMessage(msg protoreflect.Message) (string, error) {
+	md := msg.Descriptor()
+	switch md.FullName() {
+	case "google.protobuf.Timestamp":
+		ts := &timestamppb.Timestamp{}
+		copyFields(ts.ProtoReflect(), msg)
+		return ts.AsTime().Format(time.RFC3339Nano), nil
+	case "google.protobuf.Duration":
+		d := &durationpb.Duration{}
+		copyFields(d.ProtoReflect(), msg)
+		return d.AsDuration().String(), nil
+	case "google.protobuf.FieldMask":
+		fm := &fieldmaskpb.FieldMask{}
+		copyFields(fm.ProtoReflect(), msg)
+		return strings.Join(fm.GetPaths(), ","), nil
+	}
+	if isWellKnown(md) {
+		fd := md.Fields().ByName("value")
+		return formatValue(fd, msg.Get(fd))
+	}
+	return "", fmt.Errorf("unsupported message type: %q", md.FullName())
+}
+
+// copyFields copies the fields of src, which may be a dynamic message, into
+// dst of the same type.
+func copyFields(dst, src protoreflect.Message) {
+	src.Range(func(fd protoreflect.FieldDescriptor, v protoreflect.Value) bool {
+		dst.Set(dst.Descriptor().Fields().ByNumber(fd.Number()), v)
+		return true
+	})
+}
@@ -0,0 +1,207 @@
+// Copyright 2022 The codesjoy Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rest
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"regexp"
+	"strings"
+)
+
+// RouteConflict reports a route registered over an earlier one.
+type RouteConflict struct {
+	Method string `json:"method"`
+	// Path and Owner are the pattern and owner of the later route. The
+	// owner is the RPC service name, or "raw" for raw handlers.
+	Path  string `json:"path"`
+	Owner string `json:"owner"`
+	// ExistingPath and ExistingOwner describe the earlier route.
+	ExistingPath  string `json:"existingPath"`
+	ExistingOwner string `json:"existingOwner"`
+	// Duplicate reports a route with the same pattern shape as the earlier
+	// one; it was dropped. Otherwise the routes overlap.
+	Duplicate bool `json:"duplicate"`
+}
+
+func (c RouteConflict) Error() string {
+	kind := "overlaps"
+	if c.Duplicate {
+		kind = "duplicates"
+	}
+	return fmt.Sprintf("rest route %s %s (%s) %s %s %s (%s)",
+		c.Method, c.Path, c.Owner, kind, c.Method, c.ExistingPath, c.ExistingOwner)
+}
+
+// Conflicts returns the route conflicts found while registering routes.
+func (s *ServeMux) Conflicts() []RouteConflict {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]RouteConflict(nil), s.conflicts...)
+}
+
+// conflictsErr returns the conflicts as one error when routes must not
+// conflict. Callers hold s.mu.
+func (s *ServeMux) conflictsErr() error {
+	if s.cfg == nil || !s.cfg.StrictRoutes || len(s.conflicts) == 0 {
+		return nil
+	}
+	errs := make([]error, 0, len(s.conflicts))
+	for _, conflict := range s.conflicts {
+		errs = append(errs, conflict)
+	}
+	return fmt.Errorf("rest routes conflict: %w", errors.Join(errs...))
+}
+
+type route struct {
+	method   string
+	pattern  string
+	owner    string
+	segments []routeSegment
+}
+
+// routeSegment is one "/" separated segment of a pattern. Template
+// segments hold a variable between an optional literal prefix and suffix.
+type routeSegment struct {
+	literal  string
+	template bool
+	prefix   string
+	suffix   string
+	regex    string
+	wildcard bool
+}
+
+// claimRoute records the route and reports whether it may be registered,
+// which is false for duplicates of earlier routes.
+func (s *ServeMux) claimRoute(method, pattern, owner string) bool {
+	next := route{
+		method:   strings.ToUpper(method),
+		pattern:  pattern,
+		owner:    owner,
+		segments: parseRoute(pattern),
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, prev := range s.routes {
+		if prev.method != next.method {
+			continue
+		}
+		conflict := RouteConflict{
+			Method:        next.method,
+			Path:          pattern,
+			Owner:         owner,
+			ExistingPath:  prev.pattern,
+			ExistingOwner: prev.owner,
+		}
+		if sameShape(prev.segments, next.segments) {
+			conflict.Duplicate = true
+			s.conflicts = append(s.conflicts, conflict)
+			slog.Error("duplicate rest route dropped", slog.Any("error", conflict))
+			return false
+		}
+		if overlaps(prev.segments, next.segments) {
+			s.conflicts = append(s.conflicts, conflict)
+			slog.Warn("overlapping rest routes served by precedence", slog.Any("error", conflict))
+		}
+	}
+	s.routes = append(s.routes, next)
+	return true
+}
+
+func parseRoute(pattern string) []routeSegment {
+	parts := strings.Split(strings.Trim(pattern, "/"), "/")
+	segments := make([]routeSegment, 0, len(parts))
+	for _, part := range parts {
+		open, end := strings.IndexByte(part, '{'), strings.LastIndexByte(part, '}')
+		switch {
+		case part == "*":
+			segments = append(segments, routeSegment{wildcard: true})
+		case open < 0 || end < open:
+			segments = append(segments, routeSegment{literal: part})
+		default:
+			seg := routeSegment{template: true, prefix: part[:open], suffix: part[end+1:]}
+			if _, regex, ok := strings.Cut(part[open+1:end], ":"); ok {
+				seg.regex = regex
+			}
+			segments = append(segments, seg)
+		}
+	}
+	return segments
+}
+
+func sameShape(a, b []routeSegment) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] && !(a[i].template && b[i].template &&
+			a[i].prefix == b[i].prefix && a[i].suffix == b[i].suffix && a[i].regex == b[i].regex) {
+			return false
+		}
+	}
+	return true
+}
+
+// overlaps reports whether some path matches both patterns.
+func overlaps(a, b []routeSegment) bool {
+	for i := 0; ; i++ {
+		// A wildcard matches the rest of a path beyond its own slash.
+		switch {
+		case i < len(a) && a[i].wildcard:
+			return len(b) > i
+		case i < len(b) && b[i].wildcard:
+			return len(a) > i
+		case i == len(a) || i == len(b):
+			return len(a) == len(b)
+		case !segmentsOverlap(a[i], b[i]):
+			return false
+		}
+	}
+}
+
+func segmentsOverlap(a, b routeSegment) bool {
+	switch {
+	case !a.template && !b.template:
+		return a.literal == b.literal
+	case !a.template:
+		return templateMatches(b, a.literal)
+	case !b.template:
+		return templateMatches(a, b.literal)
+	default:
+		return compatible(a.prefix, b.prefix, strings.HasPrefix) &&
+			compatible(a.suffix, b.suffix, strings.HasSuffix)
+	}
+}
+
+func compatible(a, b string, has func(string, string) bool) bool {
+	return has(a, b) || has(b, a)
+}
+
+// templateMatches reports whether the template segment matches literal.
+func templateMatches(seg routeSegment, literal string) bool {
+	if len(literal) <= len(seg.prefix)+len(seg.suffix) ||
+		!strings.HasPrefix(literal, seg.prefix) || !strings.HasSuffix(literal, seg.suffix) {
+		return false
+	}
+	if seg.regex == "" {
+		return true
+	}
+	re, err := regexp.Compile("^(?:" + seg.regex + ")$")
+	if err != nil {
+		return true
+	}
+	return re.MatchString(literal[len(seg.prefix) : len(literal)-len(seg.suffix)])
+}
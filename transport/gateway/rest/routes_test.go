@@ -0,0 +1,134 @@
+// Copyright 2022 The codesjoy Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rest
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+func TestRouteConflicts(t *testing.T) {
+	s, err := NewServer(&Config{Host: "127.0.0.1"})
+	require.NoError(t, err)
+	mux := s.(*ServeMux)
+
+	rpc := func(value string) HandlerFunc {
+		return func(http.ResponseWriter, *http.Request) (interface{}, error) {
+			return wrapperspb.String(value), nil
+		}
+	}
+	raw := func(value string) http.HandlerFunc {
+		return func(w http.ResponseWriter, _ *http.Request) {
+			_, _ = w.Write([]byte(value))
+		}
+	}
+	mux.ServiceRPCHandle("pkg.Pages", http.MethodGet, "/{name}", rpc("template"))
+	mux.RawHandle(http.MethodGet, "/web", raw("literal"))
+	mux.RPCHandle(http.MethodGet, "/v1/items/{id}", rpc("first"))
+	mux.RPCHandle(http.MethodGet, "/v1/items/{key}", rpc("second"))
+	mux.RPCHandle(http.MethodPost, "/v1/items/{id}", rpc("post"))
+	mux.RawHandle(http.MethodGet, "/static/*", raw("static"))
+	mux.RawHandle(http.MethodGet, "/static/app.js", raw("app"))
+	mux.RPCHandle(http.MethodPost, "/v1/items/{id}:move", rpc("move"))
+
+	assert.Equal(t, []RouteConflict{
+		{
+			Method:        http.MethodGet,
+			Path:          "/web",
+			Owner:         "raw",
+			ExistingPath:  "/{name}",
+			ExistingOwner: "pkg.Pages",
+		},
+		{
+			Method:        http.MethodGet,
+			Path:          "/v1/items/{key}",
+			Owner:         "rpc",
+			ExistingPath:  "/v1/items/{id}",
+			ExistingOwner: "rpc",
+			Duplicate:     true,
+		},
+		{
+			Method:        http.MethodGet,
+			Path:          "/static/app.js",
+			Owner:         "raw",
+			ExistingPath:  "/static/*",
+			ExistingOwner: "raw",
+		},
+		{
+			Method:        http.MethodPost,
+			Path:          "/v1/items/{id}:move",
+			Owner:         "rpc",
+			ExistingPath:  "/v1/items/{id}",
+			ExistingOwner: "rpc",
+		},
+	}, mux.Conflicts())
+
+	serve := func(method, path string) string {
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, httptest.NewRequest(method, path, nil))
+		return w.Body.String()
+	}
+	get := func(path string) string { return serve(http.MethodGet, path) }
+	assert.Equal(t, "literal", get("/web"))
+	assert.Contains(t, get("/other"), "template")
+	assert.Contains(t, get("/v1/items/1"), "first")
+	assert.Equal(t, "app", get("/static/app.js"))
+	assert.Equal(t, "static", get("/static/app.css"))
+	assert.Contains(t, serve(http.MethodPost, "/v1/items/1:move"), "move")
+
+	require.NoError(t, mux.Start())
+	require.NoError(t, mux.Stop(t.Context()))
+}
+
+func TestRouteConflictsStrict(t *testing.T) {
+	s, err := NewServer(&Config{Host: "127.0.0.1", StrictRoutes: true})
+	require.NoError(t, err)
+	mux := s.(*ServeMux)
+	handler := func(http.ResponseWriter, *http.Request) (interface{}, error) {
+		return wrapperspb.String(""), nil
+	}
+	mux.RPCHandle(http.MethodGet, "/v1/items/{id}", handler)
+	mux.RPCHandle(http.MethodGet, "/v1/items/latest", handler)
+
+	err = mux.Start()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(),
+		"rest route GET /v1/items/latest (rpc) overlaps GET /v1/items/{id} (rpc)")
+}
+
+func TestRouteOverlaps(t *testing.T) {
+	for _, tt := range []struct {
+		a, b    string
+		overlap bool
+	}{
+		{"/v1/items/{id}", "/v1/items/{id}:move", true},
+		{"/v1/items/{id}:move", "/v1/items/a:copy", false},
+		{"/v1/items/{id:[0-9]+}", "/v1/items/latest", false},
+		{"/v1/items/{id:[0-9]+}", "/v1/items/42", true},
+		{"/v1/items", "/v1/items/{id}", false},
+		{"/v1/*", "/v1", false},
+		{"/v1/*", "/v1/{id}", true},
+		{"/v1/books", "/v2/*", false},
+	} {
+		t.Run(tt.a+" "+tt.b, func(t *testing.T) {
+			assert.Equal(t, tt.overlap, overlaps(parseRoute(tt.a), parseRoute(tt.b)))
+		})
+	}
+}
@@ -0,0 +1,59 @@
+// Copyright 2022 The codesjoy Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rest
+
+import (
+	"context"
+
+	"github.com/codesjoy/yggdrasil/v3/transport/support/marshaler"
+)
+
+// ServiceMarshalerConfig overrides the JSON options of the RPC routes of one
+// service. The options replace the global jsonpb config as a whole.
+type ServiceMarshalerConfig struct {
+	// Service is the fully-qualified proto service name, e.g.
+	// "helloworld.Greeter".
+	Service string                  `mapstructure:"service"`
+	JSONPB  *marshaler.JSONPbConfig `mapstructure:"jsonpb"`
+}
+
+// serviceJSONPb returns the JSON marshaler configured for service, or nil
+// when the service uses the global options.
+func (s *ServeMux) serviceJSONPb(service string) *marshaler.JSONPb {
+	if s.cfg == nil || service == "" {
+		return nil
+	}
+	for _, item := range s.cfg.Marshaler.Config.Services {
+		if item.Service == service {
+			return marshaler.NewJSONPbMarshalerWithConfig(item.JSONPB)
+		}
+	}
+	return nil
+}
+
+// withServiceJSONPb swaps the negotiated JSON marshalers of ctx for m; other
+// codecs are left untouched.
+func withServiceJSONPb(ctx context.Context, m *marshaler.JSONPb) context.Context {
+	if m == nil {
+		return ctx
+	}
+	if _, ok := marshaler.InboundFromContext(ctx).(*marshaler.JSONPb); ok {
+		ctx = marshaler.WithInboundContext(ctx, m)
+	}
+	if _, ok := marshaler.OutboundFromContext(ctx).(*marshaler.JSONPb); ok {
+		ctx = marshaler.WithOutboundContext(ctx, m)
+	}
+	return ctx
+}
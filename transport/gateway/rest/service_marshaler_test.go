@@ -0,0 +1,91 @@
+// Copyright 2022 The codesjoy Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rest
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/genproto/googleapis/rpc/code"
+	"google.golang.org/protobuf/types/descriptorpb"
+
+	"github.com/codesjoy/pkg/basic/xerror"
+
+	"github.com/codesjoy/yggdrasil/v3/transport/support/marshaler"
+)
+
+func echoOptionHandler(_ http.ResponseWriter, r *http.Request) (interface{}, error) {
+	msg := &descriptorpb.UninterpretedOption{}
+	inbound := marshaler.InboundFromContext(r.Context())
+	if err := inbound.NewDecoder(r.Body).Decode(msg); err != nil && err != io.EOF {
+		return nil, xerror.Wrap(err, code.Code_INVALID_ARGUMENT, "")
+	}
+	return msg, nil
+}
+
+func TestServeMux_ServiceJSONOptions(t *testing.T) {
+	jsonpb := &marshaler.JSONPbConfig{}
+	jsonpb.MarshalOptions.UseProtoNames = true
+	jsonpb.MarshalOptions.UseEnumNumbers = true
+	cfg := &Config{}
+	cfg.Marshaler.Config.Services = []ServiceMarshalerConfig{
+		{Service: "test.Service", JSONPB: jsonpb},
+	}
+	s, err := NewServer(cfg)
+	require.NoError(t, err)
+	mux := s.(*ServeMux)
+	mux.ServiceRPCHandle("test.Service", http.MethodPost, "/svc", echoOptionHandler)
+	mux.ServiceRPCHandle("other.Service", http.MethodPost, "/other", echoOptionHandler)
+	mux.RPCHandle(http.MethodPost, "/plain", echoOptionHandler)
+
+	call := func(path, body string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+		r.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, r)
+		return w
+	}
+
+	w := call("/svc", `{"identifierValue":"id"}`)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"identifier_value":"id"}`, w.Body.String())
+
+	t.Run("Unknown Fields Rejected", func(t *testing.T) {
+		w := call("/svc", `{"bogus":1}`)
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+
+	t.Run("Other Routes Keep Global Options", func(t *testing.T) {
+		for _, path := range []string{"/other", "/plain"} {
+			w := call(path, `{"identifierValue":"id","bogus":1}`)
+			require.Equal(t, http.StatusOK, w.Code, path)
+			assert.Contains(t, w.Body.String(), `"identifierValue":"id"`, path)
+		}
+	})
+
+	t.Run("Binary Codecs Untouched", func(t *testing.T) {
+		r := httptest.NewRequest(http.MethodPost, "/svc", nil)
+		r = r.WithContext(marshaler.WithOutboundContext(r.Context(), &marshaler.ProtoMarshaler{}))
+		ctx := withServiceJSONPb(r.Context(), mux.serviceJSONPb("test.Service"))
+		assert.IsType(t, &marshaler.ProtoMarshaler{}, marshaler.OutboundFromContext(ctx))
+		assert.IsType(t, &marshaler.JSONPb{}, marshaler.InboundFromContext(ctx))
+		assert.Nil(t, mux.serviceJSONPb(""))
+	})
+}
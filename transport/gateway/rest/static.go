@@ -0,0 +1,189 @@
+// Copyright 2022 The codesjoy Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rest
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/fs"
+	"mime"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+)
+
+const staticIndex = "index.html"
+
+// StaticOption configures StaticHandler.
+type StaticOption func(*staticHandler)
+
+// WithStaticCacheControl sets the Cache-Control header of assets. Index
+// documents are always served with "no-cache" so deployments show up at once.
+func WithStaticCacheControl(value string) StaticOption {
+	return func(h *staticHandler) {
+		h.cacheControl = value
+	}
+}
+
+// WithSPAFallback serves the root index.html for unknown paths without a
+// file extension, letting single page applications handle history routes.
+func WithSPAFallback() StaticOption {
+	return func(h *staticHandler) {
+		h.spa = true
+	}
+}
+
+type staticHandler struct {
+	prefix       string
+	fsys         fs.FS
+	cacheControl string
+	spa          bool
+}
+
+// StaticHandler serves the files of fsys under the URL prefix. Use os.DirFS
+// for on-disk assets or an embed.FS for assets shipped inside the binary.
+// Precompressed name.br and name.gz variants are served to clients
+// accepting them.
+func StaticHandler(prefix string, fsys fs.FS, opts ...StaticOption) http.HandlerFunc {
+	h := &staticHandler{
+		prefix:       strings.TrimSuffix(prefix, "/"),
+		fsys:         fsys,
+		cacheControl: "public, max-age=3600",
+	}
+	for _, opt := range opts {
+		opt(h)
+	}
+	return h.serve
+}
+
+func (h *staticHandler) serve(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+	rel, ok := strings.CutPrefix(r.URL.Path, h.prefix)
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	name := strings.TrimPrefix(path.Clean("/"+rel), "/")
+	name, ok = h.resolve(name)
+	if !ok && h.spa && path.Ext(name) == "" {
+		name, ok = h.resolve("")
+	}
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	h.serveFile(w, r, name)
+}
+
+// resolve maps a cleaned request path to a regular file, descending into
+// the index document of directories.
+func (h *staticHandler) resolve(name string) (string, bool) {
+	if name == "" {
+		name = staticIndex
+	}
+	info, err := fs.Stat(h.fsys, name)
+	if err == nil && info.IsDir() {
+		name = path.Join(name, staticIndex)
+		info, err = fs.Stat(h.fsys, name)
+	}
+	if err != nil || !info.Mode().IsRegular() {
+		return name, false
+	}
+	return name, true
+}
+
+func (h *staticHandler) serveFile(w http.ResponseWriter, r *http.Request, name string) {
+	header := w.Header()
+	if ctype := mime.TypeByExtension(path.Ext(name)); ctype != "" {
+		header.Set("Content-Type", ctype)
+	}
+	if path.Base(name) == staticIndex {
+		header.Set("Cache-Control", "no-cache")
+	} else if h.cacheControl != "" {
+		header.Set("Cache-Control", h.cacheControl)
+	}
+	header.Add("Vary", "Accept-Encoding")
+
+	accepted := r.Header.Get("Accept-Encoding")
+	for _, variant := range []struct{ encoding, ext string }{{"br", ".br"}, {"gzip", ".gz"}} {
+		if !acceptsEncoding(accepted, variant.encoding) {
+			continue
+		}
+		if content, modTime, err := h.open(name + variant.ext); err == nil {
+			defer func() { _ = content.Close() }()
+			header.Set("Content-Encoding", variant.encoding)
+			http.ServeContent(w, r, name, modTime, content)
+			return
+		}
+	}
+	content, modTime, err := h.open(name)
+	if err != nil {
+		status := http.StatusInternalServerError
+		http.Error(w, http.StatusText(status), status)
+		return
+	}
+	defer func() { _ = content.Close() }()
+	http.ServeContent(w, r, name, modTime, content)
+}
+
+// staticFile pairs the content of a file with the file that must be closed
+// once it has been served.
+type staticFile struct {
+	io.ReadSeeker
+	io.Closer
+}
+
+// open returns the content of a regular file. Files that can seek are served
+// directly; others are read into memory first.
+func (h *staticHandler) open(name string) (io.ReadSeekCloser, time.Time, error) {
+	f, err := h.fsys.Open(name)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	info, err := f.Stat()
+	if err == nil && !info.Mode().IsRegular() {
+		err = errors.New("not a regular file")
+	}
+	if err != nil {
+		_ = f.Close()
+		return nil, time.Time{}, err
+	}
+	if rs, ok := f.(io.ReadSeeker); ok {
+		return staticFile{ReadSeeker: rs, Closer: f}, info.ModTime(), nil
+	}
+	buf, err := io.ReadAll(f)
+	if err != nil {
+		_ = f.Close()
+		return nil, time.Time{}, err
+	}
+	return staticFile{ReadSeeker: bytes.NewReader(buf), Closer: f}, info.ModTime(), nil
+}
+
+func acceptsEncoding(header, encoding string) bool {
+	for _, item := range strings.Split(header, ",") {
+		name, params, _ := strings.Cut(strings.TrimSpace(item), ";")
+		if !strings.EqualFold(strings.TrimSpace(name), encoding) {
+			continue
+		}
+		return strings.ReplaceAll(strings.TrimSpace(params), " ", "") != "q=0"
+	}
+	return false
+}
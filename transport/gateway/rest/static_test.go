@@ -0,0 +1,157 @@
+// Copyright 2022 The codesjoy Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rest
+
+import (
+	"bytes"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStaticHandler(t *testing.T) {
+	fsys := fstest.MapFS{
+		"index.html":        {Data: []byte("<html>root</html>")},
+		"app.js":            {Data: []byte("console.log(1)")},
+		"app.js.br":         {Data: []byte("br-bytes")},
+		"app.js.gz":         {Data: []byte("gz-bytes")},
+		"docs/index.html":   {Data: []byte("<html>docs</html>")},
+		"images/logo.svg":   {Data: []byte("<svg/>")},
+		"images/nested/x.x": {Data: []byte("x")},
+	}
+	serve := func(h http.HandlerFunc, method, target, encoding string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(method, target, nil)
+		if encoding != "" {
+			r.Header.Set("Accept-Encoding", encoding)
+		}
+		w := httptest.NewRecorder()
+		h(w, r)
+		return w
+	}
+
+	h := StaticHandler("/ui/", fsys, WithStaticCacheControl("public, max-age=60"))
+
+	w := serve(h, http.MethodGet, "/ui/", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "<html>root</html>", w.Body.String())
+	assert.Equal(t, "no-cache", w.Header().Get("Cache-Control"))
+
+	w = serve(h, http.MethodGet, "/ui/docs", "")
+	assert.Equal(t, "<html>docs</html>", w.Body.String())
+
+	w = serve(h, http.MethodGet, "/ui/app.js", "")
+	assert.Equal(t, "console.log(1)", w.Body.String())
+	assert.Equal(t, "public, max-age=60", w.Header().Get("Cache-Control"))
+	assert.Contains(t, w.Header().Get("Content-Type"), "javascript")
+	assert.Equal(t, "Accept-Encoding", w.Header().Get("Vary"))
+
+	w = serve(h, http.MethodGet, "/ui/app.js", "gzip, br")
+	assert.Equal(t, "br-bytes", w.Body.String())
+	assert.Equal(t, "br", w.Header().Get("Content-Encoding"))
+	assert.Contains(t, w.Header().Get("Content-Type"), "javascript")
+
+	w = serve(h, http.MethodGet, "/ui/app.js", "br;q=0, gzip")
+	assert.Equal(t, "gz-bytes", w.Body.String())
+	assert.Equal(t, "gzip", w.Header().Get("Content-Encoding"))
+
+	w = serve(h, http.MethodHead, "/ui/images/logo.svg", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Empty(t, w.Body.String())
+
+	w = serve(h, http.MethodGet, "/ui/../../etc/passwd", "")
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	w = serve(h, http.MethodGet, "/ui/settings/profile", "")
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	w = serve(h, http.MethodPost, "/ui/app.js", "")
+	assert.Equal(t, http.StatusMethodNotAllowed, w.Code)
+
+	spa := StaticHandler("/ui", fsys, WithSPAFallback())
+	w = serve(spa, http.MethodGet, "/ui/settings/profile", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "<html>root</html>", w.Body.String())
+	assert.Equal(t, "no-cache", w.Header().Get("Cache-Control"))
+
+	w = serve(spa, http.MethodGet, "/ui/missing.css", "")
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+// trackingFS records the files it opened and can hide their Seek method.
+type trackingFS struct {
+	fs.FS
+	noSeek bool
+	opened []*trackingFile
+}
+
+type trackingFile struct {
+	fs.File
+	closed bool
+}
+
+func (f *trackingFile) Close() error {
+	f.closed = true
+	return f.File.Close()
+}
+
+// seekingFile exposes Seek of the wrapped file.
+type seekingFile struct{ *trackingFile }
+
+func (f seekingFile) Seek(offset int64, whence int) (int64, error) {
+	return f.File.(io.Seeker).Seek(offset, whence)
+}
+
+func (t *trackingFS) Open(name string) (fs.File, error) {
+	f, err := t.FS.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	tf := &trackingFile{File: f}
+	t.opened = append(t.opened, tf)
+	if t.noSeek {
+		return tf, nil
+	}
+	return seekingFile{tf}, nil
+}
+
+func TestStaticHandlerServesSeekableFilesDirectly(t *testing.T) {
+	mapFS := fstest.MapFS{"app.js": {Data: []byte("console.log(1)")}}
+	for _, noSeek := range []bool{false, true} {
+		fsys := &trackingFS{FS: mapFS, noSeek: noSeek}
+		h := &staticHandler{fsys: fsys}
+
+		content, _, err := h.open("app.js")
+		require.NoError(t, err)
+		_, buffered := content.(staticFile).ReadSeeker.(*bytes.Reader)
+		assert.Equal(t, noSeek, buffered)
+		require.NoError(t, content.Close())
+
+		r := httptest.NewRequest(http.MethodGet, "/app.js", nil)
+		r.Header.Set("Range", "bytes=8-")
+		w := httptest.NewRecorder()
+		h.serve(w, r)
+		assert.Equal(t, http.StatusPartialContent, w.Code)
+		assert.Equal(t, "log(1)", w.Body.String())
+		for _, f := range fsys.opened {
+			assert.True(t, f.closed)
+		}
+	}
+}
@@ -37,3 +37,9 @@ type Server interface {
 	Stop(context.Context) error
 	Info() ServerInfo
 }
+
+// ServiceRPCHandler is implemented by servers that apply per-service
+// settings, such as JSON marshaling options, to RPC routes.
+type ServiceRPCHandler interface {
+	ServiceRPCHandle(service, method, path string, f HandlerFunc)
+}
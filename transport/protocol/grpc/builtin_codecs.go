@@ -17,7 +17,7 @@ package grpc
 import (
 	_ "github.com/codesjoy/yggdrasil/v3/transport/protocol/grpc/encoding/gzip"
 	"github.com/codesjoy/yggdrasil/v3/transport/protocol/grpc/encoding/jsonraw"
-	_ "github.com/codesjoy/yggdrasil/v3/transport/protocol/grpc/encoding/proto"
+	"github.com/codesjoy/yggdrasil/v3/transport/protocol/grpc/encoding/proto"
 	"github.com/codesjoy/yggdrasil/v3/transport/protocol/grpc/encoding/raw"
 )
 
@@ -25,4 +25,5 @@ import (
 func ConfigureBuiltinCodecs() {
 	raw.RegisterCodec()
 	jsonraw.RegisterCodec()
+	registerSizeCheckingCodecs(proto.Name, raw.Name, jsonraw.Name)
 }
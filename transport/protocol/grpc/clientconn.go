@@ -22,6 +22,7 @@ import (
 	"math"
 	"net"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	ggrpc "google.golang.org/grpc"
@@ -30,6 +31,7 @@ import (
 	gmetadata "google.golang.org/grpc/metadata"
 
 	"github.com/codesjoy/yggdrasil/v3/discovery/resolver"
+	"github.com/codesjoy/yggdrasil/v3/internal/backoff"
 	"github.com/codesjoy/yggdrasil/v3/observability/stats"
 	"github.com/codesjoy/yggdrasil/v3/rpc/metadata"
 	"github.com/codesjoy/yggdrasil/v3/rpc/stream"
@@ -75,6 +77,10 @@ func ClientProviderWithSettings(
 				cfg = &serviceCfg
 			}
 			cfg.setDefault(serviceName)
+			attrs := endpoint.GetAttributes()
+			if network, _ := attrs[resolver.AttrNetwork].(string); network != "" {
+				cfg.Network = network
+			}
 
 			dialOpts, err := buildClientDialOptionsWithProfiles(
 				cfg,
@@ -85,20 +91,37 @@ func ClientProviderWithSettings(
 			if err != nil {
 				return nil, err
 			}
-			conn, err := ggrpc.NewClient(grpcTargetForEndpoint(endpoint.GetAddress()), dialOpts...)
-			if err != nil {
-				return nil, err
+			target := grpcTargetForEndpoint(endpoint.GetAddress())
+			conns := make([]*ggrpc.ClientConn, 0, max(cfg.ConnsPerEndpoint, 1))
+			for range cap(conns) {
+				conn, err := ggrpc.NewClient(target, dialOpts...)
+				if err != nil {
+					for _, item := range conns {
+						_ = item.Close()
+					}
+					return nil, err
+				}
+				conns = append(conns, conn)
 			}
 
 			cc := &clientConn{
 				cfg:           cfg,
-				conn:          conn,
-				state:         remoteStateFromConnectivity(conn.GetState()),
+				conn:          conns[0],
+				state:         remoteStateFromConnectivity(conns[0].GetState()),
 				endpoint:      endpoint,
 				onStateChange: onStateChange,
 			}
 			cc.ctx, cc.cancel = context.WithCancel(ctx)
-			go cc.watchConnectivity()
+			if len(conns) == 1 {
+				go cc.watchConnectivity()
+				return cc, nil
+			}
+			cc.pool = conns
+			cc.poolStates = make([]gresolver.State, len(conns))
+			for i, conn := range conns {
+				cc.poolStates[i] = conn.GetState()
+				go cc.watchPoolConnectivity(i)
+			}
 			return cc, nil
 		},
 	)
@@ -115,6 +138,13 @@ type ClientConfig struct {
 	BackOffMaxDelay   time.Duration          `mapstructure:"back_off_max_delay"  default:"5s"`
 	MinConnectTimeout time.Duration          `mapstructure:"min_connect_timeout" default:"1s"`
 	Network           string                 `mapstructure:"network"             default:"tcp"`
+	// Backoff replaces the reconnect backoff, BackOffMaxDelay included.
+	// Unset fields take the backoff defaults.
+	Backoff *backoff.Config `mapstructure:"backoff"`
+	// ConnsPerEndpoint opens several connections to each endpoint and spreads
+	// streams across the ready ones, lifting the per-connection flow-control
+	// and concurrent-stream limits for high-QPS clients.
+	ConnsPerEndpoint int `mapstructure:"conns_per_endpoint" default:"1"`
 }
 
 func (cfg *ClientConfig) setDefault(serviceName string) {
@@ -146,6 +176,12 @@ type clientConn struct {
 	state    remote.State
 	endpoint resolver.Endpoint
 
+	// pool holds every connection, conn included, when more than one
+	// connection per endpoint is configured. poolStates is guarded by mu.
+	pool       []*ggrpc.ClientConn
+	poolStates []gresolver.State
+	next       atomic.Uint32
+
 	onStateChange remote.OnStateChange
 }
 
@@ -203,11 +239,16 @@ func buildClientDialOptionsWithProfiles(
 	if cfg.Transport.KeepaliveParams != (gkeepalive.ClientParameters{}) {
 		opts = append(opts, ggrpc.WithKeepaliveParams(cfg.Transport.KeepaliveParams))
 	}
-	if cfg.Transport.InitialWindowSize > 0 {
-		opts = append(opts, ggrpc.WithInitialWindowSize(cfg.Transport.InitialWindowSize))
-	}
-	if cfg.Transport.InitialConnWindowSize > 0 {
-		opts = append(opts, ggrpc.WithInitialConnWindowSize(cfg.Transport.InitialConnWindowSize))
+	windows := resolveFlowWindows(
+		cfg.Transport.InitialWindowSize,
+		cfg.Transport.InitialConnWindowSize,
+		cfg.Transport.DynamicWindow,
+	)
+	if windows.static {
+		opts = append(opts,
+			ggrpc.WithStaticStreamWindowSize(windows.stream),
+			ggrpc.WithStaticConnWindowSize(windows.conn),
+		)
 	}
 	if cfg.Transport.WriteBufferSize > 0 {
 		opts = append(opts, ggrpc.WithWriteBufferSize(cfg.Transport.WriteBufferSize))
@@ -246,6 +287,72 @@ func (cc *clientConn) watchConnectivity() {
 	}
 }
 
+func (cc *clientConn) watchPoolConnectivity(idx int) {
+	conn := cc.pool[idx]
+	state := conn.GetState()
+	for state != gresolver.Shutdown {
+		if !conn.WaitForStateChange(cc.ctx, state) {
+			return
+		}
+		state = conn.GetState()
+
+		cc.mu.Lock()
+		cc.poolStates[idx] = state
+		aggregate := aggregateConnectivity(cc.poolStates)
+		var connErr error
+		if aggregate == gresolver.TransientFailure {
+			connErr = errors.New("grpc connection pool entered transient failure")
+		}
+		if cc.state != remote.Shutdown {
+			cc.changeStateUnlock(remoteStateFromConnectivity(aggregate), connErr)
+		}
+		cc.mu.Unlock()
+	}
+}
+
+// aggregateConnectivity reports the pool as ready when any connection is.
+func aggregateConnectivity(states []gresolver.State) gresolver.State {
+	var connecting, idle, shutdown int
+	for _, state := range states {
+		switch state {
+		case gresolver.Ready:
+			return gresolver.Ready
+		case gresolver.Connecting:
+			connecting++
+		case gresolver.Idle:
+			idle++
+		case gresolver.Shutdown:
+			shutdown++
+		}
+	}
+	switch {
+	case connecting > 0:
+		return gresolver.Connecting
+	case idle > 0:
+		return gresolver.Idle
+	case shutdown == len(states):
+		return gresolver.Shutdown
+	default:
+		return gresolver.TransientFailure
+	}
+}
+
+// pick returns the connection for a new stream, assigning streams round-robin
+// across ready pool members and falling back to plain round-robin.
+func (cc *clientConn) pick() *ggrpc.ClientConn {
+	if len(cc.pool) == 0 {
+		return cc.conn
+	}
+	start := int(cc.next.Add(1) - 1)
+	for i := range cc.pool {
+		conn := cc.pool[(start+i)%len(cc.pool)]
+		if conn.GetState() == gresolver.Ready {
+			return conn
+		}
+	}
+	return cc.pool[start%len(cc.pool)]
+}
+
 func (cc *clientConn) NewStream(
 	ctx context.Context,
 	desc *stream.Desc,
@@ -257,6 +364,15 @@ func (cc *clientConn) NewStream(
 	c := defaultCallInfo()
 	c.maxSendMessageSize = &cc.cfg.MaxSendMsgSize
 	c.maxReceiveMessageSize = &cc.cfg.MaxRecvMsgSize
+	compressor := cc.cfg.Compressor
+	if overrides, ok := remote.CallOptionsFromContext(ctx); ok {
+		if overrides.MaxRecvMsgSize > 0 {
+			c.maxReceiveMessageSize = &overrides.MaxRecvMsgSize
+		}
+		if overrides.Compressor != "" {
+			compressor = overrides.Compressor
+		}
+	}
 	if err := applyCallOptions(c, callOptionsFromContext(ctx)); err != nil {
 		return nil, err
 	}
@@ -274,15 +390,15 @@ func (cc *clientConn) NewStream(
 	if c.forceCodec && c.codec != nil {
 		callOpts = append(callOpts, ggrpc.ForceCodecV2(grpcCodecV2ForLocal(c.codec)))
 	}
-	if cc.cfg.Compressor != "" && cc.cfg.Compressor != encoding.Identity {
-		callOpts = append(callOpts, ggrpc.UseCompressor(cc.cfg.Compressor))
+	if compressor != "" && compressor != encoding.Identity {
+		callOpts = append(callOpts, ggrpc.UseCompressor(compressor))
 	}
 
 	if md, ok := metadata.FromOutContext(ctx); ok {
 		ctx = gmetadata.NewOutgoingContext(ctx, toGRPCMetadata(md))
 	}
 
-	grpcStream, err := cc.conn.NewStream(
+	grpcStream, err := cc.pick().NewStream(
 		ctx,
 		&ggrpc.StreamDesc{
 			StreamName:    desc.StreamName,
@@ -311,7 +427,16 @@ func (cc *clientConn) Close() error {
 	cc.mu.Unlock()
 
 	cc.cancel()
-	return cc.conn.Close()
+	if len(cc.pool) == 0 {
+		return cc.conn.Close()
+	}
+	var multiErr error
+	for _, conn := range cc.pool {
+		if err := conn.Close(); err != nil {
+			multiErr = errors.Join(multiErr, err)
+		}
+	}
+	return multiErr
 }
 
 func (cc *clientConn) Protocol() string {
@@ -325,7 +450,24 @@ func (cc *clientConn) State() remote.State {
 }
 
 func (cc *clientConn) Connect() {
-	cc.conn.Connect()
+	if len(cc.pool) == 0 {
+		cc.conn.Connect()
+		return
+	}
+	for _, conn := range cc.pool {
+		conn.Connect()
+	}
+}
+
+// ResetBackoff makes the connections in backoff reconnect immediately.
+func (cc *clientConn) ResetBackoff() {
+	if len(cc.pool) == 0 {
+		cc.conn.ResetConnectBackoff()
+		return
+	}
+	for _, conn := range cc.pool {
+		conn.ResetConnectBackoff()
+	}
 }
 
 func (cc *clientConn) changeStateUnlock(s remote.State, connErr error) {
@@ -27,9 +27,11 @@ import (
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	ggrpc "google.golang.org/grpc"
+	gresolver "google.golang.org/grpc/connectivity"
 	gkeepalive "google.golang.org/grpc/keepalive"
 	gmetadata "google.golang.org/grpc/metadata"
 
+	"github.com/codesjoy/yggdrasil/v3/discovery/resolver"
 	"github.com/codesjoy/yggdrasil/v3/observability/stats"
 	"github.com/codesjoy/yggdrasil/v3/rpc/metadata"
 	"github.com/codesjoy/yggdrasil/v3/rpc/stream"
@@ -325,6 +327,48 @@ func TestBuildClientDialOptions_WithInitialConnWindowSize(t *testing.T) {
 	require.NotEmpty(t, opts)
 }
 
+func TestBuildClientDialOptions_DynamicWindowSkipsStaticWindows(t *testing.T) {
+	static := &ClientConfig{
+		Transport: ClientTransportOptions{
+			InitialWindowSize:     1 << 20,
+			InitialConnWindowSize: 1 << 21,
+		},
+	}
+	static.setDefault("test-svc")
+	staticOpts, err := buildClientDialOptions(static, "test-svc", nil)
+	require.NoError(t, err)
+
+	dynamic := &ClientConfig{
+		Transport: ClientTransportOptions{
+			InitialWindowSize:     1 << 20,
+			InitialConnWindowSize: 1 << 21,
+			DynamicWindow:         ptr(true),
+		},
+	}
+	dynamic.setDefault("test-svc")
+	dynamicOpts, err := buildClientDialOptions(dynamic, "test-svc", nil)
+	require.NoError(t, err)
+
+	assert.Len(t, dynamicOpts, len(staticOpts)-2)
+
+	fixed := &ClientConfig{Transport: ClientTransportOptions{DynamicWindow: ptr(false)}}
+	fixed.setDefault("test-svc")
+	fixedOpts, err := buildClientDialOptions(fixed, "test-svc", nil)
+	require.NoError(t, err)
+	assert.Len(t, fixedOpts, len(staticOpts), "fixed windows disable BDP estimation")
+}
+
+func TestResolveFlowWindows(t *testing.T) {
+	assert.Equal(t, flowWindows{}, resolveFlowWindows(0, 0, nil))
+	assert.Equal(t,
+		flowWindows{static: true, stream: 1 << 20, conn: defaultWindowSize},
+		resolveFlowWindows(1<<20, 0, nil))
+	assert.Equal(t, flowWindows{}, resolveFlowWindows(1<<20, 1<<21, ptr(true)))
+	assert.Equal(t,
+		flowWindows{static: true, stream: defaultWindowSize, conn: defaultWindowSize},
+		resolveFlowWindows(0, 0, ptr(false)))
+}
+
 func TestBuildClientDialOptions_WithMaxHeaderListSize(t *testing.T) {
 	maxHdr := uint32(8192)
 	cfg := &ClientConfig{
@@ -820,3 +864,69 @@ func TestClientConn_CreateViaProvider(t *testing.T) {
 // ---------------------------------------------------------------------------
 
 var _ = fmt.Sprintf
+
+// ---------------------------------------------------------------------------
+// connection pool tests
+// ---------------------------------------------------------------------------
+
+func TestClientProviderWithSettings_ConnsPerEndpoint(t *testing.T) {
+	provider := ClientProviderWithSettings(Settings{
+		Client: ClientConfig{ConnsPerEndpoint: 3},
+	}, nil)
+	cli, err := provider.NewClient(
+		context.Background(),
+		"test-svc",
+		resolver.BaseEndpoint{Address: "127.0.0.1:0", Protocol: Protocol},
+		nil,
+		nil,
+	)
+	require.NoError(t, err)
+	cc := cli.(*clientConn)
+	require.Len(t, cc.pool, 3)
+	assert.Same(t, cc.pool[0], cc.conn)
+
+	// Without ready connections streams rotate over the whole pool.
+	assert.Same(t, cc.pool[0], cc.pick())
+	assert.Same(t, cc.pool[1], cc.pick())
+	assert.Same(t, cc.pool[2], cc.pick())
+	assert.Same(t, cc.pool[0], cc.pick())
+
+	require.NoError(t, cc.Close())
+	for _, conn := range cc.pool {
+		assert.Equal(t, gresolver.Shutdown, conn.GetState())
+	}
+}
+
+func TestClientConn_PickWithoutPool(t *testing.T) {
+	conn, err := ggrpc.NewClient(
+		grpcTargetForEndpoint("127.0.0.1:0"),
+		buildInsecureCreds(),
+	)
+	require.NoError(t, err)
+	defer conn.Close()
+
+	cc := &clientConn{conn: conn}
+	assert.Same(t, conn, cc.pick())
+}
+
+func TestAggregateConnectivity(t *testing.T) {
+	assert.Equal(t, gresolver.Ready, aggregateConnectivity(
+		[]gresolver.State{gresolver.TransientFailure, gresolver.Ready},
+	))
+	assert.Equal(t, gresolver.Connecting, aggregateConnectivity(
+		[]gresolver.State{gresolver.TransientFailure, gresolver.Connecting, gresolver.Idle},
+	))
+	assert.Equal(t, gresolver.Idle, aggregateConnectivity(
+		[]gresolver.State{gresolver.TransientFailure, gresolver.Idle},
+	))
+	assert.Equal(t, gresolver.TransientFailure, aggregateConnectivity(
+		[]gresolver.State{gresolver.TransientFailure, gresolver.Shutdown},
+	))
+	assert.Equal(t, gresolver.Shutdown, aggregateConnectivity(
+		[]gresolver.State{gresolver.Shutdown, gresolver.Shutdown},
+	))
+}
+
+func ptr[T any](v T) *T {
+	return &v
+}
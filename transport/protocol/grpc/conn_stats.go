@@ -0,0 +1,186 @@
+// Copyright 2022 The codesjoy Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package grpc
+
+import (
+	"context"
+	"net"
+	"sync/atomic"
+	"time"
+
+	gstats "google.golang.org/grpc/stats"
+
+	"github.com/codesjoy/yggdrasil/v3/internal/xsync"
+	ystats "github.com/codesjoy/yggdrasil/v3/observability/stats"
+)
+
+type (
+	connStatsKey struct{}
+	rpcConnKey   struct{}
+)
+
+// connStats accounts the traffic of one transport connection. ctx is the
+// context returned by the handler's TagChannel; connection events derived
+// from RPC events are reported with it so handlers find their channel state.
+type connStats struct {
+	ctx      context.Context
+	key      string
+	begin    time.Time
+	bytesIn  atomic.Int64
+	bytesOut atomic.Int64
+	streams  atomic.Int64
+	active   atomic.Int64
+}
+
+// rpcConn binds an RPC attempt to the connection carrying it. Servers know
+// the connection when the RPC is tagged; clients learn it from the local
+// address of the outbound header.
+type rpcConn struct {
+	conn  atomic.Pointer[connStats]
+	begun atomic.Bool
+	ended atomic.Bool
+}
+
+// connRegistry finds client connections by address, as grpc-go does not
+// derive client RPC contexts from the connection context.
+type connRegistry struct {
+	conns xsync.Map[string, *connStats]
+}
+
+func connKey(local, remote net.Addr) string {
+	if local == nil {
+		return ""
+	}
+	return addrString(local) + "|" + addrString(remote)
+}
+
+func (b *statsHandlerBridge) tagConn(
+	ctx context.Context,
+	info *gstats.ConnTagInfo,
+) context.Context {
+	cs := &connStats{ctx: ctx, key: connKey(info.LocalAddr, info.RemoteAddr), begin: time.Now()}
+	if cs.key != "" {
+		b.conns.conns.Store(cs.key, cs)
+	}
+	return context.WithValue(ctx, connStatsKey{}, cs)
+}
+
+func (b *statsHandlerBridge) tagRPC(ctx context.Context) context.Context {
+	rc := &rpcConn{}
+	if cs, ok := ctx.Value(connStatsKey{}).(*connStats); ok {
+		rc.conn.Store(cs)
+	}
+	return context.WithValue(ctx, rpcConnKey{}, rc)
+}
+
+func (b *statsHandlerBridge) connBegin(ctx context.Context, client bool) {
+	begin := &ystats.ChanBeginBase{Client: client}
+	if cs, ok := ctx.Value(connStatsKey{}).(*connStats); ok {
+		begin.BeginTime = cs.begin
+	}
+	b.handler.HandleChannel(ctx, begin)
+}
+
+func (b *statsHandlerBridge) connEnd(ctx context.Context, client bool) {
+	end := &ystats.ChanEndBase{Client: client, EndTime: time.Now()}
+	if cs, ok := ctx.Value(connStatsKey{}).(*connStats); ok {
+		if cs.key != "" {
+			b.conns.conns.Delete(cs.key)
+		}
+		end.BeginTime = cs.begin
+		end.BytesIn = cs.bytesIn.Load()
+		end.BytesOut = cs.bytesOut.Load()
+		end.Streams = cs.streams.Load()
+	}
+	b.handler.HandleChannel(ctx, end)
+}
+
+// account attributes the wire bytes and stream lifecycle of an RPC event to
+// its connection. Outbound header sizes are not reported by grpc-go, so the
+// outbound count covers messages and trailers only.
+func (b *statsHandlerBridge) account(ctx context.Context, rs gstats.RPCStats) {
+	rc, ok := ctx.Value(rpcConnKey{}).(*rpcConn)
+	if !ok {
+		return
+	}
+	switch s := rs.(type) {
+	case *gstats.OutHeader:
+		if s.Client {
+			if rc.conn.Load() == nil {
+				if cs, ok := b.conns.conns.Load(connKey(s.LocalAddr, s.RemoteAddr)); ok {
+					rc.conn.Store(cs)
+				}
+			}
+			b.streamBegin(rc, true)
+		}
+	case *gstats.InHeader:
+		if !s.Client {
+			b.streamBegin(rc, false)
+		}
+		b.bytesIn(rc, s.Client, s.WireLength)
+	case *gstats.InPayload:
+		b.bytesIn(rc, s.Client, s.WireLength)
+	case *gstats.InTrailer:
+		b.bytesIn(rc, s.Client, s.WireLength)
+	case *gstats.OutPayload:
+		b.bytesOut(rc, s.Client, s.WireLength)
+	case *gstats.OutTrailer:
+		b.bytesOut(rc, s.Client, s.WireLength) //nolint:staticcheck // SA1019: only size available
+	case *gstats.End:
+		b.streamEnd(rc, s.Client)
+	}
+}
+
+func (b *statsHandlerBridge) streamBegin(rc *rpcConn, client bool) {
+	cs := rc.conn.Load()
+	if cs == nil || !rc.begun.CompareAndSwap(false, true) {
+		return
+	}
+	cs.streams.Add(1)
+	b.handler.HandleChannel(cs.ctx, &ystats.ChanStreamsBase{
+		Client:        client,
+		Begin:         true,
+		ActiveStreams: cs.active.Add(1),
+	})
+}
+
+func (b *statsHandlerBridge) streamEnd(rc *rpcConn, client bool) {
+	cs := rc.conn.Load()
+	if cs == nil || !rc.begun.Load() || !rc.ended.CompareAndSwap(false, true) {
+		return
+	}
+	b.handler.HandleChannel(cs.ctx, &ystats.ChanStreamsBase{
+		Client:        client,
+		ActiveStreams: cs.active.Add(-1),
+	})
+}
+
+func (b *statsHandlerBridge) bytesIn(rc *rpcConn, client bool, n int) {
+	cs := rc.conn.Load()
+	if cs == nil || n <= 0 {
+		return
+	}
+	cs.bytesIn.Add(int64(n))
+	b.handler.HandleChannel(cs.ctx, &ystats.ChanInPayloadBase{Client: client, TransportSize: n})
+}
+
+func (b *statsHandlerBridge) bytesOut(rc *rpcConn, client bool, n int) {
+	cs := rc.conn.Load()
+	if cs == nil || n <= 0 {
+		return
+	}
+	cs.bytesOut.Add(int64(n))
+	b.handler.HandleChannel(cs.ctx, &ystats.ChanOutPayloadBase{Client: client, TransportSize: n})
+}
@@ -0,0 +1,122 @@
+// Copyright 2022 The codesjoy Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package grpc
+
+import (
+	"context"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	gstats "google.golang.org/grpc/stats"
+
+	"github.com/codesjoy/yggdrasil/v3/observability/stats"
+)
+
+type chanRecorder struct {
+	recordingHandler
+	mu     sync.Mutex
+	events []stats.ChanStats
+}
+
+func (h *chanRecorder) HandleChannel(_ context.Context, cs stats.ChanStats) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.events = append(h.events, cs)
+}
+
+func (h *chanRecorder) last() stats.ChanStats {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.events[len(h.events)-1]
+}
+
+func TestStatsHandlerBridge_ServerConnStats(t *testing.T) {
+	h := &chanRecorder{}
+	b := &statsHandlerBridge{handler: h}
+	connCtx := b.TagConn(context.Background(), &gstats.ConnTagInfo{
+		RemoteAddr: &net.TCPAddr{IP: net.ParseIP("10.0.0.1"), Port: 40000},
+		LocalAddr:  &net.TCPAddr{IP: net.ParseIP("10.0.0.2"), Port: 9000},
+	})
+	b.HandleConn(connCtx, &gstats.ConnBegin{})
+	begin, ok := h.last().(stats.ChanBegin)
+	require.True(t, ok)
+	assert.False(t, begin.GetBeginTime().IsZero())
+
+	for i := 0; i < 2; i++ {
+		ctx := b.TagRPC(connCtx, &gstats.RPCTagInfo{FullMethodName: "/svc/Method"})
+		b.HandleRPC(ctx, &gstats.InHeader{WireLength: 10})
+		in, ok := h.last().(stats.ChanInPayload)
+		require.True(t, ok)
+		assert.Equal(t, 10, in.GetTransportSize())
+		b.HandleRPC(ctx, &gstats.InPayload{WireLength: 100})
+		b.HandleRPC(ctx, &gstats.OutPayload{WireLength: 50})
+		b.HandleRPC(ctx, &gstats.End{BeginTime: time.Now(), EndTime: time.Now()})
+		b.HandleRPC(ctx, &gstats.End{BeginTime: time.Now(), EndTime: time.Now()})
+		ended, ok := h.last().(stats.ChanStreams)
+		require.True(t, ok)
+		assert.False(t, ended.IsBegin())
+		assert.Zero(t, ended.GetActiveStreams())
+	}
+
+	b.HandleConn(connCtx, &gstats.ConnEnd{})
+	end, ok := h.last().(stats.ChanEnd)
+	require.True(t, ok)
+	assert.Equal(t, int64(220), end.GetBytesIn())
+	assert.Equal(t, int64(100), end.GetBytesOut())
+	assert.Equal(t, int64(2), end.GetStreams())
+	assert.False(t, end.GetEndTime().Before(end.GetBeginTime()))
+}
+
+func TestStatsHandlerBridge_ClientConnStats(t *testing.T) {
+	h := &chanRecorder{}
+	b := &statsHandlerBridge{handler: h}
+	local := &net.TCPAddr{IP: net.ParseIP("10.0.0.1"), Port: 40000}
+	remote := &net.TCPAddr{IP: net.ParseIP("10.0.0.2"), Port: 9000}
+	connCtx := b.TagConn(context.Background(), &gstats.ConnTagInfo{
+		RemoteAddr: remote,
+		LocalAddr:  local,
+	})
+	b.HandleConn(connCtx, &gstats.ConnBegin{Client: true})
+
+	// Client RPC contexts are not derived from the connection context.
+	ctx := b.TagRPC(context.Background(), &gstats.RPCTagInfo{FullMethodName: "/svc/Method"})
+	b.HandleRPC(ctx, &gstats.Begin{Client: true})
+	b.HandleRPC(ctx, &gstats.OutHeader{Client: true, LocalAddr: local, RemoteAddr: remote})
+	started, ok := h.last().(stats.ChanStreams)
+	require.True(t, ok)
+	assert.True(t, started.IsBegin())
+	assert.True(t, started.IsClient())
+	assert.Equal(t, int64(1), started.GetActiveStreams())
+
+	b.HandleRPC(ctx, &gstats.OutPayload{Client: true, WireLength: 30})
+	out, ok := h.last().(stats.ChanOutPayload)
+	require.True(t, ok)
+	assert.Equal(t, 30, out.GetTransportSize())
+	b.HandleRPC(ctx, &gstats.InPayload{Client: true, WireLength: 70})
+	b.HandleRPC(ctx, &gstats.End{Client: true})
+
+	b.HandleConn(connCtx, &gstats.ConnEnd{Client: true})
+	end, ok := h.last().(stats.ChanEnd)
+	require.True(t, ok)
+	assert.Equal(t, int64(70), end.GetBytesIn())
+	assert.Equal(t, int64(30), end.GetBytesOut())
+	assert.Equal(t, int64(1), end.GetStreams())
+	_, ok = b.conns.conns.Load(connKey(local, remote))
+	assert.False(t, ok, "closed connections are forgotten")
+}
@@ -15,6 +15,7 @@
 package grpc
 
 import (
+	"cmp"
 	"context"
 	"errors"
 	"fmt"
@@ -38,6 +39,7 @@ import (
 
 	"github.com/codesjoy/pkg/basic/xerror"
 
+	"github.com/codesjoy/yggdrasil/v3/internal/backoff"
 	ystats "github.com/codesjoy/yggdrasil/v3/observability/stats"
 	ymetadata "github.com/codesjoy/yggdrasil/v3/rpc/metadata"
 	ystatus "github.com/codesjoy/yggdrasil/v3/rpc/status"
@@ -48,6 +50,8 @@ import (
 	"github.com/codesjoy/yggdrasil/v3/transport/support/security"
 )
 
+// toGRPCMetadata keeps -bin values as raw bytes; grpc-go base64 encodes them
+// on the wire and decodes them again for fromGRPCMetadata.
 func toGRPCMetadata(md ymetadata.MD) gmetadata.MD {
 	if len(md) == 0 {
 		return nil
@@ -144,7 +148,9 @@ func grpcConnectParams(cfg *ClientConfig) ggrpc.ConnectParams {
 		},
 		MinConnectTimeout: minConnectTimeout,
 	}
-	if cfg.BackOffMaxDelay > 0 {
+	if cfg.Backoff != nil {
+		params.Backoff = grpcBackoffConfig(*cfg.Backoff)
+	} else if cfg.BackOffMaxDelay > 0 {
 		params.Backoff.MaxDelay = cfg.BackOffMaxDelay
 	}
 	if cfg.MinConnectTimeout > 0 {
@@ -153,6 +159,15 @@ func grpcConnectParams(cfg *ClientConfig) ggrpc.ConnectParams {
 	return params
 }
 
+func grpcBackoffConfig(cfg backoff.Config) gbackoff.Config {
+	return gbackoff.Config{
+		BaseDelay:  cmp.Or(cfg.BaseDelay, backoff.DefaultConfig.BaseDelay),
+		Multiplier: cmp.Or(cfg.Multiplier, backoff.DefaultConfig.Multiplier),
+		Jitter:     cmp.Or(cfg.Jitter, backoff.DefaultConfig.Jitter),
+		MaxDelay:   cmp.Or(cfg.MaxDelay, backoff.DefaultConfig.MaxDelay),
+	}
+}
+
 type grpcAuthInfo struct {
 	base security.AuthInfo
 }
@@ -320,6 +335,7 @@ func fromGRPCPeer(p *gpeer.Peer, protocol string) *peer.Peer {
 
 type statsHandlerBridge struct {
 	handler ystats.Handler
+	conns   connRegistry
 }
 
 func newStatsHandlerBridge(handler ystats.Handler) gstats.Handler {
@@ -333,10 +349,12 @@ func (b *statsHandlerBridge) TagRPC(ctx context.Context, info *gstats.RPCTagInfo
 	if info == nil {
 		return ctx
 	}
-	return b.handler.TagRPC(ctx, &ystats.RPCTagInfoBase{FullMethod: info.FullMethodName})
+	ctx = b.handler.TagRPC(ctx, &ystats.RPCTagInfoBase{FullMethod: info.FullMethodName})
+	return b.tagRPC(ctx)
 }
 
 func (b *statsHandlerBridge) HandleRPC(ctx context.Context, rs gstats.RPCStats) {
+	defer b.account(ctx, rs)
 	switch s := rs.(type) {
 	case *gstats.Begin:
 		b.handler.HandleRPC(ctx, &ystats.RPCBeginBase{
@@ -400,10 +418,14 @@ func (b *statsHandlerBridge) HandleRPC(ctx context.Context, rs gstats.RPCStats)
 			TransportSize: s.WireLength, //nolint:staticcheck // SA1019: WireLength is the only available field for transport size in OutTrailer
 		})
 	case *gstats.InPayload:
+		payload := s.Payload
+		if m, ok := payload.(*sizeCheckedMessage); ok {
+			payload = m.msg
+		}
 		b.handler.HandleRPC(ctx, &stats2.InPayload{
 			RPCInPayloadBase: ystats.RPCInPayloadBase{
 				Client:        s.Client,
-				Payload:       s.Payload,
+				Payload:       payload,
 				TransportSize: s.WireLength,
 				RecvTime:      s.RecvTime,
 				Protocol:      Protocol,
@@ -439,19 +461,20 @@ func (b *statsHandlerBridge) TagConn(
 	if info == nil {
 		return ctx
 	}
-	return b.handler.TagChannel(ctx, &ystats.ChanTagInfoBase{
+	ctx = b.handler.TagChannel(ctx, &ystats.ChanTagInfoBase{
 		RemoteEndpoint: addrString(info.RemoteAddr),
 		LocalEndpoint:  addrString(info.LocalAddr),
 		Protocol:       Protocol,
 	})
+	return b.tagConn(ctx, info)
 }
 
 func (b *statsHandlerBridge) HandleConn(ctx context.Context, cs gstats.ConnStats) {
 	switch s := cs.(type) {
 	case *gstats.ConnBegin:
-		b.handler.HandleChannel(ctx, &ystats.ChanBeginBase{Client: s.Client})
+		b.connBegin(ctx, s.Client)
 	case *gstats.ConnEnd:
-		b.handler.HandleChannel(ctx, &ystats.ChanEndBase{Client: s.Client})
+		b.connEnd(ctx, s.Client)
 	}
 }
 
@@ -473,6 +496,41 @@ type ClientTransportOptions struct {
 	WriteBufferSize       int                         `mapstructure:"write_buffer_size"`
 	ReadBufferSize        int                         `mapstructure:"read_buffer_size"`
 	MaxHeaderListSize     *uint32                     `mapstructure:"max_header_list_size"`
+	// DynamicWindow turns BDP-based flow control, which grows the windows to
+	// match the bandwidth-delay product of the link, on or off. grpc-go
+	// cannot combine it with fixed windows: true ignores InitialWindowSize
+	// and InitialConnWindowSize, false keeps the windows fixed at their
+	// configured or default 64KB size. Unset, BDP estimation runs unless a
+	// window size is set.
+	DynamicWindow *bool `mapstructure:"dynamic_window"`
+}
+
+// defaultWindowSize is the HTTP/2 initial window size, also the smallest
+// window grpc-go accepts.
+const defaultWindowSize = 65535
+
+// flowWindows is the flow control resolved from the window options.
+type flowWindows struct {
+	// static disables BDP estimation in favor of the stream and conn windows.
+	static       bool
+	stream, conn int32
+}
+
+func resolveFlowWindows(stream, conn int32, dynamic *bool) flowWindows {
+	var static bool
+	if dynamic == nil {
+		static = stream > 0 || conn > 0
+	} else {
+		static = !*dynamic
+	}
+	if !static {
+		return flowWindows{}
+	}
+	return flowWindows{
+		static: true,
+		stream: max(stream, defaultWindowSize),
+		conn:   max(conn, defaultWindowSize),
+	}
 }
 
 func buildIncomingContext(ctx context.Context) context.Context {
@@ -26,6 +26,8 @@ import (
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"google.golang.org/genproto/googleapis/rpc/code"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	ggrpc "google.golang.org/grpc"
 	gcodes "google.golang.org/grpc/codes"
 	gconnectivity "google.golang.org/grpc/connectivity"
 	gcredentials "google.golang.org/grpc/credentials"
@@ -33,7 +35,10 @@ import (
 	gpeer "google.golang.org/grpc/peer"
 	gstats "google.golang.org/grpc/stats"
 	gstatus "google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/wrapperspb"
 
+	"github.com/codesjoy/yggdrasil/v3/internal/backoff"
 	"github.com/codesjoy/yggdrasil/v3/observability/stats"
 	ymetadata "github.com/codesjoy/yggdrasil/v3/rpc/metadata"
 	ystatus "github.com/codesjoy/yggdrasil/v3/rpc/status"
@@ -53,6 +58,12 @@ func TestToGRPCMetadata(t *testing.T) {
 		require.Len(t, got, 2)
 		assert.Equal(t, []string{"val1"}, got["key1"])
 	})
+	t.Run("binary values stay raw", func(t *testing.T) {
+		md := ymetadata.MD{}
+		md.SetBinary("trace", []byte{0x00, 0xff})
+		got := toGRPCMetadata(md)
+		assert.Equal(t, []string{"\x00\xff"}, got["trace-bin"])
+	})
 }
 
 func TestFromGRPCMetadata(t *testing.T) {
@@ -65,6 +76,11 @@ func TestFromGRPCMetadata(t *testing.T) {
 		got := fromGRPCMetadata(md)
 		assert.Equal(t, []string{"val1"}, got["key-1"])
 	})
+	t.Run("binary values", func(t *testing.T) {
+		md := gmetadata.Pairs("Trace-Bin", string([]byte{0x00, 0xff}))
+		got := fromGRPCMetadata(md)
+		assert.Equal(t, [][]byte{{0x00, 0xff}}, got.GetBinary("trace"))
+	})
 }
 
 func TestRemoteStateFromConnectivity(t *testing.T) {
@@ -102,6 +118,30 @@ func TestToGRPCError(t *testing.T) {
 	})
 }
 
+func TestStatusDetailsRoundTrip(t *testing.T) {
+	st := ystatus.New(code.Code_FAILED_PRECONDITION, "not ready").
+		WithRetryInfo(time.Second).
+		WithPreconditionFailure(ystatus.PreconditionViolation("TOS", "user:1", "terms not accepted"))
+
+	got := ystatus.FromError(toRPCErr(toGRPCError(st.Err())))
+	assert.Equal(t, code.Code_FAILED_PRECONDITION, got.Code())
+	delay, ok := got.RetryDelay()
+	require.True(t, ok)
+	assert.Equal(t, time.Second, delay)
+	require.NotNil(t, got.PreconditionFailure())
+	assert.Equal(t, "TOS", got.PreconditionFailure().GetViolations()[0].GetType())
+}
+
+func TestCustomStatusDetailsRoundTrip(t *testing.T) {
+	st := ystatus.New(code.Code_ABORTED, "conflict").
+		WithDetails(wrapperspb.String("custom"))
+
+	err := toRPCErr(toGRPCError(st.Err()))
+	values := ystatus.Details[*wrapperspb.StringValue](err)
+	require.Len(t, values, 1)
+	assert.Equal(t, "custom", values[0].GetValue())
+}
+
 func TestGRPCTargetForEndpoint(t *testing.T) {
 	assert.Equal(t, "passthrough:///127.0.0.1:8080", grpcTargetForEndpoint("127.0.0.1:8080"))
 }
@@ -459,7 +499,7 @@ func TestStatsHandlerBridge_TagRPC(t *testing.T) {
 		b := &statsHandlerBridge{handler: h}
 		ctx := context.Background()
 		got := b.TagRPC(ctx, &gstats.RPCTagInfo{FullMethodName: "/test/Method"})
-		assert.Equal(t, ctx, got)
+		assert.NotNil(t, got.Value(rpcConnKey{}))
 		require.Len(t, h.rpcCalls, 1)
 		assert.Equal(t, "TagRPC", h.rpcCalls[0].method)
 	})
@@ -580,7 +620,7 @@ func TestStatsHandlerBridge_TagConn(t *testing.T) {
 			RemoteAddr: &net.TCPAddr{IP: net.ParseIP("1.2.3.4"), Port: 80},
 			LocalAddr:  &net.TCPAddr{IP: net.ParseIP("5.6.7.8"), Port: 90},
 		})
-		assert.Equal(t, ctx, got)
+		assert.NotNil(t, got.Value(connStatsKey{}))
 		require.Contains(t, h.connCalls, "TagChannel")
 	})
 }
@@ -850,3 +890,104 @@ func TestGRPCConnectParams_ZeroBackOffMaxDelay(t *testing.T) {
 	params := grpcConnectParams(cfg)
 	assert.Equal(t, 120*time.Second, params.Backoff.MaxDelay)
 }
+
+func TestGRPCConnectParams_Backoff(t *testing.T) {
+	cfg := &ClientConfig{
+		BackOffMaxDelay: 5 * time.Second,
+		Backoff: &backoff.Config{
+			BaseDelay: 100 * time.Millisecond,
+			Jitter:    0.1,
+			MaxDelay:  10 * time.Second,
+		},
+	}
+	params := grpcConnectParams(cfg)
+	assert.Equal(t, 100*time.Millisecond, params.Backoff.BaseDelay)
+	assert.Equal(t, 1.6, params.Backoff.Multiplier)
+	assert.Equal(t, 0.1, params.Backoff.Jitter)
+	assert.Equal(t, 10*time.Second, params.Backoff.MaxDelay)
+
+	cfg.Backoff = &backoff.Config{BaseDelay: 100 * time.Millisecond}
+	assert.Equal(t, 0.2, grpcConnectParams(cfg).Backoff.Jitter)
+
+	cfg.Backoff = nil
+	assert.Equal(t, 5*time.Second, grpcConnectParams(cfg).Backoff.MaxDelay)
+}
+
+// ---------------------------------------------------------------------------
+// grpc-status-details-bin interop with vanilla grpc-go peers
+// ---------------------------------------------------------------------------
+
+func TestStatusDetailsInterop_YggdrasilServer(t *testing.T) {
+	ConfigureBuiltinCodecs()
+	cfg := ServerConfig{}
+	require.NoError(t, cfg.SetDefault())
+
+	want := ystatus.NewBadRequest().Field("name", "required").Status("invalid request")
+	s := &server{
+		stoppedCh:    make(chan struct{}),
+		opts:         cfg,
+		statsHandler: stats.NoOpHandler,
+		handle: func(ss remote.ServerStream) {
+			req := &wrapperspb.StringValue{}
+			_ = ss.RecvMsg(req)
+			ss.Finish(nil, want.Err())
+		},
+	}
+	s.ctx, s.cancel = context.WithCancel(context.Background())
+	defer s.cancel()
+	s.grpcServer = ggrpc.NewServer(s.serverOptions()...)
+	require.NoError(t, s.Start())
+	defer s.grpcServer.Stop()
+	go s.Handle()
+
+	conn, err := ggrpc.NewClient(s.address, buildInsecureCreds())
+	require.NoError(t, err)
+	defer conn.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	err = conn.Invoke(
+		ctx, "/test.Service/Method", wrapperspb.String("x"), &wrapperspb.StringValue{},
+	)
+
+	gs, ok := gstatus.FromError(err)
+	require.True(t, ok)
+	assert.Equal(t, gcodes.InvalidArgument, gs.Code())
+	require.Len(t, gs.Details(), 1)
+	assert.True(t, proto.Equal(want.BadRequest(), gs.Details()[0].(proto.Message)))
+}
+
+func TestStatusDetailsInterop_GRPCGoServer(t *testing.T) {
+	gs, err := gstatus.New(gcodes.FailedPrecondition, "not ready").
+		WithDetails(&errdetails.PreconditionFailure{
+			Violations: []*errdetails.PreconditionFailure_Violation{
+				ystatus.PreconditionViolation("TOS", "user:1", "terms not accepted"),
+			},
+		})
+	require.NoError(t, err)
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	srv := ggrpc.NewServer(ggrpc.UnknownServiceHandler(func(any, ggrpc.ServerStream) error {
+		return gs.Err()
+	}))
+	go func() { _ = srv.Serve(lis) }()
+	defer srv.Stop()
+
+	conn, err := ggrpc.NewClient(lis.Addr().String(), buildInsecureCreds())
+	require.NoError(t, err)
+	defer conn.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	err = conn.Invoke(
+		ctx, "/test.Service/Method", wrapperspb.String("x"), &wrapperspb.StringValue{},
+	)
+
+	st := ystatus.FromError(toRPCErr(err))
+	assert.Equal(t, code.Code_FAILED_PRECONDITION, st.Code())
+	assert.Equal(t, "not ready", st.Message())
+	require.NotNil(t, st.PreconditionFailure())
+	assert.Equal(t, "TOS", st.PreconditionFailure().GetViolations()[0].GetType())
+
+	// A grpc-go status returned by a handler keeps its details as well.
+	st = ystatus.FromError(toRPCErr(toGRPCError(gs.Err())))
+	require.NotNil(t, st.PreconditionFailure())
+}
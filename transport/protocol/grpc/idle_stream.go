@@ -0,0 +1,295 @@
+// Copyright 2022 The codesjoy Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package grpc
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"google.golang.org/genproto/googleapis/rpc/code"
+	ggrpc "google.golang.org/grpc"
+	gmetadata "google.golang.org/grpc/metadata"
+
+	"github.com/codesjoy/yggdrasil/v3/internal/xclock"
+	"github.com/codesjoy/yggdrasil/v3/observability/stats"
+	"github.com/codesjoy/yggdrasil/v3/rpc/status"
+	"github.com/codesjoy/yggdrasil/v3/rpc/stream"
+)
+
+// Idle stream actions.
+const (
+	// IdleActionWarn logs and reports the idle stream and leaves it open.
+	IdleActionWarn = "warn"
+	// IdleActionPing signals the handler through stream.Idle to send a
+	// heartbeat, and cancels the stream if it stays idle one more timeout.
+	IdleActionPing = "ping"
+	// IdleActionCancel ends the stream with the configured status.
+	IdleActionCancel = "cancel"
+)
+
+// IdleStreamConfig cleans up streaming RPCs that exchange no messages, such
+// as bidi streams whose client crashed without closing them.
+type IdleStreamConfig struct {
+	// Timeout is how long a stream may go without a message in either
+	// direction. Zero disables the check.
+	Timeout time.Duration `mapstructure:"timeout"`
+	// Action is warn, ping or cancel. Empty means cancel.
+	Action string `mapstructure:"action"`
+	// Code is the status code name a cancelled stream ends with. Empty
+	// means CANCELLED.
+	Code string `mapstructure:"code"`
+}
+
+func (c IdleStreamConfig) validate() error {
+	switch c.Action {
+	case "", IdleActionWarn, IdleActionPing, IdleActionCancel:
+	default:
+		return fmt.Errorf("idle_stream.action: unsupported action %q", c.Action)
+	}
+	if c.Code != "" {
+		if _, ok := code.Code_value[strings.ToUpper(c.Code)]; !ok {
+			return fmt.Errorf("idle_stream.code: unknown status code %q", c.Code)
+		}
+	}
+	return nil
+}
+
+func (c IdleStreamConfig) action() string {
+	if c.Action == "" {
+		return IdleActionCancel
+	}
+	return c.Action
+}
+
+func (c IdleStreamConfig) code() code.Code {
+	if c.Code == "" {
+		return code.Code_CANCELLED
+	}
+	return code.Code(code.Code_value[strings.ToUpper(c.Code)])
+}
+
+// idleWatcher tracks the last message of a stream and applies the idle
+// action once the stream has gone quiet for the timeout.
+type idleWatcher struct {
+	cfg    IdleStreamConfig
+	method string
+	stats  stats.Handler
+	ctx    context.Context
+	clock  xclock.Clock
+
+	mu     sync.Mutex
+	timer  xclock.Timer
+	last   time.Time
+	pinged bool
+	done   bool
+
+	ping   chan struct{}
+	reaped chan error
+}
+
+func newIdleWatcher(
+	ctx context.Context,
+	cfg IdleStreamConfig,
+	method string,
+	handler stats.Handler,
+	clock xclock.Clock,
+) *idleWatcher {
+	w := &idleWatcher{
+		cfg:    cfg,
+		method: method,
+		stats:  handler,
+		ctx:    ctx,
+		clock:  clock,
+		reaped: make(chan error, 1),
+	}
+	if cfg.action() == IdleActionPing {
+		w.ping = make(chan struct{}, 1)
+	}
+	return w
+}
+
+// context exposes the ping channel to the handler through stream.Idle.
+func (w *idleWatcher) context(ctx context.Context) context.Context {
+	if w.ping == nil {
+		return ctx
+	}
+	return stream.WithIdle(ctx, w.ping)
+}
+
+// start arms the timer. Unary RPCs never start it, since a handler working
+// on its single request is not idle.
+func (w *idleWatcher) start() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.done || w.timer != nil {
+		return
+	}
+	w.last = w.clock.Now()
+	w.timer = w.clock.AfterFunc(w.cfg.Timeout, w.check)
+}
+
+// touch records a message sent or received.
+func (w *idleWatcher) touch() {
+	w.mu.Lock()
+	w.last = w.clock.Now()
+	w.pinged = false
+	w.mu.Unlock()
+}
+
+func (w *idleWatcher) stop() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.done = true
+	if w.timer != nil {
+		w.timer.Stop()
+	}
+}
+
+func (w *idleWatcher) check() {
+	w.mu.Lock()
+	if w.done {
+		w.mu.Unlock()
+		return
+	}
+	idle := w.clock.Since(w.last)
+	if idle < w.cfg.Timeout {
+		w.timer.Reset(w.cfg.Timeout - idle)
+		w.mu.Unlock()
+		return
+	}
+	action := w.cfg.action()
+	cancel := action == IdleActionCancel || (action == IdleActionPing && w.pinged)
+	if cancel {
+		w.done = true
+	} else {
+		w.timer.Reset(w.cfg.Timeout)
+		if action == IdleActionPing {
+			w.pinged = true
+			select {
+			case w.ping <- struct{}{}:
+			default:
+			}
+		}
+	}
+	w.mu.Unlock()
+
+	slog.Warn("grpc stream idle",
+		slog.String("method", w.method),
+		slog.Duration("idle", idle),
+		slog.String("action", action),
+		slog.Bool("cancelled", cancel))
+	if w.stats != nil {
+		w.stats.HandleRPC(w.ctx, &stats.RPCStreamIdleBase{
+			FullMethod: w.method,
+			Idle:       idle,
+			Action:     action,
+			Cancelled:  cancel,
+		})
+	}
+	if cancel {
+		msg := fmt.Sprintf("stream idle for %s", idle.Round(time.Millisecond))
+		w.reaped <- status.New(w.cfg.code(), msg).Err()
+	}
+}
+
+// reapGrace bounds how long a reaped stream waits for the sends already in
+// flight before the grpc handler returns.
+const reapGrace = time.Second
+
+var errStreamReaped = status.New(code.Code_CANCELLED, "stream was closed as idle").Err()
+
+// gatedStream guards the grpc stream of a watched handler, which may still
+// run after a reaped stream's grpc handler returned. Once closed, calls fail
+// without touching the grpc stream, which must not be used after its
+// handler returned.
+type gatedStream struct {
+	ggrpc.ServerStream
+
+	mu     sync.RWMutex
+	closed atomic.Bool
+}
+
+func (g *gatedStream) enter() bool {
+	g.mu.RLock()
+	if g.closed.Load() {
+		g.mu.RUnlock()
+		return false
+	}
+	return true
+}
+
+func (g *gatedStream) SendMsg(m any) error {
+	if !g.enter() {
+		return errStreamReaped
+	}
+	defer g.mu.RUnlock()
+	return g.ServerStream.SendMsg(m)
+}
+
+func (g *gatedStream) SetHeader(md gmetadata.MD) error {
+	if !g.enter() {
+		return errStreamReaped
+	}
+	defer g.mu.RUnlock()
+	return g.ServerStream.SetHeader(md)
+}
+
+func (g *gatedStream) SendHeader(md gmetadata.MD) error {
+	if !g.enter() {
+		return errStreamReaped
+	}
+	defer g.mu.RUnlock()
+	return g.ServerStream.SendHeader(md)
+}
+
+func (g *gatedStream) SetTrailer(md gmetadata.MD) {
+	if !g.enter() {
+		return
+	}
+	defer g.mu.RUnlock()
+	g.ServerStream.SetTrailer(md)
+}
+
+// RecvMsg does not hold the gate: a receive blocked on a quiet client is
+// what returning from the reaped grpc handler unblocks.
+func (g *gatedStream) RecvMsg(m any) error {
+	if g.closed.Load() {
+		return errStreamReaped
+	}
+	return g.ServerStream.RecvMsg(m)
+}
+
+// close fails later calls and waits up to grace for the running sends. A
+// send still blocked after grace fails once the grpc stream ends.
+func (g *gatedStream) close(clock xclock.Clock, grace time.Duration) {
+	g.closed.Store(true)
+	drained := make(chan struct{})
+	go func() {
+		g.mu.Lock()
+		g.mu.Unlock() //nolint:staticcheck // waits for the running calls
+		close(drained)
+	}()
+	timer := clock.NewTimer(grace)
+	defer timer.Stop()
+	select {
+	case <-drained:
+	case <-timer.C():
+	}
+}
@@ -0,0 +1,273 @@
+// Copyright 2022 The codesjoy Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package grpc
+
+import (
+	"context"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/genproto/googleapis/rpc/code"
+	ggrpc "google.golang.org/grpc"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+
+	"github.com/codesjoy/yggdrasil/v3/internal/xclock"
+	"github.com/codesjoy/yggdrasil/v3/observability/stats"
+	"github.com/codesjoy/yggdrasil/v3/rpc/status"
+	"github.com/codesjoy/yggdrasil/v3/rpc/stream"
+	remote "github.com/codesjoy/yggdrasil/v3/transport"
+)
+
+type idleRecorder struct {
+	recordingHandler
+	mu     sync.Mutex
+	events []stats.RPCStreamIdle
+}
+
+func (h *idleRecorder) HandleRPC(_ context.Context, rs stats.RPCStats) {
+	if ev, ok := rs.(stats.RPCStreamIdle); ok {
+		h.mu.Lock()
+		h.events = append(h.events, ev)
+		h.mu.Unlock()
+	}
+}
+
+func (h *idleRecorder) snapshot() []stats.RPCStreamIdle {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return append([]stats.RPCStreamIdle(nil), h.events...)
+}
+
+// serveIdle serves every method as a bidi stream through handleUnknown and
+// returns a stream opened against it.
+func serveIdle(
+	t *testing.T,
+	cfg IdleStreamConfig,
+	handler stats.Handler,
+	handle remote.MethodHandle,
+) ggrpc.ClientStream {
+	t.Helper()
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	s := &server{opts: ServerConfig{IdleStream: cfg}, statsHandler: handler, handle: handle}
+	svr := ggrpc.NewServer(ggrpc.UnknownServiceHandler(func(_ any, ss ggrpc.ServerStream) error {
+		return s.handleUnknown(ss)
+	}))
+	go func() { _ = svr.Serve(lis) }()
+	t.Cleanup(svr.Stop)
+
+	conn, err := ggrpc.NewClient(lis.Addr().String(), buildInsecureCreds())
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = conn.Close() })
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	t.Cleanup(cancel)
+	desc := &ggrpc.StreamDesc{ClientStreams: true, ServerStreams: true}
+	cs, err := conn.NewStream(ctx, desc, "/svc/Bidi")
+	require.NoError(t, err)
+	return cs
+}
+
+func TestIdleStream_CancelUnblocksRecv(t *testing.T) {
+	recorder := &idleRecorder{}
+	cfg := IdleStreamConfig{Timeout: 50 * time.Millisecond, Code: "deadline_exceeded"}
+	recvErr := make(chan error, 1)
+	cs := serveIdle(t, cfg, recorder, func(ss remote.ServerStream) {
+		_ = ss.Start(true, true)
+		// The client goes quiet after its first message without closing
+		// the stream.
+		var err error
+		for err == nil {
+			err = ss.RecvMsg(&wrapperspb.StringValue{})
+		}
+		recvErr <- err
+		ss.Finish(nil, err)
+	})
+	require.NoError(t, cs.SendMsg(&wrapperspb.StringValue{}))
+
+	err := cs.RecvMsg(&wrapperspb.StringValue{})
+	assert.Equal(t, code.Code_DEADLINE_EXCEEDED, status.FromError(toRPCErr(err)).Code())
+	select {
+	case err := <-recvErr:
+		assert.Error(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("handler still blocked in RecvMsg")
+	}
+	events := recorder.snapshot()
+	require.Len(t, events, 1)
+	assert.True(t, events[0].IsCancelled())
+	assert.Equal(t, IdleActionCancel, events[0].GetAction())
+	assert.Equal(t, "/svc/Bidi", events[0].GetFullMethod())
+	assert.GreaterOrEqual(t, events[0].GetIdle(), cfg.Timeout)
+}
+
+func TestIdleStream_SendAfterReapFails(t *testing.T) {
+	cfg := IdleStreamConfig{Timeout: 50 * time.Millisecond}
+	release := make(chan struct{})
+	type result struct {
+		send   error
+		ctxErr error
+	}
+	results := make(chan result, 1)
+	cs := serveIdle(t, cfg, nil, func(ss remote.ServerStream) {
+		_ = ss.Start(true, true)
+		// The handler is busy elsewhere, not in RecvMsg, when the stream
+		// is reaped and keeps sending afterwards.
+		<-release
+		err := ss.SendMsg(wrapperspb.String("late"))
+		results <- result{send: err, ctxErr: ss.Context().Err()}
+		ss.Finish(nil, err)
+	})
+	require.NoError(t, cs.SendMsg(&wrapperspb.StringValue{}))
+
+	err := cs.RecvMsg(&wrapperspb.StringValue{})
+	assert.Equal(t, code.Code_CANCELLED, status.FromError(toRPCErr(err)).Code())
+	close(release)
+	select {
+	case res := <-results:
+		assert.Equal(t, code.Code_CANCELLED, status.FromError(res.send).Code())
+		assert.Error(t, res.ctxErr)
+	case <-time.After(5 * time.Second):
+		t.Fatal("handler did not finish after the reap")
+	}
+}
+
+func TestIdleStream_ActivityKeepsStreamOpen(t *testing.T) {
+	recorder := &idleRecorder{}
+	cfg := IdleStreamConfig{Timeout: 100 * time.Millisecond}
+	cs := serveIdle(t, cfg, recorder, func(ss remote.ServerStream) {
+		_ = ss.Start(true, true)
+		for {
+			msg := &wrapperspb.StringValue{}
+			if err := ss.RecvMsg(msg); err != nil {
+				ss.Finish(nil, nil)
+				return
+			}
+			if err := ss.SendMsg(msg); err != nil {
+				ss.Finish(nil, err)
+				return
+			}
+		}
+	})
+	for i := 0; i < 6; i++ {
+		require.NoError(t, cs.SendMsg(wrapperspb.String("tick")))
+		require.NoError(t, cs.RecvMsg(&wrapperspb.StringValue{}))
+		time.Sleep(40 * time.Millisecond)
+	}
+	require.NoError(t, cs.CloseSend())
+	assert.Error(t, cs.RecvMsg(&wrapperspb.StringValue{}))
+	assert.Empty(t, recorder.snapshot())
+}
+
+func TestIdleWatcher_UsesClock(t *testing.T) {
+	clock := xclock.NewFake(time.Unix(0, 0))
+	recorder := &idleRecorder{}
+	cfg := IdleStreamConfig{Timeout: time.Minute}
+	w := newIdleWatcher(context.Background(), cfg, "/svc/Bidi", recorder, clock)
+	w.start()
+	defer w.stop()
+
+	for i := 0; i < 3; i++ {
+		clock.Advance(40 * time.Second)
+		w.touch()
+	}
+	assert.Empty(t, recorder.snapshot())
+
+	clock.Advance(time.Minute)
+	select {
+	case err := <-w.reaped:
+		assert.Equal(t, code.Code_CANCELLED, status.FromError(err).Code())
+	default:
+		t.Fatal("stream idle for the timeout was not reaped")
+	}
+	events := recorder.snapshot()
+	require.Len(t, events, 1)
+	assert.Equal(t, time.Minute, events[0].GetIdle())
+}
+
+func TestIdleStream_PingAsksForHeartbeat(t *testing.T) {
+	cfg := IdleStreamConfig{Timeout: 50 * time.Millisecond, Action: IdleActionPing}
+	cs := serveIdle(t, cfg, nil, func(ss remote.ServerStream) {
+		_ = ss.Start(true, true)
+		select {
+		case <-stream.Idle(ss.Context()):
+		case <-time.After(5 * time.Second):
+		}
+		ss.Finish(nil, ss.SendMsg(wrapperspb.String("heartbeat")))
+	})
+	require.NoError(t, cs.SendMsg(&wrapperspb.StringValue{}))
+	msg := &wrapperspb.StringValue{}
+	require.NoError(t, cs.RecvMsg(msg))
+	assert.Equal(t, "heartbeat", msg.GetValue())
+}
+
+func TestIdleStream_PingCancelsUnansweredStream(t *testing.T) {
+	recorder := &idleRecorder{}
+	cfg := IdleStreamConfig{Timeout: 30 * time.Millisecond, Action: IdleActionPing}
+	cs := serveIdle(t, cfg, recorder, func(ss remote.ServerStream) {
+		_ = ss.Start(true, true)
+		var err error
+		for err == nil {
+			err = ss.RecvMsg(&wrapperspb.StringValue{})
+		}
+		ss.Finish(nil, err)
+	})
+	require.NoError(t, cs.SendMsg(&wrapperspb.StringValue{}))
+
+	err := cs.RecvMsg(&wrapperspb.StringValue{})
+	assert.Equal(t, code.Code_CANCELLED, status.FromError(toRPCErr(err)).Code())
+	events := recorder.snapshot()
+	require.Len(t, events, 2)
+	assert.False(t, events[0].IsCancelled())
+	assert.True(t, events[1].IsCancelled())
+}
+
+func TestIdleStream_WarnLeavesStreamOpen(t *testing.T) {
+	recorder := &idleRecorder{}
+	cfg := IdleStreamConfig{Timeout: 20 * time.Millisecond, Action: IdleActionWarn}
+	cs := serveIdle(t, cfg, recorder, func(ss remote.ServerStream) {
+		_ = ss.Start(true, true)
+		msg := &wrapperspb.StringValue{}
+		err := ss.RecvMsg(msg)
+		if err == nil {
+			err = ss.SendMsg(msg)
+		}
+		ss.Finish(nil, err)
+	})
+	require.Eventually(t, func() bool {
+		return len(recorder.snapshot()) >= 2
+	}, 5*time.Second, 5*time.Millisecond)
+	require.NoError(t, cs.SendMsg(wrapperspb.String("late")))
+	msg := &wrapperspb.StringValue{}
+	require.NoError(t, cs.RecvMsg(msg))
+	assert.Equal(t, "late", msg.GetValue())
+	assert.False(t, recorder.snapshot()[0].IsCancelled())
+}
+
+func TestIdleStreamConfig_Validate(t *testing.T) {
+	assert.NoError(t, (&ServerConfig{IdleStream: IdleStreamConfig{Action: "ping"}}).Validate())
+	assert.ErrorContains(t,
+		(&ServerConfig{IdleStream: IdleStreamConfig{Action: "kill"}}).Validate(),
+		"idle_stream.action")
+	assert.ErrorContains(t,
+		(&ServerConfig{IdleStream: IdleStreamConfig{Code: "NOPE"}}).Validate(),
+		"idle_stream.code")
+	assert.ErrorContains(t,
+		(&ServerConfig{IdleStream: IdleStreamConfig{Timeout: -time.Second}}).Validate(),
+		"idle_stream.timeout")
+}
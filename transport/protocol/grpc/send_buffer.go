@@ -0,0 +1,295 @@
+// Copyright 2022 The codesjoy Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package grpc
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"google.golang.org/genproto/googleapis/rpc/code"
+	ggrpc "google.golang.org/grpc"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/codesjoy/yggdrasil/v3/observability/stats"
+	"github.com/codesjoy/yggdrasil/v3/rpc/status"
+)
+
+// SendBufferConfig bounds the responses a server-streaming handler can have
+// queued ahead of a slow client. Without it SendMsg blocks the handler
+// until flow control lets the message out.
+type SendBufferConfig struct {
+	// Messages is the number of responses queued per stream. Zero disables
+	// the buffer.
+	Messages int `mapstructure:"messages"`
+	// Bytes bounds the encoded size of the queued responses. Zero bounds
+	// their number only.
+	Bytes int `mapstructure:"bytes"`
+	// Timeout is how long SendMsg waits for room in a full buffer before
+	// reporting RPCSendBufferFull. Zero waits without reporting.
+	Timeout time.Duration `mapstructure:"timeout"`
+	// Abort fails the stream with UNAVAILABLE once Timeout passed, instead of
+	// waiting on.
+	Abort bool `mapstructure:"abort"`
+}
+
+type queuedMsg struct {
+	msg  *ggrpc.PreparedMsg
+	size int
+}
+
+// sendBuffer queues the responses of one stream and writes them from its
+// own goroutine. Messages are encoded when queued, so handlers may reuse
+// them as soon as SendMsg returns.
+type sendBuffer struct {
+	cfg    SendBufferConfig
+	stream ggrpc.ServerStream
+	method string
+	stats  stats.Handler
+
+	mu       sync.Mutex
+	pending  []queuedMsg
+	bytes    int
+	inFlight bool
+	closed   bool
+	err      error
+
+	wake  chan struct{}
+	space chan struct{}
+	done  chan struct{}
+}
+
+func newSendBuffer(
+	cfg SendBufferConfig,
+	stream ggrpc.ServerStream,
+	method string,
+	handler stats.Handler,
+) *sendBuffer {
+	b := &sendBuffer{
+		cfg:    cfg,
+		stream: stream,
+		method: method,
+		stats:  handler,
+		wake:   make(chan struct{}, 1),
+		space:  make(chan struct{}, 1),
+		done:   make(chan struct{}),
+	}
+	go b.run()
+	return b
+}
+
+func notify(ch chan struct{}) {
+	select {
+	case ch <- struct{}{}:
+	default:
+	}
+}
+
+// send queues m, waiting while the buffer is full.
+func (b *sendBuffer) send(m any) error {
+	msg := &ggrpc.PreparedMsg{}
+	if err := msg.Encode(b.stream, m); err != nil {
+		return toRPCErr(err)
+	}
+	size := 0
+	if pm, ok := m.(proto.Message); ok {
+		size = proto.Size(pm)
+	}
+	ctx := b.stream.Context()
+	if ctx.Err() != nil {
+		return status.FromContextError(ctx.Err()).Err()
+	}
+	start := time.Now()
+	var timeout <-chan time.Time
+	if b.cfg.Timeout > 0 {
+		timer := time.NewTimer(b.cfg.Timeout)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+	for {
+		b.mu.Lock()
+		if b.err != nil {
+			err := b.err
+			b.mu.Unlock()
+			return err
+		}
+		if b.fitsLocked(size) {
+			b.pending = append(b.pending, queuedMsg{msg: msg, size: size})
+			b.bytes += size
+			b.mu.Unlock()
+			notify(b.wake)
+			return nil
+		}
+		b.mu.Unlock()
+		select {
+		case <-b.space:
+		case <-timeout:
+			timeout = nil
+			if err := b.full(ctx, time.Since(start)); err != nil {
+				return err
+			}
+		case <-ctx.Done():
+			return status.FromContextError(ctx.Err()).Err()
+		}
+	}
+}
+
+// fitsLocked reports whether a message of size fits. A message larger than
+// Bytes still goes out once the buffer is empty.
+func (b *sendBuffer) fitsLocked(size int) bool {
+	if len(b.pending) >= b.cfg.Messages {
+		return false
+	}
+	if b.cfg.Bytes <= 0 || b.bytes == 0 {
+		return true
+	}
+	return b.bytes+size <= b.cfg.Bytes
+}
+
+// full reports a buffer that stayed full for waited, and aborts the stream
+// when configured to.
+func (b *sendBuffer) full(ctx context.Context, waited time.Duration) error {
+	b.mu.Lock()
+	messages, bytes := len(b.pending), b.bytes
+	b.mu.Unlock()
+	slog.Warn("stream send buffer full",
+		slog.String("method", b.method),
+		slog.Int("messages", messages),
+		slog.Int("bytes", bytes),
+		slog.Duration("waited", waited),
+		slog.Bool("abort", b.cfg.Abort),
+	)
+	if b.stats != nil {
+		b.stats.HandleRPC(ctx, &stats.RPCSendBufferFullBase{
+			FullMethod:       b.method,
+			BufferedMessages: messages,
+			BufferedBytes:    bytes,
+			Waited:           waited,
+			Aborted:          b.cfg.Abort,
+		})
+	}
+	if !b.cfg.Abort {
+		return nil
+	}
+	err := status.New(
+		code.Code_UNAVAILABLE,
+		fmt.Sprintf("client too slow: send buffer full for %s", waited),
+	).Err()
+	b.fail(err)
+	return err
+}
+
+func (b *sendBuffer) fail(err error) {
+	b.mu.Lock()
+	if b.err == nil {
+		b.err = err
+	}
+	b.pending, b.bytes = nil, 0
+	b.mu.Unlock()
+	notify(b.wake)
+}
+
+func (b *sendBuffer) run() {
+	defer close(b.done)
+	ctx := b.stream.Context()
+	for {
+		b.mu.Lock()
+		for len(b.pending) == 0 {
+			if b.closed || b.err != nil {
+				b.mu.Unlock()
+				return
+			}
+			b.mu.Unlock()
+			select {
+			case <-b.wake:
+			case <-ctx.Done():
+				return
+			}
+			b.mu.Lock()
+		}
+		item := b.pending[0]
+		b.pending = b.pending[1:]
+		b.bytes -= item.size
+		b.inFlight = true
+		b.mu.Unlock()
+		notify(b.space)
+
+		err := b.stream.SendMsg(item.msg)
+
+		b.mu.Lock()
+		b.inFlight = false
+		if err != nil && b.err == nil {
+			b.err = toRPCErr(err)
+		}
+		b.mu.Unlock()
+		notify(b.space)
+		if err != nil {
+			return
+		}
+	}
+}
+
+// flush waits until the queued messages were written, so the stream can be
+// used directly again.
+func (b *sendBuffer) flush() error {
+	ctx := b.stream.Context()
+	for {
+		b.mu.Lock()
+		idle := len(b.pending) == 0 && !b.inFlight
+		err := b.err
+		b.mu.Unlock()
+		if err != nil || idle {
+			return err
+		}
+		select {
+		case <-b.space:
+		case <-b.done:
+			// The writer stops early only on an error or a finished stream.
+			if err := b.failure(); err != nil {
+				return err
+			}
+			return status.FromContextError(ctx.Err()).Err()
+		case <-ctx.Done():
+			return status.FromContextError(ctx.Err()).Err()
+		}
+	}
+}
+
+func (b *sendBuffer) failure() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.err
+}
+
+// close writes out the queued messages and stops the writer. It returns the
+// error that failed the stream, if any, without waiting: the writer may be
+// stuck in SendMsg until the stream ends.
+func (b *sendBuffer) close() error {
+	b.mu.Lock()
+	b.closed = true
+	err := b.err
+	b.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	notify(b.wake)
+	select {
+	case <-b.done:
+	case <-b.stream.Context().Done():
+	}
+	return b.failure()
+}
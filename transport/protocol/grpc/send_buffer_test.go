@@ -0,0 +1,177 @@
+// Copyright 2022 The codesjoy Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package grpc
+
+import (
+	"context"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/genproto/googleapis/rpc/code"
+	ggrpc "google.golang.org/grpc"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+
+	"github.com/codesjoy/yggdrasil/v3/observability/stats"
+	"github.com/codesjoy/yggdrasil/v3/rpc/status"
+)
+
+type bufferFullRecorder struct {
+	recordingHandler
+	mu     sync.Mutex
+	events []stats.RPCSendBufferFull
+}
+
+func (h *bufferFullRecorder) HandleRPC(_ context.Context, rs stats.RPCStats) {
+	if ev, ok := rs.(stats.RPCSendBufferFull); ok {
+		h.mu.Lock()
+		h.events = append(h.events, ev)
+		h.mu.Unlock()
+	}
+}
+
+// serveSendBuffer serves every method with handle writing through a send
+// buffer and returns a stream opened against it.
+func serveSendBuffer(
+	t *testing.T,
+	cfg SendBufferConfig,
+	handler stats.Handler,
+	handle func(*sendBuffer) error,
+) ggrpc.ClientStream {
+	t.Helper()
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	svr := ggrpc.NewServer(ggrpc.UnknownServiceHandler(func(_ any, ss ggrpc.ServerStream) error {
+		b := newSendBuffer(cfg, ss, "/svc/Stream", handler)
+		err := handle(b)
+		if closeErr := b.close(); err == nil {
+			err = closeErr
+		}
+		return toGRPCError(err)
+	}))
+	go func() { _ = svr.Serve(lis) }()
+	t.Cleanup(svr.Stop)
+
+	conn, err := ggrpc.NewClient(lis.Addr().String(), buildInsecureCreds())
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = conn.Close() })
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	t.Cleanup(cancel)
+	cs, err := conn.NewStream(ctx, &ggrpc.StreamDesc{ServerStreams: true}, "/svc/Stream")
+	require.NoError(t, err)
+	require.NoError(t, cs.SendMsg(&wrapperspb.StringValue{}))
+	require.NoError(t, cs.CloseSend())
+	return cs
+}
+
+func TestSendBuffer_DeliversInOrder(t *testing.T) {
+	cfg := SendBufferConfig{Messages: 2}
+	cs := serveSendBuffer(t, cfg, nil, func(b *sendBuffer) error {
+		// The message is reused right away; the buffer holds it encoded.
+		msg := &wrapperspb.Int64Value{}
+		for i := int64(0); i < 10; i++ {
+			msg.Value = i
+			if err := b.send(msg); err != nil {
+				return err
+			}
+		}
+		return b.flush()
+	})
+	for i := int64(0); i < 10; i++ {
+		msg := &wrapperspb.Int64Value{}
+		require.NoError(t, cs.RecvMsg(msg))
+		assert.Equal(t, i, msg.GetValue())
+	}
+	assert.ErrorIs(t, cs.RecvMsg(&wrapperspb.Int64Value{}), io.EOF)
+}
+
+func TestSendBuffer_AbortsSlowClient(t *testing.T) {
+	recorder := &bufferFullRecorder{}
+	cfg := SendBufferConfig{
+		Messages: 2,
+		Bytes:    1 << 20,
+		Timeout:  50 * time.Millisecond,
+		Abort:    true,
+	}
+	sendErr := make(chan error, 1)
+	cs := serveSendBuffer(t, cfg, recorder, func(b *sendBuffer) error {
+		// The client never reads, so flow control stops the writer after
+		// the first window and the buffer fills up.
+		msg := wrapperspb.String(strings.Repeat("x", 64<<10))
+		for {
+			if err := b.send(msg); err != nil {
+				sendErr <- err
+				return err
+			}
+		}
+	})
+
+	err := <-sendErr
+	assert.Equal(t, code.Code_UNAVAILABLE, status.FromError(err).Code())
+	recorder.mu.Lock()
+	require.Len(t, recorder.events, 1)
+	ev := recorder.events[0]
+	recorder.mu.Unlock()
+	assert.True(t, ev.IsAborted())
+	assert.Equal(t, "/svc/Stream", ev.GetFullMethod())
+	assert.Equal(t, 2, ev.GetBufferedMessages())
+	assert.GreaterOrEqual(t, ev.GetWaited(), cfg.Timeout)
+
+	for {
+		if err := cs.RecvMsg(&wrapperspb.StringValue{}); err != nil {
+			assert.Equal(t, code.Code_UNAVAILABLE, status.FromError(toRPCErr(err)).Code())
+			break
+		}
+	}
+}
+
+func TestSendBuffer_ReportsWithoutAbort(t *testing.T) {
+	recorder := &bufferFullRecorder{}
+	cfg := SendBufferConfig{Messages: 1, Timeout: 20 * time.Millisecond}
+	cs := serveSendBuffer(t, cfg, recorder, func(b *sendBuffer) error {
+		msg := wrapperspb.String(strings.Repeat("x", 64<<10))
+		for i := 0; i < 8; i++ {
+			if err := b.send(msg); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+
+	require.Eventually(t, func() bool {
+		recorder.mu.Lock()
+		defer recorder.mu.Unlock()
+		return len(recorder.events) > 0
+	}, 5*time.Second, 5*time.Millisecond)
+	// The stream goes on once the client reads.
+	received := 0
+	for {
+		err := cs.RecvMsg(&wrapperspb.StringValue{})
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		received++
+	}
+	assert.Equal(t, 8, received)
+	recorder.mu.Lock()
+	defer recorder.mu.Unlock()
+	assert.False(t, recorder.events[0].IsAborted())
+}
@@ -17,7 +17,9 @@ package grpc
 import (
 	"context"
 	"errors"
+	"fmt"
 	"io"
+	"log/slog"
 	"math"
 	"net"
 	"sync"
@@ -27,10 +29,13 @@ import (
 	gcredentials "google.golang.org/grpc/credentials"
 	gkeepalive "google.golang.org/grpc/keepalive"
 
+	"github.com/codesjoy/yggdrasil/v3/config/configdoc"
+	"github.com/codesjoy/yggdrasil/v3/internal/xclock"
 	"github.com/codesjoy/yggdrasil/v3/observability/stats"
 	"github.com/codesjoy/yggdrasil/v3/rpc/metadata"
 	remote "github.com/codesjoy/yggdrasil/v3/transport"
 	"github.com/codesjoy/yggdrasil/v3/transport/protocol/grpc/encoding"
+	"github.com/codesjoy/yggdrasil/v3/transport/support/handoff"
 	"github.com/codesjoy/yggdrasil/v3/transport/support/security"
 )
 
@@ -56,12 +61,14 @@ func ServerProviderWithSettings(
 			if err := opts.SetDefaultWithProfiles(profiles); err != nil {
 				return nil, err
 			}
+			slog.Debug("grpc server config", slog.Any("config", configdoc.Effective(opts)))
 
 			s := &server{
 				stoppedCh:    make(chan struct{}),
 				opts:         opts,
 				handle:       handle,
 				statsHandler: statsHandler,
+				clock:        xclock.Real(),
 			}
 			s.ctx, s.cancel = context.WithCancel(context.Background())
 			s.grpcServer = ggrpc.NewServer(s.serverOptions()...)
@@ -77,22 +84,39 @@ const (
 
 // ServerConfig holds gRPC server configuration.
 type ServerConfig struct {
-	Network               string                       `mapstructure:"network"`
-	Address               string                       `mapstructure:"address"`
-	SecurityProfile       string                       `mapstructure:"security_profile"`
-	CodeProto             string                       `mapstructure:"code_proto"`
-	MaxConcurrentStreams  uint32                       `mapstructure:"max_concurrent_streams"`
-	MaxReceiveMessageSize int                          `mapstructure:"max_receive_message_size"`
-	MaxSendMessageSize    int                          `mapstructure:"max_send_message_size"`
-	KeepaliveParams       gkeepalive.ServerParameters  `mapstructure:"keepalive_params"`
-	KeepalivePolicy       gkeepalive.EnforcementPolicy `mapstructure:"keepalive_policy"`
-	InitialWindowSize     int32                        `mapstructure:"initial_window_size"`
-	InitialConnWindowSize int32                        `mapstructure:"initial_conn_window_size"`
-	WriteBufferSize       int                          `mapstructure:"write_buffer_size"`
-	ReadBufferSize        int                          `mapstructure:"read_buffer_size"`
-	ConnectionTimeout     time.Duration                `mapstructure:"connection_timeout"`
-	MaxHeaderListSize     *uint32                      `mapstructure:"max_header_list_size"`
-	HeaderTableSize       *uint32                      `mapstructure:"header_table_size"`
+	Network               string        `mapstructure:"network"`
+	Address               string        `mapstructure:"address"`
+	SecurityProfile       string        `mapstructure:"security_profile"`
+	CodeProto             string        `mapstructure:"code_proto"`
+	MaxConcurrentStreams  uint32        `mapstructure:"max_concurrent_streams"`
+	MaxReceiveMessageSize int           `mapstructure:"max_receive_message_size"`
+	MaxSendMessageSize    int           `mapstructure:"max_send_message_size"`
+	InitialWindowSize     int32         `mapstructure:"initial_window_size"`
+	InitialConnWindowSize int32         `mapstructure:"initial_conn_window_size"`
+	WriteBufferSize       int           `mapstructure:"write_buffer_size"`
+	ReadBufferSize        int           `mapstructure:"read_buffer_size"`
+	ConnectionTimeout     time.Duration `mapstructure:"connection_timeout"`
+	MaxHeaderListSize     *uint32       `mapstructure:"max_header_list_size"`
+	HeaderTableSize       *uint32       `mapstructure:"header_table_size"`
+	// DynamicWindow turns BDP-based flow control on or off. True ignores
+	// InitialWindowSize and InitialConnWindowSize, false keeps the windows
+	// fixed. Unset, BDP estimation runs unless a window size is set.
+	DynamicWindow *bool `mapstructure:"dynamic_window"`
+	// SendBuffer queues the responses of server-streaming RPCs, bounding
+	// what a slow client can hold up.
+	SendBuffer SendBufferConfig `mapstructure:"send_buffer"`
+	// IdleStream cleans up streaming RPCs that stopped exchanging messages.
+	IdleStream IdleStreamConfig `mapstructure:"idle_stream"`
+	// Keepalive configures server keepalive and connection recycling.
+	Keepalive ServerKeepaliveParams `mapstructure:"keepalive"`
+	// KeepaliveEnforcement configures how the server enforces client pings.
+	KeepaliveEnforcement ServerKeepalivePolicy `mapstructure:"keepalive_enforcement"`
+	// Deprecated: use Keepalive. SetDefault moves its fields onto Keepalive;
+	// a field also set there must hold the same value.
+	KeepaliveParams gkeepalive.ServerParameters `mapstructure:"keepalive_params"`
+	// Deprecated: use KeepaliveEnforcement. SetDefault moves its fields onto
+	// KeepaliveEnforcement; a field also set there must hold the same value.
+	KeepalivePolicy gkeepalive.EnforcementPolicy `mapstructure:"keepalive_policy"`
 
 	Attr map[string]string `mapstructure:"attr"`
 
@@ -100,6 +124,120 @@ type ServerConfig struct {
 	codec encoding.Codec
 }
 
+// ServerKeepaliveParams configures server-side keepalive and connection
+// recycling. Zero values keep the grpc-go defaults.
+type ServerKeepaliveParams struct {
+	// MaxConnectionIdle closes connections that have had no active streams for this long.
+	MaxConnectionIdle time.Duration `mapstructure:"max_connection_idle"`
+	// MaxConnectionAge closes connections older than this, with jitter added by grpc-go.
+	MaxConnectionAge time.Duration `mapstructure:"max_connection_age"`
+	// MaxConnectionAgeGrace lets pending RPCs finish after MaxConnectionAge is reached.
+	MaxConnectionAgeGrace time.Duration `mapstructure:"max_connection_age_grace"`
+	// Time is the interval after which an idle connection is pinged.
+	Time time.Duration `mapstructure:"time"`
+	// Timeout is how long to wait for a ping ack before closing the connection.
+	Timeout time.Duration `mapstructure:"timeout"`
+}
+
+// resolveKeepalive maps the deprecated KeepaliveParams and KeepalivePolicy
+// onto Keepalive and KeepaliveEnforcement. A field set in both forms must
+// hold the same value.
+func (opts *ServerConfig) resolveKeepalive() (ServerKeepaliveParams, ServerKeepalivePolicy, error) {
+	params, policy := opts.Keepalive, opts.KeepaliveEnforcement
+	var errs []error
+	merge := func(key, deprecatedKey string, dst *time.Duration, deprecated time.Duration) {
+		switch {
+		case deprecated == 0 || deprecated == *dst:
+		case *dst == 0:
+			*dst = deprecated
+		default:
+			errs = append(errs, fmt.Errorf("%s: conflicts with %s", key, deprecatedKey))
+		}
+	}
+	old := opts.KeepaliveParams
+	merge("keepalive.max_connection_idle", "keepalive_params.maxconnectionidle",
+		&params.MaxConnectionIdle, old.MaxConnectionIdle)
+	merge("keepalive.max_connection_age", "keepalive_params.maxconnectionage",
+		&params.MaxConnectionAge, old.MaxConnectionAge)
+	merge("keepalive.max_connection_age_grace", "keepalive_params.maxconnectionagegrace",
+		&params.MaxConnectionAgeGrace, old.MaxConnectionAgeGrace)
+	merge("keepalive.time", "keepalive_params.time", &params.Time, old.Time)
+	merge("keepalive.timeout", "keepalive_params.timeout", &params.Timeout, old.Timeout)
+	merge("keepalive_enforcement.min_time", "keepalive_policy.mintime",
+		&policy.MinTime, opts.KeepalivePolicy.MinTime)
+	policy.PermitWithoutStream = policy.PermitWithoutStream ||
+		opts.KeepalivePolicy.PermitWithoutStream
+	return params, policy, errors.Join(errs...)
+}
+
+func (p ServerKeepaliveParams) grpcParams() gkeepalive.ServerParameters {
+	return gkeepalive.ServerParameters{
+		MaxConnectionIdle:     p.MaxConnectionIdle,
+		MaxConnectionAge:      p.MaxConnectionAge,
+		MaxConnectionAgeGrace: p.MaxConnectionAgeGrace,
+		Time:                  p.Time,
+		Timeout:               p.Timeout,
+	}
+}
+
+// ServerKeepalivePolicy configures how the server enforces client pings.
+// Clients that ping more often than allowed get their connection closed.
+type ServerKeepalivePolicy struct {
+	// MinTime is the minimum interval a client should wait between pings.
+	MinTime time.Duration `mapstructure:"min_time"`
+	// PermitWithoutStream allows pings even when there are no active streams.
+	PermitWithoutStream bool `mapstructure:"permit_without_stream"`
+}
+
+func (p ServerKeepalivePolicy) grpcPolicy() gkeepalive.EnforcementPolicy {
+	return gkeepalive.EnforcementPolicy{
+		MinTime:             p.MinTime,
+		PermitWithoutStream: p.PermitWithoutStream,
+	}
+}
+
+// Validate reports the fields holding invalid values, naming their keys.
+// Zero values are valid and replaced by SetDefault.
+func (opts *ServerConfig) Validate() error {
+	var errs []error
+	switch opts.Network {
+	case "", "tcp", "tcp4", "tcp6", "unix":
+	default:
+		errs = append(errs, fmt.Errorf("network: unsupported network %q", opts.Network))
+	}
+	if opts.Address != "" && opts.Network != "unix" {
+		if _, _, err := net.SplitHostPort(opts.Address); err != nil {
+			errs = append(errs, fmt.Errorf("address: %w", err))
+		}
+	}
+	nonNegative := func(key string, value int64) {
+		if value < 0 {
+			errs = append(errs, fmt.Errorf("%s: must not be negative", key))
+		}
+	}
+	nonNegative("max_receive_message_size", int64(opts.MaxReceiveMessageSize))
+	nonNegative("max_send_message_size", int64(opts.MaxSendMessageSize))
+	nonNegative("connection_timeout", int64(opts.ConnectionTimeout))
+	params, policy, err := opts.resolveKeepalive()
+	if err != nil {
+		errs = append(errs, err)
+	}
+	nonNegative("keepalive.max_connection_idle", int64(params.MaxConnectionIdle))
+	nonNegative("keepalive.max_connection_age", int64(params.MaxConnectionAge))
+	nonNegative("keepalive.max_connection_age_grace", int64(params.MaxConnectionAgeGrace))
+	nonNegative("keepalive.time", int64(params.Time))
+	nonNegative("keepalive.timeout", int64(params.Timeout))
+	nonNegative("keepalive_enforcement.min_time", int64(policy.MinTime))
+	nonNegative("send_buffer.messages", int64(opts.SendBuffer.Messages))
+	nonNegative("send_buffer.bytes", int64(opts.SendBuffer.Bytes))
+	nonNegative("send_buffer.timeout", int64(opts.SendBuffer.Timeout))
+	nonNegative("idle_stream.timeout", int64(opts.IdleStream.Timeout))
+	if err := opts.IdleStream.validate(); err != nil {
+		errs = append(errs, err)
+	}
+	return errors.Join(errs...)
+}
+
 // SetDefault fills zero fields with defaults.
 func (opts *ServerConfig) SetDefault() error {
 	return opts.SetDefaultWithProfiles(nil)
@@ -107,6 +245,12 @@ func (opts *ServerConfig) SetDefault() error {
 
 // SetDefaultWithProfiles fills zero fields with defaults, resolving security profiles.
 func (opts *ServerConfig) SetDefaultWithProfiles(profiles map[string]security.Profile) error {
+	if err := opts.Validate(); err != nil {
+		return err
+	}
+	opts.Keepalive, opts.KeepaliveEnforcement, _ = opts.resolveKeepalive()
+	opts.KeepaliveParams = gkeepalive.ServerParameters{}
+	opts.KeepalivePolicy = gkeepalive.EnforcementPolicy{}
 	if opts.Network == "" {
 		opts.Network = "tcp"
 	}
@@ -168,6 +312,7 @@ type server struct {
 	opts         ServerConfig
 	handle       remote.MethodHandle
 	statsHandler stats.Handler
+	clock        xclock.Clock
 	grpcServer   *ggrpc.Server
 }
 
@@ -187,17 +332,22 @@ func (s *server) serverOptions() []ggrpc.ServerOption {
 	if s.opts.MaxConcurrentStreams > 0 {
 		opts = append(opts, ggrpc.MaxConcurrentStreams(s.opts.MaxConcurrentStreams))
 	}
-	if s.opts.KeepaliveParams != (gkeepalive.ServerParameters{}) {
-		opts = append(opts, ggrpc.KeepaliveParams(s.opts.KeepaliveParams))
+	if s.opts.Keepalive != (ServerKeepaliveParams{}) {
+		opts = append(opts, ggrpc.KeepaliveParams(s.opts.Keepalive.grpcParams()))
 	}
-	if s.opts.KeepalivePolicy != (gkeepalive.EnforcementPolicy{}) {
-		opts = append(opts, ggrpc.KeepaliveEnforcementPolicy(s.opts.KeepalivePolicy))
+	if s.opts.KeepaliveEnforcement != (ServerKeepalivePolicy{}) {
+		opts = append(opts, ggrpc.KeepaliveEnforcementPolicy(s.opts.KeepaliveEnforcement.grpcPolicy()))
 	}
-	if s.opts.InitialWindowSize > 0 {
-		opts = append(opts, ggrpc.InitialWindowSize(s.opts.InitialWindowSize))
-	}
-	if s.opts.InitialConnWindowSize > 0 {
-		opts = append(opts, ggrpc.InitialConnWindowSize(s.opts.InitialConnWindowSize))
+	windows := resolveFlowWindows(
+		s.opts.InitialWindowSize,
+		s.opts.InitialConnWindowSize,
+		s.opts.DynamicWindow,
+	)
+	if windows.static {
+		opts = append(opts,
+			ggrpc.StaticStreamWindowSize(windows.stream),
+			ggrpc.StaticConnWindowSize(windows.conn),
+		)
 	}
 	if s.opts.WriteBufferSize > 0 {
 		opts = append(opts, ggrpc.WriteBufferSize(s.opts.WriteBufferSize))
@@ -212,18 +362,40 @@ func (s *server) serverOptions() []ggrpc.ServerOption {
 		opts = append(opts, ggrpc.HeaderTableSize(*s.opts.HeaderTableSize))
 	}
 	if s.opts.codec != nil {
-		opts = append(opts, ggrpc.ForceServerCodecV2(grpcCodecV2ForLocal(s.opts.codec)))
+		codec := sizeCheckingCodec{CodecV2: grpcCodecV2ForLocal(s.opts.codec)}
+		opts = append(opts, ggrpc.ForceServerCodecV2(codec))
 	}
 	return opts
 }
 
 func (s *server) handleUnknown(stream ggrpc.ServerStream) error {
 	ss := &serverStream{
-		ctx:    buildIncomingContext(stream.Context()),
-		stream: stream,
-		method: methodFromServerStream(stream),
+		ctx:        buildIncomingContext(stream.Context()),
+		stream:     stream,
+		method:     methodFromServerStream(stream),
+		sendBuffer: s.opts.SendBuffer,
+		stats:      s.statsHandler,
+		sizedCodec: s.opts.codec != nil || checksRecvSize(stream.Context()),
+	}
+	if s.opts.IdleStream.Timeout > 0 {
+		ss.idle = newIdleWatcher(
+			ss.ctx,
+			s.opts.IdleStream,
+			ss.method,
+			s.statsHandler,
+			xclock.OrReal(s.clock),
+		)
+		if err := s.handleWatched(ss); err != nil {
+			return err
+		}
+	} else {
+		s.handle(ss)
+	}
+	if ss.buffer != nil {
+		if err := ss.buffer.close(); err != nil && ss.finishErr == nil {
+			ss.finishErr = err
+		}
 	}
-	s.handle(ss)
 	if err := ss.applyContextMetadata(); err != nil {
 		return toGRPCError(err)
 	}
@@ -238,6 +410,37 @@ func (s *server) handleUnknown(stream ggrpc.ServerStream) error {
 	return nil
 }
 
+// handleWatched runs the handler on its own goroutine, so an idle stream
+// can be ended while the handler is blocked in RecvMsg. Ending the stream
+// cancels the handler's context, fails that RecvMsg and closes the stream
+// gate, so a handler still running afterwards never touches the finished
+// grpc stream.
+func (s *server) handleWatched(ss *serverStream) error {
+	ctx, cancel := context.WithCancelCause(ss.ctx)
+	defer cancel(nil)
+	gate := &gatedStream{ServerStream: ss.stream}
+	ss.ctx = ss.idle.context(ctx)
+	ss.stream = gate
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		s.handle(ss)
+	}()
+	select {
+	case <-done:
+	case err := <-ss.idle.reaped:
+		select {
+		case <-done:
+		default:
+			cancel(err)
+			gate.close(ss.idle.clock, reapGrace)
+			return toGRPCError(err)
+		}
+	}
+	ss.idle.stop()
+	return nil
+}
+
 func (s *server) Stop(ctx context.Context) error {
 	if ctx == nil {
 		ctx = context.Background()
@@ -310,7 +513,7 @@ func (s *server) Start() error {
 	}
 	ctx, cancel := context.WithTimeout(s.ctx, time.Second)
 	defer cancel()
-	lis, err := (&net.ListenConfig{}).Listen(ctx, s.opts.Network, s.opts.Address)
+	lis, err := handoff.Listen(ctx, s.opts.Network, s.opts.Address)
 	if err != nil {
 		return err
 	}
@@ -328,6 +531,21 @@ func (s *server) Handle() error {
 	return err
 }
 
+// ServeListener serves gRPC on an additional listener. It must be called after Start.
+func (s *server) ServeListener(lis net.Listener) error {
+	s.mu.Lock()
+	started := s.serve && !s.stopped
+	s.mu.Unlock()
+	if !started {
+		return errors.New("server is not serving")
+	}
+	err := s.grpcServer.Serve(lis)
+	if errors.Is(err, ggrpc.ErrServerStopped) {
+		return nil
+	}
+	return err
+}
+
 type serverStream struct {
 	ctx    context.Context
 	stream ggrpc.ServerStream
@@ -338,6 +556,19 @@ type serverStream struct {
 	headerApplied  bool
 	trailerApplied bool
 
+	sendBuffer SendBufferConfig
+	stats      stats.Handler
+	// buffer queues the responses of a server stream when sendBuffer
+	// enables it.
+	buffer *sendBuffer
+	// idle watches the messages of a streaming RPC when IdleStream is
+	// enabled.
+	idle *idleWatcher
+	// sizedCodec reports whether the codec of the stream can check the
+	// request sizes; recvCheck is the check set by CheckRecvSize.
+	sizedCodec bool
+	recvCheck  func(size int) error
+
 	finishReply any
 	finishErr   error
 }
@@ -347,12 +578,24 @@ func (ss *serverStream) Context() context.Context {
 }
 
 func (ss *serverStream) SendHeader(md metadata.MD) error {
+	if err := ss.flush(); err != nil {
+		return err
+	}
 	if err := ss.applyPendingHeader(); err != nil {
 		return err
 	}
 	return toRPCErr(ss.stream.SendHeader(toGRPCMetadata(md)))
 }
 
+// flush waits for the queued responses, so the stream is not written to
+// from two goroutines.
+func (ss *serverStream) flush() error {
+	if ss.buffer == nil {
+		return nil
+	}
+	return ss.buffer.flush()
+}
+
 func (ss *serverStream) SetTrailer(md metadata.MD) {
 	if md.Len() == 0 {
 		return
@@ -364,6 +607,9 @@ func (ss *serverStream) SetHeader(md metadata.MD) error {
 	if md.Len() == 0 {
 		return nil
 	}
+	if err := ss.flush(); err != nil {
+		return err
+	}
 	return toRPCErr(ss.stream.SetHeader(toGRPCMetadata(md)))
 }
 
@@ -371,17 +617,46 @@ func (ss *serverStream) SendMsg(m interface{}) error {
 	if err := ss.applyPendingHeader(); err != nil {
 		return err
 	}
-	return toRPCErr(ss.stream.SendMsg(m))
+	if ss.buffer != nil {
+		return ss.touch(ss.buffer.send(m))
+	}
+	return ss.touch(toRPCErr(ss.stream.SendMsg(m)))
+}
+
+// touch records a successful message for the idle watcher.
+func (ss *serverStream) touch(err error) error {
+	if err == nil && ss.idle != nil {
+		ss.idle.touch()
+	}
+	return err
 }
 
 func (ss *serverStream) RecvMsg(m interface{}) error {
-	err := ss.stream.RecvMsg(m)
+	var checked *sizeCheckedMessage
+	if ss.recvCheck != nil {
+		checked = &sizeCheckedMessage{msg: m, check: ss.recvCheck}
+		m = checked
+	}
+	err := ss.touch(ss.stream.RecvMsg(m))
+	if checked != nil && checked.err != nil {
+		return checked.err
+	}
 	if err == nil || errors.Is(err, io.EOF) {
 		return err
 	}
 	return toRPCErr(err)
 }
 
+// CheckRecvSize checks the requests on the raw frame, which grpc has read
+// in full already, bounded by MaxReceiveMessageSize.
+func (ss *serverStream) CheckRecvSize(_ int, check func(size int) error) bool {
+	if !ss.sizedCodec {
+		return false
+	}
+	ss.recvCheck = check
+	return true
+}
+
 func (ss *serverStream) Method() string {
 	return ss.method
 }
@@ -389,6 +664,12 @@ func (ss *serverStream) Method() string {
 func (ss *serverStream) Start(isClientStream, isServerStream bool) error {
 	ss.isClientStream = isClientStream
 	ss.isServerStream = isServerStream
+	if isServerStream && ss.sendBuffer.Messages > 0 {
+		ss.buffer = newSendBuffer(ss.sendBuffer, ss.stream, ss.method, ss.stats)
+	}
+	if ss.idle != nil && (isClientStream || isServerStream) {
+		ss.idle.start()
+	}
 	return nil
 }
 
@@ -16,6 +16,7 @@ package grpc
 
 import (
 	"context"
+	"encoding/binary"
 	"errors"
 	"io"
 	"net"
@@ -28,6 +29,7 @@ import (
 	gkeepalive "google.golang.org/grpc/keepalive"
 	gmetadata "google.golang.org/grpc/metadata"
 
+	"github.com/codesjoy/yggdrasil/v3/config"
 	"github.com/codesjoy/yggdrasil/v3/observability/stats"
 	"github.com/codesjoy/yggdrasil/v3/rpc/metadata"
 	remote "github.com/codesjoy/yggdrasil/v3/transport"
@@ -78,6 +80,24 @@ func TestServerConfig_SetDefaultWithExistingValues(t *testing.T) {
 	assert.Equal(t, "us-east", cfg.Attr["zone"])
 }
 
+func TestServerConfig_Validate(t *testing.T) {
+	require.NoError(t, (&ServerConfig{}).Validate())
+
+	cfg := ServerConfig{
+		Network:               "udp",
+		Address:               "no-port",
+		MaxReceiveMessageSize: -1,
+		Keepalive:             ServerKeepaliveParams{Timeout: -time.Second},
+	}
+	err := cfg.Validate()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), `network: unsupported network "udp"`)
+	assert.Contains(t, err.Error(), "address: ")
+	assert.Contains(t, err.Error(), "max_receive_message_size: must not be negative")
+	assert.Contains(t, err.Error(), "keepalive.timeout: must not be negative")
+	assert.Error(t, cfg.SetDefault())
+}
+
 func TestServerConfig_SetDefaultWithProfiles_BadAddress(t *testing.T) {
 	cfg := ServerConfig{
 		Network: "tcp",
@@ -114,6 +134,64 @@ func TestServerConfig_SetDefaultWithProfiles_ValidCodec(t *testing.T) {
 // serverStream tests
 // ---------------------------------------------------------------------------
 
+func TestServerConfig_DecodeKeepalive(t *testing.T) {
+	var cfg ServerConfig
+	require.NoError(t, config.NewSnapshot(map[string]any{
+		"keepalive": map[string]any{
+			"max_connection_idle":      "5m",
+			"max_connection_age":       "30m",
+			"max_connection_age_grace": "10s",
+			"time":                     "1m",
+			"timeout":                  "5s",
+		},
+		"keepalive_enforcement": map[string]any{
+			"min_time":              "20s",
+			"permit_without_stream": true,
+		},
+	}).Decode(&cfg))
+
+	assert.Equal(t, gkeepalive.ServerParameters{
+		MaxConnectionIdle:     5 * time.Minute,
+		MaxConnectionAge:      30 * time.Minute,
+		MaxConnectionAgeGrace: 10 * time.Second,
+		Time:                  time.Minute,
+		Timeout:               5 * time.Second,
+	}, cfg.Keepalive.grpcParams())
+	assert.Equal(t, gkeepalive.EnforcementPolicy{
+		MinTime:             20 * time.Second,
+		PermitWithoutStream: true,
+	}, cfg.KeepaliveEnforcement.grpcPolicy())
+}
+
+func TestServerConfig_DeprecatedKeepalive(t *testing.T) {
+	cfg := ServerConfig{
+		Keepalive:       ServerKeepaliveParams{Time: time.Minute},
+		KeepaliveParams: gkeepalive.ServerParameters{Time: time.Minute, Timeout: 5 * time.Second},
+		KeepalivePolicy: gkeepalive.EnforcementPolicy{MinTime: time.Second, PermitWithoutStream: true},
+	}
+	require.NoError(t, cfg.SetDefault())
+	assert.Equal(t, ServerKeepaliveParams{Time: time.Minute, Timeout: 5 * time.Second}, cfg.Keepalive)
+	assert.Equal(t,
+		ServerKeepalivePolicy{MinTime: time.Second, PermitWithoutStream: true},
+		cfg.KeepaliveEnforcement)
+	assert.Zero(t, cfg.KeepaliveParams)
+	assert.Zero(t, cfg.KeepalivePolicy)
+
+	cfg = ServerConfig{
+		Keepalive:            ServerKeepaliveParams{Time: 2 * time.Minute},
+		KeepaliveEnforcement: ServerKeepalivePolicy{MinTime: time.Second},
+		KeepaliveParams:      gkeepalive.ServerParameters{Time: time.Minute},
+		KeepalivePolicy:      gkeepalive.EnforcementPolicy{MinTime: 2 * time.Second},
+	}
+	err := cfg.Validate()
+	assert.ErrorContains(t, err, "keepalive.time: conflicts with keepalive_params.time")
+	assert.ErrorContains(t, err,
+		"keepalive_enforcement.min_time: conflicts with keepalive_policy.mintime")
+
+	cfg = ServerConfig{KeepaliveParams: gkeepalive.ServerParameters{Timeout: -time.Second}}
+	assert.ErrorContains(t, cfg.Validate(), "keepalive.timeout: must not be negative")
+}
+
 func TestServerStream_Context(t *testing.T) {
 	ctx := context.Background()
 	ss := &serverStream{ctx: ctx}
@@ -514,8 +592,8 @@ func TestServer_ServerOptions_AllBranches(t *testing.T) {
 		Address:               "",
 		SecurityProfile:       "insecure",
 		MaxConcurrentStreams:  maxStreams,
-		KeepaliveParams:       gkeepalive.ServerParameters{MaxConnectionAge: time.Minute},
-		KeepalivePolicy:       gkeepalive.EnforcementPolicy{MinTime: time.Second},
+		Keepalive:             ServerKeepaliveParams{MaxConnectionAge: time.Minute},
+		KeepaliveEnforcement:  ServerKeepalivePolicy{MinTime: time.Second},
 		InitialWindowSize:     initWin,
 		InitialConnWindowSize: initConnWin,
 		MaxHeaderListSize:     &maxHdr,
@@ -536,6 +614,63 @@ func TestServer_ServerOptions_AllBranches(t *testing.T) {
 	require.NotNil(t, s.grpcServer)
 }
 
+// serverSettings starts a server with cfg and returns the HTTP/2 settings it
+// advertises to a new connection.
+func serverSettings(t *testing.T, cfg ServerConfig) map[uint16]uint32 {
+	t.Helper()
+	s := &server{opts: cfg, statsHandler: stats.NoOpHandler}
+	gs := ggrpc.NewServer(s.serverOptions()...)
+	defer gs.Stop()
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	go func() { _ = gs.Serve(lis) }()
+
+	conn, err := net.Dial("tcp", lis.Addr().String())
+	require.NoError(t, err)
+	defer conn.Close()
+	require.NoError(t, conn.SetDeadline(time.Now().Add(5*time.Second)))
+	// Client preface followed by an empty SETTINGS frame.
+	_, err = conn.Write(append([]byte("PRI * HTTP/2.0\r\n\r\nSM\r\n\r\n"), 0, 0, 0, 4, 0, 0, 0, 0, 0))
+	require.NoError(t, err)
+
+	header := make([]byte, 9)
+	_, err = io.ReadFull(conn, header)
+	require.NoError(t, err)
+	require.Equal(t, byte(4), header[3], "first server frame is SETTINGS")
+	payload := make([]byte, int(header[0])<<16|int(header[1])<<8|int(header[2]))
+	_, err = io.ReadFull(conn, payload)
+	require.NoError(t, err)
+	out := map[uint16]uint32{}
+	for i := 0; i+6 <= len(payload); i += 6 {
+		out[binary.BigEndian.Uint16(payload[i:])] = binary.BigEndian.Uint32(payload[i+2:])
+	}
+	return out
+}
+
+func TestServer_ServerOptions_FlowControlSettings(t *testing.T) {
+	const settingInitialWindowSize = 0x4
+	decode := func(values map[string]any) ServerConfig {
+		var cfg ServerConfig
+		require.NoError(t, config.NewSnapshot(values).Decode(&cfg))
+		require.NoError(t, cfg.SetDefault())
+		return cfg
+	}
+
+	got := serverSettings(t, decode(map[string]any{
+		"initial_window_size":      1 << 20,
+		"initial_conn_window_size": 1 << 21,
+	}))
+	assert.Equal(t, uint32(1<<20), got[settingInitialWindowSize])
+
+	got = serverSettings(t, decode(map[string]any{
+		"initial_window_size":      1 << 20,
+		"initial_conn_window_size": 1 << 21,
+		"dynamic_window":           true,
+	}))
+	_, ok := got[settingInitialWindowSize]
+	assert.False(t, ok, "dynamic windows start at the HTTP/2 default")
+}
+
 func TestServer_ServerOptions_NoOptional(t *testing.T) {
 	cfg := ServerConfig{}
 	require.NoError(t, cfg.SetDefault())
@@ -774,3 +909,12 @@ func TestMethodFromServerStream_NoMethod(t *testing.T) {
 // ---------------------------------------------------------------------------
 
 var _ encoding.Codec = nil
+
+func TestServer_ServeListener_NotStarted(t *testing.T) {
+	s := &server{
+		stoppedCh: make(chan struct{}),
+	}
+	err := s.ServeListener(nil)
+	require.Error(t, err)
+	assert.ErrorContains(t, err, "not serving")
+}
@@ -0,0 +1,91 @@
+// Copyright 2022 The codesjoy Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package grpc
+
+import (
+	"context"
+	"strings"
+
+	grpcencoding "google.golang.org/grpc/encoding"
+	grpcproto "google.golang.org/grpc/encoding/proto"
+	gmem "google.golang.org/grpc/mem"
+	gmetadata "google.golang.org/grpc/metadata"
+)
+
+// sizeCheckedMessage makes a sizeCheckingCodec pass the encoded size of a
+// request to check before decoding it into msg.
+type sizeCheckedMessage struct {
+	msg   any
+	check func(size int) error
+	// err is the error returned by check. The codec skips the message
+	// without failing, as grpc would end the stream with INTERNAL, and
+	// RecvMsg returns err instead.
+	err error
+}
+
+// sizeCheckingCodec wraps the codecs of the server so the size of a request
+// can be checked on the raw frame, before the request is decoded.
+type sizeCheckingCodec struct {
+	grpcencoding.CodecV2
+}
+
+func (c sizeCheckingCodec) Unmarshal(data gmem.BufferSlice, v any) error {
+	m, ok := v.(*sizeCheckedMessage)
+	if !ok {
+		return c.CodecV2.Unmarshal(data, v)
+	}
+	if m.err = m.check(data.Len()); m.err != nil {
+		return nil
+	}
+	return c.CodecV2.Unmarshal(data, m.msg)
+}
+
+// registerSizeCheckingCodecs wraps the framework-owned codecs.
+func registerSizeCheckingCodecs(names ...string) {
+	for _, name := range names {
+		codec := grpcencoding.GetCodecV2(name)
+		if _, ok := codec.(sizeCheckingCodec); ok || codec == nil {
+			continue
+		}
+		grpcencoding.RegisterCodecV2(sizeCheckingCodec{CodecV2: codec})
+	}
+}
+
+// checksRecvSize reports whether the codec decoding the requests of the
+// stream with ctx is a sizeCheckingCodec.
+func checksRecvSize(ctx context.Context) bool {
+	subtype := grpcproto.Name
+	md, _ := gmetadata.FromIncomingContext(ctx)
+	if values := md.Get("content-type"); len(values) > 0 {
+		if sub := contentSubtype(values[0]); sub != "" {
+			subtype = sub
+		}
+	}
+	_, ok := grpcencoding.GetCodecV2(subtype).(sizeCheckingCodec)
+	return ok
+}
+
+// contentSubtype returns the subtype of a grpc content type such as
+// "application/grpc+json", or "" for plain "application/grpc".
+func contentSubtype(contentType string) string {
+	rest, ok := strings.CutPrefix(strings.ToLower(contentType), "application/grpc")
+	if !ok || rest == "" {
+		return ""
+	}
+	if rest[0] != '+' && rest[0] != ';' {
+		return ""
+	}
+	return rest[1:]
+}
@@ -0,0 +1,87 @@
+// Copyright 2022 The codesjoy Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package grpc
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/genproto/googleapis/rpc/code"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+
+	"github.com/codesjoy/yggdrasil/v3/rpc/status"
+	remote "github.com/codesjoy/yggdrasil/v3/transport"
+)
+
+func TestServerStream_CheckRecvSize(t *testing.T) {
+	ConfigureBuiltinCodecs()
+	type result struct {
+		checked bool
+		sizes   []int
+		value   string
+	}
+	results := make(chan result, 1)
+	cs := serveIdle(t, IdleStreamConfig{}, nil, func(ss remote.ServerStream) {
+		var res result
+		check := func(size int) error {
+			res.sizes = append(res.sizes, size)
+			if size > 16 {
+				return status.New(code.Code_RESOURCE_EXHAUSTED, "too large").Err()
+			}
+			return nil
+		}
+		res.checked = ss.(remote.RecvSizeChecker).CheckRecvSize(16, check)
+		_ = ss.Start(true, true)
+		msg := &wrapperspb.StringValue{}
+		err := ss.RecvMsg(msg)
+		if err == nil {
+			err = ss.RecvMsg(msg)
+		}
+		res.value = msg.GetValue()
+		results <- res
+		ss.Finish(nil, err)
+	})
+	small := wrapperspb.String("ok")
+	large := wrapperspb.String(strings.Repeat("x", 64))
+	require.NoError(t, cs.SendMsg(small))
+	require.NoError(t, cs.SendMsg(large))
+
+	err := cs.RecvMsg(&wrapperspb.StringValue{})
+	assert.Equal(t, code.Code_RESOURCE_EXHAUSTED, status.FromError(toRPCErr(err)).Code())
+	select {
+	case res := <-results:
+		assert.True(t, res.checked)
+		assert.Equal(t, []int{proto.Size(small), proto.Size(large)}, res.sizes)
+		assert.Equal(t, "ok", res.value, "the large message is not decoded")
+	case <-time.After(5 * time.Second):
+		t.Fatal("handler did not finish")
+	}
+}
+
+func TestContentSubtype(t *testing.T) {
+	for contentType, want := range map[string]string{
+		"application/grpc":         "",
+		"application/grpc+proto":   "proto",
+		"application/grpc;JSONRAW": "jsonraw",
+		"application/grpcx":        "",
+		"text/plain":               "",
+	} {
+		assert.Equal(t, want, contentSubtype(contentType), contentType)
+	}
+}
@@ -25,6 +25,7 @@ import (
 	"github.com/codesjoy/yggdrasil/v3/observability/stats"
 	"github.com/codesjoy/yggdrasil/v3/rpc/metadata"
 	remote "github.com/codesjoy/yggdrasil/v3/transport"
+	"github.com/codesjoy/yggdrasil/v3/transport/support/handoff"
 	"github.com/codesjoy/yggdrasil/v3/transport/support/marshaler"
 	"github.com/codesjoy/yggdrasil/v3/transport/support/security"
 )
@@ -108,8 +109,7 @@ func (s *server) Start() error {
 	if s.lis != nil {
 		return nil
 	}
-	lc := net.ListenConfig{}
-	lis, err := lc.Listen(context.Background(), s.opts.Network, s.opts.Address)
+	lis, err := handoff.Listen(context.Background(), s.opts.Network, s.opts.Address)
 	if err != nil {
 		return err
 	}
@@ -190,7 +190,15 @@ func (s *server) serveHTTP(w http.ResponseWriter, r *http.Request) {
 	}
 	ctx = attachPeer(ctx, r, localAddr, authInfo)
 
-	ssCtx, cancel := context.WithCancel(ctx)
+	var (
+		ssCtx  context.Context
+		cancel context.CancelFunc
+	)
+	if timeout, ok := parseTimeoutHeader(r.Header.Get(TimeoutHeader)); ok {
+		ssCtx, cancel = context.WithTimeout(ctx, timeout)
+	} else {
+		ssCtx, cancel = context.WithCancel(ctx)
+	}
 	ss := &httpServerStream{
 		ctx:                ssCtx,
 		cancel:             cancel,
@@ -209,6 +217,21 @@ func (s *server) serveHTTP(w http.ResponseWriter, r *http.Request) {
 	s.handle(ss)
 }
 
+func parseTimeoutHeader(raw string) (time.Duration, bool) {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return 0, false
+	}
+	timeout, err := time.ParseDuration(raw)
+	if err != nil {
+		return 0, false
+	}
+	if timeout < 0 {
+		timeout = 0
+	}
+	return timeout, true
+}
+
 func (s *server) authenticateRequest(r *http.Request) (security.AuthInfo, error) {
 	if s.requestAuth == nil {
 		return security.BasicAuthInfo{
@@ -20,6 +20,7 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -134,6 +135,7 @@ func TestAttachPeer(t *testing.T) {
 		p, ok := peer.FromContext(ctx)
 		require.True(t, ok)
 		assert.Equal(t, "192.168.1.1:12345", p.Addr.String())
+		assert.Equal(t, "192.168.1.1", p.RemoteIP)
 		assert.Equal(t, "http", p.Protocol)
 	})
 }
@@ -142,6 +144,21 @@ func TestAddrString(t *testing.T) {
 	assert.Equal(t, "", addrString(nil))
 }
 
+func TestParseTimeoutHeader(t *testing.T) {
+	timeout, ok := parseTimeoutHeader("1.5s")
+	require.True(t, ok)
+	assert.Equal(t, 1500*time.Millisecond, timeout)
+
+	timeout, ok = parseTimeoutHeader("-1s")
+	require.True(t, ok)
+	assert.Equal(t, time.Duration(0), timeout)
+
+	_, ok = parseTimeoutHeader("")
+	assert.False(t, ok)
+	_, ok = parseTimeoutHeader("bogus")
+	assert.False(t, ok)
+}
+
 func TestLocalAddrOrZero(t *testing.T) {
 	t.Run("negative returns default 4MB", func(t *testing.T) {
 		require.Equal(t, int64(4*1024*1024), localAddrOrZero(-1))
@@ -44,6 +44,8 @@ const (
 	MetadataHeaderPrefix = "Yggdrasil-Metadata-"
 	// MetadataTrailerPrefix is the prefix for metadata trailers.
 	MetadataTrailerPrefix = "Yggdrasil-Trailer-"
+	// TimeoutHeader carries the remaining caller deadline as a Go duration.
+	TimeoutHeader = "Yggdrasil-Timeout"
 )
 
 type httpClientStream struct {
@@ -196,10 +198,13 @@ func (cs *httpClientStream) RecvMsg(m interface{}) error {
 	req.Header.Set("Content-Type", reqMarshaler.ContentType(nil))
 	req.Header.Set("Accept", respMarshaler.ContentType(nil))
 	req.Header.Set("TE", "trailers")
+	if deadline, ok := ctx.Deadline(); ok {
+		req.Header.Set(TimeoutHeader, time.Until(deadline).String())
+	}
 
 	for k, vs := range outMD {
 		for _, v := range vs {
-			req.Header.Add(MetadataHeaderPrefix+k, v)
+			req.Header.Add(MetadataHeaderPrefix+k, metadata.EncodeHeaderValue(k, v))
 		}
 	}
 
@@ -371,6 +376,9 @@ type httpServerStream struct {
 
 	reqBody []byte
 	recv    bool
+	// recvLimit and recvCheck are set by CheckRecvSize.
+	recvLimit int
+	recvCheck func(size int) error
 
 	headerMD  metadata.MD
 	trailerMD metadata.MD
@@ -403,11 +411,21 @@ func (ss *httpServerStream) Start(isClientStream, isServerStream bool) error {
 	if limit <= 0 {
 		limit = 4 * 1024 * 1024
 	}
+	methodLimit := ss.recvCheck != nil && ss.recvLimit > 0 && int64(ss.recvLimit) < limit
+	if methodLimit {
+		limit = int64(ss.recvLimit)
+	}
 	body, err := io.ReadAll(io.LimitReader(ss.req.Body, limit+1))
 	if err != nil {
 		return err
 	}
 	if int64(len(body)) > limit {
+		if methodLimit {
+			size := max(ss.req.ContentLength, int64(len(body)))
+			if err := ss.recvCheck(int(size)); err != nil {
+				return err
+			}
+		}
 		return xerror.New(code.Code_RESOURCE_EXHAUSTED, "request body too large")
 	}
 	ss.reqBody = body
@@ -627,27 +645,52 @@ func (ss *httpServerStream) RecvMsg(m any) error {
 	ss.recv = true
 	body := ss.reqBody
 	inbound := ss.inbound
+	check := ss.recvCheck
 	ss.mu.Unlock()
+	if check != nil {
+		if err := check(len(body)); err != nil {
+			return err
+		}
+	}
 	if len(body) == 0 {
 		return nil
 	}
 	return inbound.Unmarshal(body, m)
 }
 
+// CheckRecvSize reads no more of the request body than limit bytes.
+func (ss *httpServerStream) CheckRecvSize(limit int, check func(size int) error) bool {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+	ss.recvLimit = limit
+	ss.recvCheck = check
+	return true
+}
+
 func extractMetadataWithPrefix(h http.Header, prefix string) metadata.MD {
 	md := metadata.MD{}
 	for key, vals := range h {
 		if strings.HasPrefix(key, prefix) {
-			md.Append(key[len(prefix):], vals...)
+			appendDecoded(md, key[len(prefix):], vals)
 		}
 	}
 	return md
 }
 
+// appendDecoded appends header values to md, dropping binary values that
+// are not valid base64.
+func appendDecoded(md metadata.MD, key string, vals []string) {
+	for _, v := range vals {
+		if decoded, err := metadata.DecodeHeaderValue(key, v); err == nil {
+			md.Append(key, decoded)
+		}
+	}
+}
+
 func writeMetadata(w http.ResponseWriter, md metadata.MD) {
 	for k, vs := range md {
 		for _, v := range vs {
-			w.Header().Add(MetadataHeaderPrefix+k, v)
+			w.Header().Add(MetadataHeaderPrefix+k, metadata.EncodeHeaderValue(k, v))
 		}
 	}
 }
@@ -665,7 +708,7 @@ func declareTrailers(w http.ResponseWriter, md metadata.MD) {
 func writeTrailers(w http.ResponseWriter, md metadata.MD) {
 	for k, vs := range md {
 		for _, v := range vs {
-			w.Header().Add(MetadataTrailerPrefix+k, v)
+			w.Header().Add(MetadataTrailerPrefix+k, metadata.EncodeHeaderValue(k, v))
 		}
 	}
 }
@@ -691,6 +734,7 @@ func attachPeer(
 		LocalAddr: localAddr,
 		AuthInfo:  authInfo,
 		Protocol:  "http",
+		RemoteIP:  host,
 	}
 	return peer.WithContext(ctx, p)
 }
@@ -22,6 +22,7 @@ import (
 	"net"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -135,6 +136,35 @@ func TestHTTPServerStream_Start_DuplicateStart(t *testing.T) {
 	assert.Contains(t, err.Error(), "stream already started")
 }
 
+func TestHTTPServerStream_CheckRecvSize(t *testing.T) {
+	errTooLarge := errors.New("too large")
+	var sizes []int
+	check := func(size int) error {
+		sizes = append(sizes, size)
+		if size > 16 {
+			return errTooLarge
+		}
+		return nil
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/test.Method", bytes.NewBufferString(`{"name":"a"}`))
+	ss := newTestServerStream(req, httptest.NewRecorder())
+	require.True(t, ss.CheckRecvSize(16, check))
+	require.NoError(t, ss.Start(false, false))
+	var msg struct {
+		Name string `json:"name"`
+	}
+	require.NoError(t, ss.RecvMsg(&msg))
+	assert.Equal(t, "a", msg.Name)
+
+	body := `{"name":"` + strings.Repeat("x", 64) + `"}`
+	req = httptest.NewRequest(http.MethodPost, "/test.Method", bytes.NewBufferString(body))
+	ss = newTestServerStream(req, httptest.NewRecorder())
+	require.True(t, ss.CheckRecvSize(16, check))
+	assert.ErrorIs(t, ss.Start(false, false), errTooLarge)
+	assert.Equal(t, []int{12, len(body)}, sizes)
+}
+
 func TestHTTPServerStream_RecvMsg(t *testing.T) {
 	t.Run("unmarshals body on first call", func(t *testing.T) {
 		req := httptest.NewRequest(
@@ -677,3 +707,18 @@ func TestAttachPeer_InvalidRemoteAddr(t *testing.T) {
 	// The key assertion is that there is no panic.
 	assert.Equal(t, 0, p.Addr.(*net.TCPAddr).Port)
 }
+
+func TestMetadataBinaryValuesRoundTrip(t *testing.T) {
+	md := metadata.Pairs("x-id", "plain")
+	md.SetBinary("trace", []byte{0x00, 0xff})
+
+	rec := httptest.NewRecorder()
+	writeMetadata(rec, md)
+	assert.Equal(t, "AP8", rec.Header().Get(MetadataHeaderPrefix+"trace-bin"))
+
+	rec.Header().Add(MetadataHeaderPrefix+"bad-bin", "!!")
+	got := extractMetadataWithPrefix(rec.Header(), MetadataHeaderPrefix)
+	assert.Equal(t, [][]byte{{0x00, 0xff}}, got.GetBinary("trace"))
+	assert.Equal(t, []string{"plain"}, got.Get("x-id"))
+	assert.Nil(t, got.Get("bad-bin"))
+}
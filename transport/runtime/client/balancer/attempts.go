@@ -0,0 +1,72 @@
+// Copyright 2022 The codesjoy Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package balancer
+
+import (
+	"context"
+	"sync"
+
+	remote "github.com/codesjoy/yggdrasil/v3/transport"
+)
+
+type attemptsKey struct{}
+
+// Attempts records the endpoints picked for the attempts of one call, so
+// that pickers can send further attempts, e.g. hedged ones, to endpoints not
+// tried yet. It is safe for concurrent use; a nil Attempts records nothing.
+type Attempts struct {
+	mu    sync.Mutex
+	tried []remote.Client
+}
+
+// WithAttempts returns ctx carrying a new Attempts shared by the calls made
+// with it.
+func WithAttempts(ctx context.Context) context.Context {
+	return context.WithValue(ctx, attemptsKey{}, &Attempts{})
+}
+
+// AttemptsFromContext returns the Attempts carried by ctx, or nil.
+func AttemptsFromContext(ctx context.Context) *Attempts {
+	if ctx == nil {
+		return nil
+	}
+	a, _ := ctx.Value(attemptsKey{}).(*Attempts)
+	return a
+}
+
+// Add records that an attempt was sent to endpoint.
+func (a *Attempts) Add(endpoint remote.Client) {
+	if a == nil {
+		return
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.tried = append(a.tried, endpoint)
+}
+
+// Tried reports whether an attempt was sent to endpoint.
+func (a *Attempts) Tried(endpoint remote.Client) bool {
+	if a == nil {
+		return false
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for _, item := range a.tried {
+		if item == endpoint {
+			return true
+		}
+	}
+	return false
+}
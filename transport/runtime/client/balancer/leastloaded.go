@@ -0,0 +1,273 @@
+// Copyright 2022 The codesjoy Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package balancer
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/codesjoy/yggdrasil/v3/config"
+	"github.com/codesjoy/yggdrasil/v3/discovery/resolver"
+	"github.com/codesjoy/yggdrasil/v3/internal/xclock"
+	remote "github.com/codesjoy/yggdrasil/v3/transport"
+	"github.com/codesjoy/yggdrasil/v3/transport/support/orca"
+)
+
+const leastLoadedName = "least_loaded"
+
+// minUtilization keeps idle endpoints comparable by their in-flight calls.
+const minUtilization = 0.01
+
+const defaultReportExpiration = 10 * time.Second
+
+// LoadReportReceiver is implemented by the PickResults of balancers that
+// weigh endpoints by the load reports servers attach to their trailers.
+type LoadReportReceiver interface {
+	ReportLoad(orca.LoadReport)
+}
+
+// LeastLoadedConfig configures the least_loaded balancer.
+type LeastLoadedConfig struct {
+	// ReportExpiration is how long a load report is trusted, 10s by
+	// default. Endpoints without a fresh report are compared by their
+	// in-flight calls only.
+	ReportExpiration time.Duration `mapstructure:"report_expiration"`
+}
+
+// LeastLoadedProvider returns the least_loaded balancer provider. It picks
+// the less loaded of two random ready endpoints, the load being the calls in
+// flight scaled by the utilization the endpoint reported through its
+// trailers and divided by its weight metadata. Servers report utilization
+// when server.load_report is enabled.
+func LeastLoadedProvider() Provider {
+	return NewProvider(
+		leastLoadedName,
+		func(serviceName, balancerName string, cli Client) (Balancer, error) {
+			var cfg LeastLoadedConfig
+			if err := config.NewSnapshot(LoadConfig(serviceName, balancerName)).
+				Decode(&cfg); err != nil {
+				return nil, fmt.Errorf("load least_loaded balancer config: %w", err)
+			}
+			return newLeastLoadedBalancer(cfg, cli)
+		},
+	)
+}
+
+// leastLoadedBalancer reuses round_robin for connection management and
+// replaces its picker.
+type leastLoadedBalancer struct {
+	Balancer
+	cli   Client
+	cfg   LeastLoadedConfig
+	clock xclock.Clock
+
+	mu    sync.Mutex
+	loads map[remote.Client]*endpointLoad
+}
+
+func newLeastLoadedBalancer(cfg LeastLoadedConfig, cli Client) (*leastLoadedBalancer, error) {
+	if cfg.ReportExpiration <= 0 {
+		cfg.ReportExpiration = defaultReportExpiration
+	}
+	lb := &leastLoadedBalancer{
+		cli:   cli,
+		cfg:   cfg,
+		clock: xclock.Real(),
+		loads: map[remote.Client]*endpointLoad{},
+	}
+	child, err := newRoundRobin("", "", &leastLoadedClient{owner: lb})
+	if err != nil {
+		return nil, err
+	}
+	lb.Balancer = child
+	return lb, nil
+}
+
+// Type returns the type of the balancer.
+func (lb *leastLoadedBalancer) Type() string {
+	return leastLoadedName
+}
+
+// endpointLoad is the load known for one endpoint.
+type endpointLoad struct {
+	weight      float64
+	inflight    atomic.Int64
+	utilization atomic.Uint64
+	reportedAt  atomic.Int64
+}
+
+func (l *endpointLoad) score(now time.Time, expiration time.Duration) (float64, bool) {
+	load := float64(l.inflight.Load()+1) / l.weight
+	reportedAt := l.reportedAt.Load()
+	if reportedAt == 0 || now.Sub(time.Unix(0, reportedAt)) > expiration {
+		return load, false
+	}
+	return load * max(math.Float64frombits(l.utilization.Load()), minUtilization), true
+}
+
+func (lb *leastLoadedBalancer) track(cli remote.Client, endpoint resolver.Endpoint) {
+	load := &endpointLoad{weight: float64(max(resolver.Weight(endpoint), 1))}
+	lb.mu.Lock()
+	lb.loads[cli] = load
+	lb.mu.Unlock()
+}
+
+// picker wraps the ready clients picked by round_robin.
+func (lb *leastLoadedBalancer) picker(ready []remote.Client) Picker {
+	p := &leastLoadedPicker{owner: lb, clients: ready, loads: make([]*endpointLoad, len(ready))}
+	lb.mu.Lock()
+	for cli := range lb.loads {
+		if cli.State() == remote.Shutdown {
+			delete(lb.loads, cli)
+		}
+	}
+	for i, cli := range ready {
+		load, ok := lb.loads[cli]
+		if !ok {
+			load = &endpointLoad{weight: 1}
+			lb.loads[cli] = load
+		}
+		p.loads[i] = load
+	}
+	lb.mu.Unlock()
+	return p
+}
+
+// leastLoadedClient is the Client given to the round_robin child.
+type leastLoadedClient struct {
+	owner *leastLoadedBalancer
+}
+
+func (c *leastLoadedClient) UpdateState(state State) {
+	if rr, ok := state.Picker.(*rrPicker); ok {
+		state.Picker = c.owner.picker(rr.endpoint)
+	}
+	c.owner.cli.UpdateState(state)
+}
+
+func (c *leastLoadedClient) NewRemoteClient(
+	endpoint resolver.Endpoint,
+	opts NewRemoteClientOptions,
+) (remote.Client, error) {
+	cli, err := c.owner.cli.NewRemoteClient(endpoint, opts)
+	if err == nil && cli != nil {
+		c.owner.track(cli, endpoint)
+	}
+	return cli, err
+}
+
+type leastLoadedPicker struct {
+	owner   *leastLoadedBalancer
+	clients []remote.Client
+	loads   []*endpointLoad
+}
+
+// Next picks the less loaded of two random ready endpoints.
+func (p *leastLoadedPicker) Next(info RPCInfo) (PickResult, error) {
+	if len(p.clients) == 0 {
+		return nil, ErrNoAvailableInstance
+	}
+	candidates := p.untried(info.Ctx)
+	n := len(p.clients)
+	if candidates != nil {
+		n = len(candidates)
+	}
+	at := func(k int) int {
+		if candidates == nil {
+			return k
+		}
+		return candidates[k]
+	}
+	a := rand.IntN(n)
+	i := at(a)
+	if n > 1 {
+		b := rand.IntN(n - 1)
+		if b >= a {
+			b++
+		}
+		if j := at(b); p.less(j, i) {
+			i = j
+		}
+	}
+	load := p.loads[i]
+	load.inflight.Add(1)
+	return &leastLoadedResult{
+		pickResult: pickResult{ctx: info.Ctx, endpoint: p.clients[i]},
+		owner:      p.owner,
+		load:       load,
+	}, nil
+}
+
+// untried returns the indexes of the endpoints no earlier attempt of the call
+// in ctx was sent to, or nil when all endpoints are candidates.
+func (p *leastLoadedPicker) untried(ctx context.Context) []int {
+	attempts := AttemptsFromContext(ctx)
+	if attempts == nil {
+		return nil
+	}
+	out := make([]int, 0, len(p.clients))
+	for i, item := range p.clients {
+		if !attempts.Tried(item) {
+			out = append(out, i)
+		}
+	}
+	if len(out) == 0 || len(out) == len(p.clients) {
+		return nil
+	}
+	return out
+}
+
+// less reports whether endpoint a is less loaded than b. Utilization only
+// counts when both endpoints reported it recently.
+func (p *leastLoadedPicker) less(a, b int) bool {
+	now := p.owner.clock.Now()
+	expiration := p.owner.cfg.ReportExpiration
+	scoreA, fresh := p.loads[a].score(now, expiration)
+	scoreB, freshB := p.loads[b].score(now, expiration)
+	if fresh != freshB {
+		scoreA = float64(p.loads[a].inflight.Load()+1) / p.loads[a].weight
+		scoreB = float64(p.loads[b].inflight.Load()+1) / p.loads[b].weight
+	}
+	return scoreA < scoreB
+}
+
+type leastLoadedResult struct {
+	pickResult
+	owner *leastLoadedBalancer
+	load  *endpointLoad
+	done  atomic.Bool
+}
+
+// Report ends the call on the endpoint.
+func (r *leastLoadedResult) Report(err error) {
+	if r.done.CompareAndSwap(false, true) {
+		r.load.inflight.Add(-1)
+	}
+	r.pickResult.Report(err)
+}
+
+// ReportLoad records the load report returned with the call.
+func (r *leastLoadedResult) ReportLoad(report orca.LoadReport) {
+	if report.Utilization() <= 0 {
+		return
+	}
+	r.load.utilization.Store(math.Float64bits(report.Utilization()))
+	r.load.reportedAt.Store(r.owner.clock.Now().UnixNano())
+}
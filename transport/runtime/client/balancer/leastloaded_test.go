@@ -0,0 +1,167 @@
+// Copyright 2022 The codesjoy Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package balancer
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/codesjoy/yggdrasil/v3/discovery/registry"
+	"github.com/codesjoy/yggdrasil/v3/discovery/resolver"
+	"github.com/codesjoy/yggdrasil/v3/internal/xclock"
+	"github.com/codesjoy/yggdrasil/v3/transport/support/orca"
+)
+
+func newLeastLoadedTest(t *testing.T, endpoints ...resolver.Endpoint) (
+	*leastLoadedBalancer,
+	*mockBalancerClient,
+	*xclock.Fake,
+) {
+	t.Helper()
+	cli := newMockBalancerClient()
+	lb, err := newLeastLoadedBalancer(LeastLoadedConfig{}, cli)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	t.Cleanup(func() { _ = lb.Close() })
+	clock := xclock.NewFake(time.Unix(100, 0))
+	lb.clock = clock
+	lb.UpdateState(newMockState(endpoints))
+	return lb, cli, clock
+}
+
+func pickName(t *testing.T, picker Picker) (string, PickResult) {
+	t.Helper()
+	res, err := picker.Next(RPCInfo{Ctx: context.Background()})
+	if err != nil {
+		t.Fatalf("unexpected pick error: %v", err)
+	}
+	return res.RemoteClient().(*mockRemoteClient).name, res
+}
+
+func TestLeastLoadedPrefersFewerInflight(t *testing.T) {
+	_, cli, _ := newLeastLoadedTest(t,
+		newMockEndpoint("a", "a", "grpc"),
+		newMockEndpoint("b", "b", "grpc"),
+	)
+	picker := cli.GetState().Picker
+	for range 10 {
+		first, held := pickName(t, picker)
+		second, other := pickName(t, picker)
+		if first == second {
+			t.Fatalf("expected the idle endpoint, got %s twice", first)
+		}
+		held.Report(nil)
+		other.Report(nil)
+	}
+}
+
+func TestLeastLoadedSkipsTriedEndpoints(t *testing.T) {
+	_, cli, _ := newLeastLoadedTest(t,
+		newMockEndpoint("a", "a", "grpc"),
+		newMockEndpoint("b", "b", "grpc"),
+	)
+	picker := cli.GetState().Picker
+	ctx := WithAttempts(context.Background())
+	first, err := picker.Next(RPCInfo{Ctx: ctx})
+	if err != nil {
+		t.Fatalf("unexpected pick error: %v", err)
+	}
+	first.Report(nil)
+	AttemptsFromContext(ctx).Add(first.RemoteClient())
+	for range 10 {
+		res, err := picker.Next(RPCInfo{Ctx: ctx})
+		if err != nil {
+			t.Fatalf("unexpected pick error: %v", err)
+		}
+		res.Report(nil)
+		if res.RemoteClient() == first.RemoteClient() {
+			t.Fatal("expected the endpoint not tried yet")
+		}
+	}
+}
+
+func TestLeastLoadedUsesLoadReports(t *testing.T) {
+	_, cli, clock := newLeastLoadedTest(t,
+		newMockEndpoint("a", "a", "grpc"),
+		newMockEndpoint("b", "b", "grpc"),
+	)
+	picker := cli.GetState().Picker
+	reported := map[string]bool{}
+	for len(reported) < 2 {
+		name, res := pickName(t, picker)
+		util := 0.9
+		if name == "b" {
+			util = 0.1
+		}
+		res.(LoadReportReceiver).ReportLoad(orca.LoadReport{CPUUtilization: util})
+		res.Report(nil)
+		reported[name] = true
+	}
+
+	sequential := func() map[string]int {
+		got := map[string]int{}
+		for range 20 {
+			name, res := pickName(t, picker)
+			res.Report(nil)
+			got[name]++
+		}
+		return got
+	}
+	if got := sequential(); got["b"] != 20 {
+		t.Fatalf("expected all picks on the less utilized endpoint, got %v", got)
+	}
+
+	// Reports expire: the endpoints tie again and are picked at random.
+	clock.Advance(time.Minute)
+	if got := sequential(); got["a"] == 0 {
+		t.Fatalf("expected expired reports to be ignored, got %v", got)
+	}
+}
+
+func TestLeastLoadedWeights(t *testing.T) {
+	heavy := newMockEndpoint("heavy", "heavy", "grpc")
+	heavy.attributes[registry.MDWeight] = 3
+	_, cli, _ := newLeastLoadedTest(t, heavy, newMockEndpoint("light", "light", "grpc"))
+	picker := cli.GetState().Picker
+
+	got := map[string]int{}
+	for range 4 {
+		name, _ := pickName(t, picker)
+		got[name]++
+	}
+	if got["heavy"] != 3 || got["light"] != 1 {
+		t.Fatalf("expected in-flight calls spread by weight, got %v", got)
+	}
+}
+
+func TestLeastLoadedProvider(t *testing.T) {
+	provider := LeastLoadedProvider()
+	if provider.Type() != leastLoadedName {
+		t.Fatalf("unexpected type %q", provider.Type())
+	}
+	b, err := provider.New("svc", "default", newMockBalancerClient())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer b.Close() //nolint:errcheck
+	if b.Type() != leastLoadedName {
+		t.Fatalf("unexpected balancer type %q", b.Type())
+	}
+	if got := b.(*leastLoadedBalancer).cfg.ReportExpiration; got != defaultReportExpiration {
+		t.Fatalf("unexpected report expiration %v", got)
+	}
+}
@@ -0,0 +1,305 @@
+// Copyright 2022 The codesjoy Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package balancer
+
+import (
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"slices"
+	"sync"
+
+	"github.com/codesjoy/yggdrasil/v3/config"
+	"github.com/codesjoy/yggdrasil/v3/discovery/registry"
+	"github.com/codesjoy/yggdrasil/v3/discovery/resolver"
+	remote "github.com/codesjoy/yggdrasil/v3/transport"
+)
+
+const localityName = "locality"
+
+// Locality tiers, nearest first.
+const (
+	// TierZone holds endpoints in the caller's zone.
+	TierZone = "zone"
+	// TierRegion holds the other endpoints in the caller's region.
+	TierRegion = "region"
+	// TierAny holds every remaining endpoint.
+	TierAny = "any"
+)
+
+var localityTiers = []string{TierZone, TierRegion, TierAny}
+
+// Locality is the placement of the calling application.
+type Locality struct {
+	Region string
+	Zone   string
+}
+
+// LocalityConfig configures the locality balancer.
+type LocalityConfig struct {
+	// Region and Zone override the application locality.
+	Region string `mapstructure:"region"`
+	Zone   string `mapstructure:"zone"`
+	// Weights spreads traffic over the tiers that have ready endpoints, e.g.
+	// {zone: 90, region: 10}. When empty, all traffic goes to the nearest
+	// tier with a ready endpoint.
+	Weights map[string]int `mapstructure:"weights"`
+}
+
+// LocalityProvider returns the locality balancer provider for an application
+// placed at local. Endpoints are split by their region and zone metadata into
+// same-zone, same-region and remaining tiers, each balanced round robin;
+// traffic spills over to the next tier when a tier has no ready endpoint.
+func LocalityProvider(local Locality) Provider {
+	return NewProvider(
+		localityName,
+		func(serviceName, balancerName string, cli Client) (Balancer, error) {
+			var cfg LocalityConfig
+			if err := config.NewSnapshot(LoadConfig(serviceName, balancerName)).
+				Decode(&cfg); err != nil {
+				return nil, fmt.Errorf("load locality balancer config: %w", err)
+			}
+			if cfg.Region == "" {
+				cfg.Region = local.Region
+			}
+			if cfg.Zone == "" {
+				cfg.Zone = local.Zone
+			}
+			return newLocalityBalancer(cfg, cli)
+		},
+	)
+}
+
+type localityBalancer struct {
+	cli Client
+	cfg LocalityConfig
+
+	mu     sync.Mutex
+	closed bool
+	tiers  []*localityTier
+}
+
+type localityTier struct {
+	weight    int
+	balancer  Balancer
+	state     State
+	endpoints int
+}
+
+func newLocalityBalancer(cfg LocalityConfig, cli Client) (*localityBalancer, error) {
+	for tier, weight := range cfg.Weights {
+		if !slices.Contains(localityTiers, tier) {
+			return nil, fmt.Errorf("unknown locality tier %q", tier)
+		}
+		if weight < 0 {
+			return nil, fmt.Errorf("locality tier %q has a negative weight", tier)
+		}
+	}
+	lb := &localityBalancer{cli: cli, cfg: cfg}
+	for _, name := range localityTiers {
+		tier := &localityTier{
+			weight: cfg.Weights[name],
+			state:  State{ConnectivityState: remote.Idle},
+		}
+		child, err := newRoundRobin("", "", &localityTierClient{owner: lb, tier: tier})
+		if err != nil {
+			return nil, err
+		}
+		tier.balancer = child
+		lb.tiers = append(lb.tiers, tier)
+	}
+	return lb, nil
+}
+
+// UpdateState splits the endpoints into tiers and forwards them to the children.
+func (lb *localityBalancer) UpdateState(state resolver.State) {
+	states := make([]resolver.BaseState, len(localityTiers))
+	for i := range states {
+		states[i].Attributes = state.GetAttributes()
+	}
+	for _, endpoint := range state.GetEndpoints() {
+		if endpoint == nil {
+			continue
+		}
+		i := lb.tierOf(endpoint)
+		states[i].Endpoints = append(states[i].Endpoints, endpoint)
+	}
+
+	lb.mu.Lock()
+	if lb.closed {
+		lb.mu.Unlock()
+		return
+	}
+	for i, tier := range lb.tiers {
+		tier.endpoints = len(states[i].Endpoints)
+	}
+	tiers := slices.Clone(lb.tiers)
+	lb.mu.Unlock()
+
+	for i, tier := range tiers {
+		tier.balancer.UpdateState(states[i])
+	}
+}
+
+func (lb *localityBalancer) tierOf(endpoint resolver.Endpoint) int {
+	attrs := endpoint.GetAttributes()
+	region := attributeString(attrs, registry.MDRegion)
+	zone := attributeString(attrs, registry.MDZone)
+	sameRegion := lb.cfg.Region != "" && region == lb.cfg.Region
+	switch {
+	case lb.cfg.Zone != "" && zone == lb.cfg.Zone &&
+		(sameRegion || lb.cfg.Region == "" || region == ""):
+		return 0
+	case sameRegion:
+		return 1
+	default:
+		return 2
+	}
+}
+
+func attributeString(attrs map[string]any, key string) string {
+	value, ok := attrs[key]
+	if !ok || value == nil {
+		return ""
+	}
+	return fmt.Sprint(value)
+}
+
+// Close closes all tier balancers.
+func (lb *localityBalancer) Close() error {
+	lb.mu.Lock()
+	if lb.closed {
+		lb.mu.Unlock()
+		return nil
+	}
+	lb.closed = true
+	tiers := lb.tiers
+	lb.mu.Unlock()
+
+	var multiErr error
+	for _, tier := range tiers {
+		if err := tier.balancer.Close(); err != nil {
+			multiErr = errors.Join(multiErr, err)
+		}
+	}
+	lb.cli.UpdateState(State{ConnectivityState: remote.Shutdown, Picker: &rrPicker{}})
+	return multiErr
+}
+
+// Type returns the type of the balancer.
+func (lb *localityBalancer) Type() string {
+	return localityName
+}
+
+func (lb *localityBalancer) updateTierState(tier *localityTier, state State) {
+	lb.mu.Lock()
+	if lb.closed {
+		lb.mu.Unlock()
+		return
+	}
+	tier.state = state
+	next := lb.buildStateLocked()
+	lb.mu.Unlock()
+	lb.cli.UpdateState(next)
+}
+
+func (lb *localityBalancer) buildStateLocked() State {
+	picker := &localityPicker{}
+	var numConnecting, numIdle int
+	for _, tier := range lb.tiers {
+		if tier.endpoints == 0 || tier.state.Picker == nil {
+			continue
+		}
+		if picker.fallback == nil {
+			picker.fallback = tier.state.Picker
+		}
+		switch tier.state.ConnectivityState {
+		case remote.Ready:
+			picker.ready = append(picker.ready, weightedPicker{
+				picker: tier.state.Picker,
+				weight: tier.weight,
+			})
+			picker.total += tier.weight
+		case remote.Connecting:
+			numConnecting++
+		case remote.Idle:
+			numIdle++
+		}
+	}
+	if picker.fallback == nil {
+		picker.fallback = lb.tiers[0].state.Picker
+	}
+	switch {
+	case len(picker.ready) > 0:
+		return State{ConnectivityState: remote.Ready, Picker: picker}
+	case numConnecting > 0:
+		return State{ConnectivityState: remote.Connecting, Picker: picker}
+	case numIdle > 0:
+		return State{ConnectivityState: remote.Idle, Picker: picker}
+	default:
+		return State{ConnectivityState: remote.TransientFailure, Picker: picker}
+	}
+}
+
+type weightedPicker struct {
+	picker Picker
+	weight int
+}
+
+// localityPicker picks from the ready tiers by weight, or from the nearest
+// ready tier when no ready tier is weighted.
+type localityPicker struct {
+	ready    []weightedPicker
+	total    int
+	fallback Picker
+}
+
+// Next returns the next remote client.
+func (p *localityPicker) Next(info RPCInfo) (PickResult, error) {
+	if len(p.ready) == 0 {
+		if p.fallback == nil {
+			return nil, ErrNoAvailableInstance
+		}
+		return p.fallback.Next(info)
+	}
+	if p.total == 0 {
+		return p.ready[0].picker.Next(info)
+	}
+	n := rand.IntN(p.total)
+	for _, item := range p.ready {
+		if n < item.weight {
+			return item.picker.Next(info)
+		}
+		n -= item.weight
+	}
+	return p.ready[0].picker.Next(info)
+}
+
+// localityTierClient is the Client given to one tier balancer.
+type localityTierClient struct {
+	owner *localityBalancer
+	tier  *localityTier
+}
+
+func (c *localityTierClient) UpdateState(state State) {
+	c.owner.updateTierState(c.tier, state)
+}
+
+func (c *localityTierClient) NewRemoteClient(
+	endpoint resolver.Endpoint,
+	opts NewRemoteClientOptions,
+) (remote.Client, error) {
+	return c.owner.cli.NewRemoteClient(endpoint, opts)
+}
@@ -0,0 +1,199 @@
+// Copyright 2022 The codesjoy Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package balancer
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/codesjoy/yggdrasil/v3/discovery/registry"
+	"github.com/codesjoy/yggdrasil/v3/discovery/resolver"
+	remote "github.com/codesjoy/yggdrasil/v3/transport"
+)
+
+func newLocalityEndpoint(name, region, zone string) *mockEndpoint {
+	ep := newMockEndpoint(name, name, "grpc")
+	if region != "" {
+		ep.attributes[registry.MDRegion] = region
+	}
+	if zone != "" {
+		ep.attributes[registry.MDZone] = zone
+	}
+	return ep
+}
+
+func pickNames(t *testing.T, picker Picker, n int) map[string]int {
+	t.Helper()
+	out := map[string]int{}
+	for range n {
+		res, err := picker.Next(RPCInfo{Ctx: context.Background()})
+		if err != nil {
+			t.Fatalf("unexpected pick error: %v", err)
+		}
+		out[res.RemoteClient().(*mockRemoteClient).name]++
+	}
+	return out
+}
+
+func TestLocalityBalancerTiers(t *testing.T) {
+	lb, err := newLocalityBalancer(LocalityConfig{Region: "r1", Zone: "z1"}, newMockBalancerClient())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	cases := []struct {
+		endpoint *mockEndpoint
+		want     int
+	}{
+		{newLocalityEndpoint("a", "r1", "z1"), 0},
+		{newLocalityEndpoint("b", "", "z1"), 0},
+		{newLocalityEndpoint("c", "r1", "z2"), 1},
+		{newLocalityEndpoint("d", "r2", "z1"), 2},
+		{newLocalityEndpoint("e", "", ""), 2},
+	}
+	for _, tc := range cases {
+		if got := lb.tierOf(tc.endpoint); got != tc.want {
+			t.Errorf("endpoint %s: expected tier %d, got %d", tc.endpoint.name, tc.want, got)
+		}
+	}
+}
+
+func TestLocalityBalancerPrefersNearestReadyTier(t *testing.T) {
+	cli := newMockBalancerClient()
+	lb, err := newLocalityBalancer(LocalityConfig{Region: "r1", Zone: "z1"}, cli)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer lb.Close() //nolint:errcheck
+
+	endpoints := []resolver.Endpoint{
+		newLocalityEndpoint("zone", "r1", "z1"),
+		newLocalityEndpoint("region", "r1", "z2"),
+		newLocalityEndpoint("remote", "r2", "z9"),
+	}
+	lb.UpdateState(newMockState(endpoints))
+
+	state := cli.GetState()
+	if state.ConnectivityState != remote.Ready {
+		t.Fatalf("expected READY, got %v", state.ConnectivityState)
+	}
+	if got := pickNames(t, state.Picker, 10); got["zone"] != 10 {
+		t.Fatalf("expected all picks in zone, got %v", got)
+	}
+
+	// The zone endpoint fails: traffic spills over to the region tier.
+	lb.tiers[0].balancer.(*rrBalancer).UpdateRemoteClientState(remote.ClientState{
+		Endpoint: endpoints[0],
+		State:    remote.TransientFailure,
+	})
+	if got := pickNames(t, cli.GetState().Picker, 10); got["region"] != 10 {
+		t.Fatalf("expected spill over to region, got %v", got)
+	}
+
+	lb.tiers[1].balancer.(*rrBalancer).UpdateRemoteClientState(remote.ClientState{
+		Endpoint: endpoints[1],
+		State:    remote.TransientFailure,
+	})
+	if got := pickNames(t, cli.GetState().Picker, 10); got["remote"] != 10 {
+		t.Fatalf("expected spill over to any, got %v", got)
+	}
+}
+
+func TestLocalityBalancerWeights(t *testing.T) {
+	cli := newMockBalancerClient()
+	lb, err := newLocalityBalancer(LocalityConfig{
+		Region:  "r1",
+		Zone:    "z1",
+		Weights: map[string]int{TierZone: 1, TierRegion: 1},
+	}, cli)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer lb.Close() //nolint:errcheck
+
+	lb.UpdateState(newMockState([]resolver.Endpoint{
+		newLocalityEndpoint("zone", "r1", "z1"),
+		newLocalityEndpoint("region", "r1", "z2"),
+		newLocalityEndpoint("remote", "r2", "z9"),
+	}))
+	got := pickNames(t, cli.GetState().Picker, 400)
+	if got["zone"] == 0 || got["region"] == 0 {
+		t.Fatalf("expected traffic split over zone and region, got %v", got)
+	}
+	if got["remote"] != 0 {
+		t.Fatalf("expected no traffic to the unweighted tier, got %v", got)
+	}
+}
+
+func TestLocalityBalancerNoEndpoints(t *testing.T) {
+	cli := newMockBalancerClient()
+	lb, err := newLocalityBalancer(LocalityConfig{Zone: "z1"}, cli)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	lb.UpdateState(newMockState(nil))
+
+	state := cli.GetState()
+	if state.ConnectivityState != remote.TransientFailure {
+		t.Fatalf("expected TRANSIENT_FAILURE, got %v", state.ConnectivityState)
+	}
+	_, err = state.Picker.Next(RPCInfo{Ctx: context.Background()})
+	if err == nil || !strings.Contains(err.Error(), "zero addresses") {
+		t.Fatalf("expected resolver error, got %v", err)
+	}
+
+	if err := lb.Close(); err != nil {
+		t.Fatalf("unexpected close error: %v", err)
+	}
+	if cli.GetState().ConnectivityState != remote.Shutdown {
+		t.Fatalf("expected SHUTDOWN after close")
+	}
+}
+
+func TestLocalityBalancerInvalidWeights(t *testing.T) {
+	if _, err := newLocalityBalancer(
+		LocalityConfig{Weights: map[string]int{"campus": 1}},
+		newMockBalancerClient(),
+	); err == nil {
+		t.Fatal("expected unknown tier error")
+	}
+	if _, err := newLocalityBalancer(
+		LocalityConfig{Weights: map[string]int{TierZone: -1}},
+		newMockBalancerClient(),
+	); err == nil {
+		t.Fatal("expected negative weight error")
+	}
+}
+
+func TestLocalityProviderUsesConfig(t *testing.T) {
+	Configure(map[string]Spec{
+		"nearby": {Type: localityName, Config: map[string]any{"zone": "z2"}},
+	}, nil)
+	defer Configure(nil, nil)
+
+	provider := LocalityProvider(Locality{Region: "r1", Zone: "z1"})
+	if provider.Type() != localityName {
+		t.Fatalf("unexpected type %q", provider.Type())
+	}
+	b, err := provider.New("svc", "nearby", newMockBalancerClient())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer b.Close() //nolint:errcheck
+	cfg := b.(*localityBalancer).cfg
+	if cfg.Region != "r1" || cfg.Zone != "z2" {
+		t.Fatalf("expected config zone to override the application, got %+v", cfg)
+	}
+}
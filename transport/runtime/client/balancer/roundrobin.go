@@ -365,8 +365,17 @@ func (r *rrPicker) Next(ri RPCInfo) (PickResult, error) {
 		return nil, ErrNoAvailableInstance
 	}
 	// Use atomic operations for thread-safe round-robin
-	idx := int(atomic.AddInt64(&r.idx, 1)-1) % len(r.endpoint)
-	res := &pickResult{endpoint: r.endpoint[idx], ctx: ri.Ctx}
+	idx := int(atomic.AddInt64(&r.idx, 1)-1) % len(endpoints)
+	if attempts := AttemptsFromContext(ri.Ctx); attempts != nil {
+		// Prefer an endpoint no earlier attempt of the call was sent to.
+		for i := range endpoints {
+			if j := (idx + i) % len(endpoints); !attempts.Tried(endpoints[j]) {
+				idx = j
+				break
+			}
+		}
+	}
+	res := &pickResult{endpoint: endpoints[idx], ctx: ri.Ctx}
 	return res, nil
 }
 
@@ -426,6 +426,36 @@ func TestRRPicker_Next_RoundRobin(t *testing.T) {
 	}
 }
 
+func TestRRPicker_Next_SkipsTriedEndpoints(t *testing.T) {
+	client1 := newMockRemoteClient("test1", remote.Ready)
+	client2 := newMockRemoteClient("test2", remote.Ready)
+	picker := &rrPicker{endpoint: []remote.Client{client1, client2}}
+
+	ctx := WithAttempts(context.Background())
+	first, err := picker.Next(RPCInfo{Ctx: ctx})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	AttemptsFromContext(ctx).Add(first.RemoteClient())
+	// Another call takes the next endpoint, so round robin alone would send
+	// the second attempt to the first one again.
+	if _, err = picker.Next(RPCInfo{Ctx: context.Background()}); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	second, err := picker.Next(RPCInfo{Ctx: ctx})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if second.RemoteClient() == first.RemoteClient() {
+		t.Error("expected the second attempt on the endpoint not tried yet")
+	}
+
+	AttemptsFromContext(ctx).Add(second.RemoteClient())
+	if _, err = picker.Next(RPCInfo{Ctx: ctx}); err != nil {
+		t.Errorf("expected a pick once every endpoint was tried, got %v", err)
+	}
+}
+
 func TestRRPicker_Next_Concurrent(t *testing.T) {
 	numClients := 10
 	clients := make([]remote.Client, numClients)
@@ -18,6 +18,7 @@ package client
 import (
 	"context"
 	"log/slog"
+	"time"
 
 	"github.com/codesjoy/pkg/utils/xsync"
 
@@ -31,6 +32,7 @@ type balancerClient struct {
 	serializer   *xsync.Serializer
 	remoteStates map[string]remote.State
 	activeNames  map[string]struct{}
+	tracker      endpointTracker
 }
 
 // UpdateState updates the state of the client
@@ -61,6 +63,7 @@ func (bc *balancerClient) createStateListener(f func(remote.ClientState)) func(r
 	run := func(state remote.ClientState) {
 		prevState, tracked := bc.rememberRemoteState(state)
 		if tracked {
+			bc.tracker.record(state, bc.retryIn)
 			bc.maybeResolveNow(prevState, state)
 		}
 		f(state)
@@ -77,7 +80,10 @@ func (bc *balancerClient) createStateListener(f func(remote.ClientState)) func(r
 	}
 }
 
-func (bc *balancerClient) syncActiveEndpoints(state resolver.State) {
+// syncActiveEndpoints records the resolved endpoints and reports whether
+// any of them is new.
+func (bc *balancerClient) syncActiveEndpoints(state resolver.State) bool {
+	fresh := bc.tracker.setEndpoints(state)
 	activeNames := map[string]struct{}{}
 	if state != nil {
 		endpoints := state.GetEndpoints()
@@ -96,7 +102,7 @@ func (bc *balancerClient) syncActiveEndpoints(state resolver.State) {
 	}
 	if bc.serializer == nil {
 		apply()
-		return
+		return fresh
 	}
 
 	done := make(chan struct{})
@@ -105,9 +111,10 @@ func (bc *balancerClient) syncActiveEndpoints(state resolver.State) {
 		close(done)
 	}); err != nil {
 		slog.Error("syncActiveEndpoints failed", slog.Any("error", err))
-		return
+		return fresh
 	}
 	<-done
+	return fresh
 }
 
 func (bc *balancerClient) pruneRemoteStates() {
@@ -146,3 +153,15 @@ func (bc *balancerClient) maybeResolveNow(prevState remote.State, state remote.C
 		bc.cli.resolveNow()
 	}
 }
+
+// retryIn estimates the delay before a failed endpoint is retried.
+func (bc *balancerClient) retryIn(failures int) time.Duration {
+	if bc.cli == nil || bc.cli.streamBackoff == nil {
+		return 0
+	}
+	return bc.cli.streamBackoff.Backoff(failures)
+}
+
+func (bc *balancerClient) endpointStatus() (string, []EndpointStatus) {
+	return bc.tracker.snapshot()
+}
@@ -0,0 +1,209 @@
+// Copyright 2022 The codesjoy Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/codesjoy/yggdrasil/v3/rpc/metadata"
+	"github.com/codesjoy/yggdrasil/v3/rpc/stream"
+	remote "github.com/codesjoy/yggdrasil/v3/transport"
+)
+
+// CallOption configures a single call made through Invoke or NewStream.
+type CallOption interface {
+	apply(*callInfo)
+}
+
+type callOptionFunc func(*callInfo)
+
+func (f callOptionFunc) apply(c *callInfo) { f(c) }
+
+type callInfo struct {
+	waitForReady *bool
+	timeout      time.Duration
+	header       *metadata.MD
+	trailer      *metadata.MD
+	transport    remote.CallOptions
+	hasTransport bool
+
+	// Invoke may run several attempts at once, for example when hedging, and
+	// losing attempts can outlive the call. Their metadata is recorded under
+	// mu and published to header and trailer once the call returns.
+	mu         sync.Mutex
+	deferred   bool
+	settled    bool
+	published  bool
+	gotHeader  metadata.MD
+	gotTrailer metadata.MD
+}
+
+// WaitForReady makes the call wait until a connection is ready instead of
+// failing fast while the service has no ready endpoint. It overrides the
+// client's fast_fail setting for this call.
+func WaitForReady(wait bool) CallOption {
+	return callOptionFunc(func(c *callInfo) {
+		c.waitForReady = &wait
+	})
+}
+
+// PerCallTimeout bounds the call with timeout. A shorter deadline already
+// carried by the context or configured for the method is kept.
+func PerCallTimeout(timeout time.Duration) CallOption {
+	return callOptionFunc(func(c *callInfo) {
+		c.timeout = timeout
+	})
+}
+
+// Header stores the header metadata received from the server into md once
+// the call completes.
+func Header(md *metadata.MD) CallOption {
+	return callOptionFunc(func(c *callInfo) {
+		c.header = md
+	})
+}
+
+// Trailer stores the trailer metadata received from the server into md once
+// the call completes.
+func Trailer(md *metadata.MD) CallOption {
+	return callOptionFunc(func(c *callInfo) {
+		c.trailer = md
+	})
+}
+
+// MaxRecvMsgSize overrides the maximum response message size for the call.
+func MaxRecvMsgSize(size int) CallOption {
+	return callOptionFunc(func(c *callInfo) {
+		c.transport.MaxRecvMsgSize = size
+		c.hasTransport = true
+	})
+}
+
+// UseCompressor overrides the request compressor for the call.
+func UseCompressor(name string) CallOption {
+	return callOptionFunc(func(c *callInfo) {
+		c.transport.Compressor = name
+		c.hasTransport = true
+	})
+}
+
+// CallSettings is the effect of call options, for callers that do not go
+// through Client, such as generated REST clients.
+type CallSettings struct {
+	// Timeout is the PerCallTimeout, zero when unset.
+	Timeout time.Duration
+	// Header and Trailer are the targets of Header and Trailer, nil when
+	// unset.
+	Header  *metadata.MD
+	Trailer *metadata.MD
+}
+
+// ResolveCallOptions returns the settings applied by opts.
+func ResolveCallOptions(opts ...CallOption) CallSettings {
+	info := &callInfo{}
+	for _, opt := range opts {
+		if opt != nil {
+			opt.apply(info)
+		}
+	}
+	return CallSettings{Timeout: info.timeout, Header: info.header, Trailer: info.trailer}
+}
+
+// prepareCall applies the configured method timeout and the call options to
+// ctx. The call options that are not carried by ctx are returned as info, nil
+// when no option is given, so that nested calls made with ctx do not inherit
+// them. The returned flag reports whether a timeout was applied.
+func (c *client) prepareCall(
+	ctx context.Context,
+	method string,
+	opts []CallOption,
+) (context.Context, *callInfo, context.CancelFunc, bool) {
+	ctx, cancel, applied := c.withMethodTimeout(ctx, method)
+	if len(opts) == 0 {
+		return ctx, nil, cancel, applied
+	}
+	info := &callInfo{}
+	for _, opt := range opts {
+		if opt != nil {
+			opt.apply(info)
+		}
+	}
+	if info.timeout > 0 {
+		var callCancel context.CancelFunc
+		ctx, callCancel = context.WithTimeout(ctx, info.timeout)
+		methodCancel := cancel
+		cancel = func() {
+			callCancel()
+			methodCancel()
+		}
+		applied = true
+	}
+	if info.hasTransport {
+		ctx = remote.WithCallOptions(ctx, info.transport)
+	}
+	return ctx, info, cancel, applied
+}
+
+// capture copies the header and trailer of cs into the metadata requested
+// through Header and Trailer. err is the result of the attempt made on cs.
+func (info *callInfo) capture(cs stream.ClientStream, err error) {
+	if info == nil || (info.header == nil && info.trailer == nil) {
+		return
+	}
+	var header, trailer metadata.MD
+	if info.header != nil {
+		if md, err := cs.Header(); err == nil {
+			header = md
+		}
+	}
+	if info.trailer != nil {
+		trailer = cs.Trailer()
+	}
+	if !info.deferred {
+		info.store(header, trailer)
+		return
+	}
+	info.mu.Lock()
+	defer info.mu.Unlock()
+	// The first successful attempt is the one whose reply the caller gets.
+	if info.published || info.settled {
+		return
+	}
+	info.gotHeader, info.gotTrailer = header, trailer
+	info.settled = err == nil
+}
+
+// publish stores the metadata recorded by capture. Attempts that finish
+// afterwards are ignored.
+func (info *callInfo) publish() {
+	if info == nil {
+		return
+	}
+	info.mu.Lock()
+	defer info.mu.Unlock()
+	info.published = true
+	info.store(info.gotHeader, info.gotTrailer)
+}
+
+func (info *callInfo) store(header, trailer metadata.MD) {
+	if info.header != nil && header != nil {
+		*info.header = header
+	}
+	if info.trailer != nil && trailer != nil {
+		*info.trailer = trailer
+	}
+}
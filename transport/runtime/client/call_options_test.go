@@ -0,0 +1,271 @@
+// Copyright 2022 The codesjoy Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/codesjoy/pkg/utils/xsync"
+	"github.com/stretchr/testify/require"
+
+	"github.com/codesjoy/yggdrasil/v3/rpc/interceptor"
+	"github.com/codesjoy/yggdrasil/v3/rpc/interceptor/hedging"
+	"github.com/codesjoy/yggdrasil/v3/rpc/interceptor/mirror"
+	"github.com/codesjoy/yggdrasil/v3/rpc/metadata"
+	"github.com/codesjoy/yggdrasil/v3/rpc/stream"
+	remote "github.com/codesjoy/yggdrasil/v3/transport"
+)
+
+func TestPrepareCall(t *testing.T) {
+	cli := &client{}
+
+	_, info, cancel, applied := cli.prepareCall(context.Background(), "/svc/method", nil)
+	defer cancel()
+	require.False(t, applied)
+	require.Nil(t, info)
+
+	ctx, info, cancel, applied := cli.prepareCall(
+		context.Background(),
+		"/svc/method",
+		[]CallOption{PerCallTimeout(time.Second), MaxRecvMsgSize(1024), UseCompressor("gzip"), nil},
+	)
+	defer cancel()
+	require.True(t, applied)
+	deadline, ok := ctx.Deadline()
+	require.True(t, ok)
+	require.WithinDuration(t, time.Now().Add(time.Second), deadline, 100*time.Millisecond)
+	require.NotNil(t, info)
+
+	callOpts, ok := remote.CallOptionsFromContext(ctx)
+	require.True(t, ok)
+	require.Equal(t, remote.CallOptions{MaxRecvMsgSize: 1024, Compressor: "gzip"}, callOpts)
+}
+
+func TestResolveCallOptions(t *testing.T) {
+	var header, trailer metadata.MD
+	settings := ResolveCallOptions(
+		PerCallTimeout(time.Second), Header(&header), Trailer(&trailer), UseCompressor("gzip"), nil,
+	)
+	require.Equal(t, time.Second, settings.Timeout)
+	require.Same(t, &header, settings.Header)
+	require.Same(t, &trailer, settings.Trailer)
+	require.Equal(t, CallSettings{}, ResolveCallOptions())
+}
+
+func TestPrepareCall_KeepsShorterMethodTimeout(t *testing.T) {
+	cli := &client{methodTimeouts: map[string]time.Duration{"/svc/method": 10 * time.Millisecond}}
+	ctx, _, cancel, applied := cli.prepareCall(
+		context.Background(),
+		"/svc/method",
+		[]CallOption{PerCallTimeout(time.Minute)},
+	)
+	defer cancel()
+	require.True(t, applied)
+	deadline, ok := ctx.Deadline()
+	require.True(t, ok)
+	require.Less(t, time.Until(deadline), time.Second)
+
+	_, ok = remote.CallOptionsFromContext(ctx)
+	require.False(t, ok)
+}
+
+func TestInvoke_CallOptionsReachInterceptor(t *testing.T) {
+	cli := &client{}
+	var sawDeadline bool
+	cli.chains.Store(&interceptorChains{unary: func(
+		ctx context.Context,
+		method string,
+		req, reply any,
+		_ interceptor.UnaryInvoker,
+	) error {
+		_, sawDeadline = ctx.Deadline()
+		return nil
+	}})
+	require.NoError(t, cli.Invoke(context.Background(), "/svc/unary", "req", nil, PerCallTimeout(time.Second)))
+	require.True(t, sawDeadline)
+}
+
+func TestClientStream_CaptureHeaderAndTrailer(t *testing.T) {
+	t.Run("unary", func(t *testing.T) {
+		st := newMockClientStream(context.Background())
+		st.header = metadata.Pairs("h-key", "h-val")
+		st.trailer = metadata.Pairs("t-key", "t-val")
+
+		var header, trailer metadata.MD
+		info := &callInfo{}
+		Header(&header).apply(info)
+		Trailer(&trailer).apply(info)
+		cs := &clientStream{
+			desc:         &stream.Desc{ServerStreams: false},
+			ClientStream: st,
+			info:         info,
+			report:       func(error) {},
+		}
+		require.NoError(t, cs.RecvMsg(nil))
+		require.Equal(t, []string{"h-val"}, header["h-key"])
+		require.Equal(t, []string{"t-val"}, trailer["t-key"])
+	})
+
+	t.Run("server streaming waits for end of stream", func(t *testing.T) {
+		st := newMockClientStream(context.Background())
+		st.trailer = metadata.Pairs("t-key", "t-val")
+
+		var trailer metadata.MD
+		info := &callInfo{}
+		Trailer(&trailer).apply(info)
+		cs := &clientStream{
+			desc:         &stream.Desc{ServerStreams: true},
+			ClientStream: st,
+			info:         info,
+			report:       func(error) {},
+		}
+		require.NoError(t, cs.RecvMsg(nil))
+		require.Nil(t, trailer)
+
+		st.SetRecvErr(io.EOF)
+		require.True(t, errors.Is(cs.RecvMsg(nil), io.EOF))
+		require.Equal(t, []string{"t-val"}, trailer["t-key"])
+	})
+}
+
+func TestNewStream_WaitForReadyOverridesFastFail(t *testing.T) {
+	newTestClient := func() *client {
+		cli := &client{
+			ctx:           context.Background(),
+			fastFail:      true,
+			resolvedEvent: xsync.NewEvent(),
+		}
+		cli.resolvedEvent.Fire()
+		cli.pickerSnap.Store(&pickerSnap{picker: nil, blockingCh: make(chan struct{})})
+		picker := newMockPicker()
+		picker.AddResult(nil, errors.New("transient"))
+		cli.updatePicker(picker)
+		return cli
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	_, err := newTestClient().newStream(ctx, nil, &stream.Desc{}, "/svc/method")
+	require.Error(t, err)
+	require.NoError(t, ctx.Err())
+
+	ctx, cancel = context.WithTimeout(context.Background(), 30*time.Millisecond)
+	defer cancel()
+	cli := newTestClient()
+	ctx, info, callCancel, _ := cli.prepareCall(ctx, "/svc/method", []CallOption{WaitForReady(true)})
+	defer callCancel()
+	_, err = cli.newStream(ctx, info, &stream.Desc{}, "/svc/method")
+	require.Error(t, err)
+	require.ErrorIs(t, ctx.Err(), context.DeadlineExceeded)
+}
+
+// attemptStream answers a unary call with its attempt label in the reply,
+// header and trailer. The first attempt never answers before it is cancelled.
+type attemptStream struct {
+	*mockClientStream
+	label string
+}
+
+func (s *attemptStream) RecvMsg(reply any) error {
+	if s.label == "1" {
+		<-s.ctx.Done()
+		return s.ctx.Err()
+	}
+	*reply.(*string) = s.label
+	return nil
+}
+
+type shadowInvoker struct{ cli *client }
+
+func (s shadowInvoker) Invoke(ctx context.Context, method string, args, reply any) error {
+	return s.cli.Invoke(ctx, method, args, reply)
+}
+
+func newLabelledClient(label func() string) *client {
+	cli := &client{ctx: context.Background(), fastFail: true, resolvedEvent: xsync.NewEvent()}
+	cli.resolvedEvent.Fire()
+	cli.pickerSnap.Store(&pickerSnap{picker: nil, blockingCh: make(chan struct{})})
+	rc := newMockRemoteClient("rc", remote.Ready)
+	rc.newStreamFunc = func(
+		ctx context.Context,
+		_ *stream.Desc,
+		_ string,
+	) (stream.ClientStream, error) {
+		st := newMockClientStream(ctx)
+		name := label()
+		st.header = metadata.Pairs("attempt", name)
+		st.trailer = metadata.Pairs("attempt", name)
+		return &attemptStream{mockClientStream: st, label: name}, nil
+	}
+	picker := newMockPicker()
+	picker.AddResult(newMockPickResult(rc), nil)
+	cli.updatePicker(picker)
+	return cli
+}
+
+func TestInvoke_HeaderAndTrailerWithMirrorAndHedging(t *testing.T) {
+	var shadowCalls atomic.Int32
+	shadow := newLabelledClient(func() string {
+		shadowCalls.Add(1)
+		return "shadow"
+	})
+	targets := mirror.NewTargets(func(context.Context, string) (mirror.Invoker, error) {
+		return shadowInvoker{cli: shadow}, nil
+	})
+	defer targets.Close()
+	mirrorProvider := mirror.BuiltinUnaryClientProviderWithConfig(map[string]any{
+		"services": map[string]any{"svc": map[string]any{"target": "shadow", "percent": 100}},
+	}, targets)
+	hedgingProvider := hedging.BuiltinUnaryClientProviderWithConfig(map[string]any{
+		"delay":        "1ms",
+		"max_attempts": 3,
+		"methods":      []string{"/svc/method"},
+	})
+	unary := interceptor.ChainUnaryClientInterceptorsWithProviders(
+		"svc",
+		[]string{mirrorProvider.Name(), hedgingProvider.Name()},
+		map[string]interceptor.UnaryClientInterceptorProvider{
+			mirrorProvider.Name():  mirrorProvider,
+			hedgingProvider.Name(): hedgingProvider,
+		},
+	)
+
+	const calls = 20
+	for i := 0; i < calls; i++ {
+		var attempts atomic.Int32
+		cli := newLabelledClient(func() string {
+			return strconv.Itoa(int(attempts.Add(1)))
+		})
+		cli.chains.Store(&interceptorChains{unary: unary})
+
+		var reply string
+		var header, trailer metadata.MD
+		require.NoError(t, cli.Invoke(
+			context.Background(), "/svc/method", "req", &reply, Header(&header), Trailer(&trailer),
+		))
+		require.NotEqual(t, "1", reply)
+		require.Equal(t, []string{reply}, header["attempt"])
+		require.Equal(t, []string{reply}, trailer["attempt"])
+	}
+	require.Eventually(
+		t, func() bool { return shadowCalls.Load() == calls }, time.Second, time.Millisecond,
+	)
+}
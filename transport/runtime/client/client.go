@@ -20,7 +20,9 @@ import (
 	"errors"
 	"io"
 	"log/slog"
+	"sync"
 	"sync/atomic"
+	"time"
 
 	"github.com/codesjoy/pkg/basic/xerror"
 	"github.com/codesjoy/pkg/utils/xgo"
@@ -29,6 +31,7 @@ import (
 
 	"github.com/codesjoy/yggdrasil/v3/discovery/resolver"
 	"github.com/codesjoy/yggdrasil/v3/internal/backoff"
+	"github.com/codesjoy/yggdrasil/v3/internal/xclock"
 	"github.com/codesjoy/yggdrasil/v3/observability/stats"
 	"github.com/codesjoy/yggdrasil/v3/rpc/interceptor"
 	"github.com/codesjoy/yggdrasil/v3/rpc/metadata"
@@ -42,9 +45,24 @@ var ErrClientClosing = xerror.New(code.Code_CANCELLED, "the client is closing")
 
 // Client is the client interface.
 type Client interface {
-	Invoke(ctx context.Context, method string, args, reply interface{}) error
-	NewStream(ctx context.Context, desc *stream.Desc, method string) (stream.ClientStream, error)
+	Invoke(ctx context.Context, method string, args, reply interface{}, opts ...CallOption) error
+	NewStream(
+		ctx context.Context,
+		desc *stream.Desc,
+		method string,
+		opts ...CallOption,
+	) (stream.ClientStream, error)
 	Close() error
+	// GetState returns the connectivity state of the client.
+	GetState() remote.State
+	// WaitForStateChange blocks until the state differs from source or ctx
+	// is done, and reports whether the state changed.
+	WaitForStateChange(ctx context.Context, source remote.State) bool
+	// Connect makes an idle client reconnect without waiting for an RPC.
+	Connect()
+	// ResetBackoff makes the connections in backoff reconnect immediately.
+	// It is called automatically when the resolver reports new endpoints.
+	ResetBackoff()
 }
 
 // Runtime exposes the App-scoped runtime dependencies needed by the client package.
@@ -67,6 +85,7 @@ type Runtime interface {
 type clientStream struct {
 	desc *stream.Desc
 	stream.ClientStream
+	info     *callInfo
 	report   func(err error)
 	reported atomic.Bool
 }
@@ -98,6 +117,9 @@ func (c *clientStream) RecvMsg(m interface{}) error {
 			_ = metadata.SetTrailer(c.Context(), trailer)
 		}
 	}
+	if !c.desc.ServerStreams || err != nil {
+		c.info.capture(c.ClientStream, err)
+	}
 	if err == nil && !c.desc.ServerStreams {
 		c.reportResult(nil)
 		return nil
@@ -116,22 +138,30 @@ type client struct {
 	ctx    context.Context
 	cancel context.CancelFunc
 
-	appName  string
-	fastFail bool
+	appName        string
+	target         string
+	watchName      string
+	fastFail       bool
+	methodTimeouts map[string]time.Duration
 
-	resolver resolver.Resolver
-	balancer balancer.Balancer
+	resolver    resolver.Resolver
+	balancer    balancer.Balancer
+	newBalancer func() (balancer.Balancer, error)
 
-	unaryInterceptor  interceptor.UnaryClientInterceptor
-	streamInterceptor interceptor.StreamClientInterceptor
-	statsHandler      stats.Handler
+	chains       atomic.Pointer[interceptorChains]
+	statsHandler stats.Handler
 
 	pickerSnap atomic.Pointer[pickerSnap]
 
 	streamBackoff backoff.Strategy
+	clock         xclock.Clock
 	stateChange   chan resolver.State
 	resolvedEvent *xsync.Event
 	channelState  atomic.Int32
+	stateMu       sync.Mutex
+	stateChanged  chan struct{}
+
+	idle idleState
 
 	remoteClientManager *remoteClientManager
 	balancerClient      *balancerClient
@@ -139,27 +169,48 @@ type client struct {
 	runtime             Runtime
 }
 
-// New creates a new client from one explicit runtime snapshot.
-func New(ctx context.Context, appName string, runtimeSnapshot Runtime) (_ Client, err error) {
+// New creates a new client from one explicit runtime snapshot. The target is
+// a bare service name or a scheme://authority/endpoint URI resolved by
+// resolver.ResolveTarget; the resolver or endpoints it names override the
+// settings of the snapshot, and options override both.
+func New(
+	ctx context.Context,
+	appName string,
+	runtimeSnapshot Runtime,
+	opts ...Option,
+) (_ Client, err error) {
 	if runtimeSnapshot == nil {
 		return nil, errors.New("client runtime is required")
 	}
-	cfg := runtimeSnapshot.ClientSettings(appName)
+	target, err := resolver.ResolveTarget(appName)
+	if err != nil {
+		return nil, err
+	}
+	cfg := runtimeSnapshot.ClientSettings(target.Service)
+	applyTarget(&cfg, target)
+	for _, opt := range opts {
+		opt(&cfg)
+	}
 	statsHandler := runtimeSnapshot.ClientStatsHandler()
 	cli := &client{
-		appName:       appName,
-		fastFail:      cfg.FastFail,
-		statsHandler:  statsHandler,
-		stateChange:   make(chan resolver.State, 1),
-		resolvedEvent: xsync.NewEvent(),
-		runtime:       runtimeSnapshot,
+		appName:        target.Service,
+		target:         appName,
+		watchName:      target.Watch,
+		fastFail:       cfg.FastFail,
+		methodTimeouts: methodTimeouts(cfg.Methods),
+		statsHandler:   statsHandler,
+		stateChange:    make(chan resolver.State, 1),
+		resolvedEvent:  xsync.NewEvent(),
+		runtime:        runtimeSnapshot,
+		clock:          xclock.Real(),
 	}
+	cli.idle = idleState{timeout: cfg.IdleTimeout, clock: cli.clock}
 	cli.ctx, cli.cancel = context.WithCancel(ctx)
 	cli.channelState.Store(int32(remote.Idle))
 
 	cli.remoteClientManager = newRemoteClientManager(
 		cli.ctx,
-		appName,
+		target.Service,
 		statsHandler,
 		runtimeSnapshot,
 	)
@@ -169,7 +220,7 @@ func New(ctx context.Context, appName string, runtimeSnapshot Runtime) (_ Client
 			return
 		}
 		if watchRegistered && cli.resolver != nil {
-			if cleanupErr := cli.resolver.DelWatch(cli.appName, cli); cleanupErr != nil {
+			if cleanupErr := cli.resolver.DelWatch(cli.watchName, cli); cleanupErr != nil {
 				slog.Error("failed to clean up resolver watch", slog.Any("error", cleanupErr))
 			}
 		}
@@ -201,7 +252,7 @@ func New(ctx context.Context, appName string, runtimeSnapshot Runtime) (_ Client
 	}
 	cli.initInterceptor()
 	if cli.resolver != nil {
-		if err = cli.resolver.AddWatch(cli.appName, cli); err != nil {
+		if err = cli.resolver.AddWatch(cli.watchName, cli); err != nil {
 			return nil, err
 		}
 		watchRegistered = true
@@ -211,5 +262,13 @@ func New(ctx context.Context, appName string, runtimeSnapshot Runtime) (_ Client
 			return nil, err
 		}
 	}
+	if err = cli.warmup(ctx, cfg.Warmup); err != nil {
+		return nil, err
+	}
+	if cli.idle.timeout > 0 {
+		cli.idle.touch()
+		xgo.Go(cli.watchIdle)
+	}
+	trackClient(cli)
 	return cli, nil
 }
@@ -17,8 +17,10 @@ package client
 import (
 	"context"
 	"errors"
+	"fmt"
 	"strconv"
 	"strings"
+	"sync"
 	"sync/atomic"
 	"testing"
 	"time"
@@ -28,7 +30,11 @@ import (
 	"github.com/codesjoy/pkg/utils/xsync"
 
 	"github.com/codesjoy/yggdrasil/v3/discovery/resolver"
+	"github.com/codesjoy/yggdrasil/v3/eventbus"
+	"github.com/codesjoy/yggdrasil/v3/internal/xclock"
+	"github.com/codesjoy/yggdrasil/v3/observability/stats"
 	"github.com/codesjoy/yggdrasil/v3/rpc/interceptor"
+	"github.com/codesjoy/yggdrasil/v3/rpc/interceptor/hedging"
 	"github.com/codesjoy/yggdrasil/v3/rpc/stream"
 	remote "github.com/codesjoy/yggdrasil/v3/transport"
 	"github.com/codesjoy/yggdrasil/v3/transport/runtime/client/balancer"
@@ -170,6 +176,90 @@ func TestClientUpdateState_RemoteStatesPrunedAndStaleIgnored(t *testing.T) {
 	require.Equal(t, map[string]remote.State{"b": remote.Ready}, bc.remoteStates)
 }
 
+// resettableRemoteClient counts backoff resets.
+type resettableRemoteClient struct {
+	*mockRemoteClient
+	resets atomic.Int32
+}
+
+func (c *resettableRemoteClient) ResetBackoff() { c.resets.Add(1) }
+
+func TestClientUpdateStateResetsBackoffOnNewEndpoints(t *testing.T) {
+	runtime := newTestRuntime()
+	var created []*resettableRemoteClient
+	runtime.clientProviders["test"] = remote.NewTransportClientProvider(
+		"test",
+		func(
+			_ context.Context,
+			_ string,
+			endpoint resolver.Endpoint,
+			_ stats.Handler,
+			_ remote.OnStateChange,
+		) (remote.Client, error) {
+			rc := &resettableRemoteClient{
+				mockRemoteClient: newMockRemoteClient(endpoint.Name(), remote.TransientFailure),
+			}
+			created = append(created, rc)
+			return rc, nil
+		},
+	)
+	runtime.newBalancer = func(
+		serviceName, balancerName string,
+		cli balancer.Client,
+	) (balancer.Balancer, error) {
+		return balancer.BuiltinProvider().New(serviceName, balancerName, cli)
+	}
+	endpointA := resolver.BaseEndpoint{Address: "127.0.0.1:1001", Protocol: "test"}
+	endpointB := resolver.BaseEndpoint{Address: "127.0.0.1:1002", Protocol: "test"}
+	runtime.configs["svc"] = ServiceSettings{
+		Remote: RemoteSettings{Endpoints: []resolver.BaseEndpoint{endpointA}},
+	}
+	cliRaw, err := New(context.Background(), "svc", runtime)
+	require.NoError(t, err)
+	defer func() { _ = cliRaw.Close() }()
+	cli := cliRaw.(*client)
+	require.Len(t, created, 1)
+	require.Zero(t, created[0].resets.Load())
+
+	cli.updateState(resolver.BaseState{Endpoints: []resolver.Endpoint{endpointA}})
+	require.Zero(t, created[0].resets.Load())
+
+	cli.updateState(resolver.BaseState{Endpoints: []resolver.Endpoint{endpointA, endpointB}})
+	require.Len(t, created, 2)
+	require.Equal(t, int32(1), created[0].resets.Load())
+}
+
+func TestClientUpdateStatePublishesEndpointsChanged(t *testing.T) {
+	var got []eventbus.ClientEndpointsChanged
+	unsubscribe := eventbus.Subscribe(
+		eventbus.Default(),
+		func(_ context.Context, event eventbus.ClientEndpointsChanged) {
+			if event.Target == "events-target" {
+				got = append(got, event)
+			}
+		},
+	)
+	defer unsubscribe()
+
+	cli := &client{
+		ctx:           context.Background(),
+		appName:       "events-target",
+		target:        "events-target",
+		balancer:      newMockBalancer(),
+		resolvedEvent: xsync.NewEvent(),
+	}
+	cli.updateState(resolver.BaseState{
+		Endpoints: []resolver.Endpoint{newMockEndpoint("a", "127.0.0.1:9001", "grpc")},
+	})
+
+	require.Equal(t, []eventbus.ClientEndpointsChanged{{
+		Target: "events-target",
+		Endpoints: []eventbus.Endpoint{
+			{Name: "a", Protocol: "grpc", Address: "127.0.0.1:9001"},
+		},
+	}}, got)
+}
+
 func TestClientWatchUpdateStateAndStaticState(t *testing.T) {
 	t.Run("watchUpdateState applies updates", func(t *testing.T) {
 		ctx, cancel := context.WithCancel(context.Background())
@@ -259,7 +349,7 @@ func TestClientInvokeAndNewStream(t *testing.T) {
 	cli.updatePicker(picker)
 
 	var streamIntCalled bool
-	cli.streamInterceptor = func(
+	cli.chains.Store(&interceptorChains{stream: func(
 		ctx context.Context,
 		desc *stream.Desc,
 		method string,
@@ -267,13 +357,13 @@ func TestClientInvokeAndNewStream(t *testing.T) {
 	) (stream.ClientStream, error) {
 		streamIntCalled = true
 		return streamer(ctx, desc, method)
-	}
+	}})
 	_, err := cli.NewStream(context.Background(), &stream.Desc{ServerStreams: true}, "/svc/stream")
 	require.NoError(t, err)
 	require.True(t, streamIntCalled)
 
 	var unaryIntCalled bool
-	cli.unaryInterceptor = func(
+	cli.chains.Store(&interceptorChains{unary: func(
 		ctx context.Context,
 		method string,
 		req, reply any,
@@ -281,7 +371,7 @@ func TestClientInvokeAndNewStream(t *testing.T) {
 	) error {
 		unaryIntCalled = true
 		return invoker(ctx, method, req, reply)
-	}
+	}})
 	var reply string
 	require.NoError(t, cli.Invoke(context.Background(), "/svc/unary", "req", &reply))
 	require.True(t, unaryIntCalled)
@@ -308,13 +398,58 @@ func TestNewStream_NoAvailableInstanceDoesNotBackoff(t *testing.T) {
 
 			ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
 			defer cancel()
-			_, err := cli.newStream(ctx, &stream.Desc{}, "/svc/method")
+			_, err := cli.newStream(ctx, nil, &stream.Desc{}, "/svc/method")
 			require.Error(t, err)
 			require.Equal(t, int32(0), backoffCounter.Count())
 		})
 	}
 }
 
+type fixedBackoff time.Duration
+
+func (b fixedBackoff) Backoff(int) time.Duration { return time.Duration(b) }
+
+func TestNewStream_RetryWaitsOnClientClock(t *testing.T) {
+	clock := xclock.NewFake(time.Unix(0, 0))
+	cli := &client{
+		ctx:           context.Background(),
+		fastFail:      true,
+		streamBackoff: fixedBackoff(time.Hour),
+		clock:         clock,
+		resolvedEvent: xsync.NewEvent(),
+	}
+	cli.resolvedEvent.Fire()
+	cli.pickerSnap.Store(&pickerSnap{picker: nil, blockingCh: make(chan struct{})})
+
+	var attempts atomic.Int32
+	rc := newMockRemoteClient("rc", remote.Ready)
+	rc.newStreamFunc = func(
+		ctx context.Context,
+		_ *stream.Desc,
+		_ string,
+	) (stream.ClientStream, error) {
+		if attempts.Add(1) == 1 {
+			return nil, errors.New("transient")
+		}
+		return newMockClientStream(ctx), nil
+	}
+	picker := newMockPicker()
+	picker.AddResult(newMockPickResult(rc), nil)
+	cli.updatePicker(picker)
+
+	errCh := make(chan error, 1)
+	go func() {
+		_, err := cli.newStream(context.Background(), nil, &stream.Desc{}, "/svc/method")
+		errCh <- err
+	}()
+
+	require.Eventually(t, func() bool { return clock.Waiters() == 1 }, time.Second, time.Millisecond)
+	require.Equal(t, int32(1), attempts.Load())
+	clock.Advance(time.Hour)
+	require.NoError(t, <-errCh)
+	require.Equal(t, int32(2), attempts.Load())
+}
+
 func TestNewClientStaticAndClose(t *testing.T) {
 	runtime := newTestRuntime()
 	runtime.configs["svc"] = ServiceSettings{
@@ -335,6 +470,74 @@ func TestNewClientStaticAndClose(t *testing.T) {
 	require.ErrorIs(t, cli.Close(), ErrClientClosing)
 }
 
+type watchRecordingResolver struct {
+	added, deleted []string
+}
+
+func (r *watchRecordingResolver) AddWatch(name string, _ resolver.Client) error {
+	r.added = append(r.added, name)
+	return nil
+}
+
+func (r *watchRecordingResolver) DelWatch(name string, _ resolver.Client) error {
+	r.deleted = append(r.deleted, name)
+	return nil
+}
+
+func (r *watchRecordingResolver) Type() string { return "recording" }
+
+func TestNewClientTargets(t *testing.T) {
+	t.Run("registry target watches the service on the authority resolver", func(t *testing.T) {
+		runtime := newTestRuntime()
+		runtime.configs["orders"] = ServiceSettings{Resolver: "default"}
+		r := &watchRecordingResolver{}
+		var resolverName string
+		runtime.newResolver = func(name string) (resolver.Resolver, error) {
+			resolverName = name
+			return r, nil
+		}
+
+		cliRaw, err := New(context.Background(), "etcd://east/orders", runtime)
+		require.NoError(t, err)
+		cli := cliRaw.(*client)
+		require.Equal(t, "east", resolverName)
+		require.Equal(t, []string{"orders"}, r.added)
+		require.Equal(t, "orders", cli.appName)
+		require.Equal(t, "etcd://east/orders", cli.status().Target)
+
+		require.NoError(t, cli.Close())
+		require.Equal(t, []string{"orders"}, r.deleted)
+	})
+
+	t.Run("custom scheme dials static endpoints", func(t *testing.T) {
+		resolver.RegisterScheme("mem", func(target resolver.Target) (resolver.TargetResolution, error) {
+			return resolver.TargetResolution{
+				Service:   target.Endpoint,
+				Endpoints: []resolver.BaseEndpoint{{Address: target.Authority, Protocol: "test"}},
+			}, nil
+		})
+		t.Cleanup(func() { resolver.RegisterScheme("mem", nil) })
+
+		runtime := newTestRuntime()
+		runtime.newResolver = func(name string) (resolver.Resolver, error) {
+			return nil, fmt.Errorf("unexpected resolver %s", name)
+		}
+		runtime.configs["svc"] = ServiceSettings{Resolver: "configured"}
+
+		cliRaw, err := New(context.Background(), "mem://127.0.0.1:1001/svc", runtime)
+		require.NoError(t, err)
+		cli := cliRaw.(*client)
+		require.Nil(t, cli.resolver)
+		require.True(t, cli.resolvedEvent.HasFired())
+		require.NoError(t, cli.Close())
+	})
+
+	t.Run("invalid target", func(t *testing.T) {
+		_, err := New(context.Background(), "", newTestRuntime())
+		require.Error(t, err)
+	})
+}
+
 func TestNewClientNoEndpoints(t *testing.T) {
 	runtime := newTestRuntime()
 	runtime.configs["svc"] = ServiceSettings{}
@@ -484,3 +687,98 @@ func TestClientCloseAggregatesErrors(t *testing.T) {
 	require.Contains(t, err.Error(), "remote close error")
 	require.ErrorIs(t, cli.Close(), ErrClientClosing)
 }
+
+func TestClientConfigureInterceptorsSwapsChangedChains(t *testing.T) {
+	var builds int32
+	runtime := newTestRuntime()
+	runtime.buildUnary = func(string, []string) interceptor.UnaryClientInterceptor {
+		atomic.AddInt32(&builds, 1)
+		return nil
+	}
+	cli := &client{appName: "svc", runtime: runtime}
+	cli.initInterceptor()
+	require.Equal(t, int32(1), atomic.LoadInt32(&builds))
+	first := cli.chains.Load()
+
+	cli.ConfigureInterceptors(runtime)
+	require.Same(t, first, cli.chains.Load())
+
+	runtime.configs["svc"] = ServiceSettings{
+		Interceptors: InterceptorSettings{Unary: []string{"ratelimit"}},
+	}
+	cli.ConfigureInterceptors(runtime)
+	require.NotSame(t, first, cli.chains.Load())
+	require.Equal(t, []string{"ratelimit"}, cli.chains.Load().settings.Unary)
+	require.Equal(t, int32(2), atomic.LoadInt32(&builds))
+}
+
+func TestInvoke_HedgedAttemptsReachDistinctEndpoints(t *testing.T) {
+	runtime := newTestRuntime()
+	var (
+		mu        sync.Mutex
+		endpoints []string
+		cli       *client
+	)
+	runtime.clientProviders["test"] = remote.NewTransportClientProvider(
+		"test",
+		func(
+			_ context.Context,
+			_ string,
+			endpoint resolver.Endpoint,
+			_ stats.Handler,
+			_ remote.OnStateChange,
+		) (remote.Client, error) {
+			rc := newMockRemoteClient(endpoint.Name(), remote.Ready)
+			rc.newStreamFunc = func(
+				ctx context.Context,
+				_ *stream.Desc,
+				method string,
+			) (stream.ClientStream, error) {
+				st := newMockClientStream(ctx)
+				if method != "/svc/method" {
+					return &attemptStream{mockClientStream: st, label: "other"}, nil
+				}
+				mu.Lock()
+				endpoints = append(endpoints, endpoint.Name())
+				first := len(endpoints) == 1
+				mu.Unlock()
+				if first {
+					// Another call takes the next endpoint, so round robin alone
+					// would send the hedged attempt to this endpoint again.
+					var reply string
+					require.NoError(t, cli.Invoke(context.Background(), "/svc/other", "req", &reply))
+					return &attemptStream{mockClientStream: st, label: "1"}, nil
+				}
+				return &attemptStream{mockClientStream: st, label: endpoint.Name()}, nil
+			}
+			return rc, nil
+		},
+	)
+	runtime.newBalancer = func(
+		serviceName, balancerName string,
+		cli balancer.Client,
+	) (balancer.Balancer, error) {
+		return balancer.BuiltinProvider().New(serviceName, balancerName, cli)
+	}
+	runtime.configs["svc"] = ServiceSettings{
+		Remote: RemoteSettings{Endpoints: []resolver.BaseEndpoint{
+			{Address: "127.0.0.1:1001", Protocol: "test"},
+			{Address: "127.0.0.1:1002", Protocol: "test"},
+		}},
+	}
+	cliRaw, err := New(context.Background(), "svc", runtime)
+	require.NoError(t, err)
+	defer func() { _ = cliRaw.Close() }()
+	cli = cliRaw.(*client)
+	cli.chains.Store(&interceptorChains{unary: hedging.BuiltinUnaryClientProviderWithConfig(
+		map[string]any{"delay": "1ms", "max_attempts": 2, "methods": []string{"/svc/method"}},
+	).New("svc")})
+
+	var reply string
+	require.NoError(t, cli.Invoke(context.Background(), "/svc/method", "req", &reply))
+	mu.Lock()
+	defer mu.Unlock()
+	require.Len(t, endpoints, 2)
+	require.NotEqual(t, endpoints[0], endpoints[1])
+	require.Equal(t, endpoints[1], reply)
+}
@@ -116,6 +116,30 @@ func (m *remoteClientManager) GetOrCreate(
 	return remoteClient, nil
 }
 
+// readyCount returns the number of managed connections that are ready.
+func (m *remoteClientManager) readyCount() int {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	n := 0
+	for _, rc := range m.remoteClients {
+		if rc.State() == remote.Ready {
+			n++
+		}
+	}
+	return n
+}
+
+// resetBackoff makes the managed connections in backoff reconnect now.
+func (m *remoteClientManager) resetBackoff() {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	for _, rc := range m.remoteClients {
+		if resetter, ok := rc.Client.(remote.BackoffResetter); ok {
+			resetter.ResetBackoff()
+		}
+	}
+}
+
 // Remove removes and closes a connection by endpoint name.
 func (m *remoteClientManager) Remove(name string) error {
 	m.mu.Lock()
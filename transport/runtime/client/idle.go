@@ -0,0 +1,135 @@
+// Copyright 2022 The codesjoy Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"log/slog"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/codesjoy/yggdrasil/v3/discovery/resolver"
+	"github.com/codesjoy/yggdrasil/v3/internal/xclock"
+	remote "github.com/codesjoy/yggdrasil/v3/transport"
+)
+
+// idleState tracks RPC activity for the idle timeout. mu also guards
+// balancer replacement and resolver state delivery.
+type idleState struct {
+	timeout time.Duration
+	clock   xclock.Clock
+
+	calls        atomic.Int64
+	lastActivity atomic.Int64
+
+	mu sync.Mutex
+	// idle reports whether the client is idle. It changes only under mu but
+	// is read without it, so an RPC on a busy client takes no lock.
+	// beginCall counts the call before exitIdle reads idle, and enterIdle
+	// sets idle before it reads calls, so either the call sees the client
+	// idle and rebuilds it, or enterIdle sees the call and backs out.
+	idle      atomic.Bool
+	lastState resolver.State
+}
+
+func (s *idleState) touch() {
+	s.lastActivity.Store(s.clock.Now().UnixNano())
+}
+
+// beginCall records an RPC in flight; the returned func ends it.
+func (c *client) beginCall() func() {
+	if c.idle.timeout <= 0 {
+		return func() {}
+	}
+	c.idle.calls.Add(1)
+	c.idle.touch()
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			c.idle.touch()
+			c.idle.calls.Add(-1)
+		})
+	}
+}
+
+func (c *client) watchIdle() {
+	ticker := c.idle.clock.NewTicker(max(c.idle.timeout/4, 10*time.Millisecond))
+	defer ticker.Stop()
+	for {
+		select {
+		case <-c.ctx.Done():
+			return
+		case <-ticker.C():
+		}
+		if c.idle.calls.Load() > 0 {
+			continue
+		}
+		last := time.Unix(0, c.idle.lastActivity.Load())
+		if c.idle.clock.Since(last) >= c.idle.timeout {
+			c.enterIdle()
+		}
+	}
+}
+
+// enterIdle closes the balancer and with it all remote clients. Resolver
+// updates are still recorded so exitIdle can rebuild the balancer.
+func (c *client) enterIdle() {
+	c.idle.mu.Lock()
+	defer c.idle.mu.Unlock()
+	if c.idle.idle.Load() || c.idle.calls.Load() > 0 || c.closed.Load() {
+		return
+	}
+	c.idle.idle.Store(true)
+	if c.idle.calls.Load() > 0 {
+		// A call started after the check above and may already have passed
+		// the fast path of exitIdle.
+		c.idle.idle.Store(false)
+		return
+	}
+	if err := c.balancer.Close(); err != nil {
+		slog.Warn("close balancer on idle error", slog.Any("error", err))
+	}
+	c.updatePicker(nil)
+	c.updateConnectivityState(remote.Idle)
+}
+
+// Connect makes an idle client reconnect.
+func (c *client) Connect() {
+	if err := c.exitIdle(); err != nil {
+		slog.Warn("fault to exit idle", slog.Any("error", err))
+	}
+}
+
+func (c *client) exitIdle() error {
+	if !c.idle.idle.Load() {
+		return nil
+	}
+	c.idle.mu.Lock()
+	defer c.idle.mu.Unlock()
+	if !c.idle.idle.Load() || c.closed.Load() {
+		return nil
+	}
+	b, err := c.newBalancer()
+	if err != nil {
+		return err
+	}
+	c.balancer = b
+	c.idle.idle.Store(false)
+	c.idle.touch()
+	if c.idle.lastState != nil {
+		b.UpdateState(c.idle.lastState)
+	}
+	return nil
+}
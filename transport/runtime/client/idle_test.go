@@ -0,0 +1,136 @@
+// Copyright 2022 The codesjoy Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/codesjoy/yggdrasil/v3/discovery/resolver"
+	remote "github.com/codesjoy/yggdrasil/v3/transport"
+	"github.com/codesjoy/yggdrasil/v3/transport/runtime/client/balancer"
+)
+
+func newIdleTestClient(t *testing.T, idleTimeout time.Duration) *client {
+	t.Helper()
+	runtime := newTestRuntime()
+	runtime.newBalancer = func(serviceName, balancerName string, cli balancer.Client) (balancer.Balancer, error) {
+		return balancer.BuiltinProvider().New(serviceName, balancerName, cli)
+	}
+	runtime.configs["svc"] = ServiceSettings{
+		IdleTimeout: idleTimeout,
+		Remote: RemoteSettings{
+			Endpoints: []resolver.BaseEndpoint{
+				{Address: "127.0.0.1:1001", Protocol: "test"},
+			},
+		},
+	}
+	cliRaw, err := New(context.Background(), "svc", runtime)
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = cliRaw.Close() })
+	return cliRaw.(*client)
+}
+
+func remoteClientCount(c *client) int {
+	c.remoteClientManager.mu.RLock()
+	defer c.remoteClientManager.mu.RUnlock()
+	return len(c.remoteClientManager.remoteClients)
+}
+
+func TestClientIdleTimeoutTearsDownAndReconnects(t *testing.T) {
+	cli := newIdleTestClient(t, 30*time.Millisecond)
+	require.Equal(t, remote.Ready, cli.GetState())
+	require.Equal(t, 1, remoteClientCount(cli))
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	require.True(t, cli.WaitForStateChange(ctx, remote.Ready))
+	for cli.GetState() != remote.Idle {
+		require.True(t, cli.WaitForStateChange(ctx, cli.GetState()))
+	}
+	assert.Equal(t, 0, remoteClientCount(cli))
+
+	var reply string
+	require.NoError(t, cli.Invoke(ctx, "/svc/unary", "req", &reply))
+	assert.Equal(t, remote.Ready, cli.GetState())
+	assert.Equal(t, 1, remoteClientCount(cli))
+}
+
+func TestClientConnectExitsIdle(t *testing.T) {
+	cli := newIdleTestClient(t, time.Hour)
+	cli.enterIdle()
+	require.Equal(t, remote.Idle, cli.GetState())
+
+	cli.Connect()
+	assert.Equal(t, remote.Ready, cli.GetState())
+	assert.Equal(t, 1, remoteClientCount(cli))
+}
+
+func TestClientEnterIdleRacesWithCall(t *testing.T) {
+	cli := newIdleTestClient(t, time.Hour)
+	stop := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+				cli.enterIdle()
+			}
+		}
+	}()
+	defer func() {
+		close(stop)
+		<-stopped
+	}()
+	for i := 0; i < 5000; i++ {
+		done := cli.beginCall()
+		require.NoError(t, cli.exitIdle())
+		// The call is in flight, so the client must not go idle under it.
+		require.False(t, cli.idle.idle.Load(), "iteration %d", i)
+		require.NotNil(t, cli.pickerSnap.Load().picker, "iteration %d", i)
+		done()
+	}
+}
+
+func TestClientWaitForStateChangeContextDone(t *testing.T) {
+	cli := newIdleTestClient(t, 0)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	assert.False(t, cli.WaitForStateChange(ctx, remote.Ready))
+	assert.True(t, cli.WaitForStateChange(context.Background(), remote.Idle))
+}
+
+func TestClientExitIdleSkipsLockWhenActive(t *testing.T) {
+	cli := newIdleTestClient(t, time.Hour)
+	// A resolver update holding the lock must not stall RPCs of a client
+	// that is not idle.
+	cli.idle.mu.Lock()
+	defer cli.idle.mu.Unlock()
+	done := make(chan error, 1)
+	go func() { done <- cli.exitIdle() }()
+	select {
+	case err := <-done:
+		assert.NoError(t, err)
+	case <-time.After(time.Second):
+		t.Fatal("exitIdle waited for the idle lock")
+	}
+}
@@ -15,22 +15,79 @@
 package client
 
 import (
+	"reflect"
 	"slices"
+
+	"github.com/codesjoy/yggdrasil/v3/rpc/interceptor"
 )
 
+// interceptorChains holds the interceptor chains of a client. It is swapped
+// as a whole when a reload changes the configured chains.
+type interceptorChains struct {
+	settings InterceptorSettings
+	unary    interceptor.UnaryClientInterceptor
+	stream   interceptor.StreamClientInterceptor
+}
+
 func (c *client) initInterceptor() {
-	cfg := c.runtime.ClientSettings(c.appName)
-	unaryNames := append([]string(nil), cfg.Interceptors.Unary...)
+	c.chains.Store(c.buildInterceptorChains(c.runtime))
+}
+
+// ConfigureInterceptors rebuilds the interceptor chains of a running client
+// from runtime when its configured names or rules changed. Calls in flight
+// finish with the chain they started with; unchanged chains are kept.
+func (c *client) ConfigureInterceptors(runtime Runtime) {
+	if current := c.chains.Load(); current != nil &&
+		reflect.DeepEqual(current.settings, runtime.ClientSettings(c.appName).Interceptors) {
+		return
+	}
+	c.chains.Store(c.buildInterceptorChains(runtime))
+}
+
+func (c *client) unaryInterceptor() interceptor.UnaryClientInterceptor {
+	if chains := c.chains.Load(); chains != nil {
+		return chains.unary
+	}
+	return nil
+}
+
+func (c *client) streamInterceptor() interceptor.StreamClientInterceptor {
+	if chains := c.chains.Load(); chains != nil {
+		return chains.stream
+	}
+	return nil
+}
+
+func (c *client) buildInterceptorChains(runtime Runtime) *interceptorChains {
+	cfg := runtime.ClientSettings(c.appName).Interceptors
+	chains := &interceptorChains{settings: cfg}
+	if len(cfg.Rules) > 0 {
+		chains.unary = interceptor.ScopedUnaryClientInterceptor(
+			interceptor.NewChainResolver(cfg.Unary, cfg.Rules),
+			func(names []string) interceptor.UnaryClientInterceptor {
+				return runtime.BuildUnaryClientInterceptor(c.appName, names)
+			},
+		)
+		chains.stream = interceptor.ScopedStreamClientInterceptor(
+			interceptor.NewChainResolver(cfg.Stream, cfg.Rules),
+			func(names []string) interceptor.StreamClientInterceptor {
+				return runtime.BuildStreamClientInterceptor(c.appName, names)
+			},
+		)
+		return chains
+	}
+	unaryNames := append([]string(nil), cfg.Unary...)
 	unaryNames = dedupStableStrings(
 		slices.DeleteFunc(unaryNames, func(s string) bool { return s == "" }),
 	)
-	c.unaryInterceptor = c.runtime.BuildUnaryClientInterceptor(c.appName, unaryNames)
+	chains.unary = runtime.BuildUnaryClientInterceptor(c.appName, unaryNames)
 
-	streamNames := append([]string(nil), cfg.Interceptors.Stream...)
+	streamNames := append([]string(nil), cfg.Stream...)
 	streamNames = dedupStableStrings(
 		slices.DeleteFunc(streamNames, func(s string) bool { return s == "" }),
 	)
-	c.streamInterceptor = c.runtime.BuildStreamClientInterceptor(c.appName, streamNames)
+	chains.stream = runtime.BuildStreamClientInterceptor(c.appName, streamNames)
+	return chains
 }
 
 func dedupStableStrings(values []string) []string {
@@ -0,0 +1,229 @@
+// Copyright 2022 The codesjoy Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/codesjoy/yggdrasil/v3/discovery/resolver"
+	remote "github.com/codesjoy/yggdrasil/v3/transport"
+)
+
+// TargetStatus is the client-side view of one target: its connectivity,
+// the policies serving it and the state of every resolved endpoint.
+type TargetStatus struct {
+	Target    string           `json:"target"`
+	State     string           `json:"state"`
+	Idle      bool             `json:"idle"`
+	Resolver  string           `json:"resolver,omitempty"`
+	Balancer  string           `json:"balancer,omitempty"`
+	Picker    string           `json:"picker,omitempty"`
+	LastError string           `json:"last_error,omitempty"`
+	Endpoints []EndpointStatus `json:"endpoints"`
+}
+
+// EndpointStatus is the connection state of one endpoint of a target.
+type EndpointStatus struct {
+	Name            string     `json:"name"`
+	Address         string     `json:"address"`
+	Protocol        string     `json:"protocol"`
+	State           string     `json:"state"`
+	LastError       string     `json:"last_error,omitempty"`
+	LastStateChange *time.Time `json:"last_state_change,omitempty"`
+	// Failures counts the connection failures since the endpoint was last
+	// ready.
+	Failures int `json:"consecutive_failures,omitempty"`
+	// NextRetry estimates when a failed endpoint is retried, based on the
+	// client backoff settings.
+	NextRetry *time.Time `json:"next_retry,omitempty"`
+}
+
+var liveClients = struct {
+	sync.Mutex
+	clients map[*client]struct{}
+}{clients: map[*client]struct{}{}}
+
+func trackClient(c *client) {
+	liveClients.Lock()
+	defer liveClients.Unlock()
+	liveClients.clients[c] = struct{}{}
+}
+
+func untrackClient(c *client) {
+	liveClients.Lock()
+	defer liveClients.Unlock()
+	delete(liveClients.clients, c)
+}
+
+// Targets returns the status of every open client, ordered by target.
+func Targets() []TargetStatus {
+	liveClients.Lock()
+	clients := make([]*client, 0, len(liveClients.clients))
+	for c := range liveClients.clients {
+		clients = append(clients, c)
+	}
+	liveClients.Unlock()
+
+	out := make([]TargetStatus, 0, len(clients))
+	for _, c := range clients {
+		out = append(out, c.status())
+	}
+	slices.SortStableFunc(out, func(a, b TargetStatus) int {
+		return strings.Compare(a.Target, b.Target)
+	})
+	return out
+}
+
+func (c *client) status() TargetStatus {
+	out := TargetStatus{
+		Target:    c.target,
+		State:     c.GetState().String(),
+		Endpoints: []EndpointStatus{},
+	}
+	if c.resolver != nil {
+		out.Resolver = c.resolver.Type()
+	}
+	c.idle.mu.Lock()
+	out.Idle = c.idle.idle.Load()
+	if c.balancer != nil {
+		out.Balancer = c.balancer.Type()
+	}
+	c.idle.mu.Unlock()
+	if snap := c.pickerSnap.Load(); snap != nil && snap.picker != nil {
+		out.Picker = fmt.Sprintf("%T", snap.picker)
+	}
+	if c.balancerClient != nil {
+		out.LastError, out.Endpoints = c.balancerClient.endpointStatus()
+	}
+	return out
+}
+
+// endpointTracker records the connection history of the resolved endpoints.
+type endpointTracker struct {
+	mu        sync.Mutex
+	endpoints []resolver.Endpoint
+	entries   map[string]*endpointEntry
+	lastErr   error
+}
+
+type endpointEntry struct {
+	state     remote.State
+	lastErr   error
+	changedAt time.Time
+	failures  int
+	nextRetry time.Time
+}
+
+// setEndpoints records the resolved endpoints and reports whether any of
+// them was not resolved before.
+func (t *endpointTracker) setEndpoints(state resolver.State) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	known := make(map[string]struct{}, len(t.endpoints))
+	for _, ep := range t.endpoints {
+		known[ep.Name()] = struct{}{}
+	}
+	t.endpoints = nil
+	if state != nil {
+		t.endpoints = slices.DeleteFunc(slices.Clone(state.GetEndpoints()),
+			func(ep resolver.Endpoint) bool { return ep == nil })
+	}
+	fresh := false
+	active := make(map[string]struct{}, len(t.endpoints))
+	for _, ep := range t.endpoints {
+		active[ep.Name()] = struct{}{}
+		if _, ok := known[ep.Name()]; !ok {
+			fresh = true
+		}
+	}
+	for name := range t.entries {
+		if _, ok := active[name]; !ok {
+			delete(t.entries, name)
+		}
+	}
+	return fresh
+}
+
+func (t *endpointTracker) record(state remote.ClientState, retryIn func(int) time.Duration) {
+	if state.Endpoint == nil {
+		return
+	}
+	now := time.Now()
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.entries == nil {
+		t.entries = map[string]*endpointEntry{}
+	}
+	entry, ok := t.entries[state.Endpoint.Name()]
+	if !ok {
+		entry = &endpointEntry{}
+		t.entries[state.Endpoint.Name()] = entry
+	}
+	if !ok || entry.state != state.State {
+		entry.changedAt = now
+	}
+	entry.state = state.State
+	switch state.State {
+	case remote.Ready:
+		entry.failures, entry.lastErr, entry.nextRetry = 0, nil, time.Time{}
+	case remote.TransientFailure:
+		entry.failures++
+		entry.lastErr = state.ConnectionError
+		entry.nextRetry = time.Time{}
+		if retryIn != nil {
+			entry.nextRetry = now.Add(retryIn(entry.failures - 1))
+		}
+		if state.ConnectionError != nil {
+			t.lastErr = state.ConnectionError
+		}
+	}
+}
+
+func (t *endpointTracker) snapshot() (string, []EndpointStatus) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	out := make([]EndpointStatus, 0, len(t.endpoints))
+	for _, ep := range t.endpoints {
+		item := EndpointStatus{
+			Name:     ep.Name(),
+			Address:  ep.GetAddress(),
+			Protocol: ep.GetProtocol(),
+			State:    remote.Idle.String(),
+		}
+		if entry, ok := t.entries[ep.Name()]; ok {
+			item.State = entry.state.String()
+			item.Failures = entry.failures
+			if entry.lastErr != nil {
+				item.LastError = entry.lastErr.Error()
+			}
+			changedAt := entry.changedAt
+			item.LastStateChange = &changedAt
+			if !entry.nextRetry.IsZero() && entry.state == remote.TransientFailure {
+				nextRetry := entry.nextRetry
+				item.NextRetry = &nextRetry
+			}
+		}
+		out = append(out, item)
+	}
+	lastErr := ""
+	if t.lastErr != nil {
+		lastErr = t.lastErr.Error()
+	}
+	return lastErr, out
+}
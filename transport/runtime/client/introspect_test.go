@@ -0,0 +1,117 @@
+// Copyright 2022 The codesjoy Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/codesjoy/yggdrasil/v3/discovery/resolver"
+	remote "github.com/codesjoy/yggdrasil/v3/transport"
+)
+
+func findTarget(target string) (TargetStatus, bool) {
+	for _, item := range Targets() {
+		if item.Target == target {
+			return item, true
+		}
+	}
+	return TargetStatus{}, false
+}
+
+func TestTargetsReportsEndpointStates(t *testing.T) {
+	runtime := newTestRuntime()
+	runtime.configs["introspect-svc"] = ServiceSettings{
+		Remote: RemoteSettings{
+			Endpoints: []resolver.BaseEndpoint{
+				{Address: "127.0.0.1:1001", Protocol: "test"},
+				{Address: "127.0.0.1:1002", Protocol: "test"},
+			},
+		},
+	}
+	cliRaw, err := New(context.Background(), "introspect-svc", runtime)
+	require.NoError(t, err)
+	cli := cliRaw.(*client)
+	cli.streamBackoff = &countingBackoff{}
+
+	status, ok := findTarget("introspect-svc")
+	require.True(t, ok)
+	require.Equal(t, "mock_balancer", status.Balancer)
+	require.Empty(t, status.Resolver)
+	require.Len(t, status.Endpoints, 2)
+	require.Equal(t, "127.0.0.1:1001", status.Endpoints[0].Address)
+	require.Equal(t, remote.Idle.String(), status.Endpoints[0].State)
+	require.Nil(t, status.Endpoints[0].LastStateChange)
+
+	endpoint := resolver.BaseEndpoint{Address: "127.0.0.1:1001", Protocol: "test"}
+	listener := cli.balancerClient.createStateListener(func(remote.ClientState) {})
+	done := make(chan struct{})
+	listener(remote.ClientState{
+		Endpoint:        endpoint,
+		State:           remote.TransientFailure,
+		ConnectionError: errors.New("connection refused"),
+	})
+	require.NoError(t, cli.balancerClient.serializer.Submit(func(context.Context) {
+		close(done)
+	}))
+	<-done
+
+	status, _ = findTarget("introspect-svc")
+	require.Equal(t, "connection refused", status.LastError)
+	failed := status.Endpoints[0]
+	require.Equal(t, remote.TransientFailure.String(), failed.State)
+	require.Equal(t, "connection refused", failed.LastError)
+	require.Equal(t, 1, failed.Failures)
+	require.NotNil(t, failed.LastStateChange)
+	require.NotNil(t, failed.NextRetry)
+	require.WithinDuration(t, time.Now(), *failed.NextRetry, time.Second)
+
+	done = make(chan struct{})
+	listener(remote.ClientState{Endpoint: endpoint, State: remote.Ready})
+	require.NoError(t, cli.balancerClient.serializer.Submit(func(context.Context) {
+		close(done)
+	}))
+	<-done
+	status, _ = findTarget("introspect-svc")
+	require.Equal(t, remote.Ready.String(), status.Endpoints[0].State)
+	require.Zero(t, status.Endpoints[0].Failures)
+	require.Nil(t, status.Endpoints[0].NextRetry)
+
+	require.NoError(t, cli.Close())
+	_, ok = findTarget("introspect-svc")
+	require.False(t, ok)
+}
+
+func TestEndpointTrackerPrunesRemovedEndpoints(t *testing.T) {
+	var tracker endpointTracker
+	a := resolver.BaseEndpoint{Address: "a:1", Protocol: "test"}
+	b := resolver.BaseEndpoint{Address: "b:1", Protocol: "test"}
+	tracker.setEndpoints(resolver.BaseState{Endpoints: []resolver.Endpoint{a, b}})
+	tracker.record(remote.ClientState{Endpoint: a, State: remote.Connecting}, nil)
+	tracker.setEndpoints(resolver.BaseState{Endpoints: []resolver.Endpoint{b}})
+	require.NotContains(t, tracker.entries, a.Name())
+
+	_, endpoints := tracker.snapshot()
+	require.Len(t, endpoints, 1)
+	require.Equal(t, "b:1", endpoints[0].Address)
+
+	tracker.setEndpoints(nil)
+	_, endpoints = tracker.snapshot()
+	require.Empty(t, endpoints)
+}
@@ -16,20 +16,34 @@ package client
 
 import (
 	"context"
-	"time"
 
+	"github.com/codesjoy/yggdrasil/v3/internal/xclock"
+	"github.com/codesjoy/yggdrasil/v3/rpc/interceptor"
 	"github.com/codesjoy/yggdrasil/v3/rpc/metadata"
 	"github.com/codesjoy/yggdrasil/v3/rpc/stream"
 	"github.com/codesjoy/yggdrasil/v3/transport/runtime/client/balancer"
+	"github.com/codesjoy/yggdrasil/v3/transport/support/orca"
 )
 
 // Invoke performs a unary RPC and returns after the response is received into reply.
-func (c *client) Invoke(ctx context.Context, method string, args, reply interface{}) error {
+func (c *client) Invoke(
+	ctx context.Context,
+	method string,
+	args, reply interface{},
+	opts ...CallOption,
+) error {
+	ctx, info, cancel, _ := c.prepareCall(ctx, method, opts)
+	defer cancel()
 	ctx = metadata.WithStreamContext(ctx)
-	if c.unaryInterceptor != nil {
-		return c.unaryInterceptor(ctx, method, args, reply, c.invoke)
+	if info != nil {
+		info.deferred = true
+		defer info.publish()
+	}
+	invoker := c.invoker(info)
+	if unary := c.unaryInterceptor(); unary != nil {
+		return unary(ctx, method, args, reply, invoker)
 	}
-	return c.invoke(ctx, method, args, reply)
+	return invoker(ctx, method, args, reply)
 }
 
 // NewStream creates a new stream.
@@ -37,58 +51,116 @@ func (c *client) NewStream(
 	ctx context.Context,
 	desc *stream.Desc,
 	method string,
+	opts ...CallOption,
 ) (stream.ClientStream, error) {
-	if c.streamInterceptor != nil {
-		return c.streamInterceptor(ctx, desc, method, c.newStream)
+	ctx, info, cancel, applied := c.prepareCall(ctx, method, opts)
+	var (
+		st  stream.ClientStream
+		err error
+	)
+	streamer := c.streamer(info)
+	if streamInt := c.streamInterceptor(); streamInt != nil {
+		st, err = streamInt(ctx, desc, method, streamer)
+	} else {
+		st, err = streamer(ctx, desc, method)
+	}
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	if !applied {
+		return st, nil
+	}
+	return &timeoutClientStream{ClientStream: st, desc: desc, cancel: cancel}, nil
+}
+
+// invoker returns the unary invoker at the end of the interceptor chain for a
+// call made with info.
+func (c *client) invoker(info *callInfo) interceptor.UnaryInvoker {
+	return func(ctx context.Context, method string, args, reply any) error {
+		return c.invoke(ctx, info, method, args, reply)
+	}
+}
+
+// streamer returns the streamer at the end of the interceptor chain for a call
+// made with info.
+func (c *client) streamer(info *callInfo) interceptor.Streamer {
+	return func(ctx context.Context, desc *stream.Desc, method string) (stream.ClientStream, error) {
+		return c.newStream(ctx, info, desc, method)
 	}
-	return c.newStream(ctx, desc, method)
 }
 
 func (c *client) newStream(
 	ctx context.Context,
+	info *callInfo,
 	desc *stream.Desc,
 	method string,
 ) (stream.ClientStream, error) {
+	done := c.beginCall()
+	if err := c.exitIdle(); err != nil {
+		done()
+		return nil, err
+	}
 	if err := c.waitForResolved(ctx); err != nil {
+		done()
 		return nil, err
 	}
 	pickInfo := &balancer.RPCInfo{
 		Ctx:    ctx,
 		Method: method,
 	}
+	failFast := c.fastFail
+	if info != nil && info.waitForReady != nil {
+		failFast = !*info.waitForReady
+	}
 	retries := 0
 	for {
-		r, err := c.pick(c.fastFail, pickInfo)
+		r, err := c.pick(failFast, pickInfo)
 		if err != nil {
+			done()
 			return nil, err
 		}
+		balancer.AttemptsFromContext(ctx).Add(r.RemoteClient())
 
 		st, err := r.RemoteClient().NewStream(ctx, desc, method)
 		if err == nil {
 			return &clientStream{
 				desc:         desc,
 				ClientStream: st,
-				report:       r.Report,
+				info:         info,
+				report: func(err error) {
+					reportLoad(r, st)
+					r.Report(err)
+					done()
+				},
 			}, nil
 		}
 		r.Report(err)
-		t := time.NewTimer(c.streamBackoff.Backoff(retries))
+		t := xclock.OrReal(c.clock).NewTimer(c.streamBackoff.Backoff(retries))
 		select {
 		case <-c.ctx.Done():
 			t.Stop()
+			done()
 			return nil, ErrClientClosing
 		case <-ctx.Done():
 			t.Stop()
+			done()
 			return nil, err
-		case <-t.C:
+		case <-t.C():
 			retries++
 		}
 	}
 }
 
-func (c *client) invoke(ctx context.Context, method string, args, reply interface{}) error {
+func (c *client) invoke(
+	ctx context.Context,
+	info *callInfo,
+	method string,
+	args, reply interface{},
+) error {
 	cs, err := c.newStream(
 		ctx,
+		info,
 		&stream.Desc{ServerStreams: false, ClientStreams: false},
 		method,
 	)
@@ -101,3 +173,15 @@ func (c *client) invoke(ctx context.Context, method string, args, reply interfac
 	err = cs.RecvMsg(reply)
 	return err
 }
+
+// reportLoad hands the load report in the trailer of st to balancers that
+// weigh endpoints by utilization.
+func reportLoad(r balancer.PickResult, st stream.ClientStream) {
+	receiver, ok := r.(balancer.LoadReportReceiver)
+	if !ok {
+		return
+	}
+	if report, ok := orca.FromTrailer(st.Trailer()); ok {
+		receiver.ReportLoad(report)
+	}
+}
@@ -0,0 +1,398 @@
+// Copyright 2022 The codesjoy Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"maps"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/codesjoy/yggdrasil/v3/discovery/resolver"
+	"github.com/codesjoy/yggdrasil/v3/rpc/metadata"
+	remote "github.com/codesjoy/yggdrasil/v3/transport"
+	"github.com/codesjoy/yggdrasil/v3/transport/runtime/client/balancer"
+)
+
+// routeHashBuckets is the number of buckets used by RouteHashRange.
+const routeHashBuckets = 100
+
+// routingBalancer sits between the resolver and the configured balancer. It
+// partitions resolved endpoints into the subsets referenced by the routing
+// rules, runs one child balancer per subset and selects the child picker per
+// call. Remote clients are shared between children selecting the same
+// endpoint.
+type routingBalancer struct {
+	cli  balancer.Client
+	kind string
+
+	mu       sync.Mutex
+	closed   bool
+	routes   []*route
+	fallback *subset
+	subsets  []*subset
+
+	remotesMu sync.Mutex
+	remotes   map[string]*sharedRemote
+}
+
+type subset struct {
+	selector  map[string]string
+	balancer  balancer.Balancer
+	state     balancer.State
+	endpoints int
+}
+
+type route struct {
+	match  RouteMatch
+	subset *subset
+}
+
+func newRoutingBalancer(
+	cfg RoutingSettings,
+	cli balancer.Client,
+	build func(balancer.Client) (balancer.Balancer, error),
+) (_ *routingBalancer, err error) {
+	rb := &routingBalancer{cli: cli, remotes: map[string]*sharedRemote{}}
+	defer func() {
+		if err != nil {
+			_ = rb.Close()
+		}
+	}()
+	bySelector := map[string]*subset{}
+	subsetFor := func(selector map[string]string) (*subset, error) {
+		key := subsetKey(selector)
+		if item, ok := bySelector[key]; ok {
+			return item, nil
+		}
+		item := &subset{
+			selector: selector,
+			state:    balancer.State{ConnectivityState: remote.Idle},
+		}
+		child, err := build(&subsetClient{owner: rb, subset: item})
+		if err != nil {
+			return nil, err
+		}
+		item.balancer = child
+		rb.kind = child.Type()
+		bySelector[key] = item
+		rb.subsets = append(rb.subsets, item)
+		return item, nil
+	}
+	for i, rule := range cfg.Rules {
+		if len(rule.Subset) == 0 {
+			return nil, fmt.Errorf("routing rule %d has an empty subset", i)
+		}
+		item, err := subsetFor(rule.Subset)
+		if err != nil {
+			return nil, err
+		}
+		rb.routes = append(rb.routes, &route{match: rule.Match, subset: item})
+	}
+	if rb.fallback, err = subsetFor(cfg.DefaultSubset); err != nil {
+		return nil, err
+	}
+	return rb, nil
+}
+
+func subsetKey(selector map[string]string) string {
+	keys := slices.Sorted(maps.Keys(selector))
+	var b strings.Builder
+	for _, key := range keys {
+		b.WriteString(key)
+		b.WriteByte('=')
+		b.WriteString(selector[key])
+		b.WriteByte(';')
+	}
+	return b.String()
+}
+
+// UpdateState splits the resolved endpoints and forwards them to the children.
+func (rb *routingBalancer) UpdateState(state resolver.State) {
+	rb.mu.Lock()
+	if rb.closed {
+		rb.mu.Unlock()
+		return
+	}
+	subsets := slices.Clone(rb.subsets)
+	states := make([]resolver.BaseState, len(subsets))
+	for i, item := range subsets {
+		states[i].Attributes = state.GetAttributes()
+		for _, endpoint := range state.GetEndpoints() {
+			if endpoint != nil && matchSubset(item.selector, endpoint.GetAttributes()) {
+				states[i].Endpoints = append(states[i].Endpoints, endpoint)
+			}
+		}
+		item.endpoints = len(states[i].Endpoints)
+	}
+	rb.mu.Unlock()
+
+	for i, item := range subsets {
+		item.balancer.UpdateState(states[i])
+	}
+}
+
+func matchSubset(selector map[string]string, attributes map[string]any) bool {
+	for key, want := range selector {
+		value, ok := attributes[key]
+		if !ok || fmt.Sprint(value) != want {
+			return false
+		}
+	}
+	return true
+}
+
+// Close closes all child balancers.
+func (rb *routingBalancer) Close() error {
+	rb.mu.Lock()
+	if rb.closed {
+		rb.mu.Unlock()
+		return nil
+	}
+	rb.closed = true
+	subsets := rb.subsets
+	rb.mu.Unlock()
+
+	var multiErr error
+	for _, item := range subsets {
+		if err := item.balancer.Close(); err != nil {
+			multiErr = errors.Join(multiErr, err)
+		}
+	}
+	rb.cli.UpdateState(balancer.State{
+		ConnectivityState: remote.Shutdown,
+		Picker:            &routePicker{},
+	})
+	return multiErr
+}
+
+// Type returns the type of the child balancers.
+func (rb *routingBalancer) Type() string {
+	return rb.kind
+}
+
+func (rb *routingBalancer) updateSubsetState(item *subset, state balancer.State) {
+	rb.mu.Lock()
+	defer rb.mu.Unlock()
+	if rb.closed {
+		return
+	}
+	item.state = state
+	picker := &routePicker{fallback: rb.fallback.state.Picker}
+	for _, r := range rb.routes {
+		if r.subset.endpoints == 0 || r.subset.state.Picker == nil {
+			continue
+		}
+		picker.routes = append(picker.routes, routeEntry{
+			match:  r.match,
+			picker: r.subset.state.Picker,
+		})
+	}
+	rb.cli.UpdateState(balancer.State{
+		ConnectivityState: rb.aggregateStateLocked(),
+		Picker:            picker,
+	})
+}
+
+func (rb *routingBalancer) aggregateStateLocked() remote.State {
+	var numConnecting, numIdle int
+	for _, item := range rb.subsets {
+		switch item.state.ConnectivityState {
+		case remote.Ready:
+			return remote.Ready
+		case remote.Connecting:
+			numConnecting++
+		case remote.Idle:
+			numIdle++
+		}
+	}
+	switch {
+	case numConnecting > 0:
+		return remote.Connecting
+	case numIdle > 0:
+		return remote.Idle
+	default:
+		return remote.TransientFailure
+	}
+}
+
+func (rb *routingBalancer) acquireRemote(
+	endpoint resolver.Endpoint,
+	listener func(remote.ClientState),
+) (remote.Client, error) {
+	name := endpoint.Name()
+	rb.remotesMu.Lock()
+	defer rb.remotesMu.Unlock()
+	shared, ok := rb.remotes[name]
+	if !ok {
+		shared = &sharedRemote{listeners: map[*remoteHandle]func(remote.ClientState){}}
+		cli, err := rb.cli.NewRemoteClient(
+			endpoint,
+			balancer.NewRemoteClientOptions{StateListener: shared.notify},
+		)
+		if err != nil {
+			return nil, err
+		}
+		shared.client = cli
+		rb.remotes[name] = shared
+	}
+	handle := &remoteHandle{Client: shared.client, owner: rb, name: name}
+	shared.addListener(handle, listener)
+	return handle, nil
+}
+
+func (rb *routingBalancer) releaseRemote(handle *remoteHandle) error {
+	rb.remotesMu.Lock()
+	shared, ok := rb.remotes[handle.name]
+	if !ok {
+		rb.remotesMu.Unlock()
+		return nil
+	}
+	if shared.removeListener(handle) > 0 {
+		rb.remotesMu.Unlock()
+		return nil
+	}
+	delete(rb.remotes, handle.name)
+	rb.remotesMu.Unlock()
+	return shared.client.Close()
+}
+
+// sharedRemote fans out connectivity updates of one remote client to every
+// child balancer holding a handle to it.
+type sharedRemote struct {
+	client remote.Client
+
+	mu        sync.Mutex
+	listeners map[*remoteHandle]func(remote.ClientState)
+}
+
+func (s *sharedRemote) addListener(handle *remoteHandle, listener func(remote.ClientState)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if listener == nil {
+		listener = func(remote.ClientState) {}
+	}
+	s.listeners[handle] = listener
+}
+
+func (s *sharedRemote) removeListener(handle *remoteHandle) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.listeners, handle)
+	return len(s.listeners)
+}
+
+func (s *sharedRemote) notify(state remote.ClientState) {
+	s.mu.Lock()
+	listeners := slices.Collect(maps.Values(s.listeners))
+	s.mu.Unlock()
+	for _, listener := range listeners {
+		listener(state)
+	}
+}
+
+type remoteHandle struct {
+	remote.Client
+	owner *routingBalancer
+	name  string
+	once  sync.Once
+}
+
+// Close releases the handle; the remote client is closed with the last one.
+func (h *remoteHandle) Close() error {
+	var err error
+	h.once.Do(func() {
+		err = h.owner.releaseRemote(h)
+	})
+	return err
+}
+
+// subsetClient is the balancer.Client given to one child balancer.
+type subsetClient struct {
+	owner  *routingBalancer
+	subset *subset
+}
+
+// UpdateState records the child state and publishes a new routing picker.
+func (c *subsetClient) UpdateState(state balancer.State) {
+	c.owner.updateSubsetState(c.subset, state)
+}
+
+// NewRemoteClient returns a shared handle to the endpoint's remote client.
+func (c *subsetClient) NewRemoteClient(
+	endpoint resolver.Endpoint,
+	ops balancer.NewRemoteClientOptions,
+) (remote.Client, error) {
+	return c.owner.acquireRemote(endpoint, ops.StateListener)
+}
+
+type routeEntry struct {
+	match  RouteMatch
+	picker balancer.Picker
+}
+
+// routePicker delegates each pick to the picker of the first matching route
+// that has endpoints, and to the default subset otherwise.
+type routePicker struct {
+	routes   []routeEntry
+	fallback balancer.Picker
+}
+
+// Next picks from the routed subset.
+func (p *routePicker) Next(info balancer.RPCInfo) (balancer.PickResult, error) {
+	if len(p.routes) > 0 {
+		md, _ := metadata.FromOutContext(info.Ctx)
+		for _, item := range p.routes {
+			if matchRoute(item.match, info.Method, md) {
+				return item.picker.Next(info)
+			}
+		}
+	}
+	if p.fallback == nil {
+		return nil, balancer.ErrNoAvailableInstance
+	}
+	return p.fallback.Next(info)
+}
+
+func matchRoute(match RouteMatch, method string, md metadata.MD) bool {
+	if len(match.Methods) > 0 {
+		name := method[strings.LastIndex(method, "/")+1:]
+		if !slices.Contains(match.Methods, method) && !slices.Contains(match.Methods, name) {
+			return false
+		}
+	}
+	for key, want := range match.Metadata {
+		values := md.Get(key)
+		if len(values) == 0 || (want != "*" && !slices.Contains(values, want)) {
+			return false
+		}
+	}
+	if hr := match.HashRange; hr.Header != "" {
+		values := md.Get(hr.Header)
+		if len(values) == 0 {
+			return false
+		}
+		h := fnv.New32a()
+		_, _ = h.Write([]byte(values[0]))
+		bucket := h.Sum32() % routeHashBuckets
+		if bucket < hr.From || bucket >= hr.To {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,175 @@
+// Copyright 2022 The codesjoy Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/codesjoy/yggdrasil/v3/discovery/resolver"
+	"github.com/codesjoy/yggdrasil/v3/rpc/metadata"
+	remote "github.com/codesjoy/yggdrasil/v3/transport"
+	"github.com/codesjoy/yggdrasil/v3/transport/runtime/client/balancer"
+)
+
+type routingParentClient struct {
+	mu      sync.Mutex
+	state   balancer.State
+	created map[string]*mockRemoteClient
+}
+
+func (c *routingParentClient) UpdateState(state balancer.State) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.state = state
+}
+
+func (c *routingParentClient) NewRemoteClient(
+	endpoint resolver.Endpoint,
+	_ balancer.NewRemoteClientOptions,
+) (remote.Client, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	cli := newMockRemoteClient(endpoint.Name(), remote.Ready)
+	c.created[endpoint.Name()] = cli
+	return cli, nil
+}
+
+func (c *routingParentClient) picker() balancer.Picker {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.state.Picker
+}
+
+func newRoutingTestBalancer(t *testing.T, cfg RoutingSettings) (*routingBalancer, *routingParentClient) {
+	t.Helper()
+	parent := &routingParentClient{created: map[string]*mockRemoteClient{}}
+	rb, err := newRoutingBalancer(cfg, parent, func(cli balancer.Client) (balancer.Balancer, error) {
+		return balancer.BuiltinProvider().New("svc", "default", cli)
+	})
+	require.NoError(t, err)
+	return rb, parent
+}
+
+func routingEndpoint(name, version string) *mockEndpoint {
+	ep := newMockEndpoint(name, name, "mock")
+	ep.attributes["version"] = version
+	return ep
+}
+
+func pickName(t *testing.T, picker balancer.Picker, ctx context.Context) string {
+	t.Helper()
+	res, err := picker.Next(balancer.RPCInfo{Ctx: ctx, Method: "/pkg.Svc/Get"})
+	require.NoError(t, err)
+	return res.RemoteClient().(*remoteHandle).name
+}
+
+func TestRoutingBalancerRoutesByMetadata(t *testing.T) {
+	rb, parent := newRoutingTestBalancer(t, RoutingSettings{
+		Rules: []RouteRule{{
+			Match:  RouteMatch{Metadata: map[string]string{"x-canary": "true"}},
+			Subset: map[string]string{"version": "v2"},
+		}},
+		DefaultSubset: map[string]string{"version": "v1"},
+	})
+	rb.UpdateState(resolver.BaseState{Endpoints: []resolver.Endpoint{
+		routingEndpoint("a", "v1"),
+		routingEndpoint("b", "v2"),
+	}})
+
+	picker := parent.picker()
+	require.NotNil(t, picker)
+	canary := metadata.WithOutContext(context.Background(), metadata.Pairs("x-canary", "true"))
+	assert.Equal(t, "b", pickName(t, picker, canary))
+	assert.Equal(t, "a", pickName(t, picker, context.Background()))
+	assert.Equal(t, "round_robin", rb.Type())
+
+	require.NoError(t, rb.Close())
+	assert.True(t, parent.created["a"].IsClosed())
+	assert.True(t, parent.created["b"].IsClosed())
+	assert.Equal(t, remote.Shutdown, parent.state.ConnectivityState)
+}
+
+func TestRoutingBalancerFallsBackWhenSubsetEmpty(t *testing.T) {
+	rb, parent := newRoutingTestBalancer(t, RoutingSettings{
+		Rules: []RouteRule{{Subset: map[string]string{"version": "v2"}}},
+	})
+	defer func() { _ = rb.Close() }()
+	rb.UpdateState(resolver.BaseState{Endpoints: []resolver.Endpoint{
+		routingEndpoint("a", "v1"),
+	}})
+
+	assert.Equal(t, "a", pickName(t, parent.picker(), context.Background()))
+	assert.Equal(t, remote.Ready, parent.state.ConnectivityState)
+}
+
+func TestRoutingBalancerSharesRemoteClients(t *testing.T) {
+	rb, parent := newRoutingTestBalancer(t, RoutingSettings{
+		Rules: []RouteRule{{
+			Match:  RouteMatch{Methods: []string{"Get"}},
+			Subset: map[string]string{"version": "v1"},
+		}},
+	})
+	rb.UpdateState(resolver.BaseState{Endpoints: []resolver.Endpoint{
+		routingEndpoint("a", "v1"),
+	}})
+	require.Len(t, parent.created, 1)
+	require.Len(t, rb.remotes, 1)
+	assert.Len(t, rb.remotes["a"].listeners, 2)
+
+	rb.UpdateState(resolver.BaseState{Endpoints: []resolver.Endpoint{
+		routingEndpoint("a", "v2"),
+	}})
+	assert.False(t, parent.created["a"].IsClosed())
+	assert.Len(t, rb.remotes["a"].listeners, 1)
+
+	rb.UpdateState(resolver.BaseState{})
+	assert.True(t, parent.created["a"].IsClosed())
+	assert.Empty(t, rb.remotes)
+	require.NoError(t, rb.Close())
+}
+
+func TestRoutingBalancerRejectsEmptySubset(t *testing.T) {
+	parent := &routingParentClient{created: map[string]*mockRemoteClient{}}
+	_, err := newRoutingBalancer(
+		RoutingSettings{Rules: []RouteRule{{}}},
+		parent,
+		func(cli balancer.Client) (balancer.Balancer, error) {
+			return balancer.BuiltinProvider().New("svc", "default", cli)
+		},
+	)
+	require.Error(t, err)
+}
+
+func TestMatchRoute(t *testing.T) {
+	md := metadata.Pairs("x-canary", "true", "user-id", "42")
+	assert.True(t, matchRoute(RouteMatch{}, "/pkg.Svc/Get", nil))
+	assert.True(t, matchRoute(RouteMatch{Methods: []string{"Get"}}, "/pkg.Svc/Get", nil))
+	assert.True(t, matchRoute(RouteMatch{Methods: []string{"/pkg.Svc/Get"}}, "/pkg.Svc/Get", nil))
+	assert.False(t, matchRoute(RouteMatch{Methods: []string{"List"}}, "/pkg.Svc/Get", nil))
+	assert.True(t, matchRoute(RouteMatch{Metadata: map[string]string{"X-Canary": "*"}}, "/a/b", md))
+	assert.False(t, matchRoute(RouteMatch{Metadata: map[string]string{"x-canary": "false"}}, "/a/b", md))
+	assert.False(t, matchRoute(RouteMatch{Metadata: map[string]string{"x-missing": "*"}}, "/a/b", md))
+
+	all := RouteHashRange{Header: "user-id", From: 0, To: 100}
+	none := RouteHashRange{Header: "user-id", From: 0, To: 0}
+	assert.True(t, matchRoute(RouteMatch{HashRange: all}, "/a/b", md))
+	assert.False(t, matchRoute(RouteMatch{HashRange: none}, "/a/b", md))
+	assert.False(t, matchRoute(RouteMatch{HashRange: all}, "/a/b", nil))
+}
@@ -15,8 +15,11 @@
 package client
 
 import (
+	"time"
+
 	"github.com/codesjoy/yggdrasil/v3/discovery/resolver"
 	"github.com/codesjoy/yggdrasil/v3/internal/backoff"
+	"github.com/codesjoy/yggdrasil/v3/rpc/interceptor"
 )
 
 // RemoteSettings contains static endpoints and attributes for a client service.
@@ -29,6 +32,65 @@ type RemoteSettings struct {
 type InterceptorSettings struct {
 	Unary  []string `mapstructure:"unary"`
 	Stream []string `mapstructure:"stream"`
+	// Rules adjust the unary and stream chains per method.
+	Rules []interceptor.ChainRule `mapstructure:"rules"`
+}
+
+// MethodSettings contains per-method client settings.
+type MethodSettings struct {
+	// Timeout bounds each call of the method. A shorter deadline already
+	// carried by the caller context is kept.
+	Timeout time.Duration `mapstructure:"timeout"`
+}
+
+// RouteHashRange matches calls whose metadata value falls into the bucket
+// range [From, To) out of 100 hash buckets, e.g. a user-id percentage.
+type RouteHashRange struct {
+	Header string `mapstructure:"header"`
+	From   uint32 `mapstructure:"from"`
+	To     uint32 `mapstructure:"to"`
+}
+
+// RouteMatch selects the calls a route applies to. All configured conditions
+// must hold; an empty match selects every call.
+type RouteMatch struct {
+	// Methods lists full ("/pkg.Service/Method") or bare ("Method") names.
+	Methods []string `mapstructure:"methods"`
+	// Metadata requires outgoing metadata values; "*" only requires presence.
+	Metadata  map[string]string `mapstructure:"metadata"`
+	HashRange RouteHashRange    `mapstructure:"hash_range"`
+}
+
+// RouteRule sends matching calls to the endpoints whose attributes contain
+// every key and value of Subset.
+type RouteRule struct {
+	Name   string            `mapstructure:"name"`
+	Match  RouteMatch        `mapstructure:"match"`
+	Subset map[string]string `mapstructure:"subset"`
+}
+
+// RoutingSettings routes calls to endpoint subsets before load balancing.
+// Rules are evaluated in order and the first match with endpoints wins.
+type RoutingSettings struct {
+	Rules []RouteRule `mapstructure:"rules"`
+	// DefaultSubset selects endpoints for calls that match no rule. Empty
+	// selects all endpoints.
+	DefaultSubset map[string]string `mapstructure:"default_subset"`
+}
+
+// WarmupSettings connects a client while it is created, so the first RPCs
+// do not pay for name resolution and connection setup.
+type WarmupSettings struct {
+	// Endpoints is the number of endpoints that must be ready before New
+	// returns, capped at the number of resolved endpoints. Zero disables
+	// warmup.
+	Endpoints int `mapstructure:"endpoints"`
+	// Timeout bounds the wait. Zero waits until the context passed to New
+	// is done.
+	Timeout time.Duration `mapstructure:"timeout"`
+	// Required makes New fail when warmup does not complete; otherwise the
+	// failure is logged and the client connects in the background.
+	Required bool `mapstructure:"required"`
 }
 
 // ServiceSettings contains the resolved client settings for one service.
@@ -39,6 +101,15 @@ type ServiceSettings struct {
 	Backoff      backoff.Config      `mapstructure:"backoff"`
 	Remote       RemoteSettings      `mapstructure:"remote"`
 	Interceptors InterceptorSettings `mapstructure:"interceptors"`
+	// Methods is keyed by full method name ("/pkg.Service/Method") or by the
+	// bare method name ("Method").
+	Methods map[string]MethodSettings `mapstructure:"methods"`
+	Routing RoutingSettings           `mapstructure:"routing"`
+	// IdleTimeout tears down the connections of a client without RPCs for
+	// the given period; the next RPC reconnects. Zero disables idleness.
+	IdleTimeout time.Duration `mapstructure:"idle_timeout"`
+	// Warmup connects the client before New returns.
+	Warmup WarmupSettings `mapstructure:"warmup"`
 }
 
 // Settings contains resolved client settings for all services.
@@ -23,7 +23,9 @@ import (
 	"google.golang.org/genproto/googleapis/rpc/code"
 
 	"github.com/codesjoy/yggdrasil/v3/discovery/resolver"
+	"github.com/codesjoy/yggdrasil/v3/eventbus"
 	remote "github.com/codesjoy/yggdrasil/v3/transport"
+	"github.com/codesjoy/yggdrasil/v3/transport/runtime/client/balancer"
 )
 
 // Close closes the client.
@@ -31,13 +33,17 @@ func (c *client) Close() error {
 	if !c.closed.CompareAndSwap(false, true) {
 		return ErrClientClosing
 	}
+	untrackClient(c)
 	var multiErr error
 	if c.resolver != nil {
-		if err := c.resolver.DelWatch(c.appName, c); err != nil {
+		if err := c.resolver.DelWatch(c.watchName, c); err != nil {
 			multiErr = errors.Join(multiErr, err)
 		}
 	}
-	if err := c.balancer.Close(); err != nil {
+	c.idle.mu.Lock()
+	b := c.balancer
+	c.idle.mu.Unlock()
+	if err := b.Close(); err != nil {
 		multiErr = errors.Join(multiErr, err)
 	}
 	c.cancel()
@@ -89,15 +95,84 @@ func (c *client) watchUpdateState() {
 }
 
 func (c *client) updateState(state resolver.State) {
+	fresh := false
 	if c.balancerClient != nil {
-		c.balancerClient.syncActiveEndpoints(state)
+		fresh = c.balancerClient.syncActiveEndpoints(state)
+	}
+	c.idle.mu.Lock()
+	c.idle.lastState = state
+	if !c.idle.idle.Load() {
+		c.balancer.UpdateState(state)
+	}
+	c.idle.mu.Unlock()
+	if fresh && c.resolvedEvent.HasFired() {
+		// New endpoints usually follow a deploy; retry the endpoints that
+		// failed during the rollout now instead of after their backoff.
+		c.ResetBackoff()
 	}
-	c.balancer.UpdateState(state)
 	c.resolvedEvent.Fire()
+	c.publishEndpointsChanged(state)
+}
+
+// ResetBackoff makes the connections in backoff reconnect immediately.
+func (c *client) ResetBackoff() {
+	if c.remoteClientManager != nil {
+		c.remoteClientManager.resetBackoff()
+	}
+}
+
+func (c *client) publishEndpointsChanged(state resolver.State) {
+	var resolved []resolver.Endpoint
+	if state != nil {
+		resolved = state.GetEndpoints()
+	}
+	endpoints := make([]eventbus.Endpoint, 0, len(resolved))
+	for _, item := range resolved {
+		endpoints = append(endpoints, eventbus.Endpoint{
+			Name:     item.Name(),
+			Protocol: item.GetProtocol(),
+			Address:  item.GetAddress(),
+		})
+	}
+	eventbus.Publish(c.ctx, eventbus.Default(), eventbus.ClientEndpointsChanged{
+		Target:    c.target,
+		Endpoints: endpoints,
+	})
 }
 
 func (c *client) updateConnectivityState(state remote.State) {
-	c.channelState.Store(int32(state))
+	c.stateMu.Lock()
+	defer c.stateMu.Unlock()
+	if remote.State(c.channelState.Swap(int32(state))) != state && c.stateChanged != nil {
+		close(c.stateChanged)
+		c.stateChanged = nil
+	}
+}
+
+// GetState returns the connectivity state of the client.
+func (c *client) GetState() remote.State {
+	return remote.State(c.channelState.Load())
+}
+
+// WaitForStateChange blocks until the state differs from source or ctx is done.
+func (c *client) WaitForStateChange(ctx context.Context, source remote.State) bool {
+	for {
+		c.stateMu.Lock()
+		if c.GetState() != source {
+			c.stateMu.Unlock()
+			return true
+		}
+		if c.stateChanged == nil {
+			c.stateChanged = make(chan struct{})
+		}
+		ch := c.stateChanged
+		c.stateMu.Unlock()
+		select {
+		case <-ch:
+		case <-ctx.Done():
+			return false
+		}
+	}
 }
 
 func (c *client) updateStaticState(cfg ServiceSettings) error {
@@ -115,6 +190,18 @@ func (c *client) updateStaticState(cfg ServiceSettings) error {
 	return nil
 }
 
+// applyTarget points cfg at the resolver or the static endpoints named by
+// the target.
+func applyTarget(cfg *ServiceSettings, target resolver.TargetResolution) {
+	switch {
+	case target.Resolver != "":
+		cfg.Resolver = target.Resolver
+	case len(target.Endpoints) > 0:
+		cfg.Resolver = ""
+		cfg.Remote.Endpoints = target.Endpoints
+	}
+}
+
 func (c *client) initResolverAndBalancer(cfg ServiceSettings) error {
 	balancerName := cfg.Balancer
 	if balancerName == "" {
@@ -126,7 +213,16 @@ func (c *client) initResolverAndBalancer(cfg ServiceSettings) error {
 		remoteStates: make(map[string]remote.State),
 		activeNames:  make(map[string]struct{}),
 	}
-	b, err := c.runtime.NewBalancer(c.appName, balancerName, bc)
+	build := func(cli balancer.Client) (balancer.Balancer, error) {
+		return c.runtime.NewBalancer(c.appName, balancerName, cli)
+	}
+	c.newBalancer = func() (balancer.Balancer, error) {
+		if len(cfg.Routing.Rules) > 0 {
+			return newRoutingBalancer(cfg.Routing, bc, build)
+		}
+		return build(bc)
+	}
+	b, err := c.newBalancer()
 	if err != nil {
 		return err
 	}
@@ -0,0 +1,70 @@
+// Copyright 2022 The codesjoy Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/codesjoy/yggdrasil/v3/rpc/stream"
+)
+
+func methodTimeouts(methods map[string]MethodSettings) map[string]time.Duration {
+	out := make(map[string]time.Duration, len(methods))
+	for name, item := range methods {
+		if item.Timeout > 0 {
+			out[name] = item.Timeout
+		}
+	}
+	return out
+}
+
+// withMethodTimeout applies the configured per-method timeout to ctx. The
+// deadline is propagated to the server by the transport, so downstream calls
+// made with the server context inherit it automatically.
+func (c *client) withMethodTimeout(
+	ctx context.Context,
+	method string,
+) (context.Context, context.CancelFunc, bool) {
+	if len(c.methodTimeouts) == 0 {
+		return ctx, func() {}, false
+	}
+	timeout, ok := c.methodTimeouts[method]
+	if !ok {
+		name := method[strings.LastIndex(method, "/")+1:]
+		timeout, ok = c.methodTimeouts[name]
+	}
+	if !ok {
+		return ctx, func() {}, false
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	return ctx, cancel, true
+}
+
+// timeoutClientStream releases the per-method timeout once the stream ends.
+type timeoutClientStream struct {
+	stream.ClientStream
+	desc   *stream.Desc
+	cancel context.CancelFunc
+}
+
+func (s *timeoutClientStream) RecvMsg(m interface{}) error {
+	err := s.ClientStream.RecvMsg(m)
+	if err != nil || s.desc == nil || !s.desc.ServerStreams {
+		s.cancel()
+	}
+	return err
+}
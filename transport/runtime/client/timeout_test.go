@@ -0,0 +1,85 @@
+// Copyright 2022 The codesjoy Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/codesjoy/yggdrasil/v3/rpc/interceptor"
+)
+
+func TestMethodTimeouts(t *testing.T) {
+	got := methodTimeouts(map[string]MethodSettings{
+		"Get":          {Timeout: time.Second},
+		"/pkg.Svc/Put": {Timeout: 2 * time.Second},
+		"List":         {},
+	})
+	assert.Equal(t, map[string]time.Duration{
+		"Get":          time.Second,
+		"/pkg.Svc/Put": 2 * time.Second,
+	}, got)
+}
+
+func TestClientWithMethodTimeout(t *testing.T) {
+	cli := &client{methodTimeouts: map[string]time.Duration{
+		"Get":          time.Minute,
+		"/pkg.Svc/Put": time.Hour,
+	}}
+
+	ctx, cancel, ok := cli.withMethodTimeout(context.Background(), "/pkg.Svc/Get")
+	defer cancel()
+	require.True(t, ok)
+	deadline, ok := ctx.Deadline()
+	require.True(t, ok)
+	assert.WithinDuration(t, time.Now().Add(time.Minute), deadline, time.Second)
+
+	ctx, cancel, ok = cli.withMethodTimeout(context.Background(), "/pkg.Svc/Put")
+	defer cancel()
+	require.True(t, ok)
+	deadline, _ = ctx.Deadline()
+	assert.WithinDuration(t, time.Now().Add(time.Hour), deadline, time.Second)
+
+	parent, parentCancel := context.WithTimeout(context.Background(), time.Second)
+	defer parentCancel()
+	want, _ := parent.Deadline()
+	ctx, cancel, _ = cli.withMethodTimeout(parent, "/pkg.Svc/Put")
+	defer cancel()
+	deadline, _ = ctx.Deadline()
+	assert.Equal(t, want, deadline)
+
+	_, _, ok = cli.withMethodTimeout(context.Background(), "/pkg.Svc/List")
+	assert.False(t, ok)
+}
+
+func TestClientInvokeAppliesMethodTimeout(t *testing.T) {
+	cli := &client{methodTimeouts: map[string]time.Duration{"unary": time.Minute}}
+	var hasDeadline bool
+	cli.chains.Store(&interceptorChains{unary: func(
+		ctx context.Context,
+		_ string,
+		_, _ any,
+		_ interceptor.UnaryInvoker,
+	) error {
+		_, hasDeadline = ctx.Deadline()
+		return nil
+	}})
+	require.NoError(t, cli.Invoke(context.Background(), "/svc/unary", "req", nil))
+	assert.True(t, hasDeadline)
+}
@@ -0,0 +1,77 @@
+// Copyright 2022 The codesjoy Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+
+	"github.com/codesjoy/pkg/basic/xerror"
+	"google.golang.org/genproto/googleapis/rpc/code"
+)
+
+// Option adjusts the settings of one client created by New.
+type Option func(*ServiceSettings)
+
+// WithWarmup overrides the configured warmup of the client.
+func WithWarmup(warmup WarmupSettings) Option {
+	return func(s *ServiceSettings) {
+		s.Warmup = warmup
+	}
+}
+
+// warmup waits until the configured number of endpoints is ready. Every
+// endpoint state change produces a new picker, which wakes the wait.
+func (c *client) warmup(ctx context.Context, cfg WarmupSettings) error {
+	if cfg.Endpoints <= 0 {
+		return nil
+	}
+	if cfg.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, cfg.Timeout)
+		defer cancel()
+	}
+	for {
+		snap := c.pickerSnap.Load()
+		ready, want := c.readyEndpoints(cfg.Endpoints)
+		if want > 0 && ready >= want {
+			return nil
+		}
+		select {
+		case <-snap.blockingCh:
+		case <-ctx.Done():
+			msg := fmt.Sprintf("client %s warmup: %d of %d endpoints ready", c.appName, ready, want)
+			if lastErr, _ := c.balancerClient.endpointStatus(); lastErr != "" {
+				msg += ", last error: " + lastErr
+			}
+			err := xerror.Wrap(ctx.Err(), code.Code_UNAVAILABLE, msg)
+			if cfg.Required {
+				return err
+			}
+			slog.Warn("client warmup incomplete", slog.Any("error", err))
+			return nil
+		}
+	}
+}
+
+// readyEndpoints returns the number of ready endpoints and the number warmup
+// waits for, which is zero until endpoints are resolved.
+func (c *client) readyEndpoints(endpoints int) (ready, want int) {
+	_, statuses := c.balancerClient.endpointStatus()
+	want = min(endpoints, len(statuses))
+	ready = c.remoteClientManager.readyCount()
+	return ready, want
+}
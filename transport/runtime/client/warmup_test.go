@@ -0,0 +1,136 @@
+// Copyright 2022 The codesjoy Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/genproto/googleapis/rpc/code"
+
+	"github.com/codesjoy/yggdrasil/v3/discovery/resolver"
+	"github.com/codesjoy/yggdrasil/v3/observability/stats"
+	"github.com/codesjoy/yggdrasil/v3/rpc/status"
+	remote "github.com/codesjoy/yggdrasil/v3/transport"
+	"github.com/codesjoy/yggdrasil/v3/transport/runtime/client/balancer"
+)
+
+// lazyRemoteClient becomes ready some time after Connect, or fails when
+// delay is negative.
+type lazyRemoteClient struct {
+	*mockRemoteClient
+	endpoint resolver.Endpoint
+	delay    time.Duration
+	listener remote.OnStateChange
+}
+
+func (c *lazyRemoteClient) Connect() {
+	c.mockRemoteClient.Connect()
+	c.SetState(remote.Connecting)
+	go func() {
+		if c.delay < 0 {
+			c.SetState(remote.TransientFailure)
+			c.listener(remote.ClientState{
+				Endpoint:        c.endpoint,
+				State:           remote.TransientFailure,
+				ConnectionError: errors.New("connection refused"),
+			})
+			return
+		}
+		time.Sleep(c.delay)
+		c.SetState(remote.Ready)
+		c.listener(remote.ClientState{Endpoint: c.endpoint, State: remote.Ready})
+	}()
+}
+
+func newWarmupRuntime(delay time.Duration, warmup WarmupSettings) *testRuntime {
+	runtime := newTestRuntime()
+	runtime.clientProviders["lazy"] = remote.NewTransportClientProvider(
+		"lazy",
+		func(
+			_ context.Context,
+			_ string,
+			endpoint resolver.Endpoint,
+			_ stats.Handler,
+			listener remote.OnStateChange,
+		) (remote.Client, error) {
+			return &lazyRemoteClient{
+				mockRemoteClient: newMockRemoteClient(endpoint.Name(), remote.Idle),
+				endpoint:         endpoint,
+				delay:            delay,
+				listener:         listener,
+			}, nil
+		},
+	)
+	runtime.newBalancer = func(
+		serviceName, balancerName string,
+		cli balancer.Client,
+	) (balancer.Balancer, error) {
+		return balancer.BuiltinProvider().New(serviceName, balancerName, cli)
+	}
+	runtime.configs["warmup-svc"] = ServiceSettings{
+		Warmup: warmup,
+		Remote: RemoteSettings{
+			Endpoints: []resolver.BaseEndpoint{
+				{Address: "127.0.0.1:1001", Protocol: "lazy"},
+				{Address: "127.0.0.1:1002", Protocol: "lazy"},
+			},
+		},
+	}
+	return runtime
+}
+
+func TestClientWarmupWaitsForReadyEndpoints(t *testing.T) {
+	runtime := newWarmupRuntime(20*time.Millisecond, WarmupSettings{
+		Endpoints: 5,
+		Timeout:   time.Second,
+		Required:  true,
+	})
+	cliRaw, err := New(context.Background(), "warmup-svc", runtime)
+	require.NoError(t, err)
+	defer func() { _ = cliRaw.Close() }()
+
+	cli := cliRaw.(*client)
+	assert.Equal(t, remote.Ready, cli.GetState())
+	assert.Equal(t, 2, cli.remoteClientManager.readyCount())
+}
+
+func TestClientWarmupRequiredFails(t *testing.T) {
+	runtime := newWarmupRuntime(-1, WarmupSettings{
+		Endpoints: 1,
+		Timeout:   50 * time.Millisecond,
+		Required:  true,
+	})
+	_, err := New(context.Background(), "warmup-svc", runtime)
+	require.Error(t, err)
+	assert.Equal(t, code.Code_UNAVAILABLE, status.FromError(err).Code())
+	assert.Contains(t, err.Error(), "0 of 1 endpoints ready")
+	assert.Contains(t, err.Error(), "connection refused")
+}
+
+func TestClientWarmupOptionalReturnsClient(t *testing.T) {
+	runtime := newWarmupRuntime(-1, WarmupSettings{})
+	cliRaw, err := New(context.Background(), "warmup-svc", runtime, WithWarmup(WarmupSettings{
+		Endpoints: 1,
+		Timeout:   20 * time.Millisecond,
+	}))
+	require.NoError(t, err)
+	defer func() { _ = cliRaw.Close() }()
+	assert.NotEqual(t, remote.Ready, cliRaw.GetState())
+}
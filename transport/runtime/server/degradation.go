@@ -0,0 +1,35 @@
+// Copyright 2022 The codesjoy Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import "github.com/codesjoy/yggdrasil/v3/degrade"
+
+// ConfigureDegradation applies new degradation settings to the process-wide
+// degradation manager and feeds it the queue depth of the server.
+func (s *server) ConfigureDegradation(cfg degrade.Config) {
+	m := degrade.Default()
+	m.SetQueueDepth(s.queueDepth)
+	m.Configure(cfg)
+}
+
+// queueDepth counts the streams waiting for a handler and the requests
+// waiting in the fair queue.
+func (s *server) queueDepth() int {
+	depth := s.fairness.Queued()
+	if stats, ok := s.HandlerPoolStats(); ok {
+		depth += stats.Queued
+	}
+	return depth
+}
@@ -27,14 +27,14 @@ import (
 	remote "github.com/codesjoy/yggdrasil/v3/transport"
 )
 
-func (s *server) handleStream(ss remote.ServerStream) {
+func (s *server) dispatchStream(ss remote.ServerStream) {
 	serviceName, methodName, err := splitMethodTarget(ss.Method())
 	if err != nil {
 		ss.Finish(nil, xerror.New(code.Code_UNIMPLEMENTED, err.Error()))
 		return
 	}
 
-	srv, knownService := s.services[serviceName]
+	srv, knownService := s.lookupService(serviceName)
 	if knownService {
 		if md, ok := srv.Methods[methodName]; ok {
 			s.processUnaryRPC(md, srv, ss)
@@ -69,12 +69,35 @@ func (s *server) processUnaryRPC(desc *MethodDesc, srv *ServiceInfo, ss remote.S
 	defer func() {
 		ss.Finish(reply, err)
 	}()
+	sizes := s.messageSizes.forMethod(ss.Method())
+	onWire := sizes.checkOnWire(ss.Context(), ss)
 	if err = ss.Start(false, false); err != nil {
 		return
 	}
+	release, err := s.fairness.Acquire(ss.Context())
+	if err != nil {
+		return
+	}
+	defer release()
 
-	ctx := metadata.WithStreamContext(ss.Context())
-	reply, err = desc.Handler(srv.ServiceImpl, ctx, ss.RecvMsg, s.unaryInterceptor)
+	ctx, cancel := s.withDefaultDeadline(ss.Context(), ss.Method())
+	defer cancel()
+	ctx = metadata.WithStreamContext(ctx)
+	dec := ss.RecvMsg
+	if sizes != nil && !onWire {
+		dec = func(m any) error {
+			if err := ss.RecvMsg(m); err != nil {
+				return err
+			}
+			return sizes.check(ctx, m, true)
+		}
+	}
+	reply, err = desc.Handler(srv.ServiceImpl, ctx, dec, s.unaryInterceptor())
+	if err == nil {
+		if err = sizes.check(ctx, reply, false); err != nil {
+			reply = nil
+		}
+	}
 	if header, ok := metadata.FromHeaderCtx(ctx); ok {
 		_ = ss.SetHeader(header)
 	}
@@ -88,15 +111,31 @@ func (s *server) processStreamRPC(desc *stream.Desc, srv *ServiceInfo, ss remote
 	defer func() {
 		ss.Finish(nil, err)
 	}()
+	sizes := s.messageSizes.forMethod(ss.Method())
+	onWire := sizes.checkOnWire(ss.Context(), ss)
 	if err = ss.Start(desc.ClientStreams, desc.ServerStreams); err != nil {
 		return
 	}
+	release, err := s.fairness.Acquire(ss.Context())
+	if err != nil {
+		return
+	}
+	defer release()
 	si := &interceptor.StreamServerInfo{
 		FullMethod:     ss.Method(),
 		IsClientStream: desc.ClientStreams,
 		IsServerStream: desc.ServerStreams,
 	}
-	err = s.streamInterceptor(srv.ServiceImpl, ss, si, desc.Handler)
+	ctx, cancel := s.withDefaultDeadline(ss.Context(), ss.Method())
+	defer cancel()
+	var serverStream stream.ServerStream = ss
+	if ctx != ss.Context() {
+		serverStream = &deadlineServerStream{ServerStream: ss, ctx: ctx}
+	}
+	if sizes != nil {
+		serverStream = &sizeServerStream{ServerStream: serverStream, guard: sizes, onWire: onWire}
+	}
+	err = s.streamInterceptor()(srv.ServiceImpl, serverStream, si, desc.Handler)
 }
 
 func splitMethodTarget(method string) (serviceName, methodName string, err error) {
@@ -14,6 +14,8 @@
 
 package server
 
+import "maps"
+
 func (si *serverInfo) Address() string {
 	return si.address
 }
@@ -37,7 +39,7 @@ func (s *server) Endpoints() []Endpoint {
 		endpoints[i] = &serverInfo{
 			protocol: e.Protocol,
 			address:  e.Address,
-			metadata: e.Attributes,
+			metadata: s.endpointMetadata(e.Protocol, e.Attributes),
 			svrKind:  EndpointKindRPC,
 		}
 	}
@@ -45,9 +47,26 @@ func (s *server) Endpoints() []Endpoint {
 		endpoints = append(endpoints, &serverInfo{
 			protocol: "http",
 			address:  s.restSvr.Info().GetAddress(),
-			metadata: s.restSvr.Info().GetAttributes(),
+			metadata: s.endpointMetadata("http", s.restSvr.Info().GetAttributes()),
 			svrKind:  EndpointKindRest,
 		})
 	}
+	s.mu.RLock()
+	endpoints = append(endpoints, s.extraEndpoints...)
+	s.mu.RUnlock()
 	return endpoints
 }
+
+// endpointMetadata overlays the configured endpoint metadata on attrs.
+func (s *server) endpointMetadata(protocol string, attrs map[string]string) map[string]string {
+	if len(s.endpointMD[AnyProtocol]) == 0 && len(s.endpointMD[protocol]) == 0 {
+		return attrs
+	}
+	out := maps.Clone(attrs)
+	if out == nil {
+		out = map[string]string{}
+	}
+	maps.Copy(out, s.endpointMD[AnyProtocol])
+	maps.Copy(out, s.endpointMD[protocol])
+	return out
+}
@@ -0,0 +1,65 @@
+// Copyright 2022 The codesjoy Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"context"
+
+	"github.com/codesjoy/yggdrasil/v3/rpc/interceptor"
+	"github.com/codesjoy/yggdrasil/v3/rpc/status"
+	"github.com/codesjoy/yggdrasil/v3/rpc/stream"
+)
+
+// mapUnaryErrors wraps next so errors returned by handlers and interceptors
+// pass through the registered status error mappers before reaching the
+// transport.
+func mapUnaryErrors(next interceptor.UnaryServerInterceptor) interceptor.UnaryServerInterceptor {
+	return func(
+		ctx context.Context,
+		req any,
+		info *interceptor.UnaryServerInfo,
+		handler interceptor.UnaryHandler,
+	) (any, error) {
+		resp, err := next(ctx, req, info, handler)
+		if err != nil {
+			err = status.MapError(ctx, serviceOf(info.FullMethod), err)
+		}
+		return resp, err
+	}
+}
+
+// mapStreamErrors is the streaming counterpart of mapUnaryErrors.
+func mapStreamErrors(next interceptor.StreamServerInterceptor) interceptor.StreamServerInterceptor {
+	return func(
+		srv interface{},
+		ss stream.ServerStream,
+		info *interceptor.StreamServerInfo,
+		handler stream.Handler,
+	) error {
+		err := next(srv, ss, info, handler)
+		if err != nil {
+			err = status.MapError(ss.Context(), serviceOf(info.FullMethod), err)
+		}
+		return err
+	}
+}
+
+func serviceOf(fullMethod string) string {
+	service, _, err := splitMethodTarget(fullMethod)
+	if err != nil {
+		return ""
+	}
+	return service
+}
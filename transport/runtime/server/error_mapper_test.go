@@ -0,0 +1,54 @@
+// Copyright 2022 The codesjoy Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/genproto/googleapis/rpc/code"
+
+	"github.com/codesjoy/yggdrasil/v3/rpc/interceptor"
+	"github.com/codesjoy/yggdrasil/v3/rpc/status"
+	"github.com/codesjoy/yggdrasil/v3/rpc/stream"
+)
+
+func TestInitInterceptorMapsHandlerErrors(t *testing.T) {
+	s := newTestServer()
+	s.initInterceptor()
+
+	_, err := s.unaryInterceptor()(
+		context.Background(),
+		nil,
+		&interceptor.UnaryServerInfo{FullMethod: "/svc.v1.Svc/Get"},
+		func(context.Context, any) (any, error) { return nil, sql.ErrNoRows },
+	)
+	assert.Equal(t, code.Code_NOT_FOUND, status.FromError(err).Code())
+
+	err = s.streamInterceptor()(
+		nil,
+		&testServerStream{method: "/svc.v1.Svc/Watch"},
+		&interceptor.StreamServerInfo{FullMethod: "/svc.v1.Svc/Watch"},
+		func(any, stream.ServerStream) error { return sql.ErrNoRows },
+	)
+	assert.Equal(t, code.Code_NOT_FOUND, status.FromError(err).Code())
+}
+
+func TestServiceOf(t *testing.T) {
+	assert.Equal(t, "svc.v1.Svc", serviceOf("/svc.v1.Svc/Get"))
+	assert.Equal(t, "", serviceOf("malformed"))
+}
@@ -0,0 +1,399 @@
+// Copyright 2022 The codesjoy Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package fairness admits server requests fairly between callers.
+//
+// Requests are classified by caller identity, taken from incoming metadata
+// or the SAN of the caller's mTLS certificate, and by priority class. Each
+// caller is held to its own concurrency and rate quota. When the server runs
+// MaxConcurrency requests at once, further requests wait in a weighted fair
+// queue: callers are served in proportion to their weight times the weight
+// of the request priority, so one noisy caller cannot starve the others.
+// While the process is degraded, requests of the priority classes shed at the
+// current degradation level are rejected before they are queued.
+package fairness
+
+import (
+	"container/heap"
+	"context"
+	"fmt"
+	"log/slog"
+	"math"
+	"strings"
+	"sync"
+	"time"
+
+	"google.golang.org/genproto/googleapis/rpc/code"
+
+	"github.com/codesjoy/yggdrasil/v3/degrade"
+	"github.com/codesjoy/yggdrasil/v3/rpc/interceptor/ratelimit"
+	"github.com/codesjoy/yggdrasil/v3/rpc/metadata"
+	"github.com/codesjoy/yggdrasil/v3/rpc/status"
+	"github.com/codesjoy/yggdrasil/v3/transport/support/peer"
+	ytls "github.com/codesjoy/yggdrasil/v3/transport/support/security/tls"
+)
+
+// AnyCaller keys the quota applied to callers without one of their own.
+const AnyCaller = "*"
+
+// unknownCaller identifies requests without a caller identity.
+const unknownCaller = "unknown"
+
+// Config defines the fairness settings under yggdrasil.server.fairness.
+type Config struct {
+	// CallerMetadata is the incoming metadata key identifying the caller,
+	// e.g. "x-caller-id".
+	CallerMetadata string `mapstructure:"caller_metadata"`
+	// CallerFromPeer identifies callers without caller metadata by the first
+	// URI or DNS SAN of their mTLS client certificate.
+	CallerFromPeer bool `mapstructure:"caller_from_peer"`
+	// PriorityMetadata is the incoming metadata key carrying the priority
+	// class of a request.
+	PriorityMetadata string `mapstructure:"priority_metadata"`
+	// Priorities maps priority classes to queueing weights. Requests without
+	// a known class have weight 1.
+	Priorities map[string]float64 `mapstructure:"priorities"`
+	// ShedPriorities maps priority classes to the degradation level from
+	// which their requests are rejected with UNAVAILABLE, so low priority
+	// callers are shed first.
+	ShedPriorities map[string]int `mapstructure:"shed_priorities"`
+	// Callers maps caller identities to quotas; AnyCaller applies to the
+	// callers without an entry.
+	Callers map[string]Quota `mapstructure:"callers"`
+	// MaxConcurrency bounds the requests served at once. Excess requests
+	// queue fairly. Zero disables queueing.
+	MaxConcurrency int `mapstructure:"max_concurrency"`
+	// MaxQueue bounds the queued requests; overflow fails with UNAVAILABLE.
+	MaxQueue int `mapstructure:"max_queue" default:"1024"`
+	// QueueTimeout bounds the time a request waits in the queue; zero waits
+	// until the request context is done.
+	QueueTimeout time.Duration `mapstructure:"queue_timeout" default:"1s"`
+}
+
+// Quota restricts one caller.
+type Quota struct {
+	// MaxConcurrency bounds the outstanding requests of the caller,
+	// queued ones included. Zero means unlimited.
+	MaxConcurrency int `mapstructure:"max_concurrency"`
+	// Limit bounds the request rate of the caller. A zero rate means
+	// unlimited.
+	ratelimit.Limit `mapstructure:",squash"`
+	// Weight is the share of the caller in the fair queue. Zero means 1.
+	Weight float64 `mapstructure:"weight"`
+}
+
+func (q Quota) weight() float64 {
+	if q.Weight > 0 {
+		return q.Weight
+	}
+	return 1
+}
+
+// Enabled reports whether cfg restricts anything.
+func (c Config) Enabled() bool {
+	return c.MaxConcurrency > 0 || len(c.Callers) > 0 || len(c.ShedPriorities) > 0
+}
+
+func (c Config) quota(caller string) Quota {
+	if q, ok := c.Callers[caller]; ok {
+		return q
+	}
+	return c.Callers[AnyCaller]
+}
+
+// Controller admits requests according to a Config.
+type Controller struct {
+	cfg         Config
+	limiter     ratelimit.Limiter
+	degradation *degrade.Manager
+
+	mu       sync.Mutex
+	inflight int
+	callers  map[string]int
+	queue    waitQueue
+	vtime    float64
+	flows    map[string]float64
+	seq      uint64
+}
+
+// New returns a controller enforcing cfg, or nil when cfg is not Enabled.
+// A nil controller admits every request.
+func New(cfg Config) *Controller {
+	if !cfg.Enabled() {
+		return nil
+	}
+	if cfg.CallerMetadata != "" {
+		cfg.CallerMetadata = strings.ToLower(cfg.CallerMetadata)
+	}
+	if cfg.PriorityMetadata != "" {
+		cfg.PriorityMetadata = strings.ToLower(cfg.PriorityMetadata)
+	}
+	return &Controller{
+		cfg:         cfg,
+		limiter:     ratelimit.NewLocalLimiter(),
+		degradation: degrade.Default(),
+		callers:     map[string]int{},
+		flows:       map[string]float64{},
+	}
+}
+
+// Acquire admits a request carried by ctx, waiting in the fair queue when
+// the server is saturated. On success the returned release must be called
+// once the request finishes.
+func (c *Controller) Acquire(ctx context.Context) (release func(), err error) {
+	if c == nil {
+		return func() {}, nil
+	}
+	priority := c.priority(ctx)
+	if level, ok := c.cfg.ShedPriorities[priority]; ok && level > 0 &&
+		c.degradation.Level() >= level {
+		return nil, status.New(
+			code.Code_UNAVAILABLE,
+			fmt.Sprintf("server degraded: shedding priority %q", priority),
+		).Err()
+	}
+	caller := c.caller(ctx)
+	quota := c.cfg.quota(caller)
+
+	c.mu.Lock()
+	if quota.MaxConcurrency > 0 && c.callers[caller] >= quota.MaxConcurrency {
+		c.mu.Unlock()
+		return nil, status.New(
+			code.Code_RESOURCE_EXHAUSTED,
+			fmt.Sprintf("caller %q exceeded its concurrency quota", caller),
+		).Err()
+	}
+	admit := c.cfg.MaxConcurrency <= 0 ||
+		(c.inflight < c.cfg.MaxConcurrency && c.queue.Len() == 0)
+	if !admit && c.queue.Len() >= c.cfg.MaxQueue {
+		c.mu.Unlock()
+		return nil, status.New(code.Code_UNAVAILABLE, "server overloaded: queue full").Err()
+	}
+	// Only requests that are admitted or queued spend a rate token, so
+	// rejections for concurrency do not drain the caller's rate budget.
+	if err := c.allowRate(ctx, caller, quota); err != nil {
+		c.mu.Unlock()
+		return nil, err
+	}
+	c.callers[caller]++
+	release = c.releaser(caller)
+	if admit {
+		c.inflight++
+		c.mu.Unlock()
+		return release, nil
+	}
+	w := c.enqueue(caller, quota.weight()*c.priorityWeight(priority))
+	c.mu.Unlock()
+
+	var timeout <-chan time.Time
+	if c.cfg.QueueTimeout > 0 {
+		timer := time.NewTimer(c.cfg.QueueTimeout)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+	select {
+	case <-w.ready:
+		return release, nil
+	case <-ctx.Done():
+		err = status.FromContextError(ctx.Err()).Err()
+	case <-timeout:
+		err = status.New(code.Code_UNAVAILABLE, "server overloaded: queue timeout").Err()
+	}
+	c.mu.Lock()
+	if w.index >= 0 {
+		heap.Remove(&c.queue, w.index)
+		c.forget(caller)
+		c.mu.Unlock()
+		return nil, err
+	}
+	c.mu.Unlock()
+	// Admitted while giving up; hand the slot back.
+	release()
+	return nil, err
+}
+
+// allowRate charges one request against the rate quota of caller. A limiter
+// error admits the request. Callers hold c.mu.
+func (c *Controller) allowRate(ctx context.Context, caller string, quota Quota) error {
+	if quota.Limit.Rate <= 0 {
+		return nil
+	}
+	ok, retry, err := c.limiter.Allow(ctx, caller, quota.Limit)
+	if err != nil {
+		slog.Warn(
+			"fault to check caller rate, admitting the request",
+			slog.String("caller", caller),
+			slog.Any("error", err),
+		)
+		return nil
+	}
+	if !ok {
+		return status.New(
+			code.Code_RESOURCE_EXHAUSTED,
+			fmt.Sprintf("caller %q exceeded its request rate", caller),
+		).WithRetryInfo(retry).Err()
+	}
+	return nil
+}
+
+func (c *Controller) releaser(caller string) func() {
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			c.mu.Lock()
+			defer c.mu.Unlock()
+			c.forget(caller)
+			c.inflight--
+			c.dispatch()
+		})
+	}
+}
+
+// forget drops one outstanding request of caller. Callers hold c.mu.
+func (c *Controller) forget(caller string) {
+	if c.callers[caller]--; c.callers[caller] <= 0 {
+		delete(c.callers, caller)
+	}
+}
+
+// enqueue adds a waiter tagged with its virtual finish time. Callers hold
+// c.mu.
+func (c *Controller) enqueue(caller string, weight float64) *waiter {
+	tag := math.Max(c.vtime, c.flows[caller]) + 1/weight
+	c.flows[caller] = tag
+	c.seq++
+	w := &waiter{tag: tag, seq: c.seq, ready: make(chan struct{})}
+	heap.Push(&c.queue, w)
+	return w
+}
+
+// dispatch admits queued waiters into free slots, smallest tag first.
+// Callers hold c.mu.
+func (c *Controller) dispatch() {
+	for c.queue.Len() > 0 && c.inflight < c.cfg.MaxConcurrency {
+		w := heap.Pop(&c.queue).(*waiter)
+		c.vtime = w.tag
+		c.inflight++
+		close(w.ready)
+	}
+	if c.queue.Len() == 0 {
+		// Idle flows restart from the current virtual time.
+		clear(c.flows)
+	}
+}
+
+func (c *Controller) caller(ctx context.Context) string {
+	if key := c.cfg.CallerMetadata; key != "" {
+		if md, ok := metadata.FromInContext(ctx); ok {
+			if values := md[key]; len(values) > 0 && values[0] != "" {
+				return values[0]
+			}
+		}
+	}
+	if c.cfg.CallerFromPeer {
+		if id := peerIdentity(ctx); id != "" {
+			return id
+		}
+	}
+	return unknownCaller
+}
+
+func (c *Controller) priority(ctx context.Context) string {
+	if key := c.cfg.PriorityMetadata; key != "" {
+		if md, ok := metadata.FromInContext(ctx); ok {
+			if values := md[key]; len(values) > 0 {
+				return values[0]
+			}
+		}
+	}
+	return ""
+}
+
+func (c *Controller) priorityWeight(priority string) float64 {
+	if weight, ok := c.cfg.Priorities[priority]; ok && weight > 0 {
+		return weight
+	}
+	return 1
+}
+
+// Queued returns the number of requests waiting in the fair queue.
+func (c *Controller) Queued() int {
+	if c == nil {
+		return 0
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.queue.Len()
+}
+
+// peerIdentity returns the first URI or DNS SAN of the verified mTLS client
+// certificate of the peer.
+func peerIdentity(ctx context.Context) string {
+	p, ok := peer.FromContext(ctx)
+	if !ok || p == nil {
+		return ""
+	}
+	info, ok := p.AuthInfo.(ytls.AuthInfo)
+	if !ok || len(info.State.PeerCertificates) == 0 {
+		return ""
+	}
+	cert := info.State.PeerCertificates[0]
+	if len(cert.URIs) > 0 {
+		return cert.URIs[0].String()
+	}
+	if len(cert.DNSNames) > 0 {
+		return cert.DNSNames[0]
+	}
+	return ""
+}
+
+type waiter struct {
+	tag   float64
+	seq   uint64
+	index int
+	ready chan struct{}
+}
+
+// waitQueue is a min-heap of waiters by virtual finish time.
+type waitQueue []*waiter
+
+func (q waitQueue) Len() int { return len(q) }
+
+func (q waitQueue) Less(i, j int) bool {
+	if q[i].tag != q[j].tag {
+		return q[i].tag < q[j].tag
+	}
+	return q[i].seq < q[j].seq
+}
+
+func (q waitQueue) Swap(i, j int) {
+	q[i], q[j] = q[j], q[i]
+	q[i].index = i
+	q[j].index = j
+}
+
+func (q *waitQueue) Push(x any) {
+	w := x.(*waiter)
+	w.index = len(*q)
+	*q = append(*q, w)
+}
+
+func (q *waitQueue) Pop() any {
+	old := *q
+	w := old[len(old)-1]
+	old[len(old)-1] = nil
+	w.index = -1
+	*q = old[:len(old)-1]
+	return w
+}
@@ -0,0 +1,300 @@
+// Copyright 2022 The codesjoy Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fairness
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/genproto/googleapis/rpc/code"
+
+	"github.com/codesjoy/yggdrasil/v3/degrade"
+	"github.com/codesjoy/yggdrasil/v3/rpc/interceptor/ratelimit"
+	"github.com/codesjoy/yggdrasil/v3/rpc/metadata"
+	"github.com/codesjoy/yggdrasil/v3/rpc/status"
+	"github.com/codesjoy/yggdrasil/v3/transport/support/peer"
+	ytls "github.com/codesjoy/yggdrasil/v3/transport/support/security/tls"
+)
+
+func callerCtx(caller string, kv ...string) context.Context {
+	return metadata.WithInContext(
+		context.Background(),
+		metadata.Pairs(append([]string{"x-caller", caller}, kv...)...),
+	)
+}
+
+func requireCode(t *testing.T, err error, want code.Code) {
+	t.Helper()
+	require.Error(t, err)
+	assert.Equal(t, want, status.FromError(err).Code(), err.Error())
+}
+
+func waitQueued(t *testing.T, c *Controller, n int) {
+	t.Helper()
+	require.Eventually(t, func() bool {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		return c.queue.Len() == n
+	}, time.Second, time.Millisecond)
+}
+
+func TestNewDisabled(t *testing.T) {
+	c := New(Config{CallerMetadata: "x-caller"})
+	assert.Nil(t, c)
+	release, err := c.Acquire(context.Background())
+	require.NoError(t, err)
+	release()
+}
+
+func TestCallerConcurrencyQuota(t *testing.T) {
+	c := New(Config{
+		CallerMetadata: "X-Caller",
+		Callers: map[string]Quota{
+			"noisy":   {MaxConcurrency: 1},
+			AnyCaller: {MaxConcurrency: 2},
+		},
+	})
+	r1, err := c.Acquire(callerCtx("noisy"))
+	require.NoError(t, err)
+	_, err = c.Acquire(callerCtx("noisy"))
+	requireCode(t, err, code.Code_RESOURCE_EXHAUSTED)
+
+	r2, err := c.Acquire(callerCtx("quiet"))
+	require.NoError(t, err)
+	r3, err := c.Acquire(callerCtx("quiet"))
+	require.NoError(t, err)
+
+	r1()
+	r1()
+	r4, err := c.Acquire(callerCtx("noisy"))
+	require.NoError(t, err)
+	for _, release := range []func(){r2, r3, r4} {
+		release()
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	assert.Empty(t, c.callers)
+}
+
+func TestCallerRateQuota(t *testing.T) {
+	c := New(Config{
+		CallerMetadata: "x-caller",
+		Callers: map[string]Quota{
+			"noisy": {Limit: ratelimit.Limit{Rate: 1, Burst: 1}},
+		},
+	})
+	release, err := c.Acquire(callerCtx("noisy"))
+	require.NoError(t, err)
+	release()
+	_, err = c.Acquire(callerCtx("noisy"))
+	requireCode(t, err, code.Code_RESOURCE_EXHAUSTED)
+	delay, ok := status.FromError(err).RetryDelay()
+	assert.True(t, ok)
+	assert.Positive(t, delay)
+
+	release, err = c.Acquire(callerCtx("other"))
+	require.NoError(t, err)
+	release()
+}
+
+func TestConcurrencyRejectionKeepsRateBudget(t *testing.T) {
+	c := New(Config{
+		CallerMetadata: "x-caller",
+		Callers: map[string]Quota{
+			"noisy": {MaxConcurrency: 1, Limit: ratelimit.Limit{Rate: 0.001, Burst: 2}},
+		},
+	})
+	release, err := c.Acquire(callerCtx("noisy"))
+	require.NoError(t, err)
+	for range 5 {
+		_, err = c.Acquire(callerCtx("noisy"))
+		requireCode(t, err, code.Code_RESOURCE_EXHAUSTED)
+		assert.Contains(t, err.Error(), "concurrency quota")
+	}
+	release()
+
+	release, err = c.Acquire(callerCtx("noisy"))
+	require.NoError(t, err)
+	release()
+}
+
+type failingLimiter struct{}
+
+func (failingLimiter) Allow(context.Context, string, ratelimit.Limit) (bool, time.Duration, error) {
+	return false, 0, errors.New("limiter unavailable")
+}
+
+func TestLimiterErrorAdmits(t *testing.T) {
+	c := New(Config{
+		CallerMetadata: "x-caller",
+		Callers: map[string]Quota{
+			AnyCaller: {Limit: ratelimit.Limit{Rate: 1, Burst: 1}},
+		},
+	})
+	c.limiter = failingLimiter{}
+	release, err := c.Acquire(callerCtx("noisy"))
+	require.NoError(t, err)
+	release()
+}
+
+func TestQueueFullAndTimeout(t *testing.T) {
+	c := New(Config{
+		CallerMetadata: "x-caller",
+		MaxConcurrency: 1,
+		MaxQueue:       1,
+		QueueTimeout:   20 * time.Millisecond,
+	})
+	release, err := c.Acquire(callerCtx("a"))
+	require.NoError(t, err)
+	defer release()
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := c.Acquire(callerCtx("b"))
+		done <- err
+	}()
+	waitQueued(t, c, 1)
+	_, err = c.Acquire(callerCtx("c"))
+	requireCode(t, err, code.Code_UNAVAILABLE)
+	requireCode(t, <-done, code.Code_UNAVAILABLE)
+	waitQueued(t, c, 0)
+
+	ctx, cancel := context.WithCancel(callerCtx("d"))
+	cancel()
+	_, err = c.Acquire(ctx)
+	requireCode(t, err, code.Code_CANCELLED)
+}
+
+func TestWeightedFairQueue(t *testing.T) {
+	c := New(Config{
+		CallerMetadata:   "x-caller",
+		PriorityMetadata: "x-priority",
+		Priorities:       map[string]float64{"high": 4},
+		Callers: map[string]Quota{
+			"heavy":   {Weight: 2},
+			AnyCaller: {},
+		},
+		MaxConcurrency: 1,
+		MaxQueue:       16,
+		QueueTimeout:   time.Second,
+	})
+	hold, err := c.Acquire(callerCtx("busy"))
+	require.NoError(t, err)
+
+	var (
+		mu    sync.Mutex
+		order []string
+		wg    sync.WaitGroup
+	)
+	enqueue := func(name string, ctx context.Context) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			release, err := c.Acquire(ctx)
+			if !assert.NoError(t, err) {
+				return
+			}
+			mu.Lock()
+			order = append(order, name)
+			mu.Unlock()
+			release()
+		}()
+	}
+	// Tags: noisy 1, 2, 3; heavy 0.5, 1; urgent 0.25.
+	requests := []struct {
+		name string
+		ctx  context.Context
+	}{
+		{"noisy1", callerCtx("noisy")},
+		{"noisy2", callerCtx("noisy")},
+		{"noisy3", callerCtx("noisy")},
+		{"heavy1", callerCtx("heavy")},
+		{"heavy2", callerCtx("heavy")},
+		{"urgent", callerCtx("other", "x-priority", "high")},
+	}
+	for i, req := range requests {
+		enqueue(req.name, req.ctx)
+		waitQueued(t, c, i+1)
+	}
+	hold()
+	wg.Wait()
+	assert.Equal(t, []string{"urgent", "heavy1", "noisy1", "heavy2", "noisy2", "noisy3"}, order)
+}
+
+func TestCallerFromPeer(t *testing.T) {
+	c := New(Config{
+		CallerMetadata: "x-caller",
+		CallerFromPeer: true,
+		Callers:        map[string]Quota{"spiffe://cluster/ns/a": {MaxConcurrency: 1}},
+	})
+	cert := &x509.Certificate{
+		URIs:     []*url.URL{{Scheme: "spiffe", Host: "cluster", Path: "/ns/a"}},
+		DNSNames: []string{"a.internal"},
+	}
+	ctx := peer.WithContext(context.Background(), &peer.Peer{
+		AuthInfo: ytls.AuthInfo{
+			State: tls.ConnectionState{PeerCertificates: []*x509.Certificate{cert}},
+		},
+	})
+	assert.Equal(t, "spiffe://cluster/ns/a", c.caller(ctx))
+	explicit := metadata.WithInContext(ctx, metadata.Pairs("x-caller", "explicit"))
+	assert.Equal(t, "explicit", c.caller(explicit))
+	assert.Equal(t, unknownCaller, c.caller(context.Background()))
+
+	release, err := c.Acquire(ctx)
+	require.NoError(t, err)
+	defer release()
+	_, err = c.Acquire(ctx)
+	requireCode(t, err, code.Code_RESOURCE_EXHAUSTED)
+
+	cert.URIs = nil
+	assert.Equal(t, "a.internal", c.caller(ctx))
+}
+
+func TestShedPriorities(t *testing.T) {
+	c := New(Config{
+		PriorityMetadata: "x-priority",
+		ShedPriorities:   map[string]int{"batch": 1, "background": 2},
+	})
+	require.NotNil(t, c)
+	c.degradation = degrade.NewManager(degrade.Config{})
+	acquire := func(priority string) error {
+		release, err := c.Acquire(callerCtx("caller", "x-priority", priority))
+		if err == nil {
+			release()
+		}
+		return err
+	}
+	require.NoError(t, acquire("batch"))
+
+	c.degradation.Override(1)
+	requireCode(t, acquire("batch"), code.Code_UNAVAILABLE)
+	require.NoError(t, acquire("background"))
+	require.NoError(t, acquire("interactive"))
+
+	c.degradation.Override(2)
+	requireCode(t, acquire("background"), code.Code_UNAVAILABLE)
+	c.degradation.ClearOverride()
+	require.NoError(t, acquire("batch"))
+	assert.Zero(t, c.Queued())
+}
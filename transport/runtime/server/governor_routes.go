@@ -22,7 +22,8 @@ import (
 	internalidentity "github.com/codesjoy/yggdrasil/v3/internal/identity"
 )
 
-// RegisterGovernorRoutes registers service and rest metadata routes into governor.
+// RegisterGovernorRoutes registers service, rest, route table and message
+// size routes into governor.
 func RegisterGovernorRoutes(gov *governor.Server, app Server, identity internalidentity.Identity) {
 	if gov == nil || app == nil {
 		return
@@ -55,4 +56,34 @@ func RegisterGovernorRoutes(gov *governor.Server, app Server, identity internali
 		}
 		_ = encoder.Encode(result)
 	})
+	gov.HandleFunc("/api_routes", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(200)
+		encoder := json.NewEncoder(w)
+		if r.URL.Query().Get("pretty") == "true" {
+			encoder.SetIndent("", "    ")
+		}
+		routes := s.Routes()
+		result := map[string]interface{}{
+			"appName": identity.AppName,
+			"methods": routes.Methods,
+			"rest":    routes.Rest,
+		}
+		if len(routes.RestConflicts) > 0 {
+			result["restConflicts"] = routes.RestConflicts
+		}
+		_ = encoder.Encode(result)
+	})
+	gov.HandleFunc("/message_sizes", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(200)
+		encoder := json.NewEncoder(w)
+		if r.URL.Query().Get("pretty") == "true" {
+			encoder.SetIndent("", "    ")
+		}
+		result := map[string]interface{}{
+			"appName": identity.AppName,
+			"bounds":  messageSizeBounds,
+			"methods": s.messageSizes.snapshot(),
+		}
+		_ = encoder.Encode(result)
+	})
 }
@@ -18,6 +18,7 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -25,6 +26,7 @@ import (
 	"github.com/codesjoy/yggdrasil/v3/admin/governor"
 	"github.com/codesjoy/yggdrasil/v3/config"
 	internalidentity "github.com/codesjoy/yggdrasil/v3/internal/identity"
+	"github.com/codesjoy/yggdrasil/v3/rpc/interceptor"
 )
 
 func TestRegisterGovernorRoutesInstanceIsolation(t *testing.T) {
@@ -88,3 +90,69 @@ func governorRouteBody(t *testing.T, gov *governor.Server, path string) string {
 	require.Equal(t, http.StatusOK, rec.Code)
 	return rec.Body.String()
 }
+
+func TestRegisterGovernorRoutesRouteTable(t *testing.T) {
+	gov, err := governor.NewServerWithConfig(governor.Config{}, config.NewManager())
+	require.NoError(t, err)
+
+	srv := &server{
+		servicesDesc: map[string][]methodInfo{
+			"svc.beta":  {{MethodName: "Watch", ServerStreams: true}},
+			"svc.alpha": {{MethodName: "Get"}},
+		},
+		restRouterDesc: []restRouterInfo{
+			{
+				Method:   "GET",
+				Path:     "/v1/{params1}",
+				Template: "/v1/{name=items/*}",
+				RPC:      "/svc.alpha/Get",
+			},
+			{Method: "GET", Path: "/healthz"},
+		},
+		defaultTimeouts: map[string]time.Duration{"/svc.alpha/*": time.Second},
+		messageSizes: newMessageSizeGuard(
+			map[string]MessageSizeSettings{"*": {MaxRecv: 1024}},
+			nil,
+		),
+	}
+	srv.chains.Store(&interceptorChains{
+		unaryChain: interceptor.NewChainResolver(
+			[]string{"logging", "ratelimit"},
+			[]interceptor.ChainRule{
+				{Methods: []string{"/svc.alpha/*"}, Remove: []string{"ratelimit"}},
+			},
+		),
+		streamChain: interceptor.NewChainResolver([]string{"logging"}, nil),
+	})
+
+	routes := srv.Routes()
+	assert.Equal(t, []MethodRoute{
+		{
+			FullMethod:   "/svc.alpha/Get",
+			Interceptors: []string{"logging"},
+			Timeout:      "1s",
+			MaxRecvSize:  1024,
+		},
+		{
+			FullMethod:    "/svc.beta/Watch",
+			ServerStreams: true,
+			Interceptors:  []string{"logging"},
+			MaxRecvSize:   1024,
+		},
+	}, routes.Methods)
+	assert.Equal(t, []RestRoute{
+		{
+			Method:       "GET",
+			Path:         "/v1/{params1}",
+			Template:     "/v1/{name=items/*}",
+			RPC:          "/svc.alpha/Get",
+			Interceptors: []string{"logging"},
+		},
+		{Method: "GET", Path: "/healthz"},
+	}, routes.Rest)
+
+	RegisterGovernorRoutes(gov, srv, internalidentity.Identity{AppName: "app"})
+	body := governorRouteBody(t, gov, "/api_routes")
+	assert.Contains(t, body, `"fullMethod":"/svc.beta/Watch"`)
+	assert.Contains(t, body, `"template":"/v1/{name=items/*}"`)
+}
@@ -0,0 +1,130 @@
+// Copyright 2022 The codesjoy Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"errors"
+
+	"google.golang.org/genproto/googleapis/rpc/code"
+
+	"github.com/codesjoy/yggdrasil/v3/internal/xpool"
+	"github.com/codesjoy/yggdrasil/v3/rpc/status"
+	remote "github.com/codesjoy/yggdrasil/v3/transport"
+)
+
+// handlerPoolName names the stream handler pool in logs and metrics.
+const handlerPoolName = "server.handlers"
+
+// HandlerPoolSettings bounds the stream handlers running at once. Handlers
+// still run on the goroutine the transport started for their stream; the
+// pool only limits how many run concurrently and how many wait.
+type HandlerPoolSettings struct {
+	// Workers bounds the stream handlers running at once. Zero or less leaves
+	// them unbounded.
+	Workers int `mapstructure:"workers"`
+	// QueueSize bounds the streams waiting for a worker.
+	QueueSize int `mapstructure:"queue_size" default:"1024"`
+}
+
+func (c HandlerPoolSettings) poolConfig() xpool.Config {
+	return xpool.Config{Workers: c.Workers, QueueSize: c.QueueSize}
+}
+
+// HandlerPoolStats is a point-in-time view of the handler pool.
+type HandlerPoolStats struct {
+	Workers   int    `json:"workers"`
+	Running   int    `json:"running"`
+	Queued    int    `json:"queued"`
+	QueueSize int    `json:"queue_size"`
+	Completed uint64 `json:"completed"`
+	Rejected  uint64 `json:"rejected"`
+	Panics    uint64 `json:"panics"`
+}
+
+// handleStream dispatches one stream, once the handler pool has a free slot
+// when one is configured.
+func (s *server) handleStream(ss remote.ServerStream) {
+	if recorder := s.loadRecorder.Load(); recorder != nil {
+		ss = &loadReportStream{ServerStream: ss, recorder: recorder}
+	}
+	pool := s.handlers.Load()
+	if pool == nil {
+		s.dispatchStream(ss)
+		return
+	}
+	if err := pool.Run(ss.Context(), func() { s.dispatchStream(ss) }); err != nil {
+		ss.Finish(nil, handlerPoolError(err))
+	}
+}
+
+func handlerPoolError(err error) error {
+	switch {
+	case errors.Is(err, xpool.ErrFull):
+		return status.New(
+			code.Code_RESOURCE_EXHAUSTED,
+			"server overloaded: handler pool full",
+		).Err()
+	case errors.Is(err, xpool.ErrClosed):
+		return status.New(code.Code_UNAVAILABLE, "server is stopping").Err()
+	case errors.Is(err, xpool.ErrPanicked):
+		// The pool logged and reported the panic; the stream was never
+		// finished by the handler.
+		return status.New(code.Code_INTERNAL, "internal error").Err()
+	default:
+		return status.FromContextError(err).Err()
+	}
+}
+
+// ResizeHandlerPool applies new handler pool settings to a running server.
+// Disabling the pool lets the streams already queued complete.
+func (s *server) ResizeHandlerPool(settings HandlerPoolSettings) {
+	cfg := settings.poolConfig()
+	s.handlersMu.Lock()
+	defer s.handlersMu.Unlock()
+	current := s.handlers.Load()
+	switch {
+	case !cfg.Enabled():
+		if current != nil {
+			s.handlers.Store(nil)
+			current.Close()
+		}
+	case current == nil:
+		s.handlers.Store(xpool.New(handlerPoolName, cfg))
+	default:
+		current.Resize(cfg)
+	}
+}
+
+// HandlerPoolStats returns the handler pool statistics, if the pool is enabled.
+func (s *server) HandlerPoolStats() (HandlerPoolStats, bool) {
+	pool := s.handlers.Load()
+	if pool == nil {
+		return HandlerPoolStats{}, false
+	}
+	stats := pool.Stats()
+	return HandlerPoolStats{
+		Workers:   stats.Workers,
+		Running:   stats.Running,
+		Queued:    stats.Queued,
+		QueueSize: stats.QueueSize,
+		Completed: stats.Completed,
+		Rejected:  stats.Rejected,
+		Panics:    stats.Panics,
+	}, true
+}
+
+func (s *server) closeHandlerPool() {
+	s.ResizeHandlerPool(HandlerPoolSettings{})
+}
@@ -0,0 +1,121 @@
+// Copyright 2022 The codesjoy Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"google.golang.org/genproto/googleapis/rpc/code"
+
+	"github.com/codesjoy/yggdrasil/v3/rpc/interceptor"
+	"github.com/codesjoy/yggdrasil/v3/rpc/status"
+)
+
+func TestServerHandlerPoolRejectsOverload(t *testing.T) {
+	entered := make(chan struct{})
+	release := make(chan struct{})
+	s := newTestServer()
+	s.services["svc"] = &ServiceInfo{
+		ServiceImpl: &TestServiceImpl{},
+		Methods: map[string]*MethodDesc{
+			"Block": {
+				MethodName: "Block",
+				Handler: func(
+					any,
+					context.Context,
+					func(any) error,
+					interceptor.UnaryServerInterceptor,
+				) (any, error) {
+					entered <- struct{}{}
+					<-release
+					return "ok", nil
+				},
+			},
+		},
+	}
+	s.ResizeHandlerPool(HandlerPoolSettings{Workers: 1})
+	defer s.closeHandlerPool()
+
+	first := &testServerStream{method: "/svc/Block"}
+	done := make(chan struct{})
+	go func() {
+		s.handleStream(first)
+		close(done)
+	}()
+	<-entered
+
+	rejected := &testServerStream{method: "/svc/Block"}
+	s.handleStream(rejected)
+	require.Equal(t, code.Code_RESOURCE_EXHAUSTED, status.FromError(rejected.finishErr).Code())
+
+	stats, ok := s.HandlerPoolStats()
+	require.True(t, ok)
+	require.Equal(t, 1, stats.Running)
+	require.EqualValues(t, 1, stats.Rejected)
+
+	close(release)
+	<-done
+	require.NoError(t, first.finishErr)
+	require.Equal(t, "ok", first.finishReply)
+}
+
+func TestServerResizeHandlerPool(t *testing.T) {
+	s := newTestServer()
+	_, ok := s.HandlerPoolStats()
+	require.False(t, ok)
+
+	s.ResizeHandlerPool(HandlerPoolSettings{Workers: 2, QueueSize: 8})
+	stats, ok := s.HandlerPoolStats()
+	require.True(t, ok)
+	require.Equal(t, 2, stats.Workers)
+
+	s.ResizeHandlerPool(HandlerPoolSettings{Workers: 4, QueueSize: 8})
+	stats, _ = s.HandlerPoolStats()
+	require.Equal(t, 4, stats.Workers)
+
+	s.ResizeHandlerPool(HandlerPoolSettings{})
+	_, ok = s.HandlerPoolStats()
+	require.False(t, ok)
+}
+
+func TestServerHandlerPoolFinishesPanickedStream(t *testing.T) {
+	s := newTestServer()
+	s.services["svc"] = &ServiceInfo{
+		ServiceImpl: &TestServiceImpl{},
+		Methods: map[string]*MethodDesc{
+			"Panic": {
+				MethodName: "Panic",
+				Handler: func(
+					any,
+					context.Context,
+					func(any) error,
+					interceptor.UnaryServerInterceptor,
+				) (any, error) {
+					panic("boom")
+				},
+			},
+		},
+	}
+	s.ResizeHandlerPool(HandlerPoolSettings{Workers: 1})
+	defer s.closeHandlerPool()
+
+	ss := &testServerStream{method: "/svc/Panic"}
+	s.handleStream(ss)
+	require.Equal(t, code.Code_INTERNAL, status.FromError(ss.finishErr).Code())
+	stats, _ := s.HandlerPoolStats()
+	require.EqualValues(t, 1, stats.Panics)
+}
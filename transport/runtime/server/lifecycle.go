@@ -73,11 +73,12 @@ func (s *server) Stop(ctx context.Context) error {
 	}
 
 	wg.Wait()
-	return errs
+	s.closeHandlerPool()
+	return errors.Join(errs, s.closeMuxes())
 }
 
 func (s *server) Serve(startFlag chan<- struct{}) (err error) {
-	runtimeErrCh := make(chan error, len(s.servers)+1)
+	runtimeErrCh := make(chan error, len(s.servers)+1+len(s.listeners))
 
 	defer func() {
 		if err != nil {
@@ -101,6 +102,10 @@ func (s *server) Serve(startFlag chan<- struct{}) (err error) {
 		return err
 	}
 
+	if err = s.serveListeners(runtimeErrCh); err != nil {
+		return err
+	}
+
 	if startFlag != nil {
 		startFlag <- struct{}{}
 	}
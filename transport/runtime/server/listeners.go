@@ -0,0 +1,232 @@
+// Copyright 2022 The codesjoy Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"maps"
+	"net"
+	"net/http"
+	"time"
+
+	remote "github.com/codesjoy/yggdrasil/v3/transport"
+	"github.com/codesjoy/yggdrasil/v3/transport/support/handoff"
+	"github.com/codesjoy/yggdrasil/v3/transport/support/portmux"
+)
+
+const (
+	// ListenerProtocolHTTP attaches a listener to the REST gateway.
+	ListenerProtocolHTTP = "http"
+	// ListenerProtocolMux shares one listener between the grpc transport
+	// (HTTP/2) and the REST gateway (HTTP/1.1).
+	ListenerProtocolMux = "mux"
+
+	// MetadataScheme is the endpoint metadata key carrying the scheme clients
+	// use to reach an additional listener.
+	MetadataScheme = "scheme"
+
+	muxRPCProtocol = "grpc"
+	listenTimeout  = 5 * time.Second
+)
+
+// ListenerSettings describes an additional address the server listens on.
+type ListenerSettings struct {
+	// Protocol is a transport protocol such as "grpc", "http" for the REST
+	// gateway, or "mux" to serve grpc and REST on the same port.
+	Protocol string `mapstructure:"protocol"`
+	// Network defaults to "tcp".
+	Network string            `mapstructure:"network"`
+	Address string            `mapstructure:"address"`
+	Attr    map[string]string `mapstructure:"attr"`
+}
+
+type listenerBinding struct {
+	settings ListenerSettings
+	rpc      remote.ListenerServer
+	rest     remote.ListenerServer
+}
+
+func (s *server) initListeners(items []ListenerSettings) error {
+	for i, item := range items {
+		if item.Network == "" {
+			item.Network = "tcp"
+		}
+		binding := listenerBinding{settings: item}
+		switch item.Protocol {
+		case ListenerProtocolHTTP:
+			binding.rest = s.restListenerServer()
+			if binding.rest == nil {
+				return fmt.Errorf("listener %d: rest server is not enabled", i)
+			}
+		case ListenerProtocolMux:
+			binding.rpc = s.rpcListenerServer(muxRPCProtocol)
+			if binding.rpc == nil {
+				return fmt.Errorf("listener %d: mux requires the %s transport", i, muxRPCProtocol)
+			}
+			binding.rest = s.restListenerServer()
+			if binding.rest == nil {
+				return fmt.Errorf("listener %d: mux requires the rest server", i)
+			}
+		default:
+			binding.rpc = s.rpcListenerServer(item.Protocol)
+			if binding.rpc == nil {
+				return fmt.Errorf(
+					"listener %d: protocol %q has no server accepting extra listeners",
+					i, item.Protocol,
+				)
+			}
+		}
+		s.listeners = append(s.listeners, binding)
+	}
+	return nil
+}
+
+func (s *server) rpcListenerServer(protocol string) remote.ListenerServer {
+	for _, item := range s.servers {
+		if item.Info().Protocol != protocol {
+			continue
+		}
+		if ls, ok := item.(remote.ListenerServer); ok {
+			return ls
+		}
+	}
+	return nil
+}
+
+func (s *server) restListenerServer() remote.ListenerServer {
+	if !s.restEnable {
+		return nil
+	}
+	ls, _ := s.restSvr.(remote.ListenerServer)
+	return ls
+}
+
+func (s *server) serveListeners(runtimeErrCh chan<- error) error {
+	for _, item := range s.listeners {
+		ctx, cancel := context.WithTimeout(context.Background(), listenTimeout)
+		lis, err := handoff.Listen(ctx, item.settings.Network, item.settings.Address)
+		cancel()
+		if err != nil {
+			slog.Error("fault to listen",
+				slog.String("protocol", item.settings.Protocol),
+				slog.String("address", item.settings.Address),
+				slog.Any("error", err))
+			return err
+		}
+		address := lis.Addr().String()
+		switch {
+		case item.settings.Protocol == ListenerProtocolMux:
+			mux := portmux.New(lis)
+			s.mu.Lock()
+			s.muxes = append(s.muxes, mux)
+			s.extraEndpoints = append(s.extraEndpoints,
+				s.listenerEndpoint(item.settings, muxRPCProtocol, address, EndpointKindRPC),
+				s.listenerEndpoint(item.settings, ListenerProtocolHTTP, address, EndpointKindRest),
+			)
+			s.mu.Unlock()
+			s.goServeListener(muxRPCProtocol, item.rpc, mux.HTTP2(), runtimeErrCh)
+			s.goServeListener(ListenerProtocolHTTP, item.rest, mux.HTTP1(), runtimeErrCh)
+			s.goServe(ListenerProtocolMux, mux.Serve, runtimeErrCh)
+		case item.rest != nil:
+			s.addExtraEndpoint(
+				s.listenerEndpoint(item.settings, ListenerProtocolHTTP, address, EndpointKindRest),
+			)
+			s.goServeListener(ListenerProtocolHTTP, item.rest, lis, runtimeErrCh)
+		default:
+			s.addExtraEndpoint(
+				s.listenerEndpoint(item.settings, item.settings.Protocol, address, EndpointKindRPC),
+			)
+			s.goServeListener(item.settings.Protocol, item.rpc, lis, runtimeErrCh)
+		}
+		slog.Info("listener started",
+			slog.String("protocol", item.settings.Protocol),
+			slog.String("endpoint", address))
+	}
+	return nil
+}
+
+func (s *server) goServeListener(
+	protocol string,
+	svr remote.ListenerServer,
+	lis net.Listener,
+	runtimeErrCh chan<- error,
+) {
+	s.goServe(protocol, func() error { return svr.ServeListener(lis) }, runtimeErrCh)
+}
+
+func (s *server) goServe(protocol string, serve func() error, runtimeErrCh chan<- error) {
+	s.serverWG.Add(1)
+	go func() {
+		defer s.serverWG.Done()
+		if err := serve(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			slog.Error("the listener exits abnormally",
+				slog.String("protocol", protocol),
+				slog.Any("error", err))
+			s.reportServeRuntimeError(
+				runtimeErrCh,
+				fmt.Errorf("listener %s exited abnormally: %w", protocol, err),
+			)
+		}
+	}()
+}
+
+func (s *server) addExtraEndpoint(endpoint Endpoint) {
+	s.mu.Lock()
+	s.extraEndpoints = append(s.extraEndpoints, endpoint)
+	s.mu.Unlock()
+}
+
+func (s *server) listenerEndpoint(
+	item ListenerSettings,
+	scheme, address string,
+	kind EndpointKind,
+) Endpoint {
+	var attrs map[string]string
+	if kind == EndpointKindRest {
+		attrs = s.restSvr.Info().GetAttributes()
+	} else {
+		for _, svr := range s.servers {
+			if svr.Info().Protocol == scheme {
+				attrs = svr.Info().Attributes
+				break
+			}
+		}
+	}
+	attrs = s.endpointMetadata(scheme, attrs)
+	metadata := make(map[string]string, len(attrs)+len(item.Attr)+1)
+	maps.Copy(metadata, attrs)
+	maps.Copy(metadata, item.Attr)
+	metadata[MetadataScheme] = scheme
+	return &serverInfo{
+		protocol: scheme,
+		address:  address,
+		metadata: metadata,
+		svrKind:  kind,
+	}
+}
+
+func (s *server) closeMuxes() error {
+	s.mu.RLock()
+	muxes := s.muxes
+	s.mu.RUnlock()
+	var errs error
+	for _, mux := range muxes {
+		errs = errors.Join(errs, mux.Close())
+	}
+	return errs
+}
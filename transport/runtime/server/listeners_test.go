@@ -0,0 +1,171 @@
+// Copyright 2022 The codesjoy Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	remote "github.com/codesjoy/yggdrasil/v3/transport"
+)
+
+// greetingListeners answers every accepted connection with its name.
+type greetingListeners struct {
+	name string
+	mu   sync.Mutex
+	lis  []net.Listener
+}
+
+func (g *greetingListeners) ServeListener(lis net.Listener) error {
+	g.mu.Lock()
+	g.lis = append(g.lis, lis)
+	g.mu.Unlock()
+	for {
+		conn, err := lis.Accept()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return nil
+			}
+			return err
+		}
+		_, _ = io.WriteString(conn, g.name)
+		_ = conn.Close()
+	}
+}
+
+func (g *greetingListeners) Stop(context.Context) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	for _, lis := range g.lis {
+		_ = lis.Close()
+	}
+	return nil
+}
+
+type testListenerRemoteServer struct {
+	testRemoteServer
+	*greetingListeners
+}
+
+func (s *testListenerRemoteServer) Stop(ctx context.Context) error {
+	return s.greetingListeners.Stop(ctx)
+}
+
+type testListenerRestServer struct {
+	mockRestServer
+	*greetingListeners
+}
+
+func (s *testListenerRestServer) Stop(ctx context.Context) error {
+	return s.greetingListeners.Stop(ctx)
+}
+
+func newListenerTestServer() *server {
+	s := newTestServer()
+	s.servers = []remote.Server{&testListenerRemoteServer{
+		testRemoteServer: testRemoteServer{info: remote.ServerInfo{
+			Protocol:   "grpc",
+			Address:    "127.0.0.1:9000",
+			Attributes: map[string]string{"zone": "a"},
+		}},
+		greetingListeners: &greetingListeners{name: "grpc"},
+	}}
+	s.restEnable = true
+	s.restSvr = &testListenerRestServer{
+		mockRestServer:    mockRestServer{address: "127.0.0.1:8080"},
+		greetingListeners: &greetingListeners{name: "http"},
+	}
+	return s
+}
+
+func readGreeting(t *testing.T, address string, preface []byte) string {
+	t.Helper()
+	conn, err := net.Dial("tcp", address)
+	require.NoError(t, err)
+	defer conn.Close() //nolint:errcheck
+	if len(preface) > 0 {
+		_, err = conn.Write(preface)
+		require.NoError(t, err)
+	}
+	got, err := io.ReadAll(conn)
+	require.NoError(t, err)
+	return string(got)
+}
+
+func TestInitListenersValidation(t *testing.T) {
+	s := newListenerTestServer()
+	require.NoError(t, s.initListeners([]ListenerSettings{
+		{Protocol: "grpc", Address: "127.0.0.1:0"},
+		{Protocol: ListenerProtocolHTTP, Address: "127.0.0.1:0"},
+		{Protocol: ListenerProtocolMux, Address: "127.0.0.1:0"},
+	}))
+	require.Len(t, s.listeners, 3)
+	assert.Equal(t, "tcp", s.listeners[0].settings.Network)
+
+	err := newListenerTestServer().initListeners([]ListenerSettings{{Protocol: "quic"}})
+	assert.ErrorContains(t, err, `protocol "quic"`)
+
+	noRest := newListenerTestServer()
+	noRest.restEnable = false
+	err = noRest.initListeners([]ListenerSettings{{Protocol: ListenerProtocolHTTP}})
+	assert.ErrorContains(t, err, "rest server is not enabled")
+	err = noRest.initListeners([]ListenerSettings{{Protocol: ListenerProtocolMux}})
+	assert.ErrorContains(t, err, "mux requires the rest server")
+
+	plain := newTestServer()
+	plain.servers = []remote.Server{&testRemoteServer{info: remote.ServerInfo{Protocol: "grpc"}}}
+	err = plain.initListeners([]ListenerSettings{{Protocol: "grpc"}})
+	assert.ErrorContains(t, err, "no server accepting extra listeners")
+}
+
+func TestServeAdditionalListeners(t *testing.T) {
+	s := newListenerTestServer()
+	require.NoError(t, s.initListeners([]ListenerSettings{
+		{Protocol: "grpc", Address: "127.0.0.1:0", Attr: map[string]string{"lane": "blue"}},
+		{Protocol: ListenerProtocolMux, Address: "127.0.0.1:0"},
+	}))
+
+	startFlag := make(chan struct{})
+	served := make(chan error, 1)
+	go func() { served <- s.Serve(startFlag) }()
+	<-startFlag
+
+	endpoints := s.Endpoints()
+	require.Len(t, endpoints, 5)
+	extra := endpoints[2]
+	assert.Equal(t, EndpointKindRPC, extra.Kind())
+	assert.Equal(t, map[string]string{"zone": "a", "lane": "blue", MetadataScheme: "grpc"},
+		extra.Metadata())
+	assert.Equal(t, "grpc", readGreeting(t, extra.Address(), nil))
+
+	muxRPC, muxRest := endpoints[3], endpoints[4]
+	assert.Equal(t, muxRPC.Address(), muxRest.Address())
+	assert.Equal(t, EndpointKindRPC, muxRPC.Kind())
+	assert.Equal(t, EndpointKindRest, muxRest.Kind())
+	assert.Equal(t, "http", muxRest.Metadata()[MetadataScheme])
+	assert.Equal(t, "grpc",
+		readGreeting(t, muxRPC.Address(), []byte("PRI * HTTP/2.0\r\n\r\nSM\r\n\r\n")))
+	assert.Equal(t, "http", readGreeting(t, muxRest.Address(), []byte("GET / HTTP/1.1\r\n")))
+
+	require.NoError(t, s.Stop(context.Background()))
+	require.NoError(t, <-served)
+}
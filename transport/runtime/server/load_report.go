@@ -0,0 +1,52 @@
+// Copyright 2022 The codesjoy Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	remote "github.com/codesjoy/yggdrasil/v3/transport"
+	"github.com/codesjoy/yggdrasil/v3/transport/support/orca"
+)
+
+// loadReportStream attaches the server load report to the stream trailer.
+type loadReportStream struct {
+	remote.ServerStream
+	recorder *orca.Recorder
+}
+
+func (s *loadReportStream) Finish(reply any, err error) {
+	s.recorder.Done()
+	s.ServerStream.SetTrailer(s.recorder.Report().Trailer())
+	s.ServerStream.Finish(reply, err)
+}
+
+// ConfigureLoadReport applies new load report settings to a running server.
+func (s *server) ConfigureLoadReport(cfg orca.Config) {
+	if !cfg.Enabled {
+		s.loadRecorder.Store(nil)
+		return
+	}
+	if current := s.loadRecorder.Load(); current != nil {
+		current.Configure(cfg)
+		return
+	}
+	s.loadRecorder.Store(orca.NewRecorder(cfg))
+}
+
+// LoadRecorder returns the recorder of the load reports, if they are
+// enabled. Applications use it to report their own utilization.
+func (s *server) LoadRecorder() (*orca.Recorder, bool) {
+	recorder := s.loadRecorder.Load()
+	return recorder, recorder != nil
+}
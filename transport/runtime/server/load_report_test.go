@@ -0,0 +1,70 @@
+// Copyright 2022 The codesjoy Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/codesjoy/yggdrasil/v3/rpc/interceptor"
+	"github.com/codesjoy/yggdrasil/v3/transport/support/orca"
+)
+
+func TestServerLoadReportTrailer(t *testing.T) {
+	s := newTestServer()
+	s.services["svc"] = &ServiceInfo{
+		ServiceImpl: &TestServiceImpl{},
+		Methods: map[string]*MethodDesc{
+			"Echo": {
+				MethodName: "Echo",
+				Handler: func(
+					any,
+					context.Context,
+					func(any) error,
+					interceptor.UnaryServerInterceptor,
+				) (any, error) {
+					return "ok", nil
+				},
+			},
+		},
+	}
+
+	plain := &testServerStream{method: "/svc/Echo"}
+	s.handleStream(plain)
+	assert.Empty(t, plain.trailer.Get(orca.TrailerKey))
+
+	s.ConfigureLoadReport(orca.Config{Enabled: true})
+	recorder, ok := s.LoadRecorder()
+	require.True(t, ok)
+	recorder.SetApplicationUtilization(0.5)
+
+	reported := &testServerStream{method: "/svc/Echo"}
+	s.handleStream(reported)
+	require.Equal(t, "ok", reported.finishReply)
+	report, ok := orca.FromTrailer(reported.trailer)
+	require.True(t, ok)
+	assert.Equal(t, 0.5, report.ApplicationUtilization)
+
+	s.ConfigureLoadReport(orca.Config{Enabled: true})
+	same, _ := s.LoadRecorder()
+	assert.Same(t, recorder, same, "reconfiguring keeps the recorder")
+
+	s.ConfigureLoadReport(orca.Config{})
+	_, ok = s.LoadRecorder()
+	assert.False(t, ok)
+}
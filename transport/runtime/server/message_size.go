@@ -0,0 +1,279 @@
+// Copyright 2022 The codesjoy Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+
+	"google.golang.org/genproto/googleapis/rpc/code"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/codesjoy/yggdrasil/v3/observability/stats"
+	"github.com/codesjoy/yggdrasil/v3/rpc/status"
+	"github.com/codesjoy/yggdrasil/v3/rpc/stream"
+	remote "github.com/codesjoy/yggdrasil/v3/transport"
+)
+
+// MessageSizeDomain and MessageTooLargeReason identify the ErrorInfo of the
+// RESOURCE_EXHAUSTED errors returned for messages over their size limit.
+const (
+	MessageSizeDomain     = "yggdrasil"
+	MessageTooLargeReason = "MESSAGE_TOO_LARGE"
+)
+
+func init() {
+	status.RegisterReasonEntries(status.ReasonEntry{
+		Domain:      MessageSizeDomain,
+		Reason:      MessageTooLargeReason,
+		Code:        code.Code_RESOURCE_EXHAUSTED.String(),
+		Description: "A request or response message exceeds the size limit of the method.",
+	})
+}
+
+// MessageSizeSettings bounds the message sizes of the methods it applies to.
+// Sizes are the encoded, uncompressed message sizes in bytes. Transports
+// able to do so reject requests over MaxRecv before decoding them.
+type MessageSizeSettings struct {
+	// MaxRecv rejects larger requests. Zero means unlimited.
+	MaxRecv int `mapstructure:"max_recv"`
+	// MaxSend rejects larger responses. Zero means unlimited.
+	MaxSend int `mapstructure:"max_send"`
+	// Warn logs messages of at least this size and reports them as
+	// RPCPayloadTooLarge stats. Zero disables the warning.
+	Warn int `mapstructure:"warn"`
+}
+
+// messageSizeBounds are the upper bounds of the size histogram buckets; a
+// last bucket counts the larger messages.
+var messageSizeBounds = []int{1 << 10, 1 << 12, 1 << 14, 1 << 16, 1 << 18, 1 << 20, 1 << 22}
+
+// SizeHistogram is the size distribution of the messages in one direction.
+// Buckets[i] counts the messages up to messageSizeBounds[i] bytes.
+type SizeHistogram struct {
+	Count   uint64   `json:"count"`
+	Sum     uint64   `json:"sum"`
+	Max     int      `json:"max"`
+	Buckets []uint64 `json:"buckets"`
+}
+
+func (h *SizeHistogram) record(size int) {
+	if h.Buckets == nil {
+		h.Buckets = make([]uint64, len(messageSizeBounds)+1)
+	}
+	h.Count++
+	h.Sum += uint64(size)
+	h.Max = max(h.Max, size)
+	i, _ := slices.BinarySearch(messageSizeBounds, size)
+	h.Buckets[i]++
+}
+
+func (h SizeHistogram) clone() SizeHistogram {
+	h.Buckets = slices.Clone(h.Buckets)
+	return h
+}
+
+// MethodMessageSizes is the message size distribution of one method.
+type MethodMessageSizes struct {
+	Method string        `json:"method"`
+	Recv   SizeHistogram `json:"recv"`
+	Send   SizeHistogram `json:"send"`
+}
+
+// messageSizeGuard enforces MessageSizeSettings and records the sizes of
+// the messages of the methods with a rule. A nil guard does nothing.
+type messageSizeGuard struct {
+	rules map[string]MessageSizeSettings
+	stats stats.Handler
+
+	mu      sync.Mutex
+	methods map[string]*methodSizeGuard
+}
+
+func newMessageSizeGuard(
+	rules map[string]MessageSizeSettings,
+	handler stats.Handler,
+) *messageSizeGuard {
+	if len(rules) == 0 {
+		return nil
+	}
+	return &messageSizeGuard{
+		rules:   rules,
+		stats:   handler,
+		methods: map[string]*methodSizeGuard{},
+	}
+}
+
+// forMethod returns the guard of method, or nil when no rule applies.
+func (g *messageSizeGuard) forMethod(method string) *methodSizeGuard {
+	if g == nil {
+		return nil
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if m, ok := g.methods[method]; ok {
+		return m
+	}
+	cfg, ok := matchMethodRule(g.rules, method)
+	if !ok {
+		// Remember the miss; methods are bounded by the registered services.
+		g.methods[method] = nil
+		return nil
+	}
+	m := &methodSizeGuard{method: method, cfg: cfg, stats: g.stats}
+	g.methods[method] = m
+	return m
+}
+
+func (g *messageSizeGuard) snapshot() []MethodMessageSizes {
+	out := []MethodMessageSizes{}
+	if g == nil {
+		return out
+	}
+	g.mu.Lock()
+	methods := make([]*methodSizeGuard, 0, len(g.methods))
+	for _, m := range g.methods {
+		if m != nil {
+			methods = append(methods, m)
+		}
+	}
+	g.mu.Unlock()
+	for _, m := range methods {
+		m.mu.Lock()
+		out = append(out, MethodMessageSizes{
+			Method: m.method,
+			Recv:   m.recv.clone(),
+			Send:   m.send.clone(),
+		})
+		m.mu.Unlock()
+	}
+	slices.SortFunc(out, func(a, b MethodMessageSizes) int {
+		return strings.Compare(a.Method, b.Method)
+	})
+	return out
+}
+
+type methodSizeGuard struct {
+	method string
+	cfg    MessageSizeSettings
+	stats  stats.Handler
+
+	mu   sync.Mutex
+	recv SizeHistogram
+	send SizeHistogram
+}
+
+// check records the size of msg and rejects it when over the limit.
+func (m *methodSizeGuard) check(ctx context.Context, msg any, inbound bool) error {
+	if m == nil {
+		return nil
+	}
+	pm, ok := msg.(proto.Message)
+	if !ok {
+		return nil
+	}
+	return m.checkSize(ctx, proto.Size(pm), inbound)
+}
+
+// checkOnWire asks ss to check the encoded size of the requests before
+// decoding them and reports whether it does.
+func (m *methodSizeGuard) checkOnWire(ctx context.Context, ss remote.ServerStream) bool {
+	checker, ok := ss.(remote.RecvSizeChecker)
+	if m == nil || !ok {
+		return false
+	}
+	return checker.CheckRecvSize(m.cfg.MaxRecv, func(size int) error {
+		return m.checkSize(ctx, size, true)
+	})
+}
+
+// checkSize records a message of size bytes and rejects it when over the
+// limit.
+func (m *methodSizeGuard) checkSize(ctx context.Context, size int, inbound bool) error {
+	direction, limit := "send", m.cfg.MaxSend
+	if inbound {
+		direction, limit = "recv", m.cfg.MaxRecv
+	}
+	m.mu.Lock()
+	if inbound {
+		m.recv.record(size)
+	} else {
+		m.send.record(size)
+	}
+	m.mu.Unlock()
+
+	if limit > 0 && size > limit {
+		return status.New(
+			code.Code_RESOURCE_EXHAUSTED,
+			fmt.Sprintf("%s message of %d bytes exceeds the limit of %d bytes",
+				direction, size, limit),
+		).WithDetails(&errdetails.ErrorInfo{
+			Reason: MessageTooLargeReason,
+			Domain: MessageSizeDomain,
+			Metadata: map[string]string{
+				"method":    m.method,
+				"direction": direction,
+				"size":      strconv.Itoa(size),
+				"limit":     strconv.Itoa(limit),
+			},
+		}).Err()
+	}
+	if m.cfg.Warn > 0 && size >= m.cfg.Warn {
+		slog.Warn("large message",
+			slog.String("method", m.method),
+			slog.String("direction", direction),
+			slog.Int("size", size),
+			slog.Int("threshold", m.cfg.Warn),
+		)
+		if m.stats != nil {
+			m.stats.HandleRPC(ctx, &stats.RPCPayloadTooLargeBase{
+				Inbound:    inbound,
+				FullMethod: m.method,
+				Size:       size,
+				Threshold:  m.cfg.Warn,
+			})
+		}
+	}
+	return nil
+}
+
+// sizeServerStream checks the messages of a stream against the limits of
+// its method.
+type sizeServerStream struct {
+	stream.ServerStream
+	guard *methodSizeGuard
+	// onWire reports whether the transport checks the requests.
+	onWire bool
+}
+
+func (ss *sizeServerStream) RecvMsg(m any) error {
+	if err := ss.ServerStream.RecvMsg(m); err != nil || ss.onWire {
+		return err
+	}
+	return ss.guard.check(ss.Context(), m, true)
+}
+
+func (ss *sizeServerStream) SendMsg(m any) error {
+	if err := ss.guard.check(ss.Context(), m, false); err != nil {
+		return err
+	}
+	return ss.ServerStream.SendMsg(m)
+}
@@ -0,0 +1,250 @@
+// Copyright 2022 The codesjoy Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/genproto/googleapis/rpc/code"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+
+	"github.com/codesjoy/yggdrasil/v3/observability/stats"
+	"github.com/codesjoy/yggdrasil/v3/rpc/interceptor"
+	"github.com/codesjoy/yggdrasil/v3/rpc/status"
+	"github.com/codesjoy/yggdrasil/v3/rpc/stream"
+)
+
+type sizeStatsHandler struct {
+	events []stats.RPCStats
+}
+
+func (h *sizeStatsHandler) TagRPC(ctx context.Context, _ stats.RPCTagInfo) context.Context {
+	return ctx
+}
+
+func (h *sizeStatsHandler) HandleRPC(_ context.Context, rs stats.RPCStats) {
+	h.events = append(h.events, rs)
+}
+
+func (h *sizeStatsHandler) TagChannel(ctx context.Context, _ stats.ChanTagInfo) context.Context {
+	return ctx
+}
+
+func (h *sizeStatsHandler) HandleChannel(context.Context, stats.ChanStats) {}
+
+type payloadServerStream struct {
+	testServerStream
+	recv string
+	sent []any
+}
+
+func (s *payloadServerStream) RecvMsg(m any) error {
+	m.(*wrapperspb.StringValue).Value = s.recv
+	return nil
+}
+
+func (s *payloadServerStream) SendMsg(m any) error {
+	s.sent = append(s.sent, m)
+	return nil
+}
+
+// wireSizeServerStream checks the request size before decoding it, like
+// the transports implementing remote.RecvSizeChecker.
+type wireSizeServerStream struct {
+	payloadServerStream
+	check   func(size int) error
+	decoded bool
+}
+
+func (s *wireSizeServerStream) CheckRecvSize(_ int, check func(size int) error) bool {
+	s.check = check
+	return true
+}
+
+func (s *wireSizeServerStream) RecvMsg(m any) error {
+	if err := s.check(len(s.recv)); err != nil {
+		return err
+	}
+	s.decoded = true
+	return s.payloadServerStream.RecvMsg(m)
+}
+
+func echoMethod() *MethodDesc {
+	return &MethodDesc{
+		MethodName: "Echo",
+		Handler: func(
+			_ interface{},
+			_ context.Context,
+			dec func(interface{}) error,
+			_ interceptor.UnaryServerInterceptor,
+		) (interface{}, error) {
+			in := &wrapperspb.StringValue{}
+			if err := dec(in); err != nil {
+				return nil, err
+			}
+			return wrapperspb.String(strings.Repeat(in.Value, 2)), nil
+		},
+	}
+}
+
+func TestMessageSizeGuardForMethod(t *testing.T) {
+	g := newMessageSizeGuard(map[string]MessageSizeSettings{
+		"/pkg.Svc/*":    {MaxRecv: 10},
+		"/pkg.Svc/Big*": {MaxRecv: 100},
+	}, nil)
+	assert.Equal(t, 10, g.forMethod("/pkg.Svc/Get").cfg.MaxRecv)
+	assert.Equal(t, 100, g.forMethod("/pkg.Svc/BigUpload").cfg.MaxRecv)
+	assert.Nil(t, g.forMethod("/other.Svc/Get"))
+	assert.Same(t, g.forMethod("/pkg.Svc/Get"), g.forMethod("/pkg.Svc/Get"))
+
+	assert.Nil(t, newMessageSizeGuard(nil, nil))
+	var none *messageSizeGuard
+	assert.Nil(t, none.forMethod("/pkg.Svc/Get"))
+	assert.Empty(t, none.snapshot())
+}
+
+func TestServerMessageSizeUnary(t *testing.T) {
+	t.Run("request over the limit", func(t *testing.T) {
+		s := &server{messageSizes: newMessageSizeGuard(map[string]MessageSizeSettings{
+			"*": {MaxRecv: 16},
+		}, nil)}
+		ss := &payloadServerStream{
+			testServerStream: testServerStream{method: "/svc/Echo"},
+			recv:             strings.Repeat("x", 32),
+		}
+		s.processUnaryRPC(echoMethod(), &ServiceInfo{ServiceImpl: &TestServiceImpl{}}, ss)
+
+		st := status.FromError(ss.finishErr)
+		assert.Equal(t, code.Code_RESOURCE_EXHAUSTED, st.Code())
+		info := st.ErrorInfo()
+		require.NotNil(t, info)
+		assert.Equal(t, MessageTooLargeReason, info.GetReason())
+		assert.Equal(t, map[string]string{
+			"method":    "/svc/Echo",
+			"direction": "recv",
+			"size":      "34",
+			"limit":     "16",
+		}, info.GetMetadata())
+	})
+
+	t.Run("request over the limit on the wire", func(t *testing.T) {
+		s := &server{messageSizes: newMessageSizeGuard(map[string]MessageSizeSettings{
+			"*": {MaxRecv: 16},
+		}, nil)}
+		ss := &wireSizeServerStream{payloadServerStream: payloadServerStream{
+			testServerStream: testServerStream{method: "/svc/Echo"},
+			recv:             strings.Repeat("x", 32),
+		}}
+		s.processUnaryRPC(echoMethod(), &ServiceInfo{ServiceImpl: &TestServiceImpl{}}, ss)
+
+		assert.False(t, ss.decoded)
+		st := status.FromError(ss.finishErr)
+		assert.Equal(t, code.Code_RESOURCE_EXHAUSTED, st.Code())
+		assert.Equal(t, "32", st.ErrorInfo().GetMetadata()["size"])
+		sizes := s.messageSizes.snapshot()
+		require.Len(t, sizes, 1)
+		assert.Equal(t, uint64(1), sizes[0].Recv.Count, "the size is recorded once")
+	})
+
+	t.Run("response over the limit", func(t *testing.T) {
+		s := &server{messageSizes: newMessageSizeGuard(map[string]MessageSizeSettings{
+			"/svc/*": {MaxSend: 40},
+		}, nil)}
+		ss := &payloadServerStream{
+			testServerStream: testServerStream{method: "/svc/Echo"},
+			recv:             strings.Repeat("x", 32),
+		}
+		s.processUnaryRPC(echoMethod(), &ServiceInfo{ServiceImpl: &TestServiceImpl{}}, ss)
+
+		assert.Nil(t, ss.finishReply)
+		st := status.FromError(ss.finishErr)
+		assert.Equal(t, code.Code_RESOURCE_EXHAUSTED, st.Code())
+		assert.Equal(t, "send", st.ErrorInfo().GetMetadata()["direction"])
+	})
+
+	t.Run("warn threshold reports stats", func(t *testing.T) {
+		handler := &sizeStatsHandler{}
+		s := &server{messageSizes: newMessageSizeGuard(map[string]MessageSizeSettings{
+			"*": {Warn: 20},
+		}, handler)}
+		ss := &payloadServerStream{
+			testServerStream: testServerStream{method: "/svc/Echo"},
+			recv:             strings.Repeat("x", 12),
+		}
+		s.processUnaryRPC(echoMethod(), &ServiceInfo{ServiceImpl: &TestServiceImpl{}}, ss)
+
+		require.NoError(t, ss.finishErr)
+		require.Len(t, handler.events, 1)
+		ev, ok := handler.events[0].(stats.RPCPayloadTooLarge)
+		require.True(t, ok)
+		assert.False(t, ev.IsInbound())
+		assert.Equal(t, "/svc/Echo", ev.GetFullMethod())
+		assert.Equal(t, 26, ev.GetSize())
+		assert.Equal(t, 20, ev.GetThreshold())
+
+		sizes := s.messageSizes.snapshot()
+		require.Len(t, sizes, 1)
+		assert.Equal(t, uint64(1), sizes[0].Recv.Count)
+		assert.Equal(t, uint64(14), sizes[0].Recv.Sum)
+		assert.Equal(t, uint64(1), sizes[0].Recv.Buckets[0])
+		assert.Equal(t, 26, sizes[0].Send.Max)
+	})
+}
+
+func TestServerMessageSizeStream(t *testing.T) {
+	s := &server{
+		messageSizes: newMessageSizeGuard(map[string]MessageSizeSettings{
+			"*": {MaxSend: 8},
+		}, nil),
+	}
+	s.chains.Store(&interceptorChains{
+		stream: func(
+			srv interface{},
+			ss stream.ServerStream,
+			_ *interceptor.StreamServerInfo,
+			handler stream.Handler,
+		) error {
+			return handler(srv, ss)
+		},
+	})
+	ss := &payloadServerStream{testServerStream: testServerStream{method: "/svc/Watch"}}
+	s.processStreamRPC(&stream.Desc{
+		StreamName:    "Watch",
+		ServerStreams: true,
+		Handler: func(_ interface{}, ss stream.ServerStream) error {
+			if err := ss.SendMsg(wrapperspb.String("ok")); err != nil {
+				return err
+			}
+			return ss.SendMsg(wrapperspb.String(strings.Repeat("x", 16)))
+		},
+	}, &ServiceInfo{ServiceImpl: &TestServiceImpl{}}, ss)
+
+	assert.Len(t, ss.sent, 1)
+	assert.Equal(t, code.Code_RESOURCE_EXHAUSTED, status.FromError(ss.finishErr).Code())
+}
+
+func TestSizeHistogramBuckets(t *testing.T) {
+	var h SizeHistogram
+	for _, size := range []int{0, 1 << 10, 1<<10 + 1, 1 << 22, 1<<22 + 1} {
+		h.record(size)
+	}
+	assert.Equal(t, uint64(5), h.Count)
+	assert.Equal(t, 1<<22+1, h.Max)
+	assert.Equal(t, []uint64{2, 1, 0, 0, 0, 0, 1, 1}, h.Buckets)
+}
@@ -62,6 +62,14 @@ func (m *mockServer) RegisterService(sd *ServiceDesc, _ interface{}) {
 	m.services = append(m.services, sd)
 }
 
+func (m *mockServer) UnregisterService(string) bool {
+	return false
+}
+
+func (m *mockServer) ServiceNames() []string {
+	return nil
+}
+
 func (m *mockServer) RegisterRestService(sd *RestServiceDesc, _ interface{}, _ ...string) {
 	m.restServices = append(m.restServices, sd)
 }
@@ -70,6 +78,10 @@ func (m *mockServer) RegisterRestRawHandlers(sd ...*RestRawHandlerDesc) {
 	m.rawHandlers = append(m.rawHandlers, sd...)
 }
 
+func (m *mockServer) Routes() RouteTable {
+	return RouteTable{}
+}
+
 func (m *mockServer) Serve(startFlag chan<- struct{}) error {
 	m.serveCalled = true
 	if startFlag != nil {
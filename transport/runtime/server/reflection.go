@@ -0,0 +1,102 @@
+// Copyright 2022 The codesjoy Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	ggrpc "google.golang.org/grpc"
+	gmetadata "google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/reflection"
+	reflectionpb "google.golang.org/grpc/reflection/grpc_reflection_v1"
+
+	"github.com/codesjoy/yggdrasil/v3/rpc/metadata"
+	"github.com/codesjoy/yggdrasil/v3/rpc/stream"
+)
+
+// ReflectionServiceName is the name of the gRPC server reflection service.
+const ReflectionServiceName = "grpc.reflection.v1.ServerReflection"
+
+// NewReflectionService returns the grpc.reflection.v1.ServerReflection
+// implementation describing the services registered on svr. Descriptors are
+// looked up in the global protobuf registry, which the generated code of
+// every registered service populates. Install it with ReflectionServiceDesc.
+func NewReflectionService(svr Server) reflectionpb.ServerReflectionServer {
+	return reflection.NewServerV1(reflection.ServerOptions{Services: serviceInfoProvider{svr}})
+}
+
+// serviceInfoProvider lists the services of a Server the way grpc-go's
+// reflection expects; it only reads the names.
+type serviceInfoProvider struct {
+	svr Server
+}
+
+func (p serviceInfoProvider) GetServiceInfo() map[string]ggrpc.ServiceInfo {
+	names := p.svr.ServiceNames()
+	out := make(map[string]ggrpc.ServiceInfo, len(names))
+	for _, name := range names {
+		out[name] = ggrpc.ServiceInfo{}
+	}
+	return out
+}
+
+// reflectionInfoStream adapts a ServerStream to the stream grpc-go's
+// reflection implementation serves.
+type reflectionInfoStream struct {
+	stream.ServerStream
+}
+
+func (s reflectionInfoStream) Send(m *reflectionpb.ServerReflectionResponse) error {
+	return s.ServerStream.SendMsg(m)
+}
+
+func (s reflectionInfoStream) Recv() (*reflectionpb.ServerReflectionRequest, error) {
+	m := new(reflectionpb.ServerReflectionRequest)
+	if err := s.ServerStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (s reflectionInfoStream) SetHeader(md gmetadata.MD) error {
+	return s.ServerStream.SetHeader(metadata.MD(md))
+}
+
+func (s reflectionInfoStream) SendHeader(md gmetadata.MD) error {
+	return s.ServerStream.SendHeader(metadata.MD(md))
+}
+
+func (s reflectionInfoStream) SetTrailer(md gmetadata.MD) {
+	s.ServerStream.SetTrailer(metadata.MD(md))
+}
+
+func reflectionInfoHandler(srv any, ss stream.ServerStream) error {
+	return srv.(reflectionpb.ServerReflectionServer).
+		ServerReflectionInfo(reflectionInfoStream{ServerStream: ss})
+}
+
+// ReflectionServiceDesc describes the grpc.reflection.v1.ServerReflection
+// service for the server runtime. Register it with an implementation
+// returned by NewReflectionService, or set Settings.Reflection.
+var ReflectionServiceDesc = ServiceDesc{
+	ServiceName: ReflectionServiceName,
+	HandlerType: (*reflectionpb.ServerReflectionServer)(nil),
+	Streams: []stream.Desc{
+		{
+			StreamName:    "ServerReflectionInfo",
+			Handler:       reflectionInfoHandler,
+			ServerStreams: true,
+			ClientStreams: true,
+		},
+	},
+}
@@ -0,0 +1,79 @@
+// Copyright 2022 The codesjoy Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	_ "google.golang.org/grpc/health/grpc_health_v1"
+	reflectionpb "google.golang.org/grpc/reflection/grpc_reflection_v1"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/descriptorpb"
+
+	"github.com/codesjoy/yggdrasil/v3/transport/runtime/server"
+	"github.com/codesjoy/yggdrasil/v3/yggdrasiltest"
+)
+
+func TestReflectionService(t *testing.T) {
+	ts := yggdrasiltest.StartTestServer(t,
+		yggdrasiltest.WithServiceDesc(&server.ServiceDesc{
+			ServiceName: "grpc.health.v1.Health",
+			HandlerType: (*any)(nil),
+		}, struct{}{}),
+		yggdrasiltest.WithConfig(map[string]any{
+			"yggdrasil": map[string]any{"server": map[string]any{"reflection": true}},
+		}),
+	)
+	st, err := ts.Client().NewStream(
+		context.Background(),
+		&server.ReflectionServiceDesc.Streams[0],
+		"/"+server.ReflectionServiceName+"/ServerReflectionInfo",
+	)
+	require.NoError(t, err)
+	type (
+		request  = reflectionpb.ServerReflectionRequest
+		response = reflectionpb.ServerReflectionResponse
+	)
+	exchange := func(req *request) *response {
+		require.NoError(t, st.SendMsg(req))
+		resp := new(response)
+		require.NoError(t, st.RecvMsg(resp))
+		return resp
+	}
+
+	resp := exchange(&reflectionpb.ServerReflectionRequest{
+		MessageRequest: &reflectionpb.ServerReflectionRequest_ListServices{},
+	})
+	var names []string
+	for _, svc := range resp.GetListServicesResponse().GetService() {
+		names = append(names, svc.GetName())
+	}
+	assert.ElementsMatch(t, []string{"grpc.health.v1.Health", server.ReflectionServiceName}, names)
+
+	resp = exchange(&reflectionpb.ServerReflectionRequest{
+		MessageRequest: &reflectionpb.ServerReflectionRequest_FileContainingSymbol{
+			FileContainingSymbol: "grpc.health.v1.Health",
+		},
+	})
+	files := resp.GetFileDescriptorResponse().GetFileDescriptorProto()
+	require.NotEmpty(t, files)
+	fd := new(descriptorpb.FileDescriptorProto)
+	require.NoError(t, proto.Unmarshal(files[0], fd))
+	assert.Equal(t, "grpc/health/v1/health.proto", fd.GetName())
+	require.NoError(t, st.CloseSend())
+}
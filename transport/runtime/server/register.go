@@ -20,17 +20,20 @@ import (
 	"log/slog"
 	"net/http"
 	"reflect"
+	"sort"
 	"strings"
 
 	"github.com/codesjoy/yggdrasil/v3/rpc/stream"
+	"github.com/codesjoy/yggdrasil/v3/transport/gateway/rest"
 )
 
 // RegisterService registers a service and its implementation to the gRPC
-// server. It is called from the IDL generated code. This must be called before
-// invoking Serve. If ss is non-nil (for legacy code), its type is checked to
-// ensure it implements sd.HandlerType.
+// server. It is called from the IDL generated code. It may be called before
+// Serve or while the server is running, in which case the service is routable
+// as soon as it returns. If ss is non-nil (for legacy code), its type is
+// checked to ensure it implements sd.HandlerType.
 func (s *server) RegisterService(sd *ServiceDesc, ss interface{}) {
-	if !s.ensureRegisterable("service") {
+	if !s.ensureServiceRegisterable() {
 		return
 	}
 	if !s.validateServiceHandler(sd, ss) {
@@ -62,15 +65,55 @@ func (s *server) RegisterRestRawHandlers(sd ...*RestRawHandlerDesc) {
 		return
 	}
 	for _, item := range sd {
-		s.appendRestRouteLocked(item.Method, item.Path)
+		s.restRouterDesc = append(s.restRouterDesc, restRouterInfo{
+			Method: item.Method,
+			Path:   item.Path,
+		})
 		s.restSvr.RawHandle(item.Method, item.Path, item.Handler)
 	}
 }
 
+// UnregisterService removes a service registered with RegisterService. Calls
+// already dispatched to it run to completion; new calls fail with
+// UNIMPLEMENTED. It reports whether the service was registered.
+func (s *server) UnregisterService(serviceName string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.state == serverStateClosing {
+		return false
+	}
+	if _, ok := s.services[serviceName]; !ok {
+		return false
+	}
+	delete(s.services, serviceName)
+	delete(s.servicesDesc, serviceName)
+	return true
+}
+
+// ServiceNames returns the names of the registered RPC services in sorted
+// order.
+func (s *server) ServiceNames() []string {
+	s.mu.RLock()
+	names := make([]string, 0, len(s.services))
+	for name := range s.services {
+		names = append(names, name)
+	}
+	s.mu.RUnlock()
+	sort.Strings(names)
+	return names
+}
+
+func (s *server) lookupService(serviceName string) (*ServiceInfo, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	srv, ok := s.services[serviceName]
+	return srv, ok
+}
+
 func (s *server) register(sd *ServiceDesc, ss interface{}) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
-	if !s.ensureRegisterableLocked("service") {
+	if !s.ensureServiceRegisterableLocked() {
 		return
 	}
 	if _, ok := s.services[sd.ServiceName]; ok {
@@ -105,14 +148,25 @@ func (s *server) registerRest(sd *RestServiceDesc, ss interface{}, prefix ...str
 		method := item.Method
 		path := pathPrefix + item.Path
 		handler := item.Handler
-		s.appendRestRouteLocked(method, path)
-		s.restSvr.RPCHandle(
-			method,
-			path,
-			func(w http.ResponseWriter, r *http.Request) (interface{}, error) {
-				return handler(w, r, ss, s.unaryInterceptor)
-			},
-		)
+		s.restRouterDesc = append(s.restRouterDesc, restRouterInfo{
+			Method:   method,
+			Path:     path,
+			Template: item.Template,
+			RPC:      item.RPC,
+		})
+		f := func(w http.ResponseWriter, r *http.Request) (interface{}, error) {
+			release, err := s.fairness.Acquire(r.Context())
+			if err != nil {
+				return nil, err
+			}
+			defer release()
+			return handler(w, r, ss, s.unaryInterceptor())
+		}
+		if svr, ok := s.restSvr.(rest.ServiceRPCHandler); ok && sd.ServiceName != "" {
+			svr.ServiceRPCHandle(sd.ServiceName, method, path, f)
+			continue
+		}
+		s.restSvr.RPCHandle(method, path, f)
 	}
 }
 
@@ -122,6 +176,21 @@ func (s *server) ensureRegisterable(action string) bool {
 	return s.ensureRegisterableLocked(action)
 }
 
+func (s *server) ensureServiceRegisterable() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.ensureServiceRegisterableLocked()
+}
+
+// ensureServiceRegisterableLocked also admits a running server, since RPC
+// services are dispatched through a locked lookup.
+func (s *server) ensureServiceRegisterableLocked() bool {
+	if s.state == serverStateRunning {
+		return true
+	}
+	return s.ensureRegisterableLocked("service")
+}
+
 func (s *server) ensureRegisterableLocked(action string) bool {
 	if s.state == serverStateInit {
 		return true
@@ -230,13 +299,6 @@ func (s *server) appendRegisterErrorLocked(err error) {
 	s.registerErr = errors.Join(s.registerErr, err)
 }
 
-func (s *server) appendRestRouteLocked(method, path string) {
-	s.restRouterDesc = append(s.restRouterDesc, restRouterInfo{
-		Method: method,
-		Path:   path,
-	})
-}
-
 func registrationTypes(handlerType, ss interface{}) (reflect.Type, reflect.Type) {
 	return reflect.TypeOf(handlerType).Elem(), reflect.TypeOf(ss)
 }
@@ -0,0 +1,130 @@
+// Copyright 2022 The codesjoy Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"slices"
+	"strings"
+
+	"github.com/codesjoy/yggdrasil/v3/rpc/interceptor"
+	"github.com/codesjoy/yggdrasil/v3/rpc/interceptor/tuning"
+	"github.com/codesjoy/yggdrasil/v3/transport/gateway/rest"
+)
+
+// RouteTable lists the RPC methods and REST routes a server serves.
+type RouteTable struct {
+	Methods []MethodRoute `json:"methods"`
+	Rest    []RestRoute   `json:"rest"`
+	// RestConflicts lists the REST routes registered over earlier ones.
+	RestConflicts []rest.RouteConflict `json:"restConflicts,omitempty"`
+}
+
+// MethodRoute describes a registered RPC method and the options applied to
+// it.
+type MethodRoute struct {
+	// FullMethod is the method name, e.g. "/pkg.Service/Method".
+	FullMethod    string `json:"fullMethod"`
+	ServerStreams bool   `json:"serverStreams"`
+	ClientStreams bool   `json:"clientStreams"`
+	// Interceptors names the server interceptors applied to the method,
+	// outermost first. Interceptors switched off by tuning are left out.
+	Interceptors []string `json:"interceptors"`
+	// Timeout is the deadline applied to calls arriving without one.
+	Timeout string `json:"timeout,omitempty"`
+	// MaxRecvSize and MaxSendSize bound the message sizes of the method.
+	MaxRecvSize int `json:"maxRecvSize,omitempty"`
+	MaxSendSize int `json:"maxSendSize,omitempty"`
+}
+
+// RestRoute describes a registered REST route.
+type RestRoute struct {
+	Method string `json:"method"`
+	Path   string `json:"path"`
+	// Template is the path template of the HTTP rule, when generated code
+	// provides it.
+	Template string `json:"template,omitempty"`
+	// RPC is the full method bound to the route; raw handlers have none.
+	RPC string `json:"rpc,omitempty"`
+	// Interceptors names the server interceptors applied to the bound RPC.
+	Interceptors []string `json:"interceptors,omitempty"`
+}
+
+// Routes returns the RPC methods sorted by name and the REST routes in
+// registration order.
+func (s *server) Routes() RouteTable {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	table := RouteTable{Methods: []MethodRoute{}, Rest: []RestRoute{}}
+	chains := s.chains.Load()
+	if chains == nil {
+		chains = &interceptorChains{}
+	}
+	for serviceName, methods := range s.servicesDesc {
+		for _, method := range methods {
+			fullMethod := "/" + serviceName + "/" + method.MethodName
+			chain := chains.unaryChain
+			if method.ServerStreams || method.ClientStreams {
+				chain = chains.streamChain
+			}
+			route := MethodRoute{
+				FullMethod:    fullMethod,
+				ServerStreams: method.ServerStreams,
+				ClientStreams: method.ClientStreams,
+				Interceptors:  effectiveChain(chain, fullMethod),
+			}
+			if timeout, ok := matchDefaultTimeout(s.defaultTimeouts, fullMethod); ok {
+				route.Timeout = timeout.String()
+			}
+			if s.messageSizes != nil {
+				if limits, ok := matchMethodRule(s.messageSizes.rules, fullMethod); ok {
+					route.MaxRecvSize = limits.MaxRecv
+					route.MaxSendSize = limits.MaxSend
+				}
+			}
+			table.Methods = append(table.Methods, route)
+		}
+	}
+	slices.SortFunc(table.Methods, func(a, b MethodRoute) int {
+		return strings.Compare(a.FullMethod, b.FullMethod)
+	})
+	for _, info := range s.restRouterDesc {
+		route := RestRoute{
+			Method:   info.Method,
+			Path:     info.Path,
+			Template: info.Template,
+			RPC:      info.RPC,
+		}
+		if info.RPC != "" {
+			route.Interceptors = effectiveChain(chains.unaryChain, info.RPC)
+		}
+		table.Rest = append(table.Rest, route)
+	}
+	if svr, ok := s.restSvr.(interface{ Conflicts() []rest.RouteConflict }); ok {
+		table.RestConflicts = svr.Conflicts()
+	}
+	return table
+}
+
+// effectiveChain resolves the interceptor names of method, leaving out the
+// ones switched off by tuning.
+func effectiveChain(chain *interceptor.ChainResolver, method string) []string {
+	names := []string{}
+	for _, name := range chain.Resolve(method) {
+		if !tuning.Disabled(name, method) {
+			names = append(names, name)
+		}
+	}
+	return names
+}
@@ -16,8 +16,11 @@ package server
 
 import (
 	"fmt"
+	"reflect"
 
+	"github.com/codesjoy/yggdrasil/v3/rpc/interceptor"
 	"github.com/codesjoy/yggdrasil/v3/transport/gateway/rest"
+	"github.com/codesjoy/yggdrasil/v3/transport/runtime/server/fairness"
 	"github.com/codesjoy/yggdrasil/v3/transport/support/marshaler"
 )
 
@@ -27,14 +30,21 @@ func newServer(runtimeSnapshot Runtime) (Server, error) {
 	restCfg := runtimeSnapshot.RESTConfig()
 	opts := []rest.Option{
 		rest.WithMiddlewareProviders(runtimeSnapshot.RESTMiddlewareProviders()),
+		rest.WithPropagator(runtimeSnapshot.TracePropagator()),
 	}
 	s := &server{
-		services:       map[string]*ServiceInfo{},
-		servicesDesc:   map[string][]methodInfo{},
-		restRouterDesc: []restRouterInfo{},
-		stats:          statsHandler,
-		runtime:        runtimeSnapshot,
+		services:        map[string]*ServiceInfo{},
+		servicesDesc:    map[string][]methodInfo{},
+		restRouterDesc:  []restRouterInfo{},
+		stats:           statsHandler,
+		defaultTimeouts: cfg.DefaultTimeouts,
+		fairness:        fairness.New(cfg.Fairness),
+		messageSizes:    newMessageSizeGuard(cfg.MessageSizes, statsHandler),
+		runtime:         runtimeSnapshot,
 	}
+	s.ResizeHandlerPool(cfg.HandlerPool)
+	s.ConfigureLoadReport(cfg.LoadReport)
+	s.ConfigureDegradation(cfg.Degradation)
 	if cfg.RestEnabled {
 		s.restEnable = true
 		var err error
@@ -59,17 +69,80 @@ func newServer(runtimeSnapshot Runtime) (Server, error) {
 	if err := s.initRemoteServer(); err != nil {
 		return nil, err
 	}
+	if cfg.Reflection {
+		s.RegisterService(&ReflectionServiceDesc, NewReflectionService(s))
+	}
 	return s, nil
 }
 
+// interceptorChains holds the interceptor chains of a server. It is swapped
+// as a whole when a reload changes the configured chains.
+type interceptorChains struct {
+	settings    InterceptorSettings
+	unary       interceptor.UnaryServerInterceptor
+	stream      interceptor.StreamServerInterceptor
+	unaryChain  *interceptor.ChainResolver
+	streamChain *interceptor.ChainResolver
+}
+
 func (s *server) initInterceptor() {
-	cfg := s.runtime.ServerSettings()
-	unaryNames := append([]string(nil), cfg.Interceptors.Unary...)
-	unaryNames = dedupStableStrings(unaryNames)
-	s.unaryInterceptor = s.runtime.BuildUnaryServerInterceptor(unaryNames)
-	streamNames := append([]string(nil), cfg.Interceptors.Stream...)
-	streamNames = dedupStableStrings(streamNames)
-	s.streamInterceptor = s.runtime.BuildStreamServerInterceptor(streamNames)
+	s.chains.Store(buildInterceptorChains(s.runtime))
+}
+
+// ConfigureInterceptors rebuilds the interceptor chains of a running server
+// from runtime when its configured names or rules changed, so interceptors
+// can be added or removed without a restart. RPCs in flight finish with the
+// chain they started with. Unchanged chains are kept, along with the state
+// of their interceptors.
+func (s *server) ConfigureInterceptors(runtime Runtime) {
+	if current := s.chains.Load(); current != nil &&
+		reflect.DeepEqual(current.settings, runtime.ServerSettings().Interceptors) {
+		return
+	}
+	s.chains.Store(buildInterceptorChains(runtime))
+}
+
+func (s *server) unaryInterceptor() interceptor.UnaryServerInterceptor {
+	if chains := s.chains.Load(); chains != nil {
+		return chains.unary
+	}
+	return nil
+}
+
+func (s *server) streamInterceptor() interceptor.StreamServerInterceptor {
+	if chains := s.chains.Load(); chains != nil {
+		return chains.stream
+	}
+	return nil
+}
+
+func buildInterceptorChains(runtime Runtime) *interceptorChains {
+	cfg := runtime.ServerSettings().Interceptors
+	c := &interceptorChains{
+		settings:    cfg,
+		unaryChain:  interceptor.NewChainResolver(cfg.Unary, cfg.Rules),
+		streamChain: interceptor.NewChainResolver(cfg.Stream, cfg.Rules),
+	}
+	if len(cfg.Rules) > 0 {
+		c.unary = interceptor.ScopedUnaryServerInterceptor(
+			c.unaryChain,
+			runtime.BuildUnaryServerInterceptor,
+		)
+		c.stream = interceptor.ScopedStreamServerInterceptor(
+			c.streamChain,
+			runtime.BuildStreamServerInterceptor,
+		)
+	} else {
+		unaryNames := append([]string(nil), cfg.Unary...)
+		unaryNames = dedupStableStrings(unaryNames)
+		c.unary = runtime.BuildUnaryServerInterceptor(unaryNames)
+		streamNames := append([]string(nil), cfg.Stream...)
+		streamNames = dedupStableStrings(streamNames)
+		c.stream = runtime.BuildStreamServerInterceptor(streamNames)
+	}
+	c.unary = mapUnaryErrors(c.unary)
+	c.stream = mapStreamErrors(c.stream)
+	return c
 }
 
 func (s *server) initRemoteServer() error {
@@ -18,12 +18,20 @@ package server
 import (
 	"errors"
 	"sync"
+	"sync/atomic"
+	"time"
 
+	"github.com/codesjoy/yggdrasil/v3/internal/xpool"
 	"github.com/codesjoy/yggdrasil/v3/observability/stats"
 	"github.com/codesjoy/yggdrasil/v3/rpc/interceptor"
 	remote "github.com/codesjoy/yggdrasil/v3/transport"
 	"github.com/codesjoy/yggdrasil/v3/transport/gateway/rest"
+	"github.com/codesjoy/yggdrasil/v3/transport/runtime/server/fairness"
 	"github.com/codesjoy/yggdrasil/v3/transport/support/marshaler"
+	"github.com/codesjoy/yggdrasil/v3/transport/support/orca"
+	"github.com/codesjoy/yggdrasil/v3/transport/support/portmux"
+
+	"go.opentelemetry.io/otel/propagation"
 )
 
 const (
@@ -40,20 +48,30 @@ type serverInfo struct {
 }
 
 type server struct {
-	mu                sync.RWMutex
-	services          map[string]*ServiceInfo // service name -> service serverInfo
-	servicesDesc      map[string][]methodInfo
-	restRouterDesc    []restRouterInfo
-	unaryInterceptor  interceptor.UnaryServerInterceptor
-	streamInterceptor interceptor.StreamServerInterceptor
-	servers           []remote.Server
-	state             int
-	serverWG          sync.WaitGroup
-	stats             stats.Handler
+	mu              sync.RWMutex
+	services        map[string]*ServiceInfo // service name -> service serverInfo
+	servicesDesc    map[string][]methodInfo
+	restRouterDesc  []restRouterInfo
+	chains          atomic.Pointer[interceptorChains]
+	servers         []remote.Server
+	state           int
+	serverWG        sync.WaitGroup
+	stats           stats.Handler
+	defaultTimeouts map[string]time.Duration
+	fairness        *fairness.Controller
+	handlers        atomic.Pointer[xpool.Pool]
+	handlersMu      sync.Mutex
+	loadRecorder    atomic.Pointer[orca.Recorder]
+	messageSizes    *messageSizeGuard
+	endpointMD      map[string]map[string]string
 
 	restSvr    rest.Server
 	restEnable bool
 
+	listeners      []listenerBinding
+	muxes          []*portmux.Mux
+	extraEndpoints []Endpoint
+
 	registerErr error
 
 	runtime Runtime
@@ -65,6 +83,7 @@ type Runtime interface {
 	ServerStatsHandler() stats.Handler
 	RESTConfig() *rest.Config
 	RESTMiddlewareProviders() map[string]rest.Provider
+	TracePropagator() propagation.TextMapPropagator
 	MarshalerBuilders() map[string]marshaler.MarshalerBuilder
 	BuildUnaryServerInterceptor(names []string) interceptor.UnaryServerInterceptor
 	BuildStreamServerInterceptor(names []string) interceptor.StreamServerInterceptor
@@ -46,13 +46,14 @@ func TestServerProcessUnaryRPC(t *testing.T) {
 
 	t.Run("success propagates metadata and interceptor", func(t *testing.T) {
 		var interceptorCalled bool
-		s := &server{
-			unaryInterceptor: func(ctx context.Context, req interface{}, info *interceptor.UnaryServerInfo, handler interceptor.UnaryHandler) (interface{}, error) {
+		s := &server{}
+		s.chains.Store(&interceptorChains{
+			unary: func(ctx context.Context, req interface{}, info *interceptor.UnaryServerInfo, handler interceptor.UnaryHandler) (interface{}, error) {
 				interceptorCalled = true
 				require.Equal(t, "/svc/Unary", info.FullMethod)
 				return handler(ctx, req)
 			},
-		}
+		})
 		ss := &testServerStream{method: "/svc/Unary"}
 		desc := &MethodDesc{
 			MethodName: "Unary",
@@ -86,12 +87,13 @@ func TestServerProcessUnaryRPC(t *testing.T) {
 func TestServerProcessStreamRPC(t *testing.T) {
 	t.Run("start error finishes with error", func(t *testing.T) {
 		ss := &testServerStream{startErr: errors.New("start failed")}
-		s := &server{
-			streamInterceptor: func(srv interface{}, ss stream.ServerStream, info *interceptor.StreamServerInfo, handler stream.Handler) error {
+		s := &server{}
+		s.chains.Store(&interceptorChains{
+			stream: func(srv interface{}, ss stream.ServerStream, info *interceptor.StreamServerInfo, handler stream.Handler) error {
 				t.Fatal("interceptor should not be called")
 				return nil
 			},
-		}
+		})
 		s.processStreamRPC(&stream.Desc{
 			StreamName:    "Stream",
 			ClientStreams: true,
@@ -107,15 +109,16 @@ func TestServerProcessStreamRPC(t *testing.T) {
 		var interceptorCalled bool
 		var handlerCalled bool
 		ss := &testServerStream{method: "/svc/Stream"}
-		s := &server{
-			streamInterceptor: func(srv interface{}, ss stream.ServerStream, info *interceptor.StreamServerInfo, handler stream.Handler) error {
+		s := &server{}
+		s.chains.Store(&interceptorChains{
+			stream: func(srv interface{}, ss stream.ServerStream, info *interceptor.StreamServerInfo, handler stream.Handler) error {
 				interceptorCalled = true
 				require.Equal(t, "/svc/Stream", info.FullMethod)
 				require.True(t, info.IsClientStream)
 				require.True(t, info.IsServerStream)
 				return handler(srv, ss)
 			},
-		}
+		})
 		s.processStreamRPC(&stream.Desc{
 			StreamName:    "Stream",
 			ClientStreams: true,
@@ -165,10 +168,12 @@ func TestServerHandleStreamDispatch(t *testing.T) {
 					},
 				},
 			},
-			streamInterceptor: func(srv interface{}, ss stream.ServerStream, info *interceptor.StreamServerInfo, handler stream.Handler) error {
+		}
+		s.chains.Store(&interceptorChains{
+			stream: func(srv interface{}, ss stream.ServerStream, info *interceptor.StreamServerInfo, handler stream.Handler) error {
 				return handler(srv, ss)
 			},
-		}
+		})
 
 		s.handleStream(&testServerStream{method: "/svc/Unary"})
 		s.handleStream(&testServerStream{method: "/svc/Stream"})
@@ -277,6 +282,7 @@ func TestHandleStreamConcurrentWithLateRegister(t *testing.T) {
 	_, exists := s.services["late.service"]
 	registerErr := s.registerErr
 	s.mu.RUnlock()
-	assert.False(t, exists)
+	// The first registration wins; the others are rejected as duplicates.
+	assert.True(t, exists)
 	assert.Error(t, registerErr)
 }
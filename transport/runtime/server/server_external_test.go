@@ -19,6 +19,7 @@ import (
 	"testing"
 
 	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/propagation"
 
 	"github.com/codesjoy/yggdrasil/v3/observability/stats"
 	"github.com/codesjoy/yggdrasil/v3/rpc/interceptor"
@@ -40,6 +41,10 @@ func (externalServerRuntime) RESTMiddlewareProviders() map[string]rest.Provider
 	return map[string]rest.Provider{}
 }
 
+func (externalServerRuntime) TracePropagator() propagation.TextMapPropagator {
+	return nil
+}
+
 func (externalServerRuntime) MarshalerBuilders() map[string]marshaler.MarshalerBuilder {
 	return map[string]marshaler.MarshalerBuilder{}
 }
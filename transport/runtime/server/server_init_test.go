@@ -135,12 +135,94 @@ func TestInitInterceptorDedupsConfiguredNames(t *testing.T) {
 	s.runtime = runtime
 	s.initInterceptor()
 
-	require.NotNil(t, s.unaryInterceptor)
-	require.NotNil(t, s.streamInterceptor)
+	require.NotNil(t, s.unaryInterceptor())
+	require.NotNil(t, s.streamInterceptor())
 	require.Equal(t, int32(1), atomic.LoadInt32(&unaryBuildCalls))
 	require.Equal(t, int32(1), atomic.LoadInt32(&streamBuildCalls))
 }
 
+func TestInitInterceptorAppliesRules(t *testing.T) {
+	var seen []string
+	runtime := newTestRuntime()
+	runtime.settings.Interceptors = InterceptorSettings{
+		Unary: []string{"server-rule-unary"},
+		Rules: []interceptor.ChainRule{{
+			Methods: []string{"/grpc.health.v1.Health/*"},
+			Remove:  []string{"server-rule-unary"},
+		}},
+	}
+	runtime.unaryProviders["server-rule-unary"] = interceptor.NewUnaryServerInterceptorProvider(
+		"server-rule-unary",
+		func() interceptor.UnaryServerInterceptor {
+			return func(ctx context.Context, req interface{}, info *interceptor.UnaryServerInfo, handler interceptor.UnaryHandler) (interface{}, error) {
+				seen = append(seen, info.FullMethod)
+				return handler(ctx, req)
+			}
+		},
+	)
+
+	s := newTestServer()
+	s.runtime = runtime
+	s.initInterceptor()
+
+	handler := func(context.Context, interface{}) (interface{}, error) { return nil, nil }
+	for _, method := range []string{"/grpc.health.v1.Health/Check", "/svc.v1.Svc/Get"} {
+		_, err := s.unaryInterceptor()(
+			context.Background(),
+			nil,
+			&interceptor.UnaryServerInfo{FullMethod: method},
+			handler,
+		)
+		require.NoError(t, err)
+	}
+	require.Equal(t, []string{"/svc.v1.Svc/Get"}, seen)
+}
+
+func TestConfigureInterceptorsSwapsChangedChains(t *testing.T) {
+	var builds, calls int32
+	runtime := newTestRuntime()
+	runtime.unaryProviders["server-swap-unary"] = interceptor.NewUnaryServerInterceptorProvider(
+		"server-swap-unary",
+		func() interceptor.UnaryServerInterceptor {
+			atomic.AddInt32(&builds, 1)
+			return func(ctx context.Context, req interface{}, info *interceptor.UnaryServerInfo, handler interceptor.UnaryHandler) (interface{}, error) {
+				atomic.AddInt32(&calls, 1)
+				return handler(ctx, req)
+			}
+		},
+	)
+
+	s := newTestServer()
+	s.runtime = runtime
+	s.initInterceptor()
+
+	invoke := func() {
+		_, err := s.unaryInterceptor()(
+			context.Background(),
+			nil,
+			&interceptor.UnaryServerInfo{FullMethod: "/svc.v1.Svc/Get"},
+			func(context.Context, interface{}) (interface{}, error) { return nil, nil },
+		)
+		require.NoError(t, err)
+	}
+	invoke()
+	require.Equal(t, int32(0), atomic.LoadInt32(&calls))
+
+	runtime.settings.Interceptors = InterceptorSettings{Unary: []string{"server-swap-unary"}}
+	s.ConfigureInterceptors(runtime)
+	invoke()
+	require.Equal(t, int32(1), atomic.LoadInt32(&calls))
+	require.Equal(t, int32(1), atomic.LoadInt32(&builds))
+
+	s.ConfigureInterceptors(runtime)
+	require.Equal(t, int32(1), atomic.LoadInt32(&builds))
+
+	runtime.settings.Interceptors = InterceptorSettings{}
+	s.ConfigureInterceptors(runtime)
+	invoke()
+	require.Equal(t, int32(1), atomic.LoadInt32(&calls))
+}
+
 func TestNewTwiceDoesNotPanic(t *testing.T) {
 	assert.NotPanics(t, func() {
 		first, err := New(newTestRuntime())
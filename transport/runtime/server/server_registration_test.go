@@ -21,8 +21,10 @@ import (
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"google.golang.org/genproto/googleapis/rpc/code"
 
 	"github.com/codesjoy/yggdrasil/v3/rpc/interceptor"
+	"github.com/codesjoy/yggdrasil/v3/rpc/status"
 	"github.com/codesjoy/yggdrasil/v3/rpc/stream"
 )
 
@@ -323,14 +325,81 @@ func TestRegisterRejectedWhenServerNotInit(t *testing.T) {
 
 			s.mu.RLock()
 			defer s.mu.RUnlock()
-			assert.Empty(t, s.services)
-			assert.Empty(t, s.servicesDesc)
+			if tt.state == serverStateRunning {
+				// RPC services may still be added to a running server.
+				assert.Contains(t, s.services, "late.service")
+			} else {
+				assert.Empty(t, s.services)
+				assert.Empty(t, s.servicesDesc)
+			}
 			assert.Empty(t, s.restRouterDesc)
 			assert.Error(t, s.registerErr)
 		})
 	}
 }
 
+func TestRegisterAndUnregisterServiceWhileRunning(t *testing.T) {
+	s := newTestServer()
+	s.initInterceptor()
+	s.state = serverStateRunning
+	desc := &ServiceDesc{
+		ServiceName: "plugin.Service",
+		HandlerType: (*TestService)(nil),
+		Methods: []MethodDesc{{
+			MethodName: "Get",
+			Handler: func(_ interface{}, _ context.Context, _ func(interface{}) error, _ interceptor.UnaryServerInterceptor) (interface{}, error) {
+				return "ok", nil
+			},
+		}},
+	}
+
+	s.RegisterService(desc, &TestServiceImpl{})
+	assert.Equal(t, []string{"plugin.Service"}, s.ServiceNames())
+	assert.Contains(t, s.serviceDescSnapshot(), "plugin.Service")
+	ss := &testServerStream{method: "/plugin.Service/Get"}
+	s.handleStream(ss)
+	assert.NoError(t, ss.finishErr)
+	assert.Equal(t, "ok", ss.finishReply)
+
+	assert.True(t, s.UnregisterService("plugin.Service"))
+	assert.False(t, s.UnregisterService("plugin.Service"))
+	assert.Empty(t, s.ServiceNames())
+	assert.NotContains(t, s.serviceDescSnapshot(), "plugin.Service")
+	ss = &testServerStream{method: "/plugin.Service/Get"}
+	s.handleStream(ss)
+	assert.Equal(t, code.Code_UNIMPLEMENTED, status.FromError(ss.finishErr).Code())
+
+	s.RegisterService(desc, &TestServiceImpl{})
+	s.state = serverStateClosing
+	assert.False(t, s.UnregisterService("plugin.Service"))
+}
+
+func TestRegisterRestWithServiceName(t *testing.T) {
+	s, collector := newRestRegistrationServer()
+	restDesc := &RestServiceDesc{
+		ServiceName: "test.Service",
+		HandlerType: (*TestService)(nil),
+		Methods: []RestMethodDesc{
+			{
+				Method: http.MethodPost,
+				Path:   "/items",
+				Handler: func(http.ResponseWriter, *http.Request, interface{},
+					interceptor.UnaryServerInterceptor,
+				) (interface{}, error) {
+					return "ok", nil
+				},
+			},
+		},
+	}
+
+	s.registerRest(restDesc, &TestServiceImpl{})
+	require.Equal(
+		t,
+		[]rpcHandleCall{{service: "test.Service", method: http.MethodPost, path: "/items"}},
+		collector.rpcHandles,
+	)
+}
+
 func newRestRegistrationServer() (*server, *testRestCollector) {
 	collector := &testRestCollector{}
 	s := newTestServer()
@@ -64,6 +64,27 @@ func TestServerInfoAndEndpoints(t *testing.T) {
 	require.Equal(t, EndpointKindRest, endpoints[1].Kind())
 }
 
+func TestEndpointsOverlayConfiguredMetadata(t *testing.T) {
+	s := newTestServer()
+	s.endpointMD = map[string]map[string]string{
+		AnyProtocol: {"zone": "z1", "weight": "1"},
+		"grpc":      {"weight": "10"},
+	}
+	attrs := map[string]string{"k": "v"}
+	s.servers = []remote.Server{
+		&testRemoteServer{info: remote.ServerInfo{Protocol: "grpc", Attributes: attrs}},
+	}
+	s.restEnable = true
+	s.restSvr = &mockRestServer{}
+
+	endpoints := s.Endpoints()
+	require.Len(t, endpoints, 2)
+	require.Equal(t, map[string]string{"k": "v", "zone": "z1", "weight": "10"},
+		endpoints[0].Metadata())
+	require.Equal(t, map[string]string{"zone": "z1", "weight": "1"}, endpoints[1].Metadata())
+	require.Equal(t, map[string]string{"k": "v"}, attrs)
+}
+
 func TestStateNameAndRuntimeErrorReporting(t *testing.T) {
 	s := newTestServer()
 
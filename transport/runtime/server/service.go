@@ -61,6 +61,9 @@ type RestMethodHandler func(w http.ResponseWriter, r *http.Request, srv interfac
 
 // RestServiceDesc represents a REST service's specification.
 type RestServiceDesc struct {
+	// ServiceName is the fully-qualified proto service name; it selects the
+	// per-service REST settings.
+	ServiceName string
 	HandlerType interface{}
 	Methods     []RestMethodDesc
 }
@@ -70,11 +73,18 @@ type RestMethodDesc struct {
 	Method  string
 	Path    string
 	Handler RestMethodHandler
+	// RPC is the full method bound to the route, e.g. "/pkg.Service/Method".
+	RPC string
+	// Template is the path template of the HTTP rule the route was generated
+	// from, before its variables were rewritten into Path.
+	Template string
 }
 
 type restRouterInfo struct {
-	Method string `json:"method"`
-	Path   string `json:"path"`
+	Method   string `json:"method"`
+	Path     string `json:"path"`
+	Template string `json:"template,omitempty"`
+	RPC      string `json:"rpc,omitempty"`
 }
 
 // RestRawHandlerDesc represents a raw REST handler specification.
@@ -14,15 +14,57 @@
 
 package server
 
+import (
+	"time"
+
+	"github.com/codesjoy/yggdrasil/v3/degrade"
+	"github.com/codesjoy/yggdrasil/v3/rpc/interceptor"
+	"github.com/codesjoy/yggdrasil/v3/transport/runtime/server/fairness"
+	"github.com/codesjoy/yggdrasil/v3/transport/support/orca"
+)
+
+// AnyProtocol selects every endpoint in protocol-keyed settings.
+const AnyProtocol = "*"
+
 // InterceptorSettings contains interceptor names for the server side.
 type InterceptorSettings struct {
 	Unary  []string `mapstructure:"unary"`
 	Stream []string `mapstructure:"stream"`
+	// Rules adjust the unary and stream chains per service or method.
+	Rules []interceptor.ChainRule `mapstructure:"rules"`
 }
 
 // Settings contains resolved server settings.
 type Settings struct {
 	Transports   []string            `mapstructure:"transports"`
 	Interceptors InterceptorSettings `mapstructure:"interceptors"`
-	RestEnabled  bool
+	// DefaultTimeouts maps full-method names or glob patterns such as
+	// "/pkg.Service/*" to the deadline enforced when the caller sent none.
+	DefaultTimeouts map[string]time.Duration `mapstructure:"default_timeouts"`
+	// MessageSizes bounds the message sizes per full-method name or glob
+	// pattern, "*" matching every method.
+	MessageSizes map[string]MessageSizeSettings `mapstructure:"message_sizes"`
+	// Listeners are additional addresses served next to the transports'
+	// own listeners.
+	Listeners []ListenerSettings `mapstructure:"listeners"`
+	// EndpointMetadata is published with the server endpoints, e.g. zone,
+	// canary or weight. Keys are endpoint protocols such as "grpc" or "http",
+	// or AnyProtocol for every endpoint; protocol entries win.
+	EndpointMetadata map[string]map[string]string `mapstructure:"endpoint_metadata"`
+	// Fairness enforces per-caller quotas and fair queueing when overloaded.
+	Fairness fairness.Config `mapstructure:"fairness"`
+	// HandlerPool bounds the stream handlers running at once, so load
+	// beyond Workers running and QueueSize queued streams is rejected with
+	// RESOURCE_EXHAUSTED. Zero workers leaves them unbounded.
+	HandlerPool HandlerPoolSettings `mapstructure:"handler_pool"`
+	// LoadReport attaches the server utilization to response trailers for
+	// utilization-aware client balancers such as least_loaded.
+	LoadReport orca.Config `mapstructure:"load_report"`
+	// Degradation derives the process degradation level from the server
+	// load, shedding the registered degradable features in level order.
+	Degradation degrade.Config `mapstructure:"degradation"`
+	// Reflection serves grpc.reflection.v1.ServerReflection, so tools such as
+	// yggctl and grpcurl can call the services without their proto files.
+	Reflection  bool `mapstructure:"reflection"`
+	RestEnabled bool
 }
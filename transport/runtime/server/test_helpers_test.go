@@ -21,6 +21,7 @@ import (
 	"time"
 
 	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/propagation"
 
 	"github.com/codesjoy/yggdrasil/v3/observability/stats"
 	"github.com/codesjoy/yggdrasil/v3/rpc/interceptor"
@@ -88,6 +89,10 @@ func (r *testRuntime) RESTMiddlewareProviders() map[string]rest.Provider {
 	return r.restProviders
 }
 
+func (r *testRuntime) TracePropagator() propagation.TextMapPropagator {
+	return nil
+}
+
 func (r *testRuntime) MarshalerBuilders() map[string]marshaler.MarshalerBuilder {
 	if r == nil {
 		return map[string]marshaler.MarshalerBuilder{}
@@ -138,8 +143,9 @@ func (m *mockRestServer) GetAddress() string                         { return m.
 func (m *mockRestServer) GetAttributes() map[string]string           { return m.attr }
 
 type rpcHandleCall struct {
-	method string
-	path   string
+	service string
+	method  string
+	path    string
 }
 
 type rawHandleCall struct {
@@ -157,6 +163,13 @@ func (c *testRestCollector) RPCHandle(method, path string, _ rest.HandlerFunc) {
 	c.rpcHandles = append(c.rpcHandles, rpcHandleCall{method: method, path: path})
 }
 
+func (c *testRestCollector) ServiceRPCHandle(service, method, path string, _ rest.HandlerFunc) {
+	c.rpcHandles = append(
+		c.rpcHandles,
+		rpcHandleCall{service: service, method: method, path: path},
+	)
+}
+
 func (c *testRestCollector) RawHandle(method, path string, _ http.HandlerFunc) {
 	c.rawHandles = append(c.rawHandles, rawHandleCall{method: method, path: path})
 }
@@ -0,0 +1,86 @@
+// Copyright 2022 The codesjoy Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"context"
+	"path"
+	"strings"
+	"time"
+
+	remote "github.com/codesjoy/yggdrasil/v3/transport"
+)
+
+// matchDefaultTimeout returns the default timeout configured for method.
+func matchDefaultTimeout(rules map[string]time.Duration, method string) (time.Duration, bool) {
+	timeout, ok := matchMethodRule(rules, method)
+	return timeout, ok && timeout > 0
+}
+
+// matchMethodRule returns the rule configured for method.
+//
+// An exact full-method key wins; otherwise the longest matching glob pattern
+// (path.Match syntax, e.g. "/pkg.Service/*") is used, and "*" matches any
+// method as the final fallback.
+func matchMethodRule[V any](rules map[string]V, method string) (V, bool) {
+	if rule, ok := rules[method]; ok {
+		return rule, true
+	}
+	var (
+		best  string
+		rule  V
+		found bool
+	)
+	for pattern, value := range rules {
+		if pattern == "*" || !strings.ContainsAny(pattern, "*?[") {
+			continue
+		}
+		if ok, err := path.Match(pattern, method); err != nil || !ok {
+			continue
+		}
+		if !found || len(pattern) > len(best) || (len(pattern) == len(best) && pattern < best) {
+			best, rule, found = pattern, value, true
+		}
+	}
+	if !found {
+		rule, found = rules["*"]
+	}
+	return rule, found
+}
+
+// withDefaultDeadline applies the configured default timeout when the caller
+// did not propagate a deadline.
+func (s *server) withDefaultDeadline(
+	ctx context.Context,
+	method string,
+) (context.Context, context.CancelFunc) {
+	if _, ok := ctx.Deadline(); ok {
+		return ctx, func() {}
+	}
+	timeout, ok := matchDefaultTimeout(s.defaultTimeouts, method)
+	if !ok {
+		return ctx, func() {}
+	}
+	return context.WithTimeout(ctx, timeout)
+}
+
+type deadlineServerStream struct {
+	remote.ServerStream
+	ctx context.Context
+}
+
+func (ss *deadlineServerStream) Context() context.Context {
+	return ss.ctx
+}
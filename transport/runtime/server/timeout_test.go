@@ -0,0 +1,113 @@
+// Copyright 2022 The codesjoy Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/codesjoy/yggdrasil/v3/rpc/interceptor"
+	"github.com/codesjoy/yggdrasil/v3/rpc/stream"
+)
+
+func TestMatchDefaultTimeout(t *testing.T) {
+	rules := map[string]time.Duration{
+		"*":               5 * time.Second,
+		"/pkg.Svc/*":      2 * time.Second,
+		"/pkg.Svc/Get*":   time.Second,
+		"/pkg.Svc/Delete": 3 * time.Second,
+		"/pkg.Svc/NoOp":   0,
+	}
+	cases := []struct {
+		method string
+		want   time.Duration
+		ok     bool
+	}{
+		{"/pkg.Svc/Delete", 3 * time.Second, true},
+		{"/pkg.Svc/GetUser", time.Second, true},
+		{"/pkg.Svc/List", 2 * time.Second, true},
+		{"/other.Svc/List", 5 * time.Second, true},
+		{"/pkg.Svc/NoOp", 0, false},
+	}
+	for _, tc := range cases {
+		got, ok := matchDefaultTimeout(rules, tc.method)
+		assert.Equal(t, tc.ok, ok, tc.method)
+		assert.Equal(t, tc.want, got, tc.method)
+	}
+
+	_, ok := matchDefaultTimeout(nil, "/pkg.Svc/List")
+	assert.False(t, ok)
+}
+
+func TestServerDefaultDeadline(t *testing.T) {
+	t.Run("unary gets default deadline", func(t *testing.T) {
+		s := &server{defaultTimeouts: map[string]time.Duration{"/svc/*": time.Minute}}
+		ss := &testServerStream{method: "/svc/Unary"}
+		var hasDeadline bool
+		s.processUnaryRPC(&MethodDesc{
+			MethodName: "Unary",
+			Handler: func(_ interface{}, ctx context.Context, _ func(interface{}) error, _ interceptor.UnaryServerInterceptor) (interface{}, error) {
+				_, hasDeadline = ctx.Deadline()
+				return "reply", nil
+			},
+		}, &ServiceInfo{ServiceImpl: &TestServiceImpl{}}, ss)
+		require.NoError(t, ss.finishErr)
+		assert.True(t, hasDeadline)
+	})
+
+	t.Run("caller deadline is kept", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Hour)
+		defer cancel()
+		want, _ := ctx.Deadline()
+		s := &server{defaultTimeouts: map[string]time.Duration{"*": time.Second}}
+		ss := &testServerStream{method: "/svc/Unary", ctx: ctx}
+		var got time.Time
+		s.processUnaryRPC(&MethodDesc{
+			MethodName: "Unary",
+			Handler: func(_ interface{}, ctx context.Context, _ func(interface{}) error, _ interceptor.UnaryServerInterceptor) (interface{}, error) {
+				got, _ = ctx.Deadline()
+				return nil, nil
+			},
+		}, &ServiceInfo{ServiceImpl: &TestServiceImpl{}}, ss)
+		assert.Equal(t, want, got)
+	})
+
+	t.Run("stream gets default deadline", func(t *testing.T) {
+		s := &server{
+			defaultTimeouts: map[string]time.Duration{"/svc/Stream": time.Minute},
+		}
+		s.chains.Store(&interceptorChains{
+			stream: func(srv interface{}, ss stream.ServerStream, _ *interceptor.StreamServerInfo, handler stream.Handler) error {
+				return handler(srv, ss)
+			},
+		})
+		ss := &testServerStream{method: "/svc/Stream"}
+		var hasDeadline bool
+		s.processStreamRPC(&stream.Desc{
+			StreamName:    "Stream",
+			ServerStreams: true,
+			Handler: func(_ interface{}, ss stream.ServerStream) error {
+				_, hasDeadline = ss.Context().Deadline()
+				return nil
+			},
+		}, &ServiceInfo{ServiceImpl: &TestServiceImpl{}}, ss)
+		require.NoError(t, ss.finishErr)
+		assert.True(t, hasDeadline)
+	})
+}
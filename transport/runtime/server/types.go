@@ -27,10 +27,17 @@ type Endpoint interface {
 }
 
 // Server is the interface that wraps the Serve method.
+//
+// RPC services may be registered and unregistered while the server is
+// running; REST services and raw handlers must be registered before Serve.
 type Server interface {
 	RegisterService(sd *ServiceDesc, ss interface{})
+	UnregisterService(serviceName string) bool
+	ServiceNames() []string
 	RegisterRestService(sd *RestServiceDesc, ss interface{}, prefix ...string)
 	RegisterRestRawHandlers(sd ...*RestRawHandlerDesc)
+	// Routes lists the registered RPC methods and REST routes.
+	Routes() RouteTable
 	Serve(startFlag chan<- struct{}) error
 	Stop(context.Context) error
 	Endpoints() []Endpoint
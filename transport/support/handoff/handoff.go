@@ -0,0 +1,241 @@
+// Copyright 2022 The codesjoy Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package handoff provides listener handoff between an old and a new process
+// so a binary can be upgraded without dropping connections.
+//
+// Transports obtain their listeners through Listen. When the process was
+// started by Upgrade, listeners for the same network and address are taken
+// over from the parent instead of binding new sockets. The new process calls
+// Ready once it serves traffic, after which the parent shuts down gracefully.
+package handoff
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const (
+	// EnvListeners lists the inherited listeners as comma-separated
+	// "network|address" items, in the order of the inherited file descriptors.
+	EnvListeners = "YGGDRASIL_HANDOFF_LISTENERS"
+	// EnvReadyFD is the file descriptor the child writes to once it is ready.
+	EnvReadyFD = "YGGDRASIL_HANDOFF_READY_FD"
+
+	// firstInheritedFD is the first descriptor after stdin, stdout and stderr.
+	firstInheritedFD = 3
+)
+
+// ErrUpgradeInProgress is returned when Upgrade is called concurrently.
+var ErrUpgradeInProgress = errors.New("handoff: upgrade already in progress")
+
+type filer interface {
+	File() (*os.File, error)
+}
+
+// Upgrader tracks the listeners of one process and hands them off to a new
+// process on Upgrade.
+type Upgrader struct {
+	mu        sync.Mutex
+	inherited map[string][]net.Listener
+	active    map[*trackedListener]struct{}
+	readyFile *os.File
+	upgrading bool
+}
+
+var (
+	defaultOnce     sync.Once
+	defaultUpgrader *Upgrader
+)
+
+// Default returns the process-wide upgrader initialized from the environment.
+func Default() *Upgrader {
+	defaultOnce.Do(func() {
+		defaultUpgrader = newFromEnv()
+	})
+	return defaultUpgrader
+}
+
+// Listen returns a listener from the process-wide upgrader.
+func Listen(ctx context.Context, network, address string) (net.Listener, error) {
+	return Default().Listen(ctx, network, address)
+}
+
+// Ready signals the parent process through the process-wide upgrader.
+func Ready() error {
+	return Default().Ready()
+}
+
+// IsChild reports whether this process was started by a handoff upgrade.
+func IsChild() bool {
+	return Default().IsChild()
+}
+
+func newUpgrader() *Upgrader {
+	return &Upgrader{
+		inherited: map[string][]net.Listener{},
+		active:    map[*trackedListener]struct{}{},
+	}
+}
+
+func newFromEnv() *Upgrader {
+	u := newUpgrader()
+	if raw := strings.TrimSpace(os.Getenv(EnvListeners)); raw != "" {
+		for i, key := range strings.Split(raw, ",") {
+			fd := uintptr(firstInheritedFD + i)
+			lis, err := fileListener(os.NewFile(fd, key))
+			if err != nil {
+				slog.Warn(
+					"fault to inherit listener",
+					slog.String("listener", key),
+					slog.Any("error", err),
+				)
+				continue
+			}
+			u.inherited[key] = append(u.inherited[key], lis)
+		}
+	}
+	if raw := strings.TrimSpace(os.Getenv(EnvReadyFD)); raw != "" {
+		if fd, err := strconv.Atoi(raw); err == nil {
+			u.readyFile = os.NewFile(uintptr(fd), "handoff-ready")
+		}
+	}
+	_ = os.Unsetenv(EnvListeners)
+	_ = os.Unsetenv(EnvReadyFD)
+	return u
+}
+
+func fileListener(f *os.File) (net.Listener, error) {
+	if f == nil {
+		return nil, errors.New("invalid file descriptor")
+	}
+	defer func() { _ = f.Close() }()
+	return net.FileListener(f)
+}
+
+func listenerKey(network, address string) string {
+	return network + "|" + address
+}
+
+// Listen returns the inherited listener for network and address if present,
+// otherwise it binds a new one. Returned listeners are tracked until closed
+// so they can be passed to the next process.
+func (u *Upgrader) Listen(ctx context.Context, network, address string) (net.Listener, error) {
+	key := listenerKey(network, address)
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	var lis net.Listener
+	if inherited := u.inherited[key]; len(inherited) > 0 {
+		lis = inherited[0]
+		if len(inherited) == 1 {
+			delete(u.inherited, key)
+		} else {
+			u.inherited[key] = inherited[1:]
+		}
+	} else {
+		var err error
+		lis, err = (&net.ListenConfig{}).Listen(ctx, network, address)
+		if err != nil {
+			return nil, err
+		}
+	}
+	tracked := &trackedListener{Listener: lis, owner: u, key: key}
+	u.active[tracked] = struct{}{}
+	return tracked, nil
+}
+
+// IsChild reports whether this upgrader was started by a handoff upgrade.
+func (u *Upgrader) IsChild() bool {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	return u.readyFile != nil
+}
+
+// Ready notifies the parent process that this process serves traffic and
+// closes inherited listeners that were not claimed. It is a no-op when the
+// process was not started by Upgrade.
+func (u *Upgrader) Ready() error {
+	u.mu.Lock()
+	readyFile := u.readyFile
+	u.readyFile = nil
+	unclaimed := u.inherited
+	u.inherited = map[string][]net.Listener{}
+	u.mu.Unlock()
+
+	for key, items := range unclaimed {
+		slog.Warn("close unclaimed inherited listener", slog.String("listener", key))
+		for _, lis := range items {
+			_ = lis.Close()
+		}
+	}
+	if readyFile == nil {
+		return nil
+	}
+	defer func() { _ = readyFile.Close() }()
+	if _, err := readyFile.Write([]byte{1}); err != nil {
+		return fmt.Errorf("handoff: notify parent: %w", err)
+	}
+	return nil
+}
+
+// files duplicates the descriptors of all active listeners.
+func (u *Upgrader) files() ([]string, []*os.File, error) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	keys := make([]string, 0, len(u.active))
+	files := make([]*os.File, 0, len(u.active))
+	for lis := range u.active {
+		f, ok := lis.Listener.(filer)
+		if !ok {
+			continue
+		}
+		file, err := f.File()
+		if err != nil {
+			closeFiles(files)
+			return nil, nil, fmt.Errorf("handoff: dup listener %s: %w", lis.key, err)
+		}
+		keys = append(keys, lis.key)
+		files = append(files, file)
+	}
+	return keys, files, nil
+}
+
+func closeFiles(files []*os.File) {
+	for _, f := range files {
+		_ = f.Close()
+	}
+}
+
+type trackedListener struct {
+	net.Listener
+	owner *Upgrader
+	key   string
+	once  sync.Once
+}
+
+func (l *trackedListener) Close() error {
+	l.once.Do(func() {
+		l.owner.mu.Lock()
+		delete(l.owner.active, l)
+		l.owner.mu.Unlock()
+	})
+	return l.Listener.Close()
+}
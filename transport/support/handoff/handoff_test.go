@@ -0,0 +1,93 @@
+// Copyright 2022 The codesjoy Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handoff
+
+import (
+	"context"
+	"net"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUpgraderListenTracksListeners(t *testing.T) {
+	u := newUpgrader()
+	lis, err := u.Listen(context.Background(), "tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	keys, files, err := u.files()
+	require.NoError(t, err)
+	closeFiles(files)
+	assert.Equal(t, []string{"tcp|127.0.0.1:0"}, keys)
+
+	require.NoError(t, lis.Close())
+	keys, files, err = u.files()
+	require.NoError(t, err)
+	assert.Empty(t, keys)
+	assert.Empty(t, files)
+}
+
+func TestUpgraderListenPrefersInherited(t *testing.T) {
+	parent := newUpgrader()
+	lis, err := parent.Listen(context.Background(), "tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer func() { _ = lis.Close() }()
+	_, files, err := parent.files()
+	require.NoError(t, err)
+	require.Len(t, files, 1)
+
+	inherited, err := fileListener(files[0])
+	require.NoError(t, err)
+	child := newUpgrader()
+	child.inherited["tcp|127.0.0.1:0"] = []net.Listener{inherited}
+
+	got, err := child.Listen(context.Background(), "tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer func() { _ = got.Close() }()
+	assert.Equal(t, lis.Addr().String(), got.Addr().String())
+	assert.Empty(t, child.inherited)
+}
+
+func TestUpgraderReady(t *testing.T) {
+	t.Run("not a child", func(t *testing.T) {
+		u := newUpgrader()
+		assert.False(t, u.IsChild())
+		require.NoError(t, u.Ready())
+	})
+
+	t.Run("notifies parent and closes unclaimed", func(t *testing.T) {
+		r, w, err := os.Pipe()
+		require.NoError(t, err)
+		defer func() { _ = r.Close() }()
+		unclaimed, err := net.Listen("tcp", "127.0.0.1:0")
+		require.NoError(t, err)
+
+		u := newUpgrader()
+		u.readyFile = w
+		u.inherited["tcp|unused"] = []net.Listener{unclaimed}
+		assert.True(t, u.IsChild())
+		require.NoError(t, u.Ready())
+
+		buf := make([]byte, 1)
+		n, err := r.Read(buf)
+		require.NoError(t, err)
+		assert.Equal(t, 1, n)
+		assert.False(t, u.IsChild())
+		_, err = unclaimed.Accept()
+		assert.Error(t, err)
+	})
+}
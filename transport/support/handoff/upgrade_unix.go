@@ -0,0 +1,117 @@
+// Copyright 2022 The codesjoy Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !windows
+
+package handoff
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+// Upgrade starts a new instance of the current executable that inherits all
+// active listeners and blocks until it calls Ready, exits, or ctx is done.
+// On success the caller should stop serving and exit; the listeners stay
+// open in the new process.
+func (u *Upgrader) Upgrade(ctx context.Context) error {
+	u.mu.Lock()
+	if u.upgrading {
+		u.mu.Unlock()
+		return ErrUpgradeInProgress
+	}
+	u.upgrading = true
+	u.mu.Unlock()
+	defer func() {
+		u.mu.Lock()
+		u.upgrading = false
+		u.mu.Unlock()
+	}()
+
+	executable, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("handoff: resolve executable: %w", err)
+	}
+	keys, files, err := u.files()
+	if err != nil {
+		return err
+	}
+	defer closeFiles(files)
+
+	readyR, readyW, err := os.Pipe()
+	if err != nil {
+		return fmt.Errorf("handoff: create ready pipe: %w", err)
+	}
+	defer func() { _ = readyR.Close() }()
+
+	cmd := exec.Command(executable, os.Args[1:]...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	cmd.ExtraFiles = append(append([]*os.File(nil), files...), readyW)
+	cmd.Env = append(
+		filterEnv(os.Environ()),
+		EnvListeners+"="+strings.Join(keys, ","),
+		EnvReadyFD+"="+strconv.Itoa(firstInheritedFD+len(files)),
+	)
+	err = cmd.Start()
+	_ = readyW.Close()
+	if err != nil {
+		return fmt.Errorf("handoff: start new process: %w", err)
+	}
+
+	readyCh := make(chan error, 1)
+	go func() {
+		buf := make([]byte, 1)
+		_, err := readyR.Read(buf)
+		if errors.Is(err, io.EOF) {
+			err = errors.New("handoff: new process exited before ready")
+		}
+		readyCh <- err
+	}()
+	select {
+	case err := <-readyCh:
+		if err != nil {
+			_ = cmd.Wait()
+			return err
+		}
+		return nil
+	case <-ctx.Done():
+		_ = cmd.Process.Kill()
+		_ = cmd.Wait()
+		return ctx.Err()
+	}
+}
+
+// Upgrade upgrades the process-wide upgrader.
+func Upgrade(ctx context.Context) error {
+	return Default().Upgrade(ctx)
+}
+
+func filterEnv(env []string) []string {
+	out := make([]string, 0, len(env))
+	for _, item := range env {
+		if strings.HasPrefix(item, EnvListeners+"=") || strings.HasPrefix(item, EnvReadyFD+"=") {
+			continue
+		}
+		out = append(out, item)
+	}
+	return out
+}
@@ -0,0 +1,35 @@
+// Copyright 2022 The codesjoy Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build windows
+
+package handoff
+
+import (
+	"context"
+	"errors"
+)
+
+// ErrUnsupported is returned by Upgrade on platforms without descriptor inheritance.
+var ErrUnsupported = errors.New("handoff: upgrade is not supported on windows")
+
+// Upgrade is not supported on windows.
+func (u *Upgrader) Upgrade(context.Context) error {
+	return ErrUnsupported
+}
+
+// Upgrade upgrades the process-wide upgrader.
+func Upgrade(ctx context.Context) error {
+	return Default().Upgrade(ctx)
+}
@@ -23,11 +23,16 @@ import (
 
 // Marshaler scheme names and HTTP content types.
 const (
-	SchemeJSONPb = "jsonpb"
-	SchemeProto  = "proto"
+	SchemeJSONPb  = "jsonpb"
+	SchemeProto   = "proto"
+	SchemeMsgpack = "msgpack"
 
-	ContentTypeJSON  = "application/json"
-	ContentTypeProto = "application/octet-stream"
+	ContentTypeJSON      = "application/json"
+	ContentTypeProto     = "application/octet-stream"
+	ContentTypeXProtobuf = "application/x-protobuf"
+	ContentTypeProtobuf  = "application/protobuf"
+	ContentTypeMsgpack   = "application/msgpack"
+	ContentTypeXMsgpack  = "application/x-msgpack"
 )
 
 var defaultProtoMarshaler = &ProtoMarshaler{}
@@ -51,11 +56,28 @@ func CanonicalContentTypeForScheme(scheme string) string {
 		return ContentTypeJSON
 	case SchemeProto:
 		return ContentTypeProto
+	case SchemeMsgpack:
+		return ContentTypeMsgpack
 	default:
 		return ""
 	}
 }
 
+// ContentTypesForScheme returns every MIME type served by a marshaler scheme,
+// canonical type first.
+func ContentTypesForScheme(scheme string) []string {
+	switch normalizeScheme(scheme) {
+	case SchemeJSONPb:
+		return []string{ContentTypeJSON}
+	case SchemeProto:
+		return []string{ContentTypeProto, ContentTypeXProtobuf, ContentTypeProtobuf}
+	case SchemeMsgpack:
+		return []string{ContentTypeMsgpack, ContentTypeXMsgpack}
+	default:
+		return nil
+	}
+}
+
 // MarshalerForContentType returns the preferred marshaler for the given HTTP content type.
 func MarshalerForContentType( //nolint:revive // stutter is acceptable for clarity
 	contentType string,
@@ -65,6 +87,8 @@ func MarshalerForContentType( //nolint:revive // stutter is acceptable for clari
 		return nil
 	case ct == ContentTypeJSON || strings.Contains(ct, "json"):
 		return defaultMarshaler
+	case ct == ContentTypeMsgpack || ct == ContentTypeXMsgpack:
+		return defaultMsgpackMarshaler
 	default:
 		return defaultProtoMarshaler
 	}
@@ -22,9 +22,11 @@ import (
 	"reflect"
 	"strconv"
 
+	statuspb "google.golang.org/genproto/googleapis/rpc/status"
 	"google.golang.org/protobuf/encoding/protojson"
 	"google.golang.org/protobuf/proto"
 
+	"github.com/codesjoy/yggdrasil/v3/rpc/status"
 	"github.com/codesjoy/yggdrasil/v3/transport/support/marshaler/internal/convert"
 )
 
@@ -186,7 +188,14 @@ func (j *JSONPb) marshalTo(w io.Writer, v interface{}) error {
 		return err
 	}
 
-	b, err := j.MarshalOptions.Marshal(p)
+	var b []byte
+	var err error
+	if st, ok := p.(*statuspb.Status); ok {
+		// Keep status details of unknown types rather than failing.
+		b, err = status.EncodeJSON(j.MarshalOptions, st)
+	} else {
+		b, err = j.MarshalOptions.Marshal(p)
+	}
 	if err != nil {
 		return err
 	}
@@ -348,6 +357,9 @@ func decodeJSONPb(d *json.Decoder, unmarshaler protojson.UnmarshalOptions, v int
 		return err
 	}
 
+	if st, ok := p.(*statuspb.Status); ok {
+		return status.DecodeJSON(unmarshaler, b, st)
+	}
 	return unmarshaler.Unmarshal([]byte(b), p)
 }
 
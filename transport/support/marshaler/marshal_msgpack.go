@@ -0,0 +1,104 @@
+// Copyright 2022 The codesjoy Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package marshaler
+
+import (
+	"errors"
+	"io"
+
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+)
+
+var defaultMsgpackMarshaler = &MsgpackMarshaler{}
+
+// MsgpackBuilder returns the framework built-in msgpack marshaler builder.
+func MsgpackBuilder() MarshalerBuilder {
+	return func() (Marshaler, error) {
+		return &MsgpackMarshaler{}, nil
+	}
+}
+
+// MsgpackMarshaler is a Marshaler which marshals/unmarshals proto messages
+// into/from msgpack. The encoded document mirrors the protojson mapping of the
+// message, so field names, enums and well-known types match the JSON surface.
+//
+// Because of that mapping the msgpack types are those of the JSON form, not
+// of the proto fields:
+//   - int64, uint64, fixed64 and their wrappers are msgpack strings;
+//   - bytes fields are base64 strings, not msgpack bin;
+//   - floats with an integral value, e.g. 1.0, are msgpack integers, and
+//     NaN and infinities are strings;
+//   - enums are their names, and well-known types such as Timestamp and
+//     Duration are their JSON strings;
+//   - unknown fields are dropped when decoding.
+//
+// Peers decoding into typed structures must accept those types. Use
+// application/x-protobuf where an exact binary encoding is needed.
+type MsgpackMarshaler struct{}
+
+// ContentType always returns "application/msgpack".
+func (*MsgpackMarshaler) ContentType(_ interface{}) string {
+	return ContentTypeMsgpack
+}
+
+// Marshal marshals "value" into msgpack.
+func (*MsgpackMarshaler) Marshal(value interface{}) ([]byte, error) {
+	message, ok := value.(proto.Message)
+	if !ok {
+		return nil, errors.New("unable to marshal non proto field")
+	}
+	data, err := protojson.Marshal(message)
+	if err != nil {
+		return nil, err
+	}
+	return msgpackFromJSON(data)
+}
+
+// Unmarshal unmarshals msgpack "data" into "value".
+func (*MsgpackMarshaler) Unmarshal(data []byte, value interface{}) error {
+	message, ok := value.(proto.Message)
+	if !ok {
+		return errors.New("unable to unmarshal non proto field")
+	}
+	doc, err := msgpackToJSON(data)
+	if err != nil {
+		return err
+	}
+	return protojson.UnmarshalOptions{DiscardUnknown: true}.Unmarshal(doc, message)
+}
+
+// NewDecoder returns a Decoder which reads a msgpack document from "reader".
+func (marshaller *MsgpackMarshaler) NewDecoder(reader io.Reader) Decoder {
+	return DecoderFunc(func(value interface{}) error {
+		buffer, err := io.ReadAll(reader)
+		if err != nil {
+			return err
+		}
+		return marshaller.Unmarshal(buffer, value)
+	})
+}
+
+// NewEncoder returns an Encoder which writes a msgpack document into "writer".
+func (marshaller *MsgpackMarshaler) NewEncoder(writer io.Writer) Encoder {
+	return EncoderFunc(func(value interface{}) error {
+		buffer, err := marshaller.Marshal(value)
+		if err != nil {
+			return err
+		}
+		_, err = writer.Write(buffer)
+		return err
+	})
+}
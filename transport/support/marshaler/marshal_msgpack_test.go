@@ -0,0 +1,160 @@
+// Copyright 2022 The codesjoy Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package marshaler
+
+import (
+	"bytes"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/known/structpb"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+func TestMsgpackMarshaler(t *testing.T) {
+	m := &MsgpackMarshaler{}
+	assert.Equal(t, ContentTypeMsgpack, m.ContentType(nil))
+
+	t.Run("Marshal/Unmarshal", func(t *testing.T) {
+		msg := &descriptorpb.UninterpretedOption{
+			Name: []*descriptorpb.UninterpretedOption_NamePart{
+				{NamePart: proto.String("opt"), IsExtension: proto.Bool(true)},
+			},
+			PositiveIntValue: proto.Uint64(1 << 40),
+			NegativeIntValue: proto.Int64(-7),
+			DoubleValue:      proto.Float64(2.5),
+			StringValue:      []byte{0x00, 0xff, 0x10},
+		}
+		data, err := m.Marshal(msg)
+		require.NoError(t, err)
+
+		res := &descriptorpb.UninterpretedOption{}
+		require.NoError(t, m.Unmarshal(data, res))
+		assert.True(t, proto.Equal(msg, res))
+	})
+
+	t.Run("Struct", func(t *testing.T) {
+		msg, err := structpb.NewStruct(map[string]any{
+			"name":   "ygg",
+			"count":  float64(300),
+			"ratio":  0.25,
+			"nested": map[string]any{"ok": true, "none": nil},
+			"list":   []any{"a", float64(-1), float64(70000)},
+		})
+		require.NoError(t, err)
+		data, err := m.Marshal(msg)
+		require.NoError(t, err)
+
+		res := &structpb.Struct{}
+		require.NoError(t, m.Unmarshal(data, res))
+		assert.True(t, proto.Equal(msg, res))
+	})
+
+	t.Run("JSON Value Types", func(t *testing.T) {
+		data, err := m.Marshal(&descriptorpb.UninterpretedOption{
+			NegativeIntValue: proto.Int64(-7),
+			DoubleValue:      proto.Float64(2),
+			StringValue:      []byte{0xff},
+		})
+		require.NoError(t, err)
+		doc, err := msgpackToJSON(data)
+		require.NoError(t, err)
+		assert.JSONEq(t,
+			`{"negativeIntValue":"-7","doubleValue":2,"stringValue":"/w=="}`,
+			string(doc))
+	})
+
+	t.Run("Known Encoding", func(t *testing.T) {
+		data, err := m.Marshal(wrapperspb.String("hi"))
+		require.NoError(t, err)
+		assert.Equal(t, []byte{0xa2, 'h', 'i'}, data)
+
+		res := &wrapperspb.Int32Value{}
+		require.NoError(t, m.Unmarshal([]byte{0xd1, 0xfe, 0x0c}, res))
+		assert.Equal(t, int32(-500), res.Value)
+	})
+
+	t.Run("Encoder/Decoder", func(t *testing.T) {
+		buf := &bytes.Buffer{}
+		require.NoError(t, m.NewEncoder(buf).Encode(wrapperspb.String("stream")))
+
+		res := &wrapperspb.StringValue{}
+		require.NoError(t, m.NewDecoder(buf).Decode(res))
+		assert.Equal(t, "stream", res.Value)
+	})
+
+	t.Run("Errors", func(t *testing.T) {
+		_, err := m.Marshal("non-proto")
+		assert.Error(t, err)
+		assert.Error(t, m.Unmarshal(nil, "non-proto"))
+		assert.Error(t, m.Unmarshal([]byte{0x92, 0x01}, &structpb.ListValue{}))
+		assert.Error(t, m.Unmarshal([]byte{0xa1, 'a', 0x01}, &wrapperspb.StringValue{}))
+		assert.Error(t, m.Unmarshal([]byte{0xc1}, &wrapperspb.StringValue{}))
+	})
+}
+
+func TestRegistryNegotiation(t *testing.T) {
+	reg := BuildMarshalerRegistry("jsonpb", "proto", "msgpack")
+
+	t.Run("Protobuf Alias", func(t *testing.T) {
+		req, _ := http.NewRequest("GET", "/", nil) // nolint:noctx
+		req.Header.Set("Accept", "application/x-protobuf")
+		_, out := reg.GetMarshaler(req)
+		assert.Equal(t, ContentTypeXProtobuf, out.ContentType(nil))
+		data, err := out.Marshal(wrapperspb.String("pb"))
+		require.NoError(t, err)
+		want, _ := proto.Marshal(wrapperspb.String("pb"))
+		assert.Equal(t, want, data)
+	})
+
+	t.Run("Inbound Alias Echoed", func(t *testing.T) {
+		req, _ := http.NewRequest("POST", "/", nil) // nolint:noctx
+		req.Header.Set("Content-Type", "application/protobuf")
+		in, out := reg.GetMarshaler(req)
+		assert.Equal(t, ContentTypeProtobuf, in.ContentType(nil))
+		assert.Equal(t, ContentTypeProtobuf, out.ContentType(nil))
+	})
+
+	t.Run("Msgpack", func(t *testing.T) {
+		req, _ := http.NewRequest("POST", "/", nil) // nolint:noctx
+		req.Header.Set("Accept", "application/msgpack")
+		req.Header.Set("Content-Type", "application/x-msgpack")
+		in, out := reg.GetMarshaler(req)
+		assert.Equal(t, ContentTypeXMsgpack, in.ContentType(nil))
+		assert.IsType(t, &MsgpackMarshaler{}, out)
+	})
+
+	t.Run("Quality Order", func(t *testing.T) {
+		req, _ := http.NewRequest("GET", "/", nil) // nolint:noctx
+		req.Header.Set("Accept", "application/json;q=0.5, application/x-protobuf")
+		_, out := reg.GetMarshaler(req)
+		assert.Equal(t, ContentTypeXProtobuf, out.ContentType(nil))
+
+		req.Header.Set("Accept", "application/x-protobuf;q=0, application/json;q=0.1")
+		_, out = reg.GetMarshaler(req)
+		assert.IsType(t, &JSONPb{}, out)
+	})
+
+	t.Run("Unregistered Scheme", func(t *testing.T) {
+		req, _ := http.NewRequest("GET", "/", nil) // nolint:noctx
+		req.Header.Set("Accept", "application/msgpack")
+		_, out := BuildMarshalerRegistry("jsonpb").GetMarshaler(req)
+		assert.IsType(t, &JSONPb{}, out)
+	})
+}
@@ -69,6 +69,8 @@ func builtInMarshalerBuilder(scheme string) MarshalerBuilder {
 		return JSONPbBuilder()
 	case SchemeProto:
 		return ProtoBuilder()
+	case SchemeMsgpack:
+		return MsgpackBuilder()
 	default:
 		return nil
 	}
@@ -79,8 +81,8 @@ func normalizeScheme(scheme string) string {
 }
 
 type (
-	inbound  = struct{}
-	outbound = struct{}
+	inbound  struct{}
+	outbound struct{}
 )
 
 // InboundFromContext returns the marshaler for inbound
@@ -17,7 +17,10 @@ package marshaler
 import (
 	"errors"
 	"log/slog"
+	"mime"
 	"net/http"
+	"sort"
+	"strconv"
 	"strings"
 )
 
@@ -81,9 +84,11 @@ func NewRegistry() *MarshalerRegistry {
 	return &MarshalerRegistry{mimeMap: make(map[string]Marshaler)}
 }
 
-// GetMarshaler returns the marshaler for the request.
+// GetMarshaler returns the marshaler for the request. Accept values are
+// tried in order of preference (q-value), and a match on an alias MIME type,
+// such as application/x-protobuf, is echoed back as the response content type.
 func (mr *MarshalerRegistry) GetMarshaler(r *http.Request) (inbound Marshaler, outbound Marshaler) {
-	for _, acceptVal := range headerValues(r.Header[acceptHeader]) {
+	for _, acceptVal := range acceptValues(r.Header[acceptHeader]) {
 		if m := mr.lookup(acceptVal); m != nil {
 			outbound = m
 			break
@@ -114,8 +119,15 @@ func (mr *MarshalerRegistry) Register(mime string, marshaler Marshaler) error {
 	if scheme == "" {
 		return errors.New("empty MIME type")
 	}
-	if canonical := CanonicalContentTypeForScheme(scheme); canonical != "" {
-		mr.mimeMap[canonical] = marshaler
+	for i, contentType := range ContentTypesForScheme(scheme) {
+		if i == 0 {
+			mr.mimeMap[contentType] = marshaler
+			continue
+		}
+		mr.mimeMap[contentType] = &negotiatedMarshaler{
+			Marshaler:   marshaler,
+			contentType: contentType,
+		}
 	}
 	mr.mimeMap[scheme] = marshaler
 	return nil
@@ -138,6 +150,58 @@ func (mr *MarshalerRegistry) lookup(value string) Marshaler {
 	return mr.mimeMap[alias]
 }
 
+// negotiatedMarshaler reports the alias MIME type a client negotiated
+// instead of the canonical type of the wrapped marshaler.
+type negotiatedMarshaler struct {
+	Marshaler
+	contentType string
+}
+
+func (m *negotiatedMarshaler) ContentType(_ interface{}) string {
+	return m.contentType
+}
+
+// acceptValues returns the media ranges of an Accept header ordered by
+// descending q-value; ranges with q=0 are dropped.
+func acceptValues(values []string) []string {
+	parts := headerValues(values)
+	if len(parts) == 0 {
+		return nil
+	}
+	type ranked struct {
+		value string
+		q     float64
+	}
+	items := make([]ranked, 0, len(parts))
+	for _, part := range parts {
+		if q := acceptQuality(part); q > 0 {
+			items = append(items, ranked{value: part, q: q})
+		}
+	}
+	sort.SliceStable(items, func(i, j int) bool { return items[i].q > items[j].q })
+	out := make([]string, len(items))
+	for i, item := range items {
+		out[i] = item.value
+	}
+	return out
+}
+
+func acceptQuality(value string) float64 {
+	_, params, err := mime.ParseMediaType(value)
+	if err != nil {
+		return 1
+	}
+	raw, ok := params["q"]
+	if !ok {
+		return 1
+	}
+	q, err := strconv.ParseFloat(raw, 64)
+	if err != nil || q < 0 {
+		return 0
+	}
+	return q
+}
+
 func headerValues(values []string) []string {
 	if len(values) == 0 {
 		return nil
@@ -26,7 +26,9 @@ import (
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	statuspb "google.golang.org/genproto/googleapis/rpc/status"
 	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/anypb"
 	"google.golang.org/protobuf/types/known/wrapperspb"
 )
 
@@ -80,6 +82,24 @@ func TestJSONPb(t *testing.T) {
 	})
 }
 
+func TestJSONPbStatusKeepsUnknownDetails(t *testing.T) {
+	m, err := NewJSONPbMarshaler()
+	require.NoError(t, err)
+	value, err := proto.Marshal(wrapperspb.String("opaque"))
+	require.NoError(t, err)
+	pb := &statuspb.Status{
+		Code:    9,
+		Message: "failed",
+		Details: []*anypb.Any{{TypeUrl: "type.googleapis.com/example.v1.Unlinked", Value: value}},
+	}
+
+	data, err := m.Marshal(pb)
+	require.NoError(t, err)
+	got := &statuspb.Status{}
+	require.NoError(t, m.Unmarshal(data, got))
+	assert.True(t, proto.Equal(pb, got))
+}
+
 func TestProtoMarshaler(t *testing.T) {
 	m := &ProtoMarshaler{}
 	assert.Equal(t, "application/octet-stream", m.ContentType(nil))
@@ -169,6 +189,10 @@ func TestContext(t *testing.T) {
 	ctx = WithOutboundContext(ctx, m)
 	assert.Equal(t, m, OutboundFromContext(ctx))
 
+	// Inbound and outbound are tracked independently.
+	ctx = WithOutboundContext(context.Background(), m)
+	assert.Same(t, defaultMarshaler, InboundFromContext(ctx))
+
 	// Test defaults
 	ctx = context.Background()
 	assert.NotNil(t, InboundFromContext(ctx)) // Should return defaultMarshaler
@@ -232,6 +256,9 @@ func TestMarshalerForContentType(t *testing.T) {
 		assert.NotNil(t, m)
 		assert.IsType(t, &ProtoMarshaler{}, m)
 	})
+	t.Run("msgpack returns msgpack", func(t *testing.T) {
+		assert.IsType(t, &MsgpackMarshaler{}, MarshalerForContentType("application/x-msgpack"))
+	})
 }
 
 func TestMarshalerForValue(t *testing.T) {
@@ -257,7 +284,11 @@ func TestCanonicalContentTypeForScheme(t *testing.T) {
 	assert.Equal(t, ContentTypeJSON, CanonicalContentTypeForScheme("jsonpb"))
 	assert.Equal(t, ContentTypeJSON, CanonicalContentTypeForScheme("JSONPB"))
 	assert.Equal(t, ContentTypeProto, CanonicalContentTypeForScheme("proto"))
+	assert.Equal(t, ContentTypeMsgpack, CanonicalContentTypeForScheme("msgpack"))
 	assert.Equal(t, "", CanonicalContentTypeForScheme("unknown"))
+	assert.Equal(t, []string{ContentTypeMsgpack, ContentTypeXMsgpack},
+		ContentTypesForScheme("msgpack"))
+	assert.Nil(t, ContentTypesForScheme("unknown"))
 }
 
 func TestHasMarshalerBuilder(t *testing.T) {
@@ -0,0 +1,138 @@
+// Copyright 2022 The codesjoy Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package orca implements per-request load reporting in the spirit of ORCA:
+// servers attach their utilization to response trailers and clients feed it
+// to utilization-aware balancers.
+//
+// Reports use the text form of the endpoint-load-metrics trailer understood
+// by Envoy:
+//
+//	endpoint-load-metrics: TEXT cpu_utilization=0.3, mem_utilization=0.5, rps_fractional=120
+package orca
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/codesjoy/yggdrasil/v3/rpc/metadata"
+)
+
+// TrailerKey is the trailer carrying the load report.
+const TrailerKey = "endpoint-load-metrics"
+
+const textPrefix = "TEXT "
+
+// Config configures load reporting on a server.
+type Config struct {
+	// Enabled attaches a load report to every response trailer.
+	Enabled bool `mapstructure:"enabled"`
+	// Interval is how long a utilization sample is reused before the
+	// process is sampled again.
+	Interval time.Duration `mapstructure:"interval" default:"1s"`
+}
+
+// LoadReport is the utilization of a server. Utilizations are fractions,
+// usually in [0, 1]; zero means unknown.
+type LoadReport struct {
+	// CPUUtilization is the CPU time used by the process over the CPU time
+	// available to it.
+	CPUUtilization float64
+	// MemUtilization is the memory used by the process over its limit.
+	MemUtilization float64
+	// ApplicationUtilization is a utilization defined by the application.
+	// Balancers prefer it over CPUUtilization when set.
+	ApplicationUtilization float64
+	// QPS is the rate of requests completed by the server.
+	QPS float64
+}
+
+// Utilization returns the utilization balancers should weigh the server by.
+func (r LoadReport) Utilization() float64 {
+	if r.ApplicationUtilization > 0 {
+		return r.ApplicationUtilization
+	}
+	return r.CPUUtilization
+}
+
+// String encodes r as a trailer value.
+func (r LoadReport) String() string {
+	fields := make([]string, 0, 4)
+	add := func(name string, v float64) {
+		if v > 0 {
+			fields = append(fields, name+"="+strconv.FormatFloat(v, 'g', 4, 64))
+		}
+	}
+	add("cpu_utilization", r.CPUUtilization)
+	add("mem_utilization", r.MemUtilization)
+	add("application_utilization", r.ApplicationUtilization)
+	add("rps_fractional", r.QPS)
+	return textPrefix + strings.Join(fields, ", ")
+}
+
+// Parse decodes a trailer value. Unknown fields are ignored so servers can
+// report more than this package understands.
+func Parse(value string) (LoadReport, error) {
+	var r LoadReport
+	body, ok := strings.CutPrefix(strings.TrimSpace(value), strings.TrimSpace(textPrefix))
+	if !ok {
+		return r, errors.New("orca: load report is not in TEXT format")
+	}
+	for _, field := range strings.Split(body, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+		name, raw, ok := strings.Cut(field, "=")
+		if !ok {
+			return LoadReport{}, fmt.Errorf("orca: malformed field %q", field)
+		}
+		v, err := strconv.ParseFloat(strings.TrimSpace(raw), 64)
+		if err != nil || v < 0 {
+			return LoadReport{}, fmt.Errorf("orca: invalid value for %s: %q", name, raw)
+		}
+		switch strings.TrimSpace(name) {
+		case "cpu_utilization":
+			r.CPUUtilization = v
+		case "mem_utilization":
+			r.MemUtilization = v
+		case "application_utilization":
+			r.ApplicationUtilization = v
+		case "rps_fractional":
+			r.QPS = v
+		}
+	}
+	return r, nil
+}
+
+// FromTrailer returns the load report carried by a trailer, if any.
+func FromTrailer(md metadata.MD) (LoadReport, bool) {
+	values := md.Get(TrailerKey)
+	if len(values) == 0 {
+		return LoadReport{}, false
+	}
+	r, err := Parse(values[len(values)-1])
+	if err != nil {
+		return LoadReport{}, false
+	}
+	return r, true
+}
+
+// Trailer returns the trailer carrying r.
+func (r LoadReport) Trailer() metadata.MD {
+	return metadata.Pairs(TrailerKey, r.String())
+}
@@ -0,0 +1,86 @@
+// Copyright 2022 The codesjoy Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package orca
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/codesjoy/yggdrasil/v3/internal/xclock"
+	"github.com/codesjoy/yggdrasil/v3/rpc/metadata"
+)
+
+func TestLoadReportRoundTrip(t *testing.T) {
+	in := LoadReport{CPUUtilization: 0.25, MemUtilization: 0.5, QPS: 120}
+	assert.Equal(
+		t,
+		"TEXT cpu_utilization=0.25, mem_utilization=0.5, rps_fractional=120",
+		in.String(),
+	)
+
+	out, ok := FromTrailer(in.Trailer())
+	require.True(t, ok)
+	assert.Equal(t, in, out)
+	assert.Equal(t, 0.25, out.Utilization())
+
+	out.ApplicationUtilization = 0.75
+	assert.Equal(t, 0.75, out.Utilization())
+}
+
+func TestParse(t *testing.T) {
+	r, err := Parse("TEXT cpu_utilization=0.1,named_metrics.foo=3, rps_fractional=7.5")
+	require.NoError(t, err)
+	assert.Equal(t, LoadReport{CPUUtilization: 0.1, QPS: 7.5}, r)
+
+	for _, bad := range []string{
+		"cpu_utilization=0.1",
+		"TEXT cpu_utilization",
+		"TEXT cpu_utilization=abc",
+		"TEXT cpu_utilization=-1",
+	} {
+		_, err := Parse(bad)
+		assert.Error(t, err, bad)
+	}
+
+	_, ok := FromTrailer(metadata.Pairs(TrailerKey, "garbage"))
+	assert.False(t, ok)
+	_, ok = FromTrailer(metadata.MD{})
+	assert.False(t, ok)
+}
+
+func TestRecorderQPS(t *testing.T) {
+	clock := xclock.NewFake(time.Unix(100, 0))
+	r := NewRecorder(Config{Interval: time.Second})
+	r.clock = clock
+	r.sampled = clock.Now()
+
+	for i := 0; i < 10; i++ {
+		r.Done()
+	}
+	assert.Zero(t, r.Report().QPS, "sample is reused within the interval")
+
+	clock.Advance(2 * time.Second)
+	report := r.Report()
+	assert.Equal(t, 5.0, report.QPS)
+	assert.GreaterOrEqual(t, report.CPUUtilization, 0.0)
+	assert.LessOrEqual(t, report.CPUUtilization, 1.0)
+
+	r.SetApplicationUtilization(0.4)
+	assert.Equal(t, 0.4, r.Report().ApplicationUtilization)
+	assert.Equal(t, 0.4, r.Report().Utilization())
+}
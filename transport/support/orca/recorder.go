@@ -0,0 +1,121 @@
+// Copyright 2022 The codesjoy Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package orca
+
+import (
+	"math"
+	"runtime"
+	"runtime/debug"
+	"runtime/metrics"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/codesjoy/yggdrasil/v3/internal/xclock"
+)
+
+const memoryTotalMetric = "/memory/classes/total:bytes"
+
+// Recorder samples the utilization of the process for load reports. It
+// samples lazily: a report is at most Interval old and no goroutine runs in
+// the background.
+type Recorder struct {
+	clock xclock.Clock
+
+	requests atomic.Int64
+	appUtil  atomic.Uint64
+
+	mu        sync.Mutex
+	interval  time.Duration
+	report    LoadReport
+	sampled   time.Time
+	cpuTime   time.Duration
+	requests0 int64
+}
+
+// NewRecorder returns a Recorder configured by cfg.
+func NewRecorder(cfg Config) *Recorder {
+	r := &Recorder{interval: sampleInterval(cfg), clock: xclock.Real()}
+	r.sampled = r.clock.Now()
+	r.cpuTime, _ = processCPUTime()
+	return r
+}
+
+// Configure applies new settings to the recorder.
+func (r *Recorder) Configure(cfg Config) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.interval = sampleInterval(cfg)
+}
+
+func sampleInterval(cfg Config) time.Duration {
+	if cfg.Interval <= 0 {
+		return time.Second
+	}
+	return cfg.Interval
+}
+
+// Done counts one completed request towards the reported QPS.
+func (r *Recorder) Done() {
+	r.requests.Add(1)
+}
+
+// SetApplicationUtilization reports a utilization defined by the
+// application, e.g. the fill level of a work queue. Zero clears it.
+func (r *Recorder) SetApplicationUtilization(v float64) {
+	r.appUtil.Store(math.Float64bits(max(v, 0)))
+}
+
+// Report returns the current load report, sampling the process when the
+// previous sample is older than the interval.
+func (r *Recorder) Report() LoadReport {
+	now := r.clock.Now()
+	r.mu.Lock()
+	if elapsed := now.Sub(r.sampled); elapsed >= r.interval {
+		r.sampleLocked(now, elapsed)
+	}
+	report := r.report
+	r.mu.Unlock()
+	report.ApplicationUtilization = math.Float64frombits(r.appUtil.Load())
+	return report
+}
+
+func (r *Recorder) sampleLocked(now time.Time, elapsed time.Duration) {
+	requests := r.requests.Load()
+	r.report.QPS = float64(requests-r.requests0) / elapsed.Seconds()
+	r.requests0 = requests
+	if cpuTime, ok := processCPUTime(); ok {
+		available := elapsed.Seconds() * float64(runtime.GOMAXPROCS(0))
+		r.report.CPUUtilization = min((cpuTime-r.cpuTime).Seconds()/available, 1)
+		r.cpuTime = cpuTime
+	}
+	r.report.MemUtilization = memUtilization()
+	r.sampled = now
+}
+
+// memUtilization relates the memory mapped by the Go runtime to the soft
+// memory limit. It is unknown without a limit.
+func memUtilization() float64 {
+	limit := debug.SetMemoryLimit(-1)
+	if limit <= 0 || limit == math.MaxInt64 {
+		return 0
+	}
+	sample := []metrics.Sample{{Name: memoryTotalMetric}}
+	metrics.Read(sample)
+	if sample[0].Value.Kind() != metrics.KindUint64 {
+		return 0
+	}
+	return float64(sample[0].Value.Uint64()) / float64(limit)
+}
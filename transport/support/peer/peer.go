@@ -34,7 +34,8 @@ type Peer struct {
 	AuthInfo security.AuthInfo
 	// Protocol is the protocol used for the RPC.
 	Protocol string
-	// RemoteIP is the remote ip.
+	// RemoteIP is the client ip. HTTP gateways take it from X-Forwarded-For
+	// or X-Real-Ip when present.
 	RemoteIP string
 }
 
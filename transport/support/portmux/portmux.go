@@ -0,0 +1,202 @@
+// Copyright 2022 The codesjoy Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package portmux shares one listener between HTTP/2 prior-knowledge
+// clients, such as gRPC over cleartext, and HTTP/1 clients.
+//
+// Each accepted connection is classified by its first bytes: connections
+// starting with the HTTP/2 client preface are handed to HTTP2, all others to
+// HTTP1. TLS connections cannot be told apart this way and all go to HTTP1.
+package portmux
+
+import (
+	"bytes"
+	"net"
+	"sync"
+	"time"
+)
+
+// DefaultSniffTimeout bounds how long a new connection may take to send
+// enough bytes to be classified.
+const DefaultSniffTimeout = 10 * time.Second
+
+var http2Preface = []byte("PRI * HTTP/2.0\r\n\r\nSM\r\n\r\n")
+
+// Mux splits a root listener into two child listeners.
+type Mux struct {
+	root         net.Listener
+	sniffTimeout time.Duration
+
+	http1 *childListener
+	http2 *childListener
+
+	closeOnce sync.Once
+	done      chan struct{}
+}
+
+// New returns a Mux reading connections from root. Serve must be called to
+// start accepting.
+func New(root net.Listener) *Mux {
+	m := &Mux{
+		root:         root,
+		sniffTimeout: DefaultSniffTimeout,
+		done:         make(chan struct{}),
+	}
+	m.http1 = newChildListener(m)
+	m.http2 = newChildListener(m)
+	return m
+}
+
+// HTTP1 returns the listener receiving HTTP/1 (and TLS) connections.
+func (m *Mux) HTTP1() net.Listener {
+	return m.http1
+}
+
+// HTTP2 returns the listener receiving HTTP/2 prior-knowledge connections.
+func (m *Mux) HTTP2() net.Listener {
+	return m.http2
+}
+
+// Addr returns the address of the root listener.
+func (m *Mux) Addr() net.Addr {
+	return m.root.Addr()
+}
+
+// Serve accepts connections on the root listener until it is closed. It
+// returns nil after Close.
+func (m *Mux) Serve() error {
+	for {
+		conn, err := m.root.Accept()
+		if err != nil {
+			select {
+			case <-m.done:
+				return nil
+			default:
+			}
+			m.Close() //nolint:errcheck
+			return err
+		}
+		go m.dispatch(conn)
+	}
+}
+
+// Close closes the root listener and both child listeners.
+func (m *Mux) Close() error {
+	var err error
+	m.closeOnce.Do(func() {
+		close(m.done)
+		err = m.root.Close()
+	})
+	return err
+}
+
+func (m *Mux) dispatch(conn net.Conn) {
+	if m.sniffTimeout > 0 {
+		_ = conn.SetReadDeadline(time.Now().Add(m.sniffTimeout))
+	}
+	sniffed, isHTTP2, err := sniff(conn)
+	if m.sniffTimeout > 0 {
+		_ = conn.SetReadDeadline(time.Time{})
+	}
+	if err != nil && len(sniffed) == 0 {
+		_ = conn.Close()
+		return
+	}
+	target := m.http1
+	if isHTTP2 {
+		target = m.http2
+	}
+	target.deliver(&sniffedConn{Conn: conn, buf: sniffed})
+}
+
+// sniff reads until the bytes read either match the HTTP/2 preface or
+// diverge from it.
+func sniff(conn net.Conn) ([]byte, bool, error) {
+	buf := make([]byte, 0, len(http2Preface))
+	chunk := make([]byte, len(http2Preface))
+	for len(buf) < len(http2Preface) {
+		n, err := conn.Read(chunk[:len(http2Preface)-len(buf)])
+		buf = append(buf, chunk[:n]...)
+		if !bytes.HasPrefix(http2Preface, buf) {
+			return buf, false, nil
+		}
+		if err != nil {
+			return buf, false, err
+		}
+	}
+	return buf, true, nil
+}
+
+type childListener struct {
+	mux   *Mux
+	conns chan net.Conn
+
+	closeOnce sync.Once
+	closed    chan struct{}
+}
+
+func newChildListener(m *Mux) *childListener {
+	return &childListener{
+		mux:    m,
+		conns:  make(chan net.Conn),
+		closed: make(chan struct{}),
+	}
+}
+
+func (l *childListener) deliver(conn net.Conn) {
+	select {
+	case l.conns <- conn:
+	case <-l.closed:
+		_ = conn.Close()
+	case <-l.mux.done:
+		_ = conn.Close()
+	}
+}
+
+func (l *childListener) Accept() (net.Conn, error) {
+	select {
+	case conn := <-l.conns:
+		return conn, nil
+	case <-l.closed:
+		return nil, net.ErrClosed
+	case <-l.mux.done:
+		return nil, net.ErrClosed
+	}
+}
+
+// Close stops the child from accepting; connections classified for it are
+// closed. The root listener keeps serving the other child.
+func (l *childListener) Close() error {
+	l.closeOnce.Do(func() { close(l.closed) })
+	return nil
+}
+
+func (l *childListener) Addr() net.Addr {
+	return l.mux.root.Addr()
+}
+
+// sniffedConn replays the sniffed bytes before reading from the connection.
+type sniffedConn struct {
+	net.Conn
+	buf []byte
+}
+
+func (c *sniffedConn) Read(p []byte) (int, error) {
+	if len(c.buf) > 0 {
+		n := copy(p, c.buf)
+		c.buf = c.buf[n:]
+		return n, nil
+	}
+	return c.Conn.Read(p)
+}
@@ -0,0 +1,108 @@
+// Copyright 2022 The codesjoy Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package portmux
+
+import (
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestMux(t *testing.T) (*Mux, chan error) {
+	t.Helper()
+	root, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	m := New(root)
+	served := make(chan error, 1)
+	go func() { served <- m.Serve() }()
+	t.Cleanup(func() { _ = m.Close() })
+	return m, served
+}
+
+func TestMuxRoutesHTTP1AndHTTP2(t *testing.T) {
+	m, _ := newTestMux(t)
+
+	svr := &http.Server{
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+			_, _ = io.WriteString(w, "h1")
+		}),
+		ReadHeaderTimeout: time.Second,
+	}
+	go func() { _ = svr.Serve(m.HTTP1()) }()
+	t.Cleanup(func() { _ = svr.Close() })
+
+	resp, err := http.Get("http://" + m.Addr().String() + "/")
+	require.NoError(t, err)
+	body, _ := io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	assert.Equal(t, "h1", string(body))
+
+	conn, err := net.Dial("tcp", m.Addr().String())
+	require.NoError(t, err)
+	defer conn.Close() //nolint:errcheck
+	payload := append(append([]byte(nil), http2Preface...), []byte("frames")...)
+	_, err = conn.Write(payload)
+	require.NoError(t, err)
+
+	accepted, err := m.HTTP2().Accept()
+	require.NoError(t, err)
+	defer accepted.Close() //nolint:errcheck
+	got := make([]byte, len(payload))
+	_, err = io.ReadFull(accepted, got)
+	require.NoError(t, err)
+	assert.Equal(t, payload, got, "sniffed bytes must be replayed")
+}
+
+func TestMuxShortNonHTTP2ConnGoesToHTTP1(t *testing.T) {
+	m, _ := newTestMux(t)
+
+	conn, err := net.Dial("tcp", m.Addr().String())
+	require.NoError(t, err)
+	defer conn.Close() //nolint:errcheck
+	_, err = conn.Write([]byte("GET"))
+	require.NoError(t, err)
+
+	accepted, err := m.HTTP1().Accept()
+	require.NoError(t, err)
+	defer accepted.Close() //nolint:errcheck
+	got := make([]byte, 3)
+	_, err = io.ReadFull(accepted, got)
+	require.NoError(t, err)
+	assert.Equal(t, "GET", string(got))
+}
+
+func TestMuxClose(t *testing.T) {
+	m, served := newTestMux(t)
+
+	require.NoError(t, m.HTTP2().Close())
+	_, err := m.HTTP2().Accept()
+	assert.True(t, errors.Is(err, net.ErrClosed))
+
+	require.NoError(t, m.Close())
+	_, err = m.HTTP1().Accept()
+	assert.True(t, errors.Is(err, net.ErrClosed))
+	select {
+	case err := <-served:
+		assert.NoError(t, err)
+	case <-time.After(time.Second):
+		t.Fatal("Serve did not return after Close")
+	}
+}
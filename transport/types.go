@@ -16,6 +16,7 @@ package transport
 
 import (
 	"context"
+	"net"
 
 	"github.com/codesjoy/yggdrasil/v3/rpc/stream"
 )
@@ -31,6 +32,12 @@ type Server interface {
 	Info() ServerInfo
 }
 
+// ListenerServer is implemented by servers that can accept connections from
+// additional listeners after Start, e.g. a port shared with other protocols.
+type ListenerServer interface {
+	ServeListener(lis net.Listener) error
+}
+
 // ServerStream defines the interface for a server stream.
 type ServerStream interface {
 	stream.ServerStream
@@ -39,6 +46,17 @@ type ServerStream interface {
 	Finish(any, error)
 }
 
+// RecvSizeChecker is implemented by server streams that can check the
+// encoded size of received messages before decoding them.
+type RecvSizeChecker interface {
+	// CheckRecvSize makes RecvMsg pass the encoded size of each message to
+	// check before decoding it, and fail with the error check returns.
+	// Messages over limit bytes need not be read in full; zero means no
+	// limit. It must be called before Start and reports whether the stream
+	// checks the sizes.
+	CheckRecvSize(limit int, check func(size int) error) bool
+}
+
 // State indicates the state of connectivity.
 // It can be the state of a Client.
 type State int
@@ -85,3 +103,10 @@ type Client interface {
 	State() State
 	Connect()
 }
+
+// BackoffResetter is implemented by clients that back off between
+// reconnection attempts.
+type BackoffResetter interface {
+	// ResetBackoff makes a client in backoff reconnect immediately.
+	ResetBackoff()
+}
@@ -17,15 +17,21 @@ package yggdrasil
 import (
 	"context"
 	"errors"
+	"io/fs"
+	"log/slog"
 	"os"
 	"os/signal"
 	"strings"
+	"time"
 
 	yapp "github.com/codesjoy/yggdrasil/v3/app"
 	"github.com/codesjoy/yggdrasil/v3/config"
 	configchain "github.com/codesjoy/yggdrasil/v3/config/chain"
 	"github.com/codesjoy/yggdrasil/v3/config/source"
 	"github.com/codesjoy/yggdrasil/v3/module"
+	"github.com/codesjoy/yggdrasil/v3/observability/crashreport"
+	"github.com/codesjoy/yggdrasil/v3/transport/gateway/rest"
+	"github.com/codesjoy/yggdrasil/v3/transport/support/handoff"
 )
 
 // ComposeFunc builds one business bundle from the prepared runtime.
@@ -77,6 +83,14 @@ type BusinessBundle = yapp.BusinessBundle
 // CapabilityRegistration declares one provider-only capability extension.
 type CapabilityRegistration = yapp.CapabilityRegistration
 
+// Runnable is a background worker managed by the application lifecycle.
+type Runnable = yapp.Runnable
+
+// WorkerOption configures one worker registered with WithWorker.
+type WorkerOption = yapp.WorkerOption
+
+const defaultUpgradeTimeout = time.Minute
+
 type configLayerSource struct {
 	name     string
 	priority config.Priority
@@ -89,10 +103,17 @@ type options struct {
 	processDefaults         *bool
 	signalHandling          *bool
 	shutdownSignals         []os.Signal
+	hotRestart              bool
+	upgradeSignals          []os.Signal
+	upgradeTimeout          time.Duration
 	configSources           []configLayerSource
 	configBuilders          map[string]configchain.ContextBuilder
 	modules                 []module.Module
 	capabilityRegistrations []yapp.CapabilityRegistration
+	readinessChecks         []func(context.Context) error
+	afterStartHooks         []func(context.Context) error
+	workers                 []yapp.Option
+	staticDirs              []yapp.Option
 }
 
 // Option configures one root bootstrap app instance.
@@ -163,6 +184,34 @@ func WithShutdownSignals(signals ...os.Signal) Option {
 	}
 }
 
+// WithHotRestart enables listener handoff on Run. When one of the upgrade
+// signals (SIGUSR2 by default) is received, Run starts a new instance of the
+// executable that inherits all listeners and stops this app gracefully once
+// the new instance is ready. Not supported on windows.
+func WithHotRestart(enabled bool) Option {
+	return func(opts *options) error {
+		opts.hotRestart = enabled
+		return nil
+	}
+}
+
+// WithUpgradeSignals customizes the OS signals that trigger a hot restart.
+func WithUpgradeSignals(signals ...os.Signal) Option {
+	return func(opts *options) error {
+		opts.upgradeSignals = append([]os.Signal(nil), signals...)
+		return nil
+	}
+}
+
+// WithUpgradeTimeout bounds how long Run waits for the new instance to become
+// ready during a hot restart. Defaults to one minute.
+func WithUpgradeTimeout(timeout time.Duration) Option {
+	return func(opts *options) error {
+		opts.upgradeTimeout = timeout
+		return nil
+	}
+}
+
 // WithProcessDefaults controls whether this App installs process-global
 // compatibility defaults such as slog.Default, OTel globals, and legacy
 // instance facade state.
@@ -173,6 +222,36 @@ func WithProcessDefaults(enabled bool) Option {
 	}
 }
 
+// WithReadinessCheck adds checks consulted by the governor /readyz endpoint.
+func WithReadinessCheck(checks ...func(context.Context) error) Option {
+	return func(opts *options) error {
+		opts.readinessChecks = append(opts.readinessChecks, checks...)
+		return nil
+	}
+}
+
+// WithWorker registers a background worker started after the servers and
+// stopped before them on shutdown.
+func WithWorker(runnable Runnable, workerOpts ...WorkerOption) Option {
+	return func(opts *options) error {
+		opts.workers = append(opts.workers, yapp.WithWorker(runnable, workerOpts...))
+		return nil
+	}
+}
+
+// WithRestStaticDir serves the files of fsys under the URL prefix of the
+// REST server. Pass os.DirFS for on-disk assets or an embed.FS for assets
+// shipped inside the binary.
+func WithRestStaticDir(prefix string, fsys fs.FS, staticOpts ...rest.StaticOption) Option {
+	return func(opts *options) error {
+		opts.staticDirs = append(
+			opts.staticDirs,
+			yapp.WithRestStaticDir(prefix, fsys, staticOpts...),
+		)
+		return nil
+	}
+}
+
 // WithModules registers additional full lifecycle modules.
 func WithModules(mods ...module.Module) Option {
 	return func(opts *options) error {
@@ -225,6 +304,7 @@ func Run(ctx context.Context, appName string, fn ComposeFunc, opts ...Option) er
 	if appName == "" {
 		return errors.New("app name is required")
 	}
+	defer crashreport.Guard(ctx, crashreport.SourceApp, appName)
 	rootOpts, err := collectOptions(opts...)
 	if err != nil {
 		return err
@@ -235,6 +315,13 @@ func Run(ctx context.Context, appName string, fn ComposeFunc, opts ...Option) er
 	}
 	runCtx, stopSignals := rootOpts.runContext(ctx)
 	defer stopSignals()
+	runCtx, cancelRun := context.WithCancel(runCtx)
+	defer cancelRun()
+	if rootOpts.hotRestart {
+		// The parent may only let go of its listeners once every server of
+		// this process has claimed its inherited socket.
+		rootOpts.afterStartHooks = append(rootOpts.afterStartHooks, notifyHandoffReady)
+	}
 
 	app, err := newFromOptions(appName, rootOpts)
 	if err != nil {
@@ -250,6 +337,10 @@ func Run(ctx context.Context, appName string, fn ComposeFunc, opts ...Option) er
 	}
 	done := make(chan struct{})
 	defer close(done)
+	if rootOpts.hotRestart {
+		stopUpgrade := rootOpts.watchUpgrade(runCtx, cancelRun)
+		defer stopUpgrade()
+	}
 	go func() {
 		select {
 		case <-runCtx.Done():
@@ -356,9 +447,64 @@ func (rootOpts options) appOptions() []yapp.Option {
 			yapp.WithCapabilityRegistrations(rootOpts.capabilityRegistrations...),
 		)
 	}
+	if len(rootOpts.readinessChecks) > 0 {
+		appOpts = append(appOpts, yapp.WithReadinessCheck(rootOpts.readinessChecks...))
+	}
+	if len(rootOpts.afterStartHooks) > 0 {
+		appOpts = append(appOpts, yapp.WithAfterStartHook(rootOpts.afterStartHooks...))
+	}
+	appOpts = append(appOpts, rootOpts.workers...)
+	appOpts = append(appOpts, rootOpts.staticDirs...)
 	return appOpts
 }
 
+func notifyHandoffReady(context.Context) error {
+	if err := handoff.Ready(); err != nil {
+		slog.Warn("fault to notify parent process", slog.Any("error", err))
+	}
+	return nil
+}
+
+func (rootOpts options) watchUpgrade(
+	ctx context.Context,
+	onUpgraded context.CancelFunc,
+) func() {
+	signals := rootOpts.upgradeSignals
+	if len(signals) == 0 {
+		signals = defaultUpgradeSignals
+	}
+	if len(signals) == 0 {
+		return func() {}
+	}
+	timeout := rootOpts.upgradeTimeout
+	if timeout <= 0 {
+		timeout = defaultUpgradeTimeout
+	}
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, signals...)
+	go func() {
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-sigCh:
+			}
+			slog.Info("hot restart requested")
+			upgradeCtx, cancel := context.WithTimeout(ctx, timeout)
+			err := handoff.Upgrade(upgradeCtx)
+			cancel()
+			if err != nil {
+				slog.Error("fault to hot restart", slog.Any("error", err))
+				continue
+			}
+			slog.Info("hot restart completed, stopping old process")
+			onUpgraded()
+			return
+		}
+	}()
+	return func() { signal.Stop(sigCh) }
+}
+
 func (rootOpts options) runContext(parent context.Context) (context.Context, context.CancelFunc) {
 	enabled := true
 	if rootOpts.signalHandling != nil {
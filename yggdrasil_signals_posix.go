@@ -22,3 +22,5 @@ import (
 )
 
 var defaultShutdownSignals = []os.Signal{os.Interrupt, syscall.SIGTERM}
+
+var defaultUpgradeSignals = []os.Signal{syscall.SIGUSR2}
@@ -19,3 +19,6 @@ package yggdrasil
 import "os"
 
 var defaultShutdownSignals = []os.Signal{os.Interrupt}
+
+// Hot restart is not supported on windows.
+var defaultUpgradeSignals []os.Signal
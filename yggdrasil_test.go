@@ -241,6 +241,16 @@ func TestWithOptions(t *testing.T) {
 		assert.Equal(t, []os.Signal{os.Interrupt}, opts.shutdownSignals)
 	})
 
+	t.Run("WithHotRestart", func(t *testing.T) {
+		opts := options{}
+		require.NoError(t, WithHotRestart(true)(&opts))
+		require.NoError(t, WithUpgradeSignals(os.Interrupt)(&opts))
+		require.NoError(t, WithUpgradeTimeout(time.Second)(&opts))
+		assert.True(t, opts.hotRestart)
+		assert.Equal(t, []os.Signal{os.Interrupt}, opts.upgradeSignals)
+		assert.Equal(t, time.Second, opts.upgradeTimeout)
+	})
+
 	t.Run("WithConfigSource nil source is skipped", func(t *testing.T) {
 		opts := options{}
 		err := WithConfigSource("test", config.PriorityOverride, nil)(&opts)
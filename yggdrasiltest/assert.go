@@ -0,0 +1,53 @@
+// Copyright 2022 The codesjoy Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package yggdrasiltest
+
+import (
+	"slices"
+	"testing"
+
+	"google.golang.org/genproto/googleapis/rpc/code"
+
+	"github.com/codesjoy/yggdrasil/v3/rpc/metadata"
+	"github.com/codesjoy/yggdrasil/v3/rpc/status"
+)
+
+// RequireCode fails the test unless err carries the status code want;
+// code.Code_OK expects a nil error.
+func RequireCode(t testing.TB, err error, want code.Code) {
+	t.Helper()
+	if got := status.FromError(err).Code(); got != want {
+		t.Fatalf("yggdrasiltest: status code = %v, want %v (err: %v)", got, want, err)
+	}
+}
+
+// RequireStatus fails the test unless err carries the status code want and
+// the message msg.
+func RequireStatus(t testing.TB, err error, want code.Code, msg string) {
+	t.Helper()
+	RequireCode(t, err, want)
+	if got := status.FromError(err).Message(); got != msg {
+		t.Fatalf("yggdrasiltest: status message = %q, want %q", got, msg)
+	}
+}
+
+// RequireMetadata fails the test unless md holds exactly the values want
+// under key.
+func RequireMetadata(t testing.TB, md metadata.MD, key string, want ...string) {
+	t.Helper()
+	if got := md.Get(key); !slices.Equal(got, want) {
+		t.Fatalf("yggdrasiltest: metadata %q = %q, want %q", key, got, want)
+	}
+}
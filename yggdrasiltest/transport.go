@@ -0,0 +1,640 @@
+// Copyright 2022 The codesjoy Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package yggdrasiltest
+
+import (
+	"context"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/codesjoy/pkg/basic/xerror"
+	"google.golang.org/genproto/googleapis/rpc/code"
+
+	"github.com/codesjoy/yggdrasil/v3/discovery/resolver"
+	"github.com/codesjoy/yggdrasil/v3/observability/stats"
+	"github.com/codesjoy/yggdrasil/v3/rpc/metadata"
+	"github.com/codesjoy/yggdrasil/v3/rpc/status"
+	"github.com/codesjoy/yggdrasil/v3/rpc/stream"
+	remote "github.com/codesjoy/yggdrasil/v3/transport"
+	"github.com/codesjoy/yggdrasil/v3/transport/support/marshaler"
+	"github.com/codesjoy/yggdrasil/v3/transport/support/peer"
+	"github.com/codesjoy/yggdrasil/v3/transport/support/security"
+)
+
+// Protocol is the in-memory transport protocol name.
+const Protocol = "inmemory"
+
+var (
+	networkMu sync.Mutex
+	network   = map[string]*memServer{}
+)
+
+// memAddr is the net.Addr of an in-memory endpoint.
+type memAddr string
+
+func (a memAddr) Network() string { return Protocol }
+func (a memAddr) String() string  { return string(a) }
+
+func serverProvider(
+	address string,
+	statsHandler stats.Handler,
+	record func(Call),
+) remote.TransportServerProvider {
+	if statsHandler == nil {
+		statsHandler = stats.NoOpHandler
+	}
+	return remote.NewTransportServerProvider(
+		Protocol,
+		func(handle remote.MethodHandle) (remote.Server, error) {
+			return &memServer{
+				address:      address,
+				handle:       handle,
+				statsHandler: statsHandler,
+				record:       record,
+				done:         make(chan struct{}),
+			}, nil
+		},
+	)
+}
+
+func clientProvider() remote.TransportClientProvider {
+	return remote.NewTransportClientProvider(
+		Protocol,
+		func(
+			_ context.Context,
+			_ string,
+			endpoint resolver.Endpoint,
+			statsHandler stats.Handler,
+			onStateChange remote.OnStateChange,
+		) (remote.Client, error) {
+			if statsHandler == nil {
+				statsHandler = stats.NoOpHandler
+			}
+			cc := &memClient{endpoint: endpoint, statsHandler: statsHandler, state: remote.Ready}
+			if onStateChange != nil {
+				onStateChange(remote.ClientState{Endpoint: endpoint, State: remote.Ready})
+			}
+			return cc, nil
+		},
+	)
+}
+
+// memServer serves the streams dialed to its address from the same process.
+type memServer struct {
+	address      string
+	handle       remote.MethodHandle
+	statsHandler stats.Handler
+	record       func(Call)
+
+	mu      sync.Mutex
+	stopped bool
+	done    chan struct{}
+	streams sync.WaitGroup
+}
+
+func (s *memServer) Start() error {
+	networkMu.Lock()
+	defer networkMu.Unlock()
+	if _, ok := network[s.address]; ok {
+		return xerror.New(code.Code_ALREADY_EXISTS, "address already in use: "+s.address)
+	}
+	network[s.address] = s
+	return nil
+}
+
+func (s *memServer) Handle() error {
+	<-s.done
+	return nil
+}
+
+func (s *memServer) Stop(ctx context.Context) error {
+	s.mu.Lock()
+	if s.stopped {
+		s.mu.Unlock()
+		return nil
+	}
+	s.stopped = true
+	close(s.done)
+	s.mu.Unlock()
+
+	networkMu.Lock()
+	if network[s.address] == s {
+		delete(network, s.address)
+	}
+	networkMu.Unlock()
+
+	finished := make(chan struct{})
+	go func() {
+		s.streams.Wait()
+		close(finished)
+	}()
+	select {
+	case <-finished:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (s *memServer) Info() remote.ServerInfo {
+	return remote.ServerInfo{Protocol: Protocol, Address: s.address}
+}
+
+// serve runs the server half of p until the handler finishes.
+func (s *memServer) serve(p *pipe) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.stopped {
+		return false
+	}
+	s.streams.Add(1)
+	go func() {
+		defer s.streams.Done()
+		ss := newServerStream(p, s.address, s.statsHandler, s.record)
+		defer ss.cancel()
+		s.handle(ss)
+		ss.Finish(nil, nil)
+	}()
+	return true
+}
+
+// memClient dials the in-memory server registered at its endpoint address.
+type memClient struct {
+	endpoint     resolver.Endpoint
+	statsHandler stats.Handler
+
+	mu    sync.Mutex
+	state remote.State
+}
+
+func (c *memClient) NewStream(
+	ctx context.Context,
+	desc *stream.Desc,
+	method string,
+) (stream.ClientStream, error) {
+	if c.State() == remote.Shutdown {
+		return nil, xerror.New(code.Code_UNAVAILABLE, "client is closed")
+	}
+	networkMu.Lock()
+	srv := network[c.endpoint.GetAddress()]
+	networkMu.Unlock()
+	if srv == nil {
+		return nil, xerror.New(code.Code_UNAVAILABLE, "no server at "+c.endpoint.GetAddress())
+	}
+	if desc == nil {
+		desc = &stream.Desc{}
+	}
+	ctx = c.statsHandler.TagRPC(ctx, &stats.RPCTagInfoBase{FullMethod: method})
+	ctx = metadata.WithStreamContext(ctx)
+	p := newPipe(ctx, method, desc)
+	cs := &clientStream{pipe: p, desc: desc, statsHandler: c.statsHandler, begin: time.Now()}
+	c.statsHandler.HandleRPC(ctx, &stats.RPCBeginBase{
+		Client:       true,
+		BeginTime:    cs.begin,
+		ClientStream: desc.ClientStreams,
+		ServerStream: desc.ServerStreams,
+		Protocol:     Protocol,
+	})
+	c.statsHandler.HandleRPC(ctx, &stats.OutHeaderBase{
+		Client:         true,
+		Header:         p.inMD,
+		FullMethod:     method,
+		RemoteEndpoint: c.endpoint.GetAddress(),
+		Protocol:       Protocol,
+	})
+	if !srv.serve(p) {
+		return nil, xerror.New(code.Code_UNAVAILABLE, "server is stopped")
+	}
+	return cs, nil
+}
+
+func (c *memClient) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.state = remote.Shutdown
+	return nil
+}
+
+func (c *memClient) Protocol() string { return Protocol }
+
+func (c *memClient) State() remote.State {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.state
+}
+
+func (c *memClient) Connect() {}
+
+// pipe connects the two halves of one in-memory stream. Messages cross it
+// encoded, so neither side can observe the other's mutations.
+type pipe struct {
+	ctx    context.Context
+	method string
+	desc   *stream.Desc
+	inMD   metadata.MD
+
+	toServer  chan []byte
+	closeSend sync.Once
+	toClient  chan []byte
+
+	headerReady chan struct{}
+	finished    chan struct{}
+
+	mu      sync.Mutex
+	header  metadata.MD
+	trailer metadata.MD
+	err     error
+}
+
+func newPipe(ctx context.Context, method string, desc *stream.Desc) *pipe {
+	md, _ := metadata.FromOutContext(ctx)
+	// The single request of a non client-streaming call is buffered, like a
+	// transport write, so the server may complete without reading it.
+	requests := 0
+	if !desc.ClientStreams {
+		requests = 1
+	}
+	return &pipe{
+		ctx:         ctx,
+		method:      method,
+		desc:        desc,
+		inMD:        md.Copy(),
+		toServer:    make(chan []byte, requests),
+		toClient:    make(chan []byte),
+		headerReady: make(chan struct{}),
+		finished:    make(chan struct{}),
+	}
+}
+
+type clientStream struct {
+	*pipe
+	desc         *stream.Desc
+	statsHandler stats.Handler
+	begin        time.Time
+	recvOnce     bool
+	endOnce      sync.Once
+}
+
+func (cs *clientStream) Header() (metadata.MD, error) {
+	select {
+	case <-cs.headerReady:
+	case <-cs.finished:
+	case <-cs.ctx.Done():
+		return nil, status.FromContextError(cs.ctx.Err()).Err()
+	}
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	return cs.header.Copy(), nil
+}
+
+func (cs *clientStream) Trailer() metadata.MD {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	return cs.trailer.Copy()
+}
+
+func (cs *clientStream) CloseSend() error {
+	cs.closeSend.Do(func() { close(cs.toServer) })
+	return nil
+}
+
+func (cs *clientStream) Context() context.Context {
+	return cs.ctx
+}
+
+func (cs *clientStream) SendMsg(m any) error {
+	data, err := marshaler.MarshalerForValue(m).Marshal(m)
+	if err != nil {
+		return err
+	}
+	select {
+	case cs.toServer <- data:
+	case <-cs.finished:
+		return io.EOF
+	case <-cs.ctx.Done():
+		return status.FromContextError(cs.ctx.Err()).Err()
+	}
+	cs.statsHandler.HandleRPC(cs.ctx, &stats.RPCOutPayloadBase{
+		Client:        true,
+		Payload:       m,
+		Data:          data,
+		TransportSize: len(data),
+		SendTime:      time.Now(),
+		Protocol:      Protocol,
+	})
+	return nil
+}
+
+func (cs *clientStream) RecvMsg(m any) error {
+	if !cs.desc.ServerStreams && cs.recvOnce {
+		return cs.end(io.EOF)
+	}
+	var (
+		data []byte
+		ok   bool
+	)
+	select {
+	case data, ok = <-cs.toClient:
+	case <-cs.ctx.Done():
+		return cs.end(status.FromContextError(cs.ctx.Err()).Err())
+	}
+	if !ok {
+		cs.mu.Lock()
+		err := cs.err
+		cs.mu.Unlock()
+		if err == nil {
+			if !cs.desc.ServerStreams {
+				err = xerror.New(code.Code_INTERNAL, "no response message")
+			} else {
+				err = io.EOF
+			}
+		}
+		return cs.end(err)
+	}
+	cs.recvOnce = true
+	if err := marshaler.MarshalerForValue(m).Unmarshal(data, m); err != nil {
+		return cs.end(err)
+	}
+	cs.statsHandler.HandleRPC(cs.ctx, &stats.RPCInPayloadBase{
+		Client:        true,
+		Payload:       m,
+		Data:          data,
+		TransportSize: len(data),
+		RecvTime:      time.Now(),
+		Protocol:      Protocol,
+	})
+	if !cs.desc.ServerStreams {
+		// Unary responses complete with their status, so wait for the
+		// trailer before returning.
+		select {
+		case <-cs.finished:
+		case <-cs.ctx.Done():
+			return cs.end(status.FromContextError(cs.ctx.Err()).Err())
+		}
+		cs.end(nil)
+	}
+	return nil
+}
+
+// end reports the end of the stream to the stats handler once and returns
+// err.
+func (cs *clientStream) end(err error) error {
+	cs.endOnce.Do(func() {
+		cs.mu.Lock()
+		header, trailer := cs.header, cs.trailer
+		cs.mu.Unlock()
+		cs.statsHandler.HandleRPC(cs.ctx, &stats.RPCClientInHeaderBase{
+			RPCInHeaderBase: stats.RPCInHeaderBase{Header: header, Protocol: Protocol},
+		})
+		if trailer.Len() > 0 {
+			cs.statsHandler.HandleRPC(cs.ctx, &stats.RPCInTrailerBase{
+				Client:   true,
+				Trailer:  trailer,
+				Protocol: Protocol,
+			})
+		}
+		endErr := err
+		if endErr == io.EOF {
+			endErr = nil
+		}
+		cs.statsHandler.HandleRPC(cs.ctx, &stats.RPCEndBase{
+			Client:    true,
+			BeginTime: cs.begin,
+			EndTime:   time.Now(),
+			Err:       endErr,
+			Protocol:  Protocol,
+		})
+	})
+	return err
+}
+
+type serverStream struct {
+	*pipe
+	address      string
+	ctx          context.Context
+	cancel       context.CancelFunc
+	statsHandler stats.Handler
+	record       func(Call)
+	begin        time.Time
+
+	smu          sync.Mutex
+	started      bool
+	serverStream bool
+	headerSent   bool
+	done         bool
+}
+
+func newServerStream(
+	p *pipe,
+	address string,
+	statsHandler stats.Handler,
+	record func(Call),
+) *serverStream {
+	// Like a network hop, the server context shares no values with the
+	// client's; only the deadline and cancellation cross the pipe.
+	ctx := context.Background()
+	var cancel context.CancelFunc
+	if deadline, ok := p.ctx.Deadline(); ok {
+		ctx, cancel = context.WithDeadline(ctx, deadline)
+	} else {
+		ctx, cancel = context.WithCancel(ctx)
+	}
+	stop := context.AfterFunc(p.ctx, cancel)
+	ctx = metadata.WithInContext(ctx, p.inMD.Copy())
+	ctx = statsHandler.TagRPC(ctx, &stats.RPCTagInfoBase{FullMethod: p.method})
+	ctx = metadata.WithStreamContext(ctx)
+	ctx = peer.WithContext(ctx, &peer.Peer{
+		Addr:      memAddr("client"),
+		LocalAddr: memAddr(address),
+		AuthInfo: security.BasicAuthInfo{
+			CommonAuthInfo: security.CommonAuthInfo{SecurityLevel: security.NoSecurity},
+			Type:           string(security.ModeInsecure),
+		},
+		Protocol: Protocol,
+	})
+	return &serverStream{
+		pipe:    p,
+		address: address,
+		ctx:     ctx,
+		cancel: func() {
+			stop()
+			cancel()
+		},
+		statsHandler: statsHandler,
+		record:       record,
+		begin:        time.Now(),
+	}
+}
+
+func (ss *serverStream) Method() string {
+	return ss.method
+}
+
+func (ss *serverStream) Context() context.Context {
+	return ss.ctx
+}
+
+func (ss *serverStream) Start(isClientStream, isServerStream bool) error {
+	ss.smu.Lock()
+	defer ss.smu.Unlock()
+	if ss.started {
+		return xerror.New(code.Code_FAILED_PRECONDITION, "stream already started")
+	}
+	ss.started = true
+	ss.serverStream = isServerStream
+	ss.statsHandler.HandleRPC(ss.ctx, &stats.RPCBeginBase{
+		BeginTime:    ss.begin,
+		ClientStream: isClientStream,
+		ServerStream: isServerStream,
+		Protocol:     Protocol,
+	})
+	ss.statsHandler.HandleRPC(ss.ctx, &stats.RPCServerInHeaderBase{
+		RPCInHeaderBase: stats.RPCInHeaderBase{Header: ss.inMD, Protocol: Protocol},
+		FullMethod:      ss.method,
+		RemoteEndpoint:  "client",
+		LocalEndpoint:   ss.address,
+	})
+	return nil
+}
+
+func (ss *serverStream) SetHeader(md metadata.MD) error {
+	ss.smu.Lock()
+	defer ss.smu.Unlock()
+	if ss.headerSent {
+		return xerror.New(code.Code_FAILED_PRECONDITION, "header already sent")
+	}
+	ss.mu.Lock()
+	ss.header = metadata.Join(ss.header, md)
+	ss.mu.Unlock()
+	return nil
+}
+
+func (ss *serverStream) SendHeader(md metadata.MD) error {
+	if err := ss.SetHeader(md); err != nil {
+		return err
+	}
+	ss.smu.Lock()
+	defer ss.smu.Unlock()
+	ss.sendHeaderLocked()
+	return nil
+}
+
+func (ss *serverStream) sendHeaderLocked() {
+	if ss.headerSent {
+		return
+	}
+	ss.headerSent = true
+	close(ss.headerReady)
+}
+
+func (ss *serverStream) SetTrailer(md metadata.MD) {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+	ss.trailer = metadata.Join(ss.trailer, md)
+}
+
+func (ss *serverStream) SendMsg(m any) error {
+	data, err := marshaler.MarshalerForValue(m).Marshal(m)
+	if err != nil {
+		return err
+	}
+	ss.smu.Lock()
+	ss.sendHeaderLocked()
+	ss.smu.Unlock()
+	select {
+	case ss.toClient <- data:
+	case <-ss.ctx.Done():
+		return status.FromContextError(ss.ctx.Err()).Err()
+	}
+	ss.statsHandler.HandleRPC(ss.ctx, &stats.RPCOutPayloadBase{
+		Payload:       m,
+		Data:          data,
+		TransportSize: len(data),
+		SendTime:      time.Now(),
+		Protocol:      Protocol,
+	})
+	return nil
+}
+
+func (ss *serverStream) RecvMsg(m any) error {
+	select {
+	case data, ok := <-ss.toServer:
+		if !ok {
+			return io.EOF
+		}
+		if err := marshaler.MarshalerForValue(m).Unmarshal(data, m); err != nil {
+			return err
+		}
+		ss.statsHandler.HandleRPC(ss.ctx, &stats.RPCInPayloadBase{
+			Payload:       m,
+			Data:          data,
+			TransportSize: len(data),
+			RecvTime:      time.Now(),
+			Protocol:      Protocol,
+		})
+		return nil
+	case <-ss.ctx.Done():
+		return status.FromContextError(ss.ctx.Err()).Err()
+	}
+}
+
+// Finish sends the unary reply, if any, and completes the stream with err.
+// Only the first call has an effect.
+func (ss *serverStream) Finish(reply any, err error) {
+	ss.smu.Lock()
+	if ss.done {
+		ss.smu.Unlock()
+		return
+	}
+	ss.done = true
+	serverStream, started := ss.serverStream, ss.started
+	ss.sendHeaderLocked()
+	ss.smu.Unlock()
+
+	if err == nil && reply != nil && !serverStream {
+		err = ss.SendMsg(reply)
+	}
+	ss.mu.Lock()
+	ss.err = err
+	call := Call{
+		Method:   ss.method,
+		Incoming: ss.inMD.Copy(),
+		Header:   ss.header.Copy(),
+		Trailer:  ss.trailer.Copy(),
+		Err:      err,
+	}
+	ss.mu.Unlock()
+	close(ss.toClient)
+	close(ss.finished)
+	if started {
+		ss.statsHandler.HandleRPC(ss.ctx, &stats.OutHeaderBase{
+			Header:   call.Header,
+			Protocol: Protocol,
+		})
+		if call.Trailer.Len() > 0 {
+			ss.statsHandler.HandleRPC(ss.ctx, &stats.OutTrailerBase{Trailer: call.Trailer})
+		}
+		ss.statsHandler.HandleRPC(ss.ctx, &stats.RPCEndBase{
+			BeginTime: ss.begin,
+			EndTime:   time.Now(),
+			Err:       err,
+			Protocol:  Protocol,
+		})
+	}
+	if ss.record != nil {
+		ss.record(call)
+	}
+}
@@ -0,0 +1,222 @@
+// Copyright 2022 The codesjoy Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package yggdrasiltest runs a full Yggdrasil server and a connected client
+// in one process, so integration tests need neither real ports nor config
+// files.
+//
+// The server is built from the same runtime as a regular App, with its
+// interceptor chains, stats handlers and metadata propagation, but serves over
+// an in-memory transport:
+//
+//	ts := yggdrasiltest.StartTestServer(t,
+//		yggdrasiltest.WithServiceDesc(&pb.GreeterServiceDesc, &greeter{}),
+//	)
+//	reply := new(pb.HelloReply)
+//	err := ts.Client().Invoke(ctx, "/pkg.Greeter/SayHello", req, reply)
+//	yggdrasiltest.RequireCode(t, err, code.Code_OK)
+package yggdrasiltest
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/codesjoy/yggdrasil/v3/app"
+	"github.com/codesjoy/yggdrasil/v3/config"
+	"github.com/codesjoy/yggdrasil/v3/config/source/memory"
+	"github.com/codesjoy/yggdrasil/v3/discovery/resolver"
+	"github.com/codesjoy/yggdrasil/v3/rpc/metadata"
+	"github.com/codesjoy/yggdrasil/v3/transport/runtime/client"
+	"github.com/codesjoy/yggdrasil/v3/transport/runtime/server"
+)
+
+const (
+	appName = "yggdrasiltest"
+	// Target is the service name the test client is created for; client
+	// settings under yggdrasil.clients.services.yggdrasiltest apply to it.
+	Target = "yggdrasiltest"
+)
+
+var addressSeq atomic.Uint64
+
+// Call is one RPC as completed by the test server.
+type Call struct {
+	// Method is the full method name, e.g. "/pkg.Service/Method".
+	Method string
+	// Incoming is the metadata the client sent.
+	Incoming metadata.MD
+	// Header and Trailer are the metadata the server sent back.
+	Header  metadata.MD
+	Trailer metadata.MD
+	// Err is the status the server completed the call with.
+	Err error
+}
+
+type serviceBinding struct {
+	desc *server.ServiceDesc
+	impl any
+}
+
+type options struct {
+	services []serviceBinding
+	config   map[string]any
+}
+
+// Option configures StartTestServer.
+type Option func(*options)
+
+// WithServiceDesc registers impl as the implementation of desc.
+func WithServiceDesc(desc *server.ServiceDesc, impl any) Option {
+	return func(o *options) {
+		o.services = append(o.services, serviceBinding{desc: desc, impl: impl})
+	}
+}
+
+// WithConfig loads data as the configuration of the test App, e.g.
+// interceptor chains under yggdrasil.server.interceptors. Server transports
+// and the client endpoints are always replaced by the in-memory ones.
+func WithConfig(data map[string]any) Option {
+	return func(o *options) {
+		o.config = data
+	}
+}
+
+// TestServer is a running in-memory server with a connected client.
+type TestServer struct {
+	address string
+	server  server.Server
+	client  client.Client
+
+	mu    sync.Mutex
+	calls []Call
+}
+
+// StartTestServer starts a server with the given services on an in-memory
+// transport and connects a client to it. Both are stopped when the test
+// ends.
+func StartTestServer(t testing.TB, opts ...Option) *TestServer {
+	t.Helper()
+	var o options
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	manager := config.NewManager()
+	if o.config != nil {
+		src := memory.NewSource(appName, o.config)
+		if err := manager.LoadLayer(appName, config.PriorityOverride, src); err != nil {
+			t.Fatalf("yggdrasiltest: load config: %v", err)
+		}
+	}
+	a, err := app.New(appName, app.WithConfigManager(manager))
+	if err != nil {
+		t.Fatalf("yggdrasiltest: new app: %v", err)
+	}
+	ctx := context.Background()
+	if err = a.Prepare(ctx); err != nil {
+		t.Fatalf("yggdrasiltest: prepare app: %v", err)
+	}
+	t.Cleanup(func() { _ = a.Stop(context.Background()) })
+
+	ts := &TestServer{address: fmt.Sprintf("%s-%d", appName, addressSeq.Add(1))}
+	snapshot := a.Snapshot()
+	snapshot.TransportServerProviders[Protocol] = serverProvider(
+		ts.address,
+		snapshot.ServerStatsHandler(),
+		ts.record,
+	)
+	snapshot.TransportClientProviders[Protocol] = clientProvider()
+	snapshot.Resolved.Server.Transports = []string{Protocol}
+	snapshot.Resolved.Server.RestEnabled = false
+	services := maps.Clone(snapshot.Resolved.Clients.Services)
+	if services == nil {
+		services = map[string]client.ServiceSettings{}
+	}
+	target := services[Target]
+	target.Resolver = ""
+	target.Remote.Endpoints = []resolver.BaseEndpoint{{Address: ts.address, Protocol: Protocol}}
+	services[Target] = target
+	snapshot.Resolved.Clients.Services = services
+
+	if ts.server, err = server.New(snapshot); err != nil {
+		t.Fatalf("yggdrasiltest: new server: %v", err)
+	}
+	for _, item := range o.services {
+		ts.server.RegisterService(item.desc, item.impl)
+	}
+	started := make(chan struct{})
+	served := make(chan error, 1)
+	go func() { served <- ts.server.Serve(started) }()
+	<-started
+	select {
+	case err = <-served:
+		if err != nil {
+			t.Fatalf("yggdrasiltest: serve: %v", err)
+		}
+	default:
+	}
+	t.Cleanup(func() {
+		_ = ts.server.Stop(context.Background())
+		<-served
+	})
+
+	if ts.client, err = client.New(ctx, Target, snapshot); err != nil {
+		t.Fatalf("yggdrasiltest: new client: %v", err)
+	}
+	t.Cleanup(func() { _ = ts.client.Close() })
+	return ts
+}
+
+// Client returns the client connected to the server.
+func (s *TestServer) Client() client.Client {
+	return s.client
+}
+
+// Server returns the server runtime, e.g. to register more services.
+func (s *TestServer) Server() server.Server {
+	return s.server
+}
+
+// Address returns the in-memory address of the server.
+func (s *TestServer) Address() string {
+	return s.address
+}
+
+// Calls returns the completed calls in completion order.
+func (s *TestServer) Calls() []Call {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Call(nil), s.calls...)
+}
+
+// LastCall returns the most recently completed call and fails the test when
+// there is none.
+func (s *TestServer) LastCall(t testing.TB) Call {
+	t.Helper()
+	calls := s.Calls()
+	if len(calls) == 0 {
+		t.Fatalf("yggdrasiltest: no call completed")
+	}
+	return calls[len(calls)-1]
+}
+
+func (s *TestServer) record(call Call) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.calls = append(s.calls, call)
+}
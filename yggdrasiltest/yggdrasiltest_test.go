@@ -0,0 +1,210 @@
+// Copyright 2022 The codesjoy Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package yggdrasiltest_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/genproto/googleapis/rpc/code"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+
+	"github.com/codesjoy/yggdrasil/v3/rpc/interceptor"
+	"github.com/codesjoy/yggdrasil/v3/rpc/metadata"
+	"github.com/codesjoy/yggdrasil/v3/rpc/status"
+	"github.com/codesjoy/yggdrasil/v3/rpc/stream"
+	"github.com/codesjoy/yggdrasil/v3/transport/runtime/client"
+	"github.com/codesjoy/yggdrasil/v3/transport/runtime/server"
+	"github.com/codesjoy/yggdrasil/v3/yggdrasiltest"
+)
+
+type echoService interface {
+	Echo(context.Context, *wrapperspb.StringValue) (*wrapperspb.StringValue, error)
+	Split(*wrapperspb.StringValue, stream.ServerStream) error
+}
+
+type echoServer struct{}
+
+func (echoServer) Echo(
+	ctx context.Context,
+	in *wrapperspb.StringValue,
+) (*wrapperspb.StringValue, error) {
+	switch in.GetValue() {
+	case "fail":
+		return nil, status.New(code.Code_FAILED_PRECONDITION, "asked to fail").Err()
+	case "slow":
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}
+	md, _ := metadata.FromInContext(ctx)
+	_ = metadata.SetHeader(ctx, metadata.Pairs("x-echo", md.Get("x-request")[0]))
+	_ = metadata.SetTrailer(ctx, metadata.Pairs("x-done", "yes"))
+	return wrapperspb.String("echo: " + in.GetValue()), nil
+}
+
+func (echoServer) Split(in *wrapperspb.StringValue, ss stream.ServerStream) error {
+	for _, r := range in.GetValue() {
+		if err := ss.SendMsg(wrapperspb.String(string(r))); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+var echoServiceDesc = server.ServiceDesc{
+	ServiceName: "test.Echo",
+	HandlerType: (*echoService)(nil),
+	Methods: []server.MethodDesc{{
+		MethodName: "Echo",
+		Handler: func(
+			srv any,
+			ctx context.Context,
+			dec func(any) error,
+			unary interceptor.UnaryServerInterceptor,
+		) (any, error) {
+			in := new(wrapperspb.StringValue)
+			if err := dec(in); err != nil {
+				return nil, err
+			}
+			info := &interceptor.UnaryServerInfo{Server: srv, FullMethod: "/test.Echo/Echo"}
+			return unary(ctx, in, info, func(ctx context.Context, req any) (any, error) {
+				return srv.(echoService).Echo(ctx, req.(*wrapperspb.StringValue))
+			})
+		},
+	}},
+	Streams: []stream.Desc{{
+		StreamName: "Split",
+		Handler: func(srv any, ss stream.ServerStream) error {
+			in := new(wrapperspb.StringValue)
+			if err := ss.RecvMsg(in); err != nil {
+				return err
+			}
+			return srv.(echoService).Split(in, ss)
+		},
+		ServerStreams: true,
+	}},
+}
+
+func TestUnaryCallPropagatesMetadata(t *testing.T) {
+	ts := yggdrasiltest.StartTestServer(
+		t,
+		yggdrasiltest.WithServiceDesc(&echoServiceDesc, echoServer{}),
+	)
+
+	ctx := metadata.WithOutContext(context.Background(), metadata.Pairs("x-request", "r1"))
+	var header, trailer metadata.MD
+	reply := new(wrapperspb.StringValue)
+	err := ts.Client().Invoke(
+		ctx,
+		"/test.Echo/Echo",
+		wrapperspb.String("hi"),
+		reply,
+		client.Header(&header),
+		client.Trailer(&trailer),
+	)
+	yggdrasiltest.RequireCode(t, err, code.Code_OK)
+	assert.Equal(t, "echo: hi", reply.GetValue())
+	yggdrasiltest.RequireMetadata(t, header, "x-echo", "r1")
+	yggdrasiltest.RequireMetadata(t, trailer, "x-done", "yes")
+
+	call := ts.LastCall(t)
+	assert.Equal(t, "/test.Echo/Echo", call.Method)
+	yggdrasiltest.RequireMetadata(t, call.Incoming, "x-request", "r1")
+	yggdrasiltest.RequireMetadata(t, call.Header, "x-echo", "r1")
+	assert.NoError(t, call.Err)
+}
+
+func TestUnaryCallStatuses(t *testing.T) {
+	ts := yggdrasiltest.StartTestServer(
+		t,
+		yggdrasiltest.WithServiceDesc(&echoServiceDesc, echoServer{}),
+	)
+
+	err := ts.Client().Invoke(
+		context.Background(),
+		"/test.Echo/Echo",
+		wrapperspb.String("fail"),
+		new(wrapperspb.StringValue),
+	)
+	yggdrasiltest.RequireStatus(t, err, code.Code_FAILED_PRECONDITION, "asked to fail")
+	yggdrasiltest.RequireCode(t, ts.LastCall(t).Err, code.Code_FAILED_PRECONDITION)
+
+	err = ts.Client().Invoke(
+		context.Background(),
+		"/test.Echo/Missing",
+		wrapperspb.String("x"),
+		new(wrapperspb.StringValue),
+	)
+	yggdrasiltest.RequireCode(t, err, code.Code_UNIMPLEMENTED)
+	assert.Len(t, ts.Calls(), 2)
+}
+
+func TestServerStream(t *testing.T) {
+	ts := yggdrasiltest.StartTestServer(
+		t,
+		yggdrasiltest.WithServiceDesc(&echoServiceDesc, echoServer{}),
+	)
+
+	desc := &echoServiceDesc.Streams[0]
+	cs, err := ts.Client().NewStream(context.Background(), desc, "/test.Echo/Split")
+	require.NoError(t, err)
+	require.NoError(t, cs.SendMsg(wrapperspb.String("abc")))
+	require.NoError(t, cs.CloseSend())
+	var got []string
+	for {
+		msg := new(wrapperspb.StringValue)
+		err = cs.RecvMsg(msg)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		require.NoError(t, err)
+		got = append(got, msg.GetValue())
+	}
+	assert.Equal(t, []string{"a", "b", "c"}, got)
+}
+
+func TestConfiguredInterceptors(t *testing.T) {
+	ts := yggdrasiltest.StartTestServer(t,
+		yggdrasiltest.WithServiceDesc(&echoServiceDesc, echoServer{}),
+		yggdrasiltest.WithConfig(map[string]any{
+			"yggdrasil": map[string]any{
+				"server": map[string]any{
+					"interceptors": map[string]any{"unary": []any{"timeout"}},
+				},
+				"extensions": map[string]any{
+					"interceptors": map[string]any{
+						"config": map[string]any{
+							"timeout": map[string]any{
+								"server": map[string]any{"/test.Echo/Echo": "20ms"},
+							},
+						},
+					},
+				},
+			},
+		}),
+	)
+
+	err := ts.Client().Invoke(
+		context.Background(),
+		"/test.Echo/Echo",
+		wrapperspb.String("slow"),
+		new(wrapperspb.StringValue),
+	)
+	yggdrasiltest.RequireCode(t, err, code.Code_DEADLINE_EXCEEDED)
+}